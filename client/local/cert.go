@@ -15,6 +15,7 @@
 	"time"
 
 	"go4.org/mem"
+	"tailscale.com/client/tailscale/apitype"
 )
 
 // SetDNS adds a DNS TXT record for the given domain name, containing
@@ -67,7 +68,14 @@ func (lc *Client) CertPair(ctx context.Context, domain string) (certPEM, keyPEM
 //
 // API maturity: this is considered a stable API.
 func (lc *Client) CertPairWithValidity(ctx context.Context, domain string, minValidity time.Duration) (certPEM, keyPEM []byte, err error) {
-	res, err := lc.send(ctx, "GET", fmt.Sprintf("/localapi/v0/cert/%s?type=pair&min_validity=%s", domain, minValidity), 200, nil)
+	return lc.CertPairWithKeyType(ctx, domain, "", minValidity)
+}
+
+// CertPairWithKeyType is like [Client.CertPairWithValidity], but returns a
+// cert for a private key of the given type: "ecdsa" (ECDSA P-256, used if
+// keyType is empty) or "rsa" (2048 bit RSA, for older TLS clients).
+func (lc *Client) CertPairWithKeyType(ctx context.Context, domain, keyType string, minValidity time.Duration) (certPEM, keyPEM []byte, err error) {
+	res, err := lc.send(ctx, "GET", certPath(domain, "pair", keyType, minValidity), 200, nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -85,6 +93,33 @@ func (lc *Client) CertPairWithValidity(ctx context.Context, domain string, minVa
 	return certPEM, keyPEM, nil
 }
 
+// CertChain returns the certificate chain and private key for the provided
+// DNS domain, for a private key of the given type (see
+// [Client.CertPairWithKeyType]). Unlike CertPairWithKeyType, it returns
+// them DER encoded, ready to use in a [tls.Certificate].
+//
+// It returns a cached certificate from disk if it's still valid, and for at
+// least minValidity if non-zero.
+func (lc *Client) CertChain(ctx context.Context, domain, keyType string, minValidity time.Duration) (*apitype.CertChain, error) {
+	res, err := lc.send(ctx, "GET", certPath(domain, "json", keyType, minValidity), 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*apitype.CertChain](res)
+}
+
+// certPath returns the LocalAPI path to request the given type of output
+// for a cert for domain.
+func certPath(domain, typ, keyType string, minValidity time.Duration) string {
+	v := url.Values{}
+	v.Set("type", typ)
+	v.Set("min_validity", minValidity.String())
+	if keyType != "" {
+		v.Set("key_type", keyType)
+	}
+	return "/localapi/v0/cert/" + domain + "?" + v.Encode()
+}
+
 // GetCertificate fetches a TLS certificate for the TLS ClientHello in hi.
 //
 // It returns a cached certificate from disk if it's still valid.
@@ -43,6 +43,7 @@
 	"tailscale.com/types/appctype"
 	"tailscale.com/types/dnstype"
 	"tailscale.com/types/key"
+	"tailscale.com/types/netstacktype"
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/eventbus"
 )
@@ -696,6 +697,16 @@ func (lc *Client) StatusWithoutPeers(ctx context.Context) (*ipnstate.Status, err
 	return lc.status(ctx, "?peers=false")
 }
 
+// Usage returns the number of bytes Tailscale itself sent and received in
+// recent hours and days.
+func (lc *Client) Usage(ctx context.Context) (*ipnstate.UsageReport, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/usage")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*ipnstate.UsageReport](body)
+}
+
 func (lc *Client) status(ctx context.Context, queryString string) (*ipnstate.Status, error) {
 	body, err := lc.get200(ctx, "/localapi/v0/status"+queryString)
 	if err != nil {
@@ -893,6 +904,16 @@ func (lc *Client) EditPrefs(ctx context.Context, mp *ipn.MaskedPrefs) (*ipn.Pref
 	return decodeJSON[*ipn.Prefs](body)
 }
 
+// AuditLog returns the records of tailscaled's local audit log of mutating
+// LocalAPI calls, oldest first. It requires admin access.
+func (lc *Client) AuditLog(ctx context.Context) ([]apitype.LocalAPIAuditRecord, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/audit-log")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]apitype.LocalAPIAuditRecord](body)
+}
+
 // GetDNSOSConfig returns the system DNS configuration for the current device.
 // That is, it returns the DNS configuration that the system would use if Tailscale weren't being used.
 func (lc *Client) GetDNSOSConfig(ctx context.Context) (*apitype.DNSOSConfig, error) {
@@ -917,15 +938,28 @@ func (lc *Client) QueryDNS(ctx context.Context, name string, queryType string) (
 	if !buildfeatures.HasDNS {
 		return nil, nil, feature.ErrUnavailable
 	}
-	body, err := lc.get200(ctx, fmt.Sprintf("/localapi/v0/dns-query?name=%s&type=%s", url.QueryEscape(name), queryType))
+	res, err := lc.QueryDNSTrace(ctx, name, queryType)
 	if err != nil {
 		return nil, nil, err
 	}
+	return res.Bytes, res.Resolvers, nil
+}
+
+// QueryDNSTrace is like QueryDNS, but returns the whole response, including
+// the trace of how the query was resolved, if the node reports it.
+func (lc *Client) QueryDNSTrace(ctx context.Context, name string, queryType string) (*apitype.DNSQueryResponse, error) {
+	if !buildfeatures.HasDNS {
+		return nil, feature.ErrUnavailable
+	}
+	body, err := lc.get200(ctx, fmt.Sprintf("/localapi/v0/dns-query?name=%s&type=%s", url.QueryEscape(name), queryType))
+	if err != nil {
+		return nil, err
+	}
 	var res apitype.DNSQueryResponse
 	if err := json.Unmarshal(body, &res); err != nil {
-		return nil, nil, fmt.Errorf("invalid query response: %w", err)
+		return nil, fmt.Errorf("invalid query response: %w", err)
 	}
-	return res.Bytes, res.Resolvers, nil
+	return &res, nil
 }
 
 // StartLoginInteractive starts an interactive login.
@@ -1229,6 +1263,26 @@ func (lc *Client) DeleteProfile(ctx context.Context, profile ipn.ProfileID) erro
 	return err
 }
 
+// ExportProfile returns the given profile and its prefs in a form that can
+// be passed to [Client.ImportProfile] on another machine. The node's keys
+// and prefs specific to this machine aren't included.
+func (lc *Client) ExportProfile(ctx context.Context, profile ipn.ProfileID) (*ipn.ProfileExport, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/profiles/"+url.PathEscape(string(profile))+"/export")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*ipn.ProfileExport](body)
+}
+
+// ImportProfile creates and switches to a new profile with the prefs from ex,
+// as returned by [Client.ExportProfile]. The prefs are validated and subject
+// to system policy as with [Client.EditPrefs]. The new profile is logged out;
+// the user must call LoginInteractive to log in to it as a new node.
+func (lc *Client) ImportProfile(ctx context.Context, ex *ipn.ProfileExport) error {
+	_, err := lc.send(ctx, "POST", "/localapi/v0/profiles/import", http.StatusCreated, jsonBody(ex))
+	return err
+}
+
 // QueryFeature makes a request for instructions on how to enable
 // a feature, such as Funnel, for the node's tailnet. If relevant,
 // this includes a control server URL the user can visit to enable
@@ -1268,6 +1322,85 @@ func (lc *Client) DebugPacketFilterRules(ctx context.Context) ([]tailcfg.FilterR
 	return decodeJSON[[]tailcfg.FilterRule](body)
 }
 
+// DebugLatencyMatrix tests reachability and latency from this node to each
+// of the peers with the Tailscale IPs in targets. If mesh is true, it also asks
+// each of those peers to test the others.
+func (lc *Client) DebugLatencyMatrix(ctx context.Context, targets []netip.Addr, mesh bool) (*ipnstate.LatencyMatrix, error) {
+	v := url.Values{"mesh": {strconv.FormatBool(mesh)}}
+	for _, ip := range targets {
+		v.Add("ip", ip.String())
+	}
+	body, err := lc.send(ctx, "POST", "/localapi/v0/debug-latency-matrix?"+v.Encode(), 200, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error %w: %s", err, body)
+	}
+	return decodeJSON[*ipnstate.LatencyMatrix](body)
+}
+
+// DebugDERPFailoverDrill makes this node's home DERP region unavailable for
+// up to timeout, or a default if zero, and reports how long it took to choose
+// a new home region and to reach each of the peers with the Tailscale IPs in
+// targets again. The old home region is made available again before it
+// returns.
+func (lc *Client) DebugDERPFailoverDrill(ctx context.Context, targets []netip.Addr, timeout time.Duration) (*ipnstate.DERPFailoverDrill, error) {
+	v := url.Values{}
+	if timeout > 0 {
+		v.Set("timeout", timeout.String())
+	}
+	for _, ip := range targets {
+		v.Add("ip", ip.String())
+	}
+	body, err := lc.send(ctx, "POST", "/localapi/v0/debug-derp-failover-drill?"+v.Encode(), 200, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error %w: %s", err, body)
+	}
+	return decodeJSON[*ipnstate.DERPFailoverDrill](body)
+}
+
+// DebugNetstackTCPConfig returns the TCP configuration of the userspace
+// network stack.
+func (lc *Client) DebugNetstackTCPConfig(ctx context.Context) (*netstacktype.TCPConfig, error) {
+	body, err := lc.send(ctx, "GET", "/localapi/v0/debug-netstack-tcp", 200, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error %w: %s", err, body)
+	}
+	return decodeJSON[*netstacktype.TCPConfig](body)
+}
+
+// DebugSetNetstackTCPConfig replaces the TCP configuration of the userspace
+// network stack with c. Zero fields of c use the platform defaults. It
+// returns the resulting configuration.
+func (lc *Client) DebugSetNetstackTCPConfig(ctx context.Context, c netstacktype.TCPConfig) (*netstacktype.TCPConfig, error) {
+	body, err := lc.send(ctx, "POST", "/localapi/v0/debug-netstack-tcp", 200, jsonBody(c))
+	if err != nil {
+		return nil, fmt.Errorf("error %w: %s", err, body)
+	}
+	return decodeJSON[*netstacktype.TCPConfig](body)
+}
+
+// DebugEnv returns the envknobs and control knobs in effect in tailscaled.
+// If all is true, it also returns registered envknobs that aren't set.
+func (lc *Client) DebugEnv(ctx context.Context, all bool) ([]apitype.DebugKnob, error) {
+	v := url.Values{"all": {strconv.FormatBool(all)}}
+	body, err := lc.send(ctx, "GET", "/localapi/v0/debug-env?"+v.Encode(), 200, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error %w: %s", err, body)
+	}
+	return decodeJSON[[]apitype.DebugKnob](body)
+}
+
+// DebugSetEnv changes the value of the named envknob in tailscaled until it
+// restarts. An empty value unsets it. Only some knobs can be changed; see
+// [apitype.DebugKnob.Settable]. It returns the knobs then in effect.
+func (lc *Client) DebugSetEnv(ctx context.Context, name, value string) ([]apitype.DebugKnob, error) {
+	v := url.Values{"name": {name}, "value": {value}}
+	body, err := lc.send(ctx, "POST", "/localapi/v0/debug-env?"+v.Encode(), 200, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error %w: %s", err, body)
+	}
+	return decodeJSON[[]apitype.DebugKnob](body)
+}
+
 // DebugSetExpireIn marks the current node key to expire in d.
 //
 // This is meant primarily for debug and testing.
@@ -1292,7 +1425,21 @@ func (lc *Client) DebugPeerRelaySessions(ctx context.Context) (*status.ServerSta
 // The provided context does not determine the lifetime of the
 // returned [io.ReadCloser].
 func (lc *Client) StreamDebugCapture(ctx context.Context) (io.ReadCloser, error) {
-	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+apitype.LocalAPIHost+"/localapi/v0/debug-capture", nil)
+	return lc.streamDebugCapture(ctx, "/localapi/v0/debug-capture")
+}
+
+// StreamDebugCaptureDropped streams a pcapng-formatted capture of only the
+// packets dropped by the packet filter, each with the reason it was dropped
+// as its comment.
+//
+// The provided context does not determine the lifetime of the
+// returned [io.ReadCloser].
+func (lc *Client) StreamDebugCaptureDropped(ctx context.Context) (io.ReadCloser, error) {
+	return lc.streamDebugCapture(ctx, "/localapi/v0/debug-capture?dropped=true")
+}
+
+func (lc *Client) streamDebugCapture(ctx context.Context, path string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+apitype.LocalAPIHost+path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -1461,6 +1608,38 @@ func (lc *Client) SuggestExitNode(ctx context.Context) (apitype.ExitNodeSuggesti
 	return decodeJSON[apitype.ExitNodeSuggestionResponse](body)
 }
 
+// SuggestExitNodeOpts contains options for an exit node suggestion request.
+//
+// The zero value is valid, which means to consider all exit nodes.
+type SuggestExitNodeOpts struct {
+	// Country, if non-empty, restricts the suggestion to exit nodes in the
+	// country with this name or ISO 3166-1 alpha-2 code.
+	Country string
+
+	// Tag, if non-empty, restricts the suggestion to exit nodes with this
+	// tag, such as "tag:exit".
+	Tag string
+}
+
+// SuggestExitNodeWithOpts is like SuggestExitNode, but only considers the exit
+// nodes matching opts, and the response also includes all the exit nodes
+// considered, with how they scored. Unlike SuggestExitNode, it doesn't change
+// the exit node that auto exit node mode uses.
+func (lc *Client) SuggestExitNodeWithOpts(ctx context.Context, opts SuggestExitNodeOpts) (apitype.ExitNodeSuggestionResponse, error) {
+	v := url.Values{"candidates": {"true"}}
+	if opts.Country != "" {
+		v.Set("country", opts.Country)
+	}
+	if opts.Tag != "" {
+		v.Set("tag", opts.Tag)
+	}
+	body, err := lc.get200(ctx, "/localapi/v0/suggest-exit-node?"+v.Encode())
+	if err != nil {
+		return apitype.ExitNodeSuggestionResponse{}, err
+	}
+	return decodeJSON[apitype.ExitNodeSuggestionResponse](body)
+}
+
 // CheckSOMarkInUse reports whether the socket mark option is in use. This will only
 // be true if tailscale is running on Linux and tailscaled uses SO_MARK.
 func (lc *Client) CheckSOMarkInUse(ctx context.Context) (bool, error) {
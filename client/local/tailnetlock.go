@@ -193,6 +193,46 @@ func (lc *Client) NetworkLockSubmitRecoveryAUM(ctx context.Context, aum tka.AUM)
 	return nil
 }
 
+// NetworkLockGeneratePendingAUM generates an unsigned AUM which adds or removes
+// a single tailnet lock key, for signing with NetworkLockSignOffline.
+func (lc *Client) NetworkLockGeneratePendingAUM(ctx context.Context, addKeys, removeKeys []tka.Key) ([]byte, error) {
+	vr := struct {
+		AddKeys    []tka.Key
+		RemoveKeys []tka.Key
+	}{addKeys, removeKeys}
+
+	body, err := lc.send(ctx, "POST", "/localapi/v0/tka/generate-pending-aum", 200, jsonBody(vr))
+	if err != nil {
+		return nil, fmt.Errorf("sending generate-pending-aum: %w", err)
+	}
+	return body, nil
+}
+
+// NetworkLockSignOffline signs a pending AUM using the node's tailnet lock key,
+// returning serialized detached signatures. The node need not be connected.
+func (lc *Client) NetworkLockSignOffline(ctx context.Context, aum tka.AUM) ([][]byte, error) {
+	r := bytes.NewReader(aum.Serialize())
+	body, err := lc.send(ctx, "POST", "/localapi/v0/tka/sign-offline", 200, r)
+	if err != nil {
+		return nil, fmt.Errorf("sending sign-offline: %w", err)
+	}
+	return decodeJSON[[][]byte](body)
+}
+
+// NetworkLockSubmitPendingAUM attaches serialized detached signatures to a
+// pending AUM and submits it to the control plane.
+func (lc *Client) NetworkLockSubmitPendingAUM(ctx context.Context, aum tka.AUM, sigs [][]byte) error {
+	vr := struct {
+		AUM        tkatype.MarshaledAUM
+		Signatures [][]byte
+	}{aum.Serialize(), sigs}
+
+	if _, err := lc.send(ctx, "POST", "/localapi/v0/tka/submit-pending-aum", 200, jsonBody(vr)); err != nil {
+		return fmt.Errorf("sending submit-pending-aum: %w", err)
+	}
+	return nil
+}
+
 // NetworkLockDisable shuts down network-lock across the tailnet.
 func (lc *Client) NetworkLockDisable(ctx context.Context, secret []byte) error {
 	if _, err := lc.send(ctx, "POST", "/localapi/v0/tka/disable", 200, bytes.NewReader(secret)); err != nil {
@@ -5,6 +5,8 @@
 package apitype
 
 import (
+	"time"
+
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/dnstype"
 	"tailscale.com/util/ctxkey"
@@ -77,6 +79,37 @@ type ExitNodeSuggestionResponse struct {
 	ID       tailcfg.StableNodeID
 	Name     string
 	Location tailcfg.LocationView `json:",omitempty"`
+
+	// Candidates, if requested, are all the exit nodes that were considered
+	// for the suggestion, best first, with how they scored.
+	Candidates []ExitNodeCandidate `json:",omitempty"`
+}
+
+// ExitNodeCandidate is an exit node that was considered for an exit node
+// suggestion, and how it compared to the others.
+type ExitNodeCandidate struct {
+	ID       tailcfg.StableNodeID
+	Name     string
+	Location tailcfg.LocationView `json:",omitempty"`
+
+	// DERPRegion is the candidate's home DERP region, or zero if it has
+	// none. Candidates with a home DERP region are preferred over those
+	// without, and among them those whose region has the lowest
+	// DERPLatency from this node.
+	DERPRegion  int           `json:",omitempty"`
+	DERPLatency time.Duration `json:",omitempty"` // zero if unknown
+
+	// Distance is the approximate distance, in meters, from this node's
+	// preferred DERP region to the candidate's location, if both are known.
+	// It's used to compare candidates without a home DERP region.
+	Distance float64 `json:",omitempty"`
+
+	// Priority is the priority of the candidate's location. Higher is
+	// better.
+	Priority int `json:",omitempty"`
+
+	// Reason explains why the candidate was or wasn't suggested.
+	Reason string
 }
 
 // DNSOSConfig mimics dns.OSConfig without forcing us to import the entire dns package
@@ -93,6 +126,8 @@ type DNSQueryResponse struct {
 	Bytes []byte
 	// Resolvers is the list of resolvers that the forwarder deemed able to resolve the query.
 	Resolvers []*dnstype.Resolver
+	// Trace describes how the query was resolved, if known.
+	Trace *dnstype.QueryTrace `json:",omitempty"`
 }
 
 // OptionalFeatures describes which optional features are enabled in the build.
@@ -104,3 +139,84 @@ type OptionalFeatures struct {
 	// are not guaranteed to be present.)
 	Features map[string]bool
 }
+
+// DebugKnob is a tweakable setting in effect in tailscaled, as returned by
+// the LocalAPI debug-env endpoint.
+type DebugKnob struct {
+	// Name is the knob's name: an environment variable name for
+	// envknobs, or the field name in controlknobs.Knobs for control knobs.
+	Name string
+
+	// Value is the knob's current value, or empty if it's unset.
+	Value string `json:",omitempty"`
+
+	// Source is where Value came from: "env" for the environment,
+	// "disk" for the tailscaled-env.txt file, "runtime" for a value
+	// set with the debug-env endpoint, or "control" for control knobs.
+	// It's empty if the knob is unset.
+	Source string `json:",omitempty"`
+
+	// RestartRequired is whether tailscaled must be restarted for a
+	// change to the knob to take effect.
+	RestartRequired bool `json:",omitempty"`
+
+	// Settable is whether the knob can be changed at runtime with the
+	// debug-env endpoint.
+	Settable bool `json:",omitempty"`
+}
+
+// CertChain is a TLS certificate chain and its private key, as returned by
+// the LocalAPI cert endpoint with type=json.
+type CertChain struct {
+	// Domain is the domain the certificate was requested for.
+	Domain string
+
+	// KeyType is the type of PrivateKey: "ecdsa" or "rsa".
+	KeyType string
+
+	// Chain is the DER encoded certificate chain, leaf first, as used in
+	// crypto/tls.Certificate.Certificate.
+	Chain [][]byte
+
+	// PrivateKey is the certificate's private key, PKCS #8 DER encoded.
+	PrivateKey []byte
+
+	// NotAfter is when the leaf certificate expires.
+	NotAfter time.Time
+
+	// Cached is whether the certificate came from tailscaled's cache
+	// rather than being newly issued.
+	Cached bool
+}
+
+// LocalAPIAuditRecord is an entry in tailscaled's local audit log of
+// mutating LocalAPI calls, as returned by the LocalAPI audit-log endpoint.
+type LocalAPIAuditRecord struct {
+	// Time is when the call was made.
+	Time time.Time
+
+	// Method and Path are the HTTP method and URL path of the call.
+	Method string
+	Path   string
+
+	// Status is the HTTP status code of the response.
+	Status int
+
+	// User is the name of the OS user that made the call, if known.
+	User string `json:",omitempty"`
+
+	// UID is the OS user ID of the caller, if known: a numeric user ID
+	// on Unix-like platforms, or a SID on Windows.
+	UID string `json:",omitempty"`
+
+	// PID is the process ID of the caller, if known.
+	PID int `json:",omitempty"`
+
+	// Executable is the path to the caller's binary, if known.
+	Executable string `json:",omitempty"`
+
+	// Delegated, if non-empty, is the comma-separated list of permissions
+	// delegated by the control plane (see [tailcfg.NodeAttrLocalOperator])
+	// that permitted a caller without write access to make the call.
+	Delegated string `json:",omitempty"`
+}
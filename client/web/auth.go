@@ -18,6 +18,7 @@
 	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tailcfg"
+	"tailscale.com/util/syspolicy/pkey"
 )
 
 const (
@@ -262,6 +263,9 @@ func (p peerCapabilities) canEdit(feature capFeature) bool {
 	if p[capFeatureAll] {
 		return true
 	}
+	if feature == capFeatureUseExitNode && p[capFeatureExitNodes] {
+		return true
+	}
 	return p[feature]
 }
 
@@ -293,6 +297,12 @@ func (p peerCapabilities) isEmpty() bool {
 	capFeatureSubnets   capFeature = "subnets"   // grants peer subnet routes management
 	capFeatureExitNodes capFeature = "exitnodes" // grants peer ability to advertise-as and use exit nodes
 	capFeatureAccount   capFeature = "account"   // grants peer ability to turn on auto updates and log out of node
+	capFeatureServe     capFeature = "serve"     // grants peer ability to edit the node's serve config
+
+	// capFeatureUseExitNode grants peer ability to choose an exit node to
+	// use, but not to advertise the node as one. It's implied by
+	// capFeatureExitNodes.
+	capFeatureUseExitNode capFeature = "use-exitnode"
 )
 
 // validCaps contains the list of valid capabilities used in the web client.
@@ -304,12 +314,33 @@ func (p peerCapabilities) isEmpty() bool {
 	capFeatureSubnets,
 	capFeatureExitNodes,
 	capFeatureAccount,
+	capFeatureServe,
+	capFeatureUseExitNode,
 }
 
 type capRule struct {
 	CanEdit []string `json:"canEdit,omitempty"` // list of features peer is allowed to edit
 }
 
+// peerCapabilities returns the web ui capabilities of the peer in the given
+// whois response, which are none if the web client is read-only.
+func (s *Server) peerCapabilities(status *ipnstate.Status, whois *apitype.WhoIsResponse) (peerCapabilities, error) {
+	if s.readOnly() {
+		return peerCapabilities{}, nil
+	}
+	return toPeerCapabilities(status, whois)
+}
+
+// readOnly reports whether the management web client has been made read-only
+// by the [pkey.WebClientReadOnly] policy.
+func (s *Server) readOnly() bool {
+	if s.mode != ManageServerMode {
+		return false
+	}
+	ro, _ := s.polc.GetBoolean(pkey.WebClientReadOnly, false)
+	return ro
+}
+
 // toPeerCapabilities parses out the web ui capabilities from the
 // given whois response.
 func toPeerCapabilities(status *ipnstate.Status, whois *apitype.WhoIsResponse) (peerCapabilities, error) {
@@ -0,0 +1,183 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage is the language of the web client's built-in messages.
+const defaultLanguage = "en"
+
+// Catalog is a set of translated web client messages for one language,
+// keyed by message ID.
+//
+// Message IDs are the ones the frontend passes to useTranslate, such as
+// "login.connect"; messages not in the catalog are shown in English.
+// A "{product}" placeholder in a message is replaced with the product name,
+// and other placeholders, such as "{device}", with the values the frontend
+// provides for that message.
+type Catalog map[string]string
+
+// Branding customizes how the web client presents itself, for distributors
+// that ship the web client as part of their own product.
+type Branding struct {
+	// ProductName, if non-empty, replaces "Tailscale" as the product
+	// name shown in the UI.
+	ProductName string
+
+	// Logo, if non-nil, is the image shown in place of the Tailscale
+	// logo.
+	Logo []byte
+
+	// LogoContentType is the MIME type of Logo. If empty, it's
+	// detected from Logo's contents.
+	LogoContentType string
+}
+
+// LoadCatalogs loads message catalogs from the JSON files in the root of
+// fsys. Each file is named after the BCP 47 language tag it translates to
+// (e.g. "de.json" or "pt-BR.json") and contains a JSON object mapping
+// message IDs to translated messages.
+func LoadCatalogs(fsys fs.FS) (map[string]Catalog, error) {
+	ents, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	catalogs := make(map[string]Catalog)
+	for _, ent := range ents {
+		name := ent.Name()
+		if ent.IsDir() || path.Ext(name) != ".json" {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var c Catalog
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		catalogs[strings.TrimSuffix(name, ".json")] = c
+	}
+	return catalogs, nil
+}
+
+// negotiateLanguage returns the language from available that best matches
+// the given Accept-Language header value, or defaultLanguage if none do.
+//
+// A language range matches an available language if they're equal, or if
+// either is a prefix of the other followed by a "-" (so "de" matches
+// "de-CH" and vice versa). Comparisons are case-insensitive.
+func negotiateLanguage(acceptLanguage string, available []string) string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+	var prefs []lang
+	for part := range strings.SplitSeq(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if q > 0 {
+			prefs = append(prefs, lang{tag, q})
+		}
+	}
+	// Stable, so that equally weighted languages keep the client's order.
+	slices.SortStableFunc(prefs, func(a, b lang) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+
+	matches := func(a, b string) bool {
+		return strings.EqualFold(a, b) ||
+			len(a) > len(b) && a[len(b)] == '-' && strings.EqualFold(a[:len(b)], b)
+	}
+	for _, p := range prefs {
+		if i := slices.IndexFunc(available, func(a string) bool { return strings.EqualFold(a, p.tag) }); i >= 0 {
+			return available[i]
+		}
+		for _, a := range available {
+			if matches(a, p.tag) || matches(p.tag, a) {
+				return a
+			}
+		}
+		if matches(p.tag, defaultLanguage) || matches(defaultLanguage, p.tag) {
+			return defaultLanguage
+		}
+	}
+	return defaultLanguage
+}
+
+// uiConfig is the JSON response of /api/ui, describing the language and
+// branding of the web client.
+type uiConfig struct {
+	Language    string  // negotiated BCP 47 language tag
+	Messages    Catalog // translations for Language; empty for defaultLanguage
+	ProductName string  // product name to show; "Tailscale" unless branded
+	HasLogo     bool    // whether a custom logo is served at /api/ui/logo
+}
+
+// serveUIConfig serves the web client's language and branding settings.
+// It doesn't require authorization, so that the login UI can be localized
+// and branded too.
+func (s *Server) serveUIConfig(w http.ResponseWriter, r *http.Request) {
+	langs := make([]string, 0, len(s.catalogs))
+	for lang := range s.catalogs {
+		langs = append(langs, lang)
+	}
+	slices.Sort(langs)
+
+	cfg := uiConfig{
+		Language:    negotiateLanguage(r.Header.Get("Accept-Language"), langs),
+		ProductName: "Tailscale",
+	}
+	cfg.Messages = s.catalogs[cfg.Language]
+	if b := s.branding; b != nil {
+		if b.ProductName != "" {
+			cfg.ProductName = b.ProductName
+		}
+		cfg.HasLogo = len(b.Logo) > 0
+	}
+	w.Header().Set("Vary", "Accept-Language")
+	writeJSON(w, cfg)
+}
+
+// serveUILogo serves the custom logo from the server's Branding, if any.
+func (s *Server) serveUILogo(w http.ResponseWriter, r *http.Request) {
+	b := s.branding
+	if b == nil || len(b.Logo) == 0 {
+		http.Error(w, "no custom logo", http.StatusNotFound)
+		return
+	}
+	ct := b.LogoContentType
+	if ct == "" {
+		ct = http.DetectContentType(b.Logo)
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(b.Logo)
+}
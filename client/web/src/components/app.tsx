@@ -1,9 +1,9 @@
 // Copyright (c) Tailscale Inc & contributors
 // SPDX-License-Identifier: BSD-3-Clause
 
-import React from "react"
-import TailscaleIcon from "src/assets/icons/tailscale-icon.svg?react"
+import React, { useEffect } from "react"
 import LoginToggle from "src/components/login-toggle"
+import ProductLogo from "src/components/product-logo"
 import DeviceDetailsView from "src/components/views/device-details-view"
 import DisconnectedView from "src/components/views/disconnected-view"
 import HomeView from "src/components/views/home-view"
@@ -12,6 +12,7 @@ import SSHView from "src/components/views/ssh-view"
 import SubnetRouterView from "src/components/views/subnet-router-view"
 import { UpdatingView } from "src/components/views/updating-view"
 import useAuth, { AuthResponse, canEdit } from "src/hooks/auth"
+import useUIConfig, { useTranslate } from "src/hooks/ui-config"
 import { Feature, NodeData, featureDescription } from "src/types"
 import Card from "src/ui/card"
 import EmptyState from "src/ui/empty-state"
@@ -21,6 +22,14 @@ import { Link, Route, Router, Switch, useLocation } from "wouter"
 
 export default function App() {
   const { data: auth, loading: loadingAuth, newSession } = useAuth()
+  const ui = useUIConfig()
+
+  useEffect(() => {
+    if (ui) {
+      document.documentElement.lang = ui.Language
+      document.title = ui.ProductName
+    }
+  }, [ui])
 
   return (
     <main className="min-w-sm max-w-lg mx-auto py-4 sm:py-14 px-5">
@@ -41,6 +50,7 @@ function WebClient({
   newSession: () => Promise<void>
 }) {
   const { data: node } = useSWR<NodeData>("/data")
+  const t = useTranslate()
 
   return !node ? (
     <LoadingView />
@@ -82,7 +92,7 @@ function WebClient({
           </Route>
           <Route>
             <Card className="mt-8">
-              <EmptyState description="Page not found" />
+              <EmptyState description={t("app.notFound", "Page not found")} />
             </Card>
           </Route>
         </Switch>
@@ -108,14 +118,18 @@ function FeatureRoute({
   feature: Feature
   children: React.ReactNode
 }) {
+  const t = useTranslate()
+
   return (
     <Route path={path}>
       {!node.Features[feature] ? (
         <Card className="mt-8">
           <EmptyState
-            description={`${featureDescription(
-              feature
-            )} not available on this device.`}
+            description={t(
+              "app.featureUnavailable",
+              "{feature} not available on this device.",
+              { feature: featureDescription(feature) }
+            )}
           />
         </Card>
       ) : (
@@ -135,6 +149,7 @@ function Header({
   newSession: () => Promise<void>
 }) {
   const [loc] = useLocation()
+  const t = useTranslate()
 
   if (loc === "/disconnected") {
     // No header on view presented after logout.
@@ -145,7 +160,7 @@ function Header({
     <>
       <div className="flex flex-wrap gap-4 justify-between items-center mb-9 md:mb-12">
         <Link to="/" className="flex gap-3 overflow-hidden">
-          <TailscaleIcon />
+          <ProductLogo />
           <div className="inline text-gray-800 text-lg font-medium leading-snug truncate">
             {node.DomainName}
           </div>
@@ -154,7 +169,8 @@ function Header({
       </div>
       {loc !== "/" && loc !== "/update" && (
         <Link to="/" className="link font-medium block mb-2">
-          &larr; Back to {node.DeviceName}
+          &larr;{" "}
+          {t("app.backTo", "Back to {device}", { device: node.DeviceName })}
         </Link>
       )}
     </>
@@ -0,0 +1,26 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+import cx from "classnames"
+import React from "react"
+import TailscaleIcon from "src/assets/icons/tailscale-icon.svg?react"
+import useUIConfig from "src/hooks/ui-config"
+
+/**
+ * ProductLogo renders the distributor's custom logo if the server
+ * has one, or the Tailscale logo otherwise.
+ */
+export default function ProductLogo({ className }: { className?: string }) {
+  const ui = useUIConfig()
+
+  if (ui?.HasLogo) {
+    return (
+      <img
+        src="api/ui/logo"
+        alt={ui.ProductName}
+        className={cx("h-[26px] w-auto", className)}
+      />
+    )
+  }
+  return <TailscaleIcon className={className} />
+}
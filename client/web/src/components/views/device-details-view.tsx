@@ -9,6 +9,7 @@ import * as Control from "src/components/control-components"
 import NiceIP from "src/components/nice-ip"
 import { UpdateAvailableNotification } from "src/components/update-available"
 import { AuthResponse, canEdit } from "src/hooks/auth"
+import { useTranslate } from "src/hooks/ui-config"
 import { NodeData } from "src/types"
 import Button from "src/ui/button"
 import Card from "src/ui/card"
@@ -23,6 +24,8 @@ export default function DeviceDetailsView({
   node: NodeData
   auth: AuthResponse
 }) {
+  const t = useTranslate()
+
   return (
     <>
       <h1 className="mb-10">Device details</h1>
@@ -86,7 +89,7 @@ export default function DeviceDetailsView({
                 </td>
               </tr>
               <tr>
-                <td>Tailscale version</td>
+                <td>{t("details.version", "{product} version")}</td>
                 <td>{node.IPNVersion}</td>
               </tr>
               <tr>
@@ -108,7 +111,7 @@ export default function DeviceDetailsView({
           <table>
             <tbody>
               <tr>
-                <td>Tailscale IPv4</td>
+                <td>{t("details.ipv4", "{product} IPv4")}</td>
                 <td>
                   <QuickCopy
                     primaryActionValue={node.IPv4}
@@ -119,7 +122,7 @@ export default function DeviceDetailsView({
                 </td>
               </tr>
               <tr>
-                <td>Tailscale IPv6</td>
+                <td>{t("details.ipv6", "{product} IPv6")}</td>
                 <td>
                   <QuickCopy
                     primaryActionValue={node.IPv6}
@@ -223,6 +226,7 @@ export default function DeviceDetailsView({
 function DisconnectDialog() {
   const api = useAPI()
   const [, setLocation] = useLocation()
+  const t = useTranslate()
 
   return (
     <Dialog
@@ -239,10 +243,10 @@ function DisconnectDialog() {
           setLocation("/disconnected")
         }}
       >
-        Logging out of this device will disconnect it from your tailnet and
-        expire its node key. You won’t be able to use this web interface until
-        you re-authenticate the device from either the Tailscale app or the
-        Tailscale command line interface.
+        {t(
+          "details.logOutWarning",
+          "Logging out of this device will disconnect it from your tailnet and expire its node key. You won’t be able to use this web interface until you re-authenticate the device from either the {product} app or the {product} command line interface."
+        )}
       </Dialog.Form>
     </Dialog>
   )
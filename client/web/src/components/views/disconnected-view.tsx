@@ -2,19 +2,23 @@
 // SPDX-License-Identifier: BSD-3-Clause
 
 import React from "react"
-import TailscaleIcon from "src/assets/icons/tailscale-icon.svg?react"
+import ProductLogo from "src/components/product-logo"
+import { useTranslate } from "src/hooks/ui-config"
 
 /**
  * DisconnectedView is rendered after node logout.
  */
 export default function DisconnectedView() {
+  const t = useTranslate()
+
   return (
     <>
-      <TailscaleIcon className="mx-auto" />
+      <ProductLogo className="mx-auto" />
       <p className="mt-12 text-center text-text-muted">
-        You logged out of this device. To reconnect it you will have to
-        re-authenticate the device from either the Tailscale app or the
-        Tailscale command line interface.
+        {t(
+          "disconnected.loggedOut",
+          "You logged out of this device. To reconnect it you will have to re-authenticate the device from either the {product} app or the {product} command line interface."
+        )}
       </p>
     </>
   )
@@ -9,6 +9,7 @@ import Machine from "src/assets/icons/machine.svg?react"
 import AddressCard from "src/components/address-copy-card"
 import ExitNodeSelector from "src/components/exit-node-selector"
 import { AuthResponse, canEdit } from "src/hooks/auth"
+import { useTranslate } from "src/hooks/ui-config"
 import { NodeData } from "src/types"
 import Card from "src/ui/card"
 import { pluralize } from "src/utils/util"
@@ -21,6 +22,7 @@ export default function HomeView({
   node: NodeData
   auth: AuthResponse
 }) {
+  const t = useTranslate()
   const [allSubnetRoutes, pendingSubnetRoutes] = useMemo(
     () => [
       node.AdvertisedRoutes?.length,
@@ -67,7 +69,7 @@ export default function HomeView({
           <ExitNodeSelector
             className="mb-5"
             node={node}
-            disabled={!canEdit("exitnodes", auth)}
+            disabled={!canEdit("use-exitnode", auth)}
           />
         )}
         <Link
@@ -84,7 +86,10 @@ export default function HomeView({
           <SettingsCard
             link="/subnets"
             title="Subnet router"
-            body="Add devices to your tailnet without installing Tailscale on them."
+            body={t(
+              "home.subnetsDescription",
+              "Add devices to your tailnet without installing {product} on them."
+            )}
             badge={
               allSubnetRoutes
                 ? {
@@ -110,8 +115,11 @@ export default function HomeView({
         {node.Features["ssh"] && (
           <SettingsCard
             link="/ssh"
-            title="Tailscale SSH server"
-            body="Run a Tailscale SSH server on this device and allow other devices in your tailnet to SSH into it."
+            title={t("ssh.title", "{product} SSH server")}
+            body={t(
+              "ssh.description",
+              "Run a {product} SSH server on this device and allow other devices in your tailnet to SSH into it."
+            )}
             badge={
               node.RunningSSHServer
                 ? {
@@ -3,7 +3,8 @@
 
 import React from "react"
 import { useAPI } from "src/api"
-import TailscaleIcon from "src/assets/icons/tailscale-icon.svg?react"
+import ProductLogo from "src/components/product-logo"
+import { useTranslate } from "src/hooks/ui-config"
 import { NodeData } from "src/types"
 import Button from "src/ui/button"
 
@@ -13,16 +14,22 @@ import Button from "src/ui/button"
  */
 export default function LoginView({ data }: { data: NodeData }) {
   const api = useAPI()
+  const t = useTranslate()
 
   return (
     <div className="mb-8 py-6 px-8 bg-white rounded-md shadow-2xl">
-      <TailscaleIcon className="my-2 mb-8" />
+      <ProductLogo className="my-2 mb-8" />
       {data.Status === "Stopped" ? (
         <>
           <div className="mb-6">
-            <h3 className="text-3xl font-semibold mb-3">Connect</h3>
+            <h3 className="text-3xl font-semibold mb-3">
+              {t("login.connectTitle", "Connect")}
+            </h3>
             <p className="text-gray-700">
-              Your device is disconnected from Tailscale.
+              {t(
+                "login.disconnected",
+                "Your device is disconnected from {product}."
+              )}
             </p>
           </div>
           <Button
@@ -30,22 +37,24 @@ export default function LoginView({ data }: { data: NodeData }) {
             className="w-full mb-4"
             intent="primary"
           >
-            Connect to Tailscale
+            {t("login.connect", "Connect to {product}")}
           </Button>
         </>
       ) : data.IPv4 ? (
         <>
           <div className="mb-6">
             <p className="text-gray-700">
-              Your device’s key has expired. Reauthenticate this device by
-              logging in again, or{" "}
+              {t(
+                "login.keyExpired",
+                "Your device’s key has expired. Reauthenticate this device by logging in again, or"
+              )}{" "}
               <a
                 href="https://tailscale.com/kb/1028/key-expiry"
                 className="link"
                 target="_blank"
                 rel="noreferrer"
               >
-                learn more
+                {t("login.learnMore", "learn more")}
               </a>
               .
             </p>
@@ -57,16 +66,20 @@ export default function LoginView({ data }: { data: NodeData }) {
             className="w-full mb-4"
             intent="primary"
           >
-            Reauthenticate
+            {t("login.reauthenticate", "Reauthenticate")}
           </Button>
         </>
       ) : (
         <>
           <div className="mb-6">
-            <h3 className="text-3xl font-semibold mb-3">Log in</h3>
+            <h3 className="text-3xl font-semibold mb-3">
+              {t("login.logInTitle", "Log in")}
+            </h3>
             <p className="text-gray-700">
-              Get started by logging in to your Tailscale network.
-              Or,&nbsp;learn&nbsp;more at{" "}
+              {t(
+                "login.getStarted",
+                "Get started by logging in to your {product} network. Or,\u00a0learn\u00a0more at"
+              )}{" "}
               <a
                 href="https://tailscale.com/"
                 className="link"
@@ -90,7 +103,7 @@ export default function LoginView({ data }: { data: NodeData }) {
             className="w-full mb-4"
             intent="primary"
           >
-            Log In
+            {t("login.logIn", "Log In")}
           </Button>
         </>
       )}
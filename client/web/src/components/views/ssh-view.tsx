@@ -5,6 +5,7 @@ import cx from "classnames"
 import React from "react"
 import { useAPI } from "src/api"
 import * as Control from "src/components/control-components"
+import { useTranslate } from "src/hooks/ui-config"
 import { NodeData } from "src/types"
 import Card from "src/ui/card"
 import Toggle from "src/ui/toggle"
@@ -17,13 +18,16 @@ export default function SSHView({
   node: NodeData
 }) {
   const api = useAPI()
+  const t = useTranslate()
 
   return (
     <>
-      <h1 className="mb-1">Tailscale SSH server</h1>
+      <h1 className="mb-1">{t("ssh.title", "{product} SSH server")}</h1>
       <p className="description mb-10">
-        Run a Tailscale SSH server on this device and allow other devices in
-        your tailnet to SSH into it.{" "}
+        {t(
+          "ssh.description",
+          "Run a {product} SSH server on this device and allow other devices in your tailnet to SSH into it."
+        )}{" "}
         <a
           href="https://tailscale.com/kb/1193/tailscale-ssh/"
           className="text-blue-700"
@@ -49,7 +53,7 @@ export default function SSHView({
               }
             />
             <div className="text-black text-sm font-medium leading-tight">
-              Run Tailscale SSH server
+              {t("ssh.run", "Run {product} SSH server")}
             </div>
           </label>
         ) : (
@@ -8,6 +8,7 @@ import CheckCircle from "src/assets/icons/check-circle.svg?react"
 import Clock from "src/assets/icons/clock.svg?react"
 import Plus from "src/assets/icons/plus.svg?react"
 import * as Control from "src/components/control-components"
+import { useTranslate } from "src/hooks/ui-config"
 import { NodeData } from "src/types"
 import Button from "src/ui/button"
 import Card from "src/ui/card"
@@ -23,6 +24,7 @@ export default function SubnetRouterView({
   node: NodeData
 }) {
   const api = useAPI()
+  const t = useTranslate()
 
   const [advertisedRoutes, hasRoutes, hasUnapprovedRoutes] = useMemo(() => {
     const routes = node.AdvertisedRoutes || []
@@ -45,7 +47,10 @@ export default function SubnetRouterView({
     <>
       <h1 className="mb-1">Subnet router</h1>
       <p className="description mb-5">
-        Add devices to your tailnet without installing Tailscale.{" "}
+        {t(
+          "subnets.description",
+          "Add devices to your tailnet without installing {product}."
+        )}{" "}
         <a
           href="https://tailscale.com/kb/1019/subnets/"
           className="text-blue-700"
@@ -6,6 +6,7 @@ import CheckCircleIcon from "src/assets/icons/check-circle.svg?react"
 import XCircleIcon from "src/assets/icons/x-circle.svg?react"
 import { ChangelogText } from "src/components/update-available"
 import { UpdateState, useInstallUpdate } from "src/hooks/self-update"
+import { useTranslate } from "src/hooks/ui-config"
 import { VersionInfo } from "src/types"
 import Button from "src/ui/button"
 import Spinner from "src/ui/spinner"
@@ -23,6 +24,7 @@ export function UpdatingView({
   currentVersion: string
 }) {
   const [, setLocation] = useLocation()
+  const t = useTranslate()
   const { updateState, updateLog } = useInstallUpdate(
     currentVersion,
     versionInfo
@@ -44,11 +46,14 @@ export function UpdatingView({
             <CheckCircleIcon />
             <h1 className="text-2xl m-3">Update complete!</h1>
             <p className="text-gray-400">
-              You updated Tailscale
               {versionInfo && versionInfo.LatestVersion
-                ? ` to ${versionInfo.LatestVersion}`
-                : null}
-              . <ChangelogText version={versionInfo?.LatestVersion} />
+                ? t(
+                    "update.completeVersion",
+                    "You updated {product} to {version}.",
+                    { version: versionInfo.LatestVersion }
+                  )
+                : t("update.complete", "You updated {product}.")}{" "}
+              <ChangelogText version={versionInfo?.LatestVersion} />
             </p>
             <Button
               className="m-3"
@@ -63,8 +68,11 @@ export function UpdatingView({
             <CheckCircleIcon />
             <h1 className="text-2xl m-3">Up to date!</h1>
             <p className="text-gray-400">
-              You are already running Tailscale {currentVersion}, which is the
-              newest version available.
+              {t(
+                "update.upToDate",
+                "You are already running {product} {version}, which is the newest version available.",
+                { version: currentVersion }
+              )}
             </p>
             <Button
               className="m-3"
@@ -16,11 +16,19 @@ export type AuthResponse = {
     capabilities: { [key in PeerCapability]: boolean }
   }
   needsSynoAuth?: boolean
+  readOnly?: boolean
 }
 
 export type AuthServerMode = "login" | "readonly" | "manage"
 
-export type PeerCapability = "*" | "ssh" | "subnets" | "exitnodes" | "account"
+export type PeerCapability =
+  | "*"
+  | "ssh"
+  | "subnets"
+  | "exitnodes"
+  | "use-exitnode"
+  | "account"
+  | "serve"
 
 /**
  * canEdit reports whether the given auth response specifies that the viewer
@@ -33,6 +41,12 @@ export function canEdit(cap: PeerCapability, auth: AuthResponse): boolean {
   if (auth.viewerIdentity.capabilities["*"] === true) {
     return true // can edit all features
   }
+  if (
+    cap === "use-exitnode" &&
+    auth.viewerIdentity.capabilities["exitnodes"] === true
+  ) {
+    return true // exitnodes includes using them
+  }
   return auth.viewerIdentity.capabilities[cap] === true
 }
 
@@ -0,0 +1,52 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+import { useCallback } from "react"
+import { formatMessage } from "src/utils/util"
+import useSWR from "swr"
+
+/**
+ * UIConfig is the language and branding of the web client,
+ * as served by GET /api/ui.
+ */
+export type UIConfig = {
+  Language: string // negotiated BCP 47 language tag
+  Messages?: { [id: string]: string } // translations, keyed by message ID
+  ProductName: string // "Tailscale" unless branded
+  HasLogo: boolean // whether a custom logo is served at /api/ui/logo
+}
+
+/**
+ * defaultProductName is used until the UI config has loaded.
+ */
+const defaultProductName = "Tailscale"
+
+/**
+ * useUIConfig returns the web client's language and branding,
+ * or undefined while it's loading.
+ */
+export default function useUIConfig(): UIConfig | undefined {
+  const { data } = useSWR<UIConfig>("/ui", { revalidateOnFocus: false })
+  return data
+}
+
+/**
+ * useTranslate returns a function that looks up the message with the given
+ * ID in the server's catalog for the negotiated language, falling back to
+ * the given English message. "{product}" in the message is replaced with
+ * the product name, and other "{name}" placeholders with values from vars.
+ *
+ * Message IDs are dot-separated, starting with the view they appear in,
+ * e.g. "login.connect". Distributors' catalogs map them to translations.
+ */
+export function useTranslate() {
+  const ui = useUIConfig()
+  return useCallback(
+    (id: string, message: string, vars?: { [name: string]: string }) =>
+      formatMessage(ui?.Messages?.[id] ?? message, {
+        product: ui?.ProductName ?? defaultProductName,
+        ...vars,
+      }),
+    [ui]
+  )
+}
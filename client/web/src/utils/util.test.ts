@@ -1,7 +1,7 @@
 // Copyright (c) Tailscale Inc & contributors
 // SPDX-License-Identifier: BSD-3-Clause
 
-import { isTailscaleIPv6, pluralize } from "src/utils/util"
+import { formatMessage, isTailscaleIPv6, pluralize } from "src/utils/util"
 import { describe, expect, it } from "vitest"
 
 describe("pluralize", () => {
@@ -19,3 +19,12 @@ describe("isTailscaleIPv6", () => {
     ).toBeTruthy()
   })
 })
+
+describe("formatMessage", () => {
+  it("test placeholders", () => {
+    expect(formatMessage("Connect to {product}", { product: "Acme" })).toBe(
+      "Connect to Acme"
+    )
+    expect(formatMessage("Back to {device}", {})).toBe("Back to {device}")
+  })
+})
@@ -32,6 +32,20 @@ export function pluralize(signular: string, plural: string, qty: number) {
   return qty === 1 ? signular : plural
 }
 
+/**
+ * formatMessage replaces each "{name}" placeholder in msg with
+ * the corresponding value from vars. Placeholders without a
+ * value are left as is.
+ */
+export function formatMessage(
+  msg: string,
+  vars: { [name: string]: string }
+): string {
+  return msg.replace(/\{(\w+)\}/g, (match, name) =>
+    name in vars ? vars[name] : match
+  )
+}
+
 /**
  * isTailscaleIPv6 returns true when the ip matches
  * Tailnet's IPv6 format.
@@ -71,6 +71,9 @@ type Server struct {
 	// header values to determine if the request is from the same origin.
 	originOverride string
 
+	catalogs map[string]Catalog // translated messages, keyed by language
+	branding *Branding          // or nil for the default Tailscale branding
+
 	apiHandler    http.Handler // serves api endpoints; csrf-protected
 	assetsHandler http.Handler // serves frontend assets
 	assetsCleanup func()       // called from Server.Shutdown
@@ -168,6 +171,16 @@ type ServerOpts struct {
 
 	// OriginOverride specifies the origin that the web UI will be accessible from if hosted behind a reverse proxy or CGI.
 	OriginOverride string
+
+	// Catalogs optionally provides translations of the web client's
+	// messages, keyed by BCP 47 language tag. The language served to
+	// each browser is negotiated from its Accept-Language header.
+	// See LoadCatalogs.
+	Catalogs map[string]Catalog
+
+	// Branding optionally replaces the Tailscale product name and logo
+	// shown by the web client.
+	Branding *Branding
 }
 
 // NewServer constructs a new Tailscale web client server.
@@ -198,6 +211,8 @@ func NewServer(opts ServerOpts) (s *Server, err error) {
 		newAuthURL:     opts.NewAuthURL,
 		waitAuthURL:    opts.WaitAuthURL,
 		originOverride: opts.OriginOverride,
+		catalogs:       opts.Catalogs,
+		branding:       opts.Branding,
 	}
 	if opts.PathPrefix != "" {
 		// Enforce that path prefix always has a single leading '/'
@@ -374,6 +389,12 @@ func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
 		case r.URL.Path == "/api/auth/session/wait" && r.Method == httpm.GET:
 			s.serveAPIAuthSessionWait(w, r) // wait for session to be authorized
 			return
+		case r.URL.Path == "/api/ui" && r.Method == httpm.GET:
+			s.serveUIConfig(w, r) // serve language and branding
+			return
+		case r.URL.Path == "/api/ui/logo" && r.Method == httpm.GET:
+			s.serveUILogo(w, r) // serve custom logo
+			return
 		}
 		if ok := s.authorizeRequest(w, r); !ok {
 			http.Error(w, "not authorized", http.StatusUnauthorized)
@@ -566,7 +587,7 @@ func (s *Server) setPeer(r *http.Request) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	peer, err := toPeerCapabilities(status, whois)
+	peer, err := s.peerCapabilities(status, whois)
 	if err != nil {
 		return nil, err
 	}
@@ -613,6 +634,9 @@ func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
 	case path == "/local/v0/logout" && r.Method == httpm.POST:
 		s.proxyRequestToLocalAPI(w, r)
 		return
+	case path == "/local/v0/serve-config" && (r.Method == httpm.GET || r.Method == httpm.POST):
+		s.proxyRequestToLocalAPI(w, r)
+		return
 	case path == "/local/v0/prefs" && r.Method == httpm.PATCH:
 		handleJSON[maskedPrefs](s.serveUpdatePrefs)(w, r)
 		return
@@ -637,6 +661,7 @@ type authResponse struct {
 	Authorized     bool            `json:"authorized"` // has an authorized management session
 	ViewerIdentity *viewerIdentity `json:"viewerIdentity,omitempty"`
 	NeedsSynoAuth  bool            `json:"needsSynoAuth,omitempty"`
+	ReadOnly       bool            `json:"readOnly,omitempty"` // no viewer can edit, per policy
 }
 
 // viewerIdentity is the Tailscale identity of the source node
@@ -654,12 +679,13 @@ type viewerIdentity struct {
 func (s *Server) serveAPIAuth(w http.ResponseWriter, r *http.Request) {
 	var resp authResponse
 	resp.ServerMode = s.mode
+	resp.ReadOnly = s.readOnly()
 	session, whois, status, sErr := s.getSession(r)
 	var caps peerCapabilities
 
 	if whois != nil {
 		var err error
-		caps, err = toPeerCapabilities(status, whois)
+		caps, err = s.peerCapabilities(status, whois)
 		if err != nil {
 			http.Error(w, sErr.Error(), http.StatusInternalServerError)
 			return
@@ -1078,7 +1104,7 @@ func (s *Server) servePostRoutes(ctx context.Context, data postRoutesRequest) er
 		return tsweb.Error(http.StatusBadRequest, "must specify SetExitNode or SetRoutes", nil)
 	}
 	peer := s.getPeer(ctx)
-	if data.SetExitNode && !peer.canEdit(capFeatureExitNodes) {
+	if data.SetExitNode && !peer.canEdit(capFeatureUseExitNode) {
 		return tsweb.Error(http.StatusUnauthorized, "SetExitNode not allowed", nil)
 	}
 	if data.SetRoutes && !peer.canEdit(capFeatureSubnets) {
@@ -1098,6 +1124,9 @@ func (s *Server) servePostRoutes(ctx context.Context, data postRoutesRequest) er
 		}
 		currNonExitRoutes = append(currNonExitRoutes, r.String())
 	}
+	if data.SetExitNode && data.AdvertiseExitNode != currAdvertisingExitNode && !peer.canEdit(capFeatureExitNodes) {
+		return tsweb.Error(http.StatusUnauthorized, "AdvertiseExitNode not allowed", nil)
+	}
 	// For each group of fields not being set, preserve the current prefs.
 	if !data.SetExitNode {
 		data.AdvertiseExitNode = currAdvertisingExitNode
@@ -1293,6 +1322,11 @@ func (s *Server) proxyRequestToLocalAPI(w http.ResponseWriter, r *http.Request)
 			http.Error(w, "not allowed", http.StatusUnauthorized)
 			return
 		}
+	case "/v0/serve-config":
+		if r.Method == httpm.POST && !s.getPeer(r.Context()).canEdit(capFeatureServe) {
+			http.Error(w, "not allowed", http.StatusUnauthorized)
+			return
+		}
 	}
 
 	localAPIURL := "http://" + apitype.LocalAPIHost + "/localapi" + path
@@ -1301,6 +1335,9 @@ func (s *Server) proxyRequestToLocalAPI(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "failed to construct request", http.StatusInternalServerError)
 		return
 	}
+	if etag := r.Header.Get("If-Match"); etag != "" {
+		req.Header.Set("If-Match", etag) // for serve-config
+	}
 
 	// Make request to tailscaled localapi.
 	resp, err := s.lc.DoLocalRequest(req)
@@ -1312,6 +1349,9 @@ func (s *Server) proxyRequestToLocalAPI(w http.ResponseWriter, r *http.Request)
 
 	// Send response back to web frontend.
 	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	if etag := resp.Header.Get("Etag"); etag != "" {
+		w.Header().Set("Etag", etag)
+	}
 	w.WriteHeader(resp.StatusCode)
 	if _, err := io.Copy(w, resp.Body); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -17,6 +17,7 @@
 	"slices"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
@@ -28,7 +29,9 @@
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/views"
 	"tailscale.com/util/httpm"
+	"tailscale.com/util/syspolicy/pkey"
 	"tailscale.com/util/syspolicy/policyclient"
+	"tailscale.com/util/syspolicy/policytest"
 )
 
 func TestQnapAuthnURL(t *testing.T) {
@@ -97,6 +100,7 @@ func TestServeAPI(t *testing.T) {
 	remoteUser := &tailcfg.UserProfile{ID: tailcfg.UserID(1)}
 	remoteIPWithAllCapabilities := "100.100.100.101"
 	remoteIPWithNoCapabilities := "100.100.100.102"
+	remoteIPWithScopedCapabilities := "100.100.100.103"
 
 	lal := memnet.Listen("local-tailscaled.sock:80")
 	defer lal.Close()
@@ -111,6 +115,11 @@ func TestServeAPI(t *testing.T) {
 				Node:        &tailcfg.Node{StableID: "node2"},
 				UserProfile: remoteUser,
 			},
+			remoteIPWithScopedCapabilities: {
+				Node:        &tailcfg.Node{StableID: "node3"},
+				UserProfile: remoteUser,
+				CapMap:      tailcfg.PeerCapMap{tailcfg.PeerCapabilityWebUI: []tailcfg.RawMessage{"{\"canEdit\":[\"use-exitnode\",\"serve\"]}"}},
+			},
 		},
 		func() *ipnstate.PeerStatus { return self },
 		func() *ipn.Prefs { return prefs },
@@ -122,11 +131,19 @@ func() *ipn.Prefs { return prefs },
 	s := &Server{
 		mode:    ManageServerMode,
 		lc:      &local.Client{Dial: lal.Dial},
+		polc:    policyclient.NoPolicyClient{},
+		timeNow: time.Now,
+	}
+	readOnly := &Server{
+		mode:    ManageServerMode,
+		lc:      &local.Client{Dial: lal.Dial},
+		polc:    policytest.Config{pkey.WebClientReadOnly: true},
 		timeNow: time.Now,
 	}
 
 	type requestTest struct {
 		remoteIP     string
+		readOnly     bool // whether the web client is read-only by policy
 		wantResponse string
 		wantStatus   int
 	}
@@ -172,6 +189,37 @@ type requestTest struct {
 			remoteIP:     remoteIPWithAllCapabilities,
 			wantResponse: "success", // requesting node has sufficient permissions
 			wantStatus:   http.StatusOK,
+		}, {
+			remoteIP:     remoteIPWithAllCapabilities,
+			readOnly:     true,
+			wantResponse: "not allowed", // no one can edit a read-only web client
+			wantStatus:   http.StatusUnauthorized,
+		}},
+	}, {
+		reqPath:   "/local/v0/serve-config",
+		reqMethod: httpm.POST,
+		reqBody:   "{}",
+		tests: []requestTest{{
+			remoteIP:     remoteIPWithNoCapabilities,
+			wantResponse: "not allowed",
+			wantStatus:   http.StatusUnauthorized,
+		}, {
+			remoteIP:     remoteIPWithScopedCapabilities,
+			wantResponse: "success",
+			wantStatus:   http.StatusOK,
+		}, {
+			remoteIP:     remoteIPWithScopedCapabilities,
+			readOnly:     true,
+			wantResponse: "not allowed",
+			wantStatus:   http.StatusUnauthorized,
+		}},
+	}, {
+		reqPath:   "/local/v0/serve-config",
+		reqMethod: httpm.GET,
+		tests: []requestTest{{
+			remoteIP:     remoteIPWithNoCapabilities,
+			wantResponse: "success", // allowed, no additional capabilities required
+			wantStatus:   http.StatusOK,
 		}},
 	}, {
 		reqPath:   "/exit-nodes",
@@ -193,6 +241,21 @@ type requestTest struct {
 			remoteIP:     remoteIPWithNoCapabilities,
 			wantResponse: "SetExitNode not allowed",
 			wantStatus:   http.StatusUnauthorized,
+		}, {
+			remoteIP:   remoteIPWithScopedCapabilities,
+			wantStatus: http.StatusOK,
+		}, {
+			remoteIP:   remoteIPWithAllCapabilities,
+			wantStatus: http.StatusOK,
+		}},
+	}, {
+		reqPath:   "/routes",
+		reqMethod: httpm.POST,
+		reqBody:   "{\"setExitNode\":true,\"advertiseExitNode\":true}",
+		tests: []requestTest{{
+			remoteIP:     remoteIPWithScopedCapabilities,
+			wantResponse: "AdvertiseExitNode not allowed",
+			wantStatus:   http.StatusUnauthorized,
 		}, {
 			remoteIP:   remoteIPWithAllCapabilities,
 			wantStatus: http.StatusOK,
@@ -226,7 +289,11 @@ type requestTest struct {
 	}}
 	for _, tt := range tests {
 		for _, req := range tt.tests {
-			t.Run(req.remoteIP+"_requesting_"+tt.reqPath, func(t *testing.T) {
+			name := req.remoteIP + "_requesting_" + tt.reqPath
+			if req.readOnly {
+				name += "_readonly"
+			}
+			t.Run(name, func(t *testing.T) {
 				var reqBody io.Reader
 				if tt.reqBody != "" {
 					reqBody = bytes.NewBuffer([]byte(tt.reqBody))
@@ -238,7 +305,11 @@ type requestTest struct {
 				}
 				w := httptest.NewRecorder()
 
-				s.serveAPI(w, r)
+				if req.readOnly {
+					readOnly.serveAPI(w, r)
+				} else {
+					s.serveAPI(w, r)
+				}
 				res := w.Result()
 				defer res.Body.Close()
 				if gotStatus := res.StatusCode; req.wantStatus != gotStatus {
@@ -932,6 +1003,7 @@ func(metricName string) {
 	s := &Server{
 		mode:        ManageServerMode,
 		lc:          &local.Client{Dial: lal.Dial},
+		polc:        policyclient.NoPolicyClient{},
 		timeNow:     func() time.Time { return timeNow },
 		newAuthURL:  mockNewAuthURL,
 		waitAuthURL: mockWaitAuthURL,
@@ -1485,6 +1557,9 @@ type metricName struct {
 		case "/localapi/v0/logout":
 			fmt.Fprintf(w, "success")
 			return
+		case "/localapi/v0/serve-config":
+			fmt.Fprintf(w, "success")
+			return
 		default:
 			t.Fatalf("unhandled localapi test endpoint %q, add to localapi handler func in test", r.URL.Path)
 		}
@@ -1750,3 +1825,119 @@ func TestServePostRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestNegotiateLanguage(t *testing.T) {
+	available := []string{"de", "fr-CA", "pt-BR"}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "en"},
+		{"*", "en"},
+		{"de", "de"},
+		{"DE-ch", "de"},
+		{"fr", "fr-CA"},
+		{"pt-br,de;q=0.5", "pt-BR"},
+		{"ja, de;q=0.8, fr;q=0.9", "fr-CA"},
+		{"en-US,en;q=0.9,de;q=0.8", "en"},
+		{"de;q=0, es", "en"},
+		{"de;q=bogus, fr;q=0.1", "fr-CA"},
+	}
+	for _, tt := range tests {
+		if got := negotiateLanguage(tt.accept, available); got != tt.want {
+			t.Errorf("negotiateLanguage(%q) = %q; want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCatalogs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"de.json":    {Data: []byte(`{"login": "Anmelden"}`)},
+		"pt-BR.json": {Data: []byte(`{"login": "Entrar"}`)},
+		"README.md":  {Data: []byte("not a catalog")},
+	}
+	got, err := LoadCatalogs(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Catalog{
+		"de":    {"login": "Anmelden"},
+		"pt-BR": {"login": "Entrar"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong catalogs (-want +got):\n%s", diff)
+	}
+
+	fsys["fr.json"] = &fstest.MapFile{Data: []byte(`{"login": 1}`)}
+	if _, err := LoadCatalogs(fsys); err == nil || !strings.Contains(err.Error(), "fr.json") {
+		t.Errorf("got err %v; want error mentioning fr.json", err)
+	}
+}
+
+func TestServeUI(t *testing.T) {
+	logo := []byte("\x89PNG\r\n\x1a\n")
+	tests := []struct {
+		name       string
+		opts       ServerOpts
+		accept     string
+		wantConfig uiConfig
+		wantLogo   int // status code
+	}{
+		{
+			name:       "default",
+			wantConfig: uiConfig{Language: "en", ProductName: "Tailscale"},
+			wantLogo:   http.StatusNotFound,
+		},
+		{
+			name: "localized-and-branded",
+			opts: ServerOpts{
+				Catalogs: map[string]Catalog{"de": {"login": "Anmelden"}},
+				Branding: &Branding{ProductName: "Acme VPN", Logo: logo},
+			},
+			accept: "de-DE,de;q=0.9",
+			wantConfig: uiConfig{
+				Language:    "de",
+				Messages:    Catalog{"login": "Anmelden"},
+				ProductName: "Acme VPN",
+				HasLogo:     true,
+			},
+			wantLogo: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Mode = LoginServerMode
+			s, err := NewServer(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(httpm.GET, "/api/ui", nil)
+			r.Header.Set("Accept-Language", tt.accept)
+			w := httptest.NewRecorder()
+			s.serveUIConfig(w, r)
+			var got uiConfig
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.wantConfig, got); diff != "" {
+				t.Errorf("wrong config (-want +got):\n%s", diff)
+			}
+
+			r = httptest.NewRequest(httpm.GET, "/api/ui/logo", nil)
+			w = httptest.NewRecorder()
+			s.serveUILogo(w, r)
+			if w.Code != tt.wantLogo {
+				t.Errorf("logo status = %d; want %d", w.Code, tt.wantLogo)
+			}
+			if w.Code == http.StatusOK {
+				if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+					t.Errorf("logo Content-Type = %q; want image/png", ct)
+				}
+				if !bytes.Equal(w.Body.Bytes(), logo) {
+					t.Errorf("wrong logo body %q", w.Body.Bytes())
+				}
+			}
+		})
+	}
+}
@@ -30,6 +30,7 @@
 	"tailscale.com/envknob"
 	"tailscale.com/feature"
 	"tailscale.com/hostinfo"
+	"tailscale.com/paths"
 	"tailscale.com/types/lazy"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/cmpver"
@@ -104,6 +105,18 @@ type Arguments struct {
 	// context. When true, NewUpdater returns an error if it cannot be used for
 	// auto-updates (even if Updater.Update field is non-nil).
 	ForAutoUpdate bool
+	// Rollback, if true, reinstalls the version that was running before the
+	// most recent update by this package, instead of updating.
+	// Mutually exclusive with Version and Track.
+	Rollback bool
+	// Pin, if non-empty, is the release track or the explicit version that
+	// updates are restricted to, typically from the [pkey.UpdateTrack]
+	// system policy. When Pin is a track, Track defaults to it and Version
+	// must be from it; when Pin is a version, Version defaults to it.
+	// NewUpdater returns an error if Track or Version conflict with it.
+	//
+	// [pkey.UpdateTrack]: https://pkg.go.dev/tailscale.com/util/syspolicy/pkey#UpdateTrack
+	Pin string
 }
 
 func (args Arguments) validate() error {
@@ -116,6 +129,9 @@ func (args Arguments) validate() error {
 	if args.Version != "" && args.Track != "" {
 		return fmt.Errorf("only one of Version(%q) or Track(%q) can be set", args.Version, args.Track)
 	}
+	if args.Rollback && (args.Version != "" || args.Track != "") {
+		return errors.New("Rollback cannot be combined with Version or Track")
+	}
 	switch args.Track {
 	case StableTrack, UnstableTrack, ReleaseCandidateTrack, "":
 		// All valid values.
@@ -135,12 +151,18 @@ type Updater struct {
 	// returned by version.Short(), typically "x.y.z". Used for tests to
 	// override the actual current version.
 	currentVersion string
+
+	// previousVersionPath is the file recording the version that was
+	// running before the most recent update, for rollbacks. If empty,
+	// rollbacks are unsupported.
+	previousVersionPath string
 }
 
 func NewUpdater(args Arguments) (*Updater, error) {
 	up := Updater{
-		Arguments:      args,
-		currentVersion: version.Short(),
+		Arguments:           args,
+		currentVersion:      version.Short(),
+		previousVersionPath: previousVersionPath(),
 	}
 	if up.Stdout == nil {
 		up.Stdout = os.Stdout
@@ -156,6 +178,16 @@ func NewUpdater(args Arguments) (*Updater, error) {
 	if args.ForAutoUpdate && !canAutoUpdate {
 		return nil, errors.ErrUnsupported
 	}
+	if up.Rollback {
+		prev, err := up.previousVersion()
+		if err != nil {
+			return nil, err
+		}
+		up.Version = prev
+	}
+	if err := up.applyPin(); err != nil {
+		return nil, err
+	}
 	if up.Track == "" {
 		if up.Version != "" {
 			var err error
@@ -173,6 +205,84 @@ func NewUpdater(args Arguments) (*Updater, error) {
 	return &up, nil
 }
 
+// previousVersionPath returns the default path of the file recording the
+// version that was running before the most recent update, or the empty string
+// if there's no reasonable default.
+func previousVersionPath() string {
+	dir := paths.DefaultTailscaledStateDir()
+	if dir == "" || dir == "." {
+		return ""
+	}
+	return filepath.Join(dir, "previous-version")
+}
+
+// previousVersion returns the version that was running before the most recent
+// update, for rollbacks.
+func (up *Updater) previousVersion() (string, error) {
+	if up.previousVersionPath == "" {
+		return "", errors.New("rollbacks are not supported on this platform")
+	}
+	b, err := os.ReadFile(up.previousVersionPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", errors.New("no previous version to roll back to; Tailscale was not updated with this command")
+	}
+	if err != nil {
+		return "", err
+	}
+	ver := strings.TrimSpace(string(b))
+	if _, err := versionToTrack(ver); err != nil {
+		return "", fmt.Errorf("reading %s: %w", up.previousVersionPath, err)
+	}
+	return ver, nil
+}
+
+// notePreviousVersion records the running version as the one to roll back to,
+// as an update to a different version is about to be installed. Failures are
+// only logged, so that they don't prevent updates.
+func (up *Updater) notePreviousVersion() {
+	if up.previousVersionPath == "" {
+		return
+	}
+	if err := os.WriteFile(up.previousVersionPath, []byte(up.currentVersion+"\n"), 0644); err != nil {
+		up.Logf("failed to record the current version for rollbacks: %v", err)
+	}
+}
+
+// applyPin restricts up.Track and up.Version to up.Pin, if set.
+func (up *Updater) applyPin() error {
+	switch pin := up.Pin; pin {
+	case "":
+		return nil
+	case StableTrack, UnstableTrack, ReleaseCandidateTrack:
+		if up.Track != "" && up.Track != pin {
+			return fmt.Errorf("updates are pinned to the %q track by system policy", pin)
+		}
+		if up.Version == "" {
+			up.Track = pin
+			return nil
+		}
+		track, err := versionToTrack(up.Version)
+		if err != nil {
+			return err
+		}
+		// The release-candidate track also has the stable releases.
+		if track != pin && !(pin == ReleaseCandidateTrack && track == StableTrack) {
+			return fmt.Errorf("updates are pinned to the %q track by system policy, which version %v is not from", pin, up.Version)
+		}
+		return nil
+	default:
+		pinTrack, err := versionToTrack(pin)
+		if err != nil {
+			return fmt.Errorf("invalid update pin: %w", err)
+		}
+		if up.Version != "" && up.Version != pin || up.Track != "" && up.Track != pinTrack {
+			return fmt.Errorf("updates are pinned to version %v by system policy", pin)
+		}
+		up.Version = pin
+		return nil
+	}
+}
+
 type updateFunction func() error
 
 func (up *Updater) getUpdateFunction() (fn updateFunction, canAutoUpdate bool) {
@@ -296,8 +406,8 @@ func (up *Updater) confirm(ver string) bool {
 		up.Logf("current version: %v, latest version %v; forcing an update due to TS_UPDATE_SKIP_VERSION_CHECK", up.currentVersion, ver)
 		return true
 	}
-	// Only check version when we're not switching tracks.
-	if up.Track == "" || up.Track == CurrentTrack {
+	// Only check version when we're not switching tracks or rolling back.
+	if !up.Rollback && (up.Track == "" || up.Track == CurrentTrack) {
 		switch c := cmpver.Compare(up.currentVersion, ver); {
 		case c == 0:
 			up.Logf("already running %v version %v; no update needed", up.Track, ver)
@@ -307,8 +417,11 @@ func (up *Updater) confirm(ver string) bool {
 			return false
 		}
 	}
-	if up.Confirm != nil {
-		return up.Confirm(ver)
+	if up.Confirm != nil && !up.Confirm(ver) {
+		return false
+	}
+	if ver != up.currentVersion {
+		up.notePreviousVersion()
 	}
 	return true
 }
@@ -877,16 +990,20 @@ func (up *Updater) updateLinuxBinary() error {
 		return nil
 	}
 
-	dlPath, err := up.downloadLinuxTarball(ver)
-	if err != nil {
-		return err
-	}
-	up.Logf("Extracting %q", dlPath)
-	if err := up.unpackLinuxTarball(dlPath); err != nil {
-		return err
-	}
-	if err := os.Remove(dlPath); err != nil {
-		up.Logf("failed to clean up %q: %v", dlPath, err)
+	if up.Rollback && up.restorePreviousBinaries() {
+		up.Logf("Restored the previous binaries")
+	} else {
+		dlPath, err := up.downloadLinuxTarball(ver)
+		if err != nil {
+			return err
+		}
+		up.Logf("Extracting %q", dlPath)
+		if err := up.unpackLinuxTarball(dlPath); err != nil {
+			return err
+		}
+		if err := os.Remove(dlPath); err != nil {
+			up.Logf("failed to clean up %q: %v", dlPath, err)
+		}
 	}
 
 	err = restartSystemdUnit(up.Logf)
@@ -1021,6 +1138,14 @@ func (up *Updater) unpackLinuxTarball(path string) error {
 		return fmt.Errorf("%q has missing or duplicate files: got %v, want %v", path, files, wantFiles)
 	}
 
+	// Keep the current binaries for rollbacks.
+	for _, p := range []string{tailscale, tailscaled} {
+		os.Remove(p + ".prev")
+		if err := os.Link(p, p+".prev"); err != nil {
+			up.Logf("failed to keep %s for rollbacks: %v", p, err)
+		}
+	}
+
 	// Only place the files in final locations after everything extracted correctly.
 	if err := os.Rename(tailscale+".new", tailscale); err != nil {
 		return err
@@ -1033,6 +1158,42 @@ func (up *Updater) unpackLinuxTarball(path string) error {
 	return nil
 }
 
+// restorePreviousBinaries swaps the tailscale and tailscaled binaries with
+// the ones kept by unpackLinuxTarball from before the most recent update,
+// so that a later rollback swaps them back. It reports whether it did so;
+// if the previous binaries are missing, they need to be downloaded.
+func (up *Updater) restorePreviousBinaries() bool {
+	tailscale, tailscaled, err := binaryPaths()
+	if err != nil {
+		return false
+	}
+	bins := []string{tailscale, tailscaled}
+	for _, p := range bins {
+		if _, err := os.Stat(p + ".prev"); err != nil {
+			return false
+		}
+	}
+	for _, p := range bins {
+		// Hard links keep the binaries in place throughout.
+		os.Remove(p + ".cur")
+		if err := os.Link(p, p+".cur"); err != nil {
+			up.Logf("failed to keep %s: %v", p, err)
+			return false
+		}
+	}
+	for _, p := range bins {
+		if err := os.Rename(p+".prev", p); err != nil {
+			up.Logf("failed to restore %s: %v", p, err)
+			return false
+		}
+		if err := os.Rename(p+".cur", p+".prev"); err != nil {
+			up.Logf("failed to keep %s for rollbacks: %v", p, err)
+		}
+		up.Logf("Restored %s", p)
+	}
+	return true
+}
+
 func (up *Updater) updateQNAP() (err error) {
 	if up.Version != "" {
 		return errors.New("installing a specific version on QNAP is not supported")
@@ -608,8 +608,10 @@ func TestUnpackLinuxTarball(t *testing.T) {
 				"/usr/bin/tailscaled": "v2",
 			},
 			after: map[string]string{
-				"tailscale":  "v2",
-				"tailscaled": "v2",
+				"tailscale":       "v2",
+				"tailscaled":      "v2",
+				"tailscale.prev":  "v1",
+				"tailscaled.prev": "v1",
 			},
 		},
 		{
@@ -624,9 +626,11 @@ func TestUnpackLinuxTarball(t *testing.T) {
 				"/usr/bin/tailscaled": "v2",
 			},
 			after: map[string]string{
-				"tailscale":  "v2",
-				"tailscaled": "v2",
-				"foo":        "bar",
+				"tailscale":       "v2",
+				"tailscaled":      "v2",
+				"tailscale.prev":  "v1",
+				"tailscaled.prev": "v1",
+				"foo":             "bar",
 			},
 		},
 		{
@@ -640,8 +644,10 @@ func TestUnpackLinuxTarball(t *testing.T) {
 				"/usr/bin/tailscaled": "v1",
 			},
 			after: map[string]string{
-				"tailscale":  "v1",
-				"tailscaled": "v1",
+				"tailscale":       "v1",
+				"tailscaled":      "v1",
+				"tailscale.prev":  "v1",
+				"tailscaled.prev": "v1",
 			},
 		},
 		{
@@ -656,8 +662,10 @@ func TestUnpackLinuxTarball(t *testing.T) {
 				"/systemd/tailscaled.service": "v2",
 			},
 			after: map[string]string{
-				"tailscale":  "v2",
-				"tailscaled": "v2",
+				"tailscale":       "v2",
+				"tailscaled":      "v2",
+				"tailscale.prev":  "v1",
+				"tailscaled.prev": "v1",
 			},
 		},
 		{
@@ -990,6 +998,7 @@ func TestConfirm(t *testing.T) {
 		fromVer   string
 		toVer     string
 		confirm   func(string) bool
+		rollback  bool
 		want      bool
 	}{
 		{
@@ -1062,6 +1071,15 @@ func TestConfirm(t *testing.T) {
 			toVer:     "1.66.0",
 			want:      false,
 		},
+		{
+			desc:      "rollback",
+			fromTrack: StableTrack,
+			toTrack:   StableTrack,
+			fromVer:   "1.66.1",
+			toVer:     "1.66.0",
+			rollback:  true,
+			want:      true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -1070,9 +1088,10 @@ func TestConfirm(t *testing.T) {
 			up := Updater{
 				currentVersion: tt.fromVer,
 				Arguments: Arguments{
-					Track:   tt.toTrack,
-					Confirm: tt.confirm,
-					Logf:    t.Logf,
+					Track:    tt.toTrack,
+					Confirm:  tt.confirm,
+					Logf:     t.Logf,
+					Rollback: tt.rollback,
 				},
 			}
 
@@ -1082,3 +1101,92 @@ func TestConfirm(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyPin(t *testing.T) {
+	tests := []struct {
+		pin, track, version string
+		wantTrack           string
+		wantVersion         string
+		wantErr             bool
+	}{
+		{pin: "", track: "unstable", wantTrack: "unstable"},
+		{pin: "stable", wantTrack: "stable"},
+		{pin: "stable", track: "stable", wantTrack: "stable"},
+		{pin: "stable", track: "unstable", wantErr: true},
+		{pin: "stable", version: "1.66.0", wantVersion: "1.66.0"},
+		{pin: "stable", version: "1.67.1", wantErr: true},
+		{pin: "release-candidate", version: "1.66.0", wantVersion: "1.66.0"},
+		{pin: "1.66.0", wantVersion: "1.66.0"},
+		{pin: "1.66.0", track: "stable", wantTrack: "stable", wantVersion: "1.66.0"},
+		{pin: "1.66.0", track: "unstable", wantErr: true},
+		{pin: "1.66.0", version: "1.66.2", wantErr: true},
+		{pin: "latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		up := &Updater{Arguments: Arguments{Pin: tt.pin, Track: tt.track, Version: tt.version}}
+		err := up.applyPin()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("pin %q, track %q, version %q: got error %v, want error: %v", tt.pin, tt.track, tt.version, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (up.Track != tt.wantTrack || up.Version != tt.wantVersion) {
+			t.Errorf("pin %q, track %q, version %q: got track %q, version %q; want %q, %q", tt.pin, tt.track, tt.version, up.Track, up.Version, tt.wantTrack, tt.wantVersion)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	oldBinaryPaths := binaryPaths
+	t.Cleanup(func() { binaryPaths = oldBinaryPaths })
+	tmp := t.TempDir()
+	tailscalePath := filepath.Join(tmp, "tailscale")
+	tailscaledPath := filepath.Join(tmp, "tailscaled")
+	binaryPaths = func() (string, string, error) {
+		return tailscalePath, tailscaledPath, nil
+	}
+
+	up := &Updater{
+		Arguments:           Arguments{Logf: t.Logf},
+		currentVersion:      "1.66.0",
+		previousVersionPath: filepath.Join(tmp, "previous-version"),
+	}
+	if _, err := up.previousVersion(); err == nil {
+		t.Fatal("previousVersion succeeded before any update")
+	}
+	if up.restorePreviousBinaries() {
+		t.Fatal("restorePreviousBinaries succeeded before any update")
+	}
+
+	// Updating to 1.66.2 records 1.66.0 and keeps its binaries.
+	for _, p := range []string{tailscalePath, tailscaledPath} {
+		if err := os.WriteFile(p, []byte("1.66.0"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !up.confirm("1.66.2") {
+		t.Fatal("update not confirmed")
+	}
+	tarPath := filepath.Join(tmp, "tailscale.tgz")
+	genTarball(t, tarPath, map[string]string{"tailscale": "1.66.2", "tailscaled": "1.66.2"})
+	if err := up.unpackLinuxTarball(tarPath); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := up.previousVersion(); err != nil || got != "1.66.0" {
+		t.Fatalf("previousVersion = %q, %v; want 1.66.0", got, err)
+	}
+
+	// Rolling back restores them, and keeps 1.66.2's to roll back to.
+	if !up.restorePreviousBinaries() {
+		t.Fatal("restorePreviousBinaries failed")
+	}
+	for p, want := range map[string]string{
+		tailscalePath:            "1.66.0",
+		tailscaledPath:           "1.66.0",
+		tailscalePath + ".prev":  "1.66.2",
+		tailscaledPath + ".prev": "1.66.2",
+	} {
+		if got, err := os.ReadFile(p); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", p, got, err, want)
+		}
+	}
+}
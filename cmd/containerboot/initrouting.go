@@ -0,0 +1,101 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"tailscale.com/util/linuxfw"
+)
+
+// runInitRouting runs containerboot in init container mode: it programs the
+// Pod's firewall to send traffic for cfg's tailnet targets to the egress
+// proxy at cfg.InitRoutingProxy, then returns. It doesn't start tailscaled,
+// so a Pod can reach tailnet targets through a proxy provisioned by the
+// Kubernetes operator without running a proxy sidecar of its own.
+func runInitRouting(ctx context.Context, cfg *settings, nfr linuxfw.NetfilterRunner) error {
+	targets, err := parseInitRoutingTargets(cfg.InitRoutingTargets)
+	if err != nil {
+		return err
+	}
+	proxies, err := resolveInitRoutingProxy(ctx, cfg.InitRoutingProxy)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		proxy, err := proxyForTarget(target, proxies)
+		if err != nil {
+			return err
+		}
+		if err := nfr.EnsureOutputDNATRule(target, proxy); err != nil {
+			return fmt.Errorf("error routing traffic for %v to %v: %w", target, proxy, err)
+		}
+		log.Printf("Routing traffic for %v via egress proxy %v", target, proxy)
+	}
+	return nil
+}
+
+// parseInitRoutingTargets parses the comma-separated list of tailnet target
+// IP addresses in s.
+func parseInitRoutingTargets(s string) ([]netip.Addr, error) {
+	var targets []netip.Addr
+	for t := range strings.SplitSeq(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		ip, err := netip.ParseAddr(t)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing TS_EXPERIMENTAL_INIT_ROUTING_TARGETS value %q: %w", t, err)
+		}
+		targets = append(targets, ip)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("TS_EXPERIMENTAL_INIT_ROUTING_TARGETS contains no IP addresses")
+	}
+	return targets, nil
+}
+
+// resolveInitRoutingProxy returns the IP addresses of proxy, which is an IP
+// address or a DNS name. Cluster DNS may not be reachable yet when an init
+// container starts, so failed lookups are retried until ctx is done.
+func resolveInitRoutingProxy(ctx context.Context, proxy string) ([]netip.Addr, error) {
+	if ip, err := netip.ParseAddr(proxy); err == nil {
+		return []netip.Addr{ip}, nil
+	}
+	for {
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", proxy)
+		if err == nil && len(ips) > 0 {
+			for i, ip := range ips {
+				ips[i] = ip.Unmap()
+			}
+			return ips, nil
+		}
+		log.Printf("Error resolving egress proxy %q, retrying: %v", proxy, err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error resolving egress proxy %q: %w", proxy, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// proxyForTarget returns the address in proxies of the same IP family as
+// target.
+func proxyForTarget(target netip.Addr, proxies []netip.Addr) (netip.Addr, error) {
+	for _, p := range proxies {
+		if p.Is4() == target.Is4() {
+			return p, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("egress proxy has no address of the same IP family as %v (has %v)", target, proxies)
+}
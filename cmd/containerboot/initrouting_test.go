@@ -0,0 +1,98 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"tailscale.com/util/linuxfw"
+)
+
+// recordingNetfilterRunner records the rules added by EnsureOutputDNATRule.
+type recordingNetfilterRunner struct {
+	linuxfw.NetfilterRunner
+	rules [][2]netip.Addr // origDst, dst
+}
+
+func (r *recordingNetfilterRunner) EnsureOutputDNATRule(origDst, dst netip.Addr) error {
+	r.rules = append(r.rules, [2]netip.Addr{origDst, dst})
+	return nil
+}
+
+func TestRunInitRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxy   string
+		targets string
+		want    [][2]netip.Addr
+		wantErr bool
+	}{
+		{
+			name:    "v4",
+			proxy:   "10.0.0.5",
+			targets: "100.64.0.1, 100.64.0.2",
+			want: [][2]netip.Addr{
+				{netip.MustParseAddr("100.64.0.1"), netip.MustParseAddr("10.0.0.5")},
+				{netip.MustParseAddr("100.64.0.2"), netip.MustParseAddr("10.0.0.5")},
+			},
+		},
+		{
+			name:    "v6",
+			proxy:   "fd00::5",
+			targets: "fd7a:115c:a1e0::1",
+			want: [][2]netip.Addr{
+				{netip.MustParseAddr("fd7a:115c:a1e0::1"), netip.MustParseAddr("fd00::5")},
+			},
+		},
+		{
+			name:    "family_mismatch",
+			proxy:   "10.0.0.5",
+			targets: "fd7a:115c:a1e0::1",
+			wantErr: true,
+		},
+		{
+			name:    "bad_target",
+			proxy:   "10.0.0.5",
+			targets: "foo",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nfr := &recordingNetfilterRunner{NetfilterRunner: linuxfw.NewFakeNetfilterRunner()}
+			cfg := &settings{InitRoutingProxy: tt.proxy, InitRoutingTargets: tt.targets}
+			err := runInitRouting(context.Background(), cfg, nfr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runInitRouting() error = %v; wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(nfr.rules, tt.want) {
+				t.Errorf("rules = %v; want %v", nfr.rules, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateInitRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       settings
+		wantErr bool
+	}{
+		{"proxy_and_targets", settings{InitRoutingProxy: "egress.tailscale", InitRoutingTargets: "100.64.0.1"}, false},
+		{"proxy_without_targets", settings{InitRoutingProxy: "egress.tailscale"}, true},
+		{"targets_without_proxy", settings{InitRoutingTargets: "100.64.0.1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.s.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v; wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
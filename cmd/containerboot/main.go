@@ -76,8 +76,18 @@
 //     for more information on the metrics exposed.
 //   - TS_ENABLE_HEALTH_CHECK: if true, a health check endpoint will be served at /healthz on
 //     the address specified by TS_LOCAL_ADDR_PORT. The health endpoint will return 200
-//     OK if this node has at least one tailnet IP address, otherwise returns 503.
-//     NB: the health criteria might change in the future.
+//     OK if this node meets the criteria in TS_READY_CRITERIA (by default, if it has
+//     at least one tailnet IP address), otherwise returns 503 with the unmet criteria.
+//   - TS_READY_CRITERIA: comma-separated list of the criteria this node must meet to
+//     be considered ready by the health check endpoint and TS_READY_FILE. Defaults
+//     to "has-ip". Criteria are:
+//     "logged-in": tailscaled is logged in and running;
+//     "has-ip": the node has at least one tailnet IP address;
+//     "route=<prefix>": the node advertises the route and it has been approved;
+//     "serve-config": the serve config in TS_SERVE_CONFIG has been applied.
+//   - TS_READY_FILE: if specified, a path at which a file is written when this
+//     node meets TS_READY_CRITERIA and removed when it doesn't, for use with
+//     Kubernetes exec readiness probes (for example, "test -f <path>").
 //   - TS_EXPERIMENTAL_VERSIONED_CONFIG_DIR: if specified, a path to a
 //     directory that containers tailscaled config in file. The config file needs to be
 //     named cap-<current-tailscaled-cap>.hujson. If this is set, TS_HOSTNAME,
@@ -105,6 +115,15 @@
 //     containerboot instance is not running in Kubernetes, autoadvertise any services
 //     defined in the devices serve config, and unadvertise on shutdown. Defaults
 //     to `true`, but can be disabled to allow user specific advertisement configuration.
+//   - TS_EXPERIMENTAL_INIT_ROUTING_PROXY: if set, containerboot runs as an init
+//     container: it programs the Pod's firewall to send traffic for the tailnet
+//     IPs in TS_EXPERIMENTAL_INIT_ROUTING_TARGETS to the egress proxy at this IP
+//     address or DNS name, and exits without starting tailscaled. This lets Pods
+//     reach tailnet targets through an operator-provisioned egress proxy without
+//     running a proxy sidecar. The init container needs the NET_ADMIN capability.
+//     NB: This env var is currently experimental and the logic will likely change!
+//   - TS_EXPERIMENTAL_INIT_ROUTING_TARGETS: comma-separated list of tailnet IP
+//     addresses whose traffic is routed to TS_EXPERIMENTAL_INIT_ROUTING_PROXY.
 //
 // When running on Kubernetes, containerboot defaults to storing state in the
 // "tailscale" kube secret. To store state on local disk instead, set
@@ -180,6 +199,16 @@ func run() error {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	if cfg.InitRoutingProxy != "" {
+		nfr, err := newNetfilterRunner(log.Printf)
+		if err != nil {
+			return fmt.Errorf("error creating new netfilter runner: %w", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		return runInitRouting(ctx, cfg, nfr)
+	}
+
 	if !cfg.UserspaceMode {
 		if err := ensureTunFile(cfg.Root); err != nil {
 			return fmt.Errorf("unable to create tuntap device file: %w", err)
@@ -300,6 +329,11 @@ func run() error {
 		defer close()
 	}
 
+	ready, err := newReadiness(cfg, healthCheck)
+	if err != nil {
+		return err
+	}
+
 	if cfg.EnableForwardingOptimizations {
 		if err := client.SetUDPGROForwarding(bootCtx); err != nil {
 			log.Printf("[unexpected] error enabling UDP GRO forwarding: %v", err)
@@ -747,9 +781,19 @@ func run() error {
 				}
 			}
 
-			if healthCheck != nil {
-				healthCheck.Update(len(addrs) != 0)
+			rs := readyState{
+				loggedIn:       true, // we're in the running state
+				addrs:          addrs,
+				approvedRoutes: nm.SelfNode.AllowedIPs().AsSlice(),
+			}
+			if ready.wantsRoutes() {
+				if prefs, err := client.GetPrefs(ctx); err != nil {
+					log.Printf("error getting prefs to check readiness: %v", err)
+				} else {
+					rs.advertisedRoutes = prefs.AdvertiseRoutes
+				}
 			}
+			ready.update(rs)
 
 			var prevServeConfig *ipn.ServeConfig
 			if getAutoAdvertiseBool() {
@@ -766,7 +810,7 @@ func run() error {
 
 			if cfg.ServeConfigPath != "" {
 				triggerWatchServeConfigChanges.Do(func() {
-					go watchServeConfigChanges(ctx, certDomainChanged, certDomain, client, kc, cfg, prevServeConfig)
+					go watchServeConfigChanges(ctx, certDomainChanged, certDomain, client, kc, cfg, prevServeConfig, ready)
 				})
 			}
 
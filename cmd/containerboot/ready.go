@@ -0,0 +1,192 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	healthz "tailscale.com/kube/health"
+)
+
+// Readiness criteria that can be listed in TS_READY_CRITERIA.
+const (
+	readyLoggedIn    = "logged-in"    // tailscaled is logged in and running
+	readyHasIP       = "has-ip"       // the node has at least one tailnet IP
+	readyServeConfig = "serve-config" // the TS_SERVE_CONFIG serve config has been applied
+	readyRoutePrefix = "route="       // route=<prefix>: the route is advertised and approved
+)
+
+// defaultReadyCriteria are the criteria used if TS_READY_CRITERIA is unset.
+// They match what the health check endpoint has always checked.
+const defaultReadyCriteria = readyHasIP
+
+// readyCriterion is a parsed entry of TS_READY_CRITERIA.
+type readyCriterion struct {
+	name  string       // one of the ready* constants, without route='s prefix
+	route netip.Prefix // for route criteria
+}
+
+func (c readyCriterion) String() string {
+	if c.route.IsValid() {
+		return readyRoutePrefix + c.route.String()
+	}
+	return c.name
+}
+
+// parseReadyCriteria parses the comma-separated list of readiness criteria in
+// s. See the TS_READY_CRITERIA docs in main.go.
+func parseReadyCriteria(s string) ([]readyCriterion, error) {
+	var cs []readyCriterion
+	for f := range strings.SplitSeq(s, ",") {
+		f = strings.TrimSpace(f)
+		switch {
+		case f == "":
+			continue
+		case f == readyLoggedIn, f == readyHasIP, f == readyServeConfig:
+			cs = append(cs, readyCriterion{name: f})
+		case strings.HasPrefix(f, readyRoutePrefix):
+			p, err := netip.ParsePrefix(strings.TrimPrefix(f, readyRoutePrefix))
+			if err != nil {
+				return nil, fmt.Errorf("invalid route in readiness criterion %q: %w", f, err)
+			}
+			cs = append(cs, readyCriterion{name: "route", route: p.Masked()})
+		default:
+			return nil, fmt.Errorf("unknown readiness criterion %q", f)
+		}
+	}
+	if len(cs) == 0 {
+		return nil, errors.New("no readiness criteria")
+	}
+	return cs, nil
+}
+
+// readyState is the state of the node that readiness criteria are checked
+// against.
+type readyState struct {
+	loggedIn           bool
+	addrs              []netip.Prefix // the node's tailnet IPs
+	advertisedRoutes   []netip.Prefix // from prefs
+	approvedRoutes     []netip.Prefix // the node's AllowedIPs
+	serveConfigApplied bool
+}
+
+// unmetReadyCriteria returns the criteria in cs that st doesn't meet.
+func unmetReadyCriteria(cs []readyCriterion, st readyState) []readyCriterion {
+	var unmet []readyCriterion
+	for _, c := range cs {
+		var ok bool
+		switch c.name {
+		case readyLoggedIn:
+			ok = st.loggedIn
+		case readyHasIP:
+			ok = len(st.addrs) > 0
+		case readyServeConfig:
+			ok = st.serveConfigApplied
+		case "route":
+			ok = slices.Contains(st.advertisedRoutes, c.route) && slices.Contains(st.approvedRoutes, c.route)
+		}
+		if !ok {
+			unmet = append(unmet, c)
+		}
+	}
+	return unmet
+}
+
+// readiness tracks whether the node meets its readiness criteria, and
+// reports that via the health check endpoint and the ready file, if
+// configured.
+type readiness struct {
+	criteria    []readyCriterion
+	file        string           // or empty if TS_READY_FILE is unset
+	healthCheck *healthz.Healthz // or nil if health checks are disabled
+
+	mu    sync.Mutex
+	st    readyState
+	ready bool
+}
+
+// newReadiness returns a readiness for cfg that reports to healthCheck, which
+// may be nil. It removes any ready file left by a previous run.
+func newReadiness(cfg *settings, healthCheck *healthz.Healthz) (*readiness, error) {
+	r := &readiness{
+		criteria:    cfg.ReadyCriteria,
+		file:        cfg.ReadyFile,
+		healthCheck: healthCheck,
+	}
+	if r.file != "" {
+		if err := os.Remove(r.file); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("removing stale ready file: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// wantsRoutes reports whether any of r's criteria is a route, so that the
+// caller needs to populate the routes in readyState.
+func (r *readiness) wantsRoutes() bool {
+	return slices.ContainsFunc(r.criteria, func(c readyCriterion) bool { return c.route.IsValid() })
+}
+
+// update re-checks r's criteria against st, except for whether the serve
+// config is applied, which is set by setServeConfigApplied.
+func (r *readiness) update(st readyState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st.serveConfigApplied = r.st.serveConfigApplied
+	r.st = st
+	r.checkLocked()
+}
+
+// setServeConfigApplied records that the serve config has been applied and
+// re-checks r's criteria.
+func (r *readiness) setServeConfigApplied() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.st.serveConfigApplied = true
+	r.checkLocked()
+}
+
+func (r *readiness) checkLocked() {
+	unmet := unmetReadyCriteria(r.criteria, r.st)
+	ready := len(unmet) == 0
+	var reason string
+	if !ready {
+		names := make([]string, len(unmet))
+		for i, c := range unmet {
+			names[i] = c.String()
+		}
+		reason = "unmet readiness criteria: " + strings.Join(names, ", ")
+	}
+	if r.healthCheck != nil {
+		r.healthCheck.UpdateStatus(ready, reason)
+	}
+	if ready == r.ready {
+		return
+	}
+	r.ready = ready
+	if ready {
+		log.Printf("Ready: all readiness criteria met")
+	} else {
+		log.Printf("Not ready: %s", reason)
+	}
+	if r.file == "" {
+		return
+	}
+	if ready {
+		if err := os.WriteFile(r.file, []byte("ready\n"), 0644); err != nil {
+			log.Printf("[unexpected] error writing ready file: %v", err)
+		}
+	} else if err := os.Remove(r.file); err != nil && !os.IsNotExist(err) {
+		log.Printf("[unexpected] error removing ready file: %v", err)
+	}
+}
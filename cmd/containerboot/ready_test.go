@@ -0,0 +1,97 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseReadyCriteria(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "has-ip", want: []string{"has-ip"}},
+		{in: " logged-in, has-ip ,route=10.1.2.3/24,serve-config,", want: []string{"logged-in", "has-ip", "route=10.1.2.0/24", "serve-config"}},
+		{in: "", wantErr: true},
+		{in: "route=foo", wantErr: true},
+		{in: "has-ips", wantErr: true},
+	}
+	for _, tt := range tests {
+		cs, err := parseReadyCriteria(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseReadyCriteria(%q) error = %v; want error: %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		var got []string
+		for _, c := range cs {
+			got = append(got, c.String())
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("parseReadyCriteria(%q) mismatch (-want +got):\n%s", tt.in, diff)
+		}
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	cs, err := parseReadyCriteria("logged-in,has-ip,route=10.0.0.0/24,serve-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "ready")
+	if err := os.WriteFile(file, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := newReadiness(&settings{ReadyCriteria: cs, ReadyFile: file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.wantsRoutes() {
+		t.Error("wantsRoutes = false; want true")
+	}
+	checkReady := func(want bool, wantUnmet ...string) {
+		t.Helper()
+		var unmet []string
+		for _, c := range unmetReadyCriteria(r.criteria, r.st) {
+			unmet = append(unmet, c.String())
+		}
+		if diff := cmp.Diff(wantUnmet, unmet); diff != "" {
+			t.Errorf("unmet criteria mismatch (-want +got):\n%s", diff)
+		}
+		if _, err := os.Stat(file); (err == nil) != want {
+			t.Errorf("ready file exists = %v; want %v", err == nil, want)
+		}
+	}
+	checkReady(false, "logged-in", "has-ip", "route=10.0.0.0/24", "serve-config")
+
+	route := netip.MustParsePrefix("10.0.0.0/24")
+	st := readyState{
+		loggedIn:         true,
+		addrs:            []netip.Prefix{netip.MustParsePrefix("100.64.0.1/32")},
+		advertisedRoutes: []netip.Prefix{route},
+	}
+	r.update(st)
+	checkReady(false, "route=10.0.0.0/24", "serve-config")
+
+	st.approvedRoutes = []netip.Prefix{route}
+	r.update(st)
+	checkReady(false, "serve-config")
+
+	r.setServeConfigApplied()
+	checkReady(true)
+
+	// Losing the approval makes the node unready again, without
+	// forgetting that the serve config was applied.
+	st.approvedRoutes = nil
+	r.update(st)
+	checkReady(false, "route=10.0.0.0/24")
+}
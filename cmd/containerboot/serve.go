@@ -33,7 +33,8 @@
 // is written to when the certDomain changes, causing the serve config to be
 // re-read and applied. prevServeConfig is the serve config that was fetched
 // during startup. This will be refreshed by the goroutine when serve config changes.
-func watchServeConfigChanges(ctx context.Context, cdChanged <-chan bool, certDomainAtomic *atomic.Pointer[string], lc *local.Client, kc *kubeClient, cfg *settings, prevServeConfig *ipn.ServeConfig) {
+// Once the serve config has been applied, ready is told so.
+func watchServeConfigChanges(ctx context.Context, cdChanged <-chan bool, certDomainAtomic *atomic.Pointer[string], lc *local.Client, kc *kubeClient, cfg *settings, prevServeConfig *ipn.ServeConfig, ready *readiness) {
 	if certDomainAtomic == nil {
 		panic("certDomainAtomic must not be nil")
 	}
@@ -92,6 +93,7 @@ func watchServeConfigChanges(ctx context.Context, cdChanged <-chan bool, certDom
 				continue
 			}
 			if prevServeConfig != nil && reflect.DeepEqual(sc, prevServeConfig) {
+				ready.setServeConfigApplied()
 				continue
 			}
 			if err := updateServeConfig(ctx, sc, certDomain, klc.New(lc)); err != nil {
@@ -103,6 +105,7 @@ func watchServeConfigChanges(ctx context.Context, cdChanged <-chan bool, certDom
 				}
 			}
 			prevServeConfig = sc
+			ready.setServeConfigApplied()
 			if cfg.CertShareMode != "rw" {
 				continue
 			}
@@ -13,6 +13,7 @@
 	"net/netip"
 	"os"
 	"path"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -85,6 +86,19 @@ type settings struct {
 	// certs) and 'rw' for Pods that should manage the TLS certs shared
 	// amongst the replicas.
 	CertShareMode string
+	// InitRoutingProxy, if set, runs containerboot as an init container
+	// that routes the Pod's traffic for InitRoutingTargets to the egress
+	// proxy at this IP address or DNS name, and exits.
+	InitRoutingProxy string
+	// InitRoutingTargets is a comma-separated list of tailnet IP
+	// addresses whose traffic is routed to InitRoutingProxy.
+	InitRoutingTargets string
+	// ReadyCriteria are the criteria the node must meet to be considered
+	// ready by the health check endpoint and ReadyFile.
+	ReadyCriteria []readyCriterion
+	// ReadyFile, if set, is the path of a file that's written when the node
+	// is ready and removed when it's not, for use by readiness probes.
+	ReadyFile string
 }
 
 func configFromEnv() (*settings, error) {
@@ -130,8 +144,17 @@ func configFromEnv() (*settings, error) {
 		EgressProxiesCfgPath:                  defaultEnv("TS_EGRESS_PROXIES_CONFIG_PATH", ""),
 		IngressProxiesCfgPath:                 defaultEnv("TS_INGRESS_PROXIES_CONFIG_PATH", ""),
 		PodUID:                                defaultEnv("POD_UID", ""),
+		InitRoutingProxy:                      defaultEnv("TS_EXPERIMENTAL_INIT_ROUTING_PROXY", ""),
+		InitRoutingTargets:                    defaultEnv("TS_EXPERIMENTAL_INIT_ROUTING_TARGETS", ""),
+		ReadyFile:                             defaultEnv("TS_READY_FILE", ""),
 	}
 
+	readyCriteria, err := parseReadyCriteria(defaultEnv("TS_READY_CRITERIA", defaultReadyCriteria))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing TS_READY_CRITERIA: %w", err)
+	}
+	cfg.ReadyCriteria = readyCriteria
+
 	podIPs, ok := os.LookupEnv("POD_IPS")
 	if ok {
 		ips := strings.Split(podIPs, ",")
@@ -248,6 +271,13 @@ func (s *settings) validate() error {
 			return fmt.Errorf("error validating tailscaled configfile contents: %w", err)
 		}
 	}
+	if s.InitRoutingProxy != "" {
+		if _, err := parseInitRoutingTargets(s.InitRoutingTargets); err != nil {
+			return err
+		}
+	} else if s.InitRoutingTargets != "" {
+		return errors.New("TS_EXPERIMENTAL_INIT_ROUTING_TARGETS is set but TS_EXPERIMENTAL_INIT_ROUTING_PROXY is not")
+	}
 	if s.ProxyTargetIP != "" && s.UserspaceMode {
 		return errors.New("TS_DEST_IP is not supported with TS_USERSPACE")
 	}
@@ -338,6 +368,9 @@ func (s *settings) validate() error {
 	if s.HealthCheckEnabled && s.HealthCheckAddrPort != "" {
 		return errors.New("TS_HEALTHCHECK_ADDR_PORT is deprecated and will be removed in 1.82.0, use TS_ENABLE_HEALTH_CHECK and optionally TS_LOCAL_ADDR_PORT")
 	}
+	if slices.ContainsFunc(s.ReadyCriteria, func(c readyCriterion) bool { return c.name == readyServeConfig }) && s.ServeConfigPath == "" {
+		return errors.New("TS_READY_CRITERIA includes serve-config but TS_SERVE_CONFIG is not set")
+	}
 	if s.EgressProxiesCfgPath != "" && !(s.InKubernetes && s.KubeSecret != "") {
 		return errors.New("TS_EGRESS_PROXIES_CONFIG_PATH is only supported for Tailscale running on Kubernetes")
 	}
@@ -60,6 +60,7 @@
 	httpPort    = flag.Int("http-port", 80, "The port on which to serve HTTP. Set to -1 to disable. The listener is bound to the same IP (if any) as specified in the -a flag.")
 	stunPort    = flag.Int("stun-port", 3478, "The UDP port on which to serve STUN. The listener is bound to the same IP (if any) as specified in the -a flag.")
 	configPath  = flag.String("c", "", "config file path")
+	configFile  = flag.String("config-file", "", "optional path to a HUJSON settings file, as an alternative to flags; flags given on the command line take precedence. Some settings, like client verification and rate limits, are reloaded when the file changes or on SIGHUP. Unrelated to -c, which holds the server's private key.")
 	certMode    = flag.String("certmode", "letsencrypt", "mode for getting a cert. possible options: manual, letsencrypt, gcp")
 	certDir     = flag.String("certdir", tsweb.DefaultCertDir("derper-certs"), "directory to store ACME (e.g. LetsEncrypt) certs, if addr's port is :443")
 	hostname    = flag.String("hostname", "derp.tailscale.com", "TLS host name for certs, if addr's port is :443. When --certmode=manual, this can be an IP address to avoid SNI checks")
@@ -67,6 +68,8 @@
 	acmeEABKey  = flag.String("acme-eab-key", "", "ACME External Account Binding (EAB) HMAC key, base64-encoded (required for --certmode=gcp)")
 	acmeEmail   = flag.String("acme-email", "", "ACME account contact email address (required for --certmode=gcp, optional for letsencrypt)")
 	runSTUN     = flag.Bool("stun", true, "whether to run a STUN server. It will bind to the same IP (if any) as the --addr flag value.")
+	runSTUNTCP  = flag.Bool("stun-tcp", false, "whether the STUN server also serves STUN over TCP on --stun-port, for clients on networks that block UDP")
+	relayMax    = flag.Int("relay-max-allocations", 0, "if positive, serve UDP relay allocations for disco traffic at /relay, for clients on networks that block UDP, allowing up to this many at once")
 	runDERP     = flag.Bool("derp", true, "whether to run a DERP server. The only reason to set this false is if you're decommissioning a server but want to keep its bootstrap DNS functionality still running.")
 	flagHome    = flag.String("home", "", "what to serve at the root path. It may be left empty (the default, for a default homepage), \"blank\" for a blank page, or a URL to redirect to")
 
@@ -165,6 +168,14 @@ func main() {
 		return
 	}
 
+	var st *settings
+	if *configFile != "" {
+		st = newSettings(flag.CommandLine, *configFile)
+		if _, err := st.load(false); err != nil {
+			log.Fatalf("derper: config: %v", err)
+		}
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
@@ -181,7 +192,11 @@ func main() {
 
 	if *runSTUN {
 		ss := stunserver.New(ctx)
-		go ss.ListenAndServe(net.JoinHostPort(listenHost, fmt.Sprint(*stunPort)))
+		stunAddr := net.JoinHostPort(listenHost, fmt.Sprint(*stunPort))
+		go ss.ListenAndServe(stunAddr)
+		if *runSTUNTCP {
+			go ss.ListenAndServeTCP(stunAddr)
+		}
 	}
 
 	cfg := loadConfig()
@@ -198,7 +213,10 @@ func main() {
 		if err := s.LoadAndApplyRateConfig(*rateConfigPath); err != nil {
 			log.Fatalf("derper: loading rate config: %v", err)
 		}
-		go watchRateConfig(ctx, s, *rateConfigPath)
+	}
+	acceptLim := rate.NewLimiter(rate.Limit(*acceptConnLimit), *acceptConnBurst)
+	if st != nil || *rateConfigPath != "" {
+		go watchConfig(ctx, st, s, acceptLim)
 	}
 
 	var meshKey string
@@ -275,6 +293,10 @@ func main() {
 	mux.HandleFunc("/derp/probe", derpserver.ProbeHandler)
 	mux.HandleFunc("/derp/latency-check", derpserver.ProbeHandler)
 
+	if *relayMax > 0 {
+		mux.Handle("/relay", newRelayServer(*relayMax))
+	}
+
 	go refreshBootstrapDNSLoop()
 	mux.HandleFunc("/bootstrap-dns", tsweb.BrowserHeaderHandlerFunc(handleBootstrapDNS))
 	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -419,7 +441,7 @@ func main() {
 				}
 			}()
 		}
-		err = rateLimitedListenAndServeTLS(httpsrv, &lc)
+		err = rateLimitedListenAndServeTLS(httpsrv, &lc, acceptLim)
 	} else {
 		log.Printf("derper: serving on %s", *addr)
 		var ln net.Listener
@@ -434,27 +456,6 @@ func main() {
 	}
 }
 
-// watchRateConfig listens for SIGHUP signals and reloads the rate config
-// file on each signal, applying it to the server. It returns when ctx is done.
-func watchRateConfig(ctx context.Context, s *derpserver.Server, path string) {
-	sighup := make(chan os.Signal, 1)
-	signal.Notify(sighup, syscall.SIGHUP)
-	defer signal.Stop(sighup)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-sighup:
-			log.Printf("derper: received SIGHUP, reloading rate config from %s", path)
-			if err := s.LoadAndApplyRateConfig(path); err != nil {
-				log.Printf("derper: rate config reload failed: %v", err)
-				continue
-			}
-			log.Printf("derper: rate config reloaded successfully")
-		}
-	}
-}
-
 var validProdHostname = regexp.MustCompile(`^derp([^.]*)\.tailscale\.com\.?$`)
 
 func prodAutocertHostPolicy(_ context.Context, host string) error {
@@ -481,12 +482,12 @@ func defaultMeshPSKFile() string {
 	return ""
 }
 
-func rateLimitedListenAndServeTLS(srv *http.Server, lc *net.ListenConfig) error {
+func rateLimitedListenAndServeTLS(srv *http.Server, lc *net.ListenConfig, lim *rate.Limiter) error {
 	ln, err := lc.Listen(context.Background(), "tcp", cmp.Or(srv.Addr, ":https"))
 	if err != nil {
 		return err
 	}
-	rln := newRateLimitedListener(ln, rate.Limit(*acceptConnLimit), *acceptConnBurst)
+	rln := newRateLimitedListener(ln, lim)
 	expvar.Publish("tls_listener", rln.ExpVar())
 	defer rln.Close()
 	return srv.ServeTLS(rln, "", "")
@@ -504,8 +505,8 @@ type rateLimitedListener struct {
 	lim *rate.Limiter
 }
 
-func newRateLimitedListener(ln net.Listener, limit rate.Limit, burst int) *rateLimitedListener {
-	return &rateLimitedListener{Listener: ln, lim: rate.NewLimiter(limit, burst)}
+func newRateLimitedListener(ln net.Listener, lim *rate.Limiter) *rateLimitedListener {
+	return &rateLimitedListener{Listener: ln, lim: lim}
 }
 
 func (ln *rateLimitedListener) ExpVar() expvar.Var {
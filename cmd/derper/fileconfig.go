@@ -0,0 +1,391 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/tailscale/hujson"
+	"golang.org/x/time/rate"
+	"tailscale.com/derp/derpserver"
+	"tailscale.com/tstime"
+	"tailscale.com/util/set"
+)
+
+// fileConfig is the contents of the --config-file settings file, in HUJSON
+// (JSON with comments and trailing commas). Each setting corresponds to the
+// command-line flag named in its comment; flags given on the command line
+// take precedence over the file. Settings that are omitted or empty use the
+// flag's value.
+//
+// Changes to the file are applied when it's written or derper gets a
+// SIGHUP, but only for the settings in reloadableFlags; changing any other
+// setting requires a restart.
+type fileConfig struct {
+	Addr           string // -a
+	HTTPPort       *int   // -http-port
+	Hostname       string // -hostname
+	Home           string // -home
+	DERP           *bool  // -derp
+	PrivateKeyFile string // -c
+
+	Certs *struct {
+		Mode       string // -certmode
+		Dir        string // -certdir
+		ACMEEABKid string // -acme-eab-kid
+		ACMEEABKey string // -acme-eab-key
+		ACMEEmail  string // -acme-email
+	}
+
+	STUN *struct {
+		Enabled *bool // -stun
+		Port    *int  // -stun-port
+		TCP     *bool // -stun-tcp
+	}
+
+	Relay *struct {
+		MaxAllocations *int // -relay-max-allocations
+	}
+
+	Mesh *struct {
+		PSKFile           string   // -mesh-psk-file
+		With              []string // -mesh-with
+		SecretsURL        string   // -secrets-url
+		SecretsPathPrefix string   // -secrets-path-prefix
+		SecretsCacheDir   string   // -secrets-cache-dir
+	}
+
+	VerifyClients *struct {
+		Enabled          *bool  // -verify-clients
+		URL              string // -verify-client-url
+		URLFailOpen      *bool  // -verify-client-url-fail-open
+		TailscaledSocket string // -socket
+	}
+
+	RateLimits *struct {
+		AcceptConnectionLimit *float64 // -accept-connection-limit
+		AcceptConnectionBurst *int     // -accept-connection-burst
+		ConfigFile            string   // -rate-config
+	}
+
+	BootstrapDNS *struct {
+		Names            []string // -bootstrap-dns-names
+		UnpublishedNames []string // -unpublished-bootstrap-dns-names
+	}
+
+	TCP *struct {
+		KeepAlive    *tstime.GoDuration // -tcp-keepalive-time
+		UserTimeout  *tstime.GoDuration // -tcp-user-timeout
+		WriteTimeout *tstime.GoDuration // -tcp-write-timeout
+	}
+}
+
+// reloadableFlags are the flags whose settings in the --config-file settings
+// file can change while derper is running.
+var reloadableFlags = set.Of(
+	"verify-clients",
+	"verify-client-url",
+	"verify-client-url-fail-open",
+	"accept-connection-limit",
+	"accept-connection-burst",
+	"rate-config",
+	"tcp-write-timeout",
+)
+
+// parseFileConfig parses the HUJSON settings file contents b.
+func parseFileConfig(b []byte) (*fileConfig, error) {
+	b, err := hujson.Standardize(b)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	fc := new(fileConfig)
+	if err := dec.Decode(fc); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+// flagValues returns the flag values that fc sets, keyed by flag name.
+func (fc *fileConfig) flagValues() map[string]string {
+	m := map[string]string{}
+	str := func(name, v string) {
+		if v != "" {
+			m[name] = v
+		}
+	}
+	list := func(name string, v []string) {
+		if len(v) > 0 {
+			m[name] = strings.Join(v, ",")
+		}
+	}
+	boolp := func(name string, v *bool) {
+		if v != nil {
+			m[name] = strconv.FormatBool(*v)
+		}
+	}
+	intp := func(name string, v *int) {
+		if v != nil {
+			m[name] = strconv.Itoa(*v)
+		}
+	}
+	durp := func(name string, v *tstime.GoDuration) {
+		if v != nil {
+			m[name] = v.String()
+		}
+	}
+
+	str("a", fc.Addr)
+	intp("http-port", fc.HTTPPort)
+	str("hostname", fc.Hostname)
+	str("home", fc.Home)
+	boolp("derp", fc.DERP)
+	str("c", fc.PrivateKeyFile)
+	if c := fc.Certs; c != nil {
+		str("certmode", c.Mode)
+		str("certdir", c.Dir)
+		str("acme-eab-kid", c.ACMEEABKid)
+		str("acme-eab-key", c.ACMEEABKey)
+		str("acme-email", c.ACMEEmail)
+	}
+	if c := fc.STUN; c != nil {
+		boolp("stun", c.Enabled)
+		intp("stun-port", c.Port)
+		boolp("stun-tcp", c.TCP)
+	}
+	if c := fc.Relay; c != nil {
+		intp("relay-max-allocations", c.MaxAllocations)
+	}
+	if c := fc.Mesh; c != nil {
+		str("mesh-psk-file", c.PSKFile)
+		list("mesh-with", c.With)
+		str("secrets-url", c.SecretsURL)
+		str("secrets-path-prefix", c.SecretsPathPrefix)
+		str("secrets-cache-dir", c.SecretsCacheDir)
+	}
+	if c := fc.VerifyClients; c != nil {
+		boolp("verify-clients", c.Enabled)
+		str("verify-client-url", c.URL)
+		boolp("verify-client-url-fail-open", c.URLFailOpen)
+		str("socket", c.TailscaledSocket)
+	}
+	if c := fc.RateLimits; c != nil {
+		if c.AcceptConnectionLimit != nil {
+			m["accept-connection-limit"] = strconv.FormatFloat(*c.AcceptConnectionLimit, 'g', -1, 64)
+		}
+		intp("accept-connection-burst", c.AcceptConnectionBurst)
+		str("rate-config", c.ConfigFile)
+	}
+	if c := fc.BootstrapDNS; c != nil {
+		list("bootstrap-dns-names", c.Names)
+		list("unpublished-bootstrap-dns-names", c.UnpublishedNames)
+	}
+	if c := fc.TCP; c != nil {
+		durp("tcp-keepalive-time", c.KeepAlive)
+		durp("tcp-user-timeout", c.UserTimeout)
+		durp("tcp-write-timeout", c.WriteTimeout)
+	}
+	return m
+}
+
+// settings applies the --config-file settings file to the flags in fs.
+type settings struct {
+	fs       *flag.FlagSet
+	path     string
+	explicit set.Set[string] // flags set on the command line
+	applied  map[string]string
+}
+
+// newSettings returns settings for the flags in fs, which must have been
+// parsed, read from the file at path.
+func newSettings(fs *flag.FlagSet, path string) *settings {
+	st := &settings{fs: fs, path: path, explicit: set.Set[string]{}}
+	fs.Visit(func(f *flag.Flag) { st.explicit.Add(f.Name) })
+	return st
+}
+
+// load reads the settings file and sets the flags it configures, other than
+// those set on the command line. If reload is true, it only changes flags
+// in reloadableFlags, logging any other changes, and resets flags that were
+// removed from the file to their defaults.
+//
+// It returns the names of the flags it changed.
+func (st *settings) load(reload bool) (changed []string, err error) {
+	b, err := os.ReadFile(st.path)
+	if err != nil {
+		return nil, err
+	}
+	fc, err := parseFileConfig(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", st.path, err)
+	}
+	vals := fc.flagValues()
+
+	names := make([]string, 0, len(vals))
+	for name := range vals {
+		names = append(names, name)
+	}
+	for name := range st.applied {
+		if _, ok := vals[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	// Check all the values before changing any flags, so that a bad
+	// file is ignored as a whole.
+	next := make(map[string]string, len(vals))
+	for _, name := range names {
+		if st.explicit.Contains(name) {
+			continue
+		}
+		f := st.fs.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown flag %q", name)
+		}
+		v, ok := vals[name]
+		if !ok {
+			v = f.DefValue
+		}
+		if v == f.Value.String() {
+			continue
+		}
+		if reload && !reloadableFlags.Contains(name) {
+			log.Printf("derper: config: changing %s requires a restart; ignoring", name)
+			continue
+		}
+		next[name] = v
+	}
+	old := make(map[string]string, len(next))
+	for _, name := range names {
+		v, ok := next[name]
+		if !ok {
+			continue
+		}
+		f := st.fs.Lookup(name)
+		old[name] = f.Value.String()
+		if err := f.Value.Set(v); err != nil {
+			for name, v := range old {
+				st.fs.Lookup(name).Value.Set(v)
+			}
+			return nil, fmt.Errorf("invalid value %q for %s: %w", v, name, err)
+		}
+		changed = append(changed, name)
+	}
+	st.applied = vals
+	return changed, nil
+}
+
+// watchConfig reloads the --config-file settings file, if any, when it
+// changes or derper gets a SIGHUP, and applies the changes to reloadable
+// settings to s and acceptLim. On SIGHUP, it also reloads the -rate-config
+// file. It returns when ctx is done.
+func watchConfig(ctx context.Context, st *settings, s *derpserver.Server, acceptLim *rate.Limiter) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	var (
+		eventChan <-chan fsnotify.Event
+		errChan   <-chan error
+	)
+	if st != nil {
+		if w, err := fsnotify.NewWatcher(); err != nil {
+			log.Printf("derper: config: not watching %s for changes (reload with SIGHUP): %v", st.path, err)
+		} else {
+			defer w.Close()
+			// Watch the directory rather than the file, so as to notice
+			// the file being replaced by an atomic rename.
+			if err := w.Add(filepath.Dir(st.path)); err != nil {
+				log.Printf("derper: config: not watching %s for changes (reload with SIGHUP): %v", st.path, err)
+			} else {
+				eventChan = w.Events
+				errChan = w.Errors
+			}
+		}
+	}
+
+	for {
+		hup := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			hup = true
+			log.Printf("derper: received SIGHUP, reloading config")
+		case err := <-errChan:
+			log.Printf("derper: config: watching %s: %v", st.path, err)
+			continue
+		case ev := <-eventChan:
+			if filepath.Clean(ev.Name) != filepath.Clean(st.path) || ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			// Let a writer finish writing before reading it.
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		prevRateConfig := *rateConfigPath
+		if st != nil {
+			changed, err := st.load(true)
+			if err != nil {
+				log.Printf("derper: config: reload failed; keeping current settings: %v", err)
+				continue
+			}
+			if len(changed) > 0 {
+				log.Printf("derper: config: reloaded; changed %s", strings.Join(changed, ", "))
+			}
+			applyReloadableSettings(s, acceptLim, changed)
+		}
+		if *rateConfigPath == "" {
+			if prevRateConfig != "" {
+				s.UpdateRateLimits(derpserver.RateConfig{})
+				log.Printf("derper: rate limits removed")
+			}
+		} else if hup || prevRateConfig != *rateConfigPath {
+			if err := s.LoadAndApplyRateConfig(*rateConfigPath); err != nil {
+				log.Printf("derper: rate config reload failed: %v", err)
+				continue
+			}
+			log.Printf("derper: rate config reloaded successfully")
+		}
+	}
+}
+
+// applyReloadableSettings applies the current values of the flags in
+// changed, which must be in reloadableFlags, to s and acceptLim.
+func applyReloadableSettings(s *derpserver.Server, acceptLim *rate.Limiter, changed []string) {
+	for _, name := range changed {
+		switch name {
+		case "verify-clients":
+			s.SetVerifyClient(*verifyClients)
+		case "verify-client-url":
+			s.SetVerifyClientURL(*verifyClientURL)
+		case "verify-client-url-fail-open":
+			s.SetVerifyClientURLFailOpen(*verifyFailOpen)
+		case "accept-connection-limit":
+			acceptLim.SetLimit(rate.Limit(*acceptConnLimit))
+		case "accept-connection-burst":
+			acceptLim.SetBurst(*acceptConnBurst)
+		case "tcp-write-timeout":
+			s.SetTCPWriteTimeout(*tcpWriteTimeout)
+		case "rate-config":
+			// Loaded by watchConfig.
+		}
+	}
+}
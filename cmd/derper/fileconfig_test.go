@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSettingsLoad(t *testing.T) {
+	fs := flag.NewFlagSet("derper", flag.ContinueOnError)
+	addr := fs.String("a", ":443", "")
+	stunPort := fs.Int("stun-port", 3478, "")
+	meshWith := fs.String("mesh-with", "", "")
+	verify := fs.Bool("verify-clients", false, "")
+	writeTimeout := fs.Duration("tcp-write-timeout", 2*time.Second, "")
+	if err := fs.Parse([]string{"-stun-port=1234"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "derper.hujson")
+	write := func(s string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{
+		// A comment.
+		"Addr": ":8443",
+		"STUN": {"Port": 9999}, // overridden by the command line
+		"Mesh": {"With": ["derp1a", "derp1b"]},
+		"VerifyClients": {"Enabled": true},
+	}`)
+	st := newSettings(fs, path)
+	if _, err := st.load(false); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if *addr != ":8443" || *stunPort != 1234 || *meshWith != "derp1a,derp1b" || !*verify {
+		t.Errorf("after load: a=%q stun-port=%d mesh-with=%q verify-clients=%v", *addr, *stunPort, *meshWith, *verify)
+	}
+
+	// On reload, only reloadable settings change, and removed ones go
+	// back to their defaults.
+	write(`{
+		"Addr": ":9443",
+		"Mesh": {"With": ["derp1a", "derp1b"]},
+		"TCP": {"WriteTimeout": "5s"},
+	}`)
+	changed, err := st.load(true)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if want := []string{"tcp-write-timeout", "verify-clients"}; !slices.Equal(changed, want) {
+		t.Errorf("reload changed %q; want %q", changed, want)
+	}
+	if *addr != ":8443" || *verify || *writeTimeout != 5*time.Second {
+		t.Errorf("after reload: a=%q verify-clients=%v tcp-write-timeout=%v", *addr, *verify, *writeTimeout)
+	}
+
+	// Bad files are rejected without changing anything.
+	for _, bad := range []string{
+		`{"Bogus": true}`,
+		`{"TCP": {"WriteTimeout": "soon"}}`,
+		`{`,
+	} {
+		write(bad)
+		if _, err := st.load(true); err == nil {
+			t.Errorf("reload of %s succeeded; want error", bad)
+		}
+	}
+	if *writeTimeout != 5*time.Second {
+		t.Errorf("tcp-write-timeout = %v after bad reloads; want 5s", *writeTimeout)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"tailscale.com/disco"
+	"tailscale.com/metrics"
+)
+
+// The UDP relay lets clients on networks that block UDP exchange disco
+// packets with peers over UDP through derper, without DERP's framing and
+// per-peer routing. It's a minimal take on TURN (RFC 8656) over TCP.
+//
+// A client allocates a relay address with an HTTP/1.1 upgrade to the
+// relayProtocol protocol at /relay. derper binds a UDP socket for it and
+// returns that socket's address in the Relay-Addr header of its
+// 101 Switching Protocols response. From then on, the connection carries
+// frames in both directions, each made of:
+//
+//	1 byte   IP address length: 4, 16, or 0 for a keepalive frame
+//	n bytes  IP address of the remote UDP endpoint
+//	2 bytes  port of the remote UDP endpoint, big-endian
+//	2 bytes  payload length, big-endian
+//	payload
+//
+// derper sends the payload of each frame from the client as a UDP packet
+// from the relay address to the remote endpoint, and frames each UDP packet
+// that arrives at the relay address to the client with the address it came
+// from. Only disco packets are relayed, in either direction. The allocation
+// lasts until the connection closes, which derper does after relayIdleTimeout
+// without frames from the client.
+
+const (
+	// relayProtocol is the HTTP Upgrade protocol for UDP relay allocations.
+	relayProtocol = "ts-udp-relay"
+
+	// relayIdleTimeout is how long derper keeps an allocation with no
+	// frames from the client. Clients send keepalive frames to keep idle
+	// allocations open.
+	relayIdleTimeout = 2 * time.Minute
+
+	// relayWriteTimeout is how long derper waits to write a frame to the
+	// client before giving up on the allocation.
+	relayWriteTimeout = 10 * time.Second
+)
+
+var (
+	relayAllocations         = expvar.NewInt("gauge_derper_relay_allocations")
+	relayAllocationsRejected = expvar.NewInt("derper_relay_allocations_rejected")
+	relayPackets             = metrics.NewLabelMap("counter_derper_relay_packets", "disposition")
+	relayPacketsToClient     = relayPackets.Get("to_client")
+	relayPacketsFromClient   = relayPackets.Get("from_client")
+	relayPacketsDropped      = relayPackets.Get("dropped")
+)
+
+// relayServer is the HTTP handler for UDP relay allocations.
+type relayServer struct {
+	sem chan struct{} // semaphore of active allocations
+
+	// allowDst reports whether frames from clients may be sent to the
+	// remote IP address. It's replaced in tests.
+	allowDst func(netip.Addr) bool
+}
+
+// newRelayServer returns a relayServer that allows up to maxAllocs
+// concurrent allocations.
+func newRelayServer(maxAllocs int) *relayServer {
+	return &relayServer{
+		sem:      make(chan struct{}, maxAllocs),
+		allowDst: isPublicAddr,
+	}
+}
+
+// isPublicAddr reports whether ip is a globally routable unicast address,
+// so that the relay can't be used to reach derper's own networks.
+func isPublicAddr(ip netip.Addr) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+func (rs *relayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), relayProtocol) {
+		http.Error(w, "relay requires Upgrade: "+relayProtocol, http.StatusUpgradeRequired)
+		return
+	}
+	select {
+	case rs.sem <- struct{}{}:
+		defer func() { <-rs.sem }()
+	default:
+		relayAllocationsRejected.Add(1)
+		http.Error(w, "too many relay allocations", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Bind the relay socket to the IP address the client reached us at,
+	// which is the one it can be reached back at.
+	la, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if !ok {
+		http.Error(w, "unknown local address", http.StatusInternalServerError)
+		return
+	}
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: la.IP})
+	if err != nil {
+		log.Printf("relay: listen: %v", err)
+		http.Error(w, "relay allocation failed", http.StatusInternalServerError)
+		return
+	}
+	defer pc.Close()
+	relayAddr := netip.AddrPortFrom(la.AddrPort().Addr().Unmap(), uint16(pc.LocalAddr().(*net.UDPAddr).Port))
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "relay requires HTTP/1.1", http.StatusInternalServerError)
+		return
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		log.Printf("relay: hijack: %v", err)
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: %s\r\nConnection: Upgrade\r\nRelay-Addr: %s\r\n\r\n", relayProtocol, relayAddr)
+	if err := brw.Flush(); err != nil {
+		return
+	}
+
+	relayAllocations.Add(1)
+	defer relayAllocations.Add(-1)
+	rs.relay(conn, brw.Reader, pc)
+}
+
+// relay relays frames from the client on conn, read through br, to pc and
+// packets from pc to the client, until either side fails.
+func (rs *relayServer) relay(conn net.Conn, br *bufio.Reader, pc *net.UDPConn) {
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, 64<<10)
+		var frame []byte
+		for {
+			n, src, err := pc.ReadFromUDPAddrPort(buf)
+			if err != nil {
+				return
+			}
+			if !disco.LooksLikeDiscoWrapper(buf[:n]) {
+				relayPacketsDropped.Add(1)
+				continue
+			}
+			frame = appendRelayFrame(frame[:0], src, buf[:n])
+			conn.SetWriteDeadline(time.Now().Add(relayWriteTimeout))
+			if _, err := conn.Write(frame); err != nil {
+				return
+			}
+			relayPacketsToClient.Add(1)
+		}
+	}()
+
+	defer pc.Close() // stops the goroutine above
+	buf := make([]byte, 64<<10)
+	for {
+		conn.SetReadDeadline(time.Now().Add(relayIdleTimeout))
+		dst, payload, err := readRelayFrame(br, buf)
+		if err != nil {
+			return
+		}
+		if !dst.IsValid() {
+			continue // keepalive
+		}
+		if !disco.LooksLikeDiscoWrapper(payload) || !rs.allowDst(dst.Addr()) {
+			relayPacketsDropped.Add(1)
+			continue
+		}
+		if _, err := pc.WriteToUDPAddrPort(payload, dst); err != nil {
+			relayPacketsDropped.Add(1)
+			continue
+		}
+		relayPacketsFromClient.Add(1)
+	}
+}
+
+// appendRelayFrame appends to b the relay frame for payload to or from the
+// remote UDP endpoint ap. If ap is the zero value, it appends a keepalive
+// frame.
+func appendRelayFrame(b []byte, ap netip.AddrPort, payload []byte) []byte {
+	ip := ap.Addr().Unmap().AsSlice()
+	b = append(b, byte(len(ip)))
+	b = append(b, ip...)
+	b = binary.BigEndian.AppendUint16(b, ap.Port())
+	b = binary.BigEndian.AppendUint16(b, uint16(len(payload)))
+	return append(b, payload...)
+}
+
+var errBadRelayFrame = errors.New("bad relay frame")
+
+// readRelayFrame reads a relay frame from br into buf, which must be at
+// least 64 KiB, and returns its remote UDP endpoint and payload. It returns
+// the zero AddrPort for a keepalive frame.
+func readRelayFrame(br *bufio.Reader, buf []byte) (netip.AddrPort, []byte, error) {
+	n, err := br.ReadByte()
+	if err != nil {
+		return netip.AddrPort{}, nil, err
+	}
+	if n != 0 && n != 4 && n != 16 {
+		return netip.AddrPort{}, nil, errBadRelayFrame
+	}
+	hdr := buf[:int(n)+4]
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return netip.AddrPort{}, nil, err
+	}
+	ip, _ := netip.AddrFromSlice(hdr[:n])
+	port := binary.BigEndian.Uint16(hdr[n:])
+	payload := buf[:binary.BigEndian.Uint16(hdr[n+2:])]
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return netip.AddrPort{}, nil, err
+	}
+	if !ip.IsValid() {
+		return netip.AddrPort{}, nil, nil
+	}
+	return netip.AddrPortFrom(ip, port), payload, nil
+}
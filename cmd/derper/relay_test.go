@@ -0,0 +1,139 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/disco"
+	"tailscale.com/types/key"
+)
+
+func TestRelay(t *testing.T) {
+	rs := newRelayServer(1)
+	rs.allowDst = func(netip.Addr) bool { return true }
+	ts := httptest.NewServer(rs)
+	defer ts.Close()
+
+	allocate := func() (net.Conn, *bufio.Reader, *http.Response) {
+		c, err := net.Dial("tcp", ts.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		req, _ := http.NewRequest("GET", ts.URL+"/relay", nil)
+		req.Header.Set("Upgrade", relayProtocol)
+		req.Header.Set("Connection", "Upgrade")
+		if err := req.Write(c); err != nil {
+			t.Fatal(err)
+		}
+		br := bufio.NewReader(c)
+		res, err := http.ReadResponse(br, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c, br, res
+	}
+
+	c, br, res := allocate()
+	defer c.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("allocation status = %v; want 101", res.Status)
+	}
+	relayAddr, err := netip.ParseAddrPort(res.Header.Get("Relay-Addr"))
+	if err != nil {
+		t.Fatalf("bad Relay-Addr: %v", err)
+	}
+
+	// Only one allocation is allowed at a time.
+	c2, _, res2 := allocate()
+	c2.Close()
+	if res2.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("second allocation status = %v; want 503", res2.Status)
+	}
+
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	peer.SetDeadline(time.Now().Add(5 * time.Second))
+	peerAddr := peer.LocalAddr().(*net.UDPAddr).AddrPort()
+
+	discoPkt := func(body string) []byte {
+		pub := key.NewDisco().Public().Raw32()
+		b := append([]byte(disco.Magic), pub[:]...)
+		b = append(b, make([]byte, disco.NonceLen)...)
+		return append(b, body...)
+	}
+
+	// Client to peer: the keepalive and the non-disco packet are dropped.
+	var frames []byte
+	frames = appendRelayFrame(frames, netip.AddrPort{}, nil)
+	frames = appendRelayFrame(frames, peerAddr, []byte("not disco"))
+	frames = appendRelayFrame(frames, peerAddr, discoPkt("ping"))
+	if _, err := c.Write(frames); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64<<10)
+	n, src, err := peer.ReadFromUDPAddrPort(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(buf[:n], []byte("ping")) || !disco.LooksLikeDiscoWrapper(buf[:n]) {
+		t.Errorf("peer got %q; want the disco ping", buf[:n])
+	}
+	if src.Port() != relayAddr.Port() {
+		t.Errorf("peer got packet from %v; want port of %v", src, relayAddr)
+	}
+
+	// Peer to client: the non-disco packet is dropped.
+	to := netip.AddrPortFrom(peerAddr.Addr(), relayAddr.Port())
+	if _, err := peer.WriteToUDPAddrPort([]byte("not disco"), to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := peer.WriteToUDPAddrPort(discoPkt("pong"), to); err != nil {
+		t.Fatal(err)
+	}
+	from, payload, err := readRelayFrame(br, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != peerAddr {
+		t.Errorf("client got frame from %v; want %v", from, peerAddr)
+	}
+	if !bytes.HasSuffix(payload, []byte("pong")) {
+		t.Errorf("client got %q; want the disco pong", payload)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"1.2.3.4", true},
+		{"2001:db8::1", true},
+		{"127.0.0.1", false},
+		{"10.0.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.1.1", false},
+		{"fd00::1", false},
+		{"::1", false},
+		{"224.0.0.1", false},
+		{"0.0.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v; want %v", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Command derplatency collects the reports of latency to private DERP regions
+// that devices opt in to sending with TS_DERP_LATENCY_REPORT_URL, and suggests
+// home regions for the devices from them.
+//
+// To collect reports, run it where the devices can reach it, such as on a
+// node of the tailnet:
+//
+//	derplatency collect --listen=:8080 --out=reports.jsonl
+//
+// and set TS_DERP_LATENCY_REPORT_URL=http://<collector>:8080/ on the devices.
+// Then, to suggest home regions:
+//
+//	derplatency suggest reports.jsonl
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/derp/derplatency"
+)
+
+func main() {
+	err := rootCmd.ParseAndRun(context.Background(), os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+var rootCmd = &ffcli.Command{
+	Name:       "derplatency",
+	ShortUsage: "derplatency <collect|suggest> [flags]",
+	ShortHelp:  "Collect reports of latency to private DERP regions and suggest home regions",
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "collect",
+			ShortUsage: "derplatency collect [--listen=addr] [--out=file]",
+			ShortHelp:  "Collect devices' reports, appending them to a file",
+			FlagSet: (func() *flag.FlagSet {
+				fs := flag.NewFlagSet("collect", flag.ExitOnError)
+				fs.StringVar(&collectArgs.listen, "listen", ":8080", "address to listen for reports on")
+				fs.StringVar(&collectArgs.out, "out", "reports.jsonl", "file to append reports to, one JSON object per line")
+				return fs
+			})(),
+			Exec: runCollect,
+		},
+		{
+			Name:       "suggest",
+			ShortUsage: "derplatency suggest [--min-improvement=d] [--all] <reports.jsonl>...",
+			ShortHelp:  "Suggest home regions from collected reports",
+			FlagSet: (func() *flag.FlagSet {
+				fs := flag.NewFlagSet("suggest", flag.ExitOnError)
+				fs.DurationVar(&suggestArgs.minImprovement, "min-improvement", 10*time.Millisecond, "how much lower a device's median latency to another region must be to suggest moving it there")
+				fs.DurationVar(&suggestArgs.since, "since", 0, "if nonzero, only use reports from this long ago or later")
+				fs.BoolVar(&suggestArgs.all, "all", false, "list all devices, not just those with a different suggested home")
+				return fs
+			})(),
+			Exec: runSuggest,
+		},
+	},
+	Exec: func(context.Context, []string) error { return flag.ErrHelp },
+}
+
+var collectArgs struct {
+	listen string
+	out    string
+}
+
+// maxReportSize is the largest report body that collect accepts.
+const maxReportSize = 64 << 10
+
+func runCollect(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return flag.ErrHelp
+	}
+	f, err := os.OpenFile(collectArgs.out, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var mu sync.Mutex // guards writes to f
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "want POST", http.StatusMethodNotAllowed)
+			return
+		}
+		var rep derplatency.Report
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReportSize)).Decode(&rep); err != nil {
+			http.Error(w, "bad report: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !rep.Valid() {
+			http.Error(w, "invalid report", http.StatusBadRequest)
+			return
+		}
+		line, err := json.Marshal(rep)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			log.Printf("writing report: %v", err)
+			http.Error(w, "can't store report", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	log.Printf("collecting reports on %s into %s", collectArgs.listen, collectArgs.out)
+	return http.ListenAndServe(collectArgs.listen, nil)
+}
+
+var suggestArgs struct {
+	minImprovement time.Duration
+	since          time.Duration
+	all            bool
+}
+
+func runSuggest(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return flag.ErrHelp
+	}
+	var reports []derplatency.Report
+	for _, name := range args {
+		rs, err := readReports(name)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, rs...)
+	}
+	if suggestArgs.since > 0 {
+		cutoff := time.Now().Add(-suggestArgs.since)
+		n := 0
+		for _, r := range reports {
+			if !r.Time.Before(cutoff) {
+				reports[n] = r
+				n++
+			}
+		}
+		reports = reports[:n]
+	}
+	s := derplatency.Suggest(reports, suggestArgs.minImprovement)
+	printSuggestions(os.Stdout, s, suggestArgs.all)
+	return nil
+}
+
+// readReports reads the reports in the file name, as written by collect.
+func readReports(name string) ([]derplatency.Report, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var reports []derplatency.Report
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, maxReportSize)
+	for line := 1; sc.Scan(); line++ {
+		var r derplatency.Report
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		reports = append(reports, r)
+	}
+	return reports, sc.Err()
+}
+
+// printSuggestions prints s to w as tables. Unless all, it lists only devices
+// whose suggested home is different.
+func printSuggestions(w io.Writer, s *derplatency.Suggestions, all bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tDEVICES\tMEDIAN\tHOME TO\tSUGGESTED HOME TO")
+	for _, r := range s.Regions {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%d\n", r.RegionID, r.Nodes, ms(r.MedianMS), r.CurrentHomes, r.SuggestedHomes)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tHOSTNAME\tREPORTS\tHOME\tLATENCY\tSUGGESTED\tLATENCY")
+	changed := 0
+	for _, n := range s.Nodes {
+		if n.Changed() {
+			changed++
+		} else if !all {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", n.Node, n.Hostname, n.Reports,
+			region(n.CurrentHome), ms(n.CurrentMS), region(n.SuggestedHome), ms(n.SuggestedMS))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d of %d devices have a different suggested home region.\n", changed, len(s.Nodes))
+}
+
+// region formats a region ID for printSuggestions.
+func region(id int) string {
+	if id == 0 {
+		return "-"
+	}
+	return strconv.Itoa(id)
+}
+
+// ms formats a latency in milliseconds for printSuggestions.
+func ms(v int) string {
+	if v == 0 {
+		return "-"
+	}
+	return strconv.Itoa(v) + "ms"
+}
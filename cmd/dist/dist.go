@@ -22,6 +22,7 @@
 
 var (
 	synologyPackageCenter               bool
+	outboundOnly                        bool
 	gcloudCredentialsBase64             string
 	gcloudProject                       string
 	gcloudKeyring                       string
@@ -47,12 +48,16 @@ func getTargets() ([]dist.Target, error) {
 	//
 	// To build for package center, run
 	// ./tool/go run ./cmd/dist build --synology-package-center synology
-	ret = append(ret, synology.Targets(synologyPackageCenter, nil)...)
+	//
+	// Outbound-only packages run tailscaled in userspace-networking mode
+	// and their platform privilege manifests don't request permission
+	// to use the TUN device.
+	ret = append(ret, synology.Targets(synologyPackageCenter, outboundOnly, nil)...)
 	qnapSigningArgs := []string{gcloudCredentialsBase64, gcloudProject, gcloudKeyring, qnapKeyName, qnapCertificateBase64, qnapCertificateIntermediariesBase64}
 	if cmp.Or(qnapSigningArgs...) != "" && slices.Contains(qnapSigningArgs, "") {
 		return nil, errors.New("all of --gcloud-credentials, --gcloud-project, --gcloud-keyring, --qnap-key-name, --qnap-certificate and --qnap-certificate-intermediaries must be set")
 	}
-	ret = append(ret, qnap.Targets(gcloudCredentialsBase64, gcloudProject, gcloudKeyring, qnapKeyName, qnapCertificateBase64, qnapCertificateIntermediariesBase64)...)
+	ret = append(ret, qnap.Targets(outboundOnly, gcloudCredentialsBase64, gcloudProject, gcloudKeyring, qnapKeyName, qnapCertificateBase64, qnapCertificateIntermediariesBase64)...)
 	return ret, nil
 }
 
@@ -61,6 +66,7 @@ func main() {
 	for _, subcmd := range cmd.Subcommands {
 		if subcmd.Name == "build" {
 			subcmd.FlagSet.BoolVar(&synologyPackageCenter, "synology-package-center", false, "build synology packages with extra metadata for the official package center")
+			subcmd.FlagSet.BoolVar(&outboundOnly, "outbound-only", false, "build synology and qnap packages that run in userspace-networking mode without TUN permissions")
 			subcmd.FlagSet.StringVar(&gcloudCredentialsBase64, "gcloud-credentials", "", "base64 encoded GCP credentials (used when signing QNAP builds)")
 			subcmd.FlagSet.StringVar(&gcloudProject, "gcloud-project", "", "name of project in GCP KMS (used when signing QNAP builds)")
 			subcmd.FlagSet.StringVar(&gcloudKeyring, "gcloud-keyring", "", "path to keyring in GCP KMS (used when signing QNAP builds)")
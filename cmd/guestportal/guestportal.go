@@ -0,0 +1,174 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// The guestportal command serves a small onboarding portal on a subnet
+// router's LAN address, through which guests, such as at a lab or an event,
+// can request temporary access to the tailnet.
+//
+// Each request is approved by a tailnet admin on a page served on the
+// router's Tailscale IP, or automatically with --auto-approve. An approved
+// guest is shown a single-use, pre-authorized, ephemeral auth key with the
+// tags given by --tags, which expires after --key-ttl. Guest nodes are
+// deleted from the tailnet once they're older than --access-duration, so the
+// tags must be used only for guests.
+//
+// It uses an OAuth client (https://tailscale.com/s/oauth-clients) with the
+// auth_keys and devices:core scopes, whose ID and secret are read from the
+// TS_API_CLIENT_ID and TS_API_CLIENT_SECRET environment variables. It must
+// run on a node of the tailnet, to identify admins.
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+	"tailscale.com/client/local"
+	"tailscale.com/internal/client/tailscale"
+	"tailscale.com/tstime"
+	"tailscale.com/util/httpm"
+	"tailscale.com/util/set"
+)
+
+var (
+	listen        = flag.String("listen", "", "LAN address to serve the guest portal on, such as 192.168.1.1:8080 (required)")
+	adminListen   = flag.String("admin-listen", "", "address to serve the admin page on; if empty, port 8081 of this node's Tailscale IPv4 address")
+	admins        = flag.String("admins", "", "comma-separated login names of the users who may approve guests")
+	tags          = flag.String("tags", "", "comma-separated tags for guest nodes, such as tag:guest (required)")
+	keyTTL        = flag.Duration("key-ttl", 15*time.Minute, "how long an approved guest's auth key can be used")
+	accessTTL     = flag.Duration("access-duration", 8*time.Hour, "how long guest nodes may stay in the tailnet")
+	autoApprove   = flag.Bool("auto-approve", false, "approve guest requests without an admin")
+	notifyWebhook = flag.String("notify-webhook", "", "if non-empty, a URL to POST new guest requests to as JSON, such as to alert admins")
+)
+
+func main() {
+	flag.Parse()
+	if *listen == "" {
+		log.Fatal("--listen is required")
+	}
+	if *tags == "" {
+		log.Fatal("--tags is required")
+	}
+	if *admins == "" && !*autoApprove {
+		log.Fatal("--admins is required unless --auto-approve is set")
+	}
+	if *keyTTL < time.Second || *accessTTL < *keyTTL {
+		log.Fatal("--key-ttl must be at least 1s and --access-duration at least --key-ttl")
+	}
+	clientID := os.Getenv("TS_API_CLIENT_ID")
+	clientSecret := os.Getenv("TS_API_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		log.Fatal("TS_API_CLIENT_ID and TS_API_CLIENT_SECRET must be set")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	baseURL := cmp.Or(os.Getenv("TS_BASE_URL"), "https://api.tailscale.com")
+	credentials := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     baseURL + "/api/v2/oauth/token",
+	}
+	api := tailscale.NewClient("-", nil)
+	api.UserAgent = "tailscale-guestportal"
+	api.HTTPClient = credentials.Client(ctx)
+	api.BaseURL = baseURL
+
+	var lc local.Client
+	if *adminListen == "" {
+		st, err := lc.StatusWithoutPeers(ctx)
+		if err != nil {
+			log.Fatalf("getting Tailscale status: %v", err)
+		}
+		for _, ip := range st.TailscaleIPs {
+			if ip.Is4() {
+				*adminListen = net.JoinHostPort(ip.String(), "8081")
+				break
+			}
+		}
+		if *adminListen == "" {
+			log.Fatal("no Tailscale IPv4 address to serve the admin page on; set --admin-listen")
+		}
+	}
+
+	p := &portal{
+		api:         api,
+		tags:        strings.Split(*tags, ","),
+		keyTTL:      *keyTTL,
+		accessTTL:   *accessTTL,
+		autoApprove: *autoApprove,
+		admins:      set.Of(strings.Split(*admins, ",")...),
+		whois:       lc.WhoIs,
+		logf:        log.Printf,
+		clock:       tstime.StdClock{},
+		adminURL:    "http://" + *adminListen + "/",
+	}
+	if *notifyWebhook != "" {
+		p.notify = func(r guestRequestJSON) {
+			if err := postJSON(ctx, *notifyWebhook, r); err != nil {
+				log.Printf("notify webhook: %v", err)
+			}
+		}
+	}
+
+	errc := make(chan error, 2)
+	for _, s := range []struct {
+		addr string
+		h    http.Handler
+	}{
+		{*listen, p.guestHandler()},
+		{*adminListen, p.adminHandler()},
+	} {
+		srv := &http.Server{Addr: s.addr, Handler: s.h, ReadHeaderTimeout: 10 * time.Second}
+		go func() { errc <- srv.ListenAndServe() }()
+		go func() {
+			<-ctx.Done()
+			srv.Close()
+		}()
+	}
+	go p.reapLoop(ctx)
+	log.Printf("serving guest portal on http://%s/ and admin page on %s", *listen, p.adminURL)
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+}
+
+// postJSON POSTs v as JSON to url.
+func postJSON(ctx context.Context, url string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, httpm.POST, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
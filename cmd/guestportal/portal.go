@@ -0,0 +1,439 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/internal/client/tailscale"
+	"tailscale.com/tstime"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/set"
+)
+
+const (
+	// maxPending is the most guest requests that can await approval at
+	// once, to bound what an unauthenticated LAN client can make us store.
+	maxPending = 32
+
+	// pendingTTL is how long a guest request awaits approval.
+	pendingTTL = time.Hour
+
+	// reapInterval is how often guest nodes older than the access duration
+	// are looked for.
+	reapInterval = time.Minute
+
+	// maxFieldLen bounds the length of the fields of a guest request.
+	maxFieldLen = 200
+)
+
+var (
+	errNotFound       = errors.New("no such request")
+	errAlreadyDecided = errors.New("request already decided")
+)
+
+// keyAPI is the part of the Tailscale API that the portal uses.
+type keyAPI interface {
+	CreateKeyWithExpiry(ctx context.Context, caps tailscale.KeyCapabilities, expiry time.Duration) (string, *tailscale.Key, error)
+	Devices(ctx context.Context, fields *tailscale.DeviceFieldsOpts) ([]*tailscale.Device, error)
+	DeleteDevice(ctx context.Context, deviceID string) error
+}
+
+type requestStatus string
+
+const (
+	statusPending  requestStatus = "pending"
+	statusApproved requestStatus = "approved"
+	statusDenied   requestStatus = "denied"
+	statusFailed   requestStatus = "failed"
+)
+
+// guestRequest is a guest's request for access to the tailnet.
+// Its fields are exported for use in templates.
+type guestRequest struct {
+	ID       string
+	Name     string
+	Reason   string
+	RemoteIP string
+	Created  time.Time
+
+	Status    requestStatus
+	DecidedBy string    // login name of the admin, or "auto"
+	Decided   time.Time // or zero if pending
+	AuthKey   string    // once approved
+}
+
+// guestRequestJSON is a guest request as sent to the notify webhook.
+type guestRequestJSON struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Reason   string    `json:"reason"`
+	RemoteIP string    `json:"remoteIP"`
+	Created  time.Time `json:"created"`
+	AdminURL string    `json:"adminURL"`
+}
+
+// portal is the guest portal and its admin page.
+type portal struct {
+	api         keyAPI
+	tags        []string
+	keyTTL      time.Duration
+	accessTTL   time.Duration
+	autoApprove bool
+	admins      set.Set[string] // login names
+	whois       func(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error)
+	notify      func(guestRequestJSON) // or nil
+	logf        logger.Logf
+	clock       tstime.Clock
+	adminURL    string
+
+	mu       sync.Mutex
+	requests map[string]*guestRequest // by id
+}
+
+// guestHandler returns the handler of the guest portal, served on the LAN.
+func (p *portal) guestHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		render(w, guestFormTmpl, nil)
+	})
+	mux.HandleFunc("POST /{$}", p.serveNewRequest)
+	mux.HandleFunc("GET /request/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req, ok := p.get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, errNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		render(w, guestStatusTmpl, req)
+	})
+	return http.NewCrossOriginProtection().Handler(mux)
+}
+
+// adminHandler returns the handler of the admin page, served on the tailnet.
+func (p *portal) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := p.authorizeAdmin(w, r); !ok {
+			return
+		}
+		render(w, adminTmpl, p.pending())
+	})
+	mux.HandleFunc("POST /decide", func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := p.authorizeAdmin(w, r)
+		if !ok {
+			return
+		}
+		var err error
+		switch r.FormValue("decision") {
+		case "approve":
+			err = p.approve(r.Context(), r.FormValue("id"), admin)
+		case "deny":
+			err = p.deny(r.FormValue("id"), admin)
+		default:
+			http.Error(w, "bad decision", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+	return http.NewCrossOriginProtection().Handler(mux)
+}
+
+// authorizeAdmin reports whether the client of r is a user in p.admins,
+// and returns their login name. If not, it writes an error to w.
+func (p *portal) authorizeAdmin(w http.ResponseWriter, r *http.Request) (loginName string, ok bool) {
+	who, err := p.whois(r.Context(), r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "unknown client", http.StatusUnauthorized)
+		return "", false
+	}
+	if who.Node.IsTagged() || who.UserProfile == nil || !p.admins.Contains(who.UserProfile.LoginName) {
+		http.Error(w, "not an admin", http.StatusForbidden)
+		return "", false
+	}
+	return who.UserProfile.LoginName, true
+}
+
+// serveNewRequest handles the guest portal form.
+func (p *portal) serveNewRequest(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if name == "" || len(name) > maxFieldLen || len(reason) > maxFieldLen {
+		http.Error(w, "a name of at most 200 characters is required", http.StatusBadRequest)
+		return
+	}
+	remoteIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+	now := p.clock.Now()
+
+	p.mu.Lock()
+	p.expireLocked(now)
+	var pending int
+	for _, req := range p.requests {
+		if req.Status != statusPending {
+			continue
+		}
+		if req.RemoteIP == remoteIP {
+			p.mu.Unlock()
+			http.Redirect(w, r, "/request/"+req.ID, http.StatusSeeOther)
+			return
+		}
+		pending++
+	}
+	if pending >= maxPending {
+		p.mu.Unlock()
+		http.Error(w, "too many requests are awaiting approval; try again later", http.StatusServiceUnavailable)
+		return
+	}
+	req := &guestRequest{
+		ID:       newRequestID(),
+		Name:     name,
+		Reason:   reason,
+		RemoteIP: remoteIP,
+		Created:  now,
+		Status:   statusPending,
+	}
+	if p.requests == nil {
+		p.requests = make(map[string]*guestRequest)
+	}
+	p.requests[req.ID] = req
+	p.mu.Unlock()
+
+	p.logf("guest request %s from %s: name=%q reason=%q", req.ID, remoteIP, name, reason)
+	if p.autoApprove {
+		if err := p.approve(r.Context(), req.ID, "auto"); err != nil {
+			p.logf("auto-approving guest request %s: %v", req.ID, err)
+		}
+	} else if p.notify != nil {
+		go p.notify(guestRequestJSON{
+			ID:       req.ID,
+			Name:     name,
+			Reason:   reason,
+			RemoteIP: remoteIP,
+			Created:  now,
+			AdminURL: p.adminURL,
+		})
+	}
+	http.Redirect(w, r, "/request/"+req.ID, http.StatusSeeOther)
+}
+
+// approve approves the pending request with the given id on behalf of
+// admin, and creates its auth key.
+func (p *portal) approve(ctx context.Context, id, admin string) error {
+	if err := p.decide(id, admin, statusApproved); err != nil {
+		return err
+	}
+	caps := tailscale.KeyCapabilities{
+		Devices: tailscale.KeyDeviceCapabilities{
+			Create: tailscale.KeyDeviceCreateCapabilities{
+				Ephemeral:     true,
+				Preauthorized: true,
+				Tags:          p.tags,
+			},
+		},
+	}
+	key, _, err := p.api.CreateKeyWithExpiry(ctx, caps, p.keyTTL)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	req, ok := p.requests[id]
+	if !ok {
+		return errNotFound
+	}
+	if err != nil {
+		req.Status = statusFailed
+		p.logf("creating auth key for guest request %s: %v", id, err)
+		return err
+	}
+	req.AuthKey = key
+	p.logf("guest request %s approved by %s", id, admin)
+	return nil
+}
+
+// deny denies the pending request with the given id on behalf of admin.
+func (p *portal) deny(id, admin string) error {
+	if err := p.decide(id, admin, statusDenied); err != nil {
+		return err
+	}
+	p.logf("guest request %s denied by %s", id, admin)
+	return nil
+}
+
+// decide records the decision of admin on the pending request with the
+// given id.
+func (p *portal) decide(id, admin string, status requestStatus) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	req, ok := p.requests[id]
+	if !ok {
+		return errNotFound
+	}
+	if req.Status != statusPending {
+		return errAlreadyDecided
+	}
+	req.Status = status
+	req.DecidedBy = admin
+	req.Decided = p.clock.Now()
+	return nil
+}
+
+// Waiting reports whether the guest is still waiting for a decision on r, or
+// for its auth key.
+func (r guestRequest) Waiting() bool {
+	return r.Status == statusPending || r.Status == statusApproved && r.AuthKey == ""
+}
+
+// get returns a copy of the request with the given id.
+func (p *portal) get(id string) (guestRequest, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expireLocked(p.clock.Now())
+	req, ok := p.requests[id]
+	if !ok {
+		return guestRequest{}, false
+	}
+	return *req, true
+}
+
+// pending returns copies of the pending requests, oldest first.
+func (p *portal) pending() []guestRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expireLocked(p.clock.Now())
+	var ret []guestRequest
+	for _, req := range p.requests {
+		if req.Status == statusPending {
+			ret = append(ret, *req)
+		}
+	}
+	slices.SortFunc(ret, func(a, b guestRequest) int { return a.Created.Compare(b.Created) })
+	return ret
+}
+
+// expireLocked forgets requests that have been pending for pendingTTL, and
+// decided requests whose auth key can no longer be used.
+func (p *portal) expireLocked(now time.Time) {
+	for id, req := range p.requests {
+		if req.Status == statusPending && now.Sub(req.Created) > pendingTTL ||
+			req.Status != statusPending && now.Sub(req.Decided) > p.keyTTL {
+			delete(p.requests, id)
+		}
+	}
+}
+
+// reapLoop deletes guest nodes older than p.accessTTL every reapInterval
+// until ctx is done.
+func (p *portal) reapLoop(ctx context.Context) {
+	t := time.NewTicker(reapInterval)
+	defer t.Stop()
+	for {
+		if err := p.reapGuests(ctx); err != nil {
+			p.logf("deleting expired guest nodes: %v", err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reapGuests deletes the nodes with all of p.tags that were created more than
+// p.accessTTL ago.
+func (p *portal) reapGuests(ctx context.Context) error {
+	devices, err := p.api.Devices(ctx, nil)
+	if err != nil {
+		return err
+	}
+	now := p.clock.Now()
+	for _, d := range devices {
+		if !isGuest(d, p.tags) {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, d.Created)
+		if err != nil || now.Sub(created) < p.accessTTL {
+			continue
+		}
+		id := cmp.Or(d.NodeID, d.DeviceID)
+		if err := p.api.DeleteDevice(ctx, id); err != nil {
+			p.logf("deleting guest node %s (%s): %v", d.Name, id, err)
+			continue
+		}
+		p.logf("deleted guest node %s (%s) after %v", d.Name, id, now.Sub(created).Round(time.Minute))
+	}
+	return nil
+}
+
+// isGuest reports whether d has all of the guest tags.
+func isGuest(d *tailscale.Device, tags []string) bool {
+	for _, t := range tags {
+		if !slices.Contains(d.Tags, t) {
+			return false
+		}
+	}
+	return len(tags) > 0
+}
+
+func newRequestID() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func render(w http.ResponseWriter, t *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+const pageHead = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Tailscale guest access</title>
+<style>body{font-family:sans-serif;max-width:40em;margin:2em auto;padding:0 1em} code{word-break:break-all}</style>
+`
+
+var guestFormTmpl = template.Must(template.New("form").Parse(pageHead + `</head><body>
+<h1>Request guest access</h1>
+<form method="POST" action="/">
+<p><label>Your name<br><input name="name" maxlength="200" required></label></p>
+<p><label>Reason (optional)<br><input name="reason" maxlength="200"></label></p>
+<p><button type="submit">Request access</button></p>
+</form>
+</body></html>`))
+
+var guestStatusTmpl = template.Must(template.New("status").Parse(pageHead + `{{if .Waiting}}<meta http-equiv="refresh" content="5">{{end}}</head><body>
+<h1>Guest access</h1>
+{{if .Waiting}}<p>Your request is waiting for approval. This page refreshes automatically.</p>
+{{else if eq .Status "approved"}}<p>Your request was approved. Install Tailscale, then run:</p>
+<p><code>tailscale up --auth-key={{.AuthKey}}</code></p>
+<p>The key can be used once, in the next few minutes. Your device is removed from the network when it disconnects or its access ends.</p>
+{{else if eq .Status "denied"}}<p>Your request was denied.</p>
+{{else}}<p>Your request couldn't be completed. Ask the organizer for help.</p>
+{{end}}</body></html>`))
+
+var adminTmpl = template.Must(template.New("admin").Parse(pageHead + `<meta http-equiv="refresh" content="30"></head><body>
+<h1>Guest requests</h1>
+{{range .}}<form method="POST" action="/decide"><p>
+<b>{{.Name}}</b> from {{.RemoteIP}} at {{.Created.Format "15:04:05"}}{{if .Reason}}: {{.Reason}}{{end}}
+<input type="hidden" name="id" value="{{.ID}}">
+<button name="decision" value="approve">Approve</button>
+<button name="decision" value="deny">Deny</button>
+</p></form>
+{{else}}<p>No requests are awaiting approval.</p>
+{{end}}</body></html>`))
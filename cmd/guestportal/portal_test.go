@@ -0,0 +1,177 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/internal/client/tailscale"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstest"
+	"tailscale.com/util/set"
+)
+
+type fakeAPI struct {
+	keys    []tailscale.KeyCapabilities
+	devices []*tailscale.Device
+	deleted []string
+}
+
+func (f *fakeAPI) CreateKeyWithExpiry(ctx context.Context, caps tailscale.KeyCapabilities, expiry time.Duration) (string, *tailscale.Key, error) {
+	f.keys = append(f.keys, caps)
+	return "tskey-auth-test", &tailscale.Key{}, nil
+}
+
+func (f *fakeAPI) Devices(ctx context.Context, fields *tailscale.DeviceFieldsOpts) ([]*tailscale.Device, error) {
+	return f.devices, nil
+}
+
+func (f *fakeAPI) DeleteDevice(ctx context.Context, deviceID string) error {
+	f.deleted = append(f.deleted, deviceID)
+	return nil
+}
+
+func newTestPortal(t *testing.T) (*portal, *fakeAPI, *tstest.Clock) {
+	api := &fakeAPI{}
+	clock := tstest.NewClock(tstest.ClockOpts{Start: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)})
+	p := &portal{
+		api:       api,
+		tags:      []string{"tag:guest"},
+		keyTTL:    15 * time.Minute,
+		accessTTL: 8 * time.Hour,
+		admins:    set.Of("admin@example.com"),
+		whois: func(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error) {
+			login, ok := map[string]string{
+				"100.64.0.1:1234": "admin@example.com",
+				"100.64.0.2:1234": "user@example.com",
+			}[remoteAddr]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return &apitype.WhoIsResponse{
+				Node:        &tailcfg.Node{},
+				UserProfile: &tailcfg.UserProfile{LoginName: login},
+			}, nil
+		},
+		logf:  t.Logf,
+		clock: clock,
+	}
+	return p, api, clock
+}
+
+func do(t *testing.T, h http.Handler, method, path, remoteAddr string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.RemoteAddr = remoteAddr
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGuestRequestFlow(t *testing.T) {
+	p, api, _ := newTestPortal(t)
+	guest, admin := p.guestHandler(), p.adminHandler()
+
+	rec := do(t, guest, "POST", "/", "192.168.1.50:5555", url.Values{"name": {"Ada"}, "reason": {"workshop"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("new request: got %d: %s", rec.Code, rec.Body)
+	}
+	statusPath := rec.Header().Get("Location")
+
+	// A second request from the same guest leads to the first.
+	rec = do(t, guest, "POST", "/", "192.168.1.50:6666", url.Values{"name": {"Ada"}})
+	if got := rec.Header().Get("Location"); got != statusPath {
+		t.Errorf("second request redirected to %q; want %q", got, statusPath)
+	}
+
+	rec = do(t, guest, "GET", statusPath, "192.168.1.50:5555", nil)
+	if !strings.Contains(rec.Body.String(), "waiting for approval") {
+		t.Errorf("status page doesn't say it's pending: %s", rec.Body)
+	}
+
+	if rec := do(t, admin, "GET", "/", "100.64.0.2:1234", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin got %d; want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := do(t, admin, "GET", "/", "192.168.1.50:5555", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown client got %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec = do(t, admin, "GET", "/", "100.64.0.1:1234", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Ada") {
+		t.Fatalf("admin page: got %d: %s", rec.Code, rec.Body)
+	}
+
+	id := strings.TrimPrefix(statusPath, "/request/")
+	rec = do(t, admin, "POST", "/decide", "100.64.0.1:1234", url.Values{"id": {id}, "decision": {"approve"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("approve: got %d: %s", rec.Code, rec.Body)
+	}
+	if len(api.keys) != 1 {
+		t.Fatalf("created %d keys; want 1", len(api.keys))
+	}
+	c := api.keys[0].Devices.Create
+	if c.Reusable || !c.Ephemeral || !c.Preauthorized || !slices.Equal(c.Tags, []string{"tag:guest"}) {
+		t.Errorf("key capabilities = %+v", c)
+	}
+	rec = do(t, guest, "GET", statusPath, "192.168.1.50:5555", nil)
+	if !strings.Contains(rec.Body.String(), "tailscale up --auth-key=tskey-auth-test") {
+		t.Errorf("status page doesn't show the auth key: %s", rec.Body)
+	}
+
+	// Deciding again fails.
+	rec = do(t, admin, "POST", "/decide", "100.64.0.1:1234", url.Values{"id": {id}, "decision": {"deny"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("second decision: got %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGuestRequestExpiry(t *testing.T) {
+	p, _, clock := newTestPortal(t)
+	guest := p.guestHandler()
+	for i := range maxPending {
+		rec := do(t, guest, "POST", "/", fmt.Sprintf("192.168.1.%d:1", i+1), url.Values{"name": {"x"}})
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("request %d: got %d", i, rec.Code)
+		}
+	}
+	if rec := do(t, guest, "POST", "/", "192.168.2.1:1", url.Values{"name": {"x"}}); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over limit: got %d; want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	clock.Advance(pendingTTL + time.Second)
+	if rec := do(t, guest, "POST", "/", "192.168.2.1:1", url.Values{"name": {"x"}}); rec.Code != http.StatusSeeOther {
+		t.Errorf("request after expiry: got %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+	if got := len(p.pending()); got != 1 {
+		t.Errorf("%d pending requests; want 1", got)
+	}
+}
+
+func TestReapGuests(t *testing.T) {
+	p, api, clock := newTestPortal(t)
+	now := clock.Now()
+	api.devices = []*tailscale.Device{
+		{NodeID: "old-guest", Tags: []string{"tag:guest"}, Created: now.Add(-9 * time.Hour).Format(time.RFC3339)},
+		{NodeID: "new-guest", Tags: []string{"tag:guest"}, Created: now.Add(-time.Hour).Format(time.RFC3339)},
+		{NodeID: "old-server", Tags: []string{"tag:server"}, Created: now.Add(-900 * time.Hour).Format(time.RFC3339)},
+		{NodeID: "old-laptop", Created: now.Add(-900 * time.Hour).Format(time.RFC3339)},
+	}
+	if err := p.reapGuests(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"old-guest"}; !slices.Equal(api.deleted, want) {
+		t.Errorf("deleted %q; want %q", api.deleted, want)
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
+	"tailscale.com/tstime"
+	"tailscale.com/util/httpm"
+)
+
+const (
+	// autoscalePollInterval is how often the throughput of an autoscaled
+	// ProxyGroup's replicas is measured.
+	autoscalePollInterval = 30 * time.Second
+
+	// defaultScaleDownDelay is the default for
+	// spec.autoscaling.scaleDownDelaySeconds.
+	defaultScaleDownDelay = 5 * time.Minute
+
+	// metricsScrapeTimeout bounds each request for a replica's metrics.
+	metricsScrapeTimeout = 5 * time.Second
+)
+
+// trafficMetrics are the tailscaled metrics whose sum is a replica's
+// tailnet throughput. They're counters of bytes, labelled by path.
+var trafficMetrics = []string{
+	"tailscaled_inbound_bytes_total",
+	"tailscaled_outbound_bytes_total",
+}
+
+// proxyGroupAutoscaler scales ProxyGroups that have spec.autoscaling set.
+// Every autoscalePollInterval, it scrapes the traffic counters from the
+// metrics endpoint of each of the ProxyGroup's Pods, and sets
+// status.autoscaling.desiredReplicas to the number of replicas needed for
+// the measured throughput. The ProxyGroup reconciler then scales the
+// ProxyGroup's StatefulSet to match (see pgReplicas).
+type proxyGroupAutoscaler struct {
+	client.Client
+	logger      *zap.SugaredLogger
+	tsNamespace string
+	clock       tstime.Clock
+	httpClient  doer // http client that can be set to a mock client in tests
+
+	mu    sync.Mutex
+	state map[types.UID]*autoscaleState // by ProxyGroup UID
+}
+
+// autoscaleState is what the autoscaler remembers about a ProxyGroup between
+// reconciles.
+type autoscaleState struct {
+	started time.Time // when the autoscaler started tracking the ProxyGroup
+	lastRun time.Time
+	samples map[types.UID]trafficSample // by Pod UID
+
+	// recommendations are the replica counts recommended within the scale
+	// down delay, oldest first.
+	recommendations []replicasRecommendation
+}
+
+// trafficSample is a reading of a replica's traffic counters.
+type trafficSample struct {
+	bytes float64
+	at    time.Time
+}
+
+type replicasRecommendation struct {
+	replicas int32
+	at       time.Time
+}
+
+func (a *proxyGroupAutoscaler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	lg := a.logger.With("ProxyGroup", req.Name)
+	lg.Debugf("starting reconcile")
+	defer lg.Debugf("reconcile finished")
+
+	pg := new(tsapi.ProxyGroup)
+	err := a.Get(ctx, req.NamespacedName, pg)
+	if apierrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to get ProxyGroup: %w", err)
+	}
+	as := pg.Spec.Autoscaling
+	if as == nil || markedForDeletion(pg) || pg.Spec.Type == tsapi.ProxyGroupTypeKubernetesAPIServer {
+		// The ProxyGroup reconciler reports unsupported autoscaling
+		// configurations.
+		a.mu.Lock()
+		delete(a.state, pg.UID)
+		a.mu.Unlock()
+		return reconcile.Result{}, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == nil {
+		a.state = make(map[types.UID]*autoscaleState)
+	}
+	now := a.clock.Now()
+	st := a.state[pg.UID]
+	if st == nil {
+		st = &autoscaleState{
+			started: now,
+			samples: make(map[types.UID]trafficSample),
+		}
+		a.state[pg.UID] = st
+	}
+	if since := now.Sub(st.lastRun); since < autoscalePollInterval/2 {
+		// Reconciles triggered by status updates, including our own,
+		// would otherwise measure throughput over too short a window.
+		return reconcile.Result{RequeueAfter: autoscalePollInterval - since}, nil
+	}
+	st.lastRun = now
+
+	pods := &corev1.PodList{}
+	if err := a.List(ctx, pods, client.InNamespace(a.tsNamespace), client.MatchingLabels(pgLabels(pg.Name, nil))); err != nil {
+		return reconcile.Result{}, fmt.Errorf("error listing ProxyGroup Pods: %w", err)
+	}
+	throughput, ok := a.measureThroughput(ctx, st, pods.Items, lg)
+
+	current := pgReplicas(pg)
+	desired := current
+	if ok {
+		desired = replicasForThroughput(throughput, as)
+		lg.Debugf("throughput %.0f bytes/s, %d replicas recommended", throughput, desired)
+	}
+	desired = st.stabilize(now, desired, current, scaleDownDelay(as))
+
+	oldStatus := pg.Status.Autoscaling.DeepCopy()
+	if pg.Status.Autoscaling == nil {
+		pg.Status.Autoscaling = &tsapi.ProxyGroupAutoscalingStatus{DesiredReplicas: current}
+	}
+	newStatus := pg.Status.Autoscaling
+	if ok {
+		newStatus.Throughput = resource.NewQuantity(int64(throughput), resource.DecimalSI)
+	}
+	if desired != current {
+		lg.Infof("scaling ProxyGroup from %d to %d replicas for throughput of %.0f bytes/s", current, desired, throughput)
+		newStatus.DesiredReplicas = desired
+		newStatus.LastScaleTime = &metav1.Time{Time: now}
+	}
+	if !apiequality.Semantic.DeepEqual(oldStatus, newStatus) {
+		if err := a.Status().Update(ctx, pg); err != nil {
+			return reconcile.Result{}, fmt.Errorf("error updating ProxyGroup autoscaling status: %w", err)
+		}
+	}
+	return reconcile.Result{RequeueAfter: autoscalePollInterval}, nil
+}
+
+// measureThroughput returns the total throughput of pods, in bytes per
+// second, from the difference between their traffic counters and those in
+// st.samples, which it updates. It reports false if no Pod's throughput
+// could be measured, such as on the first measurement.
+func (a *proxyGroupAutoscaler) measureThroughput(ctx context.Context, st *autoscaleState, pods []corev1.Pod, lg *zap.SugaredLogger) (throughput float64, ok bool) {
+	seen := make(map[types.UID]bool)
+	for _, pod := range pods {
+		if !pod.DeletionTimestamp.IsZero() || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		ip, err := podIPv4(&pod)
+		if err != nil || ip == "" {
+			continue
+		}
+		seen[pod.UID] = true
+		bytes, err := a.scrapeTrafficBytes(ctx, ip)
+		if err != nil {
+			lg.Debugf("error getting metrics of Pod %s: %v", pod.Name, err)
+			delete(st.samples, pod.UID)
+			continue
+		}
+		sample := trafficSample{bytes: bytes, at: a.clock.Now()}
+		prev, hasPrev := st.samples[pod.UID]
+		st.samples[pod.UID] = sample
+		if !hasPrev || bytes < prev.bytes || !sample.at.After(prev.at) {
+			// First sample, or the counters were reset by a restart.
+			continue
+		}
+		throughput += (bytes - prev.bytes) / sample.at.Sub(prev.at).Seconds()
+		ok = true
+	}
+	for uid := range st.samples {
+		if !seen[uid] {
+			delete(st.samples, uid)
+		}
+	}
+	return throughput, ok
+}
+
+// scrapeTrafficBytes returns the sum of the trafficMetrics served by the
+// proxy Pod with the given IP.
+func (a *proxyGroupAutoscaler) scrapeTrafficBytes(ctx context.Context, podIP string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, metricsScrapeTimeout)
+	defer cancel()
+	u := "http://" + net.JoinHostPort(podIP, strconv.Itoa(defaultLocalAddrPort)) + "/metrics"
+	req, err := http.NewRequestWithContext(ctx, httpm.GET, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return parseTrafficBytes(resp.Body)
+}
+
+// parseTrafficBytes returns the sum of the samples of trafficMetrics in r,
+// which is in the Prometheus text exposition format.
+func parseTrafficBytes(r io.Reader) (float64, error) {
+	var total float64
+	var found bool
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, rest, _ := strings.Cut(line, " ")
+		if i := strings.IndexByte(line, '{'); i >= 0 && i < len(name) {
+			name = line[:i]
+			j := strings.LastIndexByte(line, '}')
+			if j < i {
+				continue
+			}
+			rest = line[j+1:]
+		}
+		if !slices.Contains(trafficMetrics, name) {
+			continue
+		}
+		f := strings.Fields(rest)
+		if len(f) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(f[0], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		total += v
+		found = true
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, errors.New("no traffic metrics found")
+	}
+	return total, nil
+}
+
+// replicasForThroughput returns the number of replicas needed for the
+// given total throughput, in bytes per second.
+func replicasForThroughput(throughput float64, as *tsapi.ProxyGroupAutoscaling) int32 {
+	target := as.TargetThroughputPerReplica.AsApproximateFloat64()
+	if target <= 0 {
+		return as.MaxReplicas
+	}
+	n := math.Ceil(throughput / target)
+	if n > math.MaxInt32 {
+		n = math.MaxInt32
+	}
+	return clampReplicas(int32(n), as)
+}
+
+// stabilize returns the number of replicas to scale to, given the desired
+// and current number. Scaling up is immediate, but to avoid flapping,
+// scaling down only goes as low as the highest number desired within
+// delay.
+func (st *autoscaleState) stabilize(now time.Time, desired, current int32, delay time.Duration) int32 {
+	st.recommendations = append(st.recommendations, replicasRecommendation{replicas: desired, at: now})
+	for len(st.recommendations) > 0 && now.Sub(st.recommendations[0].at) > delay {
+		st.recommendations = st.recommendations[1:]
+	}
+	if desired >= current {
+		return desired
+	}
+	for _, r := range st.recommendations {
+		desired = max(desired, r.replicas)
+	}
+	// Until the autoscaler has been running for the whole delay, it can't
+	// know that fewer replicas have been enough for that long.
+	if now.Sub(st.started) < delay {
+		return current
+	}
+	return min(desired, current)
+}
+
+func autoscalingMinReplicas(as *tsapi.ProxyGroupAutoscaling) int32 {
+	if as.MinReplicas != nil {
+		return *as.MinReplicas
+	}
+	return 1
+}
+
+func clampReplicas(n int32, as *tsapi.ProxyGroupAutoscaling) int32 {
+	return max(min(n, as.MaxReplicas), autoscalingMinReplicas(as))
+}
+
+func scaleDownDelay(as *tsapi.ProxyGroupAutoscaling) time.Duration {
+	if as.ScaleDownDelaySeconds != nil {
+		return time.Duration(*as.ScaleDownDelaySeconds) * time.Second
+	}
+	return defaultScaleDownDelay
+}
@@ -0,0 +1,172 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
+	"tailscale.com/tstest"
+)
+
+func TestProxyGroupAutoscaler(t *testing.T) {
+	fc := fake.NewClientBuilder().
+		WithScheme(tsapi.GlobalScheme).
+		WithStatusSubresource(&tsapi.ProxyGroup{}).
+		Build()
+	zl, _ := zap.NewDevelopment()
+	cl := tstest.NewClock(tstest.ClockOpts{})
+	metrics := &fakeMetricsClient{bytes: map[string]float64{}}
+	a := &proxyGroupAutoscaler{
+		Client:      fc,
+		logger:      zl.Sugar(),
+		tsNamespace: "operator-ns",
+		clock:       cl,
+		httpClient:  metrics,
+	}
+	pg := &tsapi.ProxyGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "pg", UID: "pg-uid"},
+		Spec: tsapi.ProxyGroupSpec{
+			Type: tsapi.ProxyGroupTypeEgress,
+			Autoscaling: &tsapi.ProxyGroupAutoscaling{
+				MaxReplicas:                4,
+				TargetThroughputPerReplica: resource.MustParse("1M"),
+				ScaleDownDelaySeconds:      new(int32(60)),
+			},
+		},
+	}
+	mustCreate(t, fc, pg)
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		mustCreate(t, fc, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pgPodName("pg", int32(i)),
+				Namespace: "operator-ns",
+				UID:       types.UID(fmt.Sprintf("pod-uid-%d", i)),
+				Labels:    pgLabels("pg", nil),
+			},
+			Status: corev1.PodStatus{
+				Phase:  corev1.PodRunning,
+				PodIPs: []corev1.PodIP{{IP: ip}},
+			},
+		})
+	}
+
+	// step advances the clock by 30s, adds perPod bytes of traffic to each
+	// replica, runs the autoscaler, and checks the desired replicas.
+	step := func(perPod float64, wantReplicas int32) {
+		t.Helper()
+		cl.Advance(autoscalePollInterval)
+		metrics.add("10.0.0.1", perPod)
+		metrics.add("10.0.0.2", perPod)
+		if _, err := a.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "pg"}}); err != nil {
+			t.Fatal(err)
+		}
+		got := new(tsapi.ProxyGroup)
+		if err := fc.Get(context.Background(), types.NamespacedName{Name: "pg"}, got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Status.Autoscaling == nil {
+			t.Fatalf("no autoscaling status")
+		}
+		if r := got.Status.Autoscaling.DesiredReplicas; r != wantReplicas {
+			t.Fatalf("desired replicas = %d; want %d", r, wantReplicas)
+		}
+		if r := pgReplicas(got); r != wantReplicas {
+			t.Fatalf("pgReplicas = %d; want %d", r, wantReplicas)
+		}
+	}
+
+	step(0, 1)    // first sample; no throughput known yet, so minReplicas
+	step(45e6, 3) // 2 * 45MB in 30s is 3MB/s; scale up immediately
+	step(100, 3)  // low throughput, but 3 replicas were needed within the delay
+	step(100, 3)
+	step(100, 1)   // low for longer than the delay; scale down
+	step(300e6, 4) // capped at maxReplicas
+}
+
+func TestParseTrafficBytes(t *testing.T) {
+	in := `# HELP tailscaled_inbound_bytes_total Counts the number of bytes received from other peers
+# TYPE tailscaled_inbound_bytes_total counter
+tailscaled_inbound_bytes_total{path="direct_ipv4"} 1000
+tailscaled_inbound_bytes_total{path="derp"} 200
+tailscaled_inbound_packets_total{path="derp"} 5
+tailscaled_outbound_bytes_total{path="direct_ipv4"} 30
+tailscaled_outbound_bytes_total{path="peer relay",other="x}"} 4
+tailscaled_health_messages{type="warning"} 1
+`
+	got, err := parseTrafficBytes(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1234 {
+		t.Errorf("got %v; want 1234", got)
+	}
+
+	if _, err := parseTrafficBytes(strings.NewReader("tailscaled_health_messages 1\n")); err == nil {
+		t.Error("got no error for metrics without traffic counters")
+	}
+}
+
+func TestAutoscaleStabilize(t *testing.T) {
+	t0 := time.Now()
+	st := &autoscaleState{started: t0}
+	delay := time.Minute
+	tests := []struct {
+		after            time.Duration
+		desired, current int32
+		want             int32
+	}{
+		{0, 1, 2, 2},                 // not running for the whole delay yet
+		{30 * time.Second, 5, 2, 5},  // scale up immediately
+		{60 * time.Second, 2, 5, 5},  // 5 wanted within the delay
+		{91 * time.Second, 3, 5, 3},  // 5 is out of the window
+		{100 * time.Second, 1, 3, 3}, // 3 still in the window
+		{152 * time.Second, 1, 3, 1},
+	}
+	for _, tt := range tests {
+		if got := st.stabilize(t0.Add(tt.after), tt.desired, tt.current, delay); got != tt.want {
+			t.Errorf("after %v: stabilize(%d, %d) = %d; want %d", tt.after, tt.desired, tt.current, got, tt.want)
+		}
+	}
+}
+
+// fakeMetricsClient serves the metrics of proxy Pods with the given
+// total traffic bytes, by Pod IP.
+type fakeMetricsClient struct {
+	mu    sync.Mutex
+	bytes map[string]float64
+}
+
+func (f *fakeMetricsClient) add(ip string, n float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bytes[ip] += n
+}
+
+func (f *fakeMetricsClient) Do(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.bytes[req.URL.Hostname()]
+	if !ok || req.URL.Path != "/metrics" {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}, nil
+	}
+	body := fmt.Sprintf("tailscaled_inbound_bytes_total{path=\"direct_ipv4\"} %v\ntailscaled_outbound_bytes_total{path=\"direct_ipv4\"} 0\n", n)
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+}
@@ -205,6 +205,11 @@ func (r *ProxyGroupReconciler) reconcilePG(ctx context.Context, tsClient tsclien
 		}
 	}
 
+	if pg.Spec.Autoscaling == nil {
+		// Clear any stale status from when autoscaling was enabled.
+		pg.Status.Autoscaling = nil
+	}
+
 	if err := r.validate(ctx, pg, proxyClass, logger); err != nil {
 		return notReady(reasonProxyGroupInvalid, fmt.Sprintf("invalid ProxyGroup spec: %v", err))
 	}
@@ -256,6 +261,16 @@ func (r *ProxyGroupReconciler) validate(ctx context.Context, pg *tsapi.ProxyGrou
 	}
 
 	var errs []error
+	if pg.Spec.Autoscaling != nil {
+		switch {
+		case pg.Spec.Type == tsapi.ProxyGroupTypeKubernetesAPIServer:
+			errs = append(errs, fmt.Errorf("autoscaling is not supported for ProxyGroups of type %q", pg.Spec.Type))
+		case pc == nil || pc.Spec.Metrics == nil || !pc.Spec.Metrics.Enable:
+			errs = append(errs, errors.New("autoscaling requires a ProxyClass with metrics enabled, to measure the replicas' throughput"))
+		case hasLocalAddrPortSet(pc):
+			errs = append(errs, fmt.Errorf("autoscaling is not supported with ProxyClass %q, which sets TS_LOCAL_ADDR_PORT to a custom value", pc.Name))
+		}
+	}
 	if isAuthAPIServerProxy(pg) {
 		// Validate that the static ServiceAccount already exists.
 		sa := &corev1.ServiceAccount{}
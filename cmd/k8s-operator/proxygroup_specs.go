@@ -559,6 +559,12 @@ func pgOwnerReference(owner *tsapi.ProxyGroup) []metav1.OwnerReference {
 }
 
 func pgReplicas(pg *tsapi.ProxyGroup) int32 {
+	if as := pg.Spec.Autoscaling; as != nil {
+		if st := pg.Status.Autoscaling; st != nil {
+			return clampReplicas(st.DesiredReplicas, as)
+		}
+		return autoscalingMinReplicas(as)
+	}
 	if pg.Spec.Replicas != nil {
 		return *pg.Spec.Replicas
 	}
@@ -0,0 +1,371 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ecsMode is how natc handles EDNS Client Subnet (ECS, RFC 7871) options
+// when it resolves domains upstream.
+type ecsMode string
+
+const (
+	// ecsStrip sends no ECS option upstream. It's the default.
+	ecsStrip ecsMode = "strip"
+	// ecsForward passes the subnet from the querying client's ECS option,
+	// if any, upstream, truncated to at most ecsMaxBits4 or ecsMaxBits6.
+	ecsForward ecsMode = "forward"
+	// ecsSite sends a fixed subnet for the natc site, typically covering
+	// its egress addresses, upstream.
+	ecsSite ecsMode = "site"
+)
+
+func parseECSMode(s string) (ecsMode, error) {
+	switch m := ecsMode(s); m {
+	case ecsStrip, ecsForward, ecsSite:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown ECS mode %q; want %q, %q or %q", s, ecsStrip, ecsForward, ecsSite)
+}
+
+const (
+	// ecsMaxBits4 and ecsMaxBits6 are the longest client subnets natc
+	// forwards upstream, per the recommendation in RFC 7871 section 11.1.
+	ecsMaxBits4 = 24
+	ecsMaxBits6 = 56
+
+	// ednsUDPSize is the EDNS(0) UDP payload size natc advertises, both to
+	// its clients and to upstream servers. It's the size recommended by
+	// DNS Flag Day 2020, which avoids IP fragmentation on most paths.
+	ednsUDPSize = 1232
+
+	// Option codes from the IANA "DNS EDNS0 Option Codes (OPT)" registry.
+	ednsOptionECS    = 8
+	ednsOptionCookie = 10
+)
+
+// upstreamECS returns the client subnet to send upstream when resolving on
+// behalf of a client whose query carried the client subnet clientECS, which
+// is the zero Prefix if it had none. It returns the zero Prefix if no ECS
+// option should be sent.
+func (c *connector) upstreamECS(clientECS netip.Prefix) netip.Prefix {
+	switch c.ecs {
+	case ecsForward:
+		if !clientECS.IsValid() {
+			return netip.Prefix{}
+		}
+		maxBits := ecsMaxBits6
+		if clientECS.Addr().Is4() {
+			maxBits = ecsMaxBits4
+		}
+		return netip.PrefixFrom(clientECS.Addr(), min(clientECS.Bits(), maxBits)).Masked()
+	case ecsSite:
+		return c.ecsSubnet
+	}
+	return netip.Prefix{}
+}
+
+// ecsLookuper is implemented by resolvers that can send an ECS option
+// with their queries.
+type ecsLookuper interface {
+	LookupNetIPWithECS(ctx context.Context, network, host string, ecs netip.Prefix) ([]netip.Addr, error)
+}
+
+// lookup resolves host like c.resolver.LookupNetIP, sending the client
+// subnet ecs upstream if it's valid and c.resolver supports it.
+func (c *connector) lookup(ctx context.Context, network, host string, ecs netip.Prefix) ([]netip.Addr, error) {
+	if r, ok := c.resolver.(ecsLookuper); ok && ecs.IsValid() {
+		return r.LookupNetIPWithECS(ctx, network, host, ecs)
+	}
+	return c.resolver.LookupNetIP(ctx, network, host)
+}
+
+// ecsOption returns an ECS option for the client subnet p with the given
+// scope prefix length.
+func ecsOption(p netip.Prefix, scope uint8) dnsmessage.Option {
+	p = p.Masked()
+	family := uint16(1)
+	addr := p.Addr().AsSlice()
+	if p.Addr().Is6() {
+		family = 2
+	}
+	data := binary.BigEndian.AppendUint16(nil, family)
+	data = append(data, uint8(p.Bits()), scope)
+	data = append(data, addr[:(p.Bits()+7)/8]...)
+	return dnsmessage.Option{Code: ednsOptionECS, Data: data}
+}
+
+// parseECSOption parses the data of an ECS option, returning its client
+// subnet.
+func parseECSOption(data []byte) (netip.Prefix, error) {
+	if len(data) < 4 {
+		return netip.Prefix{}, errors.New("short ECS option")
+	}
+	family, bits, addrBytes := binary.BigEndian.Uint16(data), int(data[2]), data[4:]
+	var addrLen int
+	switch family {
+	case 1:
+		addrLen = 4
+	case 2:
+		addrLen = 16
+	default:
+		return netip.Prefix{}, fmt.Errorf("unknown ECS address family %d", family)
+	}
+	if bits > addrLen*8 || len(addrBytes) != (bits+7)/8 {
+		return netip.Prefix{}, fmt.Errorf("invalid ECS source prefix length %d for %d address bytes", bits, len(addrBytes))
+	}
+	var buf [16]byte
+	copy(buf[:], addrBytes)
+	addr, _ := netip.AddrFromSlice(buf[:addrLen])
+	p := netip.PrefixFrom(addr, bits)
+	if p.Masked() != p {
+		return netip.Prefix{}, errors.New("ECS address has bits set beyond its source prefix length")
+	}
+	return p, nil
+}
+
+// ednsQuery is the EDNS(0) information from a query's OPT record.
+type ednsQuery struct {
+	version uint8
+	udpSize int          // requestor's UDP payload size
+	ecs     netip.Prefix // client subnet from the ECS option; zero if none
+	cookie  []byte       // client cookie, plus server cookie if any; nil if none
+}
+
+// parseEDNS returns the EDNS(0) information in msg, and whether msg has an
+// OPT record. It returns an error if an option natc understands is
+// malformed.
+func parseEDNS(msg *dnsmessage.Message) (q ednsQuery, ok bool, err error) {
+	for _, r := range msg.Additionals {
+		opt, isOPT := r.Body.(*dnsmessage.OPTResource)
+		if !isOPT {
+			continue
+		}
+		q.version = uint8(r.Header.TTL >> 16)
+		q.udpSize = int(r.Header.Class)
+		for _, o := range opt.Options {
+			switch o.Code {
+			case ednsOptionECS:
+				if q.ecs, err = parseECSOption(o.Data); err != nil {
+					return q, true, err
+				}
+			case ednsOptionCookie:
+				// An 8 byte client cookie, optionally followed by an 8
+				// to 32 byte server cookie (RFC 7873 section 4).
+				if n := len(o.Data); n != 8 && (n < 16 || n > 40) {
+					return q, true, fmt.Errorf("invalid DNS cookie length %d", n)
+				}
+				q.cookie = o.Data
+			}
+		}
+		return q, true, nil
+	}
+	return q, false, nil
+}
+
+// serverCookie returns the DNS server cookie (RFC 7873) for a client with
+// the given client cookie and address.
+func (c *connector) serverCookie(clientCookie []byte, clientAddr netip.Addr) []byte {
+	h := hmac.New(sha256.New, c.cookieSecret[:])
+	h.Write(clientCookie)
+	h.Write(clientAddr.AsSlice())
+	return h.Sum(nil)[:8]
+}
+
+// ednsResponseOPT returns the OPT record for a response to a query with
+// the EDNS(0) information q from clientAddr, with the given extended RCode.
+func (c *connector) ednsResponseOPT(q ednsQuery, clientAddr netip.Addr, extRCode dnsmessage.RCode) (dnsmessage.ResourceHeader, dnsmessage.OPTResource) {
+	var h dnsmessage.ResourceHeader
+	h.SetEDNS0(ednsUDPSize, extRCode, false)
+	var opt dnsmessage.OPTResource
+	if q.ecs.IsValid() {
+		// Answers are per node, not per client subnet, so the scope is 0.
+		opt.Options = append(opt.Options, ecsOption(q.ecs, 0))
+	}
+	if len(q.cookie) >= 8 {
+		cookie := append(q.cookie[:8:8], c.serverCookie(q.cookie[:8], clientAddr)...)
+		opt.Options = append(opt.Options, dnsmessage.Option{Code: ednsOptionCookie, Data: cookie})
+	}
+	return h, opt
+}
+
+// maxUDPResponseSize returns the largest UDP response natc may send to a
+// query with the EDNS(0) information q, or without EDNS(0) if !hasEDNS.
+func maxUDPResponseSize(q ednsQuery, hasEDNS bool) int {
+	if !hasEDNS {
+		return 512
+	}
+	return min(max(q.udpSize, 512), ednsUDPSize)
+}
+
+// ecsResolver resolves names by sending queries directly to upstream DNS
+// servers, so that it can include ECS options in them.
+type ecsResolver struct {
+	servers []string // host:port
+	timeout time.Duration
+}
+
+func newECSResolver(servers []string) *ecsResolver {
+	return &ecsResolver{servers: servers, timeout: 5 * time.Second}
+}
+
+// LookupNetIP implements lookupNetIPer, without sending an ECS option.
+func (r *ecsResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	return r.LookupNetIPWithECS(ctx, network, host, netip.Prefix{})
+}
+
+// LookupNetIPWithECS implements ecsLookuper. Network must be "ip", "ip4"
+// or "ip6". If ecs is valid, it's sent upstream as the client subnet.
+func (r *ecsResolver) LookupNetIPWithECS(ctx context.Context, network, host string, ecs netip.Prefix) ([]netip.Addr, error) {
+	var types []dnsmessage.Type
+	switch network {
+	case "ip":
+		types = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	case "ip4":
+		types = []dnsmessage.Type{dnsmessage.TypeA}
+	case "ip6":
+		types = []dnsmessage.Type{dnsmessage.TypeAAAA}
+	default:
+		return nil, fmt.Errorf("unsupported network %q", network)
+	}
+	fqdn := host
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	name, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host}
+	}
+
+	var addrs []netip.Addr
+	for _, typ := range types {
+		resp, err := r.exchange(ctx, name, typ, ecs)
+		if err != nil {
+			return nil, &net.DNSError{Err: err.Error(), Name: host, IsTemporary: true}
+		}
+		switch resp.RCode {
+		case dnsmessage.RCodeSuccess:
+		case dnsmessage.RCodeNameError:
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		default:
+			return nil, &net.DNSError{Err: "server returned " + resp.RCode.String(), Name: host, IsTemporary: true}
+		}
+		for _, ans := range resp.Answers {
+			switch body := ans.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, netip.AddrFrom4(body.A))
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// exchange sends a query for name and typ to a random upstream server, over
+// UDP and then over TCP if the UDP response is truncated, and returns the
+// response.
+func (r *ecsResolver) exchange(ctx context.Context, name dnsmessage.Name, typ dnsmessage.Type, ecs netip.Prefix) (*dnsmessage.Message, error) {
+	id := uint16(rand.Uint32())
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: name, Type: typ, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var h dnsmessage.ResourceHeader
+	h.SetEDNS0(ednsUDPSize, dnsmessage.RCodeSuccess, false)
+	var opt dnsmessage.OPTResource
+	if ecs.IsValid() {
+		opt.Options = append(opt.Options, ecsOption(ecs, 0))
+	}
+	if err := b.OPTResource(h, opt); err != nil {
+		return nil, err
+	}
+	query, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	server := r.servers[rand.N(len(r.servers))]
+	resp, err := r.roundTrip(ctx, "udp", server, query)
+	if err == nil && resp.Truncated {
+		resp, err = r.roundTrip(ctx, "tcp", server, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.ID != id {
+		return nil, fmt.Errorf("response from %s has ID %d; want %d", server, resp.ID, id)
+	}
+	return resp, nil
+}
+
+// roundTrip sends query to server over network ("udp" or "tcp") and reads
+// the response.
+func (r *ecsResolver) roundTrip(ctx context.Context, network, server string, query []byte) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+
+	var buf []byte
+	if network == "tcp" {
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+			return nil, err
+		}
+		var n [2]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(n[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, ednsUDPSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[:n]
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
@@ -0,0 +1,234 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/gaissmai/bart"
+	"golang.org/x/net/dns/dnsmessage"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/cmd/natc/ippool"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/must"
+)
+
+func TestECSOption(t *testing.T) {
+	for _, s := range []string{"0.0.0.0/0", "192.0.2.0/24", "198.51.100.128/25", "2001:db8::/32", "2001:db8:1:200::/56"} {
+		p := netip.MustParsePrefix(s)
+		got, err := parseECSOption(ecsOption(p, 0).Data)
+		if err != nil {
+			t.Errorf("parseECSOption(ecsOption(%v)): %v", p, err)
+			continue
+		}
+		if got != p {
+			t.Errorf("parseECSOption(ecsOption(%v)) = %v", p, got)
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"short", []byte{0, 1, 24}},
+		{"bad_family", []byte{0, 3, 8, 0, 1}},
+		{"bits_too_long", []byte{0, 1, 33, 0, 1, 2, 3, 4, 5}},
+		{"wrong_addr_len", []byte{0, 1, 24, 0, 192, 0}},
+		{"unmasked", []byte{0, 1, 23, 0, 192, 0, 3}},
+	} {
+		if p, err := parseECSOption(tt.data); err == nil {
+			t.Errorf("%s: parseECSOption = %v; want error", tt.name, p)
+		}
+	}
+}
+
+func TestUpstreamECS(t *testing.T) {
+	site := netip.MustParsePrefix("203.0.113.0/24")
+	tests := []struct {
+		mode   ecsMode
+		client string
+		want   string
+	}{
+		{ecsStrip, "192.0.2.0/24", ""},
+		{ecsForward, "", ""},
+		{ecsForward, "192.0.2.0/24", "192.0.2.0/24"},
+		{ecsForward, "192.0.2.77/32", "192.0.2.0/24"},
+		{ecsForward, "192.0.0.0/16", "192.0.0.0/16"},
+		{ecsForward, "2001:db8:1:2:3::/80", "2001:db8:1::/56"},
+		{ecsSite, "", "203.0.113.0/24"},
+		{ecsSite, "192.0.2.0/24", "203.0.113.0/24"},
+	}
+	for _, tt := range tests {
+		c := &connector{ecs: tt.mode, ecsSubnet: site}
+		var client, want netip.Prefix
+		if tt.client != "" {
+			client = netip.MustParsePrefix(tt.client)
+		}
+		if tt.want != "" {
+			want = netip.MustParsePrefix(tt.want)
+		}
+		if got := c.upstreamECS(client); got != want {
+			t.Errorf("%s: upstreamECS(%v) = %v; want %v", tt.mode, client, got, want)
+		}
+	}
+}
+
+// ecsRecordingResolver is a resolver that records the client subnets it's
+// asked to send upstream.
+type ecsRecordingResolver struct {
+	resolver
+	ecs []netip.Prefix
+}
+
+func (r *ecsRecordingResolver) LookupNetIPWithECS(ctx context.Context, network, host string, ecs netip.Prefix) ([]netip.Addr, error) {
+	r.ecs = append(r.ecs, ecs)
+	return r.LookupNetIP(ctx, network, host)
+}
+
+func TestHandleDNSEDNS(t *testing.T) {
+	var addrs []netip.Addr
+	for i := range 40 {
+		addrs = append(addrs, netip.MustParseAddr(fmt.Sprintf("192.0.2.%d", i+1)))
+	}
+	res := &ecsRecordingResolver{
+		resolver: resolver{resolves: map[string][]netip.Addr{
+			"example.com.":      {netip.MustParseAddr("8.8.8.8")},
+			"many.example.com.": addrs,
+		}},
+	}
+	routes, dnsAddr, addrPool := calculateAddresses([]netip.Prefix{netip.MustParsePrefix("10.64.0.0/24")})
+	c := &connector{
+		resolver: res,
+		whois: &whois{
+			peers: map[string]*apitype.WhoIsResponse{
+				"100.64.254.1": {Node: &tailcfg.Node{ID: 123}},
+			},
+		},
+		ignoreDsts: &bart.Lite{},
+		routes:     routes,
+		v6ULA:      ula(1),
+		ipPool:     &ippool.SingleMachineIPPool{IPSet: addrPool},
+		dnsAddr:    dnsAddr,
+		ecs:        ecsForward,
+	}
+	// Ignored destinations are answered with all of their addresses.
+	c.ignoreDsts.Insert(netip.MustParsePrefix("192.0.2.0/24"))
+	remoteAddr := must.Get(net.ResolveUDPAddr("udp", "100.64.254.1:12345"))
+	clientCookie := []byte("cookie!!")
+
+	query := func(t *testing.T, name string, opt *dnsmessage.OPTResource, version uint8) dnsmessage.Message {
+		t.Helper()
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 1234})
+		must.Do(b.StartQuestions())
+		must.Do(b.Question(dnsmessage.Question{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}))
+		if opt != nil {
+			must.Do(b.StartAdditionals())
+			var h dnsmessage.ResourceHeader
+			must.Do(h.SetEDNS0(4096, dnsmessage.RCodeSuccess, false))
+			h.TTL |= uint32(version) << 16
+			must.Do(b.OPTResource(h, *opt))
+		}
+		var rpc recordingPacketConn
+		c.handleDNS(&rpc, must.Get(b.Finish()), remoteAddr)
+		if len(rpc.writes) != 1 {
+			t.Fatalf("got %d responses; want 1", len(rpc.writes))
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(rpc.writes[0]); err != nil {
+			t.Fatalf("unpacking response: %v", err)
+		}
+		return msg
+	}
+	responseOPT := func(t *testing.T, msg dnsmessage.Message) (dnsmessage.ResourceHeader, *dnsmessage.OPTResource) {
+		t.Helper()
+		for _, r := range msg.Additionals {
+			if opt, ok := r.Body.(*dnsmessage.OPTResource); ok {
+				return r.Header, opt
+			}
+		}
+		t.Fatalf("response has no OPT record:\n%s", msg.GoString())
+		return dnsmessage.ResourceHeader{}, nil
+	}
+
+	t.Run("ecs_and_cookie", func(t *testing.T) {
+		res.ecs = nil
+		clientECS := netip.MustParsePrefix("192.0.2.0/24")
+		msg := query(t, "example.com.", &dnsmessage.OPTResource{Options: []dnsmessage.Option{
+			ecsOption(clientECS, 0),
+			{Code: ednsOptionCookie, Data: clientCookie},
+		}}, 0)
+		if msg.Header.RCode != dnsmessage.RCodeSuccess || len(msg.Answers) != 1 {
+			t.Fatalf("unexpected response:\n%s", msg.GoString())
+		}
+		if len(res.ecs) != 1 || res.ecs[0] != clientECS {
+			t.Errorf("upstream ECS = %v; want [%v]", res.ecs, clientECS)
+		}
+		h, opt := responseOPT(t, msg)
+		if h.Class != ednsUDPSize {
+			t.Errorf("advertised UDP size = %d; want %d", h.Class, ednsUDPSize)
+		}
+		var gotECS, gotCookie bool
+		for _, o := range opt.Options {
+			switch o.Code {
+			case ednsOptionECS:
+				gotECS = true
+				if p, err := parseECSOption(o.Data); err != nil || p != clientECS || o.Data[3] != 0 {
+					t.Errorf("ECS option = %v, %v (scope %d); want %v, scope 0", p, err, o.Data[3], clientECS)
+				}
+			case ednsOptionCookie:
+				gotCookie = true
+				want := append(bytes.Clone(clientCookie), c.serverCookie(clientCookie, netip.MustParseAddr("100.64.254.1"))...)
+				if !bytes.Equal(o.Data, want) {
+					t.Errorf("cookie = %x; want %x", o.Data, want)
+				}
+			}
+		}
+		if !gotECS || !gotCookie {
+			t.Errorf("response options = %+v; want ECS and cookie", opt.Options)
+		}
+	})
+
+	t.Run("bad_version", func(t *testing.T) {
+		msg := query(t, "example.com.", &dnsmessage.OPTResource{}, 1)
+		h, _ := responseOPT(t, msg)
+		if got := h.ExtendedRCode(msg.Header.RCode); got != 16 {
+			t.Errorf("extended RCode = %v; want BADVERS (16)", got)
+		}
+		if len(msg.Answers) != 0 {
+			t.Errorf("got %d answers; want 0", len(msg.Answers))
+		}
+	})
+
+	t.Run("bad_cookie", func(t *testing.T) {
+		msg := query(t, "example.com.", &dnsmessage.OPTResource{Options: []dnsmessage.Option{
+			{Code: ednsOptionCookie, Data: []byte("short")},
+		}}, 0)
+		if msg.Header.RCode != dnsmessage.RCodeFormatError {
+			t.Errorf("RCode = %v; want %v", msg.Header.RCode, dnsmessage.RCodeFormatError)
+		}
+	})
+
+	t.Run("truncated_without_edns", func(t *testing.T) {
+		msg := query(t, "many.example.com.", nil, 0)
+		if !msg.Header.Truncated || len(msg.Answers) != 0 {
+			t.Errorf("got truncated=%v with %d answers; want truncated with none", msg.Header.Truncated, len(msg.Answers))
+		}
+	})
+
+	t.Run("large_with_edns", func(t *testing.T) {
+		msg := query(t, "many.example.com.", &dnsmessage.OPTResource{}, 0)
+		if msg.Header.Truncated || len(msg.Answers) != len(addrs) {
+			t.Errorf("got truncated=%v with %d answers; want %d answers", msg.Header.Truncated, len(msg.Answers), len(addrs))
+		}
+	})
+}
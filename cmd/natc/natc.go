@@ -8,12 +8,16 @@
 
 import (
 	"context"
+	crand "crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"expvar"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"math/rand/v2"
 	"net"
 	"net/http"
@@ -35,6 +39,7 @@
 	"tailscale.com/envknob"
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
+	"tailscale.com/net/ftpalg"
 	"tailscale.com/net/netutil"
 	"tailscale.com/tsnet"
 	"tailscale.com/tsweb"
@@ -66,6 +71,9 @@ func main() {
 		stateDir          = fs.String("state-dir", "", "path to directory in which to store app state")
 		clusterFollowOnly = fs.Bool("follow-only", false, "Try to find a leader with the cluster tag or exit.")
 		clusterAdminPort  = fs.Int("cluster-admin-port", 8081, "Port on localhost for the cluster admin HTTP API")
+		ecsModeStr        = fs.String("ecs", string(ecsStrip), `how to handle EDNS Client Subnet when resolving upstream: "strip" sends none, "forward" passes on the querying client's subnet (truncated to /24 or /56), "site" sends --ecs-subnet; modes other than "strip" require --dns-servers`)
+		ecsSubnetStr      = fs.String("ecs-subnet", "", `client subnet to send upstream with --ecs=site, typically covering this site's egress addresses`)
+		proxyProtocol     = fs.Bool("proxy-protocol", false, "send a PROXY protocol v2 header on connections to backends, with the Tailscale identity of the client as JSON in a TLV of type 0xE0")
 	)
 	ff.Parse(fs, os.Args[1:], ff.WithEnvVarPrefix("TS_NATC"))
 
@@ -82,6 +90,22 @@ func main() {
 		log.Fatalf("site-id must be in the range [0, 65535]")
 	}
 
+	ecs, err := parseECSMode(*ecsModeStr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var ecsSubnet netip.Prefix
+	if ecs == ecsSite {
+		ecsSubnet, err = netip.ParsePrefix(*ecsSubnetStr)
+		if err != nil {
+			log.Fatalf("--ecs=site requires a valid --ecs-subnet: %v", err)
+		}
+		ecsSubnet = ecsSubnet.Masked()
+	}
+	if ecs != ecsStrip && *dnsServers == "" {
+		log.Fatalf("--ecs=%s requires --dns-servers", ecs)
+	}
+
 	var ignoreDstTable *bart.Lite
 	for s := range strings.SplitSeq(*ignoreDstPfxStr, ",") {
 		s := strings.TrimSpace(s)
@@ -201,7 +225,15 @@ func main() {
 		routes:     routes,
 		dnsAddr:    dnsAddr,
 		resolver:   getResolver(*dnsServers),
+		ecs:        ecs,
+		ecsSubnet:  ecsSubnet,
+
+		proxyProtocol: *proxyProtocol,
+	}
+	if ecs != ecsStrip {
+		c.resolver = newECSResolver(parseDNSServers(*dnsServers))
 	}
+	crand.Read(c.cookieSecret[:])
 	c.run(ctx, lc)
 }
 
@@ -212,6 +244,20 @@ func getResolver(serverFlag string) lookupNetIPer {
 	if serverFlag == "" {
 		return net.DefaultResolver
 	}
+	addrs := parseDNSServers(serverFlag)
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			// TODO(raggi): perhaps something other than random?
+			return dialer.DialContext(ctx, network, addrs[rand.N(len(addrs))])
+		},
+	}
+}
+
+// parseDNSServers parses serverFlag as a comma-separated list of DNS server
+// AddrPorts, or panics.
+func parseDNSServers(serverFlag string) []string {
 	var addrs []string
 	for s := range strings.SplitSeq(serverFlag, ",") {
 		s = strings.TrimSpace(s)
@@ -221,14 +267,7 @@ func getResolver(serverFlag string) lookupNetIPer {
 		}
 		addrs = append(addrs, addr.String())
 	}
-	return &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
-			var dialer net.Dialer
-			// TODO(raggi): perhaps something other than random?
-			return dialer.DialContext(ctx, network, addrs[rand.N(len(addrs))])
-		},
-	}
+	return addrs
 }
 
 func calculateAddresses(prefixes []netip.Prefix) (*netipx.IPSet, netip.Addr, *netipx.IPSet) {
@@ -283,6 +322,25 @@ type connector struct {
 
 	// resolver is used to lookup IP addresses for DNS queries.
 	resolver lookupNetIPer
+
+	// ecs is how EDNS Client Subnet options are handled when resolving
+	// upstream, and ecsSubnet is the client subnet sent in ecsSite mode.
+	// Modes other than ecsStrip require a resolver that implements
+	// ecsLookuper.
+	ecs       ecsMode
+	ecsSubnet netip.Prefix
+
+	// cookieSecret is the secret from which DNS server cookies are
+	// derived.
+	cookieSecret [32]byte
+
+	// proxyProtocol is whether to send a PROXY protocol v2 header, with the
+	// Tailscale identity of the client, on connections to backends.
+	proxyProtocol bool
+
+	// ftpData are the FTP data connections that servers told clients to
+	// make on the FTP control connections being proxied.
+	ftpData ftpalg.Expectations
 }
 
 // v6ULA is the ULA prefix used by the app connector to assign IPv6 addresses.
@@ -321,6 +379,12 @@ func (c *connector) serveDNS() {
 		log.Fatalf("failed listening on port 53: %v", err)
 	}
 	defer pc.Close()
+	ln, err := c.ts.Listen("tcp", net.JoinHostPort(c.dnsAddr.String(), "53"))
+	if err != nil {
+		log.Fatalf("failed listening on TCP port 53: %v", err)
+	}
+	defer ln.Close()
+	go c.serveDNSTCP(ln)
 	log.Printf("Listening for DNS on %s", pc.LocalAddr().String())
 	for {
 		buf := make([]byte, 1500)
@@ -336,6 +400,68 @@ func (c *connector) serveDNS() {
 	}
 }
 
+// serveDNSTCP serves DNS over TCP on ln, for clients retrying queries whose
+// responses were truncated over UDP.
+func (c *connector) serveDNSTCP(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("serveDNSTCP.Accept failed: %v", err)
+			continue
+		}
+		go c.handleDNSConn(conn)
+	}
+}
+
+// handleDNSConn handles the DNS requests on a TCP connection, each prefixed
+// by its two byte length (RFC 1035 section 4.2.2), until the client closes
+// it or is idle for too long.
+func (c *connector) handleDNSConn(conn net.Conn) {
+	defer conn.Close()
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	remoteAddr := net.UDPAddrFromAddrPort(tcpAddr.AddrPort())
+	pc := &tcpDNSConn{Conn: conn}
+	for {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		var hdr [2]byte
+		if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+			return
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(hdr[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		c.handleDNS(pc, buf, remoteAddr)
+	}
+}
+
+// tcpDNSConn adapts a TCP connection to the net.PacketConn that handleDNS
+// writes its responses to.
+type tcpDNSConn struct {
+	net.Conn
+}
+
+func (c *tcpDNSConn) ReadFrom([]byte) (int, net.Addr, error) {
+	return 0, nil, errors.ErrUnsupported
+}
+
+func (c *tcpDNSConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	if len(b) > math.MaxUint16 {
+		return 0, errors.New("DNS message too large")
+	}
+	_, err := c.Conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(b))), b...))
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
 // handleDNS handles a DNS request to the app connector.
 // It generates a response based on the request and the node that sent it.
 //
@@ -363,6 +489,19 @@ func (c *connector) handleDNS(pc net.PacketConn, buf []byte, remoteAddr *net.UDP
 		return
 	}
 
+	edns, hasEDNS, err := parseEDNS(&msg)
+	if err != nil {
+		log.Printf("HandleDNS(remote=%s): bad EDNS(0) options: %v\n", remoteAddr.String(), err)
+		c.writeDNSResponse(pc, remoteAddr, &msg, dnsmessage.RCodeFormatError, nil, edns, hasEDNS)
+		return
+	}
+	if hasEDNS && edns.version != 0 {
+		const rcodeBadVers = dnsmessage.RCode(16) // RFC 6891 section 9
+		c.writeDNSResponse(pc, remoteAddr, &msg, rcodeBadVers, nil, edns, hasEDNS)
+		return
+	}
+	ecs := c.upstreamECS(edns.ecs)
+
 	var resolves map[string][]netip.Addr
 	var addrQCount int
 	for _, q := range msg.Questions {
@@ -371,7 +510,7 @@ func (c *connector) handleDNS(pc net.PacketConn, buf []byte, remoteAddr *net.UDP
 		}
 		addrQCount++
 		if _, ok := resolves[q.Name.String()]; !ok {
-			addrs, err := c.resolver.LookupNetIP(ctx, "ip", q.Name.String())
+			addrs, err := c.lookup(ctx, "ip", q.Name.String(), ecs)
 			if dnsErr, ok := errors.AsType[*net.DNSError](err); ok && dnsErr.IsNotFound {
 				continue
 			}
@@ -401,19 +540,45 @@ func (c *connector) handleDNS(pc net.PacketConn, buf []byte, remoteAddr *net.UDP
 	if addrQCount > 0 && len(resolves) == 0 {
 		rcode = dnsmessage.RCodeNameError
 	}
+	c.writeDNSResponse(pc, remoteAddr, &msg, rcode, resolves, edns, hasEDNS)
+}
 
+// writeDNSResponse writes the response to the query msg from remoteAddr to
+// pc. Its answers are the addresses in resolves, keyed by name; rcode may be
+// an extended RCode if the query has EDNS(0) information. If the response
+// doesn't fit in the client's UDP payload size, it's sent truncated, without
+// answers, so the client retries over TCP (see serveDNSTCP).
+func (c *connector) writeDNSResponse(pc net.PacketConn, remoteAddr *net.UDPAddr, msg *dnsmessage.Message, rcode dnsmessage.RCode, resolves map[string][]netip.Addr, edns ednsQuery, hasEDNS bool) {
+	out, err := c.dnsResponse(msg, rcode, resolves, edns, hasEDNS, remoteAddr.AddrPort().Addr().Unmap(), false)
+	if _, isTCP := pc.(*tcpDNSConn); err == nil && !isTCP && len(out) > maxUDPResponseSize(edns, hasEDNS) {
+		out, err = c.dnsResponse(msg, rcode, resolves, edns, hasEDNS, remoteAddr.AddrPort().Addr().Unmap(), true)
+	}
+	if err != nil {
+		log.Printf("HandleDNS(remote=%s): %v\n", remoteAddr.String(), err)
+		return
+	}
+	_, err = pc.WriteTo(out, remoteAddr)
+	if err != nil {
+		log.Printf("HandleDNS(remote=%s): write failed: %v\n", remoteAddr.String(), err)
+	}
+}
+
+// dnsResponse builds the response to the query msg from clientAddr. See
+// writeDNSResponse. If truncated, the response has no answers and the TC
+// bit set.
+func (c *connector) dnsResponse(msg *dnsmessage.Message, rcode dnsmessage.RCode, resolves map[string][]netip.Addr, edns ednsQuery, hasEDNS bool, clientAddr netip.Addr, truncated bool) ([]byte, error) {
 	b := dnsmessage.NewBuilder(nil,
 		dnsmessage.Header{
 			ID:            msg.Header.ID,
 			Response:      true,
 			Authoritative: true,
-			RCode:         rcode,
+			Truncated:     truncated,
+			RCode:         rcode & 0xf, // the rest goes in the OPT record
 		})
 	b.EnableCompression()
 
 	if err := b.StartQuestions(); err != nil {
-		log.Printf("HandleDNS(remote=%s): dnsmessage start questions failed: %v\n", remoteAddr.String(), err)
-		return
+		return nil, fmt.Errorf("dnsmessage start questions failed: %w", err)
 	}
 
 	for _, q := range msg.Questions {
@@ -421,11 +586,13 @@ func (c *connector) handleDNS(pc net.PacketConn, buf []byte, remoteAddr *net.UDP
 	}
 
 	if err := b.StartAnswers(); err != nil {
-		log.Printf("HandleDNS(remote=%s): dnsmessage start answers failed: %v\n", remoteAddr.String(), err)
-		return
+		return nil, fmt.Errorf("dnsmessage start answers failed: %w", err)
 	}
 
 	for _, q := range msg.Questions {
+		if truncated {
+			break
+		}
 		switch q.Type {
 		case dnsmessage.TypeSOA:
 			if err := b.SOAResource(
@@ -433,16 +600,14 @@ func (c *connector) handleDNS(pc net.PacketConn, buf []byte, remoteAddr *net.UDP
 				dnsmessage.SOAResource{NS: q.Name, MBox: tsMBox, Serial: 2023030600,
 					Refresh: 120, Retry: 120, Expire: 120, MinTTL: 60},
 			); err != nil {
-				log.Printf("HandleDNS(remote=%s): dnsmessage SOA resource failed: %v\n", remoteAddr.String(), err)
-				return
+				return nil, fmt.Errorf("dnsmessage SOA resource failed: %w", err)
 			}
 		case dnsmessage.TypeNS:
 			if err := b.NSResource(
 				dnsmessage.ResourceHeader{Name: q.Name, Class: q.Class, TTL: 120},
 				dnsmessage.NSResource{NS: tsMBox},
 			); err != nil {
-				log.Printf("HandleDNS(remote=%s): dnsmessage NS resource failed: %v\n", remoteAddr.String(), err)
-				return
+				return nil, fmt.Errorf("dnsmessage NS resource failed: %w", err)
 			}
 		case dnsmessage.TypeAAAA:
 			for _, addr := range resolves[q.Name.String()] {
@@ -453,8 +618,7 @@ func (c *connector) handleDNS(pc net.PacketConn, buf []byte, remoteAddr *net.UDP
 					dnsmessage.ResourceHeader{Name: q.Name, Class: q.Class, TTL: 120},
 					dnsmessage.AAAAResource{AAAA: addr.As16()},
 				); err != nil {
-					log.Printf("HandleDNS(remote=%s): dnsmessage AAAA resource failed: %v\n", remoteAddr.String(), err)
-					return
+					return nil, fmt.Errorf("dnsmessage AAAA resource failed: %w", err)
 				}
 			}
 		case dnsmessage.TypeA:
@@ -466,22 +630,27 @@ func (c *connector) handleDNS(pc net.PacketConn, buf []byte, remoteAddr *net.UDP
 					dnsmessage.ResourceHeader{Name: q.Name, Class: q.Class, TTL: 120},
 					dnsmessage.AResource{A: addr.As4()},
 				); err != nil {
-					log.Printf("HandleDNS(remote=%s): dnsmessage A resource failed: %v\n", remoteAddr.String(), err)
-					return
+					return nil, fmt.Errorf("dnsmessage A resource failed: %w", err)
 				}
 			}
 		}
 	}
 
+	if hasEDNS {
+		if err := b.StartAdditionals(); err != nil {
+			return nil, fmt.Errorf("dnsmessage start additionals failed: %w", err)
+		}
+		h, opt := c.ednsResponseOPT(edns, clientAddr, rcode)
+		if err := b.OPTResource(h, opt); err != nil {
+			return nil, fmt.Errorf("dnsmessage OPT resource failed: %w", err)
+		}
+	}
+
 	out, err := b.Finish()
 	if err != nil {
-		log.Printf("HandleDNS(remote=%s): dnsmessage finish failed: %v\n", remoteAddr.String(), err)
-		return
-	}
-	_, err = pc.WriteTo(out, remoteAddr)
-	if err != nil {
-		log.Printf("HandleDNS(remote=%s): write failed: %v\n", remoteAddr.String(), err)
+		return nil, fmt.Errorf("dnsmessage finish failed: %w", err)
 	}
+	return out, nil
 }
 
 func v6ForV4(ula netip.Addr, v4 netip.Addr) netip.Addr {
@@ -522,12 +691,17 @@ func (c *connector) handleTCPFlow(src, dst netip.AddrPort) (handler func(net.Con
 	if dstAddr.Is6() {
 		dstAddr = v4ForV6(dstAddr)
 	}
+	if backend, ok := c.ftpData.Take(src.Addr(), dst); ok {
+		return func(conn net.Conn) {
+			proxyTCPConnTo(conn, backend, c, who)
+		}, true
+	}
 	domain, ok := c.ipPool.DomainForIP(who.Node.ID, dstAddr, time.Now())
 	if !ok {
 		return nil, false
 	}
 	return func(conn net.Conn) {
-		proxyTCPConn(conn, domain, c)
+		proxyTCPConn(conn, domain, c, who)
 	}, true
 }
 
@@ -545,7 +719,9 @@ func (c *connector) ignoreDestination(dstAddrs []netip.Addr) bool {
 	return false
 }
 
-func proxyTCPConn(c net.Conn, dest string, ctor *connector) {
+// proxyTCPConn proxies c, a connection from the client who, to the domain
+// dest.
+func proxyTCPConn(c net.Conn, dest string, ctor *connector, who *apitype.WhoIsResponse) {
 	if c.RemoteAddr() == nil {
 		log.Printf("proxyTCPConn: nil RemoteAddr")
 		c.Close()
@@ -558,7 +734,9 @@ func proxyTCPConn(c net.Conn, dest string, ctor *connector) {
 		return
 	}
 
-	daddrs, err := ctor.resolver.LookupNetIP(context.TODO(), "ip", dest)
+	// The querying client's ECS option isn't known here, so in
+	// ecsForward mode this lookup is sent without one.
+	daddrs, err := ctor.lookup(context.TODO(), "ip", dest, ctor.upstreamECS(netip.Prefix{}))
 	if err != nil {
 		log.Printf("proxyTCPConn: LookupNetIP failed: %v", err)
 		c.Close()
@@ -577,12 +755,6 @@ func proxyTCPConn(c net.Conn, dest string, ctor *connector) {
 		return
 	}
 
-	p := &tcpproxy.Proxy{
-		ListenFunc: func(net, laddr string) (net.Listener, error) {
-			return netutil.NewOneConnListener(c, nil), nil
-		},
-	}
-
 	// TODO(raggi): more code could avoid this shuffle, but avoiding allocations
 	// for now most of the time daddrs will be short.
 	rand.Shuffle(len(daddrs), func(i, j int) {
@@ -607,12 +779,59 @@ func proxyTCPConn(c net.Conn, dest string, ctor *connector) {
 		}
 	}
 
+	proxyTCPConnTo(c, netip.AddrPortFrom(daddr, laddr.Port()), ctor, who)
+}
+
+// proxyTCPConnTo proxies c, a connection from the client who, to dst.
+//
+// If c is an FTP control connection, the data connections announced on it
+// are expected in ctor.ftpData, to be proxied to the same server.
+func proxyTCPConnTo(c net.Conn, dst netip.AddrPort, ctor *connector, who *apitype.WhoIsResponse) {
+	if c.RemoteAddr() == nil {
+		log.Printf("proxyTCPConn: nil RemoteAddr")
+		c.Close()
+		return
+	}
+	laddr, err := netip.ParseAddrPort(c.LocalAddr().String())
+	if err != nil {
+		log.Printf("proxyTCPConn: ParseAddrPort failed: %v", err)
+		c.Close()
+		return
+	}
+	raddr, err := netip.ParseAddrPort(c.RemoteAddr().String())
+	if err != nil {
+		log.Printf("proxyTCPConn: ParseAddrPort failed: %v", err)
+		c.Close()
+		return
+	}
+	if laddr.Port() == ftpalg.ControlPort {
+		c = ftpalg.WrapConn(c, laddr.Addr(), func(port uint16) {
+			ctor.ftpData.Add(raddr.Addr(), netip.AddrPortFrom(laddr.Addr(), port), netip.AddrPortFrom(dst.Addr(), port))
+		})
+	}
+
+	p := &tcpproxy.Proxy{
+		ListenFunc: func(net, laddr string) (net.Listener, error) {
+			return netutil.NewOneConnListener(c, nil), nil
+		},
+	}
+
 	// TODO(raggi): drop this library, it ends up being allocation and
 	// indirection heavy and really doesn't help us here.
-	dsockaddrs := netip.AddrPortFrom(daddr, laddr.Port()).String()
-	p.AddRoute(dsockaddrs, &tcpproxy.DialProxy{
+	dsockaddrs := dst.String()
+	dp := &tcpproxy.DialProxy{
 		Addr: dsockaddrs,
-	})
+	}
+	if ctor.proxyProtocol {
+		hdr, err := proxyHeader(raddr, laddr, who)
+		if err != nil {
+			log.Printf("proxyTCPConn: PROXY header for %v: %v", raddr, err)
+			c.Close()
+			return
+		}
+		dp.DialContext = dialWithHeader(hdr)
+	}
+	p.AddRoute(dsockaddrs, dp)
 
 	p.Start()
 }
@@ -105,7 +105,10 @@ type whois struct {
 }
 
 func (w *whois) WhoIs(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error) {
-	addr := netip.MustParseAddrPort(remoteAddr).Addr().String()
+	addr := remoteAddr // an IP or IP:port, like local.Client.WhoIs
+	if ap, err := netip.ParseAddrPort(remoteAddr); err == nil {
+		addr = ap.Addr().String()
+	}
 	if peer, ok := w.peers[addr]; ok {
 		return peer, nil
 	}
@@ -676,3 +679,65 @@ func TestGetResolverEmpty(t *testing.T) {
 		t.Fatal(`getResolver("") should return net.DefaultResolver`)
 	}
 }
+
+// addrConn is a net.Conn with fixed addresses.
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c addrConn) LocalAddr() net.Addr  { return c.local }
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func TestFTPDataFollowsControl(t *testing.T) {
+	// An FTP server that announces a data port at its loopback address.
+	ln := must.Get(net.Listen("tcp", "127.0.0.1:0"))
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.WriteString(c, "227 Entering Passive Mode (127,0,0,1,195,80)\r\n")
+	}()
+	backend := must.Get(netip.ParseAddrPort(ln.Addr().String()))
+
+	client := netip.MustParseAddrPort("100.64.254.1:5555")
+	natcAddr := netip.MustParseAddrPort("10.64.0.5:21")
+	c := &connector{
+		whois: &whois{
+			peers: map[string]*apitype.WhoIsResponse{
+				client.Addr().String(): {Node: &tailcfg.Node{ID: 123}},
+			},
+		},
+		ipPool: &ippool.SingleMachineIPPool{},
+	}
+	clientSide, natcSide := net.Pipe()
+	defer clientSide.Close()
+	go proxyTCPConnTo(addrConn{
+		Conn:   natcSide,
+		local:  net.TCPAddrFromAddrPort(natcAddr),
+		remote: net.TCPAddrFromAddrPort(client),
+	}, backend, c, nil)
+
+	clientSide.SetReadDeadline(time.Now().Add(10 * time.Second))
+	want := "227 Entering Passive Mode (10,64,0,5,195,80)\r\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(clientSide, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("client got %q; want %q", got, want)
+	}
+
+	// The data connection to natc is intercepted despite having no domain,
+	// then proxied to the control connection's server.
+	dataDst := netip.AddrPortFrom(natcAddr.Addr(), 50000)
+	if _, intercept := c.handleTCPFlow(client, dataDst); !intercept {
+		t.Error("data connection not intercepted")
+	}
+	if _, intercept := c.handleTCPFlow(client, dataDst); intercept {
+		t.Error("second data connection intercepted")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/pires/go-proxyproto"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+// proxyIdentityTLV is the type of the PROXY protocol v2 TLV in which natc
+// sends backends the Tailscale identity of the client, from the range of
+// types reserved for applications.
+const proxyIdentityTLV = proxyproto.PP2_TYPE_MIN_CUSTOM
+
+// proxyIdentity is the value of the proxyIdentityTLV, as JSON.
+type proxyIdentity struct {
+	// LoginName is the login name of the user that owns the client node,
+	// or empty if the node is tagged.
+	LoginName string `json:",omitempty"`
+
+	// Node is the FQDN of the client node in the tailnet.
+	Node string
+
+	// NodeID is the stable ID of the client node.
+	NodeID tailcfg.StableNodeID
+
+	// Tags are the tags of the client node, if any.
+	Tags []string `json:",omitempty"`
+}
+
+// identityOf returns the proxyIdentity of the client that who describes.
+func identityOf(who *apitype.WhoIsResponse) proxyIdentity {
+	var id proxyIdentity
+	if n := who.Node; n != nil {
+		id.Node = n.Name
+		id.NodeID = n.StableID
+		id.Tags = n.Tags
+	}
+	if u := who.UserProfile; u != nil && len(id.Tags) == 0 {
+		id.LoginName = u.LoginName
+	}
+	return id
+}
+
+// proxyHeader returns the PROXY protocol v2 header for a connection from
+// the client who at src to natc at dst.
+func proxyHeader(src, dst netip.AddrPort, who *apitype.WhoIsResponse) ([]byte, error) {
+	src = netip.AddrPortFrom(src.Addr().Unmap(), src.Port())
+	dst = netip.AddrPortFrom(dst.Addr().Unmap(), dst.Port())
+	h := &proxyproto.Header{
+		Version:         2,
+		Command:         proxyproto.PROXY,
+		SourceAddr:      net.TCPAddrFromAddrPort(src),
+		DestinationAddr: net.TCPAddrFromAddrPort(dst),
+	}
+	switch {
+	case src.Addr().Is4() && dst.Addr().Is4():
+		h.TransportProtocol = proxyproto.TCPv4
+	case src.Addr().Is6() && dst.Addr().Is6():
+		h.TransportProtocol = proxyproto.TCPv6
+	default:
+		return nil, fmt.Errorf("mismatched address families of %v and %v", src, dst)
+	}
+	id, err := json.Marshal(identityOf(who))
+	if err != nil {
+		return nil, err
+	}
+	if err := h.SetTLVs([]proxyproto.TLV{{Type: proxyIdentityTLV, Value: id}}); err != nil {
+		return nil, err
+	}
+	return h.Format()
+}
+
+// dialWithHeader returns a dial func that writes hdr to each connection it
+// dials, before anything else is sent on it.
+func dialWithHeader(hdr []byte) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		var d net.Dialer
+		c, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.Write(hdr); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("writing PROXY header: %w", err)
+		}
+		return c, nil
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+func TestProxyHeader(t *testing.T) {
+	user := &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "laptop.tail1234.ts.net.", StableID: "nLaptop"},
+		UserProfile: &tailcfg.UserProfile{LoginName: "alice@example.com"},
+	}
+	tagged := &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "ci.tail1234.ts.net.", StableID: "nCI", Tags: []string{"tag:ci"}},
+		UserProfile: &tailcfg.UserProfile{LoginName: "tagged-devices"},
+	}
+
+	tests := []struct {
+		name     string
+		src, dst netip.AddrPort
+		who      *apitype.WhoIsResponse
+		wantID   proxyIdentity
+		wantErr  bool
+	}{
+		{
+			name:   "v4-user",
+			src:    netip.MustParseAddrPort("100.64.0.1:41234"),
+			dst:    netip.MustParseAddrPort("100.64.1.5:443"),
+			who:    user,
+			wantID: proxyIdentity{LoginName: "alice@example.com", Node: "laptop.tail1234.ts.net.", NodeID: "nLaptop"},
+		},
+		{
+			name:   "v6-tagged",
+			src:    netip.MustParseAddrPort("[fd7a:115c:a1e0::1]:41234"),
+			dst:    netip.MustParseAddrPort("[fd7a:115c:a1e0:a99c:1::5]:443"),
+			who:    tagged,
+			wantID: proxyIdentity{Node: "ci.tail1234.ts.net.", NodeID: "nCI", Tags: []string{"tag:ci"}},
+		},
+		{
+			name:   "v4-in-v6",
+			src:    netip.MustParseAddrPort("[::ffff:100.64.0.1]:41234"),
+			dst:    netip.MustParseAddrPort("100.64.1.5:443"),
+			who:    user,
+			wantID: proxyIdentity{LoginName: "alice@example.com", Node: "laptop.tail1234.ts.net.", NodeID: "nLaptop"},
+		},
+		{
+			name:    "mismatched-families",
+			src:     netip.MustParseAddrPort("100.64.0.1:41234"),
+			dst:     netip.MustParseAddrPort("[fd7a:115c:a1e0:a99c:1::5]:443"),
+			who:     user,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := proxyHeader(tt.src, tt.dst, tt.who)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := proxyproto.Read(bufio.NewReader(bytes.NewReader(b)))
+			if err != nil {
+				t.Fatalf("reading header: %v", err)
+			}
+			if h.Version != 2 {
+				t.Errorf("version = %d; want 2", h.Version)
+			}
+			src, dst, _ := h.TCPAddrs()
+			if got, want := src.AddrPort(), netip.AddrPortFrom(tt.src.Addr().Unmap(), tt.src.Port()); got != want {
+				t.Errorf("source = %v; want %v", got, want)
+			}
+			if got := dst.AddrPort(); got != tt.dst {
+				t.Errorf("destination = %v; want %v", got, tt.dst)
+			}
+			tlvs, err := h.TLVs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tlvs) != 1 || tlvs[0].Type != proxyIdentityTLV {
+				t.Fatalf("TLVs = %v; want one of type %#x", tlvs, proxyIdentityTLV)
+			}
+			var id proxyIdentity
+			if err := json.Unmarshal(tlvs[0].Value, &id); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(id, tt.wantID) {
+				t.Errorf("identity = %+v; want %+v", id, tt.wantID)
+			}
+		})
+	}
+}
@@ -40,6 +40,9 @@ func init() {
 				fs.StringVar(&certArgs.keyFile, "key-file", "", "output key file or \"-\" for stdout; defaults to DOMAIN.key if --cert-file and --key-file are both unset")
 				fs.BoolVar(&certArgs.serve, "serve-demo", false, "if true, serve on port :443 using the cert as a demo, instead of writing out the files to disk")
 				fs.DurationVar(&certArgs.minValidity, "min-validity", 0, "ensure the certificate is valid for at least this duration; the output certificate is never expired if this flag is unset or 0, but the lifetime may vary; the maximum allowed min-validity depends on the CA")
+				fs.StringVar(&certArgs.keyType, "key-type", "ecdsa", `type of private key to get a certificate for: "ecdsa" (P-256) or "rsa" (2048 bit, for older TLS clients)`)
+				fs.StringVar(&certArgs.p12File, "p12-file", "", "output PKCS#12 file containing the cert chain and private key, in addition to any --cert-file and --key-file")
+				fs.StringVar(&certArgs.p12Password, "p12-password", "", "password to protect the PKCS#12 output with; applies to --p12-file and to a --key-file ending in .p12 or .pfx")
 				return fs
 			})(),
 		}
@@ -51,6 +54,9 @@ func init() {
 	keyFile     string
 	serve       bool
 	minValidity time.Duration
+	keyType     string
+	p12File     string
+	p12Password string
 }
 
 func runCert(ctx context.Context, args []string) error {
@@ -103,16 +109,16 @@ func runCert(ctx context.Context, args []string) error {
 	printf := func(format string, a ...any) {
 		printf(format, a...)
 	}
-	if certArgs.certFile == "-" || certArgs.keyFile == "-" {
+	if certArgs.certFile == "-" || certArgs.keyFile == "-" || certArgs.p12File == "-" {
 		printf = log.Printf
 		log.SetFlags(0)
 	}
-	if certArgs.certFile == "" && certArgs.keyFile == "" {
+	if certArgs.certFile == "" && certArgs.keyFile == "" && certArgs.p12File == "" {
 		fileBase := strings.Replace(domain, "*.", "wildcard_.", 1)
 		certArgs.certFile = fileBase + ".crt"
 		certArgs.keyFile = fileBase + ".key"
 	}
-	certPEM, keyPEM, err := localClient.CertPairWithValidity(ctx, domain, certArgs.minValidity)
+	certPEM, keyPEM, err := localClient.CertPairWithKeyType(ctx, domain, certArgs.keyType, certArgs.minValidity)
 	if err != nil {
 		return err
 	}
@@ -146,7 +152,7 @@ func runCert(ctx context.Context, args []string) error {
 		contents := keyPEM
 		if isPKCS12(dst) {
 			var err error
-			contents, err = convertToPKCS12(certPEM, keyPEM)
+			contents, err = convertToPKCS12(certPEM, keyPEM, certArgs.p12Password)
 			if err != nil {
 				return err
 			}
@@ -164,6 +170,24 @@ func runCert(ctx context.Context, args []string) error {
 			}
 		}
 	}
+	if dst := certArgs.p12File; dst != "" {
+		contents, err := convertToPKCS12(certPEM, keyPEM, certArgs.p12Password)
+		if err != nil {
+			return err
+		}
+		changed, err := writeIfChanged(dst, contents, 0600)
+		if err != nil {
+			return err
+		}
+		if dst != "-" {
+			macWarn()
+			if changed {
+				printf("Wrote PKCS#12 bundle to %v\n", dst)
+			} else {
+				printf("PKCS#12 bundle unchanged at %v\n", dst)
+			}
+		}
+	}
 	return nil
 }
 
@@ -185,7 +209,9 @@ func isPKCS12(dst string) bool {
 	return strings.HasSuffix(dst, ".p12") || strings.HasSuffix(dst, ".pfx")
 }
 
-func convertToPKCS12(certPEM, keyPEM []byte) ([]byte, error) {
+// convertToPKCS12 returns a PKCS#12 bundle of the cert chain certPEM and its
+// private key keyPEM, protected with password, which may be empty.
+func convertToPKCS12(certPEM, keyPEM []byte, password string) ([]byte, error) {
 	cert, err := tls.X509KeyPair(certPEM, keyPEM)
 	if err != nil {
 		return nil, err
@@ -204,5 +230,5 @@ func convertToPKCS12(certPEM, keyPEM []byte) ([]byte, error) {
 	// TODO(bradfitz): I'm not sure this is right yet. The goal was to make this
 	// work for https://github.com/tailscale/tailscale/issues/2928 but I'm still
 	// fighting Windows.
-	return pkcs12.Encode(rand.Reader, cert.PrivateKey, certs[0], certs[1:], "" /* no password */)
+	return pkcs12.Encode(rand.Reader, cert.PrivateKey, certs[0], certs[1:], password)
 }
@@ -294,6 +294,7 @@ func newRootCmd(tb ...testenv.TB) *ffcli.Command {
 			exitNodeCmd(),
 			nilOrCall(maybeUpdateCmd),
 			whoisCmd,
+			schemaCmd,
 			debugCmd(),
 			nilOrCall(maybeDriveCmd),
 			idTokenCmd,
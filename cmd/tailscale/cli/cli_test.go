@@ -1038,6 +1038,10 @@ func TestPrefFlagMapping(t *testing.T) {
 		case "AutoExitNode":
 			// Handled by tailscale {set,up} --exit-node=auto:any.
 			continue
+		case "PeerIdle":
+			// Set via LocalAPI by those tuning large tailnets; no CLI
+			// flag for this.
+			continue
 		}
 		t.Errorf("unexpected new ipn.Pref field %q is not handled by up.go (see addPrefFlagMapping and checkForAccidentalSettingReverts)", prefName)
 	}
@@ -1504,6 +1508,50 @@ func TestUpdatePrefs(t *testing.T) {
 	return a == b
 })
 
+func TestDryRunPrefsChanges(t *testing.T) {
+	curPrefs := ipn.NewPrefs()
+	curPrefs.Hostname = "foo"
+	curPrefs.ShieldsUp = true
+	curPrefs.Persist = &persist.Persist{UserProfile: tailcfg.UserProfile{LoginName: "user@example.com"}}
+
+	// Editing only the hostname leaves other settings as they are.
+	mp := &ipn.MaskedPrefs{
+		Prefs:          ipn.Prefs{Hostname: "bar", WantRunning: true},
+		HostnameSet:    true,
+		WantRunningSet: true,
+	}
+	got := prefsChanges(curPrefs, dryRunPrefs(nil, curPrefs, false, mp))
+	want := []prefsChange{
+		{Pref: "Hostname", Old: json.RawMessage(`"foo"`), New: json.RawMessage(`"bar"`)},
+		{Pref: "WantRunning", Old: json.RawMessage(`false`), New: json.RawMessage(`true`)},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("edit changes (-want +got):\n%s", diff)
+	}
+
+	// A full up replaces the settings, resetting ShieldsUp, but keeps the
+	// login state.
+	prefs := ipn.NewPrefs()
+	prefs.Hostname = "foo"
+	prefs.WantRunning = true
+	newPrefs := dryRunPrefs(prefs, curPrefs, false, nil)
+	if newPrefs.Persist != curPrefs.Persist {
+		t.Errorf("Persist = %v; want %v", newPrefs.Persist, curPrefs.Persist)
+	}
+	got = prefsChanges(curPrefs, newPrefs)
+	want = []prefsChange{
+		{Pref: "ShieldsUp", Old: json.RawMessage(`true`), New: json.RawMessage(`false`)},
+		{Pref: "WantRunning", Old: json.RawMessage(`false`), New: json.RawMessage(`true`)},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("up changes (-want +got):\n%s", diff)
+	}
+
+	if got := prefsChanges(curPrefs, curPrefs.Clone()); len(got) != 0 {
+		t.Errorf("no-op changes = %v; want none", got)
+	}
+}
+
 func TestCleanUpArgs(t *testing.T) {
 	type S = []string
 	c := qt.New(t)
@@ -0,0 +1,583 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_debug
+
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/util/prompt"
+	"tailscale.com/version"
+)
+
+func init() {
+	debugBugReportCmd = mkDebugBugReportCmd
+}
+
+var debugBugReportArgs struct {
+	out          string
+	redact       bool
+	exclude      map[string]bool // or nil if --exclude isn't given
+	pseudonymKey string
+	logsFor      time.Duration
+}
+
+func mkDebugBugReportCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "bugreport",
+		ShortUsage: "tailscale debug bugreport [--redact] [--exclude=<category>,...] [--out=<file>] [note]",
+		Exec:       runDebugBugReport,
+		ShortHelp:  "Save a bundle of diagnostic data to attach to a bug report",
+		LongHelp: strings.TrimSpace(`
+Collects tailscaled's status, prefs, current netmap and recent logs into a
+.tar.gz bundle and saves it locally. Nothing is uploaded.
+
+With --redact, the collected data is summarized by category before the bundle
+is saved, and you're asked which categories to exclude. Excluded hostnames,
+IP addresses and user names are replaced with pseudonyms; excluded files are
+left out. The same value is always given the same pseudonym, so that it can
+still be correlated across the bundle.
+
+The categories are: ` + strings.Join(bugReportCategoryNames(), ", ") + `.
+
+To redact without prompting, list the categories to exclude with --exclude
+(which implies --redact), or use --exclude= to exclude none. Without a
+terminal, the default answers to the prompts are used.
+`),
+		FlagSet: (func() *flag.FlagSet {
+			fs := newFlagSet("bugreport")
+			fs.StringVar(&debugBugReportArgs.out, "out", "", "file to save the bundle to (default tailscale-bugreport-<time>.tar.gz)")
+			fs.BoolVar(&debugBugReportArgs.redact, "redact", false, "review and redact the collected data before saving it")
+			fs.Func("exclude", "comma-separated categories to exclude without prompting; implies --redact", func(s string) (err error) {
+				debugBugReportArgs.exclude, err = parseBugReportExclude(s)
+				return err
+			})
+			fs.StringVar(&debugBugReportArgs.pseudonymKey, "pseudonym-key", "", "secret to derive pseudonyms from, so that bundles saved with the same key use the same pseudonyms (default random)")
+			fs.DurationVar(&debugBugReportArgs.logsFor, "logs-for", 5*time.Second, "how long to record tailscaled's logs for; zero to not include logs")
+			return fs
+		})(),
+	}
+}
+
+// bugReportCategory is a category of the data in a bugreport bundle that can
+// be excluded from it.
+type bugReportCategory struct {
+	name string // as used in --exclude
+
+	// pseudonymize is whether the category is excluded by replacing its
+	// values with pseudonyms, rather than by leaving out its file.
+	pseudonymize bool
+
+	// keep is the default for whether to keep the category, when prompting.
+	keep bool
+}
+
+var bugReportCategories = []bugReportCategory{
+	{name: "hostnames", pseudonymize: true},
+	{name: "ips", pseudonymize: true},
+	{name: "users", pseudonymize: true},
+	{name: "logs", keep: true},
+	{name: "netmap", keep: true},
+	{name: "prefs", keep: true},
+}
+
+func bugReportCategoryNames() []string {
+	var names []string
+	for _, c := range bugReportCategories {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// bugReportFile is a file in a bugreport bundle.
+type bugReportFile struct {
+	name     string
+	category string // or empty if it can't be excluded
+	data     []byte
+}
+
+func runDebugBugReport(ctx context.Context, args []string) error {
+	var note string
+	switch len(args) {
+	case 0:
+	case 1:
+		note = args[0]
+	default:
+		return errors.New("usage: tailscale debug bugreport [--redact] [--exclude=<category>,...] [--out=<file>] [note]")
+	}
+	exclude := debugBugReportArgs.exclude
+
+	st, err := localClient.Status(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	var files []bugReportFile
+	addJSON := func(name, category string, v any) {
+		j, err := json.MarshalIndent(v, "", "\t")
+		if err != nil {
+			fmt.Fprintf(Stderr, "warning: %s: %v\n", name, err)
+			return
+		}
+		files = append(files, bugReportFile{name, category, append(j, '\n')})
+	}
+	addJSON("status.json", "", st)
+	if prefs, err := localClient.GetPrefs(ctx); err != nil {
+		fmt.Fprintf(Stderr, "warning: getting prefs: %v\n", err)
+	} else {
+		addJSON("prefs.json", "prefs", prefs)
+	}
+	if nm, err := localClient.DebugResultJSON(ctx, "current-netmap"); err != nil {
+		fmt.Fprintf(Stderr, "warning: getting netmap: %v\n", err)
+	} else {
+		addJSON("netmap.json", "netmap", nm)
+	}
+	if d := debugBugReportArgs.logsFor; d > 0 {
+		fmt.Fprintf(Stderr, "Recording tailscaled's logs for %v...\n", d)
+		logs, err := recordDaemonLogs(ctx, d)
+		if err != nil {
+			fmt.Fprintf(Stderr, "warning: recording logs: %v\n", err)
+		} else {
+			files = append(files, bugReportFile{"tailscaled.log", "logs", logs})
+		}
+	}
+
+	redacted := debugBugReportArgs.redact || exclude != nil
+	if redacted {
+		key := []byte(debugBugReportArgs.pseudonymKey)
+		if len(key) == 0 {
+			key = make([]byte, 32)
+			rand.Read(key)
+		}
+		r := newBugReportRedactor(key)
+		r.addNamesFromStatus(st)
+		if exclude == nil {
+			exclude = promptBugReportExclude(r, files)
+		}
+		r.setExcluded(exclude)
+		files = slices.DeleteFunc(files, func(f bugReportFile) bool {
+			return exclude[f.category]
+		})
+		for i := range files {
+			files[i].data = r.redact(files[i].data)
+		}
+		note = string(r.redact([]byte(note)))
+	}
+
+	var summary bytes.Buffer
+	fmt.Fprintf(&summary, "Tailscale bugreport bundle\n\n")
+	fmt.Fprintf(&summary, "Time: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&summary, "CLI version: %s\n", version.Long())
+	if note != "" {
+		fmt.Fprintf(&summary, "Note: %s\n", note)
+	}
+	if redacted {
+		var ex []string
+		for _, c := range bugReportCategories {
+			if exclude[c.name] {
+				ex = append(ex, c.name)
+			}
+		}
+		fmt.Fprintf(&summary, "Excluded: %s\n", cmp.Or(strings.Join(ex, ", "), "none"))
+	}
+	files = append([]bugReportFile{{name: "bugreport.txt", data: summary.Bytes()}}, files...)
+
+	out := debugBugReportArgs.out
+	if out == "" {
+		out = "tailscale-bugreport-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	}
+	if err := writeBugReportBundle(out, files); err != nil {
+		return err
+	}
+	printf("Saved bugreport bundle to %s\n", out)
+	return nil
+}
+
+// parseBugReportExclude parses the value of --exclude.
+func parseBugReportExclude(s string) (map[string]bool, error) {
+	ret := map[string]bool{}
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(bugReportCategoryNames(), name) {
+			return nil, fmt.Errorf("unknown category %q; want one of %s", name, strings.Join(bugReportCategoryNames(), ", "))
+		}
+		ret[name] = true
+	}
+	return ret, nil
+}
+
+// promptBugReportExclude summarizes the data in files by category and asks
+// which categories to exclude.
+func promptBugReportExclude(r *bugReportRedactor, files []bugReportFile) map[string]bool {
+	var all [][]byte
+	for _, f := range files {
+		all = append(all, f.data)
+	}
+	ips := r.ipsIn(all...)
+	names, users := r.namesIn(all...)
+
+	// describe returns a description of the data in c, or the empty string
+	// if there's none.
+	describe := func(c bugReportCategory) string {
+		values := map[string][]string{"hostnames": names, "ips": ips, "users": users}
+		if c.pseudonymize {
+			vals := values[c.name]
+			if len(vals) == 0 {
+				return ""
+			}
+			return fmt.Sprintf("%d distinct, such as %s", len(vals), examples(vals))
+		}
+		for _, f := range files {
+			if f.category != c.name {
+				continue
+			}
+			if c.name == "logs" {
+				return fmt.Sprintf("%s, %d lines", f.name, bytes.Count(f.data, []byte("\n")))
+			}
+			return fmt.Sprintf("%s, %d bytes", f.name, len(f.data))
+		}
+		return ""
+	}
+
+	outln("The bundle contains:")
+	outln()
+	tw := tabwriter.NewWriter(Stdout, 0, 0, 2, ' ', 0)
+	var present []bugReportCategory
+	for _, c := range bugReportCategories {
+		desc := describe(c)
+		if desc == "" {
+			continue
+		}
+		present = append(present, c)
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, desc)
+	}
+	tw.Flush()
+	outln()
+	outln("Excluded hostnames, IP addresses and user names are replaced with pseudonyms.")
+	outln()
+
+	exclude := map[string]bool{}
+	for _, c := range present {
+		q := fmt.Sprintf("Include %s?", c.name)
+		if c.pseudonymize {
+			q = fmt.Sprintf("Keep %s unredacted?", c.name)
+		}
+		if !prompt.YesNo(q, c.keep) {
+			exclude[c.name] = true
+		}
+	}
+	return exclude
+}
+
+// examples returns the first few of vals, for display.
+func examples(vals []string) string {
+	const max = 3
+	if len(vals) > max {
+		return strings.Join(vals[:max], ", ") + ", ..."
+	}
+	return strings.Join(vals, ", ")
+}
+
+// recordDaemonLogs returns tailscaled's logs from the next d.
+func recordDaemonLogs(ctx context.Context, d time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	logs, err := localClient.TailDaemonLogs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	dec := json.NewDecoder(logs)
+	for {
+		var line struct {
+			Text string `json:"text"`
+			Time string `json:"client_time"`
+		}
+		if err := dec.Decode(&line); err != nil {
+			if ctx.Err() != nil {
+				return buf.Bytes(), nil
+			}
+			return nil, err
+		}
+		if text := strings.TrimSpace(line.Text); text != "" {
+			fmt.Fprintf(&buf, "%s %s\n", line.Time, text)
+		}
+	}
+}
+
+// writeBugReportBundle writes files to a new .tar.gz file at path.
+func writeBugReportBundle(path string, files []bugReportFile) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    f.name,
+			Mode:    0600,
+			Size:    int64(len(f.data)),
+			ModTime: now,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// bugReportRedactor replaces the hostnames, IP addresses and user names in a
+// bugreport bundle with pseudonyms derived from a key, so that the same value
+// always gets the same pseudonym.
+type bugReportRedactor struct {
+	key []byte
+
+	// names maps the lowercased hostnames and user names known from the
+	// status to their pseudonyms' prefix: "host", "tailnet" or "user".
+	names map[string]string
+	re    *regexp.Regexp // matches the names and IPs to redact, or nil
+}
+
+func newBugReportRedactor(key []byte) *bugReportRedactor {
+	return &bugReportRedactor{key: key, names: map[string]string{}}
+}
+
+// addNamesFromStatus learns the hostnames and user names to redact from st.
+func (r *bugReportRedactor) addNamesFromStatus(st *ipnstate.Status) {
+	add := func(name, kind string) {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		// Skip names too short or common to be replaced in logs.
+		if len(name) < 2 || name == "localhost" {
+			return
+		}
+		if _, ok := r.names[name]; !ok {
+			r.names[name] = kind
+		}
+	}
+	if t := st.CurrentTailnet; t != nil {
+		add(t.MagicDNSSuffix, "tailnet")
+		add(t.Name, "tailnet")
+	}
+	addPeer := func(ps *ipnstate.PeerStatus) {
+		if ps == nil {
+			return
+		}
+		// MagicDNS names are redacted label by label, as the host
+		// followed by the tailnet's MagicDNS suffix, so that they
+		// correlate with both.
+		host, _, _ := strings.Cut(ps.DNSName, ".")
+		add(host, "host")
+		add(ps.HostName, "host")
+	}
+	addPeer(st.Self)
+	for _, ps := range st.Peer {
+		addPeer(ps)
+	}
+	for _, u := range st.User {
+		add(u.LoginName, "user")
+		add(u.DisplayName, "user")
+	}
+}
+
+// ipv6Pattern and ipv4Pattern match candidate IPv6 and IPv4 addresses, to be
+// checked with netip.ParseAddr. IPv6 comes first so that IPv4-mapped IPv6
+// addresses are matched as a whole.
+const (
+	ipv6Pattern = `(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}(?:\.[0-9]{1,3}){0,3}`
+	ipv4Pattern = `\b[0-9]{1,3}(?:\.[0-9]{1,3}){3}\b`
+)
+
+// setExcluded sets which of the "hostnames", "ips" and "users" categories
+// are to be redacted.
+func (r *bugReportRedactor) setExcluded(exclude map[string]bool) {
+	kinds := map[string]bool{
+		"host":    exclude["hostnames"],
+		"tailnet": exclude["hostnames"],
+		"user":    exclude["users"],
+	}
+	r.re = r.compile(kinds, exclude["ips"])
+}
+
+// compile returns a regexp matching the names of the given kinds and, if
+// ips, IP addresses. Longer names come first, so that the longest name is
+// matched where names overlap.
+func (r *bugReportRedactor) compile(kinds map[string]bool, ips bool) *regexp.Regexp {
+	var names []string
+	for name, kind := range r.names {
+		if kinds[kind] {
+			names = append(names, name)
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b))
+	})
+	var alts []string
+	if ips {
+		alts = append(alts, ipv6Pattern, ipv4Pattern)
+	}
+	for _, name := range names {
+		alts = append(alts, regexp.QuoteMeta(name))
+	}
+	if len(alts) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(alts, "|"))
+}
+
+// matches returns the locations of the matches of re in b, leaving out
+// names that are only part of a word. (The regexp's \b is ASCII-only, which
+// doesn't do for user names.)
+func (r *bugReportRedactor) matches(re *regexp.Regexp, b []byte) [][]int {
+	locs := re.FindAllIndex(b, -1)
+	return slices.DeleteFunc(locs, func(loc []int) bool {
+		if _, ok := r.names[strings.ToLower(string(b[loc[0]:loc[1]]))]; !ok {
+			return false
+		}
+		before, _ := utf8.DecodeLastRune(b[:loc[0]])
+		after, _ := utf8.DecodeRune(b[loc[1]:])
+		return isWordRune(before) || isWordRune(after)
+	})
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// redact returns b with its excluded values replaced with pseudonyms.
+func (r *bugReportRedactor) redact(b []byte) []byte {
+	if r.re == nil {
+		return b
+	}
+	var out []byte
+	last := 0
+	for _, loc := range r.matches(r.re, b) {
+		out = append(out, b[last:loc[0]]...)
+		last = loc[1]
+		m := string(b[loc[0]:loc[1]])
+		if kind, ok := r.names[strings.ToLower(m)]; ok {
+			out = append(out, r.pseudonym(kind, strings.ToLower(m))...)
+		} else if ip, err := netip.ParseAddr(m); err == nil {
+			out = append(out, r.pseudoIP(ip).String()...)
+		} else {
+			out = append(out, m...)
+		}
+	}
+	return append(out, b[last:]...)
+}
+
+// hash returns the keyed hash of val of the given kind.
+func (r *bugReportRedactor) hash(kind, val string) []byte {
+	h := hmac.New(sha256.New, r.key)
+	fmt.Fprintf(h, "%s\x00%s", kind, val)
+	return h.Sum(nil)
+}
+
+// pseudonym returns the pseudonym of the name of the given kind, such as
+// "host-1a2b3c4d".
+func (r *bugReportRedactor) pseudonym(kind, name string) string {
+	return kind + "-" + hex.EncodeToString(r.hash(kind, name)[:4])
+}
+
+// pseudoIP returns the pseudonym of ip: an address in 240.0.0.0/4 for IPv4,
+// or in 2001:db8::/32 for IPv6. IPv4-mapped IPv6 addresses map to the
+// IPv4-mapped pseudonym of their IPv4 address. Loopback, multicast and
+// unspecified addresses and Tailscale's service IPs aren't identifying, and
+// are returned as is.
+func (r *bugReportRedactor) pseudoIP(ip netip.Addr) netip.Addr {
+	ip = ip.WithZone("")
+	if ip.Is4In6() {
+		return netip.AddrFrom16(r.pseudoIP(ip.Unmap()).As16())
+	}
+	if !isIdentifyingIP(ip) {
+		return ip
+	}
+	h := r.hash("ip", ip.String())
+	if ip.Is4() {
+		return netip.AddrFrom4([4]byte{0xf0 | h[0]&0x0f, h[1], h[2], h[3]})
+	}
+	a := [16]byte{0x20, 0x01, 0x0d, 0xb8}
+	copy(a[4:], h)
+	return netip.AddrFrom16(a)
+}
+
+func isIdentifyingIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return !ip.IsLoopback() && !ip.IsMulticast() && !ip.IsUnspecified() &&
+		ip != tsaddr.TailscaleServiceIP() && ip != tsaddr.TailscaleServiceIPv6()
+}
+
+// ipsIn returns the distinct identifying IP addresses in bs, sorted.
+func (r *bugReportRedactor) ipsIn(bs ...[]byte) []string {
+	re := r.compile(nil, true)
+	var ips []netip.Addr
+	for _, b := range bs {
+		for _, loc := range re.FindAllIndex(b, -1) {
+			if ip, err := netip.ParseAddr(string(b[loc[0]:loc[1]])); err == nil && isIdentifyingIP(ip) {
+				ips = append(ips, ip.Unmap().WithZone(""))
+			}
+		}
+	}
+	slices.SortFunc(ips, netip.Addr.Compare)
+	var ret []string
+	for _, ip := range slices.Compact(ips) {
+		ret = append(ret, ip.String())
+	}
+	return ret
+}
+
+// namesIn returns the distinct known hostnames (including tailnet names) and
+// user names in bs, sorted.
+func (r *bugReportRedactor) namesIn(bs ...[]byte) (hostnames, users []string) {
+	re := r.compile(map[string]bool{"host": true, "tailnet": true, "user": true}, false)
+	if re == nil {
+		return nil, nil
+	}
+	for _, b := range bs {
+		for _, loc := range r.matches(re, b) {
+			name := strings.ToLower(string(b[loc[0]:loc[1]]))
+			if r.names[name] == "user" {
+				users = append(users, name)
+			} else {
+				hostnames = append(hostnames, name)
+			}
+		}
+	}
+	slices.Sort(hostnames)
+	slices.Sort(users)
+	return slices.Compact(hostnames), slices.Compact(users)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_debug
+
+package cli
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+func TestBugReportRedactor(t *testing.T) {
+	st := &ipnstate.Status{
+		CurrentTailnet: &ipnstate.TailnetStatus{
+			Name:           "example.com",
+			MagicDNSSuffix: "tail1234.ts.net",
+		},
+		Self: &ipnstate.PeerStatus{
+			HostName: "Laptop",
+			DNSName:  "laptop.tail1234.ts.net.",
+		},
+		Peer: map[key.NodePublic]*ipnstate.PeerStatus{
+			key.NewNode().Public(): {
+				HostName: "db",
+				DNSName:  "db-1.tail1234.ts.net.",
+			},
+		},
+		User: map[tailcfg.UserID]tailcfg.UserProfile{
+			1: {LoginName: "josé@example.com", DisplayName: "José"},
+		},
+	}
+	const in = `laptop.tail1234.ts.net (LAPTOP) dialed db-1 at 100.64.0.2:41641 via [fd7a:115c:a1e0::2]:41641
+peer ::ffff:192.0.2.1 and 192.0.2.1; dns 100.100.100.100, lo 127.0.0.1, time 12:34:56
+login josé@example.com (José), not Josého or dbx or mydb`
+
+	newRedactor := func(key string) *bugReportRedactor {
+		r := newBugReportRedactor([]byte(key))
+		r.addNamesFromStatus(st)
+		return r
+	}
+	r := newRedactor("k1")
+
+	if got, want := r.ipsIn([]byte(in)), []string{"100.64.0.2", "192.0.2.1", "fd7a:115c:a1e0::2"}; !slices.Equal(got, want) {
+		t.Errorf("ipsIn = %q; want %q", got, want)
+	}
+	hosts, users := r.namesIn([]byte(in))
+	if want := []string{"db-1", "laptop", "tail1234.ts.net"}; !slices.Equal(hosts, want) {
+		t.Errorf("namesIn hostnames = %q; want %q", hosts, want)
+	}
+	if want := []string{"josé", "josé@example.com"}; !slices.Equal(users, want) {
+		t.Errorf("namesIn users = %q; want %q", users, want)
+	}
+
+	r.setExcluded(map[string]bool{})
+	if got := string(r.redact([]byte(in))); got != in {
+		t.Errorf("with nothing excluded, redact changed input to %q", got)
+	}
+
+	r.setExcluded(map[string]bool{"hostnames": true, "ips": true, "users": true})
+	got := string(r.redact([]byte(in)))
+	for _, leak := range []string{"laptop", "LAPTOP", "tail1234", "db-1", "100.64.0.2", "192.0.2.1", "fd7a:115c:a1e0::2", "josé@", "(José)"} {
+		if strings.Contains(got, leak) {
+			t.Errorf("redacted output contains %q:\n%s", leak, got)
+		}
+	}
+	for _, keep := range []string{"100.100.100.100", "127.0.0.1", "12:34:56", "Josého", "dbx", "mydb", ":41641"} {
+		if !strings.Contains(got, keep) {
+			t.Errorf("redacted output is missing %q:\n%s", keep, got)
+		}
+	}
+
+	// Values are consistently pseudonymized.
+	p4 := r.pseudoIP(netip.MustParseAddr("192.0.2.1"))
+	if !strings.Contains(got, "::ffff:"+p4.String()+" and "+p4.String()+";") {
+		t.Errorf("IPv4 and IPv4-mapped addresses not given the same pseudonym %v:\n%s", p4, got)
+	}
+	if !netip.MustParsePrefix("240.0.0.0/4").Contains(p4) {
+		t.Errorf("IPv4 pseudonym %v not in 240.0.0.0/4", p4)
+	}
+	if p := r.pseudoIP(netip.MustParseAddr("fd7a:115c:a1e0::2")); !netip.MustParsePrefix("2001:db8::/32").Contains(p) {
+		t.Errorf("IPv6 pseudonym %v not in 2001:db8::/32", p)
+	}
+	h, tn := r.pseudonym("host", "laptop"), r.pseudonym("tailnet", "tail1234.ts.net")
+	if !strings.HasPrefix(got, h+"."+tn+" ("+h+")") {
+		t.Errorf("hostname pseudonym %q and tailnet pseudonym %q not used consistently:\n%s", h, tn, got)
+	}
+
+	r2 := newRedactor("k1")
+	r2.setExcluded(map[string]bool{"hostnames": true, "ips": true, "users": true})
+	if got2 := string(r2.redact([]byte(in))); got2 != got {
+		t.Errorf("same key gave different output:\n%s\n%s", got, got2)
+	}
+	r3 := newRedactor("k2")
+	r3.setExcluded(map[string]bool{"hostnames": true, "ips": true, "users": true})
+	if got3 := string(r3.redact([]byte(in))); got3 == got {
+		t.Errorf("different keys gave the same output:\n%s", got)
+	}
+}
+
+func TestParseBugReportExclude(t *testing.T) {
+	got, err := parseBugReportExclude("ips, logs,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got["ips"] || !got["logs"] {
+		t.Errorf("got %v; want ips and logs", got)
+	}
+	if got, err := parseBugReportExclude(""); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("empty: got %v, %v; want empty non-nil map", got, err)
+	}
+	if _, err := parseBugReportExclude("ips,bogus"); err == nil {
+		t.Error("unknown category: got nil error")
+	}
+}
@@ -24,12 +24,13 @@ func init() {
 func mkDebugCaptureCmd() *ffcli.Command {
 	return &ffcli.Command{
 		Name:       "capture",
-		ShortUsage: "tailscale debug capture",
+		ShortUsage: "tailscale debug capture [--dropped]",
 		Exec:       runCapture,
 		ShortHelp:  "Stream pcaps for debugging",
 		FlagSet: (func() *flag.FlagSet {
 			fs := newFlagSet("capture")
 			fs.StringVar(&captureArgs.outFile, "o", "", "path to stream the pcap (or - for stdout), leave empty to start wireshark")
+			fs.BoolVar(&captureArgs.dropped, "dropped", false, "capture only packets dropped by the packet filter, as pcapng with the reason for each drop as its comment")
 			return fs
 		})(),
 	}
@@ -37,10 +38,15 @@ func mkDebugCaptureCmd() *ffcli.Command {
 
 var captureArgs struct {
 	outFile string
+	dropped bool
 }
 
 func runCapture(ctx context.Context, args []string) error {
-	stream, err := localClient.StreamDebugCapture(ctx)
+	streamCapture := localClient.StreamDebugCapture
+	if captureArgs.dropped {
+		streamCapture = localClient.StreamDebugCaptureDropped
+	}
+	stream, err := streamCapture(ctx)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,88 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/client/tailscale/apitype"
+)
+
+var debugDaemonEnvArgs struct {
+	all  bool
+	json bool
+}
+
+func mkDebugDaemonEnvCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "daemon-env",
+		ShortUsage: "tailscale debug daemon-env [--all] [--json] [<NAME>=<value>]",
+		Exec:       runDebugDaemonEnv,
+		ShortHelp:  "Show (or change) the envknobs and control knobs in effect in tailscaled",
+		LongHelp: `Prints the environment knobs and control knobs currently in effect in
+tailscaled, where each value came from, and whether changing it requires
+restarting tailscaled.
+
+Given an argument of the form NAME=value, first sets the envknob NAME to
+value (or unsets it if value is empty) until tailscaled restarts. Only
+registered TS_DEBUG_* knobs, which take effect immediately, can be set.`,
+		FlagSet: (func() *flag.FlagSet {
+			fs := newFlagSet("daemon-env")
+			fs.BoolVar(&debugDaemonEnvArgs.all, "all", false, "also show registered envknobs that are not set")
+			fs.BoolVar(&debugDaemonEnvArgs.json, "json", false, "output in JSON format")
+			return fs
+		})(),
+	}
+}
+
+func runDebugDaemonEnv(ctx context.Context, args []string) error {
+	var (
+		knobs []apitype.DebugKnob
+		err   error
+	)
+	switch len(args) {
+	case 0:
+		knobs, err = localClient.DebugEnv(ctx, debugDaemonEnvArgs.all)
+	case 1:
+		name, value, ok := strings.Cut(args[0], "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid argument %q; want NAME=value", args[0])
+		}
+		if _, err = localClient.DebugSetEnv(ctx, name, value); err != nil {
+			return err
+		}
+		knobs, err = localClient.DebugEnv(ctx, debugDaemonEnvArgs.all)
+	default:
+		return errors.New("too many arguments")
+	}
+	if err != nil {
+		return err
+	}
+
+	if debugDaemonEnvArgs.json {
+		e := json.NewEncoder(Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(knobs)
+	}
+	tw := tabwriter.NewWriter(Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE\tNOTES")
+	for _, k := range knobs {
+		var notes []string
+		if k.RestartRequired {
+			notes = append(notes, "restart required")
+		}
+		if k.Settable {
+			notes = append(notes, "settable")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", k.Name, k.Value, k.Source, strings.Join(notes, ", "))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,172 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/types/views"
+)
+
+var derpFailoverDrillArgs struct {
+	tag     string
+	timeout time.Duration
+	json    bool
+}
+
+func mkDebugDERPFailoverDrillCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "derp-failover-drill",
+		ShortUsage: "tailscale debug derp-failover-drill [--tag=<tag>] [--timeout=<duration>] [<hostname-or-IP>...]",
+		Exec:       runDebugDERPFailoverDrill,
+		ShortHelp:  "Test how connectivity recovers if the home DERP region goes down",
+		LongHelp: `Makes this node's home DERP region unavailable, as if it were down, and
+measures how long it takes to choose a new home region and to reach each of
+the given peers, and all peers with the given tag, again. Then it makes the
+old home region available again and prints a report.
+
+This disrupts this node's connectivity while it runs, up to --timeout. Peers
+whose home is the same region can only be reached directly or by peer relay
+during the drill.`,
+		FlagSet: (func() *flag.FlagSet {
+			fs := newFlagSet("derp-failover-drill")
+			fs.StringVar(&derpFailoverDrillArgs.tag, "tag", "", `test all peers with this ACL tag (e.g. "tag:server")`)
+			fs.DurationVar(&derpFailoverDrillArgs.timeout, "timeout", time.Minute, "how long the home DERP region may be unavailable at most")
+			fs.BoolVar(&derpFailoverDrillArgs.json, "json", false, "output in JSON format")
+			return fs
+		})(),
+	}
+}
+
+func runDebugDERPFailoverDrill(ctx context.Context, args []string) error {
+	st, err := localClient.Status(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	description, ok := isRunningOrStarting(st)
+	if !ok {
+		printf("%s\n", description)
+		os.Exit(1)
+	}
+
+	var targets []netip.Addr
+	if tag := derpFailoverDrillArgs.tag; tag != "" {
+		for _, ps := range st.Peer {
+			if ps.Tags == nil || !views.SliceContains(*ps.Tags, tag) {
+				continue
+			}
+			if len(ps.TailscaleIPs) > 0 {
+				targets = append(targets, ps.TailscaleIPs[0])
+			}
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("no peers with tag %q", tag)
+		}
+	}
+	for _, arg := range args {
+		ipStr, self, err := tailscaleIPFromArg(ctx, arg)
+		if err != nil {
+			return err
+		}
+		if self {
+			continue
+		}
+		ip, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			return fmt.Errorf("invalid IP %q for %q", ipStr, arg)
+		}
+		targets = append(targets, ip)
+	}
+
+	if !derpFailoverDrillArgs.json {
+		printf("Making the home DERP region unavailable for up to %v...\n", derpFailoverDrillArgs.timeout)
+	}
+	res, err := localClient.DebugDERPFailoverDrill(ctx, targets, derpFailoverDrillArgs.timeout)
+	if err != nil {
+		return err
+	}
+	if derpFailoverDrillArgs.json {
+		e := json.NewEncoder(Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(res)
+	}
+	printDERPFailoverDrill(st, res)
+	return nil
+}
+
+// printDERPFailoverDrill prints res as a summary of the home region failover
+// followed by a table with a row per peer.
+func printDERPFailoverDrill(st *ipnstate.Status, res *ipnstate.DERPFailoverDrill) {
+	names := map[netip.Addr]string{}
+	for _, ps := range st.Peer {
+		for _, ip := range ps.TailscaleIPs {
+			names[ip] = dnsOrQuoteHostname(st, ps)
+		}
+	}
+	region := func(id int, code string) string {
+		if code == "" {
+			return fmt.Sprint(id)
+		}
+		return fmt.Sprintf("%d (%s)", id, code)
+	}
+
+	printf("Drill ran for %.1fs.\n", res.DurationSeconds)
+	printf("Old home DERP region: %s\n", region(res.OldHomeRegionID, res.OldHomeRegionCode))
+	if res.NewHomeRegionID != 0 {
+		printf("New home DERP region: %s, after %.1fs\n", region(res.NewHomeRegionID, res.NewHomeRegionCode), res.HomeFailoverSeconds)
+	} else {
+		printf("New home DERP region: none chosen\n")
+	}
+	if len(res.Peers) == 0 {
+		return
+	}
+	outln()
+
+	tw := tabwriter.NewWriter(Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PEER\tBEFORE\tDURING\tRECOVERED AFTER")
+	var errs []string
+	for _, p := range res.Peers {
+		name := p.IP.String()
+		if n, ok := names[p.IP]; ok {
+			name = n
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s", name, drillPing(p.Before), drillPing(p.After))
+		if p.Recovered {
+			fmt.Fprintf(tw, "\t%.1fs\n", p.RecoverySeconds)
+		} else {
+			fmt.Fprint(tw, "\tnot recovered\n")
+			if p.After != nil && p.After.Err != "" {
+				errs = append(errs, fmt.Sprintf("%s: %s", name, p.After.Err))
+			}
+		}
+	}
+	tw.Flush()
+	if len(errs) > 0 {
+		outln()
+		for _, e := range errs {
+			outln(e)
+		}
+	}
+}
+
+// drillPing returns a short description of pr, a ping during a DERP failover
+// drill.
+func drillPing(pr *ipnstate.PingResult) string {
+	switch {
+	case pr == nil:
+		return "-"
+	case pr.Err != "":
+		return "ERR"
+	}
+	return fmt.Sprintf("%.1fms %s", pr.LatencySeconds*1000, pingPath(pr))
+}
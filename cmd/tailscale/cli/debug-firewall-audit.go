@@ -0,0 +1,65 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// firewallMetricPrefix is the name prefix of the user metrics that
+// util/linuxfw registers for tailscaled's firewall rule operations.
+const firewallMetricPrefix = "tailscaled_firewall_"
+
+func mkDebugFirewallAuditCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "firewall-audit",
+		ShortUsage: "tailscale debug firewall-audit",
+		Exec:       runDebugFirewallAudit,
+		ShortHelp:  "Print counters of tailscaled's firewall rule operations",
+		LongHelp: `Prints the metrics tailscaled keeps about the firewall (iptables or
+nftables) rules it manages on Linux: rule add and delete operations by rule
+kind and result, failures by kernel error code, and when rules were last
+changed successfully.`,
+	}
+}
+
+func runDebugFirewallAudit(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	out, err := localClient.UserMetrics(ctx)
+	if err != nil {
+		return err
+	}
+	var found bool
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, firewallMetricPrefix) {
+			continue
+		}
+		found = true
+		if name, val, ok := strings.Cut(line, " "); ok && strings.HasPrefix(name, firewallMetricPrefix+"last_sync_timestamp_seconds") {
+			if sec, err := strconv.ParseInt(val, 10, 64); err == nil && sec > 0 {
+				line += " # " + time.Unix(sec, 0).Format(time.RFC3339)
+			}
+		}
+		outln(line)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("no firewall metrics; tailscaled only manages firewall rules on Linux")
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"text/tabwriter"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/types/views"
+)
+
+var latencyMatrixArgs struct {
+	tag  string
+	mesh bool
+	json bool
+}
+
+func mkDebugLatencyMatrixCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "latency-matrix",
+		ShortUsage: "tailscale debug latency-matrix [--tag=<tag>] [--mesh] [<hostname-or-IP>...]",
+		Exec:       runDebugLatencyMatrix,
+		ShortHelp:  "Test reachability and latency to (and optionally between) a set of peers",
+		LongHelp: `Disco pings each of the given peers, and all peers with the given tag,
+and prints a matrix of the results.
+
+With --mesh, each peer is also asked to ping the others over its peerapi. This
+requires the peer to grant this node debug access.`,
+		FlagSet: (func() *flag.FlagSet {
+			fs := newFlagSet("latency-matrix")
+			fs.StringVar(&latencyMatrixArgs.tag, "tag", "", `test all peers with this ACL tag (e.g. "tag:server")`)
+			fs.BoolVar(&latencyMatrixArgs.mesh, "mesh", false, "also ask each peer to test the other peers")
+			fs.BoolVar(&latencyMatrixArgs.json, "json", false, "output in JSON format")
+			return fs
+		})(),
+	}
+}
+
+func runDebugLatencyMatrix(ctx context.Context, args []string) error {
+	st, err := localClient.Status(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	description, ok := isRunningOrStarting(st)
+	if !ok {
+		printf("%s\n", description)
+		os.Exit(1)
+	}
+
+	var targets []netip.Addr
+	if tag := latencyMatrixArgs.tag; tag != "" {
+		for _, ps := range st.Peer {
+			if ps.Tags == nil || !views.SliceContains(*ps.Tags, tag) {
+				continue
+			}
+			if len(ps.TailscaleIPs) > 0 {
+				targets = append(targets, ps.TailscaleIPs[0])
+			}
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("no peers with tag %q", tag)
+		}
+	}
+	for _, arg := range args {
+		ipStr, self, err := tailscaleIPFromArg(ctx, arg)
+		if err != nil {
+			return err
+		}
+		if self {
+			continue
+		}
+		ip, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			return fmt.Errorf("invalid IP %q for %q", ipStr, arg)
+		}
+		targets = append(targets, ip)
+	}
+	if len(targets) == 0 {
+		return errors.New("usage: tailscale debug latency-matrix [--tag=<tag>] [--mesh] [<hostname-or-IP>...]")
+	}
+
+	lm, err := localClient.DebugLatencyMatrix(ctx, targets, latencyMatrixArgs.mesh)
+	if err != nil {
+		return err
+	}
+	if latencyMatrixArgs.json {
+		e := json.NewEncoder(Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(lm)
+	}
+	printLatencyMatrix(st, lm)
+	return nil
+}
+
+// printLatencyMatrix prints lm as a table with a row per source node and a
+// column per destination node, followed by any errors.
+func printLatencyMatrix(st *ipnstate.Status, lm *ipnstate.LatencyMatrix) {
+	names := map[netip.Addr]string{}
+	addName := func(ps *ipnstate.PeerStatus) {
+		for _, ip := range ps.TailscaleIPs {
+			names[ip] = dnsOrQuoteHostname(st, ps)
+		}
+	}
+	if st.Self != nil {
+		addName(st.Self)
+	}
+	for _, ps := range st.Peer {
+		addName(ps)
+	}
+	name := func(ip netip.Addr) string {
+		if n, ok := names[ip]; ok {
+			return n
+		}
+		return ip.String()
+	}
+
+	type pair struct{ from, to netip.Addr }
+	results := map[pair]*ipnstate.PingResult{}
+	for _, r := range lm.Results {
+		results[pair{r.From, r.To}] = r.Ping
+	}
+
+	tw := tabwriter.NewWriter(Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "FROM \\ TO")
+	for _, to := range lm.Nodes[1:] {
+		fmt.Fprintf(tw, "\t%s", name(to))
+	}
+	fmt.Fprintln(tw)
+	var errs []string
+	for _, from := range lm.Nodes {
+		fmt.Fprint(tw, name(from))
+		for _, to := range lm.Nodes[1:] {
+			pr, ok := results[pair{from, to}]
+			switch {
+			case from == to:
+				fmt.Fprint(tw, "\t")
+			case !ok || pr == nil:
+				fmt.Fprint(tw, "\t-")
+			case pr.Err != "":
+				fmt.Fprint(tw, "\tERR")
+				errs = append(errs, fmt.Sprintf("%s -> %s: %s", name(from), name(to), pr.Err))
+			default:
+				fmt.Fprintf(tw, "\t%.1fms %s", pr.LatencySeconds*1000, pingPath(pr))
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	if len(errs) > 0 {
+		outln()
+		for _, e := range errs {
+			outln(e)
+		}
+	}
+}
+
+// pingPath returns a short description of the path a successful ping took.
+func pingPath(pr *ipnstate.PingResult) string {
+	switch {
+	case pr.Endpoint != "":
+		return "direct"
+	case pr.PeerRelay != "":
+		return "relay"
+	case pr.DERPRegionCode != "":
+		return "derp(" + pr.DERPRegionCode + ")"
+	}
+	return "?"
+}
@@ -0,0 +1,60 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bytes"
+	"io"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tstest"
+	"tailscale.com/types/key"
+)
+
+func TestPrintLatencyMatrix(t *testing.T) {
+	var stdout bytes.Buffer
+	tstest.Replace[io.Writer](t, &Stdout, &stdout)
+
+	self := netip.MustParseAddr("100.64.0.1")
+	a := netip.MustParseAddr("100.64.0.2")
+	b := netip.MustParseAddr("100.64.0.3")
+	c := netip.MustParseAddr("100.64.0.4") // not in status
+	st := &ipnstate.Status{
+		MagicDNSSuffix: "example.ts.net",
+		Self:           &ipnstate.PeerStatus{DNSName: "self.example.ts.net.", TailscaleIPs: []netip.Addr{self}},
+		Peer: map[key.NodePublic]*ipnstate.PeerStatus{
+			key.NewNode().Public(): {DNSName: "a.example.ts.net.", TailscaleIPs: []netip.Addr{a}},
+			key.NewNode().Public(): {DNSName: "b.example.ts.net.", TailscaleIPs: []netip.Addr{b}},
+		},
+	}
+	lm := &ipnstate.LatencyMatrix{
+		Nodes: []netip.Addr{self, a, b, c},
+		Results: []ipnstate.LatencyMatrixResult{
+			{From: self, To: a, Ping: &ipnstate.PingResult{LatencySeconds: 0.0012, Endpoint: "1.2.3.4:41641"}},
+			{From: self, To: b, Ping: &ipnstate.PingResult{LatencySeconds: 0.025, DERPRegionCode: "nyc"}},
+			{From: self, To: c, Ping: &ipnstate.PingResult{Err: "timeout"}},
+			{From: a, To: b, Ping: &ipnstate.PingResult{LatencySeconds: 0.0035, PeerRelay: "100.64.0.5:7777"}},
+			{From: b, To: a, Ping: &ipnstate.PingResult{Err: "denied"}},
+		},
+	}
+	printLatencyMatrix(st, lm)
+
+	want := strings.Join([]string{
+		`FROM \ TO   a             b                 100.64.0.4`,
+		`self        1.2ms direct  25.0ms derp(nyc)  ERR`,
+		`a                         3.5ms relay       -`,
+		`b           ERR                             -`,
+		`100.64.0.4  -             -                 `,
+		``,
+		`self -> 100.64.0.4: timeout`,
+		`b -> a: denied`,
+		``,
+	}, "\n")
+	if got := stdout.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
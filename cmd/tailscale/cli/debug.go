@@ -55,6 +55,7 @@
 	debugPortmapCmd          func() *ffcli.Command // or nil
 	debugPeerRelayCmd        func() *ffcli.Command // or nil
 	debugClearNetmapCacheCmd func() *ffcli.Command // or nil
+	debugBugReportCmd        func() *ffcli.Command // or nil
 )
 
 func debugCmd() *ffcli.Command {
@@ -250,6 +251,7 @@ func debugCmd() *ffcli.Command {
 				Exec:       debugControlKnobs,
 				ShortHelp:  "See current control knobs",
 			},
+			mkDebugDaemonEnvCmd(),
 			{
 				Name:       "prefs",
 				ShortUsage: "tailscale debug prefs",
@@ -337,12 +339,27 @@ func debugCmd() *ffcli.Command {
 			},
 			ccall(debugCaptureCmd),
 			ccall(debugPortmapCmd),
+			mkDebugFirewallAuditCmd(),
+			mkDebugLatencyMatrixCmd(),
+			mkDebugDERPFailoverDrillCmd(),
+			ccall(debugBugReportCmd),
 			{
 				Name:       "peer-endpoint-changes",
 				ShortUsage: "tailscale debug peer-endpoint-changes <hostname-or-IP>",
 				Exec:       runPeerEndpointChanges,
 				ShortHelp:  "Print debug information about a peer's endpoint changes",
 			},
+			{
+				Name:       "peer-paths",
+				ShortUsage: "tailscale debug peer-paths [hostname-or-IP]",
+				Exec:       runPeerPaths,
+				ShortHelp:  "Print the quality of the paths to a peer, or all peers",
+				LongHelp: strings.TrimSpace(`
+Print the quality of the paths to a peer, or all peers, as measured by disco
+pings: the loss and latency of each direct path, and how often the best path
+changed or fell back to DERP.
+`),
+			},
 			{
 				Name:       "dial-types",
 				ShortUsage: "tailscale debug dial-types <hostname-or-IP> <port>",
@@ -377,6 +394,12 @@ func debugCmd() *ffcli.Command {
 				ShortHelp:  "Print the current set of candidate peer relay servers",
 				Exec:       runPeerRelayServers,
 			},
+			{
+				Name:       "portmap-leases",
+				ShortUsage: "tailscale debug portmap-leases",
+				ShortHelp:  "Print the port mapping leases tailscaled currently holds",
+				Exec:       runPortMapLeases,
+			},
 			{
 				Name:       "test-risk",
 				ShortUsage: "tailscale debug test-risk",
@@ -1256,8 +1279,35 @@ func runPeerEndpointChanges(ctx context.Context, args []string) error {
 	if ip != hostOrIP {
 		log.Printf("lookup %q => %q", hostOrIP, ip)
 	}
+	return printLocalAPIJSON(ctx, "debug-peer-endpoint-changes?ip="+ip)
+}
+
+func runPeerPaths(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: tailscale debug peer-paths [hostname-or-IP]")
+	}
+	if len(args) == 0 {
+		return printLocalAPIJSON(ctx, "debug-peer-paths")
+	}
+	hostOrIP := args[0]
+	ip, self, err := tailscaleIPFromArg(ctx, hostOrIP)
+	if err != nil {
+		return err
+	}
+	if self {
+		printf("%v is local Tailscale IP\n", ip)
+		return nil
+	}
+	if ip != hostOrIP {
+		log.Printf("lookup %q => %q", hostOrIP, ip)
+	}
+	return printLocalAPIJSON(ctx, "debug-peer-paths?ip="+ip)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://local-tailscaled.sock/localapi/v0/debug-peer-endpoint-changes?ip="+ip, nil)
+// printLocalAPIJSON GETs the LocalAPI path and prints its JSON response,
+// indented.
+func printLocalAPIJSON(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://local-tailscaled.sock/localapi/v0/"+path, nil)
 	if err != nil {
 		return err
 	}
@@ -1272,6 +1322,9 @@ func runPeerEndpointChanges(ctx context.Context, args []string) error {
 	if err != nil {
 		return err
 	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", bytes.TrimSpace(body))
+	}
 
 	var dst bytes.Buffer
 	if err := json.Indent(&dst, body, "", "  "); err != nil {
@@ -1394,6 +1447,23 @@ func runPeerRelayServers(ctx context.Context, args []string) error {
 	return nil
 }
 
+func runPortMapLeases(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	v, err := localClient.DebugResultJSON(ctx, "portmap-leases")
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		outln("no port mapping leases")
+		return nil
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
 var testRiskArgs struct {
 	acceptedRisk string
 }
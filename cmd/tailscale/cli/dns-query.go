@@ -12,10 +12,12 @@
 	"net/netip"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"golang.org/x/net/dns/dnsmessage"
 	"tailscale.com/cmd/tailscale/cli/jsonoutput"
+	"tailscale.com/types/dnstype"
 )
 
 var dnsQueryArgs struct {
@@ -35,7 +37,11 @@
 a second argument after the name (e.g. AAAA, CNAME, MX, NS, PTR, SRV, TXT).
 
 The output also provides information about the resolver(s) used to resolve the
-query.
+query: whether it was answered by MagicDNS or forwarded, and if so by which
+route (a split DNS route, the default resolvers, or the host's resolvers) to
+which upstream resolvers, which of them answered, over what transport, and how
+long each took. Queries forwarded over "peerapi-doh" were resolved by the DNS
+proxy of an exit node or app connector.
 `),
 	FlagSet: (func() *flag.FlagSet {
 		fs := newFlagSet("query")
@@ -68,19 +74,23 @@ func runDNSQuery(ctx context.Context, args []string) error {
 		queryType = strings.ToUpper(args[1])
 	}
 
-	rawBytes, resolvers, err := localClient.QueryDNS(ctx, name, queryType)
+	res, err := localClient.QueryDNSTrace(ctx, name, queryType)
 	if err != nil {
 		return fmt.Errorf("failed to query DNS: %w", err)
 	}
+	rawBytes := res.Bytes
 
 	data := &jsonoutput.DNSQueryResult{
 		Name:      name,
 		QueryType: queryType,
 	}
 
-	for _, r := range resolvers {
+	for _, r := range res.Resolvers {
 		data.Resolvers = append(data.Resolvers, makeDNSResolverInfo(r))
 	}
+	if res.Trace != nil {
+		data.Route = makeDNSQueryRoute(res.Trace)
+	}
 
 	var p dnsmessage.Parser
 	header, err := p.Start(rawBytes)
@@ -125,7 +135,9 @@ func formatDNSQueryText(data *jsonoutput.DNSQueryResult) string {
 
 	fmt.Fprintf(&sb, "DNS query for %q (%s) using internal resolver:\n", data.Name, data.QueryType)
 	fmt.Fprintf(&sb, "\n")
-	if len(data.Resolvers) == 1 {
+	if data.Route != nil {
+		formatDNSQueryRoute(&sb, data.Route)
+	} else if len(data.Resolvers) == 1 {
 		fmt.Fprintf(&sb, "Forwarding to resolver: %v\n", formatResolverString(data.Resolvers[0]))
 	} else {
 		fmt.Fprintf(&sb, "Multiple resolvers available:\n")
@@ -135,6 +147,9 @@ func formatDNSQueryText(data *jsonoutput.DNSQueryResult) string {
 	}
 	fmt.Fprintf(&sb, "\n")
 	fmt.Fprintf(&sb, "Response code: %v\n", data.ResponseCode)
+	if data.Route != nil {
+		fmt.Fprintf(&sb, "Resolved in %v\n", data.Route.Duration)
+	}
 	fmt.Fprintf(&sb, "\n")
 
 	if data.Answers == nil {
@@ -158,6 +173,85 @@ func formatDNSQueryText(data *jsonoutput.DNSQueryResult) string {
 	return sb.String()
 }
 
+// formatDNSQueryRoute writes a human-readable description of how a query
+// was routed to sb.
+func formatDNSQueryRoute(sb *strings.Builder, r *jsonoutput.DNSQueryRoute) {
+	switch r.Route {
+	case dnstype.RouteMagicDNS:
+		fmt.Fprintf(sb, "Answered by MagicDNS from the tailnet's records.\n")
+		return
+	case dnstype.RouteZone:
+		fmt.Fprintf(sb, "Answered by Tailscale for a zone it serves.\n")
+		return
+	case dnstype.RouteSplit:
+		fmt.Fprintf(sb, "Forwarded per the split DNS route for %q:\n", r.Suffix)
+	case dnstype.RouteDefault:
+		fmt.Fprintf(sb, "Forwarded to the default resolvers:\n")
+	case dnstype.RouteFallback:
+		fmt.Fprintf(sb, "Forwarded to this host's resolvers, as none are configured:\n")
+	case dnstype.RouteNone:
+		fmt.Fprintf(sb, "No resolvers are configured to forward the query to.\n")
+		return
+	default:
+		fmt.Fprintf(sb, "Forwarded (route %q):\n", r.Route)
+	}
+	for _, u := range r.Upstreams {
+		var status string
+		switch {
+		case u.Answered:
+			status = "answered"
+		case u.Error != "":
+			status = "failed: " + u.Error
+		case u.Sent:
+			status = "response unused"
+		default:
+			status = "not queried"
+		}
+		var details []string
+		if u.Transport == "peerapi-doh" {
+			details = append(details, "via exit node DNS")
+		} else if u.Transport != "" {
+			details = append(details, "over "+u.Transport)
+		}
+		if u.Duration != "" {
+			details = append(details, "in "+u.Duration)
+		}
+		if u.StartDelay != "" {
+			details = append(details, "after "+u.StartDelay+" delay")
+		}
+		if len(details) > 0 {
+			status += " (" + strings.Join(details, ", ") + ")"
+		}
+		fmt.Fprintf(sb, "  - %s: %s\n", u.Addr, status)
+	}
+}
+
+// makeDNSQueryRoute converts a dnstype.QueryTrace to its JSON form.
+func makeDNSQueryRoute(t *dnstype.QueryTrace) *jsonoutput.DNSQueryRoute {
+	r := &jsonoutput.DNSQueryRoute{
+		Route:    t.Route,
+		Suffix:   t.RouteSuffix,
+		Duration: t.Duration.Round(100 * time.Microsecond).String(),
+	}
+	for _, u := range t.Upstreams {
+		ur := jsonoutput.DNSUpstreamResult{
+			Addr:      u.Addr,
+			Sent:      u.Sent,
+			Transport: u.Transport,
+			Answered:  u.Answered,
+			Error:     u.Err,
+		}
+		if u.StartDelay > 0 {
+			ur.StartDelay = u.StartDelay.String()
+		}
+		if u.Duration > 0 {
+			ur.Duration = u.Duration.Round(100 * time.Microsecond).String()
+		}
+		r.Upstreams = append(r.Upstreams, ur)
+	}
+	return r
+}
+
 // formatResolverString formats a jsonoutput.DNSResolverInfo for human-readable text output.
 func formatResolverString(r jsonoutput.DNSResolverInfo) string {
 	if len(r.BootstrapResolution) > 0 {
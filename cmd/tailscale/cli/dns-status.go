@@ -5,7 +5,6 @@
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"maps"
@@ -19,7 +18,7 @@
 
 var dnsStatusCmd = &ffcli.Command{
 	Name:       "status",
-	ShortUsage: "tailscale dns status [--all] [--json]",
+	ShortUsage: "tailscale dns status [--all] [--json | --output=<format>]",
 	Exec:       runDNSStatus,
 	ShortHelp:  "Print the current DNS status and configuration",
 	LongHelp: strings.TrimSpace(`
@@ -73,15 +72,21 @@
 	FlagSet: (func() *flag.FlagSet {
 		fs := newFlagSet("status")
 		fs.BoolVar(&dnsStatusArgs.all, "all", false, "outputs advanced debugging information")
-		fs.BoolVar(&dnsStatusArgs.json, "json", false, "output in JSON format")
+		fs.BoolVar(&dnsStatusArgs.json, "json", false, "output in JSON format; same as --output=json")
+		fs.Var(&dnsStatusArgs.output, "output", outputFlagUsage)
 		return fs
 	})(),
 }
 
 // dnsStatusArgs are the arguments for the "dns status" subcommand.
 var dnsStatusArgs struct {
-	all  bool
-	json bool
+	all    bool
+	json   bool
+	output jsonoutput.Format
+}
+
+func init() {
+	registerOutputSchema[jsonoutput.DNSStatusResult]("dns status", 1)
 }
 
 // makeDNSResolverInfo converts a dnstype.Resolver to a jsonoutput.DNSResolverInfo.
@@ -97,6 +102,10 @@ func makeDNSResolverInfo(r *dnstype.Resolver) jsonoutput.DNSResolverInfo {
 }
 
 func runDNSStatus(ctx context.Context, args []string) error {
+	output, err := outputFormat(dnsStatusArgs.output, dnsStatusArgs.json)
+	if err != nil {
+		return err
+	}
 	s, err := localClient.Status(ctx)
 	if err != nil {
 		return err
@@ -174,13 +183,8 @@ func runDNSStatus(ctx context.Context, args []string) error {
 		}
 	}
 
-	if dnsStatusArgs.json {
-		j, err := json.MarshalIndent(data, "", "  ")
-		if err != nil {
-			return err
-		}
-		printf("%s\n", j)
-		return nil
+	if output.IsMachineReadable() {
+		return jsonoutput.Write(Stdout, output, data)
 	}
 	printf("%s", formatDNSStatusText(data, dnsStatusArgs.all))
 	return nil
@@ -7,8 +7,11 @@
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"math"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
@@ -16,12 +19,19 @@
 )
 
 const (
-	driveShareUsage   = "tailscale drive share <name> <path>"
+	driveShareUsage   = "tailscale drive share [--read-only] [--allow=<peers>] [--quota=<size>] [--bandwidth=<size>] <name> <path>"
 	driveRenameUsage  = "tailscale drive rename <oldname> <newname>"
 	driveUnshareUsage = "tailscale drive unshare <name>"
 	driveListUsage    = "tailscale drive list"
 )
 
+var driveShareArgs struct {
+	readOnly  bool
+	allow     string
+	quota     byteSize
+	bandwidth byteSize
+}
+
 func init() {
 	maybeDriveCmd = driveCmd
 }
@@ -44,6 +54,14 @@ func driveCmd() *ffcli.Command {
 				ShortUsage: driveShareUsage,
 				Exec:       runDriveShare,
 				ShortHelp:  "[ALPHA] Create or modify a share",
+				FlagSet: (func() *flag.FlagSet {
+					fs := newFlagSet("share")
+					fs.BoolVar(&driveShareArgs.readOnly, "read-only", false, "only allow peers to read from the share, even if the tailnet policy grants them read/write access")
+					fs.StringVar(&driveShareArgs.allow, "allow", "", `only allow these peers to access the share, in addition to the tailnet policy (comma-separated login names, tags or Tailscale IPs, e.g. "alice@example.com,tag:server")`)
+					fs.Var(&driveShareArgs.quota, "quota", `reject writes by peers that would grow the share beyond this size (e.g. "10G"; K, M, G and T are powers of 1024)`)
+					fs.Var(&driveShareArgs.bandwidth, "bandwidth", `limit transfers to and from the share to this many bytes per second, across all peers (e.g. "5M")`)
+					return fs
+				})(),
 			},
 			{
 				Name:       "rename",
@@ -80,9 +98,22 @@ func runDriveShare(ctx context.Context, args []string) error {
 		return err
 	}
 
+	var allowed []string
+	if driveShareArgs.allow != "" {
+		for p := range strings.SplitSeq(driveShareArgs.allow, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				allowed = append(allowed, p)
+			}
+		}
+	}
+
 	err = localClient.DriveShareSet(ctx, &drive.Share{
-		Name: name,
-		Path: absolutePath,
+		Name:           name,
+		Path:           absolutePath,
+		ReadOnly:       driveShareArgs.readOnly,
+		AllowedPeers:   allowed,
+		QuotaBytes:     int64(driveShareArgs.quota),
+		BandwidthLimit: int64(driveShareArgs.bandwidth),
 	})
 	if err == nil {
 		fmt.Printf("Sharing %q as %q\n", path, name)
@@ -144,16 +175,75 @@ func runDriveList(ctx context.Context, args []string) error {
 			longestAs = len(share.As)
 		}
 	}
-	formatString := fmt.Sprintf("%%-%ds    %%-%ds    %%s\n", longestName, longestPath)
-	fmt.Printf(formatString, "name", "path", "as")
-	fmt.Printf(formatString, strings.Repeat("-", longestName), strings.Repeat("-", longestPath), strings.Repeat("-", longestAs))
+	formatString := fmt.Sprintf("%%-%ds    %%-%ds    %%-%ds    %%s\n", longestName, longestPath, longestAs)
+	fmt.Printf(formatString, "name", "path", "as", "restrictions")
+	fmt.Printf(formatString, strings.Repeat("-", longestName), strings.Repeat("-", longestPath), strings.Repeat("-", longestAs), strings.Repeat("-", len("restrictions")))
 	for _, share := range shares {
-		fmt.Printf(formatString, share.Name, share.Path, share.As)
+		fmt.Printf(formatString, share.Name, share.Path, share.As, shareRestrictions(share))
 	}
 
 	return nil
 }
 
+// shareRestrictions returns a description of the local access restrictions
+// on share, for "tailscale drive list".
+func shareRestrictions(share *drive.Share) string {
+	var rs []string
+	if share.ReadOnly {
+		rs = append(rs, "read-only")
+	}
+	if len(share.AllowedPeers) > 0 {
+		rs = append(rs, "allow="+strings.Join(share.AllowedPeers, ","))
+	}
+	if share.QuotaBytes > 0 {
+		rs = append(rs, "quota="+byteSize(share.QuotaBytes).String())
+	}
+	if share.BandwidthLimit > 0 {
+		rs = append(rs, "bandwidth="+byteSize(share.BandwidthLimit).String()+"/s")
+	}
+	return strings.Join(rs, " ")
+}
+
+// byteSize is a flag.Value for a number of bytes, optionally with a K, M, G
+// or T suffix for powers of 1024.
+type byteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+func (b byteSize) String() string {
+	for _, u := range byteSizeUnits {
+		if b != 0 && int64(b)%u.size == 0 {
+			return strconv.FormatInt(int64(b)/u.size, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	mult := int64(1)
+	for _, u := range byteSizeUnits {
+		if n, ok := strings.CutSuffix(num, u.suffix); ok {
+			num, mult = n, u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/mult {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = byteSize(n * mult)
+	return nil
+}
+
 func buildShareLongHelp() string {
 	longHelpAs := ""
 	if drive.AllowShareAs() {
@@ -225,6 +315,14 @@ func buildShareLongHelp() string {
 	  }
 	}]
 
+In addition to the ACLs, you can restrict access to a share locally. The --read-only flag limits everyone to read-only access, and the --allow flag limits access to the given users, tags or Tailscale IPs:
+
+  $ tailscale drive share --read-only --allow=alice@example.com,tag:backup docs /Users/me/Documents
+
+You can also limit how much peers may store in a share, and how fast they may transfer files to and from it, with the --quota and --bandwidth flags:
+
+  $ tailscale drive share --quota=100G --bandwidth=5M backups /Volumes/nas/backups
+
 You can rename shares, for example you could rename the above share by running:
 
   $ tailscale drive rename docs newdocs
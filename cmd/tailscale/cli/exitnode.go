@@ -12,9 +12,12 @@
 	"slices"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/kballard/go-shellquote"
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/client/local"
+	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/envknob"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tailcfg"
@@ -40,9 +43,16 @@ func exitNodeCmd() *ffcli.Command {
 			},
 			{
 				Name:       "suggest",
-				ShortUsage: "tailscale exit-node suggest",
+				ShortUsage: "tailscale exit-node suggest [flags]",
 				ShortHelp:  "Suggest the best available exit node",
 				Exec:       runExitNodeSuggest,
+				FlagSet: (func() *flag.FlagSet {
+					fs := newFlagSet("suggest")
+					fs.StringVar(&exitNodeArgs.country, "country", "", "only suggest exit nodes in this country, by name or ISO 3166-1 alpha-2 code")
+					fs.StringVar(&exitNodeArgs.tag, "tag", "", `only suggest exit nodes with this tag, such as "tag:exit"`)
+					fs.BoolVar(&exitNodeArgs.explain, "explain", false, "show all the exit nodes considered, and why they were or weren't suggested")
+					return fs
+				})(),
 			}},
 			(func() []*ffcli.Command {
 				if !envknob.UseWIPCode() {
@@ -67,7 +77,10 @@ func exitNodeCmd() *ffcli.Command {
 }
 
 var exitNodeArgs struct {
-	filter string
+	filter  string
+	country string // for suggest
+	tag     string // for suggest
+	explain bool   // for suggest
 }
 
 func exitNodeSetUse(wantOn bool) func(ctx context.Context, args []string) error {
@@ -148,10 +161,26 @@ func runExitNodeList(ctx context.Context, args []string) error {
 // runExitNodeSuggest returns a suggested exit node ID to connect to and shows the chosen exit node tailcfg.StableNodeID.
 // If there are no derp based exit nodes to choose from or there is a failure in finding a suggestion, the command will return an error indicating so.
 func runExitNodeSuggest(ctx context.Context, args []string) error {
-	res, err := localClient.SuggestExitNode(ctx)
+	if len(args) > 0 {
+		return errors.New("unexpected non-flag arguments to 'tailscale exit-node suggest'")
+	}
+	var res apitype.ExitNodeSuggestionResponse
+	var err error
+	if exitNodeArgs.country != "" || exitNodeArgs.tag != "" || exitNodeArgs.explain {
+		res, err = localClient.SuggestExitNodeWithOpts(ctx, local.SuggestExitNodeOpts{
+			Country: exitNodeArgs.country,
+			Tag:     exitNodeArgs.tag,
+		})
+	} else {
+		res, err = localClient.SuggestExitNode(ctx)
+	}
 	if err != nil {
 		return fmt.Errorf("suggest exit node: %w", err)
 	}
+	if exitNodeArgs.explain && len(res.Candidates) > 0 {
+		printExitNodeCandidates(res.Candidates)
+		fmt.Println()
+	}
 	if res.ID == "" {
 		fmt.Println("No exit node suggestion is available.")
 		return nil
@@ -160,6 +189,32 @@ func runExitNodeSuggest(ctx context.Context, args []string) error {
 	return nil
 }
 
+// printExitNodeCandidates prints a table of the exit nodes considered for a
+// suggestion and how they scored.
+func printExitNodeCandidates(cands []apitype.ExitNodeCandidate) {
+	w := tabwriter.NewWriter(Stdout, 10, 5, 5, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", "HOSTNAME", "COUNTRY", "CITY", "DERP REGION", "DISTANCE", "PRIORITY", "REASON")
+	for _, c := range cands {
+		country, city := "-", "-"
+		if c.Location.Valid() {
+			country, city = cmp.Or(c.Location.Country(), "-"), cmp.Or(c.Location.City(), "-")
+		}
+		derp := "-"
+		if c.DERPRegion != 0 {
+			derp = fmt.Sprintf("%d (latency unknown)", c.DERPRegion)
+			if c.DERPLatency != 0 {
+				derp = fmt.Sprintf("%d (%v)", c.DERPRegion, c.DERPLatency.Round(time.Millisecond))
+			}
+		}
+		distance := "-"
+		if c.Distance != 0 {
+			distance = fmt.Sprintf("%.0fkm", c.Distance/1000)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", strings.Trim(c.Name, "."), country, city, derp, distance, c.Priority, c.Reason)
+	}
+}
+
 func hasAnyExitNodeSuggestions(peers []*ipnstate.PeerStatus) bool {
 	for _, peer := range peers {
 		if peer.HasCap(tailcfg.NodeAttrSuggestExitNode) {
@@ -422,21 +422,6 @@ func truncateString(s string, n int) string {
 	return truncate.String(s, max(n-1, 0)) + "…"
 }
 
-func formatIEC(n float64, unit string) string {
-	switch {
-	case n < 1<<10:
-		return fmt.Sprintf("%0.2f%s", n/(1<<0), unit)
-	case n < 1<<20:
-		return fmt.Sprintf("%0.2fKi%s", n/(1<<10), unit)
-	case n < 1<<30:
-		return fmt.Sprintf("%0.2fMi%s", n/(1<<20), unit)
-	case n < 1<<40:
-		return fmt.Sprintf("%0.2fGi%s", n/(1<<30), unit)
-	default:
-		return fmt.Sprintf("%0.2fTi%s", n/(1<<40), unit)
-	}
-}
-
 func getTargetStableID(ctx context.Context, ipStr string) (id tailcfg.StableNodeID, isOffline bool, err error) {
 	ip, err := netip.ParseAddr(ipStr)
 	if err != nil {
@@ -0,0 +1,142 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_serve
+
+package cli
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/ipn"
+	"tailscale.com/util/mak"
+)
+
+// newFunnelScheduleCommand returns the "funnel schedule" subcommand, which
+// sets, clears, and shows the windows of time during which Funnel is on.
+func newFunnelScheduleCommand(e *serveEnv) *ffcli.Command {
+	return &ffcli.Command{
+		Name: "schedule",
+		ShortUsage: strings.Join([]string{
+			"tailscale funnel schedule [--https=<port>] [--timezone=<zone>] <window>...",
+			"tailscale funnel schedule [--https=<port>] --clear",
+			"tailscale funnel schedule",
+		}, "\n"),
+		ShortHelp: "Turn Funnel on only during scheduled windows of time",
+		LongHelp: strings.TrimSpace(`
+Schedule the windows of time during which Funnel is on for a port that's
+already being served in the background. Outside of them, Funnel is off.
+tailscaled turns Funnel on and off as the windows start and end, and logs
+each change. If this device is offline for all of a window, a health
+warning is shown.
+
+Each window is an optional comma-separated list of days of the week and
+ranges of them, followed by a time range in 24-hour format. A window
+ending at or before its start ends the following day. For example:
+
+  tailscale funnel schedule mon-fri 09:00-17:00
+  tailscale funnel schedule --https=8443 "mon-fri 09:00-17:00" "sat 10:00-14:00"
+
+Without arguments, it shows the current schedules.
+`),
+		Exec: e.runFunnelSchedule,
+		FlagSet: e.newFlags("funnel-schedule", func(fs *flag.FlagSet) {
+			fs.UintVar(&e.funnelSchedulePort, "https", 443, "the HTTPS port to schedule Funnel for")
+			fs.StringVar(&e.funnelTimeZone, "timezone", "", `IANA time zone of the windows, such as "America/New_York" (default this device's time zone)`)
+			fs.BoolVar(&e.funnelClear, "clear", false, "remove the schedule, leaving Funnel in its current state")
+		}),
+	}
+}
+
+func (e *serveEnv) runFunnelSchedule(ctx context.Context, args []string) error {
+	sc, err := e.lc.GetServeConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting serve config: %w", err)
+	}
+	if sc == nil {
+		sc = new(ipn.ServeConfig)
+	}
+	if len(args) == 0 && !e.funnelClear {
+		printFunnelSchedules(e, sc)
+		return nil
+	}
+	if e.funnelClear && len(args) > 0 {
+		return errors.New("can't both set and --clear a schedule")
+	}
+
+	if e.funnelSchedulePort == 0 || e.funnelSchedulePort > 65535 {
+		return fmt.Errorf("invalid --https port %d", e.funnelSchedulePort)
+	}
+	port := uint16(e.funnelSchedulePort)
+	dnsName, err := e.getSelfDNSName(ctx)
+	if err != nil {
+		return err
+	}
+	hp := ipn.HostPort(dnsName + ":" + strconv.Itoa(int(port)))
+
+	if e.funnelClear {
+		if _, ok := sc.FunnelSchedules[hp]; !ok {
+			return fmt.Errorf("no Funnel schedule for port %d", port)
+		}
+		delete(sc.FunnelSchedules, hp)
+		if err := e.lc.SetServeConfig(ctx, sc); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout(), "Removed the Funnel schedule for port %d.\n", port)
+		return nil
+	}
+
+	sched := &ipn.FunnelSchedule{TimeZone: e.funnelTimeZone}
+	for _, a := range args {
+		w, err := ipn.ParseFunnelWindow(a)
+		if err != nil {
+			return err
+		}
+		sched.Windows = append(sched.Windows, w)
+	}
+	if err := sched.Validate(); err != nil {
+		return err
+	}
+	if !sc.IsServingWeb(port, "") && !sc.IsTCPForwardingOnPort(port, "") {
+		return fmt.Errorf("nothing is being served in the background on port %d; set it up with 'tailscale serve --bg --https=%d' first", port, port)
+	}
+	if err := e.verifyFunnelEnabled(ctx, port); err != nil {
+		return err
+	}
+	mak.Set(&sc.FunnelSchedules, hp, sched)
+	if err := e.lc.SetServeConfig(ctx, sc); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout(), "Scheduled Funnel for port %d.\n\n", port)
+	printFunnelSchedules(e, sc)
+	return nil
+}
+
+// printFunnelSchedules prints the Funnel schedules of sc, and whether Funnel
+// is currently on for each of them.
+func printFunnelSchedules(e *serveEnv, sc *ipn.ServeConfig) {
+	if len(sc.FunnelSchedules) == 0 {
+		fmt.Fprintln(e.stdout(), "No Funnel schedules.")
+		return
+	}
+	for _, hp := range slices.Sorted(maps.Keys(sc.FunnelSchedules)) {
+		sched := sc.FunnelSchedules[hp]
+		state := "off"
+		if sc.AllowFunnel[hp] {
+			state = "on"
+		}
+		fmt.Fprintf(e.stdout(), "%s (Funnel %s, time zone %s)\n", hp, state, cmp.Or(sched.TimeZone, "local"))
+		for _, w := range sched.Windows {
+			fmt.Fprintf(e.stdout(), "  %v\n", w)
+		}
+	}
+}
@@ -113,4 +113,43 @@ type DNSQueryResult struct {
 	Resolvers    []DNSResolverInfo `json:",omitzero"`
 	ResponseCode string            // e.g. "RCodeSuccess", "RCodeNameError"
 	Answers      []DNSAnswer       `json:",omitzero"`
+
+	// Route describes how the query was resolved. It's nil if the
+	// daemon is too old to report it.
+	Route *DNSQueryRoute `json:",omitzero"`
+}
+
+// DNSQueryRoute is the JSON form of [dnstype.QueryTrace].
+type DNSQueryRoute struct {
+	// Route is "magicdns", "zone", "split", "default", "fallback" or
+	// "none"; see the Route constants of package dnstype.
+	Route string
+
+	// Suffix is the domain suffix of the split DNS route, with trailing
+	// dot, if Route is "split".
+	Suffix string `json:",omitempty"`
+
+	// Upstreams are the resolvers the query was forwarded to, in the
+	// order they were to be queried.
+	Upstreams []DNSUpstreamResult `json:",omitzero"`
+
+	Duration string // e.g. "12.3ms"
+}
+
+// DNSUpstreamResult is the JSON form of [dnstype.UpstreamTrace].
+type DNSUpstreamResult struct {
+	Addr       string
+	StartDelay string `json:",omitempty"` // e.g. "200ms"
+
+	// Sent is whether the query was sent to the resolver, rather than
+	// answered by another resolver first.
+	Sent bool
+
+	// Transport is "udp", "tcp", "doh", or "peerapi-doh" for DNS over
+	// an exit node or app connector.
+	Transport string `json:",omitempty"`
+
+	Duration string `json:",omitempty"`
+	Answered bool   // whether its response was the one used
+	Error    string `json:",omitempty"`
 }
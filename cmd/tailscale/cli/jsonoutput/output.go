@@ -0,0 +1,93 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package jsonoutput
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Format is a machine-readable output format selected with a command's
+// `--output` flag. It implements flag.Value.
+//
+// The zero value means the command's default, human-oriented output, whose
+// formatting may change between releases. The other formats are stable:
+// they encode the same values as `--json`, whose schemas are printed by
+// `tailscale schema`.
+type Format string
+
+const (
+	FormatDefault Format = ""      // human-oriented output
+	FormatJSON    Format = "json"  // indented JSON
+	FormatYAML    Format = "yaml"  // YAML, with the same field names as JSON
+	FormatTable   Format = "table" // tab-aligned columns
+)
+
+// String implements flag.Value.
+func (f *Format) String() string {
+	return string(*f)
+}
+
+// Set implements flag.Value.
+func (f *Format) Set(s string) error {
+	switch v := Format(s); v {
+	case FormatDefault, FormatJSON, FormatYAML, FormatTable:
+		*f = v
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q; want json, yaml or table", s)
+}
+
+// IsMachineReadable reports whether f is a format other than the default
+// human-oriented one.
+func (f Format) IsMachineReadable() bool {
+	return f != FormatDefault
+}
+
+// Write writes v to w in format f, which must not be [FormatDefault].
+//
+// The JSON and YAML forms are derived from v's JSON encoding, so they use
+// the same field names and omit the same empty fields. The table form uses
+// v's [Tabler] implementation if it has one, and otherwise lists the fields
+// of v (or of each element, if v is a list) in columns.
+func Write(w io.Writer, f Format, v any) error {
+	switch f {
+	case FormatJSON:
+		j, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		j = append(j, '\n')
+		_, err = w.Write(j)
+		return err
+	case FormatYAML:
+		y, err := marshalYAML(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(y)
+		return err
+	case FormatTable:
+		return writeTable(w, v)
+	}
+	return fmt.Errorf("unsupported output format %q", f)
+}
+
+// decodeGeneric returns v's JSON encoding decoded into the generic types
+// map[string]any, []any, string, json.Number, bool and nil.
+func decodeGeneric(v any) (any, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+	var g any
+	if err := dec.Decode(&g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
@@ -0,0 +1,114 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package jsonoutput
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type testOutput struct {
+	Name    string
+	Count   int
+	Tags    []string          `json:",omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Nested  []testItem
+	Skipped string `json:"-"`
+}
+
+type testItem struct {
+	ID   int
+	Note string `json:",omitempty"`
+}
+
+var testValue = testOutput{
+	Name:   "yes",
+	Count:  2,
+	Tags:   []string{"tag:a", "b"},
+	Labels: map[string]string{"k": ""},
+	Nested: []testItem{{ID: 1, Note: "first: one"}, {ID: 2}},
+}
+
+func TestWriteYAML(t *testing.T) {
+	var b bytes.Buffer
+	if err := Write(&b, FormatYAML, testValue); err != nil {
+		t.Fatal(err)
+	}
+	const want = `Count: 2
+Name: "yes"
+Nested:
+  - ID: 1
+    Note: "first: one"
+  - ID: 2
+Tags:
+  - "tag:a"
+  - b
+labels:
+  k: ""
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	var b bytes.Buffer
+	if err := Write(&b, FormatTable, testValue.Nested); err != nil {
+		t.Fatal(err)
+	}
+	const want = "ID  NOTE\n" +
+		"1   first: one\n" +
+		"2   -\n"
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatSet(t *testing.T) {
+	var f Format
+	for _, s := range []string{"json", "yaml", "table", ""} {
+		if err := f.Set(s); err != nil || string(f) != s {
+			t.Errorf("Set(%q) = %v, format %q", s, err, f)
+		}
+	}
+	if err := f.Set("xml"); err == nil {
+		t.Error("Set(xml) succeeded")
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	s := Schema{Command: "test", Version: 1, Type: reflect.TypeFor[testOutput]()}
+	j, err := json.Marshal(s.JSONSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Ref  string `json:"$ref"`
+		Defs map[string]struct {
+			Properties map[string]json.RawMessage
+			Required   []string
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(j, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Ref != "#/$defs/jsonoutput.testOutput" {
+		t.Fatalf("$ref = %q", got.Ref)
+	}
+	out := got.Defs["jsonoutput.testOutput"]
+	if _, ok := out.Properties["Skipped"]; ok {
+		t.Error(`schema includes field tagged json:"-"`)
+	}
+	if _, ok := out.Properties["labels"]; !ok {
+		t.Error("schema doesn't use the field's JSON name")
+	}
+	if want := []string{"Name", "Count", "Nested"}; !reflect.DeepEqual(out.Required, want) {
+		t.Errorf("required = %q; want %q", out.Required, want)
+	}
+	if _, ok := got.Defs["jsonoutput.testItem"]; !ok {
+		t.Error("schema doesn't define nested struct type")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package jsonoutput
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// A Schema describes the machine-readable output of a CLI command.
+type Schema struct {
+	// Command is the command's name, as in "status" or "dns status".
+	Command string
+
+	// Version is the output's schema version. It's incremented when a field
+	// is removed or changes type; adding fields doesn't change it.
+	Version int
+
+	// Type is the Go type encoded as the command's output.
+	Type reflect.Type
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) describing the JSON
+// encoding of s.Type, suitable for marshaling with encoding/json.
+func (s Schema) JSONSchema() map[string]any {
+	g := &schemaGen{defs: map[string]any{}, seen: map[reflect.Type]string{}}
+	root := g.schemaFor(s.Type)
+	out := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   fmt.Sprintf("tailscale %s output, schema version %d", s.Command, s.Version),
+	}
+	for k, v := range root {
+		out[k] = v
+	}
+	if len(g.defs) > 0 {
+		out["$defs"] = g.defs
+	}
+	return out
+}
+
+// schemaGen generates JSON Schemas from Go types. Named struct types are
+// put in defs and referenced, which keeps the output small and handles
+// recursive types.
+type schemaGen struct {
+	defs map[string]any
+	seen map[reflect.Type]string // struct type => defs name
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+func (g *schemaGen) schemaFor(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+			return map[string]any{"type": "string"}
+		}
+		return map[string]any{} // custom encoding; could be anything
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaFor(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": []string{"array", "null"}, "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": []string{"object", "null"}, "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name, ok := g.seen[t]
+		if !ok {
+			name = g.defName(t)
+			g.seen[t] = name
+			g.defs[name] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	}
+	return map[string]any{} // interfaces and anything else
+}
+
+// defName returns a unique name for the named type t in g.defs.
+func (g *schemaGen) defName(t reflect.Type) string {
+	base := path.Base(t.PkgPath()) + "." + t.Name()
+	base = strings.NewReplacer("[", "_", "]", "", "/", "_", "*", "", " ", "").Replace(base)
+	name := base
+	for i := 2; ; i++ {
+		if _, taken := g.defs[name]; !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// structSchema returns the schema for the struct type t, following the rules
+// of encoding/json for field names, embedded structs and omitted fields.
+func (g *schemaGen) structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	g.addFields(t, props, &required)
+	s := map[string]any{
+		"type":       "object",
+		"properties": props,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// addFields adds the JSON fields of the struct type t to props and required.
+// Fields of embedded structs are added after t's own fields, so that, as with
+// encoding/json, the shallower of two fields with the same name wins.
+func (g *schemaGen) addFields(t reflect.Type, props map[string]any, required *[]string) {
+	var embedded []reflect.Type
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, dup := props[name]; dup {
+			continue // shadowed by a shallower field
+		}
+		props[name] = g.schemaFor(ft)
+		omitted := false
+		for o := range strings.SplitSeq(opts, ",") {
+			if o == "omitempty" || o == "omitzero" {
+				omitted = true
+			}
+		}
+		if !omitted {
+			*required = append(*required, name)
+		}
+	}
+	for _, et := range embedded {
+		g.addFields(et, props, required)
+	}
+}
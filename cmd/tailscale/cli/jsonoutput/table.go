@@ -0,0 +1,116 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package jsonoutput
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Tabler is implemented by output values that have a more useful tabular
+// form than a list of their fields, such as a status with a list of peers.
+type Tabler interface {
+	// Table returns the table's column headers and rows.
+	Table() (header []string, rows [][]string)
+}
+
+// writeTable writes v to w as tab-aligned columns.
+func writeTable(w io.Writer, v any) error {
+	var header []string
+	var rows [][]string
+	if t, ok := v.(Tabler); ok {
+		header, rows = t.Table()
+	} else {
+		g, err := decodeGeneric(v)
+		if err != nil {
+			return err
+		}
+		header, rows = genericTable(g)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if len(header) > 0 {
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// genericTable returns a table for the JSON value g. A list of objects has a
+// column for each of their fields; an object has a row for each field; and
+// anything else is a single cell.
+func genericTable(g any) (header []string, rows [][]string) {
+	switch g := g.(type) {
+	case []any:
+		var cols []string
+		for _, e := range g {
+			if m, ok := e.(map[string]any); ok {
+				for k := range m {
+					if !slices.Contains(cols, k) {
+						cols = append(cols, k)
+					}
+				}
+			}
+		}
+		if len(cols) == 0 {
+			for _, e := range g {
+				rows = append(rows, []string{tableCell(e)})
+			}
+			return nil, rows
+		}
+		slices.Sort(cols)
+		for _, e := range g {
+			m, _ := e.(map[string]any)
+			row := make([]string, len(cols))
+			for i, c := range cols {
+				row[i] = tableCell(m[c])
+			}
+			rows = append(rows, row)
+		}
+		for _, c := range cols {
+			header = append(header, strings.ToUpper(c))
+		}
+		return header, rows
+	case map[string]any:
+		keys := make([]string, 0, len(g))
+		for k := range g {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			rows = append(rows, []string{k, tableCell(g[k])})
+		}
+		return []string{"FIELD", "VALUE"}, rows
+	}
+	return nil, [][]string{{tableCell(g)}}
+}
+
+// tableCell returns the JSON value g as the text of a table cell. Missing
+// values are shown as "-" and containers as compact JSON.
+func tableCell(g any) string {
+	switch g := g.(type) {
+	case nil:
+		return "-"
+	case string:
+		if g == "" {
+			return "-"
+		}
+		return g
+	case json.Number:
+		return g.String()
+	case bool:
+		if g {
+			return "true"
+		}
+		return "false"
+	}
+	j, _ := json.Marshal(g)
+	return string(j)
+}
@@ -0,0 +1,148 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package jsonoutput
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// marshalYAML returns the YAML encoding of v, which has the same structure
+// and field names as its JSON encoding. Object keys are sorted.
+//
+// It only needs to emit the small subset of YAML required to represent JSON
+// values, so it's implemented here rather than pulling in a YAML library.
+func marshalYAML(v any) ([]byte, error) {
+	g, err := decodeGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if isYAMLScalar(g) {
+		b.WriteString(yamlScalar(g))
+		b.WriteByte('\n')
+	} else {
+		writeYAMLBlock(&b, g, 0)
+	}
+	return b.Bytes(), nil
+}
+
+// isYAMLScalar reports whether g is written on the same line as its key,
+// which is the case for everything but non-empty objects and lists.
+func isYAMLScalar(g any) bool {
+	switch g := g.(type) {
+	case map[string]any:
+		return len(g) == 0
+	case []any:
+		return len(g) == 0
+	}
+	return true
+}
+
+// writeYAMLBlock writes the non-empty object or list g to b as a block
+// indented by indent spaces.
+func writeYAMLBlock(b *bytes.Buffer, g any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch g := g.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(g))
+		for k := range g {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			b.WriteString(pad)
+			b.WriteString(yamlString(k))
+			b.WriteByte(':')
+			writeYAMLValue(b, g[k], indent+2)
+		}
+	case []any:
+		for _, e := range g {
+			if isYAMLScalar(e) {
+				b.WriteString(pad)
+				b.WriteString("- ")
+				b.WriteString(yamlScalar(e))
+				b.WriteByte('\n')
+				continue
+			}
+			// Write the element indented as if it were under a key, then
+			// turn the start of its first line into the list item marker.
+			var eb bytes.Buffer
+			writeYAMLBlock(&eb, e, indent+2)
+			item := eb.Bytes()
+			b.WriteString(pad)
+			b.WriteString("- ")
+			b.Write(item[indent+2:])
+		}
+	}
+}
+
+// writeYAMLValue writes the value g following a key: scalars on the same line,
+// and objects and lists as blocks on the following lines.
+func writeYAMLValue(b *bytes.Buffer, g any, indent int) {
+	if isYAMLScalar(g) {
+		b.WriteByte(' ')
+		b.WriteString(yamlScalar(g))
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	writeYAMLBlock(b, g, indent)
+}
+
+// yamlScalar returns the YAML form of the scalar or empty container g.
+func yamlScalar(g any) string {
+	switch g := g.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(g)
+	case json.Number:
+		return g.String()
+	case string:
+		return yamlString(g)
+	case map[string]any:
+		return "{}"
+	case []any:
+		return "[]"
+	}
+	panic("unreachable")
+}
+
+// yamlString returns s as a YAML string, quoting it unless it's
+// unambiguously a plain string.
+func yamlString(s string) string {
+	if yamlPlainSafe(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// yamlPlainSafe reports whether s can be written as a plain (unquoted) YAML
+// scalar and still be read back as the same string.
+func yamlPlainSafe(s string) bool {
+	if s == "" {
+		return false
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', r == '_', r == '/':
+		case '0' <= r && r <= '9', r == '.', r == '-', r == '@', r == '+':
+			if i == 0 {
+				// Might be read as a number, or a list item.
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -54,6 +54,7 @@
 	fs.BoolVar(&netcheckArgs.verbose, "verbose", false, "verbose logs")
 	fs.StringVar(&netcheckArgs.bindAddress, "bind-address", "", "send and receive connectivity probes using this locally bound IP address; default: OS-assigned")
 	fs.IntVar(&netcheckArgs.bindPort, "bind-port", 0, "send and receive connectivity probes using this UDP port; default: OS-assigned")
+	fs.BoolVar(&netcheckArgs.speed, "speed", false, "also measure the throughput to the nearest DERP regions, which takes several seconds per region")
 	return fs
 }()
 
@@ -63,6 +64,7 @@
 	verbose     bool
 	bindAddress string
 	bindPort    int
+	speed       bool
 }
 
 func runNetcheck(ctx context.Context, args []string) error {
@@ -143,7 +145,11 @@ func runNetcheck(ctx context.Context, args []string) error {
 		if err != nil {
 			return fmt.Errorf("netcheck: %w", err)
 		}
-		if err := printReport(dm, report); err != nil {
+		var speeds []derpSpeed
+		if netcheckArgs.speed {
+			speeds = measureDERPSpeeds(ctx, netMon, dm, report)
+		}
+		if err := printReport(dm, report, speeds); err != nil {
 			return err
 		}
 		if netcheckArgs.every == 0 {
@@ -153,15 +159,25 @@ func runNetcheck(ctx context.Context, args []string) error {
 	}
 }
 
-func printReport(dm *tailcfg.DERPMap, report *netcheck.Report) error {
+// netcheckJSON is the JSON output of "netcheck --speed".
+type netcheckJSON struct {
+	*netcheck.Report
+	DERPSpeed []derpSpeed
+}
+
+func printReport(dm *tailcfg.DERPMap, report *netcheck.Report, speeds []derpSpeed) error {
+	var v any = report
+	if speeds != nil {
+		v = netcheckJSON{report, speeds}
+	}
 	var j []byte
 	var err error
 	switch netcheckArgs.format {
 	case "":
 	case "json":
-		j, err = json.MarshalIndent(report, "", "\t")
+		j, err = json.MarshalIndent(v, "", "\t")
 	case "json-line":
-		j, err = json.Marshal(report)
+		j, err = json.Marshal(v)
 	default:
 		return fmt.Errorf("unknown output format %q", netcheckArgs.format)
 	}
@@ -242,6 +258,16 @@ func printReport(dm *tailcfg.DERPMap, report *netcheck.Report) error {
 			printf("\t\t- %3s: %-7s (%s%s)\n", r.RegionCode, latency, derpNum, r.RegionName)
 		}
 	}
+	if speeds != nil {
+		printf("\t* DERP throughput (upload):\n")
+		for _, s := range speeds {
+			if s.Error != "" {
+				printf("\t\t- %3s: %s\n", s.RegionCode, s.Error)
+				continue
+			}
+			printf("\t\t- %3s: %.1f Mbit/s (%.1f%% unacknowledged)\n", s.RegionCode, s.BitsPerSecond/1e6, s.Unacked()*100)
+		}
+	}
 	return nil
 }
 
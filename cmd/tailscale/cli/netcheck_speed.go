@@ -0,0 +1,165 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"tailscale.com/derp"
+	"tailscale.com/derp/derphttp"
+	"tailscale.com/net/netcheck"
+	"tailscale.com/net/netmon"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+)
+
+const (
+	// derpSpeedRegions is how many of the nearest DERP regions
+	// "netcheck --speed" measures the throughput to.
+	derpSpeedRegions = 3
+
+	// derpSpeedDuration is how long data is sent to each region.
+	derpSpeedDuration = 3 * time.Second
+
+	// derpSpeedAckWait is how long to wait, after sending, for the
+	// server to acknowledge the data still in flight.
+	derpSpeedAckWait = 2 * time.Second
+
+	// derpSpeedFrameSize is the size of the speed test frames sent.
+	derpSpeedFrameSize = 16 << 10
+)
+
+// derpSpeed is the result of measuring the throughput to a DERP region.
+type derpSpeed struct {
+	RegionID   int
+	RegionCode string
+
+	// BytesSent and BytesAcked are how many bytes were sent to the
+	// region, and how many of them it acknowledged receiving before the
+	// measurement ended.
+	BytesSent  uint64
+	BytesAcked uint64
+
+	// BitsPerSecond is the rate at which the region acknowledged
+	// receiving data.
+	BitsPerSecond float64
+
+	// Error, if non-empty, is why the throughput couldn't be measured.
+	Error string `json:",omitempty"`
+}
+
+// Unacked returns the fraction of the bytes sent that weren't acknowledged
+// by the end of the measurement, either because they were lost or because
+// they were still queued on the way to the region.
+func (s derpSpeed) Unacked() float64 {
+	if s.BytesSent == 0 {
+		return 0
+	}
+	return float64(s.BytesSent-s.BytesAcked) / float64(s.BytesSent)
+}
+
+// measureDERPSpeeds measures the throughput to the derpSpeedRegions DERP
+// regions in dm with the lowest latency in report, one at a time.
+func measureDERPSpeeds(ctx context.Context, netMon *netmon.Monitor, dm *tailcfg.DERPMap, report *netcheck.Report) []derpSpeed {
+	rids := slices.SortedFunc(maps.Keys(report.RegionLatency), func(a, b int) int {
+		return cmp.Or(cmp.Compare(report.RegionLatency[a], report.RegionLatency[b]), cmp.Compare(a, b))
+	})
+	ret := []derpSpeed{}
+	for _, rid := range rids {
+		if len(ret) == derpSpeedRegions {
+			break
+		}
+		region, ok := dm.Regions[rid]
+		if !ok || len(region.Nodes) == 0 {
+			continue
+		}
+		s := derpSpeed{RegionID: rid, RegionCode: region.RegionCode}
+		if err := measureDERPSpeed(ctx, netMon, region, &s); err != nil {
+			s.Error = err.Error()
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// measureDERPSpeed measures the throughput to region into s, by sending it
+// speed test frames for derpSpeedDuration from a new, throwaway node key,
+// and timing the acknowledgements.
+func measureDERPSpeed(ctx context.Context, netMon *netmon.Monitor, region *tailcfg.DERPRegion, s *derpSpeed) error {
+	ctx, cancel := context.WithTimeout(ctx, derpSpeedDuration+derpSpeedAckWait+10*time.Second)
+	defer cancel()
+
+	dc := derphttp.NewRegionClient(key.NewNode(), logger.Discard, netMon, func() *tailcfg.DERPRegion { return region })
+	defer dc.Close()
+	if err := dc.Connect(ctx); err != nil {
+		return err
+	}
+
+	var (
+		mu      sync.Mutex
+		acked   uint64    // bytes acknowledged so far
+		lastAck time.Time // when acked last grew
+	)
+	gotAck := make(chan struct{}, 1)
+	go func() {
+		for {
+			m, err := dc.Recv()
+			if err != nil {
+				return
+			}
+			if ack, ok := m.(derp.SpeedTestAckMessage); ok {
+				mu.Lock()
+				acked, lastAck = ack.Bytes, time.Now()
+				mu.Unlock()
+				select {
+				case gotAck <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	start := time.Now()
+	for seq := uint64(1); time.Since(start) < derpSpeedDuration && ctx.Err() == nil; seq++ {
+		if err := dc.SendSpeedTest(seq, derpSpeedFrameSize); err != nil {
+			return err
+		}
+		s.BytesSent += derpSpeedFrameSize
+	}
+
+	timeout := time.NewTimer(derpSpeedAckWait)
+	defer timeout.Stop()
+wait:
+	for {
+		mu.Lock()
+		done := acked >= s.BytesSent
+		mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case <-gotAck:
+		case <-timeout.C:
+			break wait
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if acked == 0 {
+		return errors.New("no acknowledgements; server may not support speed tests")
+	}
+	s.BytesAcked = acked
+	s.BitsPerSecond = float64(acked*8) / lastAck.Sub(start).Seconds()
+	return nil
+}
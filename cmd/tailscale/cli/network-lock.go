@@ -51,6 +51,7 @@ func init() {
 		nlLogCmd,
 		nlLocalDisableCmd,
 		nlRevokeKeysCmd,
+		nlSignOfflineCmd,
 	},
 	Exec: runNetworkLockNoSubcommand,
 }
@@ -898,3 +899,163 @@ func runNetworkLockRevokeKeys(ctx context.Context, args []string) error {
 
 	return nil
 }
+
+var nlSignOfflineArgs struct {
+	prepare string
+	submit  bool
+}
+
+var nlSignOfflineCmd = &ffcli.Command{
+	Name: "sign-offline",
+	ShortUsage: "tailscale lock sign-offline --prepare=add|remove <pending-file> <tailnet-lock-key>\n" +
+		"  sign-offline <pending-file> <signature-file>\n" +
+		"  sign-offline --submit <pending-file> <signature-file>...",
+	ShortHelp: "Sign a tailnet lock update on a disconnected machine",
+	LongHelp: `Change the trusted tailnet lock keys using a signature made by a tailnet lock key
+held on a disconnected (such as air-gapped) machine.
+
+1. On a node connected to the tailnet, run ` + "`tailscale lock sign-offline --prepare=add <pending-file> <tlpub-key>`" + `
+   (or ` + "`--prepare=remove`" + `) to write the unsigned update to <pending-file>.
+2. Carry <pending-file> to the disconnected machine holding a trusted tailnet lock key, and run
+   ` + "`tailscale lock sign-offline <pending-file> <signature-file>`" + ` to write a detached signature.
+   This does not require a connection to the tailnet.
+3. Carry <signature-file> back, and run ` + "`tailscale lock sign-offline --submit <pending-file> <signature-file>`" + `
+   on a node connected to the tailnet.
+
+Each pending update adds or removes exactly one key, and must be submitted before
+any other change is made to tailnet lock.`,
+	Exec: runNetworkLockSignOffline,
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("lock sign-offline")
+		fs.StringVar(&nlSignOfflineArgs.prepare, "prepare", "", `write an unsigned update which makes the given change ("add" or "remove") to a file`)
+		fs.BoolVar(&nlSignOfflineArgs.submit, "submit", false, "submit a pending update with its detached signatures")
+		return fs
+	})(),
+}
+
+func runNetworkLockSignOffline(ctx context.Context, args []string) error {
+	switch {
+	case nlSignOfflineArgs.prepare != "" && nlSignOfflineArgs.submit:
+		return errors.New("--prepare and --submit are mutually exclusive")
+	case nlSignOfflineArgs.prepare != "":
+		if len(args) != 2 {
+			return errors.New("usage: tailscale lock sign-offline --prepare=add|remove <pending-file> <tailnet-lock-key>")
+		}
+		keys, _, err := parseNLArgs(args[1:], true, false)
+		if err != nil {
+			return err
+		}
+		var addKeys, removeKeys []tka.Key
+		switch nlSignOfflineArgs.prepare {
+		case "add":
+			addKeys = keys
+		case "remove":
+			removeKeys = keys
+		default:
+			return fmt.Errorf("invalid --prepare value %q; want \"add\" or \"remove\"", nlSignOfflineArgs.prepare)
+		}
+		aumBytes, err := localClient.NetworkLockGeneratePendingAUM(ctx, addKeys, removeKeys)
+		if err != nil {
+			return fmt.Errorf("generating pending update: %w", err)
+		}
+		if err := writeHexFile(args[0], aumBytes); err != nil {
+			return err
+		}
+		fmt.Printf(`Wrote pending update to %s.
+
+Sign it by running the following command on a machine with a trusted tailnet lock key:
+	%s lock sign-offline %s <signature-file>
+`, args[0], os.Args[0], args[0])
+		return nil
+	case nlSignOfflineArgs.submit:
+		if len(args) < 2 {
+			return errors.New("usage: tailscale lock sign-offline --submit <pending-file> <signature-file>...")
+		}
+		aum, err := readPendingAUM(args[0])
+		if err != nil {
+			return err
+		}
+		var sigs [][]byte
+		for _, f := range args[1:] {
+			b, err := readHexFile(f)
+			if err != nil {
+				return err
+			}
+			var sig tka.DetachedSignature
+			if err := sig.Unserialize(b); err != nil {
+				return fmt.Errorf("decoding signature in %s: %v", f, err)
+			}
+			sigs = append(sigs, b)
+		}
+		if err := localClient.NetworkLockSubmitPendingAUM(ctx, aum, sigs); err != nil {
+			return err
+		}
+		fmt.Println("Update submitted.")
+		return nil
+	}
+
+	if len(args) != 2 {
+		return errors.New("usage: tailscale lock sign-offline <pending-file> <signature-file>")
+	}
+	aum, err := readPendingAUM(args[0])
+	if err != nil {
+		return err
+	}
+	desc, err := nlDescribeUpdate(ipnstate.NetworkLockUpdate{
+		Hash:   aum.Hash(),
+		Change: aum.MessageKind.String(),
+		Raw:    aum.Serialize(),
+	}, false)
+	if err != nil {
+		return err
+	}
+	fmt.Print(desc)
+	if isatty.IsTerminal(os.Stdout.Fd()) && !prompt.YesNo("Sign this update?", false) {
+		return errors.New("aborted")
+	}
+	sigs, err := localClient.NetworkLockSignOffline(ctx, aum)
+	if err != nil {
+		return fmt.Errorf("signing pending update: %w", err)
+	}
+	if len(sigs) != 1 {
+		return fmt.Errorf("got %d signatures, want 1", len(sigs))
+	}
+	if err := writeHexFile(args[1], sigs[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote signature to %s.\n", args[1])
+	return nil
+}
+
+// readPendingAUM reads a pending AUM written by
+// 'tailscale lock sign-offline --prepare' from the named file.
+func readPendingAUM(path string) (tka.AUM, error) {
+	var aum tka.AUM
+	b, err := readHexFile(path)
+	if err != nil {
+		return aum, err
+	}
+	if err := aum.Unserialize(b); err != nil {
+		return aum, fmt.Errorf("decoding pending update in %s: %v", path, err)
+	}
+	return aum, nil
+}
+
+// writeHexFile writes b to the named file as a line of hex, which survives
+// being copied by hand or through tools which mangle binary data.
+func writeHexFile(path string, b []byte) error {
+	return os.WriteFile(path, fmt.Appendf(nil, "%X\n", b), 0600)
+}
+
+// readHexFile reads a file written by writeHexFile.
+func readHexFile(path string) ([]byte, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(string(text)))
+	if err != nil {
+		return nil, fmt.Errorf("parsing hex in %s: %v", path, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/cmd/tailscale/cli/jsonoutput"
+)
+
+var schemaCmd = &ffcli.Command{
+	Name:       "schema",
+	ShortUsage: "tailscale schema [<command>]",
+	ShortHelp:  "Print the schema of a command's machine-readable output",
+	LongHelp: strings.TrimSpace(`
+'tailscale schema' lists the commands that support the --output flag, with
+the version of their output's schema.
+
+'tailscale schema <command>' prints a JSON Schema describing the command's
+--output=json output. The YAML output has the same structure. Fields may be
+added to a schema without changing its version, but a field is only removed
+or changed in meaning with a new version.
+`),
+	Exec: runSchema,
+}
+
+// outputSchemas are the schemas of the commands that support the --output
+// flag, keyed by command name (as in "dns status").
+var outputSchemas = map[string]jsonoutput.Schema{}
+
+// registerOutputSchema records that command's machine-readable output is the
+// JSON encoding of a T, in the given schema version.
+func registerOutputSchema[T any](command string, version int) {
+	if _, dup := outputSchemas[command]; dup {
+		panic("duplicate output schema for " + command)
+	}
+	outputSchemas[command] = jsonoutput.Schema{
+		Command: command,
+		Version: version,
+		Type:    reflect.TypeFor[T](),
+	}
+}
+
+// outputFlagUsage is the usage text of the --output flag.
+const outputFlagUsage = `machine-readable output format: "json", "yaml" or "table"; see 'tailscale schema'`
+
+// outputFormat returns the machine-readable output format selected by a
+// command's --output flag and its older boolean --json flag, which is
+// equivalent to --output=json.
+func outputFormat(output jsonoutput.Format, json bool) (jsonoutput.Format, error) {
+	if !json {
+		return output, nil
+	}
+	if output.IsMachineReadable() && output != jsonoutput.FormatJSON {
+		return "", fmt.Errorf("--json can't be used with --output=%s", output)
+	}
+	return jsonoutput.FormatJSON, nil
+}
+
+func runSchema(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		tw := tabwriter.NewWriter(Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "COMMAND\tVERSION")
+		for _, name := range slices.Sorted(maps.Keys(outputSchemas)) {
+			fmt.Fprintf(tw, "%s\t%d\n", name, outputSchemas[name].Version)
+		}
+		return tw.Flush()
+	}
+	name := strings.Join(args, " ")
+	s, ok := outputSchemas[name]
+	if !ok {
+		return fmt.Errorf("no output schema for %q; run 'tailscale schema' for a list", name)
+	}
+	j, err := json.MarshalIndent(s.JSONSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	printf("%s\n", j)
+	return nil
+}
@@ -177,6 +177,11 @@ type serveEnv struct {
 	allServices      bool                     // apply config file to all services
 	acceptAppCaps    []tailcfg.PeerCapability // app capabilities to forward
 
+	// funnel schedule flags
+	funnelSchedulePort uint   // HTTPS port to schedule
+	funnelTimeZone     string // time zone of the windows
+	funnelClear        bool   // remove the schedule
+
 	lc localServeClient // localClient interface, specific to serve
 	// optional stuff for tests:
 	testFlagOut io.Writer
@@ -13,6 +13,7 @@
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"math"
 	"net"
 	"net/url"
@@ -153,6 +154,11 @@ func (u *acceptAppCapsFlag) String() string {
   - Expose a service listening on a Unix socket (Linux/macOS/BSD only):
     $ tailscale %[1]s unix:/var/run/myservice.sock
 
+  - Forward TLS connections to port 443 for git.example.com to a TLS server at 127.0.0.1:8443,
+    choosing the backend by server name (SNI) without terminating TLS. Other names can be added
+    to the same port, and "sni:*" matches any name not otherwise listed:
+    $ tailscale %[1]s --bg --tcp=443 sni:git.example.com=8443
+
 For more examples and use cases visit our docs site https://tailscale.com/kb/1247/funnel-serve-use-cases
 `)
 
@@ -270,6 +276,9 @@ func newServeV2Command(e *serveEnv, subcmd serveMode) *ffcli.Command {
 					FlagSet:    e.newFlags("serve-reset", nil),
 				},
 			}
+			if subcmd == funnel {
+				subcmds = append(subcmds, newFunnelScheduleCommand(e))
+			}
 			if subcmd == serve {
 				subcmds = append(subcmds, []*ffcli.Command{
 					{
@@ -511,8 +520,17 @@ func (e *serveEnv) runServeCombined(subcmd serveMode) execFunc {
 
 		var msg string
 		if turnOff {
-			// only unset serve when trying to unset with type and port flags.
-			err = e.unsetServe(sc, dnsName, srvType, srvPort, mount, magicDNSSuffix)
+			if sni, _, isSNI, perr := parseSNITarget(args[0]); len(args) == 2 && (isSNI || perr != nil) {
+				// "sni:<name> off" removes one server name, leaving any
+				// others forwarded on the port.
+				err = perr
+				if err == nil {
+					err = e.removeSNIServe(sc, dnsName, srvType, srvPort, sni)
+				}
+			} else {
+				// only unset serve when trying to unset with type and port flags.
+				err = e.unsetServe(sc, dnsName, srvType, srvPort, mount, magicDNSSuffix)
+			}
 		} else {
 			if forService {
 				e.addServiceToPrefs(ctx, svcName)
@@ -521,7 +539,11 @@ func (e *serveEnv) runServeCombined(subcmd serveMode) execFunc {
 			if len(args) > 0 {
 				target = args[0]
 			}
-			if err := e.shouldWarnRemoteDestCompatibility(ctx, target); err != nil {
+			dest := target
+			if _, backend, isSNI, _ := parseSNITarget(target); isSNI {
+				dest = backend
+			}
+			if err := e.shouldWarnRemoteDestCompatibility(ctx, dest); err != nil {
 				return err
 			}
 			err = e.setServe(sc, dnsName, srvType, srvPort, mount, target, funnel, magicDNSSuffix, e.acceptAppCaps, int(e.proxyProtocol))
@@ -1050,6 +1072,9 @@ func (e *serveEnv) messageForPort(sc *ipn.ServeConfig, st *ipnstate.Status, dnsN
 		if tcpHandler.TerminateTLS != "" {
 			tlsStatus = "TLS terminated"
 		}
+		if len(tcpHandler.SNI) > 0 {
+			tlsStatus = "TLS forwarded by SNI"
+		}
 		if ver := tcpHandler.ProxyProtocol; ver != 0 {
 			tlsStatus = fmt.Sprintf("%s, PROXY protocol v%d", tlsStatus, ver)
 		}
@@ -1059,7 +1084,14 @@ func (e *serveEnv) messageForPort(sc *ipn.ServeConfig, st *ipnstate.Status, dnsN
 			ipp := net.JoinHostPort(a.String(), strconv.Itoa(int(srvPort)))
 			output.WriteString(fmt.Sprintf("|-- tcp://%s\n", ipp))
 		}
-		output.WriteString(fmt.Sprintf("|--> tcp://%s\n\n", tcpHandler.TCPForward))
+		if len(tcpHandler.SNI) > 0 {
+			for _, sni := range slices.Sorted(maps.Keys(tcpHandler.SNI)) {
+				output.WriteString(fmt.Sprintf("|--> %s: tcp://%s\n", sni, tcpHandler.SNI[sni]))
+			}
+			output.WriteString("\n")
+		} else {
+			output.WriteString(fmt.Sprintf("|--> tcp://%s\n\n", tcpHandler.TCPForward))
+		}
 	}
 
 	if !forService && !e.bg.Value {
@@ -1216,6 +1248,14 @@ func (e *serveEnv) applyTCPServe(sc *ipn.ServeConfig, dnsName string, srcType se
 
 	svcName := tailcfg.AsServiceName(dnsName)
 
+	sni, target, isSNI, err := parseSNITarget(target)
+	if err != nil {
+		return err
+	}
+	if isSNI && terminateTLS {
+		return errors.New("SNI forwarding does not terminate TLS; use --tcp")
+	}
+
 	targetURL, err := ipn.ExpandProxyTargetValue(target, []string{"tcp"}, "tcp")
 	if err != nil {
 		return fmt.Errorf("unable to expand target: %v", err)
@@ -1230,6 +1270,17 @@ func (e *serveEnv) applyTCPServe(sc *ipn.ServeConfig, dnsName string, srcType se
 		return fmt.Errorf("cannot serve TCP; already serving web on %d for %s", srcPort, dnsName)
 	}
 
+	if isSNI {
+		if h := sc.GetTCPPortHandler(srcPort, svcName); h != nil && h.TCPForward != "" {
+			return fmt.Errorf("cannot forward by SNI; already forwarding TCP on %d for %s", srcPort, dnsName)
+		}
+		sc.SetSNIForwarding(srcPort, sni, dstURL.Host, proxyProtocol, svcName)
+		return nil
+	}
+	if h := sc.GetTCPPortHandler(srcPort, svcName); h != nil && len(h.SNI) > 0 {
+		return fmt.Errorf("cannot serve TCP; already forwarding by SNI on %d for %s", srcPort, dnsName)
+	}
+
 	// TODO: needs to account for multiple configs from foreground mode
 	if svcName := tailcfg.AsServiceName(dnsName); svcName != "" {
 		sc.SetTCPForwardingForService(srcPort, dstURL.Host, terminateTLS, svcName, proxyProtocol, mds)
@@ -1246,6 +1297,25 @@ func (e *serveEnv) applyTCPServe(sc *ipn.ServeConfig, dnsName string, srcType se
 	return nil
 }
 
+// parseSNITarget parses a TCP serve target of the form
+// "sni:<server-name>=<target>", for forwarding TLS connections by server
+// name. If target doesn't start with "sni:", it returns it unmodified with
+// isSNI false. For removal, the "=<target>" part may be omitted.
+func parseSNITarget(target string) (sni, backend string, isSNI bool, err error) {
+	rest, ok := strings.CutPrefix(target, "sni:")
+	if !ok {
+		return "", target, false, nil
+	}
+	sni, backend, _ = strings.Cut(rest, "=")
+	sni = strings.ToLower(strings.TrimSuffix(sni, "."))
+	if sni != "*" {
+		if err := dnsname.ValidHostname(sni); err != nil {
+			return "", "", false, fmt.Errorf("invalid SNI server name %q: %w", sni, err)
+		}
+	}
+	return sni, backend, true, nil
+}
+
 func (e *serveEnv) applyFunnel(sc *ipn.ServeConfig, dnsName string, srvPort uint16, allowFunnel bool) {
 	hp := ipn.HostPort(net.JoinHostPort(dnsName, strconv.Itoa(int(srvPort))))
 
@@ -1501,6 +1571,24 @@ func (e *serveEnv) removeTCPServe(sc *ipn.ServeConfig, dnsName string, src uint1
 	return nil
 }
 
+// removeSNIServe stops forwarding TLS connections for the server name sni on
+// the given port, as added by a "sni:" target.
+func (e *serveEnv) removeSNIServe(sc *ipn.ServeConfig, dnsName string, srvType serveType, srvPort uint16, sni string) error {
+	if srvType != serveTypeTCP {
+		return errors.New("SNI forwarding can only be removed with --tcp")
+	}
+	svcName := tailcfg.AsServiceName(dnsName)
+	h := sc.GetTCPPortHandler(srvPort, svcName)
+	if h == nil {
+		return errors.New("serve config does not exist")
+	}
+	if _, ok := h.SNI[sni]; !ok {
+		return fmt.Errorf("not forwarding %q by SNI on port %d", sni, srvPort)
+	}
+	sc.RemoveSNIForwarding(svcName, srvPort, sni)
+	return nil
+}
+
 func (e *serveEnv) removeTunServe(sc *ipn.ServeConfig, dnsName string) error {
 	if sc == nil {
 		return nil
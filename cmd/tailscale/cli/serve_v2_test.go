@@ -507,6 +507,58 @@ type group struct {
 				},
 			},
 		},
+		{
+			name: "tcp_sni",
+			steps: []step{
+				{
+					command: cmd("serve --tcp=443 --bg sni:git.example.com=8443"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{
+							443: {SNI: map[string]string{"git.example.com": "127.0.0.1:8443"}},
+						},
+					},
+				},
+				{
+					command: cmd("serve --tcp=443 --bg sni:*=tcp://localhost:9443"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{
+							443: {SNI: map[string]string{
+								"git.example.com": "127.0.0.1:8443",
+								"*":               "localhost:9443",
+							}},
+						},
+					},
+				},
+				{ // can't mix with plain TCP forwarding
+					command: cmd("serve --tcp=443 --bg 5432"),
+					wantErr: anyErr(),
+				},
+				{ // TLS is not terminated
+					command: cmd("serve --tls-terminated-tcp=443 --bg sni:db.example.com=5432"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("serve --tcp=443 --bg sni:bad_name=5432"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("serve --tcp=443 sni:git.example.com off"),
+					want: &ipn.ServeConfig{
+						TCP: map[uint16]*ipn.TCPPortHandler{
+							443: {SNI: map[string]string{"*": "localhost:9443"}},
+						},
+					},
+				},
+				{ // name not forwarded
+					command: cmd("serve --tcp=443 sni:git.example.com off"),
+					wantErr: anyErr(),
+				},
+				{
+					command: cmd("serve --tcp=443 sni:* off"),
+					want:    &ipn.ServeConfig{},
+				},
+			},
+		},
 		{
 			name: "text",
 			steps: []step{{
@@ -10,6 +10,7 @@
 	"fmt"
 	"net/netip"
 	"os/exec"
+	"path"
 	"runtime"
 	"slices"
 	"strconv"
@@ -68,6 +69,14 @@ type setArgsT struct {
 	netfilterMode              string
 	relayServerPort            string
 	relayServerStaticEndpoints string
+	advertiseConnectedSubnets  bool
+	connectedSubnetsInclude    string
+	connectedSubnetsExclude    string
+	excludeApps                string
+	requireTunnelApps          string
+	derpHomeRegion             int
+	derpDenyRegions            string
+	keepWarm                   string
 }
 
 func newSetFlagSet(goos string, setArgs *setArgsT) *flag.FlagSet {
@@ -84,6 +93,9 @@ func newSetFlagSet(goos string, setArgs *setArgsT) *flag.FlagSet {
 	setf.StringVar(&setArgs.advertiseRoutes, "advertise-routes", "", "routes to advertise to other nodes (comma-separated, e.g. \"10.0.0.0/8,192.168.0.0/24\") or empty string to not advertise routes")
 	setf.BoolVar(&setArgs.advertiseDefaultRoute, "advertise-exit-node", false, "offer to be an exit node for internet traffic for the tailnet")
 	setf.BoolVar(&setArgs.advertiseConnector, "advertise-connector", false, "offer to be an app connector for domain specific internet traffic for the tailnet")
+	setf.BoolVar(&setArgs.advertiseConnectedSubnets, "advertise-connected-subnets", false, "automatically advertise the subnets of this node's directly connected network interfaces, updating them as the interfaces change")
+	setf.StringVar(&setArgs.connectedSubnetsInclude, "connected-subnets-include", "", "only advertise connected subnets within these prefixes (comma-separated, e.g. \"192.168.0.0/16\") or empty string to advertise all connected subnets")
+	setf.StringVar(&setArgs.connectedSubnetsExclude, "connected-subnets-exclude", "", "never advertise connected subnets overlapping these prefixes (comma-separated, e.g. \"10.0.0.0/8\") or empty string to not exclude any")
 	setf.BoolVar(&setArgs.updateCheck, "update-check", true, "notify about available Tailscale updates")
 	setf.BoolVar(&setArgs.updateApply, "auto-update", false, "automatically update to the latest available version")
 	setf.BoolVar(&setArgs.reportPosture, "report-posture", false, "allow management plane to gather device posture information")
@@ -91,6 +103,9 @@ func newSetFlagSet(goos string, setArgs *setArgsT) *flag.FlagSet {
 	setf.BoolVar(&setArgs.sync, "sync", false, hidden+"actively sync configuration from the control plane (set to false only for network failure testing)")
 	setf.StringVar(&setArgs.relayServerPort, "relay-server-port", "", "UDP port number (0 will pick a random unused port) for the relay server to bind to, on all interfaces, or empty string to disable relay server functionality")
 	setf.StringVar(&setArgs.relayServerStaticEndpoints, "relay-server-static-endpoints", "", "static IP:port endpoints to advertise as candidates for relay connections (comma-separated, e.g. \"[2001:db8::1]:40000,192.0.2.1:40000\") or empty string to not advertise any static endpoints")
+	setf.IntVar(&setArgs.derpHomeRegion, "derp-home-region", 0, "ID of the DERP region to use as home, or 0 to use the one with the lowest latency")
+	setf.StringVar(&setArgs.derpDenyRegions, "derp-deny-regions", "", "IDs of DERP regions never to use (comma-separated, e.g. \"1,2\") or empty string to not deny any")
+	setf.StringVar(&setArgs.keepWarm, "keep-warm", "", "peers (IP, base name, or MagicDNS name; comma-separated, e.g. \"db,nas\") whose connections to keep warm even while idle, or empty string to not keep any warm")
 
 	ffcomplete.Flag(setf, "exit-node", func(args []string) ([]string, ffcomplete.ShellCompDirective, error) {
 		st, err := localClient.Status(context.Background())
@@ -115,6 +130,8 @@ func newSetFlagSet(goos string, setArgs *setArgsT) *flag.FlagSet {
 		setf.BoolVar(&setArgs.snat, "snat-subnet-routes", true, "source NAT traffic to local routes advertised with --advertise-routes")
 		setf.BoolVar(&setArgs.statefulFiltering, "stateful-filtering", false, "apply stateful filtering to forwarded packets (subnet routers, exit nodes, and so on)")
 		setf.StringVar(&setArgs.netfilterMode, "netfilter-mode", defaultNetfilterMode(), "netfilter mode (one of on, nodivert, off)")
+		setf.StringVar(&setArgs.excludeApps, "exclude-app", "", "cgroup v2 paths whose processes' traffic bypasses Tailscale routes (comma-separated, e.g. \"/user.slice/user-1000.slice/app-firefox.scope\") or empty string to not exclude any; requires --netfilter-mode=on")
+		setf.StringVar(&setArgs.requireTunnelApps, "require-tunnel-app", "", "cgroup v2 paths whose processes may only send traffic over Tailscale (comma-separated) or empty string to not restrict any; requires --netfilter-mode=on")
 	case "windows":
 		setf.BoolVar(&setArgs.forceDaemon, "unattended", false, "run in \"Unattended Mode\" where Tailscale keeps running even after the current GUI user logs out (Windows-only)")
 	}
@@ -162,8 +179,10 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 			AppConnector: ipn.AppConnectorPrefs{
 				Advertise: setArgs.advertiseConnector,
 			},
-			PostureChecking:     setArgs.reportPosture,
-			NoStatefulFiltering: opt.NewBool(!setArgs.statefulFiltering),
+			PostureChecking:           setArgs.reportPosture,
+			NoStatefulFiltering:       opt.NewBool(!setArgs.statefulFiltering),
+			AdvertiseConnectedSubnets: setArgs.advertiseConnectedSubnets,
+			DERPHomeRegion:            setArgs.derpHomeRegion,
 		},
 	}
 
@@ -263,6 +282,49 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 		maskedPrefs.Prefs.RelayServerStaticEndpoints = endpoints
 	}
 
+	if setArgs.derpHomeRegion < 0 {
+		return fmt.Errorf("invalid --derp-home-region %d", setArgs.derpHomeRegion)
+	}
+	if setArgs.derpDenyRegions != "" {
+		maskedPrefs.Prefs.DERPDenyRegions, err = parseDERPRegionList(setArgs.derpDenyRegions)
+		if err != nil {
+			return fmt.Errorf("invalid --derp-deny-regions: %w", err)
+		}
+	}
+
+	if setArgs.keepWarm != "" {
+		maskedPrefs.Prefs.KeepWarmPeers, err = parseKeepWarmPeers(setArgs.keepWarm)
+		if err != nil {
+			return fmt.Errorf("invalid --keep-warm: %w", err)
+		}
+	}
+
+	if setArgs.connectedSubnetsInclude != "" {
+		maskedPrefs.Prefs.ConnectedSubnetsInclude, err = parsePrefixList(setArgs.connectedSubnetsInclude)
+		if err != nil {
+			return fmt.Errorf("invalid --connected-subnets-include: %w", err)
+		}
+	}
+	if setArgs.connectedSubnetsExclude != "" {
+		maskedPrefs.Prefs.ConnectedSubnetsExclude, err = parsePrefixList(setArgs.connectedSubnetsExclude)
+		if err != nil {
+			return fmt.Errorf("invalid --connected-subnets-exclude: %w", err)
+		}
+	}
+
+	if setArgs.excludeApps != "" {
+		maskedPrefs.Prefs.ExcludeApps, err = parseCgroupList(setArgs.excludeApps)
+		if err != nil {
+			return fmt.Errorf("invalid --exclude-app: %w", err)
+		}
+	}
+	if setArgs.requireTunnelApps != "" {
+		maskedPrefs.Prefs.RequireTunnelApps, err = parseCgroupList(setArgs.requireTunnelApps)
+		if err != nil {
+			return fmt.Errorf("invalid --require-tunnel-app: %w", err)
+		}
+	}
+
 	checkPrefs := curPrefs.Clone()
 	checkPrefs.ApplyEdits(maskedPrefs)
 	// We want to make sure user is aware setting --snat-subnet-routes=false with --advertise-exit-node would break exitnode,
@@ -286,6 +348,69 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 	return nil
 }
 
+// parsePrefixList parses a comma-separated list of CIDR prefixes.
+func parsePrefixList(s string) ([]netip.Prefix, error) {
+	var ret []netip.Prefix
+	for v := range strings.SplitSeq(s, ",") {
+		pfx, err := netip.ParsePrefix(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid CIDR prefix", v)
+		}
+		if pfx != pfx.Masked() {
+			return nil, fmt.Errorf("%s has non-address bits set; expected %s", pfx, pfx.Masked())
+		}
+		ret = append(ret, pfx)
+	}
+	return ret, nil
+}
+
+// parseCgroupList parses a comma-separated list of cgroup v2 paths, which
+// must be absolute paths relative to the cgroup2 mount.
+func parseCgroupList(s string) ([]string, error) {
+	var ret []string
+	for v := range strings.SplitSeq(s, ",") {
+		v = strings.TrimSpace(v)
+		if !strings.HasPrefix(v, "/") || path.Clean(v) != v || v == "/" {
+			return nil, fmt.Errorf("%q is not a cgroup path like \"/user.slice/app.scope\"", v)
+		}
+		if !slices.Contains(ret, v) {
+			ret = append(ret, v)
+		}
+	}
+	return ret, nil
+}
+
+// parseKeepWarmPeers parses a comma-separated list of peers, returning them
+// without duplicates.
+func parseKeepWarmPeers(s string) ([]string, error) {
+	var ret []string
+	for v := range strings.SplitSeq(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || strings.ContainsAny(v, " \t") {
+			return nil, fmt.Errorf("%q is not a peer IP or name", v)
+		}
+		if !slices.Contains(ret, v) {
+			ret = append(ret, v)
+		}
+	}
+	return ret, nil
+}
+
+// parseDERPRegionList parses a comma-separated list of DERP region IDs,
+// returning them sorted and without duplicates.
+func parseDERPRegionList(s string) ([]int, error) {
+	var ret []int
+	for v := range strings.SplitSeq(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("%q is not a valid DERP region ID", v)
+		}
+		ret = append(ret, id)
+	}
+	slices.Sort(ret)
+	return slices.Compact(ret), nil
+}
+
 // calcAdvertiseRoutesForSet returns the new value for Prefs.AdvertiseRoutes based on the
 // current value, the flags passed to "tailscale set".
 // advertiseExitNodeSet is whether the --advertise-exit-node flag was set.
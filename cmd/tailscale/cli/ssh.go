@@ -7,6 +7,7 @@
 	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/netip"
@@ -27,7 +28,7 @@
 
 var sshCmd = &ffcli.Command{
 	Name:       "ssh",
-	ShortUsage: "tailscale ssh [user@]<host> [args...]",
+	ShortUsage: "tailscale ssh [--jump=[user@]<hop>,...] [user@]<host> [args...]",
 	ShortHelp:  "SSH to a Tailscale machine",
 	LongHelp: strings.TrimSpace(`
 
@@ -44,10 +45,25 @@
   system 'ssh' command that connects via a pipe through tailscaled.
 * It automatically checks the destination server's SSH host key against the
   node's SSH host key as advertised via the Tailscale coordination server.
+* With --jump (or -J), it connects through one or more intermediate tailnet
+  nodes running Tailscale SSH, such as bastions, without any ProxyJump
+  configuration. Each hop's host key is checked, and each hop's SSH policy
+  must allow forwarding to the next. The SSH agent is never forwarded to the
+  intermediate hops; -A only applies to the destination.
 `),
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("ssh")
+		fs.StringVar(&sshArgs.jump, "jump", "", "comma-separated tailnet nodes ([user@]host) to connect through, in order")
+		fs.StringVar(&sshArgs.jump, "J", "", "shorthand for --jump")
+		return fs
+	})(),
 	Exec: runSSH,
 }
 
+var sshArgs struct {
+	jump string
+}
+
 func runSSH(ctx context.Context, args []string) error {
 	if runtime.GOOS == "darwin" && version.IsMacAppStore() && !envknob.UseWIPCode() {
 		return errors.New("The 'tailscale ssh' subcommand is not available on macOS builds distributed through the App Store or TestFlight.\nInstall the Standalone variant of Tailscale (download it from https://pkgs.tailscale.com), or use the regular 'ssh' client instead.")
@@ -95,6 +111,24 @@ func runSSH(ctx context.Context, args []string) error {
 		}
 	}
 
+	var hops []string
+	if sshArgs.jump != "" {
+		hops = strings.Split(sshArgs.jump, ",")
+		for _, hop := range hops {
+			_, hopHost, ok := strings.Cut(hop, "@")
+			if !ok {
+				hopHost = hop
+			}
+			hps, ok := peerStatusFromArg(st, hopHost)
+			if !ok {
+				return fmt.Errorf("jump host %q not found in tailnet", hopHost)
+			}
+			if len(hps.SSH_HostKeys) == 0 {
+				return fmt.Errorf("jump host %q is not running Tailscale SSH", hopHost)
+			}
+		}
+	}
+
 	ssh, err := findSSH()
 	if err != nil {
 		// TODO(bradfitz): use Go's crypto/ssh client instead
@@ -119,14 +153,15 @@ func runSSH(ctx context.Context, args []string) error {
 		"-o", "CanonicalizeHostname no", // https://github.com/tailscale/tailscale/issues/10348
 	)
 
-	// MagicDNS is usually working on macOS anyway and they're not in userspace
-	// mode, so 'nc' isn't very useful.
-	if runtime.GOOS != "darwin" {
-		socketArg := ""
-		if localClient.Socket != "" && localClient.Socket != paths.DefaultTailscaledSocket() {
-			socketArg = fmt.Sprintf("--socket=%q", localClient.Socket)
-		}
-
+	socketArg := ""
+	if localClient.Socket != "" && localClient.Socket != paths.DefaultTailscaledSocket() {
+		socketArg = fmt.Sprintf("--socket=%q", localClient.Socket)
+	}
+	if len(hops) > 0 {
+		argv = append(argv, "-o", jumpProxyCommand(os.Args[0], socketArg, hops))
+	} else if runtime.GOOS != "darwin" {
+		// MagicDNS is usually working on macOS anyway and they're not in
+		// userspace mode, so 'nc' isn't very useful.
 		argv = append(argv,
 			"-o", fmt.Sprintf("ProxyCommand %q %s nc %%h %%p",
 				// os.Executable() would return the real running binary but in case tailscale is built with the ts_include_cli tag,
@@ -157,6 +192,29 @@ func runSSH(ctx context.Context, args []string) error {
 	return execSSH(ssh, argv)
 }
 
+// jumpProxyCommand returns the ssh ProxyCommand option that connects
+// through hops, the last of which forwards the connection to the
+// destination. It runs 'tailscale ssh' (exe) to the last hop, which in turn
+// jumps through the hops before it, so each hop gets the same host key
+// checking and transport as the destination.
+func jumpProxyCommand(exe, socketArg string, hops []string) string {
+	last, rest := hops[len(hops)-1], hops[:len(hops)-1]
+	var jumpArg string
+	if len(rest) > 0 {
+		jumpArg = fmt.Sprintf("--jump=%q", strings.Join(rest, ","))
+	}
+	cmd := strings.Join(slices.DeleteFunc([]string{
+		fmt.Sprintf("%q", exe),
+		socketArg,
+		"ssh",
+		jumpArg,
+		fmt.Sprintf("%q", last),
+		"-o", "ForwardAgent=no",
+		"-W", "%h:%p",
+	}, func(s string) bool { return s == "" }), " ")
+	return "ProxyCommand " + cmd
+}
+
 func writeKnownHosts(st *ipnstate.Status) (knownHostsFile string, err error) {
 	confDir, err := os.UserConfigDir()
 	if err != nil {
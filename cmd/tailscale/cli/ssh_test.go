@@ -0,0 +1,33 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import "testing"
+
+func TestJumpProxyCommand(t *testing.T) {
+	tests := []struct {
+		socketArg string
+		hops      []string
+		want      string
+	}{
+		{
+			hops: []string{"bastion"},
+			want: `ProxyCommand "tailscale" ssh "bastion" -o ForwardAgent=no -W %h:%p`,
+		},
+		{
+			socketArg: `--socket="/tmp/ts.sock"`,
+			hops:      []string{"alice@bastion1", "bastion2"},
+			want:      `ProxyCommand "tailscale" --socket="/tmp/ts.sock" ssh --jump="alice@bastion1" "bastion2" -o ForwardAgent=no -W %h:%p`,
+		},
+		{
+			hops: []string{"a", "b", "c"},
+			want: `ProxyCommand "tailscale" ssh --jump="a,b" "c" -o ForwardAgent=no -W %h:%p`,
+		},
+	}
+	for _, tt := range tests {
+		if got := jumpProxyCommand("tailscale", tt.socketArg, tt.hops); got != tt.want {
+			t.Errorf("jumpProxyCommand(%q, %q):\n got %s\nwant %s", tt.socketArg, tt.hops, got, tt.want)
+		}
+	}
+}
@@ -6,19 +6,23 @@
 import (
 	"cmp"
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"maps"
 	"net"
 	"net/http"
 	"net/netip"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"golang.org/x/net/idna"
+	"tailscale.com/cmd/tailscale/cli/jsonoutput"
 	"tailscale.com/feature"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
@@ -28,14 +32,15 @@
 
 var statusCmd = &ffcli.Command{
 	Name:       "status",
-	ShortUsage: "tailscale status [--active] [--web] [--json]",
+	ShortUsage: "tailscale status [--active] [--web] [--json | --output=<format>] [--watch] [--usage]",
 	ShortHelp:  "Show state of tailscaled and its connections",
 	LongHelp: strings.TrimSpace(`
 
 JSON FORMAT
 
-Warning: this format has changed between releases and might change more
-in the future.
+The --output=json, --output=yaml and --json formats follow a versioned
+schema, printed by 'tailscale schema status'. Fields may be added in
+future releases.
 
 For a description of the fields, see the "type Status" declaration at:
 
@@ -44,11 +49,15 @@
 (and be sure to select branch/tag that corresponds to the version
  of Tailscale you're running)
 
+With --usage, the machine-readable output is instead the "type UsageReport"
+declared in the same file.
+
 `),
 	Exec: runStatus,
 	FlagSet: (func() *flag.FlagSet {
 		fs := newFlagSet("status")
-		fs.BoolVar(&statusArgs.json, "json", false, "output in JSON format (WARNING: format subject to change)")
+		fs.BoolVar(&statusArgs.json, "json", false, "output in JSON format; same as --output=json")
+		fs.Var(&statusArgs.output, "output", outputFlagUsage)
 		fs.BoolVar(&statusArgs.web, "web", false, "run webserver with HTML showing status")
 		fs.BoolVar(&statusArgs.active, "active", false, "filter output to only peers with active sessions (not applicable to web mode)")
 		fs.BoolVar(&statusArgs.self, "self", true, "show status of local machine")
@@ -56,19 +65,28 @@
 		fs.StringVar(&statusArgs.listen, "listen", "127.0.0.1:8384", "listen address for web mode; use port 0 for automatic")
 		fs.BoolVar(&statusArgs.browser, "browser", true, "Open a browser in web mode")
 		fs.BoolVar(&statusArgs.header, "header", false, "show column headers in table format")
+		fs.BoolVar(&statusArgs.watch, "watch", false, "after printing status, keep running and print changes to peers' connection paths as they happen")
+		fs.BoolVar(&statusArgs.usage, "usage", false, "show the network traffic Tailscale itself used in recent days and hours, by category and network interface")
 		return fs
 	})(),
 }
 
+func init() {
+	registerOutputSchema[ipnstate.Status]("status", 1)
+}
+
 var statusArgs struct {
-	json    bool   // JSON output mode
-	web     bool   // run webserver
-	listen  string // in web mode, webserver address to listen on, empty means auto
-	browser bool   // in web mode, whether to open browser
-	active  bool   // in CLI mode, filter output to only peers with active sessions
-	self    bool   // in CLI mode, show status of local machine
-	peers   bool   // in CLI mode, show status of peer machines
-	header  bool   // in CLI mode, show column headers in table format
+	json    bool              // JSON output mode
+	output  jsonoutput.Format // machine-readable output format
+	web     bool              // run webserver
+	listen  string            // in web mode, webserver address to listen on, empty means auto
+	browser bool              // in web mode, whether to open browser
+	active  bool              // in CLI mode, filter output to only peers with active sessions
+	self    bool              // in CLI mode, show status of local machine
+	peers   bool              // in CLI mode, show status of peer machines
+	header  bool              // in CLI mode, show column headers in table format
+	watch   bool              // in CLI mode, keep printing peer path changes
+	usage   bool              // show Tailscale's own network usage instead
 }
 
 const mullvadTCD = "mullvad.ts.net."
@@ -77,6 +95,19 @@ func runStatus(ctx context.Context, args []string) error {
 	if len(args) > 0 {
 		return errors.New("unexpected non-flag arguments to 'tailscale status'")
 	}
+	output, err := outputFormat(statusArgs.output, statusArgs.json)
+	if err != nil {
+		return err
+	}
+	if statusArgs.watch && (output.IsMachineReadable() || statusArgs.web || !statusArgs.peers) {
+		return errors.New("--watch can't be used with --json, --output, --web or --peers=false")
+	}
+	if statusArgs.usage {
+		if statusArgs.web || statusArgs.watch {
+			return errors.New("--usage can't be used with --web or --watch")
+		}
+		return runStatusUsage(ctx, output)
+	}
 	getStatus := localClient.Status
 	if !statusArgs.peers {
 		getStatus = localClient.StatusWithoutPeers
@@ -85,7 +116,7 @@ func runStatus(ctx context.Context, args []string) error {
 	if err != nil {
 		return fixTailscaledConnectError(err)
 	}
-	if statusArgs.json {
+	if output.IsMachineReadable() {
 		if statusArgs.active {
 			for peer, ps := range st.Peer {
 				if !ps.Active {
@@ -93,12 +124,7 @@ func runStatus(ctx context.Context, args []string) error {
 				}
 			}
 		}
-		j, err := json.MarshalIndent(st, "", "  ")
-		if err != nil {
-			return err
-		}
-		printf("%s", j)
-		return nil
+		return jsonoutput.Write(Stdout, output, statusTable{st})
 	}
 	if statusArgs.web {
 		ln, err := net.Listen("tcp", statusArgs.listen)
@@ -250,6 +276,9 @@ func runStatus(ctx context.Context, args []string) error {
 	if f, ok := hookPrintFunnelStatus.GetOk(); ok {
 		f(ctx)
 	}
+	if statusArgs.watch {
+		return watchStatus(ctx, st)
+	}
 	return nil
 }
 
@@ -319,3 +348,146 @@ func firstIPString(v []netip.Addr) string {
 	}
 	return v[0].String()
 }
+
+// statusTable is a Status whose --output=table form lists this node and its
+// peers. Its JSON encoding is the Status's.
+type statusTable struct {
+	*ipnstate.Status
+}
+
+func (st statusTable) Table() (header []string, rows [][]string) {
+	header = []string{"IP", "HOSTNAME", "DNSNAME", "OS", "ONLINE", "ACTIVE", "EXITNODE", "RELAY"}
+	addRow := func(ps *ipnstate.PeerStatus) {
+		ip := "-"
+		if len(ps.TailscaleIPs) > 0 {
+			ip = ps.TailscaleIPs[0].String()
+		}
+		rows = append(rows, []string{
+			ip,
+			cmp.Or(ps.HostName, "-"),
+			cmp.Or(strings.TrimSuffix(ps.DNSName, "."), "-"),
+			cmp.Or(ps.OS, "-"),
+			fmt.Sprint(ps.Online),
+			fmt.Sprint(ps.Active),
+			fmt.Sprint(ps.ExitNode),
+			cmp.Or(ps.Relay, "-"),
+		})
+	}
+	if st.Self != nil {
+		addRow(st.Self)
+	}
+	for _, k := range st.Peers() {
+		addRow(st.Peer[k])
+	}
+	return header, rows
+}
+
+// statusUsageHours is the number of recent hours whose usage
+// 'tailscale status --usage' shows.
+const statusUsageHours = 24
+
+// runStatusUsage implements 'tailscale status --usage'.
+func runStatusUsage(ctx context.Context, output jsonoutput.Format) error {
+	u, err := localClient.Usage(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if output.IsMachineReadable() {
+		return jsonoutput.Write(Stdout, output, usageTable{u})
+	}
+	if len(u.Daily) == 0 {
+		outln("No usage recorded yet.")
+		return nil
+	}
+	categories := []ipnstate.UsageCategory{ipnstate.UsagePeer, ipnstate.UsageDERP, ipnstate.UsageControl, ipnstate.UsageLog}
+	printWindows := func(title, layout string, windows []ipnstate.UsageWindow) {
+		printf("%s (sent / received):\n", title)
+		w := tabwriter.NewWriter(Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprint(w, "\tTOTAL")
+		for _, c := range categories {
+			fmt.Fprintf(w, "\t%s", strings.ToUpper(string(c)))
+		}
+		fmt.Fprintln(w, "\tINTERFACES")
+		for _, win := range windows {
+			fmt.Fprintf(w, "%s\t%s", win.Start.Local().Format(layout), formatUsageBytes(win.Total()))
+			for _, c := range categories {
+				if slices.Contains(u.Unmeasured, c) {
+					fmt.Fprint(w, "\tn/a")
+				} else {
+					fmt.Fprintf(w, "\t%s", formatUsageBytes(win.Categories[c]))
+				}
+			}
+			var ifaces []string
+			for _, name := range slices.Sorted(maps.Keys(win.Interfaces)) {
+				b := win.Interfaces[name]
+				ifaces = append(ifaces, fmt.Sprintf("%s %s", name, formatIEC(float64(b.TxBytes+b.RxBytes), "B")))
+			}
+			fmt.Fprintf(w, "\t%s\n", strings.Join(ifaces, ", "))
+		}
+		w.Flush()
+	}
+	printWindows("Daily", "2006-01-02", u.Daily)
+	hourly := u.Hourly
+	if len(hourly) > statusUsageHours {
+		hourly = hourly[len(hourly)-statusUsageHours:]
+	}
+	outln()
+	printWindows("Hourly", "2006-01-02 15:04", hourly)
+	if len(u.Unmeasured) > 0 {
+		outln()
+		printf("# Usage of %s can't be measured on this platform or by this build.\n", joinUsageCategories(u.Unmeasured))
+	}
+	return nil
+}
+
+func formatUsageBytes(b ipnstate.UsageBytes) string {
+	return formatIEC(float64(b.TxBytes), "B") + " / " + formatIEC(float64(b.RxBytes), "B")
+}
+
+func formatIEC(n float64, unit string) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%0.2f%s", n/(1<<0), unit)
+	case n < 1<<20:
+		return fmt.Sprintf("%0.2fKi%s", n/(1<<10), unit)
+	case n < 1<<30:
+		return fmt.Sprintf("%0.2fMi%s", n/(1<<20), unit)
+	case n < 1<<40:
+		return fmt.Sprintf("%0.2fGi%s", n/(1<<30), unit)
+	default:
+		return fmt.Sprintf("%0.2fTi%s", n/(1<<40), unit)
+	}
+}
+
+func joinUsageCategories(cats []ipnstate.UsageCategory) string {
+	s := make([]string, len(cats))
+	for i, c := range cats {
+		s[i] = string(c)
+	}
+	return strings.Join(s, " and ")
+}
+
+// usageTable is a UsageReport whose --output=table form lists the bytes
+// sent and received in each window. Its JSON encoding is the UsageReport's.
+type usageTable struct {
+	*ipnstate.UsageReport
+}
+
+func (u usageTable) Table() (header []string, rows [][]string) {
+	header = []string{"PERIOD", "START", "END", "TX_BYTES", "RX_BYTES"}
+	add := func(period string, windows []ipnstate.UsageWindow) {
+		for _, w := range windows {
+			t := w.Total()
+			rows = append(rows, []string{
+				period,
+				w.Start.Format(time.RFC3339),
+				w.End.Format(time.RFC3339),
+				strconv.FormatUint(t.TxBytes, 10),
+				strconv.FormatUint(t.RxBytes, 10),
+			})
+		}
+	}
+	add("day", u.Daily)
+	add("hour", u.Hourly)
+	return header, rows
+}
@@ -0,0 +1,168 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/types/key"
+)
+
+// statusWatchPollInterval is how often "tailscale status --watch" re-reads
+// the status even without a notification from tailscaled, as not every path
+// change results in one.
+const statusWatchPollInterval = 2 * time.Second
+
+// peerWatchState is the subset of a peer's status that "tailscale status
+// --watch" reports changes to.
+type peerWatchState struct {
+	name   string
+	online bool
+	path   string // how traffic to the peer flows; empty if idle
+}
+
+func (s peerWatchState) String() string {
+	if !s.online {
+		return "offline"
+	}
+	if s.path == "" {
+		return "idle"
+	}
+	return s.path
+}
+
+func newPeerWatchState(st *ipnstate.Status, ps *ipnstate.PeerStatus) peerWatchState {
+	s := peerWatchState{
+		name:   dnsOrQuoteHostname(st, ps),
+		online: ps.Online,
+	}
+	if ps.Active {
+		switch {
+		case ps.CurAddr != "":
+			s.path = "direct " + ps.CurAddr
+		case ps.PeerRelay != "":
+			s.path = "peer-relay " + ps.PeerRelay
+		case ps.Relay != "":
+			s.path = fmt.Sprintf("relay %q", ps.Relay)
+		}
+	}
+	return s
+}
+
+// watchStatus prints changes to peers' connectivity (online state and
+// direct/relayed paths and endpoints) as they happen, until ctx is done.
+// prev is the status that was last printed.
+func watchStatus(ctx context.Context, prev *ipnstate.Status) error {
+	watcher, err := localClient.WatchIPNBus(ctx, ipn.NotifyWatchEngineUpdates)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Reading from the bus blocks, so do it in a goroutine and turn each
+	// notification into a wakeup.
+	wake := make(chan struct{}, 1)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := watcher.Next(); err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	out, color := colorableOutput()
+	state := peerWatchStates(prev)
+	outln()
+	printf("# Watching for changes; press Ctrl+C to stop.\n")
+
+	t := time.NewTicker(statusWatchPollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		case <-wake:
+		case <-t.C:
+		}
+		st, err := localClient.Status(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		next := peerWatchStates(st)
+		printPeerWatchChanges(out, color, time.Now(), state, next)
+		state = next
+	}
+}
+
+func peerWatchStates(st *ipnstate.Status) map[key.NodePublic]peerWatchState {
+	m := make(map[key.NodePublic]peerWatchState, len(st.Peer))
+	for k, ps := range st.Peer {
+		if ps.ShareeNode {
+			continue
+		}
+		m[k] = newPeerWatchState(st, ps)
+	}
+	return m
+}
+
+// printPeerWatchChanges writes a line to w for each peer whose state differs
+// between prev and next. Transitions between direct and relayed paths are
+// highlighted if color is true.
+func printPeerWatchChanges(w io.Writer, color bool, now time.Time, prev, next map[key.NodePublic]peerWatchState) {
+	ts := now.Format(time.TimeOnly)
+	highlight := func(s string) string {
+		if !color {
+			return s
+		}
+		return "\x1b[33m" + s + "\x1b[0m"
+	}
+	var lines []string
+	for k, n := range next {
+		p, ok := prev[k]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("%s: added (%v)", n.name, n))
+		case p != n:
+			change := fmt.Sprintf("%v -> %v", p, n)
+			if p.path != "" && n.path != "" && isDirect(p.path) != isDirect(n.path) {
+				change = highlight(change)
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s", n.name, change))
+		}
+	}
+	for k, p := range prev {
+		if _, ok := next[k]; !ok {
+			lines = append(lines, fmt.Sprintf("%s: removed", p.name))
+		}
+	}
+	slices.Sort(lines)
+	for _, l := range lines {
+		fmt.Fprintf(w, "%s %s\n", ts, l)
+	}
+}
+
+func isDirect(path string) bool {
+	return strings.HasPrefix(path, "direct ")
+}
@@ -0,0 +1,35 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/types/key"
+)
+
+func TestPrintPeerWatchChanges(t *testing.T) {
+	a, b, c := key.NewNode().Public(), key.NewNode().Public(), key.NewNode().Public()
+	prev := map[key.NodePublic]peerWatchState{
+		a: {name: "a", online: true, path: `relay "nyc"`},
+		b: {name: "b", online: true},
+		c: {name: "c", online: true, path: "direct 192.0.2.1:41641"},
+	}
+	next := map[key.NodePublic]peerWatchState{
+		a: {name: "a", online: true, path: "direct 192.0.2.2:41641"},
+		b: {name: "b", online: true},
+		c: {name: "c", online: false},
+	}
+	var buf strings.Builder
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	printPeerWatchChanges(&buf, false, now, prev, next)
+	want := `03:04:05 a: relay "nyc" -> direct 192.0.2.2:41641
+03:04:05 c: direct 192.0.2.1:41641 -> offline
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -4,10 +4,12 @@
 package cli
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"text/tabwriter"
@@ -15,6 +17,7 @@
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/cmd/tailscale/cli/ffcomplete"
+	"tailscale.com/cmd/tailscale/cli/jsonoutput"
 	"tailscale.com/ipn"
 )
 
@@ -22,7 +25,7 @@
 	Name: "switch",
 	ShortUsage: strings.Join([]string{
 		"tailscale switch <id>",
-		"tailscale switch --list [--json]",
+		"tailscale switch --list [--json | --output=<format>]",
 	}, "\n"),
 	ShortHelp: "Switch to a different Tailscale account",
 	LongHelp: `"tailscale switch" switches between logged in accounts. You can
@@ -35,7 +38,8 @@
 	FlagSet: func() *flag.FlagSet {
 		fs := flag.NewFlagSet("switch", flag.ExitOnError)
 		fs.BoolVar(&switchArgs.list, "list", false, "list available accounts")
-		fs.BoolVar(&switchArgs.json, "json", false, "list available accounts in JSON format")
+		fs.BoolVar(&switchArgs.json, "json", false, "list available accounts in JSON format; same as --output=json")
+		fs.Var(&switchArgs.output, "output", "with --list, "+outputFlagUsage)
 		return fs
 	}(),
 	Exec: switchProfile,
@@ -54,6 +58,43 @@
 This command is currently in alpha and may change in the future.`,
 			Exec: removeProfile,
 		},
+		{
+			Name:       "export",
+			ShortUsage: "tailscale switch export [--out=<file>] <id>",
+			ShortHelp:  "Export a Tailscale account's settings",
+			LongHelp: `"tailscale switch export" writes a Tailscale account's settings as
+JSON, for use with "tailscale switch import" on another machine.
+
+Only settings that aren't specific to this machine are exported, such as
+the control server, DNS and subnet route acceptance, and advertised tags.
+The hostname, operator, advertised routes, exit node selection and other
+machine-local settings are not. Nor are the device's identity and node
+keys: the imported account must be logged in again and becomes a new
+device in its tailnet.
+
+This command is currently in alpha and may change in the future.`,
+			FlagSet: func() *flag.FlagSet {
+				fs := flag.NewFlagSet("export", flag.ExitOnError)
+				fs.StringVar(&switchExportArgs.out, "out", "", "file to write the export to; stdout if empty")
+				return fs
+			}(),
+			Exec: exportProfile,
+		},
+		{
+			Name:       "import",
+			ShortUsage: "tailscale switch import <file>",
+			ShortHelp:  "Import a Tailscale account's settings",
+			LongHelp: `"tailscale switch import" adds and switches to a new Tailscale
+account with the settings from a file written by "tailscale switch export",
+or from stdin if the file is "-". The settings are checked and subject to
+system policy as with "tailscale set".
+
+The exported device's identity is not carried over: the new account starts
+out logged out, and "tailscale login" authenticates it as a new device.
+
+This command is currently in alpha and may change in the future.`,
+			Exec: importProfile,
+		},
 	},
 }
 
@@ -86,8 +127,13 @@ func(prof ipn.LoginProfile) string { return prof.Name },
 }
 
 var switchArgs struct {
-	list bool
-	json bool
+	list   bool
+	json   bool
+	output jsonoutput.Format
+}
+
+func init() {
+	registerOutputSchema[[]switchProfileJSON]("switch", 1)
 }
 
 func listProfiles(ctx context.Context) error {
@@ -123,7 +169,7 @@ type switchProfileJSON struct {
 	Selected bool   `json:"selected"`
 }
 
-func listProfilesJSON(ctx context.Context) error {
+func listProfilesMachineReadable(ctx context.Context, output jsonoutput.Format) error {
 	curP, all, err := localClient.ProfileStatus(ctx)
 	if err != nil {
 		return err
@@ -138,23 +184,22 @@ func listProfilesJSON(ctx context.Context) error {
 			Selected: prof.ID == curP.ID,
 		})
 	}
-	profilesJSON, err := json.MarshalIndent(profiles, "", "  ")
-	if err != nil {
-		return err
-	}
-	printf("%s\n", profilesJSON)
-	return nil
+	return jsonoutput.Write(Stdout, output, profiles)
 }
 
 func switchProfile(ctx context.Context, args []string) error {
+	output, err := outputFormat(switchArgs.output, switchArgs.json)
+	if err != nil {
+		return err
+	}
 	if switchArgs.list {
-		if switchArgs.json {
-			return listProfilesJSON(ctx)
+		if output.IsMachineReadable() {
+			return listProfilesMachineReadable(ctx, output)
 		}
 		return listProfiles(ctx)
 	}
-	if switchArgs.json {
-		outln("--json argument cannot be used with tailscale switch NAME")
+	if output.IsMachineReadable() {
+		outln("--json and --output arguments cannot be used with tailscale switch NAME")
 		os.Exit(1)
 	}
 	if len(args) != 1 {
@@ -240,6 +285,68 @@ func removeProfile(ctx context.Context, args []string) error {
 	return localClient.DeleteProfile(ctx, profID)
 }
 
+var switchExportArgs struct {
+	out string
+}
+
+func exportProfile(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		outln("usage: tailscale switch export [--out=<file>] NAME")
+		os.Exit(1)
+	}
+	_, all, err := localClient.ProfileStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to export account: %w", err)
+	}
+	profID, ok := matchProfile(args[0], all)
+	if !ok {
+		errf("No profile named %q\n", args[0])
+		os.Exit(1)
+	}
+	ex, err := localClient.ExportProfile(ctx, profID)
+	if err != nil {
+		return fmt.Errorf("failed to export account: %w", err)
+	}
+	j, err := json.MarshalIndent(ex, "", "  ")
+	if err != nil {
+		return err
+	}
+	j = append(j, '\n')
+	if switchExportArgs.out == "" {
+		Stdout.Write(j)
+		return nil
+	}
+	return os.WriteFile(switchExportArgs.out, j, 0600)
+}
+
+func importProfile(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		outln("usage: tailscale switch import <file>")
+		os.Exit(1)
+	}
+	var j []byte
+	var err error
+	if args[0] == "-" {
+		j, err = io.ReadAll(os.Stdin)
+	} else {
+		j, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	var ex ipn.ProfileExport
+	if err := json.Unmarshal(j, &ex); err != nil {
+		return fmt.Errorf("invalid account export: %w", err)
+	}
+	if err := localClient.ImportProfile(ctx, &ex); err != nil {
+		return fmt.Errorf("failed to import account: %w", err)
+	}
+	printf("Imported account %q\n", cmp.Or(ex.Name, ex.NetworkProfile.DisplayNameOrDefault()))
+	outln("To log in, run:")
+	outln("  tailscale login")
+	return nil
+}
+
 func matchProfile(arg string, all []ipn.LoginProfile) (ipn.ProfileID, bool) {
 	// Allow matching by ID, Tailnet, Account, or Display Name
 	// in that order.
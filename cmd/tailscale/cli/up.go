@@ -4,6 +4,7 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -11,11 +12,13 @@
 	"flag"
 	"fmt"
 	"log"
+	"maps"
 	"net/netip"
 	"os"
 	"os/signal"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"syscall"
@@ -141,6 +144,7 @@ func newUpFlagSet(goos string, upArgs *upArgsT, cmd string) *flag.FlagSet {
 		// Some flags are only for "up", not "login".
 		upf.BoolVar(&upArgs.json, "json", false, "output in JSON format (WARNING: format subject to change)")
 		upf.BoolVar(&upArgs.reset, "reset", false, "reset unspecified settings to their default values")
+		upf.BoolVar(&upArgs.dryRun, "dry-run", false, "print the changes to settings that would be made, without making them")
 
 		// There's no --force-reauth flag on "login" because all login commands
 		// trigger a reauth.
@@ -177,6 +181,7 @@ type upArgsT struct {
 	qr                     bool
 	qrFormat               string
 	reset                  bool
+	dryRun                 bool
 	server                 string
 	acceptRoutes           bool
 	acceptDNS              bool
@@ -487,6 +492,101 @@ func updatePrefs(prefs, curPrefs *ipn.Prefs, env upCheckEnv) (simpleUp bool, jus
 	return simpleUp, justEditMP, nil
 }
 
+// dryRunPrefs returns the prefs that runUp would leave in effect, given
+// the flag-provided prefs, the currently active curPrefs, and the results
+// of updatePrefs.
+func dryRunPrefs(prefs, curPrefs *ipn.Prefs, simpleUp bool, justEditMP *ipn.MaskedPrefs) *ipn.Prefs {
+	switch {
+	case justEditMP != nil:
+		p := curPrefs.Clone()
+		p.ApplyEdits(justEditMP)
+		return p
+	case simpleUp:
+		p := curPrefs.Clone()
+		p.WantRunning = true
+		return p
+	}
+	// Start replaces the prefs wholesale but keeps the login state.
+	p := prefs.Clone()
+	p.Persist = curPrefs.Persist
+	return p
+}
+
+// prefsChange is a change to a single preference, as printed by
+// `tailscale up --dry-run`.
+type prefsChange struct {
+	Pref string          // name of the ipn.Prefs field
+	Old  json.RawMessage // JSON value before the change, or null if unset
+	New  json.RawMessage // JSON value after the change, or null if unset
+}
+
+// prefsChanges returns the changes from oldPrefs to newPrefs, sorted by
+// pref name. The Persist field isn't compared.
+func prefsChanges(oldPrefs, newPrefs *ipn.Prefs) []prefsChange {
+	fields := func(p *ipn.Prefs) map[string]json.RawMessage {
+		j, err := json.Marshal(p)
+		if err != nil {
+			panic(err) // can't happen; Prefs always marshal
+		}
+		m := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(j, &m); err != nil {
+			panic(err)
+		}
+		delete(m, "Config") // Persist
+		return m
+	}
+	oldFields, newFields := fields(oldPrefs), fields(newPrefs)
+	names := slices.Collect(maps.Keys(oldFields))
+	for name := range newFields {
+		if _, ok := oldFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	null := json.RawMessage("null")
+	var changes []prefsChange
+	for _, name := range names {
+		o, ok := oldFields[name]
+		if !ok {
+			o = null
+		}
+		n, ok := newFields[name]
+		if !ok {
+			n = null
+		}
+		if !bytes.Equal(o, n) {
+			changes = append(changes, prefsChange{Pref: name, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+// printPrefsChanges prints changes for `tailscale up --dry-run`, as a JSON
+// array if asJSON is set, or as one line per change otherwise.
+func printPrefsChanges(changes []prefsChange, asJSON bool) error {
+	if asJSON {
+		if changes == nil {
+			changes = []prefsChange{}
+		}
+		j, err := json.MarshalIndent(changes, "", "\t")
+		if err != nil {
+			return err
+		}
+		outln(string(j))
+		return nil
+	}
+	if len(changes) == 0 {
+		outln("No settings would change.")
+		return nil
+	}
+	outln("Settings that would change:")
+	for _, c := range changes {
+		printf("\t%s: %s -> %s\n", c.Pref, c.Old, c.New)
+	}
+	return nil
+}
+
 func presentSSHToggleRisk(wantSSH, haveSSH bool, acceptedRisks string) error {
 	if !isSSHOverTailscale() || wantSSH == haveSSH {
 		return nil
@@ -577,7 +677,7 @@ func runUp(ctx context.Context, cmd string, args []string, upArgs upArgsT) (retE
 	}
 
 	defer func() {
-		if retErr == nil {
+		if retErr == nil && !upArgs.dryRun {
 			checkUpWarnings(ctx)
 		}
 	}()
@@ -586,6 +686,13 @@ func runUp(ctx context.Context, cmd string, args []string, upArgs upArgsT) (retE
 	if err != nil {
 		fatalf("%s", err)
 	}
+	if upArgs.dryRun {
+		newPrefs := dryRunPrefs(prefs, curPrefs, simpleUp, justEditMP)
+		if err := localClient.CheckPrefs(ctx, newPrefs); err != nil {
+			return err
+		}
+		return printPrefsChanges(prefsChanges(curPrefs, newPrefs), upArgs.json)
+	}
 	if justEditMP != nil {
 		justEditMP.EggSet = egg
 		_, err := localClient.EditPrefs(ctx, justEditMP)
@@ -920,6 +1027,14 @@ func init() {
 	addPrefFlagMapping("relay-server-port", "RelayServerPort")
 	addPrefFlagMapping("sync", "Sync")
 	addPrefFlagMapping("relay-server-static-endpoints", "RelayServerStaticEndpoints")
+	addPrefFlagMapping("advertise-connected-subnets", "AdvertiseConnectedSubnets")
+	addPrefFlagMapping("connected-subnets-include", "ConnectedSubnetsInclude")
+	addPrefFlagMapping("connected-subnets-exclude", "ConnectedSubnetsExclude")
+	addPrefFlagMapping("exclude-app", "ExcludeApps")
+	addPrefFlagMapping("require-tunnel-app", "RequireTunnelApps")
+	addPrefFlagMapping("derp-home-region", "DERPHomeRegion")
+	addPrefFlagMapping("derp-deny-regions", "DERPDenyRegions")
+	addPrefFlagMapping("keep-warm", "KeepWarmPeers")
 }
 
 func addPrefFlagMapping(flagName string, prefNames ...string) {
@@ -942,7 +1057,7 @@ func addPrefFlagMapping(flagName string, prefNames ...string) {
 // correspond to an ipn.Pref.
 func preflessFlag(flagName string) bool {
 	switch flagName {
-	case "auth-key", "force-reauth", "reset", "qr", "qr-format", "json", "timeout", "accept-risk", "host-routes", "client-id", "audience", "client-secret", "id-token":
+	case "auth-key", "force-reauth", "reset", "dry-run", "qr", "qr-format", "json", "timeout", "accept-risk", "host-routes", "client-id", "audience", "client-secret", "id-token":
 		return true
 	}
 	return false
@@ -1241,7 +1356,7 @@ func exitNodeIP(p *ipn.Prefs, st *ipnstate.Status) (ip netip.Addr) {
 }
 
 func warnOnAdvertiseRoutes(ctx context.Context, prefs *ipn.Prefs) {
-	if buildfeatures.HasAdvertiseRoutes && len(prefs.AdvertiseRoutes) > 0 ||
+	if buildfeatures.HasAdvertiseRoutes && (len(prefs.AdvertiseRoutes) > 0 || prefs.AdvertiseConnectedSubnets) ||
 		buildfeatures.HasAppConnectors && prefs.AppConnector.Advertise {
 		// TODO(jwhited): compress CheckIPForwarding and CheckUDPGROForwarding
 		//  into a single HTTP req.
@@ -23,6 +23,7 @@
 	"advertise-routes",
 	"advertise-tags",
 	"auth-key",
+	"dry-run",
 	"exit-node",
 	"exit-node-allow-lan-access",
 	"force-reauth",
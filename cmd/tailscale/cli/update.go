@@ -15,6 +15,8 @@
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/clientupdate"
 	"tailscale.com/util/prompt"
+	"tailscale.com/util/syspolicy/pkey"
+	"tailscale.com/util/syspolicy/policyclient"
 	"tailscale.com/version"
 	"tailscale.com/version/distro"
 )
@@ -55,16 +57,18 @@ func init() {
 			runtime.GOOS != "darwin" {
 			fs.StringVar(&updateArgs.track, "track", "", `which track to check for updates: "stable", "release-candidate", or "unstable" (dev); empty means same as current`)
 			fs.StringVar(&updateArgs.version, "version", "", `explicit version to update/downgrade to`)
+			fs.BoolVar(&updateArgs.rollback, "rollback", false, "reinstall the version that was running before the most recent update")
 		}
 		return fs
 	})(),
 }
 
 var updateArgs struct {
-	yes     bool
-	dryRun  bool
-	track   string // explicit track; empty means same as current
-	version string // explicit version; empty means auto
+	yes      bool
+	dryRun   bool
+	track    string // explicit track; empty means same as current
+	version  string // explicit version; empty means auto
+	rollback bool
 }
 
 func runUpdate(ctx context.Context, args []string) error {
@@ -74,13 +78,25 @@ func runUpdate(ctx context.Context, args []string) error {
 	if updateArgs.version != "" && updateArgs.track != "" {
 		return errors.New("cannot specify both --version and --track")
 	}
+	if updateArgs.rollback && (updateArgs.version != "" || updateArgs.track != "") {
+		return errors.New("cannot combine --rollback with --version or --track")
+	}
+	polc := policyclient.Get()
+	if updateArgs.rollback {
+		if allow, _ := polc.GetBoolean(pkey.AllowUpdateRollback, true); !allow {
+			return errors.New("rollbacks are disabled by system policy")
+		}
+	}
+	pin, _ := polc.GetString(pkey.UpdateTrack, "")
 	err := clientupdate.Update(clientupdate.Arguments{
-		Version: updateArgs.version,
-		Track:   updateArgs.track,
-		Logf:    func(f string, a ...any) { printf(f+"\n", a...) },
-		Stdout:  Stdout,
-		Stderr:  Stderr,
-		Confirm: confirmUpdate,
+		Version:  updateArgs.version,
+		Track:    updateArgs.track,
+		Rollback: updateArgs.rollback,
+		Pin:      pin,
+		Logf:     func(f string, a ...any) { printf(f+"\n", a...) },
+		Stdout:   Stdout,
+		Stderr:   Stderr,
+		Confirm:  confirmUpdate,
 	})
 	if errors.Is(err, errors.ErrUnsupported) {
 		return errors.New("The 'update' command is not supported on this platform; see https://tailscale.com/s/client-updates")
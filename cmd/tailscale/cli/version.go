@@ -5,11 +5,11 @@
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/cmd/tailscale/cli/jsonoutput"
 	"tailscale.com/feature"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/version"
@@ -22,7 +22,8 @@
 	FlagSet: (func() *flag.FlagSet {
 		fs := newFlagSet("version")
 		fs.BoolVar(&versionArgs.daemon, "daemon", false, "also print local node's daemon version")
-		fs.BoolVar(&versionArgs.json, "json", false, "output in JSON format")
+		fs.BoolVar(&versionArgs.json, "json", false, "output in JSON format; same as --output=json")
+		fs.Var(&versionArgs.output, "output", outputFlagUsage)
 		fs.BoolVar(&versionArgs.upstream, "upstream", false, "fetch and print the latest upstream release version from pkgs.tailscale.com")
 		fs.StringVar(&versionArgs.track, "track", "", `which track to check for updates: "stable", "release-candidate", or "unstable" (dev); empty means same as current`)
 		return fs
@@ -33,17 +34,31 @@
 var versionArgs struct {
 	daemon   bool // also check local node's daemon version
 	json     bool
+	output   jsonoutput.Format
 	upstream bool
 	track    string
 }
 
+func init() {
+	registerOutputSchema[versionOutput]("version", 1)
+}
+
+// versionOutput is the machine-readable output of "tailscale version".
+type versionOutput struct {
+	version.Meta
+	Upstream string `json:"upstream,omitempty"`
+}
+
 var clientupdateLatestTailscaleVersion feature.Hook[func(string) (string, error)]
 
 func runVersion(ctx context.Context, args []string) error {
 	if len(args) > 0 {
 		return fmt.Errorf("too many non-flag arguments: %q", args)
 	}
-	var err error
+	output, err := outputFormat(versionArgs.output, versionArgs.json)
+	if err != nil {
+		return err
+	}
 	var st *ipnstate.Status
 
 	if versionArgs.daemon {
@@ -65,21 +80,15 @@ func runVersion(ctx context.Context, args []string) error {
 		}
 	}
 
-	if versionArgs.json {
+	if output.IsMachineReadable() {
 		m := version.GetMeta()
 		if st != nil {
 			m.DaemonLong = st.Version
 		}
-		out := struct {
-			version.Meta
-			Upstream string `json:"upstream,omitempty"`
-		}{
+		return jsonoutput.Write(Stdout, output, versionOutput{
 			Meta:     m,
 			Upstream: upstreamVer,
-		}
-		e := json.NewEncoder(Stdout)
-		e.SetIndent("", "\t")
-		return e.Encode(out)
+		})
 	}
 
 	if st == nil {
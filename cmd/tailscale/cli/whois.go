@@ -13,11 +13,13 @@
 	"text/tabwriter"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/cmd/tailscale/cli/jsonoutput"
 )
 
 var whoisCmd = &ffcli.Command{
 	Name:       "whois",
-	ShortUsage: "tailscale whois [--json] ip[:port]",
+	ShortUsage: "tailscale whois [--json | --output=<format>] ip[:port]",
 	ShortHelp:  "Show the machine and user associated with a Tailscale IP (v4 or v6)",
 	LongHelp: strings.TrimSpace(`
 	'tailscale whois' shows the machine and user associated with a Tailscale IP (v4 or v6).
@@ -25,15 +27,21 @@
 	Exec: runWhoIs,
 	FlagSet: func() *flag.FlagSet {
 		fs := newFlagSet("whois")
-		fs.BoolVar(&whoIsArgs.json, "json", false, "output in JSON format")
+		fs.BoolVar(&whoIsArgs.json, "json", false, "output in JSON format; same as --output=json")
+		fs.Var(&whoIsArgs.output, "output", outputFlagUsage)
 		fs.StringVar(&whoIsArgs.proto, "proto", "", `protocol; one of "tcp" or "udp"; empty means both`)
 		return fs
 	}(),
 }
 
 var whoIsArgs struct {
-	json  bool   // output in JSON format
-	proto string // "tcp" or "udp"
+	json   bool // output in JSON format
+	output jsonoutput.Format
+	proto  string // "tcp" or "udp"
+}
+
+func init() {
+	registerOutputSchema[apitype.WhoIsResponse]("whois", 1)
 }
 
 func runWhoIs(ctx context.Context, args []string) error {
@@ -42,15 +50,16 @@ func runWhoIs(ctx context.Context, args []string) error {
 	} else if len(args) == 0 {
 		return errors.New("missing argument, expected one peer")
 	}
+	output, err := outputFormat(whoIsArgs.output, whoIsArgs.json)
+	if err != nil {
+		return err
+	}
 	who, err := localClient.WhoIsProto(ctx, whoIsArgs.proto, args[0])
 	if err != nil {
 		return err
 	}
-	if whoIsArgs.json {
-		ec := json.NewEncoder(Stdout)
-		ec.SetIndent("", "  ")
-		ec.Encode(who)
-		return nil
+	if output.IsMachineReadable() {
+		return jsonoutput.Write(Stdout, output, who)
 	}
 
 	w := tabwriter.NewWriter(Stdout, 10, 5, 5, ' ', 0)
@@ -93,6 +93,94 @@ func TestOmitDrive(t *testing.T) {
 	}.Check(t)
 }
 
+func TestOmitServe(t *testing.T) {
+	const msg = "unexpected with ts_omit_serve"
+	deptest.DepChecker{
+		GOOS:   "linux",
+		GOARCH: "amd64",
+		Tags:   "ts_omit_serve,ts_include_cli",
+		BadDeps: map[string]string{
+			"github.com/pires/go-proxyproto": msg,
+		},
+	}.Check(t)
+}
+
+func TestOmitTaildrop(t *testing.T) {
+	const msg = "unexpected with ts_omit_taildrop"
+	deptest.DepChecker{
+		GOOS:   "linux",
+		GOARCH: "amd64",
+		Tags:   "ts_omit_taildrop,ts_include_cli",
+		BadDeps: map[string]string{
+			"tailscale.com/feature/taildrop":      msg,
+			"tailscale.com/util/progresstracking": msg,
+			"tailscale.com/util/quarantine":       msg,
+		},
+	}.Check(t)
+}
+
+func TestOmitDERPBroker(t *testing.T) {
+	deptest.DepChecker{
+		GOOS:   "linux",
+		GOARCH: "amd64",
+		Tags:   "ts_omit_derpbroker,ts_omit_debug",
+		// derphttp itself is still needed to talk to DERP servers, so
+		// check that tailscaled doesn't import it to serve a broker.
+		OnImport: func(pkg string) {
+			if pkg == "tailscale.com/derp/derphttp" {
+				t.Errorf("unexpected import with ts_omit_derpbroker: %q", pkg)
+			}
+		},
+	}.Check(t)
+}
+
+func TestOmitDERPTelemetry(t *testing.T) {
+	const msg = "unexpected with ts_omit_derptelemetry"
+	deptest.DepChecker{
+		GOOS:   "linux",
+		GOARCH: "amd64",
+		Tags:   "ts_omit_derptelemetry,ts_include_cli",
+		BadDeps: map[string]string{
+			"tailscale.com/derp/derplatency":      msg,
+			"tailscale.com/feature/derptelemetry": msg,
+		},
+	}.Check(t)
+}
+
+func TestOmitHostinfoAttrs(t *testing.T) {
+	deptest.DepChecker{
+		GOOS:   "linux",
+		GOARCH: "amd64",
+		Tags:   "ts_omit_hostinfoattrs,ts_include_cli",
+		BadDeps: map[string]string{
+			"tailscale.com/feature/hostinfoattrs": "unexpected with ts_omit_hostinfoattrs",
+		},
+	}.Check(t)
+}
+
+func TestOmitLocalAPIWebSocket(t *testing.T) {
+	deptest.DepChecker{
+		GOOS:   "linux",
+		GOARCH: "amd64",
+		// The eventbus debugger uses websockets too.
+		Tags: "ts_omit_localapiwebsocket,ts_omit_debugeventbus",
+		BadDeps: map[string]string{
+			"github.com/coder/websocket": "unexpected with ts_omit_localapiwebsocket",
+		},
+	}.Check(t)
+}
+
+func TestOmitMDNSGateway(t *testing.T) {
+	deptest.DepChecker{
+		GOOS:   "linux",
+		GOARCH: "amd64",
+		Tags:   "ts_omit_mdnsgateway,ts_include_cli",
+		BadDeps: map[string]string{
+			"tailscale.com/net/dns/mdnsgw": "unexpected with ts_omit_mdnsgateway",
+		},
+	}.Check(t)
+}
+
 func TestOmitPortmapper(t *testing.T) {
 	deptest.DepChecker{
 		GOOS:   "linux",
@@ -9,6 +9,8 @@
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"io"
 	"log"
@@ -16,6 +18,7 @@
 	"net/http"
 	"net/http/httputil"
 	"strings"
+	"sync"
 
 	"tailscale.com/feature"
 	"tailscale.com/net/proxymux"
@@ -32,6 +35,7 @@ func init() {
 func registerOutboundProxyFlags() {
 	flag.StringVar(&args.socksAddr, "socks5-server", "", `optional [ip]:port to run a SOCK5 server (e.g. "localhost:1080")`)
 	flag.StringVar(&args.httpProxyAddr, "outbound-http-proxy-listen", "", `optional [ip]:port to run an outbound HTTP proxy (e.g. "localhost:8080")`)
+	flag.StringVar(&args.httpProxyPolicy, "outbound-http-proxy-policy", "", "optional path to a JSON file of per-user rules for the outbound HTTP proxy; clients are identified by local user ID when connecting over loopback on Linux, by basic auth, or by TLS client certificate")
 }
 
 // outboundProxyListen creates listeners for local SOCKS and HTTP proxies, if
@@ -48,12 +52,25 @@ func registerOutboundProxyFlags() {
 func outboundProxyListen() proxyStartFunc {
 	socksAddr, httpAddr := args.socksAddr, args.httpProxyAddr
 
+	var policy *proxyPolicy
+	if args.httpProxyPolicy != "" {
+		if httpAddr == "" {
+			log.Fatalf("--outbound-http-proxy-policy requires --outbound-http-proxy-listen")
+		}
+		var err error
+		policy, err = loadProxyPolicy(args.httpProxyPolicy)
+		if err != nil {
+			log.Fatalf("HTTP proxy policy: %v", err)
+		}
+	}
+
 	if socksAddr == httpAddr && socksAddr != "" && !strings.HasSuffix(socksAddr, ":0") {
 		ln, err := net.Listen("tcp", socksAddr)
 		if err != nil {
 			log.Fatalf("proxy listener: %v", err)
 		}
-		return mkProxyStartFunc(proxymux.SplitSOCKSAndHTTP(ln))
+		socksListener, httpListener := proxymux.SplitSOCKSAndHTTP(ln)
+		return mkProxyStartFunc(socksListener, httpListener, policy)
 	}
 
 	var socksListener, httpListener net.Listener
@@ -81,14 +98,25 @@ func outboundProxyListen() proxyStartFunc {
 		}
 	}
 
-	return mkProxyStartFunc(socksListener, httpListener)
+	return mkProxyStartFunc(socksListener, httpListener, policy)
 }
 
-func mkProxyStartFunc(socksListener, httpListener net.Listener) proxyStartFunc {
+// mkProxyStartFunc returns a proxyStartFunc serving on the given listeners.
+// If policy is non-nil, it's applied to requests to the HTTP proxy.
+func mkProxyStartFunc(socksListener, httpListener net.Listener, policy *proxyPolicy) proxyStartFunc {
 	return func(logf logger.Logf, dialer *tsdial.Dialer) {
 		var addrs []string
 		if httpListener != nil {
+			if policy != nil && policy.tlsConfig != nil {
+				httpListener = tls.NewListener(httpListener, policy.tlsConfig)
+			}
 			hs := &http.Server{Handler: httpProxyHandler(dialer.UserDial)}
+			if policy != nil {
+				hs = &http.Server{
+					Handler:     policy.handler(logger.WithPrefix(logf, "http-proxy: "), dialer.UserDial, dialer.SystemDial),
+					ConnContext: proxyConnContext,
+				}
+			}
 			go func() {
 				log.Fatalf("HTTP proxy exited: %v", hs.Serve(httpListener))
 			}()
@@ -112,28 +140,70 @@ func mkProxyStartFunc(socksListener, httpListener net.Listener) proxyStartFunc {
 
 // httpProxyHandler returns an HTTP proxy http.Handler using the
 // provided backend dialer.
-func httpProxyHandler(dialer func(ctx context.Context, netw, addr string) (net.Conn, error)) http.Handler {
-	rp := &httputil.ReverseProxy{
-		Director: func(r *http.Request) {}, // no change
-		Transport: &http.Transport{
-			DialContext: dialer,
-		},
+func httpProxyHandler(dialer proxyDialFunc) http.Handler {
+	return httpProxyHandlerFor(func(*http.Request) (proxyRoute, error) {
+		return proxyRoute{dial: dialer}, nil
+	})
+}
+
+type proxyDialFunc = func(ctx context.Context, netw, addr string) (net.Conn, error)
+
+// proxyRoute is a way for the HTTP proxy to reach a request's destination.
+type proxyRoute struct {
+	// name identifies the route among those returned by a
+	// httpProxyHandlerFor route func. Connections are only reused
+	// between requests with the same route.
+	name string
+	dial proxyDialFunc
+}
+
+// httpProxyHandlerFor returns an HTTP proxy http.Handler which sends each
+// request along the route returned by route. If route returns an error, the
+// request is rejected as forbidden, or as needing proxy authentication if
+// the error is errProxyAuth.
+func httpProxyHandlerFor(route func(*http.Request) (proxyRoute, error)) http.Handler {
+	var mu sync.Mutex
+	proxies := map[string]*httputil.ReverseProxy{} // by proxyRoute.name
+	reverseProxy := func(rt proxyRoute) *httputil.ReverseProxy {
+		mu.Lock()
+		defer mu.Unlock()
+		rp, ok := proxies[rt.name]
+		if !ok {
+			rp = &httputil.ReverseProxy{
+				Director: func(r *http.Request) {}, // no change
+				Transport: &http.Transport{
+					DialContext: rt.dial,
+				},
+			}
+			proxies[rt.name] = rp
+		}
+		return rp
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, err := route(r)
+		if errors.Is(err, errProxyAuth) {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="tailscale"`)
+			http.Error(w, err.Error(), http.StatusProxyAuthRequired)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		if r.Method != "CONNECT" {
 			backURL := r.RequestURI
 			if strings.HasPrefix(backURL, "/") || backURL == "*" {
 				http.Error(w, "bogus RequestURI; must be absolute URL or CONNECT", 400)
 				return
 			}
-			rp.ServeHTTP(w, r)
+			reverseProxy(rt).ServeHTTP(w, r)
 			return
 		}
 
 		// CONNECT support:
 
 		dst := r.RequestURI
-		c, err := dialer(r.Context(), "tcp", dst)
+		c, err := rt.dial(r.Context(), "tcp", dst)
 		if err != nil {
 			w.Header().Set("Tailscale-Connect-Error", err.Error())
 			http.Error(w, err.Error(), 500)
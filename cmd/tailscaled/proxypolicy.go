@@ -0,0 +1,585 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_outboundproxy
+
+// Per-user policy for the outbound HTTP proxy.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/types/logger"
+	"tailscale.com/util/osuser"
+)
+
+// proxyPolicy is the per-user policy of the outbound HTTP proxy, as read
+// from the --outbound-http-proxy-policy file. For example:
+//
+//	{
+//	  "RequireLocalUser": true,
+//	  "Rules": [
+//	    {"Users": ["group:ml"], "Hosts": ["*"], "Action": "tailscale", "Via": "100.101.102.103:8080"},
+//	    {"Users": ["alice", "1001"], "Hosts": ["*.corp.example.com", "10.0.0.0/8"], "Action": "tailscale"},
+//	    {"Users": ["*"], "Hosts": ["*.corp.example.com"], "Action": "deny"}
+//	  ],
+//	  "Default": "direct"
+//	}
+//
+// Clients other than local users can be identified by HTTP basic auth or,
+// if the proxy is served over TLS, by client certificates:
+//
+//	{
+//	  "RequireAuth": true,
+//	  "BasicAuth": [{"Name": "ci", "PasswordSHA256": "<hex SHA-256 of the password>"}],
+//	  "TLS": {"CertFile": "proxy.crt", "KeyFile": "proxy.key", "ClientCAFile": "clients.pem"},
+//	  "Rules": [
+//	    {"Users": ["basic:ci"], "Hosts": ["*.corp.example.com"], "Action": "tailscale"},
+//	    {"Users": ["cert:build-agent"], "Hosts": ["10.0.0.0/8"], "Action": "tailscale"}
+//	  ],
+//	  "Default": "deny"
+//	}
+type proxyPolicy struct {
+	// RequireLocalUser is whether to reject requests from clients which
+	// can't be identified as a local user. Clients can only be identified
+	// when they connect over loopback, on Linux.
+	RequireLocalUser bool `json:",omitempty"`
+
+	// RequireAuth is whether to reject requests from clients which aren't
+	// identified as a local user, by basic auth, or by a client
+	// certificate. Such requests get a 407 response asking for basic auth
+	// if BasicAuth is non-empty.
+	RequireAuth bool `json:",omitempty"`
+
+	// BasicAuth are the users which may authenticate to the proxy with
+	// HTTP basic auth, in a Proxy-Authorization header. Rules refer to
+	// them as "basic:<name>".
+	BasicAuth []proxyBasicUser `json:",omitempty"`
+
+	// TLS, if non-nil, configures the proxy to be served over TLS instead
+	// of plain HTTP.
+	TLS *proxyTLS `json:",omitempty"`
+
+	// Rules are the policy's rules. The first rule matching a request's
+	// user and destination decides what happens to it.
+	Rules []proxyRule
+
+	// Default is the action for requests which match no rule. If empty,
+	// it's proxyActionTailscale, which is the proxy's behavior without a
+	// policy.
+	Default proxyAction `json:",omitempty"`
+
+	tlsConfig *tls.Config // from TLS, if non-nil; set by loadProxyPolicy
+}
+
+// proxyBasicUser is a user of a proxyPolicy which authenticates with HTTP
+// basic auth.
+type proxyBasicUser struct {
+	Name string
+
+	// PasswordSHA256 is the hex SHA-256 hash of the user's password, as
+	// printed by "printf %s <password> | sha256sum".
+	PasswordSHA256 string
+}
+
+// proxyTLS is the TLS configuration of a proxyPolicy. Relative paths are
+// relative to tailscaled's working directory.
+type proxyTLS struct {
+	CertFile string // PEM certificate chain of the proxy
+	KeyFile  string // PEM private key of the proxy
+
+	// ClientCAFile, if non-empty, is a PEM file of CA certificates to
+	// verify client certificates with. Clients presenting a certificate
+	// signed by one of them are identified by its subject common name,
+	// which rules refer to as "cert:<common name>".
+	ClientCAFile string `json:",omitempty"`
+
+	// RequireClientCert is whether to reject TLS connections without a
+	// valid client certificate. It requires ClientCAFile.
+	RequireClientCert bool `json:",omitempty"`
+}
+
+// proxyRule is a rule of a proxyPolicy.
+type proxyRule struct {
+	// Users are the users the rule applies to: user names, numeric user
+	// IDs, "group:<name-or-gid>" for members of a group, or "*" for any
+	// client, including unidentified ones.
+	//
+	// Users may also be "basic:<name>" for a BasicAuth user and
+	// "cert:<common name>" for a client certificate.
+	Users []string
+
+	// Hosts are the destinations the rule applies to: DNS names, which
+	// may start with "*." to match subdomains, IP addresses, CIDR
+	// prefixes, or "*" for any destination. Empty means any destination.
+	Hosts []string `json:",omitempty"`
+
+	// Action is what to do with matching requests.
+	Action proxyAction
+
+	// Via, if non-empty, is the ip:port of an HTTP proxy reachable over
+	// the tailnet to send matching requests through, with Action
+	// proxyActionTailscale. Pointing it at the --outbound-http-proxy-listen
+	// address of another node makes that node the requests' exit node,
+	// independent of this node's exit node.
+	Via string `json:",omitempty"`
+}
+
+// proxyAction is what the proxy does with a request.
+type proxyAction string
+
+const (
+	// proxyActionTailscale dials the destination as tailscaled would dial
+	// on behalf of a user: over the tailnet for tailnet addresses and
+	// routes, including via the exit node if one is in use.
+	proxyActionTailscale proxyAction = "tailscale"
+
+	// proxyActionDirect dials the destination using the system's
+	// network stack, bypassing Tailscale.
+	proxyActionDirect proxyAction = "direct"
+
+	// proxyActionDeny rejects the request.
+	proxyActionDeny proxyAction = "deny"
+)
+
+// loadProxyPolicy reads and validates the proxy policy in the named file.
+func loadProxyPolicy(path string) (*proxyPolicy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := new(proxyPolicy)
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid proxy policy %s: %w", path, err)
+	}
+	if p.TLS != nil {
+		if p.tlsConfig, err = p.TLS.config(); err != nil {
+			return nil, fmt.Errorf("proxy policy %s: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+// config returns the tls.Config for serving the proxy.
+func (t *proxyTLS) config() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("TLS certificate: %w", err)
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if t.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("TLS client CAs: %w", err)
+		}
+		conf.ClientCAs = x509.NewCertPool()
+		if !conf.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS client CAs: no certificates in %s", t.ClientCAFile)
+		}
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		if t.RequireClientCert {
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return conf, nil
+}
+
+func (p *proxyPolicy) validate() error {
+	if p.Default == "" {
+		p.Default = proxyActionTailscale
+	}
+	if !p.Default.valid() {
+		return fmt.Errorf("unknown default action %q", p.Default)
+	}
+	basicUsers := map[string]bool{}
+	for i, u := range p.BasicAuth {
+		if u.Name == "" || strings.Contains(u.Name, ":") {
+			return fmt.Errorf("basic auth user %d: invalid name %q", i, u.Name)
+		}
+		if basicUsers[u.Name] {
+			return fmt.Errorf("basic auth user %q listed more than once", u.Name)
+		}
+		basicUsers[u.Name] = true
+		if h, err := hex.DecodeString(u.PasswordSHA256); err != nil || len(h) != sha256.Size {
+			return fmt.Errorf("basic auth user %q: PasswordSHA256 is not a hex SHA-256 hash", u.Name)
+		}
+	}
+	if t := p.TLS; t != nil {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return errors.New("TLS requires CertFile and KeyFile")
+		}
+		if t.RequireClientCert && t.ClientCAFile == "" {
+			return errors.New("TLS RequireClientCert requires ClientCAFile")
+		}
+	}
+	for i, r := range p.Rules {
+		if !r.Action.valid() {
+			return fmt.Errorf("rule %d: unknown action %q", i, r.Action)
+		}
+		if len(r.Users) == 0 {
+			return fmt.Errorf("rule %d: no users", i)
+		}
+		for _, u := range r.Users {
+			if name, ok := strings.CutPrefix(u, "basic:"); ok && !basicUsers[name] {
+				return fmt.Errorf("rule %d: unknown basic auth user %q", i, name)
+			}
+			if strings.HasPrefix(u, "cert:") && (p.TLS == nil || p.TLS.ClientCAFile == "") {
+				return fmt.Errorf("rule %d: user %q requires TLS with ClientCAFile", i, u)
+			}
+		}
+		if r.Via != "" {
+			if r.Action != proxyActionTailscale {
+				return fmt.Errorf("rule %d: Via requires action %q", i, proxyActionTailscale)
+			}
+			if _, err := netip.ParseAddrPort(r.Via); err != nil {
+				return fmt.Errorf("rule %d: Via: %w", i, err)
+			}
+		}
+		for _, h := range r.Hosts {
+			if strings.Contains(h, "/") {
+				if _, err := netip.ParsePrefix(h); err != nil {
+					return fmt.Errorf("rule %d: host %q: %w", i, h, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (a proxyAction) valid() bool {
+	switch a {
+	case proxyActionTailscale, proxyActionDirect, proxyActionDeny:
+		return true
+	}
+	return false
+}
+
+// match returns the rule applying to a request from id for host, which is
+// a DNS name or IP address without a port, or nil if no rule matches.
+func (p *proxyPolicy) match(id *proxyIdentity, host string) *proxyRule {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.matchesUser(id) && r.matchesHost(host) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (r *proxyRule) matchesUser(id *proxyIdentity) bool {
+	for _, u := range r.Users {
+		if u == "*" {
+			return true
+		}
+		if name, ok := strings.CutPrefix(u, "basic:"); ok {
+			if id.basicUser != "" && name == id.basicUser {
+				return true
+			}
+			continue
+		}
+		if name, ok := strings.CutPrefix(u, "cert:"); ok {
+			if id.certName != "" && name == id.certName {
+				return true
+			}
+			continue
+		}
+		c := id.local
+		if !c.identified() {
+			continue
+		}
+		if g, ok := strings.CutPrefix(u, "group:"); ok {
+			if c.inGroup(g) {
+				return true
+			}
+			continue
+		}
+		if u == c.uid || u == c.username {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *proxyRule) matchesHost(host string) bool {
+	if len(r.Hosts) == 0 {
+		return true
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	ip, ipErr := netip.ParseAddr(host)
+	for _, h := range r.Hosts {
+		switch {
+		case h == "*":
+			return true
+		case strings.Contains(h, "/"):
+			if pfx, err := netip.ParsePrefix(h); err == nil && ipErr == nil && pfx.Contains(ip) {
+				return true
+			}
+		case strings.HasPrefix(h, "*."):
+			if strings.HasSuffix(host, strings.ToLower(h[1:])) {
+				return true
+			}
+		default:
+			if strings.EqualFold(strings.TrimSuffix(h, "."), host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyClient is the local user on the other end of a connection to the
+// proxy, if known.
+type proxyClient struct {
+	uid      string // numeric; empty if unidentified
+	username string // empty if unknown
+
+	groupsOnce sync.Once
+	gids       []string
+	groupNames []string
+}
+
+func (c *proxyClient) identified() bool { return c != nil && c.uid != "" }
+
+func (c *proxyClient) String() string {
+	if !c.identified() {
+		return "unidentified client"
+	}
+	if c.username != "" {
+		return fmt.Sprintf("user %s (uid %s)", c.username, c.uid)
+	}
+	return "uid " + c.uid
+}
+
+// inGroup reports whether c is a member of the group with the given name
+// or numeric ID.
+func (c *proxyClient) inGroup(group string) bool {
+	c.groupsOnce.Do(func() {
+		u, err := user.LookupId(c.uid)
+		if err != nil {
+			return
+		}
+		c.gids, _ = osuser.GetGroupIds(u)
+		for _, gid := range c.gids {
+			if g, err := user.LookupGroupId(gid); err == nil {
+				c.groupNames = append(c.groupNames, g.Name)
+			}
+		}
+	})
+	return slices.Contains(c.gids, group) || slices.Contains(c.groupNames, group)
+}
+
+// proxyIdentity is who made a request to the proxy, as far as known.
+type proxyIdentity struct {
+	local     *proxyClient // of the connection; nil or unidentified if unknown
+	basicUser string       // name of the authenticated basic auth user, if any
+	certName  string       // common name of the verified client certificate, if any
+}
+
+// authenticated reports whether the requester was identified by any means.
+func (id *proxyIdentity) authenticated() bool {
+	return id.local.identified() || id.basicUser != "" || id.certName != ""
+}
+
+func (id *proxyIdentity) String() string {
+	var parts []string
+	if id.basicUser != "" {
+		parts = append(parts, "basic auth user "+id.basicUser)
+	}
+	if id.certName != "" {
+		parts = append(parts, fmt.Sprintf("client cert %q", id.certName))
+	}
+	if id.local.identified() || len(parts) == 0 {
+		parts = append(parts, id.local.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// errProxyAuth is returned by proxyPolicy.identify for requests with bad or
+// missing credentials.
+var errProxyAuth = errors.New("proxy authentication required")
+
+// identify returns the identity of the requester of r. It returns
+// errProxyAuth if r has invalid basic auth credentials.
+func (p *proxyPolicy) identify(r *http.Request) (*proxyIdentity, error) {
+	id := &proxyIdentity{}
+	id.local, _ = r.Context().Value(proxyClientKey{}).(*proxyClient)
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		id.certName = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	if auth := r.Header.Get("Proxy-Authorization"); auth != "" {
+		name, ok := p.checkBasicAuth(auth)
+		if !ok {
+			return nil, errProxyAuth
+		}
+		id.basicUser = name
+	}
+	return id, nil
+}
+
+// checkBasicAuth returns the name of the BasicAuth user authenticated by
+// the Proxy-Authorization header value auth, and whether it's valid.
+func (p *proxyPolicy) checkBasicAuth(auth string) (name string, ok bool) {
+	scheme, enc, _ := strings.Cut(auth, " ")
+	if !strings.EqualFold(scheme, "Basic") {
+		return "", false
+	}
+	dec, err := base64.StdEncoding.DecodeString(strings.TrimSpace(enc))
+	if err != nil {
+		return "", false
+	}
+	name, password, ok := strings.Cut(string(dec), ":")
+	if !ok {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(password))
+	for _, u := range p.BasicAuth {
+		want, _ := hex.DecodeString(u.PasswordSHA256) // checked by validate
+		if u.Name == name && subtle.ConstantTimeCompare(sum[:], want) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+type proxyClientKey struct{}
+
+// proxyConnContext is an http.Server.ConnContext func which identifies the
+// local user connecting to the proxy, for use by proxyPolicy.handler.
+func proxyConnContext(ctx context.Context, c net.Conn) context.Context {
+	client := new(proxyClient)
+	local, lerr := netip.ParseAddrPort(c.LocalAddr().String())
+	remote, rerr := netip.ParseAddrPort(c.RemoteAddr().String())
+	if lerr == nil && rerr == nil && remote.Addr().Unmap().IsLoopback() {
+		if uid, err := loopbackConnUID(local, remote); err == nil {
+			client.uid = strconv.FormatUint(uint64(uid), 10)
+			if u, err := user.LookupId(client.uid); err == nil {
+				client.username = u.Username
+			}
+		}
+	}
+	return context.WithValue(ctx, proxyClientKey{}, client)
+}
+
+// handler returns an HTTP proxy http.Handler which applies p to each
+// request, dialing with userDial (for proxyActionTailscale) or systemDial
+// (for proxyActionDirect). The http.Server must use proxyConnContext.
+func (p *proxyPolicy) handler(logf logger.Logf, userDial, systemDial proxyDialFunc) http.Handler {
+	direct := proxyRoute{name: string(proxyActionDirect), dial: systemDial}
+	viaTailscale := proxyRoute{name: string(proxyActionTailscale), dial: userDial}
+	return httpProxyHandlerFor(func(r *http.Request) (proxyRoute, error) {
+		id, err := p.identify(r)
+		if err != nil {
+			logf("rejected %s request with bad credentials from %v", r.Method, r.RemoteAddr)
+			return proxyRoute{}, err
+		}
+		if p.RequireLocalUser && !id.local.identified() {
+			return proxyRoute{}, errors.New("proxy requires an identifiable local user")
+		}
+		if p.RequireAuth && !id.authenticated() {
+			if len(p.BasicAuth) > 0 {
+				return proxyRoute{}, errProxyAuth
+			}
+			return proxyRoute{}, errors.New("proxy requires an authenticated client")
+		}
+
+		host := r.URL.Hostname()
+		if r.Method == "CONNECT" {
+			host, _, _ = net.SplitHostPort(r.RequestURI)
+		}
+
+		action, via := p.Default, ""
+		if rule := p.match(id, host); rule != nil {
+			action, via = rule.Action, rule.Via
+		}
+		switch action {
+		case proxyActionDeny:
+			logf("denied %s request for %q from %v", r.Method, host, id)
+			return proxyRoute{}, fmt.Errorf("proxy policy denies access to %q", host)
+		case proxyActionDirect:
+			return direct, nil
+		}
+		if via != "" {
+			return proxyRoute{name: "via " + via, dial: viaHTTPProxy(userDial, via)}, nil
+		}
+		return viaTailscale, nil
+	})
+}
+
+// viaHTTPProxy returns a dial func which connects to its destination
+// through a CONNECT request to the HTTP proxy at proxyAddr, itself dialed
+// with dial.
+func viaHTTPProxy(dial proxyDialFunc, proxyAddr string) proxyDialFunc {
+	return func(ctx context.Context, netw, addr string) (_ net.Conn, retErr error) {
+		c, err := dial(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if retErr != nil {
+				c.Close()
+			}
+		}()
+		if d, ok := ctx.Deadline(); ok {
+			c.SetDeadline(d)
+			defer c.SetDeadline(time.Time{})
+		}
+		req := &http.Request{
+			Method: "CONNECT",
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: make(http.Header),
+		}
+		if err := req.Write(c); err != nil {
+			return nil, fmt.Errorf("writing CONNECT to proxy %s: %w", proxyAddr, err)
+		}
+		br := bufio.NewReader(c)
+		res, err := http.ReadResponse(br, req)
+		if err != nil {
+			return nil, fmt.Errorf("reading CONNECT response from proxy %s: %w", proxyAddr, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("proxy %s: CONNECT %s: %s", proxyAddr, addr, res.Status)
+		}
+		if br.Buffered() > 0 {
+			// The destination spoke first and it was read along with the
+			// response; don't lose it.
+			return &bufferedConn{Conn: c, r: br}, nil
+		}
+		return c, nil
+	}
+}
+
+// bufferedConn is a net.Conn whose reads start with data already buffered
+// in r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
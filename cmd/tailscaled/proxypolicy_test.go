@@ -0,0 +1,223 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_outboundproxy
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyPolicyMatch(t *testing.T) {
+	p := &proxyPolicy{
+		Rules: []proxyRule{
+			{Users: []string{"alice"}, Hosts: []string{"*.corp.example.com", "10.0.0.0/8"}, Action: proxyActionTailscale},
+			{Users: []string{"1002"}, Hosts: []string{"db.example.com"}, Action: proxyActionTailscale, Via: "100.64.0.1:8080"},
+			{Users: []string{"*"}, Hosts: []string{"*.corp.example.com"}, Action: proxyActionDeny},
+		},
+		Default: proxyActionDirect,
+	}
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &proxyIdentity{local: &proxyClient{uid: "1001", username: "alice"}}
+	bob := &proxyIdentity{local: &proxyClient{uid: "1002", username: "bob"}}
+	unknown := &proxyIdentity{local: &proxyClient{}}
+	nilClient := &proxyIdentity{}
+
+	tests := []struct {
+		client *proxyIdentity
+		host   string
+		want   int // index of matching rule, or -1 for none
+	}{
+		{alice, "git.corp.example.com", 0},
+		{alice, "GIT.corp.example.com.", 0},
+		{alice, "10.1.2.3", 0},
+		{alice, "11.1.2.3", -1},
+		{alice, "corp.example.com", -1},
+		{bob, "git.corp.example.com", 2},
+		{bob, "db.example.com", 1},
+		{alice, "db.example.com", -1},
+		{unknown, "git.corp.example.com", 2},
+		{nilClient, "git.corp.example.com", 2},
+		{unknown, "db.example.com", -1},
+	}
+	for _, tt := range tests {
+		got := p.match(tt.client, tt.host)
+		want := (*proxyRule)(nil)
+		if tt.want >= 0 {
+			want = &p.Rules[tt.want]
+		}
+		if got != want {
+			t.Errorf("match(%v, %q) = %+v; want %+v", tt.client, tt.host, got, want)
+		}
+	}
+}
+
+func TestProxyPolicyValidate(t *testing.T) {
+	bad := []proxyPolicy{
+		{Default: "bogus"},
+		{Rules: []proxyRule{{Users: []string{"*"}, Action: "bogus"}}},
+		{Rules: []proxyRule{{Action: proxyActionDirect}}},
+		{Rules: []proxyRule{{Users: []string{"*"}, Action: proxyActionDirect, Via: "100.64.0.1:8080"}}},
+		{Rules: []proxyRule{{Users: []string{"*"}, Action: proxyActionTailscale, Via: "proxy.example.com:8080"}}},
+		{Rules: []proxyRule{{Users: []string{"*"}, Action: proxyActionDeny, Hosts: []string{"10.0.0.0/33"}}}},
+		{Rules: []proxyRule{{Users: []string{"basic:nobody"}, Action: proxyActionDirect}}},
+		{Rules: []proxyRule{{Users: []string{"cert:agent"}, Action: proxyActionDirect}}},
+		{BasicAuth: []proxyBasicUser{{Name: "ci", PasswordSHA256: "s3cret"}}},
+		{BasicAuth: []proxyBasicUser{{Name: "a:b", PasswordSHA256: strings.Repeat("00", 32)}}},
+		{TLS: &proxyTLS{CertFile: "proxy.crt"}},
+		{TLS: &proxyTLS{CertFile: "proxy.crt", KeyFile: "proxy.key", RequireClientCert: true}},
+	}
+	for i, p := range bad {
+		if err := p.validate(); err == nil {
+			t.Errorf("%d: validate succeeded on invalid policy %+v", i, p)
+		}
+	}
+
+	var p proxyPolicy
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Default != proxyActionTailscale {
+		t.Errorf("default action = %q; want %q", p.Default, proxyActionTailscale)
+	}
+}
+
+func TestProxyPolicyHandler(t *testing.T) {
+	p := &proxyPolicy{
+		Rules: []proxyRule{
+			{Users: []string{"*"}, Hosts: []string{"denied.example.com"}, Action: proxyActionDeny},
+			{Users: []string{"*"}, Hosts: []string{"direct.example.com"}, Action: proxyActionDirect},
+		},
+	}
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var dialed []string
+	dialer := func(name string) proxyDialFunc {
+		return func(ctx context.Context, netw, addr string) (net.Conn, error) {
+			dialed = append(dialed, name+" "+addr)
+			return nil, errors.New("dial refused in test")
+		}
+	}
+	h := p.handler(t.Logf, dialer("user"), dialer("system"))
+
+	tests := []struct {
+		host       string
+		wantStatus int
+		wantDial   string
+	}{
+		{"denied.example.com:443", http.StatusForbidden, ""},
+		{"direct.example.com:443", http.StatusInternalServerError, "system direct.example.com:443"},
+		{"other.example.com:443", http.StatusInternalServerError, "user other.example.com:443"},
+	}
+	for _, tt := range tests {
+		dialed = nil
+		req := httptest.NewRequest("CONNECT", tt.host, nil)
+		req.RequestURI = tt.host
+		req = req.WithContext(context.WithValue(req.Context(), proxyClientKey{}, &proxyClient{}))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("CONNECT %s: status %d; want %d", tt.host, rec.Code, tt.wantStatus)
+		}
+		var gotDial string
+		if len(dialed) > 0 {
+			gotDial = dialed[0]
+		}
+		if gotDial != tt.wantDial {
+			t.Errorf("CONNECT %s: dialed %q; want %q", tt.host, gotDial, tt.wantDial)
+		}
+	}
+
+	p.RequireLocalUser = true
+	req := httptest.NewRequest("CONNECT", "other.example.com:443", nil)
+	req.RequestURI = "other.example.com:443"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("unidentified client with RequireLocalUser: status %d; want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestProxyPolicyAuth(t *testing.T) {
+	hash := func(pw string) string {
+		sum := sha256.Sum256([]byte(pw))
+		return hex.EncodeToString(sum[:])
+	}
+	p := &proxyPolicy{
+		RequireAuth: true,
+		BasicAuth:   []proxyBasicUser{{Name: "ci", PasswordSHA256: hash("s3cret:x")}},
+		TLS:         &proxyTLS{CertFile: "proxy.crt", KeyFile: "proxy.key", ClientCAFile: "ca.pem"},
+		Rules: []proxyRule{
+			{Users: []string{"basic:ci"}, Hosts: []string{"ci.example.com"}, Action: proxyActionTailscale},
+			{Users: []string{"cert:agent"}, Hosts: []string{"agent.example.com"}, Action: proxyActionTailscale},
+		},
+		Default: proxyActionDeny,
+	}
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var dialed string
+	dial := func(ctx context.Context, netw, addr string) (net.Conn, error) {
+		dialed = addr
+		return nil, errors.New("dial refused in test")
+	}
+	h := p.handler(t.Logf, dial, dial)
+
+	agentCert := &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "agent"}}}},
+	}
+	tests := []struct {
+		name       string
+		host       string
+		auth       string // Proxy-Authorization header
+		tls        *tls.ConnectionState
+		wantStatus int
+		wantDial   bool
+	}{
+		{"no_auth", "ci.example.com:443", "", nil, http.StatusProxyAuthRequired, false},
+		{"basic", "ci.example.com:443", "Basic Y2k6czNjcmV0Ong=", nil, http.StatusInternalServerError, true},
+		{"basic_wrong_host", "agent.example.com:443", "Basic Y2k6czNjcmV0Ong=", nil, http.StatusForbidden, false},
+		{"basic_bad_password", "ci.example.com:443", "Basic Y2k6d3Jvbmc=", nil, http.StatusProxyAuthRequired, false},
+		{"basic_bad_scheme", "ci.example.com:443", "Bearer Y2k6czNjcmV0Ong=", nil, http.StatusProxyAuthRequired, false},
+		{"cert", "agent.example.com:443", "", agentCert, http.StatusInternalServerError, true},
+		{"cert_wrong_host", "ci.example.com:443", "", agentCert, http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialed = ""
+			req := httptest.NewRequest("CONNECT", tt.host, nil)
+			req.RequestURI = tt.host
+			req.TLS = tt.tls
+			if tt.auth != "" {
+				req.Header.Set("Proxy-Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d; want %d", rec.Code, tt.wantStatus)
+			}
+			if got := dialed != ""; got != tt.wantDial {
+				t.Errorf("dialed %q; want dial %v", dialed, tt.wantDial)
+			}
+			if rec.Code == http.StatusProxyAuthRequired && rec.Header().Get("Proxy-Authenticate") == "" {
+				t.Error("407 response without Proxy-Authenticate header")
+			}
+		})
+	}
+}
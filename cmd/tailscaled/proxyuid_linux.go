@@ -0,0 +1,99 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_outboundproxy
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loopbackConnUID returns the user ID owning the client end of a loopback
+// TCP connection from client to the local address server, by finding the
+// client's socket in /proc/net/tcp or /proc/net/tcp6.
+func loopbackConnUID(server, client netip.AddrPort) (uint32, error) {
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		uid, err := findProcNetTCPUID(bufio.NewReader(f), client, server)
+		f.Close()
+		if err == nil {
+			return uid, nil
+		}
+	}
+	return 0, fmt.Errorf("no socket found for connection from %v", client)
+}
+
+var errNoSocket = errors.New("no matching socket")
+
+// findProcNetTCPUID returns the uid of the socket in a /proc/net/tcp{,6}
+// file whose local and remote addresses are local and remote. Addresses
+// are compared without regard to IPv4-mapped IPv6 addresses.
+func findProcNetTCPUID(r *bufio.Reader, local, remote netip.AddrPort) (uint32, error) {
+	// skip header row
+	if _, err := r.ReadString('\n'); err != nil {
+		return 0, err
+	}
+	local = netip.AddrPortFrom(local.Addr().Unmap(), local.Port())
+	remote = netip.AddrPortFrom(remote.Addr().Unmap(), remote.Port())
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return 0, errNoSocket
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid ...
+		f := strings.Fields(line)
+		if len(f) < 8 {
+			continue
+		}
+		if l, ok := parseProcNetAddr(f[1]); !ok || l != local {
+			continue
+		}
+		if r, ok := parseProcNetAddr(f[2]); !ok || r != remote {
+			continue
+		}
+		uid, err := strconv.ParseUint(f[7], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("bad uid %q: %w", f[7], err)
+		}
+		return uint32(uid), nil
+	}
+}
+
+// parseProcNetAddr parses an address from /proc/net/tcp{,6}, such as
+// "0100007F:1F90". The IP address is written as 32-bit words in host byte
+// order, and the port in hex. IPv4-mapped addresses are unmapped.
+func parseProcNetAddr(s string) (_ netip.AddrPort, ok bool) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	b, err := hex.DecodeString(ipHex)
+	if err != nil || (len(b) != 4 && len(b) != 16) {
+		return netip.AddrPort{}, false
+	}
+	for i := 0; i < len(b); i += 4 {
+		binary.NativeEndian.PutUint32(b[i:], binary.BigEndian.Uint32(b[i:]))
+	}
+	ip, _ := netip.AddrFromSlice(b)
+	return netip.AddrPortFrom(ip.Unmap(), uint16(port)), true
+}
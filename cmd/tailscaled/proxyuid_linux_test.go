@@ -0,0 +1,55 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_outboundproxy
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestFindProcNetTCPUID(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("test data is from a little-endian machine")
+	}
+	const tcp = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:D4E2 0100007F:1F90 01 00000000:00000000 00:00000000 00000000  1001        0 21002 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:1F90 0100007F:D4E2 01 00000000:00000000 00:00000000 00000000     0        0 21003 1 0000000000000000 20 4 30 10 -1
+`
+	const tcp6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:D4E3 00000000000000000000000001000000:1F90 01 00000000:00000000 00:00000000 00000000  1002        0 21004 1 0000000000000000 20 4 30 10 -1
+   1: 0000000000000000FFFF00000100007F:D4E4 0000000000000000FFFF00000100007F:1F90 01 00000000:00000000 00:00000000 00000000  1003        0 21005 1 0000000000000000 20 4 30 10 -1
+`
+	server := netip.MustParseAddrPort("127.0.0.1:8080")
+	server6 := netip.MustParseAddrPort("[::1]:8080")
+	tests := []struct {
+		name    string
+		file    string
+		client  netip.AddrPort
+		server  netip.AddrPort
+		wantUID uint32
+		wantErr bool
+	}{
+		{"v4", tcp, netip.MustParseAddrPort("127.0.0.1:54498"), server, 1001, false},
+		{"v4-no-match", tcp, netip.MustParseAddrPort("127.0.0.1:54499"), server, 0, true},
+		{"v6", tcp6, netip.MustParseAddrPort("[::1]:54499"), server6, 1002, false},
+		{"v4-mapped", tcp6, netip.MustParseAddrPort("127.0.0.1:54500"), netip.MustParseAddrPort("[::ffff:127.0.0.1]:8080"), 1003, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, err := findProcNetTCPUID(bufio.NewReader(strings.NewReader(tt.file)), tt.client, tt.server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v; want error: %v", err, tt.wantErr)
+			}
+			if uid != tt.wantUID {
+				t.Errorf("uid = %d; want %d", uid, tt.wantUID)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !linux && !ts_omit_outboundproxy
+
+package main
+
+import (
+	"errors"
+	"net/netip"
+)
+
+// loopbackConnUID returns the user ID owning the client end of a loopback
+// TCP connection from client to the local address server.
+//
+// It's only implemented on Linux.
+func loopbackConnUID(server, client netip.AddrPort) (uint32, error) {
+	return 0, errors.New("identifying proxy clients is not supported on this platform")
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	runtimemetrics "runtime/metrics"
+	"sync"
+
+	"tailscale.com/envknob"
+	"tailscale.com/util/clientmetric"
+)
+
+// Resource profiles, for the --resource-profile flag.
+const (
+	resourceProfileDefault = "default"
+
+	// resourceProfileLow trades throughput and responsiveness for a smaller
+	// CPU and memory footprint, aiming to keep tailscaled under 64MB RSS on
+	// small MIPS and ARM routers. Compared to the default, it:
+	//
+	//   - disables portlist polling, so peers don't see this node's
+	//     listening services;
+	//   - shrinks magicsock's per-peer ring buffers of debug history;
+	//   - applies netmap changes to fewer peers at a time, so large netmaps
+	//     take longer to apply but allocate less at once;
+	//   - caps netstack's TCP receive and send buffers at 1MiB per
+	//     connection, down from 8MiB and 6MiB;
+	//   - disables netstack's GRO, so it doesn't keep a batch of
+	//     packet buffers and a 64KiB GSO buffer for coalescing segments;
+	//   - disables the per-peer traffic user metrics;
+	//   - sends periodic STUN probes every 60-78s instead of every 20-26s,
+	//     so magicsock wakes up less often, at the risk of
+	//     NAT mappings expiring between probes;
+	//   - limits the Go runtime to at most 2 OS threads running Go code at a
+	//     time, and makes the garbage collector run more often, with a soft
+	//     memory limit of 48MB, which costs CPU time.
+	//
+	// Any of the environment variables it sets (those in lowProfileEnv, plus
+	// GOMAXPROCS, GOGC and GOMEMLIMIT) that are already set are left alone.
+	resourceProfileLow = "low"
+)
+
+// lowProfileEnv are the environment variables set by the low resource
+// profile, unless already set.
+var lowProfileEnv = []struct{ k, v string }{
+	{"TS_PORTLIST", "false"},
+	{"TS_DEBUG_MAGICSOCK_RING_BUFFER_MAX_SIZE_BYTES", "1048576"},
+	{"TS_DEBUG_NETMAP_APPLY_BATCH_SIZE", "250"},
+	{"TS_NETSTACK_TCP_RECEIVE_BUFFER_MAX", "1048576"},
+	{"TS_NETSTACK_TCP_SEND_BUFFER_MAX", "1048576"},
+	{"TS_NETSTACK_DISABLE_GRO", "true"},
+	{"TS_DEBUG_DISABLE_PEER_TRAFFIC_METRICS", "true"},
+	{"TS_DEBUG_PERIODIC_RESTUN_INTERVAL", "60s"},
+}
+
+var metricResourceProfileLow = clientmetric.NewGauge("tailscaled_resource_profile_low")
+
+// publishGoSysBytes publishes the tailscaled_go_sys_bytes metric, the memory
+// obtained from the OS by the Go runtime, which approximates (and usually
+// slightly exceeds) tailscaled's RSS. It's only published when a constrained
+// resource profile is in use, where memory use is worth watching.
+//
+// It reads runtime/metrics rather than runtime.ReadMemStats, which stops the
+// world on every metrics scrape.
+var publishGoSysBytes = sync.OnceFunc(func() {
+	clientmetric.NewGaugeFunc("tailscaled_go_sys_bytes", func() int64 {
+		s := []runtimemetrics.Sample{{Name: "/memory/classes/total:bytes"}}
+		runtimemetrics.Read(s)
+		if v := s[0].Value; v.Kind() == runtimemetrics.KindUint64 {
+			return int64(v.Uint64())
+		}
+		return 0
+	})
+})
+
+// applyResourceProfile applies the named resource profile. It must be called
+// early in main, before any goroutines are started.
+func applyResourceProfile(profile string) error {
+	switch profile {
+	case "", resourceProfileDefault:
+		return nil
+	case resourceProfileLow:
+	default:
+		return fmt.Errorf("unknown resource profile %q; want %q or %q", profile, resourceProfileDefault, resourceProfileLow)
+	}
+
+	for _, e := range lowProfileEnv {
+		if _, ok := os.LookupEnv(e.k); !ok {
+			envknob.Setenv(e.k, e.v)
+		}
+	}
+	if _, ok := os.LookupEnv("GOMAXPROCS"); !ok {
+		runtime.GOMAXPROCS(min(runtime.NumCPU(), 2))
+	}
+	if _, ok := os.LookupEnv("GOGC"); !ok {
+		debug.SetGCPercent(50)
+	}
+	if _, ok := os.LookupEnv("GOMEMLIMIT"); !ok {
+		debug.SetMemoryLimit(48 << 20)
+	}
+	metricResourceProfileLow.Set(1)
+	publishGoSysBytes()
+	return nil
+}
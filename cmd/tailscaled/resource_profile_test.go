@@ -0,0 +1,129 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"tailscale.com/envknob"
+)
+
+// clearResourceProfileEnv unsets the environment variables that resource
+// profiles set, and restores them and the Go runtime settings the profiles
+// change when t finishes.
+func clearResourceProfileEnv(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	gcPercent := debug.SetGCPercent(100)
+	debug.SetGCPercent(gcPercent)
+	memLimit := debug.SetMemoryLimit(-1)
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(procs)
+		debug.SetGCPercent(gcPercent)
+		debug.SetMemoryLimit(memLimit)
+		metricResourceProfileLow.Set(0)
+	})
+
+	keys := []string{"GOMAXPROCS", "GOGC", "GOMEMLIMIT"}
+	for _, e := range lowProfileEnv {
+		keys = append(keys, e.k)
+	}
+	for _, k := range keys {
+		old, ok := os.LookupEnv(k)
+		os.Unsetenv(k)
+		t.Cleanup(func() {
+			if ok {
+				envknob.Setenv(k, old)
+				return
+			}
+			envknob.Setenv(k, "")
+			os.Unsetenv(k)
+		})
+	}
+}
+
+func TestResourceProfileLow(t *testing.T) {
+	clearResourceProfileEnv(t)
+	if err := applyResourceProfile(resourceProfileLow); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range lowProfileEnv {
+		if got := os.Getenv(e.k); got != e.v {
+			t.Errorf("%s = %q; want %q", e.k, got, e.v)
+		}
+	}
+	if got, want := runtime.GOMAXPROCS(0), min(runtime.NumCPU(), 2); got != want {
+		t.Errorf("GOMAXPROCS = %d; want %d", got, want)
+	}
+	if got := debug.SetGCPercent(50); got != 50 {
+		t.Errorf("GC percent = %d; want 50", got)
+	}
+	if got := debug.SetMemoryLimit(-1); got != 48<<20 {
+		t.Errorf("memory limit = %d; want %d", got, 48<<20)
+	}
+	if got := metricResourceProfileLow.Value(); got != 1 {
+		t.Errorf("metric = %d; want 1", got)
+	}
+}
+
+func TestResourceProfileLowKeepsUserEnv(t *testing.T) {
+	clearResourceProfileEnv(t)
+	envknob.Setenv("TS_PORTLIST", "true")
+	envknob.Setenv("TS_NETSTACK_TCP_RECEIVE_BUFFER_MAX", "4194304")
+	os.Setenv("GOGC", "200")
+	os.Setenv("GOMEMLIMIT", "off")
+	gcPercent := debug.SetGCPercent(200)
+	defer debug.SetGCPercent(gcPercent)
+	memLimit := debug.SetMemoryLimit(-1)
+
+	if err := applyResourceProfile(resourceProfileLow); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"TS_PORTLIST":                        "true",
+		"TS_NETSTACK_TCP_RECEIVE_BUFFER_MAX": "4194304",
+		"TS_NETSTACK_TCP_SEND_BUFFER_MAX":    "1048576",
+	} {
+		if got := os.Getenv(k); got != want {
+			t.Errorf("%s = %q; want %q", k, got, want)
+		}
+	}
+	if got := debug.SetGCPercent(200); got != 200 {
+		t.Errorf("GC percent = %d; want 200", got)
+	}
+	if got := debug.SetMemoryLimit(-1); got != memLimit {
+		t.Errorf("memory limit = %d; want %d", got, memLimit)
+	}
+}
+
+func TestResourceProfileDefault(t *testing.T) {
+	for _, profile := range []string{"", resourceProfileDefault} {
+		clearResourceProfileEnv(t)
+		if err := applyResourceProfile(profile); err != nil {
+			t.Fatalf("applyResourceProfile(%q) = %v", profile, err)
+		}
+		for _, e := range lowProfileEnv {
+			if v, ok := os.LookupEnv(e.k); ok {
+				t.Errorf("applyResourceProfile(%q) set %s=%q", profile, e.k, v)
+			}
+		}
+	}
+}
+
+func TestResourceProfileUnknown(t *testing.T) {
+	clearResourceProfileEnv(t)
+	if err := applyResourceProfile("tiny"); err == nil {
+		t.Fatal("applyResourceProfile(tiny) succeeded; want error")
+	}
+	for _, e := range lowProfileEnv {
+		if v, ok := os.LookupEnv(e.k); ok {
+			t.Errorf("unknown profile set %s=%q", e.k, v)
+		}
+	}
+	if got := metricResourceProfileLow.Value(); got != 0 {
+		t.Errorf("metric = %d; want 0", got)
+	}
+}
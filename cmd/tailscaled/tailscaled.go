@@ -22,6 +22,7 @@
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
@@ -116,6 +117,7 @@ func defaultPort() uint16 {
 
 	cleanUp             bool
 	confFile            string // empty, file path, or "vm:user-data"
+	profile             string // name or ID of the login profile to use at startup
 	debug               string
 	port                uint16
 	statepath           string
@@ -123,11 +125,14 @@ func defaultPort() uint16 {
 	statedir            string
 	socketpath          string
 	birdSocketPath      string
+	derpBrokerSocket    string // path of the unix socket to serve a DERP broker on
 	verbose             int
 	socksAddr           string // listen address for SOCKS5 server
 	httpProxyAddr       string // listen address for HTTP proxy server
+	httpProxyPolicy     string // path to per-user policy file for HTTP proxy server
 	disableLogs         bool
 	hardwareAttestation boolFlag
+	resourceProfile     string // "default" or "low"; see resourceProfileLow
 }
 
 var (
@@ -205,9 +210,14 @@ func main() {
 	if buildfeatures.HasBird {
 		flag.StringVar(&args.birdSocketPath, "bird-socket", "", "path of the bird unix socket")
 	}
+	if buildfeatures.HasDERPBroker && runtime.GOOS != "windows" {
+		flag.StringVar(&args.derpBrokerSocket, "derp-broker-socket", "", "path of a unix socket to serve a DERP broker on, for other processes on this host, such as tsnet apps run with TS_DERP_BROKER_SOCKET set to it, to share DERP connections through; only processes running as the same user as tailscaled may use it")
+	}
 	flag.BoolVar(&printVersion, "version", false, "print version information and exit")
 	flag.BoolVar(&args.disableLogs, "no-logs-no-support", false, "disable log uploads; this also disables any technical support")
 	flag.StringVar(&args.confFile, "config", "", "path to config file, or 'vm:user-data' to use the VM's user-data (EC2)")
+	flag.StringVar(&args.profile, "profile", "", "name or ID of the login profile to use at startup, instead of the last used one")
+	flag.StringVar(&args.resourceProfile, "resource-profile", resourceProfileDefault, `resource usage profile: "default", or "low" to use less memory and CPU on small devices, at the cost of throughput and some features such as sharing listening services with peers`)
 	if buildfeatures.HasTPM {
 		flag.Var(&args.hardwareAttestation, "hardware-attestation", `use hardware-backed keys to bind node identity to this device when supported
 by the OS and hardware. Uses TPM 2.0 on Linux and Windows; SecureEnclave on
@@ -254,6 +264,11 @@ func main() {
 		os.Exit(0)
 	}
 
+	if err := applyResourceProfile(args.resourceProfile); err != nil {
+		log.SetFlags(0)
+		log.Fatal(err)
+	}
+
 	if runtime.GOOS == "darwin" && os.Getuid() != 0 && !strings.Contains(args.tunname, "userspace-networking") && !args.cleanUp {
 		log.SetFlags(0)
 		log.Fatalf("tailscaled requires root; use sudo tailscaled (or use --tun=userspace-networking)")
@@ -405,6 +420,7 @@ func run() (err error) {
 	// available universally when setting up everything else.
 	sys := tsd.NewSystem()
 	sys.SocketPath = args.socketpath
+	sys.StartupProfile = args.profile
 
 	// Parse config, if specified, to fail early if it's invalid.
 	var conf *conffile.Config
@@ -414,6 +430,15 @@ func run() (err error) {
 			return fmt.Errorf("error reading config file: %w", err)
 		}
 		sys.InitialConfig = conf
+		if v := conf.Parsed.VRF; v != nil {
+			if v.TUN != "" && v.TUN == v.Physical {
+				return fmt.Errorf("config file: VRF %q can't be both the TUN and the physical VRF", v.TUN)
+			}
+			netmon.SetVRFConfig(netmon.VRFConfig{Physical: v.Physical, TUN: v.TUN})
+		}
+	}
+	if err := setBootstrapDNSServers(conf, logf); err != nil {
+		return err
 	}
 
 	var netMon *netmon.Monitor
@@ -489,6 +514,12 @@ func run() (err error) {
 		debugMux = hookNewDebugMux.Get()()
 	}
 
+	if args.derpBrokerSocket != "" {
+		if err := hookServeDERPBroker.Get()(logf, netMon, args.derpBrokerSocket); err != nil {
+			return err
+		}
+	}
+
 	if f, ok := hookSetSysDrive.GetOk(); ok {
 		f(sys, logf)
 	}
@@ -503,15 +534,40 @@ func run() (err error) {
 var (
 	hookSetSysDrive           feature.Hook[func(*tsd.System, logger.Logf)]
 	hookSetWgEnginConfigDrive feature.Hook[func(*wgengine.Config, logger.Logf)]
+
+	// hookServeDERPBroker starts serving a DERP broker on the unix socket at
+	// the given path. It's set when the derpbroker feature is linked in.
+	hookServeDERPBroker feature.Hook[func(_ logger.Logf, _ *netmon.Monitor, path string) error]
 )
 
 var sigPipe os.Signal // set by sigpipe.go
 
+// listenIPN returns the listener for the LocalAPI: the socket passed by
+// systemd socket activation, if any, or else a new listener on
+// args.socketpath.
+func listenIPN(logf logger.Logf) (net.Listener, error) {
+	if f, ok := feature.HookSystemdListener.GetOk(); ok {
+		ln, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("systemd socket activation: %w", err)
+		}
+		if ln != nil {
+			logf("using LocalAPI socket %v from systemd socket activation", ln.Addr())
+			return ln, nil
+		}
+	}
+	ln, err := safesocket.Listen(args.socketpath)
+	if err != nil {
+		return nil, fmt.Errorf("safesocket.Listen: %v", err)
+	}
+	return ln, nil
+}
+
 // logID may be the zero value if logging is not in use.
 func startIPNServer(ctx context.Context, logf logger.Logf, logID logid.PublicID, sys *tsd.System) error {
-	ln, err := safesocket.Listen(args.socketpath)
+	ln, err := listenIPN(logf)
 	if err != nil {
-		return fmt.Errorf("safesocket.Listen: %v", err)
+		return err
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -805,7 +861,7 @@ func tryEngine(logf logger.Logf, sys *tsd.System, name string) (onlyNetstack boo
 			netmon.SetTailscaleInterfaceProps(devName, 0)
 		}
 
-		r, err := router.New(logf, dev, sys.NetMon.Get(), sys.HealthTracker.Get(), sys.Bus.Get())
+		r, err := router.New(logf, dev, sys.NetMon.Get(), sys.HealthTracker.Get(), sys.Bus.Get(), sys.UserMetricsRegistry())
 		if err != nil {
 			dev.Close()
 			return false, fmt.Errorf("creating router: %w", err)
@@ -904,6 +960,38 @@ func applyIntegrationTestEnvKnob() {
 	}
 }
 
+// setBootstrapDNSServers sets the servers that tailscaled queries for
+// bootstrap DNS before the DERP servers, from the config file conf (which
+// may be nil) and the BootstrapDNSServers policy setting.
+func setBootstrapDNSServers(conf *conffile.Config, logf logger.Logf) error {
+	var servers []dnsfallback.BootstrapServer
+	if conf != nil {
+		for _, s := range conf.Parsed.BootstrapDNS {
+			bs, err := dnsfallback.ParseBootstrapServer(s)
+			if err != nil {
+				return fmt.Errorf("config file: %w", err)
+			}
+			servers = append(servers, bs)
+		}
+	}
+	policyServers, _ := policyclient.Get().GetStringArray(pkey.BootstrapDNSServers, nil)
+	for _, s := range policyServers {
+		bs, err := dnsfallback.ParseBootstrapServer(s)
+		if err != nil {
+			logf("ignoring invalid server in %s policy setting: %v", pkey.BootstrapDNSServers, err)
+			continue
+		}
+		if !slices.Contains(servers, bs) {
+			servers = append(servers, bs)
+		}
+	}
+	if len(servers) > 0 {
+		logf("using extra bootstrap DNS servers: %v", servers)
+		dnsfallback.SetExtraServers(servers)
+	}
+	return nil
+}
+
 // handleTPMFlags validates the --encrypt-state and --hardware-attestation flags
 // if set, and defaults both to on if supported and compatible with other
 // settings.
@@ -0,0 +1,46 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_derpbroker
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"tailscale.com/derp/derphttp"
+	"tailscale.com/net/netmon"
+	"tailscale.com/types/logger"
+)
+
+func init() {
+	hookServeDERPBroker.Set(serveDERPBroker)
+}
+
+// serveDERPBroker starts serving a DERP broker on the unix socket at path,
+// through which other processes on the host share DERP connections.
+func serveDERPBroker(logf logger.Logf, netMon *netmon.Monitor, path string) error {
+	os.Remove(path) // left over from a previous run, if any
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("DERP broker: %w", err)
+	}
+	// The broker makes DERP connections on behalf of whoever connects to
+	// it, so by default only processes running as tailscaled's user may.
+	// Administrators who want to share it more widely can change the
+	// socket's group and mode after it's created.
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return fmt.Errorf("DERP broker: %w", err)
+	}
+	b := derphttp.NewBroker(logf, netMon)
+	go func() {
+		if err := b.Serve(ln); err != nil {
+			logf("DERP broker: %v", err)
+		}
+	}()
+	logf("serving DERP broker on %v", path)
+	return nil
+}
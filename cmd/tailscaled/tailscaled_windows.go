@@ -49,6 +49,7 @@
 	"tailscale.com/net/dns"
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/tstun"
+	"tailscale.com/safesocket"
 	"tailscale.com/tsd"
 	"tailscale.com/types/logger"
 	"tailscale.com/types/logid"
@@ -343,6 +344,12 @@ func beWindowsSubprocess() bool {
 
 	sys.Set(driveimpl.NewFileSystemForRemote(log.Printf))
 
+	if groups, _ := policyclient.Get().GetStringArray(pkey.LocalAPIReadOnlyGroups, nil); len(groups) > 0 {
+		if err := safesocket.SetWindowsPipeGroups(groups); err != nil {
+			log.Printf("LocalAPIReadOnlyGroups policy: %v", err)
+		}
+	}
+
 	publicLogID, _ := logid.ParsePublicID(logID)
 	err = startIPNServer(ctx, log.Printf, publicLogID, sys)
 	if err != nil {
@@ -6,6 +6,7 @@ import { URLDisplay } from "./url-display"
 import { Header } from "./header"
 import { GoPanicDisplay } from "./go-panic-display"
 import { SSH } from "./ssh"
+import { downloadFile } from "../lib/ssh"
 
 type AppState = {
   ipn?: IPN
@@ -87,6 +88,7 @@ class App extends Component<{}, AppState> {
         notifyNetMap: this.handleNetMap,
         notifyBrowseToURL: this.handleBrowseToURL,
         notifyPanicRecover: this.handleGoPanic,
+        notifyIncomingFile: downloadFile,
       })
     })
   }
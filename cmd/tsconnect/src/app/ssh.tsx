@@ -43,6 +43,7 @@ function SSHSession({
   onDone: () => void
 }) {
   const ref = useRef<HTMLDivElement>(null)
+  const [fileStatus, setFileStatus] = useState<string>()
   useEffect(() => {
     if (ref.current) {
       runSSHSession(ref.current, def, ipn, {
@@ -50,11 +51,21 @@ function SSHSession({
         onConnected() {},
         onError: (err) => console.error(err),
         onDone,
+        onFileTransfer: setFileStatus,
       })
     }
   }, [ref])
 
-  return <div class="flex-grow bg-black p-2 overflow-hidden" ref={ref} />
+  return (
+    <>
+      {fileStatus && (
+        <div class="bg-gray-800 text-gray-100 text-sm px-2 py-1">
+          {fileStatus}
+        </div>
+      )}
+      <div class="flex-grow bg-black p-2 overflow-hidden" ref={ref} />
+    </>
+  )
 }
 
 function NoSSHPeers() {
@@ -17,6 +17,11 @@ export type SSHSessionCallbacks = {
   onConnected: () => void
   onDone: () => void
   onError?: (err: string) => void
+  /**
+   * Called with the progress of sending files dropped on the terminal to
+   * the host. Defaults to logging to the console.
+   */
+  onFileTransfer?: (message: string) => void
 }
 
 export function runSSHSession(
@@ -48,6 +53,9 @@ export function runSSHSession(
     onDataHook?.(e)
   })
 
+  setUpClipboard(term, parentWindow)
+  setUpFileDrop(termContainerNode, def, ipn, callbacks)
+
   term.focus()
 
   let resizeObserver: ResizeObserver | undefined
@@ -80,7 +88,18 @@ export function runSSHSession(
   })
 
   // Make terminal and SSH session track the size of the containing DOM node.
-  resizeObserver = new parentWindow.ResizeObserver(() => fitAddon.fit())
+  // Refitting is deferred to the next frame, so that dragging the window
+  // border only sends the server a resize (and the session a SIGWINCH) once
+  // per frame at most.
+  let fitFrame: number | undefined
+  resizeObserver = new parentWindow.ResizeObserver(() => {
+    if (fitFrame === undefined) {
+      fitFrame = parentWindow.requestAnimationFrame(() => {
+        fitFrame = undefined
+        fitAddon.fit()
+      })
+    }
+  })
   resizeObserver.observe(termContainerNode)
   term.onResize(({ rows, cols }) => sshSession.resize(rows, cols))
 
@@ -89,3 +108,108 @@ export function runSSHSession(
   handleUnload = () => sshSession.close()
   parentWindow.addEventListener("unload", handleUnload)
 }
+
+/**
+ * Connects the terminal to the system clipboard: Ctrl+Shift+C copies the
+ * selection (pasting is handled by the browser's own paste events), and
+ * programs in the session such as tmux or vim can set the clipboard with
+ * OSC 52 escape sequences. Programs may not read the clipboard.
+ */
+function setUpClipboard(term: Terminal, parentWindow: Window) {
+  const clipboard = parentWindow.navigator.clipboard
+  if (!clipboard) {
+    // Only available in secure contexts.
+    return
+  }
+  const writeText = (text: string) =>
+    clipboard
+      .writeText(text)
+      .catch((err) => console.error("Could not write to clipboard", err))
+
+  term.attachCustomKeyEventHandler((e) => {
+    if (
+      e.type === "keydown" &&
+      e.ctrlKey &&
+      e.shiftKey &&
+      e.code === "KeyC" &&
+      term.hasSelection()
+    ) {
+      e.preventDefault()
+      writeText(term.getSelection())
+      return false
+    }
+    return true
+  })
+
+  term.parser.registerOscHandler(52, (data) => {
+    // The data is "<selection targets>;<base64 text>", or a "?" in place of
+    // the text to read the clipboard, which isn't allowed.
+    const sep = data.indexOf(";")
+    const payload = sep === -1 ? "" : data.slice(sep + 1)
+    if (payload === "" || payload === "?") {
+      return true
+    }
+    try {
+      const bytes = Uint8Array.from(atob(payload), (c) => c.charCodeAt(0))
+      writeText(new TextDecoder().decode(bytes))
+    } catch (err) {
+      console.error("Invalid OSC 52 sequence", err)
+    }
+    return true
+  })
+}
+
+/**
+ * Sends files dropped on the terminal to the session's host with Taildrop,
+ * where they can be saved with "tailscale file get".
+ */
+function setUpFileDrop(
+  termContainerNode: HTMLDivElement,
+  def: SSHSessionDef,
+  ipn: IPN,
+  callbacks: SSHSessionCallbacks
+) {
+  const progress =
+    callbacks.onFileTransfer ?? ((message) => console.log(message))
+
+  const sendFile = async (file: File) => {
+    progress(`Sending ${file.name} to ${def.hostname}…`)
+    try {
+      const data = new Uint8Array(await file.arrayBuffer())
+      await ipn.sendFile(def.hostname, file.name, data)
+      progress(
+        `Sent ${file.name}. Run "tailscale file get ." on ${def.hostname} to save it.`
+      )
+    } catch (err) {
+      progress(`Could not send ${file.name}: ${err}`)
+    }
+  }
+
+  termContainerNode.addEventListener("dragover", (e) => {
+    if (e.dataTransfer?.types.includes("Files")) {
+      e.preventDefault()
+      e.dataTransfer.dropEffect = "copy"
+    }
+  })
+  termContainerNode.addEventListener("drop", (e) => {
+    const files = e.dataTransfer?.files
+    if (!files?.length) {
+      return
+    }
+    e.preventDefault()
+    Array.from(files).forEach(sendFile)
+  })
+}
+
+/**
+ * Offers a file received with Taildrop to the user as a download.
+ */
+export function downloadFile(name: string, data: Uint8Array) {
+  const url = URL.createObjectURL(new Blob([data]))
+  const a = document.createElement("a")
+  a.href = url
+  a.download = name
+  a.click()
+  // Give the browser a chance to start the download before revoking.
+  setTimeout(() => URL.revokeObjectURL(url), 60_000)
+}
@@ -37,4 +37,4 @@ export async function createIPN(config: IPNPackageConfig): Promise<IPN> {
   return newIPN(config)
 }
 
-export { runSSHSession } from "../lib/ssh"
+export { runSSHSession, downloadFile } from "../lib/ssh"
@@ -29,6 +29,11 @@ declare global {
         onDone: () => void
       }
     ): IPNSSHSession
+    /**
+     * Sends a file to the named peer using Taildrop. The promise is rejected
+     * with an error message if the peer doesn't accept it.
+     */
+    sendFile(hostname: string, name: string, data: Uint8Array): Promise<void>
     fetch(url: string): Promise<{
       status: number
       statusText: string
@@ -58,6 +63,11 @@ declare global {
     notifyNetMap: (netMapStr: string) => void
     notifyBrowseToURL: (url: string) => void
     notifyPanicRecover: (err: string) => void
+    /**
+     * Called with files sent to this node using Taildrop. Files are only
+     * accepted if this is set.
+     */
+    notifyIncomingFile?: (name: string, data: Uint8Array) => void
   }
 
   type IPNNetMap = {
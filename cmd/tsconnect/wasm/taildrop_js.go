@@ -0,0 +1,151 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall/js"
+	"time"
+
+	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/tailcfg"
+)
+
+// This file implements a minimal Taildrop, so that files can be moved in and
+// out of SSH sessions in the browser: files are sent to peers with
+// ipn.sendFile, and files sent to this node are handed to the page with the
+// notifyIncomingFile callback, to offer them as downloads. There's no disk
+// to stage files on, so they're held in memory and partial transfers can't
+// be resumed.
+
+func init() {
+	ipnlocal.RegisterPeerAPIHandler("/v0/put/", handlePeerPut)
+}
+
+// maxIncomingFileSize is the largest file accepted from peers, as it needs
+// to fit in memory twice: once in Go and once in JS.
+const maxIncomingFileSize = 256 << 20
+
+// runningIPNs maps the LocalBackend of each running jsIPN to it, for
+// PeerAPI handlers to find their callbacks.
+var runningIPNs sync.Map // *ipnlocal.LocalBackend => *jsIPN
+
+func handlePeerPut(h ipnlocal.PeerAPIHandler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		// Including GETs of partial files to resume, which senders treat
+		// as resumption being unsupported.
+		http.Error(w, "expected method PUT", http.StatusMethodNotAllowed)
+		return
+	}
+	v, ok := runningIPNs.Load(h.LocalBackend())
+	if !ok {
+		http.Error(w, "not running", http.StatusServiceUnavailable)
+		return
+	}
+	notifyIncomingFile := v.(*jsIPN).jsCallbacks.Get("notifyIncomingFile")
+	if notifyIncomingFile.Type() != js.TypeFunction || !h.Self().HasCap(tailcfg.CapabilityFileSharing) {
+		http.Error(w, "Taildrop not enabled on this node", http.StatusForbidden)
+		return
+	}
+	if h.Peer().UnsignedPeerAPIOnly() || !(h.IsSelfUntagged() || h.PeerCaps().HasCapability(tailcfg.PeerCapabilityFileSharingSend)) {
+		http.Error(w, "Taildrop access denied", http.StatusForbidden)
+		return
+	}
+	name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/v0/put/"))
+	if err != nil || !validFileName(name) {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Range") != "" {
+		http.Error(w, "resuming not supported", http.StatusBadRequest)
+		return
+	}
+	if r.ContentLength > maxIncomingFileSize {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxIncomingFileSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(b) > maxIncomingFileSize {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	data := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(data, b)
+	notifyIncomingFile.Invoke(name, data)
+	h.Logf("got put of %d bytes from %v", len(b), h.Peer().ComputedName())
+	io.WriteString(w, "{}\n")
+}
+
+// validFileName reports whether name is acceptable as the name of a file
+// sent to this node, to be offered to the user for download.
+func validFileName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsAny(name, `/\`) &&
+		!strings.ContainsFunc(name, func(r rune) bool { return r < ' ' || r == 0x7f })
+}
+
+// sendFile sends the contents of data, a Uint8Array, to the peer named host
+// using Taildrop.
+func (i *jsIPN) sendFile(host, name string, data js.Value) js.Value {
+	b := make([]byte, data.Get("length").Int())
+	js.CopyBytesToGo(b, data)
+	return makePromise(func() (any, error) {
+		if !validFileName(name) {
+			return nil, fmt.Errorf("invalid filename %q", name)
+		}
+		nb := i.lb.NodeBackend()
+		peers := nb.AppendMatchingPeers(nil, func(p tailcfg.NodeView) bool {
+			return peerHasName(p, host)
+		})
+		if len(peers) == 0 {
+			return nil, fmt.Errorf("unknown host %q", host)
+		}
+		base := nb.PeerAPIBase(peers[0])
+		if base == "" {
+			return nil, fmt.Errorf("%s can't receive files", host)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "PUT", base+"/v0/put/"+url.PathEscape(name), bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		c := &http.Client{Transport: i.dialer.PeerAPITransport()}
+		res, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+			return nil, errors.New(strings.TrimSpace(string(msg)))
+		}
+		log.Printf("sent %d bytes to %s", len(b), host)
+		return nil, nil
+	})
+}
+
+// peerHasName reports whether p is named host, either in full or by the
+// first label of its name, as the SSH UI names peers.
+func peerHasName(p tailcfg.NodeView, host string) bool {
+	name := strings.TrimSuffix(p.Name(), ".")
+	host = strings.TrimSuffix(host, ".")
+	short, _, _ := strings.Cut(name, ".")
+	return host != "" && (strings.EqualFold(name, host) || strings.EqualFold(short, host))
+}
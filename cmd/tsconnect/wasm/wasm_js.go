@@ -6,7 +6,7 @@
 //
 // When run in the browser, a newIPN(config) function is added to the global JS
 // namespace. When called it returns an ipn object with the methods
-// run(callbacks), login(), logout(), and ssh(...).
+// run(callbacks), login(), logout(), ssh(...), sendFile(...) and fetch(url).
 package main
 
 import (
@@ -21,6 +21,7 @@
 	"net/http"
 	"net/netip"
 	"strings"
+	"sync"
 	"syscall/js"
 	"time"
 
@@ -167,6 +168,7 @@ func newIPN(jsConfig js.Value) map[string]any {
 					notifyNetMap(netMap: object): void,
 					notifyBrowseToURL(url: string): void,
 					notifyPanicRecover(err: string): void,
+					notifyIncomingFile?(name: string, data: Uint8Array): void,
 				})`)
 				return nil
 			}
@@ -199,6 +201,16 @@ func newIPN(jsConfig js.Value) map[string]any {
 				args[1].String(),
 				args[2])
 		}),
+		"sendFile": js.FuncOf(func(this js.Value, args []js.Value) any {
+			if len(args) != 3 {
+				log.Printf("Usage: sendFile(hostname, name, data)")
+				return nil
+			}
+			return jsIPN.sendFile(
+				args[0].String(),
+				args[1].String(),
+				args[2])
+		}),
 		"fetch": js.FuncOf(func(this js.Value, args []js.Value) any {
 			if len(args) != 1 {
 				log.Printf("Usage: fetch(url)")
@@ -218,6 +230,8 @@ type jsIPN struct {
 	controlURL string
 	authKey    string
 	hostname   string
+
+	jsCallbacks js.Value // as passed to run
 }
 
 var jsIPNState = map[ipn.State]string{
@@ -238,6 +252,9 @@ type jsIPN struct {
 }
 
 func (i *jsIPN) run(jsCallbacks js.Value) {
+	i.jsCallbacks = jsCallbacks
+	runningIPNs.Store(i.lb, i)
+
 	notifyState := func(state ipn.State) {
 		jsCallbacks.Call("notifyState", jsIPNState[state])
 	}
@@ -356,6 +373,8 @@ func (i *jsIPN) ssh(host, username string, termConfig js.Value) map[string]any {
 		host:       host,
 		username:   username,
 		termConfig: termConfig,
+		rows:       termConfig.Get("rows").Int(),
+		cols:       termConfig.Get("cols").Int(),
 	}
 
 	go jsSSHSession.Run()
@@ -377,18 +396,18 @@ type jsSSHSession struct {
 	host       string
 	username   string
 	termConfig js.Value
-	session    *ssh.Session
 
-	pendingResizeRows int
-	pendingResizeCols int
+	mu      sync.Mutex
+	session *ssh.Session // non-nil once the session has a pty
+	rows    int          // latest size of the terminal
+	cols    int
+	closed  bool
 }
 
 func (s *jsSSHSession) Run() {
 	writeFn := s.termConfig.Get("writeFn")
 	writeErrorFn := s.termConfig.Get("writeErrorFn")
 	setReadFn := s.termConfig.Get("setReadFn")
-	rows := s.termConfig.Get("rows").Int()
-	cols := s.termConfig.Get("cols").Int()
 	timeoutSeconds := 5.0
 	if jsTimeoutSeconds := s.termConfig.Get("timeoutSeconds"); jsTimeoutSeconds.Type() == js.TypeNumber {
 		timeoutSeconds = jsTimeoutSeconds.Float()
@@ -441,7 +460,6 @@ func (s *jsSSHSession) Run() {
 		writeError("SSH Session", err)
 		return
 	}
-	s.session = session
 	defer session.Close()
 
 	stdin, err := session.StdinPipe()
@@ -462,15 +480,20 @@ func (s *jsSSHSession) Run() {
 		return nil
 	}))
 
-	// We might have gotten a resize notification since we started opening the
-	// session, pick up the latest size.
-	if s.pendingResizeRows != 0 {
-		rows = s.pendingResizeRows
+	// Request the pty at the latest size, in case the terminal was resized
+	// since we started opening the session, and from then on send resizes
+	// to the server as they happen. The lock is held throughout, so that
+	// no resize is sent before the pty exists or lost in between.
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
 	}
-	if s.pendingResizeCols != 0 {
-		cols = s.pendingResizeCols
+	err = session.RequestPty("xterm", s.rows, s.cols, ssh.TerminalModes{})
+	if err == nil {
+		s.session = session
 	}
-	err = session.RequestPty("xterm", rows, cols, ssh.TerminalModes{})
+	s.mu.Unlock()
 	if err != nil {
 		writeError("Pseudo Terminal", err)
 		return
@@ -491,6 +514,9 @@ func (s *jsSSHSession) Run() {
 }
 
 func (s *jsSSHSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
 	if s.session == nil {
 		// We never had a chance to open the session, ignore the close request.
 		return nil
@@ -498,10 +524,16 @@ func (s *jsSSHSession) Close() error {
 	return s.session.Close()
 }
 
+// Resize records the terminal's new size and, once the session has a pty,
+// sends it to the server, which passes it on as a SIGWINCH.
 func (s *jsSSHSession) Resize(rows, cols int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rows == s.rows && cols == s.cols {
+		return nil
+	}
+	s.rows, s.cols = rows, cols
 	if s.session == nil {
-		s.pendingResizeRows = rows
-		s.pendingResizeCols = cols
 		return nil
 	}
 	return s.session.WindowChange(rows, cols)
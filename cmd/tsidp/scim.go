@@ -0,0 +1,490 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/rands"
+	"tailscale.com/util/set"
+)
+
+// This file implements a read-only SCIM 2.0 (RFC 7643 and RFC 7644) API, so
+// that applications which sign users in with tsidp can also provision their
+// accounts and group memberships from it.
+//
+// Users are the tailnet users with untagged devices visible to tsidp.
+// Groups are the values of the "groups" extra claim granted to those users
+// by the tsidp capability, the same groups that relying parties see in ID
+// tokens.
+
+// scimTokenFile is where the bearer token for the SCIM API is persisted.
+const scimTokenFile = "scim-token.txt"
+
+// scimPathPrefix is the URL path prefix of the SCIM API.
+const scimPathPrefix = "/scim/v2/"
+
+const (
+	// scimDirectoryTTL is how long the users and groups are cached for.
+	scimDirectoryTTL = time.Minute
+
+	// scimMaxResults is the most resources returned in one list response.
+	scimMaxResults = 1000
+)
+
+// SCIM schema URNs.
+const (
+	scimSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// loadSCIMToken returns the bearer token for the SCIM API, generating and
+// persisting one if needed, and the path of the file it's stored in.
+func loadSCIMToken(rootPath string) (token, path string, err error) {
+	path, err = getConfigFilePath(rootPath, scimTokenFile)
+	if err != nil {
+		return "", "", fmt.Errorf("could not get SCIM token file path: %w", err)
+	}
+	b, err := os.ReadFile(path)
+	if err == nil {
+		if token = strings.TrimSpace(string(b)); token != "" {
+			return token, path, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", "", err
+	}
+	token = rands.HexString(64)
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", "", err
+	}
+	return token, path, nil
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+type scimValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimRef struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimName struct {
+	Formatted string `json:"formatted"`
+}
+
+type scimUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	UserName    string      `json:"userName"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Name        *scimName   `json:"name,omitempty"`
+	Emails      []scimValue `json:"emails,omitempty"`
+	Photos      []scimValue `json:"photos,omitempty"`
+	Active      bool        `json:"active"`
+	Groups      []scimRef   `json:"groups,omitempty"`
+	Meta        scimMeta    `json:"meta"`
+}
+
+type scimGroup struct {
+	Schemas     []string  `json:"schemas"`
+	ID          string    `json:"id"`
+	DisplayName string    `json:"displayName"`
+	Members     []scimRef `json:"members,omitempty"`
+	Meta        scimMeta  `json:"meta"`
+}
+
+type scimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// scimMember is a tailnet user and the tsidp capability rules granted to
+// them.
+type scimMember struct {
+	profile tailcfg.UserProfile
+	rules   []capRule
+}
+
+// scimDirectory is the users and groups served by the SCIM API.
+type scimDirectory struct {
+	users  []*scimUser  // sorted by ID
+	groups []*scimGroup // sorted by ID
+}
+
+// newSCIMDirectory returns the SCIM resources for members, with locations
+// under the SCIM API at baseURL.
+func newSCIMDirectory(baseURL string, members []scimMember) *scimDirectory {
+	d := new(scimDirectory)
+	groups := map[string]*scimGroup{}
+	for _, m := range members {
+		id := strconv.FormatInt(int64(m.profile.ID), 10)
+		u := &scimUser{
+			Schemas:     []string{scimSchemaUser},
+			ID:          id,
+			UserName:    m.profile.LoginName,
+			DisplayName: m.profile.DisplayName,
+			Active:      true,
+			Meta: scimMeta{
+				ResourceType: "User",
+				Location:     baseURL + "Users/" + id,
+			},
+		}
+		if m.profile.DisplayName != "" {
+			u.Name = &scimName{Formatted: m.profile.DisplayName}
+		}
+		// Login names like "alice@github" are emailish, but they aren't
+		// email addresses.
+		if _, domain, ok := strings.Cut(m.profile.LoginName, "@"); ok && strings.Contains(domain, ".") {
+			u.Emails = []scimValue{{Value: m.profile.LoginName, Type: "work", Primary: true}}
+		}
+		if m.profile.ProfilePicURL != "" {
+			u.Photos = []scimValue{{Value: m.profile.ProfilePicURL, Type: "photo"}}
+		}
+		for _, name := range groupsOfRules(m.rules) {
+			g := groups[name]
+			if g == nil {
+				g = &scimGroup{
+					Schemas:     []string{scimSchemaGroup},
+					ID:          name,
+					DisplayName: name,
+					Meta: scimMeta{
+						ResourceType: "Group",
+						Location:     baseURL + "Groups/" + url.PathEscape(name),
+					},
+				}
+				groups[name] = g
+			}
+			g.Members = append(g.Members, scimRef{Value: u.ID, Ref: u.Meta.Location, Display: u.UserName})
+			u.Groups = append(u.Groups, scimRef{Value: g.ID, Ref: g.Meta.Location, Display: g.DisplayName})
+		}
+		d.users = append(d.users, u)
+	}
+	for _, g := range groups {
+		slices.SortFunc(g.Members, func(a, b scimRef) int { return cmp.Compare(a.Value, b.Value) })
+		d.groups = append(d.groups, g)
+	}
+	slices.SortFunc(d.users, func(a, b *scimUser) int { return cmp.Compare(a.ID, b.ID) })
+	slices.SortFunc(d.groups, func(a, b *scimGroup) int { return cmp.Compare(a.ID, b.ID) })
+	return d
+}
+
+// groupsOfRules returns the sorted, distinct groups in the "groups" extra
+// claims of rules.
+func groupsOfRules(rules []capRule) []string {
+	groups := make(set.Set[string])
+	add := func(v any) {
+		if s, ok := v.(string); ok && s != "" {
+			groups.Add(s)
+		}
+	}
+	for _, r := range rules {
+		switch v := r.ExtraClaims["groups"].(type) {
+		case []any:
+			for _, e := range v {
+				add(e)
+			}
+		default:
+			add(v)
+		}
+	}
+	s := groups.Slice()
+	slices.Sort(s)
+	return s
+}
+
+// currentSCIMDirectory returns the users and groups to serve, loading them
+// if the cached ones are stale.
+func (s *idpServer) currentSCIMDirectory(ctx context.Context) (*scimDirectory, error) {
+	s.scimMu.Lock()
+	defer s.scimMu.Unlock()
+	if s.scimDir != nil && time.Since(s.scimDirTime) < scimDirectoryTTL {
+		return s.scimDir, nil
+	}
+	members, err := s.loadSCIMMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.scimDir = newSCIMDirectory(s.serverURL+scimPathPrefix, members)
+	s.scimDirTime = time.Now()
+	return s.scimDir, nil
+}
+
+// loadSCIMMembers returns the tailnet users with untagged devices visible to
+// tsidp, and the tsidp capability rules granted to them.
+func (s *idpServer) loadSCIMMembers(ctx context.Context) ([]scimMember, error) {
+	st, err := s.lc.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting status: %w", err)
+	}
+	byUser := map[tailcfg.UserID]*scimMember{}
+	for _, ps := range st.Peer {
+		if (ps.Tags != nil && ps.Tags.Len() > 0) || ps.ShareeNode || len(ps.TailscaleIPs) == 0 {
+			continue
+		}
+		who, err := s.lc.WhoIs(ctx, ps.TailscaleIPs[0].String())
+		if err != nil {
+			log.Printf("scim: WhoIs %v: %v", ps.TailscaleIPs[0], err)
+			continue
+		}
+		if who.Node.IsTagged() || who.UserProfile == nil {
+			continue
+		}
+		m := byUser[who.UserProfile.ID]
+		if m == nil {
+			m = &scimMember{profile: *who.UserProfile}
+			byUser[who.UserProfile.ID] = m
+		}
+		rules, err := tailcfg.UnmarshalCapJSON[capRule](who.CapMap, tailcfg.PeerCapabilityTsIDP)
+		if err != nil {
+			log.Printf("scim: capabilities of %v: %v", ps.TailscaleIPs[0], err)
+			continue
+		}
+		m.rules = append(m.rules, rules...)
+	}
+	members := make([]scimMember, 0, len(byUser))
+	for _, m := range byUser {
+		members = append(members, *m)
+	}
+	return members, nil
+}
+
+func (s *idpServer) serveSCIM(w http.ResponseWriter, r *http.Request) {
+	tk, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(tk), []byte(s.scimToken)) != 1 {
+		writeSCIMError(w, http.StatusUnauthorized, "", "invalid or missing bearer token")
+		return
+	}
+	if r.Method != "GET" {
+		writeSCIMError(w, http.StatusNotImplemented, "", "tsidp's SCIM API is read-only")
+		return
+	}
+	resource, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, scimPathPrefix), "/")
+	switch resource {
+	case "ServiceProviderConfig":
+		s.serveSCIMServiceProviderConfig(w)
+		return
+	case "ResourceTypes":
+		s.serveSCIMResourceTypes(w)
+		return
+	case "Users", "Groups":
+	default:
+		writeSCIMError(w, http.StatusNotFound, "", "unknown resource type")
+		return
+	}
+
+	dir, err := s.currentSCIMDirectory(r.Context())
+	if err != nil {
+		log.Printf("scim: %v", err)
+		writeSCIMError(w, http.StatusInternalServerError, "", "could not list users")
+		return
+	}
+	var resources []any
+	var filterAttrs []string
+	switch resource {
+	case "Users":
+		for _, u := range dir.users {
+			resources = append(resources, u)
+		}
+		filterAttrs = []string{"id", "userName"}
+	case "Groups":
+		for _, g := range dir.groups {
+			resources = append(resources, g)
+		}
+		filterAttrs = []string{"id", "displayName"}
+	}
+
+	if id != "" {
+		for _, res := range resources {
+			if scimAttr(res, "id") == id {
+				writeSCIMJSON(w, http.StatusOK, res)
+				return
+			}
+		}
+		writeSCIMError(w, http.StatusNotFound, "", "no such resource")
+		return
+	}
+
+	q := r.URL.Query()
+	if f := q.Get("filter"); f != "" {
+		attr, value, err := parseSCIMFilter(f)
+		if err != nil || !slices.ContainsFunc(filterAttrs, func(a string) bool { return strings.EqualFold(a, attr) }) {
+			writeSCIMError(w, http.StatusBadRequest, "invalidFilter", fmt.Sprintf("unsupported filter %q; only %q eq filters are supported", f, filterAttrs))
+			return
+		}
+		resources = slices.DeleteFunc(resources, func(res any) bool {
+			return !strings.EqualFold(scimAttr(res, attr), value)
+		})
+	}
+	writeSCIMJSON(w, http.StatusOK, scimPage(resources, q))
+}
+
+// scimPage returns the page of resources selected by the startIndex and
+// count parameters in q.
+func scimPage(resources []any, q url.Values) *scimListResponse {
+	start, err := strconv.Atoi(q.Get("startIndex"))
+	if err != nil || start < 1 {
+		start = 1
+	}
+	count, err := strconv.Atoi(q.Get("count"))
+	if err != nil || count > scimMaxResults {
+		count = scimMaxResults
+	}
+	count = max(count, 0)
+	page := resources[min(start-1, len(resources)):]
+	page = page[:min(count, len(page))]
+	if page == nil {
+		page = []any{} // "Resources" must be an array, even if empty
+	}
+	return &scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   start,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
+
+// scimAttr returns the value of the filterable attribute attr of res, which
+// is a *scimUser or *scimGroup.
+func scimAttr(res any, attr string) string {
+	switch res := res.(type) {
+	case *scimUser:
+		switch strings.ToLower(attr) {
+		case "id":
+			return res.ID
+		case "username":
+			return res.UserName
+		}
+	case *scimGroup:
+		switch strings.ToLower(attr) {
+		case "id":
+			return res.ID
+		case "displayname":
+			return res.DisplayName
+		}
+	}
+	return ""
+}
+
+// parseSCIMFilter parses a filter of the form `attr eq "value"`, the only
+// form supported.
+func parseSCIMFilter(f string) (attr, value string, err error) {
+	attr, rest, ok := strings.Cut(strings.TrimSpace(f), " ")
+	if !ok {
+		return "", "", errors.New("invalid filter")
+	}
+	op, rest, ok := strings.Cut(strings.TrimSpace(rest), " ")
+	if !ok || !strings.EqualFold(op, "eq") {
+		return "", "", errors.New("unsupported filter operator")
+	}
+	value, err = strconv.Unquote(strings.TrimSpace(rest))
+	if err != nil || !strings.HasPrefix(strings.TrimSpace(rest), `"`) {
+		return "", "", errors.New("filter value must be a string")
+	}
+	return attr, value, nil
+}
+
+func (s *idpServer) serveSCIMServiceProviderConfig(w http.ResponseWriter) {
+	unsupported := map[string]bool{"supported": false}
+	writeSCIMJSON(w, http.StatusOK, map[string]any{
+		"schemas": []string{scimSchemaServiceProviderConfig},
+		"patch":   unsupported,
+		"bulk": map[string]any{
+			"supported":      false,
+			"maxOperations":  0,
+			"maxPayloadSize": 0,
+		},
+		"filter": map[string]any{
+			"supported":  true,
+			"maxResults": scimMaxResults,
+		},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "The token in " + scimTokenFile + " in tsidp's state directory",
+		}},
+		"meta": scimMeta{
+			ResourceType: "ServiceProviderConfig",
+			Location:     s.serverURL + scimPathPrefix + "ServiceProviderConfig",
+		},
+	})
+}
+
+func (s *idpServer) serveSCIMResourceTypes(w http.ResponseWriter) {
+	resourceType := func(name, endpoint, schema string) map[string]any {
+		return map[string]any{
+			"schemas":  []string{scimSchemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta": scimMeta{
+				ResourceType: "ResourceType",
+				Location:     s.serverURL + scimPathPrefix + "ResourceTypes/" + name,
+			},
+		}
+	}
+	types := []any{
+		resourceType("User", "/Users", scimSchemaUser),
+		resourceType("Group", "/Groups", scimSchemaGroup),
+	}
+	writeSCIMJSON(w, http.StatusOK, scimPage(types, nil))
+}
+
+func writeSCIMJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("scim: writing response: %v", err)
+	}
+}
+
+func writeSCIMError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeSCIMJSON(w, status, &scimError{
+		Schemas:  []string{scimSchemaError},
+		Status:   strconv.Itoa(status),
+		SCIMType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,171 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+func TestNewSCIMDirectory(t *testing.T) {
+	members := []scimMember{
+		{
+			profile: tailcfg.UserProfile{ID: 2, LoginName: "bob@example.com", DisplayName: "Bob"},
+			rules: []capRule{
+				{ExtraClaims: map[string]any{"groups": []any{"eng", "ops"}}},
+				{ExtraClaims: map[string]any{"groups": "eng"}},
+			},
+		},
+		{
+			profile: tailcfg.UserProfile{ID: 1, LoginName: "alice@example.com"},
+			rules: []capRule{
+				{ExtraClaims: map[string]any{"groups": []any{"eng", 42}}},
+			},
+		},
+		{
+			profile: tailcfg.UserProfile{ID: 3, LoginName: "carol@github"},
+		},
+	}
+	d := newSCIMDirectory("https://idp.example.ts.net/scim/v2/", members)
+
+	var userIDs []string
+	for _, u := range d.users {
+		userIDs = append(userIDs, u.ID)
+	}
+	if want := []string{"1", "2", "3"}; !slices.Equal(userIDs, want) {
+		t.Errorf("user IDs = %q; want %q", userIDs, want)
+	}
+	bob := d.users[1]
+	if bob.UserName != "bob@example.com" || bob.Name == nil || bob.Name.Formatted != "Bob" || len(bob.Emails) != 1 {
+		t.Errorf("bob = %+v", bob)
+	}
+	if got := bob.Meta.Location; got != "https://idp.example.ts.net/scim/v2/Users/2" {
+		t.Errorf("bob's location = %q", got)
+	}
+	if len(d.users[2].Emails) != 0 {
+		t.Errorf("carol has emails %v; want none, as her login name isn't an email address", d.users[2].Emails)
+	}
+
+	var groups []string
+	members2 := map[string][]string{}
+	for _, g := range d.groups {
+		groups = append(groups, g.ID)
+		for _, m := range g.Members {
+			members2[g.ID] = append(members2[g.ID], m.Value)
+		}
+	}
+	if want := []string{"eng", "ops"}; !slices.Equal(groups, want) {
+		t.Errorf("groups = %q; want %q", groups, want)
+	}
+	if got, want := members2["eng"], []string{"1", "2"}; !slices.Equal(got, want) {
+		t.Errorf("eng members = %q; want %q", got, want)
+	}
+	if got, want := members2["ops"], []string{"2"}; !slices.Equal(got, want) {
+		t.Errorf("ops members = %q; want %q", got, want)
+	}
+}
+
+func TestParseSCIMFilter(t *testing.T) {
+	tests := []struct {
+		filter    string
+		attr, val string
+		wantErr   bool
+	}{
+		{filter: `userName eq "alice@example.com"`, attr: "userName", val: "alice@example.com"},
+		{filter: `displayName EQ "eng ops"`, attr: "displayName", val: "eng ops"},
+		{filter: `userName sw "a"`, wantErr: true},
+		{filter: `userName eq alice`, wantErr: true},
+		{filter: `userName`, wantErr: true},
+	}
+	for _, tt := range tests {
+		attr, val, err := parseSCIMFilter(tt.filter)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSCIMFilter(%q) error = %v; want error %v", tt.filter, err, tt.wantErr)
+			continue
+		}
+		if attr != tt.attr || val != tt.val {
+			t.Errorf("parseSCIMFilter(%q) = %q, %q; want %q, %q", tt.filter, attr, val, tt.attr, tt.val)
+		}
+	}
+}
+
+func TestServeSCIM(t *testing.T) {
+	const token = "secret"
+	s := &idpServer{
+		serverURL: "https://idp.example.ts.net",
+		scimToken: token,
+	}
+	s.scimDir = newSCIMDirectory(s.serverURL+scimPathPrefix, []scimMember{
+		{profile: tailcfg.UserProfile{ID: 1, LoginName: "alice@example.com"}},
+		{profile: tailcfg.UserProfile{ID: 2, LoginName: "bob@example.com"}},
+		{profile: tailcfg.UserProfile{ID: 3, LoginName: "carol@example.com"}},
+	})
+	s.scimDirTime = time.Now()
+
+	do := func(method, target, tok string) (int, map[string]any) {
+		t.Helper()
+		r := httptest.NewRequest(method, target, nil)
+		if tok != "" {
+			r.Header.Set("Authorization", "Bearer "+tok)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		var body map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q: %v", method, target, w.Body.Bytes(), err)
+		}
+		return w.Code, body
+	}
+
+	if code, _ := do("GET", "/scim/v2/Users", ""); code != http.StatusUnauthorized {
+		t.Errorf("without token, status = %d; want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := do("GET", "/scim/v2/Users", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("with wrong token, status = %d; want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := do("POST", "/scim/v2/Users", token); code != http.StatusNotImplemented {
+		t.Errorf("POST status = %d; want %d", code, http.StatusNotImplemented)
+	}
+
+	code, body := do("GET", "/scim/v2/Users?startIndex=2&count=1", token)
+	if code != http.StatusOK {
+		t.Fatalf("list status = %d", code)
+	}
+	if body["totalResults"] != 3.0 || body["itemsPerPage"] != 1.0 || body["startIndex"] != 2.0 {
+		t.Errorf("list = %v", body)
+	}
+	if res := body["Resources"].([]any); len(res) != 1 || res[0].(map[string]any)["id"] != "2" {
+		t.Errorf("list resources = %v; want user 2", res)
+	}
+
+	code, body = do("GET", `/scim/v2/Users?filter=userName+eq+%22CAROL@example.com%22`, token)
+	if code != http.StatusOK || body["totalResults"] != 1.0 {
+		t.Errorf("filtered list = %d, %v; want one result", code, body)
+	}
+	if code, _ := do("GET", `/scim/v2/Users?filter=emails+eq+%22x%22`, token); code != http.StatusBadRequest {
+		t.Errorf("unsupported filter status = %d; want %d", code, http.StatusBadRequest)
+	}
+
+	code, body = do("GET", "/scim/v2/Users/1", token)
+	if code != http.StatusOK || body["userName"] != "alice@example.com" {
+		t.Errorf("get user 1 = %d, %v", code, body)
+	}
+	if code, _ := do("GET", "/scim/v2/Users/9", token); code != http.StatusNotFound {
+		t.Errorf("get unknown user status = %d; want %d", code, http.StatusNotFound)
+	}
+
+	code, body = do("GET", "/scim/v2/Groups", token)
+	if code != http.StatusOK || body["totalResults"] != 0.0 || body["Resources"] == nil {
+		t.Errorf("groups = %d, %v; want empty list", code, body)
+	}
+	if code, _ := do("GET", "/scim/v2/ServiceProviderConfig", token); code != http.StatusOK {
+		t.Errorf("ServiceProviderConfig status = %d", code)
+	}
+}
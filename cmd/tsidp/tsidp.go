@@ -79,6 +79,7 @@ type ctxConn struct{
 	flagFunnel                        = flag.Bool("funnel", false, "use Tailscale Funnel to make tsidp available on the public internet")
 	flagHostname                      = flag.String("hostname", "idp", "tsnet hostname to use instead of idp")
 	flagDir                           = flag.String("dir", "", "tsnet state directory; a default one will be created if not provided")
+	flagSCIM                          = flag.Bool("scim", false, "serve a read-only SCIM 2.0 API of tailnet users and groups at /scim/v2/, authenticated by the bearer token in "+scimTokenFile+" in the state directory")
 	flagAllowInsecureRegistrationBool opt.Bool
 	flagAllowInsecureRegistration     = opt.BoolFlag{Bool: &flagAllowInsecureRegistrationBool}
 )
@@ -231,6 +232,15 @@ func main() {
 		log.Fatalf("could not open %s: %v", clientsFilePath, err)
 	}
 
+	if *flagSCIM {
+		token, tokenPath, err := loadSCIMToken(rootPath)
+		if err != nil {
+			log.Fatalf("could not load SCIM token: %v", err)
+		}
+		srv.scimToken = token
+		log.Printf("Serving SCIM API at %s%s with the bearer token in %s", srv.serverURL, scimPathPrefix, tokenPath)
+	}
+
 	log.Printf("Running tsidp at %s ...", srv.serverURL)
 
 	if *flagLocalPort != -1 {
@@ -342,6 +352,7 @@ type idpServer struct {
 	localTSMode               bool
 	rootPath                  string // root path, used for storing state files
 	allowInsecureRegistration bool   // If true, allow OAuth without pre-registered clients
+	scimToken                 string // if non-empty, the SCIM API is served, with this bearer token
 
 	lazyMux        lazy.SyncValue[*http.ServeMux]
 	lazySigningKey lazy.SyncValue[*signingKey]
@@ -351,6 +362,10 @@ type idpServer struct {
 	code          map[string]*authRequest  // keyed by random hex
 	accessToken   map[string]*authRequest  // keyed by random hex
 	funnelClients map[string]*funnelClient // keyed by client ID
+
+	scimMu      sync.Mutex     // guards the fields below; held while loading them
+	scimDir     *scimDirectory // cached users and groups, or nil
+	scimDirTime time.Time      // when scimDir was loaded
 }
 
 type authRequest struct {
@@ -605,6 +620,9 @@ func (s *idpServer) newMux() *http.ServeMux {
 	mux.HandleFunc("/userinfo", s.serveUserInfo)
 	mux.HandleFunc("/token", s.serveToken)
 	mux.HandleFunc("/clients/", s.serveClients)
+	if s.scimToken != "" {
+		mux.HandleFunc(scimPathPrefix, s.serveSCIM)
+	}
 	mux.HandleFunc("/", s.handleUI)
 	return mux
 }
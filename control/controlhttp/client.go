@@ -384,6 +384,70 @@ func isLoopback(a net.Addr) bool {
 	return false
 }
 
+// tunnelHTTPSViaProxy changes tr to make its own CONNECT requests, using
+// connect, for HTTPS requests that tr.Proxy says should go via a proxy.
+// Unlike the CONNECT requests that tr makes itself, these can carry out
+// authentication handshakes that take more than one request. Plain HTTP
+// requests still go via the proxy as before.
+//
+// tcpDial is used to dial the proxy. tr.DialTLSContext is used for HTTPS
+// requests that don't go via a proxy.
+func tunnelHTTPSViaProxy(tr *http.Transport, connect func(context.Context, func(context.Context) (net.Conn, error), *url.URL, string) (net.Conn, error), tcpDial netx.DialFunc) {
+	proxy := tr.Proxy
+	tlsDial := tr.DialTLSContext
+	tr.Proxy = func(req *http.Request) (*url.URL, error) {
+		if req.URL.Scheme == "https" {
+			return nil, nil // tunneled by DialTLSContext below
+		}
+		return proxy(req)
+	}
+	tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		pu, err := proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+		if err != nil {
+			return nil, err
+		}
+		if pu == nil {
+			return tlsDial(ctx, network, addr)
+		}
+		dialProxy := func(ctx context.Context) (net.Conn, error) {
+			if pu.Scheme != "https" {
+				return tcpDial(ctx, "tcp", net.JoinHostPort(pu.Hostname(), cmp.Or(pu.Port(), "80")))
+			}
+			c, err := tcpDial(ctx, "tcp", net.JoinHostPort(pu.Hostname(), cmp.Or(pu.Port(), "443")))
+			if err != nil {
+				return nil, err
+			}
+			cfg := tr.TLSClientConfig.Clone()
+			cfg.ServerName = pu.Hostname()
+			tc := tls.Client(c, cfg)
+			if err := tc.HandshakeContext(ctx); err != nil {
+				c.Close()
+				return nil, err
+			}
+			return tc, nil
+		}
+		conn, err := connect(ctx, dialProxy, pu, addr)
+		if err != nil {
+			return nil, err
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		cfg := tr.TLSClientConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = host
+		}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+}
+
 var macOSScreenTime = health.Register(&health.Warnable{
 	Code:     "macos-screen-time",
 	Severity: health.SeverityHigh,
@@ -502,6 +566,14 @@ func (a *Dialer) tryURLUpgrade(ctx context.Context, u *url.URL, optAddr netip.Ad
 	}
 
 	tr.DialTLSContext = dnscache.TLSDialer(dialer, dns, tr.TLSClientConfig)
+	if buildfeatures.HasUseProxy && tr.Proxy != nil {
+		if connect, ok := feature.HookProxyConnect.GetOk(); ok {
+			// Do our own CONNECT for HTTPS, rather than letting the
+			// transport do it, so connection-oriented proxy auth
+			// (NTLM, Negotiate) can span multiple requests.
+			tunnelHTTPSViaProxy(tr, connect, dnscache.Dialer(dialer, dns))
+		}
+	}
 	tr.DisableCompression = true
 
 	// (mis)use httptrace to extract the underlying net.Conn from the
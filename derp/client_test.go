@@ -6,13 +6,17 @@
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"net"
 	"reflect"
 	"sync"
 	"testing"
 	"time"
 
+	"golang.org/x/time/rate"
 	"tailscale.com/tstest"
+	"tailscale.com/tstime"
 	"tailscale.com/types/key"
 )
 
@@ -160,7 +164,7 @@ func TestClientSendRateLimiting(t *testing.T) {
 	c.setSendRateLimiter(ServerInfoMessage{})
 
 	pkt := make([]byte, 1000)
-	if err := c.send(key.NodePublic{}, pkt); err != nil {
+	if err := c.send(context.Background(), key.NodePublic{}, pkt); err != nil {
 		t.Fatal(err)
 	}
 	writes1, bytes1 := cw.Stats()
@@ -171,7 +175,7 @@ func TestClientSendRateLimiting(t *testing.T) {
 	// Flood should all succeed.
 	cw.ResetStats()
 	for range 1000 {
-		if err := c.send(key.NodePublic{}, pkt); err != nil {
+		if err := c.send(context.Background(), key.NodePublic{}, pkt); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -190,7 +194,7 @@ func TestClientSendRateLimiting(t *testing.T) {
 		TokenBucketBytesBurst:     int(bytes1 * 2),
 	})
 	for range 1000 {
-		if err := c.send(key.NodePublic{}, pkt); err != nil {
+		if err := c.send(context.Background(), key.NodePublic{}, pkt); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -202,3 +206,87 @@ func TestClientSendRateLimiting(t *testing.T) {
 		t.Errorf("limited conn's bytes count = %v; want >=%v, <%v", bytesLimited, bytes1K*2, bytes1K)
 	}
 }
+
+// timerClock is a tstest.Clock that reports the durations of new timers.
+type timerClock struct {
+	*tstest.Clock
+	newTimer chan time.Duration
+}
+
+func (c timerClock) NewTimer(d time.Duration) (tstime.TimerController, <-chan time.Time) {
+	c.newTimer <- d
+	return c.Clock.NewTimer(d)
+}
+
+func TestClientSendPacingWait(t *testing.T) {
+	cw := new(countWriter)
+	clock := timerClock{
+		Clock:    tstest.NewClock(tstest.ClockOpts{}),
+		newTimer: make(chan time.Duration, 1),
+	}
+	c := &Client{
+		bw:       bufio.NewWriter(cw),
+		clock:    clock,
+		pacer:    &pacer{lim: rate.NewLimiter(pacerMinRate, pacerBurst)},
+		recvDone: make(chan struct{}),
+	}
+	pkt := make([]byte, MaxPacketSize) // a full pacerBurst per frame
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.SendContext(ctx, key.NodePublic{}, pkt); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- c.SendContext(ctx, key.NodePublic{}, pkt) }()
+	if d := <-clock.newTimer; d <= 0 {
+		t.Fatalf("pacing delay = %v; want > 0", d)
+	}
+
+	// Other frames aren't held up by the paced packet.
+	if err := c.SendPing([8]byte{}); err != nil {
+		t.Fatal(err)
+	}
+	const pingLen = FrameHeaderLen + 8
+	if _, n := cw.Stats(); n != pacerBurst+pingLen {
+		t.Errorf("wrote %v bytes; want %v (packet and ping)", n, pacerBurst+pingLen)
+	}
+
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("paced SendContext = %v; want %v", err, context.Canceled)
+	}
+	if _, n := cw.Stats(); n != pacerBurst+pingLen {
+		t.Errorf("wrote %v bytes after canceled send; want %v", n, pacerBurst+pingLen)
+	}
+}
+
+func TestClientSendPacingConnClosed(t *testing.T) {
+	clock := timerClock{
+		Clock:    tstest.NewClock(tstest.ClockOpts{}),
+		newTimer: make(chan time.Duration, 1),
+	}
+	c := &Client{
+		nc:       dummyNetConn{},
+		br:       bufio.NewReader(bytes.NewReader(nil)),
+		bw:       bufio.NewWriter(new(countWriter)),
+		clock:    clock,
+		pacer:    &pacer{lim: rate.NewLimiter(pacerMinRate, pacerBurst)},
+		recvDone: make(chan struct{}),
+	}
+	pkt := make([]byte, MaxPacketSize)
+	if err := c.Send(key.NodePublic{}, pkt); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- c.Send(key.NodePublic{}, pkt) }()
+	<-clock.newTimer
+
+	// Recv failing (here, at EOF) ends the wait.
+	if _, err := c.Recv(); err == nil {
+		t.Fatal("Recv succeeded; want error")
+	}
+	if err := <-errc; err == nil {
+		t.Error("paced Send succeeded after Recv failed; want error")
+	}
+}
@@ -128,8 +128,49 @@
 	// and how long to try total. See ServerRestartingMessage docs for
 	// more details on how the client should interpret them.
 	FrameRestarting = FrameType(0x15)
+
+	// FrameSpeedTest is sent from client to server to measure the
+	// throughput of the connection. The payload is an 8 byte big endian
+	// sequence number, followed by any amount of padding up to
+	// MaxPacketSize in total. The server replies with FrameSpeedTestAck.
+	// Servers that predate it ignore it, like any unknown frame.
+	FrameSpeedTest = FrameType(0x16)
+
+	// FrameSpeedTestAck is sent from server to client to acknowledge
+	// FrameSpeedTest frames. The payload is the 8 byte big endian sequence
+	// number of the latest FrameSpeedTest received, followed by the 8 byte
+	// big endian total size of the FrameSpeedTest payloads received on
+	// the connection. The server may acknowledge several FrameSpeedTest
+	// frames with a single FrameSpeedTestAck.
+	FrameSpeedTestAck = FrameType(0x17)
+
+	// FrameSharedData carries a stream of a DERP connection that's shared:
+	// the complete DERP connection of another client, tunneled through this
+	// one, so that several processes on a host can share one connection to
+	// the server (see derphttp.Broker). The payload is a 4 byte big endian
+	// stream ID chosen by the client, followed by the next bytes of the
+	// stream, if any. It's sent in both directions. The first frame of a
+	// stream, which may be empty, opens it, and the server then serves it
+	// as it would a new connection. The IDs of the streams of a connection
+	// must increase and be less than 0xffffffff; a server closes a
+	// connection that opens stream 0xffffffff. Streams can't carry streams
+	// of their own; a server closes a stream that sends FrameSharedData or
+	// FrameSharedClose, and doesn't set SharedStreams in the ServerInfo it
+	// sends over one. Servers that predate it ignore it, like any unknown
+	// frame, so clients must only send it to servers whose ServerInfo has
+	// SharedStreams set.
+	FrameSharedData = FrameType(0x18)
+
+	// FrameSharedClose closes a stream opened with FrameSharedData. The
+	// payload is its 4 byte big endian stream ID. It's sent in both
+	// directions.
+	FrameSharedClose = FrameType(0x19)
 )
 
+// MaxSharedStreams is the most streams that a DERP connection may carry at
+// once with FrameSharedData. Servers close streams beyond it.
+const MaxSharedStreams = 256
+
 // PeerGoneReasonType is a one byte reason code explaining why a
 // server does not have a path to the requested destination.
 type PeerGoneReasonType byte
@@ -303,4 +344,7 @@ type ServerInfo struct {
 
 	TokenBucketBytesPerSecond int `json:",omitempty"`
 	TokenBucketBytesBurst     int `json:",omitempty"`
+
+	// SharedStreams is whether the server supports FrameSharedData.
+	SharedStreams bool `json:",omitempty"`
 }
@@ -5,6 +5,7 @@
 
 import (
 	"bufio"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -34,13 +35,15 @@ type Client struct {
 	canAckPings bool
 	isProber    bool
 
-	wmu  sync.Mutex // hold while writing to bw
-	bw   *bufio.Writer
-	rate *rate.Limiter // if non-nil, rate limiter to use
+	wmu   sync.Mutex // hold while writing to bw
+	bw    *bufio.Writer
+	rate  *rate.Limiter // if non-nil, rate limiter to use
+	pacer *pacer        // if non-nil, adaptive write pacing is enabled
 
 	// Owned by Recv:
-	peeked  int                      // bytes to discard on next Recv
-	readErr syncs.AtomicValue[error] // sticky (set by Recv)
+	peeked   int                      // bytes to discard on next Recv
+	readErr  syncs.AtomicValue[error] // sticky (set by Recv)
+	recvDone chan struct{}            // closed when readErr is set; nil in some tests
 
 	clock tstime.Clock
 }
@@ -60,6 +63,7 @@ type clientOpt struct {
 	ServerPub   key.NodePublic
 	CanAckPings bool
 	IsProber    bool
+	PaceWrites  bool
 }
 
 // MeshKey returns a ClientOpt to pass to the DERP server during connect to get
@@ -84,6 +88,13 @@ func CanAckPings(v bool) ClientOpt {
 	return clientOptFunc(func(o *clientOpt) { o.CanAckPings = v })
 }
 
+// PaceWrites returns a ClientOpt to set whether the client adaptively
+// paces the packets it sends, to avoid overrunning lossy or slow links
+// with bursts. See [Client.NoteRTT].
+func PaceWrites(v bool) ClientOpt {
+	return clientOptFunc(func(o *clientOpt) { o.PaceWrites = v })
+}
+
 func NewClient(privateKey key.NodePrivate, nc Conn, brw *bufio.ReadWriter, logf logger.Logf, opts ...ClientOpt) (*Client, error) {
 	var opt clientOpt
 	for _, o := range opts {
@@ -106,8 +117,12 @@ func newClient(privateKey key.NodePrivate, nc Conn, brw *bufio.ReadWriter, logf
 		meshKey:     opt.MeshKey,
 		canAckPings: opt.CanAckPings,
 		isProber:    opt.IsProber,
+		recvDone:    make(chan struct{}),
 		clock:       tstime.StdClock{},
 	}
+	if opt.PaceWrites {
+		c.pacer = new(pacer)
+	}
 	if opt.ServerPub.IsZero() {
 		if err := c.recvServerKey(); err != nil {
 			return nil, fmt.Errorf("derp.Client: failed to receive server key: %v", err)
@@ -216,9 +231,17 @@ func (c *Client) ServerPublicKey() key.NodePublic { return c.serverKey }
 // Send sends a packet to the Tailscale node identified by dstKey.
 //
 // It is an error if the packet is larger than 64KB.
-func (c *Client) Send(dstKey key.NodePublic, pkt []byte) error { return c.send(dstKey, pkt) }
+func (c *Client) Send(dstKey key.NodePublic, pkt []byte) error {
+	return c.send(context.Background(), dstKey, pkt)
+}
+
+// SendContext is like Send, but if write pacing delays the packet, it stops
+// waiting and returns an error once ctx is done.
+func (c *Client) SendContext(ctx context.Context, dstKey key.NodePublic, pkt []byte) error {
+	return c.send(ctx, dstKey, pkt)
+}
 
-func (c *Client) send(dstKey key.NodePublic, pkt []byte) (ret error) {
+func (c *Client) send(ctx context.Context, dstKey key.NodePublic, pkt []byte) (ret error) {
 	defer func() {
 		if ret != nil {
 			ret = fmt.Errorf("derp.Send: %w", ret)
@@ -230,13 +253,34 @@ func (c *Client) send(dstKey key.NodePublic, pkt []byte) (ret error) {
 	}
 
 	c.wmu.Lock()
-	defer c.wmu.Unlock()
+	pktLen := FrameHeaderLen + key.NodePublicRawLen + len(pkt)
 	if c.rate != nil {
-		pktLen := FrameHeaderLen + key.NodePublicRawLen + len(pkt)
 		if !c.rate.AllowN(c.clock.Now(), pktLen) {
+			c.wmu.Unlock()
 			return nil // drop
 		}
 	}
+	if c.pacer != nil {
+		if d := c.pacer.delay(c.clock.Now(), pktLen); d > 0 {
+			// Wait without holding wmu, so pings, pongs and other
+			// frames aren't stuck behind paced packets. The pacer has
+			// already reserved this packet's share of the rate.
+			c.wmu.Unlock()
+			if err := c.waitPacing(ctx, d); err != nil {
+				return err
+			}
+			c.wmu.Lock()
+		}
+	}
+	defer c.wmu.Unlock()
+	if c.pacer != nil {
+		start := c.clock.Now()
+		defer func() {
+			if ret == nil {
+				c.pacer.noteWrite(start, pktLen, c.clock.Since(start))
+			}
+		}()
+	}
 	if err := WriteFrameHeader(c.bw, FrameSendPacket, uint32(key.NodePublicRawLen+len(pkt))); err != nil {
 		return err
 	}
@@ -249,6 +293,21 @@ func (c *Client) send(dstKey key.NodePublic, pkt []byte) (ret error) {
 	return c.bw.Flush()
 }
 
+// waitPacing waits for d to pass, unless ctx is done or the connection
+// fails first.
+func (c *Client) waitPacing(ctx context.Context, d time.Duration) error {
+	t, ch := c.clock.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.recvDone:
+		return c.readErr.Load()
+	}
+}
+
 func (c *Client) ForwardPacket(srcKey, dstKey key.NodePublic, pkt []byte) (err error) {
 	defer func() {
 		if err != nil {
@@ -283,6 +342,27 @@ func (c *Client) ForwardPacket(srcKey, dstKey key.NodePublic, pkt []byte) (err e
 
 func (c *Client) writeTimeoutFired() { c.nc.Close() }
 
+// NoteRTT records a round-trip time measured to the DERP server, such as
+// from a ping. If write pacing is enabled, a rising RTT is used as a sign
+// of congestion.
+func (c *Client) NoteRTT(d time.Duration) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.pacer != nil {
+		c.pacer.noteRTT(d)
+	}
+}
+
+// PacerStats returns statistics about the client's write pacing.
+func (c *Client) PacerStats() PacerStats {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.pacer == nil {
+		return PacerStats{}
+	}
+	return c.pacer.stats()
+}
+
 func (c *Client) SendPing(data [8]byte) error {
 	return c.sendPingOrPong(FramePing, data)
 }
@@ -303,6 +383,34 @@ func (c *Client) sendPingOrPong(typ FrameType, data [8]byte) error {
 	return c.bw.Flush()
 }
 
+// SendSpeedTest sends a FrameSpeedTest with sequence number seq, padded to
+// size bytes, to measure the throughput of the connection. The server
+// acknowledges it with a SpeedTestAckMessage, unless it predates speed
+// tests. Unlike SendPacket, it's not subject to the rate limit advertised
+// by the server.
+func (c *Client) SendSpeedTest(seq uint64, size int) error {
+	if size < 8 || size > MaxPacketSize {
+		return fmt.Errorf("speed test frame size %d out of range", size)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := WriteFrameHeader(c.bw, FrameSpeedTest, uint32(size)); err != nil {
+		return err
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	if _, err := c.bw.Write(b[:]); err != nil {
+		return err
+	}
+	if _, err := c.bw.Write(speedTestPadding[:size-8]); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// speedTestPadding is the padding of FrameSpeedTest frames.
+var speedTestPadding [MaxPacketSize]byte
+
 // NotePreferred sends a packet that tells the server whether this
 // client is the user's preferred server. This is only used in the
 // server for stats.
@@ -348,6 +456,34 @@ func (c *Client) ClosePeer(target key.NodePublic) error {
 	return WriteFrame(c.bw, FrameClosePeer, target.AppendTo(nil))
 }
 
+// SendSharedData sends b, the next bytes of the shared stream with ID
+// stream, opening the stream if it's new. b may be empty, and must be at
+// most MaxPacketSize bytes. See FrameSharedData.
+func (c *Client) SendSharedData(stream uint32, b []byte) error {
+	if len(b) > MaxPacketSize {
+		return fmt.Errorf("shared data of %d bytes too large", len(b))
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := WriteFrameHeader(c.bw, FrameSharedData, uint32(4+len(b))); err != nil {
+		return err
+	}
+	if err := writeUint32(c.bw, stream); err != nil {
+		return err
+	}
+	if _, err := c.bw.Write(b); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// CloseShared closes the shared stream with ID stream.
+func (c *Client) CloseShared(stream uint32) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return WriteFrame(c.bw, FrameSharedClose, binary.BigEndian.AppendUint32(nil, stream))
+}
+
 // ReceivedMessage represents a type returned by Client.Recv. Unless
 // otherwise documented, the returned message aliases the byte slice
 // provided to Recv and thus the message is only as good as that
@@ -414,6 +550,10 @@ type ServerInfoMessage struct {
 	// Zero means unspecified. There might be a limit, but the
 	// client need not try to respect it.
 	TokenBucketBytesBurst int
+
+	// SharedStreams is whether the server supports shared streams
+	// (see FrameSharedData).
+	SharedStreams bool
 }
 
 func (ServerInfoMessage) msg() {}
@@ -430,6 +570,39 @@ func (PingMessage) msg() {}
 
 func (PongMessage) msg() {}
 
+// SpeedTestAckMessage is a reply to frames sent with
+// [Client.SendSpeedTest].
+type SpeedTestAckMessage struct {
+	// Seq is the sequence number of the latest speed test frame the
+	// server received.
+	Seq uint64
+
+	// Bytes is the total size of the speed test frames the server
+	// received on the connection.
+	Bytes uint64
+}
+
+func (SpeedTestAckMessage) msg() {}
+
+// SharedDataMessage is a ReceivedMessage carrying the next bytes of a
+// shared stream, sent with [Client.SendSharedData].
+type SharedDataMessage struct {
+	Stream uint32
+	// Data is the next bytes of the stream. It aliases the memory
+	// passed to Client.Recv.
+	Data []byte
+}
+
+func (SharedDataMessage) msg() {}
+
+// SharedCloseMessage is a ReceivedMessage saying that the server closed a
+// shared stream.
+type SharedCloseMessage struct {
+	Stream uint32
+}
+
+func (SharedCloseMessage) msg() {}
+
 // KeepAliveMessage is a one-way empty message from server to client, just to
 // keep the connection alive. It's like a PingMessage, but doesn't solicit
 // a reply from the client.
@@ -490,6 +663,9 @@ func (c *Client) recvTimeout(timeout time.Duration) (m ReceivedMessage, err erro
 		if err != nil {
 			err = fmt.Errorf("derp.Recv: %w", err)
 			c.readErr.Store(err)
+			if c.recvDone != nil {
+				close(c.recvDone)
+			}
 		}
 	}()
 	for {
@@ -549,6 +725,7 @@ func (c *Client) recvTimeout(timeout time.Duration) (m ReceivedMessage, err erro
 			sm := ServerInfoMessage{
 				TokenBucketBytesPerSecond: si.TokenBucketBytesPerSecond,
 				TokenBucketBytesBurst:     si.TokenBucketBytesBurst,
+				SharedStreams:             si.SharedStreams,
 			}
 			c.setSendRateLimiter(sm)
 			return sm, nil
@@ -630,6 +807,33 @@ func (c *Client) recvTimeout(timeout time.Duration) (m ReceivedMessage, err erro
 			copy(pm[:], b[:])
 			return pm, nil
 
+		case FrameSpeedTestAck:
+			if n < 16 {
+				c.logf("[unexpected] dropping short speed test ack frame")
+				continue
+			}
+			return SpeedTestAckMessage{
+				Seq:   binary.BigEndian.Uint64(b[0:8]),
+				Bytes: binary.BigEndian.Uint64(b[8:16]),
+			}, nil
+
+		case FrameSharedData:
+			if n < 4 {
+				c.logf("[unexpected] dropping short shared data frame")
+				continue
+			}
+			return SharedDataMessage{
+				Stream: binary.BigEndian.Uint32(b[0:4]),
+				Data:   b[4:n],
+			}, nil
+
+		case FrameSharedClose:
+			if n < 4 {
+				c.logf("[unexpected] dropping short shared close frame")
+				continue
+			}
+			return SharedCloseMessage{Stream: binary.BigEndian.Uint32(b[0:4])}, nil
+
 		case FrameHealth:
 			return HealthMessage{Problem: string(b[:])}, nil
 
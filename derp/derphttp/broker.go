@@ -0,0 +1,517 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derphttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"tailscale.com/derp"
+	"tailscale.com/net/netmon"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+)
+
+// Broker shares connections to DERP servers among the processes on a host,
+// such as several tsnet apps, so that the host makes one connection to each
+// DERP region its processes use, rather than one per process. Processes
+// connect through it by setting [Client.BrokerSocket] to the Unix socket it
+// serves on.
+//
+// The DERP connection of each process is tunneled through the shared
+// connection whole (see [derp.FrameSharedData]), so the server authenticates
+// each process, and serves it as it would any other client. The shared
+// connections themselves are made with a key of the Broker's own, so it
+// can't be used with servers that only allow known clients to connect.
+//
+// Processes only share a connection if they ask for identical regions, so
+// that no process can change where another's connection goes. If the
+// Broker can't share a connection to a region, such as because its server
+// doesn't support shared streams, it says so, and processes connect to the
+// region directly instead.
+type Broker struct {
+	privateKey key.NodePrivate
+	logf       logger.Logf
+	netMon     *netmon.Monitor
+
+	mu          sync.Mutex
+	closed      bool
+	lns         map[net.Listener]bool
+	regions     map[string]*brokerRegion // by brokerRegionKey
+	unsupported map[string]time.Time     // by brokerRegionKey; when the region's server was found not to support shared streams
+	nextID      uint32                   // of the next stream; IDs must increase per connection
+}
+
+// brokerRegion is a connection of a Broker to a DERP region, and the streams
+// of the processes it carries.
+type brokerRegion struct {
+	b   *Broker
+	key string              // brokerRegionKey of reg
+	reg *tailcfg.DERPRegion // never changed, so that processes can't redirect each other's connection
+	dc  *Client
+
+	ready      chan struct{} // closed once dc is connected, or failed to
+	connectErr error         // set before ready is closed
+
+	// Guarded by b.mu.
+	streams map[uint32]*brokerStream
+	closed  bool
+}
+
+// brokerStream is the DERP connection of a process, carried by a
+// brokerRegion.
+type brokerStream struct {
+	r    *brokerRegion
+	id   uint32
+	conn net.Conn
+
+	out       chan []byte   // from the server, to write to conn; never closed
+	done      chan struct{} // closed by close
+	closeOnce sync.Once
+}
+
+// brokerStreamQueueDepth is how many frames from the server a brokerStream
+// buffers for its process. Processes that fall further behind are
+// disconnected, so that they don't hold up the other streams.
+const brokerStreamQueueDepth = 64
+
+// brokerUnsupportedRetry is how long a Broker waits to try again to share
+// a connection to a region whose server didn't support shared streams.
+const brokerUnsupportedRetry = 10 * time.Minute
+
+// errSharingUnsupported is the error of connections to regions whose server
+// doesn't support shared streams.
+var errSharingUnsupported = errors.New("DERP server doesn't support shared streams")
+
+// brokerRequest is the request a process sends a Broker upon connecting,
+// as a line of JSON, before speaking DERP.
+type brokerRequest struct {
+	// Region is the DERP region to connect to.
+	Region *tailcfg.DERPRegion
+}
+
+// brokerResponse is the Broker's response to a brokerRequest, as a line of
+// JSON. If it has no error, the process then speaks DERP.
+type brokerResponse struct {
+	// Error, if non-empty, is why the Broker can't connect the process to
+	// the region, which should connect to it directly instead.
+	Error string `json:",omitempty"`
+}
+
+// brokerRegionKey returns the key of the connection to reg that a Broker
+// shares: its full contents, so that only processes asking for the same
+// nodes, hostnames, ports and so on share it.
+func brokerRegionKey(reg *tailcfg.DERPRegion) (string, error) {
+	k, err := json.Marshal(reg)
+	return string(k), err
+}
+
+// NewBroker returns a new Broker. Serve it on a listener with Serve.
+func NewBroker(logf logger.Logf, netMon *netmon.Monitor) *Broker {
+	if netMon == nil {
+		panic("nil netMon")
+	}
+	return &Broker{
+		privateKey:  key.NewNode(),
+		logf:        logger.WithPrefix(logf, "derp-broker: "),
+		netMon:      netMon,
+		lns:         make(map[net.Listener]bool),
+		regions:     make(map[string]*brokerRegion),
+		unsupported: make(map[string]time.Time),
+	}
+}
+
+// Serve accepts connections from processes on ln, which is typically a Unix
+// socket listener, until it or b is closed.
+func (b *Broker) Serve(ln net.Listener) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClientClosed
+	}
+	b.lns[ln] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.lns, ln)
+		b.mu.Unlock()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if b.isClosed() {
+				return ErrClientClosed
+			}
+			return err
+		}
+		go b.serveConn(conn)
+	}
+}
+
+func (b *Broker) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Close closes the listeners b is serving on, and its connections.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	for ln := range b.lns {
+		ln.Close()
+	}
+	var streams []*brokerStream
+	for _, r := range b.regions {
+		for _, st := range r.streams {
+			streams = append(streams, st)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, st := range streams {
+		st.close(false)
+	}
+	return nil
+}
+
+func (b *Broker) serveConn(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	br := bufio.NewReaderSize(conn, 64<<10)
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		b.logf("reading request: %v", err)
+		conn.Close()
+		return
+	}
+	var req brokerRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		b.logf("invalid request: %v", err)
+		conn.Close()
+		return
+	}
+	if req.Region == nil || len(req.Region.Nodes) == 0 {
+		b.logf("invalid request: no DERP region")
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	r, err := b.region(req.Region)
+	if err == nil {
+		<-r.ready
+		err = r.connectErr
+	}
+	var st *brokerStream
+	if err == nil {
+		st, err = b.addStream(r, conn)
+	}
+	if err != nil {
+		writeBrokerResponse(conn, brokerResponse{Error: err.Error()})
+		conn.Close()
+		return
+	}
+	if err := writeBrokerResponse(conn, brokerResponse{}); err != nil {
+		st.close(false)
+		return
+	}
+	// Open the stream, for the server to greet the process through it.
+	if err := r.dc.SendSharedData(st.id, nil); err != nil {
+		st.close(false)
+		return
+	}
+	go st.writeLoop()
+	st.readLoop(br)
+}
+
+func writeBrokerResponse(conn net.Conn, res brokerResponse) error {
+	j, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetWriteDeadline(time.Time{})
+	_, err = conn.Write(append(j, '\n'))
+	return err
+}
+
+// region returns b's connection to the region reg, starting to make one if
+// there's none. It returns an error if reg's server was recently found not
+// to support shared streams.
+func (b *Broker) region(reg *tailcfg.DERPRegion) (*brokerRegion, error) {
+	key, err := brokerRegionKey(reg)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClientClosed
+	}
+	if r, ok := b.regions[key]; ok && !r.closed {
+		return r, nil
+	}
+	if t, ok := b.unsupported[key]; ok {
+		if time.Since(t) < brokerUnsupportedRetry {
+			return nil, errSharingUnsupported
+		}
+		delete(b.unsupported, key)
+	}
+	r := &brokerRegion{
+		b:       b,
+		key:     key,
+		reg:     reg.Clone(),
+		ready:   make(chan struct{}),
+		streams: make(map[uint32]*brokerStream),
+	}
+	r.dc = NewRegionClient(b.privateKey, b.logf, b.netMon, func() *tailcfg.DERPRegion {
+		return r.reg
+	})
+	b.regions[key] = r
+	go r.connect()
+	return r, nil
+}
+
+// connect connects r to its region, and then receives from it until the
+// connection's lost.
+func (r *brokerRegion) connect() {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	err := r.dc.Connect(ctx)
+	if err == nil {
+		err = r.awaitSharing(ctx)
+	}
+	cancel()
+	r.connectErr = err
+	close(r.ready)
+	if err != nil {
+		r.b.logf("connecting to derp-%d: %v", r.reg.RegionID, err)
+		if errors.Is(err, errSharingUnsupported) {
+			r.b.mu.Lock()
+			r.b.unsupported[r.key] = time.Now()
+			r.b.mu.Unlock()
+		}
+		r.b.closeRegion(r)
+		return
+	}
+	r.recvLoop()
+}
+
+// awaitSharing waits for the ServerInfo that the server sends first upon
+// connecting, and returns errSharingUnsupported if it doesn't say that the
+// server supports shared streams. Servers that predate them ignore their
+// frames, so processes would otherwise wait on them forever.
+func (r *brokerRegion) awaitSharing(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() { r.dc.Close() })
+	defer stop()
+	m, err := r.dc.Recv()
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for server info: %w", ctx.Err())
+		}
+		return err
+	}
+	si, ok := m.(derp.ServerInfoMessage)
+	if !ok {
+		return fmt.Errorf("got %T before server info", m)
+	}
+	if !si.SharedStreams {
+		return errSharingUnsupported
+	}
+	return nil
+}
+
+func (r *brokerRegion) recvLoop() {
+	defer r.b.closeRegion(r)
+	for {
+		m, err := r.dc.Recv()
+		if err != nil {
+			if !errors.Is(err, ErrClientClosed) {
+				r.b.logf("derp-%d: %v", r.reg.RegionID, err)
+			}
+			return
+		}
+		switch m := m.(type) {
+		case derp.SharedDataMessage:
+			if st := r.b.stream(r, m.Stream); st != nil {
+				st.deliver(m.Data)
+			}
+		case derp.SharedCloseMessage:
+			if st := r.b.stream(r, m.Stream); st != nil {
+				st.close(false)
+			}
+		case derp.PingMessage:
+			r.dc.SendPong(m)
+		}
+	}
+}
+
+// closeRegion closes r's connection, and the streams it carries, so that
+// their processes reconnect.
+func (b *Broker) closeRegion(r *brokerRegion) {
+	b.mu.Lock()
+	r.closed = true
+	if b.regions[r.key] == r {
+		delete(b.regions, r.key)
+	}
+	var streams []*brokerStream
+	for _, st := range r.streams {
+		streams = append(streams, st)
+	}
+	b.mu.Unlock()
+
+	for _, st := range streams {
+		st.close(false)
+	}
+	r.dc.Close()
+}
+
+// addStream adds a stream for the process connected on conn to r. It fails
+// if r is closed, or if b has run out of stream IDs, after which processes
+// connect directly.
+func (b *Broker) addStream(r *brokerRegion, conn net.Conn) (*brokerStream, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r.closed || b.closed {
+		return nil, ErrClientClosed
+	}
+	if b.nextID == math.MaxUint32 {
+		return nil, errors.New("out of shared stream IDs")
+	}
+	st := &brokerStream{
+		r:    r,
+		id:   b.nextID,
+		conn: conn,
+		out:  make(chan []byte, brokerStreamQueueDepth),
+		done: make(chan struct{}),
+	}
+	b.nextID++
+	r.streams[st.id] = st
+	return st, nil
+}
+
+// stream returns r's stream with ID id, or nil if it's closed.
+func (b *Broker) stream(r *brokerRegion, id uint32) *brokerStream {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return r.streams[id]
+}
+
+// deliver queues data from the server to be written to the process.
+func (st *brokerStream) deliver(data []byte) {
+	select {
+	case st.out <- append([]byte(nil), data...):
+	default:
+		st.r.b.logf("derp-%d: closing stream %d; process not keeping up", st.r.reg.RegionID, st.id)
+		st.close(true)
+	}
+}
+
+func (st *brokerStream) writeLoop() {
+	for {
+		select {
+		case b := <-st.out:
+			if _, err := st.conn.Write(b); err != nil {
+				st.close(true)
+				return
+			}
+		case <-st.done:
+			return
+		}
+	}
+}
+
+// readLoop sends what the process writes to the server, until either hangs
+// up.
+func (st *brokerStream) readLoop(br *bufio.Reader) {
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := br.Read(buf)
+		if n > 0 {
+			if err := st.r.dc.SendSharedData(st.id, buf[:n]); err != nil {
+				st.close(false)
+				return
+			}
+		}
+		if err != nil {
+			st.close(true)
+			return
+		}
+	}
+}
+
+// close closes st, telling the server if tellServer. Closing the last
+// stream of a region closes its connection.
+func (st *brokerStream) close(tellServer bool) {
+	st.closeOnce.Do(func() {
+		close(st.done)
+		st.conn.Close()
+		r := st.r
+		b := r.b
+		b.mu.Lock()
+		delete(r.streams, st.id)
+		idle := len(r.streams) == 0 && !r.closed
+		b.mu.Unlock()
+		if tellServer {
+			r.dc.CloseShared(st.id)
+		}
+		if idle {
+			b.closeRegion(r)
+		}
+	})
+}
+
+// dialBroker connects to the Broker serving on the Unix socket at path, and
+// asks it to connect to the region reg. It returns the connection, and a
+// reader of it to speak DERP with, unless the Broker can't connect to reg.
+func dialBroker(ctx context.Context, path string, reg *tailcfg.DERPRegion) (net.Conn, *bufio.Reader, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dialing DERP broker: %w", err)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req, err := json.Marshal(brokerRequest{Region: reg})
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if _, err := conn.Write(append(req, '\n')); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("writing DERP broker request: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("reading DERP broker response: %w", err)
+	}
+	var res brokerResponse
+	if err := json.Unmarshal(line, &res); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("invalid DERP broker response: %w", err)
+	}
+	if res.Error != "" {
+		conn.Close()
+		return nil, nil, fmt.Errorf("DERP broker: %s", res.Error)
+	}
+	return conn, br, nil
+}
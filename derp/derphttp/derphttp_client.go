@@ -61,6 +61,16 @@ type Client struct {
 	MeshKey       key.DERPMesh       // optional; for trusted clients
 	IsProber      bool               // optional; for probers to optional declare themselves as such
 
+	// PaceWrites is whether the client adaptively paces the packets it
+	// sends to the server, to avoid TCP loss cascades on lossy links.
+	// RTT samples from Ping feed the pacer.
+	PaceWrites bool
+
+	// BrokerSocket, if non-empty, is the path of the Unix socket of a
+	// [Broker] to connect to DERP regions through, sharing its connections
+	// with other processes on the host. It's only used by region clients.
+	BrokerSocket string
+
 	// WatchConnectionChanges is whether the client wishes to subscribe to
 	// notifications about clients connecting & disconnecting.
 	//
@@ -386,6 +396,22 @@ func (c *Client) connect(ctx context.Context, caller string) (client *derp.Clien
 		}
 	}()
 
+	if c.BrokerSocket != "" && reg != nil {
+		// Give the broker at most half the time, leaving the rest to
+		// connect directly if it can't.
+		bctx, bcancel := context.WithTimeout(ctx, timeout/2)
+		derpClient, conn, err := c.connectViaBroker(bctx, caller, reg)
+		bcancel()
+		if err == nil {
+			c.serverPubKey = derpClient.ServerPublicKey()
+			c.client = derpClient
+			c.netConn = conn
+			c.connGen++
+			return c.client, c.connGen, nil
+		}
+		c.logf("%s: connecting to derp-%d directly: %v", caller, reg.RegionID, err)
+	}
+
 	var node *tailcfg.DERPNode // nil when using c.url to dial
 	var idealNodeInRegion bool
 	switch {
@@ -407,6 +433,7 @@ func (c *Client) connect(ctx context.Context, caller string) (client *derp.Clien
 			derp.MeshKey(c.MeshKey),
 			derp.CanAckPings(c.canAckPings),
 			derp.IsProber(c.IsProber),
+			derp.PaceWrites(c.PaceWrites),
 		)
 		if err != nil {
 			return nil, 0, err
@@ -552,6 +579,7 @@ func (c *Client) connect(ctx context.Context, caller string) (client *derp.Clien
 		derp.ServerPublicKey(serverPub),
 		derp.CanAckPings(c.canAckPings),
 		derp.IsProber(c.IsProber),
+		derp.PaceWrites(c.PaceWrites),
 	)
 	if err != nil {
 		return nil, 0, err
@@ -837,14 +865,29 @@ func firstStr(a, b string) string {
 // dialNodeUsingProxy connects to n using a CONNECT to the HTTP(s) proxy in proxyURL.
 func (c *Client) dialNodeUsingProxy(ctx context.Context, n *tailcfg.DERPNode, proxyURL *url.URL) (_ net.Conn, err error) {
 	pu := proxyURL
-	var proxyConn net.Conn
-	if pu.Scheme == "https" {
-		var d tls.Dialer
-		proxyConn, err = d.DialContext(ctx, "tcp", net.JoinHostPort(pu.Hostname(), firstStr(pu.Port(), "443")))
-	} else {
+	dialProxy := func(ctx context.Context) (net.Conn, error) {
+		if pu.Scheme == "https" {
+			var d tls.Dialer
+			return d.DialContext(ctx, "tcp", net.JoinHostPort(pu.Hostname(), firstStr(pu.Port(), "443")))
+		}
 		var d net.Dialer
-		proxyConn, err = d.DialContext(ctx, "tcp", net.JoinHostPort(pu.Hostname(), firstStr(pu.Port(), "80")))
+		return d.DialContext(ctx, "tcp", net.JoinHostPort(pu.Hostname(), firstStr(pu.Port(), "80")))
 	}
+	target := net.JoinHostPort(n.HostName, "443")
+
+	if buildfeatures.HasUseProxy {
+		if connect, ok := feature.HookProxyConnect.GetOk(); ok {
+			conn, err := connect(ctx, dialProxy, pu, target)
+			if err != nil {
+				c.logf("derphttp: CONNECT dial to %s: %v", target, err)
+				return nil, err
+			}
+			c.logf("derphttp: CONNECT dial to %s: ok", target)
+			return conn, nil
+		}
+	}
+
+	proxyConn, err := dialProxy(ctx)
 	defer func() {
 		if err != nil && proxyConn != nil {
 			// In a goroutine in case it's a *tls.Conn (that can block on Close)
@@ -867,20 +910,7 @@ func (c *Client) dialNodeUsingProxy(ctx context.Context, n *tailcfg.DERPNode, pr
 		}
 	}()
 
-	target := net.JoinHostPort(n.HostName, "443")
-
-	var authHeader string
-	if buildfeatures.HasUseProxy {
-		if getAuthHeader, ok := feature.HookProxyGetAuthHeader.GetOk(); ok {
-			if v, err := getAuthHeader(pu); err != nil {
-				c.logf("derphttp: error getting proxy auth header for %v: %v", proxyURL, err)
-			} else if v != "" {
-				authHeader = fmt.Sprintf("Proxy-Authorization: %s\r\n", v)
-			}
-		}
-	}
-
-	if _, err := fmt.Fprintf(proxyConn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n%s\r\n", target, target, authHeader); err != nil {
+	if _, err := fmt.Fprintf(proxyConn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target); err != nil {
 		if ctx.Err() != nil {
 			return nil, ctx.Err()
 		}
@@ -908,12 +938,25 @@ func (c *Client) Send(dstKey key.NodePublic, b []byte) error {
 	if err != nil {
 		return err
 	}
-	if err := client.Send(dstKey, b); err != nil {
+	// c.ctx is canceled by Close, which stops waiting for write pacing.
+	if err := client.SendContext(c.ctx, dstKey, b); err != nil {
 		c.closeForReconnect(client)
 	}
 	return err
 }
 
+// PacerStats returns statistics about the write pacing of the current
+// connection, or the zero value if not connected.
+func (c *Client) PacerStats() derp.PacerStats {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return derp.PacerStats{}
+	}
+	return client.PacerStats()
+}
+
 func (c *Client) registerPing(m derp.PingMessage, ch chan<- bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -960,11 +1003,18 @@ func (c *Client) Ping(ctx context.Context) error {
 	gotPing := make(chan bool, 1)
 	c.registerPing(data, gotPing)
 	defer c.unregisterPing(data)
+	start := time.Now()
 	if err := c.SendPing(data); err != nil {
 		return err
 	}
 	select {
 	case <-gotPing:
+		c.mu.Lock()
+		client := c.client
+		c.mu.Unlock()
+		if client != nil {
+			client.NoteRTT(time.Since(start))
+		}
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
@@ -988,6 +1038,88 @@ func (c *Client) SendPing(data [8]byte) error {
 	return client.SendPing(data)
 }
 
+// SendSpeedTest writes a speed test frame with sequence number seq, padded to
+// size bytes, without any implicit connect or reconnect. The server's
+// acknowledgements are returned by Recv as [derp.SpeedTestAckMessage].
+func (c *Client) SendSpeedTest(seq uint64, size int) error {
+	c.mu.Lock()
+	closed, client := c.closed, c.client
+	c.mu.Unlock()
+	if closed {
+		return ErrClientClosed
+	}
+	if client == nil {
+		return errors.New("client not connected")
+	}
+	return client.SendSpeedTest(seq, size)
+}
+
+// connectViaBroker connects to the region reg through the [Broker] at
+// c.BrokerSocket.
+func (c *Client) connectViaBroker(ctx context.Context, caller string, reg *tailcfg.DERPRegion) (*derp.Client, net.Conn, error) {
+	c.logf("%s: connecting to derp-%d (%v) via broker %v", caller, reg.RegionID, reg.RegionCode, c.BrokerSocket)
+	conn, br, err := dialBroker(ctx, c.BrokerSocket, reg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	brw := bufio.NewReadWriter(br, bufio.NewWriter(conn))
+	derpClient, err := derp.NewClient(c.privateKey, conn, brw, c.logf,
+		derp.MeshKey(c.MeshKey),
+		derp.CanAckPings(c.canAckPings),
+		derp.IsProber(c.IsProber),
+		derp.PaceWrites(c.PaceWrites),
+	)
+	if err != nil {
+		go conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	if c.preferred {
+		if err := derpClient.NotePreferred(true); err != nil {
+			go conn.Close()
+			return nil, nil, err
+		}
+	}
+	return derpClient, conn, nil
+}
+
+// SendSharedData sends the next bytes b of the shared stream with ID stream,
+// as a [Broker] does, without any implicit connect or reconnect.
+func (c *Client) SendSharedData(stream uint32, b []byte) error {
+	c.mu.Lock()
+	closed, client := c.closed, c.client
+	c.mu.Unlock()
+	if closed {
+		return ErrClientClosed
+	}
+	if client == nil {
+		return errors.New("client not connected")
+	}
+	if err := client.SendSharedData(stream, b); err != nil {
+		c.closeForReconnect(client)
+		return err
+	}
+	return nil
+}
+
+// CloseShared tells the server that the shared stream with ID stream is
+// closed, without any implicit connect or reconnect.
+func (c *Client) CloseShared(stream uint32) error {
+	c.mu.Lock()
+	closed, client := c.closed, c.client
+	c.mu.Unlock()
+	if closed {
+		return ErrClientClosed
+	}
+	if client == nil {
+		return errors.New("client not connected")
+	}
+	return client.CloseShared(stream)
+}
+
 // LocalAddr reports c's local TCP address, without any implicit
 // connect or reconnect.
 func (c *Client) LocalAddr() (netip.AddrPort, error) {
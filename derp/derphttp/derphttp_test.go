@@ -4,6 +4,7 @@
 package derphttp_test
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
@@ -11,10 +12,12 @@
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"maps"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
@@ -25,6 +28,7 @@
 	"tailscale.com/derp"
 	"tailscale.com/derp/derphttp"
 	"tailscale.com/derp/derpserver"
+	"tailscale.com/metrics"
 	"tailscale.com/net/memnet"
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/netx"
@@ -225,6 +229,51 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestSpeedTest(t *testing.T) {
+	serverURL, s, ln := newTestServer(t, key.NewNode())
+	defer s.Close()
+	defer ln.Close()
+
+	c, err := derphttp.NewClient(key.NewNode(), serverURL, t.Logf, netmon.NewStatic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetURLDialer(ln.Dial)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	const frames, size = 10, 1000
+	for seq := range uint64(frames) {
+		if err := c.SendSpeedTest(seq+1, size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.SendSpeedTest(frames+1, derp.MaxPacketSize+1); err == nil {
+		t.Error("oversized speed test frame sent")
+	}
+
+	// The server may acknowledge several frames at once, but its last
+	// acknowledgement covers them all.
+	for {
+		m, err := c.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ack, ok := m.(derp.SpeedTestAckMessage)
+		if !ok {
+			continue
+		}
+		if ack.Seq == frames {
+			if ack.Bytes != frames*size {
+				t.Errorf("acked %d bytes; want %d", ack.Bytes, frames*size)
+			}
+			break
+		}
+	}
+}
+
 const testMeshKey = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
 
 func newTestServer(t *testing.T, k key.NodePrivate) (serverURL string, s *derpserver.Server, ln *memnet.Listener) {
@@ -625,3 +674,182 @@ func TestURLDial(t *testing.T) {
 		t.Fatalf("rc.Connect: %v", err)
 	}
 }
+
+func TestBroker(t *testing.T) {
+	s := derpserver.New(key.NewNode(), t.Logf)
+	defer s.Close()
+	httpsrv := httptest.NewUnstartedServer(derpserver.Handler(s))
+	httpsrv.Config.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	httpsrv.StartTLS()
+	defer httpsrv.Close()
+	region := &tailcfg.DERPRegion{
+		RegionID:   1,
+		RegionCode: "test",
+		Nodes: []*tailcfg.DERPNode{{
+			Name:             "t1",
+			RegionID:         1,
+			HostName:         "test-node.unused",
+			IPv4:             "127.0.0.1",
+			IPv6:             "none",
+			DERPPort:         httpsrv.Listener.Addr().(*net.TCPAddr).Port,
+			InsecureForTests: true,
+		}},
+	}
+
+	netMon := netmon.NewStatic()
+	b := derphttp.NewBroker(t.Logf, netMon)
+	defer b.Close()
+	sock := filepath.Join(t.TempDir(), "derp-broker.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go b.Serve(ln)
+
+	var clients []*derphttp.Client
+	for i := range 2 {
+		c := derphttp.NewRegionClient(key.NewNode(), t.Logf, netMon, func() *tailcfg.DERPRegion { return region })
+		c.BrokerSocket = sock
+		defer c.Close()
+		if err := c.Connect(context.Background()); err != nil {
+			t.Fatalf("client %d Connect: %v", i, err)
+		}
+		waitConnect(t, c)
+		clients = append(clients, c)
+	}
+
+	// Both clients are served through the broker's one connection.
+	vars := s.ExpVar(false).(*metrics.Set)
+	if got := vars.Get("gauge_current_shared_streams").String(); got != "2" {
+		t.Errorf("shared streams = %s; want 2", got)
+	}
+	if got := vars.Get("gauge_current_connections").String(); got != "3" {
+		t.Errorf("connections = %s; want 3", got)
+	}
+
+	recv := func(c *derphttp.Client, want string) {
+		t.Helper()
+		for {
+			m, err := c.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p, ok := m.(derp.ReceivedPacket); ok {
+				if got := string(p.Data); got != want {
+					t.Fatalf("got %q; want %q", got, want)
+				}
+				return
+			}
+		}
+	}
+	if err := clients[0].Send(clients[1].SelfPublicKey(), []byte("hello 0->1")); err != nil {
+		t.Fatal(err)
+	}
+	recv(clients[1], "hello 0->1")
+	big := strings.Repeat("x", derp.MaxPacketSize)
+	if err := clients[1].Send(clients[0].SelfPublicKey(), []byte(big)); err != nil {
+		t.Fatal(err)
+	}
+	recv(clients[0], big)
+
+	// Closing a client closes only its stream.
+	clients[0].Close()
+	if err := tstest.WaitFor(5*time.Second, func() error {
+		if got := vars.Get("gauge_current_shared_streams").String(); got != "1" {
+			return fmt.Errorf("shared streams = %s; want 1", got)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := clients[1].Send(clients[1].SelfPublicKey(), []byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	recv(clients[1], "still here")
+
+	// A client asking for the same region ID with different nodes doesn't
+	// share, or change, the existing connection.
+	other := region.Clone()
+	other.Nodes[0].HostName = "other-node.unused"
+	c := derphttp.NewRegionClient(key.NewNode(), t.Logf, netMon, func() *tailcfg.DERPRegion { return other })
+	c.BrokerSocket = sock
+	defer c.Close()
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("other region Connect: %v", err)
+	}
+	waitConnect(t, c)
+	if err := tstest.WaitFor(5*time.Second, func() error {
+		if got := vars.Get("gauge_current_shared_streams").String(); got != "2" {
+			return fmt.Errorf("shared streams = %s; want 2", got)
+		}
+		if got := vars.Get("gauge_current_connections").String(); got != "4" {
+			return fmt.Errorf("connections = %s; want 4", got)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := clients[1].Send(c.SelfPublicKey(), []byte("across connections")); err != nil {
+		t.Fatal(err)
+	}
+	recv(c, "across connections")
+}
+
+func TestBrokerFallback(t *testing.T) {
+	s := derpserver.New(key.NewNode(), t.Logf)
+	defer s.Close()
+	httpsrv := httptest.NewUnstartedServer(derpserver.Handler(s))
+	httpsrv.Config.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	httpsrv.StartTLS()
+	defer httpsrv.Close()
+	region := &tailcfg.DERPRegion{
+		RegionID:   1,
+		RegionCode: "test",
+		Nodes: []*tailcfg.DERPNode{{
+			Name:             "t1",
+			RegionID:         1,
+			HostName:         "test-node.unused",
+			IPv4:             "127.0.0.1",
+			IPv6:             "none",
+			DERPPort:         httpsrv.Listener.Addr().(*net.TCPAddr).Port,
+			InsecureForTests: true,
+		}},
+	}
+
+	// A broker that can't share the region, as for a server that doesn't
+	// support shared streams.
+	sock := filepath.Join(t.TempDir(), "derp-broker.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			bufio.NewReader(conn).ReadString('\n')
+			io.WriteString(conn, `{"Error":"DERP server doesn't support shared streams"}`+"\n")
+			conn.Close()
+		}
+	}()
+
+	for _, sock := range []string{sock, filepath.Join(t.TempDir(), "missing.sock")} {
+		c := derphttp.NewRegionClient(key.NewNode(), t.Logf, netmon.NewStatic(), func() *tailcfg.DERPRegion { return region })
+		c.BrokerSocket = sock
+		defer c.Close()
+		if err := c.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect with broker %v: %v", sock, err)
+		}
+		waitConnect(t, c)
+	}
+	vars := s.ExpVar(false).(*metrics.Set)
+	if got := vars.Get("gauge_current_shared_streams").String(); got != "0" {
+		t.Errorf("shared streams = %s; want 0", got)
+	}
+	if got := vars.Get("gauge_current_connections").String(); got != "2" {
+		t.Errorf("connections = %s; want 2", got)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package derplatency defines the coarse reports of latency to private DERP
+// regions that clients can opt in to sending to a collector run by the
+// regions' operator, and suggests home regions for the clients from them.
+package derplatency
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+// Private DERP regions are those with IDs in the range that
+// [tailcfg.DERPRegion] reserves for end users to run their own DERP servers.
+const (
+	MinPrivateRegionID = 900
+	MaxPrivateRegionID = 999
+)
+
+// IsPrivateRegion reports whether regionID is that of a private region.
+func IsPrivateRegion(regionID int) bool {
+	return regionID >= MinPrivateRegionID && regionID <= MaxPrivateRegionID
+}
+
+// Granularity is what reported latencies are rounded to, so that they
+// describe the network path rather than the moment.
+const Granularity = 5 * time.Millisecond
+
+// RoundLatency returns d in milliseconds, rounded to [Granularity]. Nonzero
+// latencies are at least Granularity.
+func RoundLatency(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(max(d.Round(Granularity), Granularity) / time.Millisecond)
+}
+
+// Report is a client's latency to the private DERP regions it measured in one
+// netcheck. Clients POST it as JSON to the collector.
+type Report struct {
+	Node     tailcfg.StableNodeID
+	Hostname string    `json:",omitempty"`
+	Time     time.Time // when the latencies were measured, to the minute
+
+	// HomeRegion is the client's home region at the time, or zero if it's
+	// not a private one.
+	HomeRegion int `json:",omitempty"`
+
+	Regions []RegionLatency
+}
+
+// RegionLatency is a client's latency to a DERP region.
+type RegionLatency struct {
+	RegionID  int
+	LatencyMS int // rounded to Granularity
+}
+
+// MaxRegions is the most regions a valid Report has: the size of the private
+// region ID range.
+const MaxRegions = MaxPrivateRegionID - MinPrivateRegionID + 1
+
+// Valid reports whether r is a well-formed report of only private regions.
+func (r *Report) Valid() bool {
+	if r.Node == "" || r.Time.IsZero() || len(r.Regions) == 0 || len(r.Regions) > MaxRegions {
+		return false
+	}
+	if r.HomeRegion != 0 && !IsPrivateRegion(r.HomeRegion) {
+		return false
+	}
+	for _, rl := range r.Regions {
+		if !IsPrivateRegion(rl.RegionID) || rl.LatencyMS <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NodeSuggestion is the suggested home region of a client.
+type NodeSuggestion struct {
+	Node     tailcfg.StableNodeID
+	Hostname string
+	Reports  int // how many of its reports the suggestion is from
+
+	// CurrentHome is the home region of its latest report, or zero if that
+	// wasn't a private one.
+	CurrentHome int
+	// SuggestedHome is the region it has the lowest median latency to of
+	// those it reported in at least half of its reports, unless that's not
+	// enough of an improvement on CurrentHome, in which case it's
+	// CurrentHome. It's zero if there's no such region.
+	SuggestedHome int
+
+	// CurrentMS and SuggestedMS are its median latencies to CurrentHome
+	// and SuggestedHome, or zero if unknown.
+	CurrentMS   int
+	SuggestedMS int
+}
+
+// Changed reports whether s suggests a different home region.
+func (s *NodeSuggestion) Changed() bool {
+	return s.SuggestedHome != 0 && s.SuggestedHome != s.CurrentHome
+}
+
+// RegionSummary is the aggregate of clients' reports about a region.
+type RegionSummary struct {
+	RegionID       int
+	Nodes          int // how many clients reported it
+	MedianMS       int // median of those clients' median latencies to it
+	CurrentHomes   int // how many clients it's currently home to
+	SuggestedHomes int // how many clients it's suggested as home for
+}
+
+// Suggestions are home region suggestions from clients' reports.
+type Suggestions struct {
+	Nodes   []NodeSuggestion // sorted by node
+	Regions []RegionSummary  // sorted by region ID
+}
+
+// Suggest suggests home regions for the clients in reports. A client's home
+// is only changed if that lowers its median latency by at least
+// minImprovement. Invalid reports are ignored.
+func Suggest(reports []Report, minImprovement time.Duration) *Suggestions {
+	type nodeState struct {
+		hostname string
+		latest   time.Time
+		home     int
+		reports  int
+		samples  map[int][]int // region ID => latencies in ms
+	}
+	nodes := map[tailcfg.StableNodeID]*nodeState{}
+	for _, r := range reports {
+		if !r.Valid() {
+			continue
+		}
+		ns := nodes[r.Node]
+		if ns == nil {
+			ns = &nodeState{samples: map[int][]int{}}
+			nodes[r.Node] = ns
+		}
+		ns.reports++
+		if !r.Time.Before(ns.latest) {
+			ns.latest, ns.home = r.Time, r.HomeRegion
+			ns.hostname = cmp.Or(r.Hostname, ns.hostname)
+		}
+		for _, rl := range r.Regions {
+			ns.samples[rl.RegionID] = append(ns.samples[rl.RegionID], rl.LatencyMS)
+		}
+	}
+
+	regionMedians := map[int][]int{} // region ID => medians of nodes
+	regions := map[int]*RegionSummary{}
+	region := func(id int) *RegionSummary {
+		rs := regions[id]
+		if rs == nil {
+			rs = &RegionSummary{RegionID: id}
+			regions[id] = rs
+		}
+		return rs
+	}
+	ret := new(Suggestions)
+	for id, ns := range nodes {
+		s := NodeSuggestion{
+			Node:        id,
+			Hostname:    ns.hostname,
+			Reports:     ns.reports,
+			CurrentHome: ns.home,
+		}
+		medians := map[int]int{}
+		for rid, samples := range ns.samples {
+			m := median(samples)
+			medians[rid] = m
+			regionMedians[rid] = append(regionMedians[rid], m)
+			// Only consider regions the client reliably reaches.
+			if 2*len(samples) < ns.reports {
+				continue
+			}
+			if s.SuggestedHome == 0 || m < s.SuggestedMS || (m == s.SuggestedMS && rid < s.SuggestedHome) {
+				s.SuggestedHome, s.SuggestedMS = rid, m
+			}
+		}
+		s.CurrentMS = medians[s.CurrentHome]
+		if s.CurrentMS > 0 && time.Duration(s.CurrentMS-s.SuggestedMS)*time.Millisecond < minImprovement {
+			s.SuggestedHome, s.SuggestedMS = s.CurrentHome, s.CurrentMS
+		}
+		if s.CurrentHome != 0 {
+			region(s.CurrentHome).CurrentHomes++
+		}
+		if s.SuggestedHome != 0 {
+			region(s.SuggestedHome).SuggestedHomes++
+		}
+		ret.Nodes = append(ret.Nodes, s)
+	}
+	for rid, medians := range regionMedians {
+		rs := region(rid)
+		rs.Nodes = len(medians)
+		rs.MedianMS = median(medians)
+	}
+	slices.SortFunc(ret.Nodes, func(a, b NodeSuggestion) int { return cmp.Compare(a.Node, b.Node) })
+	for _, rs := range regions {
+		ret.Regions = append(ret.Regions, *rs)
+	}
+	slices.SortFunc(ret.Regions, func(a, b RegionSummary) int { return cmp.Compare(a.RegionID, b.RegionID) })
+	return ret
+}
+
+// median returns the median of vs, which must not be empty. It sorts vs.
+func median(vs []int) int {
+	slices.Sort(vs)
+	n := len(vs)
+	if n%2 == 1 {
+		return vs[n/2]
+	}
+	return (vs[n/2-1] + vs[n/2]) / 2
+}
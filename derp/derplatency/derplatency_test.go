@@ -0,0 +1,77 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derplatency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"tailscale.com/tailcfg"
+)
+
+func TestRoundLatency(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Millisecond, 5},
+		{12 * time.Millisecond, 10},
+		{13 * time.Millisecond, 15},
+		{time.Second, 1000},
+	}
+	for _, tt := range tests {
+		if got := RoundLatency(tt.d); got != tt.want {
+			t.Errorf("RoundLatency(%v) = %d; want %d", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	t0 := time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)
+	report := func(node tailcfg.StableNodeID, minute, home int, latencies ...int) Report {
+		r := Report{Node: node, Hostname: string(node) + "-host", Time: t0.Add(time.Duration(minute) * time.Minute), HomeRegion: home}
+		for i := 0; i < len(latencies); i += 2 {
+			r.Regions = append(r.Regions, RegionLatency{RegionID: latencies[i], LatencyMS: latencies[i+1]})
+		}
+		return r
+	}
+	reports := []Report{
+		// a is homed on 901 but 902 is much closer.
+		report("a", 0, 901, 901, 80, 902, 20),
+		report("a", 1, 901, 901, 90, 902, 25),
+		report("a", 2, 901, 901, 70, 902, 15),
+		// b is homed on 901; 902 is only a little closer.
+		report("b", 0, 901, 901, 30, 902, 25),
+		// c has no private home, and only reaches 903 once of three times.
+		report("c", 0, 0, 901, 50),
+		report("c", 1, 0, 901, 60, 903, 5),
+		report("c", 2, 0, 901, 55),
+		// Invalid reports are ignored.
+		report("d", 0, 0, 2, 10),
+		report("", 0, 0, 901, 10),
+	}
+	got := Suggest(reports, 10*time.Millisecond)
+	want := &Suggestions{
+		Nodes: []NodeSuggestion{
+			{Node: "a", Hostname: "a-host", Reports: 3, CurrentHome: 901, SuggestedHome: 902, CurrentMS: 80, SuggestedMS: 20},
+			{Node: "b", Hostname: "b-host", Reports: 1, CurrentHome: 901, SuggestedHome: 901, CurrentMS: 30, SuggestedMS: 30},
+			{Node: "c", Hostname: "c-host", Reports: 3, SuggestedHome: 901, SuggestedMS: 55},
+		},
+		Regions: []RegionSummary{
+			{RegionID: 901, Nodes: 3, MedianMS: 55, CurrentHomes: 2, SuggestedHomes: 2},
+			{RegionID: 902, Nodes: 2, MedianMS: 22, SuggestedHomes: 1},
+			{RegionID: 903, Nodes: 1, MedianMS: 5},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Suggest mismatch (-want +got):\n%s", diff)
+	}
+	for _, s := range got.Nodes {
+		if changed := s.Node == "a" || s.Node == "c"; s.Changed() != changed {
+			t.Errorf("%s: Changed = %v; want %v", s.Node, s.Changed(), changed)
+		}
+	}
+}
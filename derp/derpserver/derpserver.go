@@ -50,6 +50,7 @@
 	"tailscale.com/syncs"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tstime"
+	"tailscale.com/tstime/mono"
 	"tailscale.com/tstime/rate"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
@@ -153,6 +154,9 @@ type Server struct {
 	peerGoneNotHereFrames      expvar.Int // number of peer not here frames sent
 	gotPing                    expvar.Int // number of ping frames from client
 	sentPong                   expvar.Int // number of pong frames enqueued to client
+	gotSpeedTestBytes          expvar.Int // bytes of speed test frames from clients
+	curSharedStreams           expvar.Int // shared streams open, which are also counted in curClients once accepted
+	sharedStreamsTotal         expvar.Int // shared streams ever opened
 	accepts                    expvar.Int
 	curClients                 expvar.Int
 	curClientsNotIdeal         expvar.Int
@@ -173,18 +177,25 @@ type Server struct {
 	meshUpdateLoopCount        *metrics.Histogram
 	bufferedWriteFrames        *metrics.Histogram // how many sendLoop frames (or groups of related frames) get written per flush
 	rateLimitPerClientWaited   expvar.Int         // number of times per-client rate limit caused a wait
+	senderDrops                metrics.LabelMap   // packets dropped by per-sender rate limit, disco rate limit or fair queueing, by sender key prefix
+	fairQueueing               atomic.Bool        // whether RateConfig.FairQueueing is in effect
 	// TODO(illotum): add metrics for rate limited wait time, consider total seconds vs a histogram.
 
+	// discoRate is the per-pair disco rate limit from RateConfig, or nil
+	// if disabled. Each sclient compares it with the limit its disco
+	// limiters were created with, to notice changes.
+	discoRate atomic.Pointer[discoRateLimit]
+
 	// verifyClientsLocalTailscaled only accepts client connections to the DERP
 	// server if the clientKey is a known peer in the network, as specified by a
 	// running tailscaled's client's LocalAPI.
-	verifyClientsLocalTailscaled bool
+	verifyClientsLocalTailscaled atomic.Bool
 
-	verifyClientsURL         string
-	verifyClientsURLFailOpen bool
+	verifyClientsURL         syncs.AtomicValue[string]
+	verifyClientsURLFailOpen atomic.Bool
 
 	perClientSendQueueDepth int // Sets the client send queue depth for the server.
-	tcpWriteTimeout         time.Duration
+	tcpWriteTimeout         syncs.AtomicValue[time.Duration]
 	clock                   tstime.Clock
 
 	mu       syncs.Mutex // guards the following fields
@@ -372,13 +383,14 @@ func New(privateKey key.NodePrivate, logf logger.Logf) *Server {
 		peerGoneWatchers:    map[key.NodePublic]set.HandleSet[func(key.NodePublic)]{},
 		avgQueueDuration:    new(uint64),
 		tcpRtt:              metrics.LabelMap{Label: "le"},
+		senderDrops:         metrics.LabelMap{Label: "node"},
 		meshUpdateBatchSize: metrics.NewHistogram([]float64{0, 1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}),
 		meshUpdateLoopCount: metrics.NewHistogram([]float64{0, 1, 2, 5, 10, 20, 50, 100}),
 		bufferedWriteFrames: metrics.NewHistogram([]float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 15, 20, 25, 50, 100}),
 		keyOfAddr:           map[netip.AddrPort]key.NodePublic{},
 		clock:               tstime.StdClock{},
-		tcpWriteTimeout:     DefaultTCPWiteTimeout,
 	}
+	s.tcpWriteTimeout.Store(DefaultTCPWiteTimeout)
 	s.initMetacert()
 	s.packetsRecvDisco = s.packetsRecvByKind.Get(string(packetKindDisco))
 	s.packetsRecvOther = s.packetsRecvByKind.Get(string(packetKindOther))
@@ -437,6 +449,9 @@ func genDroppedCounters() {
 		dropReasonQueueTail,
 		dropReasonWriteError,
 		dropReasonDupClient,
+		dropReasonSenderRateLimited,
+		dropReasonFairShare,
+		dropReasonDiscoRateLimited,
 	}
 
 	for _, dr := range dropReasons {
@@ -469,22 +484,22 @@ func (s *Server) SetMeshKey(v string) error {
 
 // SetVerifyClients sets whether this DERP server verifies clients through tailscaled.
 //
-// It must be called before serving begins.
+// It may be called while serving; it applies to clients that connect afterwards.
 func (s *Server) SetVerifyClient(v bool) {
-	s.verifyClientsLocalTailscaled = v
+	s.verifyClientsLocalTailscaled.Store(v)
 }
 
 // SetVerifyClientURL sets the admission controller URL to use for verifying clients.
 // If empty, all clients are accepted (unless restricted by SetVerifyClient checking
 // against tailscaled).
 func (s *Server) SetVerifyClientURL(v string) {
-	s.verifyClientsURL = v
+	s.verifyClientsURL.Store(v)
 }
 
 // SetVerifyClientURLFailOpen sets whether to allow clients to connect if the
 // admission controller URL is unreachable.
 func (s *Server) SetVerifyClientURLFailOpen(v bool) {
-	s.verifyClientsURLFailOpen = v
+	s.verifyClientsURLFailOpen.Store(v)
 }
 
 // SetTailscaledSocketPath sets the unix socket path to use to talk to
@@ -501,7 +516,7 @@ func (s *Server) SetTailscaledSocketPath(path string) {
 // This timeout does not apply to mesh connections.
 // Defaults to 2 seconds.
 func (s *Server) SetTCPWriteTimeout(d time.Duration) {
-	s.tcpWriteTimeout = d
+	s.tcpWriteTimeout.Store(d)
 }
 
 // minRateLimitTokenBucketSize represents the minimum size of a token bucket
@@ -517,13 +532,57 @@ func (s *Server) SetTCPWriteTimeout(d time.Duration) {
 // in bytes.
 type RateConfig struct {
 	// PerClientRateLimitBytesPerSec represents the per-client
-	// rate limit in bytes per second. A zero value disables all rate limiting.
+	// rate limit in bytes per second. A zero value disables receive rate
+	// limiting.
 	PerClientRateLimitBytesPerSec uint64 `json:",omitzero"`
 	// PerClientRateBurstBytes represents the per-client token bucket depth,
 	// or burst, in bytes. Any value lower than [minRateLimitTokenBucketSize]
 	// will be increased to [minRateLimitTokenBucketSize] before application. Only
 	// relevant if PerClientRateLimitBytesPerSec is nonzero.
 	PerClientRateBurstBytes uint64 `json:",omitzero"`
+
+	// PerSenderRateLimitPacketsPerSec is the rate, in packets per second,
+	// at which each client may send non-disco packets to other clients.
+	// Unlike the per-client limit, which slows down reads from a client,
+	// packets over this limit are dropped. A zero value disables per-sender
+	// rate limiting.
+	PerSenderRateLimitPacketsPerSec uint64 `json:",omitzero"`
+	// PerSenderRateBurstPackets is the per-sender token bucket depth, in
+	// packets. Values lower than 1 are increased to 1. Only relevant if
+	// PerSenderRateLimitPacketsPerSec is nonzero.
+	PerSenderRateBurstPackets uint64 `json:",omitzero"`
+
+	// FairQueueing, if true, makes the server share each client's send
+	// queue among the peers sending to it: when the queue is full, a packet
+	// from a peer that holds more than its share of the queue is dropped,
+	// rather than the oldest queued packet.
+	FairQueueing bool `json:",omitzero"`
+
+	// PerPairDiscoRateLimitPacketsPerSec is the rate, in packets per
+	// second, at which disco packets from one node to another are queued
+	// to the destination, whether the sender is connected to this server
+	// or to a mesh peer. Disco packets over this limit are dropped. It
+	// dampens storms of disco pings and call-me-maybes when many nodes
+	// re-handshake at once, such as after a large netmap change. A zero
+	// value disables disco rate limiting.
+	PerPairDiscoRateLimitPacketsPerSec uint64 `json:",omitzero"`
+	// PerPairDiscoRateBurstPackets is the per-pair disco token bucket
+	// depth, in packets. Values lower than 1 are increased to 1. Only
+	// relevant if PerPairDiscoRateLimitPacketsPerSec is nonzero.
+	PerPairDiscoRateBurstPackets uint64 `json:",omitzero"`
+}
+
+// discoRateLimit is the per-pair disco rate limit in effect, from
+// [RateConfig].
+type discoRateLimit struct {
+	packetsPerSec uint64
+	burst         uint64
+}
+
+// idle returns how long a pair's token bucket takes to fill back up from
+// empty, after which its limiter is indistinguishable from a new one.
+func (dr *discoRateLimit) idle() time.Duration {
+	return time.Duration(float64(dr.burst) / float64(dr.packetsPerSec) * float64(time.Second))
 }
 
 // LoadRateConfig reads and JSON-unmarshals a [RateConfig] from the file at path.
@@ -550,28 +609,49 @@ func (s *Server) LoadAndApplyRateConfig(path string) error {
 		return err
 	}
 	applied := s.UpdateRateLimits(rc)
-	s.logf("rate config applied: client-rate=%d bytes/sec, client-burst=%d bytes",
-		applied.PerClientRateLimitBytesPerSec, applied.PerClientRateBurstBytes)
+	s.logf("rate config applied: client-rate=%d bytes/sec, client-burst=%d bytes, sender-rate=%d packets/sec, sender-burst=%d packets, fair-queueing=%v, disco-rate=%d packets/sec, disco-burst=%d packets",
+		applied.PerClientRateLimitBytesPerSec, applied.PerClientRateBurstBytes,
+		applied.PerSenderRateLimitPacketsPerSec, applied.PerSenderRateBurstPackets,
+		applied.FairQueueing,
+		applied.PerPairDiscoRateLimitPacketsPerSec, applied.PerPairDiscoRateBurstPackets)
 	return nil
 }
 
-// UpdateRateLimits sets the receive rate limits, updating all existing client
-// connections. It returns the applied config, which may differ from rc. If the
-// per-client rate limits is 0, rate limiting is disabled. Mesh peers are always
-// exempt from rate limiting.
+// UpdateRateLimits sets the receive, per-sender and per-pair disco rate
+// limits and whether fair queueing is enabled, updating all existing client
+// connections. It returns the applied config, which may differ from rc. A
+// rate limit of 0 disables that limit. Mesh peers are exempt from the receive
+// and per-sender rate limits, but disco packets they forward are subject to
+// the per-pair disco rate limit of their original sender.
 func (s *Server) UpdateRateLimits(rc RateConfig) (applied RateConfig) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if rc.PerClientRateLimitBytesPerSec == 0 {
-		// all rate limiting is disabled
-		rc = RateConfig{}
+		rc.PerClientRateBurstBytes = 0
 	} else {
 		rc.PerClientRateBurstBytes = max(rc.PerClientRateBurstBytes, minRateLimitTokenBucketSize)
 	}
+	if rc.PerSenderRateLimitPacketsPerSec == 0 {
+		rc.PerSenderRateBurstPackets = 0
+	} else {
+		rc.PerSenderRateBurstPackets = max(rc.PerSenderRateBurstPackets, 1)
+	}
+	if rc.PerPairDiscoRateLimitPacketsPerSec == 0 {
+		rc.PerPairDiscoRateBurstPackets = 0
+		s.discoRate.Store(nil)
+	} else {
+		rc.PerPairDiscoRateBurstPackets = max(rc.PerPairDiscoRateBurstPackets, 1)
+		s.discoRate.Store(&discoRateLimit{
+			packetsPerSec: rc.PerPairDiscoRateLimitPacketsPerSec,
+			burst:         rc.PerPairDiscoRateBurstPackets,
+		})
+	}
 	s.rateConfig = rc
+	s.fairQueueing.Store(rc.FairQueueing)
 	for _, cs := range s.clients {
 		cs.ForeachClient(func(c *sclient) {
 			c.setRateLimit(rc.PerClientRateLimitBytesPerSec, rc.PerClientRateBurstBytes)
+			c.setSendRateLimit(rc.PerSenderRateLimitPacketsPerSec, rc.PerSenderRateBurstPackets)
 		})
 	}
 	return rc
@@ -740,6 +820,7 @@ func (s *Server) registerClient(c *sclient) {
 	defer s.mu.Unlock()
 
 	c.setRateLimit(s.rateConfig.PerClientRateLimitBytesPerSec, s.rateConfig.PerClientRateBurstBytes)
+	c.setSendRateLimit(s.rateConfig.PerSenderRateLimitPacketsPerSec, s.rateConfig.PerSenderRateBurstPackets)
 
 	cs, ok := s.clients[c.key]
 	if !ok {
@@ -933,6 +1014,7 @@ func (s *Server) notePeerGoneFromRegionLocked(key key.NodePublic) {
 		go f(key)
 	}
 	delete(s.peerGoneWatchers, key)
+	s.senderDrops.Delete(nodeLabel(key))
 }
 
 // requestPeerGoneWriteLimited sends a request to write a "peer gone"
@@ -1020,7 +1102,10 @@ func (s *Server) accept(ctx context.Context, nc derp.Conn, brw *bufio.ReadWriter
 		sendQueue:      make(chan pkt, s.perClientSendQueueDepth),
 		discoSendQueue: make(chan pkt, s.perClientSendQueueDepth),
 		sendPongCh:     make(chan [8]byte, 1),
+		speedTestAck:   make(chan struct{}, 1),
 		peerGone:       make(chan peerGoneMsg),
+		sharedOut:      make(chan sharedFrame),
+		sharedClose:    make(chan struct{}, 1),
 		canMesh:        s.isMeshPeer(clientInfo),
 		isNotIdealConn: IdealNodeContextKey.Value(ctx) != "",
 		peerGoneLim:    rate.NewLimiter(rate.Every(time.Second), 3),
@@ -1042,7 +1127,7 @@ func (s *Server) accept(ctx context.Context, nc derp.Conn, brw *bufio.ReadWriter
 	s.registerClient(c)
 	defer s.unregisterClient(c)
 
-	err = s.sendServerInfo(c.bw, clientKey)
+	err = s.sendServerInfo(c.bw, clientKey, !c.isSharedStream())
 	if err != nil {
 		return fmt.Errorf("send server info: %v", err)
 	}
@@ -1063,6 +1148,7 @@ func (c *sclient) run(ctx context.Context) error {
 	var grp errgroup.Group
 	sendCtx, cancelSender := context.WithCancel(ctx)
 	grp.Go(func() error { return c.sendLoop(sendCtx) })
+	defer c.closeSharedStreams()
 	defer func() {
 		cancelSender()
 		if err := grp.Wait(); err != nil && !c.s.isClosed() {
@@ -1100,7 +1186,8 @@ func (c *sclient) run(ctx context.Context) error {
 		}
 		// Rate-limit by DERP frame length (fl), which excludes TLS protocol and
 		// DERP frame length field overheads.
-		// Note: meshed clients are exempt from rate limits.
+		// Note: meshed clients are exempt from rate limits. Shared streams
+		// count against both their carrier's limit and their own.
 		if err := c.rateLimit(int(fl)); err != nil {
 			return err // context canceled, connection closing
 		}
@@ -1119,6 +1206,12 @@ func (c *sclient) run(ctx context.Context) error {
 			err = c.handleFrameClosePeer(ft, fl)
 		case derp.FramePing:
 			err = c.handleFramePing(ft, fl)
+		case derp.FrameSpeedTest:
+			err = c.handleFrameSpeedTest(ft, fl)
+		case derp.FrameSharedData:
+			err = c.handleFrameSharedData(ft, fl)
+		case derp.FrameSharedClose:
+			err = c.handleFrameSharedClose(ft, fl)
 		default:
 			err = c.handleUnknownFrame(ft, fl)
 		}
@@ -1184,6 +1277,30 @@ func (c *sclient) handleFramePing(ft derp.FrameType, fl uint32) error {
 	return err
 }
 
+// handleFrameSpeedTest reads a speed test frame from the client, and requests
+// that the sendLoop acknowledge it.
+func (c *sclient) handleFrameSpeedTest(ft derp.FrameType, fl uint32) error {
+	if fl < 8 || fl > derp.MaxPacketSize {
+		return fmt.Errorf("speed test frame size %d out of range", fl)
+	}
+	var seq [8]byte
+	if _, err := bufiox.ReadFull(c.br, seq[:]); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(io.Discard, c.br, int64(fl)-int64(len(seq))); err != nil {
+		return err
+	}
+	c.s.gotSpeedTestBytes.Add(int64(fl))
+	c.speedTestSeq.Store(binary.BigEndian.Uint64(seq[:]))
+	c.speedTestBytes.Add(uint64(fl))
+	select {
+	case c.speedTestAck <- struct{}{}:
+	default:
+		// An ack is already pending, and will cover this frame too.
+	}
+	return nil
+}
+
 func (c *sclient) handleFrameClosePeer(ft derp.FrameType, fl uint32) error {
 	if fl != derp.KeyLen {
 		return fmt.Errorf("handleFrameClosePeer wrong size")
@@ -1268,6 +1385,10 @@ func (c *sclient) handleFrameSendPacket(_ derp.FrameType, fl uint32) error {
 	if err != nil {
 		return fmt.Errorf("client %v: recvPacket: %v", c.key, err)
 	}
+	if lim := c.sendLim.Load(); lim != nil && !disco.LooksLikeDiscoWrapper(contents) && !lim.Allow() {
+		s.recordSenderDrop(contents, c.key, dstKey, dropReasonSenderRateLimited)
+		return nil
+	}
 
 	var fwd PacketForwarder
 	var dstLen int
@@ -1325,6 +1446,17 @@ func (c *sclient) setRateLimit(bytesPerSec, burst uint64) {
 	c.recvLim.Store(limiter)
 }
 
+// setSendRateLimit updates the per-sender rate limiter. When packetsPerSec
+// is 0, or the client is a mesh peer, the limiter is set to nil so that the
+// client's packets aren't limited.
+func (c *sclient) setSendRateLimit(packetsPerSec, burst uint64) {
+	if c.canMesh || packetsPerSec == 0 {
+		c.sendLim.Store(nil)
+		return
+	}
+	c.sendLim.Store(rate.NewLimiter(rate.Limit(packetsPerSec), int(max(burst, 1))))
+}
+
 // rateLimitWait is a reimplementation of [xrate.Limiter.WaitN] via [xrate.Limiter.ReserveN].
 // It returns the duration waited for tokens to become available.
 func rateLimitWait(ctx context.Context, lim *xrate.Limiter, n int, now time.Time, newTimer func(time.Duration) (<-chan time.Time, func() bool)) (time.Duration, error) {
@@ -1403,13 +1535,16 @@ type dropReasonKindLabels struct {
 type dropReason string
 
 const (
-	dropReasonUnknownDest      dropReason = "unknown_dest"        // unknown destination pubkey
-	dropReasonUnknownDestOnFwd dropReason = "unknown_dest_on_fwd" // unknown destination pubkey on a derp-forwarded packet
-	dropReasonGoneDisconnected dropReason = "gone_disconnected"   // destination tailscaled disconnected before we could send
-	dropReasonQueueHead        dropReason = "queue_head"          // destination queue is full, dropped packet at queue head
-	dropReasonQueueTail        dropReason = "queue_tail"          // destination queue is full, dropped packet at queue tail
-	dropReasonWriteError       dropReason = "write_error"         // OS write() failed
-	dropReasonDupClient        dropReason = "dup_client"          // the public key is connected 2+ times (active/active, fighting)
+	dropReasonUnknownDest       dropReason = "unknown_dest"        // unknown destination pubkey
+	dropReasonUnknownDestOnFwd  dropReason = "unknown_dest_on_fwd" // unknown destination pubkey on a derp-forwarded packet
+	dropReasonGoneDisconnected  dropReason = "gone_disconnected"   // destination tailscaled disconnected before we could send
+	dropReasonQueueHead         dropReason = "queue_head"          // destination queue is full, dropped packet at queue head
+	dropReasonQueueTail         dropReason = "queue_tail"          // destination queue is full, dropped packet at queue tail
+	dropReasonWriteError        dropReason = "write_error"         // OS write() failed
+	dropReasonDupClient         dropReason = "dup_client"          // the public key is connected 2+ times (active/active, fighting)
+	dropReasonSenderRateLimited dropReason = "sender_rate_limited" // source exceeded its per-sender packet rate limit
+	dropReasonFairShare         dropReason = "fair_share"          // destination queue is full and source holds more than its share of it
+	dropReasonDiscoRateLimited  dropReason = "disco_rate_limited"  // source exceeded the per-pair disco rate limit to the destination
 )
 
 func (s *Server) recordDrop(packetBytes []byte, srcKey, dstKey key.NodePublic, reason dropReason) {
@@ -1436,6 +1571,20 @@ func (s *Server) recordDrop(packetBytes []byte, srcKey, dstKey key.NodePublic, r
 	s.debugLogf("dropping packet reason=%s dst=%s disco=%v", reason, dstKey, looksDisco)
 }
 
+// recordSenderDrop is like recordDrop, for drops that are attributed to the
+// sender srcKey, such as those due to per-sender or disco rate limiting or
+// fair queueing. It also counts the drop against srcKey in s.senderDrops.
+func (s *Server) recordSenderDrop(packetBytes []byte, srcKey, dstKey key.NodePublic, reason dropReason) {
+	s.recordDrop(packetBytes, srcKey, dstKey, reason)
+	s.senderDrops.Add(nodeLabel(srcKey), 1)
+}
+
+// nodeLabel returns the metric label value for k: a short prefix of its
+// public key, as in [key.NodePublic.ShortString], without the brackets.
+func nodeLabel(k key.NodePublic) string {
+	return strings.Trim(k.ShortString(), "[]")
+}
+
 func (c *sclient) sendPkt(dst *sclient, p pkt) error {
 	s := c.s
 	dstKey := dst.key
@@ -1445,11 +1594,22 @@ func (c *sclient) sendPkt(dst *sclient, p pkt) error {
 	// fresher packets.
 	sendQueue := dst.sendQueue
 	if disco.LooksLikeDiscoWrapper(p.bs) {
+		if !dst.allowDisco(p.src) {
+			s.recordSenderDrop(p.bs, p.src, dstKey, dropReasonDiscoRateLimited)
+			dst.debugLogf("sendPkt dropped, disco rate limited from %s", p.src.ShortString())
+			return nil
+		}
 		sendQueue = dst.discoSendQueue
+	} else if s.fairQueueing.Load() {
+		// Count p against its sender before it's visible to the
+		// sendLoop, which uncounts it when it dequeues it.
+		p.counted = true
+		dst.noteEnqueued(p.src)
 	}
 	for attempt := range 3 {
 		select {
 		case <-dst.ctx.Done():
+			dst.noteDequeued(p)
 			s.recordDrop(p.bs, c.key, dstKey, dropReasonGoneDisconnected)
 			dst.debugLogf("sendPkt attempt %d dropped, dst gone", attempt)
 			return nil
@@ -1462,8 +1622,19 @@ func (c *sclient) sendPkt(dst *sclient, p pkt) error {
 		default:
 		}
 
+		// The queue is full. If fair queueing is on and p's sender
+		// is hogging the queue, drop p rather than the packet at
+		// the head, which is likely from someone else.
+		if p.counted && dst.overFairShare(p.src) {
+			dst.noteDequeued(p)
+			s.recordSenderDrop(p.bs, p.src, dstKey, dropReasonFairShare)
+			dst.debugLogf("sendPkt attempt %d dropped, sender over fair share", attempt)
+			return nil
+		}
+
 		select {
 		case pkt := <-sendQueue:
+			dst.noteDequeued(pkt)
 			s.recordDrop(pkt.bs, c.key, dstKey, dropReasonQueueHead)
 			c.recordQueueTime(pkt.enqueuedAt)
 		default:
@@ -1472,6 +1643,7 @@ func (c *sclient) sendPkt(dst *sclient, p pkt) error {
 	// Failed to make room for packet. This can happen in a heavily
 	// contended queue with racing writers. Give up and tail-drop in
 	// this case to keep reader unblocked.
+	dst.noteDequeued(p)
 	s.recordDrop(p.bs, c.key, dstKey, dropReasonQueueTail)
 	dst.debugLogf("sendPkt attempt %d dropped, queue full")
 
@@ -1538,7 +1710,7 @@ func (s *Server) verifyClient(ctx context.Context, clientKey key.NodePublic, inf
 	}
 
 	// tailscaled-based verification:
-	if s.verifyClientsLocalTailscaled {
+	if s.verifyClientsLocalTailscaled.Load() {
 		_, err := s.localClient.WhoIsNodeKey(ctx, clientKey)
 		if err == local.ErrPeerNotFound {
 			return fmt.Errorf("peer %v not authorized (not found in local tailscaled)", clientKey)
@@ -1553,7 +1725,7 @@ func (s *Server) verifyClient(ctx context.Context, clientKey key.NodePublic, inf
 	}
 
 	// admission controller-based verification:
-	if s.verifyClientsURL != "" {
+	if verifyURL := s.verifyClientsURL.Load(); verifyURL != "" {
 		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 		defer cancel()
 
@@ -1564,13 +1736,13 @@ func (s *Server) verifyClient(ctx context.Context, clientKey key.NodePublic, inf
 		if err != nil {
 			return err
 		}
-		req, err := http.NewRequestWithContext(ctx, "POST", s.verifyClientsURL, bytes.NewReader(jreq))
+		req, err := http.NewRequestWithContext(ctx, "POST", verifyURL, bytes.NewReader(jreq))
 		if err != nil {
 			return err
 		}
 		res, err := http.DefaultClient.Do(req)
 		if err != nil {
-			if s.verifyClientsURLFailOpen {
+			if s.verifyClientsURLFailOpen.Load() {
 				s.logf("admission controller unreachable; allowing client %v", clientKey)
 				return nil
 			}
@@ -1660,8 +1832,11 @@ func (s *Server) noteClientActivity(c *sclient) {
 
 type ServerInfo = derp.ServerInfo
 
-func (s *Server) sendServerInfo(bw *lazyBufioWriter, clientKey key.NodePublic) error {
-	msg, err := json.Marshal(ServerInfo{Version: derp.ProtocolVersion})
+func (s *Server) sendServerInfo(bw *lazyBufioWriter, clientKey key.NodePublic, sharedStreams bool) error {
+	msg, err := json.Marshal(ServerInfo{
+		Version:       derp.ProtocolVersion,
+		SharedStreams: sharedStreams,
+	})
 	if err != nil {
 		return err
 	}
@@ -1784,8 +1959,11 @@ type sclient struct {
 	sendQueue      chan pkt         // packets queued to this client; never closed
 	discoSendQueue chan pkt         // important packets queued to this client; never closed
 	sendPongCh     chan [8]byte     // pong replies to send to the client; never closed
+	speedTestAck   chan struct{}    // write request to ack speed test frames; buffered so requests coalesce; never closed
 	peerGone       chan peerGoneMsg // write request that a peer is not at this server (not used by mesh peers)
 	meshUpdate     chan struct{}    // write request to write peerStateChange
+	sharedOut      chan sharedFrame // write requests for frames of shared streams; never closed
+	sharedClose    chan struct{}    // write request to send sharedClosed; buffered so requests coalesce; never closed
 	canMesh        bool             // clientInfo had correct mesh token for inter-region routing
 	isNotIdealConn bool             // client indicated it is not its ideal node in the region
 	isDup          atomic.Bool      // whether more than 1 sclient for key is connected
@@ -1797,6 +1975,14 @@ type sclient struct {
 	connectedAt time.Time
 	preferred   bool
 
+	// sharedMu guards shared and sharedNextID, the shared streams that
+	// the client carries and the lowest ID a new one may have, and
+	// sharedClosed, the IDs of streams to tell the client are closed.
+	sharedMu     sync.Mutex
+	shared       map[uint32]*sharedStream
+	sharedNextID uint32
+	sharedClosed []uint32
+
 	// Owned by sendLoop, not thread-safe.
 	sawSrc map[key.NodePublic]set.Handle
 	bw     *lazyBufioWriter
@@ -1829,6 +2015,118 @@ type sclient struct {
 	// TODO: consider porting the required APIs from [xrate.Limiter] to [rate.Limiter],
 	// which is already optimized to use [mono.Time].
 	recvLim atomic.Pointer[xrate.Limiter]
+
+	// sendLim limits the rate at which this client may send non-disco
+	// packets to other clients; packets over the limit are dropped. It's
+	// nil when per-sender rate limiting is disabled or the client is a mesh
+	// peer. Updated atomically by [sclient.setSendRateLimit].
+	sendLim atomic.Pointer[rate.Limiter]
+
+	// speedTestSeq and speedTestBytes are the sequence number of the
+	// latest speed test frame from this client and the total size of its
+	// speed test frames, to be acknowledged by the sendLoop.
+	speedTestSeq   atomic.Uint64
+	speedTestBytes atomic.Uint64
+
+	// queuedMu guards queued and queuedTotal, which count the packets in
+	// sendQueue by sender for fair queueing. Only packets with pkt.counted
+	// set are included.
+	queuedMu    sync.Mutex
+	queued      map[key.NodePublic]int
+	queuedTotal int
+
+	// discoMu guards the fields below, which implement the per-pair disco
+	// rate limit for disco packets sent to this client.
+	discoMu        sync.Mutex
+	discoRate      *discoRateLimit // limit that discoLims were created with
+	discoLims      map[key.NodePublic]*discoLimiter
+	discoPruneSize int // len(discoLims) at which to next prune idle limiters
+}
+
+// discoLimiter is the token bucket for disco packets from one sender to an
+// sclient.
+type discoLimiter struct {
+	lim      *rate.Limiter
+	lastUsed mono.Time
+}
+
+// minDiscoPruneSize is the minimum number of senders' disco limiters an
+// sclient keeps before pruning idle ones.
+const minDiscoPruneSize = 64
+
+// allowDisco reports whether a disco packet from src may be queued to c
+// under the server's per-pair disco rate limit, if any.
+func (c *sclient) allowDisco(src key.NodePublic) bool {
+	dr := c.s.discoRate.Load()
+	if dr == nil {
+		return true
+	}
+	now := mono.Now()
+	c.discoMu.Lock()
+	defer c.discoMu.Unlock()
+	if c.discoRate != dr {
+		// The rate config was (re)applied. Start over with full buckets.
+		c.discoRate = dr
+		clear(c.discoLims)
+	}
+	dl, ok := c.discoLims[src]
+	if !ok {
+		if len(c.discoLims) >= c.discoPruneSize {
+			c.pruneDiscoLimitersLocked(now)
+		}
+		dl = &discoLimiter{lim: rate.NewLimiter(rate.Limit(dr.packetsPerSec), int(dr.burst))}
+		mak.Set(&c.discoLims, src, dl)
+	}
+	dl.lastUsed = now
+	return dl.lim.Allow()
+}
+
+// pruneDiscoLimitersLocked removes the disco limiters of senders that have
+// been quiet long enough for their buckets to refill, so that the map doesn't
+// grow without bound as peers come and go. c.discoMu must be held.
+func (c *sclient) pruneDiscoLimitersLocked(now mono.Time) {
+	idle := c.discoRate.idle()
+	for src, dl := range c.discoLims {
+		if now.Sub(dl.lastUsed) >= idle {
+			delete(c.discoLims, src)
+		}
+	}
+	c.discoPruneSize = max(2*len(c.discoLims), minDiscoPruneSize)
+}
+
+// noteEnqueued counts a packet from src as being in c.sendQueue.
+func (c *sclient) noteEnqueued(src key.NodePublic) {
+	c.queuedMu.Lock()
+	defer c.queuedMu.Unlock()
+	mak.Set(&c.queued, src, c.queued[src]+1)
+	c.queuedTotal++
+}
+
+// noteDequeued uncounts p, which has left (or failed to enter) c.sendQueue,
+// if it was counted by noteEnqueued.
+func (c *sclient) noteDequeued(p pkt) {
+	if !p.counted {
+		return
+	}
+	c.queuedMu.Lock()
+	defer c.queuedMu.Unlock()
+	if n := c.queued[p.src]; n > 1 {
+		c.queued[p.src] = n - 1
+	} else {
+		delete(c.queued, p.src)
+	}
+	c.queuedTotal--
+}
+
+// overFairShare reports whether src has more packets counted in c.sendQueue
+// than an equal share of the counted packets among their senders.
+func (c *sclient) overFairShare(src key.NodePublic) bool {
+	c.queuedMu.Lock()
+	defer c.queuedMu.Unlock()
+	if len(c.queued) < 2 {
+		return false
+	}
+	return c.queued[src] > c.queuedTotal/len(c.queued)
 }
 
 func (c *sclient) presentFlags() derp.PeerPresentFlags {
@@ -1869,6 +2167,10 @@ type pkt struct {
 
 	// src is the who's the sender of the packet.
 	src key.NodePublic
+
+	// counted is whether the packet is counted in the destination's
+	// queued map, for fair queueing.
+	counted bool
 }
 
 // peerGoneMsg is a request to write a peerGone frame to an sclient
@@ -1939,6 +2241,7 @@ func (c *sclient) onSendLoopDone() {
 	for {
 		select {
 		case pkt := <-c.sendQueue:
+			c.noteDequeued(pkt)
 			c.s.recordDrop(pkt.bs, pkt.src, c.key, dropReasonGoneDisconnected)
 		case pkt := <-c.discoSendQueue:
 			c.s.recordDrop(pkt.bs, pkt.src, c.key, dropReasonGoneDisconnected)
@@ -1977,6 +2280,7 @@ func (c *sclient) sendLoop(ctx context.Context) error {
 			werr = c.sendMeshUpdates()
 			continue
 		case msg := <-c.sendQueue:
+			c.noteDequeued(msg)
 			werr = c.sendPacket(msg.src, msg.bs)
 			c.recordQueueTime(msg.enqueuedAt)
 			continue
@@ -1987,6 +2291,15 @@ func (c *sclient) sendLoop(ctx context.Context) error {
 		case msg := <-c.sendPongCh:
 			werr = c.sendPong(msg)
 			continue
+		case <-c.speedTestAck:
+			werr = c.sendSpeedTestAck()
+			continue
+		case f := <-c.sharedOut:
+			werr = c.sendShared(f)
+			continue
+		case <-c.sharedClose:
+			werr = c.sendSharedCloses()
+			continue
 		case <-keepAliveTickChannel:
 			werr = c.sendKeepAlive()
 			continue
@@ -2011,6 +2324,7 @@ func (c *sclient) sendLoop(ctx context.Context) error {
 		case <-c.meshUpdate:
 			werr = c.sendMeshUpdates()
 		case msg := <-c.sendQueue:
+			c.noteDequeued(msg)
 			werr = c.sendPacket(msg.src, msg.bs)
 			c.recordQueueTime(msg.enqueuedAt)
 		case msg := <-c.discoSendQueue:
@@ -2018,6 +2332,12 @@ func (c *sclient) sendLoop(ctx context.Context) error {
 			c.recordQueueTime(msg.enqueuedAt)
 		case msg := <-c.sendPongCh:
 			werr = c.sendPong(msg)
+		case <-c.speedTestAck:
+			werr = c.sendSpeedTestAck()
+		case f := <-c.sharedOut:
+			werr = c.sendShared(f)
+		case <-c.sharedClose:
+			werr = c.sendSharedCloses()
 		case <-keepAliveTickChannel:
 			werr = c.sendKeepAlive()
 		}
@@ -2025,7 +2345,7 @@ func (c *sclient) sendLoop(ctx context.Context) error {
 }
 
 func (c *sclient) setWriteDeadline() {
-	d := c.s.tcpWriteTimeout
+	d := c.s.tcpWriteTimeout.Load()
 	if c.canMesh {
 		// Trusted peers get more tolerance.
 		//
@@ -2068,6 +2388,20 @@ func (c *sclient) sendPong(data [8]byte) error {
 	return err
 }
 
+// sendSpeedTestAck acknowledges the speed test frames received so far,
+// without flushing.
+func (c *sclient) sendSpeedTestAck() error {
+	c.setWriteDeadline()
+	if err := derp.WriteFrameHeader(c.bw.bw(), derp.FrameSpeedTestAck, 16); err != nil {
+		return err
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[0:8], c.speedTestSeq.Load())
+	binary.BigEndian.PutUint64(b[8:16], c.speedTestBytes.Load())
+	_, err := c.bw.Write(b[:])
+	return err
+}
+
 const (
 	peerGoneFrameLen    = derp.KeyLen + 1
 	peerPresentFrameLen = derp.KeyLen + 16 + 2 + 1 // 16 byte IP + 2 byte port + 1 byte flags
@@ -2377,6 +2711,8 @@ func (s *Server) ExpVar(rateLimitEnabled bool) expvar.Var {
 	m.Set("gauge_current_connections", &s.curClients)
 	m.Set("gauge_current_home_connections", &s.curHomeClients)
 	m.Set("gauge_current_notideal_connections", &s.curClientsNotIdeal)
+	m.Set("gauge_current_shared_streams", &s.curSharedStreams)
+	m.Set("counter_shared_streams", &s.sharedStreamsTotal)
 	m.Set("gauge_clients_total", s.expVarFunc(func() any { return len(s.clientsMesh) }))
 	m.Set("gauge_clients_local", s.expVarFunc(func() any { return len(s.clients) }))
 	m.Set("gauge_clients_remote", s.expVarFunc(func() any { return len(s.clientsMesh) - len(s.clients) }))
@@ -2394,6 +2730,7 @@ func (s *Server) ExpVar(rateLimitEnabled bool) expvar.Var {
 	m.Set("home_moves_out", &s.homeMovesOut)
 	m.Set("got_ping", &s.gotPing)
 	m.Set("sent_pong", &s.sentPong)
+	m.Set("got_speed_test_bytes", &s.gotSpeedTestBytes)
 	m.Set("peer_gone_disconnected_frames", &s.peerGoneDisconnectedFrames)
 	m.Set("peer_gone_not_here_frames", &s.peerGoneNotHereFrames)
 	m.Set("packets_forwarded_out", &s.packetsForwardedOut)
@@ -2423,6 +2760,25 @@ func (s *Server) ExpVar(rateLimitEnabled bool) expvar.Var {
 			return s.rateConfig.PerClientRateBurstBytes
 		}))
 		m.Set("rate_limit_per_client_waited", &s.rateLimitPerClientWaited)
+		m.Set("rate_limit_per_sender_packets_per_second", s.expVarFunc(func() any {
+			return s.rateConfig.PerSenderRateLimitPacketsPerSec
+		}))
+		m.Set("rate_limit_per_sender_burst_packets", s.expVarFunc(func() any {
+			return s.rateConfig.PerSenderRateBurstPackets
+		}))
+		m.Set("gauge_fair_queueing", expvar.Func(func() any {
+			if s.fairQueueing.Load() {
+				return 1
+			}
+			return 0
+		}))
+		m.Set("counter_sender_drops_by_node", &s.senderDrops)
+		m.Set("rate_limit_per_pair_disco_packets_per_second", s.expVarFunc(func() any {
+			return s.rateConfig.PerPairDiscoRateLimitPacketsPerSec
+		}))
+		m.Set("rate_limit_per_pair_disco_burst_packets", s.expVarFunc(func() any {
+			return s.rateConfig.PerPairDiscoRateBurstPackets
+		}))
 	}
 	return m
 }
@@ -2461,7 +2817,7 @@ func (s *Server) ConsistencyCheck() error {
 			len(s.clients)))
 	}
 
-	if s.verifyClientsLocalTailscaled {
+	if s.verifyClientsLocalTailscaled.Load() {
 		if err := s.checkVerifyClientsLocalTailscaled(); err != nil {
 			errs = append(errs, err.Error())
 		}
@@ -5,6 +5,7 @@
 
 import (
 	"bufio"
+	"bytes"
 	"cmp"
 	"context"
 	"crypto/x509"
@@ -13,6 +14,7 @@
 	"expvar"
 	"fmt"
 	"log"
+	"maps"
 	"net"
 	"os"
 	"path/filepath"
@@ -29,6 +31,8 @@
 	"golang.org/x/time/rate"
 	"tailscale.com/derp"
 	"tailscale.com/derp/derpconst"
+	"tailscale.com/disco"
+	"tailscale.com/tstime/mono"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/set"
@@ -1465,3 +1469,353 @@ func BenchmarkSenderCardinalityOverhead(b *testing.B) {
 		}
 	})
 }
+
+func TestPerSenderRateLimit(t *testing.T) {
+	s := New(key.NewNode(), logger.Discard)
+	defer s.Close()
+
+	c := &sclient{
+		ctx:  context.Background(),
+		s:    s,
+		key:  key.NewNode().Public(),
+		logf: logger.Discard,
+	}
+	cs := &clientSet{}
+	cs.activeClient.Store(c)
+	s.mu.Lock()
+	s.clients[c.key] = cs
+	s.mu.Unlock()
+
+	applied := s.UpdateRateLimits(RateConfig{PerSenderRateLimitPacketsPerSec: 1})
+	if applied.PerSenderRateBurstPackets != 1 {
+		t.Errorf("applied burst = %d; want 1", applied.PerSenderRateBurstPackets)
+	}
+	if c.sendLim.Load() == nil {
+		t.Fatal("expected non-nil sender limiter")
+	}
+
+	// Send two packets to an unknown destination. The first uses the
+	// limiter's only token; the second is dropped against the sender.
+	dstKey := key.NewNode().Public()
+	send := func() {
+		t.Helper()
+		frame := append(dstKey.AppendTo(nil), "not disco"...)
+		c.br = bufio.NewReader(bytes.NewReader(frame))
+		if err := c.handleFrameSendPacket(derp.FrameSendPacket, uint32(len(frame))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send()
+	if got := s.senderDrops.Get(nodeLabel(c.key)).Value(); got != 0 {
+		t.Errorf("after first packet, sender drops = %d; want 0", got)
+	}
+	send()
+	if got := s.senderDrops.Get(nodeLabel(c.key)).Value(); got != 1 {
+		t.Errorf("after second packet, sender drops = %d; want 1", got)
+	}
+
+	s.UpdateRateLimits(RateConfig{})
+	if c.sendLim.Load() != nil {
+		t.Error("expected nil sender limiter after disable")
+	}
+}
+
+func TestFairQueueing(t *testing.T) {
+	s := New(key.NewNode(), logger.Discard)
+	defer s.Close()
+	s.UpdateRateLimits(RateConfig{FairQueueing: true})
+
+	newClient := func() *sclient {
+		return &sclient{
+			ctx:            context.Background(),
+			s:              s,
+			key:            key.NewNode().Public(),
+			logf:           logger.Discard,
+			sendQueue:      make(chan pkt, 4),
+			discoSendQueue: make(chan pkt, 4),
+		}
+	}
+	dst, chatty, quiet := newClient(), newClient(), newClient()
+	send := func(src *sclient) {
+		t.Helper()
+		if err := src.sendPkt(dst, pkt{bs: []byte("not disco"), src: src.key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queuedBy := func() map[key.NodePublic]int {
+		dst.queuedMu.Lock()
+		defer dst.queuedMu.Unlock()
+		return maps.Clone(dst.queued)
+	}
+
+	// chatty fills dst's queue by itself.
+	for range 4 {
+		send(chatty)
+	}
+	// quiet's packet displaces one of chatty's from the head of the queue.
+	send(quiet)
+	if got, want := queuedBy(), map[key.NodePublic]int{chatty.key: 3, quiet.key: 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("queued = %v; want %v", got, want)
+	}
+	// chatty holds more than its share, so its next packet is dropped
+	// instead of quiet's.
+	send(chatty)
+	if got, want := queuedBy(), map[key.NodePublic]int{chatty.key: 3, quiet.key: 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("queued = %v; want %v", got, want)
+	}
+	if got := s.senderDrops.Get(nodeLabel(chatty.key)).Value(); got != 1 {
+		t.Errorf("chatty sender drops = %d; want 1", got)
+	}
+	if got := s.senderDrops.Get(nodeLabel(quiet.key)).Value(); got != 0 {
+		t.Errorf("quiet sender drops = %d; want 0", got)
+	}
+
+	// Dequeuing everything leaves nothing counted.
+	for range 4 {
+		dst.noteDequeued(<-dst.sendQueue)
+	}
+	if got := queuedBy(); len(got) != 0 || dst.queuedTotal != 0 {
+		t.Errorf("after draining, queued = %v, total = %d; want empty", got, dst.queuedTotal)
+	}
+}
+
+func TestPerPairDiscoRateLimit(t *testing.T) {
+	s := New(key.NewNode(), logger.Discard)
+	defer s.Close()
+	applied := s.UpdateRateLimits(RateConfig{PerPairDiscoRateLimitPacketsPerSec: 1, PerPairDiscoRateBurstPackets: 2})
+	if applied.PerPairDiscoRateBurstPackets != 2 {
+		t.Errorf("applied burst = %d; want 2", applied.PerPairDiscoRateBurstPackets)
+	}
+
+	newClient := func() *sclient {
+		return &sclient{
+			ctx:            context.Background(),
+			s:              s,
+			key:            key.NewNode().Public(),
+			logf:           logger.Discard,
+			sendQueue:      make(chan pkt, 8),
+			discoSendQueue: make(chan pkt, 8),
+		}
+	}
+	// mesh stands in for a mesh peer forwarding disco packets from
+	// senders connected to another server.
+	dst, mesh := newClient(), newClient()
+	discoPkt := append([]byte(disco.Magic), make([]byte, 56)...)
+	send := func(src key.NodePublic) {
+		t.Helper()
+		if err := mesh.sendPkt(dst, pkt{bs: discoPkt, src: src}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each sender gets its own burst of 2.
+	chatty, quiet := key.NewNode().Public(), key.NewNode().Public()
+	for range 5 {
+		send(chatty)
+	}
+	send(quiet)
+	if got := len(dst.discoSendQueue); got != 3 {
+		t.Errorf("queued %d disco packets; want 3", got)
+	}
+	if got := s.senderDrops.Get(nodeLabel(chatty)).Value(); got != 3 {
+		t.Errorf("chatty sender drops = %d; want 3", got)
+	}
+	if got := s.senderDrops.Get(nodeLabel(quiet)).Value(); got != 0 {
+		t.Errorf("quiet sender drops = %d; want 0", got)
+	}
+
+	// Non-disco packets aren't limited.
+	for range 5 {
+		if err := mesh.sendPkt(dst, pkt{bs: []byte("not disco"), src: chatty}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(dst.sendQueue); got != 5 {
+		t.Errorf("queued %d non-disco packets; want 5", got)
+	}
+
+	// Idle senders' limiters are pruned once there are enough of them.
+	dst.discoMu.Lock()
+	for range minDiscoPruneSize {
+		dst.discoLims[key.NewNode().Public()] = &discoLimiter{lastUsed: mono.Now().Add(-time.Hour)}
+	}
+	dst.discoMu.Unlock()
+	send(key.NewNode().Public())
+	dst.discoMu.Lock()
+	if got := len(dst.discoLims); got != 3 {
+		t.Errorf("after pruning, %d disco limiters; want 3", got)
+	}
+	dst.discoMu.Unlock()
+
+	// Changing the limit starts over with full buckets; disabling it lets
+	// everything through.
+	s.UpdateRateLimits(RateConfig{PerPairDiscoRateLimitPacketsPerSec: 1})
+	if !dst.allowDisco(chatty) {
+		t.Error("chatty disallowed after limit change")
+	}
+	if dst.allowDisco(chatty) {
+		t.Error("chatty allowed beyond new burst of 1")
+	}
+	s.UpdateRateLimits(RateConfig{})
+	if !dst.allowDisco(chatty) {
+		t.Error("chatty disallowed after disabling limit")
+	}
+}
+
+// newSharedTestClient returns a client connected to s that may open shared
+// streams.
+func newSharedTestClient(t *testing.T, s *Server) *derp.Client {
+	t.Helper()
+	cin, cout := net.Pipe()
+	t.Cleanup(func() {
+		cin.Close()
+		cout.Close()
+	})
+	brwServer := bufio.NewReadWriter(bufio.NewReader(cin), bufio.NewWriter(cin))
+	go s.Accept(t.Context(), cin, brwServer, "test-client")
+
+	brw := bufio.NewReadWriter(bufio.NewReader(cout), bufio.NewWriter(cout))
+	c, err := derp.NewClient(key.NewNode(), cout, brw, logger.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSharedStreamLimit(t *testing.T) {
+	s := New(key.NewNode(), logger.Discard)
+	defer s.Close()
+	c := newSharedTestClient(t, s)
+
+	const extra = 10
+	closed := make(chan uint32, extra)
+	go func() {
+		for {
+			m, err := c.Recv()
+			if err != nil {
+				return
+			}
+			if m, ok := m.(derp.SharedCloseMessage); ok {
+				closed <- m.Stream
+			}
+		}
+	}()
+
+	for id := range uint32(derp.MaxSharedStreams + extra) {
+		if err := c.SendSharedData(id, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for want := uint32(derp.MaxSharedStreams); want < derp.MaxSharedStreams+extra; want++ {
+		select {
+		case got := <-closed:
+			if got != want {
+				t.Fatalf("server closed stream %d; want %d", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for server to close stream %d", want)
+		}
+	}
+	if got := s.curSharedStreams.Value(); got != derp.MaxSharedStreams {
+		t.Errorf("curSharedStreams = %d; want %d", got, derp.MaxSharedStreams)
+	}
+}
+
+func TestSharedStreamNested(t *testing.T) {
+	s := New(key.NewNode(), logger.Discard)
+	defer s.Close()
+	carrier := newSharedTestClient(t, s)
+
+	// Tunnel a client through stream 0 of carrier.
+	inner, pump := net.Pipe()
+	t.Cleanup(func() {
+		inner.Close()
+		pump.Close()
+	})
+	go func() {
+		buf := make([]byte, 64<<10)
+		for {
+			n, err := pump.Read(buf)
+			if err != nil {
+				return
+			}
+			if err := carrier.SendSharedData(0, buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+	closed := make(chan struct{})
+	go func() {
+		for {
+			m, err := carrier.Recv()
+			if err != nil {
+				return
+			}
+			switch m := m.(type) {
+			case derp.SharedDataMessage:
+				if _, err := pump.Write(m.Data); err != nil {
+					return
+				}
+			case derp.SharedCloseMessage:
+				if m.Stream == 0 {
+					close(closed)
+					return
+				}
+			}
+		}
+	}()
+
+	if err := carrier.SendSharedData(0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	brw := bufio.NewReadWriter(bufio.NewReader(inner), bufio.NewWriter(inner))
+	c, err := derp.NewClient(key.NewNode(), inner, brw, logger.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	si, ok := m.(derp.ServerInfoMessage)
+	if !ok {
+		t.Fatalf("got %T; want ServerInfoMessage", m)
+	}
+	if si.SharedStreams {
+		t.Error("server offered shared streams over a shared stream")
+	}
+
+	if err := c.SendSharedData(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("server didn't close the shared stream after it sent a shared data frame")
+	}
+}
+
+func TestSharedStreamIDsExhausted(t *testing.T) {
+	s := New(key.NewNode(), logger.Discard)
+	defer s.Close()
+	c := newSharedTestClient(t, s)
+
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := c.Recv(); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	if err := c.SendSharedData(1<<32-1, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errc:
+	case <-time.After(10 * time.Second):
+		t.Fatal("server didn't close the connection after stream ID 0xffffffff")
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derpserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/derp"
+	"tailscale.com/syncs"
+	"tailscale.com/util/bufiox"
+)
+
+// sharedStreamQueueDepth is how many frames of data from the client a shared
+// stream buffers before the carrier's read loop waits for it to catch up.
+const sharedStreamQueueDepth = 32
+
+// maxPendingSharedCloses is how many closings of shared streams beyond
+// [derp.MaxSharedStreams] may await sending to a client. Clients that open
+// such streams faster than they read the closings are disconnected.
+const maxPendingSharedCloses = derp.MaxSharedStreams
+
+// maxServerSharedStreams is the most shared streams that a server carries
+// at once, across all its clients. Streams beyond it are closed as those
+// beyond [derp.MaxSharedStreams] are. Carriers opening streams concurrently
+// may overshoot it slightly.
+const maxServerSharedStreams = 64 << 10
+
+// sharedFrame is a frame of data of a shared stream for an sclient's
+// sendLoop to write.
+type sharedFrame struct {
+	stream uint32
+	data   []byte // owned by the sharedFrame
+}
+
+// sharedStream is the DERP connection of another client, tunneled through
+// the connection of its carrier in [derp.FrameSharedData] frames. It's
+// served with Accept as any other connection, so the client behind it
+// authenticates and is subject to the server's policies as if it had
+// connected directly.
+//
+// It implements [derp.Conn]. Its deadlines only interrupt Read and Write
+// calls that start after they're set, which is all Accept needs.
+type sharedStream struct {
+	id      uint32
+	carrier *sclient
+
+	in         chan []byte   // bytes from the client; never closed
+	closed     chan struct{} // closed by Close
+	closeOnce  sync.Once
+	peerClosed atomic.Bool // the client closed the stream, or the carrier's gone, so it needn't be told
+
+	readDeadline  syncs.AtomicValue[time.Time]
+	writeDeadline syncs.AtomicValue[time.Time]
+
+	// Owned by Read.
+	buf []byte // unread bytes of the last from in
+}
+
+func (ss *sharedStream) Read(p []byte) (int, error) {
+	if len(ss.buf) == 0 {
+		b, err := ss.next()
+		if err != nil {
+			return 0, err
+		}
+		ss.buf = b
+	}
+	n := copy(p, ss.buf)
+	ss.buf = ss.buf[n:]
+	return n, nil
+}
+
+// next returns the next bytes from the client.
+func (ss *sharedStream) next() ([]byte, error) {
+	timeout, stop := deadlineChan(ss.readDeadline.Load())
+	defer stop()
+	select {
+	case b := <-ss.in:
+		return b, nil
+	case <-ss.closed:
+		// Deliver what the client sent before closing.
+		select {
+		case b := <-ss.in:
+			return b, nil
+		default:
+			return nil, io.EOF
+		}
+	case <-timeout:
+		return nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (ss *sharedStream) Write(p []byte) (n int, err error) {
+	c := ss.carrier
+	timeout, stop := deadlineChan(ss.writeDeadline.Load())
+	defer stop()
+	for len(p) > 0 {
+		chunk := p[:min(len(p), derp.MaxPacketSize)]
+		f := sharedFrame{stream: ss.id, data: append([]byte(nil), chunk...)}
+		select {
+		case c.sharedOut <- f:
+		case <-ss.closed:
+			return n, net.ErrClosed
+		case <-c.ctx.Done():
+			return n, net.ErrClosed
+		case <-timeout:
+			return n, os.ErrDeadlineExceeded
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// deadlineChan returns a channel that receives when the deadline t passes,
+// or nil if t is zero, and a func to release its resources.
+func deadlineChan(t time.Time) (<-chan time.Time, func()) {
+	if t.IsZero() {
+		return nil, func() {}
+	}
+	tm := time.NewTimer(time.Until(t))
+	return tm.C, func() { tm.Stop() }
+}
+
+// Close closes the stream, telling the client unless it closed it.
+func (ss *sharedStream) Close() error {
+	ss.closeOnce.Do(func() {
+		close(ss.closed)
+		c := ss.carrier
+		c.sharedMu.Lock()
+		delete(c.shared, ss.id)
+		if !ss.peerClosed.Load() {
+			c.queueSharedCloseLocked(ss.id)
+		}
+		c.sharedMu.Unlock()
+		c.s.curSharedStreams.Add(-1)
+	})
+	return nil
+}
+
+// queueSharedCloseLocked queues telling the client that the shared stream
+// with ID id is closed, and requests that the sendLoop do so. It doesn't
+// block.
+//
+// c.sharedMu must be held.
+func (c *sclient) queueSharedCloseLocked(id uint32) {
+	c.sharedClosed = append(c.sharedClosed, id)
+	select {
+	case c.sharedClose <- struct{}{}:
+	default:
+	}
+}
+
+func (ss *sharedStream) LocalAddr() net.Addr { return ss.carrier.nc.LocalAddr() }
+
+func (ss *sharedStream) SetDeadline(t time.Time) error {
+	ss.readDeadline.Store(t)
+	ss.writeDeadline.Store(t)
+	return nil
+}
+
+func (ss *sharedStream) SetReadDeadline(t time.Time) error {
+	ss.readDeadline.Store(t)
+	return nil
+}
+
+func (ss *sharedStream) SetWriteDeadline(t time.Time) error {
+	ss.writeDeadline.Store(t)
+	return nil
+}
+
+// isSharedStream reports whether c is connected over a shared stream of
+// another client. Such clients can't carry shared streams themselves, lest
+// one connection open streams within streams without bound.
+func (c *sclient) isSharedStream() bool {
+	_, ok := c.nc.(*sharedStream)
+	return ok
+}
+
+// handleFrameSharedData reads a shared data frame from the client, and
+// passes its bytes on to the stream, opening the stream if it's new.
+func (c *sclient) handleFrameSharedData(ft derp.FrameType, fl uint32) error {
+	if c.isSharedStream() {
+		return errors.New("shared data frame on a shared stream")
+	}
+	if fl < 4 || fl > 4+derp.MaxPacketSize {
+		return fmt.Errorf("shared data frame size %d out of range", fl)
+	}
+	var idb [4]byte
+	if _, err := bufiox.ReadFull(c.br, idb[:]); err != nil {
+		return err
+	}
+	var data []byte
+	if fl > 4 {
+		data = make([]byte, fl-4)
+		if _, err := io.ReadFull(c.br, data); err != nil {
+			return err
+		}
+	}
+	ss, err := c.sharedStream(binary.BigEndian.Uint32(idb[:]))
+	if err != nil {
+		return err
+	}
+	if ss == nil || len(data) == 0 {
+		return nil
+	}
+	select {
+	case ss.in <- data:
+	case <-ss.closed:
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+	return nil
+}
+
+// sharedStream returns the open shared stream with ID id, opening it if it's
+// new, or nil if it's closed or there are too many, on c or the server. It
+// returns an error, which ends the connection, if id isn't a valid stream
+// ID, or the client keeps opening streams beyond [derp.MaxSharedStreams].
+func (c *sclient) sharedStream(id uint32) (*sharedStream, error) {
+	c.sharedMu.Lock()
+	defer c.sharedMu.Unlock()
+	if ss, ok := c.shared[id]; ok {
+		return ss, nil
+	}
+	if id < c.sharedNextID {
+		// Stream IDs increase, so this is data the client sent before
+		// learning that we closed the stream.
+		return nil, nil
+	}
+	if id == math.MaxUint32 {
+		// sharedNextID would wrap, after which every stream would look
+		// closed.
+		return nil, errors.New("shared stream IDs exhausted")
+	}
+	c.sharedNextID = id + 1
+	if len(c.shared) >= derp.MaxSharedStreams || c.s.curSharedStreams.Value() >= maxServerSharedStreams {
+		if len(c.sharedClosed) >= maxPendingSharedCloses {
+			return nil, errors.New("too many shared streams")
+		}
+		c.logf("closing shared stream %d; too many", id)
+		c.queueSharedCloseLocked(id)
+		return nil, nil
+	}
+	ss := &sharedStream{
+		id:      id,
+		carrier: c,
+		in:      make(chan []byte, sharedStreamQueueDepth),
+		closed:  make(chan struct{}),
+	}
+	if c.shared == nil {
+		c.shared = make(map[uint32]*sharedStream)
+	}
+	c.shared[id] = ss
+	c.s.curSharedStreams.Add(1)
+	c.s.sharedStreamsTotal.Add(1)
+	brw := bufio.NewReadWriter(bufio.NewReader(ss), bufio.NewWriter(ss))
+	go c.s.Accept(c.ctx, ss, brw, c.remoteIPPort.String())
+	return ss, nil
+}
+
+// handleFrameSharedClose reads a shared close frame from the client, and
+// closes the stream.
+func (c *sclient) handleFrameSharedClose(ft derp.FrameType, fl uint32) error {
+	if c.isSharedStream() {
+		return errors.New("shared close frame on a shared stream")
+	}
+	if fl < 4 {
+		return fmt.Errorf("short shared close frame: %v", fl)
+	}
+	var idb [4]byte
+	if _, err := bufiox.ReadFull(c.br, idb[:]); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(io.Discard, c.br, int64(fl)-4); err != nil {
+		return err
+	}
+	c.sharedMu.Lock()
+	ss := c.shared[binary.BigEndian.Uint32(idb[:])]
+	c.sharedMu.Unlock()
+	if ss != nil {
+		ss.peerClosed.Store(true)
+		ss.Close()
+	}
+	return nil
+}
+
+// closeSharedStreams closes the shared streams of c, once its connection is
+// gone.
+func (c *sclient) closeSharedStreams() {
+	c.sharedMu.Lock()
+	streams := make([]*sharedStream, 0, len(c.shared))
+	for _, ss := range c.shared {
+		streams = append(streams, ss)
+	}
+	c.sharedMu.Unlock()
+	for _, ss := range streams {
+		ss.peerClosed.Store(true)
+		ss.Close()
+	}
+}
+
+// sendShared sends a frame of data of a shared stream, without flushing.
+func (c *sclient) sendShared(f sharedFrame) error {
+	c.setWriteDeadline()
+	var idb [4]byte
+	binary.BigEndian.PutUint32(idb[:], f.stream)
+	if err := derp.WriteFrameHeader(c.bw.bw(), derp.FrameSharedData, uint32(len(idb)+len(f.data))); err != nil {
+		return err
+	}
+	if _, err := c.bw.Write(idb[:]); err != nil {
+		return err
+	}
+	_, err := c.bw.Write(f.data)
+	return err
+}
+
+// sendSharedCloses tells the client that the shared streams queued by
+// queueSharedCloseLocked are closed, without flushing.
+func (c *sclient) sendSharedCloses() error {
+	c.sharedMu.Lock()
+	ids := c.sharedClosed
+	c.sharedClosed = nil
+	c.sharedMu.Unlock()
+
+	c.setWriteDeadline()
+	for _, id := range ids {
+		var idb [4]byte
+		binary.BigEndian.PutUint32(idb[:], id)
+		if err := derp.WriteFrameHeader(c.bw.bw(), derp.FrameSharedClose, uint32(len(idb))); err != nil {
+			return err
+		}
+		if _, err := c.bw.Write(idb[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
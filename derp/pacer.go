@@ -0,0 +1,195 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derp
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"tailscale.com/types/key"
+	"tailscale.com/util/clientmetric"
+)
+
+// Pacing constants.
+//
+// The pacer is loosely modeled on BBR: it estimates the bottleneck
+// bandwidth of the DERP connection from the rate at which the kernel
+// accepts our writes, and once it sees signs of congestion (writes that
+// block, or RTT inflating well above the minimum observed), it spreads
+// writes out at slightly below that rate rather than handing the kernel
+// bursts it will only queue and retransmit.
+const (
+	// pacerInterval is how often the pacer re-evaluates its rate.
+	pacerInterval = 250 * time.Millisecond
+
+	// pacerStallThreshold is how long a single flush must block before
+	// it's treated as a congestion signal.
+	pacerStallThreshold = 20 * time.Millisecond
+
+	// pacerQueueDelayThreshold is how far the smoothed RTT may rise above
+	// the minimum RTT before it's treated as a congestion signal.
+	pacerQueueDelayThreshold = 50 * time.Millisecond
+
+	// pacerMinRate is the lowest pacing rate, in bytes per second.
+	pacerMinRate = 64 << 10
+
+	// pacerDrainGain is the fraction of the estimated bottleneck
+	// bandwidth to pace at after a congestion signal.
+	pacerDrainGain = 0.85
+
+	// pacerProbeGain is how much the pacing rate grows per interval
+	// without congestion.
+	pacerProbeGain = 1.25
+
+	// pacerBurst is the number of bytes that may be written back-to-back
+	// without pacing. It must be at least the largest frame a client
+	// writes.
+	pacerBurst = FrameHeaderLen + key.NodePublicRawLen + MaxPacketSize
+)
+
+var (
+	metricPacedWrites    = clientmetric.NewCounter("derp_client_paced_writes")
+	metricPacingDelayMs  = clientmetric.NewCounter("derp_client_pacing_delay_ms")
+	metricPacerCongested = clientmetric.NewCounter("derp_client_pacer_congestion_events")
+)
+
+// pacer adaptively paces writes on a DERP client connection.
+//
+// All methods must be called with Client.wmu held.
+type pacer struct {
+	lim *rate.Limiter // nil when unpaced
+
+	// Bandwidth estimation, over the current interval.
+	intervalStart time.Time
+	intervalBytes int
+	intervalStall bool
+	btlBw         float64 // max bytes/sec seen over recent intervals
+
+	// RTT estimation, from NoteRTT.
+	minRTT time.Duration
+	srtt   time.Duration
+
+	totalDelay time.Duration // total pacing delay introduced
+}
+
+// delay returns how long to wait before writing a frame of n bytes at now.
+func (p *pacer) delay(now time.Time, n int) time.Duration {
+	if p.lim == nil {
+		return 0
+	}
+	r := p.lim.ReserveN(now, n)
+	if !r.OK() {
+		return 0
+	}
+	d := r.DelayFrom(now)
+	if d > 0 {
+		p.totalDelay += d
+		metricPacedWrites.Add(1)
+		metricPacingDelayMs.Add(d.Milliseconds())
+	}
+	return d
+}
+
+// noteWrite records that n bytes were handed to the kernel at start and
+// that the write took took.
+func (p *pacer) noteWrite(start time.Time, n int, took time.Duration) {
+	if p.intervalStart.IsZero() {
+		p.intervalStart = start
+	}
+	p.intervalBytes += n
+	if took >= pacerStallThreshold {
+		p.intervalStall = true
+	}
+	end := start.Add(took)
+	if elapsed := end.Sub(p.intervalStart); elapsed >= pacerInterval {
+		p.endInterval(end, elapsed)
+	}
+}
+
+// noteRTT records an RTT sample for the connection.
+func (p *pacer) noteRTT(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if p.minRTT == 0 || d < p.minRTT {
+		p.minRTT = d
+	}
+	if p.srtt == 0 {
+		p.srtt = d
+	} else {
+		p.srtt = (7*p.srtt + d) / 8
+	}
+}
+
+// rttCongested reports whether the RTT samples indicate a standing queue.
+func (p *pacer) rttCongested() bool {
+	return p.minRTT > 0 && p.srtt-p.minRTT > pacerQueueDelayThreshold
+}
+
+func (p *pacer) endInterval(now time.Time, elapsed time.Duration) {
+	bw := float64(p.intervalBytes) / elapsed.Seconds()
+	stalled := p.intervalStall
+	p.intervalStart = now
+	p.intervalBytes = 0
+	p.intervalStall = false
+
+	if stalled || p.rttCongested() {
+		// Congestion: the kernel (or the path) couldn't keep up with
+		// what we were sending. Pace just under what actually got
+		// through.
+		metricPacerCongested.Add(1)
+		if bw > p.btlBw || p.lim == nil {
+			p.btlBw = bw
+		}
+		r := max(p.btlBw*pacerDrainGain, pacerMinRate)
+		if p.lim == nil {
+			p.lim = rate.NewLimiter(rate.Limit(r), pacerBurst)
+		} else {
+			p.lim.SetLimitAt(now, rate.Limit(min(float64(p.lim.Limit()), r)))
+		}
+		return
+	}
+	if p.lim == nil {
+		p.btlBw = max(p.btlBw, bw)
+		return
+	}
+	// No congestion this interval: probe for more bandwidth. Once the
+	// pacing rate is well above anything we've managed to send, pacing
+	// isn't doing anything useful, so turn it off.
+	r := float64(p.lim.Limit()) * pacerProbeGain
+	if r > 2*max(p.btlBw, bw) {
+		p.lim = nil
+		p.btlBw = bw
+		return
+	}
+	p.lim.SetLimitAt(now, rate.Limit(r))
+}
+
+// PacerStats are statistics about a DERP client's write pacing.
+type PacerStats struct {
+	// Enabled is whether pacing is enabled on the connection.
+	Enabled bool
+	// Active is whether writes are currently being paced.
+	Active bool
+	// RateBytesPerSec is the current pacing rate, if Active.
+	RateBytesPerSec float64
+	// MinRTT and SmoothedRTT are the RTT estimates used by the pacer.
+	MinRTT, SmoothedRTT time.Duration
+	// TotalDelay is the total delay pacing has added to writes.
+	TotalDelay time.Duration
+}
+
+func (p *pacer) stats() PacerStats {
+	st := PacerStats{
+		Enabled:     true,
+		MinRTT:      p.minRTT,
+		SmoothedRTT: p.srtt,
+		TotalDelay:  p.totalDelay,
+	}
+	if p.lim != nil {
+		st.Active = true
+		st.RateBytesPerSec = float64(p.lim.Limit())
+	}
+	return st
+}
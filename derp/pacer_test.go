@@ -0,0 +1,67 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacer(t *testing.T) {
+	var p pacer
+	now := time.Unix(1, 0)
+
+	// Unpaced until there's a congestion signal.
+	for range 10 {
+		if d := p.delay(now, 1000); d != 0 {
+			t.Fatalf("delay = %v before congestion; want 0", d)
+		}
+		p.noteWrite(now, 1000, time.Millisecond)
+		now = now.Add(pacerInterval / 4)
+	}
+	if st := p.stats(); st.Active {
+		t.Fatalf("pacer active without congestion: %+v", st)
+	}
+
+	// A stalled write ends up enabling pacing at the next interval.
+	p.noteWrite(now, 100<<10, pacerStallThreshold)
+	now = now.Add(pacerInterval)
+	p.noteWrite(now, 1000, time.Millisecond)
+	st := p.stats()
+	if !st.Active {
+		t.Fatalf("pacer not active after stall: %+v", st)
+	}
+	if st.RateBytesPerSec < pacerMinRate {
+		t.Errorf("rate = %v; want >= %v", st.RateBytesPerSec, pacerMinRate)
+	}
+
+	// Writes faster than the pacing rate get delayed.
+	var delayed bool
+	for range 100 {
+		if p.delay(now, 8<<10) > 0 {
+			delayed = true
+			break
+		}
+	}
+	if !delayed {
+		t.Errorf("no writes delayed at rate %v", st.RateBytesPerSec)
+	}
+	if p.stats().TotalDelay == 0 {
+		t.Errorf("TotalDelay = 0; want > 0")
+	}
+}
+
+func TestPacerRTT(t *testing.T) {
+	var p pacer
+	p.noteRTT(20 * time.Millisecond)
+	if p.rttCongested() {
+		t.Fatal("congested after one sample")
+	}
+	for range 50 {
+		p.noteRTT(200 * time.Millisecond)
+	}
+	if !p.rttCongested() {
+		t.Fatalf("not congested with minRTT=%v srtt=%v", p.minRTT, p.srtt)
+	}
+}
@@ -14,15 +14,20 @@ func (src *Share) Clone() *Share {
 	dst := new(Share)
 	*dst = *src
 	dst.BookmarkData = append(src.BookmarkData[:0:0], src.BookmarkData...)
+	dst.AllowedPeers = append(src.AllowedPeers[:0:0], src.AllowedPeers...)
 	return dst
 }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ShareCloneNeedsRegeneration = Share(struct {
-	Name         string
-	Path         string
-	As           string
-	BookmarkData []byte
+	Name           string
+	Path           string
+	As             string
+	BookmarkData   []byte
+	ReadOnly       bool
+	AllowedPeers   []string
+	QuotaBytes     int64
+	BandwidthLimit int64
 }{})
 
 // Clone duplicates src into dst and reports whether it succeeded.
@@ -105,10 +105,34 @@ func (v ShareView) BookmarkData() views.ByteSlice[[]byte] {
 	return views.ByteSliceOf(v.ж.BookmarkData)
 }
 
+// ReadOnly, if true, limits all peers to read-only access to this share,
+// regardless of the access granted to them by the tailnet policy.
+func (v ShareView) ReadOnly() bool { return v.ж.ReadOnly }
+
+// AllowedPeers, if non-empty, limits access to this share to the peers
+// matching one of these identities, in addition to the tailnet policy.
+// Each identity is a user login name (e.g. "alice@example.com"), an ACL
+// tag (e.g. "tag:server") or a Tailscale IP address.
+func (v ShareView) AllowedPeers() views.Slice[string] { return views.SliceOf(v.ж.AllowedPeers) }
+
+// QuotaBytes, if positive, limits how large peers may make this share:
+// writes that would grow the total size of its files beyond this many
+// bytes are rejected.
+func (v ShareView) QuotaBytes() int64 { return v.ж.QuotaBytes }
+
+// BandwidthLimit, if positive, limits the rate at which peers may
+// transfer file data to and from this share, in bytes per second,
+// combined across all peers and both directions.
+func (v ShareView) BandwidthLimit() int64 { return v.ж.BandwidthLimit }
+
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ShareViewNeedsRegeneration = Share(struct {
-	Name         string
-	Path         string
-	As           string
-	BookmarkData []byte
+	Name           string
+	Path           string
+	As             string
+	BookmarkData   []byte
+	ReadOnly       bool
+	AllowedPeers   []string
+	QuotaBytes     int64
+	BandwidthLimit int64
 }{})
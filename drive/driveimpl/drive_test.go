@@ -133,6 +133,39 @@ func TestPermissions(t *testing.T) {
 	}
 }
 
+func TestReadOnlyShare(t *testing.T) {
+	s := newSystem(t)
+
+	s.addRemote(remote1)
+	s.remotes[remote1].readOnly[share12] = true
+	s.addShare(remote1, share12, drive.PermissionReadWrite)
+
+	s.writeFile("writing file to read-only share should fail", remote1, share12, file111, "hello world", false)
+	if err := s.client.Mkdir(path.Join(remote1, share12), 0644); err == nil {
+		t.Error("making directory on read-only share should fail")
+	}
+
+	s.write(remote1, share12, file111, "hello world")
+	s.checkFileContents(remote1, share12, file111)
+	if err := s.client.Remove(pathTo(remote1, share12, file111)); err == nil {
+		t.Error("deleting file from read-only share should fail")
+	}
+}
+
+func TestShareQuota(t *testing.T) {
+	s := newSystem(t)
+
+	s.addRemote(remote1)
+	s.remotes[remote1].quota[share11] = 16
+	s.addShare(remote1, share11, drive.PermissionReadWrite)
+
+	s.write(remote1, share11, file111, "0123456789")
+	s.writeFile("writing file that exceeds quota should fail", remote1, share11, file112, "0123456789", false)
+	s.writeFile("writing file within quota should succeed", remote1, share11, file112, "01234", true)
+	s.checkFileContents(remote1, share11, file112)
+	s.writeFile("writing more than is left of quota should fail", remote1, share11, file111, "01", false)
+}
+
 // TestMissingPaths verifies that the fileserver running at localhost
 // correctly handles paths with missing required components.
 //
@@ -438,6 +471,8 @@ type remote struct {
 	fileServer  *FileServer
 	shares      map[string]string
 	permissions map[string]drive.Permission
+	readOnly    map[string]bool
+	quota       map[string]int64
 	mu          sync.RWMutex
 }
 
@@ -515,6 +550,8 @@ func (s *system) addRemote(name string) string {
 		fs:          NewFileSystemForRemote(log.Printf),
 		shares:      make(map[string]string),
 		permissions: make(map[string]drive.Permission),
+		readOnly:    make(map[string]bool),
+		quota:       make(map[string]int64),
 	}
 	r.fs.SetFileServerAddr(fileServer.Addr())
 	go http.Serve(ln, r)
@@ -551,8 +588,10 @@ func (s *system) addShare(remoteName, shareName string, permission drive.Permiss
 	shares := make([]*drive.Share, 0, len(r.shares))
 	for shareName, folder := range r.shares {
 		shares = append(shares, &drive.Share{
-			Name: shareName,
-			Path: folder,
+			Name:       shareName,
+			Path:       folder,
+			ReadOnly:   r.readOnly[shareName],
+			QuotaBytes: r.quota[shareName],
 		})
 	}
 	slices.SortFunc(shares, drive.CompareShares)
@@ -745,7 +784,7 @@ func pathTo(remote, share, name string) string {
 type noopAuthorizer struct{}
 
 func (a *noopAuthorizer) NewAuthenticator(body io.Reader) (gowebdav.Authenticator, io.Reader) {
-	return &noopAuthenticator{}, nil
+	return &noopAuthenticator{}, body
 }
 
 func (a *noopAuthorizer) AddAuthenticator(key string, fn gowebdav.AuthFactory) {
@@ -0,0 +1,159 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package driveimpl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"tailscale.com/drive"
+)
+
+// quotaUsageMaxAge is how long the measured size of a share with a quota is
+// trusted before it's measured again. Writes in the meantime are added to it,
+// so overwriting or deleting files only frees up quota once it's remeasured.
+const quotaUsageMaxAge = time.Minute
+
+// maxBandwidthBurst is the most data a share's bandwidth limiter lets through
+// at once.
+const maxBandwidthBurst = 256 << 10
+
+// errQuotaExceeded is returned when reading the body of a write to a share
+// would exceed its quota.
+var errQuotaExceeded = errors.New("share quota exceeded")
+
+// shareLimits enforces the QuotaBytes and BandwidthLimit of a share.
+type shareLimits struct {
+	path    string        // of the share's directory
+	quota   int64         // or 0 for none
+	limiter *rate.Limiter // or nil for no bandwidth limit
+
+	mu     sync.Mutex
+	used   int64     // bytes in the share as measured at usedAt, plus writes since
+	usedAt time.Time // or zero if not measured yet
+}
+
+// newShareLimits returns the limits to enforce for share, or nil if it has
+// none.
+func newShareLimits(share *drive.Share) *shareLimits {
+	if share.QuotaBytes <= 0 && share.BandwidthLimit <= 0 {
+		return nil
+	}
+	l := &shareLimits{
+		path:  share.Path,
+		quota: max(share.QuotaBytes, 0),
+	}
+	if bw := share.BandwidthLimit; bw > 0 {
+		l.limiter = rate.NewLimiter(rate.Limit(bw), int(min(bw, maxBandwidthBurst)))
+	}
+	return l
+}
+
+// remaining returns how many more bytes may be written to the share before it
+// exceeds its quota.
+func (l *shareLimits) remaining() (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.usedAt.IsZero() || time.Since(l.usedAt) > quotaUsageMaxAge {
+		used, err := dirSize(l.path)
+		if err != nil {
+			return 0, err
+		}
+		l.used, l.usedAt = used, time.Now()
+	}
+	return max(l.quota-l.used, 0), nil
+}
+
+// addUsed records that n more bytes were written to the share, and reports
+// whether it's still within its quota.
+func (l *shareLimits) addUsed(n int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used += n
+	return l.used <= l.quota
+}
+
+// dirSize returns the total size of the regular files in the directory tree
+// rooted at dir. Files and directories that can't be read are skipped.
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				total += fi.Size()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// limitedBody is a request body that counts against the quota and bandwidth
+// limit of a share.
+type limitedBody struct {
+	io.ReadCloser
+	ctx        context.Context
+	l          *shareLimits
+	countQuota bool // whether the body counts against the quota
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.l.limiter != nil && len(p) > b.l.limiter.Burst() {
+		p = p[:b.l.limiter.Burst()]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if b.countQuota && !b.l.addUsed(int64(n)) {
+			return 0, errQuotaExceeded
+		}
+		if b.l.limiter != nil {
+			if err := b.l.limiter.WaitN(b.ctx, n); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, err
+}
+
+// limitedResponseWriter is an http.ResponseWriter whose writes are limited by
+// the bandwidth limit of a share.
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (w *limitedResponseWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p[:min(len(p), w.limiter.Burst())]
+		if err := w.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+			return n, err
+		}
+		m, err := w.ResponseWriter.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Unwrap lets http.ResponseController find the underlying ResponseWriter.
+func (w *limitedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -40,6 +40,7 @@ func NewFileSystemForRemote(logf logger.Logf) *FileSystemForRemote {
 		lockSystem:  webdav.NewMemLS(),
 		children:    make(map[string]*compositedav.Child),
 		userServers: make(map[string]*userServer),
+		limits:      make(map[string]*shareLimits),
 	}
 	return fs
 }
@@ -57,6 +58,7 @@ type FileSystemForRemote struct {
 	shares                 []*drive.Share
 	children               map[string]*compositedav.Child
 	userServers            map[string]*userServer
+	limits                 map[string]*shareLimits // by share name, for shares with a quota or bandwidth limit
 }
 
 // SetFileServerAddr implements drive.FileSystemForRemote.
@@ -97,12 +99,17 @@ func (s *FileSystemForRemote) SetShares(shares []*drive.Share) {
 	}
 
 	children := make(map[string]*compositedav.Child, len(shares))
+	limits := make(map[string]*shareLimits)
 	for _, share := range shares {
 		children[share.Name] = s.buildChild(share)
+		if l := newShareLimits(share); l != nil {
+			limits[share.Name] = l
+		}
 	}
 
 	s.mu.Lock()
 	s.shares = shares
+	s.limits = limits
 	oldUserServers := s.userServers
 	oldChildren := s.children
 	s.children = children
@@ -213,12 +220,39 @@ func (s *FileSystemForRemote) ServeHTTPWithPerms(permissions drive.Permissions,
 			http.Error(w, "permission denied", http.StatusForbidden)
 			return
 		}
+		if s.shareIsReadOnly(share) {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
 	}
 
 	s.mu.RLock()
 	childrenMap := s.children
+	limits := s.limits[shared.CleanAndSplit(r.URL.Path)[0]]
 	s.mu.RUnlock()
 
+	if limits != nil {
+		if limits.quota > 0 && quotaMethods[r.Method] {
+			remaining, err := limits.remaining()
+			if err != nil {
+				s.logf("taildrive: measuring share size for quota: %v", err)
+				http.Error(w, "unable to check share quota", http.StatusInternalServerError)
+				return
+			}
+			if remaining == 0 || r.ContentLength > remaining {
+				http.Error(w, errQuotaExceeded.Error(), http.StatusInsufficientStorage)
+				return
+			}
+		}
+		countQuota := limits.quota > 0 && quotaMethods[r.Method]
+		if r.Body != nil && (countQuota || limits.limiter != nil) {
+			r.Body = &limitedBody{ReadCloser: r.Body, ctx: r.Context(), l: limits, countQuota: countQuota}
+		}
+		if limits.limiter != nil {
+			w = &limitedResponseWriter{ResponseWriter: w, ctx: r.Context(), limiter: limits.limiter}
+		}
+	}
+
 	children := make([]*compositedav.Child, 0, len(childrenMap))
 	// filter out shares to which the connecting principal has no access
 	for name, child := range childrenMap {
@@ -236,6 +270,17 @@ func (s *FileSystemForRemote) ServeHTTPWithPerms(permissions drive.Permissions,
 	h.ServeHTTP(w, r)
 }
 
+// shareIsReadOnly reports whether the share with the given name is configured
+// as read-only.
+func (s *FileSystemForRemote) shareIsReadOnly(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, found := slices.BinarySearchFunc(s.shares, name, func(s *drive.Share, name string) int {
+		return strings.Compare(s.Name, name)
+	})
+	return found && s.shares[i].ReadOnly
+}
+
 func (s *FileSystemForRemote) stopUserServers(userServers map[string]*userServer) {
 	for _, server := range userServers {
 		if err := server.Close(); err != nil {
@@ -415,6 +460,14 @@ func (s *userServer) run() error {
 	"DELETE":    true,
 }
 
+// quotaMethods are the writeMethods that can add data to a share, and so are
+// subject to its quota.
+var quotaMethods = map[string]bool{
+	"PUT":  true,
+	"POST": true,
+	"COPY": true,
+}
+
 // canSudo checks whether we can sudo -u the configured executable as the
 // configured user by attempting to call the executable with the '-h' flag to
 // print help.
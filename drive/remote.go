@@ -9,7 +9,10 @@
 	"bytes"
 	"errors"
 	"net/http"
+	"slices"
 	"strings"
+
+	"tailscale.com/types/views"
 )
 
 var (
@@ -46,6 +49,26 @@ type Share struct {
 	// hold on to a security-scoped bookmark. That bookmark is stored here. See
 	// https://developer.apple.com/documentation/security/app_sandbox/accessing_files_from_the_macos_app_sandbox#4144043
 	BookmarkData []byte `json:"bookmarkData,omitempty"`
+
+	// ReadOnly, if true, limits all peers to read-only access to this share,
+	// regardless of the access granted to them by the tailnet policy.
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// AllowedPeers, if non-empty, limits access to this share to the peers
+	// matching one of these identities, in addition to the tailnet policy.
+	// Each identity is a user login name (e.g. "alice@example.com"), an ACL
+	// tag (e.g. "tag:server") or a Tailscale IP address.
+	AllowedPeers []string `json:"allowedPeers,omitempty"`
+
+	// QuotaBytes, if positive, limits how large peers may make this share:
+	// writes that would grow the total size of its files beyond this many
+	// bytes are rejected.
+	QuotaBytes int64 `json:"quotaBytes,omitempty"`
+
+	// BandwidthLimit, if positive, limits the rate at which peers may
+	// transfer file data to and from this share, in bytes per second,
+	// combined across all peers and both directions.
+	BandwidthLimit int64 `json:"bandwidthLimit,omitempty"`
 }
 
 func ShareViewsEqual(a, b ShareView) bool {
@@ -55,7 +78,9 @@ func ShareViewsEqual(a, b ShareView) bool {
 	if !a.Valid() || !b.Valid() {
 		return false
 	}
-	return a.Name() == b.Name() && a.Path() == b.Path() && a.As() == b.As() && a.BookmarkData().Equal(b.ж.BookmarkData)
+	return a.Name() == b.Name() && a.Path() == b.Path() && a.As() == b.As() && a.BookmarkData().Equal(b.ж.BookmarkData) &&
+		a.ReadOnly() == b.ReadOnly() && views.SliceEqual(a.AllowedPeers(), b.AllowedPeers()) &&
+		a.QuotaBytes() == b.QuotaBytes() && a.BandwidthLimit() == b.BandwidthLimit()
 }
 
 func SharesEqual(a, b *Share) bool {
@@ -65,7 +90,23 @@ func SharesEqual(a, b *Share) bool {
 	if a == nil || b == nil {
 		return false
 	}
-	return a.Name == b.Name && a.Path == b.Path && a.As == b.As && bytes.Equal(a.BookmarkData, b.BookmarkData)
+	return a.Name == b.Name && a.Path == b.Path && a.As == b.As && bytes.Equal(a.BookmarkData, b.BookmarkData) &&
+		a.ReadOnly == b.ReadOnly && slices.Equal(a.AllowedPeers, b.AllowedPeers) &&
+		a.QuotaBytes == b.QuotaBytes && a.BandwidthLimit == b.BandwidthLimit
+}
+
+// AllowsPeer reports whether s's AllowedPeers permit access by a peer with
+// the given identities.
+func (s ShareView) AllowsPeer(peerIDs []string) bool {
+	if s.AllowedPeers().Len() == 0 {
+		return true
+	}
+	for _, id := range peerIDs {
+		if s.AllowedPeers().ContainsFunc(func(allowed string) bool { return strings.EqualFold(allowed, id) }) {
+			return true
+		}
+	}
+	return false
 }
 
 func CompareShares(a, b *Share) int {
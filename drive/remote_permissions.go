@@ -6,6 +6,8 @@
 import (
 	"encoding/json"
 	"fmt"
+
+	"tailscale.com/types/views"
 )
 
 type Permission uint8
@@ -63,3 +65,25 @@ func (p Permissions) For(share string) Permission {
 	}
 	return wildcard
 }
+
+// Restrict returns the permissions in p further limited by the local
+// configuration of shares, for a peer with the given identities (see
+// [Share.AllowedPeers]). The result has no wildcard entry, so it grants
+// nothing for shares that aren't in shares.
+func (p Permissions) Restrict(shares views.SliceView[*Share, ShareView], peerIDs []string) Permissions {
+	res := make(Permissions, shares.Len())
+	for _, share := range shares.All() {
+		perm := p.For(share.Name())
+		if perm == PermissionNone {
+			continue
+		}
+		if !share.AllowsPeer(peerIDs) {
+			continue
+		}
+		if share.ReadOnly() {
+			perm = min(perm, PermissionReadOnly)
+		}
+		res[share.Name()] = perm
+	}
+	return res
+}
@@ -5,7 +5,10 @@
 
 import (
 	"encoding/json"
+	"maps"
 	"testing"
+
+	"tailscale.com/types/views"
 )
 
 func TestPermissions(t *testing.T) {
@@ -59,3 +62,50 @@ func TestPermissions(t *testing.T) {
 		})
 	}
 }
+
+func TestPermissionsRestrict(t *testing.T) {
+	p := Permissions{"*": PermissionReadWrite}
+	shares := []*Share{
+		{Name: "a"},
+		{Name: "b", ReadOnly: true},
+		{Name: "c", AllowedPeers: []string{"alice@example.com", "tag:server"}},
+	}
+	sv := views.SliceOfViews(shares)
+
+	tests := []struct {
+		name    string
+		peerIDs []string
+		want    Permissions
+	}{
+		{
+			name:    "other-user",
+			peerIDs: []string{"bob@example.com", "100.64.0.2"},
+			want:    Permissions{"a": PermissionReadWrite, "b": PermissionReadOnly},
+		},
+		{
+			name:    "allowed-user",
+			peerIDs: []string{"Alice@example.com", "100.64.0.3"},
+			want:    Permissions{"a": PermissionReadWrite, "b": PermissionReadOnly, "c": PermissionReadWrite},
+		},
+		{
+			name:    "allowed-tag",
+			peerIDs: []string{"tag:server", "100.64.0.4"},
+			want:    Permissions{"a": PermissionReadWrite, "b": PermissionReadOnly, "c": PermissionReadWrite},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.Restrict(sv, tt.peerIDs)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+			if got.For("d") != PermissionNone {
+				t.Errorf("got %v for unknown share; want none", got.For("d"))
+			}
+		})
+	}
+
+	if got := (Permissions{"b": PermissionReadOnly}).Restrict(sv, nil); !maps.Equal(got, Permissions{"b": PermissionReadOnly}) {
+		t.Errorf("got %v; want only b", got)
+	}
+}
@@ -44,15 +44,17 @@
 	// +checklocks:mu
 	set = map[string]string{}
 	// +checklocks:mu
-	regStr = map[string]*string{}
+	source = map[string]string{} // knob => "disk" or "runtime"; absent means "env"
 	// +checklocks:mu
-	regBool = map[string]*bool{}
+	regStr = map[string]*syncs.AtomicValue[string]{}
 	// +checklocks:mu
-	regOptBool = map[string]*opt.Bool{}
+	regBool = map[string]*atomic.Bool{}
 	// +checklocks:mu
-	regDuration = map[string]*time.Duration{}
+	regOptBool = map[string]*syncs.AtomicValue[opt.Bool]{}
 	// +checklocks:mu
-	regInt = map[string]*int{}
+	regDuration = map[string]*syncs.AtomicValue[time.Duration]{}
+	// +checklocks:mu
+	regInt = map[string]*syncs.AtomicValue[int]{}
 )
 
 func noteEnv(k, v string) {
@@ -93,11 +95,17 @@ func LogCurrent(logf logf) {
 func Setenv(envVar, val string) {
 	mu.Lock()
 	defer mu.Unlock()
+	setenvLocked(envVar, val)
+}
+
+// +checklocks:mu
+func setenvLocked(envVar, val string) {
 	os.Setenv(envVar, val)
 	noteEnvLocked(envVar, val)
+	delete(source, envVar)
 
 	if p := regStr[envVar]; p != nil {
-		*p = val
+		p.Store(val)
 	}
 	if p := regBool[envVar]; p != nil {
 		setBoolLocked(p, envVar, val)
@@ -108,6 +116,9 @@ func Setenv(envVar, val string) {
 	if p := regDuration[envVar]; p != nil {
 		setDurationLocked(p, envVar, val)
 	}
+	if p := regInt[envVar]; p != nil {
+		setIntLocked(p, envVar, val)
+	}
 }
 
 // String returns the named environment variable, using os.Getenv.
@@ -132,10 +143,11 @@ func RegisterString(envVar string) func() string {
 		if val != "" {
 			noteEnvLocked(envVar, val)
 		}
-		p = &val
+		p = new(syncs.AtomicValue[string])
+		p.Store(val)
 		regStr[envVar] = p
 	}
-	return func() string { return *p }
+	return p.Load
 }
 
 // RegisterBool returns a func that gets the named environment variable,
@@ -146,12 +158,11 @@ func RegisterBool(envVar string) func() bool {
 	defer mu.Unlock()
 	p, ok := regBool[envVar]
 	if !ok {
-		var b bool
-		p = &b
+		p = new(atomic.Bool)
 		setBoolLocked(p, envVar, os.Getenv(envVar))
 		regBool[envVar] = p
 	}
-	return func() bool { return *p }
+	return p.Load
 }
 
 // RegisterOptBool returns a func that gets the named environment variable,
@@ -162,12 +173,11 @@ func RegisterOptBool(envVar string) func() opt.Bool {
 	defer mu.Unlock()
 	p, ok := regOptBool[envVar]
 	if !ok {
-		var b opt.Bool
-		p = &b
+		p = new(syncs.AtomicValue[opt.Bool])
 		setOptBoolLocked(p, envVar, os.Getenv(envVar))
 		regOptBool[envVar] = p
 	}
-	return func() opt.Bool { return *p }
+	return p.Load
 }
 
 // RegisterDuration returns a func that gets the named environment variable as a
@@ -182,11 +192,11 @@ func RegisterDuration(envVar string) func() time.Duration {
 		if val != "" {
 			noteEnvLocked(envVar, val)
 		}
-		p = new(time.Duration)
+		p = new(syncs.AtomicValue[time.Duration])
 		setDurationLocked(p, envVar, val)
 		regDuration[envVar] = p
 	}
-	return func() time.Duration { return *p }
+	return p.Load
 }
 
 // RegisterInt returns a func that gets the named environment variable as an
@@ -201,67 +211,88 @@ func RegisterInt(envVar string) func() int {
 		if val != "" {
 			noteEnvLocked(envVar, val)
 		}
-		p = new(int)
+		p = new(syncs.AtomicValue[int])
 		setIntLocked(p, envVar, val)
 		regInt[envVar] = p
 	}
-	return func() int { return *p }
+	return p.Load
 }
 
 // +checklocks:mu
-func setBoolLocked(p *bool, envVar, val string) {
+func setBoolLocked(p *atomic.Bool, envVar, val string) {
 	noteEnvLocked(envVar, val)
-	if val == "" {
-		*p = false
-		return
-	}
-	var err error
-	*p, err = strconv.ParseBool(val)
+	v, err := parseBool(val)
 	if err != nil {
 		log.Fatalf("invalid boolean environment variable %s value %q", envVar, val)
 	}
+	p.Store(v)
 }
 
 // +checklocks:mu
-func setOptBoolLocked(p *opt.Bool, envVar, val string) {
+func setOptBoolLocked(p *syncs.AtomicValue[opt.Bool], envVar, val string) {
 	noteEnvLocked(envVar, val)
-	if val == "" {
-		*p = ""
-		return
-	}
-	b, err := strconv.ParseBool(val)
+	v, err := parseOptBool(val)
 	if err != nil {
 		log.Fatalf("invalid boolean environment variable %s value %q", envVar, val)
 	}
-	p.Set(b)
+	p.Store(v)
 }
 
 // +checklocks:mu
-func setDurationLocked(p *time.Duration, envVar, val string) {
+func setDurationLocked(p *syncs.AtomicValue[time.Duration], envVar, val string) {
 	noteEnvLocked(envVar, val)
-	if val == "" {
-		*p = 0
-		return
-	}
-	var err error
-	*p, err = time.ParseDuration(val)
+	v, err := parseDuration(val)
 	if err != nil {
 		log.Fatalf("invalid duration environment variable %s value %q", envVar, val)
 	}
+	p.Store(v)
 }
 
 // +checklocks:mu
-func setIntLocked(p *int, envVar, val string) {
+func setIntLocked(p *syncs.AtomicValue[int], envVar, val string) {
 	noteEnvLocked(envVar, val)
+	v, err := parseInt(val)
+	if err != nil {
+		log.Fatalf("invalid int environment variable %s value %q", envVar, val)
+	}
+	p.Store(v)
+}
+
+// The parse funcs parse the values of registered knobs. The empty
+// string, meaning unset, parses as the zero value.
+
+func parseBool(val string) (bool, error) {
 	if val == "" {
-		*p = 0
-		return
+		return false, nil
 	}
-	var err error
-	*p, err = strconv.Atoi(val)
+	return strconv.ParseBool(val)
+}
+
+func parseOptBool(val string) (opt.Bool, error) {
+	var ret opt.Bool
+	if val == "" {
+		return ret, nil
+	}
+	b, err := strconv.ParseBool(val)
 	if err != nil {
-		log.Fatalf("invalid int environment variable %s value %q", envVar, val)
+		return ret, err
 	}
+	ret.Set(b)
+	return ret, nil
+}
+
+func parseDuration(val string) (time.Duration, error) {
+	if val == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(val)
+}
+
+func parseInt(val string) (int, error) {
+	if val == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(val)
 }
 
 // Bool returns the boolean value of the named environment variable.
@@ -444,6 +475,15 @@ func IsCertShareReadWriteMode() bool {
 	return m == "rw"
 }
 
+// IsCertShareLeaseMode returns true if replicas sharing a state store (such as
+// the members of an HA pair behind a shared hostname) should coordinate TLS
+// cert issuance through a lease in that store. The lease holder issues and
+// renews certs; the other replicas read them from the store.
+func IsCertShareLeaseMode() bool {
+	m := String("TS_CERT_SHARE_MODE")
+	return m == "lease"
+}
+
 // CrashOnUnexpected reports whether the Tailscale client should panic
 // on unexpected conditions. If TS_DEBUG_CRASH_ON_UNEXPECTED is set, that's
 // used. Otherwise the default value is true for unstable builds.
@@ -669,7 +709,10 @@ func applyKeyValueEnv(r io.Reader) error {
 				return fmt.Errorf("invalid value in line %q: %v", line, err)
 			}
 		}
-		Setenv(k, v)
+		mu.Lock()
+		setenvLocked(k, v)
+		source[k] = "disk"
+		mu.Unlock()
 	}
 	return bs.Err()
 }
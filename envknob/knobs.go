@@ -0,0 +1,169 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package envknob
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Knob describes an environment knob known to this process.
+type Knob struct {
+	// Name is the environment variable's name.
+	Name string
+
+	// Value is the knob's current value, or empty if it's unset. Values
+	// that likely hold credentials are redacted; see redactKnobValue.
+	Value string
+
+	// Source is where Value came from: "env" for the process environment
+	// (or a call to Setenv), "disk" for the platform's tailscaled-env.txt
+	// file (see ApplyDiskConfig), or "runtime" for SetAtRuntime. It's
+	// empty if the knob is unset.
+	Source string
+
+	// Registered is whether the knob was registered using one of the
+	// Register funcs. Changes to registered knobs take effect immediately;
+	// other knobs are typically read once, so changing them requires a
+	// restart.
+	Registered bool
+}
+
+// Knobs returns the knobs that are set or registered in this process,
+// sorted by name.
+func Knobs() []Knob {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := map[string]bool{}
+	for k := range set {
+		names[k] = true
+	}
+	for k := range regStr {
+		names[k] = true
+	}
+	for k := range regBool {
+		names[k] = true
+	}
+	for k := range regOptBool {
+		names[k] = true
+	}
+	for k := range regDuration {
+		names[k] = true
+	}
+	for k := range regInt {
+		names[k] = true
+	}
+
+	ret := make([]Knob, 0, len(names))
+	for _, k := range slices.Sorted(maps.Keys(names)) {
+		kn := Knob{
+			Name:       k,
+			Value:      redactKnobValue(k, set[k]),
+			Registered: isRegisteredLocked(k),
+		}
+		if kn.Value != "" {
+			kn.Source = source[k]
+			if kn.Source == "" {
+				kn.Source = "env"
+			}
+		}
+		ret = append(ret, kn)
+	}
+	return ret
+}
+
+// secretKnobWords are substrings of knob names whose values likely hold
+// credentials.
+var secretKnobWords = []string{
+	"AUTHKEY",
+	"AUTH_KEY",
+	"API_KEY",
+	"SECRET",
+	"TOKEN",
+	"PASSWORD",
+	"PASSWD",
+	"CREDENTIAL",
+}
+
+// redactKnobValue returns val, the value of the knob named name, with any
+// credentials it likely holds redacted, so that Knobs is safe to show to
+// someone debugging the process. Values of knobs with secret-sounding names
+// are replaced entirely, and passwords in URLs (such as proxy URLs) are
+// replaced with "xxxxx".
+func redactKnobValue(name, val string) string {
+	if val == "" {
+		return ""
+	}
+	for _, w := range secretKnobWords {
+		if strings.Contains(name, w) {
+			return "[redacted]"
+		}
+	}
+	if strings.Contains(val, "@") {
+		if u, err := url.Parse(val); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return u.Redacted()
+			}
+		}
+	}
+	return val
+}
+
+// +checklocks:mu
+func isRegisteredLocked(envVar string) bool {
+	return regStr[envVar] != nil || regBool[envVar] != nil || regOptBool[envVar] != nil ||
+		regDuration[envVar] != nil || regInt[envVar] != nil
+}
+
+// CanSetAtRuntime reports whether the named knob may be changed with
+// SetAtRuntime. Only registered debug knobs (those named TS_DEBUG_*) may be:
+// their new values take effect immediately, and they aren't meant to
+// change security-relevant behavior.
+func CanSetAtRuntime(envVar string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return canSetAtRuntimeLocked(envVar)
+}
+
+// +checklocks:mu
+func canSetAtRuntimeLocked(envVar string) bool {
+	return strings.HasPrefix(envVar, "TS_DEBUG_") && isRegisteredLocked(envVar)
+}
+
+// SetAtRuntime changes the value of a knob in a running process, for
+// debugging. An empty val unsets the knob. It returns an error if the knob
+// can't be set at runtime (see CanSetAtRuntime) or val isn't valid for the
+// knob's type.
+//
+// Unlike Setenv, it's safe to call concurrently with reads of the knob.
+func SetAtRuntime(envVar, val string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if !canSetAtRuntimeLocked(envVar) {
+		return fmt.Errorf("knob %s can't be set at runtime", envVar)
+	}
+	var err error
+	switch {
+	case regBool[envVar] != nil:
+		_, err = parseBool(val)
+	case regOptBool[envVar] != nil:
+		_, err = parseOptBool(val)
+	case regDuration[envVar] != nil:
+		_, err = parseDuration(val)
+	case regInt[envVar] != nil:
+		_, err = parseInt(val)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q for %s: %w", val, envVar, err)
+	}
+	setenvLocked(envVar, val)
+	if val != "" {
+		source[envVar] = "runtime"
+	}
+	return nil
+}
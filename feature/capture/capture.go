@@ -41,7 +41,12 @@ func serveLocalAPIDebugCapture(h *localapi.Handler, w http.ResponseWriter, r *ht
 	b := h.LocalBackend()
 	s := b.GetOrSetCaptureSink(newSink)
 
-	unregister := s.RegisterOutput(w)
+	var unregister func()
+	if r.FormValue("dropped") == "true" {
+		unregister = s.(*Sink).RegisterDroppedOutput(w)
+	} else {
+		unregister = s.RegisterOutput(w)
+	}
 
 	select {
 	case <-ctx.Done():
@@ -70,6 +75,60 @@ func writePcapHeader(w io.Writer) {
 	binary.Write(w, binary.LittleEndian, uint32(147))        // link-layer ID - USER0
 }
 
+// writePcapngHeader writes the pcapng section header and interface
+// description blocks that start the stream of dropped packets. Unlike the
+// pcap format, pcapng lets each packet carry a comment, which is used for the
+// reason it was dropped.
+func writePcapngHeader(w io.Writer) {
+	// Section Header Block.
+	binary.Write(w, binary.LittleEndian, uint32(0x0A0D0D0A)) // block type
+	binary.Write(w, binary.LittleEndian, uint32(28))         // block length
+	binary.Write(w, binary.LittleEndian, uint32(0x1A2B3C4D)) // byte-order magic
+	binary.Write(w, binary.LittleEndian, uint16(1))          // version major
+	binary.Write(w, binary.LittleEndian, uint16(0))          // version minor
+	binary.Write(w, binary.LittleEndian, int64(-1))          // section length: unknown
+	binary.Write(w, binary.LittleEndian, uint32(28))         // block length
+
+	// Interface Description Block.
+	binary.Write(w, binary.LittleEndian, uint32(1))     // block type
+	binary.Write(w, binary.LittleEndian, uint32(20))    // block length
+	binary.Write(w, binary.LittleEndian, uint16(147))   // link-layer ID - USER0
+	binary.Write(w, binary.LittleEndian, uint16(0))     // reserved
+	binary.Write(w, binary.LittleEndian, uint32(65535)) // max packet len
+	binary.Write(w, binary.LittleEndian, uint32(20))    // block length
+}
+
+// pad4 returns n rounded up to a multiple of 4, as pcapng requires.
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// writeEnhancedPacketBlock writes a pcapng Enhanced Packet Block for a packet
+// with the given length, whose data the caller writes with writeData,
+// with comment as its opt_comment option.
+func writeEnhancedPacketBlock(w *bytes.Buffer, when time.Time, length int, comment string, writeData func()) {
+	blockLen := 28 + pad4(length) + 4 + pad4(len(comment)) + 4 + 4
+	us := uint64(when.UnixMicro())
+
+	binary.Write(w, binary.LittleEndian, uint32(6))        // block type
+	binary.Write(w, binary.LittleEndian, uint32(blockLen)) // block length
+	binary.Write(w, binary.LittleEndian, uint32(0))        // interface ID
+	binary.Write(w, binary.LittleEndian, uint32(us>>32))   // timestamp (high), in microseconds
+	binary.Write(w, binary.LittleEndian, uint32(us))       // timestamp (low)
+	binary.Write(w, binary.LittleEndian, uint32(length))   // length present
+	binary.Write(w, binary.LittleEndian, uint32(length))   // total length
+	writeData()
+	w.Write(make([]byte, pad4(length)-length))
+
+	binary.Write(w, binary.LittleEndian, uint16(1))            // opt_comment
+	binary.Write(w, binary.LittleEndian, uint16(len(comment))) // option length
+	w.WriteString(comment)
+	w.Write(make([]byte, pad4(len(comment))-len(comment)))
+	binary.Write(w, binary.LittleEndian, uint32(0)) // opt_endofopt
+
+	binary.Write(w, binary.LittleEndian, uint32(blockLen)) // block length
+}
+
 func writePktHeader(w *bytes.Buffer, when time.Time, length int) {
 	s := when.Unix()
 	us := when.UnixMicro() - (s * 1000000)
@@ -96,9 +155,10 @@ type Sink struct {
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 
-	mu         sync.Mutex
-	outputs    set.HandleSet[io.Writer]
-	flushTimer *time.Timer // or nil if none running
+	mu             sync.Mutex
+	outputs        set.HandleSet[io.Writer]
+	droppedOutputs set.HandleSet[io.Writer] // pcapng streams of only dropped packets
+	flushTimer     *time.Timer              // or nil if none running
 }
 
 // RegisterOutput connects an output to this sink, which
@@ -128,6 +188,28 @@ func (s *Sink) RegisterOutput(w io.Writer) (unregister func()) {
 	}
 }
 
+// RegisterDroppedOutput is like RegisterOutput, but w is written to with
+// a pcapng stream of only the packets that the packet filter dropped, each
+// with the reason it was dropped as its comment.
+func (s *Sink) RegisterDroppedOutput(w io.Writer) (unregister func()) {
+	select {
+	case <-s.ctx.Done():
+		return func() {}
+	default:
+	}
+
+	writePcapngHeader(w)
+	s.mu.Lock()
+	hnd := s.droppedOutputs.Add(w)
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.droppedOutputs, hnd)
+	}
+}
+
 func (s *Sink) CaptureCallback() packet.CaptureCallback {
 	return s.LogPacket
 }
@@ -136,7 +218,7 @@ func (s *Sink) CaptureCallback() packet.CaptureCallback {
 func (s *Sink) NumOutputs() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return len(s.outputs)
+	return len(s.outputs) + len(s.droppedOutputs)
 }
 
 // Close shuts down the sink. Future calls to LogPacket
@@ -151,12 +233,15 @@ func (s *Sink) Close() error {
 		s.flushTimer = nil
 	}
 
-	for _, o := range s.outputs {
-		if o, ok := o.(io.Closer); ok {
-			o.Close()
+	for _, outputs := range []set.HandleSet[io.Writer]{s.outputs, s.droppedOutputs} {
+		for _, o := range outputs {
+			if o, ok := o.(io.Closer); ok {
+				o.Close()
+			}
 		}
 	}
 	s.outputs = nil
+	s.droppedOutputs = nil
 	return nil
 }
 
@@ -179,6 +264,10 @@ func customDataLen(meta packet.CaptureMeta) int {
 
 // LogPacket is called to insert a packet into the capture.
 //
+// Packets that the packet filter dropped, which have a meta.DropReason, go
+// only to the outputs registered with RegisterDroppedOutput; all others go
+// only to those registered with RegisterOutput.
+//
 // This function does not take ownership of the provided data slice.
 func (s *Sink) LogPacket(path packet.CapturePath, when time.Time, data []byte, meta packet.CaptureMeta) {
 	select {
@@ -187,58 +276,89 @@ func (s *Sink) LogPacket(path packet.CapturePath, when time.Time, data []byte, m
 	default:
 	}
 
+	dropped := meta.DropReason != ""
+	if dropped {
+		s.mu.Lock()
+		n := len(s.droppedOutputs)
+		s.mu.Unlock()
+		if n == 0 {
+			return // don't bother encoding what nobody asked for
+		}
+	}
+
 	extraLen := customDataLen(meta)
 	b := bufferPool.Get().(*bytes.Buffer)
 	b.Reset()
-	b.Grow(16 + extraLen + len(data)) // 16b pcap header + len(metadata) + len(payload)
 	defer bufferPool.Put(b)
 
-	writePktHeader(b, when, len(data)+extraLen)
-
-	// Custom tailscale debugging data
-	binary.Write(b, binary.LittleEndian, uint16(path))
-	if meta.DidSNAT {
-		binary.Write(b, binary.LittleEndian, uint8(meta.OriginalSrc.Addr().BitLen()/8))
-		b.Write(meta.OriginalSrc.Addr().AsSlice())
-	} else {
-		binary.Write(b, binary.LittleEndian, uint8(0)) // SNAT addr len == 0
-	}
-	if meta.DidDNAT {
-		binary.Write(b, binary.LittleEndian, uint8(meta.OriginalDst.Addr().BitLen()/8))
-		b.Write(meta.OriginalDst.Addr().AsSlice())
+	if dropped {
+		comment := "dropped: " + meta.DropReason
+		if len(comment) > 0xffff {
+			comment = comment[:0xffff]
+		}
+		b.Grow(40 + extraLen + len(data) + len(comment)) // pcapng block + len(metadata) + len(payload) + len(comment)
+		writeEnhancedPacketBlock(b, when, len(data)+extraLen, comment, func() {
+			writeCustomData(b, path, meta)
+			b.Write(data)
+		})
 	} else {
-		binary.Write(b, binary.LittleEndian, uint8(0)) // DNAT addr len == 0
+		b.Grow(16 + extraLen + len(data)) // 16b pcap header + len(metadata) + len(payload)
+		writePktHeader(b, when, len(data)+extraLen)
+		writeCustomData(b, path, meta)
+		b.Write(data)
 	}
 
-	b.Write(data)
-
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	outputs := s.outputs
+	if dropped {
+		outputs = s.droppedOutputs
+	}
 	var hadError []set.Handle
-	for hnd, o := range s.outputs {
+	for hnd, o := range outputs {
 		if _, err := o.Write(b.Bytes()); err != nil {
 			hadError = append(hadError, hnd)
 			continue
 		}
 	}
 	for _, hnd := range hadError {
-		if o, ok := s.outputs[hnd].(io.Closer); ok {
+		if o, ok := outputs[hnd].(io.Closer); ok {
 			o.Close()
 		}
-		delete(s.outputs, hnd)
+		delete(outputs, hnd)
 	}
 
 	if s.flushTimer == nil {
 		s.flushTimer = time.AfterFunc(flushPeriod, func() {
 			s.mu.Lock()
 			defer s.mu.Unlock()
-			for _, o := range s.outputs {
-				if f, ok := o.(http.Flusher); ok {
-					f.Flush()
+			for _, outputs := range []set.HandleSet[io.Writer]{s.outputs, s.droppedOutputs} {
+				for _, o := range outputs {
+					if f, ok := o.(http.Flusher); ok {
+						f.Flush()
+					}
 				}
 			}
 			s.flushTimer = nil
 		})
 	}
 }
+
+// writeCustomData writes the Tailscale debugging data that precedes each
+// captured packet, which the dissector decodes.
+func writeCustomData(b *bytes.Buffer, path packet.CapturePath, meta packet.CaptureMeta) {
+	binary.Write(b, binary.LittleEndian, uint16(path))
+	if meta.DidSNAT {
+		binary.Write(b, binary.LittleEndian, uint8(meta.OriginalSrc.Addr().BitLen()/8))
+		b.Write(meta.OriginalSrc.Addr().AsSlice())
+	} else {
+		binary.Write(b, binary.LittleEndian, uint8(0)) // SNAT addr len == 0
+	}
+	if meta.DidDNAT {
+		binary.Write(b, binary.LittleEndian, uint8(meta.OriginalDst.Addr().BitLen()/8))
+		b.Write(meta.OriginalDst.Addr().AsSlice())
+	} else {
+		binary.Write(b, binary.LittleEndian, uint8(0)) // DNAT addr len == 0
+	}
+}
@@ -31,6 +31,7 @@
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/httpm"
+	"tailscale.com/util/syspolicy/pkey"
 	"tailscale.com/version"
 	"tailscale.com/version/distro"
 )
@@ -156,7 +157,9 @@ func (e *extension) DoSelfUpdate() {
 	}
 	e.clearSelfUpdateProgress()
 	e.pushSelfUpdateProgress(ipnstate.NewUpdateProgress(ipnstate.UpdateInProgress, ""))
+	pin, _ := e.sb.Sys().PolicyClientOrDefault().GetString(pkey.UpdateTrack, "")
 	up, err := clientupdate.NewUpdater(clientupdate.Arguments{
+		Pin: pin,
 		Logf: func(format string, args ...any) {
 			e.pushSelfUpdateProgress(ipnstate.NewUpdateProgress(ipnstate.UpdateInProgress, fmt.Sprintf(format, args...)))
 		},
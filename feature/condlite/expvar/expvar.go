@@ -9,4 +9,8 @@
 
 import "expvar"
 
+// IsAvailable is whether the types are real, rather than stubs that count
+// nothing.
+const IsAvailable = true
+
 type Int = expvar.Int
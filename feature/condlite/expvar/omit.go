@@ -5,6 +5,10 @@
 
 package expvar
 
+const IsAvailable = false
+
 type Int int64
 
 func (*Int) Add(int64) {}
+
+func (*Int) Value() int64 { return 0 }
@@ -0,0 +1,206 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package derptelemetry periodically reports the device's latency to private
+// DERP regions (those with IDs 900-999) to a collector run by the regions'
+// operator, so that they can tune their regions and the devices' homes with
+// the derplatency tool. It's off unless the device opts in.
+//
+// It's configured with environment variables:
+//
+//   - TS_DERP_LATENCY_REPORT_URL is the collector's URL, which it POSTs
+//     [derplatency.Report]s to as JSON. It can be a Tailscale address.
+//   - TS_DERP_LATENCY_REPORT_INTERVAL is how often to report (default 15m).
+//
+// Reports carry only the device's stable node ID and hostname, its home
+// region, and its latency to each private region, rounded to
+// [derplatency.Granularity].
+package derptelemetry
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"tailscale.com/derp/derplatency"
+	"tailscale.com/envknob"
+	"tailscale.com/ipn/ipnext"
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+)
+
+func init() {
+	ipnext.RegisterExtension("derptelemetry", newExtension)
+}
+
+var (
+	urlEnv      = envknob.RegisterString("TS_DERP_LATENCY_REPORT_URL")
+	intervalEnv = envknob.RegisterDuration("TS_DERP_LATENCY_REPORT_INTERVAL")
+)
+
+const (
+	defaultInterval = 15 * time.Minute
+	minInterval     = time.Minute
+	postTimeout     = 30 * time.Second
+)
+
+func newExtension(logf logger.Logf, sb ipnext.SafeBackend) (ipnext.Extension, error) {
+	e := &extension{
+		sb:   sb,
+		logf: logger.WithPrefix(logf, "derptelemetry: "),
+		done: make(chan struct{}),
+	}
+	e.ctx, e.ctxCancel = context.WithCancel(context.Background())
+	return e, nil
+}
+
+// extension implements the derptelemetry extension.
+type extension struct {
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	done      chan struct{} // closed when the report goroutine exits
+	logf      logger.Logf
+	sb        ipnext.SafeBackend
+
+	mu   sync.Mutex
+	self tailcfg.NodeView // or invalid if not logged in
+}
+
+func (e *extension) Name() string { return "derptelemetry" }
+
+func (e *extension) Init(h ipnext.Host) error {
+	url := urlEnv()
+	if url == "" {
+		return ipnext.SkipExtension
+	}
+	interval := intervalEnv()
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	if interval < minInterval {
+		e.logf("TS_DERP_LATENCY_REPORT_INTERVAL %v too short; using %v", interval, minInterval)
+		interval = minInterval
+	}
+	h.Hooks().OnSelfChange.Add(e.onSelfChange)
+	go e.runReportLoop(url, interval)
+	return nil
+}
+
+func (e *extension) Shutdown() error {
+	e.ctxCancel()
+	<-e.done
+	return nil
+}
+
+// onSelfChange implements the [ipnext.Hooks.OnSelfChange] hook.
+func (e *extension) onSelfChange(self tailcfg.NodeView) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.self = self
+}
+
+// runReportLoop reports to url every interval, if there's a new netcheck
+// report with private regions in it.
+func (e *extension) runReportLoop(url string, interval time.Duration) {
+	defer close(e.done)
+
+	ticker, tickerChannel := e.sb.Clock().NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastSent time.Time // time of the last netcheck report sent
+	for {
+		select {
+		case <-tickerChannel:
+		case <-e.ctx.Done():
+			return
+		}
+
+		e.mu.Lock()
+		self := e.self
+		e.mu.Unlock()
+		ms, ok := e.sb.Sys().MagicSock.GetOK()
+		if !ok || !self.Valid() {
+			continue
+		}
+		nr := ms.GetLastNetcheckReport(e.ctx)
+		if nr == nil || !nr.Now.After(lastSent) {
+			continue
+		}
+		r, ok := newReport(self, nr)
+		if !ok {
+			continue
+		}
+		if err := e.post(url, r); err != nil {
+			e.logf("%v", err)
+			continue
+		}
+		lastSent = nr.Now
+	}
+}
+
+// post POSTs r to url.
+func (e *extension) post(url string, r *derplatency.Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(e.ctx, postTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Use the user dialer so that the collector can be on the tailnet.
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: e.sb.Sys().Dialer.Get().UserDial,
+	}}
+	defer c.CloseIdleConnections()
+	res, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("reporting: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("reporting: %s", res.Status)
+	}
+	return nil
+}
+
+// newReport returns the report of self's latency to the private regions in
+// nr, or ok false if there are none.
+func newReport(self tailcfg.NodeView, nr *netcheck.Report) (_ *derplatency.Report, ok bool) {
+	r := &derplatency.Report{
+		Node: self.StableID(),
+		Time: nr.Now.UTC().Truncate(time.Minute),
+	}
+	if hi := self.Hostinfo(); hi.Valid() {
+		r.Hostname = hi.Hostname()
+	}
+	if derplatency.IsPrivateRegion(nr.PreferredDERP) {
+		r.HomeRegion = nr.PreferredDERP
+	}
+	for rid, d := range nr.RegionLatency {
+		if !derplatency.IsPrivateRegion(rid) || d <= 0 {
+			continue
+		}
+		r.Regions = append(r.Regions, derplatency.RegionLatency{
+			RegionID:  rid,
+			LatencyMS: derplatency.RoundLatency(d),
+		})
+	}
+	if len(r.Regions) == 0 {
+		return nil, false
+	}
+	slices.SortFunc(r.Regions, func(a, b derplatency.RegionLatency) int { return cmp.Compare(a.RegionID, b.RegionID) })
+	return r, true
+}
@@ -0,0 +1,61 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derptelemetry
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"tailscale.com/derp/derplatency"
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+)
+
+func TestNewReport(t *testing.T) {
+	self := (&tailcfg.Node{
+		StableID: "n1",
+		Hostinfo: (&tailcfg.Hostinfo{Hostname: "box"}).View(),
+	}).View()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	got, ok := newReport(self, &netcheck.Report{
+		Now:           now,
+		PreferredDERP: 902,
+		RegionLatency: map[int]time.Duration{
+			1:   5 * time.Millisecond, // not private
+			902: 23 * time.Millisecond,
+			901: 41 * time.Millisecond,
+		},
+	})
+	if !ok {
+		t.Fatal("no report")
+	}
+	want := &derplatency.Report{
+		Node:       "n1",
+		Hostname:   "box",
+		Time:       now.Truncate(time.Minute),
+		HomeRegion: 902,
+		Regions: []derplatency.RegionLatency{
+			{RegionID: 901, LatencyMS: 40},
+			{RegionID: 902, LatencyMS: 25},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+	if !got.Valid() {
+		t.Error("report not valid")
+	}
+
+	// Reports without private regions aren't sent, and non-private homes
+	// aren't reported.
+	if _, ok := newReport(self, &netcheck.Report{
+		Now:           now,
+		PreferredDERP: 1,
+		RegionLatency: map[int]time.Duration{1: 5 * time.Millisecond},
+	}); ok {
+		t.Error("report of only public regions")
+	}
+}
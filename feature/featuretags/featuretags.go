@@ -157,6 +157,8 @@ type FeatureMeta struct {
 		Desc: "portmapper debug support",
 		Deps: []FeatureTag{"portmapper"},
 	},
+	"derpbroker":       {Sym: "DERPBroker", Desc: "Serve a DERP broker for other processes on the host to share DERP connections through"},
+	"derptelemetry":    {Sym: "DERPTelemetry", Desc: "Opt-in reporting of latency to private DERP regions to their operator's collector"},
 	"desktop_sessions": {Sym: "DesktopSessions", Desc: "Desktop sessions support"},
 	"doctor":           {Sym: "Doctor", Desc: "Diagnose possible issues with Tailscale and its host environment"},
 	"drive":            {Sym: "Drive", Desc: "Tailscale Drive (file server) support"},
@@ -166,6 +168,7 @@ type FeatureMeta struct {
 		Deps: []FeatureTag{"netstack"},
 	},
 	"health":             {Sym: "Health", Desc: "Health checking support"},
+	"hostinfoattrs":      {Sym: "HostinfoAttrs", Desc: "Report custom device attributes from a local command to the control plane"},
 	"hujsonconf":         {Sym: "HuJSONConf", Desc: "HuJSON config file support"},
 	"identityfederation": {Sym: "IdentityFederation", Desc: "Auth key generation via identity federation support"},
 	"ipnbus":             {Sym: "IPNBus", Desc: "IPN notification bus (watch-ipn-bus) support, used by GUIs, debugging, and nicer 'tailscale up' support"},
@@ -180,10 +183,19 @@ type FeatureMeta struct {
 		Sym:  "ListenRawDisco",
 		Desc: "Use raw sockets for more robust disco (NAT traversal) message receiving (Linux only)",
 	},
+	"localapiwebsocket": {
+		Sym:  "LocalAPIWebSocket",
+		Desc: "LocalAPI IPN bus watching over WebSocket, for browser-based clients",
+	},
 	"logtail": {
 		Sym:  "LogTail",
 		Desc: "upload logs to log.tailscale.com (debug logs for bug reports and also by network flow logs if enabled)",
 	},
+	"mdnsgateway": {
+		Sym:  "MDNSGateway",
+		Desc: "Gateway between mDNS service discovery on the LAN and DNS-SD over MagicDNS",
+		Deps: []FeatureTag{"dns"},
+	},
 	"oauthkey": {Sym: "OAuthKey", Desc: "OAuth secret-to-authkey resolution support"},
 	"outboundproxy": {
 		Sym:  "OutboundProxy",
@@ -4,6 +4,8 @@
 package feature
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -53,6 +55,10 @@ func CanAutoUpdate() bool {
 // [tshttpproxy.SetTransportGetProxyConnectHeader].
 var HookProxySetTransportGetProxyConnectHeader Hook[func(*http.Transport)]
 
+// HookProxyConnect is a hook for feature/useproxy to register
+// [tshttpproxy.Connect].
+var HookProxyConnect Hook[func(ctx context.Context, dialProxy func(context.Context) (net.Conn, error), proxyURL *url.URL, target string) (net.Conn, error)]
+
 // HookTPMAvailable is a hook that reports whether a TPM device is supported
 // and available.
 var HookTPMAvailable Hook[func() bool]
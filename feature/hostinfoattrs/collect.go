@@ -0,0 +1,143 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package hostinfoattrs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// runTimeout is how long the command may run.
+	runTimeout = 30 * time.Second
+
+	// maxOutput is the most output the command may print.
+	maxOutput = 64 << 10
+
+	maxAttrs       = 64
+	maxKeyLen      = 64
+	maxValueLen    = 256
+	maxStderrInErr = 256
+)
+
+// collector runs an attribute collection command.
+type collector struct {
+	path string // absolute path of the command
+	user string // user to run as, if root; see sandbox
+}
+
+// collect runs the command and returns the attributes it printed.
+func (c *collector) collect(ctx context.Context) (map[string]string, error) {
+	if !filepath.IsAbs(c.path) {
+		return nil, fmt.Errorf("command %q is not an absolute path", c.path)
+	}
+	if err := checkCommandFile(c.path); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.path)
+	cmd.Dir = "/"
+	cmd.Env = []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"}
+	stdout := &limitedBuffer{max: maxOutput}
+	stderr := &limitedBuffer{max: maxStderrInErr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+	if err := sandbox(cmd, c.user); err != nil {
+		return nil, err
+	}
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s: timed out after %v", c.path, runTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", c.path, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", c.path, err)
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf("%s: output exceeds %d bytes", c.path, maxOutput)
+	}
+	attrs, err := parseAttributes(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c.path, err)
+	}
+	return attrs, nil
+}
+
+// parseAttributes parses and validates the attributes printed by a
+// collection command: a JSON object with string values.
+func parseAttributes(out []byte) (map[string]string, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("parsing output: %w", err)
+	}
+	if len(raw) > maxAttrs {
+		return nil, fmt.Errorf("%d attributes; at most %d are allowed", len(raw), maxAttrs)
+	}
+	attrs := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if !validKey(k) {
+			return nil, fmt.Errorf("invalid attribute name %q", k)
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("attribute %q: value must be a string, not %T", k, v)
+		}
+		if len(s) > maxValueLen || !utf8.ValidString(s) {
+			return nil, fmt.Errorf("attribute %q: value must be at most %d bytes of UTF-8", k, maxValueLen)
+		}
+		attrs[k] = s
+	}
+	return attrs, nil
+}
+
+// validKey reports whether k is a valid attribute name, per
+// [tailcfg.Hostinfo.Attributes].
+func validKey(k string) bool {
+	if k == "" || len(k) > maxKeyLen {
+		return false
+	}
+	for _, r := range k {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case r == '_', r == '-', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// limitedBuffer is an io.Writer which keeps the first max bytes written to
+// it, and discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer // not embedded, so io.Copy can't bypass Write with ReadFrom
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - b.buf.Len(); len(p) > room {
+		p = p[:max(room, 0)]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+func (b *limitedBuffer) Bytes() []byte  { return b.buf.Bytes() }
+func (b *limitedBuffer) String() string { return b.buf.String() }
@@ -0,0 +1,29 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !unix
+
+package hostinfoattrs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func checkCommandFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	return nil
+}
+
+// sandbox does nothing on this platform: the command runs with
+// tailscaled's privileges, so should be protected as tailscaled is.
+func sandbox(cmd *exec.Cmd, userName string) error {
+	return nil
+}
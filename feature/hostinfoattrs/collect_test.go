@@ -0,0 +1,99 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package hostinfoattrs
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseAttributes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr string
+	}{
+		{in: `{}`, want: map[string]string{}},
+		{
+			in:   `{"asset-tag": "A1234", "dc:rack": "r12", "cost_center.v2": ""}`,
+			want: map[string]string{"asset-tag": "A1234", "dc:rack": "r12", "cost_center.v2": ""},
+		},
+		{in: `[]`, wantErr: "parsing output"},
+		{in: `not json`, wantErr: "parsing output"},
+		{in: `{"rack": 12}`, wantErr: "must be a string"},
+		{in: `{"rack": null}`, wantErr: "must be a string"},
+		{in: `{"rack id": "r12"}`, wantErr: "invalid attribute name"},
+		{in: `{"": "x"}`, wantErr: "invalid attribute name"},
+		{in: `{"` + strings.Repeat("k", maxKeyLen+1) + `": "x"}`, wantErr: "invalid attribute name"},
+		{in: `{"k": "` + strings.Repeat("v", maxValueLen+1) + `"}`, wantErr: "at most"},
+	}
+	for _, tt := range tests {
+		got, err := parseAttributes([]byte(tt.in))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseAttributes(%s) error = %v; want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAttributes(%s): %v", tt.in, err)
+		} else if !maps.Equal(got, tt.want) {
+			t.Errorf("parseAttributes(%s) = %v; want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("test uses a shell script")
+	}
+	dir := t.TempDir()
+	writeScript := func(name, body string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// Don't drop privileges if run as root, as the script is in a
+	// directory only root can read.
+	const user = "root"
+
+	c := &collector{path: writeScript("ok", `echo '{"rack": "r12", "path": "'$PATH'"}'`, 0o755), user: user}
+	got, err := c.collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["rack"] != "r12" || !strings.HasPrefix(got["path"], "/usr/local/sbin:") {
+		t.Errorf("got %v; want rack r12 and a minimal PATH", got)
+	}
+
+	for name, tc := range map[string]struct {
+		body    string
+		mode    os.FileMode
+		wantErr string
+	}{
+		"fails":    {body: "echo oops >&2; exit 3", mode: 0o700, wantErr: "oops"},
+		"badjson":  {body: "echo '{'", mode: 0o700, wantErr: "parsing output"},
+		"writable": {body: "echo '{}'", mode: 0o777, wantErr: "writable"},
+		"huge":     {body: "head -c 100000 /dev/zero", mode: 0o700, wantErr: "exceeds"},
+	} {
+		c := &collector{path: writeScript(name, tc.body, tc.mode), user: user}
+		if _, err := c.collect(context.Background()); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: error = %v; want %q", name, err, tc.wantErr)
+		}
+	}
+
+	if _, err := (&collector{path: "relative/path"}).collect(context.Background()); err == nil {
+		t.Error("relative path: no error")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build unix
+
+package hostinfoattrs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// checkCommandFile returns an error if the command at path isn't a regular
+// file owned by root (or the current user), and writable only by its owner,
+// as it's run with tailscaled's privileges until sandbox drops them.
+func checkCommandFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	if fi.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("%s must not be writable by group or others", path)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if ok && st.Uid != 0 && int(st.Uid) != os.Geteuid() {
+		return fmt.Errorf("%s must be owned by root", path)
+	}
+	return nil
+}
+
+// sandbox configures cmd to run in its own process group, killed as a whole
+// when cmd is canceled, and if tailscaled runs as root, as the named user
+// (by default "nobody") with no supplementary groups. The user "root" keeps
+// root privileges, for commands which need them to read hardware details.
+func sandbox(cmd *exec.Cmd, userName string) error {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	cmd.SysProcAttr = attr
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	if userName == "" {
+		userName = "nobody"
+	}
+	if userName == "root" {
+		return nil
+	}
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return fmt.Errorf("looking up user to run as: %w", err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return err
+	}
+	attr.Credential = &syscall.Credential{
+		Uid:    uint32(uid),
+		Gid:    uint32(gid),
+		Groups: []uint32{},
+	}
+	return nil
+}
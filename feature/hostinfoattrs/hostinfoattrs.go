@@ -0,0 +1,129 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package hostinfoattrs periodically runs a command configured by the
+// device's administrator to collect custom attributes of the device, such as
+// an asset tag, rack or cost center, and reports them to the control plane
+// in [tailcfg.Hostinfo.Attributes].
+//
+// It's configured with environment variables:
+//
+//   - TS_HOSTINFO_ATTRS_COMMAND is the absolute path of the command. It's
+//     run without arguments, and must print a JSON object of string
+//     attributes, like {"asset-tag": "A1234", "rack": "r12"}.
+//   - TS_HOSTINFO_ATTRS_INTERVAL is how often to run it (default 1h).
+//   - TS_HOSTINFO_ATTRS_USER is, on Unix systems when tailscaled runs as
+//     root, the user to run the command as (default "nobody").
+package hostinfoattrs
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/ipn/ipnext"
+	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/eventbus"
+)
+
+func init() {
+	ipnext.RegisterExtension("hostinfoattrs", newExtension)
+}
+
+var (
+	commandEnv  = envknob.RegisterString("TS_HOSTINFO_ATTRS_COMMAND")
+	intervalEnv = envknob.RegisterDuration("TS_HOSTINFO_ATTRS_INTERVAL")
+	userEnv     = envknob.RegisterString("TS_HOSTINFO_ATTRS_USER")
+)
+
+const (
+	defaultInterval = time.Hour
+	minInterval     = time.Minute
+)
+
+func newExtension(logf logger.Logf, sb ipnext.SafeBackend) (ipnext.Extension, error) {
+	busClient := sb.Sys().Bus.Get().Client("hostinfoattrs")
+	e := &extension{
+		sb:        sb,
+		busClient: busClient,
+		logf:      logger.WithPrefix(logf, "hostinfoattrs: "),
+		pub:       eventbus.Publish[ipnlocal.HostinfoAttributes](busClient),
+		done:      make(chan struct{}),
+	}
+	e.ctx, e.ctxCancel = context.WithCancel(context.Background())
+	return e, nil
+}
+
+// extension implements the hostinfoattrs extension.
+type extension struct {
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	done      chan struct{} // closed when the collection goroutine exits
+	busClient *eventbus.Client
+	pub       *eventbus.Publisher[ipnlocal.HostinfoAttributes]
+	logf      logger.Logf
+	sb        ipnext.SafeBackend
+}
+
+func (e *extension) Name() string { return "hostinfoattrs" }
+
+func (e *extension) Init(h ipnext.Host) error {
+	cmd := commandEnv()
+	if cmd == "" {
+		return ipnext.SkipExtension
+	}
+	c := &collector{
+		path: cmd,
+		user: userEnv(),
+	}
+	interval := intervalEnv()
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	if interval < minInterval {
+		e.logf("TS_HOSTINFO_ATTRS_INTERVAL %v too short; using %v", interval, minInterval)
+		interval = minInterval
+	}
+	go e.runCollectLoop(c, interval)
+	return nil
+}
+
+func (e *extension) Shutdown() error {
+	e.ctxCancel()
+	e.busClient.Close()
+	<-e.done
+	return nil
+}
+
+// runCollectLoop runs c every interval, publishing its attributes when
+// they change. If the command fails, the previous attributes are kept.
+func (e *extension) runCollectLoop(c *collector, interval time.Duration) {
+	defer close(e.done)
+
+	ticker, tickerChannel := e.sb.Clock().NewTicker(interval)
+	defer ticker.Stop()
+
+	var last map[string]string
+	published := false
+	for {
+		attrs, err := c.collect(e.ctx)
+		switch {
+		case e.ctx.Err() != nil:
+			return
+		case err != nil:
+			e.logf("%v", err)
+		case !published || !maps.Equal(attrs, last):
+			e.logf("collected %d attributes", len(attrs))
+			e.pub.Publish(ipnlocal.HostinfoAttributes(attrs))
+			last, published = attrs, true
+		}
+
+		select {
+		case <-tickerChannel:
+		case <-e.ctx.Done():
+			return
+		}
+	}
+}
@@ -98,11 +98,18 @@ func handleC2NPostureIdentityGet(b *ipnlocal.LocalBackend, w http.ResponseWriter
 				e.logf("c2n: GetHardwareAddrs returned error: %v", err)
 			}
 		}
+
+		if r.FormValue("securityagents") == "true" {
+			res.SecurityAgents, err = posture.GetSecurityAgents(e.logf)
+			if err != nil {
+				e.logf("c2n: GetSecurityAgents returned error: %v", err)
+			}
+		}
 	} else {
 		res.PostureDisabled = true
 	}
 
-	e.logf("c2n: posture identity disabled=%v reported %d serials %d hwaddrs", res.PostureDisabled, len(res.SerialNumbers), len(res.IfaceHardwareAddrs))
+	e.logf("c2n: posture identity disabled=%v reported %d serials %d hwaddrs %d security agents", res.PostureDisabled, len(res.SerialNumbers), len(res.IfaceHardwareAddrs), len(res.SecurityAgents))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(res)
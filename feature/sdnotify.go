@@ -4,6 +4,7 @@
 package feature
 
 import (
+	"net"
 	"runtime"
 
 	"tailscale.com/feature/buildfeatures"
@@ -13,6 +14,10 @@
 // dependents from starting.
 var HookSystemdReady Hook[func()]
 
+// HookSystemdListener holds a func that returns the LocalAPI listener passed
+// to this process by systemd socket activation, or nil if there isn't one.
+var HookSystemdListener Hook[func() (net.Listener, error)]
+
 // HookSystemdStatus holds a func that will send a single line status update to
 // systemd so that information shows up in systemctl output.
 var HookSystemdStatus Hook[func(format string, args ...any)]
@@ -0,0 +1,93 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux && !android
+
+package sdnotify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"tailscale.com/feature"
+)
+
+func init() {
+	feature.HookSystemdListener.Set(listener)
+}
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation. See sd_listen_fds(3).
+const listenFDsStart = 3
+
+// localAPIFDName is the FileDescriptorName= of the LocalAPI socket, needed
+// only when systemd passes more than one socket.
+const localAPIFDName = "localapi"
+
+// listener returns the LocalAPI listener passed by systemd socket
+// activation, or nil if this process wasn't socket activated.
+func listener() (net.Listener, error) {
+	n, idx, err := listenFDs(os.Getenv, os.Getpid())
+	if n == 0 {
+		return nil, nil
+	}
+	// The sockets are for us, not any child processes.
+	for _, k := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		os.Unsetenv(k)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range n {
+		fd := listenFDsStart + i
+		if i != idx {
+			syscall.Close(fd)
+			continue
+		}
+		syscall.CloseOnExec(fd)
+	}
+	f := os.NewFile(uintptr(listenFDsStart+idx), "systemd-socket")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ln.(*net.UnixListener); !ok {
+		ln.Close()
+		return nil, fmt.Errorf("socket from systemd is a %v listener; want unix", ln.Addr().Network())
+	}
+	return ln, nil
+}
+
+// listenFDs parses the socket activation environment variables, as returned
+// by getenv, of the process with ID pid. It returns the number of sockets
+// that systemd passed to the process, and the index among them of the
+// LocalAPI socket. It returns n == 0 if the process wasn't socket activated,
+// including if the variables are malformed or are for another process.
+func listenFDs(getenv func(string) string, pid int) (n, idx int, err error) {
+	if p, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || p != pid {
+		return 0, 0, nil
+	}
+	n, err = strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return 0, 0, nil
+	}
+	if n == 1 {
+		return n, 0, nil
+	}
+	var names []string
+	if v := getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+	idx = slices.Index(names, localAPIFDName)
+	if idx < 0 || idx >= n {
+		return n, 0, fmt.Errorf("got %d sockets from systemd; want 1, or one named %q", n, localAPIFDName)
+	}
+	return n, idx, nil
+}
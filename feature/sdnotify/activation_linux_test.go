@@ -0,0 +1,97 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux && !android
+
+package sdnotify
+
+import "testing"
+
+func TestListenFDs(t *testing.T) {
+	const pid = 1234
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantN   int
+		wantIdx int
+		wantErr bool
+	}{
+		{
+			name: "not-activated",
+		},
+		{
+			name:  "one-fd",
+			env:   map[string]string{"LISTEN_PID": "1234", "LISTEN_FDS": "1"},
+			wantN: 1,
+		},
+		{
+			name:  "one-fd-named",
+			env:   map[string]string{"LISTEN_PID": "1234", "LISTEN_FDS": "1", "LISTEN_FDNAMES": "other"},
+			wantN: 1,
+		},
+		{
+			name: "pid-mismatch",
+			env:  map[string]string{"LISTEN_PID": "4321", "LISTEN_FDS": "1"},
+		},
+		{
+			name: "pid-missing",
+			env:  map[string]string{"LISTEN_FDS": "1"},
+		},
+		{
+			name: "pid-malformed",
+			env:  map[string]string{"LISTEN_PID": "12x4", "LISTEN_FDS": "1"},
+		},
+		{
+			name: "zero-fds",
+			env:  map[string]string{"LISTEN_PID": "1234", "LISTEN_FDS": "0"},
+		},
+		{
+			name: "negative-fds",
+			env:  map[string]string{"LISTEN_PID": "1234", "LISTEN_FDS": "-1"},
+		},
+		{
+			name: "fds-malformed",
+			env:  map[string]string{"LISTEN_PID": "1234", "LISTEN_FDS": "one"},
+		},
+		{
+			name: "fds-missing",
+			env:  map[string]string{"LISTEN_PID": "1234"},
+		},
+		{
+			name:    "multiple-fds-named",
+			env:     map[string]string{"LISTEN_PID": "1234", "LISTEN_FDS": "3", "LISTEN_FDNAMES": "debug:localapi:metrics"},
+			wantN:   3,
+			wantIdx: 1,
+		},
+		{
+			name:    "multiple-fds-unnamed",
+			env:     map[string]string{"LISTEN_PID": "1234", "LISTEN_FDS": "2"},
+			wantN:   2,
+			wantErr: true,
+		},
+		{
+			name:    "multiple-fds-no-localapi",
+			env:     map[string]string{"LISTEN_PID": "1234", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "debug:metrics"},
+			wantN:   2,
+			wantErr: true,
+		},
+		{
+			name:    "multiple-fds-name-beyond-count",
+			env:     map[string]string{"LISTEN_PID": "1234", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "debug:metrics:localapi"},
+			wantN:   2,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(k string) string { return tt.env[k] }
+			n, idx, err := listenFDs(getenv, pid)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v; want error: %v", err, tt.wantErr)
+			}
+			if n != tt.wantN || idx != tt.wantIdx {
+				t.Errorf("listenFDs = (%d, %d); want (%d, %d)", n, idx, tt.wantN, tt.wantIdx)
+			}
+		})
+	}
+}
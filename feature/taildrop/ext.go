@@ -28,6 +28,7 @@
 	"tailscale.com/types/logger"
 	"tailscale.com/util/osshare"
 	"tailscale.com/util/set"
+	"tailscale.com/util/syspolicy/pkey"
 )
 
 func init() {
@@ -181,9 +182,21 @@ func (e *Extension) onChangeProfile(profile ipn.LoginProfileView, _ ipn.PrefsVie
 		DirectFileMode: isDirectFileMode,
 		fileOps:        fops,
 		SendFileNotify: e.sendFileNotify,
+		FileScanner:    e.fileScanner,
 	}.New())
 }
 
+// fileScanner returns the scanner that received files must pass, as
+// configured by the TaildropFileScanner policy setting, or nil if none is.
+// It's read for each file, so policy changes take effect immediately.
+func (e *Extension) fileScanner() fileScanner {
+	spec, err := e.sb.Sys().PolicyClientOrDefault().GetString(pkey.TaildropFileScanner, "")
+	if err != nil {
+		e.logf("reading TaildropFileScanner policy: %v", err)
+	}
+	return newFileScanner(spec)
+}
+
 // fileRoot returns where to store Taildrop files for the given user and whether
 // to write received files directly to this directory, without staging them in
 // an intermediate buffered directory for "pick-up" later.
@@ -70,7 +70,7 @@ func init() {
 func serveFilePut(h *localapi.Handler, w http.ResponseWriter, r *http.Request) {
 	metricFilePutCalls.Add(1)
 
-	if !h.PermitWrite {
+	if !h.PermitWrite && !h.PermitTaildrop {
 		http.Error(w, "file access denied", http.StatusForbidden)
 		return
 	}
@@ -128,6 +128,10 @@ func serveFilePut(h *localapi.Handler, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Periodically report progress of outgoing files.
+	var localUser string
+	if h.Actor != nil {
+		localUser, _ = h.Actor.Username()
+	}
 	outgoingFiles := make(map[string]*ipn.OutgoingFile)
 	t := time.NewTicker(1 * time.Second)
 	progressUpdates := make(chan ipn.OutgoingFile)
@@ -142,6 +146,7 @@ func serveFilePut(h *localapi.Handler, w http.ResponseWriter, r *http.Request) {
 				if !ok {
 					return
 				}
+				u.LocalUser = localUser
 				outgoingFiles[u.ID] = &u
 			case <-t.C:
 				ext.updateOutgoingFiles(outgoingFiles)
@@ -357,7 +362,19 @@ func singleFilePut(
 }
 
 func serveFiles(h *localapi.Handler, w http.ResponseWriter, r *http.Request) {
-	if !h.PermitWrite {
+	if !h.PermitWrite && !h.PermitTaildrop {
+		http.Error(w, "file access denied", http.StatusForbidden)
+		return
+	}
+	if h.RedactOtherUsers && !h.PermitTaildrop {
+		// Received files are for root, the operator and Taildrop
+		// delegates to fetch, so others see none and can't fetch or
+		// delete them.
+		if r.Method == "GET" && r.URL.EscapedPath() == "/localapi/v0/files/" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]apitype.WaitingFile{})
+			return
+		}
 		http.Error(w, "file access denied", http.StatusForbidden)
 		return
 	}
@@ -440,6 +457,14 @@ func serveFileTargets(h *localapi.Handler, w http.ResponseWriter, r *http.Reques
 		http.Error(w, "want GET to list targets", http.StatusBadRequest)
 		return
 	}
+	if h.RedactOtherUsers && !h.PermitTaildrop {
+		// Sending files as the node is for root, the operator and
+		// Taildrop delegates; the targets are other users' (the node
+		// owner's) devices.
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]*apitype.FileTarget{})
+		return
+	}
 
 	ext, ok := ipnlocal.GetExt[*Extension](h.LocalBackend())
 	if !ok {
@@ -0,0 +1,44 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package taildrop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn/localapi"
+)
+
+func TestLocalAPIRedactOtherUsers(t *testing.T) {
+	h := &localapi.Handler{
+		PermitRead:       true,
+		PermitWrite:      true,
+		RedactOtherUsers: true,
+	}
+	tests := []struct {
+		method, path string
+		serve        localapi.LocalAPIHandler
+		wantCode     int
+		wantBody     string
+	}{
+		{"GET", "/localapi/v0/files/", serveFiles, http.StatusOK, "[]"},
+		{"GET", "/localapi/v0/files/secret.txt", serveFiles, http.StatusForbidden, ""},
+		{"DELETE", "/localapi/v0/files/secret.txt", serveFiles, http.StatusForbidden, ""},
+		{"GET", "/localapi/v0/file-targets", serveFileTargets, http.StatusOK, "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.serve(h, rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d; want %d", rec.Code, tt.wantCode)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); tt.wantBody != "" && got != tt.wantBody {
+				t.Errorf("body = %q; want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -150,6 +150,8 @@ func handlePeerPutWithBackend(h ipnlocal.PeerAPIHandler, ext extensionForPut, w
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		case ErrFileExists:
 			http.Error(w, err.Error(), http.StatusConflict)
+		case ErrFileRejected:
+			http.Error(w, err.Error(), http.StatusForbidden)
 		default:
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
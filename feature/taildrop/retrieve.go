@@ -44,7 +44,7 @@ func (m *manager) HasFilesWaiting() bool {
 	fileSet := set.Of(files...)
 
 	for _, filename := range files {
-		if isPartialOrDeleted(filename) {
+		if isPartialDeletedOrQuarantined(filename) {
 			continue
 		}
 		if fileSet.Contains(filename + deletedSuffix) {
@@ -75,7 +75,7 @@ func (m *manager) WaitingFiles() ([]apitype.WaitingFile, error) {
 	}
 	var ret []apitype.WaitingFile
 	for _, name := range names {
-		if isPartialOrDeleted(name) {
+		if isPartialDeletedOrQuarantined(name) {
 			continue
 		}
 		// A corresponding .deleted marker means the file was already handled.
@@ -0,0 +1,198 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package taildrop
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"tailscale.com/util/clientmetric"
+)
+
+// quarantinedSuffix is the suffix of received files that a [fileScanner]
+// quarantined. They're kept, but not surfaced to users.
+const quarantinedSuffix = ".quarantined"
+
+// scanTimeout is how long a [fileScanner] may take to check a file.
+const scanTimeout = 5 * time.Minute
+
+// ErrFileRejected is returned by [manager.PutFile] when the file scanner
+// rejected or quarantined the received file.
+var ErrFileRejected = errors.New("file rejected by content policy")
+
+var (
+	metricScanAccepted    = clientmetric.NewCounter("taildrop_scan_accepted")
+	metricScanRejected    = clientmetric.NewCounter("taildrop_scan_rejected")
+	metricScanQuarantined = clientmetric.NewCounter("taildrop_scan_quarantined")
+	metricScanErrors      = clientmetric.NewCounter("taildrop_scan_errors")
+)
+
+// scanVerdict is what a [fileScanner] decided to do with a file.
+type scanVerdict string
+
+const (
+	scanAccept     scanVerdict = "accept"     // surface it as usual
+	scanReject     scanVerdict = "reject"     // delete it
+	scanQuarantine scanVerdict = "quarantine" // keep it, hidden from users
+)
+
+// scanRequest describes a received file to check. It's the request sent to
+// Unix socket scanners, encoded as one line of JSON.
+type scanRequest struct {
+	Path   string `json:"path"`   // of the file, not yet at its final name
+	Name   string `json:"name"`   // the name it was sent with
+	Sender string `json:"sender"` // stable node ID of the sending node
+	Size   int64  `json:"size"`
+}
+
+// scanResult is a [fileScanner]'s decision. It's the response from Unix
+// socket scanners, encoded as one line of JSON.
+type scanResult struct {
+	Verdict scanVerdict `json:"verdict"`
+	Reason  string      `json:"reason,omitempty"`
+}
+
+// fileScanner checks received files, such as for viruses or data loss
+// prevention, before they're surfaced to users.
+type fileScanner interface {
+	scan(context.Context, scanRequest) (scanResult, error)
+}
+
+// newFileScanner returns the [fileScanner] configured by spec, the value of
+// the TaildropFileScanner policy setting. It returns nil if spec is empty.
+func newFileScanner(spec string) fileScanner {
+	if spec == "" {
+		return nil
+	}
+	if path, ok := strings.CutPrefix(spec, "unix:"); ok {
+		return socketScanner(path)
+	}
+	return commandScanner(spec)
+}
+
+// commandScanner is a [fileScanner] that runs the named command with the
+// path of the file to check as its only argument, and its name, sender and
+// size in the TS_TAILDROP_NAME, TS_TAILDROP_SENDER and TS_TAILDROP_SIZE
+// environment variables. The command's exit status is the verdict: 0 to
+// accept the file, 1 to reject it, or 2 to quarantine it. The first line
+// of its output, if any, is the reason.
+type commandScanner string
+
+func (c commandScanner) scan(ctx context.Context, req scanRequest) (scanResult, error) {
+	cmd := exec.CommandContext(ctx, string(c), req.Path)
+	cmd.Env = append(os.Environ(),
+		"TS_TAILDROP_NAME="+req.Name,
+		"TS_TAILDROP_SENDER="+req.Sender,
+		"TS_TAILDROP_SIZE="+strconv.FormatInt(req.Size, 10),
+	)
+	out, err := cmd.Output()
+	reason, _, _ := strings.Cut(string(out), "\n")
+	res := scanResult{Reason: strings.TrimSpace(reason)}
+	var ee *exec.ExitError
+	switch {
+	case err == nil:
+		res.Verdict = scanAccept
+	case errors.As(err, &ee) && ee.ExitCode() == 1:
+		res.Verdict = scanReject
+	case errors.As(err, &ee) && ee.ExitCode() == 2:
+		res.Verdict = scanQuarantine
+	default:
+		if ee != nil && len(bytes.TrimSpace(ee.Stderr)) > 0 {
+			err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(ee.Stderr))
+		}
+		return scanResult{}, err
+	}
+	return res, nil
+}
+
+// socketScanner is a [fileScanner] that connects to the Unix socket at the
+// given path for each file, writes a [scanRequest], and reads back a
+// [scanResult].
+type socketScanner string
+
+func (s socketScanner) scan(ctx context.Context, req scanRequest) (scanResult, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "unix", string(s))
+	if err != nil {
+		return scanResult{}, err
+	}
+	defer c.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		c.SetDeadline(dl)
+	}
+	if err := json.NewEncoder(c).Encode(req); err != nil {
+		return scanResult{}, err
+	}
+	line, err := bufio.NewReader(c).ReadBytes('\n')
+	if err != nil {
+		return scanResult{}, err
+	}
+	var res scanResult
+	if err := json.Unmarshal(line, &res); err != nil {
+		return scanResult{}, err
+	}
+	switch res.Verdict {
+	case scanAccept, scanReject, scanQuarantine:
+		return res, nil
+	}
+	return scanResult{}, fmt.Errorf("unknown verdict %q", res.Verdict)
+}
+
+// scanFile checks the received file at partialPath with the configured
+// [fileScanner], if any, recording the result in the log. If the file was
+// rejected or quarantined, it disposes of it and returns [ErrFileRejected].
+// If the file can't be checked, it's treated as rejected.
+func (m *manager) scanFile(id clientID, baseName, partialName, partialPath string, size int64) error {
+	if m.opts.FileScanner == nil {
+		return nil
+	}
+	sc := m.opts.FileScanner()
+	if sc == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scanTimeout)
+	defer cancel()
+	res, err := sc.scan(ctx, scanRequest{
+		Path:   partialPath,
+		Name:   baseName,
+		Sender: string(id),
+		Size:   size,
+	})
+	if err != nil {
+		metricScanErrors.Add(1)
+		m.opts.Logf("scan of %q from %v failed, rejecting it: %v", redactString(baseName), id, err)
+		res = scanResult{Verdict: scanReject, Reason: "scan failed"}
+	} else {
+		m.opts.Logf("scan of %q from %v: %s %q", redactString(baseName), id, res.Verdict, res.Reason)
+	}
+
+	switch res.Verdict {
+	case scanAccept:
+		metricScanAccepted.Add(1)
+		return nil
+	case scanQuarantine:
+		metricScanQuarantined.Add(1)
+		if _, err := m.opts.fileOps.Rename(partialPath, baseName+quarantinedSuffix); err != nil {
+			m.opts.Logf("quarantining %q: %v", redactString(baseName), redactError(err))
+			m.deleter.Insert(partialName)
+		}
+	default:
+		metricScanRejected.Add(1)
+		if err := m.opts.fileOps.Remove(partialName); err != nil {
+			m.deleter.Insert(partialName)
+		}
+	}
+	// The reason is only logged; it's not for the sender.
+	return ErrFileRejected
+}
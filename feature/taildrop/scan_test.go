@@ -0,0 +1,196 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package taildrop
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"tailscale.com/tstime"
+	"tailscale.com/util/must"
+)
+
+type fakeScanner func(scanRequest) (scanResult, error)
+
+func (f fakeScanner) scan(_ context.Context, req scanRequest) (scanResult, error) {
+	return f(req)
+}
+
+func TestPutFileScan(t *testing.T) {
+	const content = "hello, world"
+
+	tests := []struct {
+		name      string
+		verdict   scanVerdict
+		wantErr   error
+		wantFiles []string
+	}{
+		{"accept", scanAccept, nil, []string{"file.txt"}},
+		{"reject", scanReject, ErrFileRejected, nil},
+		{"quarantine", scanQuarantine, ErrFileRejected, []string{"file.txt.quarantined"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var got scanRequest
+			mgr := managerOptions{
+				Logf:    t.Logf,
+				Clock:   tstime.DefaultClock{},
+				fileOps: must.Get(newFileOps(dir)),
+				FileScanner: func() fileScanner {
+					return fakeScanner(func(req scanRequest) (scanResult, error) {
+						got = req
+						b, err := os.ReadFile(req.Path)
+						if err != nil || string(b) != content {
+							t.Errorf("reading scanned file: %q, %v", b, err)
+						}
+						return scanResult{Verdict: tt.verdict, Reason: "test"}, nil
+					})
+				},
+			}.New()
+			defer mgr.Shutdown()
+
+			_, err := mgr.PutFile("n123", "file.txt", strings.NewReader(content), 0, int64(len(content)))
+			if err != tt.wantErr {
+				t.Fatalf("PutFile error = %v; want %v", err, tt.wantErr)
+			}
+			if got.Name != "file.txt" || got.Sender != "n123" || got.Size != int64(len(content)) {
+				t.Errorf("scan request = %+v", got)
+			}
+
+			var names []string
+			for _, e := range must.Get(os.ReadDir(dir)) {
+				names = append(names, e.Name())
+			}
+			if !slices.Equal(names, tt.wantFiles) {
+				t.Errorf("files = %q; want %q", names, tt.wantFiles)
+			}
+			if waiting := must.Get(mgr.WaitingFiles()); (len(waiting) > 0) != (tt.verdict == scanAccept) {
+				t.Errorf("waiting files = %v", waiting)
+			}
+		})
+	}
+}
+
+func TestPutFileScanError(t *testing.T) {
+	dir := t.TempDir()
+	mgr := managerOptions{
+		Logf:    t.Logf,
+		Clock:   tstime.DefaultClock{},
+		fileOps: must.Get(newFileOps(dir)),
+		FileScanner: func() fileScanner {
+			return commandScanner(filepath.Join(dir, "no-such-scanner"))
+		},
+	}.New()
+	defer mgr.Shutdown()
+
+	if _, err := mgr.PutFile("n123", "file.txt", strings.NewReader("x"), 0, 1); err != ErrFileRejected {
+		t.Fatalf("PutFile error = %v; want %v", err, ErrFileRejected)
+	}
+	if entries := must.Get(os.ReadDir(dir)); len(entries) != 0 {
+		t.Errorf("unexpected files left: %v", entries)
+	}
+}
+
+func TestCommandScanner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "scan.sh")
+	must.Do(os.WriteFile(script, []byte(`#!/bin/sh
+case "$TS_TAILDROP_NAME" in
+*.exe) echo "executables not allowed"; exit 1 ;;
+*.zip) echo "archive from $TS_TAILDROP_SENDER"; exit 2 ;;
+*.bad) echo "oops" >&2; exit 3 ;;
+esac
+test -f "$1" || exit 3
+`), 0o755))
+	file := filepath.Join(dir, "file")
+	must.Do(os.WriteFile(file, nil, 0o644))
+
+	tests := []struct {
+		name    string
+		want    scanResult
+		wantErr bool
+	}{
+		{name: "a.txt", want: scanResult{Verdict: scanAccept}},
+		{name: "a.exe", want: scanResult{Verdict: scanReject, Reason: "executables not allowed"}},
+		{name: "a.zip", want: scanResult{Verdict: scanQuarantine, Reason: "archive from n123"}},
+		{name: "a.bad", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := commandScanner(script).scan(context.Background(), scanRequest{Path: file, Name: tt.name, Sender: "n123"})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("scan(%q) error = %v; want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("scan(%q) = %+v; want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSocketScanner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a Unix socket")
+	}
+	sock := filepath.Join(t.TempDir(), "scan.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var req scanRequest
+			if err := json.NewDecoder(bufio.NewReader(c)).Decode(&req); err != nil {
+				c.Close()
+				continue
+			}
+			res := scanResult{Verdict: scanAccept}
+			switch {
+			case strings.HasSuffix(req.Name, ".exe"):
+				res = scanResult{Verdict: scanReject, Reason: "executable"}
+			case strings.HasSuffix(req.Name, ".bad"):
+				res.Verdict = "maybe"
+			}
+			json.NewEncoder(c).Encode(res)
+			c.Close()
+		}
+	}()
+
+	sc := newFileScanner("unix:" + sock)
+	tests := []struct {
+		name    string
+		want    scanResult
+		wantErr bool
+	}{
+		{name: "a.txt", want: scanResult{Verdict: scanAccept}},
+		{name: "a.exe", want: scanResult{Verdict: scanReject, Reason: "executable"}},
+		{name: "a.bad", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := sc.scan(context.Background(), scanRequest{Name: tt.name})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("scan(%q) error = %v; want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("scan(%q) = %+v; want %+v", tt.name, got, tt.want)
+		}
+	}
+}
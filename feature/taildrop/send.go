@@ -148,6 +148,10 @@ func (m *manager) PutFile(id clientID, baseName string, r io.Reader, offset, len
 
 	fileLength = offset + copyLength
 
+	if err := m.scanFile(id, baseName, partialName, partialPath, fileLength); err != nil {
+		return 0, err
+	}
+
 	inFile.mu.Lock()
 	inFile.done = true
 	inFile.mu.Unlock()
@@ -87,6 +87,10 @@ type managerOptions struct {
 	// to the function when reception completes.
 	// It is not called if nil.
 	SendFileNotify func()
+
+	// FileScanner, if non-nil, returns the scanner to check each received
+	// file with before it's surfaced to users, or nil to not check it.
+	FileScanner func() fileScanner
 }
 
 // manager manages the state for receiving and managing taildropped files.
@@ -147,8 +151,8 @@ func validFilenameRune(r rune) bool {
 	return unicode.IsGraphic(r)
 }
 
-func isPartialOrDeleted(s string) bool {
-	return strings.HasSuffix(s, deletedSuffix) || strings.HasSuffix(s, partialSuffix)
+func isPartialDeletedOrQuarantined(s string) bool {
+	return strings.HasSuffix(s, deletedSuffix) || strings.HasSuffix(s, partialSuffix) || strings.HasSuffix(s, quarantinedSuffix)
 }
 
 func validateBaseName(name string) error {
@@ -162,7 +166,7 @@ func validateBaseName(name string) error {
 	if clean != name || clean == "." || clean == ".." {
 		return ErrInvalidFileName
 	}
-	if isPartialOrDeleted(name) {
+	if isPartialDeletedOrQuarantined(name) {
 		return ErrInvalidFileName
 	}
 	for _, r := range name {
@@ -0,0 +1,377 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"tailscale.com/net/tsaddr"
+)
+
+// routerLinkLocal is the IPv6 link-local address of the router the TAP device
+// pretends to be, derived from ourMAC with EUI-64. It's the source of our
+// router advertisements and DHCPv6 replies, and so the client's default
+// IPv6 route.
+var routerLinkLocal = netip.AddrFrom16([16]byte{
+	0: 0xfe, 1: 0x80,
+	8: ourMAC[0] ^ 0x02, 9: ourMAC[1], 10: ourMAC[2], 11: 0xff,
+	12: 0xfe, 13: ourMAC[3], 14: ourMAC[4], 15: ourMAC[5],
+})
+
+var (
+	// allNodes is the IPv6 link-local all-nodes multicast address, to which
+	// router advertisements are sent, and allNodesMAC its Ethernet address.
+	allNodes    = netip.MustParseAddr("ff02::1")
+	allNodesMAC = net.HardwareAddr{0x33, 0x33, 0, 0, 0, 1}
+)
+
+const (
+	// raInterval is how often unsolicited router advertisements are sent,
+	// well within raRouterLifetime so the client's default route doesn't
+	// lapse.
+	raInterval       = 5 * time.Minute
+	raRouterLifetime = 30 * time.Minute
+
+	// dhcpv6Lifetime is the valid and preferred lifetime of the address
+	// handed out by DHCPv6; it's renewed at half of it.
+	dhcpv6Lifetime = time.Hour
+)
+
+// DHCPv6 message types and options, from RFC 8415 and RFC 3646.
+const (
+	dhcpv6Solicit            = 1
+	dhcpv6Advertise          = 2
+	dhcpv6Request            = 3
+	dhcpv6Confirm            = 4
+	dhcpv6Renew              = 5
+	dhcpv6Rebind             = 6
+	dhcpv6Reply              = 7
+	dhcpv6Release            = 8
+	dhcpv6Decline            = 9
+	dhcpv6InformationRequest = 11
+
+	dhcpv6OptClientID    = 1
+	dhcpv6OptServerID    = 2
+	dhcpv6OptIANA        = 3
+	dhcpv6OptIAAddr      = 5
+	dhcpv6OptStatusCode  = 13
+	dhcpv6OptRapidCommit = 14
+	dhcpv6OptDNSServers  = 23
+
+	dhcpv6StatusSuccess   = 0
+	dhcpv6StatusNotOnLink = 4
+
+	dhcpv6ClientPort = 546
+	dhcpv6ServerPort = 547
+)
+
+// NDP options, from RFC 4861 and RFC 8106.
+const (
+	ndpOptSourceLinkAddr = 1
+	ndpOptTargetLinkAddr = 2
+	ndpOptMTU            = 5
+	ndpOptRDNSS          = 25
+)
+
+// dhcpv6ServerDUID is our DHCPv6 server identifier: a DUID-LL (type 3) of
+// ourMAC on Ethernet (hardware type 1).
+var dhcpv6ServerDUID = append([]byte{0, 3, 0, 1}, ourMAC...)
+
+// handleIPv6 handles an IPv6 TAP ethernet frame and reports whether it's been
+// handled. It answers router and neighbor solicitations for the router and
+// DHCPv6 requests, and passes everything else on to WireGuard.
+func (t *tapDevice) handleIPv6(ethBuf []byte) bool {
+	ethSrcMAC := net.HardwareAddr(ethBuf[6:12])
+	ip := header.IPv6(ethBuf[ethernetFrameSize:])
+	if len(ip) < header.IPv6MinimumSize || int(ip.PayloadLength()) > len(ip)-header.IPv6MinimumSize {
+		if tapDebug {
+			t.logf("tap: short ipv6")
+		}
+		return consumePacket
+	}
+	src := ip.SourceAddress()
+	payload := ip.Payload()
+	switch tcpip.TransportProtocolNumber(ip.NextHeader()) {
+	case header.ICMPv6ProtocolNumber:
+		if len(payload) < header.ICMPv6MinimumSize {
+			return consumePacket
+		}
+		switch header.ICMPv6(payload).Type() {
+		case header.ICMPv6RouterSolicit:
+			t.learnMAC(ethSrcMAC)
+			t.sendRouterAdvert()
+			return consumePacket
+		case header.ICMPv6NeighborSolicit:
+			t.handleNeighborSolicit(ethSrcMAC, src, payload)
+			return consumePacket
+		case header.ICMPv6RouterAdvert, header.ICMPv6NeighborAdvert:
+			// Not for the tailnet.
+			return consumePacket
+		}
+	case header.UDPProtocolNumber:
+		u := header.UDP(payload)
+		if len(u) >= header.UDPMinimumSize && u.SourcePort() == dhcpv6ClientPort && u.DestinationPort() == dhcpv6ServerPort {
+			t.learnMAC(ethSrcMAC)
+			t.handleDHCPv6(ethSrcMAC, netip.AddrFrom16(src.As16()), u.Payload())
+			return consumePacket
+		}
+	}
+	return passOnPacket
+}
+
+// sendRouterAdvert sends a router advertisement to all nodes on the link,
+// making us the default IPv6 router and telling the client to get its
+// address and DNS server with DHCPv6. It does nothing until we know the
+// client's tailnet IPv6 address.
+func (t *tapDevice) sendRouterAdvert() {
+	if !t.clientIPv6.Load().IsValid() {
+		return
+	}
+	mtu, err := t.MTU()
+	if err != nil {
+		mtu = 1280 // the IPv6 minimum
+	}
+	dns := tsaddr.TailscaleServiceIPv6().As16()
+
+	var b []byte
+	b = append(b, byte(header.ICMPv6RouterAdvert), 0, 0, 0) // type, code, checksum
+	b = append(b, 64)                                       // current hop limit
+	b = append(b, 0xc0)                                     // managed and other configuration flags
+	b = binary.BigEndian.AppendUint16(b, uint16(raRouterLifetime/time.Second))
+	b = binary.BigEndian.AppendUint32(b, 0) // reachable time: unspecified
+	b = binary.BigEndian.AppendUint32(b, 0) // retrans timer: unspecified
+	b = append(b, ndpOptSourceLinkAddr, 1)
+	b = append(b, ourMAC...)
+	b = append(b, ndpOptMTU, 1, 0, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(mtu))
+	b = append(b, ndpOptRDNSS, 3, 0, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(raRouterLifetime/time.Second))
+	b = append(b, dns[:]...)
+
+	n, err := t.WriteEthernet(packLayer2IPv6(b, header.ICMPv6ProtocolNumber, ourMAC, allNodesMAC, routerLinkLocal, allNodes))
+	if tapDebug {
+		t.logf("tap: wrote router advertisement %v, %v", n, err)
+	}
+}
+
+// raLoop sends unsolicited router advertisements every raInterval until
+// the device is closed.
+func (t *tapDevice) raLoop() {
+	tick := time.NewTicker(raInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			t.sendRouterAdvert()
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// handleNeighborSolicit answers the neighbor solicitation ns from srcMAC and
+// src with our MAC, if it's for the router's link-local address.
+func (t *tapDevice) handleNeighborSolicit(srcMAC net.HardwareAddr, src tcpip.Address, ns []byte) {
+	const targetOff = header.ICMPv6HeaderSize + 4 // after the reserved field
+	if len(ns) < targetOff+16 {
+		return
+	}
+	target := netip.AddrFrom16([16]byte(ns[targetOff:]))
+	srcIP := netip.AddrFrom16(src.As16())
+	if target != routerLinkLocal || srcIP.IsUnspecified() {
+		// Not for us, or duplicate address detection of the client's
+		// own address, which must go unanswered.
+		return
+	}
+	t.learnMAC(srcMAC)
+
+	var b []byte
+	b = append(b, byte(header.ICMPv6NeighborAdvert), 0, 0, 0) // type, code, checksum
+	b = append(b, 0xe0, 0, 0, 0)                              // router, solicited and override flags
+	b = append(b, target.AsSlice()...)
+	b = append(b, ndpOptTargetLinkAddr, 1)
+	b = append(b, ourMAC...)
+
+	n, err := t.WriteEthernet(packLayer2IPv6(b, header.ICMPv6ProtocolNumber, ourMAC, srcMAC, routerLinkLocal, srcIP))
+	if tapDebug {
+		t.logf("tap: wrote neighbor advertisement %v, %v", n, err)
+	}
+}
+
+// handleDHCPv6 answers the DHCPv6 message msg from the client at srcMAC and
+// src, handing out its tailnet IPv6 address and our DNS server.
+func (t *tapDevice) handleDHCPv6(srcMAC net.HardwareAddr, src netip.Addr, msg []byte) {
+	if len(msg) < 4 {
+		return
+	}
+	msgType, txID := msg[0], msg[1:4]
+	opts := parseDHCPv6Options(msg[4:])
+	clientID := opts[dhcpv6OptClientID]
+	if sid, ok := opts[dhcpv6OptServerID]; ok && !bytes.Equal(sid, dhcpv6ServerDUID) {
+		// For another server.
+		return
+	}
+	if tapDebug {
+		t.logf("tap: DHCPv6 message type %d", msgType)
+	}
+	ip := t.clientIPv6.Load()
+
+	respType := byte(dhcpv6Reply)
+	var withAddr, rapidCommit bool
+	status := -1 // none
+	switch msgType {
+	case dhcpv6Solicit:
+		if _, rapidCommit = opts[dhcpv6OptRapidCommit]; !rapidCommit {
+			respType = dhcpv6Advertise
+		}
+		withAddr = true
+	case dhcpv6Request, dhcpv6Renew, dhcpv6Rebind:
+		withAddr = true
+	case dhcpv6Confirm:
+		status = dhcpv6StatusSuccess
+		for _, a := range dhcpv6IAAddrs(opts[dhcpv6OptIANA]) {
+			if a != ip {
+				status = dhcpv6StatusNotOnLink
+			}
+		}
+	case dhcpv6Release, dhcpv6Decline:
+		status = dhcpv6StatusSuccess
+	case dhcpv6InformationRequest:
+	default:
+		return
+	}
+	if clientID == nil && msgType != dhcpv6InformationRequest {
+		return // bogus
+	}
+	iana, hasIANA := opts[dhcpv6OptIANA]
+	if withAddr && (!ip.IsValid() || !hasIANA || len(iana) < 4) {
+		if !ip.IsValid() {
+			t.logf("tap: DHCPv6 no client IP")
+		}
+		return
+	}
+
+	resp := append([]byte{respType}, txID...)
+	if clientID != nil {
+		resp = appendDHCPv6Option(resp, dhcpv6OptClientID, clientID)
+	}
+	resp = appendDHCPv6Option(resp, dhcpv6OptServerID, dhcpv6ServerDUID)
+	if rapidCommit {
+		resp = appendDHCPv6Option(resp, dhcpv6OptRapidCommit, nil)
+	}
+	if status >= 0 {
+		resp = appendDHCPv6Option(resp, dhcpv6OptStatusCode, binary.BigEndian.AppendUint16(nil, uint16(status)))
+	}
+	if withAddr {
+		lifetime := uint32(dhcpv6Lifetime / time.Second)
+		addr := ip.AsSlice()
+		addr = binary.BigEndian.AppendUint32(addr, lifetime) // preferred
+		addr = binary.BigEndian.AppendUint32(addr, lifetime) // valid
+		ia := append([]byte(nil), iana[:4]...)               // the client's IAID
+		ia = binary.BigEndian.AppendUint32(ia, lifetime/2)   // T1
+		ia = binary.BigEndian.AppendUint32(ia, lifetime*4/5) // T2
+		ia = appendDHCPv6Option(ia, dhcpv6OptIAAddr, addr)
+		resp = appendDHCPv6Option(resp, dhcpv6OptIANA, ia)
+	}
+	dns := tsaddr.TailscaleServiceIPv6().As16()
+	resp = appendDHCPv6Option(resp, dhcpv6OptDNSServers, dns[:])
+
+	u := make([]byte, header.UDPMinimumSize, header.UDPMinimumSize+len(resp))
+	header.UDP(u).Encode(&header.UDPFields{
+		SrcPort: dhcpv6ServerPort,
+		DstPort: dhcpv6ClientPort,
+		Length:  uint16(header.UDPMinimumSize + len(resp)),
+	})
+	u = append(u, resp...)
+	n, err := t.WriteEthernet(packLayer2IPv6(u, header.UDPProtocolNumber, ourMAC, srcMAC, routerLinkLocal, src))
+	if tapDebug {
+		t.logf("tap: wrote DHCPv6 reply type %d: %v, %v", respType, n, err)
+	}
+}
+
+// parseDHCPv6Options returns the value of the first of each option in b,
+// keyed by option code. Options with no value map to an empty non-nil slice.
+func parseDHCPv6Options(b []byte) map[uint16][]byte {
+	opts := make(map[uint16][]byte)
+	for len(b) >= 4 {
+		code, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			break
+		}
+		if _, dup := opts[code]; !dup {
+			opts[code] = b[4 : 4+n : 4+n]
+		}
+		b = b[4+n:]
+	}
+	return opts
+}
+
+// dhcpv6IAAddrs returns the addresses in the IA_NA option value iana.
+func dhcpv6IAAddrs(iana []byte) []netip.Addr {
+	const ianaHeaderLen = 12 // IAID, T1 and T2
+	if len(iana) < ianaHeaderLen {
+		return nil
+	}
+	var addrs []netip.Addr
+	b := iana[ianaHeaderLen:]
+	for len(b) >= 4 {
+		code, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			break
+		}
+		if code == dhcpv6OptIAAddr && n >= 16 {
+			addrs = append(addrs, netip.AddrFrom16([16]byte(b[4:20])))
+		}
+		b = b[4+n:]
+	}
+	return addrs
+}
+
+// appendDHCPv6Option appends the DHCPv6 option with the given code and
+// value to b.
+func appendDHCPv6Option(b []byte, code uint16, val []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, code)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(val)))
+	return append(b, val...)
+}
+
+// packLayer2IPv6 returns an Ethernet frame from srcMAC to dstMAC of an IPv6
+// packet from src to dst with the ICMPv6 or UDP payload transport, whose
+// checksum it fills in.
+func packLayer2IPv6(transport []byte, proto tcpip.TransportProtocolNumber, srcMAC, dstMAC net.HardwareAddr, src, dst netip.Addr) []byte {
+	buf := make([]byte, header.EthernetMinimumSize+header.IPv6MinimumSize+len(transport))
+	writeEthernetFrame(buf, srcMAC, dstMAC, ipv6.ProtocolNumber)
+	srcIP, dstIP := tcpip.AddrFrom16(src.As16()), tcpip.AddrFrom16(dst.As16())
+	ip := header.IPv6(buf[header.EthernetMinimumSize:])
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength:     uint16(len(transport)),
+		TransportProtocol: proto,
+		HopLimit:          255, // required for NDP
+		SrcAddr:           srcIP,
+		DstAddr:           dstIP,
+	})
+	payload := buf[header.EthernetMinimumSize+header.IPv6MinimumSize:]
+	copy(payload, transport)
+
+	csumOff := 2 // ICMPv6
+	if proto == header.UDPProtocolNumber {
+		csumOff = 6
+	}
+	binary.BigEndian.PutUint16(payload[csumOff:], 0)
+	xsum := header.PseudoHeaderChecksum(proto, srcIP, dstIP, uint16(len(payload)))
+	xsum = ^checksum.Checksum(payload, xsum)
+	if xsum == 0 && proto == header.UDPProtocolNumber {
+		xsum = 0xffff
+	}
+	binary.BigEndian.PutUint16(payload[csumOff:], xsum)
+	return buf
+}
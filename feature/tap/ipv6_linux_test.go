@@ -0,0 +1,174 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tap
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tailscale/wireguard-go/tun"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"tailscale.com/net/tsaddr"
+)
+
+// newTestTAP returns a tapDevice that writes its frames to a pipe, and the
+// read end of that pipe.
+func newTestTAP(t *testing.T) (*tapDevice, *os.File) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	d := &tapDevice{
+		logf:   t.Logf,
+		file:   w,
+		events: make(chan tun.Event),
+		closed: make(chan struct{}),
+		name:   "tap-test",
+	}
+	t.Cleanup(func() { d.Close() })
+	return d, r
+}
+
+// readIPv6Frame reads a frame written by d and returns its IPv6 packet,
+// checking the checksum of its transport.
+func readIPv6Frame(t *testing.T, r *os.File) (dstMAC net.HardwareAddr, ip header.IPv6) {
+	t.Helper()
+	buf := make([]byte, 1500)
+	r.SetReadDeadline(time.Now().Add(10 * time.Second))
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth := header.Ethernet(buf[:n])
+	if eth.Type() != header.IPv6ProtocolNumber {
+		t.Fatalf("got ethertype %v; want IPv6", eth.Type())
+	}
+	ip = header.IPv6(buf[header.EthernetMinimumSize:n])
+	xsum := header.PseudoHeaderChecksum(ip.TransportProtocol(), ip.SourceAddress(), ip.DestinationAddress(), ip.PayloadLength())
+	if got := checksum.Checksum(ip.Payload(), xsum); got != 0xffff {
+		t.Errorf("bad transport checksum")
+	}
+	return net.HardwareAddr(eth.DestinationAddress()), ip
+}
+
+func TestDHCPv6(t *testing.T) {
+	d, r := newTestTAP(t)
+	clientIP := netip.MustParseAddr("fd7a:115c:a1e0::1234")
+	d.clientIPv6.Store(clientIP)
+
+	clientMAC := net.HardwareAddr{0x52, 0x54, 0, 0x12, 0x34, 0x56}
+	clientLL := netip.MustParseAddr("fe80::5054:ff:fe12:3456")
+	clientID := []byte{0, 3, 0, 1, 0x52, 0x54, 0, 0x12, 0x34, 0x56}
+	iaid := []byte{1, 2, 3, 4}
+
+	msg := []byte{dhcpv6Solicit, 0xaa, 0xbb, 0xcc}
+	msg = appendDHCPv6Option(msg, dhcpv6OptClientID, clientID)
+	msg = appendDHCPv6Option(msg, dhcpv6OptIANA, append(slices.Clone(iaid), make([]byte, 8)...))
+	u := make([]byte, header.UDPMinimumSize)
+	header.UDP(u).Encode(&header.UDPFields{
+		SrcPort: dhcpv6ClientPort,
+		DstPort: dhcpv6ServerPort,
+		Length:  uint16(header.UDPMinimumSize + len(msg)),
+	})
+	frame := packLayer2IPv6(append(u, msg...), header.UDPProtocolNumber, clientMAC, net.HardwareAddr{0x33, 0x33, 0, 1, 0, 2}, clientLL, netip.MustParseAddr("ff02::1:2"))
+
+	if !d.handleTAPFrame(frame) {
+		t.Fatal("DHCPv6 solicit passed on to WireGuard")
+	}
+	if got := d.destMAC(); !slices.Equal(got[:], clientMAC) {
+		t.Errorf("learned MAC %v; want %v", net.HardwareAddr(got[:]), clientMAC)
+	}
+
+	dstMAC, ip := readIPv6Frame(t, r)
+	if !slices.Equal(dstMAC, clientMAC) {
+		t.Errorf("reply sent to %v; want %v", dstMAC, clientMAC)
+	}
+	if got, want := ip.SourceAddress(), tcpip.AddrFrom16(routerLinkLocal.As16()); got != want {
+		t.Errorf("reply from %v; want %v", got, want)
+	}
+	if got, want := ip.DestinationAddress(), tcpip.AddrFrom16(clientLL.As16()); got != want {
+		t.Errorf("reply to %v; want %v", got, want)
+	}
+	reply := header.UDP(ip.Payload()).Payload()
+	if reply[0] != dhcpv6Advertise || !slices.Equal(reply[1:4], []byte{0xaa, 0xbb, 0xcc}) {
+		t.Fatalf("reply type %d, transaction %x; want %d, aabbcc", reply[0], reply[1:4], dhcpv6Advertise)
+	}
+	opts := parseDHCPv6Options(reply[4:])
+	if !slices.Equal(opts[dhcpv6OptClientID], clientID) {
+		t.Errorf("client ID %x; want %x", opts[dhcpv6OptClientID], clientID)
+	}
+	if !slices.Equal(opts[dhcpv6OptServerID], dhcpv6ServerDUID) {
+		t.Errorf("server ID %x; want %x", opts[dhcpv6OptServerID], dhcpv6ServerDUID)
+	}
+	iana := opts[dhcpv6OptIANA]
+	if len(iana) < 12 || !slices.Equal(iana[:4], iaid) {
+		t.Fatalf("IA_NA %x; want IAID %x", iana, iaid)
+	}
+	if got := dhcpv6IAAddrs(iana); !slices.Equal(got, []netip.Addr{clientIP}) {
+		t.Errorf("addresses %v; want %v", got, clientIP)
+	}
+	if t1, t2 := binary.BigEndian.Uint32(iana[4:]), binary.BigEndian.Uint32(iana[8:]); t1 == 0 || t2 <= t1 {
+		t.Errorf("T1 %d, T2 %d", t1, t2)
+	}
+	dns := tsaddr.TailscaleServiceIPv6().As16()
+	if !slices.Equal(opts[dhcpv6OptDNSServers], dns[:]) {
+		t.Errorf("DNS servers %x; want %x", opts[dhcpv6OptDNSServers], dns)
+	}
+
+	// Messages for another server are ignored.
+	msg = []byte{dhcpv6Request, 1, 2, 3}
+	msg = appendDHCPv6Option(msg, dhcpv6OptClientID, clientID)
+	msg = appendDHCPv6Option(msg, dhcpv6OptServerID, []byte{0, 3, 0, 1, 1, 2, 3, 4, 5, 6})
+	header.UDP(u).SetLength(uint16(header.UDPMinimumSize + len(msg)))
+	frame = packLayer2IPv6(append(u, msg...), header.UDPProtocolNumber, clientMAC, net.HardwareAddr{0x33, 0x33, 0, 1, 0, 2}, clientLL, netip.MustParseAddr("ff02::1:2"))
+	if !d.handleTAPFrame(frame) {
+		t.Fatal("DHCPv6 request passed on to WireGuard")
+	}
+}
+
+func TestNeighborSolicit(t *testing.T) {
+	d, r := newTestTAP(t)
+	clientMAC := net.HardwareAddr{0x52, 0x54, 0, 0x12, 0x34, 0x56}
+	clientLL := netip.MustParseAddr("fe80::5054:ff:fe12:3456")
+
+	ns := func(src, target netip.Addr) []byte {
+		b := []byte{byte(header.ICMPv6NeighborSolicit), 0, 0, 0, 0, 0, 0, 0}
+		b = append(b, target.AsSlice()...)
+		return packLayer2IPv6(b, header.ICMPv6ProtocolNumber, clientMAC, net.HardwareAddr{0x33, 0x33, 0xff, 0, 0, 1}, src, netip.MustParseAddr("ff02::1:ff00:1"))
+	}
+
+	// Duplicate address detection and solicitations for other addresses
+	// go unanswered, so the first frame written answers the last one.
+	for _, f := range [][]byte{
+		ns(netip.IPv6Unspecified(), clientLL),
+		ns(clientLL, netip.MustParseAddr("fe80::1")),
+		ns(clientLL, routerLinkLocal),
+	} {
+		if !d.handleTAPFrame(f) {
+			t.Fatal("neighbor solicitation passed on to WireGuard")
+		}
+	}
+	dstMAC, ip := readIPv6Frame(t, r)
+	if !slices.Equal(dstMAC, clientMAC) {
+		t.Errorf("advertisement sent to %v; want %v", dstMAC, clientMAC)
+	}
+	na := ip.Payload()
+	if header.ICMPv6(na).Type() != header.ICMPv6NeighborAdvert {
+		t.Fatalf("got ICMPv6 type %v; want neighbor advertisement", header.ICMPv6(na).Type())
+	}
+	if got := netip.AddrFrom16([16]byte(na[8:24])); got != routerLinkLocal {
+		t.Errorf("advertised %v; want %v", got, routerLinkLocal)
+	}
+	if !slices.Equal(na[26:32], ourMAC) {
+		t.Errorf("advertised MAC %x; want %v", na[26:32], ourMAC)
+	}
+}
@@ -6,6 +6,7 @@
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
@@ -122,11 +123,7 @@ func (t *tapDevice) handleTAPFrame(ethBuf []byte) bool {
 		}
 		return consumePacket // filter out packet we should ignore
 	case etherTypeIPv6:
-		// TODO: support DHCPv6/ND/etc later. For now pass all to WireGuard.
-		if tapDebug {
-			t.logf("tap: ignoring IPv6 %v", et)
-		}
-		return passOnPacket
+		return t.handleIPv6(ethBuf)
 	case etherTypeIPv4:
 		if len(ethBuf) < ethernetFrameSize+ipv4HeaderLen {
 			// Bogus IPv4. Eat.
@@ -148,11 +145,7 @@ func (t *tapDevice) handleTAPFrame(ethBuf []byte) bool {
 			buf := make([]byte, header.EthernetMinimumSize+header.ARPSize)
 
 			// Our ARP "Table" of one:
-			var srcMAC [6]byte
-			copy(srcMAC[:], ethSrcMAC)
-			if old := t.destMAC(); old != srcMAC {
-				t.destMACAtomic.Store(srcMAC)
-			}
+			t.learnMAC(ethSrcMAC)
 
 			eth := header.Ethernet(buf)
 			eth.Encode(&header.EthernetFields{
@@ -166,7 +159,7 @@ func (t *tapDevice) handleTAPFrame(ethBuf []byte) bool {
 
 			// If the client's asking about their own IP, tell them it's
 			// their own MAC. TODO(bradfitz): remove String allocs.
-			if net.IP(req.ProtocolAddressTarget()).String() == t.clientIPv4.Load() {
+			if target, _ := netip.AddrFromSlice(req.ProtocolAddressTarget()); target == t.clientIPv4.Load() {
 				copy(res.HardwareAddressSender(), ethSrcMAC)
 			} else {
 				copy(res.HardwareAddressSender(), ourMAC[:])
@@ -211,10 +204,10 @@ func (t *tapDevice) handleDHCPRequest(ethBuf []byte) bool {
 	}
 	ethDstMAC, ethSrcMAC := ethBuf[:6], ethBuf[6:12]
 
-	if string(ethDstMAC) != "\xff\xff\xff\xff\xff\xff" {
-		// Not a broadcast
+	if string(ethDstMAC) != "\xff\xff\xff\xff\xff\xff" && !bytes.Equal(ethDstMAC, ourMAC) {
+		// Neither a broadcast nor a renewal sent to us.
 		if tapDebug {
-			t.logf("tap: dhcp no broadcast")
+			t.logf("tap: dhcp not for us")
 		}
 		return passOnPacket
 	}
@@ -242,80 +235,87 @@ func (t *tapDevice) handleDHCPRequest(ethBuf []byte) bool {
 	if tapDebug {
 		t.logf("tap: DHCP request: %+v", dp)
 	}
+	var (
+		ip        netip.Addr // assigned to the client, or invalid for none
+		replyType dhcpv4.MessageType
+	)
 	switch dp.MessageType() {
 	case dhcpv4.MessageTypeDiscover:
-		ips := t.clientIPv4.Load()
-		if ips == "" {
-			t.logf("tap: DHCP no client IP")
-			return consumePacket
+		replyType = dhcpv4.MessageTypeOffer
+		ip = t.clientIPv4.Load()
+	case dhcpv4.MessageTypeRequest:
+		replyType = dhcpv4.MessageTypeAck
+		ip = t.clientIPv4.Load()
+		// The client asks for the address of its lease in an option
+		// when selecting or rebooting, and in ciaddr when renewing.
+		want, _ := netip.AddrFromSlice(dp.RequestedIPAddress().To4())
+		if !want.IsValid() {
+			want, _ = netip.AddrFromSlice(dp.ClientIPAddr.To4())
 		}
-		offer, err := dhcpv4.New(
-			dhcpv4.WithReply(dp),
-			dhcpv4.WithMessageType(dhcpv4.MessageTypeOffer),
-			dhcpv4.WithRouter(routerIP), // the default route
-			dhcpv4.WithDNS(routerIP),
-			dhcpv4.WithServerIP(routerIP), // TODO: what is this?
-			dhcpv4.WithOption(dhcpv4.OptServerIdentifier(routerIP)),
-			dhcpv4.WithYourIP(net.ParseIP(ips)),
-			dhcpv4.WithLeaseTime(3600), // hour works
-			//dhcpv4.WithHwAddr(ethSrcMAC),
-			dhcpv4.WithNetmask(cgnatNetMask),
-			//dhcpv4.WithTransactionID(dp.TransactionID),
-		)
-		if err != nil {
-			t.logf("error building DHCP offer: %v", err)
+		if ip.IsValid() && want.IsValid() && !want.IsUnspecified() && want != ip {
+			// Its lease is stale, such as if our tailnet IP changed.
+			// Tell it to start over, to get the current one.
+			t.writeDHCPReply(dp, ethSrcMAC, dhcpv4.MessageTypeNak)
 			return consumePacket
 		}
-		// Make a layer 2 packet to write out:
-		pkt := packLayer2UDP(
-			offer.ToBytes(),
-			ourMAC, ethSrcMAC,
-			netip.AddrPortFrom(netaddr.IPv4(100, 100, 100, 100), 67), // src
-			netip.AddrPortFrom(netaddr.IPv4(255, 255, 255, 255), 68), // dst
-		)
-
-		n, err := t.WriteEthernet(pkt)
+	case dhcpv4.MessageTypeInform:
+		// The client has an address and only wants options.
+		t.writeDHCPReply(dp, ethSrcMAC, dhcpv4.MessageTypeAck)
+		return consumePacket
+	default:
 		if tapDebug {
-			t.logf("tap: wrote DHCP OFFER %v, %v", n, err)
+			t.logf("tap: unhandled DHCP type %v", dp.MessageType())
 		}
-	case dhcpv4.MessageTypeRequest:
-		ips := t.clientIPv4.Load()
-		if ips == "" {
-			t.logf("tap: DHCP no client IP")
-			return consumePacket
-		}
-		ack, err := dhcpv4.New(
-			dhcpv4.WithReply(dp),
-			dhcpv4.WithMessageType(dhcpv4.MessageTypeAck),
+		return consumePacket
+	}
+	if !ip.IsValid() {
+		t.logf("tap: DHCP no client IP")
+		return consumePacket
+	}
+	t.writeDHCPReply(dp, ethSrcMAC, replyType,
+		dhcpv4.WithYourIP(ip.AsSlice()),
+		dhcpv4.WithLeaseTime(3600), // hour works
+		dhcpv4.WithNetmask(cgnatNetMask),
+	)
+	return consumePacket
+}
+
+// writeDHCPReply writes a DHCP reply of type msgType to the request dp from
+// dstMAC. Replies other than NAKs carry our network configuration options as
+// well as mods.
+func (t *tapDevice) writeDHCPReply(dp *dhcpv4.DHCPv4, dstMAC net.HardwareAddr, msgType dhcpv4.MessageType, mods ...dhcpv4.Modifier) {
+	opts := []dhcpv4.Modifier{
+		dhcpv4.WithReply(dp),
+		dhcpv4.WithMessageType(msgType),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(routerIP)),
+	}
+	if msgType != dhcpv4.MessageTypeNak {
+		opts = append(opts,
+			dhcpv4.WithRouter(routerIP), // the default route
 			dhcpv4.WithDNS(routerIP),
-			dhcpv4.WithRouter(routerIP),   // the default route
 			dhcpv4.WithServerIP(routerIP), // TODO: what is this?
-			dhcpv4.WithOption(dhcpv4.OptServerIdentifier(routerIP)),
-			dhcpv4.WithYourIP(net.ParseIP(ips)), // Hello world
-			dhcpv4.WithLeaseTime(3600),          // hour works
-			dhcpv4.WithNetmask(cgnatNetMask),
 		)
-		if err != nil {
-			t.logf("error building DHCP ack: %v", err)
-			return consumePacket
-		}
-		// Make a layer 2 packet to write out:
-		pkt := packLayer2UDP(
-			ack.ToBytes(),
-			ourMAC, ethSrcMAC,
-			netip.AddrPortFrom(netaddr.IPv4(100, 100, 100, 100), 67), // src
-			netip.AddrPortFrom(netaddr.IPv4(255, 255, 255, 255), 68), // dst
-		)
-		n, err := t.WriteEthernet(pkt)
-		if tapDebug {
-			t.logf("tap: wrote DHCP ACK %v, %v", n, err)
-		}
-	default:
-		if tapDebug {
-			t.logf("tap: unknown DHCP type")
+		if mtu, err := t.MTU(); err == nil && mtu >= 576 {
+			opts = append(opts, dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionInterfaceMTU, binary.BigEndian.AppendUint16(nil, uint16(mtu)))))
 		}
+		opts = append(opts, mods...)
+	}
+	reply, err := dhcpv4.New(opts...)
+	if err != nil {
+		t.logf("error building DHCP %v: %v", msgType, err)
+		return
+	}
+	// Make a layer 2 packet to write out:
+	pkt := packLayer2UDP(
+		reply.ToBytes(),
+		ourMAC, dstMAC,
+		netip.AddrPortFrom(netaddr.IPv4(100, 100, 100, 100), 67), // src
+		netip.AddrPortFrom(netaddr.IPv4(255, 255, 255, 255), 68), // dst
+	)
+	n, err := t.WriteEthernet(pkt)
+	if tapDebug {
+		t.logf("tap: wrote DHCP %v %v, %v", msgType, n, err)
 	}
-	return consumePacket
 }
 
 func writeEthernetFrame(buf []byte, srcMAC, dstMAC net.HardwareAddr, proto tcpip.NetworkProtocolNumber) {
@@ -378,6 +378,16 @@ func (t *tapDevice) destMAC() [6]byte {
 	return t.destMACAtomic.Load()
 }
 
+// learnMAC records mac as the client's, to which IP packets from the
+// tailnet are sent.
+func (t *tapDevice) learnMAC(mac net.HardwareAddr) {
+	var m [6]byte
+	copy(m[:], mac)
+	if old := t.destMAC(); old != m {
+		t.destMACAtomic.Store(m)
+	}
+}
+
 func newTAPDevice(logf logger.Logf, fd int, tapName string) (tun.Device, error) {
 	err := unix.SetNonblock(fd, true)
 	if err != nil {
@@ -388,8 +398,10 @@ func newTAPDevice(logf logger.Logf, fd int, tapName string) (tun.Device, error)
 		logf:   logf,
 		file:   file,
 		events: make(chan tun.Event),
+		closed: make(chan struct{}),
 		name:   tapName,
 	}
+	go d.raLoop()
 	return d, nil
 }
 
@@ -398,16 +410,22 @@ type tapDevice struct {
 	logf       func(format string, args ...any)
 	events     chan tun.Event
 	name       string
+	closed     chan struct{} // closed by Close
 	closeOnce  sync.Once
-	clientIPv4 syncs.AtomicValue[string]
+	clientIPv4 syncs.AtomicValue[netip.Addr]
+	clientIPv6 syncs.AtomicValue[netip.Addr]
 
 	destMACAtomic syncs.AtomicValue[[6]byte]
 }
 
 var _ tstun.SetIPer = (*tapDevice)(nil)
 
-func (t *tapDevice) SetIP(ipV4, ipV6TODO netip.Addr) error {
-	t.clientIPv4.Store(ipV4.String())
+func (t *tapDevice) SetIP(ipV4, ipV6 netip.Addr) error {
+	t.clientIPv4.Store(ipV4)
+	if old := t.clientIPv6.Swap(ipV6); old != ipV6 {
+		// Let the client know it can get an IPv6 address now.
+		t.sendRouterAdvert()
+	}
 	return nil
 }
 
@@ -503,6 +521,7 @@ func (t *tapDevice) Events() <-chan tun.Event {
 func (t *tapDevice) Close() error {
 	var err error
 	t.closeOnce.Do(func() {
+		close(t.closed)
 		close(t.events)
 		err = t.file.Close()
 	})
@@ -15,4 +15,5 @@ func init() {
 	feature.HookProxyGetAuthHeader.Set(tshttpproxy.GetAuthHeader)
 	feature.HookProxySetSelfProxy.Set(tshttpproxy.SetSelfProxy)
 	feature.HookProxySetTransportGetProxyConnectHeader.Set(tshttpproxy.SetTransportGetProxyConnectHeader)
+	feature.HookProxyConnect.Set(tshttpproxy.Connect)
 }
@@ -3,6 +3,8 @@
 
 package health
 
+import "tailscale.com/net/neterror"
+
 // Arg is a type for the key to be used in the Args of a Warnable.
 type Arg string
 
@@ -19,6 +21,10 @@
 	// ArgError provides a Warnable with the underlying error behind an unhealthy state.
 	ArgError Arg = "error"
 
+	// ArgErrorCode provides a Warnable with the stable [neterror.Code] classifying
+	// the error in ArgError, if it is a known class of network failure.
+	ArgErrorCode Arg = "error-code"
+
 	// ArgMagicsockFunctionName provides a Warnable with the name of the Magicsock function that caused the unhealthy state.
 	ArgMagicsockFunctionName Arg = "magicsock-function-name"
 
@@ -36,4 +42,29 @@
 	// ArgServerName provides a Warnable with comma delimited list of the hostname of the servers involved in the unhealthy state.
 	// If no nameservers were available to query, this will be an empty string.
 	ArgDNSServers Arg = "dns-servers"
+
+	// ArgKeyExpiry provides a Warnable with the time, in RFC 3339 format, at which this node's key expires.
+	ArgKeyExpiry Arg = "key-expiry"
+
+	// ArgMessage provides a Warnable with text configured by an administrator, to show instead of its default text.
+	ArgMessage Arg = "message"
+
+	// ArgFunnelTargets provides a Warnable with a comma delimited list of the SNI names and ports of the Funnel targets involved in the unhealthy state.
+	ArgFunnelTargets Arg = "funnel-targets"
 )
+
+// ErrorArgs returns Args describing err, for use with [Tracker.SetUnhealthy].
+//
+// ArgError is set to the text of err. If err is a known class of network
+// failure, ArgErrorCode is also set so that the warning carries a stable code
+// and remediation text rather than just a raw, platform-specific error string.
+func ErrorArgs(err error) Args {
+	if err == nil {
+		return nil
+	}
+	args := Args{ArgError: err.Error()}
+	if code := neterror.Classify(err); code != "" {
+		args[ArgErrorCode] = string(code)
+	}
+	return args
+}
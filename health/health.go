@@ -20,6 +20,7 @@
 
 	"tailscale.com/envknob"
 	"tailscale.com/feature/buildfeatures"
+	"tailscale.com/net/neterror"
 	"tailscale.com/syncs"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tstime"
@@ -215,15 +216,13 @@ func init() {
 			Code:     WarnableCode(s),
 			Severity: SeverityMedium,
 			Text: func(args Args) string {
-				return args[legacyErrorArgKey]
+				return args[ArgError]
 			},
 		})
 		subsystemsWarnables[s] = w
 	}
 }
 
-const legacyErrorArgKey = "LegacyError"
-
 // Warnable returns a Warnable representing a legacy Subsystem. This is used
 // temporarily (2024-06-14) while we migrate the old health infrastructure based
 // on Subsystems to the new Warnables architecture.
@@ -687,7 +686,7 @@ func (t *Tracker) setLocked(key Subsystem, err error) {
 func (t *Tracker) updateLegacyErrorWarnableLocked(key Subsystem, err error) {
 	w := key.Warnable()
 	if err != nil {
-		t.setUnhealthyLocked(key.Warnable(), Args{legacyErrorArgKey: err.Error()})
+		t.setUnhealthyLocked(w, ErrorArgs(err))
 	} else {
 		t.setHealthyLocked(w)
 	}
@@ -1016,6 +1015,7 @@ func (t *Tracker) stringsLocked() []string {
 		return nil
 	}
 	result := []string{}
+	suppressed := t.suppressedWarnablesLocked()
 	for w, ws := range t.warnableVal {
 		if !w.IsVisible(ws, t.now) {
 			// Do not append invisible warnings.
@@ -1024,11 +1024,23 @@ func (t *Tracker) stringsLocked() []string {
 		if t.isEffectivelyHealthyLocked(w) {
 			continue
 		}
+		var text string
 		if ws.Args == nil {
-			result = append(result, w.Text(Args{}))
+			text = w.Text(Args{})
 		} else {
-			result = append(result, w.Text(ws.Args))
+			text = w.Text(ws.Args)
+		}
+		if code := neterror.Code(ws.Args[ArgErrorCode]); code.Remediation() != "" {
+			text = fmt.Sprintf("%s %s [%s]", text, code.Remediation(), code)
+		}
+		switch n := len(suppressed[w]); n {
+		case 0:
+		case 1:
+			text += " (1 related warning hidden)"
+		default:
+			text += fmt.Sprintf(" (%d related warnings hidden)", n)
 		}
+		result = append(result, text)
 	}
 
 	warnLen := len(result)
@@ -1105,9 +1117,7 @@ func (t *Tracker) updateBuiltinWarnablesLocked() {
 	t.updateIPForwardingWarnableLocked()
 
 	if t.localLogConfigErr != nil {
-		t.setUnhealthyLocked(localLogWarnable, Args{
-			ArgError: t.localLogConfigErr.Error(),
-		})
+		t.setUnhealthyLocked(localLogWarnable, ErrorArgs(t.localLogConfigErr))
 	} else {
 		t.setHealthyLocked(localLogWarnable)
 	}
@@ -1168,13 +1178,11 @@ func (t *Tracker) updateBuiltinWarnablesLocked() {
 	}
 
 	if t.lastLoginErr != nil {
-		var errMsg string
+		args := Args{ArgError: ""}
 		if !errors.Is(t.lastLoginErr, context.Canceled) {
-			errMsg = t.lastLoginErr.Error()
+			args = ErrorArgs(t.lastLoginErr)
 		}
-		t.setUnhealthyLocked(LoginStateWarnable, Args{
-			ArgError: errMsg,
-		})
+		t.setUnhealthyLocked(LoginStateWarnable, args)
 		return
 	} else {
 		t.setHealthyLocked(LoginStateWarnable)
@@ -1249,10 +1257,9 @@ func (t *Tracker) updateBuiltinWarnablesLocked() {
 
 	if len(t.tlsConnectionErrors) > 0 {
 		for serverName, err := range t.tlsConnectionErrors {
-			t.setUnhealthyLocked(tlsConnectionFailedWarnable, Args{
-				ArgServerName: serverName,
-				ArgError:      err.Error(),
-			})
+			args := ErrorArgs(err)
+			args[ArgServerName] = serverName
+			t.setUnhealthyLocked(tlsConnectionFailedWarnable, args)
 		}
 	} else {
 		t.setHealthyLocked(tlsConnectionFailedWarnable)
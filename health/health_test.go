@@ -378,6 +378,56 @@ func TestCheckDependsOnAppearsInUnhealthyState(t *testing.T) {
 	}
 }
 
+// TestSuppressedWarnablesCollapseUnderRootCause asserts that unhealthy
+// Warnables hidden by an unhealthy dependency are listed, transitively, under
+// the root cause that's reported.
+func TestSuppressedWarnablesCollapseUnderRootCause(t *testing.T) {
+	ht := NewTracker(eventbustest.NewBus(t))
+	root := Register(&Warnable{
+		Code: "root",
+		Text: StaticMessage("root is broken"),
+	})
+	defer unregister(root)
+	mid := Register(&Warnable{
+		Code:      "mid",
+		Text:      StaticMessage("mid is broken"),
+		DependsOn: []*Warnable{root},
+	})
+	defer unregister(mid)
+	leaf := Register(&Warnable{
+		Code:      "leaf",
+		Text:      StaticMessage("leaf is broken"),
+		DependsOn: []*Warnable{mid},
+	})
+	defer unregister(leaf)
+
+	ht.SetUnhealthy(root, nil)
+	ht.SetUnhealthy(mid, nil)
+	ht.SetUnhealthy(leaf, nil)
+
+	warnings := ht.CurrentState().Warnings
+	if len(warnings) != 1 {
+		t.Fatalf("got %d warnings; want only the root cause: %v", len(warnings), warnings)
+	}
+	want := []WarnableCode{"leaf", "mid"}
+	if got := warnings[root.Code].Suppressed; !reflect.DeepEqual(got, want) {
+		t.Errorf("Suppressed = %v; want %v", got, want)
+	}
+	wantStrs := []string{"root is broken (2 related warnings hidden)"}
+	if got := ht.Strings(); !reflect.DeepEqual(got, wantStrs) {
+		t.Errorf("Strings() = %q; want %q", got, wantStrs)
+	}
+
+	ht.SetHealthy(root)
+	warnings = ht.CurrentState().Warnings
+	if got, want := warnings[mid.Code].Suppressed, []WarnableCode{"leaf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after root healthy, mid Suppressed = %v; want %v", got, want)
+	}
+	if _, ok := warnings[root.Code]; ok {
+		t.Error("root still reported after SetHealthy")
+	}
+}
+
 func TestShowUpdateWarnable(t *testing.T) {
 	tests := []struct {
 		desc         string
@@ -7,9 +7,11 @@
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"slices"
 	"time"
 
 	"tailscale.com/feature/buildfeatures"
+	"tailscale.com/net/neterror"
 	"tailscale.com/tailcfg"
 	"tailscale.com/util/mak"
 )
@@ -44,6 +46,19 @@ type UnhealthyState struct {
 	ImpactsConnectivity bool                  `json:",omitempty"`
 	PrimaryAction       *UnhealthyStateAction `json:",omitempty"`
 
+	// Suppressed lists the codes of other unhealthy Warnables that aren't
+	// reported because they depend, directly or transitively, on this one.
+	// UIs can use it to show them collapsed under this root cause, or just
+	// their count. It's sorted and empty if nothing was suppressed.
+	Suppressed []WarnableCode `json:",omitempty"`
+
+	// ErrorCode is the stable [neterror.Code] classifying the error behind
+	// this unhealthy state, if it is a known class of network failure.
+	ErrorCode neterror.Code `json:",omitempty"`
+	// Remediation is human-readable text describing what the user can do
+	// about ErrorCode. It is empty if ErrorCode is.
+	Remediation string `json:",omitempty"`
+
 	// ETag identifies a specific version of an UnhealthyState. If the contents
 	// of the other fields of two UnhealthyStates are the same, the ETags will
 	// be the same. If the contents differ, the ETags will also differ. The
@@ -104,6 +119,7 @@ func (w *Warnable) unhealthyState(ws *warningState) *UnhealthyState {
 		dependsOnWarnableCodes = append(dependsOnWarnableCodes, warmingUpWarnable.Code)
 	}
 
+	errCode := neterror.Code(ws.Args[ArgErrorCode])
 	return &UnhealthyState{
 		WarnableCode:        w.Code,
 		Severity:            w.Severity,
@@ -113,6 +129,8 @@ func (w *Warnable) unhealthyState(ws *warningState) *UnhealthyState {
 		Args:                ws.Args,
 		DependsOn:           dependsOnWarnableCodes,
 		ImpactsConnectivity: w.ImpactsConnectivity,
+		ErrorCode:           errCode,
+		Remediation:         errCode.Remediation(),
 	}
 }
 
@@ -131,6 +149,7 @@ func (t *Tracker) CurrentState() *State {
 
 	var wm map[WarnableCode]UnhealthyState
 
+	suppressed := t.suppressedWarnablesLocked()
 	for w, ws := range t.warnableVal {
 		if !w.IsVisible(ws, t.now) {
 			// Skip invisible Warnables.
@@ -142,6 +161,10 @@ func (t *Tracker) CurrentState() *State {
 			continue
 		}
 		state := w.unhealthyState(ws)
+		for _, sw := range suppressed[w] {
+			state.Suppressed = append(state.Suppressed, sw.Code)
+		}
+		slices.Sort(state.Suppressed)
 		mak.Set(&wm, w.Code, state.withETag())
 	}
 
@@ -185,13 +208,16 @@ func severityFromTailcfg(s tailcfg.DisplayMessageSeverity) Severity {
 // That means it's either actually healthy or it has a dependency that
 // that's unhealthy, so we should treat w as healthy to not spam users
 // with multiple warnings when only the root cause is relevant.
+// A dependency that's itself effectively healthy because of its own
+// unhealthy dependencies still counts, so that a chain of warnings
+// collapses under the one at its root.
 func (t *Tracker) isEffectivelyHealthyLocked(w *Warnable) bool {
 	if _, ok := t.warnableVal[w]; !ok {
 		// Warnable not found in the tracker. So healthy.
 		return true
 	}
 	for _, d := range w.DependsOn {
-		if !t.isEffectivelyHealthyLocked(d) {
+		if _, ok := t.warnableVal[d]; ok {
 			// If one of our deps is unhealthy, we're healthy.
 			return true
 		}
@@ -200,3 +226,39 @@ func (t *Tracker) isEffectivelyHealthyLocked(w *Warnable) bool {
 	// we're unhealthy.
 	return false
 }
+
+// suppressedWarnablesLocked returns the visible, unhealthy Warnables that
+// aren't reported because of an unhealthy dependency, keyed by the reported
+// root causes they depend on. A Warnable with several unhealthy dependencies
+// is listed under each of them.
+func (t *Tracker) suppressedWarnablesLocked() map[*Warnable][]*Warnable {
+	var m map[*Warnable][]*Warnable
+	for w, ws := range t.warnableVal {
+		if !w.IsVisible(ws, t.now) || !t.isEffectivelyHealthyLocked(w) {
+			continue
+		}
+		for _, root := range t.rootCausesLocked(w, nil) {
+			if root.IsVisible(t.warnableVal[root], t.now) {
+				mak.Set(&m, root, append(m[root], w))
+			}
+		}
+	}
+	return m
+}
+
+// rootCausesLocked appends to dst the unhealthy Warnables that w depends on,
+// directly or transitively, that are not themselves suppressed by an unhealthy
+// dependency, and returns the extended slice.
+func (t *Tracker) rootCausesLocked(w *Warnable, dst []*Warnable) []*Warnable {
+	for _, d := range w.DependsOn {
+		if _, ok := t.warnableVal[d]; !ok {
+			continue // healthy
+		}
+		if t.isEffectivelyHealthyLocked(d) {
+			dst = t.rootCausesLocked(d, dst)
+		} else if !slices.Contains(dst, d) {
+			dst = append(dst, d)
+		}
+	}
+	return dst
+}
@@ -272,6 +272,10 @@ type OutgoingFile struct {
 	Sent         int64                // bytes copied thus far
 	Finished     bool                 // indicates whether or not the transfer finished
 	Succeeded    bool                 // for a finished transfer, indicates whether or not it was successful
+
+	// LocalUser is the username of the local user sending the file, if
+	// known. It's not sent to LocalAPI clients.
+	LocalUser string `json:"-"`
 }
 
 // StateKey is an opaque identifier for a set of LocalBackend state
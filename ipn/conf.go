@@ -9,6 +9,7 @@
 	"net/netip"
 
 	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
 	"tailscale.com/types/opt"
 	"tailscale.com/types/preftype"
 )
@@ -52,10 +53,78 @@ type ConfigVAlpha struct {
 	// should advertise amongst its wireguard endpoints.
 	StaticEndpoints []netip.AddrPort `json:",omitempty"`
 
+	// EndpointPolicy are rules restricting which paths this node may use to
+	// reach its peers, such as to never use direct connections over a
+	// corporate LAN. They're enforced along with any rules from the
+	// control plane.
+	EndpointPolicy []tailcfg.EndpointPolicyRule `json:",omitempty"`
+
+	// KeepWarmPeers are peers, each a Tailscale IP, StableID, or MagicDNS
+	// name, whose connections to keep warm. See Prefs.KeepWarmPeers.
+	KeepWarmPeers []string `json:",omitempty"`
+
+	// Profile is the name or ID of the login profile to use at startup,
+	// instead of the last used one. It's only consulted when tailscaled
+	// starts, not when the config is reloaded.
+	Profile *string `json:",omitempty"`
+
+	// BootstrapDNS are servers, each of the form "hostname=ip", to query for
+	// bootstrap DNS before the DERP servers, for networks where those can't
+	// be reached. They're used along with any from the BootstrapDNSServers
+	// policy. It's only consulted when tailscaled starts, not when the
+	// config is reloaded.
+	BootstrapDNS []string `json:",omitempty"`
+
+	// VRF, if non-nil, places tailscaled's traffic in Linux VRFs. It's only
+	// consulted when tailscaled starts, not when the config is reloaded.
+	VRF *VRFConfig `json:",omitempty"`
+
+	// DNSOptions are resolver options for the DNS configuration that
+	// Tailscale manages, if AcceptDNS. The DNSNdots, DNSTimeout,
+	// DNSAttempts, and DNSSearchOrder policies take precedence over them.
+	DNSOptions *DNSOptions `json:",omitempty"`
+
 	// TODO(bradfitz,maisem): future something like:
 	// Profile map[string]*Config // keyed by alice@gmail.com, corp.com (TailnetSID)
 }
 
+// VRFConfig is the Linux VRF (virtual routing and forwarding) configuration
+// of tailscaled, for routers whose management and data planes are separated
+// into different VRFs.
+type VRFConfig struct {
+	// Physical is the name of the VRF device that tailscaled's own sockets,
+	// to the control plane, DERP servers, and peers, are bound to. Empty
+	// means the default VRF.
+	Physical string `json:",omitempty"`
+
+	// TUN is the name of the VRF device to enslave the TUN interface to,
+	// putting Tailscale's routes in its routing table. Empty means the
+	// default VRF. It must differ from Physical.
+	TUN string `json:",omitempty"`
+}
+
+// DNSOptions are resolv.conf(5)-style resolver options. Each is left to the
+// default if zero.
+type DNSOptions struct {
+	// Ndots is the number of dots a name must have to be tried as an
+	// absolute name before the search domains are appended to it, such as
+	// to stop names with a dot or two being tried with Kubernetes' search
+	// domains first.
+	Ndots int `json:",omitzero"`
+
+	// Timeout is how long to wait for a nameserver to respond before
+	// retrying, such as "2s".
+	Timeout tstime.GoDuration `json:",omitzero"`
+
+	// Attempts is how many times to query each nameserver before giving up
+	// on it.
+	Attempts int `json:",omitzero"`
+
+	// SearchOrder is "tailscale-first" (the default) to try Tailscale's
+	// search domains before the OS's others, or "os-first" for the reverse.
+	SearchOrder string `json:",omitzero"`
+}
+
 func (c *ConfigVAlpha) ToPrefs() (MaskedPrefs, error) {
 	var mp MaskedPrefs
 	if c == nil {
@@ -115,6 +184,10 @@ func (c *ConfigVAlpha) ToPrefs() (MaskedPrefs, error) {
 		mp.AdvertiseRoutes = c.AdvertiseRoutes
 		mp.AdvertiseRoutesSet = true
 	}
+	if c.KeepWarmPeers != nil {
+		mp.KeepWarmPeers = c.KeepWarmPeers
+		mp.KeepWarmPeersSet = true
+	}
 	if c.DisableSNAT != "" {
 		mp.NoSNAT = c.DisableSNAT.EqualBool(true)
 		mp.NoSNATSet = true
@@ -23,6 +23,10 @@ type Config struct {
 	Std     []byte // standardized JSON form
 	Version string // "alpha0" for now
 
+	// Included are the paths of the config files that this one included,
+	// directly or indirectly, in the order they were read.
+	Included []string
+
 	// Parsed is the parsed config, converted from its on-disk version to the
 	// latest known format.
 	//
@@ -45,6 +49,10 @@ func (c *Config) WantRunning() bool {
 var hujsonStandardize func([]byte) ([]byte, error)
 
 // Load reads and parses the config file at the provided path on disk.
+//
+// The config file may include other config files with an "Include" key, and
+// may reference environment variables in its string values as "${NAME}".
+// See [resolveConfig] for details.
 func Load(path string) (*Config, error) {
 	switch runtime.GOOS {
 	case "ios", "android":
@@ -64,33 +72,26 @@ func Load(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	if buildfeatures.HasHuJSONConf && hujsonStandardize != nil {
-		c.Std, err = hujsonStandardize(c.Raw)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing config file %s HuJSON/JSON: %w", path, err)
-		}
-	} else {
-		c.Std = c.Raw // config file must be valid JSON with ts_omit_hujsonconf
-	}
-	var ver struct {
-		Version string `json:"version"`
+	c.Std, err = standardize(c.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s HuJSON/JSON: %w", path, err)
 	}
-	if err := json.Unmarshal(c.Std, &ver); err != nil {
-		if !buildfeatures.HasHuJSONConf {
-			return nil, fmt.Errorf("error parsing config file %s, which must be valid standard JSON: %w", path, err)
-		}
+	ver, err := parseVersion(c.Std)
+	if err != nil {
 		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
 	}
-	switch ver.Version {
-	case "":
+	if ver == "" {
 		return nil, fmt.Errorf("error parsing config file %s: no \"version\" field defined", path)
-	case "alpha0":
-	default:
-		return nil, fmt.Errorf("error parsing config file %s: unsupported \"version\" value %q; want \"alpha0\" for now", path, ver.Version)
 	}
-	c.Version = ver.Version
+	c.Version = ver
+
+	resolved, included, err := resolveConfig(path, c.Std)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	c.Included = included
 
-	jd := json.NewDecoder(bytes.NewReader(c.Std))
+	jd := json.NewDecoder(bytes.NewReader(resolved))
 	jd.DisallowUnknownFields()
 	err = jd.Decode(&c.Parsed)
 	if err != nil {
@@ -101,3 +102,31 @@ func Load(path string) (*Config, error) {
 	}
 	return &c, nil
 }
+
+// standardize returns the standard JSON form of the config file raw.
+func standardize(raw []byte) ([]byte, error) {
+	if buildfeatures.HasHuJSONConf && hujsonStandardize != nil {
+		return hujsonStandardize(raw)
+	}
+	return raw, nil // config file must be valid JSON with ts_omit_hujsonconf
+}
+
+// parseVersion returns the "version" field of the standardized config file
+// std, which is empty if it has none. It returns an error if the version is
+// set but unsupported.
+func parseVersion(std []byte) (string, error) {
+	var ver struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(std, &ver); err != nil {
+		if !buildfeatures.HasHuJSONConf {
+			return "", fmt.Errorf("must be valid standard JSON: %w", err)
+		}
+		return "", err
+	}
+	switch ver.Version {
+	case "", "alpha0":
+		return ver.Version, nil
+	}
+	return "", fmt.Errorf("unsupported \"version\" value %q; want \"alpha0\" for now", ver.Version)
+}
@@ -0,0 +1,263 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package conffile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxIncludeDepth is how deeply config files may include each other.
+const maxIncludeDepth = 8
+
+// includeKey is the top-level config file key naming other config files to
+// include. It's handled here while loading and isn't part of
+// [ipn.ConfigVAlpha].
+const includeKey = "Include"
+
+// resolver applies "Include" directives and ${ENV_VAR} substitution to a
+// config file.
+type resolver struct {
+	stack    []string // absolute paths of the files being included, outermost first
+	included []string // paths of all files included, in the order read
+}
+
+// resolveConfig returns the standardized JSON std of the config file at path
+// with its includes merged in and environment variables substituted, along
+// with the paths of the files it included, directly or indirectly.
+//
+// The "Include" key is a list of paths of other config files, relative to
+// the directory of the file that includes them. Their settings are merged in
+// order, with later files overriding earlier ones and the including file
+// overriding them all. Objects are merged key by key; other values, including
+// lists, are replaced wholesale.
+//
+// After merging, each "${NAME}" in a string value is replaced by the value of
+// the environment variable NAME, which must be set. "$${" is a literal "${".
+func resolveConfig(path string, std []byte) (_ []byte, included []string, err error) {
+	var r resolver
+	m, err := r.load(path, std)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := expandEnv(m); err != nil {
+		return nil, nil, err
+	}
+	j, err := json.Marshal(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	return j, r.included, nil
+}
+
+// load returns the config file at path, whose standardized JSON is std,
+// with its includes merged in.
+func (r *resolver) load(path string, std []byte) (map[string]any, error) {
+	m, err := decodeObject(std)
+	if err != nil {
+		return nil, err
+	}
+	var includes []string
+	for k, v := range m {
+		if !strings.EqualFold(k, includeKey) {
+			continue
+		}
+		delete(m, k)
+		if err := remarshal(v, &includes); err != nil {
+			return nil, fmt.Errorf("%q must be a list of paths: %w", includeKey, err)
+		}
+	}
+	if len(includes) == 0 {
+		return m, nil
+	}
+	if path == VMUserDataPath {
+		return nil, fmt.Errorf("%q isn't supported in VM user data", includeKey)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	r.stack = append(r.stack, abs)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	merged := map[string]any{}
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(abs), inc)
+		}
+		im, err := r.include(inc)
+		if err != nil {
+			return nil, err
+		}
+		mergeObjects(merged, im)
+	}
+	mergeObjects(merged, m)
+	return merged, nil
+}
+
+// include reads and returns the config file at the absolute path, with its
+// own includes merged in.
+func (r *resolver) include(path string) (map[string]any, error) {
+	for _, p := range r.stack {
+		if p == path {
+			return nil, fmt.Errorf("include cycle: %s includes itself", path)
+		}
+	}
+	if len(r.stack) >= maxIncludeDepth {
+		return nil, fmt.Errorf("including %s: includes nested more than %d deep", path, maxIncludeDepth)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("including config file: %w", err)
+	}
+	std, err := standardize(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing included config file %s: %w", path, err)
+	}
+	if _, err := parseVersion(std); err != nil {
+		return nil, fmt.Errorf("error parsing included config file %s: %w", path, err)
+	}
+	r.included = append(r.included, path)
+	m, err := r.load(path, std)
+	if err != nil {
+		return nil, fmt.Errorf("included config file %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// decodeObject decodes std, which must be a JSON object.
+func decodeObject(std []byte) (map[string]any, error) {
+	jd := json.NewDecoder(bytes.NewReader(std))
+	jd.UseNumber() // don't round-trip numbers through float64
+	var m map[string]any
+	if err := jd.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.New("config is not a JSON object")
+	}
+	return m, nil
+}
+
+func remarshal(v, dst any) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, dst)
+}
+
+// mergeObjects merges src into dst, recursively for values that are objects
+// in both. Keys match case-insensitively, as they do when decoding the
+// config, with the key from src replacing the one in dst.
+func mergeObjects(dst, src map[string]any) {
+	for k, sv := range src {
+		for dk, dv := range dst {
+			if !strings.EqualFold(dk, k) {
+				continue
+			}
+			delete(dst, dk)
+			dm, ok1 := dv.(map[string]any)
+			sm, ok2 := sv.(map[string]any)
+			if ok1 && ok2 {
+				mergeObjects(dm, sm)
+				sv = dm
+			}
+		}
+		dst[k] = sv
+	}
+}
+
+// expandEnv substitutes environment variables in the string values of v,
+// recursively. It modifies v in place.
+func expandEnv(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if s, ok := e.(string); ok {
+				es, err := expandEnvString(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+				v[k] = es
+			} else if err := expandEnv(e); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			if s, ok := e.(string); ok {
+				es, err := expandEnvString(s)
+				if err != nil {
+					return fmt.Errorf("[%d]: %w", i, err)
+				}
+				v[i] = es
+			} else if err := expandEnv(e); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// expandEnvString replaces each "${NAME}" in s with the value of the
+// environment variable NAME, and each "$${" with a literal "${".
+//
+// Unlike [os.ExpandEnv], a lone "$" is left alone, so values such as
+// passwords needn't be escaped, and it's an error to reference a variable
+// that isn't set, so a missing secret isn't silently replaced by nothing.
+func expandEnvString(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i == -1 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			sb.WriteString(s[:i]) // includes the first '$' of "$${"
+			sb.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		sb.WriteString(s[:i])
+		name, rest, ok := strings.Cut(s[i+2:], "}")
+		if !ok {
+			return "", fmt.Errorf("unterminated %q", s[i:])
+		}
+		if !validEnvName(name) {
+			return "", fmt.Errorf("invalid environment variable name %q", name)
+		}
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		sb.WriteString(val)
+		s = rest
+	}
+}
+
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
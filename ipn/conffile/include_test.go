@@ -0,0 +1,180 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package conffile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeConfigs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadInclude(t *testing.T) {
+	t.Setenv("TEST_TS_AUTHKEY", "tskey-auth-secret")
+	dir := writeConfigs(t, map[string]string{
+		"base/base.json": `{
+			"version": "alpha0",
+			"ServerURL": "https://control.example.com",
+			"Hostname": "base",
+			"acceptRoutes": true,
+			"AdvertiseRoutes": ["10.0.0.0/8"],
+			"AutoUpdate": {"Check": true, "Apply": false},
+		}`,
+		"base/routes.json": `{"AdvertiseRoutes": ["10.1.0.0/16", "10.2.0.0/16"]}`,
+		"host.json": `{
+			"version": "alpha0",
+			"Include": ["base/base.json", "base/routes.json"],
+			"hostname": "host-${TEST_TS_AUTHKEY_SUFFIX}",
+			"AuthKey": "${TEST_TS_AUTHKEY}",
+			"AutoUpdate": {"Apply": true},
+			"OperatorUser": "pa$$word $${literal}",
+		}`,
+	})
+	t.Setenv("TEST_TS_AUTHKEY_SUFFIX", "1")
+
+	c, err := Load(filepath.Join(dir, "host.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := c.Parsed
+	if got, want := *p.ServerURL, "https://control.example.com"; got != want {
+		t.Errorf("ServerURL = %q; want %q", got, want)
+	}
+	if got, want := *p.Hostname, "host-1"; got != want {
+		t.Errorf("Hostname = %q; want %q", got, want)
+	}
+	if got, want := *p.AuthKey, "tskey-auth-secret"; got != want {
+		t.Errorf("AuthKey = %q; want %q", got, want)
+	}
+	if got, want := *p.OperatorUser, "pa$$word ${literal}"; got != want {
+		t.Errorf("OperatorUser = %q; want %q", got, want)
+	}
+	if !p.AcceptRoutes.EqualBool(true) {
+		t.Errorf("AcceptRoutes = %q; want true", p.AcceptRoutes)
+	}
+	if got := len(p.AdvertiseRoutes); got != 2 {
+		t.Errorf("AdvertiseRoutes = %v; want the 2 from routes.json", p.AdvertiseRoutes)
+	}
+	if au := p.AutoUpdate; au == nil || !au.Check || !au.Apply.EqualBool(true) {
+		t.Errorf("AutoUpdate = %+v; want Check and Apply", au)
+	}
+	wantIncluded := []string{filepath.Join(dir, "base/base.json"), filepath.Join(dir, "base/routes.json")}
+	if !slices.Equal(c.Included, wantIncluded) {
+		t.Errorf("Included = %q; want %q", c.Included, wantIncluded)
+	}
+	if strings.Contains(string(c.Std), "tskey-auth-secret") {
+		t.Errorf("Std contains substituted secret: %s", c.Std)
+	}
+}
+
+func TestLoadIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"host.json": `{"version": "alpha0", "Include": ["a.json"]}`,
+				"a.json":    `{"Include": ["b.json"]}`,
+				"b.json":    `{"Include": ["a.json"]}`,
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name: "missing",
+			files: map[string]string{
+				"host.json": `{"version": "alpha0", "Include": ["nope.json"]}`,
+			},
+			wantErr: "no such file",
+		},
+		{
+			name: "bad_version",
+			files: map[string]string{
+				"host.json": `{"version": "alpha0", "Include": ["a.json"]}`,
+				"a.json":    `{"version": "beta9"}`,
+			},
+			wantErr: "unsupported",
+		},
+		{
+			name: "not_list",
+			files: map[string]string{
+				"host.json": `{"version": "alpha0", "Include": "a.json"}`,
+			},
+			wantErr: "must be a list",
+		},
+		{
+			name: "unknown_field",
+			files: map[string]string{
+				"host.json": `{"version": "alpha0", "Include": ["a.json"]}`,
+				"a.json":    `{"NoSuchField": true}`,
+			},
+			wantErr: "unknown field",
+		},
+		{
+			name: "unset_env",
+			files: map[string]string{
+				"host.json": `{"version": "alpha0", "AuthKey": "${TEST_TS_UNSET_VAR}"}`,
+			},
+			wantErr: "TEST_TS_UNSET_VAR is not set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigs(t, tt.files)
+			_, err := Load(filepath.Join(dir, "host.json"))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load error = %v; want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandEnvString(t *testing.T) {
+	t.Setenv("TEST_TS_A", "x")
+	t.Setenv("TEST_TS_EMPTY", "")
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "plain", want: "plain"},
+		{in: "$HOME and $", want: "$HOME and $"},
+		{in: "${TEST_TS_A}", want: "x"},
+		{in: "a${TEST_TS_A}b${TEST_TS_A}c", want: "axbxc"},
+		{in: "${TEST_TS_EMPTY}", want: ""},
+		{in: "$${TEST_TS_A}", want: "${TEST_TS_A}"},
+		{in: "${TEST_TS_A", wantErr: true},
+		{in: "${1ABC}", wantErr: true},
+		{in: "${}", wantErr: true},
+		{in: "${TEST_TS_UNSET_VAR}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := expandEnvString(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("expandEnvString(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("expandEnvString(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FunnelSchedule is a weekly schedule of windows of time during which Funnel
+// is on for a HostPort. See [ServeConfig.FunnelSchedules].
+type FunnelSchedule struct {
+	// TimeZone is the IANA name of the time zone of the Windows, such as
+	// "America/New_York". Empty means the node's local time zone.
+	TimeZone string `json:",omitempty"`
+
+	// Windows are the recurring windows of time during which Funnel is on.
+	// They may overlap.
+	Windows []FunnelWindow
+}
+
+// FunnelWindow is a recurring window of time in a [FunnelSchedule].
+type FunnelWindow struct {
+	// Days are the days of the week on which the window starts, as a
+	// comma-separated list of days and ranges of days, such as "mon-fri" or
+	// "sat,sun". Empty means every day.
+	Days string `json:",omitempty"`
+
+	// Start and End are the times of day, in "15:04" format, at which the
+	// window starts and ends. If End isn't after Start, the window ends on
+	// the following day.
+	Start string
+	End   string
+}
+
+// funnelTimeOfDay parses a "15:04" time of day into its offset from midnight.
+func funnelTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q; want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// location returns the time zone of s.
+func (s *FunnelSchedule) location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(s.TimeZone)
+}
+
+// Validate reports whether s is a valid schedule.
+func (s *FunnelSchedule) Validate() error {
+	if _, err := s.location(); err != nil {
+		return fmt.Errorf("invalid time zone %q: %w", s.TimeZone, err)
+	}
+	if len(s.Windows) == 0 {
+		return errors.New("schedule has no windows")
+	}
+	for _, w := range s.Windows {
+		if _, err := parseFunnelDays(w.Days); err != nil {
+			return err
+		}
+		start, err := funnelTimeOfDay(w.Start)
+		if err != nil {
+			return err
+		}
+		end, err := funnelTimeOfDay(w.End)
+		if err != nil {
+			return err
+		}
+		if start == end {
+			return fmt.Errorf("window %v is empty", w)
+		}
+	}
+	return nil
+}
+
+// Occurrences returns the start and end times of the occurrences of the
+// windows of s that overlap the time range [from, to), in order of their
+// start. It yields nothing if s isn't valid.
+func (s *FunnelSchedule) Occurrences(from, to time.Time) iter.Seq2[time.Time, time.Time] {
+	return func(yield func(time.Time, time.Time) bool) {
+		loc, err := s.location()
+		if err != nil || !from.Before(to) {
+			return
+		}
+		type span struct{ start, end time.Time }
+		var spans []span
+		// Windows are at most a day long, so any overlapping the range
+		// start at most a day before it.
+		y, m, d := from.In(loc).AddDate(0, 0, -1).Date()
+		for day := time.Date(y, m, d, 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+			for _, w := range s.Windows {
+				days, err := parseFunnelDays(w.Days)
+				if err != nil || days != nil && !slices.Contains(days, day.Weekday()) {
+					continue
+				}
+				startOff, err1 := funnelTimeOfDay(w.Start)
+				endOff, err2 := funnelTimeOfDay(w.End)
+				if err1 != nil || err2 != nil || startOff == endOff {
+					continue
+				}
+				start := clockTime(day, startOff)
+				end := clockTime(day, endOff)
+				if endOff < startOff {
+					end = clockTime(day.AddDate(0, 0, 1), endOff)
+				}
+				if end.After(from) && start.Before(to) {
+					spans = append(spans, span{start, end})
+				}
+			}
+		}
+		slices.SortStableFunc(spans, func(a, b span) int { return a.start.Compare(b.start) })
+		for _, sp := range spans {
+			if !yield(sp.start, sp.end) {
+				return
+			}
+		}
+	}
+}
+
+// clockTime returns the time off after midnight on day, by the clock in
+// day's time zone, so that windows keep their times of day across daylight
+// saving time changes.
+func clockTime(day time.Time, off time.Duration) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, int(off/time.Hour), int(off%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+// ActiveAt reports whether t is within one of the windows of s.
+func (s *FunnelSchedule) ActiveAt(t time.Time) bool {
+	for range s.Occurrences(t, t.Add(time.Nanosecond)) {
+		return true
+	}
+	return false
+}
+
+// NextChange returns the first time after t at which one of the windows of s
+// starts or ends, or the zero time if there's none.
+func (s *FunnelSchedule) NextChange(t time.Time) time.Time {
+	var next time.Time
+	// Every window recurs at least once a week.
+	for start, end := range s.Occurrences(t, t.AddDate(0, 0, 8)) {
+		for _, c := range []time.Time{start, end} {
+			if c.After(t) && (next.IsZero() || c.Before(next)) {
+				next = c
+			}
+		}
+	}
+	return next
+}
+
+var funnelDayNames = [...]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseFunnelWindow parses a window in the format of [FunnelWindow.String],
+// such as "09:00-17:00", "mon-fri 09:00-17:00", or "sat,sun 22:00-02:00".
+func ParseFunnelWindow(s string) (FunnelWindow, error) {
+	var w FunnelWindow
+	f := strings.Fields(s)
+	switch len(f) {
+	case 1:
+	case 2:
+		days, err := parseFunnelDays(f[0])
+		if err != nil {
+			return w, err
+		}
+		w.Days = formatFunnelDays(days)
+		f = f[1:]
+	default:
+		return w, fmt.Errorf("invalid window %q; want [DAYS] HH:MM-HH:MM", s)
+	}
+	start, end, ok := strings.Cut(f[0], "-")
+	if !ok {
+		return w, fmt.Errorf("invalid window %q; want [DAYS] HH:MM-HH:MM", s)
+	}
+	for _, t := range []string{start, end} {
+		if _, err := funnelTimeOfDay(t); err != nil {
+			return w, err
+		}
+	}
+	w.Start, w.End = start, end
+	if w.Start == w.End {
+		return w, fmt.Errorf("window %q is empty", s)
+	}
+	return w, nil
+}
+
+// parseFunnelDays parses a comma-separated list of days of the week, and
+// ranges of them, such as "mon-fri" or "sat,sun", into a sorted list of days.
+// It returns nil for the empty string, which means every day.
+func parseFunnelDays(s string) ([]time.Weekday, error) {
+	if s == "" {
+		return nil, nil
+	}
+	day := func(name string) (time.Weekday, error) {
+		i := slices.Index(funnelDayNames[:], strings.ToLower(name))
+		if i < 0 {
+			return 0, fmt.Errorf("invalid day of the week %q; want one of %s", name, strings.Join(funnelDayNames[:], ", "))
+		}
+		return time.Weekday(i), nil
+	}
+	var days []time.Weekday
+	for f := range strings.SplitSeq(s, ",") {
+		first, last, isRange := strings.Cut(f, "-")
+		d1, err := day(first)
+		if err != nil {
+			return nil, err
+		}
+		d2 := d1
+		if isRange {
+			if d2, err = day(last); err != nil {
+				return nil, err
+			}
+		}
+		for d := d1; ; d = (d + 1) % 7 {
+			if !slices.Contains(days, d) {
+				days = append(days, d)
+			}
+			if d == d2 {
+				break
+			}
+		}
+	}
+	slices.Sort(days)
+	return days, nil
+}
+
+// String returns w in the format accepted by [ParseFunnelWindow].
+func (w FunnelWindow) String() string {
+	if w.Days == "" {
+		return w.Start + "-" + w.End
+	}
+	return w.Days + " " + w.Start + "-" + w.End
+}
+
+// formatFunnelDays formats sorted days of the week in the format accepted by
+// parseFunnelDays, collapsing runs of three or more days into ranges.
+func formatFunnelDays(days []time.Weekday) string {
+	var parts []string
+	for i := 0; i < len(days); {
+		j := i
+		for j+1 < len(days) && days[j+1] == days[j]+1 {
+			j++
+		}
+		if j-i >= 2 {
+			parts = append(parts, funnelDayNames[days[i]]+"-"+funnelDayNames[days[j]])
+		} else {
+			for _, d := range days[i : j+1] {
+				parts = append(parts, funnelDayNames[d])
+			}
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFunnelWindow(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    FunnelWindow
+		wantErr bool
+	}{
+		{in: "09:00-17:00", want: FunnelWindow{Start: "09:00", End: "17:00"}},
+		{in: "mon-fri 09:00-17:00", want: FunnelWindow{Days: "mon-fri", Start: "09:00", End: "17:00"}},
+		{in: "Sat,sun 22:00-02:00", want: FunnelWindow{Days: "sun,sat", Start: "22:00", End: "02:00"}},
+		{in: "mon,tue,wed 08:30-12:00", want: FunnelWindow{Days: "mon-wed", Start: "08:30", End: "12:00"}},
+		{in: "fri-mon 18:00-06:00", want: FunnelWindow{Days: "sun,mon,fri,sat", Start: "18:00", End: "06:00"}},
+		{in: "09:00", wantErr: true},
+		{in: "9am-5pm", wantErr: true},
+		{in: "24:00-01:00", wantErr: true},
+		{in: "funday 09:00-17:00", wantErr: true},
+		{in: "10:00-10:00", wantErr: true},
+		{in: "mon 09:00-10:00 extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFunnelWindow(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFunnelWindow(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParseFunnelWindow(%q) = %+v; want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFunnelSchedule(t *testing.T) {
+	s := &FunnelSchedule{
+		TimeZone: "America/New_York",
+		Windows: []FunnelWindow{
+			{Days: "mon-fri", Start: "09:00", End: "17:00"},
+			{Days: "sat", Start: "22:00", End: "02:00"},
+		},
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(day, hour, min int) time.Time {
+		// October 2026 starts on a Thursday.
+		return time.Date(2026, 10, day, hour, min, 0, 0, ny)
+	}
+
+	tests := []struct {
+		t          time.Time
+		wantActive bool
+		wantNext   time.Time
+	}{
+		{at(12, 8, 0), false, at(12, 9, 0)},   // Monday morning
+		{at(12, 9, 0), true, at(12, 17, 0)},   // Monday, start of the window
+		{at(16, 16, 59), true, at(16, 17, 0)}, // Friday afternoon
+		{at(16, 17, 0), false, at(17, 22, 0)}, // Friday, end of the window
+		{at(18, 1, 0), true, at(18, 2, 0)},    // Saturday night, into Sunday
+		{at(18, 12, 0), false, at(19, 9, 0)},  // Sunday
+	}
+	for _, tt := range tests {
+		if got := s.ActiveAt(tt.t); got != tt.wantActive {
+			t.Errorf("ActiveAt(%v) = %v; want %v", tt.t, got, tt.wantActive)
+		}
+		if got := s.NextChange(tt.t); !got.Equal(tt.wantNext) {
+			t.Errorf("NextChange(%v) = %v; want %v", tt.t, got, tt.wantNext)
+		}
+	}
+
+	// Windows keep their time of day after daylight saving time ends, on
+	// November 1, 2026.
+	if got, want := s.NextChange(time.Date(2026, 11, 1, 12, 0, 0, 0, ny)), time.Date(2026, 11, 2, 9, 0, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("NextChange across DST = %v; want %v", got, want)
+	}
+
+	var n int
+	for start, end := range s.Occurrences(at(12, 0, 0), at(19, 0, 0)) {
+		if !end.After(start) {
+			t.Errorf("occurrence from %v to %v", start, end)
+		}
+		n++
+	}
+	if n != 6 {
+		t.Errorf("got %d occurrences in a week; want 6", n)
+	}
+
+	for _, bad := range []*FunnelSchedule{
+		{},
+		{TimeZone: "Not/AZone", Windows: []FunnelWindow{{Start: "09:00", End: "10:00"}}},
+		{Windows: []FunnelWindow{{Days: "someday", Start: "09:00", End: "10:00"}}},
+		{Windows: []FunnelWindow{{Start: "09:00", End: "09:00"}}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil; want error", bad)
+		}
+	}
+}
@@ -8,6 +8,7 @@
 import (
 	"maps"
 	"net/netip"
+	"time"
 
 	"tailscale.com/drive"
 	"tailscale.com/tailcfg"
@@ -51,6 +52,10 @@ func (src *Prefs) Clone() *Prefs {
 	dst.AdvertiseTags = append(src.AdvertiseTags[:0:0], src.AdvertiseTags...)
 	dst.AdvertiseRoutes = append(src.AdvertiseRoutes[:0:0], src.AdvertiseRoutes...)
 	dst.AdvertiseServices = append(src.AdvertiseServices[:0:0], src.AdvertiseServices...)
+	dst.ConnectedSubnetsInclude = append(src.ConnectedSubnetsInclude[:0:0], src.ConnectedSubnetsInclude...)
+	dst.ConnectedSubnetsExclude = append(src.ConnectedSubnetsExclude[:0:0], src.ConnectedSubnetsExclude...)
+	dst.ExcludeApps = append(src.ExcludeApps[:0:0], src.ExcludeApps...)
+	dst.RequireTunnelApps = append(src.RequireTunnelApps[:0:0], src.RequireTunnelApps...)
 	if src.DriveShares != nil {
 		dst.DriveShares = make([]*drive.Share, len(src.DriveShares))
 		for i := range dst.DriveShares {
@@ -65,6 +70,9 @@ func (src *Prefs) Clone() *Prefs {
 		dst.RelayServerPort = new(*src.RelayServerPort)
 	}
 	dst.RelayServerStaticEndpoints = append(src.RelayServerStaticEndpoints[:0:0], src.RelayServerStaticEndpoints...)
+	dst.DERPDenyRegions = append(src.DERPDenyRegions[:0:0], src.DERPDenyRegions...)
+	dst.PeerIdle = *src.PeerIdle.Clone()
+	dst.KeepWarmPeers = append(src.KeepWarmPeers[:0:0], src.KeepWarmPeers...)
 	dst.Persist = src.Persist.Clone()
 	return dst
 }
@@ -91,6 +99,9 @@ func (src *Prefs) Clone() *Prefs {
 	Egg                        bool
 	AdvertiseRoutes            []netip.Prefix
 	AdvertiseServices          []string
+	AdvertiseConnectedSubnets  bool
+	ConnectedSubnetsInclude    []netip.Prefix
+	ConnectedSubnetsExclude    []netip.Prefix
 	Sync                       opt.Bool
 	NoSNAT                     bool
 	NoStatefulFiltering        opt.Bool
@@ -101,9 +112,15 @@ func (src *Prefs) Clone() *Prefs {
 	AppConnector               AppConnectorPrefs
 	PostureChecking            bool
 	NetfilterKind              string
+	ExcludeApps                []string
+	RequireTunnelApps          []string
 	DriveShares                []*drive.Share
 	RelayServerPort            *uint16
 	RelayServerStaticEndpoints []netip.AddrPort
+	DERPHomeRegion             int
+	DERPDenyRegions            []int
+	PeerIdle                   PeerIdlePrefs
+	KeepWarmPeers              []string
 	AllowSingleHosts           marshalAsTrueInJSON
 	Persist                    *persist.Persist
 }{})
@@ -122,7 +139,7 @@ func (src *ServeConfig) Clone() *ServeConfig {
 			if v == nil {
 				dst.TCP[k] = nil
 			} else {
-				dst.TCP[k] = new(*v)
+				dst.TCP[k] = v.Clone()
 			}
 		}
 	}
@@ -147,6 +164,16 @@ func (src *ServeConfig) Clone() *ServeConfig {
 		}
 	}
 	dst.AllowFunnel = maps.Clone(src.AllowFunnel)
+	if dst.FunnelSchedules != nil {
+		dst.FunnelSchedules = map[HostPort]*FunnelSchedule{}
+		for k, v := range src.FunnelSchedules {
+			if v == nil {
+				dst.FunnelSchedules[k] = nil
+			} else {
+				dst.FunnelSchedules[k] = v.Clone()
+			}
+		}
+	}
 	if dst.Foreground != nil {
 		dst.Foreground = map[string]*ServeConfig{}
 		for k, v := range src.Foreground {
@@ -162,12 +189,13 @@ func (src *ServeConfig) Clone() *ServeConfig {
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ServeConfigCloneNeedsRegeneration = ServeConfig(struct {
-	TCP         map[uint16]*TCPPortHandler
-	Web         map[HostPort]*WebServerConfig
-	Services    map[tailcfg.ServiceName]*ServiceConfig
-	AllowFunnel map[HostPort]bool
-	Foreground  map[string]*ServeConfig
-	ETag        string
+	TCP             map[uint16]*TCPPortHandler
+	Web             map[HostPort]*WebServerConfig
+	Services        map[tailcfg.ServiceName]*ServiceConfig
+	AllowFunnel     map[HostPort]bool
+	FunnelSchedules map[HostPort]*FunnelSchedule
+	Foreground      map[string]*ServeConfig
+	ETag            string
 }{})
 
 // Clone makes a deep copy of ServiceConfig.
@@ -184,7 +212,7 @@ func (src *ServiceConfig) Clone() *ServiceConfig {
 			if v == nil {
 				dst.TCP[k] = nil
 			} else {
-				dst.TCP[k] = new(*v)
+				dst.TCP[k] = v.Clone()
 			}
 		}
 	}
@@ -216,6 +244,7 @@ func (src *TCPPortHandler) Clone() *TCPPortHandler {
 	}
 	dst := new(TCPPortHandler)
 	*dst = *src
+	dst.SNI = maps.Clone(src.SNI)
 	return dst
 }
 
@@ -225,6 +254,7 @@ func (src *TCPPortHandler) Clone() *TCPPortHandler {
 	HTTP          bool
 	TCPForward    string
 	TerminateTLS  string
+	SNI           map[string]string
 	ProxyProtocol int
 }{})
 
@@ -237,6 +267,9 @@ func (src *HTTPHandler) Clone() *HTTPHandler {
 	dst := new(HTTPHandler)
 	*dst = *src
 	dst.AcceptAppCaps = append(src.AcceptAppCaps[:0:0], src.AcceptAppCaps...)
+	if dst.Timeouts != nil {
+		dst.Timeouts = new(*src.Timeouts)
+	}
 	return dst
 }
 
@@ -247,6 +280,7 @@ func (src *HTTPHandler) Clone() *HTTPHandler {
 	Text          string
 	AcceptAppCaps []tailcfg.PeerCapability
 	Redirect      string
+	Timeouts      *HTTPTimeouts
 }{})
 
 // Clone makes a deep copy of WebServerConfig.
@@ -274,3 +308,40 @@ func (src *WebServerConfig) Clone() *WebServerConfig {
 var _WebServerConfigCloneNeedsRegeneration = WebServerConfig(struct {
 	Handlers map[string]*HTTPHandler
 }{})
+
+// Clone makes a deep copy of FunnelSchedule.
+// The result aliases no memory with the original.
+func (src *FunnelSchedule) Clone() *FunnelSchedule {
+	if src == nil {
+		return nil
+	}
+	dst := new(FunnelSchedule)
+	*dst = *src
+	dst.Windows = append(src.Windows[:0:0], src.Windows...)
+	return dst
+}
+
+// A compilation failure here means this code must be regenerated, with the command at the top of this file.
+var _FunnelScheduleCloneNeedsRegeneration = FunnelSchedule(struct {
+	TimeZone string
+	Windows  []FunnelWindow
+}{})
+
+// Clone makes a deep copy of PeerIdlePrefs.
+// The result aliases no memory with the original.
+func (src *PeerIdlePrefs) Clone() *PeerIdlePrefs {
+	if src == nil {
+		return nil
+	}
+	dst := new(PeerIdlePrefs)
+	*dst = *src
+	dst.AlwaysOn = append(src.AlwaysOn[:0:0], src.AlwaysOn...)
+	return dst
+}
+
+// A compilation failure here means this code must be regenerated, with the command at the top of this file.
+var _PeerIdlePrefsCloneNeedsRegeneration = PeerIdlePrefs(struct {
+	Timeout   time.Duration
+	MaxActive int
+	AlwaysOn  []tailcfg.StableNodeID
+}{})
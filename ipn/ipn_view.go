@@ -9,6 +9,7 @@
 	jsonv1 "encoding/json"
 	"errors"
 	"net/netip"
+	"time"
 
 	jsonv2 "github.com/go-json-experiment/json"
 	"github.com/go-json-experiment/json/jsontext"
@@ -20,7 +21,7 @@
 	"tailscale.com/types/views"
 )
 
-//go:generate go run tailscale.com/cmd/cloner  -clonefunc=false -type=LoginProfile,Prefs,ServeConfig,ServiceConfig,TCPPortHandler,HTTPHandler,WebServerConfig
+//go:generate go run tailscale.com/cmd/cloner  -clonefunc=false -type=LoginProfile,Prefs,ServeConfig,ServiceConfig,TCPPortHandler,HTTPHandler,WebServerConfig,FunnelSchedule,PeerIdlePrefs
 
 // View returns a read-only view of LoginProfile.
 func (p *LoginProfile) View() LoginProfileView {
@@ -363,6 +364,25 @@ func (v PrefsView) AdvertiseServices() views.Slice[string] {
 	return views.SliceOf(v.ж.AdvertiseServices)
 }
 
+// AdvertiseConnectedSubnets specifies whether to advertise the subnets
+// of this node's directly connected LAN interfaces, in addition to
+// AdvertiseRoutes. The advertised subnets are updated as interfaces
+// and their addresses change.
+func (v PrefsView) AdvertiseConnectedSubnets() bool { return v.ж.AdvertiseConnectedSubnets }
+
+// ConnectedSubnetsInclude, if non-empty, limits the subnets advertised
+// by AdvertiseConnectedSubnets to those contained within one of these
+// prefixes.
+func (v PrefsView) ConnectedSubnetsInclude() views.Slice[netip.Prefix] {
+	return views.SliceOf(v.ж.ConnectedSubnetsInclude)
+}
+
+// ConnectedSubnetsExclude are prefixes whose overlapping subnets
+// are never advertised by AdvertiseConnectedSubnets.
+func (v PrefsView) ConnectedSubnetsExclude() views.Slice[netip.Prefix] {
+	return views.SliceOf(v.ж.ConnectedSubnetsExclude)
+}
+
 // Sync is whether this node should sync its configuration from
 // the control plane. If unset, this defaults to true.
 // This exists primarily for testing, to verify that netmap caching
@@ -432,6 +452,23 @@ func (v PrefsView) PostureChecking() bool { return v.ж.PostureChecking }
 // Linux-only.
 func (v PrefsView) NetfilterKind() string { return v.ж.NetfilterKind }
 
+// ExcludeApps are cgroup v2 paths, relative to the cgroup2 mount
+// (e.g. "/user.slice/user-1000.slice/app-firefox.scope"), whose
+// processes' traffic bypasses Tailscale's routes, including the exit
+// node, as if Tailscale weren't running.
+//
+// Linux-only, and only applied when NetfilterMode is "on".
+func (v PrefsView) ExcludeApps() views.Slice[string] { return views.SliceOf(v.ж.ExcludeApps) }
+
+// RequireTunnelApps are cgroup v2 paths, like ExcludeApps, whose
+// processes may only send traffic over the Tailscale interface or
+// loopback. Their other traffic is dropped.
+//
+// Linux-only, and only applied when NetfilterMode is "on".
+func (v PrefsView) RequireTunnelApps() views.Slice[string] {
+	return views.SliceOf(v.ж.RequireTunnelApps)
+}
+
 // DriveShares are the configured DriveShares, stored in increasing order
 // by name.
 func (v PrefsView) DriveShares() views.SliceView[*drive.Share, drive.ShareView] {
@@ -453,6 +490,31 @@ func (v PrefsView) RelayServerStaticEndpoints() views.Slice[netip.AddrPort] {
 	return views.SliceOf(v.ж.RelayServerStaticEndpoints)
 }
 
+// DERPHomeRegion, if non-zero, is the ID of the DERP region to use as
+// the node's home, instead of the one with the lowest latency.
+func (v PrefsView) DERPHomeRegion() int { return v.ж.DERPHomeRegion }
+
+// DERPDenyRegions are the IDs of DERP regions never to use, neither as
+// home nor to reach peers, such as for data sovereignty requirements.
+// Peers whose home is a denied region are only reachable directly or
+// via peer relays. Denying a region overrides DERPHomeRegion.
+func (v PrefsView) DERPDenyRegions() views.Slice[int] { return views.SliceOf(v.ж.DERPDenyRegions) }
+
+// PeerIdle controls when the WireGuard sessions of idle peers are torn
+// down. See PeerIdlePrefs docs for more details.
+func (v PrefsView) PeerIdle() PeerIdlePrefsView { return v.ж.PeerIdle.View() }
+
+// KeepWarmPeers are peers whose connections are kept warm, so that the
+// first packet to them after being idle or a network change, such as
+// waking from sleep, doesn't wait seconds for path discovery. Each is a
+// Tailscale IP, a StableNodeID, or a MagicDNS name (either the FQDN or
+// its first label). Entries matching no peer are ignored.
+//
+// The paths to these peers are kept alive while idle, rediscovered
+// right after network changes, and remembered across restarts, and
+// their WireGuard sessions aren't torn down per PeerIdle.
+func (v PrefsView) KeepWarmPeers() views.Slice[string] { return views.SliceOf(v.ж.KeepWarmPeers) }
+
 // AllowSingleHosts was a legacy field that was always true
 // for the past 4.5 years. It controlled whether Tailscale
 // peers got /32 or /128 routes for each other.
@@ -493,6 +555,9 @@ func (v PrefsView) Persist() persist.PersistView { return v.ж.Persist.View() }
 	Egg                        bool
 	AdvertiseRoutes            []netip.Prefix
 	AdvertiseServices          []string
+	AdvertiseConnectedSubnets  bool
+	ConnectedSubnetsInclude    []netip.Prefix
+	ConnectedSubnetsExclude    []netip.Prefix
 	Sync                       opt.Bool
 	NoSNAT                     bool
 	NoStatefulFiltering        opt.Bool
@@ -503,9 +568,15 @@ func (v PrefsView) Persist() persist.PersistView { return v.ж.Persist.View() }
 	AppConnector               AppConnectorPrefs
 	PostureChecking            bool
 	NetfilterKind              string
+	ExcludeApps                []string
+	RequireTunnelApps          []string
 	DriveShares                []*drive.Share
 	RelayServerPort            *uint16
 	RelayServerStaticEndpoints []netip.AddrPort
+	DERPHomeRegion             int
+	DERPDenyRegions            []int
+	PeerIdle                   PeerIdlePrefs
+	KeepWarmPeers              []string
 	AllowSingleHosts           marshalAsTrueInJSON
 	Persist                    *persist.Persist
 }{})
@@ -607,6 +678,15 @@ func (v ServeConfigView) AllowFunnel() views.Map[HostPort, bool] {
 	return views.MapOf(v.ж.AllowFunnel)
 }
 
+// FunnelSchedules maps from SNI:port values to the schedules of when
+// funnel traffic is allowed for them. LocalBackend adds and removes
+// their AllowFunnel entries as their windows start and end.
+func (v ServeConfigView) FunnelSchedules() views.MapFn[HostPort, *FunnelSchedule, FunnelScheduleView] {
+	return views.MapFnOf(v.ж.FunnelSchedules, func(t *FunnelSchedule) FunnelScheduleView {
+		return t.View()
+	})
+}
+
 // Foreground is a map of an IPN Bus session ID to an alternate foreground serve config that's valid for the
 // life of that WatchIPNBus session ID. This allows the config to specify ephemeral configs that are used
 // in the CLI's foreground mode to ensure ungraceful shutdowns of either the client or the LocalBackend does not
@@ -627,12 +707,13 @@ func (v ServeConfigView) ETag() string { return v.ж.ETag }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ServeConfigViewNeedsRegeneration = ServeConfig(struct {
-	TCP         map[uint16]*TCPPortHandler
-	Web         map[HostPort]*WebServerConfig
-	Services    map[tailcfg.ServiceName]*ServiceConfig
-	AllowFunnel map[HostPort]bool
-	Foreground  map[string]*ServeConfig
-	ETag        string
+	TCP             map[uint16]*TCPPortHandler
+	Web             map[HostPort]*WebServerConfig
+	Services        map[tailcfg.ServiceName]*ServiceConfig
+	AllowFunnel     map[HostPort]bool
+	FunnelSchedules map[HostPort]*FunnelSchedule
+	Foreground      map[string]*ServeConfig
+	ETag            string
 }{})
 
 // View returns a read-only view of ServiceConfig.
@@ -820,10 +901,19 @@ func (v TCPPortHandlerView) TCPForward() string { return v.ж.TCPForward }
 // (the HTTPS mode uses ServeConfig.Web)
 func (v TCPPortHandlerView) TerminateTLS() string { return v.ж.TerminateTLS }
 
+// SNI, if non-empty, maps TLS server names to the IP:port to forward
+// TLS connections with that server name (as sent in the ClientHello) to.
+// TLS is not terminated: the backend receives the connection unmodified,
+// starting with the ClientHello. The name "*" matches connections whose
+// server name matches no other entry, or which send none.
+//
+// It is mutually exclusive with HTTPS, HTTP and TCPForward.
+func (v TCPPortHandlerView) SNI() views.Map[string, string] { return views.MapOf(v.ж.SNI) }
+
 // ProxyProtocol indicates whether to send a PROXY protocol header
-// before forwarding the connection to TCPForward.
+// before forwarding the connection to TCPForward or an SNI backend.
 //
-// This is only valid if TCPForward is non-empty.
+// This is only valid if TCPForward or SNI is non-empty.
 func (v TCPPortHandlerView) ProxyProtocol() int { return v.ж.ProxyProtocol }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
@@ -832,6 +922,7 @@ func (v TCPPortHandlerView) ProxyProtocol() int { return v.ж.ProxyProtocol }
 	HTTP          bool
 	TCPForward    string
 	TerminateTLS  string
+	SNI           map[string]string
 	ProxyProtocol int
 }{})
 
@@ -925,6 +1016,12 @@ func (v HTTPHandlerView) AcceptAppCaps() views.Slice[tailcfg.PeerCapability] {
 //   - ${REQUEST_URI}: replaced with the request's full URI (path and query string)
 func (v HTTPHandlerView) Redirect() string { return v.ж.Redirect }
 
+// Timeouts, if non-nil, are the timeouts of requests proxied to Proxy.
+// It's only used with Proxy.
+func (v HTTPHandlerView) Timeouts() views.ValuePointer[HTTPTimeouts] {
+	return views.ValuePointerOf(v.ж.Timeouts)
+}
+
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _HTTPHandlerViewNeedsRegeneration = HTTPHandler(struct {
 	Path          string
@@ -932,6 +1029,7 @@ func (v HTTPHandlerView) Redirect() string { return v.ж.Redirect }
 	Text          string
 	AcceptAppCaps []tailcfg.PeerCapability
 	Redirect      string
+	Timeouts      *HTTPTimeouts
 }{})
 
 // View returns a read-only view of WebServerConfig.
@@ -1012,3 +1110,175 @@ func (v WebServerConfigView) Handlers() views.MapFn[string, *HTTPHandler, HTTPHa
 var _WebServerConfigViewNeedsRegeneration = WebServerConfig(struct {
 	Handlers map[string]*HTTPHandler
 }{})
+
+// View returns a read-only view of FunnelSchedule.
+func (p *FunnelSchedule) View() FunnelScheduleView {
+	return FunnelScheduleView{ж: p}
+}
+
+// FunnelScheduleView provides a read-only view over FunnelSchedule.
+//
+// Its methods should only be called if `Valid()` returns true.
+type FunnelScheduleView struct {
+	// ж is the underlying mutable value, named with a hard-to-type
+	// character that looks pointy like a pointer.
+	// It is named distinctively to make you think of how dangerous it is to escape
+	// to callers. You must not let callers be able to mutate it.
+	ж *FunnelSchedule
+}
+
+// Valid reports whether v's underlying value is non-nil.
+func (v FunnelScheduleView) Valid() bool { return v.ж != nil }
+
+// AsStruct returns a clone of the underlying value which aliases no memory with
+// the original.
+func (v FunnelScheduleView) AsStruct() *FunnelSchedule {
+	if v.ж == nil {
+		return nil
+	}
+	return v.ж.Clone()
+}
+
+// MarshalJSON implements [jsonv1.Marshaler].
+func (v FunnelScheduleView) MarshalJSON() ([]byte, error) {
+	return jsonv1.Marshal(v.ж)
+}
+
+// MarshalJSONTo implements [jsonv2.MarshalerTo].
+func (v FunnelScheduleView) MarshalJSONTo(enc *jsontext.Encoder) error {
+	return jsonv2.MarshalEncode(enc, v.ж)
+}
+
+// UnmarshalJSON implements [jsonv1.Unmarshaler].
+func (v *FunnelScheduleView) UnmarshalJSON(b []byte) error {
+	if v.ж != nil {
+		return errors.New("already initialized")
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	var x FunnelSchedule
+	if err := jsonv1.Unmarshal(b, &x); err != nil {
+		return err
+	}
+	v.ж = &x
+	return nil
+}
+
+// UnmarshalJSONFrom implements [jsonv2.UnmarshalerFrom].
+func (v *FunnelScheduleView) UnmarshalJSONFrom(dec *jsontext.Decoder) error {
+	if v.ж != nil {
+		return errors.New("already initialized")
+	}
+	var x FunnelSchedule
+	if err := jsonv2.UnmarshalDecode(dec, &x); err != nil {
+		return err
+	}
+	v.ж = &x
+	return nil
+}
+
+// TimeZone is the IANA name of the time zone of the Windows, such as
+// "America/New_York". Empty means the node's local time zone.
+func (v FunnelScheduleView) TimeZone() string { return v.ж.TimeZone }
+
+// Windows are the recurring windows of time during which Funnel is on.
+// They may overlap.
+func (v FunnelScheduleView) Windows() views.Slice[FunnelWindow] { return views.SliceOf(v.ж.Windows) }
+
+// A compilation failure here means this code must be regenerated, with the command at the top of this file.
+var _FunnelScheduleViewNeedsRegeneration = FunnelSchedule(struct {
+	TimeZone string
+	Windows  []FunnelWindow
+}{})
+
+// View returns a read-only view of PeerIdlePrefs.
+func (p *PeerIdlePrefs) View() PeerIdlePrefsView {
+	return PeerIdlePrefsView{ж: p}
+}
+
+// PeerIdlePrefsView provides a read-only view over PeerIdlePrefs.
+//
+// Its methods should only be called if `Valid()` returns true.
+type PeerIdlePrefsView struct {
+	// ж is the underlying mutable value, named with a hard-to-type
+	// character that looks pointy like a pointer.
+	// It is named distinctively to make you think of how dangerous it is to escape
+	// to callers. You must not let callers be able to mutate it.
+	ж *PeerIdlePrefs
+}
+
+// Valid reports whether v's underlying value is non-nil.
+func (v PeerIdlePrefsView) Valid() bool { return v.ж != nil }
+
+// AsStruct returns a clone of the underlying value which aliases no memory with
+// the original.
+func (v PeerIdlePrefsView) AsStruct() *PeerIdlePrefs {
+	if v.ж == nil {
+		return nil
+	}
+	return v.ж.Clone()
+}
+
+// MarshalJSON implements [jsonv1.Marshaler].
+func (v PeerIdlePrefsView) MarshalJSON() ([]byte, error) {
+	return jsonv1.Marshal(v.ж)
+}
+
+// MarshalJSONTo implements [jsonv2.MarshalerTo].
+func (v PeerIdlePrefsView) MarshalJSONTo(enc *jsontext.Encoder) error {
+	return jsonv2.MarshalEncode(enc, v.ж)
+}
+
+// UnmarshalJSON implements [jsonv1.Unmarshaler].
+func (v *PeerIdlePrefsView) UnmarshalJSON(b []byte) error {
+	if v.ж != nil {
+		return errors.New("already initialized")
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	var x PeerIdlePrefs
+	if err := jsonv1.Unmarshal(b, &x); err != nil {
+		return err
+	}
+	v.ж = &x
+	return nil
+}
+
+// UnmarshalJSONFrom implements [jsonv2.UnmarshalerFrom].
+func (v *PeerIdlePrefsView) UnmarshalJSONFrom(dec *jsontext.Decoder) error {
+	if v.ж != nil {
+		return errors.New("already initialized")
+	}
+	var x PeerIdlePrefs
+	if err := jsonv2.UnmarshalDecode(dec, &x); err != nil {
+		return err
+	}
+	v.ж = &x
+	return nil
+}
+
+// Timeout, if non-zero, is how long a peer may go without sending or
+// receiving traffic before its session is torn down. It must be at
+// least MinPeerIdleTimeout.
+func (v PeerIdlePrefsView) Timeout() time.Duration { return v.ж.Timeout }
+
+// MaxActive, if non-zero, is the maximum number of peers to keep
+// sessions with. Beyond it, the sessions of the least recently active
+// peers are torn down. It's enforced periodically, so it may be exceeded
+// for a few seconds at a time.
+func (v PeerIdlePrefsView) MaxActive() int { return v.ж.MaxActive }
+
+// AlwaysOn are peers whose sessions are never torn down for Timeout or
+// MaxActive. They still count towards MaxActive.
+func (v PeerIdlePrefsView) AlwaysOn() views.Slice[tailcfg.StableNodeID] {
+	return views.SliceOf(v.ж.AlwaysOn)
+}
+
+// A compilation failure here means this code must be regenerated, with the command at the top of this file.
+var _PeerIdlePrefsViewNeedsRegeneration = PeerIdlePrefs(struct {
+	Timeout   time.Duration
+	MaxActive int
+	AlwaysOn  []tailcfg.StableNodeID
+}{})
@@ -69,7 +69,8 @@ type ConnIdentity struct {
 	// Used on Windows:
 	// TODO(bradfitz): merge these into the peercreds package and
 	// use that for all.
-	pid int
+	pid      int
+	readonly bool // member of a read-only group; see safesocket.SetWindowsPipeGroups
 }
 
 // WindowsUserID returns the local machine's userid of the connection
@@ -165,9 +166,10 @@ func LookupUserFromID(logf logger.Logf, uid string) (*user.User, error) {
 // TODO(bradfitz): rename it? Also make Windows use this.
 func (ci *ConnIdentity) IsReadonlyConn(operatorUID string, logf logger.Logf) bool {
 	if runtime.GOOS == "windows" {
-		// Windows doesn't need/use this mechanism, at least yet. It
-		// has a different last-user-wins auth model.
-		return false
+		// Windows has a different last-user-wins auth model, except
+		// for members of the groups that policy allows to connect
+		// with read-only access.
+		return ci.readonly
 	}
 	const ro = true
 	const rw = false
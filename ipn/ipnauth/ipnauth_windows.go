@@ -35,9 +35,69 @@ func GetConnIdentity(logf logger.Logf, c net.Conn) (ci *ConnIdentity, err error)
 	if err != nil {
 		return nil, err
 	}
+	if groups := safesocket.WindowsPipeGroups(); len(groups) > 0 {
+		ci.readonly = isReadonlyPipeClient(logf, wcc, groups)
+	}
 	return ci, nil
 }
 
+// isReadonlyPipeClient reports whether the client of wcc may only connect to
+// the pipe as a member of one of groups, which only have read-only access to
+// the LocalAPI. LocalSystem, elevated administrators and members of the users
+// and groups that may connect to the pipe anyway keep their usual access.
+// If that can't be determined, the client is read-only.
+func isReadonlyPipeClient(logf logger.Logf, wcc *safesocket.WindowsClientConn, groups []*windows.SID) bool {
+	const ro = true
+	const rw = false
+	tok, err := wcc.Token()
+	if err != nil {
+		logf("connection from client with unknown token; read-only; %v", err)
+		return ro
+	}
+	t := newToken(tok)
+	defer t.Close()
+	if t.IsLocalSystem() || t.IsElevated() {
+		return rw
+	}
+	defaults, err := safesocket.WindowsPipeDefaultSIDs()
+	if err != nil {
+		logf("connection from client with unknown default pipe access; read-only; %v", err)
+		return ro
+	}
+	readonly, err := pipeClientReadonly(t.t.IsMember, defaults, groups)
+	if err != nil {
+		logf("connection from client of unknown group membership; read-only; %v", err)
+		return ro
+	}
+	return readonly
+}
+
+// pipeClientReadonly reports whether a pipe client, whose membership of a
+// group isMember reports, has access to the pipe only through one of the
+// read-only groups, and not through any of the default users and groups in
+// defaults.
+func pipeClientReadonly(isMember func(*windows.SID) (bool, error), defaults, groups []*windows.SID) (bool, error) {
+	for _, sid := range defaults {
+		ok, err := isMember(sid)
+		if err != nil {
+			return true, fmt.Errorf("%v: %w", sid, err)
+		}
+		if ok {
+			return false, nil
+		}
+	}
+	for _, sid := range groups {
+		ok, err := isMember(sid)
+		if err != nil {
+			return true, fmt.Errorf("%v: %w", sid, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 type token struct {
 	t windows.Token
 }
@@ -0,0 +1,64 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnauth
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestPipeClientReadonly(t *testing.T) {
+	sid := func(s string) *windows.SID {
+		t.Helper()
+		sid, err := windows.StringToSid(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sid
+	}
+	users := sid("S-1-5-32-545")             // BUILTIN\Users
+	system := sid("S-1-5-18")                // LocalSystem
+	monitoring := sid("S-1-5-21-1-2-3-1001") // a read-only group
+	other := sid("S-1-5-21-1-2-3-1002")      // an unrelated group
+	defaults := []*windows.SID{users, system}
+	groups := []*windows.SID{monitoring}
+
+	tests := []struct {
+		name      string
+		memberOf  []*windows.SID
+		memberErr bool
+		want      bool
+	}{
+		{"group-only", []*windows.SID{monitoring}, false, true},
+		{"group-and-users", []*windows.SID{monitoring, users}, false, false},
+		{"users-only", []*windows.SID{users}, false, false},
+		{"system", []*windows.SID{system, monitoring}, false, false},
+		{"neither", []*windows.SID{other}, false, false},
+		{"unknown-membership", nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isMember := func(s *windows.SID) (bool, error) {
+				if tt.memberErr {
+					return false, errors.New("no token")
+				}
+				for _, m := range tt.memberOf {
+					if m.Equals(s) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+			got, err := pipeClientReadonly(isMember, defaults, groups)
+			if (err != nil) != tt.memberErr {
+				t.Errorf("err = %v; want error %v", err, tt.memberErr)
+			}
+			if got != tt.want {
+				t.Errorf("readonly = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -98,6 +98,61 @@ func (b *LocalBackend) GetCertPEM(ctx context.Context, domain string) (*TLSCertK
 	return b.GetCertPEMWithValidity(ctx, domain, 0)
 }
 
+// CertKeyType is the type of private key a TLS certificate is issued for.
+type CertKeyType string
+
+const (
+	CertKeyECDSA CertKeyType = "ecdsa" // ECDSA with P-256; the default
+	CertKeyRSA   CertKeyType = "rsa"   // 2048 bit RSA, for older TLS clients
+)
+
+// ParseCertKeyType parses a CertKeyType. The empty string is CertKeyECDSA.
+func ParseCertKeyType(s string) (CertKeyType, error) {
+	switch kt := CertKeyType(s); kt {
+	case "":
+		return CertKeyECDSA, nil
+	case CertKeyECDSA, CertKeyRSA:
+		return kt, nil
+	}
+	return "", fmt.Errorf("unknown cert key type %q; want %q or %q", s, CertKeyECDSA, CertKeyRSA)
+}
+
+// storageName returns the name under which the cert and key for domain with
+// a key of type kt are stored. ECDSA ones are stored under the domain
+// itself, as they were before other key types were supported.
+func (kt CertKeyType) storageName(domain string) string {
+	if kt == CertKeyRSA {
+		return domain + ".rsa"
+	}
+	return domain
+}
+
+// generateKey returns a new private key of type kt, and its PEM encoding.
+func (kt CertKeyType) generateKey() (crypto.Signer, []byte, error) {
+	var buf bytes.Buffer
+	switch kt {
+	case CertKeyRSA:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, nil, err
+		}
+		pb := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		if err := pem.Encode(&buf, pb); err != nil {
+			return nil, nil, err
+		}
+		return key, buf.Bytes(), nil
+	default:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := encodeECDSAKey(&buf, key); err != nil {
+			return nil, nil, err
+		}
+		return key, buf.Bytes(), nil
+	}
+}
+
 // GetCertPEMWithValidity gets the TLSCertKeyPair for domain, either from cache
 // or via the ACME process. ACME process is used for new domain certs, existing
 // expired certs or existing certs that should get renewed sooner than
@@ -113,6 +168,13 @@ func (b *LocalBackend) GetCertPEM(ctx context.Context, domain string) (*TLSCertK
 //
 // The wildcard format requires the NodeAttrDNSSubdomainResolve capability.
 func (b *LocalBackend) GetCertPEMWithValidity(ctx context.Context, domain string, minValidity time.Duration) (*TLSCertKeyPair, error) {
+	return b.GetCertPEMWithOptions(ctx, domain, CertKeyECDSA, minValidity)
+}
+
+// GetCertPEMWithOptions is like GetCertPEMWithValidity, but gets a cert for
+// a private key of type kt. Certs for each key type are cached and renewed
+// separately.
+func (b *LocalBackend) GetCertPEMWithOptions(ctx context.Context, domain string, kt CertKeyType, minValidity time.Duration) (*TLSCertKeyPair, error) {
 	b.mu.Lock()
 	getCertForTest := b.getCertForTest
 	b.mu.Unlock()
@@ -145,13 +207,27 @@ func (b *LocalBackend) GetCertPEMWithValidity(ctx context.Context, domain string
 		return nil, err
 	}
 
-	if pair, err := getCertPEMCached(cs, certDomain, now); err == nil {
-		if envknob.IsCertShareReadOnlyMode() {
+	// In read-only cert share mode, or if another node sharing our state
+	// store holds the cert issuer lease, we never issue or renew certs
+	// ourselves and only use what's in the cert store.
+	readOnly := envknob.IsCertShareReadOnlyMode()
+	var follower bool
+	if !readOnly {
+		issuer, err := b.isCertIssuer(ctx, now)
+		if err != nil {
+			return nil, err
+		}
+		follower = !issuer
+		readOnly = follower
+	}
+
+	if pair, err := getCertPEMCached(cs, certDomain, kt, now); err == nil {
+		if readOnly {
 			return pair, nil
 		}
 		// If we got here, we have a valid unexpired cert.
 		// Check whether we should start an async renewal.
-		shouldRenew, err := b.shouldStartDomainRenewal(cs, certDomain, now, pair, minValidity)
+		shouldRenew, err := b.shouldStartDomainRenewal(cs, kt.storageName(certDomain), now, pair, minValidity)
 		if err != nil {
 			logf("error checking for certificate renewal: %v", err)
 			// Renewal check failed, but the current cert is valid and not
@@ -165,7 +241,7 @@ func (b *LocalBackend) GetCertPEMWithValidity(ctx context.Context, domain string
 			logf("starting async renewal")
 			// Start renewal in the background, return current valid cert.
 			b.goTracker.Go(func() {
-				if _, err := getCertPEM(context.Background(), b, cs, logf, traceACME, certDomain, now, minValidity); err != nil {
+				if _, err := getCertPEM(context.Background(), b, cs, logf, traceACME, certDomain, kt, now, minValidity); err != nil {
 					logf("async renewal failed: getCertPem: %v", err)
 				}
 			})
@@ -176,11 +252,15 @@ func (b *LocalBackend) GetCertPEMWithValidity(ctx context.Context, domain string
 		logf("starting sync renewal")
 	}
 
-	if envknob.IsCertShareReadOnlyMode() {
+	if follower {
+		logf("waiting for cert issued by cert issuer lease holder")
+		return b.waitForSharedCert(ctx, cs, certDomain, kt)
+	}
+	if readOnly {
 		return nil, fmt.Errorf("retrieving cached TLS certificate failed and cert store is configured in read-only mode, not attempting to issue a new certificate: %w", err)
 	}
 
-	pair, err := getCertPEM(ctx, b, cs, logf, traceACME, certDomain, now, minValidity)
+	pair, err := getCertPEM(ctx, b, cs, logf, traceACME, certDomain, kt, now, minValidity)
 	if err != nil {
 		logf("getCertPEM: %v", err)
 		return nil, err
@@ -190,6 +270,7 @@ func (b *LocalBackend) GetCertPEMWithValidity(ctx context.Context, domain string
 
 // shouldStartDomainRenewal reports whether the domain's cert should be renewed
 // based on the current time, the cert's expiry, and the ARI check.
+// The domain is the cert's storage name; see CertKeyType.storageName.
 func (b *LocalBackend) shouldStartDomainRenewal(cs certStore, domain string, now time.Time, pair *TLSCertKeyPair, minValidity time.Duration) (bool, error) {
 	if minValidity != 0 {
 		cert, err := pair.parseCertificate()
@@ -284,17 +365,17 @@ func (b *LocalBackend) domainRenewalTimeByARI(cs certStore, pair *TLSCertKeyPair
 // As of 2023-02-01, we use store certs in directories on disk everywhere
 // except on Kubernetes, where we use the state store.
 type certStore interface {
-	// Read returns the cert and key for domain, if they exist and are valid
-	// for now. If they're expired, it returns errCertExpired.
+	// Read returns the cert and key of type kt for domain, if they exist
+	// and are valid for now. If they're expired, it returns errCertExpired.
 	// If they don't exist, it returns ipn.ErrStateNotExist.
-	Read(domain string, now time.Time) (*TLSCertKeyPair, error)
+	Read(domain string, kt CertKeyType, now time.Time) (*TLSCertKeyPair, error)
 	// ACMEKey returns the value previously stored via WriteACMEKey.
 	// It is a PEM encoded ECDSA key.
 	ACMEKey() ([]byte, error)
 	// WriteACMEKey stores the provided PEM encoded ECDSA key.
 	WriteACMEKey([]byte) error
-	// WriteTLSCertAndKey writes the cert and key for domain.
-	WriteTLSCertAndKey(domain string, cert, key []byte) error
+	// WriteTLSCertAndKey writes the cert and key of type kt for domain.
+	WriteTLSCertAndKey(domain string, kt CertKeyType, cert, key []byte) error
 }
 
 var errCertExpired = errors.New("cert expired")
@@ -302,6 +383,11 @@ type certStore interface {
 var testX509Roots *x509.CertPool // set non-nil by tests
 
 func (b *LocalBackend) getCertStore() (certStore, error) {
+	if envknob.IsCertShareLeaseMode() {
+		// Certs must live in the state store shared with the other
+		// nodes participating in the cert issuer lease.
+		return certStateStore{StateStore: b.store, testRoots: testX509Roots}, nil
+	}
 	switch b.store.(type) {
 	case *store.FileStore:
 	case *mem.Store:
@@ -361,15 +447,16 @@ func (f certFileStore) WriteACMEKey(b []byte) error {
 	return atomicfile.WriteFile(pemName, b, 0600)
 }
 
-func (f certFileStore) Read(domain string, now time.Time) (*TLSCertKeyPair, error) {
-	certPEM, err := os.ReadFile(certFile(f.dir, domain))
+func (f certFileStore) Read(domain string, kt CertKeyType, now time.Time) (*TLSCertKeyPair, error) {
+	name := kt.storageName(domain)
+	certPEM, err := os.ReadFile(certFile(f.dir, name))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, ipn.ErrStateNotExist
 		}
 		return nil, err
 	}
-	keyPEM, err := os.ReadFile(keyFile(f.dir, domain))
+	keyPEM, err := os.ReadFile(keyFile(f.dir, name))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, ipn.ErrStateNotExist
@@ -390,11 +477,12 @@ func (f certFileStore) WriteKey(domain string, key []byte) error {
 	return atomicfile.WriteFile(keyFile(f.dir, domain), key, 0600)
 }
 
-func (f certFileStore) WriteTLSCertAndKey(domain string, cert, key []byte) error {
-	if err := f.WriteKey(domain, key); err != nil {
+func (f certFileStore) WriteTLSCertAndKey(domain string, kt CertKeyType, cert, key []byte) error {
+	name := kt.storageName(domain)
+	if err := f.WriteKey(name, key); err != nil {
 		return err
 	}
-	return f.WriteCert(domain, cert)
+	return f.WriteCert(name, cert)
 }
 
 // certStateStore implements certStore by storing the cert & key files in an ipn.StateStore.
@@ -415,9 +503,10 @@ type TLSCertKeyReader interface {
 	ReadTLSCertAndKey(domain string) ([]byte, []byte, error)
 }
 
-func (s certStateStore) Read(domain string, now time.Time) (*TLSCertKeyPair, error) {
-	// If we're using a store that supports atomic reads, use that
-	if kr, ok := s.StateStore.(TLSCertKeyReader); ok {
+func (s certStateStore) Read(domain string, kt CertKeyType, now time.Time) (*TLSCertKeyPair, error) {
+	// If we're using a store that supports atomic reads, use that.
+	// Such stores only hold ECDSA certs in their TLS-specific storage.
+	if kr, ok := s.StateStore.(TLSCertKeyReader); ok && kt == CertKeyECDSA {
 		cert, key, err := kr.ReadTLSCertAndKey(domain)
 		if err != nil {
 			return nil, err
@@ -429,11 +518,12 @@ func (s certStateStore) Read(domain string, now time.Time) (*TLSCertKeyPair, err
 	}
 
 	// Otherwise fall back to separate reads
-	certPEM, err := s.ReadState(ipn.StateKey(domain + ".crt"))
+	name := kt.storageName(domain)
+	certPEM, err := s.ReadState(ipn.StateKey(name + ".crt"))
 	if err != nil {
 		return nil, err
 	}
-	keyPEM, err := s.ReadState(ipn.StateKey(domain + ".key"))
+	keyPEM, err := s.ReadState(ipn.StateKey(name + ".key"))
 	if err != nil {
 		return nil, err
 	}
@@ -468,16 +558,17 @@ type TLSCertKeyWriter interface {
 
 // WriteTLSCertAndKey writes the TLS cert and key for domain to the current
 // LocalBackend's StateStore.
-func (s certStateStore) WriteTLSCertAndKey(domain string, cert, key []byte) error {
+func (s certStateStore) WriteTLSCertAndKey(domain string, kt CertKeyType, cert, key []byte) error {
 	// If we're using a store that supports atomic writes, use that.
-	if aw, ok := s.StateStore.(TLSCertKeyWriter); ok {
+	if aw, ok := s.StateStore.(TLSCertKeyWriter); ok && kt == CertKeyECDSA {
 		return aw.WriteTLSCertAndKey(domain, cert, key)
 	}
 	// Otherwise fall back to separate writes for cert and key.
-	if err := s.WriteKey(domain, key); err != nil {
+	name := kt.storageName(domain)
+	if err := s.WriteKey(name, key); err != nil {
 		return err
 	}
-	return s.WriteCert(domain, cert)
+	return s.WriteCert(name, cert)
 }
 
 // TLSCertKeyPair is a TLS public and private key, and whether they were obtained
@@ -506,24 +597,24 @@ func certFile(dir, domain string) string {
 	return filepath.Join(dir, strings.Replace(domain, "*.", "wildcard_.", 1)+".crt")
 }
 
-// getCertPEMCached returns a non-nil keyPair if a cached keypair for domain
-// exists on disk in dir that is valid at the provided now time.
+// getCertPEMCached returns a non-nil keyPair if a cached keypair of type kt
+// for domain exists in cs that is valid at the provided now time.
 //
 // If the keypair is expired, it returns errCertExpired.
 // If the keypair doesn't exist, it returns ipn.ErrStateNotExist.
-func getCertPEMCached(cs certStore, domain string, now time.Time) (p *TLSCertKeyPair, err error) {
+func getCertPEMCached(cs certStore, domain string, kt CertKeyType, now time.Time) (p *TLSCertKeyPair, err error) {
 	if !validLookingCertDomain(domain) {
 		// Before we read files from disk using it, validate it's halfway
 		// reasonable looking.
 		return nil, fmt.Errorf("invalid domain %q", domain)
 	}
-	return cs.Read(domain, now)
+	return cs.Read(domain, kt, now)
 }
 
 // getCertPem checks if a cert needs to be renewed and if so, renews it.
 // domain is the resolved cert domain (e.g., "*.node.ts.net" for wildcards).
 // It can be overridden in tests.
-var getCertPEM = func(ctx context.Context, b *LocalBackend, cs certStore, logf logger.Logf, traceACME func(any), domain string, now time.Time, minValidity time.Duration) (*TLSCertKeyPair, error) {
+var getCertPEM = func(ctx context.Context, b *LocalBackend, cs certStore, logf logger.Logf, traceACME func(any), domain string, kt CertKeyType, now time.Time, minValidity time.Duration) (*TLSCertKeyPair, error) {
 	acmeMu.Lock()
 	defer acmeMu.Unlock()
 
@@ -532,11 +623,11 @@ func getCertPEMCached(cs certStore, domain string, now time.Time) (p *TLSCertKey
 	// In case this method was triggered multiple times in parallel (when
 	// serving incoming requests), check whether one of the other goroutines
 	// already renewed the cert before us.
-	previous, err := getCertPEMCached(cs, domain, now)
+	previous, err := getCertPEMCached(cs, domain, kt, now)
 	if err == nil {
 		// shouldStartDomainRenewal caches its result so it's OK to call this
 		// frequently.
-		shouldRenew, err := b.shouldStartDomainRenewal(cs, domain, now, previous, minValidity)
+		shouldRenew, err := b.shouldStartDomainRenewal(cs, kt.storageName(domain), now, previous, minValidity)
 		if err != nil {
 			logf("error checking for certificate renewal: %v", err)
 		} else if !shouldRenew {
@@ -668,14 +759,10 @@ func getCertPEMCached(cs certStore, domain string, now time.Time) (p *TLSCertKey
 	}
 	traceACME(order)
 
-	certPrivKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	certPrivKey, privPEM, err := kt.generateKey()
 	if err != nil {
 		return nil, err
 	}
-	var privPEM bytes.Buffer
-	if err := encodeECDSAKey(&privPEM, certPrivKey); err != nil {
-		return nil, err
-	}
 
 	csr, err := certRequest(certPrivKey, domain, nil)
 	if err != nil {
@@ -697,12 +784,12 @@ func getCertPEMCached(cs certStore, domain string, now time.Time) (p *TLSCertKey
 			return nil, err
 		}
 	}
-	if err := cs.WriteTLSCertAndKey(domain, certPEM.Bytes(), privPEM.Bytes()); err != nil {
+	if err := cs.WriteTLSCertAndKey(domain, kt, certPEM.Bytes(), privPEM); err != nil {
 		return nil, err
 	}
-	b.domainRenewed(domain)
+	b.domainRenewed(kt.storageName(domain))
 
-	return &TLSCertKeyPair{CertPEM: certPEM.Bytes(), KeyPEM: privPEM.Bytes()}, nil
+	return &TLSCertKeyPair{CertPEM: certPEM.Bytes(), KeyPEM: privPEM}, nil
 }
 
 // certRequest generates a CSR for the given domain and optional SANs.
@@ -958,7 +1045,7 @@ func handleC2NTLSCertStatus(b *LocalBackend, w http.ResponseWriter, r *http.Requ
 	}
 
 	ret := &tailcfg.C2NTLSCertInfo{}
-	pair, err := getCertPEMCached(cs, domain, b.clock.Now())
+	pair, err := getCertPEMCached(cs, domain, CertKeyECDSA, b.clock.Now())
 	ret.Valid = err == nil
 	if err != nil {
 		ret.Error = err.Error()
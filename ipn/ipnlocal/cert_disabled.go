@@ -31,7 +31,9 @@ func (b *LocalBackend) GetCertPEM(ctx context.Context, domain string) (*TLSCertK
 
 type certStore interface{}
 
-func getCertPEMCached(cs certStore, domain string, now time.Time) (p *TLSCertKeyPair, err error) {
+type CertKeyType string
+
+func getCertPEMCached(cs certStore, domain string, kt CertKeyType, now time.Time) (p *TLSCertKeyPair, err error) {
 	return nil, errNoCerts
 }
 
@@ -0,0 +1,178 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !js && !ts_omit_acme
+
+package ipnlocal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/ipn"
+)
+
+// certLeaseKey is the state store key holding the lease that decides which of
+// the nodes sharing a state store issues and renews TLS certs, when
+// TS_CERT_SHARE_MODE=lease.
+const certLeaseKey = ipn.StateKey("_cert-issuer-lease")
+
+const (
+	// certLeaseDuration is how long a cert issuer lease is valid for
+	// without being refreshed. If the issuer goes away, another node takes
+	// over issuance once its lease expires.
+	certLeaseDuration = 15 * time.Minute
+
+	// certLeaseConfirmDelay is how long a node waits after writing the
+	// lease before reading it back to check that no other node raced it.
+	// State stores have no compare-and-swap, so the last writer wins.
+	certLeaseConfirmDelay = 500 * time.Millisecond
+
+	// certFollowerPollInterval is how often a node that doesn't hold the
+	// lease polls the state store for a cert issued by the lease holder.
+	certFollowerPollInterval = 2 * time.Second
+
+	// certFollowerMaxWait is how long a node that doesn't hold the lease
+	// waits for the lease holder to issue a cert before giving up. If the
+	// holder is gone, a later request takes over issuance once its lease
+	// expires.
+	certFollowerMaxWait = 2 * time.Minute
+)
+
+// certLease is the JSON value stored under certLeaseKey.
+type certLease struct {
+	Holder  string    // certLeaseHolder of the issuing node
+	Expires time.Time // when the lease lapses if not refreshed
+}
+
+// certLeaseHolder returns the identity this node uses in the cert issuer
+// lease: its StableID, which unlike its hostname is unique among the nodes
+// sharing a state store.
+func (b *LocalBackend) certLeaseHolder() (string, error) {
+	self := b.currentNode().Self()
+	if !self.Valid() || self.StableID() == "" {
+		return "", errors.New("cert issuer lease: node has no StableID yet; not logged in?")
+	}
+	return string(self.StableID()), nil
+}
+
+// readCertLease returns the cert issuer lease in st. It returns a zero lease
+// if there is none or it can't be parsed.
+func readCertLease(st ipn.StateStore) (certLease, error) {
+	var l certLease
+	bs, err := st.ReadState(certLeaseKey)
+	if errors.Is(err, ipn.ErrStateNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(bs, &l); err != nil {
+		// A corrupt lease is treated as expired so that someone can
+		// take over issuance.
+		return certLease{}, nil
+	}
+	return l, nil
+}
+
+// acquireCertLease reports whether holder holds the cert issuer lease in st,
+// taking or refreshing it if possible.
+//
+// sleep is used to wait before confirming a newly written lease; it's
+// overridden in tests.
+func acquireCertLease(ctx context.Context, st ipn.StateStore, holder string, now time.Time, sleep func(context.Context, time.Duration) error) (bool, error) {
+	cur, err := readCertLease(st)
+	if err != nil {
+		return false, fmt.Errorf("reading cert lease: %w", err)
+	}
+	if cur.Holder != holder && now.Before(cur.Expires) {
+		return false, nil // someone else holds a live lease
+	}
+	if cur.Holder == holder && cur.Expires.Sub(now) > certLeaseDuration/2 {
+		return true, nil // ours, and not yet due for refresh
+	}
+
+	bs, err := json.Marshal(certLease{Holder: holder, Expires: now.Add(certLeaseDuration)})
+	if err != nil {
+		return false, err
+	}
+	if err := ipn.WriteState(st, certLeaseKey, bs); err != nil {
+		return false, fmt.Errorf("writing cert lease: %w", err)
+	}
+	if cur.Holder == holder {
+		// Refreshing our own live lease; nobody else would have
+		// written it.
+		return true, nil
+	}
+	if err := sleep(ctx, certLeaseConfirmDelay); err != nil {
+		return false, err
+	}
+	got, err := readCertLease(st)
+	if err != nil {
+		return false, fmt.Errorf("confirming cert lease: %w", err)
+	}
+	return got.Holder == holder, nil
+}
+
+// isCertIssuer reports whether this node should issue and renew certs itself.
+// It always does unless TS_CERT_SHARE_MODE=lease and another node holds the
+// cert issuer lease.
+func (b *LocalBackend) isCertIssuer(ctx context.Context, now time.Time) (bool, error) {
+	if !envknob.IsCertShareLeaseMode() {
+		return true, nil
+	}
+	holder, err := b.certLeaseHolder()
+	if err != nil {
+		return false, err
+	}
+	return acquireCertLease(ctx, b.store, holder, now, sleepCtx)
+}
+
+// waitForSharedCert waits for a valid cert of type kt for domain to be issued
+// by the cert issuer lease holder. It's used by nodes that don't hold the
+// lease.
+func (b *LocalBackend) waitForSharedCert(ctx context.Context, cs certStore, domain string, kt CertKeyType) (*TLSCertKeyPair, error) {
+	return waitForSharedCert(ctx, b.store, cs, domain, kt, b.clock.Now, sleepCtx)
+}
+
+// waitForSharedCert polls cs for a valid cert of type kt for domain until one
+// appears, ctx is done or certFollowerMaxWait passes. The cert issuer lease in
+// st is only used to name the holder in errors.
+//
+// sleep is used to wait between polls; it's overridden in tests.
+func waitForSharedCert(ctx context.Context, st ipn.StateStore, cs certStore, domain string, kt CertKeyType, now func() time.Time, sleep func(context.Context, time.Duration) error) (*TLSCertKeyPair, error) {
+	for waited := time.Duration(0); ; waited += certFollowerPollInterval {
+		pair, err := getCertPEMCached(cs, domain, kt, now())
+		if err == nil {
+			return pair, nil
+		}
+		if !errors.Is(err, ipn.ErrStateNotExist) && !errors.Is(err, errCertExpired) {
+			return nil, err
+		}
+		if waited >= certFollowerMaxWait {
+			holder := "another node"
+			if l, err := readCertLease(st); err == nil && l.Holder != "" {
+				holder = fmt.Sprintf("node %q", l.Holder)
+			}
+			return nil, fmt.Errorf("no valid cert for %q issued by cert issuer lease holder %s after %v; it may be offline or failing to issue certs", domain, holder, certFollowerMaxWait)
+		}
+		if err := sleep(ctx, certFollowerPollInterval); err != nil {
+			return nil, fmt.Errorf("waiting for cert issued by another node: %w", err)
+		}
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
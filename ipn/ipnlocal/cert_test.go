@@ -6,23 +6,30 @@
 package ipnlocal
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"embed"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"math/big"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"tailscale.com/envknob"
+	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/mem"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tstest"
@@ -301,10 +308,10 @@ func TestCertStoreRoundTrip(t *testing.T) {
 			if test.debugACMEURL {
 				t.Setenv("TS_DEBUG_ACME_DIRECTORY_URL", "https://acme-staging-v02.api.letsencrypt.org/directory")
 			}
-			if err := test.store.WriteTLSCertAndKey(testDomain, testCert, testKey); err != nil {
+			if err := test.store.WriteTLSCertAndKey(testDomain, CertKeyECDSA, testCert, testKey); err != nil {
 				t.Fatalf("WriteTLSCertAndKey: unexpected error: %v", err)
 			}
-			kp, err := test.store.Read(testDomain, testNow)
+			kp, err := test.store.Read(testDomain, CertKeyECDSA, testNow)
 			if err != nil {
 				t.Fatalf("Read: unexpected error: %v", err)
 			}
@@ -314,14 +321,55 @@ func TestCertStoreRoundTrip(t *testing.T) {
 			if diff := cmp.Diff(kp.KeyPEM, testKey); diff != "" {
 				t.Errorf("Key (-got, +want):\n%s", diff)
 			}
-			unexpected, err := test.store.Read(testDomain, testExpired)
+			unexpected, err := test.store.Read(testDomain, CertKeyECDSA, testExpired)
 			if err != errCertExpired {
 				t.Fatalf("Read: expected expiry error: %v", string(unexpected.CertPEM))
 			}
+			// Certs for other key types are stored separately.
+			if _, err := test.store.Read(testDomain, CertKeyRSA, testNow); !errors.Is(err, ipn.ErrStateNotExist) {
+				t.Errorf("Read(CertKeyRSA) = %v; want ErrStateNotExist", err)
+			}
 		})
 	}
 }
 
+func TestCertKeyTypeGenerateKey(t *testing.T) {
+	for _, kt := range []CertKeyType{CertKeyECDSA, CertKeyRSA} {
+		signer, keyPEM, err := kt.generateKey()
+		if err != nil {
+			t.Fatalf("%s: generateKey: %v", kt, err)
+		}
+		block, _ := pem.Decode(keyPEM)
+		if block == nil {
+			t.Fatalf("%s: key isn't PEM encoded", kt)
+		}
+		parsed, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			t.Fatalf("%s: parsePrivateKey: %v", kt, err)
+		}
+		var ok bool
+		switch kt {
+		case CertKeyECDSA:
+			_, ok = parsed.(*ecdsa.PrivateKey)
+		case CertKeyRSA:
+			_, ok = parsed.(*rsa.PrivateKey)
+		}
+		if !ok {
+			t.Errorf("%s: parsed key is %T", kt, parsed)
+		}
+		if !parsed.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(signer.Public()) {
+			t.Errorf("%s: PEM key doesn't match returned key", kt)
+		}
+	}
+
+	if _, err := ParseCertKeyType("dsa"); err == nil {
+		t.Errorf("ParseCertKeyType(dsa) succeeded")
+	}
+	if kt, err := ParseCertKeyType(""); err != nil || kt != CertKeyECDSA {
+		t.Errorf(`ParseCertKeyType("") = %q, %v; want %q`, kt, err, CertKeyECDSA)
+	}
+}
+
 func TestShouldStartDomainRenewal(t *testing.T) {
 	reset := func() {
 		renewMu.Lock()
@@ -557,7 +605,7 @@ func TestGetCertPEMWithValidity(t *testing.T) {
 			// Set to true if get getCertPEM is called. GetCertPEM can be called in a goroutine for async
 			// renewal or in the main goroutine if issuance is required to obtain valid TLS credentials.
 			getCertPemWasCalled := false
-			getCertPEM = func(ctx context.Context, b *LocalBackend, cs certStore, logf logger.Logf, traceACME func(any), domain string, now time.Time, minValidity time.Duration) (*TLSCertKeyPair, error) {
+			getCertPEM = func(ctx context.Context, b *LocalBackend, cs certStore, logf logger.Logf, traceACME func(any), domain string, kt CertKeyType, now time.Time, minValidity time.Duration) (*TLSCertKeyPair, error) {
 				getCertPemWasCalled = true
 				return nil, nil
 			}
@@ -588,3 +636,163 @@ func TestGetCertPEMWithValidity(t *testing.T) {
 		})
 	}
 }
+
+func TestAcquireCertLease(t *testing.T) {
+	st := new(mem.Store)
+	ctx := context.Background()
+	now := time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC)
+	noSleep := func(context.Context, time.Duration) error { return nil }
+
+	acquire := func(holder string, now time.Time) bool {
+		t.Helper()
+		ok, err := acquireCertLease(ctx, st, holder, now, noSleep)
+		if err != nil {
+			t.Fatalf("acquireCertLease(%q): %v", holder, err)
+		}
+		return ok
+	}
+
+	if !acquire("a", now) {
+		t.Fatal("a did not get unheld lease")
+	}
+	if acquire("b", now.Add(time.Minute)) {
+		t.Fatal("b got lease held by a")
+	}
+	if !acquire("a", now.Add(certLeaseDuration*3/4)) {
+		t.Fatal("a lost its own lease")
+	}
+	// a refreshed its lease above, so it's still live past the original
+	// expiry.
+	if acquire("b", now.Add(certLeaseDuration+time.Minute)) {
+		t.Fatal("b got refreshed lease held by a")
+	}
+	// Once a stops refreshing, b takes over.
+	later := now.Add(3 * certLeaseDuration)
+	if !acquire("b", later) {
+		t.Fatal("b did not take over expired lease")
+	}
+	if acquire("a", later) {
+		t.Fatal("a got lease held by b")
+	}
+
+	// A racing writer that overwrites the lease before it's confirmed wins.
+	// b read the unheld lease before a wrote it, so b's write lands while a
+	// waits to confirm.
+	st = new(mem.Store)
+	raced, err := acquireCertLease(ctx, st, "a", now, func(context.Context, time.Duration) error {
+		bs, err := json.Marshal(certLease{Holder: "b", Expires: now.Add(certLeaseDuration)})
+		if err != nil {
+			return err
+		}
+		return ipn.WriteState(st, certLeaseKey, bs)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raced {
+		t.Error("a got lease after b overwrote it")
+	}
+	if !acquire("b", now) {
+		t.Error("b lost the lease it overwrote")
+	}
+}
+
+func TestWaitForSharedCert(t *testing.T) {
+	const testDomain = "example.com"
+	testNow := time.Date(2023, time.February, 10, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return testNow }
+	ctx := context.Background()
+
+	testRoot, err := certTestFS.ReadFile("testdata/rootCA.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(testRoot) {
+		t.Fatal("Unable to add test CA to the cert pool")
+	}
+	testCert, err := certTestFS.ReadFile("testdata/example.com.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKey, err := certTestFS.ReadFile("testdata/example.com-key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("issued", func(t *testing.T) {
+		st := new(mem.Store)
+		cs := certStateStore{StateStore: st, testRoots: roots}
+		var polls int
+		pair, err := waitForSharedCert(ctx, st, cs, testDomain, CertKeyECDSA, now, func(context.Context, time.Duration) error {
+			polls++
+			if polls == 3 {
+				return cs.WriteTLSCertAndKey(testDomain, CertKeyECDSA, testCert, testKey)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pair.CertPEM, testCert) {
+			t.Error("got wrong cert")
+		}
+		if polls != 3 {
+			t.Errorf("polled %d times; want 3", polls)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		st := new(mem.Store)
+		bs, err := json.Marshal(certLease{Holder: "nStable1", Expires: testNow.Add(certLeaseDuration)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ipn.WriteState(st, certLeaseKey, bs); err != nil {
+			t.Fatal(err)
+		}
+		cs := certStateStore{StateStore: st, testRoots: roots}
+		var polls int
+		_, err = waitForSharedCert(ctx, st, cs, testDomain, CertKeyECDSA, now, func(context.Context, time.Duration) error {
+			polls++
+			return nil
+		})
+		if err == nil {
+			t.Fatal("got cert; want timeout error")
+		}
+		if !strings.Contains(err.Error(), `"nStable1"`) {
+			t.Errorf("error %q doesn't name the lease holder", err)
+		}
+		if want := int(certFollowerMaxWait / certFollowerPollInterval); polls != want {
+			t.Errorf("polled %d times; want %d", polls, want)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		st := new(mem.Store)
+		cs := certStateStore{StateStore: st, testRoots: roots}
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := waitForSharedCert(ctx, st, cs, testDomain, CertKeyECDSA, now, sleepCtx)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v; want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestCertLeaseHolderNeedsStableID(t *testing.T) {
+	b := newTestLocalBackend(t)
+	if h, err := b.certLeaseHolder(); err == nil {
+		t.Fatalf("certLeaseHolder without a netmap = %q; want error", h)
+	}
+	b.currentNode().SetNetMap(&netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{ID: 1, StableID: "nStable1"}).View(),
+	})
+	h, err := b.certLeaseHolder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != "nStable1" {
+		t.Errorf("certLeaseHolder = %q; want %q", h, "nStable1")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"slices"
+
+	"tailscale.com/feature/buildfeatures"
+	"tailscale.com/ipn"
+	"tailscale.com/net/netmon"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/types/views"
+)
+
+// connectedSubnets returns the sorted subnets of the up, non-loopback
+// interfaces in st that should be advertised per prefs'
+// ConnectedSubnetsInclude and ConnectedSubnetsExclude filters.
+//
+// It returns nil if prefs doesn't have AdvertiseConnectedSubnets set.
+func connectedSubnets(st *netmon.State, prefs ipn.PrefsView) []netip.Prefix {
+	if !buildfeatures.HasAdvertiseRoutes || st == nil || !prefs.Valid() || !prefs.AdvertiseConnectedSubnets() {
+		return nil
+	}
+	include := prefs.ConnectedSubnetsInclude()
+	exclude := prefs.ConnectedSubnetsExclude()
+
+	var ret []netip.Prefix
+	for name, pfxs := range st.InterfaceIPs {
+		iface, ok := st.Interface[name]
+		if !ok || !iface.IsUp() || iface.IsLoopback() {
+			continue
+		}
+		for _, pfx := range pfxs {
+			ip := pfx.Addr()
+			if pfx.IsSingleIP() || pfx.Bits() == 0 ||
+				tsaddr.IsTailscaleIP(ip) || ip.IsLoopback() ||
+				ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+				continue
+			}
+			pfx = pfx.Masked()
+			if include.Len() > 0 && !prefixWithinAny(pfx, include) {
+				continue
+			}
+			if slices.ContainsFunc(exclude.AsSlice(), pfx.Overlaps) {
+				continue
+			}
+			if !slices.Contains(ret, pfx) {
+				ret = append(ret, pfx)
+			}
+		}
+	}
+	tsaddr.SortPrefixes(ret)
+	return ret
+}
+
+// prefixWithinAny reports whether pfx is entirely contained within any of
+// the prefixes in outer.
+func prefixWithinAny(pfx netip.Prefix, outer views.Slice[netip.Prefix]) bool {
+	for _, o := range outer.All() {
+		if o.Bits() <= pfx.Bits() && o.Contains(pfx.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// advertisedRoutesLocked returns the routes this node advertises: those in
+// prefs' AdvertiseRoutes, plus its connected subnets if
+// AdvertiseConnectedSubnets is set.
+//
+// b.mu must be held.
+func (b *LocalBackend) advertisedRoutesLocked(prefs ipn.PrefsView) views.Slice[netip.Prefix] {
+	routes := prefs.AdvertiseRoutes()
+	extra := connectedSubnets(b.interfaceState, prefs)
+	if len(extra) == 0 {
+		return routes
+	}
+	all := routes.AsSlice()
+	for _, pfx := range extra {
+		if !slices.Contains(all, pfx) {
+			all = append(all, pfx)
+		}
+	}
+	return views.SliceOf(all)
+}
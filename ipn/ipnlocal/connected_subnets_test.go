@@ -0,0 +1,83 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/net/netmon"
+)
+
+func TestConnectedSubnets(t *testing.T) {
+	pfxs := func(ss ...string) (ret []netip.Prefix) {
+		for _, s := range ss {
+			ret = append(ret, netip.MustParsePrefix(s))
+		}
+		return ret
+	}
+	iface := func(name string, flags net.Flags) netmon.Interface {
+		return netmon.Interface{Interface: &net.Interface{Name: name, Flags: flags}}
+	}
+	st := &netmon.State{
+		Interface: map[string]netmon.Interface{
+			"lo":        iface("lo", net.FlagUp|net.FlagLoopback),
+			"eth0":      iface("eth0", net.FlagUp),
+			"eth1":      iface("eth1", net.FlagUp),
+			"eth2":      iface("eth2", 0), // down
+			"tailscale": iface("tailscale", net.FlagUp),
+		},
+		InterfaceIPs: map[string][]netip.Prefix{
+			"lo":        pfxs("127.0.0.1/8", "::1/128"),
+			"eth0":      pfxs("192.168.1.10/24", "fe80::1/64", "2001:db8:1::10/64"),
+			"eth1":      pfxs("10.1.2.3/16", "192.168.1.11/24"),
+			"eth2":      pfxs("172.16.0.1/24"),
+			"tailscale": pfxs("100.64.0.1/32", "fd7a:115c:a1e0::1/128"),
+		},
+	}
+
+	tests := []struct {
+		name  string
+		prefs ipn.Prefs
+		want  []netip.Prefix
+	}{
+		{
+			name:  "disabled",
+			prefs: ipn.Prefs{},
+			want:  nil,
+		},
+		{
+			name:  "all",
+			prefs: ipn.Prefs{AdvertiseConnectedSubnets: true},
+			want:  pfxs("10.1.0.0/16", "192.168.1.0/24", "2001:db8:1::/64"),
+		},
+		{
+			name: "include",
+			prefs: ipn.Prefs{
+				AdvertiseConnectedSubnets: true,
+				ConnectedSubnetsInclude:   pfxs("192.168.0.0/16", "10.1.2.0/24"),
+			},
+			want: pfxs("192.168.1.0/24"),
+		},
+		{
+			name: "exclude",
+			prefs: ipn.Prefs{
+				AdvertiseConnectedSubnets: true,
+				ConnectedSubnetsExclude:   pfxs("10.1.2.0/24", "::/0"),
+			},
+			want: pfxs("192.168.1.0/24"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := connectedSubnets(st, tt.prefs.View())
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+const (
+	// DefaultDERPFailoverDrillTimeout is how long a DERP failover drill runs
+	// at most, if not specified.
+	DefaultDERPFailoverDrillTimeout = time.Minute
+
+	// maxDERPFailoverDrillTimeout bounds how long a DERP failover drill can
+	// keep the home DERP region unavailable.
+	maxDERPFailoverDrillTimeout = 10 * time.Minute
+
+	// derpDrillPingTimeout bounds each ping during a DERP failover drill.
+	derpDrillPingTimeout = 2 * time.Second
+
+	// derpDrillPollInterval is how often a DERP failover drill checks for a
+	// new home region, and retries pings to peers not yet reached.
+	derpDrillPollInterval = 250 * time.Millisecond
+)
+
+// DERPFailoverDrill tests how this node's connectivity recovers if its home
+// DERP region goes down. It makes the home region unavailable, as if denied
+// by policy, and measures how long it takes to choose a new home region and
+// to reach each of the peers with the Tailscale IPs in targets again.
+//
+// The drill ends once the new home is chosen and all the peers reached, or
+// after timeout, and the old home region is made available again before it
+// returns. Peers whose own home is the old home region can only be reached
+// directly or by peer relay during the drill.
+func (b *LocalBackend) DERPFailoverDrill(ctx context.Context, targets []netip.Addr, timeout time.Duration) (*ipnstate.DERPFailoverDrill, error) {
+	if timeout <= 0 {
+		timeout = DefaultDERPFailoverDrillTimeout
+	}
+	if timeout > maxDERPFailoverDrillTimeout {
+		return nil, fmt.Errorf("timeout %v too long; max %v", timeout, maxDERPFailoverDrillTimeout)
+	}
+	self := b.currentNode().Self()
+	if !self.Valid() {
+		return nil, errors.New("no netmap")
+	}
+	var peers []netip.Addr
+	for _, ip := range targets {
+		if !isSelfAddr(self, ip) && !slices.Contains(peers, ip) {
+			peers = append(peers, ip)
+		}
+	}
+	if len(peers) > maxLatencyMatrixTargets {
+		return nil, fmt.Errorf("too many peers (%d); max %d", len(peers), maxLatencyMatrixTargets)
+	}
+
+	mc := b.MagicConn()
+	dm := b.DERPMap()
+	home := mc.HomeDERPRegion()
+	if home == 0 || dm == nil {
+		return nil, errors.New("no home DERP region")
+	}
+	if len(dm.Regions) < 2 {
+		return nil, errors.New("no other DERP region to fail over to")
+	}
+	regionCode := func(id int) string {
+		if r := dm.Regions[id]; r != nil {
+			return r.RegionCode
+		}
+		return ""
+	}
+
+	res := &ipnstate.DERPFailoverDrill{
+		OldHomeRegionID:   home,
+		OldHomeRegionCode: regionCode(home),
+		Peers:             make([]ipnstate.DERPFailoverDrillPeer, len(peers)),
+	}
+	var wg sync.WaitGroup
+	for i, ip := range peers {
+		res.Peers[i].IP = ip
+		wg.Go(func() {
+			res.Peers[i].Before = b.derpDrillPing(ctx, ip)
+		})
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.logf("DERP failover drill: making home region %d unavailable for up to %v", home, timeout)
+	stop, err := mc.StartDERPFailoverDrill(home)
+	if err != nil {
+		return nil, err
+	}
+	t0 := b.clock.Now()
+	defer func() {
+		stop()
+		res.DurationSeconds = b.clock.Since(t0).Seconds()
+		b.logf("DERP failover drill: done after %.1fs; home region %d available again", res.DurationSeconds, home)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	wait := func() bool {
+		select {
+		case <-time.After(derpDrillPollInterval):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	wg.Go(func() {
+		for {
+			if r := mc.HomeDERPRegion(); r != 0 && r != home {
+				res.NewHomeRegionID = r
+				res.NewHomeRegionCode = regionCode(r)
+				res.HomeFailoverSeconds = b.clock.Since(t0).Seconds()
+				return
+			}
+			if !wait() {
+				return
+			}
+		}
+	})
+	for i, ip := range peers {
+		p := &res.Peers[i]
+		wg.Go(func() {
+			for {
+				pr := b.derpDrillPing(ctx, ip)
+				if pr.Err == "" || p.After == nil || ctx.Err() == nil {
+					// Keep the last result before the drill ended,
+					// not an error about it ending.
+					p.After = pr
+				}
+				if pr.Err == "" {
+					p.Recovered = true
+					p.RecoverySeconds = b.clock.Since(t0).Seconds()
+					return
+				}
+				if !wait() {
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+	return res, nil
+}
+
+// derpDrillPing disco pings the peer with Tailscale IP ip for a DERP failover
+// drill. Failures are reported in the result's Err field.
+func (b *LocalBackend) derpDrillPing(ctx context.Context, ip netip.Addr) *ipnstate.PingResult {
+	ctx, cancel := context.WithTimeout(ctx, derpDrillPingTimeout)
+	defer cancel()
+	pr, err := b.Ping(ctx, ip, tailcfg.PingDisco, 0)
+	if err != nil {
+		return &ipnstate.PingResult{IP: ip.String(), Err: err.Error()}
+	}
+	return pr
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"fmt"
+
+	"tailscale.com/ipn/conffile"
+	"tailscale.com/net/dns"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/syspolicy/pkey"
+	"tailscale.com/util/syspolicy/policyclient"
+)
+
+// dnsOptionsPolicies are the policies that set DNS resolver options.
+var dnsOptionsPolicies = []pkey.Key{
+	pkey.DNSNdots,
+	pkey.DNSTimeout,
+	pkey.DNSAttempts,
+	pkey.DNSSearchOrder,
+}
+
+// dnsOptionsFromConfig returns the DNS resolver options of the config file
+// conf, which may be nil.
+func dnsOptionsFromConfig(conf *conffile.Config) (dns.ResolverOptions, error) {
+	if conf == nil || conf.Parsed.DNSOptions == nil {
+		return dns.ResolverOptions{}, nil
+	}
+	c := conf.Parsed.DNSOptions
+	opts := dns.ResolverOptions{
+		Ndots:       c.Ndots,
+		Timeout:     c.Timeout.Duration,
+		Attempts:    c.Attempts,
+		SearchOrder: dns.SearchOrder(c.SearchOrder),
+	}
+	if err := opts.Check(); err != nil {
+		return dns.ResolverOptions{}, fmt.Errorf("invalid DNSOptions: %w", err)
+	}
+	return opts, nil
+}
+
+// dnsOptionsWithPolicy returns opts with the options that polc sets in place
+// of theirs. If the result is invalid, it logs why and returns opts.
+func dnsOptionsWithPolicy(opts dns.ResolverOptions, polc policyclient.Client, logf logger.Logf) dns.ResolverOptions {
+	with := opts
+	if v, err := polc.GetUint64(pkey.DNSNdots, uint64(opts.Ndots)); err == nil {
+		with.Ndots = int(v)
+	}
+	if v, err := polc.GetDuration(pkey.DNSTimeout, opts.Timeout); err == nil {
+		with.Timeout = v
+	}
+	if v, err := polc.GetUint64(pkey.DNSAttempts, uint64(opts.Attempts)); err == nil {
+		with.Attempts = int(v)
+	}
+	if v, err := polc.GetString(pkey.DNSSearchOrder, string(opts.SearchOrder)); err == nil {
+		with.SearchOrder = dns.SearchOrder(v)
+	}
+	if err := with.Check(); err != nil {
+		logf("syspolicy: ignoring DNS resolver option policies: %v", err)
+		return opts
+	}
+	return with
+}
+
+// updateDNSOptionsLocked updates b.dnsOptions from the config file and
+// policy, and reports whether they changed.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateDNSOptionsLocked() (changed bool) {
+	opts, _ := dnsOptionsFromConfig(b.conf) // checked when b.conf was set
+	opts = dnsOptionsWithPolicy(opts, b.polc, b.logf)
+	if opts == b.dnsOptions {
+		return false
+	}
+	b.logf("DNS resolver options: %+v", opts)
+	b.dnsOptions = opts
+	return true
+}
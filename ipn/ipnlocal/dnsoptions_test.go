@@ -0,0 +1,58 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/conffile"
+	"tailscale.com/net/dns"
+	"tailscale.com/tstime"
+	"tailscale.com/util/syspolicy/pkey"
+	"tailscale.com/util/syspolicy/policytest"
+)
+
+func TestDNSOptions(t *testing.T) {
+	conf := &conffile.Config{Parsed: ipn.ConfigVAlpha{
+		DNSOptions: &ipn.DNSOptions{
+			Ndots:       2,
+			Timeout:     tstime.GoDuration{Duration: 3 * time.Second},
+			SearchOrder: "os-first",
+		},
+	}}
+	fromConf, err := dnsOptionsFromConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dns.ResolverOptions{Ndots: 2, Timeout: 3 * time.Second, SearchOrder: dns.SearchOrderOSFirst}
+	if fromConf != want {
+		t.Errorf("from config = %+v; want %+v", fromConf, want)
+	}
+
+	conf.Parsed.DNSOptions.Ndots = 100
+	if _, err := dnsOptionsFromConfig(conf); err == nil {
+		t.Error("invalid config options accepted")
+	}
+
+	// Policy overrides the options it sets.
+	got := dnsOptionsWithPolicy(fromConf, policytest.Config{
+		pkey.DNSNdots:    uint64(1),
+		pkey.DNSAttempts: uint64(4),
+	}, t.Logf)
+	want = dns.ResolverOptions{Ndots: 1, Timeout: 3 * time.Second, Attempts: 4, SearchOrder: dns.SearchOrderOSFirst}
+	if got != want {
+		t.Errorf("with policy = %+v; want %+v", got, want)
+	}
+
+	// Invalid policy is ignored.
+	got = dnsOptionsWithPolicy(fromConf, policytest.Config{
+		pkey.DNSNdots:       uint64(1),
+		pkey.DNSSearchOrder: "last",
+	}, t.Logf)
+	if got != fromConf {
+		t.Errorf("with invalid policy = %+v; want %+v", got, fromConf)
+	}
+}
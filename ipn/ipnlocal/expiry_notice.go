@@ -0,0 +1,184 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"tailscale.com/health"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/httpm"
+	"tailscale.com/util/syspolicy/pkey"
+)
+
+const (
+	// defaultKeyExpiryNoticeTime is the default for
+	// [pkey.KeyExpirationNoticeTime].
+	defaultKeyExpiryNoticeTime = 24 * time.Hour
+
+	// keyExpiryNoticeActionTimeout bounds each key expiry notice action.
+	keyExpiryNoticeActionTimeout = time.Minute
+)
+
+var keyExpiryNoticeWarnable = health.Register(&health.Warnable{
+	Code:     "key-expiry-soon",
+	Title:    "Key expiring soon",
+	Severity: health.SeverityMedium,
+	Text: func(args health.Args) string {
+		if msg := args[health.ArgMessage]; msg != "" {
+			return msg
+		}
+		return fmt.Sprintf("This device's key expires at %s. Reauthenticate with 'tailscale up --force-reauth' to keep it connected.", args[health.ArgKeyExpiry])
+	},
+})
+
+// keyExpiryNoticeState is the state of the key expiry notice of a
+// LocalBackend. See [LocalBackend.updateKeyExpiryNoticeLocked].
+type keyExpiryNoticeState struct {
+	// timer fires when the node key expiry comes within
+	// [pkey.KeyExpirationNoticeTime], or is nil if not scheduled.
+	timer tstime.TimerController
+
+	// notified is the node key expiry for which the notice actions last
+	// ran, so that they run once per key expiry.
+	notified time.Time
+}
+
+// keyExpiryNotice is the JSON body of the request made to the
+// [pkey.KeyExpirationNoticeWebhook] URL.
+type keyExpiryNotice struct {
+	NodeID    tailcfg.StableNodeID `json:"nodeID"`
+	Name      string               `json:"name"` // the node's MagicDNS name
+	KeyExpiry time.Time            `json:"keyExpiry"`
+}
+
+// updateKeyExpiryNoticeLocked checks whether the node key of nm's self node
+// expires within [pkey.KeyExpirationNoticeTime]. If so, it sets the key expiry
+// health warning and runs the notice actions configured by policy, unless
+// they already ran for this expiry. Otherwise, it clears the warning and, if
+// the key expires, schedules the check again for when it's due.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateKeyExpiryNoticeLocked(nm *netmap.NetworkMap) {
+	st := &b.keyExpiryNotice
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	var expiry time.Time
+	if nm != nil {
+		expiry = nm.SelfKeyExpiry()
+	}
+	now := b.clock.Now()
+	if expiry.IsZero() || !expiry.After(now) {
+		// An expired key is reported as such elsewhere.
+		b.health.SetHealthy(keyExpiryNoticeWarnable)
+		return
+	}
+	lead, _ := b.polc.GetDuration(pkey.KeyExpirationNoticeTime, defaultKeyExpiryNoticeTime)
+	if wait := expiry.Sub(now) - lead; wait > 0 {
+		b.health.SetHealthy(keyExpiryNoticeWarnable)
+		var timer tstime.TimerController
+		timer = b.clock.AfterFunc(wait, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if b.keyExpiryNotice.timer != timer {
+				// Stopped or replaced while we waited for the lock.
+				return
+			}
+			b.keyExpiryNotice.timer = nil
+			b.updateKeyExpiryNoticeLocked(b.currentNode().NetMap())
+		})
+		st.timer = timer
+		return
+	}
+
+	msg, _ := b.polc.GetString(pkey.KeyExpirationNoticeMessage, "")
+	b.health.SetUnhealthy(keyExpiryNoticeWarnable, health.Args{
+		health.ArgKeyExpiry: expiry.Format(time.RFC3339),
+		health.ArgMessage:   msg,
+	})
+	if st.notified.Equal(expiry) {
+		return
+	}
+	st.notified = expiry
+	b.logf("node key expires at %v, within %v", expiry.Format(time.RFC3339), lead)
+
+	command, _ := b.polc.GetString(pkey.KeyExpirationNoticeCommand, "")
+	webhook, _ := b.polc.GetString(pkey.KeyExpirationNoticeWebhook, "")
+	notice := keyExpiryNotice{
+		NodeID:    nm.SelfNode.StableID(),
+		Name:      strings.TrimSuffix(nm.SelfNode.Name(), "."),
+		KeyExpiry: expiry,
+	}
+	if command != "" {
+		go func() {
+			if err := runKeyExpiryNoticeCommand(b.ctx, command, notice); err != nil {
+				b.logf("key expiry notice command: %v", err)
+			}
+		}()
+	}
+	if webhook != "" {
+		go func() {
+			if err := postKeyExpiryNotice(b.ctx, webhook, notice); err != nil {
+				b.logf("key expiry notice webhook: %v", err)
+			}
+		}()
+	}
+}
+
+// runKeyExpiryNoticeCommand runs the [pkey.KeyExpirationNoticeCommand]
+// command for n.
+func runKeyExpiryNoticeCommand(ctx context.Context, command string, n keyExpiryNotice) error {
+	ctx, cancel := context.WithTimeout(ctx, keyExpiryNoticeActionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command)
+	cmd.Env = append(os.Environ(),
+		"TS_KEY_EXPIRY="+n.KeyExpiry.Format(time.RFC3339),
+		"TS_NODE_ID="+string(n.NodeID),
+		"TS_NODE_NAME="+n.Name,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+// postKeyExpiryNotice POSTs n to the [pkey.KeyExpirationNoticeWebhook] URL.
+func postKeyExpiryNotice(ctx context.Context, url string, n keyExpiryNotice) error {
+	ctx, cancel := context.WithTimeout(ctx, keyExpiryNoticeActionTimeout)
+	defer cancel()
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, httpm.POST, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
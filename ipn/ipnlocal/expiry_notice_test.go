@@ -0,0 +1,118 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/tsd"
+	"tailscale.com/tstest"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/syspolicy/pkey"
+	"tailscale.com/util/syspolicy/policytest"
+)
+
+func TestKeyExpiryNotice(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	expiry := start.Add(72 * time.Hour)
+
+	notices := make(chan keyExpiryNotice, 10)
+	var posts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n keyExpiryNotice
+		if r.Method != "POST" || json.NewDecoder(r.Body).Decode(&n) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		posts.Add(1)
+		notices <- n
+	}))
+	defer srv.Close()
+
+	sys := tsd.NewSystem()
+	sys.PolicyClient.Set(policytest.Config{
+		pkey.KeyExpirationNoticeTime:    48 * time.Hour,
+		pkey.KeyExpirationNoticeWebhook: srv.URL,
+		pkey.KeyExpirationNoticeMessage: "Run the reauth playbook.",
+	})
+	b := newTestLocalBackendWithSys(t, sys)
+	nm := func(expiry time.Time) *netmap.NetworkMap {
+		return &netmap.NetworkMap{
+			SelfNode: (&tailcfg.Node{
+				StableID:  "n1",
+				Name:      "box.tail-scale.ts.net.",
+				KeyExpiry: expiry,
+			}).View(),
+		}
+	}
+	update := func(now time.Time, nm *netmap.NetworkMap) {
+		t.Helper()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.clock = tstest.NewClock(tstest.ClockOpts{Start: now})
+		b.updateKeyExpiryNoticeLocked(nm)
+	}
+	checkWarning := func(want bool) {
+		t.Helper()
+		if got := b.health.IsUnhealthy(keyExpiryNoticeWarnable); got != want {
+			t.Fatalf("key expiry warning = %v; want %v", got, want)
+		}
+	}
+
+	// More than 48h before expiry, the notice is only scheduled.
+	update(start, nm(expiry))
+	checkWarning(false)
+	b.mu.Lock()
+	scheduled := b.keyExpiryNotice.timer != nil
+	b.mu.Unlock()
+	if !scheduled {
+		t.Fatal("key expiry notice not scheduled")
+	}
+
+	// Within 48h of expiry, the warning is set and the webhook called.
+	update(start.Add(25*time.Hour), nm(expiry))
+	checkWarning(true)
+	if got := b.health.CurrentState().Warnings[keyExpiryNoticeWarnable.Code].Text; got != "Run the reauth playbook." {
+		t.Errorf("warning text = %q", got)
+	}
+	select {
+	case n := <-notices:
+		want := keyExpiryNotice{NodeID: "n1", Name: "box.tail-scale.ts.net", KeyExpiry: expiry}
+		if !n.KeyExpiry.Equal(want.KeyExpiry) || n.NodeID != want.NodeID || n.Name != want.Name {
+			t.Errorf("notice = %+v; want %+v", n, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for webhook")
+	}
+
+	// The actions run once per key expiry.
+	update(start.Add(26*time.Hour), nm(expiry))
+	checkWarning(true)
+
+	// Extending the key clears the warning, and a later expiry is notified
+	// again.
+	later := expiry.Add(90 * 24 * time.Hour)
+	update(start.Add(27*time.Hour), nm(later))
+	checkWarning(false)
+	update(later.Add(-time.Hour), nm(later))
+	checkWarning(true)
+	select {
+	case <-notices:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for webhook")
+	}
+	if got := posts.Load(); got != 2 {
+		t.Errorf("webhook called %d times; want 2", got)
+	}
+
+	// Logging out clears everything.
+	update(later.Add(-time.Hour), nil)
+	checkWarning(false)
+}
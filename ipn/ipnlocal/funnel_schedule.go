@@ -0,0 +1,146 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_serve
+
+package ipnlocal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"tailscale.com/health"
+	"tailscale.com/ipn"
+	"tailscale.com/tstime"
+	"tailscale.com/util/mak"
+	"tailscale.com/util/set"
+)
+
+var funnelScheduleMissedWarnable = health.Register(&health.Warnable{
+	Code:     "funnel-schedule-missed",
+	Title:    "Scheduled Funnel window missed",
+	Severity: health.SeverityLow,
+	Text: func(args health.Args) string {
+		return fmt.Sprintf("Funnel wasn't turned on for %s during a scheduled window, because this device was offline for all of it.", args[health.ArgFunnelTargets])
+	},
+})
+
+// funnelScheduleState is the state of the Funnel schedules of a LocalBackend.
+// See [LocalBackend.updateFunnelScheduleLocked].
+type funnelScheduleState struct {
+	// timer fires when the next scheduled window starts or ends, or is nil
+	// if not scheduled.
+	timer tstime.TimerController
+
+	// checked is when the schedules were last applied while running, or the
+	// zero time if they haven't been.
+	checked time.Time
+
+	// missed are the Funnel targets with a scheduled window that passed
+	// while the node wasn't running, which haven't had a window start since.
+	missed set.Set[ipn.HostPort]
+}
+
+// updateFunnelScheduleLocked applies the Funnel schedules of the current serve
+// config, turning Funnel on or off for each scheduled target as needed, and
+// schedules the check again for when the next window starts or ends.
+// Schedules are only applied while running; windows that passed entirely
+// while not running are logged, and reported with a health warning.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateFunnelScheduleLocked() {
+	st := &b.funnelSchedule
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	sc := b.serveConfig
+	if !sc.Valid() || sc.FunnelSchedules().Len() == 0 {
+		st.checked = time.Time{}
+		st.missed = nil
+		b.health.SetHealthy(funnelScheduleMissedWarnable)
+		return
+	}
+	if b.state != ipn.Running {
+		return
+	}
+
+	now := b.clock.Now()
+	conf := sc.AsStruct()
+	changed := false
+	var next time.Time
+	for hp, sched := range conf.FunnelSchedules {
+		if !st.checked.IsZero() {
+			for start, end := range sched.Occurrences(st.checked, now) {
+				if start.After(st.checked) && !end.After(now) {
+					b.logf("funnel schedule: missed window for %s from %v to %v, while not running", hp, start.Format(time.RFC3339), end.Format(time.RFC3339))
+					mak.Set(&st.missed, hp, struct{}{})
+				}
+			}
+		}
+		on := sched.ActiveAt(now)
+		if on {
+			delete(st.missed, hp)
+		}
+		if on != conf.AllowFunnel[hp] {
+			changed = true
+			if on {
+				mak.Set(&conf.AllowFunnel, hp, true)
+				b.logf("funnel schedule: turned Funnel on for %s", hp)
+			} else {
+				delete(conf.AllowFunnel, hp)
+				b.logf("funnel schedule: turned Funnel off for %s", hp)
+			}
+		}
+		if t := sched.NextChange(now); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	for hp := range st.missed {
+		if _, ok := conf.FunnelSchedules[hp]; !ok {
+			delete(st.missed, hp)
+		}
+	}
+	st.checked = now
+
+	if len(st.missed) == 0 {
+		b.health.SetHealthy(funnelScheduleMissedWarnable)
+	} else {
+		targets := make([]string, 0, len(st.missed))
+		for hp := range st.missed {
+			targets = append(targets, string(hp))
+		}
+		slices.Sort(targets)
+		b.health.SetUnhealthy(funnelScheduleMissedWarnable, health.Args{
+			health.ArgFunnelTargets: strings.Join(targets, ", "),
+		})
+	}
+
+	if changed {
+		err := b.setServeConfigLocked(conf, "")
+		if err == nil {
+			// setServeConfigLocked called back into
+			// updateFunnelScheduleLocked, which found nothing more to
+			// change and scheduled the next check.
+			return
+		}
+		b.logf("funnel schedule: %v", err)
+	}
+	if next.IsZero() {
+		return
+	}
+	var timer tstime.TimerController
+	timer = b.clock.AfterFunc(next.Sub(now), func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.funnelSchedule.timer != timer {
+			// Stopped or replaced while we waited for the lock.
+			return
+		}
+		b.funnelSchedule.timer = nil
+		b.updateFunnelScheduleLocked()
+	})
+	st.timer = timer
+}
@@ -0,0 +1,125 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_serve
+
+package ipnlocal
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tstest"
+)
+
+func TestFunnelSchedule(t *testing.T) {
+	b := newTestBackend(t)
+	const hp = ipn.HostPort("example.ts.net:443")
+
+	// Monday, October 12, 2026.
+	now := time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC)
+	b.mu.Lock()
+	b.clock = tstest.NewClock(tstest.ClockOpts{Start: now})
+	b.state = ipn.Running
+	b.mu.Unlock()
+
+	checkFunnel := func(want bool) {
+		t.Helper()
+		if got := b.ServeConfig().AllowFunnel().Get(hp); got != want {
+			t.Fatalf("at %v, Funnel on = %v; want %v", now, got, want)
+		}
+	}
+	checkWarning := func(want bool) {
+		t.Helper()
+		if got := b.health.IsUnhealthy(funnelScheduleMissedWarnable); got != want {
+			t.Fatalf("at %v, missed window warning = %v; want %v", now, got, want)
+		}
+	}
+	setState := func(st ipn.State) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.state = st
+		b.updateFunnelScheduleLocked()
+	}
+	setTime := func(t time.Time) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		now = t
+		b.clock = tstest.NewClock(tstest.ClockOpts{Start: now})
+	}
+	// advanceTo moves the time to t and runs the check that the timer would
+	// have run then.
+	advanceTo := func(t time.Time) {
+		setTime(t)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.updateFunnelScheduleLocked()
+	}
+	checkScheduled := func(want bool) {
+		t.Helper()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if got := b.funnelSchedule.timer != nil; got != want {
+			t.Fatalf("at %v, check scheduled = %v; want %v", now, got, want)
+		}
+	}
+
+	conf := &ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			hp: {Handlers: map[string]*ipn.HTTPHandler{
+				"/": {Proxy: "http://127.0.0.1:3000"},
+			}},
+		},
+		AllowFunnel: map[ipn.HostPort]bool{hp: true},
+		FunnelSchedules: map[ipn.HostPort]*ipn.FunnelSchedule{
+			hp: {TimeZone: "UTC", Windows: []ipn.FunnelWindow{{Days: "mon-fri", Start: "09:00", End: "17:00"}}},
+		},
+	}
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Outside of the window, Funnel is turned off right away.
+	checkFunnel(false)
+	checkScheduled(true)
+
+	advanceTo(time.Date(2026, 10, 12, 9, 0, 0, 0, time.UTC))
+	checkFunnel(true)
+	advanceTo(time.Date(2026, 10, 12, 17, 0, 0, 0, time.UTC))
+	checkFunnel(false)
+
+	// Offline for all of Tuesday's window.
+	setState(ipn.Stopped)
+	checkScheduled(false)
+	setTime(time.Date(2026, 10, 13, 18, 0, 0, 0, time.UTC))
+	checkFunnel(false)
+	checkWarning(false)
+	setState(ipn.Running)
+	checkFunnel(false)
+	checkWarning(true)
+
+	// Offline at the start of Wednesday's window, but back during it:
+	// Funnel is turned on late, and the warning cleared.
+	setState(ipn.Stopped)
+	setTime(time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC))
+	setState(ipn.Running)
+	checkFunnel(true)
+	checkWarning(false)
+
+	// Invalid schedules are rejected.
+	conf = b.ServeConfig().AsStruct()
+	conf.FunnelSchedules[hp] = &ipn.FunnelSchedule{Windows: []ipn.FunnelWindow{{Start: "25:00", End: "26:00"}}}
+	if err := b.SetServeConfig(conf, ""); err == nil {
+		t.Fatal("invalid schedule accepted")
+	}
+
+	// Removing the schedule leaves Funnel as it is.
+	conf.FunnelSchedules = nil
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+	checkScheduled(false)
+	advanceTo(time.Date(2026, 10, 14, 18, 0, 0, 0, time.UTC))
+	checkFunnel(true)
+}
@@ -0,0 +1,242 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"tailscale.com/feature"
+	"tailscale.com/feature/buildfeatures"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+const (
+	// latencyMatrixPingTimeout bounds each ping in a latency matrix test.
+	latencyMatrixPingTimeout = 5 * time.Second
+
+	// latencyMatrixPeerTimeout bounds how long we wait for a peer to run
+	// its row of a latency matrix test.
+	latencyMatrixPeerTimeout = 3 * latencyMatrixPingTimeout
+
+	// maxLatencyMatrixTargets is the maximum number of targets in a latency
+	// matrix test. With mesh testing, the number of pings is quadratic in
+	// the number of targets.
+	maxLatencyMatrixTargets = 64
+)
+
+// pingMatrixRequest is the JSON body of a peerapi /v0/ping-matrix request.
+type pingMatrixRequest struct {
+	Targets []netip.Addr
+}
+
+// LatencyMatrix disco pings each of targets from this node and returns the
+// results.
+//
+// If mesh is true, it also asks each target, over its peerapi, to ping the
+// other targets. Targets that don't grant this node debug access, or that
+// can't be reached, report an error for each of their pings instead.
+func (b *LocalBackend) LatencyMatrix(ctx context.Context, targets []netip.Addr, mesh bool) (*ipnstate.LatencyMatrix, error) {
+	self := b.currentNode().Self()
+	if !self.Valid() {
+		return nil, errors.New("no netmap")
+	}
+	var selfIP netip.Addr
+	for _, pfx := range self.Addresses().All() {
+		if !pfx.IsSingleIP() {
+			continue
+		}
+		if !selfIP.IsValid() || (pfx.Addr().Is4() && !selfIP.Is4()) {
+			selfIP = pfx.Addr()
+		}
+	}
+	if !selfIP.IsValid() {
+		return nil, errors.New("no Tailscale IP")
+	}
+
+	var peers []netip.Addr
+	for _, ip := range targets {
+		if !isSelfAddr(self, ip) && !slices.Contains(peers, ip) {
+			peers = append(peers, ip)
+		}
+	}
+	if len(peers) == 0 {
+		return nil, errors.New("no peers to test")
+	}
+	if len(peers) > maxLatencyMatrixTargets {
+		return nil, fmt.Errorf("too many peers (%d); max %d", len(peers), maxLatencyMatrixTargets)
+	}
+
+	lm := &ipnstate.LatencyMatrix{
+		Nodes: append([]netip.Addr{selfIP}, peers...),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		res := b.pingAll(ctx, selfIP, peers)
+		mu.Lock()
+		defer mu.Unlock()
+		lm.Results = append(lm.Results, res...)
+	})
+	if mesh && len(peers) > 1 {
+		for _, ip := range peers {
+			others := slices.DeleteFunc(slices.Clone(peers), func(o netip.Addr) bool { return o == ip })
+			wg.Go(func() {
+				res, err := b.requestPingMatrix(ctx, ip, others)
+				if err != nil {
+					res = make([]ipnstate.LatencyMatrixResult, len(others))
+					for i, o := range others {
+						res[i] = ipnstate.LatencyMatrixResult{
+							From: ip,
+							To:   o,
+							Ping: &ipnstate.PingResult{
+								IP:  o.String(),
+								Err: fmt.Sprintf("asking %v to ping: %v", ip, err),
+							},
+						}
+					}
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				lm.Results = append(lm.Results, res...)
+			})
+		}
+	}
+	wg.Wait()
+	return lm, nil
+}
+
+// isSelfAddr reports whether ip is one of self's Tailscale IPs.
+func isSelfAddr(self tailcfg.NodeView, ip netip.Addr) bool {
+	for _, pfx := range self.Addresses().All() {
+		if pfx.IsSingleIP() && pfx.Addr() == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// pingAll concurrently disco pings each of targets from this node, whose
+// Tailscale IP is from.
+func (b *LocalBackend) pingAll(ctx context.Context, from netip.Addr, targets []netip.Addr) []ipnstate.LatencyMatrixResult {
+	res := make([]ipnstate.LatencyMatrixResult, len(targets))
+	var wg sync.WaitGroup
+	for i, ip := range targets {
+		res[i] = ipnstate.LatencyMatrixResult{From: from, To: ip}
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, latencyMatrixPingTimeout)
+			defer cancel()
+			pr, err := b.Ping(ctx, ip, tailcfg.PingDisco, 0)
+			if err != nil {
+				pr = &ipnstate.PingResult{IP: ip.String(), Err: err.Error()}
+			}
+			res[i].Ping = pr
+		})
+	}
+	wg.Wait()
+	return res
+}
+
+// requestPingMatrix asks the peer with Tailscale IP peerIP to disco ping
+// each of targets, and returns its results.
+func (b *LocalBackend) requestPingMatrix(ctx context.Context, peerIP netip.Addr, targets []netip.Addr) ([]ipnstate.LatencyMatrixResult, error) {
+	if !buildfeatures.HasPeerAPIClient {
+		return nil, feature.ErrUnavailable
+	}
+	ctx, cancel := context.WithTimeout(ctx, latencyMatrixPeerTimeout)
+	defer cancel()
+
+	nm := b.NetMapWithPeers()
+	if nm == nil {
+		return nil, errors.New("no netmap")
+	}
+	peer, ok := nm.PeerByTailscaleIP(peerIP)
+	if !ok {
+		return nil, fmt.Errorf("no peer found with Tailscale IP %v", peerIP)
+	}
+	base := peerAPIBase(nm, peer)
+	if base == "" {
+		return nil, errors.New("peer has no peerapi")
+	}
+	body, err := json.Marshal(pingMatrixRequest{Targets: targets})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", base+"/v0/ping-matrix", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := b.Dialer().PeerAPIHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return nil, fmt.Errorf("%v: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	var results []ipnstate.LatencyMatrixResult
+	if err := json.NewDecoder(res.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	for i := range results {
+		// Label results with the IP we know the peer by, which might
+		// be of a different address family than the one it picked.
+		results[i].From = peerIP
+	}
+	return results, nil
+}
+
+// handleServePingMatrix serves a peerapi request from a peer running a mesh
+// latency matrix test, pinging each of the requested targets from this node.
+func (h *peerAPIHandler) handleServePingMatrix(w http.ResponseWriter, r *http.Request) {
+	if !h.canDebug() {
+		http.Error(w, "denied; no debug access", http.StatusForbidden)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "want POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req pingMatrixRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Targets) > maxLatencyMatrixTargets {
+		http.Error(w, "too many targets", http.StatusBadRequest)
+		return
+	}
+	self := h.selfNode
+	var from netip.Addr
+	for _, pfx := range self.Addresses().All() {
+		if pfx.IsSingleIP() && pfx.Addr().BitLen() == h.remoteAddr.Addr().BitLen() {
+			from = pfx.Addr()
+			break
+		}
+	}
+	if !from.IsValid() {
+		// We'd have no source address to label our results with, and the
+		// requester can retry using the address family we do have.
+		http.Error(w, "no Tailscale IP in the requester's address family", http.StatusBadRequest)
+		return
+	}
+	targets := slices.DeleteFunc(slices.Clone(req.Targets), func(ip netip.Addr) bool {
+		return isSelfAddr(self, ip)
+	})
+	res := h.ps.b.pingAll(r.Context(), from, targets)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+)
+
+func newLatencyMatrixTestBackend(t *testing.T, selfNode *tailcfg.Node) *LocalBackend {
+	t.Helper()
+	b := newTestLocalBackend(t)
+	b.currentNode().SetNetMap(&netmap.NetworkMap{SelfNode: selfNode.View()})
+	return b
+}
+
+func TestLatencyMatrixTargets(t *testing.T) {
+	selfNode := &tailcfg.Node{
+		Addresses: []netip.Prefix{
+			netip.MustParsePrefix("100.64.0.1/32"),
+			netip.MustParsePrefix("fd7a:115c:a1e0::1/128"),
+		},
+	}
+	b := newLatencyMatrixTestBackend(t, selfNode)
+
+	self4 := netip.MustParseAddr("100.64.0.1")
+	self6 := netip.MustParseAddr("fd7a:115c:a1e0::1")
+	p1 := netip.MustParseAddr("100.64.0.2")
+	p2 := netip.MustParseAddr("100.64.0.3")
+
+	lm, err := b.LatencyMatrix(context.Background(), []netip.Addr{p1, self6, p2, p1, self4, p2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []netip.Addr{self4, p1, p2}; !slices.Equal(lm.Nodes, want) {
+		t.Errorf("Nodes = %v; want %v", lm.Nodes, want)
+	}
+	if len(lm.Results) != 2 {
+		t.Fatalf("got %d results; want 2", len(lm.Results))
+	}
+	for _, r := range lm.Results {
+		if r.From != self4 {
+			t.Errorf("result From = %v; want %v", r.From, self4)
+		}
+		if r.Ping == nil || r.Ping.Err == "" {
+			t.Errorf("result for %v = %+v; want ping error for unknown peer", r.To, r.Ping)
+		}
+	}
+
+	if _, err := b.LatencyMatrix(context.Background(), []netip.Addr{self4, self6}, false); err == nil {
+		t.Error("LatencyMatrix with only self targets succeeded; want error")
+	}
+
+	var many []netip.Addr
+	for i := range maxLatencyMatrixTargets + 1 {
+		many = append(many, netip.AddrFrom4([4]byte{100, 64, 1, byte(i)}))
+	}
+	if _, err := b.LatencyMatrix(context.Background(), many, false); err == nil || !strings.Contains(err.Error(), "too many") {
+		t.Errorf("LatencyMatrix with %d targets = %v; want too many error", len(many), err)
+	}
+	// Duplicates don't count against the limit.
+	dups := append(slices.Clone(many[:maxLatencyMatrixTargets]), many[:maxLatencyMatrixTargets]...)
+	lm, err = b.LatencyMatrix(context.Background(), dups, false)
+	if err != nil {
+		t.Fatalf("LatencyMatrix with duplicated targets: %v", err)
+	}
+	if got, want := len(lm.Nodes), maxLatencyMatrixTargets+1; got != want {
+		t.Errorf("got %d nodes; want %d", got, want)
+	}
+}
+
+func TestServePingMatrix(t *testing.T) {
+	selfNode := &tailcfg.Node{
+		Addresses: []netip.Prefix{netip.MustParsePrefix("100.64.0.1/32")},
+		CapMap:    tailcfg.NodeCapMap{tailcfg.CapabilityDebug: nil},
+	}
+	b := newLatencyMatrixTestBackend(t, selfNode)
+
+	tests := []struct {
+		name     string
+		remote   string
+		body     string
+		wantCode int
+	}{
+		{"ok", "100.64.0.9:1234", `{"Targets":["100.64.0.2","100.64.0.1"]}`, http.StatusOK},
+		{"bad-json", "100.64.0.9:1234", `{`, http.StatusBadRequest},
+		{"no-matching-family", "[fd7a:115c:a1e0::9]:1234", `{"Targets":["100.64.0.2"]}`, http.StatusBadRequest},
+		{"too-many", "100.64.0.9:1234", fmt.Sprintf(`{"Targets":[%s]}`, strings.TrimSuffix(strings.Repeat(`"100.64.0.2",`, maxLatencyMatrixTargets+1), ",")), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &peerAPIHandler{
+				isSelf:     true,
+				selfNode:   selfNode.View(),
+				peerNode:   (&tailcfg.Node{}).View(),
+				remoteAddr: netip.MustParseAddrPort(tt.remote),
+				ps:         &peerAPIServer{b: b},
+			}
+			rec := httptest.NewRecorder()
+			h.handleServePingMatrix(rec, httptest.NewRequest("POST", "/v0/ping-matrix", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d; want %d; body: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if tt.wantCode == http.StatusOK && strings.Contains(rec.Body.String(), `"To":"100.64.0.1"`) {
+				t.Errorf("response includes a ping to self: %s", rec.Body.String())
+			}
+		})
+	}
+}
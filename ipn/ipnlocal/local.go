@@ -55,6 +55,7 @@
 	"tailscale.com/log/sockstatlog"
 	"tailscale.com/logpolicy"
 	"tailscale.com/net/dns"
+	"tailscale.com/net/dns/resolver"
 	"tailscale.com/net/dnscache"
 	"tailscale.com/net/dnsfallback"
 	"tailscale.com/net/ipset"
@@ -64,6 +65,7 @@
 	"tailscale.com/net/netns"
 	"tailscale.com/net/netutil"
 	"tailscale.com/net/packet"
+	"tailscale.com/net/portmapper/portmappertype"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/net/tsdial"
 	"tailscale.com/paths"
@@ -279,6 +281,7 @@ type LocalBackend struct {
 	ccGen            clientGen          // function for producing controlclient; lazily populated
 	sshServer        SSHServer          // or nil, initialized lazily.
 	appConnector     *appc.AppConnector // or nil, initialized when configured.
+	mdnsGateway      *mdnsGateway       // or nil, running when configured by NodeAttrMDNSGateway.
 	// notifyCancel cancels notifications to the current SetNotifyCallback.
 	notifyCancel context.CancelFunc
 	cc           controlclient.Client // TODO(nickkhyl): move to nodeBackend
@@ -391,6 +394,21 @@ type LocalBackend struct {
 	// to true after a delay, or nil if no reconnect is scheduled.
 	reconnectTimer tstime.TimerController
 
+	// keyExpiryNotice is the state of the notice that the node key is due
+	// to expire soon.
+	keyExpiryNotice keyExpiryNoticeState
+
+	// funnelSchedule is the state of the Funnel schedules of the current
+	// serve config.
+	funnelSchedule funnelScheduleState
+
+	// warmPeers is the state of the peers in Prefs.KeepWarmPeers.
+	warmPeers warmPeersState
+
+	// usage accumulates the bytes Tailscale itself sends and receives.
+	// It has its own mutex and isn't guarded by mu.
+	usage usageTracker
+
 	// overrideExitNodePolicy is whether the user has overridden the exit node policy
 	// by manually selecting an exit node, as allowed by [pkey.AllowExitNodeOverride].
 	//
@@ -404,6 +422,11 @@ type LocalBackend struct {
 	// See tailscale/corp#29969.
 	overrideExitNodePolicy bool
 
+	// dnsOptions are the DNS resolver options from the config file and
+	// policy, applied to the DNS config on reconfig.
+	// See [LocalBackend.updateDNSOptionsLocked].
+	dnsOptions dns.ResolverOptions
+
 	// hardwareAttested is whether backend should use a hardware-backed key to
 	// bind the node identity to this device.
 	hardwareAttested atomic.Bool
@@ -417,6 +440,23 @@ type LocalBackend struct {
 	// It is used to prevent goroutines from piling up to do the same
 	// work of [LocalBackend.authReconfigLocked].
 	existsPendingAuthReconfig atomic.Bool
+
+	// appliedWGCfg is the WireGuard config authReconfigLocked last
+	// applied to the engine, or nil if it's unconfigured. It's the
+	// starting point for staged netmap application; see stageWGConfig.
+	appliedWGCfg *wgcfg.Config // +checklocks:mu
+
+	// stagedApplyTimer, if non-nil, fires to apply the next batch of
+	// peer changes. See scheduleStagedApplyLocked.
+	stagedApplyTimer tstime.TimerController // +checklocks:mu
+
+	// netSettingsTxn is the state of network settings transactions.
+	// See netSettingsRollbackTimeout.
+	netSettingsTxn netSettingsTxn // +checklocks:mu
+
+	// probeNetSettingsForTest, if non-nil, replaces the connectivity
+	// check of network settings transactions in tests.
+	probeNetSettingsForTest func(context.Context) error
 }
 
 // SetHardwareAttested enables hardware attestation key signatures in map
@@ -459,6 +499,12 @@ type metrics struct {
 	// approvedRoutes is a metric that reports the number of network routes served by the local node and approved
 	// by the control server.
 	approvedRoutes *usermetric.Gauge
+
+	// peerInboundBytes and peerOutboundBytes count the WireGuard traffic
+	// received from and sent to peers, attributed by the peers' tags and
+	// roles. They're fed from the per-peer totals in engine status updates.
+	peerInboundBytes  *usermetric.DeltaCounter[key.NodePublic, usermetric.PeerTrafficLabels]
+	peerOutboundBytes *usermetric.DeltaCounter[key.NodePublic, usermetric.PeerTrafficLabels]
 }
 
 // clientGen is a func that creates a control plane client.
@@ -510,6 +556,12 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 			"tailscaled_advertised_routes", "Number of advertised network routes (e.g. by a subnet router)"),
 		approvedRoutes: sys.UserMetricsRegistry().NewGauge(
 			"tailscaled_approved_routes", "Number of approved network routes (e.g. by a subnet router)"),
+		peerInboundBytes: usermetric.NewDeltaCounterWithRegistry[key.NodePublic, usermetric.PeerTrafficLabels](
+			sys.UserMetricsRegistry(), "tailscaled_peer_inbound_bytes_total",
+			"Counts the number of bytes received from peers, by the peers' tags and role"),
+		peerOutboundBytes: usermetric.NewDeltaCounterWithRegistry[key.NodePublic, usermetric.PeerTrafficLabels](
+			sys.UserMetricsRegistry(), "tailscaled_peer_outbound_bytes_total",
+			"Counts the number of bytes sent to peers, by the peers' tags and role"),
 	}
 
 	b := &LocalBackend{
@@ -542,6 +594,7 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 
 	e.SetPeerByIPPacketFunc(b.lookupPeerByIP)
 
+	b.switchToStartupProfile()
 	if sys.InitialConfig != nil {
 		if err := b.initPrefsFromConfig(sys.InitialConfig); err != nil {
 			return nil, err
@@ -581,6 +634,7 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 
 	b.e.SetStatusCallback(b.setWgengineStatus)
 
+	b.startUsageTracking()
 	b.interfaceState = netMon.InterfaceState()
 
 	// Call our linkChange code once with the current state.
@@ -627,6 +681,9 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 	if buildfeatures.HasPortList {
 		eventbus.SubscribeFunc(ec, b.setPortlistServices)
 	}
+	if buildfeatures.HasHostinfoAttrs {
+		eventbus.SubscribeFunc(ec, b.setHostinfoAttributes)
+	}
 	eventbus.SubscribeFunc(ec, b.onAppConnectorRouteUpdate)
 	eventbus.SubscribeFunc(ec, b.onAppConnectorStoreRoutes)
 	eventbus.SubscribeFunc(ec, b.onHomeDERPUpdate)
@@ -837,25 +894,25 @@ func (b *LocalBackend) GetDNSOSConfig() (dns.OSConfig, error) {
 }
 
 // QueryDNS performs a DNS query for name and queryType using the built-in DNS resolver, and returns
-// the raw DNS response and the resolvers that are were able to handle the query (the internal forwarder
-// may race multiple resolvers).
-func (b *LocalBackend) QueryDNS(name string, queryType dnsmessage.Type) (res []byte, resolvers []*dnstype.Resolver, err error) {
+// the raw DNS response, the resolvers that are were able to handle the query (the internal forwarder
+// may race multiple resolvers), and a trace of how the query was resolved.
+func (b *LocalBackend) QueryDNS(name string, queryType dnsmessage.Type) (res []byte, resolvers []*dnstype.Resolver, trace *dnstype.QueryTrace, err error) {
 	if !buildfeatures.HasDNS {
-		return nil, nil, feature.ErrUnavailable
+		return nil, nil, nil, feature.ErrUnavailable
 	}
 	manager, ok := b.sys.DNSManager.GetOK()
 	if !ok {
-		return nil, nil, errors.New("DNS manager not available")
+		return nil, nil, nil, errors.New("DNS manager not available")
 	}
 	fqdn, err := dnsname.ToFQDN(name)
 	if err != nil {
 		b.logf("DNSQuery: failed to parse FQDN %q: %v", name, err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	n, err := dnsmessage.NewName(fqdn.WithTrailingDot())
 	if err != nil {
 		b.logf("DNSQuery: failed to parse name %q: %v", name, err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	from := netip.MustParseAddrPort("127.0.0.1:0")
 	db := dnsmessage.NewBuilder(nil, dnsmessage.Header{
@@ -872,15 +929,17 @@ func (b *LocalBackend) QueryDNS(name string, queryType dnsmessage.Type) (res []b
 	q, err := db.Finish()
 	if err != nil {
 		b.logf("DNSQuery: failed to build query: %v", err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	res, err = manager.Query(b.ctx, q, "tcp", from)
+	var tr resolver.QueryTracer
+	res, err = manager.Query(resolver.WithQueryTracer(b.ctx, &tr), q, "tcp", from)
 	if err != nil {
 		b.logf("DNSQuery: failed to query %q: %v", name, err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	rr := manager.Resolver().GetUpstreamResolvers(fqdn)
-	return res, rr, nil
+	t := tr.Trace()
+	return res, rr, &t, nil
 }
 
 // GetComponentDebugLogging gets the time that component's debug logging is
@@ -931,6 +990,47 @@ func (b *LocalBackend) ReloadConfig() (ok bool, err error) {
 // initPrefsFromConfig initializes the backend's prefs from the provided config.
 // This should only be called once, at startup. For updates at runtime, use
 // [LocalBackend.setConfigLocked].
+// startupProfile returns the name or ID of the login profile to switch to at
+// startup instead of the last used one, and where it was configured. It
+// returns "" if there's none.
+//
+// The tailscaled --profile flag takes precedence over the config file,
+// which takes precedence over the [pkey.DefaultProfile] policy setting.
+func (b *LocalBackend) startupProfile() (nameOrID, source string) {
+	if p := b.sys.StartupProfile; p != "" {
+		return p, "--profile"
+	}
+	if conf := b.sys.InitialConfig; conf != nil && conf.Parsed.Profile != nil && *conf.Parsed.Profile != "" {
+		return *conf.Parsed.Profile, "config file"
+	}
+	if p, _ := b.polc.GetString(pkey.DefaultProfile, ""); p != "" {
+		return p, "policy"
+	}
+	return "", ""
+}
+
+// switchToStartupProfile switches to the profile returned by
+// [LocalBackend.startupProfile], if any. If that profile doesn't exist,
+// it logs and leaves the last used profile in place.
+//
+// It's called by [NewLocalBackend] before the backend is started.
+func (b *LocalBackend) switchToStartupProfile() {
+	nameOrID, source := b.startupProfile()
+	if nameOrID == "" {
+		return
+	}
+	profile := b.pm.findProfileByNameOrID("", nameOrID)
+	if !profile.Valid() {
+		b.logf("startup profile %q from %s not found; using profile %q", nameOrID, source, b.pm.CurrentProfile().Name())
+		return
+	}
+	if _, _, err := b.pm.SwitchToProfile(profile); err != nil {
+		b.logf("switching to startup profile %q from %s: %v", nameOrID, source, err)
+		return
+	}
+	b.logf("using startup profile %q (%s) from %s", profile.Name(), profile.ID(), source)
+}
+
 func (b *LocalBackend) initPrefsFromConfig(conf *conffile.Config) error {
 	// TODO(maisem,bradfitz): combine this with setConfigLocked. This is called
 	// before anything is running, so there's no need to lock and we don't
@@ -942,12 +1042,17 @@ func (b *LocalBackend) initPrefsFromConfig(conf *conffile.Config) error {
 		return fmt.Errorf("error parsing config to prefs: %w", err)
 	}
 	p.ApplyEdits(&mp)
+	if _, err := dnsOptionsFromConfig(conf); err != nil {
+		return err
+	}
 	if err := b.pm.SetPrefs(p.View(), ipn.NetworkProfile{}); err != nil {
 		return err
 	}
 	b.updateWarnSync(p.View())
 	b.setStaticEndpointsFromConfigLocked(conf)
+	b.setEndpointPolicyFromConfigLocked(conf)
 	b.conf = conf
+	b.updateDNSOptionsLocked()
 	return nil
 }
 
@@ -970,6 +1075,19 @@ func (b *LocalBackend) setStaticEndpointsFromConfigLocked(conf *conffile.Config)
 	}
 }
 
+func (b *LocalBackend) setEndpointPolicyFromConfigLocked(conf *conffile.Config) {
+	syncs.RequiresMutex(&b.mu)
+	if conf.Parsed.EndpointPolicy == nil && (b.conf == nil || b.conf.Parsed.EndpointPolicy == nil) {
+		return
+	}
+	ms, ok := b.sys.MagicSock.GetOK()
+	if !ok {
+		b.logf("[unexpected] ReloadConfig: MagicSock not set")
+		return
+	}
+	ms.SetLocalEndpointPolicy(conf.Parsed.EndpointPolicy)
+}
+
 func (b *LocalBackend) setStateLocked(state ipn.State) {
 	syncs.RequiresMutex(&b.mu)
 	if b.state == state {
@@ -1007,10 +1125,17 @@ func (b *LocalBackend) setConfigLocked(conf *conffile.Config) error {
 		return fmt.Errorf("error parsing config to prefs: %w", err)
 	}
 	p.ApplyEdits(&mp)
+	if _, err := dnsOptionsFromConfig(conf); err != nil {
+		return err
+	}
 	b.setStaticEndpointsFromConfigLocked(conf)
+	b.setEndpointPolicyFromConfigLocked(conf)
 	b.setPrefsLocked(p)
 
 	b.conf = conf
+	if b.updateDNSOptionsLocked() {
+		b.authReconfigLocked()
+	}
 	return nil
 }
 
@@ -1051,10 +1176,15 @@ func (b *LocalBackend) linkChange(delta *netmon.ChangeDelta) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	prefs := b.pm.CurrentPrefs()
+	oldConnectedSubnets := connectedSubnets(b.interfaceState, prefs)
 	b.interfaceState = delta.CurrentState()
+	if st := b.interfaceState; st != nil {
+		// Attribute usage so far to the previous default route.
+		b.usage.sample(b.clock.Now(), b.usageCounters(), st.DefaultRouteInterface)
+	}
 
 	b.pauseOrResumeControlClientLocked()
-	prefs := b.pm.CurrentPrefs()
 	if delta.RebindLikelyRequired && prefs.AutoExitNode().IsSet() {
 		b.refreshAutoExitNode = true
 	}
@@ -1070,6 +1200,16 @@ func (b *LocalBackend) linkChange(delta *netmon.ChangeDelta) {
 		b.logf("linkChange: in state %v; PAC or proxyConfig changed; updating routes", b.state)
 		needReconfig = true
 	}
+	// If we're advertising our connected subnets and they changed,
+	// update our advertised routes.
+	if newSubnets := connectedSubnets(b.interfaceState, prefs); !slices.Equal(oldConnectedSubnets, newSubnets) {
+		b.logf("linkChange: connected subnets changed to %v; updating advertised routes", newSubnets)
+		if b.hostinfo != nil {
+			b.applyPrefsToHostinfoLocked(b.hostinfo, prefs)
+			b.doSetHostinfoFilterServicesLocked()
+		}
+		needReconfig = true
+	}
 	if needReconfig {
 		switch b.state {
 		case ipn.NoState, ipn.Stopped:
@@ -1206,6 +1346,8 @@ func (b *LocalBackend) Shutdown() {
 	}
 
 	b.stopReconnectTimerLocked()
+	b.stopStagedApplyLocked()
+	b.saveWarmPeerHintsLocked()
 
 	if b.loginFlags&controlclient.LoginEphemeral != 0 {
 		b.mu.Unlock()
@@ -1236,6 +1378,7 @@ func (b *LocalBackend) Shutdown() {
 		b.notifyCancel()
 	}
 	b.appConnector.Close()
+	b.stopMDNSGatewayLocked()
 	b.mu.Unlock()
 	b.webClientShutdown()
 
@@ -1245,6 +1388,7 @@ func (b *LocalBackend) Shutdown() {
 		b.sockstatLogger.Shutdown(ctx)
 	}
 
+	b.stopUsageTracking()
 	b.unregisterSysPolicyWatch()
 	if cc != nil {
 		cc.Shutdown()
@@ -2055,6 +2199,10 @@ func (b *LocalBackend) applySysPolicyLocked(prefs *ipn.Prefs) (anyChange bool) {
 		anyChange = true
 	}
 
+	if b.applyDERPSysPolicyLocked(prefs) {
+		anyChange = true
+	}
+
 	if alwaysOn, _ := b.polc.GetBoolean(pkey.AlwaysOn, false); alwaysOn && !b.overrideAlwaysOn && !prefs.WantRunning {
 		prefs.WantRunning = true
 		anyChange = true
@@ -2074,6 +2222,42 @@ func (b *LocalBackend) applySysPolicyLocked(prefs *ipn.Prefs) (anyChange bool) {
 	return anyChange
 }
 
+// applyDERPSysPolicyLocked applies the DERP region policy settings to prefs
+// and reports whether any change was made.
+//
+// b.mu must be held.
+func (b *LocalBackend) applyDERPSysPolicyLocked(prefs *ipn.Prefs) (anyChange bool) {
+	syncs.RequiresMutex(&b.mu)
+
+	if homeStr, _ := b.polc.GetString(pkey.DERPHomeRegion, ""); homeStr != "" {
+		if home, err := strconv.Atoi(homeStr); err != nil || home <= 0 {
+			b.logf("ignoring invalid %s policy setting %q", pkey.DERPHomeRegion, homeStr)
+		} else if prefs.DERPHomeRegion != home {
+			prefs.DERPHomeRegion = home
+			anyChange = true
+		}
+	}
+
+	if denyStrs, _ := b.polc.GetStringArray(pkey.DERPDenyRegions, nil); len(denyStrs) > 0 {
+		deny := make([]int, 0, len(denyStrs))
+		for _, s := range denyStrs {
+			id, err := strconv.Atoi(s)
+			if err != nil || id <= 0 {
+				b.logf("ignoring invalid region %q in %s policy setting", s, pkey.DERPDenyRegions)
+				continue
+			}
+			deny = append(deny, id)
+		}
+		slices.Sort(deny)
+		deny = slices.Compact(deny)
+		if !slices.Equal(prefs.DERPDenyRegions, deny) {
+			prefs.DERPDenyRegions = deny
+			anyChange = true
+		}
+	}
+	return anyChange
+}
+
 // applyExitNodeSysPolicyLocked applies the exit node policy settings to prefs
 // and reports whether any change was made.
 //
@@ -2152,6 +2336,9 @@ func (b *LocalBackend) registerSysPolicyWatch() (unregister func(), err error) {
 		b.logf("syspolicy: changed initial profile prefs: %v", prefs.Pretty())
 	}
 	b.refreshAllowedSuggestions()
+	b.mu.Lock()
+	b.updateDNSOptionsLocked()
+	b.mu.Unlock()
 	return unregister, nil
 }
 
@@ -2200,6 +2387,20 @@ func (b *LocalBackend) sysPolicyChanged(policy policyclient.PolicyChange) {
 		// will be used when [applySysPolicy] updates the current profile's prefs.
 	}
 
+	if policy.HasChangedAnyOf(pkey.KeyExpirationNoticeTime, pkey.KeyExpirationNoticeMessage) {
+		b.mu.Lock()
+		b.updateKeyExpiryNoticeLocked(b.currentNode().NetMap())
+		b.mu.Unlock()
+	}
+
+	if policy.HasChangedAnyOf(dnsOptionsPolicies...) {
+		b.mu.Lock()
+		if b.updateDNSOptionsLocked() {
+			b.authReconfigLocked()
+		}
+		b.mu.Unlock()
+	}
+
 	if prefs, anyChange := b.reconcilePrefs(); anyChange {
 		b.logf("syspolicy: changed profile prefs: %v", prefs.Pretty())
 	}
@@ -2492,6 +2693,7 @@ func (b *LocalBackend) setWgengineStatusLocked(s *wgengine.Status) {
 	// "Starting" to "Running" in the call to state machine a few lines below
 	// this. Maybe we don't even need to store it at all.
 	b.engineStatus = es
+	b.updatePeerTrafficMetricsLocked(s)
 
 	needUpdateEndpoints := !slices.Equal(s.LocalAddrs, b.endpoints)
 	if needUpdateEndpoints {
@@ -2507,6 +2709,54 @@ func (b *LocalBackend) setWgengineStatusLocked(s *wgengine.Status) {
 	b.sendLocked(ipn.Notify{Engine: &es})
 }
 
+// disablePeerTrafficMetrics disables the per-peer traffic user metrics, whose
+// series grow with the number of peers.
+var disablePeerTrafficMetrics = envknob.RegisterBool("TS_DEBUG_DISABLE_PEER_TRAFFIC_METRICS")
+
+// updatePeerTrafficMetricsLocked feeds the per-peer traffic totals in s to
+// the peer traffic user metrics.
+//
+// b.mu must be held.
+func (b *LocalBackend) updatePeerTrafficMetricsLocked(s *wgengine.Status) {
+	if !buildfeatures.HasUserMetrics || disablePeerTrafficMetrics() {
+		return
+	}
+	syncs.RequiresMutex(&b.mu)
+	cn := b.currentNode()
+	seen := make(set.Set[key.NodePublic], len(s.Peers))
+	for _, ps := range s.Peers {
+		seen.Add(ps.NodeKey)
+		var labels usermetric.PeerTrafficLabels
+		if nid, ok := cn.NodeByKey(ps.NodeKey); ok {
+			if n, ok := cn.NodeByID(nid); ok {
+				labels = peerTrafficLabels(n)
+			}
+		}
+		b.metrics.peerInboundBytes.Observe(ps.NodeKey, labels, ps.RxBytes)
+		b.metrics.peerOutboundBytes.Observe(ps.NodeKey, labels, ps.TxBytes)
+	}
+	b.metrics.peerInboundBytes.Retain(seen.Contains)
+	b.metrics.peerOutboundBytes.Retain(seen.Contains)
+}
+
+// peerTrafficLabels returns the labels under which traffic to and from the
+// peer n is counted.
+func peerTrafficLabels(n tailcfg.NodeView) usermetric.PeerTrafficLabels {
+	labels := usermetric.PeerTrafficLabels{Role: usermetric.PeerRoleNode}
+	switch {
+	case tsaddr.ContainsExitRoutes(n.AllowedIPs()):
+		labels.Role = usermetric.PeerRoleExitNode
+	case tsaddr.ContainsNonExitSubnetRoutes(n.PrimaryRoutes()):
+		labels.Role = usermetric.PeerRoleSubnetRouter
+	}
+	if n.Tags().Len() > 0 {
+		tags := n.Tags().AsSlice()
+		slices.Sort(tags)
+		labels.Tags = strings.Join(tags, ",")
+	}
+	return labels
+}
+
 // SetNotifyCallback sets the function to call when the backend has something to
 // notify the frontend about. Only one callback can be set at a time, so calling
 // this function will replace the previous callback.
@@ -2666,7 +2916,8 @@ func (b *LocalBackend) startLocked(opts ipn.Options) error {
 	httpTestClient := b.httpTestClient
 
 	if b.hostinfo != nil {
-		hostinfo.Services = b.hostinfo.Services // keep any previous services
+		hostinfo.Services = b.hostinfo.Services     // keep any previous services
+		hostinfo.Attributes = b.hostinfo.Attributes // and attributes
 	}
 	b.hostinfo = hostinfo
 	b.setStateLocked(ipn.NoState)
@@ -2723,6 +2974,7 @@ func (b *LocalBackend) startLocked(opts ipn.Options) error {
 	// Reset the always-on override whenever Start is called.
 	b.resetAlwaysOnOverrideLocked()
 	b.setAtomicValuesFromPrefsLocked(prefs)
+	b.setDERPRegionPolicyLocked(prefs)
 	b.updateNoSNATExitNodeWarning(prefs)
 
 	wantRunning := prefs.WantRunning()
@@ -3928,6 +4180,18 @@ func (b *LocalBackend) setAtomicValuesFromPrefsLocked(p ipn.PrefsView) {
 	}
 }
 
+// setDERPRegionPolicyLocked configures magicsock with the DERP regions that
+// prefs p pin as home or deny.
+//
+// b.mu must be held.
+func (b *LocalBackend) setDERPRegionPolicyLocked(p ipn.PrefsView) {
+	if !p.Valid() {
+		b.MagicConn().SetDERPRegionPolicy(0, nil)
+		return
+	}
+	b.MagicConn().SetDERPRegionPolicy(p.DERPHomeRegion(), p.DERPDenyRegions().AsSlice())
+}
+
 // State returns the backend state machine's current state.
 func (b *LocalBackend) State() ipn.State {
 	b.mu.Lock()
@@ -4349,6 +4613,9 @@ func (b *LocalBackend) checkPrefsLocked(p *ipn.Prefs) error {
 	if err := checkAdvertiseRoutes(p); err != nil {
 		errs = append(errs, err)
 	}
+	if err := p.PeerIdle.Validate(); err != nil {
+		errs = append(errs, err)
+	}
 	return errors.Join(errs...)
 }
 
@@ -4931,6 +5198,7 @@ func (b *LocalBackend) setPrefsLocked(newp *ipn.Prefs) ipn.PrefsView {
 		b.doSetHostinfoFilterServicesLocked()
 	}
 
+	b.setDERPRegionPolicyLocked(newp.View())
 	if netMap != nil {
 		b.MagicConn().SetDERPMap(netMap.DERPMap)
 	}
@@ -5058,6 +5326,25 @@ func (b *LocalBackend) setPortlistServices(sl []tailcfg.Service) {
 	b.doSetHostinfoFilterServices()
 }
 
+// HostinfoAttributes is an eventbus topic for the hostinfoattrs extension
+// to set [tailcfg.Hostinfo.Attributes].
+type HostinfoAttributes map[string]string
+
+func (b *LocalBackend) setHostinfoAttributes(attrs HostinfoAttributes) {
+	if !buildfeatures.HasHostinfoAttrs { // redundant, but explicit for linker deadcode and humans
+		return
+	}
+
+	b.mu.Lock()
+	if b.hostinfo == nil {
+		b.hostinfo = new(tailcfg.Hostinfo)
+	}
+	b.hostinfo.Attributes = attrs
+	b.mu.Unlock()
+
+	b.doSetHostinfoFilterServices()
+}
+
 // doSetHostinfoFilterServices calls SetHostinfo on the controlclient,
 // possibly after mangling the given hostinfo.
 //
@@ -5373,8 +5660,12 @@ func (b *LocalBackend) authReconfigLocked() {
 	disableSubnetsIfPAC := cn.SelfHasCap(tailcfg.NodeAttrDisableSubnetsIfPAC)
 	dohURL, dohURLOK := cn.exitNodeCanProxyDNS(prefs.ExitNodeID())
 	dcfg := cn.dnsConfigForNetmap(prefs, b.keyExpired, version.OS())
+	if dcfg != nil && prefs.CorpDNS() {
+		dcfg.Options = b.dnsOptions
+	}
 	// If the current node is an app connector, ensure the app connector machine is started
 	b.reconfigAppConnectorLocked(nm, prefs)
+	b.reconfigMDNSGatewayLocked(nm, prefs)
 
 	if !prefs.WantRunning() {
 		b.logf("[v1] authReconfig: skipping because !WantRunning.")
@@ -5413,10 +5704,23 @@ func (b *LocalBackend) authReconfigLocked() {
 		b.logf("wgcfg: %v", err)
 		return
 	}
+	cfg.PeerIdle = peerIdleConfig(prefs.PeerIdle(), nm)
+	cfg.PeerIdle.AlwaysOn = append(cfg.PeerIdle.AlwaysOn, b.updateWarmPeersLocked(prefs, nm)...)
+
+	cfg, more := stageWGConfig(b.appliedWGCfg, cfg, stagedApplyBatchSize(), b.stagedApplyPeerPriority)
+	if more {
+		metricStagedApplyBatches.Add(1)
+		b.logf("[v1] authReconfig: applying %d of %d peers; more to come", len(cfg.Peers), len(nm.Peers))
+		b.scheduleStagedApplyLocked()
+	}
 
 	oneCGNATRoute := shouldUseOneCGNATRoute(b.logf, b.sys.NetMon.Get(), b.sys.ControlKnobs(), version.OS())
 	rcfg := b.routerConfigLocked(cfg, prefs, nm, oneCGNATRoute)
 
+	// Remember the config before the extra Allowed IPs below, to compare
+	// with the next one from nmcfg.WGCfg once it's applied.
+	applied := cfg.Clone()
+
 	// Add these extra Allowed IPs after router configuration, because the expected
 	// extension (features/conn25), does not want these routes installed on the OS.
 	// See also [Hooks.ExtraWireGuardAllowedIPs].
@@ -5427,10 +5731,22 @@ func (b *LocalBackend) authReconfigLocked() {
 		}
 	}
 
+	ns := b.netSettingsToApplyLocked(netSettings{router: rcfg, dns: dcfg})
+	rcfg, dcfg = ns.router, ns.dns
+
+	start := b.clock.Now()
 	err = b.e.Reconfig(cfg, rcfg, dcfg)
 	if err == wgengine.ErrNoChanges {
+		b.appliedWGCfg = applied
 		return
 	}
+	if err == nil {
+		b.appliedWGCfg = applied
+		b.netSettingsAppliedLocked(ns)
+	}
+	d := b.clock.Since(start).Milliseconds()
+	metricReconfigDurationMs.Add(d)
+	metricReconfigLastDurationMs.Set(d)
 	b.logf("[v1] authReconfig: ra=%v dns=%v 0x%02x: %v", prefs.RouteAll(), prefs.CorpDNS(), flags, err)
 
 	b.initPeerAPIListenerLocked()
@@ -5439,6 +5755,22 @@ func (b *LocalBackend) authReconfigLocked() {
 	}
 }
 
+// peerIdleConfig returns the engine's configuration for tearing down the
+// WireGuard sessions of idle peers, per the PeerIdle prefs. AlwaysOn peers
+// that aren't in nm are ignored.
+func peerIdleConfig(p ipn.PeerIdlePrefsView, nm *netmap.NetworkMap) wgcfg.PeerIdleConfig {
+	ret := wgcfg.PeerIdleConfig{
+		Timeout:   p.Timeout(),
+		MaxActive: p.MaxActive(),
+	}
+	for _, id := range p.AlwaysOn().All() {
+		if n, ok := nm.PeerWithStableID(id); ok {
+			ret.AlwaysOn = append(ret.AlwaysOn, n.Key())
+		}
+	}
+	return ret
+}
+
 // shouldUseOneCGNATRoute reports whether we should prefer to make one big
 // CGNAT /10 route rather than a /32 per peer.
 //
@@ -5829,13 +6161,15 @@ func (b *LocalBackend) routerConfigLocked(cfg *wgcfg.Config, prefs ipn.PrefsView
 
 	rs := &router.Config{
 		LocalAddrs:          unmapIPPrefixes(cfg.Addresses),
-		SubnetRoutes:        unmapIPPrefixes(prefs.AdvertiseRoutes().AsSlice()),
+		SubnetRoutes:        unmapIPPrefixes(b.advertisedRoutesLocked(prefs).AsSlice()),
 		SNATSubnetRoutes:    !prefs.NoSNAT(),
 		StatefulFiltering:   doStatefulFiltering,
 		NetfilterMode:       prefs.NetfilterMode(),
 		Routes:              peerRoutes(b.logf, cfg.Peers, singleRouteThreshold, prefs.RouteAll()),
 		NetfilterKind:       netfilterKind,
 		RemoveCGNATDropRule: nm.HasCap(tailcfg.NodeAttrDisableLinuxCGNATDropRule),
+		ExcludeApps:         prefs.ExcludeApps().AsSlice(),
+		RequireTunnelApps:   prefs.RequireTunnelApps().AsSlice(),
 	}
 
 	if buildfeatures.HasSynology && distro.Get() == distro.Synology {
@@ -5935,13 +6269,13 @@ func (b *LocalBackend) applyPrefsToHostinfoLocked(hi *tailcfg.Hostinfo, prefs ip
 	if h := prefs.Hostname(); h != "" {
 		hi.Hostname = h
 	}
-	hi.RoutableIPs = prefs.AdvertiseRoutes().AsSlice()
+	hi.RoutableIPs = b.advertisedRoutesLocked(prefs).AsSlice()
 	hi.RequestTags = prefs.AdvertiseTags().AsSlice()
 	hi.ShieldsUp = prefs.ShieldsUp()
 	hi.AllowsUpdate = buildfeatures.HasClientUpdate && (envknob.AllowsRemoteUpdate() || prefs.AutoUpdate().Apply.EqualBool(true))
 
 	if buildfeatures.HasAdvertiseRoutes {
-		b.metrics.advertisedRoutes.Set(float64(tsaddr.WithoutExitRoute(prefs.AdvertiseRoutes()).Len()))
+		b.metrics.advertisedRoutes.Set(float64(tsaddr.WithoutExitRoute(views.SliceOf(hi.RoutableIPs)).Len()))
 
 		// Set up IP forwarding check when routes change
 		if len(hi.RoutableIPs) > 0 && b.NetMon() != nil && !b.sys.IsNetstackRouter() {
@@ -6041,6 +6375,7 @@ func (b *LocalBackend) enterStateLocked(newState ipn.State) {
 		// necessary and add unit tests to cover those cases, or remove it.
 		if oldState != ipn.Running {
 			b.resetAuthURLLocked()
+			b.updateFunnelScheduleLocked()
 		}
 
 		// Start a captive portal detection loop if none has been
@@ -6056,6 +6391,7 @@ func (b *LocalBackend) enterStateLocked(newState ipn.State) {
 	} else if oldState == ipn.Running {
 		// Transitioning away from running.
 		b.closePeerAPIListenersLocked()
+		b.updateFunnelScheduleLocked()
 
 		// Stop any existing captive portal detection loop.
 		if buildfeatures.HasCaptivePortal && b.captiveCancel != nil {
@@ -6091,6 +6427,8 @@ func (b *LocalBackend) enterStateLocked(newState ipn.State) {
 	case ipn.Stopped, ipn.NoState:
 		// Unconfigure the engine if it has stopped (WantRunning is set to false)
 		// or if we've switched to a different profile and the state is unknown.
+		b.stopStagedApplyLocked()
+		b.resetNetSettingsLocked()
 		err := b.e.Reconfig(&wgcfg.Config{}, &router.Config{}, &dns.Config{})
 		if err != nil {
 			b.logf("Reconfig(down): %v", err)
@@ -6610,6 +6948,7 @@ func (b *LocalBackend) setNetMapLocked(nm *netmap.NetworkMap) {
 	} else {
 		b.health.SetControlHealth(nil)
 	}
+	b.updateKeyExpiryNoticeLocked(nm)
 
 	if runtime.GOOS == "linux" && buildfeatures.HasOSRouter {
 		if nm.HasCap(tailcfg.NodeAttrLinuxMustUseIPTables) {
@@ -7212,6 +7551,12 @@ func (b *LocalBackend) DebugPeerRelayServers() set.Set[netip.Addr] {
 	return b.MagicConn().PeerRelays()
 }
 
+// DebugPortMapLeases returns the NAT-PMP, PCP or UPnP port mapping leases
+// this node currently holds.
+func (b *LocalBackend) DebugPortMapLeases() []portmappertype.Lease {
+	return b.MagicConn().PortMapLeases()
+}
+
 // DebugPeerDiscoKeys returns the disco public keys this node has learned for
 // each of its peers from the most recent network map. Intended for tests
 // (the production [ipnstate.PeerStatus] purposefully does not surface disco
@@ -7564,6 +7909,118 @@ func (b *LocalBackend) NewProfile() error {
 	return b.resetForProfileChangeLocked()
 }
 
+// portablePrefs returns the subset of p that's carried by a profile export:
+// settings that describe how to use the tailnet rather than this machine.
+// Machine-local settings, such as the operator user, hostname, advertised
+// routes and services, exit node selection, netfilter settings and Taildrive
+// shares, are left out, as are the node's identity and keys.
+func portablePrefs(p *ipn.Prefs) *ipn.MaskedPrefs {
+	return &ipn.MaskedPrefs{
+		Prefs: ipn.Prefs{
+			ControlURL:             p.ControlURL,
+			RouteAll:               p.RouteAll,
+			ExitNodeAllowLANAccess: p.ExitNodeAllowLANAccess,
+			CorpDNS:                p.CorpDNS,
+			ShieldsUp:              p.ShieldsUp,
+			AdvertiseTags:          slices.Clone(p.AdvertiseTags),
+			NotepadURLs:            p.NotepadURLs,
+			Sync:                   p.Sync,
+			ProfileName:            p.ProfileName,
+			PostureChecking:        p.PostureChecking,
+			DERPHomeRegion:         p.DERPHomeRegion,
+			DERPDenyRegions:        slices.Clone(p.DERPDenyRegions),
+			PeerIdle:               p.PeerIdle,
+			KeepWarmPeers:          slices.Clone(p.KeepWarmPeers),
+		},
+		ControlURLSet:             true,
+		RouteAllSet:               true,
+		ExitNodeAllowLANAccessSet: true,
+		CorpDNSSet:                true,
+		ShieldsUpSet:              true,
+		AdvertiseTagsSet:          true,
+		NotepadURLsSet:            true,
+		SyncSet:                   true,
+		ProfileNameSet:            true,
+		PostureCheckingSet:        true,
+		DERPHomeRegionSet:         true,
+		DERPDenyRegionsSet:        true,
+		PeerIdleSet:               true,
+		KeepWarmPeersSet:          true,
+	}
+}
+
+// ExportProfile returns the profile with the given ID and its prefs in a
+// form suitable for importing on another machine with [LocalBackend.ImportProfile].
+// Only the prefs returned by [portablePrefs] are included; the node's keys
+// and machine-local settings aren't.
+func (b *LocalBackend) ExportProfile(id ipn.ProfileID) (*ipn.ProfileExport, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lp, err := b.pm.ProfileByID(id)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := b.pm.ProfilePrefs(id)
+	if err != nil {
+		return nil, err
+	}
+	p := new(ipn.Prefs)
+	p.ApplyEdits(portablePrefs(prefs.AsStruct()))
+	return &ipn.ProfileExport{
+		Version:        ipn.ProfileExportVersion,
+		Name:           lp.Name(),
+		NetworkProfile: lp.NetworkProfile(),
+		ControlURL:     lp.ControlURL(),
+		Prefs:          p,
+	}, nil
+}
+
+// ImportProfile creates and switches to a new profile with the prefs from ex,
+// as returned by [LocalBackend.ExportProfile] on this or another machine.
+//
+// Only the prefs returned by [portablePrefs] are imported, and they're applied
+// on behalf of actor as by [LocalBackend.EditPrefsAs], so they're subject to
+// the same access checks, validation and system policy. If that fails, the
+// previous profile is restored.
+//
+// The node's identity isn't carried over: the new profile is logged out and,
+// like one created by [LocalBackend.NewProfile], it's only persisted once the
+// user logs in, becoming a new node.
+func (b *LocalBackend) ImportProfile(ex *ipn.ProfileExport, actor ipnauth.Actor) error {
+	if ex.Version != ipn.ProfileExportVersion {
+		return fmt.Errorf("unsupported profile export version %d", ex.Version)
+	}
+	if ex.Prefs == nil {
+		return errors.New("profile export has no prefs")
+	}
+	if b.health.IsUnhealthy(ipn.StateStoreHealth) {
+		return errors.New("cannot log in when state store is unhealthy")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prev := b.pm.CurrentProfile()
+	b.pm.SwitchToNewProfile()
+	b.resetDialPlan()
+	if err := b.resetForProfileChangeLocked(); err != nil {
+		return err
+	}
+	if _, err := b.editPrefsLocked(actor, portablePrefs(ex.Prefs)); err != nil {
+		if prev.ID() == "" {
+			b.pm.SwitchToNewProfile()
+		} else if _, _, err := b.pm.SwitchToProfileByID(prev.ID()); err != nil {
+			b.logf("ImportProfile: restoring profile %q: %v", prev.ID(), err)
+		}
+		b.resetDialPlan()
+		if err := b.resetForProfileChangeLocked(); err != nil {
+			b.logf("ImportProfile: %v", err)
+		}
+		return err
+	}
+	return nil
+}
+
 // ListProfiles returns a list of all LoginProfiles.
 func (b *LocalBackend) ListProfiles() []ipn.LoginProfileView {
 	b.mu.Lock()
@@ -7610,6 +8067,26 @@ func (b *LocalBackend) GetPeerEndpointChanges(ctx context.Context, ip netip.Addr
 	return chs, nil
 }
 
+// GetPeerPathStats returns the path quality stats of the peer with Tailscale
+// IP ip, or of all peers if ip is the zero value.
+func (b *LocalBackend) GetPeerPathStats(ip netip.Addr) ([]magicsock.PeerPathStats, error) {
+	if !ip.IsValid() {
+		return b.MagicConn().AllPeerPathStats(), nil
+	}
+	pip, ok := b.e.PeerForIP(ip)
+	if !ok {
+		return nil, fmt.Errorf("no matching peer")
+	}
+	if pip.IsSelf {
+		return nil, fmt.Errorf("%v is local Tailscale IP", ip)
+	}
+	st, err := b.MagicConn().GetPeerPathStats(pip.Node)
+	if err != nil {
+		return nil, fmt.Errorf("getting path stats: %w", err)
+	}
+	return []magicsock.PeerPathStats{st}, nil
+}
+
 var breakTCPConns func() error
 
 func (b *LocalBackend) DebugBreakTCPConns() error {
@@ -7844,6 +8321,65 @@ func (b *LocalBackend) SuggestExitNode() (response apitype.ExitNodeSuggestionRes
 	return b.suggestExitNodeLocked()
 }
 
+// ExitNodeSuggestionFilter restricts the exit nodes considered by
+// [LocalBackend.SuggestExitNodeMatching]. The zero value matches all exit
+// nodes.
+type ExitNodeSuggestionFilter struct {
+	// Country, if non-empty, is the country name or ISO 3166-1 alpha-2 code
+	// of the exit nodes to consider, matched case-insensitively.
+	Country string
+
+	// Tag, if non-empty, is a tag the exit nodes must have, such as
+	// "tag:exit".
+	Tag string
+}
+
+// matches reports whether the peer p matches f.
+func (f ExitNodeSuggestionFilter) matches(p tailcfg.NodeView) bool {
+	if f.Country != "" {
+		hi := p.Hostinfo()
+		if !hi.Valid() || !hi.Location().Valid() {
+			return false
+		}
+		loc := hi.Location()
+		if !strings.EqualFold(loc.Country(), f.Country) && !strings.EqualFold(loc.CountryCode(), f.Country) {
+			return false
+		}
+	}
+	return f.Tag == "" || views.SliceContains(p.Tags(), f.Tag)
+}
+
+// SuggestExitNodeMatching is like [LocalBackend.SuggestExitNode], but only
+// considers the exit nodes matching f, and also returns all the exit nodes
+// it considered and how they scored. Unlike SuggestExitNode, it doesn't
+// change the suggestion that IPN bus watchers and the auto exit node see.
+func (b *LocalBackend) SuggestExitNodeMatching(f ExitNodeSuggestionFilter) (response apitype.ExitNodeSuggestionResponse, err error) {
+	if !buildfeatures.HasUseExitNode {
+		return response, feature.ErrUnavailable
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	report := b.MagicConn().GetLastNetcheckReport(b.ctx)
+	nb := b.currentNode()
+	allowList := b.getAllowedSuggestions()
+	if f != (ExitNodeSuggestionFilter{}) {
+		matching := make(set.Set[tailcfg.StableNodeID])
+		nb.AppendMatchingPeers(nil, func(p tailcfg.NodeView) bool {
+			if f.matches(p) && (allowList == nil || allowList.Contains(p.StableID())) {
+				matching.Add(p.StableID())
+			}
+			return false
+		})
+		allowList = matching
+	}
+	res, err := suggestExitNode(report, nb, b.lastSuggestedExitNode, randomRegion, randomNode, allowList)
+	if err != nil {
+		return res, err
+	}
+	res.Candidates = explainExitNodeSuggestion(report, nb, allowList, res.ID)
+	return res, nil
+}
+
 // getAllowedSuggestions returns a set of exit nodes permitted by the most recent
 // [pkey.AllowedSuggestedExitNodes] value. Callers must not mutate the returned set.
 func (b *LocalBackend) getAllowedSuggestions() set.Set[tailcfg.StableNodeID] {
@@ -7936,18 +8472,7 @@ func suggestExitNodeUsingDERP(report *netcheck.Report, nb *nodeBackend, prevSugg
 	if report == nil || report.PreferredDERP == 0 || netMap == nil || netMap.DERPMap == nil {
 		return res, ErrNoPreferredDERP
 	}
-	// Use [nodeBackend.AppendMatchingPeers] instead of the netmap directly,
-	// since the netmap doesn't include delta updates (e.g., home DERP or Online
-	// status changes) from the control plane since the last full update.
-	candidates := nb.AppendMatchingPeers(nil, func(peer tailcfg.NodeView) bool {
-		if !peer.Valid() || !nb.PeerIsReachable(ctx, peer) {
-			return false
-		}
-		if allowList != nil && !allowList.Contains(peer.StableID()) {
-			return false
-		}
-		return peer.CapMap().Contains(tailcfg.NodeAttrSuggestExitNode) && tsaddr.ContainsExitRoutes(peer.AllowedIPs())
-	})
+	candidates := exitNodeSuggestionCandidates(ctx, nb, allowList)
 	if len(candidates) == 0 {
 		return res, nil
 	}
@@ -8022,18 +8547,9 @@ type nodeDistance struct {
 		return res, nil
 	}
 	// None of the candidates have a DERP home, so proceed to select based on geographical distance from our preferred DERP region.
-
-	// allowanceMeters is the extra distance that will be permitted when considering peers. By this point, there
-	// are multiple approximations taking place (DERP location standing in for this device's location, the peer's
-	// location may only be city granularity, the distance algorithm assumes a spherical planet, etc.) so it is
-	// reasonable to consider peers that are similar distances. Those peers are good enough to be within
-	// measurement error. 100km corresponds to approximately 1ms of additional round trip light
-	// propagation delay in a fiber optic cable and seems like a reasonable heuristic. It may be adjusted in
-	// future.
-	const allowanceMeters = 100000
 	pickFrom := make([]tailcfg.NodeView, 0, len(distances))
 	for _, candidate := range distances {
-		if candidate.nv.Valid() && candidate.distance <= minDistance+allowanceMeters {
+		if candidate.nv.Valid() && candidate.distance <= minDistance+exitNodeAllowanceMeters {
 			pickFrom = append(pickFrom, candidate.nv)
 		}
 	}
@@ -8062,6 +8578,33 @@ type nodeDistance struct {
 	return res, nil
 }
 
+// exitNodeAllowanceMeters is the extra distance that will be permitted when considering peers. By this point, there
+// are multiple approximations taking place (DERP location standing in for this device's location, the peer's
+// location may only be city granularity, the distance algorithm assumes a spherical planet, etc.) so it is
+// reasonable to consider peers that are similar distances. Those peers are good enough to be within
+// measurement error. 100km corresponds to approximately 1ms of additional round trip light
+// propagation delay in a fiber optic cable and seems like a reasonable heuristic. It may be adjusted in
+// future.
+const exitNodeAllowanceMeters = 100000
+
+// exitNodeSuggestionCandidates returns the peers eligible to be suggested as
+// an exit node: reachable peers offering exit routes, with
+// NodeAttrSuggestExitNode in their CapMap, and in allowList if it's non-nil.
+func exitNodeSuggestionCandidates(ctx context.Context, nb *nodeBackend, allowList set.Set[tailcfg.StableNodeID]) []tailcfg.NodeView {
+	// Use [nodeBackend.AppendMatchingPeers] instead of the netmap directly,
+	// since the netmap doesn't include delta updates (e.g., home DERP or Online
+	// status changes) from the control plane since the last full update.
+	return nb.AppendMatchingPeers(nil, func(peer tailcfg.NodeView) bool {
+		if !peer.Valid() || !nb.PeerIsReachable(ctx, peer) {
+			return false
+		}
+		if allowList != nil && !allowList.Contains(peer.StableID()) {
+			return false
+		}
+		return peer.CapMap().Contains(tailcfg.NodeAttrSuggestExitNode) && tsaddr.ContainsExitRoutes(peer.AllowedIPs())
+	})
+}
+
 var ErrNoNetMap = errors.New("no network map, try again later")
 
 // suggestExitNodeUsingTrafficSteering uses traffic steering priority scores to
@@ -8087,24 +8630,7 @@ func suggestExitNodeUsingTrafficSteering(nb *nodeBackend, allowed set.Set[tailcf
 		panic("missing traffic-steering capability")
 	}
 
-	nodes := nb.AppendMatchingPeers(nil, func(p tailcfg.NodeView) bool {
-		if !p.Valid() {
-			return false
-		}
-		if !nb.PeerIsReachable(ctx, p) {
-			return false
-		}
-		if allowed != nil && !allowed.Contains(p.StableID()) {
-			return false
-		}
-		if !p.CapMap().Contains(tailcfg.NodeAttrSuggestExitNode) {
-			return false
-		}
-		if !tsaddr.ContainsExitRoutes(p.AllowedIPs()) {
-			return false
-		}
-		return true
-	})
+	nodes := exitNodeSuggestionCandidates(ctx, nb, allowed)
 
 	scores := make(map[tailcfg.NodeID]int, len(nodes))
 	score := func(n tailcfg.NodeView) int {
@@ -8174,6 +8700,124 @@ func suggestExitNodeUsingTrafficSteering(nb *nodeBackend, allowed set.Set[tailcf
 	return res, nil
 }
 
+// explainExitNodeSuggestion returns the exit nodes that suggestExitNode
+// considered when it suggested the exit node suggested, best first, with how
+// they scored and why they were or weren't suggested.
+func explainExitNodeSuggestion(report *netcheck.Report, nb *nodeBackend, allowList set.Set[tailcfg.StableNodeID], suggested tailcfg.StableNodeID) []apitype.ExitNodeCandidate {
+	steering := nb.SelfHasCap(tailcfg.NodeAttrTrafficSteering)
+	var preferred *tailcfg.DERPRegion
+	if nm := nb.NetMap(); report != nil && nm != nil && nm.DERPMap != nil {
+		preferred = nm.DERPMap.Regions[report.PreferredDERP]
+	}
+
+	peers := exitNodeSuggestionCandidates(context.TODO(), nb, allowList)
+	cands := make([]apitype.ExitNodeCandidate, 0, len(peers))
+	var anyDERPHome bool
+	minDistance := math.MaxFloat64
+	for _, p := range peers {
+		c := apitype.ExitNodeCandidate{
+			ID:         p.StableID(),
+			Name:       p.Name(),
+			DERPRegion: p.HomeDERP(),
+		}
+		if c.DERPRegion != 0 {
+			anyDERPHome = true
+			if report != nil {
+				c.DERPLatency = report.RegionLatency[c.DERPRegion]
+			}
+		}
+		if hi := p.Hostinfo(); hi.Valid() && hi.Location().Valid() {
+			loc := hi.Location()
+			c.Location = loc
+			c.Priority = loc.Priority()
+			if preferred != nil {
+				c.Distance = longLatDistance(preferred.Latitude, preferred.Longitude, loc.Latitude(), loc.Longitude())
+				if c.DERPRegion == 0 {
+					minDistance = min(minDistance, c.Distance)
+				}
+			}
+		}
+		cands = append(cands, c)
+	}
+
+	var best apitype.ExitNodeCandidate
+	for _, c := range cands {
+		if c.ID == suggested {
+			best = c
+		}
+	}
+	for i := range cands {
+		c := &cands[i]
+		switch {
+		case suggested == "":
+		case c.ID == suggested && len(cands) == 1:
+			c.Reason = "only candidate"
+		case c.ID == suggested && steering:
+			c.Reason = "highest priority"
+		case c.ID == suggested && anyDERPHome:
+			c.Reason = "home DERP region with the lowest latency"
+		case c.ID == suggested:
+			c.Reason = "closest location with the highest priority"
+		case steering && c.Priority < best.Priority:
+			c.Reason = "lower priority"
+		case steering:
+			c.Reason = "same priority as the suggestion"
+		case anyDERPHome && c.DERPRegion == 0:
+			c.Reason = "no home DERP region"
+		case anyDERPHome && c.DERPRegion == best.DERPRegion:
+			c.Reason = "same home DERP region as the suggestion"
+		case anyDERPHome && c.DERPLatency == 0:
+			c.Reason = "home DERP region latency unknown"
+		case anyDERPHome:
+			c.Reason = "home DERP region with higher latency"
+		case !c.Location.Valid():
+			c.Reason = "no location"
+		case c.Distance > minDistance+exitNodeAllowanceMeters:
+			c.Reason = "farther away"
+		case c.Priority < best.Priority:
+			c.Reason = "lower priority"
+		default:
+			c.Reason = "as good as the suggestion"
+		}
+	}
+
+	// rank orders the suggestion first, then candidates with a home DERP
+	// region, unless traffic steering ignores those.
+	rank := func(c apitype.ExitNodeCandidate) int {
+		switch {
+		case c.ID == suggested:
+			return 0
+		case c.DERPRegion != 0 && !steering:
+			return 1
+		}
+		return 2
+	}
+	// latency sorts unknown latencies last.
+	latency := func(c apitype.ExitNodeCandidate) time.Duration {
+		if c.DERPLatency == 0 {
+			return math.MaxInt64
+		}
+		return c.DERPLatency
+	}
+	slices.SortStableFunc(cands, func(a, b apitype.ExitNodeCandidate) int {
+		if steering {
+			return cmp.Or(
+				cmp.Compare(rank(a), rank(b)),
+				cmp.Compare(b.Priority, a.Priority),
+				cmp.Compare(a.Name, b.Name),
+			)
+		}
+		return cmp.Or(
+			cmp.Compare(rank(a), rank(b)),
+			cmp.Compare(latency(a), latency(b)),
+			cmp.Compare(a.Distance, b.Distance),
+			cmp.Compare(b.Priority, a.Priority),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+	return cands
+}
+
 // pickWeighted chooses the node with highest priority given a list of mullvad nodes.
 func pickWeighted(candidates []tailcfg.NodeView) []tailcfg.NodeView {
 	maxWeight := 0
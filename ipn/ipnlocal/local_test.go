@@ -17,6 +17,7 @@
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"slices"
 	"strings"
 	"sync"
@@ -31,6 +32,7 @@
 	"golang.org/x/net/dns/dnsmessage"
 	"tailscale.com/appc"
 	"tailscale.com/appc/appctest"
+	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/control/controlclient"
 	"tailscale.com/control/controlknobs"
 	"tailscale.com/drive"
@@ -5896,6 +5898,83 @@ func TestSuggestExitNodeTrafficSteering(t *testing.T) {
 	}
 }
 
+func TestExplainExitNodeSuggestion(t *testing.T) {
+	dallas := &tailcfg.Location{
+		Country:     "United States",
+		CountryCode: "US",
+		Latitude:    32.779167,
+		Longitude:   -96.808889,
+		Priority:    100,
+	}
+	nm := &netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{
+			Addresses: []netip.Prefix{netip.MustParsePrefix("100.64.1.1/32")},
+		}).View(),
+		DERPMap: &tailcfg.DERPMap{
+			Regions: map[int]*tailcfg.DERPRegion{
+				1: {Latitude: 32, Longitude: -97},
+				2: {},
+				3: {},
+			},
+		},
+		Peers: []tailcfg.NodeView{
+			makePeer(1, withExitRoutes(), withSuggest()),
+			makePeer(2, withExitRoutes(), withSuggest(), withDERP(3)),
+			makePeer(3, withExitRoutes(), withSuggest(), withDERP(2)),
+			makePeer(4, withExitRoutes(), withSuggest(), withoutDERP(), withLocation(dallas.View())),
+			makePeer(5, withExitRoutes()), // not suggestible
+		},
+	}
+	report := &netcheck.Report{
+		RegionLatency: map[int]time.Duration{
+			1: 10 * time.Millisecond,
+			3: 30 * time.Millisecond,
+		},
+		PreferredDERP: 1,
+	}
+
+	nb := newNodeBackend(t.Context(), tstest.WhileTestRunningLogger(t), eventbus.New())
+	defer nb.shutdown(errShutdown)
+	nb.SetNetMap(nm)
+
+	got := explainExitNodeSuggestion(report, nb, nil, "stable1")
+	want := []apitype.ExitNodeCandidate{
+		{ID: "stable1", Name: "peer1", DERPRegion: 1, DERPLatency: 10 * time.Millisecond, Reason: "home DERP region with the lowest latency"},
+		{ID: "stable2", Name: "peer2", DERPRegion: 3, DERPLatency: 30 * time.Millisecond, Reason: "home DERP region with higher latency"},
+		{ID: "stable3", Name: "peer3", DERPRegion: 2, Reason: "home DERP region latency unknown"},
+		{ID: "stable4", Name: "peer4", Location: dallas.View(), Priority: 100, Reason: "no home DERP region"},
+	}
+	opts := []cmp.Option{
+		cmp.Comparer(func(a, b tailcfg.LocationView) bool { return reflect.DeepEqual(a.AsStruct(), b.AsStruct()) }),
+		cmpopts.IgnoreFields(apitype.ExitNodeCandidate{}, "Distance"),
+	}
+	if diff := cmp.Diff(want, got, opts...); diff != "" {
+		t.Errorf("candidates mismatch (-want +got):\n%s", diff)
+	}
+	if d := got[3].Distance; d < 50_000 || d > 150_000 {
+		t.Errorf("distance to Dallas = %vm; want about 90km", d)
+	}
+
+	// Filters restrict the candidates.
+	for _, tt := range []struct {
+		filter ExitNodeSuggestionFilter
+		peer   tailcfg.NodeView
+		want   bool
+	}{
+		{ExitNodeSuggestionFilter{}, nm.Peers[0], true},
+		{ExitNodeSuggestionFilter{Country: "us"}, nm.Peers[3], true},
+		{ExitNodeSuggestionFilter{Country: "united states"}, nm.Peers[3], true},
+		{ExitNodeSuggestionFilter{Country: "CA"}, nm.Peers[3], false},
+		{ExitNodeSuggestionFilter{Country: "US"}, nm.Peers[0], false},
+		{ExitNodeSuggestionFilter{Tag: "tag:exit"}, nm.Peers[0], false},
+		{ExitNodeSuggestionFilter{Tag: "tag:exit"}, makePeer(6, func(n *tailcfg.Node) { n.Tags = []string{"tag:exit"} }), true},
+	} {
+		if got := tt.filter.matches(tt.peer); got != tt.want {
+			t.Errorf("%+v matches %v = %v; want %v", tt.filter, tt.peer.Name(), got, tt.want)
+		}
+	}
+}
+
 func TestMinLatencyDERPregion(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -8232,3 +8311,148 @@ func TestPeerRoutesCGNATCollapse(t *testing.T) {
 		t.Errorf("with subnet: got %v; want %v", got, want)
 	}
 }
+
+func TestStartupProfile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("tailscaled on Windows starts with the connecting user's profile")
+	}
+	// newStore returns a state store with profiles for alice and bob,
+	// with bob's being the last used one.
+	newStore := func(t *testing.T) (_ ipn.StateStore, aliceID ipn.ProfileID) {
+		store := new(mem.Store)
+		pm, err := newProfileManager(store, t.Logf, health.NewTracker(eventbustest.NewBus(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, name := range []string{"alice", "bob"} {
+			pm.SwitchToNewProfile()
+			p := pm.CurrentPrefs().AsStruct()
+			p.Persist = &persist.Persist{
+				NodeID:         tailcfg.StableNodeID(fmt.Sprint(i)),
+				PrivateNodeKey: key.NewNode(),
+				UserProfile: tailcfg.UserProfile{
+					ID:        tailcfg.UserID(i + 1),
+					LoginName: name,
+				},
+			}
+			if err := pm.SetPrefs(p.View(), ipn.NetworkProfile{}); err != nil {
+				t.Fatal(err)
+			}
+			if name == "alice" {
+				aliceID = pm.CurrentProfile().ID()
+			}
+		}
+		return store, aliceID
+	}
+
+	tests := []struct {
+		name   string
+		flag   string
+		policy string
+		byID   bool // use alice's profile ID as the flag value
+		want   string
+	}{
+		{name: "last_used", want: "bob"},
+		{name: "flag", flag: "alice", want: "alice"},
+		{name: "flag_id", byID: true, want: "alice"},
+		{name: "policy", policy: "alice", want: "alice"},
+		{name: "flag_over_policy", flag: "bob", policy: "alice", want: "bob"},
+		{name: "unknown", flag: "carol", want: "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, aliceID := newStore(t)
+			sys := tsd.NewSystemWithBus(eventbustest.NewBus(t))
+			sys.Set(store)
+			sys.StartupProfile = tt.flag
+			if tt.byID {
+				sys.StartupProfile = string(aliceID)
+			}
+			if tt.policy != "" {
+				sys.PolicyClient.Set(policytest.Config{pkey.DefaultProfile: tt.policy})
+			}
+			b := newTestLocalBackendWithSys(t, sys)
+			if got := b.pm.CurrentProfile().Name(); got != tt.want {
+				t.Errorf("startup profile = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportImportProfile(t *testing.T) {
+	b := newTestLocalBackend(t)
+	user := &ipnauth.TestActor{}
+	// Persist can't be set by SetPrefsForTest, so set it as a login does.
+	if err := b.pm.SetPrefs((&ipn.Prefs{
+		ControlURL:      "https://control.example.com",
+		ShieldsUp:       true,
+		ProfileName:     "work",
+		Hostname:        "laptop",
+		OperatorUser:    "alice",
+		AdvertiseRoutes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+		WantRunning:     true,
+		Persist: &persist.Persist{
+			PrivateNodeKey: key.NewNode(),
+			NodeID:         "node1",
+			UserProfile:    tailcfg.UserProfile{LoginName: "user@example.com"},
+		},
+	}).View(), ipn.NetworkProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	src := b.CurrentProfile()
+	if src.ID() == "" {
+		t.Fatal("profile not persisted")
+	}
+
+	ex, err := b.ExportProfile(src.ID())
+	if err != nil {
+		t.Fatalf("ExportProfile: %v", err)
+	}
+	if ex.Prefs.Persist != nil {
+		t.Errorf("export includes Persist: %v", ex.Prefs.Persist)
+	}
+	if ex.Prefs.Hostname != "" || ex.Prefs.OperatorUser != "" || len(ex.Prefs.AdvertiseRoutes) > 0 {
+		t.Errorf("export includes machine-local prefs: %v", ex.Prefs.Pretty())
+	}
+	if ex.Name != "work" || !ex.Prefs.ShieldsUp {
+		t.Errorf("export = %+v; missing profile details", ex)
+	}
+
+	// The exported profile name is still in use on this machine,
+	// so the import fails validation and the profile is restored.
+	if err := b.ImportProfile(ex, user); err == nil {
+		t.Error("ImportProfile accepted a profile name that's in use")
+	}
+	if got := b.CurrentProfile(); got.ID() != src.ID() {
+		t.Errorf("after failed import, current profile = %q; want %q", got.ID(), src.ID())
+	}
+
+	ex.Prefs.ProfileName = ""
+	if err := b.ImportProfile(ex, user); err != nil {
+		t.Fatalf("ImportProfile: %v", err)
+	}
+	if got := b.CurrentProfile(); got.ID() != "" {
+		t.Errorf("imported profile was persisted before login: %v", got.ID())
+	}
+	prefs := b.Prefs()
+	if !prefs.ShieldsUp() || prefs.ControlURL() != "https://control.example.com" {
+		t.Errorf("imported prefs = %v; want exported settings", prefs.Pretty())
+	}
+	if prefs.Hostname() != "" || prefs.OperatorUser() != "" || prefs.AdvertiseRoutes().Len() > 0 {
+		t.Errorf("imported prefs = %v; want no machine-local settings", prefs.Pretty())
+	}
+	if !prefs.LoggedOut() || prefs.WantRunning() {
+		t.Errorf("imported profile LoggedOut=%v, WantRunning=%v; want logged out and not running", prefs.LoggedOut(), prefs.WantRunning())
+	}
+	if prefs.Persist().Valid() && !prefs.Persist().PrivateNodeKey().IsZero() {
+		t.Error("imported profile has a node key")
+	}
+	if len(b.ListProfiles()) != 1 {
+		t.Errorf("got %d profiles; want only the exported one until the import logs in", len(b.ListProfiles()))
+	}
+
+	ex.Version = ipn.ProfileExportVersion + 1
+	if err := b.ImportProfile(ex, user); err == nil {
+		t.Error("ImportProfile accepted an unknown version")
+	}
+}
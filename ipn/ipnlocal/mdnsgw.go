@@ -0,0 +1,141 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_mdnsgateway
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"tailscale.com/feature/buildfeatures"
+	"tailscale.com/ipn"
+	"tailscale.com/net/dns"
+	"tailscale.com/net/dns/mdnsgw"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/dnstype"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/dnsname"
+	"tailscale.com/wgengine/filter"
+)
+
+type mdnsGateway = mdnsgw.Gateway
+
+// reconfigMDNSGatewayLocked starts, restarts or stops the node's mDNS
+// gateway to match the [tailcfg.NodeAttrMDNSGateway] configuration in nm.
+//
+// b.mu must be held.
+func (b *LocalBackend) reconfigMDNSGatewayLocked(nm *netmap.NetworkMap, prefs ipn.PrefsView) {
+	if !buildfeatures.HasDNS {
+		return
+	}
+	cfg, ok := mdnsgw.SelfConfig(nm.SelfNode)
+	if !ok || !prefs.WantRunning() {
+		b.stopMDNSGatewayLocked()
+		return
+	}
+	if b.mdnsGateway != nil && b.mdnsGateway.Config().Equal(cfg) {
+		return
+	}
+	b.stopMDNSGatewayLocked()
+	dm, ok := b.sys.DNSManager.GetOK()
+	if !ok {
+		return
+	}
+	gw, err := mdnsgw.New(b.logf, cfg)
+	if err != nil {
+		b.logf("mDNS gateway for %v: %v", cfg.Domain, err)
+		return
+	}
+	b.logf("mDNS gateway: serving %v", cfg.Domain)
+	b.mdnsGateway = gw
+	dm.Resolver().SetZoneHandler(cfg.Domain, gw.Respond)
+}
+
+// stopMDNSGatewayLocked stops the node's mDNS gateway, if it's running.
+//
+// b.mu must be held.
+func (b *LocalBackend) stopMDNSGatewayLocked() {
+	gw := b.mdnsGateway
+	if gw == nil {
+		return
+	}
+	b.mdnsGateway = nil
+	if dm, ok := b.sys.DNSManager.GetOK(); ok {
+		dm.Resolver().SetZoneHandler(gw.Config().Domain, nil)
+	}
+	gw.Close()
+}
+
+// addMDNSGatewayRoutes adds split DNS routes to dcfg for mDNS gateway zones.
+// A gateway answers for its own zone locally; other nodes ask a gateway over
+// its peerapi.
+func addMDNSGatewayRoutes(dcfg *dns.Config, nm *netmap.NetworkMap, peers map[tailcfg.NodeID]tailcfg.NodeView) {
+	if cfg, ok := mdnsgw.SelfConfig(nm.SelfNode); ok {
+		dcfg.Routes[cfg.Domain] = nil
+	}
+	for domain, gws := range mdnsgw.PickGatewayPeers(nm.SelfNode, peers) {
+		for _, peer := range gws {
+			base := peerAPIBase(nm, peer)
+			if base == "" {
+				continue
+			}
+			dcfg.Routes[domain] = []*dnstype.Resolver{{Addr: base + "/dns-query"}}
+			break // Just use the first gateway we can get a peerAPIBase for.
+		}
+	}
+}
+
+// mdnsGatewayHandles reports whether the node runs an mDNS gateway whose
+// zone contains name.
+func (b *LocalBackend) mdnsGatewayHandles(name dnsname.FQDN) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.mdnsGateway != nil && b.mdnsGateway.Handles(name)
+}
+
+// replyToMDNSGatewayQuery reports whether to answer the DNS query q from the
+// peer because it's for a name in the zone of this node's mDNS gateway, and
+// the peer is allowed to reach this node's DNS port.
+func (h *peerAPIHandler) replyToMDNSGatewayQuery(q []byte) bool {
+	if !buildfeatures.HasDNS || !h.remoteAddr.IsValid() {
+		return false
+	}
+	var p dnsmessage.Parser
+	if _, err := p.Start(q); err != nil {
+		return false
+	}
+	question, err := p.Question()
+	if err != nil {
+		return false
+	}
+	name, err := dnsname.ToFQDN(strings.ToLower(question.Name.String()))
+	if err != nil || !h.ps.b.mdnsGatewayHandles(name) {
+		return false
+	}
+	f := h.ps.b.currentNode().filter()
+	if f == nil {
+		return false
+	}
+	// As in replyToDNSQueries, peerapi bypasses the packet filter, so
+	// check whether it would have let the peer query us on port 53.
+	remoteIP := h.remoteAddr.Addr()
+	selfIP, ok := h.selfAddrFamily(remoteIP)
+	if !ok {
+		return false
+	}
+	return f.CheckTCP(remoteIP, selfIP, 53) == filter.Accept
+}
+
+// selfAddrFamily returns the node's Tailscale address of the same family as
+// ip.
+func (h *peerAPIHandler) selfAddrFamily(ip netip.Addr) (netip.Addr, bool) {
+	for _, pfx := range h.selfNode.Addresses().All() {
+		if pfx.IsSingleIP() && pfx.Addr().Is4() == ip.Is4() {
+			return pfx.Addr(), true
+		}
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,23 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build ts_omit_mdnsgateway
+
+package ipnlocal
+
+import (
+	"tailscale.com/ipn"
+	"tailscale.com/net/dns"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+)
+
+type mdnsGateway struct{}
+
+func (b *LocalBackend) reconfigMDNSGatewayLocked(*netmap.NetworkMap, ipn.PrefsView) {}
+
+func (b *LocalBackend) stopMDNSGatewayLocked() {}
+
+func addMDNSGatewayRoutes(*dns.Config, *netmap.NetworkMap, map[tailcfg.NodeID]tailcfg.NodeView) {}
+
+func (h *peerAPIHandler) replyToMDNSGatewayQuery([]byte) bool { return false }
@@ -0,0 +1,174 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/types/key"
+	"tailscale.com/util/clientmetric"
+	"tailscale.com/wgengine/wgcfg"
+)
+
+// On very large tailnets, a new netmap can change thousands of peers at
+// once, and reconfiguring the engine with all of them in one go stalls it
+// for long enough to disrupt traffic. So when a netmap changes more peers
+// than the batch size, authReconfigLocked applies the changes in batches,
+// most important peers first, with a short pause between batches. Peer
+// removals aren't batched.
+
+// defaultStagedApplyBatchSize is the default maximum number of peer
+// additions and changes applied to the engine at once.
+const defaultStagedApplyBatchSize = 2000
+
+// stagedApplyInterval is how long authReconfigLocked waits between
+// applying batches of peer changes.
+const stagedApplyInterval = 250 * time.Millisecond
+
+// debugStagedApplyBatchSize, if positive, overrides
+// defaultStagedApplyBatchSize. If negative, peer changes are never
+// batched.
+var debugStagedApplyBatchSize = envknob.RegisterInt("TS_DEBUG_NETMAP_APPLY_BATCH_SIZE")
+
+func stagedApplyBatchSize() int {
+	if n := debugStagedApplyBatchSize(); n != 0 {
+		return n
+	}
+	return defaultStagedApplyBatchSize
+}
+
+// Peer priorities for staged netmap application; lower is applied first.
+const (
+	peerPriorityActive = iota // handshake within peerActiveWithin
+	peerPriorityRecent        // handshake within peerRecentWithin
+	peerPriorityOther
+)
+
+const (
+	peerActiveWithin = 2 * time.Minute
+	peerRecentWithin = 30 * time.Minute
+)
+
+// stageWGConfig returns the WireGuard config to apply next to move the
+// engine from config prev, last applied, toward config want, changing at
+// most batch peers, and whether more batches are needed after it. A nil
+// prev means the engine has no peers yet.
+//
+// Peers in want that are new or differ from prev are applied in order of
+// priority(peer key), then in the order they appear in want. Peers in prev
+// but not want are always removed. If batch isn't positive or the private
+// key changed, it returns want.
+func stageWGConfig(prev, want *wgcfg.Config, batch int, priority func(key.NodePublic) int) (next *wgcfg.Config, more bool) {
+	if prev == nil {
+		prev = &wgcfg.Config{PrivateKey: want.PrivateKey}
+	}
+	if batch <= 0 || !prev.PrivateKey.Equal(want.PrivateKey) {
+		return want, false
+	}
+	prevPeers := make(map[key.NodePublic]wgcfg.Peer, len(prev.Peers))
+	for _, p := range prev.Peers {
+		prevPeers[p.PublicKey] = p
+	}
+	type change struct {
+		idx  int // in want.Peers
+		prio int
+	}
+	var changes []change
+	for i, p := range want.Peers {
+		if old, ok := prevPeers[p.PublicKey]; !ok || !old.Equal(p) {
+			changes = append(changes, change{idx: i})
+		}
+	}
+	if len(changes) <= batch {
+		return want, false
+	}
+	for i := range changes {
+		changes[i].prio = priority(want.Peers[changes[i].idx].PublicKey)
+	}
+	slices.SortStableFunc(changes, func(a, b change) int {
+		return cmp.Compare(a.prio, b.prio)
+	})
+	apply := make(map[int]bool, batch)
+	for _, c := range changes[:batch] {
+		apply[c.idx] = true
+	}
+
+	next = new(wgcfg.Config)
+	*next = *want
+	next.Peers = make([]wgcfg.Peer, 0, len(want.Peers))
+	for i, p := range want.Peers {
+		old, inPrev := prevPeers[p.PublicKey]
+		switch {
+		case apply[i], inPrev && old.Equal(p):
+			next.Peers = append(next.Peers, p)
+		case inPrev:
+			// Changed, but not in this batch; keep the old config.
+			next.Peers = append(next.Peers, old)
+		}
+	}
+	return next, true
+}
+
+// stagedApplyPeerPriority returns the priority of the peer with key k for
+// staged netmap application, based on how recently the engine last
+// completed a handshake with it. Warm peers (see Prefs.KeepWarmPeers) count
+// as active.
+func (b *LocalBackend) stagedApplyPeerPriority(k key.NodePublic) int {
+	if _, ok := b.warmPeers.peers[k]; ok {
+		return peerPriorityActive
+	}
+	p, ok := b.e.PeerByKey(k)
+	if !ok {
+		return peerPriorityOther
+	}
+	switch since := b.clock.Since(p.LastHandshake()); {
+	case since < peerActiveWithin:
+		return peerPriorityActive
+	case since < peerRecentWithin:
+		return peerPriorityRecent
+	}
+	return peerPriorityOther
+}
+
+// scheduleStagedApplyLocked arranges for authReconfig to run again after
+// stagedApplyInterval to apply the next batch of peer changes, if it isn't
+// already scheduled.
+//
+// b.mu must be held.
+func (b *LocalBackend) scheduleStagedApplyLocked() {
+	if b.stagedApplyTimer != nil {
+		return
+	}
+	b.stagedApplyTimer = b.clock.AfterFunc(stagedApplyInterval, func() {
+		b.mu.Lock()
+		b.stagedApplyTimer = nil
+		shutdown := b.shutdownCalled
+		b.mu.Unlock()
+		if !shutdown {
+			b.authReconfig()
+		}
+	})
+}
+
+// stopStagedApplyLocked cancels any scheduled batch of peer changes and
+// forgets the last applied WireGuard config, for when the engine is
+// unconfigured or the backend shuts down.
+//
+// b.mu must be held.
+func (b *LocalBackend) stopStagedApplyLocked() {
+	if b.stagedApplyTimer != nil {
+		b.stagedApplyTimer.Stop()
+		b.stagedApplyTimer = nil
+	}
+	b.appliedWGCfg = nil
+}
+
+var (
+	metricStagedApplyBatches     = clientmetric.NewCounter("localbackend_netmap_staged_apply_batches")
+	metricReconfigDurationMs     = clientmetric.NewCounter("localbackend_engine_reconfig_duration_ms")
+	metricReconfigLastDurationMs = clientmetric.NewGauge("localbackend_engine_reconfig_last_duration_ms")
+)
@@ -0,0 +1,109 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"tailscale.com/types/key"
+	"tailscale.com/wgengine/wgcfg"
+)
+
+func TestStageWGConfig(t *testing.T) {
+	priv := key.NewNode()
+	keys := make([]key.NodePublic, 5)
+	for i := range keys {
+		keys[i] = key.NewNode().Public()
+	}
+	a, b, c, d, e := keys[0], keys[1], keys[2], keys[3], keys[4]
+	peer := func(k key.NodePublic, ip string) wgcfg.Peer {
+		return wgcfg.Peer{PublicKey: k, AllowedIPs: []netip.Prefix{netip.MustParsePrefix(ip)}}
+	}
+	peerKeys := func(cfg *wgcfg.Config) []key.NodePublic {
+		var ret []key.NodePublic
+		for _, p := range cfg.Peers {
+			ret = append(ret, p.PublicKey)
+		}
+		return ret
+	}
+	priority := func(k key.NodePublic) int {
+		if k == e {
+			return peerPriorityActive
+		}
+		return peerPriorityOther
+	}
+
+	prev := &wgcfg.Config{PrivateKey: priv, Peers: []wgcfg.Peer{
+		peer(a, "100.64.0.1/32"),
+		peer(b, "100.64.0.2/32"),
+		peer(c, "100.64.0.3/32"),
+	}}
+	want := &wgcfg.Config{PrivateKey: priv, Peers: []wgcfg.Peer{
+		peer(a, "100.64.0.1/32"),
+		peer(b, "100.64.0.22/32"), // changed
+		peer(d, "100.64.0.4/32"),  // new
+		peer(e, "100.64.0.5/32"),  // new and active
+	}}
+
+	// Three changes with a batch of two: the active peer first, then
+	// the changed one, which comes before the other new one in want.
+	// The removed peer c goes right away.
+	next, more := stageWGConfig(prev, want, 2, priority)
+	if !more {
+		t.Fatal("first batch: more = false; want true")
+	}
+	if got, want := peerKeys(next), []key.NodePublic{a, b, e}; !slices.Equal(got, want) {
+		t.Errorf("first batch peers = %v; want %v", got, want)
+	}
+	if got, _ := next.PeerWithKey(b); !got.Equal(want.Peers[1]) {
+		t.Errorf("first batch has old config for changed peer: %+v", got)
+	}
+
+	next, more = stageWGConfig(next, want, 2, priority)
+	if more || next != want {
+		t.Errorf("second batch = %v, more=%v; want the wanted config", peerKeys(next), more)
+	}
+
+	// Large enough batches, and a disabled or changed key, apply all at once.
+	for _, tt := range []struct {
+		name  string
+		prev  *wgcfg.Config
+		batch int
+	}{
+		{"big_batch", prev, 3},
+		{"disabled", prev, -1},
+		{"new_key", &wgcfg.Config{PrivateKey: key.NewNode()}, 1},
+	} {
+		if next, more := stageWGConfig(tt.prev, want, tt.batch, priority); more || next != want {
+			t.Errorf("%s: got %v, more=%v; want the wanted config", tt.name, peerKeys(next), more)
+		}
+	}
+
+	// With nothing applied yet, new peers are batched too.
+	next, more = stageWGConfig(nil, want, 3, priority)
+	if !more || len(next.Peers) != 3 || next.Peers[2].PublicKey != e {
+		t.Errorf("from nil: got %v, more=%v; want 3 peers including the active one", peerKeys(next), more)
+	}
+}
+
+func TestShutdownStopsStagedApply(t *testing.T) {
+	b := newTestLocalBackend(t)
+	b.mu.Lock()
+	b.scheduleStagedApplyLocked()
+	b.appliedWGCfg = &wgcfg.Config{}
+	b.mu.Unlock()
+
+	b.Shutdown()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stagedApplyTimer != nil {
+		t.Error("staged apply timer still scheduled after Shutdown")
+	}
+	if b.appliedWGCfg != nil {
+		t.Error("applied WireGuard config kept after Shutdown")
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/net/dns"
+	"tailscale.com/tstime"
+	"tailscale.com/util/clientmetric"
+	"tailscale.com/wgengine/router"
+)
+
+// Applying routes or DNS settings from the netmap can leave a machine unable
+// to reach anything, such as when a resolver it's told to use is unreachable,
+// and so unable to get the netmap that'd fix it. To guard against that, when
+// enabled, authReconfigLocked applies changed network settings as a
+// transaction: it keeps the settings last known to work, checks connectivity
+// once the new ones have been in place for the rollback timeout, and, if it
+// fails, rolls back to the settings known to work. The new settings are then
+// held back until the netmap changes them, unless the rollback didn't restore
+// connectivity either, in which case they weren't to blame, and are
+// reapplied.
+
+// netSettingsRollbackTimeout, if positive, enables network settings
+// transactions, with connectivity checked this long after new settings are
+// applied.
+var netSettingsRollbackTimeout = envknob.RegisterDuration("TS_NET_SETTINGS_ROLLBACK_TIMEOUT")
+
+// netSettingsProbeTimeout is how long a connectivity check may take.
+const netSettingsProbeTimeout = 10 * time.Second
+
+// netSettings are the OS network settings applied by authReconfigLocked.
+// The zero value is none, as when the engine is unconfigured.
+type netSettings struct {
+	router *router.Config
+	dns    *dns.Config
+}
+
+func (s netSettings) isZero() bool {
+	return s.router == nil && s.dns == nil
+}
+
+func (s netSettings) equal(o netSettings) bool {
+	return s.orEmpty().router.Equal(o.orEmpty().router) && s.orEmpty().dns.Equal(o.orEmpty().dns)
+}
+
+// orEmpty returns s with empty configs in place of nil ones, to apply.
+func (s netSettings) orEmpty() netSettings {
+	if s.router == nil {
+		s.router = &router.Config{}
+	}
+	if s.dns == nil {
+		s.dns = &dns.Config{}
+	}
+	return s
+}
+
+// netSettingsTxn is the state of network settings transactions.
+type netSettingsTxn struct {
+	committed netSettings // last known to work
+	pending   netSettings // applied, and to be checked by timer, if !verifying
+	rejected  netSettings // rolled back from and held back, if non-zero
+
+	// verifying is whether timer checks that rolling back to committed
+	// restored connectivity, rather than checking pending.
+	verifying bool
+
+	timer tstime.TimerController // or nil if no check is scheduled
+	gen   int                    // of the latest check scheduled
+}
+
+// stopLocked cancels the scheduled check, if any.
+func (t *netSettingsTxn) stopLocked() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.gen++
+}
+
+// netSettingsToApplyLocked returns the network settings to apply in place of
+// s, which are the committed ones if s was rolled back from.
+//
+// b.mu must be held.
+func (b *LocalBackend) netSettingsToApplyLocked(s netSettings) netSettings {
+	t := &b.netSettingsTxn
+	if t.rejected.isZero() {
+		return s
+	}
+	if t.rejected.equal(s) {
+		return t.committed.orEmpty()
+	}
+	// The settings changed since they were rolled back, so the new ones
+	// get their own chance.
+	b.logf("network settings changed since rollback; applying")
+	t.rejected = netSettings{}
+	if t.verifying {
+		t.verifying = false
+		t.stopLocked()
+	}
+	return s
+}
+
+// netSettingsAppliedLocked records that the network settings s were applied,
+// scheduling a connectivity check if they're new and transactions are
+// enabled.
+//
+// b.mu must be held.
+func (b *LocalBackend) netSettingsAppliedLocked(s netSettings) {
+	t := &b.netSettingsTxn
+	timeout := netSettingsRollbackTimeout()
+	if timeout <= 0 {
+		t.committed = s
+		return
+	}
+	if t.verifying {
+		// Rolled back; the check is of the committed settings.
+		return
+	}
+	if s.equal(t.committed) {
+		t.stopLocked()
+		return
+	}
+	if t.timer != nil && s.equal(t.pending) {
+		return
+	}
+	t.stopLocked()
+	t.pending = s
+	b.scheduleNetSettingsCheckLocked(timeout)
+}
+
+// resetNetSettingsLocked forgets the network settings applied, for when the
+// engine is unconfigured.
+//
+// b.mu must be held.
+func (b *LocalBackend) resetNetSettingsLocked() {
+	t := &b.netSettingsTxn
+	t.stopLocked()
+	*t = netSettingsTxn{gen: t.gen}
+}
+
+// scheduleNetSettingsCheckLocked schedules a connectivity check after
+// timeout.
+//
+// b.mu must be held.
+func (b *LocalBackend) scheduleNetSettingsCheckLocked(timeout time.Duration) {
+	t := &b.netSettingsTxn
+	gen := t.gen
+	controlURL := b.pm.CurrentPrefs().ControlURLOrDefault(b.polc)
+	t.timer = b.clock.AfterFunc(timeout, func() {
+		ctx, cancel := context.WithTimeout(b.ctx, netSettingsProbeTimeout)
+		defer cancel()
+		err := b.probeNetSettings(ctx, controlURL)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if t.gen != gen || b.shutdownCalled {
+			return
+		}
+		t.timer = nil
+		b.netSettingsCheckedLocked(err)
+	})
+}
+
+// netSettingsCheckedLocked handles the result of the scheduled connectivity
+// check, which failed if err is non-nil.
+//
+// b.mu must be held.
+func (b *LocalBackend) netSettingsCheckedLocked(err error) {
+	t := &b.netSettingsTxn
+	switch {
+	case !t.verifying && err == nil:
+		t.committed = t.pending
+		t.pending = netSettings{}
+	case !t.verifying:
+		metricNetSettingsRollbacks.Add(1)
+		b.logf("connectivity check failed after applying network settings: %v; rolling back", err)
+		t.rejected = t.pending
+		t.pending = netSettings{}
+		t.verifying = true
+		b.authReconfigLocked()
+		if t.verifying && t.timer == nil {
+			b.scheduleNetSettingsCheckLocked(netSettingsRollbackTimeout())
+		}
+	case err == nil:
+		b.logf("rolling back network settings restored connectivity; holding back new settings until they change")
+		t.verifying = false
+	default:
+		// Connectivity is broken either way, so the new settings
+		// weren't to blame.
+		metricNetSettingsRollbacksUndone.Add(1)
+		b.logf("connectivity check still failing after rolling back network settings: %v; reapplying new settings", err)
+		t.committed = t.rejected
+		t.rejected = netSettings{}
+		t.verifying = false
+		b.authReconfigLocked()
+	}
+}
+
+// probeNetSettings checks connectivity with the network settings in place,
+// by resolving the host of controlURL with the OS resolver, and connecting
+// to it.
+func (b *LocalBackend) probeNetSettings(ctx context.Context, controlURL string) error {
+	if f := b.probeNetSettingsForTest; f != nil {
+		return f(ctx)
+	}
+	u, err := url.Parse(controlURL)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("resolving %q: %w", u.Hostname(), err)
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("resolving %q: no addresses", u.Hostname())
+	}
+	c, err := b.dialer.SystemDial(ctx, "tcp", net.JoinHostPort(ips[0].Unmap().String(), port))
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+var (
+	metricNetSettingsRollbacks       = clientmetric.NewCounter("localbackend_net_settings_rollbacks")
+	metricNetSettingsRollbacksUndone = clientmetric.NewCounter("localbackend_net_settings_rollbacks_undone")
+)
@@ -0,0 +1,112 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/net/dns"
+	"tailscale.com/types/dnstype"
+	"tailscale.com/util/dnsname"
+	"tailscale.com/wgengine/router"
+)
+
+func TestNetSettingsTxn(t *testing.T) {
+	envknob.Setenv("TS_NET_SETTINGS_ROLLBACK_TIMEOUT", "1ms")
+	t.Cleanup(func() { envknob.Setenv("TS_NET_SETTINGS_ROLLBACK_TIMEOUT", "") })
+
+	b := newTestLocalBackend(t)
+	probes := make(chan chan error)
+	b.probeNetSettingsForTest = func(ctx context.Context) error {
+		c := make(chan error)
+		probes <- c
+		return <-c
+	}
+	// probe answers the next connectivity check with err.
+	probe := func(err error) {
+		t.Helper()
+		select {
+		case c := <-probes:
+			c <- err
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for connectivity check")
+		}
+	}
+	// waitFor waits for the transaction state to satisfy cond.
+	waitFor := func(what string, cond func(*netSettingsTxn) bool) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			b.mu.Lock()
+			ok := cond(&b.netSettingsTxn)
+			b.mu.Unlock()
+			if ok {
+				return
+			}
+		}
+		t.Fatalf("timeout waiting for %s", what)
+	}
+	applied := func(s netSettings) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.netSettingsAppliedLocked(s)
+	}
+	toApply := func(s netSettings) netSettings {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.netSettingsToApplyLocked(s)
+	}
+	settings := func(route, resolver string) netSettings {
+		return netSettings{
+			router: &router.Config{Routes: []netip.Prefix{netip.MustParsePrefix(route)}},
+			dns: &dns.Config{Routes: map[dnsname.FQDN][]*dnstype.Resolver{
+				".": {{Addr: resolver}},
+			}},
+		}
+	}
+	a := settings("10.0.0.0/8", "10.0.0.53")
+	bad := settings("0.0.0.0/0", "192.0.2.53")
+	c := settings("0.0.0.0/0", "10.0.0.53")
+	unreachable := errors.New("unreachable")
+
+	// Settings that pass the check are committed.
+	applied(a)
+	probe(nil)
+	waitFor("a committed", func(t *netSettingsTxn) bool { return t.committed.equal(a) })
+
+	// Settings that fail it are rolled back, and held back once the
+	// rollback restores connectivity.
+	applied(bad)
+	probe(unreachable)
+	waitFor("rollback", func(t *netSettingsTxn) bool { return t.rejected.equal(bad) && t.verifying })
+	if got := toApply(bad); !got.equal(a) {
+		t.Errorf("applying rolled back settings applies %+v; want %+v", got, a)
+	}
+	applied(a)
+	probe(nil)
+	waitFor("rollback verified", func(t *netSettingsTxn) bool { return !t.verifying })
+	if got := toApply(bad); !got.equal(a) {
+		t.Errorf("after rollback, applying rolled back settings applies %+v; want %+v", got, a)
+	}
+
+	// New settings get their own chance, and if rolling them back doesn't
+	// help either, they're reapplied and committed.
+	if got := toApply(c); !got.equal(c) {
+		t.Errorf("applying new settings applies %+v; want them", got)
+	}
+	applied(c)
+	probe(unreachable)
+	waitFor("rollback", func(t *netSettingsTxn) bool { return t.rejected.equal(c) && t.verifying })
+	probe(unreachable)
+	waitFor("c committed", func(t *netSettingsTxn) bool {
+		return t.committed.equal(c) && t.rejected.isZero() && !t.verifying
+	})
+	if got := toApply(c); !got.equal(c) {
+		t.Errorf("applying committed settings applies %+v; want them", got)
+	}
+}
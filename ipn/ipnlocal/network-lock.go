@@ -1099,6 +1099,122 @@ func (b *LocalBackend) NetworkLockSubmitRecoveryAUM(aum *tka.AUM) error {
 
 var tkaSuffixEncoder = base64.RawStdEncoding
 
+// NetworkLockGeneratePendingAUM generates an unsigned AUM which makes the
+// specified change to the tailnet key authority, for signing by a tailnet lock
+// key held elsewhere (see NetworkLockSignOffline).
+//
+// Exactly one key may be added or removed, as each AUM references the hash of
+// its parent (including signatures), so a chain of updates cannot be built
+// before its members are signed.
+func (b *LocalBackend) NetworkLockGeneratePendingAUM(addKeys, removeKeys []tka.Key) (*tka.AUM, error) {
+	if len(addKeys)+len(removeKeys) != 1 {
+		return nil, errors.New("exactly one key must be added or removed per pending update")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tka == nil {
+		return nil, errNetworkLockNotActive
+	}
+
+	updater := b.tka.authority.NewUpdater(nil)
+	for _, addKey := range addKeys {
+		if err := updater.AddKey(addKey); err != nil {
+			return nil, err
+		}
+	}
+	for _, removeKey := range removeKeys {
+		keyID, err := removeKey.ID()
+		if err != nil {
+			return nil, err
+		}
+		if err := updater.RemoveKey(keyID); err != nil {
+			return nil, err
+		}
+	}
+
+	aums, err := updater.Finalize(b.tka.storage)
+	if err != nil {
+		return nil, err
+	}
+	if len(aums) != 1 {
+		// Finalize also emitted a checkpoint, which would need signing too.
+		return nil, errors.New("a checkpoint is due: make this change with a key held by an online node")
+	}
+	return &aums[0], nil
+}
+
+// NetworkLockSignOffline signs the provided AUM with this node's tailnet lock
+// key, returning detached signatures to be submitted with
+// NetworkLockSubmitPendingAUM on another node.
+//
+// No connectivity or tailnet lock state is required, so this can be run on a
+// disconnected machine. The AUM is not checked against the authority here:
+// that's the job of the submitting node.
+func (b *LocalBackend) NetworkLockSignOffline(aum *tka.AUM) ([]tka.DetachedSignature, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var nlPriv key.NLPrivate
+	if p := b.pm.CurrentPrefs(); p.Valid() && p.Persist().Valid() {
+		nlPriv = p.Persist().NetworkLockKey()
+	}
+	if nlPriv.IsZero() {
+		return nil, errMissingNetmap
+	}
+	if err := aum.StaticValidate(); err != nil {
+		return nil, fmt.Errorf("invalid AUM: %w", err)
+	}
+	return tka.SignDetached(*aum, nlPriv)
+}
+
+// NetworkLockSubmitPendingAUM attaches the detached signatures to a pending
+// AUM generated by NetworkLockGeneratePendingAUM, and submits it to the
+// control plane.
+func (b *LocalBackend) NetworkLockSubmitPendingAUM(aum *tka.AUM, sigs []tka.DetachedSignature) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("submit pending AUM: %w", err)
+		}
+	}()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tka == nil {
+		return errNetworkLockNotActive
+	}
+	var ourNodeKey key.NodePublic
+	if p := b.pm.CurrentPrefs(); p.Valid() && p.Persist().Valid() && !p.Persist().PrivateNodeKey().IsZero() {
+		ourNodeKey = p.Persist().PublicNodeKey()
+	}
+	if ourNodeKey.IsZero() {
+		return errors.New("no node-key: is tailscale logged in?")
+	}
+
+	if err := aum.AttachSignatures(sigs...); err != nil {
+		return err
+	}
+	if err := b.tka.authority.CheckPending(*aum); err != nil {
+		return err
+	}
+
+	head := b.tka.authority.Head()
+	b.mu.Unlock()
+	resp, err := b.tkaDoSyncSend(ourNodeKey, head, []tka.AUM{*aum}, true)
+	b.mu.Lock()
+	if err != nil {
+		return err
+	}
+
+	var controlHead tka.AUMHash
+	if err := controlHead.UnmarshalText([]byte(resp.Head)); err != nil {
+		return err
+	}
+	if controlHead != aum.Hash() {
+		return errors.New("central tka head differs from submitted AUM, try again")
+	}
+	return nil
+}
+
 // NetworkLockWrapPreauthKey wraps a pre-auth key with information to
 // enable unattended bringup in the locked tailnet.
 //
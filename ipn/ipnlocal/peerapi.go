@@ -405,6 +405,9 @@ func (h *peerAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case "/v0/sockstats":
 			h.handleServeSockStats(w, r)
 			return
+		case "/v0/ping-matrix":
+			h.handleServePingMatrix(w, r)
+			return
 		}
 	}
 	if ph, ok := peerAPIHandlers[r.URL.Path]; ok {
@@ -733,10 +736,6 @@ func (h *peerAPIHandler) handleDNSQuery(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "DNS not wired up", http.StatusNotImplemented)
 		return
 	}
-	if !h.replyToDNSQueries() {
-		http.Error(w, "DNS access denied", http.StatusForbidden)
-		return
-	}
 	pretty := false // non-DoH debug mode for humans
 	q, publicError := dohQuery(r)
 	if publicError != "" && r.Method == "GET" {
@@ -750,6 +749,10 @@ func (h *peerAPIHandler) handleDNSQuery(w http.ResponseWriter, r *http.Request)
 		http.Error(w, publicError, http.StatusBadRequest)
 		return
 	}
+	if !h.replyToDNSQueries() && !h.replyToMDNSGatewayQuery(q) {
+		http.Error(w, "DNS access denied", http.StatusForbidden)
+		return
+	}
 
 	// Some timeout that's short enough to be noticed by humans
 	// but long enough that it's longer than real DNS timeouts.
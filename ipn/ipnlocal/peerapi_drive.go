@@ -52,6 +52,9 @@ func handleServeDrive(hi PeerAPIHandler, w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// Apply the local share configuration (read-only shares and per-share
+	// peer allow lists) on top of what the tailnet policy grants.
+	p = p.Restrict(h.ps.b.DriveGetShares(), h.drivePeerIDs())
 
 	fs, ok := h.ps.b.sys.DriveForRemote.GetOK()
 	if !ok {
@@ -89,6 +92,23 @@ func handleServeDrive(hi PeerAPIHandler, w http.ResponseWriter, r *http.Request)
 	fs.ServeHTTPWithPerms(p, wr, r)
 }
 
+// drivePeerIDs returns the identities of the peer making the request, for
+// matching against [drive.Share.AllowedPeers].
+func (h *peerAPIHandler) drivePeerIDs() []string {
+	var ids []string
+	if h.peerNode.IsTagged() {
+		ids = h.peerNode.Tags().AppendTo(ids)
+	} else if h.peerUser.LoginName != "" {
+		ids = append(ids, h.peerUser.LoginName)
+	}
+	for _, pfx := range h.peerNode.Addresses().All() {
+		if pfx.IsSingleIP() {
+			ids = append(ids, pfx.Addr().String())
+		}
+	}
+	return ids
+}
+
 // parseDriveFileExtensionForLog parses the file extension, if available.
 // If a file extension is not present or parsable, the file extension is
 // set to "unknown". If the file extension contains a double quote, it is
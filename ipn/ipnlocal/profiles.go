@@ -303,6 +303,15 @@ func (pm *profileManager) findProfileByName(uid ipn.WindowsUserID, name string)
 	return out[0]
 }
 
+// findProfileByNameOrID returns the profile accessible to uid whose ID or
+// name is nameOrID, or an invalid view if there's none.
+func (pm *profileManager) findProfileByNameOrID(uid ipn.WindowsUserID, nameOrID string) ipn.LoginProfileView {
+	if p, ok := pm.knownProfiles[ipn.ProfileID(nameOrID)]; ok && pm.checkProfileAccessAs(uid, p) == nil {
+		return p
+	}
+	return pm.findProfileByName(uid, nameOrID)
+}
+
 func (pm *profileManager) findProfileByKey(uid ipn.WindowsUserID, key ipn.StateKey) ipn.LoginProfileView {
 	out := pm.matchingProfiles(uid, func(p ipn.LoginProfileView) bool {
 		return p.Key() == key && pm.checkProfileAccessAs(uid, p) == nil
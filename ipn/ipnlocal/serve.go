@@ -8,9 +8,12 @@
 package ipnlocal
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"crypto/tls"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -374,6 +377,7 @@ func (b *LocalBackend) setServeConfigLocked(config *ipn.ServeConfig, etag string
 	}
 
 	b.setTCPPortsInterceptedFromNetmapAndPrefsLocked(b.pm.CurrentPrefs())
+	b.updateFunnelScheduleLocked()
 
 	// clean up and close all previously open foreground sessions
 	// if the current ServeConfig has overwritten them.
@@ -588,6 +592,10 @@ func (b *LocalBackend) tcpHandlerForVIPService(dstAddr, srcAddr netip.AddrPort)
 		}
 	}
 
+	if tcph.SNI().Len() > 0 {
+		return b.sniForwardHandler(tcph, srcAddr, dport)
+	}
+
 	if backDst := tcph.TCPForward(); backDst != "" {
 		return func(conn net.Conn) error {
 			defer conn.Close()
@@ -666,6 +674,10 @@ func (b *LocalBackend) tcpHandlerForServe(dport uint16, srcAddr netip.AddrPort,
 		}
 	}
 
+	if tcph.SNI().Len() > 0 {
+		return b.sniForwardHandler(tcph, srcAddr, dport)
+	}
+
 	if backDst := tcph.TCPForward(); backDst != "" {
 		return func(conn net.Conn) error {
 			defer conn.Close()
@@ -704,6 +716,89 @@ func (b *LocalBackend) tcpHandlerForServe(dport uint16, srcAddr netip.AddrPort,
 	return nil
 }
 
+// sniForwardHandler returns a handler for TCP connections which forwards each
+// connection, without terminating TLS, to the backend tcph.SNI maps the
+// server name in its TLS ClientHello to.
+func (b *LocalBackend) sniForwardHandler(tcph ipn.TCPPortHandlerView, srcAddr netip.AddrPort, dport uint16) func(net.Conn) error {
+	return func(conn net.Conn) error {
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		br := bufio.NewReaderSize(conn, tlsRecordHeaderLen+maxTLSRecordLen)
+		sni := peekClientHelloServerName(conn, br)
+		conn.SetReadDeadline(time.Time{})
+
+		backDst, ok := tcph.SNI().GetOk(sni)
+		if !ok {
+			backDst, ok = tcph.SNI().GetOk("*")
+		}
+		if !ok {
+			b.logf("localbackend: no SNI backend on port %v for %q (from %v)", dport, sni, srcAddr)
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		backConn, err := b.dialer.SystemDial(ctx, "tcp", backDst)
+		cancel()
+		if err != nil {
+			b.logf("localbackend: failed to TCP proxy port %v for %q (from %v) to %s: %v", dport, sni, srcAddr, backDst, err)
+			return nil
+		}
+		defer backConn.Close()
+
+		// Forward the peeked ClientHello along with the rest of the
+		// connection.
+		return b.forwardTCPWithProxyProtocol(netutil.NewDrainBufConn(conn, br), backConn, tcph.ProxyProtocol(), srcAddr, dport, backDst)
+	}
+}
+
+const (
+	tlsRecordHeaderLen     = 5
+	tlsRecordTypeHandshake = 22
+	maxTLSRecordLen        = 1 << 14
+)
+
+// peekClientHelloServerName returns the lowercased server name (SNI) of the
+// TLS ClientHello at the start of br, which reads from conn, without
+// consuming it from br. It returns the empty string if br doesn't start with
+// a ClientHello with a server name, or if the ClientHello spans more than
+// one TLS record.
+func peekClientHelloServerName(conn net.Conn, br *bufio.Reader) string {
+	hdr, err := br.Peek(tlsRecordHeaderLen)
+	if err != nil || hdr[0] != tlsRecordTypeHandshake {
+		return ""
+	}
+	n := int(binary.BigEndian.Uint16(hdr[3:5]))
+	if n > maxTLSRecordLen {
+		return ""
+	}
+	rec, err := br.Peek(tlsRecordHeaderLen + n)
+	if err != nil {
+		return ""
+	}
+
+	// Let crypto/tls parse the ClientHello, aborting the handshake as soon
+	// as it has.
+	var sni string
+	errGotHello := errors.New("got ClientHello")
+	tls.Server(helloPeekConn{conn, bytes.NewReader(rec)}, &tls.Config{
+		GetConfigForClient: func(hi *tls.ClientHelloInfo) (*tls.Config, error) {
+			sni = hi.ServerName
+			return nil, errGotHello
+		},
+	}).Handshake()
+	return strings.ToLower(strings.TrimSuffix(sni, "."))
+}
+
+// helloPeekConn is a net.Conn for crypto/tls to parse a ClientHello from,
+// which reads from r and discards writes.
+type helloPeekConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c helloPeekConn) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c helloPeekConn) Write(p []byte) (int, error) { return len(p), nil }
+
 // forwardTCPWithProxyProtocol forwards TCP traffic between conn and backConn,
 // optionally prepending a PROXY protocol header if proxyProtoVer > 0.
 // The srcAddr is the original client address used to build the PROXY header.
@@ -1172,6 +1267,11 @@ func (b *LocalBackend) serveWebHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		c.AppCapabilities = h.AcceptAppCaps()
+		if t, ok := h.Timeouts().GetOk(); ok {
+			var done func()
+			w, r, done = withServeTimeouts(w, r, t)
+			defer done()
+		}
 		h := p.(http.Handler)
 		// Trim the mount point from the URL path before proxying. (#6571)
 		if r.URL.Path != "/" {
@@ -1673,6 +1773,15 @@ func validateServeConfigUpdate(existing, incoming ipn.ServeConfigView) error {
 		}
 	}
 
+	for hp, sched := range incoming.FunnelSchedules().All() {
+		if !sched.Valid() {
+			return fmt.Errorf("nil Funnel schedule for %s", hp)
+		}
+		if err := sched.AsStruct().Validate(); err != nil {
+			return fmt.Errorf("invalid Funnel schedule for %s: %w", hp, err)
+		}
+	}
+
 	if !existing.Valid() {
 		return nil
 	}
@@ -1760,6 +1869,7 @@ func validateServeConfigUpdate(existing, incoming ipn.ServeConfigView) error {
 	serveTypeHTTP
 	serveTypeTCP
 	serveTypeTLSTerminatedTCP
+	serveTypeSNI
 )
 
 func (s serveType) String() string {
@@ -1772,6 +1882,8 @@ func (s serveType) String() string {
 		return "tcp"
 	case serveTypeTLSTerminatedTCP:
 		return "tls-terminated-tcp"
+	case serveTypeSNI:
+		return "sni"
 	default:
 		return "unknownServeType"
 	}
@@ -1785,6 +1897,8 @@ func serveTypeFromPortHandler(ph ipn.TCPPortHandlerView) serveType {
 		return serveTypeHTTP
 	case ph.HTTPS():
 		return serveTypeHTTPS
+	case ph.SNI().Len() > 0:
+		return serveTypeSNI
 	case ph.TerminateTLS() != "":
 		return serveTypeTLSTerminatedTCP
 	case ph.TCPForward() != "":
@@ -26,6 +26,10 @@ func (b *LocalBackend) DeleteForegroundSession(sessionID string) error {
 
 type funnelFlow = struct{}
 
+type funnelScheduleState = struct{}
+
+func (*LocalBackend) updateFunnelScheduleLocked() {}
+
 func (*LocalBackend) hasIngressEnabledLocked() bool         { return false }
 func (*LocalBackend) shouldWireInactiveIngressLocked() bool { return false }
 
@@ -6,6 +6,7 @@
 package ipnlocal
 
 import (
+	"bufio"
 	"bytes"
 	"cmp"
 	"context"
@@ -15,6 +16,7 @@
 	"fmt"
 	"io"
 	"mime"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
@@ -30,6 +32,7 @@
 	"tailscale.com/health"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/mem"
+	"tailscale.com/net/netutil"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tsd"
 	"tailscale.com/tstest"
@@ -1764,3 +1767,59 @@ func TestValidateServeConfigUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestPeekClientHelloServerName(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(net.Conn)
+		want string
+	}{
+		{
+			name: "sni",
+			send: func(c net.Conn) {
+				tls.Client(c, &tls.Config{ServerName: "Git.Example.com", InsecureSkipVerify: true}).Handshake()
+			},
+			want: "git.example.com",
+		},
+		{
+			name: "no-sni",
+			send: func(c net.Conn) {
+				tls.Client(c, &tls.Config{InsecureSkipVerify: true}).Handshake()
+			},
+			want: "",
+		},
+		{
+			name: "not-tls",
+			send: func(c net.Conn) {
+				io.WriteString(c, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			go tt.send(client)
+
+			br := bufio.NewReaderSize(server, tlsRecordHeaderLen+maxTLSRecordLen)
+			if got := peekClientHelloServerName(server, br); got != tt.want {
+				t.Errorf("server name = %q; want %q", got, tt.want)
+			}
+
+			// The peeked bytes must still be there for the backend.
+			first := make([]byte, 1)
+			if _, err := io.ReadFull(netutil.NewDrainBufConn(server, br), first); err != nil {
+				t.Fatal(err)
+			}
+			wantFirst := byte(tlsRecordTypeHandshake)
+			if tt.name == "not-tls" {
+				wantFirst = 'G'
+			}
+			if first[0] != wantFirst {
+				t.Errorf("first byte forwarded = %#x; want %#x", first[0], wantFirst)
+			}
+		})
+	}
+}
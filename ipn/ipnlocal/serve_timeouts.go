@@ -0,0 +1,214 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn"
+)
+
+// serveTimeoutWriter is the http.ResponseWriter of a request proxied by
+// serve with [ipn.HTTPTimeouts]. It tells streaming responses from others
+// when their headers are written, and applies the timeouts to each
+// accordingly.
+type serveTimeoutWriter struct {
+	http.ResponseWriter
+	rc     *http.ResponseController // of ResponseWriter
+	t      ipn.HTTPTimeouts
+	cancel context.CancelFunc // cancels the proxied request
+
+	mu          sync.Mutex
+	wroteHeader bool
+	streaming   bool
+	idle        *time.Timer // or nil; cancels the request when the stream is idle
+}
+
+// withServeTimeouts applies the timeouts t to the request r, returning the
+// ResponseWriter and request to proxy it with, and a func to call once it's
+// been proxied.
+func withServeTimeouts(w http.ResponseWriter, r *http.Request, t ipn.HTTPTimeouts) (http.ResponseWriter, *http.Request, func()) {
+	ctx, cancel := context.WithCancel(r.Context())
+	tw := &serveTimeoutWriter{
+		ResponseWriter: w,
+		rc:             http.NewResponseController(w),
+		t:              t,
+		cancel:         cancel,
+	}
+	now := time.Now()
+	if d := t.Read.Duration; d > 0 {
+		tw.rc.SetReadDeadline(now.Add(d))
+	}
+	if d := t.Write.Duration; d > 0 {
+		tw.rc.SetWriteDeadline(now.Add(d))
+	}
+	r = r.WithContext(ctx)
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &serveTimeoutBody{ReadCloser: r.Body, tw: tw}
+	}
+	return tw, r, tw.done
+}
+
+// done stops applying the timeouts, once the request has been proxied.
+func (tw *serveTimeoutWriter) done() {
+	tw.mu.Lock()
+	if tw.idle != nil {
+		tw.idle.Stop()
+	}
+	tw.mu.Unlock()
+	tw.cancel()
+	if tw.t.Write.Duration > 0 {
+		// The http.Server leaves the write deadline on the connection
+		// for the requests that follow on it, which may be for other
+		// handlers.
+		tw.rc.SetWriteDeadline(time.Time{})
+	}
+}
+
+// isStreamingResponse reports whether a response with the header h streams:
+// it's Server-Sent Events or of unknown length.
+func isStreamingResponse(h http.Header) bool {
+	if ct, _, _ := mime.ParseMediaType(h.Get("Content-Type")); ct == "text/event-stream" {
+		return true
+	}
+	return h.Get("Content-Length") == ""
+}
+
+// startStreamLocked switches tw to applying the timeouts of a streaming
+// response.
+//
+// tw.mu must be held.
+func (tw *serveTimeoutWriter) startStreamLocked() {
+	if tw.streaming {
+		return
+	}
+	tw.streaming = true
+	// Streams may last much longer than a whole request is allowed to;
+	// from here on, the Write timeout is applied to each write instead,
+	// and the Idle timeout to the stream.
+	tw.rc.SetReadDeadline(time.Time{})
+	tw.rc.SetWriteDeadline(time.Time{})
+	if d := tw.t.Idle.Duration; d > 0 {
+		tw.idle = time.AfterFunc(d, tw.cancel)
+	}
+}
+
+// activity records that data flowed in the stream, if it's streaming.
+func (tw *serveTimeoutWriter) activity() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.idle != nil {
+		tw.idle.Reset(tw.t.Idle.Duration)
+	}
+}
+
+// beforeWrite sets the deadline of a write to the client of a streaming
+// response, using set to set it.
+func (tw *serveTimeoutWriter) beforeWrite(set func(time.Time) error) {
+	tw.mu.Lock()
+	streaming := tw.streaming
+	tw.mu.Unlock()
+	if d := tw.t.Write.Duration; streaming && d > 0 {
+		set(time.Now().Add(d))
+	}
+}
+
+func (tw *serveTimeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	if !tw.wroteHeader && code >= 200 {
+		tw.wroteHeader = true
+		if isStreamingResponse(tw.Header()) {
+			tw.startStreamLocked()
+		}
+	}
+	tw.mu.Unlock()
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *serveTimeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	wrote := tw.wroteHeader
+	tw.mu.Unlock()
+	if !wrote {
+		tw.WriteHeader(http.StatusOK)
+	}
+	tw.beforeWrite(tw.rc.SetWriteDeadline)
+	n, err := tw.ResponseWriter.Write(p)
+	if n > 0 {
+		tw.activity()
+	}
+	return n, err
+}
+
+// FlushError implements the interface used by [http.ResponseController] to
+// flush, which is when writes of streaming responses reach the client.
+func (tw *serveTimeoutWriter) FlushError() error {
+	tw.beforeWrite(tw.rc.SetWriteDeadline)
+	return tw.rc.Flush()
+}
+
+// Hijack implements [http.Hijacker], for the connections of WebSockets and
+// other upgraded protocols, which are streams.
+func (tw *serveTimeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, brw, err := tw.rc.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.SetDeadline(time.Time{})
+	tw.mu.Lock()
+	tw.wroteHeader = true
+	tw.startStreamLocked()
+	tw.mu.Unlock()
+	return &serveTimeoutConn{Conn: c, tw: tw}, brw, nil
+}
+
+// Unwrap returns the underlying ResponseWriter, for [http.ResponseController].
+func (tw *serveTimeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// serveTimeoutConn is a connection hijacked from a serveTimeoutWriter.
+// Frames of WebSockets, including pings and pongs, pass through it as is.
+type serveTimeoutConn struct {
+	net.Conn
+	tw *serveTimeoutWriter
+}
+
+func (c *serveTimeoutConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.tw.activity()
+	}
+	return n, err
+}
+
+func (c *serveTimeoutConn) Write(p []byte) (int, error) {
+	c.tw.beforeWrite(c.Conn.SetWriteDeadline)
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.tw.activity()
+	}
+	return n, err
+}
+
+// serveTimeoutBody is the body of a request with a serveTimeoutWriter.
+type serveTimeoutBody struct {
+	io.ReadCloser
+	tw *serveTimeoutWriter
+}
+
+func (b *serveTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.tw.activity()
+	}
+	return n, err
+}
@@ -0,0 +1,173 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tstime"
+)
+
+// newTimeoutProxy returns a server that proxies requests to backend with
+// the timeouts t, as serve does.
+func newTimeoutProxy(t *testing.T, backend http.Handler, timeouts ipn.HTTPTimeouts) *httptest.Server {
+	bs := httptest.NewServer(backend)
+	t.Cleanup(bs.Close)
+	u, err := url.Parse(bs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := httputil.NewSingleHostReverseProxy(u)
+	ps := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, done := withServeTimeouts(w, r, timeouts)
+		defer done()
+		rp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ps.Close)
+	return ps
+}
+
+func dur(d time.Duration) tstime.GoDuration { return tstime.GoDuration{Duration: d} }
+
+func TestServeTimeoutsSSE(t *testing.T) {
+	const events = 5
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := range events {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+	// The stream lasts longer than the Write timeout, but each write
+	// doesn't, and it's never idle for long.
+	ps := newTimeoutProxy(t, backend, ipn.HTTPTimeouts{
+		Write: dur(200 * time.Millisecond),
+		Idle:  dur(2 * time.Second),
+	})
+	res, err := http.Get(ps.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	// Each event arrives unbuffered, before the next is sent.
+	br := bufio.NewReader(res.Body)
+	for i := range events {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("data: %d\n", i); line != want {
+			t.Fatalf("got %q; want %q", line, want)
+		}
+		br.ReadString('\n')
+	}
+	if _, err := io.ReadAll(br); err != nil {
+		t.Errorf("stream didn't end cleanly: %v", err)
+	}
+}
+
+func TestServeTimeoutsIdleStream(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	})
+	ps := newTimeoutProxy(t, backend, ipn.HTTPTimeouts{Idle: dur(200 * time.Millisecond)})
+	res, err := http.Get(ps.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(res.Body)
+		errc <- err
+	}()
+	select {
+	case <-errc:
+	case <-time.After(10 * time.Second):
+		t.Fatal("idle stream wasn't closed")
+	}
+}
+
+func TestServeTimeoutsUpgrade(t *testing.T) {
+	// The backend speaks an upgraded echo protocol, as WebSockets are,
+	// without interpreting the frames passing through.
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			http.Error(w, "want upgrade", http.StatusBadRequest)
+			return
+		}
+		c, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		brw.Flush()
+		io.Copy(c, brw)
+	})
+	ps := newTimeoutProxy(t, backend, ipn.HTTPTimeouts{
+		Read:  dur(100 * time.Millisecond),
+		Write: dur(time.Second),
+		Idle:  dur(300 * time.Millisecond),
+	})
+
+	c, err := net.Dial("tcp", strings.TrimPrefix(ps.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	io.WriteString(c, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	br := bufio.NewReader(c)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %v; want 101", res.Status)
+	}
+
+	// Pings at intervals shorter than the Idle timeout keep the stream
+	// open past the Read timeout, and past the Idle timeout.
+	for i := range 6 {
+		ping := fmt.Sprintf("ping %d\n", i)
+		io.WriteString(c, ping)
+		got, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ping %d: %v", i, err)
+		}
+		if got != ping {
+			t.Fatalf("got %q; want %q", got, ping)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Once the pings stop, the idle stream is closed.
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := br.ReadString('\n'); err != io.EOF {
+		t.Fatalf("reading idle stream: got %v; want EOF", err)
+	}
+}
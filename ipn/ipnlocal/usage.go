@@ -0,0 +1,297 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"tailscale.com/feature/condlite/expvar"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/net/sockstats"
+	"tailscale.com/tstime"
+)
+
+// usageStateKey is the state store key holding the usage windows of a
+// usageTracker, so that they survive restarts.
+const usageStateKey = ipn.StateKey("_usage")
+
+const (
+	// usageSampleInterval is how often the usage counters are sampled
+	// into the current windows.
+	usageSampleInterval = time.Minute
+
+	// usagePersistInterval is how often changed usage windows are written
+	// to the state store, besides at shutdown. It's long because some
+	// stores, such as Kubernetes Secrets and AWS SSM, are remote APIs that
+	// are otherwise only written when prefs or keys change. A crash loses
+	// at most this much usage.
+	usagePersistInterval = 6 * time.Hour
+
+	// usageHourlyWindows and usageDailyWindows are the number of hourly
+	// and daily windows kept.
+	usageHourlyWindows = 48
+	usageDailyWindows  = 31
+)
+
+// usageUnknownInterface is the interface name that usage is attributed to
+// when there's no default route.
+const usageUnknownInterface = "unknown"
+
+// usageCounters are cumulative byte counts by usage category, since the
+// process started.
+type usageCounters map[ipnstate.UsageCategory]ipnstate.UsageBytes
+
+// usageTracker accumulates the growth of usageCounters into hourly and daily
+// windows, attributed to the network interface that was the default route.
+//
+// The zero value is ready for use.
+type usageTracker struct {
+	mu         sync.Mutex
+	last       usageCounters // at the previous sample; nil before the first
+	iface      string        // default route interface at the previous sample
+	hourly     []ipnstate.UsageWindow
+	daily      []ipnstate.UsageWindow
+	dirty      bool      // windows changed since they were last persisted
+	persisted  time.Time // when the windows were last persisted
+	timer      tstime.TimerController
+	stopped    bool
+	unmeasured []ipnstate.UsageCategory // categories missing from the counters
+}
+
+// usageState is the JSON value stored under usageStateKey.
+type usageState struct {
+	Hourly []ipnstate.UsageWindow
+	Daily  []ipnstate.UsageWindow
+}
+
+// sample attributes the growth of cur since the previous sample to the
+// windows containing now, and to the interface that was the default route
+// then. iface is the current default route interface.
+func (t *usageTracker) sample(now time.Time, cur usageCounters, iface string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last, prevIface := t.last, cmp.Or(t.iface, iface, usageUnknownInterface)
+	t.last, t.iface = cur, iface
+
+	deltas := make(usageCounters)
+	for cat, c := range cur {
+		l := last[cat]
+		d := ipnstate.UsageBytes{
+			TxBytes: counterDelta(l.TxBytes, c.TxBytes),
+			RxBytes: counterDelta(l.RxBytes, c.RxBytes),
+		}
+		if d != (ipnstate.UsageBytes{}) {
+			deltas[cat] = d
+		}
+	}
+	if len(deltas) == 0 {
+		return
+	}
+	y, m, d := now.Date()
+	hour := time.Date(y, m, d, now.Hour(), 0, 0, 0, now.Location())
+	day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	t.hourly = addUsage(t.hourly, hour, hour.Add(time.Hour), usageHourlyWindows, deltas, prevIface)
+	t.daily = addUsage(t.daily, day, day.AddDate(0, 0, 1), usageDailyWindows, deltas, prevIface)
+	t.dirty = true
+}
+
+// counterDelta returns how much a cumulative counter grew from last to cur.
+// A counter that went backwards was reset, such as by recreating what it
+// counts, so all of cur is new.
+func counterDelta(last, cur uint64) uint64 {
+	if cur < last {
+		return cur
+	}
+	return cur - last
+}
+
+// addUsage adds deltas, which happened on iface, to the window of windows
+// that starts at start, appending it if needed, and returns the updated
+// windows with at most max of them.
+func addUsage(windows []ipnstate.UsageWindow, start, end time.Time, max int, deltas usageCounters, iface string) []ipnstate.UsageWindow {
+	// Usage is added to the latest window if the clock went backwards.
+	if n := len(windows); n == 0 || windows[n-1].Start.Before(start) {
+		windows = append(windows, ipnstate.UsageWindow{Start: start, End: end})
+		if len(windows) > max {
+			windows = slices.Delete(windows, 0, len(windows)-max)
+		}
+	}
+	w := &windows[len(windows)-1]
+	if w.Categories == nil {
+		w.Categories = make(map[ipnstate.UsageCategory]ipnstate.UsageBytes)
+	}
+	if w.Interfaces == nil {
+		w.Interfaces = make(map[string]ipnstate.UsageBytes)
+	}
+	for cat, d := range deltas {
+		w.Categories[cat] = w.Categories[cat].Add(d)
+		w.Interfaces[iface] = w.Interfaces[iface].Add(d)
+	}
+	return windows
+}
+
+// report returns a copy of the usage windows.
+func (t *usageTracker) report() *ipnstate.UsageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clone := func(windows []ipnstate.UsageWindow) []ipnstate.UsageWindow {
+		ret := make([]ipnstate.UsageWindow, len(windows))
+		for i, w := range windows {
+			ret[i] = ipnstate.UsageWindow{
+				Start:      w.Start,
+				End:        w.End,
+				Categories: maps.Clone(w.Categories),
+				Interfaces: maps.Clone(w.Interfaces),
+			}
+		}
+		return ret
+	}
+	return &ipnstate.UsageReport{
+		Hourly:     clone(t.hourly),
+		Daily:      clone(t.daily),
+		Unmeasured: slices.Clone(t.unmeasured),
+	}
+}
+
+// load replaces the usage windows with those persisted in st, if any.
+func (t *usageTracker) load(st ipn.StateStore) error {
+	bs, err := st.ReadState(usageStateKey)
+	if errors.Is(err, ipn.ErrStateNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var us usageState
+	if err := json.Unmarshal(bs, &us); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hourly, t.daily = us.Hourly, us.Daily
+	return nil
+}
+
+// persist writes the usage windows to st if they changed since they were
+// last written, and either force is set or that was at least
+// usagePersistInterval before now.
+func (t *usageTracker) persist(st ipn.StateStore, now time.Time, force bool) error {
+	t.mu.Lock()
+	if !t.dirty || !force && now.Sub(t.persisted) < usagePersistInterval {
+		t.mu.Unlock()
+		return nil
+	}
+	bs, err := json.Marshal(usageState{Hourly: t.hourly, Daily: t.daily})
+	t.dirty = false
+	t.persisted = now
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ipn.WriteState(st, usageStateKey, bs)
+}
+
+// startUsageTracking loads the persisted usage windows and starts sampling
+// the usage counters every usageSampleInterval until stopUsageTracking.
+func (b *LocalBackend) startUsageTracking() {
+	t := &b.usage
+	if err := t.load(b.store); err != nil {
+		b.logf("usage: loading saved usage: %v", err)
+	}
+	var unmeasured []ipnstate.UsageCategory
+	if !expvar.IsAvailable {
+		// magicsock's counters are stubbed out.
+		unmeasured = append(unmeasured, ipnstate.UsagePeer, ipnstate.UsageDERP)
+	}
+	if !sockstats.IsAvailable {
+		unmeasured = append(unmeasured, ipnstate.UsageControl, ipnstate.UsageLog)
+	}
+	t.mu.Lock()
+	t.unmeasured = unmeasured
+	t.mu.Unlock()
+	clock := b.clock
+	t.sample(clock.Now(), b.usageCounters(), b.defaultRouteInterface())
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.persisted = clock.Now() // the first write is an interval after starting
+	t.timer = clock.AfterFunc(usageSampleInterval, func() {
+		now := clock.Now()
+		t.sample(now, b.usageCounters(), b.defaultRouteInterface())
+		if err := t.persist(b.store, now, false); err != nil {
+			b.logf("usage: saving usage: %v", err)
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.stopped {
+			t.timer.Reset(usageSampleInterval)
+		}
+	})
+}
+
+// stopUsageTracking stops sampling the usage counters and persists the usage
+// windows.
+func (b *LocalBackend) stopUsageTracking() {
+	t := &b.usage
+	t.mu.Lock()
+	t.stopped = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.mu.Unlock()
+	now := b.clock.Now()
+	t.sample(now, b.usageCounters(), b.defaultRouteInterface())
+	if err := t.persist(b.store, now, true); err != nil {
+		b.logf("usage: saving usage: %v", err)
+	}
+}
+
+// UsageReport returns the number of bytes Tailscale itself sent and received
+// in recent hours and days.
+func (b *LocalBackend) UsageReport() *ipnstate.UsageReport {
+	b.usage.sample(b.clock.Now(), b.usageCounters(), b.defaultRouteInterface())
+	return b.usage.report()
+}
+
+// usageCounters returns the current usage counters of this process.
+func (b *LocalBackend) usageCounters() usageCounters {
+	c := make(usageCounters)
+	if mc, ok := b.sys.MagicSock.GetOK(); ok {
+		c[ipnstate.UsagePeer], c[ipnstate.UsageDERP] = mc.DataBytes()
+	}
+	if !sockstats.IsAvailable {
+		return c
+	}
+	for label, s := range sockstats.Get().Stats {
+		var cat ipnstate.UsageCategory
+		switch label {
+		case sockstats.LabelControlClientAuto, sockstats.LabelControlClientDialer:
+			cat = ipnstate.UsageControl
+		case sockstats.LabelLogtailLogger, sockstats.LabelNetlogLogger, sockstats.LabelSockstatlogLogger:
+			cat = ipnstate.UsageLog
+		default:
+			continue
+		}
+		c[cat] = c[cat].Add(ipnstate.UsageBytes{TxBytes: s.TxBytes, RxBytes: s.RxBytes})
+	}
+	return c
+}
+
+// defaultRouteInterface returns the name of the current default route
+// interface, or the empty string if unknown.
+func (b *LocalBackend) defaultRouteInterface() string {
+	if nm, ok := b.sys.NetMon.GetOK(); ok {
+		if st := nm.InterfaceState(); st != nil {
+			return st.DefaultRouteInterface
+		}
+	}
+	return ""
+}
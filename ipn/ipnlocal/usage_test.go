@@ -0,0 +1,147 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/ipn/store/mem"
+)
+
+func TestUsageTracker(t *testing.T) {
+	var tr usageTracker
+	start := time.Date(2026, 10, 16, 22, 50, 0, 0, time.UTC)
+	ub := func(tx, rx uint64) ipnstate.UsageBytes { return ipnstate.UsageBytes{TxBytes: tx, RxBytes: rx} }
+	counters := func(peer, control ipnstate.UsageBytes) usageCounters {
+		return usageCounters{ipnstate.UsagePeer: peer, ipnstate.UsageControl: control}
+	}
+
+	tr.sample(start, counters(ub(10, 20), ub(1, 2)), "wlan0")
+	// The default route changed, but the growth since the last sample
+	// happened on wlan0.
+	tr.sample(start.Add(5*time.Minute), counters(ub(110, 220), ub(1, 2)), "rmnet0")
+	tr.sample(start.Add(15*time.Minute), counters(ub(1110, 2220), ub(2, 4)), "rmnet0")
+	// tailscaled's counters were reset, such as by recreating magicsock.
+	tr.sample(start.Add(90*time.Minute), counters(ub(5, 5), ub(2, 4)), "rmnet0")
+
+	hour := func(h int) time.Time { return time.Date(2026, 10, 16, h, 0, 0, 0, time.UTC) }
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC) }
+	want := &ipnstate.UsageReport{
+		Hourly: []ipnstate.UsageWindow{
+			{
+				Start: hour(22),
+				End:   hour(23),
+				Categories: map[ipnstate.UsageCategory]ipnstate.UsageBytes{
+					ipnstate.UsagePeer:    ub(110, 220),
+					ipnstate.UsageControl: ub(1, 2),
+				},
+				Interfaces: map[string]ipnstate.UsageBytes{
+					"wlan0": ub(111, 222),
+				},
+			},
+			{
+				Start: hour(23),
+				End:   day(17),
+				Categories: map[ipnstate.UsageCategory]ipnstate.UsageBytes{
+					ipnstate.UsagePeer:    ub(1000, 2000),
+					ipnstate.UsageControl: ub(1, 2),
+				},
+				Interfaces: map[string]ipnstate.UsageBytes{
+					"rmnet0": ub(1001, 2002),
+				},
+			},
+			{
+				Start: day(17),
+				End:   day(17).Add(time.Hour),
+				Categories: map[ipnstate.UsageCategory]ipnstate.UsageBytes{
+					ipnstate.UsagePeer: ub(5, 5),
+				},
+				Interfaces: map[string]ipnstate.UsageBytes{
+					"rmnet0": ub(5, 5),
+				},
+			},
+		},
+		Daily: []ipnstate.UsageWindow{
+			{
+				Start: day(16),
+				End:   day(17),
+				Categories: map[ipnstate.UsageCategory]ipnstate.UsageBytes{
+					ipnstate.UsagePeer:    ub(1110, 2220),
+					ipnstate.UsageControl: ub(2, 4),
+				},
+				Interfaces: map[string]ipnstate.UsageBytes{
+					"wlan0":  ub(111, 222),
+					"rmnet0": ub(1001, 2002),
+				},
+			},
+			{
+				Start: day(17),
+				End:   day(18),
+				Categories: map[ipnstate.UsageCategory]ipnstate.UsageBytes{
+					ipnstate.UsagePeer: ub(5, 5),
+				},
+				Interfaces: map[string]ipnstate.UsageBytes{
+					"rmnet0": ub(5, 5),
+				},
+			},
+		},
+	}
+	got := tr.report()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("report mismatch (-want +got):\n%s", diff)
+	}
+
+	// The windows survive a restart.
+	store := new(mem.Store)
+	now := start.Add(2 * time.Hour)
+	if err := tr.persist(store, now, false); err != nil {
+		t.Fatal(err)
+	}
+	var tr2 usageTracker
+	if err := tr2.load(store); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, tr2.report()); diff != "" {
+		t.Fatalf("loaded report mismatch (-want +got):\n%s", diff)
+	}
+
+	// Unchanged windows, or windows changed within usagePersistInterval of
+	// the last write, aren't written again unless forced.
+	store.WriteState(usageStateKey, nil)
+	tr.sample(now, counters(ub(6, 6), ub(2, 4)), "rmnet0")
+	if err := tr.persist(store, now.Add(time.Minute), false); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := store.ReadState(usageStateKey); len(bs) != 0 {
+		t.Errorf("usage persisted within %v", usagePersistInterval)
+	}
+	if err := tr.persist(store, now.Add(time.Minute), true); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := store.ReadState(usageStateKey); len(bs) == 0 {
+		t.Errorf("usage not persisted when forced")
+	}
+}
+
+func TestUsageWindowLimit(t *testing.T) {
+	var tr usageTracker
+	start := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	for i := range 100 {
+		n := uint64(i + 1)
+		tr.sample(start.Add(time.Duration(i)*time.Hour), usageCounters{ipnstate.UsageDERP: {TxBytes: n}}, "eth0")
+	}
+	r := tr.report()
+	if len(r.Hourly) != usageHourlyWindows {
+		t.Errorf("got %d hourly windows; want %d", len(r.Hourly), usageHourlyWindows)
+	}
+	if got, want := r.Hourly[len(r.Hourly)-1].Start, start.Add(99*time.Hour); !got.Equal(want) {
+		t.Errorf("latest hourly window starts at %v; want %v", got, want)
+	}
+	if len(r.Daily) != 5 {
+		t.Errorf("got %d daily windows; want 5", len(r.Daily))
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tailscale.com/atomicfile"
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/netmap"
+	"tailscale.com/types/views"
+	"tailscale.com/util/dnsname"
+	"tailscale.com/util/mak"
+)
+
+// warmPeerHintsFile is the name of the file in the profile's data directory
+// in which the paths to the peers in Prefs.KeepWarmPeers are saved, to try
+// first after a restart.
+const warmPeerHintsFile = "warm-peer-hints.json"
+
+// warmPeersState is the LocalBackend's state for Prefs.KeepWarmPeers.
+type warmPeersState struct {
+	// all fields guarded by LocalBackend.mu
+
+	// peers are the peers that Prefs.KeepWarmPeers currently refers to.
+	peers map[key.NodePublic]tailcfg.StableNodeID
+
+	// hintsProfile is the profile whose saved path hints were loaded, or
+	// empty if none were.
+	hintsProfile ipn.ProfileID
+
+	// hints are the path hints of hintsProfile as last loaded or saved.
+	hints map[tailcfg.StableNodeID]netip.AddrPort
+}
+
+// resolveWarmPeers returns the peers in nm that names, from
+// Prefs.KeepWarmPeers, refer to. Names that match no peer are ignored.
+func resolveWarmPeers(names views.Slice[string], nm *netmap.NetworkMap) map[key.NodePublic]tailcfg.StableNodeID {
+	if names.Len() == 0 || nm == nil {
+		return nil
+	}
+	var ret map[key.NodePublic]tailcfg.StableNodeID
+	add := func(n tailcfg.NodeView) {
+		mak.Set(&ret, n.Key(), n.StableID())
+	}
+	for _, name := range names.All() {
+		if ip, err := netip.ParseAddr(name); err == nil {
+			if n, ok := nm.PeerByTailscaleIP(ip); ok {
+				add(n)
+			}
+			continue
+		}
+		if n, ok := nm.PeerWithStableID(tailcfg.StableNodeID(name)); ok {
+			add(n)
+			continue
+		}
+		fqdn := strings.TrimSuffix(name, ".")
+		for _, n := range nm.Peers {
+			peerFQDN := strings.TrimSuffix(n.Name(), ".")
+			if strings.EqualFold(peerFQDN, fqdn) || strings.EqualFold(dnsname.FirstLabel(peerFQDN), name) {
+				add(n)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// updateWarmPeersLocked resolves prefs.KeepWarmPeers against nm and tells
+// magicsock to keep the paths to those peers warm. The first time it's called
+// for a profile with warm peers, it passes magicsock the paths saved in a
+// previous run to try first; on later calls, it saves the current ones.
+//
+// It returns the warm peers' keys.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateWarmPeersLocked(prefs ipn.PrefsView, nm *netmap.NetworkMap) []key.NodePublic {
+	ms, ok := b.sys.MagicSock.GetOK()
+	if !ok {
+		return nil
+	}
+	st := &b.warmPeers
+	st.peers = resolveWarmPeers(prefs.KeepWarmPeers(), nm)
+	keys := make([]key.NodePublic, 0, len(st.peers))
+	for k := range st.peers {
+		keys = append(keys, k)
+	}
+	ms.SetWarmPeers(keys)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if id := b.pm.CurrentProfile().ID(); st.hintsProfile != id {
+		st.hintsProfile = id
+		st.hints = b.loadWarmPeerHintsLocked()
+		var hints map[key.NodePublic]netip.AddrPort
+		for k, id := range st.peers {
+			if ap, ok := st.hints[id]; ok {
+				mak.Set(&hints, k, ap)
+			}
+		}
+		ms.AddPathHints(hints)
+	} else {
+		b.saveWarmPeerHintsLocked()
+	}
+	return keys
+}
+
+// saveWarmPeerHintsLocked saves the paths magicsock currently uses to the warm
+// peers, if they changed since last saved or loaded. Saved paths to warm peers
+// that currently have none are kept.
+//
+// b.mu must be held.
+func (b *LocalBackend) saveWarmPeerHintsLocked() {
+	st := &b.warmPeers
+	ms, ok := b.sys.MagicSock.GetOK()
+	if !ok || len(st.peers) == 0 || st.hintsProfile != b.pm.CurrentProfile().ID() {
+		return
+	}
+	var hints map[tailcfg.StableNodeID]netip.AddrPort
+	for _, id := range st.peers {
+		if ap, ok := st.hints[id]; ok {
+			mak.Set(&hints, id, ap)
+		}
+	}
+	for k, ap := range ms.WarmPeerPaths() {
+		if id, ok := st.peers[k]; ok {
+			mak.Set(&hints, id, ap)
+		}
+	}
+	if maps.Equal(hints, st.hints) {
+		return
+	}
+	dir, err := b.profileMkdirAllLocked(st.hintsProfile)
+	if err != nil {
+		b.logf("[v1] saving warm peer hints: %v", err)
+		return
+	}
+	j, err := json.Marshal(hints)
+	if err != nil {
+		b.logf("saving warm peer hints: %v", err)
+		return
+	}
+	if err := atomicfile.WriteFile(filepath.Join(dir, warmPeerHintsFile), j, 0600); err != nil {
+		b.logf("saving warm peer hints: %v", err)
+		return
+	}
+	st.hints = hints
+}
+
+// loadWarmPeerHintsLocked returns the warm peer path hints saved for the
+// current profile, if any.
+//
+// b.mu must be held.
+func (b *LocalBackend) loadWarmPeerHintsLocked() map[tailcfg.StableNodeID]netip.AddrPort {
+	dir, err := b.profileMkdirAllLocked(b.pm.CurrentProfile().ID())
+	if err != nil {
+		b.logf("[v1] loading warm peer hints: %v", err)
+		return nil
+	}
+	j, err := os.ReadFile(filepath.Join(dir, warmPeerHintsFile))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			b.logf("loading warm peer hints: %v", err)
+		}
+		return nil
+	}
+	var hints map[tailcfg.StableNodeID]netip.AddrPort
+	if err := json.Unmarshal(j, &hints); err != nil {
+		b.logf("loading warm peer hints: %v", err)
+		return nil
+	}
+	return hints
+}
@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"maps"
+	"net/netip"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/netmap"
+	"tailscale.com/types/views"
+)
+
+func TestResolveWarmPeers(t *testing.T) {
+	newPeer := func(id tailcfg.StableNodeID, name, ip string) *tailcfg.Node {
+		return &tailcfg.Node{
+			StableID:  id,
+			Name:      name,
+			Key:       key.NewNode().Public(),
+			Addresses: []netip.Prefix{netip.MustParsePrefix(ip + "/32")},
+		}
+	}
+	db := newPeer("ndb", "db.tail-scale.ts.net.", "100.64.0.1")
+	nas := newPeer("nnas", "nas.tail-scale.ts.net.", "100.64.0.2")
+	web := newPeer("nweb", "web.tail-scale.ts.net.", "100.64.0.3")
+	nm := &netmap.NetworkMap{
+		Peers: []tailcfg.NodeView{db.View(), nas.View(), web.View()},
+	}
+
+	tests := []struct {
+		name  string
+		names []string
+		want  []*tailcfg.Node
+	}{
+		{"none", nil, nil},
+		{"ip", []string{"100.64.0.2"}, []*tailcfg.Node{nas}},
+		{"stable-id", []string{"nweb"}, []*tailcfg.Node{web}},
+		{"base-name", []string{"DB"}, []*tailcfg.Node{db}},
+		{"fqdn", []string{"nas.tail-scale.ts.net"}, []*tailcfg.Node{nas}},
+		{"fqdn-dot", []string{"nas.tail-scale.ts.net."}, []*tailcfg.Node{nas}},
+		{"unknown", []string{"printer", "100.64.0.9", "nas.other.ts.net"}, nil},
+		{"several", []string{"db", "100.64.0.1", "web"}, []*tailcfg.Node{db, web}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want map[key.NodePublic]tailcfg.StableNodeID
+			for _, n := range tt.want {
+				if want == nil {
+					want = map[key.NodePublic]tailcfg.StableNodeID{}
+				}
+				want[n.Key] = n.StableID
+			}
+			got := resolveWarmPeers(views.SliceOf(tt.names), nm)
+			if !maps.Equal(got, want) {
+				t.Errorf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
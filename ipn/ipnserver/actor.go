@@ -18,6 +18,8 @@
 	"tailscale.com/types/logger"
 	"tailscale.com/util/ctxkey"
 	"tailscale.com/util/osuser"
+	"tailscale.com/util/syspolicy/pkey"
+	"tailscale.com/util/syspolicy/policyclient"
 	"tailscale.com/version"
 )
 
@@ -123,6 +125,36 @@ func (a *actor) pid() int {
 	return a.ci.Pid()
 }
 
+// isReadonly reports whether the actor is a Windows client that may only read
+// from the LocalAPI, as a member of one of the groups that the
+// LocalAPIReadOnlyGroups policy allows to connect.
+func (a *actor) isReadonly() bool {
+	return runtime.GOOS == "windows" && a.ci != nil && a.ci.IsReadonlyConn("", logger.Discard)
+}
+
+// redactOtherUsers reports whether other local users' data is to be redacted
+// from the actor's LocalAPI responses, as it's a Unix socket client that's
+// neither root nor the operator and the LocalAPIRedactOtherUsers policy is
+// enabled.
+func (a *actor) redactOtherUsers(polc policyclient.Client, operatorUID string) bool {
+	if !buildfeatures.HasUnixSocketIdentity || a.ci == nil || !a.ci.IsUnixSock() || a.ci.Creds() == nil {
+		return false
+	}
+	uid, ok := a.ci.Creds().UserID()
+	if !ok || uid == "0" || uid == operatorUID {
+		return false
+	}
+	redact, _ := polc.GetBoolean(pkey.LocalAPIRedactOtherUsers, false)
+	return redact
+}
+
+// isReadonlyActor reports whether a is an [actor] for which
+// [actor.isReadonly] is true.
+func isReadonlyActor(a ipnauth.Actor) bool {
+	ac, ok := a.(*actor)
+	return ok && ac.isReadonly()
+}
+
 // ClientID implements [ipnauth.Actor].
 func (a *actor) ClientID() (_ ipnauth.ClientID, ok bool) {
 	return a.clientID, a.clientID != ipnauth.NoClientID
@@ -0,0 +1,180 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"tailscale.com/feature/buildfeatures"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/ipn/localapi"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/httpm"
+	"tailscale.com/util/set"
+)
+
+// maxDelegatedPrefsBody is the largest prefs edit body read to check
+// whether a delegated permission covers it.
+const maxDelegatedPrefsBody = 1 << 20
+
+// delegatedPrefs maps the [ipn.MaskedPrefs] fields that may be edited with a
+// delegated permission to that permission. Edits of any other field require
+// the operator.
+var delegatedPrefs = map[string]string{
+	"ExitNodeIDSet":             tailcfg.LocalOperatorExitNode,
+	"ExitNodeIPSet":             tailcfg.LocalOperatorExitNode,
+	"AutoExitNodeSet":           tailcfg.LocalOperatorExitNode,
+	"ExitNodeAllowLANAccessSet": tailcfg.LocalOperatorExitNode,
+	"RouteAllSet":               tailcfg.LocalOperatorAcceptRoutes,
+	"CorpDNSSet":                tailcfg.LocalOperatorAcceptDNS,
+	"ShieldsUpSet":              tailcfg.LocalOperatorShieldsUp,
+	"WantRunningSet":            tailcfg.LocalOperatorUpDown,
+}
+
+// localOperatorGrants returns the permissions that the control plane has
+// delegated to the local user with the given user ID and name, per
+// [tailcfg.NodeAttrLocalOperator].
+func localOperatorGrants(lb *ipnlocal.LocalBackend, uid, username string) set.Set[string] {
+	nm := lb.NetMapNoPeers()
+	if nm == nil || !nm.SelfNode.Valid() {
+		return nil
+	}
+	grants, err := tailcfg.UnmarshalNodeCapViewJSON[tailcfg.LocalOperatorGrant](nm.SelfNode.CapMap(), tailcfg.NodeAttrLocalOperator)
+	if err != nil {
+		return nil
+	}
+	return grantedPermissions(grants, uid, username)
+}
+
+// grantedPermissions returns the permissions that grants give the local
+// user with the given user ID and name.
+func grantedPermissions(grants []tailcfg.LocalOperatorGrant, uid, username string) set.Set[string] {
+	var perms set.Set[string]
+	for _, g := range grants {
+		if !slices.ContainsFunc(g.Users, func(u string) bool {
+			return u != "" && (u == uid || u == username)
+		}) {
+			continue
+		}
+		if perms == nil {
+			perms = make(set.Set[string])
+		}
+		perms.AddSlice(g.Permissions)
+	}
+	return perms
+}
+
+// localOperatorPermissions returns the delegated permissions that a LocalAPI
+// request r requires. It returns ok false if r can't be made with delegated
+// permissions at all. A request requiring no particular permission, such as
+// checking prefs, returns an empty set and ok true.
+//
+// It may read r.Body, which it replaces for the request's handler.
+func localOperatorPermissions(r *http.Request) (_ set.Set[string], ok bool) {
+	suffix, _ := strings.CutPrefix(r.URL.Path, "/localapi/v0/")
+	switch {
+	case suffix == "check-prefs" && r.Method == httpm.POST:
+		return set.Set[string]{}, true
+	case suffix == "prefs" && r.Method == httpm.PATCH:
+		return delegatedPrefsPermissions(r)
+	case suffix == "file-targets",
+		strings.HasPrefix(suffix, "file-put/"),
+		strings.HasPrefix(suffix, "files/"):
+		return set.Of(tailcfg.LocalOperatorTaildrop), true
+	}
+	return nil, false
+}
+
+// delegatedPrefsPermissions returns the delegated permissions required to
+// make the prefs edit in the body of r.
+func delegatedPrefsPermissions(r *http.Request) (_ set.Set[string], ok bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDelegatedPrefsBody+1))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || len(body) > maxDelegatedPrefsBody {
+		return nil, false
+	}
+	mp := new(ipn.MaskedPrefs)
+	if err := json.Unmarshal(body, mp); err != nil {
+		return nil, false
+	}
+	perms := make(set.Set[string])
+	mv := reflect.ValueOf(mp).Elem()
+	mt := mv.Type()
+	for i := range mt.NumField() {
+		f := mt.Field(i)
+		if !strings.HasSuffix(f.Name, "Set") {
+			continue // the embedded Prefs
+		}
+		if mv.Field(i).IsZero() {
+			continue
+		}
+		perm, ok := delegatedPrefs[f.Name]
+		if !ok {
+			return nil, false
+		}
+		perms.Add(perm)
+	}
+	return perms, true
+}
+
+// delegatedWrite reports whether the control plane has delegated the
+// permissions that LocalAPI request r requires to the actor's local user.
+// If so, it returns the permissions, for [permitDelegated].
+func (a *actor) delegatedWrite(lb *ipnlocal.LocalBackend, r *http.Request) (perms set.Set[string], ok bool) {
+	if !buildfeatures.HasUnixSocketIdentity || a.ci == nil {
+		return nil, false
+	}
+	creds := a.ci.Creds()
+	if creds == nil {
+		return nil, false
+	}
+	uid, ok := creds.UserID()
+	if !ok {
+		return nil, false
+	}
+	username, _ := a.Username()
+	granted := localOperatorGrants(lb, uid, username)
+	if len(granted) == 0 {
+		return nil, false
+	}
+	need, ok := localOperatorPermissions(r)
+	if !ok {
+		return nil, false
+	}
+	for p := range need {
+		if !granted.Contains(p) {
+			return nil, false
+		}
+	}
+	return need, true
+}
+
+// permitDelegated grants lah the access that the delegated permissions perms,
+// as returned by [actor.delegatedWrite], allow for the request they were
+// checked against. It returns the permissions as a string, for logging.
+//
+// Taildrop requests only get PermitTaildrop, which only the Taildrop handlers
+// honor. Other delegable requests get PermitWrite, having had their prefs
+// edits checked field by field.
+func permitDelegated(lah *localapi.Handler, perms set.Set[string]) string {
+	if perms.Contains(tailcfg.LocalOperatorTaildrop) {
+		lah.PermitTaildrop = true
+	} else {
+		lah.PermitWrite = true
+	}
+	s := perms.Slice()
+	slices.Sort(s)
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ",")
+}
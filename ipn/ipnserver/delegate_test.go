@@ -0,0 +1,205 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn/ipnauth"
+	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/ipn/localapi"
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tsd"
+	"tailscale.com/types/logid"
+	"tailscale.com/wgengine"
+)
+
+func TestLocalOperatorPermissions(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   []string // nil if not delegable
+	}{
+		{
+			name:   "exit-node",
+			method: "PATCH",
+			path:   "/localapi/v0/prefs",
+			body:   `{"ExitNodeID":"n123","ExitNodeIDSet":true,"ExitNodeAllowLANAccessSet":true}`,
+			want:   []string{tailcfg.LocalOperatorExitNode},
+		},
+		{
+			name:   "several",
+			method: "PATCH",
+			path:   "/localapi/v0/prefs",
+			body:   `{"RouteAllSet":true,"CorpDNSSet":true,"ShieldsUpSet":true,"WantRunningSet":true}`,
+			want: []string{
+				tailcfg.LocalOperatorAcceptDNS,
+				tailcfg.LocalOperatorAcceptRoutes,
+				tailcfg.LocalOperatorShieldsUp,
+				tailcfg.LocalOperatorUpDown,
+			},
+		},
+		{
+			name:   "unset-fields-ignored",
+			method: "PATCH",
+			path:   "/localapi/v0/prefs",
+			body:   `{"ShieldsUp":true,"ShieldsUpSet":true,"OperatorUser":"eve"}`,
+			want:   []string{tailcfg.LocalOperatorShieldsUp},
+		},
+		{
+			name:   "operator",
+			method: "PATCH",
+			path:   "/localapi/v0/prefs",
+			body:   `{"OperatorUser":"eve","OperatorUserSet":true,"ShieldsUpSet":true}`,
+		},
+		{
+			name:   "auto-update",
+			method: "PATCH",
+			path:   "/localapi/v0/prefs",
+			body:   `{"AutoUpdateSet":{"ApplySet":true}}`,
+		},
+		{
+			name:   "bad-json",
+			method: "PATCH",
+			path:   "/localapi/v0/prefs",
+			body:   `{`,
+		},
+		{
+			name:   "check-prefs",
+			method: "POST",
+			path:   "/localapi/v0/check-prefs",
+			body:   `{}`,
+			want:   []string{},
+		},
+		{
+			name:   "file-put",
+			method: "PUT",
+			path:   "/localapi/v0/file-put/n123/a.txt",
+			want:   []string{tailcfg.LocalOperatorTaildrop},
+		},
+		{
+			name:   "files",
+			method: "DELETE",
+			path:   "/localapi/v0/files/a.txt",
+			want:   []string{tailcfg.LocalOperatorTaildrop},
+		},
+		{
+			name:   "logout",
+			method: "POST",
+			path:   "/localapi/v0/logout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			perms, ok := localOperatorPermissions(r)
+			if ok != (tt.want != nil) {
+				t.Fatalf("ok = %v; want %v", ok, tt.want != nil)
+			}
+			got := perms.Slice()
+			slices.Sort(got)
+			if ok && !slices.Equal(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body after check = %q; want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestGrantedPermissions(t *testing.T) {
+	grants := []tailcfg.LocalOperatorGrant{
+		{Users: []string{"alice", "1001"}, Permissions: []string{tailcfg.LocalOperatorExitNode}},
+		{Users: []string{"1001"}, Permissions: []string{tailcfg.LocalOperatorTaildrop}},
+		{Users: []string{""}, Permissions: []string{tailcfg.LocalOperatorShieldsUp}},
+	}
+	tests := []struct {
+		uid, username string
+		want          []string
+	}{
+		{"1001", "alice", []string{tailcfg.LocalOperatorExitNode, tailcfg.LocalOperatorTaildrop}},
+		{"1002", "alice", []string{tailcfg.LocalOperatorExitNode}},
+		{"1003", "bob", nil},
+		{"1004", "", nil},
+	}
+	for _, tt := range tests {
+		got := grantedPermissions(grants, tt.uid, tt.username).Slice()
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("grantedPermissions(%q, %q) = %q; want %q", tt.uid, tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestTaildropDelegateCannotWrite(t *testing.T) {
+	sys := tsd.NewSystem()
+	sys.Set(new(mem.Store))
+	e, err := wgengine.NewFakeUserspaceEngine(t.Logf, sys.Set, sys.HealthTracker.Get(), sys.UserMetricsRegistry(), sys.Bus.Get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	sys.Set(e)
+	lb, err := ipnlocal.NewLocalBackend(t.Logf, logid.PublicID{}, sys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(lb.Shutdown)
+
+	newHandler := func(delegated *http.Request) *localapi.Handler {
+		lah := localapi.NewHandler(localapi.HandlerConfig{
+			Actor:    &ipnauth.TestActor{Name: "alice"},
+			Backend:  lb,
+			Logf:     t.Logf,
+			EventBus: lb.Sys().Bus.Get(),
+		})
+		lah.PermitRead = true
+		perms, ok := localOperatorPermissions(delegated)
+		if !ok {
+			t.Fatalf("%s %s not delegable", delegated.Method, delegated.URL.Path)
+		}
+		permitDelegated(lah, perms)
+		return lah
+	}
+
+	lah := newHandler(httptest.NewRequest("PUT", "/localapi/v0/file-put/n123/a.txt", nil))
+	if lah.PermitWrite || !lah.PermitTaildrop {
+		t.Fatalf("Taildrop delegation: PermitWrite=%v, PermitTaildrop=%v; want false, true", lah.PermitWrite, lah.PermitTaildrop)
+	}
+	for _, req := range []struct{ method, path, body string }{
+		{"PATCH", "/localapi/v0/prefs", `{"ShieldsUpSet":true}`},
+		{"POST", "/localapi/v0/logout", ""},
+		{"POST", "/localapi/v0/start", `{}`},
+		{"POST", "/localapi/v0/shutdown", ""},
+		{"POST", "/localapi/v0/reset-auth", ""},
+	} {
+		r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+		r.Host = "local-tailscaled.sock"
+		rec := httptest.NewRecorder()
+		lah.ServeHTTP(rec, r)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Taildrop delegate: %s %s = %d; want %d", req.method, req.path, rec.Code, http.StatusForbidden)
+		}
+	}
+
+	// Delegated prefs edits still get PermitWrite, having been checked
+	// field by field.
+	lah = newHandler(httptest.NewRequest("PATCH", "/localapi/v0/prefs", strings.NewReader(`{"ShieldsUpSet":true}`)))
+	if !lah.PermitWrite || lah.PermitTaildrop {
+		t.Errorf("prefs delegation: PermitWrite=%v, PermitTaildrop=%v; want true, false", lah.PermitWrite, lah.PermitTaildrop)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn/ipnauth"
+	"tailscale.com/util/httpm"
+)
+
+// maxLocalAuditLogSize is the size in bytes at which the local audit log is
+// rotated. The previous file is kept, so the log takes up at most twice this.
+const maxLocalAuditLogSize = 1 << 20
+
+// localAuditLog is an append-only log of mutating LocalAPI calls, kept as
+// JSON lines in a file in tailscaled's state directory. It lets admins of
+// shared machines attribute configuration changes to local users.
+type localAuditLog struct {
+	path string // path to the log; path+".1" is the previous one
+
+	mu sync.Mutex // guards writes and rotation of the files
+}
+
+// add appends rec to the log, rotating it first if it's too large.
+func (l *localAuditLog) add(rec apitype.LocalAPIAuditRecord) error {
+	j, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	j = append(j, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if fi, err := os.Stat(l.path); err == nil && fi.Size()+int64(len(j)) > maxLocalAuditLogSize {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(j); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// records returns the records in the log, oldest first, including those in
+// the previous file. Lines that can't be parsed, such as one cut short by a
+// crash, are skipped.
+func (l *localAuditLog) records() ([]apitype.LocalAPIAuditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var recs []apitype.LocalAPIAuditRecord
+	for _, name := range []string{l.path + ".1", l.path} {
+		f, err := os.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		bs := bufio.NewScanner(f)
+		bs.Buffer(nil, maxLocalAuditLogSize)
+		for bs.Scan() {
+			var rec apitype.LocalAPIAuditRecord
+			if json.Unmarshal(bs.Bytes(), &rec) == nil {
+				recs = append(recs, rec)
+			}
+		}
+		err = bs.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return recs, nil
+}
+
+// isMutatingMethod reports whether LocalAPI calls with the HTTP method m
+// may change tailscaled's state, and so belong in the audit log.
+func isMutatingMethod(m string) bool {
+	switch m {
+	case httpm.GET, httpm.HEAD, httpm.OPTIONS:
+		return false
+	}
+	return true
+}
+
+// newLocalAuditRecord returns the audit log record for a LocalAPI call r
+// made by ci at start that completed with the HTTP status code status.
+func newLocalAuditRecord(ci ipnauth.Actor, r *http.Request, start time.Time, status int) apitype.LocalAPIAuditRecord {
+	rec := apitype.LocalAPIAuditRecord{
+		Time:   start.UTC(),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Status: status,
+	}
+	if name, err := ci.Username(); err == nil {
+		rec.User = name
+	}
+	a, ok := ci.(*actor)
+	if !ok || a.ci == nil {
+		return rec
+	}
+	if uid := a.ci.WindowsUserID(); uid != "" {
+		rec.UID = string(uid)
+	} else if creds := a.ci.Creds(); creds != nil {
+		rec.UID, _ = creds.UserID()
+	}
+	if pid := a.pid(); pid != 0 {
+		rec.PID = pid
+		if exe, err := processExecutable(pid); err == nil {
+			rec.Executable = exe
+		}
+	}
+	return rec
+}
+
+// statusRecorder is an [http.ResponseWriter] that records the status code
+// of the response, for the audit log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements [http.Flusher], which some LocalAPI handlers require.
+func (r *statusRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements [http.Hijacker], which some LocalAPI handlers require.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter, for [http.ResponseController].
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
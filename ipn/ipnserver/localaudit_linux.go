@@ -0,0 +1,14 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnserver
+
+import (
+	"os"
+	"strconv"
+)
+
+// processExecutable returns the path to the binary of the process pid.
+func processExecutable(pid int) (string, error) {
+	return os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+}
@@ -0,0 +1,13 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !linux && !windows
+
+package ipnserver
+
+import "errors"
+
+// processExecutable returns the path to the binary of the process pid.
+func processExecutable(pid int) (string, error) {
+	return "", errors.ErrUnsupported
+}
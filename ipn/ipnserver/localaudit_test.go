@@ -0,0 +1,123 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/util/httpm"
+)
+
+func TestLocalAuditLog(t *testing.T) {
+	l := &localAuditLog{path: filepath.Join(t.TempDir(), "audit.log")}
+	if recs, err := l.records(); err != nil || len(recs) != 0 {
+		t.Fatalf("records of empty log = %v, %v; want none", recs, err)
+	}
+
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	rec := func(i int) apitype.LocalAPIAuditRecord {
+		return apitype.LocalAPIAuditRecord{
+			Time:   start.Add(time.Duration(i) * time.Second),
+			Method: httpm.PATCH,
+			Path:   "/localapi/v0/prefs",
+			Status: http.StatusOK,
+			User:   "alice",
+			UID:    "1000",
+			PID:    i,
+		}
+	}
+	for i := range 3 {
+		if err := l.add(rec(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A torn write at the end of the log shouldn't hide the rest of it.
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Time":"2026-10`)
+	f.Close()
+
+	recs, err := l.records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("got %d records; want 3", len(recs))
+	}
+	for i, got := range recs {
+		if want := rec(i); got != want {
+			t.Errorf("record %d = %+v; want %+v", i, got, want)
+		}
+	}
+}
+
+func TestLocalAuditLogRotation(t *testing.T) {
+	l := &localAuditLog{path: filepath.Join(t.TempDir(), "audit.log")}
+	var n int
+	for {
+		if err := l.add(apitype.LocalAPIAuditRecord{Method: httpm.POST, Path: "/localapi/v0/start", PID: n}); err != nil {
+			t.Fatal(err)
+		}
+		n++
+		if _, err := os.Stat(l.path + ".1"); err == nil {
+			break
+		}
+	}
+	if err := l.add(apitype.LocalAPIAuditRecord{Method: httpm.POST, Path: "/localapi/v0/start", PID: n}); err != nil {
+		t.Fatal(err)
+	}
+	n++
+
+	recs, err := l.records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != n {
+		t.Fatalf("got %d records; want %d", len(recs), n)
+	}
+	for i, rec := range recs {
+		if rec.PID != i {
+			t.Fatalf("record %d has PID %d; want records in order", i, rec.PID)
+		}
+	}
+	for _, name := range []string{l.path, l.path + ".1"} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() > maxLocalAuditLogSize {
+			t.Errorf("%s is %d bytes; want at most %d", name, fi.Size(), maxLocalAuditLogSize)
+		}
+	}
+}
+
+func TestStatusRecorder(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(w http.ResponseWriter)
+		want    int
+	}{
+		{"none", func(w http.ResponseWriter) {}, 0},
+		{"write", func(w http.ResponseWriter) { w.Write([]byte("ok")) }, http.StatusOK},
+		{"error", func(w http.ResponseWriter) { http.Error(w, "denied", http.StatusForbidden) }, http.StatusForbidden},
+		{"flush", func(w http.ResponseWriter) { w.(http.Flusher).Flush() }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+			tt.handler(sr)
+			if sr.status != tt.want {
+				t.Errorf("status = %d; want %d", sr.status, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnserver
+
+import (
+	"golang.org/x/sys/windows"
+	"tailscale.com/util/winutil"
+)
+
+// processExecutable returns the path to the binary of the process pid.
+func processExecutable(pid int) (string, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return "", err
+	}
+	defer windows.CloseHandle(h)
+	return winutil.ProcessImageName(h)
+}
@@ -15,11 +15,13 @@
 	"net"
 	"net/http"
 	"os/user"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unicode"
 
 	"tailscale.com/client/tailscale/apitype"
@@ -47,6 +49,10 @@ type Server struct {
 	netMon       *netmon.Monitor // must be non-nil
 	backendLogID logid.PublicID
 
+	// auditLog, if non-nil, records mutating LocalAPI calls. It's set
+	// along with lb and is read-only after that.
+	auditLog *localAuditLog
+
 	// mu guards the fields that follow.
 	// lock order: mu, then LocalBackend.mu
 	mu            sync.Mutex
@@ -214,13 +220,41 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 			LogID:    s.backendLogID,
 			EventBus: lb.Sys().Bus.Get(),
 		})
+		var delegated string
 		if actor, ok := ci.(*actor); ok {
-			lah.PermitRead, lah.PermitWrite = actor.Permissions(lb.OperatorUserID())
+			operatorUID := lb.OperatorUserID()
+			lah.PermitRead, lah.PermitWrite = actor.Permissions(operatorUID)
 			lah.PermitCert = actor.CanFetchCerts()
+			lah.RedactOtherUsers = actor.redactOtherUsers(lb.PolicyClient(), operatorUID)
+			if lah.PermitRead && !lah.PermitWrite {
+				if perms, ok := actor.delegatedWrite(lb, r); ok {
+					delegated = permitDelegated(lah, perms)
+					s.logf("localapi: %s %s permitted by delegated permissions %s", r.Method, r.URL.Path, delegated)
+				}
+			}
 		} else if testenv.InTest() {
 			lah.PermitRead, lah.PermitWrite = true, true
 		}
-		lah.ServeHTTP(w, r)
+		if s.auditLog == nil {
+			lah.ServeHTTP(w, r)
+			return
+		}
+		lah.AuditLog = s.auditLog.records
+		if !isMutatingMethod(r.Method) {
+			lah.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		lah.ServeHTTP(sr, r)
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		rec := newLocalAuditRecord(ci, r, start, sr.status)
+		rec.Delegated = delegated
+		if err := s.auditLog.add(rec); err != nil {
+			s.logf("localapi audit log: %v", err)
+		}
 		return
 	}
 
@@ -253,12 +287,21 @@ func (e inUseOtherUserError) Unwrap() error { return e.error }
 //
 // s.mu must be held.
 func (s *Server) checkConnIdentityLocked(ci ipnauth.Actor) error {
+	if isReadonlyActor(ci) {
+		// Read-only clients can't change which user Tailscale is
+		// being used by, nor anything else, so they may always
+		// connect.
+		return nil
+	}
 	// If clients are already connected, verify they're the same user.
 	// This mostly matters on Windows at the moment.
 	if len(s.activeReqs) > 0 {
 		var active ipnauth.Actor
-		for _, active = range s.activeReqs {
-			break
+		for _, a := range s.activeReqs {
+			if !isReadonlyActor(a) {
+				active = a
+				break
+			}
 		}
 		if active != nil {
 			// Always allow Windows SYSTEM user to connect,
@@ -344,7 +387,11 @@ func (a *actor) Permissions(operatorUID string) (read, write bool) {
 		// acceptable to permit read and write access without any additional
 		// checks here. Note that this permission model is being changed in
 		// tailscale/corp#18342.
-		return true, true
+		//
+		// The exception is members of the groups that the
+		// LocalAPIReadOnlyGroups policy allows to connect, who only have
+		// read access.
+		return true, !a.isReadonly()
 	case "js", "plan9":
 		return true, true
 	}
@@ -426,25 +473,25 @@ func (s *Server) addActiveHTTPRequest(req *http.Request, actor ipnauth.Actor) (o
 
 	mak.Set(&s.activeReqs, req, actor)
 
-	if len(s.activeReqs) == 1 {
-		if envknob.GOOS() == "windows" && !actor.IsLocalSystem() {
-			// Tell the LocalBackend about the identity we're now running as,
-			// unless it's the SYSTEM user. That user is not a real account and
-			// doesn't have a home directory.
-			lb.SetCurrentUser(actor)
-		}
+	// Tell the LocalBackend about the identity we're now running as,
+	// unless it's the SYSTEM user. That user is not a real account and
+	// doesn't have a home directory. Read-only clients don't count as
+	// running Tailscale either.
+	setsUser := envknob.GOOS() == "windows" && !actor.IsLocalSystem() && !isReadonlyActor(actor)
+	if setsUser && s.numUserReqsLocked() == 1 {
+		lb.SetCurrentUser(actor)
 	}
 
 	onDone = func() {
 		s.mu.Lock()
 		defer s.mu.Unlock()
 		delete(s.activeReqs, req)
-		if len(s.activeReqs) != 0 {
+		if s.numUserReqsLocked() != 0 {
 			// The server is not idle yet.
 			return
 		}
 
-		if envknob.GOOS() == "windows" && !actor.IsLocalSystem() {
+		if setsUser {
 			lb.SetCurrentUser(nil)
 		}
 
@@ -455,6 +502,20 @@ func (s *Server) addActiveHTTPRequest(req *http.Request, actor ipnauth.Actor) (o
 	return onDone, nil
 }
 
+// numUserReqsLocked returns the number of active requests, not counting
+// those from read-only clients.
+//
+// s.mu must be held.
+func (s *Server) numUserReqsLocked() int {
+	n := 0
+	for _, a := range s.activeReqs {
+		if !isReadonlyActor(a) {
+			n++
+		}
+	}
+	return n
+}
+
 // New returns a new Server.
 //
 // To start it, use the Server.Run method.
@@ -481,6 +542,9 @@ func (s *Server) SetLocalBackend(lb *ipnlocal.LocalBackend) {
 		panic("nil LocalBackend")
 	}
 
+	if root := lb.TailscaleVarRoot(); root != "" {
+		s.auditLog = &localAuditLog{path: filepath.Join(root, "localapi-audit.log")}
+	}
 	if !s.lb.CompareAndSwap(nil, lb) {
 		panic("already set")
 	}
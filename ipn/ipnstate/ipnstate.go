@@ -787,6 +787,135 @@ type DebugDERPRegionReport struct {
 	Errors   []string
 }
 
+// LatencyMatrix is the result of a "tailscale debug latency-matrix" command:
+// reachability and latency between a set of nodes.
+type LatencyMatrix struct {
+	// Nodes are the Tailscale IPs of the nodes involved, starting with the
+	// node that ran the test.
+	Nodes []netip.Addr
+
+	// Results are the ping results between pairs of Nodes, in no
+	// particular order. A pair is missing if it wasn't tested.
+	Results []LatencyMatrixResult
+}
+
+// LatencyMatrixResult is the result of pinging To from From, as part of
+// a [LatencyMatrix].
+type LatencyMatrixResult struct {
+	From netip.Addr
+	To   netip.Addr
+
+	// Ping is the result of a disco ping from From to To. Its Err field is
+	// set if the ping failed, or if From couldn't be asked to run it.
+	Ping *PingResult
+}
+
+// DERPFailoverDrill is the result of a "tailscale debug derp-failover-drill"
+// command: how this node's connectivity recovered after its home DERP region
+// was made unavailable.
+type DERPFailoverDrill struct {
+	// OldHomeRegionID is the home DERP region that was made unavailable
+	// for the drill.
+	OldHomeRegionID   int
+	OldHomeRegionCode string
+
+	// NewHomeRegionID is the home DERP region chosen in its place, or zero
+	// if none was chosen before the drill ended.
+	NewHomeRegionID   int
+	NewHomeRegionCode string
+
+	// HomeFailoverSeconds is how long after the start of the drill the new
+	// home region was chosen.
+	HomeFailoverSeconds float64
+
+	// DurationSeconds is how long the drill ran before the old home region
+	// was made available again.
+	DurationSeconds float64
+
+	// Peers are the results for each peer tested, in the order requested.
+	Peers []DERPFailoverDrillPeer
+}
+
+// DERPFailoverDrillPeer is the result for one peer of a [DERPFailoverDrill].
+type DERPFailoverDrillPeer struct {
+	IP netip.Addr
+
+	// Before is the result of a disco ping to the peer just before the
+	// drill started.
+	Before *PingResult
+
+	// After is the first successful disco ping to the peer during the
+	// drill, or the last failed one if it wasn't reached.
+	After *PingResult
+
+	// Recovered is whether the peer was reached during the drill, and
+	// RecoverySeconds how long after the start of the drill it was.
+	Recovered       bool
+	RecoverySeconds float64
+}
+
+// UsageReport is the number of bytes Tailscale itself sent and received in
+// recent time windows, such as for users on metered connections. It's returned
+// by the LocalAPI "usage" endpoint.
+type UsageReport struct {
+	// Hourly is the usage in each of the last hours with any, oldest
+	// first.
+	Hourly []UsageWindow
+
+	// Daily is the usage in each of the last days (in local time) with
+	// any, oldest first.
+	Daily []UsageWindow
+
+	// Unmeasured lists the usage categories that can't be measured on
+	// this platform or by this build, and so are missing from the windows.
+	Unmeasured []UsageCategory `json:",omitempty"`
+}
+
+// UsageWindow is the usage in a time window of a [UsageReport].
+type UsageWindow struct {
+	Start time.Time
+	End   time.Time // exclusive
+
+	// Categories is the usage by category. Its values sum to the total
+	// usage in the window.
+	Categories map[UsageCategory]UsageBytes
+
+	// Interfaces is the usage by the name of the network interface that
+	// was the default route when it happened. Its values sum to the total
+	// usage in the window.
+	Interfaces map[string]UsageBytes
+}
+
+// Total returns the total usage in w.
+func (w UsageWindow) Total() UsageBytes {
+	var t UsageBytes
+	for _, b := range w.Categories {
+		t = t.Add(b)
+	}
+	return t
+}
+
+// UsageCategory is a category of traffic in a [UsageWindow].
+type UsageCategory string
+
+const (
+	UsagePeer    UsageCategory = "peer"    // WireGuard traffic to peers, sent directly or via peer relays
+	UsageDERP    UsageCategory = "derp"    // WireGuard traffic to peers, relayed by DERP
+	UsageControl UsageCategory = "control" // traffic to the coordination server
+	UsageLog     UsageCategory = "log"     // log uploads
+)
+
+// UsageBytes is a number of bytes sent and received.
+type UsageBytes struct {
+	TxBytes uint64
+	RxBytes uint64
+}
+
+// Add returns the sum of b and o.
+func (b UsageBytes) Add(o UsageBytes) UsageBytes {
+	return UsageBytes{TxBytes: b.TxBytes + o.TxBytes, RxBytes: b.RxBytes + o.RxBytes}
+}
+
 type SelfUpdateStatus string
 
 const (
@@ -6,11 +6,15 @@
 package localapi
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/ipn/ipnlocal"
 )
 
@@ -37,7 +41,12 @@ func (h *Handler) serveCert(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	pair, err := h.b.GetCertPEMWithValidity(r.Context(), domain, minValidity)
+	kt, err := ipnlocal.ParseCertKeyType(r.URL.Query().Get("key_type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pair, err := h.b.GetCertPEMWithOptions(r.Context(), domain, kt, minValidity)
 	if err != nil {
 		// TODO(bradfitz): 500 is a little lazy here. The errors returned from
 		// GetCertPEM (and everywhere) should carry info info to get whether
@@ -47,9 +56,36 @@ func (h *Handler) serveCert(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprint(err), 500)
 		return
 	}
+	if r.URL.Query().Get("type") == "json" {
+		serveCertChainJSON(w, domain, kt, pair)
+		return
+	}
 	serveKeyPair(w, r, pair)
 }
 
+// serveCertChainJSON writes p to w as an apitype.CertChain.
+func serveCertChainJSON(w http.ResponseWriter, domain string, kt ipnlocal.CertKeyType, p *ipnlocal.TLSCertKeyPair) {
+	cert, err := tls.X509KeyPair(p.CertPEM, p.KeyPEM)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("parsing cert: %v", err), http.StatusInternalServerError)
+		return
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("marshaling key: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apitype.CertChain{
+		Domain:     domain,
+		KeyType:    string(kt),
+		Chain:      cert.Certificate,
+		PrivateKey: key,
+		NotAfter:   cert.Leaf.NotAfter,
+		Cached:     p.Cached,
+	})
+}
+
 func serveKeyPair(w http.ResponseWriter, r *http.Request, p *ipnlocal.TLSCertKeyPair) {
 	w.Header().Set("Content-Type", "text/plain")
 	switch r.URL.Query().Get("type") {
@@ -61,6 +97,6 @@ func serveKeyPair(w http.ResponseWriter, r *http.Request, p *ipnlocal.TLSCertKey
 		w.Write(p.KeyPEM)
 		w.Write(p.CertPEM)
 	default:
-		http.Error(w, `invalid type; want "cert" (default), "key", or "pair"`, 400)
+		http.Error(w, `invalid type; want "cert" (default), "key", "pair", or "json"`, 400)
 	}
 }
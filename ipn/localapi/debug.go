@@ -12,6 +12,7 @@
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http"
 	"net/netip"
@@ -22,10 +23,12 @@
 	"time"
 
 	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/envknob"
 	"tailscale.com/feature"
 	"tailscale.com/feature/buildfeatures"
 	"tailscale.com/ipn"
 	"tailscale.com/types/logger"
+	"tailscale.com/types/netstacktype"
 	"tailscale.com/util/eventbus"
 	"tailscale.com/util/httpm"
 )
@@ -40,10 +43,15 @@ func init() {
 	Register("debug-bus-queues", (*Handler).serveDebugBusQueues)
 	Register("debug-derp-region", (*Handler).serveDebugDERPRegion)
 	Register("debug-dial-types", (*Handler).serveDebugDialTypes)
+	Register("debug-env", (*Handler).serveDebugEnv)
+	Register("debug-latency-matrix", (*Handler).serveDebugLatencyMatrix)
+	Register("debug-derp-failover-drill", (*Handler).serveDebugDERPFailoverDrill)
 	Register("debug-log", (*Handler).serveDebugLog)
+	Register("debug-netstack-tcp", (*Handler).serveDebugNetstackTCP)
 	Register("debug-packet-filter-matches", (*Handler).serveDebugPacketFilterMatches)
 	Register("debug-packet-filter-rules", (*Handler).serveDebugPacketFilterRules)
 	Register("debug-peer-endpoint-changes", (*Handler).serveDebugPeerEndpointChanges)
+	Register("debug-peer-paths", (*Handler).serveDebugPeerPaths)
 	Register("debug-optional-features", (*Handler).serveDebugOptionalFeatures)
 }
 
@@ -75,6 +83,35 @@ func (h *Handler) serveDebugPeerEndpointChanges(w http.ResponseWriter, r *http.R
 	e.Encode(chs)
 }
 
+// serveDebugPeerPaths serves the path quality stats of the peer with the
+// Tailscale IP in the "ip" parameter, or of all peers if it's absent.
+func (h *Handler) serveDebugPeerPaths(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "status access denied", http.StatusForbidden)
+		return
+	}
+
+	var ip netip.Addr
+	if ipStr := r.FormValue("ip"); ipStr != "" {
+		var err error
+		ip, err = netip.ParseAddr(ipStr)
+		if err != nil {
+			http.Error(w, "invalid IP", http.StatusBadRequest)
+			return
+		}
+	}
+	stats, err := h.b.GetPeerPathStats(ip)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	e.Encode(stats)
+}
+
 func (h *Handler) serveComponentDebugLogging(w http.ResponseWriter, r *http.Request) {
 	if !h.PermitWrite {
 		http.Error(w, "debug access denied", http.StatusForbidden)
@@ -233,6 +270,12 @@ func (h *Handler) serveDebug(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			return
 		}
+	case "portmap-leases":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(h.b.DebugPortMapLeases())
+		if err == nil {
+			return
+		}
 	case "peer-disco-keys":
 		w.Header().Set("Content-Type", "application/json")
 		err = json.NewEncoder(w).Encode(h.b.DebugPeerDiscoKeys())
@@ -313,6 +356,181 @@ func (h *Handler) serveDebugPacketFilterRules(w http.ResponseWriter, r *http.Req
 	enc.Encode(nm.PacketFilterRules)
 }
 
+// serveDebugLatencyMatrix runs a reachability and latency test from this node
+// to the peers with the Tailscale IPs given in the "ip" query parameters, and, if
+// "mesh" is true, between those peers.
+func (h *Handler) serveDebugLatencyMatrix(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != httpm.POST {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var targets []netip.Addr
+	for _, s := range q["ip"] {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			http.Error(w, "invalid 'ip' parameter", http.StatusBadRequest)
+			return
+		}
+		targets = append(targets, ip)
+	}
+	mesh, _ := strconv.ParseBool(q.Get("mesh"))
+	lm, err := h.b.LatencyMatrix(r.Context(), targets, mesh)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lm)
+}
+
+// serveDebugDERPFailoverDrill makes this node's home DERP region unavailable
+// for up to the duration in the "timeout" query parameter, and reports how
+// connectivity to the peers with the Tailscale IPs given in the "ip" query
+// parameters recovered.
+func (h *Handler) serveDebugDERPFailoverDrill(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != httpm.POST {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var targets []netip.Addr
+	for _, s := range q["ip"] {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			http.Error(w, "invalid 'ip' parameter", http.StatusBadRequest)
+			return
+		}
+		targets = append(targets, ip)
+	}
+	var timeout time.Duration
+	if s := q.Get("timeout"); s != "" {
+		var err error
+		timeout, err = time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, "invalid 'timeout' parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	res, err := h.b.DERPFailoverDrill(r.Context(), targets, timeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// netstackTCPConfigurer is the subset of *netstack.Impl used by
+// serveDebugNetstackTCP.
+type netstackTCPConfigurer interface {
+	TCPConfig() netstacktype.TCPConfig
+	SetTCPConfig(netstacktype.TCPConfig) error
+}
+
+// serveDebugNetstackTCP returns the userspace network stack's TCP
+// configuration on GET, and replaces it with the JSON-encoded
+// [netstacktype.TCPConfig] in the request body on POST.
+func (h *Handler) serveDebugNetstackTCP(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	ns, _ := h.b.Sys().Netstack.GetOK()
+	tcpc, ok := ns.(netstackTCPConfigurer)
+	if !ok {
+		http.Error(w, "netstack not in use", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case httpm.GET:
+	case httpm.POST:
+		var c netstacktype.TCPConfig
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := tcpc.SetTCPConfig(c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "want GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tcpc.TCPConfig())
+}
+
+// serveDebugEnv returns the envknobs and control knobs in effect as a JSON
+// array of [apitype.DebugKnob] on GET. With ?all=true, it also includes
+// registered envknobs that aren't set.
+//
+// On POST, it sets the envknob named by the "name" parameter to the
+// "value" parameter, if the knob can be set at runtime.
+func (h *Handler) serveDebugEnv(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case httpm.GET:
+	case httpm.POST:
+		name := r.FormValue("name")
+		if name == "" {
+			http.Error(w, "missing 'name' parameter", http.StatusBadRequest)
+			return
+		}
+		if err := envknob.SetAtRuntime(name, r.FormValue("value")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.logf("debug-env: set %s=%q", name, r.FormValue("value"))
+	default:
+		http.Error(w, "want GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	all, _ := strconv.ParseBool(r.FormValue("all"))
+	var knobs []apitype.DebugKnob
+	for _, k := range envknob.Knobs() {
+		if k.Value == "" && !all {
+			continue
+		}
+		knobs = append(knobs, apitype.DebugKnob{
+			Name:            k.Name,
+			Value:           k.Value,
+			Source:          k.Source,
+			RestartRequired: !k.Registered,
+			Settable:        envknob.CanSetAtRuntime(k.Name),
+		})
+	}
+	ck := h.b.ControlKnobs().AsDebugJSON()
+	for _, name := range slices.Sorted(maps.Keys(ck)) {
+		v := fmt.Sprint(ck[name])
+		if v == "false" || v == "" {
+			continue // not in effect
+		}
+		knobs = append(knobs, apitype.DebugKnob{
+			Name:   name,
+			Value:  v,
+			Source: "control",
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	e.Encode(knobs)
+}
+
 func (h *Handler) serveDebugPacketFilterMatches(w http.ResponseWriter, r *http.Request) {
 	if !h.PermitWrite {
 		http.Error(w, "debug access denied", http.StatusForbidden)
@@ -72,6 +72,7 @@
 
 	// The other /localapi/v0/NAME handlers are exact matches and contain only NAME
 	// without a trailing slash:
+	"audit-log":            (*Handler).serveAuditLog,
 	"cert-domains":         (*Handler).serveCertDomains,
 	"check-prefs":          (*Handler).serveCheckPrefs,
 	"check-so-mark-in-use": (*Handler).serveCheckSOMarkInUse,
@@ -90,6 +91,7 @@
 	"shutdown":             (*Handler).serveShutdown,
 	"start":                (*Handler).serveStart,
 	"status":               (*Handler).serveStatus,
+	"usage":                (*Handler).serveUsage,
 	"whois":                (*Handler).serveWhoIs,
 }
 
@@ -220,9 +222,23 @@ type Handler struct {
 	// cert fetching access.
 	PermitCert bool
 
+	// PermitTaildrop is whether the client is additionally granted
+	// access to the Taildrop handlers, as delegated by the control plane,
+	// without PermitWrite.
+	PermitTaildrop bool
+
+	// RedactOtherUsers is whether other local users' data is redacted from
+	// responses, per the LocalAPIRedactOtherUsers policy, as the client is
+	// neither root nor the operator.
+	RedactOtherUsers bool
+
 	// Actor is the identity of the client connected to the Handler.
 	Actor ipnauth.Actor
 
+	// AuditLog, if non-nil, returns the records of tailscaled's local
+	// audit log of mutating LocalAPI calls, oldest first.
+	AuditLog func() ([]apitype.LocalAPIAuditRecord, error)
+
 	b            *ipnlocal.LocalBackend
 	logf         logger.Logf
 	backendLogID logid.PublicID
@@ -243,6 +259,9 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "server has no local backend", http.StatusInternalServerError)
 		return
 	}
+	if serveWebSocket != nil && serveWebSocket(h, w, r) {
+		return
+	}
 	if r.Referer() != "" || r.Header.Get("Origin") != "" || !h.validHost(r.Host) {
 		metricInvalidRequests.Add(1)
 		http.Error(w, "invalid localapi request", http.StatusForbidden)
@@ -274,6 +293,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serveWebSocket, if non-nil, serves LocalAPI requests that upgrade to a
+// WebSocket and reports whether the request was one. It's only set when the
+// binary is built with the localapiwebsocket feature, and never on iOS.
+var serveWebSocket func(*Handler, http.ResponseWriter, *http.Request) (handled bool)
+
 // validLocalHostForTesting allows loopback handlers without RequiredPassword for testing.
 var validLocalHostForTesting = false
 
@@ -834,6 +858,23 @@ func (h *Handler) serveStatus(w http.ResponseWriter, r *http.Request) {
 	e.Encode(st)
 }
 
+// serveUsage returns the number of bytes Tailscale itself sent and received
+// in recent hours and days, as an [ipnstate.UsageReport].
+func (h *Handler) serveUsage(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "usage access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != httpm.GET {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	e.Encode(h.b.UsageReport())
+}
+
 // InUseOtherUserIPNStream reports whether r is a request for the watch-ipn-bus
 // handler. If so, it writes an ipn.Notify InUseOtherUser message to the user
 // and returns true. Otherwise it returns false, in which case it doesn't write
@@ -884,7 +925,15 @@ func (h *Handler) serveWatchIPNBus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
 	enc := json.NewEncoder(w)
+	var username string
+	if h.RedactOtherUsers {
+		username = h.localUsername()
+	}
 	h.b.WatchNotificationsAs(ctx, h.Actor, mask, f.Flush, func(roNotify *ipn.Notify) (keepGoing bool) {
+		roNotify, ok := h.redactNotify(roNotify, username)
+		if !ok {
+			return true
+		}
 		err := enc.Encode(roNotify)
 		if err != nil {
 			if !neterror.IsClosedPipeError(err) {
@@ -994,6 +1043,9 @@ func (h *Handler) servePrefs(w http.ResponseWriter, r *http.Request) {
 		}
 	case httpm.GET, httpm.HEAD:
 		prefs = h.b.Prefs()
+		if h.RedactOtherUsers {
+			prefs = h.redactPrefs(prefs, h.localUsername())
+		}
 	default:
 		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
 		return
@@ -1451,7 +1503,13 @@ func (h *Handler) serveSetUseExitNodeEnabled(w http.ResponseWriter, r *http.Requ
 //   - PUT /profiles/: add new profile (no response). A separate
 //     StartLoginInteractive() is needed to populate and persist the new profile.
 //   - GET /profiles/current: current profile (JSON-ecoded ipn.LoginProfile)
+//   - POST /profiles/import: add and switch to a profile from a JSON-encoded
+//     ipn.ProfileExport in the request body (no response). The exported node's
+//     identity isn't carried over, so as with PUT, a StartLoginInteractive()
+//     is needed to log in to the new profile as a new node.
 //   - GET /profiles/<id>: output profile (JSON-ecoded ipn.LoginProfile)
+//   - GET /profiles/<id>/export: output profile and its prefs that aren't
+//     specific to this machine, without node keys (JSON-encoded ipn.ProfileExport)
 //   - POST /profiles/<id>: switch to profile (no response)
 //   - DELETE /profiles/<id>: delete profile (no response)
 func (h *Handler) serveProfiles(w http.ResponseWriter, r *http.Request) {
@@ -1496,6 +1554,37 @@ func (h *Handler) serveProfiles(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if suffix == "import" {
+		if r.Method != httpm.POST {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		var ex ipn.ProfileExport
+		if err := json.NewDecoder(r.Body).Decode(&ex); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.b.ImportProfile(&ex, h.Actor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if id, ok := strings.CutSuffix(suffix, "/export"); ok {
+		if r.Method != httpm.GET {
+			http.Error(w, "use GET", http.StatusMethodNotAllowed)
+			return
+		}
+		ex, err := h.b.ExportProfile(ipn.ProfileID(id))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ex)
+		return
+	}
 
 	profileID := ipn.ProfileID(suffix)
 	switch r.Method {
@@ -1625,6 +1714,34 @@ func (h *Handler) serveUpdateCheck(w http.ResponseWriter, r *http.Request) {
 
 // serveDNSOSConfig serves the current system DNS configuration as a JSON object, if
 // supported by the OS.
+// serveAuditLog serves the records of the local audit log of mutating
+// LocalAPI calls as a JSON array.
+func (h *Handler) serveAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != httpm.GET {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Require write access, as the log reveals other users' activity.
+	if !h.PermitWrite {
+		http.Error(w, "audit log access denied", http.StatusForbidden)
+		return
+	}
+	if h.AuditLog == nil {
+		http.Error(w, "no audit log", http.StatusNotFound)
+		return
+	}
+	recs, err := h.AuditLog()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if recs == nil {
+		recs = []apitype.LocalAPIAuditRecord{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recs)
+}
+
 func (h *Handler) serveDNSOSConfig(w http.ResponseWriter, r *http.Request) {
 	if !buildfeatures.HasDNS {
 		http.Error(w, feature.ErrUnavailable.Error(), http.StatusNotImplemented)
@@ -1699,7 +1816,7 @@ func (h *Handler) serveDNSQuery(w http.ResponseWriter, r *http.Request) {
 		qt = t
 	}
 
-	res, rrs, err := h.b.QueryDNS(name, qt)
+	res, rrs, trace, err := h.b.QueryDNS(name, qt)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1709,6 +1826,7 @@ func (h *Handler) serveDNSQuery(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(&apitype.DNSQueryResponse{
 		Bytes:     res,
 		Resolvers: rrs,
+		Trace:     trace,
 	})
 }
 
@@ -1759,7 +1877,16 @@ func (h *Handler) serveSuggestExitNode(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	res, err := h.b.SuggestExitNode()
+	var res apitype.ExitNodeSuggestionResponse
+	var err error
+	if defBool(r.FormValue("candidates"), false) {
+		res, err = h.b.SuggestExitNodeMatching(ipnlocal.ExitNodeSuggestionFilter{
+			Country: r.FormValue("country"),
+			Tag:     r.FormValue("tag"),
+		})
+	} else {
+		res, err = h.b.SuggestExitNode()
+	}
 	if err != nil {
 		WriteErrorJSON(w, err)
 		return
@@ -14,6 +14,7 @@
 	"path"
 
 	"tailscale.com/drive"
+	"tailscale.com/types/views"
 	"tailscale.com/util/httpm"
 )
 
@@ -130,6 +131,9 @@ func (h *Handler) serveShares(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 	case httpm.GET:
 		shares := h.b.DriveGetShares()
+		if h.RedactOtherUsers {
+			shares = views.SliceOfViews(ownDriveShares(shares, h.localUsername()))
+		}
 		err := json.NewEncoder(w).Encode(shares)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -19,12 +19,14 @@
 	"net/netip"
 	"net/url"
 	"os"
+	"reflect"
 	"slices"
 	"strconv"
 	"strings"
 	"testing"
 
 	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/envknob"
 	"tailscale.com/health"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnauth"
@@ -632,3 +634,119 @@ func TestServeDialSelf(t *testing.T) {
 		})
 	}
 }
+
+func TestServeDebugEnv(t *testing.T) {
+	const (
+		debugKnob  = "TS_DEBUG_TEST_LOCALAPI_ENV"
+		plainKnob  = "TS_TEST_LOCALAPI_ENV"
+		secretKnob = "TS_TEST_LOCALAPI_AUTHKEY"
+	)
+	t.Cleanup(func() {
+		for _, k := range []string{debugKnob, plainKnob, secretKnob} {
+			envknob.Setenv(k, "")
+			os.Unsetenv(k)
+		}
+	})
+	envknob.RegisterBool(debugKnob)
+	envknob.RegisterBool(plainKnob)
+	envknob.Setenv(secretKnob, "tskey-auth-xyz")
+	lb := newTestLocalBackend(t)
+
+	tests := []struct {
+		name        string
+		permitWrite bool
+		method      string
+		query       string
+		wantStatus  int
+		want        []apitype.DebugKnob // knobs named *_TEST_LOCALAPI_*, if status is 200
+	}{
+		{
+			name:       "denied",
+			method:     "GET",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:        "list-set",
+			permitWrite: true,
+			method:      "GET",
+			wantStatus:  http.StatusOK,
+			want: []apitype.DebugKnob{
+				{Name: secretKnob, Value: "[redacted]", Source: "env", RestartRequired: true},
+			},
+		},
+		{
+			name:        "list-all",
+			permitWrite: true,
+			method:      "GET",
+			query:       "all=true",
+			wantStatus:  http.StatusOK,
+			want: []apitype.DebugKnob{
+				{Name: debugKnob, Settable: true},
+				{Name: secretKnob, Value: "[redacted]", Source: "env", RestartRequired: true},
+				{Name: plainKnob},
+			},
+		},
+		{
+			name:        "set-debug",
+			permitWrite: true,
+			method:      "POST",
+			query:       "name=" + debugKnob + "&value=true",
+			wantStatus:  http.StatusOK,
+			want: []apitype.DebugKnob{
+				{Name: debugKnob, Value: "true", Source: "runtime", Settable: true},
+				{Name: secretKnob, Value: "[redacted]", Source: "env", RestartRequired: true},
+			},
+		},
+		{
+			name:        "set-invalid",
+			permitWrite: true,
+			method:      "POST",
+			query:       "name=" + debugKnob + "&value=maybe",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "set-non-debug",
+			permitWrite: true,
+			method:      "POST",
+			query:       "name=" + plainKnob + "&value=true",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "set-missing-name",
+			permitWrite: true,
+			method:      "POST",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "wrong-method",
+			permitWrite: true,
+			method:      "DELETE",
+			wantStatus:  http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlerForTest(t, &Handler{PermitWrite: tt.permitWrite, b: lb})
+			rec := httptest.NewRecorder()
+			h.serveDebugEnv(rec, httptest.NewRequest(tt.method, "/localapi/v0/debug-env?"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d; body: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var all, got []apitype.DebugKnob
+			if err := json.Unmarshal(rec.Body.Bytes(), &all); err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range all {
+				if strings.Contains(k.Name, "_TEST_LOCALAPI_") {
+					got = append(got, k)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got knobs %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
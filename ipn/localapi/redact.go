@@ -0,0 +1,92 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package localapi
+
+import (
+	"reflect"
+
+	"tailscale.com/drive"
+	"tailscale.com/ipn"
+	"tailscale.com/types/views"
+)
+
+// On multi-user machines, the LocalAPIRedactOtherUsers policy limits what
+// local users other than root and the operator can read of other users'
+// data. The Handler's RedactOtherUsers is set for them, and the helpers below
+// redact responses accordingly: they see only their own Taildrive shares and
+// outgoing Taildrop transfers, and none of the node's incoming Taildrop
+// files, which are for root and the operator to fetch, nor its Taildrop
+// targets (see the taildrop feature's files/ and file-targets handlers).
+//
+// Status isn't redacted: it describes the node and its tailnet, not local
+// users, and every local user may read it. Nor is anything SSH-related: the
+// LocalAPI doesn't expose Tailscale SSH sessions, only the RunSSH pref and the
+// node's public SSH host keys in status.
+
+// localUsername returns the username of the local user making the request, or
+// "" if it's unknown.
+func (h *Handler) localUsername() string {
+	if h.Actor == nil {
+		return ""
+	}
+	username, _ := h.Actor.Username()
+	return username
+}
+
+// redactPrefs returns p, without other users' data if h.RedactOtherUsers.
+// username is that of the local user making the request, per
+// [Handler.localUsername].
+func (h *Handler) redactPrefs(p ipn.PrefsView, username string) ipn.PrefsView {
+	if !h.RedactOtherUsers || !p.Valid() || p.DriveShares().Len() == 0 {
+		return p
+	}
+	p2 := p.AsStruct()
+	p2.DriveShares = ownDriveShares(p.DriveShares(), username)
+	return p2.View()
+}
+
+// ownDriveShares returns those of shares shared as username.
+func ownDriveShares(shares views.SliceView[*drive.Share, drive.ShareView], username string) []*drive.Share {
+	var own []*drive.Share
+	for _, s := range shares.All() {
+		if username != "" && s.As() == username {
+			own = append(own, s.AsStruct())
+		}
+	}
+	return own
+}
+
+// redactNotify returns n, without other users' data if h.RedactOtherUsers,
+// and whether there's anything left of it to send. username is as for
+// [Handler.redactPrefs].
+func (h *Handler) redactNotify(n *ipn.Notify, username string) (_ *ipn.Notify, ok bool) {
+	if !h.RedactOtherUsers {
+		return n, true
+	}
+	n2 := *n
+	if n.Prefs != nil {
+		p := h.redactPrefs(*n.Prefs, username)
+		n2.Prefs = &p
+	}
+	if n.DriveShares.Len() > 0 {
+		n2.DriveShares = views.SliceOfViews(ownDriveShares(n.DriveShares, username))
+	}
+	n2.FilesWaiting = nil
+	n2.IncomingFiles = nil
+	n2.OutgoingFiles = nil
+	for _, f := range n.OutgoingFiles {
+		if username != "" && f.LocalUser == username {
+			n2.OutgoingFiles = append(n2.OutgoingFiles, f)
+		}
+	}
+	if n.FilesWaiting != nil || n.IncomingFiles != nil || n.OutgoingFiles != nil {
+		// Don't send what were only Taildrop updates for others.
+		rest := n2
+		rest.Version = ""
+		if reflect.ValueOf(rest).IsZero() {
+			return nil, false
+		}
+	}
+	return &n2, true
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package localapi
+
+import (
+	"testing"
+
+	"tailscale.com/drive"
+	"tailscale.com/ipn"
+	"tailscale.com/types/empty"
+	"tailscale.com/types/views"
+)
+
+func TestRedactNotify(t *testing.T) {
+	shares := []*drive.Share{
+		{Name: "alice-docs", Path: "/home/alice/docs", As: "alice"},
+		{Name: "bob-docs", Path: "/home/bob/docs", As: "bob"},
+	}
+	prefs := (&ipn.Prefs{Hostname: "host", DriveShares: shares}).View()
+	outgoing := []*ipn.OutgoingFile{
+		{ID: "1", Name: "alice.txt", LocalUser: "alice"},
+		{ID: "2", Name: "bob.txt", LocalUser: "bob"},
+		{ID: "3", Name: "root.txt"},
+	}
+	shareNames := func(s views.SliceView[*drive.Share, drive.ShareView]) (names []string) {
+		for _, v := range s.All() {
+			names = append(names, v.Name())
+		}
+		return names
+	}
+
+	h := &Handler{RedactOtherUsers: true}
+
+	n, ok := h.redactNotify(&ipn.Notify{
+		Version:       "1",
+		Prefs:         &prefs,
+		DriveShares:   views.SliceOfViews(shares),
+		FilesWaiting:  &empty.Message{},
+		IncomingFiles: []ipn.PartialFile{{Name: "in.txt"}},
+		OutgoingFiles: outgoing,
+	}, "bob")
+	if !ok {
+		t.Fatal("notify with prefs dropped")
+	}
+	if got := shareNames(n.Prefs.DriveShares()); len(got) != 1 || got[0] != "bob-docs" {
+		t.Errorf("prefs shares = %q; want bob's", got)
+	}
+	if n.Prefs.Hostname() != "host" {
+		t.Errorf("prefs hostname = %q; want it kept", n.Prefs.Hostname())
+	}
+	if got := shareNames(n.DriveShares); len(got) != 1 || got[0] != "bob-docs" {
+		t.Errorf("shares = %q; want bob's", got)
+	}
+	if n.FilesWaiting != nil || n.IncomingFiles != nil {
+		t.Errorf("incoming files not redacted: %v, %v", n.FilesWaiting, n.IncomingFiles)
+	}
+	if len(n.OutgoingFiles) != 1 || n.OutgoingFiles[0].ID != "2" {
+		t.Errorf("outgoing files = %v; want bob's", n.OutgoingFiles)
+	}
+	if prefs.DriveShares().Len() != 2 || len(outgoing) != 3 {
+		t.Error("original notify modified")
+	}
+
+	// Notifies of only others' transfers aren't sent at all.
+	if _, ok := h.redactNotify(&ipn.Notify{Version: "1", OutgoingFiles: outgoing}, "carol"); ok {
+		t.Error("notify of others' outgoing files sent")
+	}
+	if _, ok := h.redactNotify(&ipn.Notify{Version: "1", FilesWaiting: &empty.Message{}}, "bob"); ok {
+		t.Error("files waiting notify sent")
+	}
+	if _, ok := h.redactNotify(&ipn.Notify{Version: "1", State: new(ipn.Running)}, ""); !ok {
+		t.Error("state notify dropped")
+	}
+
+	// Nothing is redacted without RedactOtherUsers.
+	h.RedactOtherUsers = false
+	all := &ipn.Notify{Version: "1", OutgoingFiles: outgoing}
+	if n, ok := h.redactNotify(all, "carol"); !ok || n != all {
+		t.Error("notify redacted without RedactOtherUsers")
+	}
+}
@@ -22,12 +22,15 @@ func init() {
 	Register("tka/cosign-recovery-aum", (*Handler).serveTKACosignRecoveryAUM)
 	Register("tka/disable", (*Handler).serveTKADisable)
 	Register("tka/force-local-disable", (*Handler).serveTKALocalDisable)
+	Register("tka/generate-pending-aum", (*Handler).serveTKAGeneratePendingAUM)
 	Register("tka/generate-recovery-aum", (*Handler).serveTKAGenerateRecoveryAUM)
 	Register("tka/init", (*Handler).serveTKAInit)
 	Register("tka/log", (*Handler).serveTKALog)
 	Register("tka/modify", (*Handler).serveTKAModify)
 	Register("tka/sign", (*Handler).serveTKASign)
+	Register("tka/sign-offline", (*Handler).serveTKASignOffline)
 	Register("tka/status", (*Handler).serveTKAStatus)
+	Register("tka/submit-pending-aum", (*Handler).serveTKASubmitPendingAUM)
 	Register("tka/submit-recovery-aum", (*Handler).serveTKASubmitRecoveryAUM)
 	Register("tka/verify-deeplink", (*Handler).serveTKAVerifySigningDeeplink)
 	Register("tka/wrap-preauth-key", (*Handler).serveTKAWrapPreauthKey)
@@ -411,3 +414,106 @@ func (h *Handler) serveTKASubmitRecoveryAUM(w http.ResponseWriter, r *http.Reque
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+func (h *Handler) serveTKAGeneratePendingAUM(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != httpm.POST {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type pendingRequest struct {
+		AddKeys    []tka.Key
+		RemoveKeys []tka.Key
+	}
+	var req pendingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.b.NetworkLockGeneratePendingAUM(req.AddKeys, req.RemoveKeys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(res.Serialize())
+}
+
+func (h *Handler) serveTKASignOffline(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != httpm.POST {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := io.LimitReader(r.Body, 1024*1024)
+	aumBytes, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "reading AUM", http.StatusBadRequest)
+		return
+	}
+	var aum tka.AUM
+	if err := aum.Unserialize(aumBytes); err != nil {
+		http.Error(w, "decoding AUM", http.StatusBadRequest)
+		return
+	}
+
+	sigs, err := h.b.NetworkLockSignOffline(&aum)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := make([][]byte, len(sigs))
+	for i := range sigs {
+		res[i] = sigs[i].Serialize()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *Handler) serveTKASubmitPendingAUM(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != httpm.POST {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type submitRequest struct {
+		AUM        tkatype.MarshaledAUM
+		Signatures [][]byte // serialized tka.DetachedSignature values
+	}
+	var req submitRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	var aum tka.AUM
+	if err := aum.Unserialize(req.AUM); err != nil {
+		http.Error(w, "decoding AUM", http.StatusBadRequest)
+		return
+	}
+	sigs := make([]tka.DetachedSignature, len(req.Signatures))
+	for i, b := range req.Signatures {
+		if err := sigs[i].Unserialize(b); err != nil {
+			http.Error(w, "decoding signature "+strconv.Itoa(i), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.b.NetworkLockSubmitPendingAUM(&aum, sigs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
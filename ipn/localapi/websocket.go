@@ -0,0 +1,208 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ios && !ts_omit_localapiwebsocket
+
+package localapi
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/coder/websocket"
+	"tailscale.com/envknob"
+	"tailscale.com/ipn"
+	"tailscale.com/util/clientmetric"
+)
+
+func init() {
+	serveWebSocket = (*Handler).serveWebSocket
+}
+
+const (
+	// webSocketSubprotocol is the WebSocket subprotocol spoken by the
+	// LocalAPI: each message from the server is a JSON-encoded ipn.Notify.
+	// Clients must offer it.
+	webSocketSubprotocol = "tailscale-localapi-v0"
+
+	// webSocketAuthSubprotocolPrefix prefixes a subprotocol that carries the
+	// LocalAPI password, base64url-encoded without padding. Browsers can't
+	// set an Authorization header on WebSocket requests, so clients offer the
+	// password this way instead; the server never selects it.
+	webSocketAuthSubprotocolPrefix = "tailscale-localapi-auth."
+)
+
+// webSocketOrigins is a comma-separated list of additional origin host
+// patterns (in the syntax of [path.Match], such as "*.example.com" or
+// "app.example.com:8443") that may open LocalAPI WebSockets. Origins on
+// loopback hosts are always permitted.
+var webSocketOrigins = envknob.RegisterString("TS_LOCALAPI_WEBSOCKET_ORIGINS")
+
+var metricWebSocketWatchers = clientmetric.NewCounter("localapi_websocket_watchers")
+
+// serveWebSocket serves r if it asks to upgrade to a WebSocket, reporting
+// whether it did. Only the IPN bus can currently be watched this way.
+//
+// Unlike other LocalAPI requests, these may come from browsers, so rather
+// than rejecting all requests with an Origin, it permits the origins allowed
+// by webSocketOriginAllowed, and it accepts the LocalAPI password in a
+// subprotocol.
+func (h *Handler) serveWebSocket(w http.ResponseWriter, r *http.Request) (handled bool) {
+	if !isWebSocketUpgrade(r) {
+		return false
+	}
+	if !h.validHost(r.Host) || !webSocketOriginAllowed(r.Header.Get("Origin")) {
+		metricInvalidRequests.Add(1)
+		http.Error(w, "invalid localapi request", http.StatusForbidden)
+		return true
+	}
+	if h.RequiredPassword != "" {
+		pass, ok := webSocketPassword(r)
+		if !ok {
+			metricInvalidRequests.Add(1)
+			http.Error(w, "auth required", http.StatusUnauthorized)
+			return true
+		}
+		if subtle.ConstantTimeCompare([]byte(pass), []byte(h.RequiredPassword)) == 0 {
+			metricInvalidRequests.Add(1)
+			http.Error(w, "bad password", http.StatusForbidden)
+			return true
+		}
+	}
+	if r.URL.Path != "/localapi/v0/watch-ipn-bus" {
+		http.NotFound(w, r)
+		return true
+	}
+	h.logRequest(r.Method, "watch-ipn-bus")
+	h.serveWatchIPNBusWebSocket(w, r)
+	return true
+}
+
+func (h *Handler) serveWatchIPNBusWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "watch ipn bus access denied", http.StatusForbidden)
+		return
+	}
+	var mask ipn.NotifyWatchOpt
+	if s := r.FormValue("mask"); s != "" {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "bad mask", http.StatusBadRequest)
+			return
+		}
+		mask = ipn.NotifyWatchOpt(v)
+	}
+
+	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		Subprotocols: []string{webSocketSubprotocol},
+		// The origin was checked by serveWebSocket, which, unlike
+		// Accept, permits loopback origins on any port.
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		// Accept has already written an error response.
+		return
+	}
+	defer c.CloseNow()
+	if c.Subprotocol() != webSocketSubprotocol {
+		c.Close(websocket.StatusPolicyViolation, "client must speak the "+webSocketSubprotocol+" subprotocol")
+		return
+	}
+	metricWebSocketWatchers.Add(1)
+
+	// Clients don't send anything; CloseRead handles their control frames
+	// and cancels ctx when they go away.
+	ctx := c.CloseRead(r.Context())
+	var username string
+	if h.RedactOtherUsers {
+		username = h.localUsername()
+	}
+	h.b.WatchNotificationsAs(ctx, h.Actor, mask, nil, func(roNotify *ipn.Notify) (keepGoing bool) {
+		roNotify, ok := h.redactNotify(roNotify, username)
+		if !ok {
+			return true
+		}
+		js, err := json.Marshal(roNotify)
+		if err != nil {
+			h.logf("json.Marshal: %v", err)
+			return false
+		}
+		return c.Write(ctx, websocket.MessageText, js) == nil
+	})
+	c.Close(websocket.StatusNormalClosure, "")
+}
+
+// webSocketPassword returns the LocalAPI password offered by r, either in a
+// subprotocol with prefix webSocketAuthSubprotocolPrefix or using HTTP basic
+// auth.
+func webSocketPassword(r *http.Request) (pass string, ok bool) {
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for p := range strings.SplitSeq(v, ",") {
+			enc, ok := strings.CutPrefix(strings.TrimSpace(p), webSocketAuthSubprotocolPrefix)
+			if !ok {
+				continue
+			}
+			b, err := base64.RawURLEncoding.DecodeString(enc)
+			if err != nil {
+				return "", false
+			}
+			return string(b), true
+		}
+	}
+	_, pass, ok = r.BasicAuth()
+	return pass, ok
+}
+
+// webSocketOriginAllowed reports whether a WebSocket request with the given
+// Origin header may be accepted. Requests without an Origin don't come from
+// browsers and are allowed.
+func webSocketOriginAllowed(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if host := u.Hostname(); host == "localhost" {
+		return true
+	} else if ip, err := netip.ParseAddr(host); err == nil && ip.IsLoopback() {
+		return true
+	}
+	for pat := range strings.SplitSeq(webSocketOrigins(), ",") {
+		pat = strings.TrimSpace(pat)
+		if pat == "" {
+			continue
+		}
+		if ok, _ := path.Match(strings.ToLower(pat), strings.ToLower(u.Host)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isWebSocketUpgrade reports whether r asks to upgrade to a WebSocket.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+// headerContainsToken reports whether any value of the comma-separated
+// header key in h contains token, case-insensitively.
+func headerContainsToken(h http.Header, key, token string) bool {
+	for _, v := range h.Values(key) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
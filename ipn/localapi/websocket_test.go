@@ -0,0 +1,59 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ios && !ts_omit_localapiwebsocket
+
+package localapi
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/envknob"
+)
+
+func TestWebSocketOriginAllowed(t *testing.T) {
+	envknob.Setenv("TS_LOCALAPI_WEBSOCKET_ORIGINS", "*.example.com, app.example.net:8443")
+	defer envknob.Setenv("TS_LOCALAPI_WEBSOCKET_ORIGINS", "")
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://localhost:3000", true},
+		{"http://127.0.0.1:8080", true},
+		{"http://[::1]:8080", true},
+		{"https://dash.example.com", true},
+		{"https://DASH.EXAMPLE.COM", true},
+		{"https://example.com", false},
+		{"https://app.example.net:8443", true},
+		{"https://app.example.net", false},
+		{"https://evil.test", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		if got := webSocketOriginAllowed(tt.origin); got != tt.want {
+			t.Errorf("webSocketOriginAllowed(%q) = %v; want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestWebSocketPassword(t *testing.T) {
+	r := httptest.NewRequest("GET", "/localapi/v0/watch-ipn-bus", nil)
+	if _, ok := webSocketPassword(r); ok {
+		t.Error("got password from request without one")
+	}
+
+	r.Header.Set("Sec-WebSocket-Protocol", webSocketSubprotocol+", "+webSocketAuthSubprotocolPrefix+base64.RawURLEncoding.EncodeToString([]byte("s3cr3t")))
+	if pass, ok := webSocketPassword(r); !ok || pass != "s3cr3t" {
+		t.Errorf("subprotocol password = %q, %v; want %q, true", pass, ok, "s3cr3t")
+	}
+
+	r.Header.Del("Sec-WebSocket-Protocol")
+	r.SetBasicAuth("", "basic")
+	if pass, ok := webSocketPassword(r); !ok || pass != "basic" {
+		t.Errorf("basic auth password = %q, %v; want %q, true", pass, ok, "basic")
+	}
+}
@@ -17,6 +17,7 @@
 	"runtime"
 	"slices"
 	"strings"
+	"time"
 
 	"tailscale.com/atomicfile"
 	"tailscale.com/drive"
@@ -207,6 +208,21 @@ type Prefs struct {
 	// control server.
 	AdvertiseServices []string
 
+	// AdvertiseConnectedSubnets specifies whether to advertise the subnets
+	// of this node's directly connected LAN interfaces, in addition to
+	// AdvertiseRoutes. The advertised subnets are updated as interfaces
+	// and their addresses change.
+	AdvertiseConnectedSubnets bool `json:",omitempty"`
+
+	// ConnectedSubnetsInclude, if non-empty, limits the subnets advertised
+	// by AdvertiseConnectedSubnets to those contained within one of these
+	// prefixes.
+	ConnectedSubnetsInclude []netip.Prefix `json:",omitempty"`
+
+	// ConnectedSubnetsExclude are prefixes whose overlapping subnets
+	// are never advertised by AdvertiseConnectedSubnets.
+	ConnectedSubnetsExclude []netip.Prefix `json:",omitempty"`
+
 	// Sync is whether this node should sync its configuration from
 	// the control plane. If unset, this defaults to true.
 	// This exists primarily for testing, to verify that netmap caching
@@ -276,6 +292,21 @@ type Prefs struct {
 	// Linux-only.
 	NetfilterKind string
 
+	// ExcludeApps are cgroup v2 paths, relative to the cgroup2 mount
+	// (e.g. "/user.slice/user-1000.slice/app-firefox.scope"), whose
+	// processes' traffic bypasses Tailscale's routes, including the exit
+	// node, as if Tailscale weren't running.
+	//
+	// Linux-only, and only applied when NetfilterMode is "on".
+	ExcludeApps []string `json:",omitempty"`
+
+	// RequireTunnelApps are cgroup v2 paths, like ExcludeApps, whose
+	// processes may only send traffic over the Tailscale interface or
+	// loopback. Their other traffic is dropped.
+	//
+	// Linux-only, and only applied when NetfilterMode is "on".
+	RequireTunnelApps []string `json:",omitempty"`
+
 	// DriveShares are the configured DriveShares, stored in increasing order
 	// by name.
 	DriveShares []*drive.Share
@@ -291,6 +322,31 @@ type Prefs struct {
 	// non-nil.
 	RelayServerStaticEndpoints []netip.AddrPort `json:",omitempty"`
 
+	// DERPHomeRegion, if non-zero, is the ID of the DERP region to use as
+	// the node's home, instead of the one with the lowest latency.
+	DERPHomeRegion int `json:",omitempty"`
+
+	// DERPDenyRegions are the IDs of DERP regions never to use, neither as
+	// home nor to reach peers, such as for data sovereignty requirements.
+	// Peers whose home is a denied region are only reachable directly or
+	// via peer relays. Denying a region overrides DERPHomeRegion.
+	DERPDenyRegions []int `json:",omitempty"`
+
+	// PeerIdle controls when the WireGuard sessions of idle peers are torn
+	// down. See PeerIdlePrefs docs for more details.
+	PeerIdle PeerIdlePrefs `json:",omitzero"`
+
+	// KeepWarmPeers are peers whose connections are kept warm, so that the
+	// first packet to them after being idle or a network change, such as
+	// waking from sleep, doesn't wait seconds for path discovery. Each is a
+	// Tailscale IP, a StableNodeID, or a MagicDNS name (either the FQDN or
+	// its first label). Entries matching no peer are ignored.
+	//
+	// The paths to these peers are kept alive while idle, rediscovered
+	// right after network changes, and remembered across restarts, and
+	// their WireGuard sessions aren't torn down per PeerIdle.
+	KeepWarmPeers []string `json:",omitempty"`
+
 	// AllowSingleHosts was a legacy field that was always true
 	// for the past 4.5 years. It controlled whether Tailscale
 	// peers got /32 or /128 routes for each other.
@@ -345,6 +401,73 @@ type AppConnectorPrefs struct {
 	Advertise bool
 }
 
+// PeerIdlePrefs are the settings for tearing down the WireGuard sessions of
+// idle peers, to bound the memory used on tailnets with many peers. A peer's
+// session is re-established on demand when there's traffic for it again.
+//
+// The zero value keeps the default behavior, in which a session is torn down
+// after several minutes without a handshake.
+type PeerIdlePrefs struct {
+	// Timeout, if non-zero, is how long a peer may go without sending or
+	// receiving traffic before its session is torn down. It must be at
+	// least MinPeerIdleTimeout.
+	Timeout time.Duration `json:",omitempty"`
+
+	// MaxActive, if non-zero, is the maximum number of peers to keep
+	// sessions with. Beyond it, the sessions of the least recently active
+	// peers are torn down. It's enforced periodically, so it may be exceeded
+	// for a few seconds at a time.
+	MaxActive int `json:",omitempty"`
+
+	// AlwaysOn are peers whose sessions are never torn down for Timeout or
+	// MaxActive. They still count towards MaxActive.
+	AlwaysOn []tailcfg.StableNodeID `json:",omitempty"`
+}
+
+// MinPeerIdleTimeout is the smallest non-zero PeerIdlePrefs.Timeout.
+const MinPeerIdleTimeout = time.Minute
+
+// Validate reports whether p is valid.
+func (p PeerIdlePrefs) Validate() error {
+	if p.Timeout < 0 || p.Timeout > 0 && p.Timeout < MinPeerIdleTimeout {
+		return fmt.Errorf("peer idle timeout %v must be zero or at least %v", p.Timeout, MinPeerIdleTimeout)
+	}
+	if p.MaxActive < 0 {
+		return fmt.Errorf("max active peers %d must not be negative", p.MaxActive)
+	}
+	return nil
+}
+
+// IsZero reports whether p is the zero value.
+func (p PeerIdlePrefs) IsZero() bool {
+	return p.Timeout == 0 && p.MaxActive == 0 && len(p.AlwaysOn) == 0
+}
+
+// Equals reports whether p and p2 are equal.
+func (p PeerIdlePrefs) Equals(p2 PeerIdlePrefs) bool {
+	return p.Timeout == p2.Timeout &&
+		p.MaxActive == p2.MaxActive &&
+		slices.Equal(p.AlwaysOn, p2.AlwaysOn)
+}
+
+// Pretty returns a short, human-readable form of p for Prefs.Pretty.
+func (p PeerIdlePrefs) Pretty() string {
+	if p.IsZero() {
+		return ""
+	}
+	var sb strings.Builder
+	if p.Timeout != 0 {
+		fmt.Fprintf(&sb, "peerIdle=%v ", p.Timeout)
+	}
+	if p.MaxActive != 0 {
+		fmt.Fprintf(&sb, "maxActivePeers=%d ", p.MaxActive)
+	}
+	if len(p.AlwaysOn) > 0 {
+		fmt.Fprintf(&sb, "alwaysOnPeers=%v ", p.AlwaysOn)
+	}
+	return sb.String()
+}
+
 // MaskedPrefs is a Prefs with an associated bitmask of which fields are set.
 //
 // Each FooSet field maps to a corresponding Foo field in Prefs. FooSet can be
@@ -373,6 +496,9 @@ type MaskedPrefs struct {
 	EggSet                        bool                `json:",omitempty"`
 	AdvertiseRoutesSet            bool                `json:",omitempty"`
 	AdvertiseServicesSet          bool                `json:",omitempty"`
+	AdvertiseConnectedSubnetsSet  bool                `json:",omitempty"`
+	ConnectedSubnetsIncludeSet    bool                `json:",omitempty"`
+	ConnectedSubnetsExcludeSet    bool                `json:",omitempty"`
 	SyncSet                       bool                `json:",omitzero"`
 	NoSNATSet                     bool                `json:",omitempty"`
 	NoStatefulFilteringSet        bool                `json:",omitempty"`
@@ -383,9 +509,15 @@ type MaskedPrefs struct {
 	AppConnectorSet               bool                `json:",omitempty"`
 	PostureCheckingSet            bool                `json:",omitempty"`
 	NetfilterKindSet              bool                `json:",omitempty"`
+	ExcludeAppsSet                bool                `json:",omitempty"`
+	RequireTunnelAppsSet          bool                `json:",omitempty"`
 	DriveSharesSet                bool                `json:",omitempty"`
 	RelayServerPortSet            bool                `json:",omitempty"`
 	RelayServerStaticEndpointsSet bool                `json:",omitzero"`
+	DERPHomeRegionSet             bool                `json:",omitempty"`
+	DERPDenyRegionsSet            bool                `json:",omitempty"`
+	PeerIdleSet                   bool                `json:",omitempty"`
+	KeepWarmPeersSet              bool                `json:",omitempty"`
 }
 
 // SetsInternal reports whether mp has any of the Internal*Set field bools set
@@ -593,6 +725,15 @@ func (p *Prefs) pretty(goos string) string {
 			bb, _ := p.NoStatefulFiltering.Get()
 			fmt.Fprintf(&sb, "statefulFiltering=%v ", !bb)
 		}
+		if p.AdvertiseConnectedSubnets {
+			sb.WriteString("connectedSubnets=on ")
+			if len(p.ConnectedSubnetsInclude) > 0 {
+				fmt.Fprintf(&sb, "include=%v ", p.ConnectedSubnetsInclude)
+			}
+			if len(p.ConnectedSubnetsExclude) > 0 {
+				fmt.Fprintf(&sb, "exclude=%v ", p.ConnectedSubnetsExclude)
+			}
+		}
 	}
 	if len(p.AdvertiseTags) > 0 {
 		fmt.Fprintf(&sb, "tags=%s ", strings.Join(p.AdvertiseTags, ","))
@@ -603,6 +744,12 @@ func (p *Prefs) pretty(goos string) string {
 	if goos == "linux" {
 		fmt.Fprintf(&sb, "nf=%v ", p.NetfilterMode)
 	}
+	if len(p.ExcludeApps) > 0 {
+		fmt.Fprintf(&sb, "excludeApps=%s ", strings.Join(p.ExcludeApps, ","))
+	}
+	if len(p.RequireTunnelApps) > 0 {
+		fmt.Fprintf(&sb, "requireTunnelApps=%s ", strings.Join(p.RequireTunnelApps, ","))
+	}
 	if p.ControlURL != "" && p.ControlURL != DefaultControlURL {
 		fmt.Fprintf(&sb, "url=%q ", p.ControlURL)
 	}
@@ -627,6 +774,16 @@ func (p *Prefs) pretty(goos string) string {
 	if buildfeatures.HasRelayServer && len(p.RelayServerStaticEndpoints) > 0 {
 		fmt.Fprintf(&sb, "relayServerStaticEndpoints=%v ", p.RelayServerStaticEndpoints)
 	}
+	if p.DERPHomeRegion != 0 {
+		fmt.Fprintf(&sb, "derpHome=%d ", p.DERPHomeRegion)
+	}
+	if len(p.DERPDenyRegions) > 0 {
+		fmt.Fprintf(&sb, "derpDeny=%v ", p.DERPDenyRegions)
+	}
+	sb.WriteString(p.PeerIdle.Pretty())
+	if len(p.KeepWarmPeers) > 0 {
+		fmt.Fprintf(&sb, "keepWarm=%v ", p.KeepWarmPeers)
+	}
 	if p.Persist != nil {
 		sb.WriteString(p.Persist.Pretty())
 	} else {
@@ -684,6 +841,9 @@ func (p *Prefs) Equals(p2 *Prefs) bool {
 		slices.Equal(p.AdvertiseRoutes, p2.AdvertiseRoutes) &&
 		slices.Equal(p.AdvertiseTags, p2.AdvertiseTags) &&
 		slices.Equal(p.AdvertiseServices, p2.AdvertiseServices) &&
+		p.AdvertiseConnectedSubnets == p2.AdvertiseConnectedSubnets &&
+		slices.Equal(p.ConnectedSubnetsInclude, p2.ConnectedSubnetsInclude) &&
+		slices.Equal(p.ConnectedSubnetsExclude, p2.ConnectedSubnetsExclude) &&
 		p.Persist.Equals(p2.Persist) &&
 		p.ProfileName == p2.ProfileName &&
 		p.AutoUpdate.Equals(p2.AutoUpdate) &&
@@ -691,8 +851,14 @@ func (p *Prefs) Equals(p2 *Prefs) bool {
 		p.PostureChecking == p2.PostureChecking &&
 		slices.EqualFunc(p.DriveShares, p2.DriveShares, drive.SharesEqual) &&
 		p.NetfilterKind == p2.NetfilterKind &&
+		slices.Equal(p.ExcludeApps, p2.ExcludeApps) &&
+		slices.Equal(p.RequireTunnelApps, p2.RequireTunnelApps) &&
 		compareUint16Ptrs(p.RelayServerPort, p2.RelayServerPort) &&
-		slices.Equal(p.RelayServerStaticEndpoints, p2.RelayServerStaticEndpoints)
+		slices.Equal(p.RelayServerStaticEndpoints, p2.RelayServerStaticEndpoints) &&
+		p.DERPHomeRegion == p2.DERPHomeRegion &&
+		slices.Equal(p.DERPDenyRegions, p2.DERPDenyRegions) &&
+		p.PeerIdle.Equals(p2.PeerIdle) &&
+		slices.Equal(p.KeepWarmPeers, p2.KeepWarmPeers)
 }
 
 func (au AutoUpdatePrefs) Pretty() string {
@@ -1122,6 +1288,33 @@ func (p *LoginProfile) Equals(p2 *LoginProfile) bool {
 		p.ControlURL == p2.ControlURL
 }
 
+// ProfileExportVersion is the current version of [ProfileExport].
+const ProfileExportVersion = 1
+
+// ProfileExport is a profile and its preferences in a form that can be moved
+// to another machine, as produced by "tailscale switch export" and consumed by
+// "tailscale switch import".
+//
+// It deliberately omits the node's identity and keys: an imported profile
+// starts out logged out and must be authenticated again, becoming a new node
+// in the tailnet. Prefs that only make sense on the exporting machine, such
+// as OperatorUser, Hostname, AdvertiseRoutes and ExitNodeID, are omitted too.
+type ProfileExport struct {
+	// Version is the version of the export format.
+	// It's currently always [ProfileExportVersion].
+	Version int
+
+	// Name, NetworkProfile and ControlURL describe the exported profile,
+	// as in [LoginProfile]. They're informational only.
+	Name           string
+	NetworkProfile NetworkProfile
+	ControlURL     string
+
+	// Prefs are the profile's preferences that aren't specific to the
+	// exporting machine. Other fields are zero and ignored on import.
+	Prefs *Prefs
+}
+
 // ExitNodeExpression is a string that specifies how an exit node
 // should be selected. An empty string means that no exit node
 // should be selected.
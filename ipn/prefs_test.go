@@ -57,6 +57,9 @@ func TestPrefsEqual(t *testing.T) {
 		"Egg",
 		"AdvertiseRoutes",
 		"AdvertiseServices",
+		"AdvertiseConnectedSubnets",
+		"ConnectedSubnetsInclude",
+		"ConnectedSubnetsExclude",
 		"Sync",
 		"NoSNAT",
 		"NoStatefulFiltering",
@@ -67,9 +70,15 @@ func TestPrefsEqual(t *testing.T) {
 		"AppConnector",
 		"PostureChecking",
 		"NetfilterKind",
+		"ExcludeApps",
+		"RequireTunnelApps",
 		"DriveShares",
 		"RelayServerPort",
 		"RelayServerStaticEndpoints",
+		"DERPHomeRegion",
+		"DERPDenyRegions",
+		"PeerIdle",
+		"KeepWarmPeers",
 		"AllowSingleHosts",
 		"Persist",
 	}
@@ -360,6 +369,16 @@ func TestPrefsEqual(t *testing.T) {
 			&Prefs{NetfilterKind: ""},
 			false,
 		},
+		{
+			&Prefs{ExcludeApps: []string{"/user.slice/app-firefox.scope"}},
+			&Prefs{ExcludeApps: []string{"/user.slice/app-firefox.scope"}},
+			true,
+		},
+		{
+			&Prefs{ExcludeApps: []string{"/user.slice/app-firefox.scope"}},
+			&Prefs{RequireTunnelApps: []string{"/user.slice/app-firefox.scope"}},
+			false,
+		},
 		{
 			&Prefs{AdvertiseServices: []string{"svc:tux", "svc:xenia"}},
 			&Prefs{AdvertiseServices: []string{"svc:tux", "svc:xenia"}},
@@ -370,6 +389,21 @@ func TestPrefsEqual(t *testing.T) {
 			&Prefs{AdvertiseServices: []string{"svc:tux", "svc:amelie"}},
 			false,
 		},
+		{
+			&Prefs{AdvertiseConnectedSubnets: true},
+			&Prefs{AdvertiseConnectedSubnets: false},
+			false,
+		},
+		{
+			&Prefs{ConnectedSubnetsInclude: nets("192.168.0.0/16")},
+			&Prefs{ConnectedSubnetsInclude: nets("192.168.0.0/16")},
+			true,
+		},
+		{
+			&Prefs{ConnectedSubnetsExclude: nets("10.0.0.0/8")},
+			&Prefs{ConnectedSubnetsExclude: nets("10.1.0.0/16")},
+			false,
+		},
 		{
 			&Prefs{RelayServerPort: relayServerPort(0)},
 			&Prefs{RelayServerPort: nil},
@@ -390,6 +424,46 @@ func TestPrefsEqual(t *testing.T) {
 			&Prefs{RelayServerStaticEndpoints: aps("[2001:db8::1]:40000", "192.0.2.1:40000")},
 			false,
 		},
+		{
+			&Prefs{DERPHomeRegion: 1},
+			&Prefs{DERPHomeRegion: 2},
+			false,
+		},
+		{
+			&Prefs{DERPDenyRegions: []int{1, 2}},
+			&Prefs{DERPDenyRegions: []int{1, 2}},
+			true,
+		},
+		{
+			&Prefs{DERPDenyRegions: []int{1, 2}},
+			&Prefs{DERPDenyRegions: []int{1}},
+			false,
+		},
+		{
+			&Prefs{PeerIdle: PeerIdlePrefs{Timeout: time.Minute, AlwaysOn: []tailcfg.StableNodeID{"n1"}}},
+			&Prefs{PeerIdle: PeerIdlePrefs{Timeout: time.Minute, AlwaysOn: []tailcfg.StableNodeID{"n1"}}},
+			true,
+		},
+		{
+			&Prefs{PeerIdle: PeerIdlePrefs{Timeout: time.Minute, AlwaysOn: []tailcfg.StableNodeID{"n1"}}},
+			&Prefs{PeerIdle: PeerIdlePrefs{Timeout: time.Minute}},
+			false,
+		},
+		{
+			&Prefs{PeerIdle: PeerIdlePrefs{MaxActive: 100}},
+			&Prefs{PeerIdle: PeerIdlePrefs{MaxActive: 200}},
+			false,
+		},
+		{
+			&Prefs{KeepWarmPeers: []string{"db", "100.64.0.1"}},
+			&Prefs{KeepWarmPeers: []string{"db", "100.64.0.1"}},
+			true,
+		},
+		{
+			&Prefs{KeepWarmPeers: []string{"db"}},
+			&Prefs{KeepWarmPeers: []string{"db", "100.64.0.1"}},
+			false,
+		},
 	}
 	for i, tt := range tests {
 		got := tt.a.Equals(tt.b)
@@ -598,6 +672,14 @@ func TestPrefsPretty(t *testing.T) {
 			"linux",
 			`Prefs{ra=false dns=false want=false routes=[] nf=off host="foo" update=off Persist=nil}`,
 		},
+		{
+			Prefs{
+				AdvertiseConnectedSubnets: true,
+				ConnectedSubnetsExclude:   []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+			},
+			"linux",
+			`Prefs{ra=false dns=false want=false routes=[] connectedSubnets=on exclude=[10.0.0.0/8] nf=off update=off Persist=nil}`,
+		},
 		{
 			Prefs{
 				AutoUpdate: AutoUpdatePrefs{
@@ -643,6 +725,22 @@ func TestPrefsPretty(t *testing.T) {
 			"linux",
 			`Prefs{ra=false dns=false want=false routes=[] nf=off netfilterKind=iptables update=off Persist=nil}`,
 		},
+		{
+			Prefs{
+				ExcludeApps:       []string{"/a.scope", "/b.scope"},
+				RequireTunnelApps: []string{"/c.scope"},
+			},
+			"linux",
+			`Prefs{ra=false dns=false want=false routes=[] nf=off excludeApps=/a.scope,/b.scope requireTunnelApps=/c.scope update=off Persist=nil}`,
+		},
+		{
+			Prefs{
+				DERPHomeRegion:  1,
+				DERPDenyRegions: []int{2, 3},
+			},
+			"linux",
+			`Prefs{ra=false dns=false want=false routes=[] nf=off update=off derpHome=1 derpDeny=[2 3] Persist=nil}`,
+		},
 		{
 			Prefs{
 				NetfilterKind: "",
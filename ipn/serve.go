@@ -17,6 +17,7 @@
 
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
 	"tailscale.com/types/ipproto"
 	"tailscale.com/util/dnsname"
 	"tailscale.com/util/mak"
@@ -65,6 +66,11 @@ type ServeConfig struct {
 	// traffic is allowed, from trusted ingress peers.
 	AllowFunnel map[HostPort]bool `json:",omitempty"`
 
+	// FunnelSchedules maps from SNI:port values to the schedules of when
+	// funnel traffic is allowed for them. LocalBackend adds and removes
+	// their AllowFunnel entries as their windows start and end.
+	FunnelSchedules map[HostPort]*FunnelSchedule `json:",omitempty"`
+
 	// Foreground is a map of an IPN Bus session ID to an alternate foreground serve config that's valid for the
 	// life of that WatchIPNBus session ID. This allows the config to specify ephemeral configs that are used
 	// in the CLI's foreground mode to ensure ungraceful shutdowns of either the client or the LocalBackend does not
@@ -152,10 +158,19 @@ type TCPPortHandler struct {
 	// (the HTTPS mode uses ServeConfig.Web)
 	TerminateTLS string `json:",omitempty"`
 
+	// SNI, if non-empty, maps TLS server names to the IP:port to forward
+	// TLS connections with that server name (as sent in the ClientHello) to.
+	// TLS is not terminated: the backend receives the connection unmodified,
+	// starting with the ClientHello. The name "*" matches connections whose
+	// server name matches no other entry, or which send none.
+	//
+	// It is mutually exclusive with HTTPS, HTTP and TCPForward.
+	SNI map[string]string `json:",omitempty"`
+
 	// ProxyProtocol indicates whether to send a PROXY protocol header
-	// before forwarding the connection to TCPForward.
+	// before forwarding the connection to TCPForward or an SNI backend.
 	//
-	// This is only valid if TCPForward is non-empty.
+	// This is only valid if TCPForward or SNI is non-empty.
 	ProxyProtocol int `json:",omitzero"`
 }
 
@@ -179,10 +194,37 @@ type HTTPHandler struct {
 	//   - ${REQUEST_URI}: replaced with the request's full URI (path and query string)
 	Redirect string `json:",omitempty"`
 
+	// Timeouts, if non-nil, are the timeouts of requests proxied to Proxy.
+	// It's only used with Proxy.
+	Timeouts *HTTPTimeouts `json:",omitempty"`
+
 	// TODO(bradfitz): bool to not enumerate directories? TTL on mapping for
 	// temporary ones? Error codes?
 }
 
+// HTTPTimeouts are the timeouts of requests to an HTTPHandler that proxies
+// them to a backend. A zero timeout means none.
+//
+// Responses that stream, which are Server-Sent Events, WebSockets and other
+// upgraded connections, and responses of unknown length, aren't subject to
+// Read, and Write only limits each write to the client rather than the
+// whole response, so that long-lived streams aren't cut off but slow clients
+// can't hold them open.
+type HTTPTimeouts struct {
+	// Read is how long a client may take to send a request, including its
+	// body.
+	Read tstime.GoDuration `json:",omitzero"`
+
+	// Write is how long a response may take to be written to the client,
+	// or, for streaming responses, how long each write may take.
+	Write tstime.GoDuration `json:",omitzero"`
+
+	// Idle is how long a streaming response may go without data flowing in
+	// either direction before it's closed. WebSocket pings and pongs count
+	// as data, as do Server-Sent Events comments.
+	Idle tstime.GoDuration `json:",omitzero"`
+}
+
 // WebHandlerExists reports whether if the ServeConfig Web handler exists for
 // the given host:port and mount point.
 func (sc *ServeConfig) WebHandlerExists(svcName tailcfg.ServiceName, hp HostPort, mount string) bool {
@@ -271,7 +313,7 @@ func (sc *ServeConfig) IsTCPForwardingAny() bool {
 		return false
 	}
 	for _, h := range sc.TCP {
-		if h.TCPForward != "" {
+		if h.TCPForward != "" || len(h.SNI) > 0 {
 			return true
 		}
 	}
@@ -466,6 +508,30 @@ func (sc *ServeConfig) SetTCPForwardingForService(port uint16, fwdAddr string, t
 	}
 }
 
+// SetSNIForwarding sets the fwdAddr (IP:port form) to which to forward TLS
+// connections for the server name sni on the given port, without terminating
+// TLS, for local serve (svcName empty) or the named service. Other server
+// names already forwarded on the port are kept; any other kind of handler
+// for the port is replaced.
+func (sc *ServeConfig) SetSNIForwarding(port uint16, sni, fwdAddr string, proxyProtocol int, svcName tailcfg.ServiceName) {
+	tcp := &sc.TCP
+	if svcName != "" {
+		svcConfig, ok := sc.Services[svcName]
+		if !ok {
+			svcConfig = new(ServiceConfig)
+			mak.Set(&sc.Services, svcName, svcConfig)
+		}
+		tcp = &svcConfig.TCP
+	}
+	h := (*tcp)[port]
+	if h == nil || len(h.SNI) == 0 {
+		h = new(TCPPortHandler)
+		mak.Set(tcp, port, h)
+	}
+	mak.Set(&h.SNI, sni, fwdAddr)
+	h.ProxyProtocol = proxyProtocol // can be 0
+}
+
 // SetFunnel sets the sc.AllowFunnel value for the given host and port.
 func (sc *ServeConfig) SetFunnel(host string, port uint16, setOn bool) {
 	if sc == nil {
@@ -542,6 +608,20 @@ func (sc *ServeConfig) RemoveServiceWebHandler(svcName tailcfg.ServiceName, host
 	}
 }
 
+// RemoveSNIForwarding stops forwarding TLS connections for the server name
+// sni on the given port, for local serve (svcName empty) or the named
+// service. The port's configuration is deleted once no server names remain.
+func (sc *ServeConfig) RemoveSNIForwarding(svcName tailcfg.ServiceName, port uint16, sni string) {
+	h := sc.GetTCPPortHandler(port, svcName)
+	if h == nil {
+		return
+	}
+	delete(h.SNI, sni)
+	if len(h.SNI) == 0 {
+		sc.RemoveTCPForwarding(svcName, port)
+	}
+}
+
 // RemoveTCPForwarding deletes the TCP forwarding configuration for the given
 // port from the serve config.
 func (sc *ServeConfig) RemoveTCPForwarding(svcName tailcfg.ServiceName, port uint16) {
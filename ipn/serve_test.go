@@ -4,6 +4,8 @@
 package ipn
 
 import (
+	"maps"
+	"reflect"
 	"testing"
 
 	"tailscale.com/ipn/ipnstate"
@@ -417,3 +419,35 @@ func TestIsFunnelOn(t *testing.T) {
 		})
 	}
 }
+
+func TestSNIForwarding(t *testing.T) {
+	for _, svcName := range []tailcfg.ServiceName{"", "svc:foo"} {
+		sc := new(ServeConfig)
+		sc.SetSNIForwarding(443, "a.example.com", "127.0.0.1:8443", 0, svcName)
+		sc.SetSNIForwarding(443, "*", "127.0.0.1:9443", 2, svcName)
+
+		h := sc.GetTCPPortHandler(443, svcName)
+		if h == nil {
+			t.Fatalf("%q: no handler for port 443", svcName)
+		}
+		want := map[string]string{"a.example.com": "127.0.0.1:8443", "*": "127.0.0.1:9443"}
+		if !maps.Equal(h.SNI, want) || h.ProxyProtocol != 2 {
+			t.Errorf("%q: got handler %+v; want SNI %v with PROXY protocol v2", svcName, h, want)
+		}
+		if !sc.IsTCPForwardingOnPort(443, svcName) {
+			t.Errorf("%q: IsTCPForwardingOnPort = false; want true", svcName)
+		}
+		if svcName == "" && !sc.IsTCPForwardingAny() {
+			t.Errorf("IsTCPForwardingAny = false; want true")
+		}
+
+		sc.RemoveSNIForwarding(svcName, 443, "a.example.com")
+		if h := sc.GetTCPPortHandler(443, svcName); h == nil || len(h.SNI) != 1 {
+			t.Errorf("%q: after removing one name, got handler %+v; want one name left", svcName, h)
+		}
+		sc.RemoveSNIForwarding(svcName, 443, "*")
+		if !reflect.DeepEqual(sc, new(ServeConfig)) {
+			t.Errorf("%q: after removing all names, got %+v; want empty config", svcName, sc)
+		}
+	}
+}
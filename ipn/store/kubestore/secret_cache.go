@@ -0,0 +1,201 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package kubestore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"tailscale.com/kube/kubeapi"
+	"tailscale.com/kube/kubeclient"
+	"tailscale.com/util/backoff"
+)
+
+// secretCache is an informer-style cache of Secrets, kept up to date by
+// watching them, so that the store doesn't need to GET a Secret from the API
+// server before each write to it or each TLS cert lookup. With hundreds of
+// proxies in a cluster, those GETs add up to a significant load on the API
+// server.
+//
+// The zero value is an empty cache that's never live.
+type secretCache struct {
+	mu      sync.Mutex
+	live    bool                       // secrets were listed and are being watched
+	secrets map[string]*kubeapi.Secret // by name
+	rv      string                     // resourceVersion to watch from
+}
+
+// secretLister lists the Secrets for a secretCache, returning them by name
+// along with the resourceVersion to start watching them from.
+type secretLister func(context.Context) (map[string]*kubeapi.Secret, string, error)
+
+// get returns a copy of the cached Secret with the given name, or nil if
+// there's no such Secret, and whether the cache is live. If it's not, the
+// Secret needs to be read from the API server instead.
+func (c *secretCache) get(name string) (_ *kubeapi.Secret, live bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.live {
+		return nil, false
+	}
+	s, ok := c.secrets[name]
+	if !ok {
+		return nil, true
+	}
+	s2 := *s
+	s2.Data = maps.Clone(s.Data)
+	return &s2, true
+}
+
+func (c *secretCache) setLive(live bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live = live
+}
+
+// start fills the cache with the Secrets returned by list and starts
+// watching the Secret name, or the Secrets matching sel if name is empty,
+// for changes to them.
+func (c *secretCache) start(ctx context.Context, kc kubeclient.Client, name string, sel map[string]string, list secretLister) (kubeclient.SecretWatch, error) {
+	secrets, rv, err := list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.secrets, c.rv = secrets, rv
+	c.mu.Unlock()
+	return c.watch(ctx, kc, name, sel)
+}
+
+// watch starts watching the Secret name, or the Secrets matching sel if name
+// is empty, for changes since the cache was last updated, and marks the
+// cache live.
+func (c *secretCache) watch(ctx context.Context, kc kubeclient.Client, name string, sel map[string]string) (kubeclient.SecretWatch, error) {
+	c.mu.Lock()
+	rv := c.rv
+	c.mu.Unlock()
+	w, err := kc.WatchSecrets(ctx, name, sel, rv)
+	if err != nil {
+		return nil, err
+	}
+	c.setLive(true)
+	return w, nil
+}
+
+// follow applies the changes seen by w to the cache until w ends, and
+// returns why it ended.
+func (c *secretCache) follow(w kubeclient.SecretWatch) error {
+	for {
+		ev, err := w.Next()
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		if rv := ev.Secret.ResourceVersion; rv != "" {
+			c.rv = rv
+		}
+		switch ev.Type {
+		case "ADDED", "MODIFIED":
+			if c.secrets == nil {
+				c.secrets = make(map[string]*kubeapi.Secret)
+			}
+			c.secrets[ev.Secret.Name] = ev.Secret
+		case "DELETED":
+			delete(c.secrets, ev.Secret.Name)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// startCache fills c with the Secrets returned by list and keeps it up to
+// date until ctx is done, by watching the Secret name, or the Secrets
+// matching sel if name is empty. The first list and watch happen before it
+// returns, so that the cache is ready for use by then. If they fail, such as
+// because this Pod isn't allowed to watch the Secrets, c is left not live,
+// and the store keeps reading Secrets from the API server.
+func (s *Store) startCache(ctx context.Context, c *secretCache, name string, sel map[string]string, list secretLister) {
+	w, err := c.start(ctx, s.client, name, sel, list)
+	if err != nil {
+		s.logf("kubestore: not caching Secrets: %v", err)
+		return
+	}
+	go s.runCache(ctx, c, w, name, sel, list)
+}
+
+// runCache keeps c up to date with the changes seen by w, restarting the
+// watch, and relisting the Secrets if needed, whenever it ends.
+func (s *Store) runCache(ctx context.Context, c *secretCache, w kubeclient.SecretWatch, name string, sel map[string]string, list secretLister) {
+	bo := backoff.NewBackoff("kubestore", s.logf, 30*time.Second)
+	for {
+		err := c.follow(w)
+		w.Close()
+		if errors.Is(err, io.EOF) {
+			// The API server ends watches every few minutes; pick up
+			// where this one left off.
+			w, err = c.watch(ctx, s.client, name, sel)
+		}
+		for err != nil {
+			c.setLive(false)
+			if ctx.Err() != nil {
+				return
+			}
+			if isForbidden(err) {
+				s.logf("kubestore: stopped caching Secrets, as they can't be watched: %v", err)
+				return
+			}
+			bo.BackOff(ctx, err)
+			w, err = c.start(ctx, s.client, name, sel, list)
+		}
+		bo.Reset()
+	}
+}
+
+// listStateSecret is the secretLister of the cache of the state Secret.
+func (s *Store) listStateSecret(ctx context.Context) (map[string]*kubeapi.Secret, string, error) {
+	secret, err := s.client.GetSecret(ctx, s.secretName)
+	if kubeclient.IsNotFoundErr(err) {
+		// Watching from no resourceVersion reports the Secret if it's
+		// created before the watch starts.
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return map[string]*kubeapi.Secret{s.secretName: secret}, secret.ResourceVersion, nil
+}
+
+// certSecretLister returns the secretLister of the cache of the TLS cert
+// Secrets matching sel.
+func (s *Store) certSecretLister(sel map[string]string) secretLister {
+	return func(ctx context.Context) (map[string]*kubeapi.Secret, string, error) {
+		sl, err := s.client.ListSecrets(ctx, sel)
+		if err != nil || sl == nil {
+			return nil, "", err
+		}
+		secrets := make(map[string]*kubeapi.Secret, len(sl.Items))
+		for i := range sl.Items {
+			secrets[sl.Items[i].Name] = &sl.Items[i]
+		}
+		return secrets, sl.ResourceVersion, nil
+	}
+}
+
+// statusCode returns the HTTP status code of the API server error in err's
+// chain, or 0 if there's none.
+func statusCode(err error) int {
+	var st *kubeapi.Status
+	if errors.As(err, &st) {
+		return st.Code
+	}
+	return 0
+}
+
+func isForbidden(err error) bool {
+	return statusCode(err) == http.StatusForbidden
+}
@@ -47,6 +47,10 @@ func init() {
 
 	keyTLSCert = "tls.crt"
 	keyTLSKey  = "tls.key"
+
+	// maxUpdateAttempts is how many times a Secret update is attempted when
+	// it's rejected for being based on an outdated version of the Secret.
+	maxUpdateAttempts = 3
 )
 
 // Store is an ipn.StateStore that uses a Kubernetes Secret for persistence.
@@ -62,17 +66,32 @@ type Store struct {
 	// memory holds the latest tailscale state. Writes write state to a kube
 	// Secret and memory, Reads read from memory.
 	memory mem.Store
+
+	// stateCache and certCache cache the state Secret and, in cert share
+	// mode, the TLS cert Secrets, if this Pod is allowed to watch them.
+	stateCache secretCache
+	certCache  secretCache
 }
 
 // New returns a new Store that persists state to Kubernets Secret(s).
-// Tailscale state is stored in a Secret named by the secretName parameter.
-// TLS certs are stored and retrieved from state Secret or separate Secrets
-// named after TLS endpoints if running in cert share mode.
+// Tailscale state is stored in a Secret named by the secretName parameter,
+// which may be of the form "namespace/name" to use a Secret in a namespace
+// other than the Pod's. TLS certs are stored and retrieved from state Secret
+// or separate Secrets named after TLS endpoints if running in cert share
+// mode.
 func New(logf logger.Logf, secretName string) (*Store, error) {
+	ns, name, hasNS := strings.Cut(secretName, "/")
+	if hasNS && (ns == "" || name == "") {
+		return nil, fmt.Errorf("invalid state Secret %q; want name or namespace/name", secretName)
+	}
 	c, err := newClient()
 	if err != nil {
 		return nil, err
 	}
+	if hasNS {
+		c.SetSecretNamespace(ns)
+		secretName = name
+	}
 	return newWithClient(logf, c, secretName)
 }
 
@@ -126,6 +145,11 @@ func newWithClient(logf logger.Logf, c kubeclient.Client, secretName string) (*S
 	if s.certShareMode == "ro" {
 		go s.runCertReload(context.Background())
 	}
+
+	s.startCache(context.Background(), &s.stateCache, s.secretName, nil, s.listStateSecret)
+	if sel := s.certSecretSelector(); s.certShareMode != "" && len(sel) > 0 {
+		s.startCache(context.Background(), &s.certCache, "", sel, s.certSecretLister(sel))
+	}
 	return s, nil
 }
 
@@ -209,6 +233,12 @@ func (s *Store) ReadTLSCertAndKey(domain string) (cert, key []byte, err error) {
 	if s.certShareMode == "" {
 		return nil, nil, ipn.ErrStateNotExist
 	}
+	if secret, live := s.certCache.get(domain); live {
+		if secret == nil || !hasTLSData(secret) {
+			return nil, nil, ipn.ErrStateNotExist
+		}
+		return secret.Data[keyTLSCert], secret.Data[keyTLSKey], nil
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -274,11 +304,40 @@ func (s *Store) updateSecret(data map[string][]byte, secretName string) (err err
 		}
 		cancel()
 	}()
-	secret, err := s.client.GetSecret(ctx, secretName)
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = s.tryUpdateSecret(ctx, data, secretName, attempt == 1)
+		if !retry || attempt == maxUpdateAttempts {
+			return err
+		}
+	}
+}
+
+// tryUpdateSecret makes one attempt at writing data to the Secret secretName,
+// based on its cached version if useCache is set and it's cached. It reports
+// whether a failed attempt should be retried without the cache, as it was
+// based on an outdated version of the Secret.
+func (s *Store) tryUpdateSecret(ctx context.Context, data map[string][]byte, secretName string, useCache bool) (retry bool, err error) {
+	var cached bool
+	defer func() {
+		switch statusCode(err) {
+		case http.StatusConflict:
+			retry = true
+		case http.StatusNotFound, http.StatusUnprocessableEntity:
+			retry = cached
+		}
+	}()
+	secret, live := s.cacheFor(secretName).get(secretName)
+	cached = useCache && live
+	if !cached {
+		secret, err = s.client.GetSecret(ctx, secretName)
+	} else if secret == nil {
+		err = &kubeapi.Status{Code: http.StatusNotFound, Reason: "NotFound"}
+	}
 	if err != nil {
 		// If the Secret does not exist, create it with the required data.
 		if kubeclient.IsNotFoundErr(err) && s.canCreateSecret(secretName) {
-			return s.client.CreateSecret(ctx, &kubeapi.Secret{
+			return false, s.client.CreateSecret(ctx, &kubeapi.Secret{
 				TypeMeta: kubeapi.TypeMeta{
 					APIVersion: "v1",
 					Kind:       "Secret",
@@ -295,7 +354,7 @@ func (s *Store) updateSecret(data map[string][]byte, secretName string) (err err
 				}(data),
 			})
 		}
-		return fmt.Errorf("error getting Secret %s: %w", secretName, err)
+		return false, fmt.Errorf("error getting Secret %s: %w", secretName, err)
 	}
 	if s.canPatchSecret(secretName) {
 		var m []kubeclient.JSONPatch
@@ -325,18 +384,28 @@ func (s *Store) updateSecret(data map[string][]byte, secretName string) (err err
 			}
 		}
 		if err := s.client.JSONPatchResource(ctx, secretName, kubeclient.TypeSecrets, m); err != nil {
-			return fmt.Errorf("error patching Secret %s: %w", secretName, err)
+			return false, fmt.Errorf("error patching Secret %s: %w", secretName, err)
 		}
-		return nil
+		return false, nil
 	}
-	// No patch permissions, use UPDATE instead.
+	// No patch permissions, use UPDATE instead. The update carries the
+	// resourceVersion of the Secret it's based on, so the API server rejects
+	// it with a conflict if the Secret has changed since.
 	for key, val := range data {
 		mak.Set(&secret.Data, sanitizeKey(key), val)
 	}
 	if err := s.client.UpdateSecret(ctx, secret); err != nil {
-		return fmt.Errorf("error updating Secret %s: %w", s.secretName, err)
+		return false, fmt.Errorf("error updating Secret %s: %w", s.secretName, err)
 	}
-	return nil
+	return false, nil
+}
+
+// cacheFor returns the cache of the Secret secretName.
+func (s *Store) cacheFor(secretName string) *secretCache {
+	if secretName == s.secretName {
+		return &s.stateCache
+	}
+	return &s.certCache
 }
 
 func (s *Store) loadState() (err error) {
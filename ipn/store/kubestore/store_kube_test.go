@@ -8,8 +8,12 @@
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"tailscale.com/envknob"
@@ -812,3 +816,129 @@ func TestNewWithClient(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateSecretConflict(t *testing.T) {
+	var gets, updates int
+	client := &kubeclient.FakeClient{
+		GetSecretImpl: func(ctx context.Context, name string) (*kubeapi.Secret, error) {
+			gets++
+			return &kubeapi.Secret{
+				ObjectMeta: kubeapi.ObjectMeta{Name: name, ResourceVersion: fmt.Sprint(gets)},
+				Data:       map[string][]byte{"existing": []byte("old")},
+			}, nil
+		},
+		UpdateSecretImpl: func(ctx context.Context, s *kubeapi.Secret) error {
+			updates++
+			// Another writer updated the Secret after the first GET.
+			if s.ResourceVersion == "1" {
+				return &kubeapi.Status{Code: http.StatusConflict}
+			}
+			return nil
+		},
+	}
+	s := &Store{
+		client:     client,
+		secretName: "ts-state",
+		memory:     mem.Store{},
+	}
+	if err := s.WriteState("foo", []byte("bar")); err != nil {
+		t.Fatalf("WriteState() error = %v", err)
+	}
+	if gets != 2 || updates != 2 {
+		t.Errorf("got %d GETs and %d updates; want 2 of each", gets, updates)
+	}
+}
+
+// fakeSecretWatch is a kubeclient.SecretWatch of the events sent on it. It
+// ends when closed.
+type fakeSecretWatch chan kubeclient.SecretEvent
+
+func (w fakeSecretWatch) Next() (kubeclient.SecretEvent, error) {
+	ev, ok := <-w
+	if !ok {
+		return ev, io.EOF
+	}
+	return ev, nil
+}
+
+func (w fakeSecretWatch) Close() error { return nil }
+
+func TestStateSecretCache(t *testing.T) {
+	envknob.Setenv("TS_CERT_SHARE_MODE", "")
+	const secretName = "ts-state"
+	var (
+		mu      sync.Mutex
+		gets    int
+		created *kubeapi.Secret
+		patched []kubeclient.JSONPatch
+	)
+	w := make(fakeSecretWatch)
+	client := &kubeclient.FakeClient{
+		GetSecretImpl: func(ctx context.Context, name string) (*kubeapi.Secret, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			gets++
+			return &kubeapi.Secret{
+				ObjectMeta: kubeapi.ObjectMeta{Name: name, ResourceVersion: "1"},
+				Data:       map[string][]byte{"existing": []byte("old")},
+			}, nil
+		},
+		CheckSecretPermissionsImpl: func(ctx context.Context, name string) (bool, bool, error) {
+			return true, true, nil
+		},
+		CreateSecretImpl: func(ctx context.Context, s *kubeapi.Secret) error {
+			created = s
+			return nil
+		},
+		JSONPatchResourceImpl: func(ctx context.Context, name, resourceType string, patches []kubeclient.JSONPatch) error {
+			patched = patches
+			return nil
+		},
+		WatchSecretsImpl: func(ctx context.Context, name string, sel map[string]string, rv string) (kubeclient.SecretWatch, error) {
+			if name != secretName || rv != "1" {
+				t.Errorf("watching Secret %q from resourceVersion %q; want %q from 1", name, rv, secretName)
+			}
+			return w, nil
+		},
+	}
+	s, err := newWithClient(t.Logf, client, secretName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	initialGets := gets
+	mu.Unlock()
+
+	// Writes are based on the cached Secret.
+	if err := s.WriteState("foo", []byte("bar")); err != nil {
+		t.Fatalf("WriteState() error = %v", err)
+	}
+	want := []kubeclient.JSONPatch{{Op: "add", Path: "/data/foo", Value: []byte("bar")}}
+	if diff := cmp.Diff(patched, want); diff != "" {
+		t.Errorf("patches mismatch (-got +want):\n%s", diff)
+	}
+
+	// Once the watch reports the Secret deleted, writes recreate it.
+	w <- kubeclient.SecretEvent{
+		Type:   "DELETED",
+		Secret: &kubeapi.Secret{ObjectMeta: kubeapi.ObjectMeta{Name: secretName, ResourceVersion: "2"}},
+	}
+	for {
+		if secret, _ := s.stateCache.get(secretName); secret == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.WriteState("foo", []byte("baz")); err != nil {
+		t.Fatalf("WriteState() error = %v", err)
+	}
+	if created == nil || string(created.Data["foo"]) != "baz" {
+		t.Errorf("state Secret not recreated; got %+v", created)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if gets != initialGets {
+		t.Errorf("got %d GETs after startup; want none", gets-initialGets)
+	}
+}
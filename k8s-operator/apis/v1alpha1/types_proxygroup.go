@@ -6,6 +6,7 @@
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -72,11 +73,20 @@ type ProxyGroupSpec struct {
 	Tags Tags `json:"tags,omitempty"`
 
 	// Replicas specifies how many replicas to create the StatefulSet with.
-	// Defaults to 2.
+	// Defaults to 2. Ignored if Autoscaling is set.
 	// +optional
 	// +kubebuilder:validation:Minimum=0
 	Replicas *int32 `json:"replicas,omitempty"`
 
+	// Autoscaling configures the operator to scale the number of replicas
+	// between minReplicas and maxReplicas, based on the tailnet throughput
+	// of the replicas, instead of using a fixed number of replicas.
+	// The operator measures throughput by scraping the replicas' metrics,
+	// so the ProxyGroup's ProxyClass must enable metrics. Only supported
+	// for ProxyGroups of type egress and ingress.
+	// +optional
+	Autoscaling *ProxyGroupAutoscaling `json:"autoscaling,omitempty"`
+
 	// HostnamePrefix is the hostname prefix to use for tailnet devices created
 	// by the ProxyGroup. Each device will have the integer number from its
 	// StatefulSet pod appended to this prefix to form the full hostname.
@@ -105,6 +115,48 @@ type ProxyGroupSpec struct {
 	Tailnet string `json:"tailnet,omitempty"`
 }
 
+// +kubebuilder:validation:XValidation:rule="!has(self.minReplicas) || self.minReplicas <= self.maxReplicas",message="minReplicas must not be greater than maxReplicas"
+type ProxyGroupAutoscaling struct {
+	// MinReplicas is the lowest number of replicas to scale down to.
+	// Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the highest number of replicas to scale up to.
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetThroughputPerReplica is the tailnet throughput, in bytes per
+	// second sent and received, that each replica should handle on
+	// average. The operator adds replicas when the average throughput is
+	// above the target, and removes them when it's below, e.g. "50M" for
+	// 50MB/s.
+	TargetThroughputPerReplica resource.Quantity `json:"targetThroughputPerReplica"`
+
+	// ScaleDownDelaySeconds is how long throughput must stay low enough
+	// for fewer replicas before the operator removes replicas, to avoid
+	// flapping when traffic fluctuates. Replicas are added without delay.
+	// Defaults to 300.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	ScaleDownDelaySeconds *int32 `json:"scaleDownDelaySeconds,omitempty"`
+}
+
+type ProxyGroupAutoscalingStatus struct {
+	// DesiredReplicas is the number of replicas chosen by the autoscaler.
+	DesiredReplicas int32 `json:"desiredReplicas"`
+
+	// Throughput is the total tailnet throughput of the replicas, in bytes
+	// per second sent and received, as last measured.
+	// +optional
+	Throughput *resource.Quantity `json:"throughput,omitempty"`
+
+	// LastScaleTime is when the autoscaler last changed DesiredReplicas.
+	// +optional
+	LastScaleTime *metav1.Time `json:"lastScaleTime,omitempty"`
+}
+
 type ProxyGroupStatus struct {
 	// List of status conditions to indicate the status of the ProxyGroup
 	// resources. Known condition types include `ProxyGroupReady` and
@@ -137,6 +189,11 @@ type ProxyGroupStatus struct {
 	// any. Only applies to ProxyGroups of type kube-apiserver.
 	// +optional
 	URL string `json:"url,omitempty"`
+
+	// Autoscaling is the status of the ProxyGroup's autoscaling, if
+	// spec.autoscaling is set.
+	// +optional
+	Autoscaling *ProxyGroupAutoscalingStatus `json:"autoscaling,omitempty"`
 }
 
 type TailnetDevice struct {
@@ -812,6 +812,56 @@ func (in *ProxyGroup) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyGroupAutoscaling) DeepCopyInto(out *ProxyGroupAutoscaling) {
+	*out = *in
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	out.TargetThroughputPerReplica = in.TargetThroughputPerReplica.DeepCopy()
+	if in.ScaleDownDelaySeconds != nil {
+		in, out := &in.ScaleDownDelaySeconds, &out.ScaleDownDelaySeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyGroupAutoscaling.
+func (in *ProxyGroupAutoscaling) DeepCopy() *ProxyGroupAutoscaling {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyGroupAutoscaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyGroupAutoscalingStatus) DeepCopyInto(out *ProxyGroupAutoscalingStatus) {
+	*out = *in
+	if in.Throughput != nil {
+		in, out := &in.Throughput, &out.Throughput
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.LastScaleTime != nil {
+		in, out := &in.LastScaleTime, &out.LastScaleTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyGroupAutoscalingStatus.
+func (in *ProxyGroupAutoscalingStatus) DeepCopy() *ProxyGroupAutoscalingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyGroupAutoscalingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProxyGroupList) DeepCopyInto(out *ProxyGroupList) {
 	*out = *in
@@ -963,6 +1013,11 @@ func (in *ProxyGroupSpec) DeepCopyInto(out *ProxyGroupSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(ProxyGroupAutoscaling)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.KubeAPIServer != nil {
 		in, out := &in.KubeAPIServer, &out.KubeAPIServer
 		*out = new(KubeAPIServerConfig)
@@ -997,6 +1052,11 @@ func (in *ProxyGroupStatus) DeepCopyInto(out *ProxyGroupStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(ProxyGroupAutoscalingStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyGroupStatus.
@@ -20,11 +20,12 @@
 )
 
 // Healthz is a simple health check server, if enabled it returns 200 OK if
-// this tailscale node currently has at least one tailnet IP address else
-// returns 503.
+// this tailscale node currently has at least one tailnet IP address (or meets
+// whatever criteria its owner passes to UpdateStatus) else returns 503.
 type Healthz struct {
 	sync.Mutex
 	hasAddrs bool
+	reason   string // why not healthy, if set by UpdateStatus
 	podIPv4  string
 	logger   logger.Logf
 }
@@ -38,12 +39,20 @@ func (h *Healthz) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if _, err := w.Write([]byte("ok")); err != nil {
 			http.Error(w, fmt.Sprintf("error writing status: %v", err), http.StatusInternalServerError)
 		}
+	} else if h.reason != "" {
+		http.Error(w, h.reason, http.StatusServiceUnavailable)
 	} else {
 		http.Error(w, "node currently has no tailscale IPs", http.StatusServiceUnavailable)
 	}
 }
 
 func (h *Healthz) Update(healthy bool) {
+	h.UpdateStatus(healthy, "")
+}
+
+// UpdateStatus is like Update, but if not healthy, reason (if non-empty) is
+// served as the explanation instead of the node having no tailscale IPs.
+func (h *Healthz) UpdateStatus(healthy bool, reason string) {
 	h.Lock()
 	defer h.Unlock()
 
@@ -51,6 +60,7 @@ func (h *Healthz) Update(healthy bool) {
 		h.logger("Setting healthy %v", healthy)
 	}
 	h.hasAddrs = healthy
+	h.reason = reason
 }
 
 func (h *Healthz) MonitorHealth(ctx context.Context, lc *local.Client) error {
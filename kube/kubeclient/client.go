@@ -19,11 +19,14 @@
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -38,6 +41,10 @@
 
 	TypeSecrets = "secrets"
 	typeEvents  = "events"
+
+	// watchTimeout is how long the API server is asked to keep a watch
+	// open before ending it.
+	watchTimeout = 5 * time.Minute
 )
 
 // rootPathForTests is set by tests to override the root path to the
@@ -71,8 +78,34 @@ type Client interface {
 	StrategicMergePatchSecret(context.Context, string, *kubeapi.Secret, string) error
 	JSONPatchResource(_ context.Context, resourceName string, resourceType string, patches []JSONPatch) error
 	CheckSecretPermissions(context.Context, string) (bool, bool, error)
+	// WatchSecrets watches the named Secret, or if name is empty the
+	// Secrets matching selector, for changes after resourceVersion. If
+	// resourceVersion is empty, the watch starts with an "ADDED" event for
+	// each existing Secret.
+	WatchSecrets(_ context.Context, name string, selector map[string]string, resourceVersion string) (SecretWatch, error)
 	SetDialer(dialer func(context.Context, string, string) (net.Conn, error))
 	SetURL(string)
+	SetSecretNamespace(string)
+}
+
+// SecretEvent is a change to a Secret being watched.
+type SecretEvent struct {
+	// Type is "ADDED", "MODIFIED", "DELETED" or "BOOKMARK". The Secret of a
+	// bookmark only has its resourceVersion set.
+	Type   string
+	Secret *kubeapi.Secret
+}
+
+// SecretWatch is a watch of Secrets started with Client.WatchSecrets.
+type SecretWatch interface {
+	// Next blocks until the next change to the watched Secrets and returns
+	// it. It returns io.EOF once the API server ends the watch, which it
+	// does every few minutes. Errors reported by the API server are
+	// returned as a *kubeapi.Status; one with code 410 (Gone) means the
+	// watch fell too far behind and the Secrets must be listed again.
+	Next() (SecretEvent, error)
+	// Close ends the watch.
+	Close() error
 }
 
 type client struct {
@@ -82,6 +115,7 @@ type client struct {
 	podName     string
 	podUID      string
 	ns          string // Pod namespace
+	secretNS    string // Secret namespace, if not the Pod's
 	client      *http.Client
 	token       string
 	tokenExpiry time.Time
@@ -131,6 +165,13 @@ func (c *client) SetURL(url string) {
 	c.url = url
 }
 
+// SetSecretNamespace sets the namespace of the Secrets the client reads and
+// writes, if it's not the namespace of the Pod in which it runs. Events are
+// still created in the Pod's namespace.
+func (c *client) SetSecretNamespace(ns string) {
+	c.secretNS = ns
+}
+
 // SetDialer sets the dialer to use when establishing a connection
 // to the Kubernetes API server.
 func (c *client) SetDialer(dialer func(ctx context.Context, network, addr string) (net.Conn, error)) {
@@ -269,9 +310,80 @@ func (c *client) ListSecrets(ctx context.Context, selector map[string]string) (*
 	return sl, nil
 }
 
+// WatchSecrets starts a watch of Secrets in the Kubernetes API.
+func (c *client) WatchSecrets(ctx context.Context, name string, selector map[string]string, resourceVersion string) (SecretWatch, error) {
+	q := url.Values{
+		"watch":               {"true"},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {strconv.Itoa(int(watchTimeout / time.Second))},
+	}
+	if name != "" {
+		q.Set("fieldSelector", "metadata.name="+name)
+	}
+	if len(selector) > 0 {
+		var sel []string
+		for _, key := range slices.Sorted(maps.Keys(selector)) {
+			sel = append(sel, key+"="+selector[key])
+		}
+		q.Set("labelSelector", strings.Join(sel, ","))
+	}
+	if resourceVersion != "" {
+		q.Set("resourceVersion", resourceVersion)
+	}
+	req, err := c.newRequest(ctx, "GET", c.resourceURL("", TypeSecrets, "")+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := getError(resp); err != nil {
+		resp.Body.Close()
+		if st, ok := err.(*kubeapi.Status); ok && st.Code == 401 {
+			c.expireToken()
+		}
+		return nil, err
+	}
+	return &secretWatch{body: resp.Body, dec: json.NewDecoder(resp.Body)}, nil
+}
+
+// secretWatch is the SecretWatch returned by client.WatchSecrets, reading
+// watch events from the body of the API server's response.
+type secretWatch struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+}
+
+func (w *secretWatch) Next() (SecretEvent, error) {
+	var ev struct {
+		Type   string          `json:"type"`
+		Object json.RawMessage `json:"object"`
+	}
+	if err := w.dec.Decode(&ev); err != nil {
+		return SecretEvent{}, err
+	}
+	if ev.Type == "ERROR" {
+		st := &kubeapi.Status{}
+		if err := json.Unmarshal(ev.Object, st); err != nil {
+			return SecretEvent{}, err
+		}
+		return SecretEvent{}, st
+	}
+	s := &kubeapi.Secret{}
+	if err := json.Unmarshal(ev.Object, s); err != nil {
+		return SecretEvent{}, err
+	}
+	return SecretEvent{Type: ev.Type, Secret: s}, nil
+}
+
+func (w *secretWatch) Close() error {
+	return w.body.Close()
+}
+
 // CreateSecret creates a secret in the Kubernetes API.
 func (c *client) CreateSecret(ctx context.Context, s *kubeapi.Secret) error {
-	s.Namespace = c.ns
+	s.Namespace = c.namespace(TypeSecrets)
 	return c.kubeAPIRequest(ctx, "POST", c.resourceURL("", TypeSecrets, ""), s, nil)
 }
 
@@ -312,7 +424,7 @@ func (c *client) StrategicMergePatchSecret(ctx context.Context, name string, s *
 		}
 		surl += "?" + uv.Encode()
 	}
-	s.Namespace = c.ns
+	s.Namespace = c.namespace(TypeSecrets)
 	s.Name = name
 	return c.kubeAPIRequest(ctx, "PATCH", surl, s, nil, setHeader("Content-Type", "application/strategic-merge-patch+json"))
 }
@@ -458,7 +570,7 @@ func (c *client) setEventPerms() {
 // the given name only.
 func (c *client) checkPermission(ctx context.Context, verb, typ, name string) (bool, error) {
 	ra := map[string]any{
-		"namespace": c.ns,
+		"namespace": c.namespace(typ),
 		"verb":      verb,
 		"resource":  typ,
 	}
@@ -488,14 +600,24 @@ func (c *client) checkPermission(ctx context.Context, verb, typ, name string) (b
 // the named resource of that type.
 // Note that this only works for core/v1 resource types.
 func (c *client) resourceURL(name, typ, sel string) string {
+	ns := c.namespace(typ)
 	if name == "" {
-		url := fmt.Sprintf("%s/api/v1/namespaces/%s/%s", c.url, c.ns, typ)
+		url := fmt.Sprintf("%s/api/v1/namespaces/%s/%s", c.url, ns, typ)
 		if sel != "" {
 			url += "?labelSelector=" + sel
 		}
 		return url
 	}
-	return fmt.Sprintf("%s/api/v1/namespaces/%s/%s/%s", c.url, c.ns, typ, name)
+	return fmt.Sprintf("%s/api/v1/namespaces/%s/%s/%s", c.url, ns, typ, name)
+}
+
+// namespace returns the namespace of the resources of the given type that
+// the client works with.
+func (c *client) namespace(typ string) string {
+	if typ == TypeSecrets && c.secretNS != "" {
+		return c.secretNS
+	}
+	return c.ns
 }
 
 // nameForEvent returns a name for the Event that uniquely identifies Event with that reason for the current Pod.
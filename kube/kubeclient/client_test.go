@@ -6,6 +6,7 @@
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -126,6 +127,49 @@ func TestReturnsKubeStatusError(t *testing.T) {
 	}
 }
 
+func TestWatchSecrets(t *testing.T) {
+	cl := clientForKubeHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.URL.Path, "/api/v1/namespaces/other-ns/secrets"; got != want {
+			t.Errorf("got path %q; want %q", got, want)
+		}
+		q := r.URL.Query()
+		if q.Get("watch") != "true" || q.Get("fieldSelector") != "metadata.name=ts-state" || q.Get("resourceVersion") != "5" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		enc := json.NewEncoder(w)
+		enc.Encode(map[string]any{
+			"type":   "MODIFIED",
+			"object": kubeapi.Secret{ObjectMeta: kubeapi.ObjectMeta{Name: "ts-state", ResourceVersion: "6"}},
+		})
+		enc.Encode(map[string]any{
+			"type":   "ERROR",
+			"object": kubeapi.Status{Code: http.StatusGone},
+		})
+	}))
+	cl.SetSecretNamespace("other-ns")
+
+	w, err := cl.WatchSecrets(t.Context(), "ts-state", nil, "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ev, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != "MODIFIED" || ev.Secret.Name != "ts-state" || ev.Secret.ResourceVersion != "6" {
+		t.Errorf("got event %+v", ev)
+	}
+	if _, err := w.Next(); err == nil {
+		t.Fatal("expected error, got nil")
+	} else if st, ok := err.(*kubeapi.Status); !ok || st.Code != http.StatusGone {
+		t.Fatalf("expected kubeapi.Status with code %d, got %T: %v", http.StatusGone, err, err)
+	}
+	if _, err := w.Next(); err != io.EOF {
+		t.Fatalf("got %v; want io.EOF at the end of the watch", err)
+	}
+}
+
 // clientForKubeHandler creates a client using the externally accessible package
 // API to ensure it's testing behaviour as close to prod as possible. The passed
 // in handler mocks the Kubernetes API server's responses to any HTTP requests
@@ -6,6 +6,7 @@
 import (
 	"context"
 	"net"
+	"net/http"
 
 	"tailscale.com/kube/kubeapi"
 )
@@ -20,6 +21,7 @@ type FakeClient struct {
 	JSONPatchResourceImpl         func(context.Context, string, string, []JSONPatch) error
 	ListSecretsImpl               func(context.Context, map[string]string) (*kubeapi.SecretList, error)
 	StrategicMergePatchSecretImpl func(context.Context, string, *kubeapi.Secret, string) error
+	WatchSecretsImpl              func(context.Context, string, map[string]string, string) (SecretWatch, error)
 }
 
 func (fc *FakeClient) CheckSecretPermissions(ctx context.Context, name string) (bool, bool, error) {
@@ -37,6 +39,8 @@ func (fc *FakeClient) StrategicMergePatchSecret(ctx context.Context, name string
 func (fc *FakeClient) Event(context.Context, string, string, string) error {
 	return nil
 }
+func (fc *FakeClient) SetSecretNamespace(_ string) {
+}
 
 func (fc *FakeClient) JSONPatchResource(ctx context.Context, resource, name string, patches []JSONPatch) error {
 	return fc.JSONPatchResourceImpl(ctx, resource, name, patches)
@@ -53,3 +57,10 @@ func (fc *FakeClient) ListSecrets(ctx context.Context, selector map[string]strin
 	}
 	return nil, nil
 }
+func (fc *FakeClient) WatchSecrets(ctx context.Context, name string, selector map[string]string, resourceVersion string) (SecretWatch, error) {
+	if fc.WatchSecretsImpl != nil {
+		return fc.WatchSecretsImpl(ctx, name, selector, resourceVersion)
+	}
+	// Like an API server that doesn't allow watching Secrets.
+	return nil, &kubeapi.Status{Code: http.StatusForbidden}
+}
@@ -61,6 +61,9 @@ type Config struct {
 	// OnlyIPv6, if true, uses the IPv6 service IP (for MagicDNS)
 	// instead of the IPv4 version (100.100.100.100).
 	OnlyIPv6 bool
+	// Options are resolver options for the OS and the quad-100
+	// forwarder to resolve names with.
+	Options ResolverOptions
 }
 
 var magicDNSDualStack = envknob.RegisterBool("TS_DEBUG_MAGIC_DNS_DUAL_STACK")
@@ -95,6 +98,9 @@ func (c *Config) WriteToBufioWriter(w *bufio.Writer) {
 	resolver.WriteRoutes(w, c.Routes)
 
 	fmt.Fprintf(w, " SearchDomains:%v", c.SearchDomains)
+	if !c.Options.IsZero() {
+		fmt.Fprintf(w, " Options:%+v", c.Options)
+	}
 	fmt.Fprintf(w, " Hosts:%v", len(c.Hosts))
 	w.WriteString("}")
 }
@@ -116,7 +116,7 @@ func (m *resolvconfManager) SetDNS(config OSConfig) error {
 		}
 	} else {
 		stdin := new(bytes.Buffer)
-		writeResolvConf(stdin, config.Nameservers, config.SearchDomains) // dns_direct.go
+		writeResolvConf(stdin, config.Nameservers, config.SearchDomains, config.Options) // dns_direct.go
 
 		// This resolvconf implementation doesn't support exclusive
 		// mode or interface priorities, so it will end up blending
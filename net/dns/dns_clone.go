@@ -67,6 +67,7 @@ func (src *Config) Clone() *Config {
 	Hosts            map[dnsname.FQDN][]netip.Addr
 	SubdomainHosts   set.Set[dnsname.FQDN]
 	OnlyIPv6         bool
+	Options          ResolverOptions
 }{})
 
 // Clone duplicates src into dst and reports whether it succeeded.
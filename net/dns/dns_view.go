@@ -139,7 +139,11 @@ func (v ConfigView) SubdomainHosts() views.Map[dnsname.FQDN, struct{}] {
 
 // OnlyIPv6, if true, uses the IPv6 service IP (for MagicDNS)
 // instead of the IPv4 version (100.100.100.100).
-func (v ConfigView) OnlyIPv6() bool           { return v.ж.OnlyIPv6 }
+func (v ConfigView) OnlyIPv6() bool { return v.ж.OnlyIPv6 }
+
+// Options are resolver options for the OS and the quad-100
+// forwarder to resolve names with.
+func (v ConfigView) Options() ResolverOptions { return v.ж.Options }
 func (v ConfigView) Equal(v2 ConfigView) bool { return v.ж.Equal(v2.ж) }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
@@ -151,4 +155,5 @@ func (v ConfigView) Equal(v2 ConfigView) bool { return v.ж.Equal(v2.ж) }
 	Hosts            map[dnsname.FQDN][]netip.Addr
 	SubdomainHosts   set.Set[dnsname.FQDN]
 	OnlyIPv6         bool
+	Options          ResolverOptions
 }{})
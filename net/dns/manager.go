@@ -299,6 +299,8 @@ func (m *Manager) compileConfig(cfg Config) (rcfg resolver.Config, ocfg OSConfig
 	rcfg.Hosts = cfg.Hosts
 	rcfg.SubdomainHosts = cfg.SubdomainHosts
 	rcfg.AcceptDNS = cfg.AcceptDNS
+	rcfg.UpstreamTimeout = cfg.Options.Timeout
+	rcfg.UpstreamAttempts = cfg.Options.Attempts
 	routes := map[dnsname.FQDN][]*dnstype.Resolver{} // assigned conditionally to rcfg.Routes below.
 	var propagateHostsToOS bool
 	for suffix, resolvers := range cfg.Routes {
@@ -310,8 +312,9 @@ func (m *Manager) compileConfig(cfg Config) (rcfg resolver.Config, ocfg OSConfig
 		}
 	}
 
-	// Similarly, the OS always gets search paths.
+	// Similarly, the OS always gets search paths, and resolver options.
 	ocfg.SearchDomains = cfg.SearchDomains
+	ocfg.Options = cfg.Options
 	if propagateHostsToOS && m.goos == "windows" {
 		ocfg.Hosts = compileHostEntries(cfg)
 	}
@@ -434,11 +437,17 @@ func (m *Manager) compileConfig(cfg Config) (rcfg resolver.Config, ocfg OSConfig
 		// Append base config search domains, but only if not already present.
 		// This prevents duplicates when GetBaseConfig() reads back domains that
 		// Tailscale itself previously wrote to resolv.conf.
+		var baseDomains []dnsname.FQDN
 		for _, domain := range baseCfg.SearchDomains {
 			if !slices.Contains(ocfg.SearchDomains, domain) {
-				ocfg.SearchDomains = append(ocfg.SearchDomains, domain)
+				baseDomains = append(baseDomains, domain)
 			}
 		}
+		if cfg.Options.SearchOrder == SearchOrderOSFirst {
+			ocfg.SearchDomains = slices.Concat(baseDomains, ocfg.SearchDomains)
+		} else {
+			ocfg.SearchDomains = append(ocfg.SearchDomains, baseDomains...)
+		}
 	}
 
 	return rcfg, ocfg, nil
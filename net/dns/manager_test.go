@@ -437,6 +437,40 @@ func TestManager(t *testing.T) {
 					"corp.com.", "2.2.2.2"),
 			},
 		},
+		{
+			name: "routes-options-os-first",
+			in: Config{
+				Routes:        upstreams("corp.com", "2.2.2.2"),
+				SearchDomains: fqdns("tailscale.com", "universe.tf"),
+				Options: ResolverOptions{
+					Ndots:       2,
+					Timeout:     3 * time.Second,
+					Attempts:    4,
+					SearchOrder: SearchOrderOSFirst,
+				},
+			},
+			bs: OSConfig{
+				Nameservers:   mustIPs("8.8.8.8"),
+				SearchDomains: fqdns("coffee.shop"),
+			},
+			os: OSConfig{
+				Nameservers:   serviceAddr46,
+				SearchDomains: fqdns("coffee.shop", "tailscale.com", "universe.tf"),
+				Options: ResolverOptions{
+					Ndots:       2,
+					Timeout:     3 * time.Second,
+					Attempts:    4,
+					SearchOrder: SearchOrderOSFirst,
+				},
+			},
+			rs: resolver.Config{
+				Routes: upstreams(
+					".", "8.8.8.8",
+					"corp.com.", "2.2.2.2"),
+				UpstreamTimeout:  3 * time.Second,
+				UpstreamAttempts: 4,
+			},
+		},
 		{
 			name: "routes-split",
 			in: Config{
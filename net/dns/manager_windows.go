@@ -28,6 +28,7 @@
 	"tailscale.com/health"
 	"tailscale.com/syncs"
 	"tailscale.com/types/logger"
+	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/dnsname"
 	"tailscale.com/util/eventbus"
 	"tailscale.com/util/syspolicy/pkey"
@@ -53,6 +54,12 @@ type windowsManager struct {
 
 	unregisterPolicyChangeCb func() // called when the manager is closing
 
+	// setMu serializes SetDNS with reapplying the last config after a
+	// group policy refresh.
+	setMu   syncs.Mutex
+	lastCfg OSConfig // +checklocks:setMu
+	haveCfg bool     // +checklocks:setMu
+
 	mu      syncs.Mutex
 	closing bool
 }
@@ -73,7 +80,7 @@ func NewOSConfigurator(logf logger.Logf, health *health.Tracker, bus *eventbus.B
 	}
 
 	if isWindows10OrBetter() {
-		ret.nrptDB = newNRPTRuleDatabase(logf)
+		ret.nrptDB = newNRPTRuleDatabase(logf, ret.reapplyAfterGPRefresh)
 	}
 
 	var err error
@@ -360,6 +367,41 @@ func (m *windowsManager) disableHostsFileUpdates() bool {
 }
 
 func (m *windowsManager) SetDNS(cfg OSConfig) error {
+	m.setMu.Lock()
+	defer m.setMu.Unlock()
+	m.lastCfg, m.haveCfg = cfg, true
+	return m.setDNSLocked(cfg)
+}
+
+// reapplyAfterGPRefresh is called after a machine group policy refresh,
+// such as one caused by running gpupdate, that we didn't initiate. A refresh
+// can replace the NRPT rules under the group policy key and reset our
+// interface's settings, breaking MagicDNS until the next time SetDNS is
+// called, so it reapplies the last config right away.
+func (m *windowsManager) reapplyAfterGPRefresh() {
+	m.setMu.Lock()
+	defer m.setMu.Unlock()
+	m.mu.Lock()
+	closing := m.closing
+	m.mu.Unlock()
+	if closing || !m.haveCfg {
+		return
+	}
+	metricGPRefreshReapply.Add(1)
+	m.logf("reapplying DNS config after group policy refresh")
+	if err := m.setDNSLocked(m.lastCfg); err != nil {
+		metricGPRefreshReapplyError.Add(1)
+		m.logf("reapplying DNS config after group policy refresh: %v", err)
+	}
+}
+
+var (
+	metricGPRefreshReapply      = clientmetric.NewCounter("dns_windows_gp_refresh_reapply")
+	metricGPRefreshReapplyError = clientmetric.NewCounter("dns_windows_gp_refresh_reapply_error")
+)
+
+// setDNSLocked applies cfg. m.setMu must be held.
+func (m *windowsManager) setDNSLocked(cfg OSConfig) error {
 	// We can configure Windows DNS in one of two ways:
 	//
 	//  - In primary DNS mode, we set the NameServer and SearchList
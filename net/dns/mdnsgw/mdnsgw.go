@@ -0,0 +1,706 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package mdnsgw implements a gateway between DNS-based service discovery
+// (DNS-SD) over multicast DNS on a node's local network and unicast DNS-SD
+// (RFC 6763) over MagicDNS.
+//
+// The gateway browses its LAN for an allowlist of service types, such as
+// printers (_ipp._tcp) or HomeKit hubs (_hap._tcp), and serves what it finds
+// in a DNS zone that tailnet peers can browse. In the other direction, it
+// answers mDNS queries on its LAN for a configured set of tailnet services.
+//
+// It's configured by the [tailcfg.NodeAttrMDNSGateway] node attribute, whose
+// values are of type [Attr].
+package mdnsgw
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+	"tailscale.com/tstime/rate"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/clientmetric"
+	"tailscale.com/util/dnsname"
+	"tailscale.com/util/set"
+)
+
+// Attr is the value of the [tailcfg.NodeAttrMDNSGateway] node attribute.
+//
+// It's sent to every node that should be able to browse Domain. Nodes
+// tagged with one of Gateways bridge the zone to their LAN; other nodes send
+// their queries for it to a gateway's peer API, which answers peers that the
+// tailnet policy allows to reach it on port 53.
+type Attr struct {
+	// Domain is the DNS zone that the services discovered on the LAN are
+	// published under, like "office.example.com".
+	Domain string `json:"domain"`
+	// Gateways are the tags of the nodes that bridge the zone.
+	Gateways []string `json:"gateways,omitempty"`
+	// Services are the DNS-SD service types, like "_ipp._tcp", that are
+	// bridged from the LAN. Services of other types are ignored.
+	Services []string `json:"services,omitempty"`
+	// Publish are the tailnet services that gateways announce to their LAN.
+	Publish []Service `json:"publish,omitempty"`
+}
+
+// Service is a service instance that a gateway announces to its LAN.
+type Service struct {
+	// Instance is the service instance name, like "Office Printer".
+	Instance string `json:"instance"`
+	// Type is the DNS-SD service type, like "_ipp._tcp".
+	Type string `json:"type"`
+	// Host is the single-label name of the host the instance runs on.
+	// It's announced as "<Host>.local".
+	Host string `json:"host"`
+	// Addrs are the addresses of Host, usually its Tailscale IPs.
+	Addrs []netip.Addr `json:"addrs,omitempty"`
+	// Port is the port the instance listens on.
+	Port uint16 `json:"port"`
+	// TXT are the strings of the instance's TXT record, like "rp=printers/1".
+	TXT []string `json:"txt,omitempty"`
+}
+
+// Config is the configuration of a Gateway.
+type Config struct {
+	// Domain is the zone that LAN services are served under.
+	Domain dnsname.FQDN
+	// Services are the service types to bridge from the LAN.
+	Services []string
+	// Publish are the services to announce to the LAN.
+	Publish []Service
+}
+
+// Equal reports whether c and o are the same configuration.
+func (c Config) Equal(o Config) bool {
+	return c.Domain == o.Domain &&
+		slices.Equal(c.Services, o.Services) &&
+		slices.EqualFunc(c.Publish, o.Publish, func(a, b Service) bool {
+			return a.Instance == b.Instance && a.Type == b.Type && a.Host == b.Host &&
+				slices.Equal(a.Addrs, b.Addrs) && a.Port == b.Port && slices.Equal(a.TXT, b.TXT)
+		})
+}
+
+func attrs(self tailcfg.NodeView) []Attr {
+	if !self.Valid() {
+		return nil
+	}
+	attrs, err := tailcfg.UnmarshalNodeCapViewJSON[Attr](self.CapMap(), tailcfg.NodeAttrMDNSGateway)
+	if err != nil {
+		return nil
+	}
+	return attrs
+}
+
+func isGateway(n tailcfg.NodeView, a Attr) bool {
+	return n.Tags().ContainsFunc(func(tag string) bool {
+		return slices.Contains(a.Gateways, tag)
+	})
+}
+
+// SelfConfig returns the configuration of the gateway that self should
+// run, if any. A node runs at most one gateway; if it's tagged as a gateway
+// by more than one attribute value, the first one is used.
+func SelfConfig(self tailcfg.NodeView) (_ Config, ok bool) {
+	for _, a := range attrs(self) {
+		if !isGateway(self, a) {
+			continue
+		}
+		domain, err := dnsname.ToFQDN(strings.ToLower(a.Domain))
+		if err != nil || domain.NumLabels() == 0 {
+			continue
+		}
+		return Config{Domain: domain, Services: a.Services, Publish: a.Publish}, true
+	}
+	return Config{}, false
+}
+
+// PickGatewayPeers returns the peers that gateway each zone in self's
+// [tailcfg.NodeAttrMDNSGateway] attribute, in order of preference, leaving
+// out zones that self gateways itself.
+func PickGatewayPeers(self tailcfg.NodeView, peers map[tailcfg.NodeID]tailcfg.NodeView) map[dnsname.FQDN][]tailcfg.NodeView {
+	selfCfg, selfOK := SelfConfig(self)
+	var m map[dnsname.FQDN][]tailcfg.NodeView
+	for _, a := range attrs(self) {
+		domain, err := dnsname.ToFQDN(strings.ToLower(a.Domain))
+		if err != nil || domain.NumLabels() == 0 || (selfOK && domain == selfCfg.Domain) {
+			continue
+		}
+		var gws []tailcfg.NodeView
+		for _, p := range peers {
+			if isGateway(p, a) {
+				gws = append(gws, p)
+			}
+		}
+		if len(gws) == 0 {
+			continue
+		}
+		// Prefer online gateways, then pick consistently among them.
+		slices.SortFunc(gws, func(a, b tailcfg.NodeView) int {
+			if ao, bo := a.Online().Get(), b.Online().Get(); ao != bo {
+				if ao {
+					return -1
+				}
+				return 1
+			}
+			return cmp.Compare(a.ID(), b.ID())
+		})
+		if m == nil {
+			m = make(map[dnsname.FQDN][]tailcfg.NodeView)
+		}
+		m[domain] = append(m[domain], gws...)
+	}
+	return m
+}
+
+// validServiceType reports whether t is a DNS-SD service type, like
+// "_ipp._tcp".
+func validServiceType(t string) bool {
+	name, proto, ok := strings.Cut(t, ".")
+	if !ok || (proto != "_tcp" && proto != "_udp") {
+		return false
+	}
+	name, ok = strings.CutPrefix(name, "_")
+	if !ok || name == "" || len(name) > 15 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	// maxInstances is the maximum number of LAN service instances a
+	// gateway keeps track of.
+	maxInstances = 256
+	// maxHostAddrs is the maximum number of addresses kept per LAN host.
+	maxHostAddrs = 8
+	// maxTXTBytes is the maximum total size of an instance's TXT strings.
+	maxTXTBytes = 1300
+
+	// zoneTTL is the TTL of the records in the zone served to peers,
+	// and of the records announced on the LAN.
+	zoneTTL = 120
+
+	// maxBrowseInterval is the maximum interval between queries for the
+	// bridged service types on the LAN. Queries start out more frequent
+	// and back off to this, as recommended by RFC 6762, section 5.2.
+	maxBrowseInterval = 5 * time.Minute
+)
+
+var (
+	mdnsAddr4 = netip.MustParseAddrPort("224.0.0.251:5353")
+
+	metricRecvDropped     = clientmetric.NewCounter("mdnsgw_recv_dropped_rate_limit")
+	metricRecvBad         = clientmetric.NewCounter("mdnsgw_recv_bad")
+	metricInstanceDropped = clientmetric.NewCounter("mdnsgw_instance_dropped_limit")
+	metricZoneQueries     = clientmetric.NewCounter("mdnsgw_zone_queries")
+	metricLANAnswers      = clientmetric.NewCounter("mdnsgw_lan_answers")
+	metricLANDropped      = clientmetric.NewCounter("mdnsgw_lan_answers_dropped_rate_limit")
+)
+
+// Gateway bridges DNS-SD between a LAN and the tailnet.
+type Gateway struct {
+	logf  logger.Logf
+	cfg   Config
+	clock tstime.Clock
+	types set.Set[string] // bridged service types, lowercased
+
+	// recvLimiter limits the rate of mDNS packets from the LAN that are
+	// processed, and sendLimiter the rate of answers sent to it.
+	recvLimiter *rate.Limiter
+	sendLimiter *rate.Limiter
+
+	conn   *net.UDPConn // nil in tests
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	instances map[string]*instance // keyed by lowercased "<instance>.<type>"
+	hosts     map[string]*host     // keyed by lowercased host label
+}
+
+// instance is a service instance discovered on the LAN.
+type instance struct {
+	name    string // instance name, as announced
+	typ     string // service type, lowercased
+	expires time.Time
+	host    string // host label from the SRV record, lowercased, or "" if none yet
+	port    uint16
+	txt     []string
+}
+
+// host is a host discovered on the LAN.
+type host struct {
+	addrs map[netip.Addr]time.Time // to expiry
+}
+
+// New returns a gateway with the given config and starts it. It listens
+// for mDNS on the default IPv4 multicast interface.
+func New(logf logger.Logf, cfg Config) (*Gateway, error) {
+	g := newGateway(logf, cfg, tstime.StdClock{})
+	conn, err := net.ListenMulticastUDP("udp4", nil, net.UDPAddrFromAddrPort(mdnsAddr4))
+	if err != nil {
+		return nil, fmt.Errorf("listening for mDNS: %w", err)
+	}
+	g.conn = conn
+	g.wg.Add(2)
+	go g.readLoop()
+	go g.browseLoop()
+	return g, nil
+}
+
+func newGateway(logf logger.Logf, cfg Config, clock tstime.Clock) *Gateway {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &Gateway{
+		logf:        logger.WithPrefix(logf, "mdnsgw: "),
+		cfg:         cfg,
+		clock:       clock,
+		types:       make(set.Set[string]),
+		recvLimiter: rate.NewLimiter(50, 100),
+		sendLimiter: rate.NewLimiter(10, 20),
+		ctx:         ctx,
+		cancel:      cancel,
+		instances:   make(map[string]*instance),
+		hosts:       make(map[string]*host),
+	}
+	for _, t := range cfg.Services {
+		t = strings.ToLower(t)
+		if !validServiceType(t) {
+			g.logf("ignoring invalid service type %q", t)
+			continue
+		}
+		g.types.Add(t)
+	}
+	return g
+}
+
+// Config returns the gateway's configuration.
+func (g *Gateway) Config() Config { return g.cfg }
+
+// Close stops the gateway.
+func (g *Gateway) Close() error {
+	g.cancel()
+	var err error
+	if g.conn != nil {
+		err = g.conn.Close()
+	}
+	g.wg.Wait()
+	return err
+}
+
+func (g *Gateway) readLoop() {
+	defer g.wg.Done()
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := g.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if g.ctx.Err() == nil {
+				g.logf("read: %v", err)
+			}
+			return
+		}
+		if !g.recvLimiter.Allow() {
+			metricRecvDropped.Add(1)
+			continue
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil {
+			metricRecvBad.Add(1)
+			continue
+		}
+		if msg.Header.Response {
+			g.handleResponse(&msg)
+		} else {
+			g.handleQuery(&msg, src)
+		}
+	}
+}
+
+func (g *Gateway) browseLoop() {
+	defer g.wg.Done()
+	if len(g.types) == 0 {
+		return
+	}
+	q, err := g.browseQuery()
+	if err != nil {
+		g.logf("building query: %v", err)
+		return
+	}
+	interval := time.Second
+	for {
+		if _, err := g.conn.WriteToUDPAddrPort(q, mdnsAddr4); err != nil && g.ctx.Err() == nil {
+			g.logf("sending query: %v", err)
+		}
+		t, c := g.clock.NewTimer(interval)
+		select {
+		case <-g.ctx.Done():
+			t.Stop()
+			return
+		case <-c:
+		}
+		interval = min(2*interval, maxBrowseInterval)
+	}
+}
+
+// browseQuery returns an mDNS query for the instances of the bridged
+// service types.
+func (g *Gateway) browseQuery() ([]byte, error) {
+	var msg dnsmessage.Message
+	for _, t := range slices.Sorted(maps.Keys(g.types)) {
+		name, err := dnsmessage.NewName(t + ".local.")
+		if err != nil {
+			return nil, err
+		}
+		msg.Questions = append(msg.Questions, dnsmessage.Question{
+			Name:  name,
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		})
+	}
+	return msg.Pack()
+}
+
+// cacheFlush is the mDNS cache-flush bit of a resource record's class,
+// and the unicast-response bit of a question's class (RFC 6762, section
+// 10.2 and 5.4).
+const cacheFlush = 0x8000
+
+// localRel returns name relative to the ".local." domain, lowercased.
+func localRel(name dnsmessage.Name) (rel string, ok bool) {
+	return strings.CutSuffix(strings.ToLower(name.String()), ".local.")
+}
+
+// handleResponse updates the gateway's view of the LAN from an mDNS
+// response.
+func (g *Gateway) handleResponse(msg *dnsmessage.Message) {
+	rrs := append(slices.Clip(msg.Answers), msg.Additionals...)
+	now := g.clock.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expireLocked(now)
+
+	// Instances are added by PTR records, and described by SRV and TXT
+	// records, and their hosts' addresses by A and AAAA records. Handle
+	// them in that order, as they may all arrive in the same packet.
+	for _, rr := range rrs {
+		if rr.Header.Class&^cacheFlush != dnsmessage.ClassINET {
+			continue
+		}
+		if ptr, ok := rr.Body.(*dnsmessage.PTRResource); ok {
+			g.handlePTRLocked(rr.Header, ptr, now)
+		}
+	}
+	for _, rr := range rrs {
+		if rr.Header.Class&^cacheFlush != dnsmessage.ClassINET {
+			continue
+		}
+		rel, ok := localRel(rr.Header.Name)
+		if !ok {
+			continue
+		}
+		in := g.instances[rel]
+		if in == nil {
+			continue
+		}
+		switch b := rr.Body.(type) {
+		case *dnsmessage.SRVResource:
+			target, ok := localRel(b.Target)
+			if !ok || strings.Contains(target, ".") {
+				continue
+			}
+			in.host, in.port = target, b.Port
+		case *dnsmessage.TXTResource:
+			if size := txtSize(b.TXT); size <= maxTXTBytes {
+				in.txt = slices.Clone(b.TXT)
+			}
+		}
+	}
+	for _, rr := range rrs {
+		if rr.Header.Class&^cacheFlush != dnsmessage.ClassINET {
+			continue
+		}
+		var ip netip.Addr
+		switch b := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			ip = netip.AddrFrom4(b.A)
+		case *dnsmessage.AAAAResource:
+			ip = netip.AddrFrom16(b.AAAA)
+		default:
+			continue
+		}
+		label, ok := localRel(rr.Header.Name)
+		if !ok || !g.hostReferencedLocked(label) {
+			continue
+		}
+		h := g.hosts[label]
+		if h == nil {
+			h = &host{addrs: make(map[netip.Addr]time.Time)}
+			g.hosts[label] = h
+		}
+		if rr.Header.TTL == 0 {
+			delete(h.addrs, ip)
+			continue
+		}
+		if _, ok := h.addrs[ip]; ok || len(h.addrs) < maxHostAddrs {
+			h.addrs[ip] = now.Add(time.Duration(rr.Header.TTL) * time.Second)
+		}
+	}
+}
+
+func (g *Gateway) handlePTRLocked(hdr dnsmessage.ResourceHeader, ptr *dnsmessage.PTRResource, now time.Time) {
+	typ, ok := localRel(hdr.Name)
+	if !ok || !g.types.Contains(typ) {
+		return
+	}
+	target := ptr.PTR.String()
+	rel, ok := strings.CutSuffix(target, ".local.")
+	if !ok {
+		return
+	}
+	if !strings.HasSuffix(strings.ToLower(rel), "."+typ) {
+		return
+	}
+	name := rel[:len(rel)-len(typ)-1]
+	if name == "" || g.isPublished(name, typ) {
+		// Don't bridge our own announcements back to the tailnet.
+		return
+	}
+	key := strings.ToLower(name) + "." + typ
+	if hdr.TTL == 0 {
+		delete(g.instances, key)
+		return
+	}
+	in := g.instances[key]
+	if in == nil {
+		if len(g.instances) >= maxInstances {
+			metricInstanceDropped.Add(1)
+			return
+		}
+		in = &instance{name: name, typ: typ}
+		g.instances[key] = in
+	}
+	in.expires = now.Add(time.Duration(hdr.TTL) * time.Second)
+}
+
+func (g *Gateway) isPublished(name, typ string) bool {
+	return slices.ContainsFunc(g.cfg.Publish, func(s Service) bool {
+		return strings.EqualFold(s.Instance, name) && strings.EqualFold(s.Type, typ)
+	})
+}
+
+func (g *Gateway) hostReferencedLocked(label string) bool {
+	for _, in := range g.instances {
+		if in.host == label {
+			return true
+		}
+	}
+	return false
+}
+
+// expireLocked removes expired instances and host addresses, and hosts
+// that are no longer referenced.
+func (g *Gateway) expireLocked(now time.Time) {
+	for k, in := range g.instances {
+		if now.After(in.expires) {
+			delete(g.instances, k)
+		}
+	}
+	for label, h := range g.hosts {
+		for ip, exp := range h.addrs {
+			if now.After(exp) {
+				delete(h.addrs, ip)
+			}
+		}
+		if len(h.addrs) == 0 || !g.hostReferencedLocked(label) {
+			delete(g.hosts, label)
+		}
+	}
+}
+
+func txtSize(txt []string) int {
+	n := 0
+	for _, s := range txt {
+		n += len(s) + 1
+	}
+	return n
+}
+
+// handleQuery answers an mDNS query from the LAN for the services the
+// gateway publishes.
+func (g *Gateway) handleQuery(msg *dnsmessage.Message, src netip.AddrPort) {
+	if len(g.cfg.Publish) == 0 {
+		return
+	}
+	resp, unicast, err := g.lanAnswer(msg)
+	if err != nil {
+		g.logf("answering LAN query: %v", err)
+		return
+	}
+	if resp == nil {
+		return
+	}
+	if !g.sendLimiter.Allow() {
+		metricLANDropped.Add(1)
+		return
+	}
+	dst := mdnsAddr4
+	if unicast {
+		dst = src
+	}
+	if _, err := g.conn.WriteToUDPAddrPort(resp, dst); err != nil {
+		g.logf("sending answer: %v", err)
+		return
+	}
+	metricLANAnswers.Add(1)
+}
+
+// lanAnswer returns the mDNS response to msg, or nil if the gateway has
+// nothing to say. It reports whether the querier asked for a unicast
+// response.
+func (g *Gateway) lanAnswer(msg *dnsmessage.Message) (resp []byte, unicast bool, err error) {
+	var rb recordBuilder
+	for _, q := range msg.Questions {
+		if q.Class&^cacheFlush != dnsmessage.ClassINET {
+			continue
+		}
+		rel, ok := localRel(q.Name)
+		if !ok {
+			continue
+		}
+		if q.Class&cacheFlush != 0 {
+			unicast = true
+		}
+		for _, s := range g.cfg.Publish {
+			typ := strings.ToLower(s.Type)
+			inst := strings.ToLower(s.Instance) + "." + typ
+			instName := s.Instance + "." + typ + ".local."
+			hostName := s.Host + ".local."
+			switch {
+			case rel == "_services._dns-sd._udp" && q.Type == dnsmessage.TypePTR:
+				rb.ptr(q.Name.String(), typ+".local.", 0)
+			case rel == typ && q.Type == dnsmessage.TypePTR:
+				rb.ptr(q.Name.String(), instName, 0)
+				rb.srv(instName, hostName, s.Port, cacheFlush, true)
+				rb.txt(instName, s.TXT, cacheFlush, true)
+				rb.addrs(hostName, s.Addrs, dnsmessage.TypeALL, cacheFlush, true)
+			case rel == inst:
+				if q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeALL {
+					rb.srv(instName, hostName, s.Port, cacheFlush, false)
+					rb.addrs(hostName, s.Addrs, dnsmessage.TypeALL, cacheFlush, true)
+				}
+				if q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL {
+					rb.txt(instName, s.TXT, cacheFlush, false)
+				}
+			case rel == strings.ToLower(s.Host):
+				rb.addrs(hostName, s.Addrs, q.Type, cacheFlush, false)
+			}
+		}
+	}
+	if len(rb.answers) == 0 {
+		return nil, false, rb.err
+	}
+	resp, err = rb.message(dnsmessage.Header{Response: true, Authoritative: true}, nil)
+	return resp, unicast, err
+}
+
+// recordBuilder accumulates DNS resource records, dropping duplicates.
+type recordBuilder struct {
+	answers     []dnsmessage.Resource
+	additionals []dnsmessage.Resource
+	seen        set.Set[string]
+	err         error
+}
+
+func (rb *recordBuilder) add(name string, class dnsmessage.Class, body dnsmessage.ResourceBody, additional bool) {
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		rb.err = cmp.Or(rb.err, err)
+		return
+	}
+	key := fmt.Sprintf("%s/%v/%v", strings.ToLower(name), body.GoString(), additional)
+	if rb.seen.Contains(key) {
+		return
+	}
+	if rb.seen == nil {
+		rb.seen = make(set.Set[string])
+	}
+	rb.seen.Add(key)
+	rr := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: n, Class: dnsmessage.ClassINET | class, TTL: zoneTTL},
+		Body:   body,
+	}
+	if additional {
+		rb.additionals = append(rb.additionals, rr)
+	} else {
+		rb.answers = append(rb.answers, rr)
+	}
+}
+
+func (rb *recordBuilder) ptr(name, target string, class dnsmessage.Class) {
+	t, err := dnsmessage.NewName(target)
+	if err != nil {
+		rb.err = cmp.Or(rb.err, err)
+		return
+	}
+	rb.add(name, class, &dnsmessage.PTRResource{PTR: t}, false)
+}
+
+func (rb *recordBuilder) srv(name, target string, port uint16, class dnsmessage.Class, additional bool) {
+	t, err := dnsmessage.NewName(target)
+	if err != nil {
+		rb.err = cmp.Or(rb.err, err)
+		return
+	}
+	rb.add(name, class, &dnsmessage.SRVResource{Port: port, Target: t}, additional)
+}
+
+func (rb *recordBuilder) txt(name string, txt []string, class dnsmessage.Class, additional bool) {
+	if len(txt) == 0 {
+		// RFC 6763, section 6.1: an empty TXT record has a single empty string.
+		txt = []string{""}
+	}
+	rb.add(name, class, &dnsmessage.TXTResource{TXT: txt}, additional)
+}
+
+// addrs adds A and AAAA records for addrs, as selected by typ.
+func (rb *recordBuilder) addrs(name string, addrs []netip.Addr, typ dnsmessage.Type, class dnsmessage.Class, additional bool) {
+	for _, ip := range addrs {
+		switch {
+		case ip.Is4() && (typ == dnsmessage.TypeA || typ == dnsmessage.TypeALL):
+			rb.add(name, class, &dnsmessage.AResource{A: ip.As4()}, additional)
+		case ip.Is6() && (typ == dnsmessage.TypeAAAA || typ == dnsmessage.TypeALL):
+			rb.add(name, class, &dnsmessage.AAAAResource{AAAA: ip.As16()}, additional)
+		}
+	}
+}
+
+// message returns a DNS message with the accumulated records.
+func (rb *recordBuilder) message(hdr dnsmessage.Header, questions []dnsmessage.Question) ([]byte, error) {
+	if rb.err != nil {
+		return nil, rb.err
+	}
+	msg := dnsmessage.Message{
+		Header:      hdr,
+		Questions:   questions,
+		Answers:     rb.answers,
+		Additionals: rb.additionals,
+	}
+	return msg.Pack()
+}
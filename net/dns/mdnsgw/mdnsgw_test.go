@@ -0,0 +1,347 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package mdnsgw
+
+import (
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstest"
+	"tailscale.com/types/logger"
+)
+
+func mustName(t *testing.T, s string) dnsmessage.Name {
+	t.Helper()
+	n, err := dnsmessage.NewName(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func rr(t *testing.T, name string, ttl uint32, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: mustName(t, name), Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   body,
+	}
+}
+
+// announce returns an mDNS response announcing a printer on the LAN with
+// the given TTL.
+func announce(t *testing.T, ttl uint32) *dnsmessage.Message {
+	return &dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: []dnsmessage.Resource{
+			rr(t, "_ipp._tcp.local.", ttl, &dnsmessage.PTRResource{PTR: mustName(t, "Office Printer._ipp._tcp.local.")}),
+		},
+		Additionals: []dnsmessage.Resource{
+			rr(t, "Office Printer._ipp._tcp.local.", ttl, &dnsmessage.SRVResource{Port: 631, Target: mustName(t, "printer.local.")}),
+			rr(t, "Office Printer._ipp._tcp.local.", ttl, &dnsmessage.TXTResource{TXT: []string{"rp=printers/1"}}),
+			rr(t, "printer.local.", ttl, &dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}}),
+			// Not of a bridged type; ignored.
+			rr(t, "_smb._tcp.local.", ttl, &dnsmessage.PTRResource{PTR: mustName(t, "NAS._smb._tcp.local.")}),
+		},
+	}
+}
+
+func query(t *testing.T, name string, typ dnsmessage.Type) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 1234, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: mustName(t, name), Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// records returns the string forms of the answers and additionals of the
+// packed DNS response b.
+func records(t *testing.T, b []byte) (rcode dnsmessage.RCode, answers, additionals []string) {
+	t.Helper()
+	var msg dnsmessage.Message
+	if err := msg.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	str := func(r dnsmessage.Resource) string {
+		switch b := r.Body.(type) {
+		case *dnsmessage.PTRResource:
+			return r.Header.Name.String() + " PTR " + b.PTR.String()
+		case *dnsmessage.SRVResource:
+			return r.Header.Name.String() + " SRV " + b.Target.String() + ":" + strconv.Itoa(int(b.Port))
+		case *dnsmessage.TXTResource:
+			return r.Header.Name.String() + " TXT " + strings.Join(b.TXT, ",")
+		case *dnsmessage.AResource:
+			return r.Header.Name.String() + " A " + netip.AddrFrom4(b.A).String()
+		case *dnsmessage.AAAAResource:
+			return r.Header.Name.String() + " AAAA " + netip.AddrFrom16(b.AAAA).String()
+		}
+		return r.Header.Name.String() + " " + r.Header.Type.String()
+	}
+	for _, r := range msg.Answers {
+		answers = append(answers, str(r))
+	}
+	for _, r := range msg.Additionals {
+		additionals = append(additionals, str(r))
+	}
+	return msg.Header.RCode, answers, additionals
+}
+
+func newTestGateway(t *testing.T, cfg Config) (*Gateway, *tstest.Clock) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	return newGateway(logger.Discard, cfg, clock), clock
+}
+
+func TestZone(t *testing.T) {
+	g, clock := newTestGateway(t, Config{
+		Domain:   "office.example.com.",
+		Services: []string{"_ipp._tcp", "_hap._tcp"},
+	})
+	g.handleResponse(announce(t, 300))
+
+	tests := []struct {
+		name        string
+		typ         dnsmessage.Type
+		rcode       dnsmessage.RCode
+		answers     []string
+		additionals []string
+	}{
+		{
+			name:    "b._dns-sd._udp.office.example.com.",
+			typ:     dnsmessage.TypePTR,
+			answers: []string{"b._dns-sd._udp.office.example.com. PTR office.example.com."},
+		},
+		{
+			name:    "_services._dns-sd._udp.office.example.com.",
+			typ:     dnsmessage.TypePTR,
+			answers: []string{"_services._dns-sd._udp.office.example.com. PTR _ipp._tcp.office.example.com."},
+		},
+		{
+			name:    "_IPP._tcp.office.example.com.",
+			typ:     dnsmessage.TypePTR,
+			answers: []string{"_IPP._tcp.office.example.com. PTR Office Printer._ipp._tcp.office.example.com."},
+		},
+		{
+			// Bridged, but nothing found.
+			name: "_hap._tcp.office.example.com.",
+			typ:  dnsmessage.TypePTR,
+		},
+		{
+			name:        "Office Printer._ipp._tcp.office.example.com.",
+			typ:         dnsmessage.TypeSRV,
+			answers:     []string{"Office Printer._ipp._tcp.office.example.com. SRV printer.office.example.com.:631"},
+			additionals: []string{"printer.office.example.com. A 192.168.1.20"},
+		},
+		{
+			name:    "Office Printer._ipp._tcp.office.example.com.",
+			typ:     dnsmessage.TypeTXT,
+			answers: []string{"Office Printer._ipp._tcp.office.example.com. TXT rp=printers/1"},
+		},
+		{
+			name:    "printer.office.example.com.",
+			typ:     dnsmessage.TypeA,
+			answers: []string{"printer.office.example.com. A 192.168.1.20"},
+		},
+		{
+			name: "printer.office.example.com.",
+			typ:  dnsmessage.TypeAAAA,
+		},
+		{
+			name: "office.example.com.",
+			typ:  dnsmessage.TypeA,
+		},
+		{
+			name:  "NAS._smb._tcp.office.example.com.",
+			typ:   dnsmessage.TypeSRV,
+			rcode: dnsmessage.RCodeNameError,
+		},
+		{
+			name:  "nas.office.example.com.",
+			typ:   dnsmessage.TypeA,
+			rcode: dnsmessage.RCodeNameError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.typ.String(), func(t *testing.T) {
+			res, err := g.Respond(query(t, tt.name, tt.typ))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rcode, answers, additionals := records(t, res)
+			if rcode != tt.rcode {
+				t.Errorf("rcode = %v; want %v", rcode, tt.rcode)
+			}
+			if !slices.Equal(answers, tt.answers) {
+				t.Errorf("answers = %q; want %q", answers, tt.answers)
+			}
+			if !slices.Equal(additionals, tt.additionals) {
+				t.Errorf("additionals = %q; want %q", additionals, tt.additionals)
+			}
+		})
+	}
+
+	if _, err := g.Respond(query(t, "www.example.com.", dnsmessage.TypeA)); err == nil {
+		t.Error("Respond outside the zone succeeded; want error")
+	}
+
+	// Announcements expire with their TTL.
+	clock.Advance(301 * time.Second)
+	res, err := g.Respond(query(t, "printer.office.example.com.", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcode, _, _ := records(t, res); rcode != dnsmessage.RCodeNameError {
+		t.Errorf("after expiry, rcode = %v; want NXDOMAIN", rcode)
+	}
+}
+
+func TestGoodbye(t *testing.T) {
+	g, _ := newTestGateway(t, Config{Domain: "office.example.com.", Services: []string{"_ipp._tcp"}})
+	g.handleResponse(announce(t, 300))
+	if len(g.instances) != 1 {
+		t.Fatalf("got %d instances; want 1", len(g.instances))
+	}
+	// A TTL of zero removes the instance (RFC 6762, section 10.1).
+	g.handleResponse(announce(t, 0))
+	if len(g.instances) != 0 {
+		t.Errorf("got %d instances after goodbye; want 0", len(g.instances))
+	}
+}
+
+func TestInstanceLimit(t *testing.T) {
+	g, _ := newTestGateway(t, Config{Domain: "office.example.com.", Services: []string{"_ipp._tcp"}})
+	msg := &dnsmessage.Message{Header: dnsmessage.Header{Response: true}}
+	for i := range maxInstances + 10 {
+		msg.Answers = append(msg.Answers, rr(t, "_ipp._tcp.local.", 120,
+			&dnsmessage.PTRResource{PTR: mustName(t, "Printer "+strconv.Itoa(i)+"._ipp._tcp.local.")}))
+	}
+	g.handleResponse(msg)
+	if len(g.instances) != maxInstances {
+		t.Errorf("got %d instances; want %d", len(g.instances), maxInstances)
+	}
+}
+
+func TestLANAnswer(t *testing.T) {
+	g, _ := newTestGateway(t, Config{
+		Domain:   "office.example.com.",
+		Services: []string{"_ipp._tcp"},
+		Publish: []Service{{
+			Instance: "Build Farm",
+			Type:     "_ssh._tcp",
+			Host:     "buildfarm",
+			Addrs:    []netip.Addr{netip.MustParseAddr("100.64.0.5")},
+			Port:     22,
+		}},
+	})
+
+	q := &dnsmessage.Message{Questions: []dnsmessage.Question{{
+		Name:  mustName(t, "_ssh._tcp.local."),
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET | cacheFlush, // QU bit
+	}}}
+	res, unicast, err := g.lanAnswer(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !unicast {
+		t.Error("unicast = false; want true for QU question")
+	}
+	_, answers, additionals := records(t, res)
+	wantAnswers := []string{"_ssh._tcp.local. PTR Build Farm._ssh._tcp.local."}
+	wantAdditionals := []string{
+		"Build Farm._ssh._tcp.local. SRV buildfarm.local.:22",
+		"Build Farm._ssh._tcp.local. TXT ",
+		"buildfarm.local. A 100.64.0.5",
+	}
+	if !slices.Equal(answers, wantAnswers) {
+		t.Errorf("answers = %q; want %q", answers, wantAnswers)
+	}
+	if !slices.Equal(additionals, wantAdditionals) {
+		t.Errorf("additionals = %q; want %q", additionals, wantAdditionals)
+	}
+
+	q.Questions[0].Name = mustName(t, "_ipp._tcp.local.")
+	if res, _, err := g.lanAnswer(q); err != nil || res != nil {
+		t.Errorf("query for unpublished type = %x, %v; want nil, nil", res, err)
+	}
+
+	// The gateway's own announcements aren't bridged back to the tailnet.
+	g2, _ := newTestGateway(t, Config{
+		Domain:   "office.example.com.",
+		Services: []string{"_ssh._tcp"},
+		Publish:  g.cfg.Publish,
+	})
+	var resMsg dnsmessage.Message
+	if err := resMsg.Unpack(res0(t, g)); err != nil {
+		t.Fatal(err)
+	}
+	resMsg.Header.Response = true
+	g2.handleResponse(&resMsg)
+	if len(g2.instances) != 0 {
+		t.Errorf("gateway bridged its own announcement: %v", g2.instances)
+	}
+}
+
+// res0 returns g's answer to a PTR query for its first published service.
+func res0(t *testing.T, g *Gateway) []byte {
+	q := &dnsmessage.Message{Questions: []dnsmessage.Question{{
+		Name:  mustName(t, g.cfg.Publish[0].Type+".local."),
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET,
+	}}}
+	res, _, err := g.lanAnswer(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestSelfConfigAndGatewayPeers(t *testing.T) {
+	capMap := tailcfg.NodeCapMap{
+		tailcfg.NodeAttrMDNSGateway: []tailcfg.RawMessage{
+			`{"domain":"office.example.com","gateways":["tag:office-gw"],"services":["_ipp._tcp"]}`,
+			`{"domain":"lab.example.com","gateways":["tag:lab-gw"],"services":["_hap._tcp"]}`,
+		},
+	}
+	self := (&tailcfg.Node{ID: 1, Tags: []string{"tag:office-gw"}, CapMap: capMap}).View()
+	online, offline := true, false
+	peers := map[tailcfg.NodeID]tailcfg.NodeView{
+		2: (&tailcfg.Node{ID: 2, Tags: []string{"tag:lab-gw"}, Online: &offline}).View(),
+		3: (&tailcfg.Node{ID: 3, Tags: []string{"tag:lab-gw"}, Online: &online}).View(),
+		4: (&tailcfg.Node{ID: 4, Tags: []string{"tag:office-gw"}}).View(),
+		5: (&tailcfg.Node{ID: 5}).View(),
+	}
+
+	cfg, ok := SelfConfig(self)
+	if !ok {
+		t.Fatal("SelfConfig: not a gateway")
+	}
+	if cfg.Domain != "office.example.com." || !slices.Equal(cfg.Services, []string{"_ipp._tcp"}) {
+		t.Errorf("SelfConfig = %+v", cfg)
+	}
+
+	got := PickGatewayPeers(self, peers)
+	if len(got) != 1 {
+		t.Fatalf("PickGatewayPeers returned %d zones; want 1 (lab only)", len(got))
+	}
+	var ids []tailcfg.NodeID
+	for _, p := range got["lab.example.com."] {
+		ids = append(ids, p.ID())
+	}
+	if want := []tailcfg.NodeID{3, 2}; !slices.Equal(ids, want) {
+		t.Errorf("lab gateways = %v; want %v (online first)", ids, want)
+	}
+
+	if _, ok := SelfConfig((&tailcfg.Node{CapMap: capMap}).View()); ok {
+		t.Error("SelfConfig for untagged node; want not a gateway")
+	}
+}
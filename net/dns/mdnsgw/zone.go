@@ -0,0 +1,145 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package mdnsgw
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"tailscale.com/util/dnsname"
+)
+
+// Handles reports whether name is in the gateway's zone.
+func (g *Gateway) Handles(name dnsname.FQDN) bool {
+	return g.cfg.Domain.Contains(name)
+}
+
+// browseDomainLabels are the names under a domain that DNS-SD clients query
+// to find out whether it's a browsing domain (RFC 6763, section 11).
+var browseDomainLabels = []string{"b._dns-sd._udp", "db._dns-sd._udp", "lb._dns-sd._udp"}
+
+// Respond returns the DNS response to query, which must be for a name in
+// the gateway's zone.
+//
+// The zone has a DNS-SD browsing domain at its apex that lists the service
+// instances the gateway has discovered on its LAN, with their hosts'
+// addresses under it: an instance "Office Printer._ipp._tcp.local." on host
+// "printer.local." is served as "Office Printer._ipp._tcp.<zone>." with an
+// SRV record pointing at "printer.<zone>.".
+func (g *Gateway) Respond(query []byte) ([]byte, error) {
+	metricZoneQueries.Add(1)
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(q.Name.String())
+	rel, ok := strings.CutSuffix(name, string(g.cfg.Domain))
+	if !ok || (rel != "" && !strings.HasSuffix(rel, ".")) {
+		return nil, fmt.Errorf("%q not in zone %q", name, g.cfg.Domain)
+	}
+	rel = strings.TrimSuffix(rel, ".")
+	zone := string(g.cfg.Domain)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expireLocked(g.clock.Now())
+
+	var rb recordBuilder
+	exists := true
+	switch {
+	case rel == "":
+		// The zone apex.
+	case slices.Contains(browseDomainLabels, rel):
+		if q.Type == dnsmessage.TypePTR {
+			rb.ptr(q.Name.String(), zone, 0)
+		}
+	case rel == "_services._dns-sd._udp":
+		if q.Type == dnsmessage.TypePTR {
+			for _, t := range g.activeTypesLocked() {
+				rb.ptr(q.Name.String(), t+"."+zone, 0)
+			}
+		}
+	case g.types.Contains(rel):
+		if q.Type == dnsmessage.TypePTR {
+			for _, in := range g.sortedInstancesLocked() {
+				if in.typ == rel {
+					rb.ptr(q.Name.String(), in.name+"."+in.typ+"."+zone, 0)
+				}
+			}
+		}
+	case g.instances[rel] != nil:
+		in := g.instances[rel]
+		if in.host != "" && (q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeALL) {
+			target := in.host + "." + zone
+			rb.srv(q.Name.String(), target, in.port, 0, false)
+			rb.addrs(target, g.hostAddrsLocked(in.host), dnsmessage.TypeALL, 0, true)
+		}
+		if q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL {
+			rb.txt(q.Name.String(), in.txt, 0, false)
+		}
+	case g.hosts[rel] != nil:
+		rb.addrs(q.Name.String(), g.hostAddrsLocked(rel), q.Type, 0, false)
+	default:
+		exists = false
+	}
+
+	rcode := dnsmessage.RCodeSuccess
+	if !exists {
+		rcode = dnsmessage.RCodeNameError
+	}
+	return rb.message(dnsmessage.Header{
+		ID:               hdr.ID,
+		Response:         true,
+		Authoritative:    true,
+		RecursionDesired: hdr.RecursionDesired,
+		RCode:            rcode,
+	}, []dnsmessage.Question{q})
+}
+
+// activeTypesLocked returns the sorted service types that have at least one
+// discovered instance.
+func (g *Gateway) activeTypesLocked() []string {
+	var types []string
+	for _, in := range g.instances {
+		if !slices.Contains(types, in.typ) {
+			types = append(types, in.typ)
+		}
+	}
+	slices.Sort(types)
+	return types
+}
+
+// sortedInstancesLocked returns the discovered instances, sorted by name.
+func (g *Gateway) sortedInstancesLocked() []*instance {
+	ins := make([]*instance, 0, len(g.instances))
+	for _, in := range g.instances {
+		ins = append(ins, in)
+	}
+	slices.SortFunc(ins, func(a, b *instance) int {
+		return strings.Compare(a.name+"."+a.typ, b.name+"."+b.typ)
+	})
+	return ins
+}
+
+// hostAddrsLocked returns the sorted addresses of the LAN host label.
+func (g *Gateway) hostAddrsLocked(label string) []netip.Addr {
+	h := g.hosts[label]
+	if h == nil {
+		return nil
+	}
+	addrs := make([]netip.Addr, 0, len(h.addrs))
+	for ip := range h.addrs {
+		addrs = append(addrs, ip)
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	return addrs
+}
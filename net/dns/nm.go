@@ -192,9 +192,20 @@ func (m *nmManager) trySet(ctx context.Context, config OSConfig) error {
 	// effectively fine. We used to try and enforce LLMNR and mdns
 	// settings here, but that led to #1870.
 
+	// The resolver options are left unset unless configured, for
+	// NetworkManagers that predate them.
+	setOptions := func(m map[string]dbus.Variant) {
+		if opts := config.Options.resolvConfOptions(); len(opts) > 0 {
+			m["dns-options"] = dbus.MakeVariant(opts)
+		} else {
+			delete(m, "dns-options")
+		}
+	}
+
 	ipv4Map := settings["ipv4"]
 	ipv4Map["dns"] = dbus.MakeVariant(dnsv4)
 	ipv4Map["dns-search"] = dbus.MakeVariant(search)
+	setOptions(ipv4Map)
 	// We should only request priority if we have nameservers to set.
 	if len(dnsv4) == 0 {
 		ipv4Map["dns-priority"] = dbus.MakeVariant(lowerPriority)
@@ -234,6 +245,7 @@ func (m *nmManager) trySet(ctx context.Context, config OSConfig) error {
 
 	ipv6Map["dns"] = dbus.MakeVariant(dnsv6)
 	ipv6Map["dns-search"] = dbus.MakeVariant(search)
+	setOptions(ipv6Map)
 	if len(dnsv6) == 0 {
 		ipv6Map["dns-priority"] = dbus.MakeVariant(lowerPriority)
 	} else if len(config.MatchDomains) > 0 {
@@ -54,6 +54,7 @@
 // Table (NRPT).
 type nrptRuleDatabase struct {
 	logf               logger.Logf
+	onGPRefresh        func() // or nil
 	watcher            *gp.ChangeWatcher
 	isGPRefreshPending atomic.Bool
 	mu                 sync.Mutex // protects the fields below
@@ -62,8 +63,11 @@ type nrptRuleDatabase struct {
 	writeAsGP          bool
 }
 
-func newNRPTRuleDatabase(logf logger.Logf) *nrptRuleDatabase {
-	ret := &nrptRuleDatabase{logf: logf}
+// newNRPTRuleDatabase returns a new nrptRuleDatabase. If onGPRefresh is
+// non-nil, it's called after each machine group policy refresh that the
+// database didn't initiate itself, which may have reset the NRPT rules.
+func newNRPTRuleDatabase(logf logger.Logf, onGPRefresh func()) *nrptRuleDatabase {
+	ret := &nrptRuleDatabase{logf: logf, onGPRefresh: onGPRefresh}
 	ret.loadRuleSubkeyNames()
 	ret.detectWriteAsGP()
 	ret.watchForGPChanges()
@@ -362,6 +366,9 @@ func (db *nrptRuleDatabase) watchForGPChanges() {
 		}
 		db.logf("Computer group policies refreshed, reconfiguring NRPT rule database.")
 		db.detectWriteAsGP()
+		if db.onGPRefresh != nil {
+			db.onGPRefresh()
+		}
 	}
 
 	watcher, err := gp.NewChangeWatcher(gp.MachinePolicy, watchHandler)
@@ -55,7 +55,7 @@ func (m openresolvManager) SetDNS(config OSConfig) error {
 	}
 
 	var stdin bytes.Buffer
-	writeResolvConf(&stdin, config.Nameservers, config.SearchDomains)
+	writeResolvConf(&stdin, config.Nameservers, config.SearchDomains, config.Options)
 
 	cmd := exec.Command("resolvconf", "-m", "0", "-x", "-a", "tailscale")
 	cmd.Stdin = &stdin
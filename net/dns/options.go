@@ -0,0 +1,102 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dns
+
+import (
+	"fmt"
+	"time"
+)
+
+// SearchOrder is the order of Tailscale's search domains relative to the OS's
+// other search domains.
+type SearchOrder string
+
+const (
+	// SearchOrderTailscaleFirst puts Tailscale's search domains first. It's
+	// the default.
+	SearchOrderTailscaleFirst SearchOrder = "tailscale-first"
+
+	// SearchOrderOSFirst puts the OS's other search domains first, so that
+	// single-label names resolve as they would without Tailscale where they
+	// can, such as for Kubernetes cluster names.
+	SearchOrderOSFirst SearchOrder = "os-first"
+)
+
+// Limits of [ResolverOptions], as in resolv.conf(5).
+const (
+	maxNdots    = 15
+	maxTimeout  = 30 * time.Second
+	maxAttempts = 5
+)
+
+// ResolverOptions are resolv.conf(5)-style options for resolving names with
+// the DNS configuration that Tailscale manages. Each is left to the OS (or,
+// for the quad-100 forwarder, to its defaults) if zero.
+//
+// Not every OS supports every option; the OSConfigurator applies those it
+// can. The forwarder applies Timeout and Attempts to its upstream queries.
+type ResolverOptions struct {
+	// Ndots is the number of dots a name must have to be tried as an
+	// absolute name before the search domains are appended to it.
+	Ndots int
+
+	// Timeout is how long to wait for a nameserver to respond to a query
+	// before retrying it.
+	Timeout time.Duration
+
+	// Attempts is how many times to query each nameserver before giving
+	// up on it.
+	Attempts int
+
+	// SearchOrder is the order of Tailscale's search domains relative to the
+	// OS's other ones, where Tailscale merges them into its configuration.
+	// Empty means [SearchOrderTailscaleFirst].
+	SearchOrder SearchOrder
+}
+
+// IsZero reports whether o leaves every option to the default.
+func (o ResolverOptions) IsZero() bool {
+	return o == ResolverOptions{}
+}
+
+// Check returns an error if any of o's options is out of range.
+func (o ResolverOptions) Check() error {
+	if o.Ndots < 0 || o.Ndots > maxNdots {
+		return fmt.Errorf("ndots %d out of range [0, %d]", o.Ndots, maxNdots)
+	}
+	if o.Timeout < 0 || o.Timeout > maxTimeout {
+		return fmt.Errorf("timeout %v out of range [0, %v]", o.Timeout, maxTimeout)
+	}
+	if o.Attempts < 0 || o.Attempts > maxAttempts {
+		return fmt.Errorf("attempts %d out of range [0, %d]", o.Attempts, maxAttempts)
+	}
+	switch o.SearchOrder {
+	case "", SearchOrderTailscaleFirst, SearchOrderOSFirst:
+	default:
+		return fmt.Errorf("unknown search order %q; want %q or %q", o.SearchOrder, SearchOrderTailscaleFirst, SearchOrderOSFirst)
+	}
+	return nil
+}
+
+// timeoutSeconds returns o.Timeout in whole seconds, as resolv.conf(5) has
+// it, rounding up, or zero if it's the default.
+func (o ResolverOptions) timeoutSeconds() int {
+	return int((o.Timeout + time.Second - 1) / time.Second)
+}
+
+// resolvConfOptions returns the resolv.conf(5) "options" of o, such as
+// "ndots:2".
+func (o ResolverOptions) resolvConfOptions() []string {
+	var opts []string
+	if o.Ndots > 0 {
+		opts = append(opts, fmt.Sprintf("ndots:%d", o.Ndots))
+	}
+	if s := o.timeoutSeconds(); s > 0 {
+		opts = append(opts, fmt.Sprintf("timeout:%d", s))
+	}
+	if o.Attempts > 0 {
+		opts = append(opts, fmt.Sprintf("attempts:%d", o.Attempts))
+	}
+	return opts
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dns
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestResolverOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ResolverOptions
+		wantErr bool
+		want    []string
+	}{
+		{name: "zero"},
+		{
+			name: "all",
+			opts: ResolverOptions{Ndots: 2, Timeout: 1500 * time.Millisecond, Attempts: 3, SearchOrder: SearchOrderOSFirst},
+			want: []string{"ndots:2", "timeout:2", "attempts:3"},
+		},
+		{
+			name: "max",
+			opts: ResolverOptions{Ndots: maxNdots, Timeout: maxTimeout, Attempts: maxAttempts},
+			want: []string{"ndots:15", "timeout:30", "attempts:5"},
+		},
+		{name: "ndots-range", opts: ResolverOptions{Ndots: 16}, wantErr: true},
+		{name: "timeout-range", opts: ResolverOptions{Timeout: time.Minute}, wantErr: true},
+		{name: "attempts-range", opts: ResolverOptions{Attempts: -1}, wantErr: true},
+		{name: "search-order", opts: ResolverOptions{SearchOrder: "last"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Check()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check = %v; want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := tt.opts.resolvConfOptions(); !slices.Equal(got, tt.want) {
+				t.Errorf("resolvConfOptions = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -66,6 +66,9 @@ type OSConfig struct {
 	// from the OS, which will only work with OSConfigurators that
 	// report SupportsSplitDNS()=true.
 	MatchDomains []dnsname.FQDN
+	// Options are resolver options to apply along with Nameservers and
+	// SearchDomains, where the OS supports them.
+	Options ResolverOptions
 }
 
 func (o *OSConfig) WriteToBufioWriter(w *bufio.Writer) {
@@ -83,6 +86,9 @@ func (o *OSConfig) WriteToBufioWriter(w *bufio.Writer) {
 	if len(o.SearchDomains) > 0 {
 		fmt.Fprintf(w, "SearchDomains:%v ", o.SearchDomains)
 	}
+	if !o.Options.IsZero() {
+		fmt.Fprintf(w, "Options:%+v ", o.Options)
+	}
 	if len(o.MatchDomains) > 0 {
 		w.WriteString("MatchDomains:[")
 		sp := ""
@@ -108,7 +114,8 @@ func (o OSConfig) IsZero() bool {
 	return len(o.Hosts) == 0 &&
 		len(o.Nameservers) == 0 &&
 		len(o.SearchDomains) == 0 &&
-		len(o.MatchDomains) == 0
+		len(o.MatchDomains) == 0 &&
+		o.Options.IsZero()
 }
 
 func (a OSConfig) Equal(b OSConfig) bool {
@@ -124,6 +131,9 @@ func (a OSConfig) Equal(b OSConfig) bool {
 	if len(a.MatchDomains) != len(b.MatchDomains) {
 		return false
 	}
+	if a.Options != b.Options {
+		return false
+	}
 
 	for i := range a.Hosts {
 		ha, hb := a.Hosts[i], b.Hosts[i]
@@ -184,7 +194,11 @@ func (a OSConfig) Format(f fmt.State, verb rune) {
 			}
 			fmt.Fprintf(w, "%+v", domain)
 		}
-		w.WriteString(`] Hosts:[`)
+		w.WriteString(`]`)
+		if !a.Options.IsZero() {
+			fmt.Fprintf(w, " Options:%+v", a.Options)
+		}
+		w.WriteString(` Hosts:[`)
 		for i, host := range a.Hosts {
 			if i != 0 {
 				w.WriteString(" ")
@@ -51,5 +51,6 @@ func TestIsZero(t *testing.T) {
 			Addr:  netip.AddrFrom4([4]byte{100, 1, 2, 3}),
 			Hosts: []string{"foo", "bar"},
 		},
+		reflect.TypeFor[ResolverOptions](): ResolverOptions{Ndots: 2},
 	})
 }
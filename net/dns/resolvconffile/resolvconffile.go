@@ -34,6 +34,9 @@ type Config struct {
 	// single-label name queries. SearchDomains is additive to
 	// whatever non-Tailscale search domains the OS has.
 	SearchDomains []dnsname.FQDN
+
+	// Options are the resolver options, such as "ndots:2".
+	Options []string
 }
 
 // Write writes c to w. It does so in one Write call.
@@ -55,6 +58,11 @@ func (c *Config) Write(w io.Writer) error {
 		}
 		io.WriteString(buf, "\n")
 	}
+	if len(c.Options) > 0 {
+		io.WriteString(buf, "options ")
+		io.WriteString(buf, strings.Join(c.Options, " "))
+		io.WriteString(buf, "\n")
+	}
 	_, err := w.Write(buf.Bytes())
 	return err
 }
@@ -81,6 +89,15 @@ func Parse(r io.Reader) (*Config, error) {
 			continue
 		}
 
+		if s, ok := strings.CutPrefix(line, "options"); ok {
+			opts := strings.Fields(s)
+			if len(opts) > 0 && len(strings.TrimLeft(s, " \t")) == len(s) {
+				return nil, fmt.Errorf("missing space after \"options\" in %q", line)
+			}
+			config.Options = append(config.Options, opts...)
+			continue
+		}
+
 		if s, ok := strings.CutPrefix(line, "search"); ok {
 			domains := strings.TrimSpace(s)
 			if len(domains) == len(s) {
@@ -81,6 +81,13 @@ func TestParse(t *testing.T) {
 				},
 			},
 		},
+
+		{in: "options ndots:2 timeout:1\noptions attempts:3 # comment",
+			want: &Config{
+				Options: []string{"ndots:2", "timeout:1", "attempts:3"},
+			},
+		},
+		{in: `optionsndots:2`, wantErr: true},
 	}
 
 	for _, tt := range tests {
@@ -101,3 +108,25 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteOptions(t *testing.T) {
+	c := &Config{
+		Nameservers:   []netip.Addr{netip.MustParseAddr("100.100.100.100")},
+		SearchDomains: []dnsname.FQDN{"tailnet.ts.net."},
+		Options:       []string{"ndots:2", "attempts:3"},
+	}
+	var buf strings.Builder
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "search tailnet.ts.net\noptions ndots:2 attempts:3\n") {
+		t.Errorf("wrote:\n%s\nwant options line after search", buf.String())
+	}
+	got, err := Parse(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("round trip: got %+v; want %+v", got, c)
+	}
+}
@@ -345,6 +345,12 @@ type forwarder struct {
 	// queries directly - but we didn't configure it with any upstream resolvers.
 	// That's an error, but not a health error if the user has disabled CorpDNS.
 	acceptDNS bool
+
+	// upstreamTimeout and upstreamAttempts are the configured timeout
+	// and number of attempts of queries to each upstream resolver, or
+	// zero for the defaults of no timeout of their own and one attempt.
+	upstreamTimeout  time.Duration
+	upstreamAttempts int
 }
 
 func newForwarder(logf logger.Logf, netMon *netmon.Monitor, linkSel ForwardLinkSelector, dialer *tsdial.Dialer, health *health.Tracker, knobs *controlknobs.Knobs) *forwarder {
@@ -456,6 +462,42 @@ func cloudResolvers() []resolverAndDelay {
 // Resolver.SetConfig on reconfig.
 //
 // The memory referenced by routesBySuffix should not be modified.
+// setUpstreamOptions sets the timeout and number of attempts of queries to
+// each upstream resolver, either of which may be zero for the default.
+func (f *forwarder) setUpstreamOptions(timeout time.Duration, attempts int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.upstreamTimeout = timeout
+	f.upstreamAttempts = attempts
+}
+
+// sendAttempts sends fq to rr as send does, making up to the configured
+// number of attempts, each bounded by the configured timeout.
+func (f *forwarder) sendAttempts(ctx context.Context, fq *forwardQuery, rr resolverAndDelay) (ret []byte, err error) {
+	f.mu.Lock()
+	timeout, attempts := f.upstreamTimeout, max(f.upstreamAttempts, 1)
+	f.mu.Unlock()
+	for i := range attempts {
+		if i > 0 {
+			metricDNSFwdRetry.Add(1)
+		}
+		actx, cancel := ctx, func() {}
+		if timeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		ret, err = f.send(actx, fq, rr)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return ret, err
+		}
+		if _, ok := errors.AsType[rcodeResponseError](err); ok {
+			// The resolver answered; asking again won't help.
+			return ret, err
+		}
+	}
+	return ret, err
+}
+
 func (f *forwarder) setRoutes(routesBySuffix map[dnsname.FQDN][]*dnstype.Resolver, acceptDNS bool) {
 	routes := make([]route, 0, len(routesBySuffix))
 
@@ -636,6 +678,7 @@ func (f *forwarder) send(ctx context.Context, fq *forwardQuery, rr resolverAndDe
 		if err != nil {
 			return nil, err
 		}
+		noteTransport(ctx, "peerapi-doh")
 		// Check response size and set TC flag if needed (only for UDP queries)
 		res = checkResponseSizeAndSetTC(res, fq.packet, fq.family, f.logf)
 		return res, nil
@@ -653,6 +696,7 @@ func (f *forwarder) send(ctx context.Context, fq *forwardQuery, rr resolverAndDe
 			if err != nil {
 				return nil, err
 			}
+			noteTransport(ctx, "doh")
 			// Check response size and set TC flag if needed (only for UDP queries)
 			res = checkResponseSizeAndSetTC(res, fq.packet, fq.family, f.logf)
 			return res, nil
@@ -689,6 +733,7 @@ func (f *forwarder) send(ctx context.Context, fq *forwardQuery, rr resolverAndDe
 		if err != nil {
 			return nil, err
 		}
+		noteTransport(ctx, "udp")
 		if !truncatedFlagSet(resp) {
 			// Successful, non-truncated response; no retry.
 			return resp, nil
@@ -725,7 +770,11 @@ func (f *forwarder) send(ctx context.Context, fq *forwardQuery, rr resolverAndDe
 			return nil, ctx.Err()
 		}
 
-		return f.sendTCP(ctx, fq, rr)
+		resp, err := f.sendTCP(ctx, fq, rr)
+		if err == nil {
+			noteTransport(ctx, "tcp")
+		}
+		return resp, err
 	}
 
 	// If the input query is TCP, then don't have a timeout between
@@ -807,6 +856,10 @@ func (f *forwarder) sendUDP(ctx context.Context, fq *forwardQuery, rr resolverAn
 
 	fq.closeOnCtxDone.Add(conn)
 	defer fq.closeOnCtxDone.Remove(conn)
+	if d, ok := ctx.Deadline(); ok {
+		// The attempt may time out before the query as a whole.
+		conn.SetReadDeadline(d)
+	}
 
 	if _, err := conn.WriteToUDPAddrPort(fq.packet, ipp); err != nil {
 		metricDNSFwdUDPErrorWrite.Add(1)
@@ -1056,6 +1109,14 @@ func applySchemes(logf logger.Logf, rrs []resolverAndDelay, schemes views.Map[st
 
 // resolvers returns the resolvers to use for domain.
 func (f *forwarder) resolvers(domain dnsname.FQDN) []resolverAndDelay {
+	rrs, _, _ := f.route(domain)
+	return rrs
+}
+
+// route returns the resolvers to use for domain, and the suffix of the route
+// they're from, or, if they're the cloud host's fallback resolvers,
+// fallback.
+func (f *forwarder) route(domain dnsname.FQDN) (_ []resolverAndDelay, suffix dnsname.FQDN, fallback bool) {
 	f.mu.Lock()
 	routes := f.routes
 	cloudHostFallback := f.cloudHostFallback
@@ -1071,10 +1132,10 @@ func (f *forwarder) resolvers(domain dnsname.FQDN) []resolverAndDelay {
 		// route, fall through to the next matching route. If the resolvers
 		// were configured to be empty allow resolved to be empty.
 		if len(resolved) > 0 || len(route.Resolvers) == 0 {
-			return resolved
+			return resolved, route.Suffix, false
 		}
 	}
-	return cloudHostFallback // or nil if no fallback
+	return cloudHostFallback, "", cloudHostFallback != nil // or nil if no fallback
 }
 
 // GetUpstreamResolvers returns the resolvers that would be used to resolve
@@ -1147,6 +1208,12 @@ type forwardQuery struct {
 	// ...
 }
 
+// sendResult is a response from an upstream resolver.
+type sendResult struct {
+	res      []byte
+	resolver int // index of the resolver in those queried
+}
+
 // forwardWithDestChan forwards the query to all upstream nameservers
 // and waits for the first response.
 //
@@ -1191,8 +1258,23 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 
 	clampEDNSSize(query.bs, maxResponseBytes)
 
+	tr := queryTracerFrom(ctx)
 	if len(resolvers) == 0 {
-		resolvers = f.resolvers(domain)
+		var suffix dnsname.FQDN
+		var fallback bool
+		resolvers, suffix, fallback = f.route(domain)
+		if tr != nil {
+			switch {
+			case len(resolvers) == 0:
+				tr.setRoute(dnstype.RouteNone, "")
+			case fallback:
+				tr.setRoute(dnstype.RouteFallback, "")
+			case suffix == ".":
+				tr.setRoute(dnstype.RouteDefault, "")
+			default:
+				tr.setRoute(dnstype.RouteSplit, suffix)
+			}
+		}
 		if len(resolvers) == 0 {
 			metricDNSFwdErrorNoUpstream.Add(1)
 			if f.acceptDNS {
@@ -1230,10 +1312,14 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 		f.logf("request(%d, %v, %d, %s) %d...", fq.txid, typ, len(domain), domainSig, len(fq.packet))
 	}
 
-	resc := make(chan []byte, 1) // it's fine buffered or not
-	errc := make(chan error, 1)  // it's fine buffered or not too
+	if tr != nil {
+		tr.setUpstreams(resolvers)
+	}
+
+	resc := make(chan sendResult, 1) // it's fine buffered or not
+	errc := make(chan error, 1)      // it's fine buffered or not too
 	for i := range resolvers {
-		go func(rr *resolverAndDelay) {
+		go func(i int, rr *resolverAndDelay) {
 			if rr.startDelay > 0 {
 				timer := time.NewTimer(rr.startDelay)
 				select {
@@ -1243,7 +1329,23 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 					return
 				}
 			}
-			resb, err := f.send(ctx, fq, *rr)
+			sendCtx := ctx
+			var start time.Time
+			if tr != nil {
+				sendCtx = context.WithValue(ctx, upstreamTraceKey{}, upstreamTrace{tr, i})
+				start = time.Now()
+				tr.updateUpstream(i, func(u *dnstype.UpstreamTrace) { u.Sent = true })
+			}
+			resb, err := f.sendAttempts(sendCtx, fq, *rr)
+			if tr != nil {
+				d := time.Since(start)
+				tr.updateUpstream(i, func(u *dnstype.UpstreamTrace) {
+					u.Duration = d
+					if err != nil {
+						u.Err = err.Error()
+					}
+				})
+			}
 			if err != nil {
 				err = fmt.Errorf("resolving using %q: %w", rr.name.Addr, err)
 				select {
@@ -1253,10 +1355,10 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 				return
 			}
 			select {
-			case resc <- resb:
+			case resc <- sendResult{resb, i}:
 			case <-ctx.Done():
 			}
-		}(&resolvers[i])
+		}(i, &resolvers[i])
 	}
 
 	var firstErr error
@@ -1264,7 +1366,8 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 	var sawNonRefused bool
 	for {
 		select {
-		case v := <-resc:
+		case r := <-resc:
+			v := r.res
 			select {
 			case <-ctx.Done():
 				metricDNSFwdErrorContext.Add(1)
@@ -1273,6 +1376,9 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 				if f.verboseFwd {
 					f.logf("response(%d, %v, %d) = %d, nil", fq.txid, typ, len(domain), len(v))
 				}
+				if tr != nil {
+					tr.updateUpstream(r.resolver, func(u *dnstype.UpstreamTrace) { u.Answered = true })
+				}
 				metricDNSFwdSuccess.Add(1)
 				f.health.SetHealthy(dnsForwarderFailing)
 				return nil
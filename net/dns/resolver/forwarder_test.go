@@ -1525,3 +1525,53 @@ func TestResolversCustomScheme(t *testing.T) {
 		})
 	}
 }
+
+func TestForwarderQueryTrace(t *testing.T) {
+	const domain = "host.example.com."
+	request := makeTestRequest(t, domain, dns.TypeA, 0)
+	response := makeTestResponse(t, domain, dns.RCodeSuccess, netip.MustParseAddr("127.0.0.1"))
+	port := runDNSServer(t, nil, response, func(isTCP bool, gotRequest []byte) {})
+
+	logf := tstest.WhileTestRunningLogger(t)
+	bus := eventbustest.NewBus(t)
+	netMon, err := netmon.New(bus, logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dialer tsdial.Dialer
+	dialer.SetNetMon(netMon)
+	dialer.SetBus(bus)
+	fwd := newForwarder(logf, netMon, nil, &dialer, health.NewTracker(bus), nil)
+	upstream := fmt.Sprintf("127.0.0.1:%d", port)
+	fwd.setRoutes(map[dnsname.FQDN][]*dnstype.Resolver{
+		"example.com.": {{Addr: upstream}},
+	}, false)
+
+	var tr QueryTracer
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rchan := make(chan packet, 1)
+	rpkt := packet{
+		bs:     request,
+		family: "udp",
+		addr:   netip.MustParseAddrPort("127.0.0.1:12345"),
+	}
+	if err := fwd.forwardWithDestChan(WithQueryTracer(ctx, &tr), rpkt, rchan); err != nil {
+		t.Fatal(err)
+	}
+	if res := <-rchan; !bytes.Equal(res.bs, response) {
+		t.Errorf("invalid response\ngot: %+v\nwant: %+v", res.bs, response)
+	}
+
+	got := tr.Trace()
+	if got.Route != dnstype.RouteSplit || got.RouteSuffix != "example.com." {
+		t.Errorf("route = %q %q; want %q %q", got.Route, got.RouteSuffix, dnstype.RouteSplit, "example.com.")
+	}
+	if len(got.Upstreams) != 1 {
+		t.Fatalf("upstreams = %+v; want 1", got.Upstreams)
+	}
+	u := got.Upstreams[0]
+	if u.Addr != upstream || !u.Sent || !u.Answered || u.Transport != "udp" || u.Err != "" {
+		t.Errorf("upstream = %+v; want answered by %v over udp", u, upstream)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package resolver
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"tailscale.com/types/dnstype"
+	"tailscale.com/util/dnsname"
+)
+
+// QueryTracer records how a Resolver resolves a query whose context it's
+// attached to with [WithQueryTracer], such as for `tailscale dns query`.
+type QueryTracer struct {
+	mu    sync.Mutex
+	trace dnstype.QueryTrace
+}
+
+type queryTracerKey struct{}
+
+// WithQueryTracer returns a context for a query that t records.
+func WithQueryTracer(ctx context.Context, t *QueryTracer) context.Context {
+	return context.WithValue(ctx, queryTracerKey{}, t)
+}
+
+// queryTracerFrom returns the QueryTracer of ctx, or nil if it has none.
+func queryTracerFrom(ctx context.Context) *QueryTracer {
+	t, _ := ctx.Value(queryTracerKey{}).(*QueryTracer)
+	return t
+}
+
+// Trace returns what t has recorded.
+func (t *QueryTracer) Trace() dnstype.QueryTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tr := t.trace
+	tr.Upstreams = slices.Clone(tr.Upstreams)
+	return tr
+}
+
+func (t *QueryTracer) setDuration(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trace.Duration = d
+}
+
+func (t *QueryTracer) setRoute(route string, suffix dnsname.FQDN) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trace.Route = route
+	if suffix != "" {
+		t.trace.RouteSuffix = suffix.WithTrailingDot()
+	}
+}
+
+// setUpstreams records that the query is forwarded to resolvers.
+func (t *QueryTracer) setUpstreams(resolvers []resolverAndDelay) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trace.Upstreams = make([]dnstype.UpstreamTrace, len(resolvers))
+	for i, rr := range resolvers {
+		t.trace.Upstreams[i] = dnstype.UpstreamTrace{
+			Addr:       rr.name.Addr,
+			StartDelay: rr.startDelay,
+		}
+	}
+}
+
+// updateUpstream updates the record of the ith upstream with f.
+func (t *QueryTracer) updateUpstream(i int, f func(*dnstype.UpstreamTrace)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i < len(t.trace.Upstreams) {
+		f(&t.trace.Upstreams[i])
+	}
+}
+
+type upstreamTraceKey struct{}
+
+// upstreamTrace is the record of the query to an upstream, for send to
+// note its transport in.
+type upstreamTrace struct {
+	t *QueryTracer
+	i int
+}
+
+// noteTransport notes the transport of the response to the query of ctx to
+// an upstream, if it's being traced.
+func noteTransport(ctx context.Context, transport string) {
+	if ut, ok := ctx.Value(upstreamTraceKey{}).(upstreamTrace); ok {
+		ut.t.updateUpstream(ut.i, func(u *dnstype.UpstreamTrace) { u.Transport = transport })
+	}
+}
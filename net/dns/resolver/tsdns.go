@@ -39,6 +39,7 @@
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/cloudenv"
 	"tailscale.com/util/dnsname"
+	"tailscale.com/util/mak"
 	"tailscale.com/util/set"
 )
 
@@ -89,6 +90,12 @@ type Config struct {
 	// "node.tailnet.ts.net" is in SubdomainHosts, the query resolves
 	// to the IPs for "node.tailnet.ts.net".
 	SubdomainHosts set.Set[dnsname.FQDN]
+	// UpstreamTimeout, if non-zero, is how long to wait for an upstream
+	// resolver to respond to a forwarded query before retrying it.
+	UpstreamTimeout time.Duration
+	// UpstreamAttempts, if non-zero, is how many times to query each
+	// upstream resolver before giving up on it.
+	UpstreamAttempts int
 }
 
 // WriteToBufioWriter write a debug version of c for logs to w, omitting
@@ -229,6 +236,7 @@ type Resolver struct {
 	hostToIP       map[dnsname.FQDN][]netip.Addr
 	ipToHost       map[netip.Addr]dnsname.FQDN
 	subdomainHosts set.Set[dnsname.FQDN]
+	zoneHandlers   map[dnsname.FQDN]ZoneHandler
 }
 
 type ForwardLinkSelector interface {
@@ -283,6 +291,7 @@ func (r *Resolver) SetConfig(cfg Config) error {
 	}
 
 	r.forwarder.setRoutes(cfg.Routes, cfg.AcceptDNS)
+	r.forwarder.setUpstreamOptions(cfg.UpstreamTimeout, cfg.UpstreamAttempts)
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -293,6 +302,35 @@ func (r *Resolver) SetConfig(cfg Config) error {
 	return nil
 }
 
+// ZoneHandler answers DNS queries for the names in a zone. It's given the
+// raw DNS query and returns the raw response.
+type ZoneHandler func(query []byte) ([]byte, error)
+
+// SetZoneHandler sets the handler that answers queries for names in zone,
+// including those from peers via HandlePeerDNSQuery, instead of resolving
+// or forwarding them. A nil h removes the zone's handler.
+func (r *Resolver) SetZoneHandler(zone dnsname.FQDN, h ZoneHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h == nil {
+		delete(r.zoneHandlers, zone)
+		return
+	}
+	mak.Set(&r.zoneHandlers, zone, h)
+}
+
+// zoneHandler returns the handler for the zone containing name, if any.
+func (r *Resolver) zoneHandler(name dnsname.FQDN) ZoneHandler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for zone, h := range r.zoneHandlers {
+		if zone.Contains(name) {
+			return h
+		}
+	}
+	return nil
+}
+
 // CustomSchemeHandler takes a URI (retrieved from [dnstype.Resolver.Addr]) and
 // returns an updated URI to use for the current query. The result is only valid
 // for right now and may change over time.
@@ -339,7 +377,12 @@ func (r *Resolver) Query(ctx context.Context, bs []byte, family string, from net
 	default:
 	}
 
-	out, err := r.respond(bs)
+	if tr := queryTracerFrom(ctx); tr != nil {
+		start := time.Now()
+		defer func() { tr.setDuration(time.Since(start)) }()
+	}
+
+	out, err := r.respond(ctx, bs)
 	if err == errNotOurName {
 		responses := make(chan packet, 1)
 		ctx, cancel := context.WithTimeout(ctx, dnsQueryTimeout)
@@ -410,6 +453,12 @@ func (r *Resolver) HandlePeerDNSQuery(ctx context.Context, q []byte, from netip.
 		resp.Header.RCode = dns.RCodeRefused
 		return marshalResponse(resp)
 	}
+	if fqdn, err := dnsname.ToFQDN(strings.ToLower(name)); err == nil {
+		if h := r.zoneHandler(fqdn); h != nil {
+			metricDNSZoneHandler.Add(1)
+			return h(q)
+		}
+	}
 
 	switch runtime.GOOS {
 	default:
@@ -1303,8 +1352,9 @@ func (r *Resolver) respondReverse(query []byte, name dnsname.FQDN, resp *respons
 }
 
 // respond returns a DNS response to query if it can be resolved locally.
-// Otherwise, it returns errNotOurName.
-func (r *Resolver) respond(query []byte) ([]byte, error) {
+// Otherwise, it returns errNotOurName. If ctx has a QueryTracer, it's told
+// how the query was answered.
+func (r *Resolver) respond(ctx context.Context, query []byte) ([]byte, error) {
 	if !buildfeatures.HasDNS {
 		return nil, feature.ErrUnavailable
 	}
@@ -1338,17 +1388,33 @@ func (r *Resolver) respond(query []byte) ([]byte, error) {
 		return marshalResponse(resp)
 	}
 
+	tr := queryTracerFrom(ctx)
+	if h := r.zoneHandler(name); h != nil {
+		metricDNSZoneHandler.Add(1)
+		if tr != nil {
+			tr.setRoute(dnstype.RouteZone, "")
+		}
+		return h(query)
+	}
+
 	// Always try to handle reverse lookups; delegate inside when not found.
 	// This way, queries for existent nodes do not leak,
 	// but we behave gracefully if non-Tailscale nodes exist in CGNATRange.
 	if parser.Question.Type == dns.TypePTR {
-		return r.respondReverse(query, name, parser.response())
+		out, err := r.respondReverse(query, name, parser.response())
+		if tr != nil && err == nil {
+			tr.setRoute(dnstype.RouteMagicDNS, "")
+		}
+		return out, err
 	}
 
 	ip, rcode := r.resolveLocal(name, parser.Question.Type)
 	if rcode == dns.RCodeRefused {
 		return nil, errNotOurName // sentinel error return value: it requests forwarding
 	}
+	if tr != nil {
+		tr.setRoute(dnstype.RouteMagicDNS, "")
+	}
 
 	resp := parser.response()
 	resp.Header.RCode = rcode
@@ -1398,6 +1464,8 @@ func unARPA(a string) (ipStr string, ok bool) {
 	metricDNSMagicDNSSuccessName    = clientmetric.NewCounter("dns_query_magic_success_name")
 	metricDNSMagicDNSSuccessReverse = clientmetric.NewCounter("dns_query_magic_success_reverse")
 
+	metricDNSZoneHandler = clientmetric.NewCounter("dns_query_zone_handler")
+
 	metricDNSExitProxyQuery           = clientmetric.NewCounter("dns_exit_node_query")
 	metricDNSExitProxyErrorName       = clientmetric.NewCounter("dns_exit_node_error_name")
 	metricDNSExitProxyErrorForward    = clientmetric.NewCounter("dns_exit_node_error_forward")
@@ -1413,6 +1481,7 @@ func unARPA(a string) (ipStr string, ok bool) {
 
 	metricDNSFwdErrorType = clientmetric.NewCounter("dns_query_fwd_error_type")
 	metricDNSFwdTruncated = clientmetric.NewCounter("dns_query_fwd_truncated")
+	metricDNSFwdRetry     = clientmetric.NewCounter("dns_query_fwd_retry")
 
 	metricDNSFwdUDP             = clientmetric.NewCounter("dns_query_fwd_udp")       // on entry
 	metricDNSFwdUDPWrote        = clientmetric.NewCounter("dns_query_fwd_udp_wrote") // sent UDP packet
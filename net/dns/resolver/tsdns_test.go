@@ -16,6 +16,7 @@
 	"net/netip"
 	"reflect"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
@@ -549,6 +550,44 @@ func generateTXT(size int, source rand.Source) []string {
 	return txts
 }
 
+func TestZoneHandler(t *testing.T) {
+	r := newResolver(t)
+	defer r.Close()
+	r.SetConfig(dnsCfg)
+
+	var got []dnsname.FQDN
+	r.SetZoneHandler("office.example.com.", func(query []byte) ([]byte, error) {
+		var p dns.Parser
+		if _, err := p.Start(query); err != nil {
+			return nil, err
+		}
+		q, err := p.Question()
+		if err != nil {
+			return nil, err
+		}
+		got = append(got, dnsname.FQDN(q.Name.String()))
+		return []byte("handled"), nil
+	})
+
+	for _, name := range []dnsname.FQDN{"office.example.com.", "Printer.Office.Example.com.", "test1.ipn.dev."} {
+		res, err := r.respond(context.Background(), dnspacket(name, dns.TypeA, noEdns))
+		if err != nil {
+			t.Fatalf("respond(%q): %v", name, err)
+		}
+		if handled := string(res) == "handled"; handled != (name != "test1.ipn.dev.") {
+			t.Errorf("respond(%q) handled = %v", name, handled)
+		}
+	}
+	if want := []dnsname.FQDN{"office.example.com.", "Printer.Office.Example.com."}; !slices.Equal(got, want) {
+		t.Errorf("handler got queries for %q; want %q", got, want)
+	}
+
+	r.SetZoneHandler("office.example.com.", nil)
+	if _, err := r.respond(context.Background(), dnspacket("printer.office.example.com.", dns.TypeA, noEdns)); err != errNotOurName {
+		t.Errorf("after removing handler, err = %v; want errNotOurName", err)
+	}
+}
+
 func TestDelegate(t *testing.T) {
 	tstest.ResourceCheck(t)
 
@@ -22,6 +22,8 @@
 	"net/url"
 	"os"
 	"reflect"
+	"slices"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -67,13 +69,45 @@ func lookup(ctx context.Context, host string, logf logger.Logf, ht *health.Track
 		return []netip.Addr{ip}, nil
 	}
 
-	type nameIP struct {
-		dnsName string
-		ip      netip.Addr
+	cands := bootstrapCandidates(GetDERPMap(), extraServers())
+	if len(cands) == 0 {
+		return nil, fmt.Errorf("no DNS fallback options for %q", host)
 	}
+	for _, cand := range cands {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		logf("trying bootstrapDNS(%q, %q) for %q ...", cand.dnsName, cand.ip, host)
+		ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+		dm, err := bootstrapDNSMap(ctx, cand.dnsName, cand.ip, host, logf, ht, netMon)
+		if err != nil {
+			logf("bootstrapDNS(%q, %q) for %q error: %v", cand.dnsName, cand.ip, host, err)
+			continue
+		}
+		if ips := dm[host]; len(ips) > 0 {
+			slicesx.Shuffle(ips)
+			logf("bootstrapDNS(%q, %q) for %q = %v", cand.dnsName, cand.ip, host, ips)
+			return ips, nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no DNS fallback candidates remain for %q", host)
+}
 
-	dm := GetDERPMap()
+// nameIP is a bootstrap DNS server to query: the name of its TLS
+// certificate, and the IP address to reach it at.
+type nameIP struct {
+	dnsName string
+	ip      netip.Addr
+}
 
+// bootstrapCandidates returns the servers to query for bootstrap DNS, in
+// order: the extra servers, then up to a few of the DERP servers of dm,
+// alternating between IPv4 and IPv6 as long as there are both.
+func bootstrapCandidates(dm *tailcfg.DERPMap, extra []BootstrapServer) []nameIP {
 	var cands4, cands6 []nameIP
 	for _, dr := range dm.Regions {
 		for _, n := range dr.Nodes {
@@ -88,8 +122,15 @@ type nameIP struct {
 	slicesx.Shuffle(cands4)
 	slicesx.Shuffle(cands6)
 
-	const maxCands = 6
-	var cands []nameIP // up to maxCands alternating v4/v6 as long as we have both
+	// The extra servers are always tried, and first: they're there for
+	// networks where the DERP servers can't be reached.
+	cands := make([]nameIP, 0, len(extra)+maxDERPCands)
+	for _, s := range extra {
+		cands = append(cands, nameIP{s.HostName, s.IP})
+	}
+	slicesx.Shuffle(cands)
+
+	maxCands := len(extra) + maxDERPCands
 	for (len(cands4) > 0 || len(cands6) > 0) && len(cands) < maxCands {
 		if len(cands4) > 0 {
 			cands = append(cands, cands4[0])
@@ -100,33 +141,12 @@ type nameIP struct {
 			cands6 = cands6[1:]
 		}
 	}
-	if len(cands) == 0 {
-		return nil, fmt.Errorf("no DNS fallback options for %q", host)
-	}
-	for _, cand := range cands {
-		if err := ctx.Err(); err != nil {
-			return nil, err
-		}
-		logf("trying bootstrapDNS(%q, %q) for %q ...", cand.dnsName, cand.ip, host)
-		ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-		defer cancel()
-		dm, err := bootstrapDNSMap(ctx, cand.dnsName, cand.ip, host, logf, ht, netMon)
-		if err != nil {
-			logf("bootstrapDNS(%q, %q) for %q error: %v", cand.dnsName, cand.ip, host, err)
-			continue
-		}
-		if ips := dm[host]; len(ips) > 0 {
-			slicesx.Shuffle(ips)
-			logf("bootstrapDNS(%q, %q) for %q = %v", cand.dnsName, cand.ip, host, ips)
-			return ips, nil
-		}
-	}
-	if err := ctx.Err(); err != nil {
-		return nil, err
-	}
-	return nil, fmt.Errorf("no DNS fallback candidates remain for %q", host)
+	return cands
 }
 
+// maxDERPCands is the most DERP servers that a lookup queries.
+const maxDERPCands = 6
+
 // serverName and serverIP of are, say, "derpN.tailscale.com".
 // queryName is the name being sought (e.g. "controlplane.tailscale.com"), passed as hint.
 //
@@ -164,6 +184,55 @@ func bootstrapDNSMap(ctx context.Context, serverName string, serverIP netip.Addr
 // https://derp10.tailscale.com/bootstrap-dns
 type dnsMap map[string][]netip.Addr
 
+// BootstrapServer is a server to query for bootstrap DNS besides the DERP
+// servers of [GetDERPMap], such as one run by a network's administrator
+// where those are blocked. Like them, it must serve /bootstrap-dns over
+// HTTPS on port 443, with a certificate valid for HostName.
+type BootstrapServer struct {
+	HostName string     // the server's name, for TLS
+	IP       netip.Addr // the address to reach it at, without DNS
+}
+
+// String returns s in the form parsed by [ParseBootstrapServer].
+func (s BootstrapServer) String() string {
+	return s.HostName + "=" + s.IP.String()
+}
+
+// ParseBootstrapServer parses a BootstrapServer of the form "hostname=ip",
+// such as "bootstrap.corp.example.com=192.0.2.10".
+func ParseBootstrapServer(s string) (BootstrapServer, error) {
+	host, ipStr, ok := strings.Cut(s, "=")
+	if !ok {
+		return BootstrapServer{}, fmt.Errorf("bootstrap DNS server %q isn't of the form hostname=ip", s)
+	}
+	if host == "" || strings.ContainsAny(host, "/:@ ") {
+		return BootstrapServer{}, fmt.Errorf("bootstrap DNS server %q has an invalid hostname", s)
+	}
+	ip, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return BootstrapServer{}, fmt.Errorf("bootstrap DNS server %q has an invalid IP: %w", s, err)
+	}
+	return BootstrapServer{HostName: host, IP: ip}, nil
+}
+
+// extraServersList is the list of servers set by SetExtraServers.
+var extraServersList atomic.Pointer[[]BootstrapServer]
+
+// SetExtraServers sets the servers that lookups query for bootstrap DNS
+// before the DERP servers of [GetDERPMap], replacing any set before.
+func SetExtraServers(servers []BootstrapServer) {
+	servers = slices.Clone(servers)
+	extraServersList.Store(&servers)
+}
+
+// extraServers returns the servers set by SetExtraServers.
+func extraServers() []BootstrapServer {
+	if p := extraServersList.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
 // GetDERPMap returns a fallback DERP map that is always available, useful for basic
 // bootstrapping purposes. The dynamically updated DERP map in LocalBackend should
 // always be preferred over this. Use this DERP map only when the control plane is
@@ -7,9 +7,12 @@
 	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"testing"
 
 	"tailscale.com/net/netmon"
@@ -176,6 +179,81 @@ func TestCacheUnchanged(t *testing.T) {
 	}
 }
 
+func TestParseBootstrapServer(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    BootstrapServer
+		wantErr bool
+	}{
+		{in: "bootstrap.example.com=192.0.2.10", want: BootstrapServer{"bootstrap.example.com", netip.MustParseAddr("192.0.2.10")}},
+		{in: "bootstrap.example.com=2001:db8::10", want: BootstrapServer{"bootstrap.example.com", netip.MustParseAddr("2001:db8::10")}},
+		{in: "bootstrap.example.com", wantErr: true},
+		{in: "=192.0.2.10", wantErr: true},
+		{in: "https://bootstrap.example.com=192.0.2.10", wantErr: true},
+		{in: "bootstrap.example.com=bogus", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBootstrapServer(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseBootstrapServer(%q) = %v; want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseBootstrapServer(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseBootstrapServer(%q) = %v; want %v", tt.in, got, tt.want)
+		}
+		if got.String() != tt.in {
+			t.Errorf("String() = %q; want %q", got.String(), tt.in)
+		}
+	}
+}
+
+func TestBootstrapCandidates(t *testing.T) {
+	dm := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{}}
+	for i := range 10 {
+		dm.Regions[i+1] = &tailcfg.DERPRegion{
+			RegionID: i + 1,
+			Nodes: []*tailcfg.DERPNode{{
+				HostName: fmt.Sprintf("derp%d.example.com", i+1),
+				IPv4:     fmt.Sprintf("198.51.100.%d", i+1),
+				IPv6:     fmt.Sprintf("2001:db8::%d", i+1),
+			}},
+		}
+	}
+	extra := []BootstrapServer{
+		{"bootstrap1.example.com", netip.MustParseAddr("192.0.2.1")},
+		{"bootstrap2.example.com", netip.MustParseAddr("192.0.2.2")},
+	}
+
+	if got := bootstrapCandidates(dm, nil); len(got) != maxDERPCands {
+		t.Errorf("without extra servers, got %d candidates; want %d", len(got), maxDERPCands)
+	}
+
+	got := bootstrapCandidates(dm, extra)
+	if len(got) != len(extra)+maxDERPCands {
+		t.Fatalf("got %d candidates; want %d", len(got), len(extra)+maxDERPCands)
+	}
+	// The extra servers come first, in any order.
+	var first []string
+	for _, c := range got[:len(extra)] {
+		first = append(first, c.dnsName)
+	}
+	slices.Sort(first)
+	if want := []string{"bootstrap1.example.com", "bootstrap2.example.com"}; !slices.Equal(first, want) {
+		t.Errorf("first candidates = %q; want %q", first, want)
+	}
+
+	// With no DERP servers, only the extra servers remain.
+	if got := bootstrapCandidates(&tailcfg.DERPMap{}, extra); len(got) != len(extra) {
+		t.Errorf("with empty DERP map, got %d candidates; want %d", len(got), len(extra))
+	}
+}
+
 var extNetwork = flag.Bool("use-external-network", false, "use the external network in tests")
 
 func TestLookup(t *testing.T) {
@@ -0,0 +1,319 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package ftpalg is an application layer gateway for FTP: it follows the
+// passive mode negotiation on FTP control connections being proxied, so that
+// the data connections the server asks the client to make can be proxied to
+// the same server too.
+package ftpalg
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ControlPort is the well-known port of FTP control connections.
+const ControlPort = 21
+
+// maxLineLen is the length past which a reply line is passed through without
+// being inspected. Passive mode replies are much shorter.
+const maxLineLen = 512
+
+// ReplyWriter writes the server-to-client stream of an FTP control connection
+// to an underlying writer, following passive mode replies.
+//
+// For each "227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)" reply, it replaces
+// the host address with the address the client reached the server on, which
+// the host address is often not (such as when the server is on localhost or
+// behind NAT), and reports the port. For each "229 Entering Extended Passive
+// Mode (|||port|)" reply, it reports the port. Everything else is passed
+// through unchanged.
+//
+// A ReplyWriter is not safe for concurrent use.
+type ReplyWriter struct {
+	w         io.Writer
+	addr      netip.Addr
+	onPassive func(port uint16)
+
+	buf      []byte // start of a line that may be a passive mode reply
+	passLine bool   // whether the rest of the current line is passed through
+}
+
+// NewReplyWriter returns a ReplyWriter writing to w. It puts addr, the address
+// the client connected to, into 227 replies if it's an IPv4 address, and
+// calls onPassive with the data port of each passive mode reply before
+// writing the reply.
+func NewReplyWriter(w io.Writer, addr netip.Addr, onPassive func(port uint16)) *ReplyWriter {
+	return &ReplyWriter{
+		w:         w,
+		addr:      addr.Unmap(),
+		onPassive: onPassive,
+	}
+}
+
+// Write implements io.Writer. It holds back the start of a line that may be
+// a passive mode reply until the rest of the line is written.
+func (rw *ReplyWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+		}
+		p = p[len(line):]
+		n += len(line)
+		complete := line[len(line)-1] == '\n'
+
+		if rw.passLine {
+			rw.passLine = !complete
+			if _, err := rw.w.Write(line); err != nil {
+				return n, err
+			}
+			continue
+		}
+		rw.buf = append(rw.buf, line...)
+		if !complete && len(rw.buf) <= maxLineLen && mayBePassiveReply(rw.buf) {
+			continue // wait for the rest of the line
+		}
+		out := rw.buf
+		if complete {
+			out = rw.followLine(out)
+		}
+		rw.passLine = !complete
+		_, err := rw.w.Write(out)
+		rw.buf = rw.buf[:0]
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Flush writes any held back partial line.
+func (rw *ReplyWriter) Flush() error {
+	if len(rw.buf) == 0 {
+		return nil
+	}
+	_, err := rw.w.Write(rw.buf)
+	rw.buf = rw.buf[:0]
+	rw.passLine = true
+	return err
+}
+
+// mayBePassiveReply reports whether b is, or is the start of, a passive mode
+// reply line.
+func mayBePassiveReply(b []byte) bool {
+	b = b[:min(len(b), 4)]
+	return bytes.HasPrefix([]byte("227 "), b) || bytes.HasPrefix([]byte("229 "), b)
+}
+
+// followLine returns line, a complete reply line, rewritten if it's a 227
+// reply, after reporting the data port if it's a passive mode reply.
+func (rw *ReplyWriter) followLine(line []byte) []byte {
+	switch {
+	case bytes.HasPrefix(line, []byte("227 ")):
+		start, end, port, ok := parsePASVReply(line)
+		if !ok {
+			return line
+		}
+		rw.onPassive(port)
+		if !rw.addr.Is4() {
+			return line
+		}
+		a := rw.addr.As4()
+		var out []byte
+		out = append(out, line[:start]...)
+		for _, b := range a {
+			out = strconv.AppendUint(out, uint64(b), 10)
+			out = append(out, ',')
+		}
+		out = strconv.AppendUint(out, uint64(port>>8), 10)
+		out = append(out, ',')
+		out = strconv.AppendUint(out, uint64(port&0xff), 10)
+		return append(out, line[end:]...)
+	case bytes.HasPrefix(line, []byte("229 ")):
+		if port, ok := parseEPSVReply(line); ok {
+			rw.onPassive(port)
+		}
+	}
+	return line
+}
+
+// parsePASVReply finds the "h1,h2,h3,h4,p1,p2" in a 227 reply line, returning
+// its bounds in line and the port it encodes.
+func parsePASVReply(line []byte) (start, end int, port uint16, ok bool) {
+	for start = 4; start < len(line); start++ {
+		if !isDigit(line[start]) || isDigit(line[start-1]) {
+			continue
+		}
+		var nums [6]uint64
+		i := start
+		for j := range nums {
+			if j > 0 {
+				if i >= len(line) || line[i] != ',' {
+					break
+				}
+				i++
+			}
+			k := i
+			for k < len(line) && isDigit(line[k]) {
+				k++
+			}
+			v, err := strconv.ParseUint(string(line[i:k]), 10, 8)
+			if err != nil {
+				break
+			}
+			nums[j], i = v, k
+			if j == len(nums)-1 {
+				return start, i, uint16(nums[4]<<8 | nums[5]), true
+			}
+		}
+	}
+	return 0, 0, 0, false
+}
+
+// parseEPSVReply returns the port in a 229 reply line, of the form
+// "229 text (<d><d><d>port<d>)" for a delimiter d.
+func parseEPSVReply(line []byte) (port uint16, ok bool) {
+	i := bytes.IndexByte(line, '(')
+	if i < 0 || len(line) < i+6 {
+		return 0, false
+	}
+	s := line[i+1:]
+	d := s[0]
+	if s[1] != d || s[2] != d {
+		return 0, false
+	}
+	s = s[3:]
+	j := bytes.IndexByte(s, d)
+	if j < 0 || j+1 >= len(s) || s[j+1] != ')' {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(string(s[:j]), 10, 16)
+	if err != nil || v == 0 {
+		return 0, false
+	}
+	return uint16(v), true
+}
+
+func isDigit(b byte) bool { return '0' <= b && b <= '9' }
+
+// WrapConn returns c, the client side of a proxied FTP control connection,
+// with the writes of server replies to it going through a ReplyWriter. See
+// NewReplyWriter for addr and onPassive.
+func WrapConn(c net.Conn, addr netip.Addr, onPassive func(port uint16)) net.Conn {
+	return &conn{Conn: c, rw: NewReplyWriter(c, addr, onPassive)}
+}
+
+type conn struct {
+	net.Conn
+
+	mu sync.Mutex // guards rw
+	rw *ReplyWriter
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rw.Write(p)
+}
+
+func (c *conn) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rw.Flush()
+}
+
+func (c *conn) Close() error {
+	c.flush()
+	return c.Conn.Close()
+}
+
+// CloseWrite closes the write side of c, if supported.
+func (c *conn) CloseWrite() error {
+	if err := c.flush(); err != nil {
+		return err
+	}
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// ExpectTimeout is how long a data connection told to a client in a passive
+// mode reply is expected for.
+const ExpectTimeout = 30 * time.Second
+
+// Expectations is a table of data connections that clients were told to
+// make in passive mode replies, and the servers they should be proxied to.
+// It is safe for concurrent use. The zero value is ready for use.
+type Expectations struct {
+	now func() time.Time // or nil for time.Now; for tests
+
+	mu sync.Mutex
+	m  map[expectKey]expectation
+}
+
+type expectKey struct {
+	client netip.Addr
+	dst    netip.AddrPort
+}
+
+type expectation struct {
+	backend netip.AddrPort
+	expires time.Time
+}
+
+func (e *Expectations) timeNow() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+	return time.Now()
+}
+
+// Add expects a connection from client to dst, the data port of a passive
+// mode reply at the address the client reached the server on, for the next
+// ExpectTimeout, to be proxied to backend.
+func (e *Expectations) Add(client netip.Addr, dst, backend netip.AddrPort) {
+	now := e.timeNow()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for k, x := range e.m {
+		if now.After(x.expires) {
+			delete(e.m, k)
+		}
+	}
+	if e.m == nil {
+		e.m = make(map[expectKey]expectation)
+	}
+	e.m[expectKey{client.Unmap(), unmapAddrPort(dst)}] = expectation{
+		backend: backend,
+		expires: now.Add(ExpectTimeout),
+	}
+}
+
+// Take reports whether a connection from client to dst is expected, and if
+// so, returns where to proxy it to and stops expecting it.
+func (e *Expectations) Take(client netip.Addr, dst netip.AddrPort) (backend netip.AddrPort, ok bool) {
+	now := e.timeNow()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	k := expectKey{client.Unmap(), unmapAddrPort(dst)}
+	x, ok := e.m[k]
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	delete(e.m, k)
+	if now.After(x.expires) {
+		return netip.AddrPort{}, false
+	}
+	return x.backend, true
+}
+
+func unmapAddrPort(ap netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ftpalg
+
+import (
+	"bytes"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReplyWriter(t *testing.T) {
+	tests := []struct {
+		name      string
+		addr      string
+		in        string
+		want      string
+		wantPorts []uint16
+	}{
+		{
+			name: "other-replies",
+			addr: "100.64.0.1",
+			in:   "220 Welcome\r\n331 Password required\r\n230 Logged in\r\n",
+			want: "220 Welcome\r\n331 Password required\r\n230 Logged in\r\n",
+		},
+		{
+			name:      "pasv",
+			addr:      "100.64.0.1",
+			in:        "227 Entering Passive Mode (127,0,0,1,195,80).\r\n",
+			want:      "227 Entering Passive Mode (100,64,0,1,195,80).\r\n",
+			wantPorts: []uint16{50000},
+		},
+		{
+			name:      "pasv-no-parens",
+			addr:      "::ffff:10.1.2.3",
+			in:        "227 =192,168,1,5,4,1\r\n",
+			want:      "227 =10,1,2,3,4,1\r\n",
+			wantPorts: []uint16{1025},
+		},
+		{
+			name:      "pasv-ipv6-client",
+			addr:      "fd7a:115c:a1e0::1",
+			in:        "227 Entering Passive Mode (127,0,0,1,195,80)\r\n",
+			want:      "227 Entering Passive Mode (127,0,0,1,195,80)\r\n",
+			wantPorts: []uint16{50000},
+		},
+		{
+			name: "pasv-malformed",
+			addr: "100.64.0.1",
+			in:   "227 Entering Passive Mode (127,0,0,1,195)\r\n227 (1,2,3,4,5,256)\r\n",
+			want: "227 Entering Passive Mode (127,0,0,1,195)\r\n227 (1,2,3,4,5,256)\r\n",
+		},
+		{
+			name:      "epsv",
+			addr:      "100.64.0.1",
+			in:        "229 Entering Extended Passive Mode (|||50001|)\r\n",
+			want:      "229 Entering Extended Passive Mode (|||50001|)\r\n",
+			wantPorts: []uint16{50001},
+		},
+		{
+			name: "epsv-malformed",
+			addr: "100.64.0.1",
+			in:   "229 Entering Extended Passive Mode (||50001|)\r\n229 (|||70000|)\r\n",
+			want: "229 Entering Extended Passive Mode (||50001|)\r\n229 (|||70000|)\r\n",
+		},
+		{
+			name:      "mixed",
+			addr:      "100.64.0.1",
+			in:        "200 OK\r\n227 (127,0,0,1,0,21)\r\n150 Here it comes\r\n226 Done\r\n229 (!!!2121!)\r\n",
+			want:      "200 OK\r\n227 (100,64,0,1,0,21)\r\n150 Here it comes\r\n226 Done\r\n229 (!!!2121!)\r\n",
+			wantPorts: []uint16{21, 2121},
+		},
+	}
+	for _, tt := range tests {
+		// Write the input all at once and byte by byte, to check that
+		// replies split across writes are followed too.
+		for _, chunk := range []int{len(tt.in), 1} {
+			var buf bytes.Buffer
+			var ports []uint16
+			rw := NewReplyWriter(&buf, netip.MustParseAddr(tt.addr), func(port uint16) {
+				ports = append(ports, port)
+			})
+			for in := []byte(tt.in); len(in) > 0; {
+				n := min(chunk, len(in))
+				if got, err := rw.Write(in[:n]); got != n || err != nil {
+					t.Fatalf("%s/%d: Write = %v, %v; want %v, nil", tt.name, chunk, got, err, n)
+				}
+				in = in[n:]
+			}
+			if err := rw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("%s/%d: wrote %q; want %q", tt.name, chunk, got, tt.want)
+			}
+			if !slices.Equal(ports, tt.wantPorts) {
+				t.Errorf("%s/%d: passive ports %v; want %v", tt.name, chunk, ports, tt.wantPorts)
+			}
+		}
+	}
+}
+
+func TestReplyWriterPassesThroughPartialLines(t *testing.T) {
+	var buf bytes.Buffer
+	rw := NewReplyWriter(&buf, netip.MustParseAddr("100.64.0.1"), func(uint16) {
+		t.Error("unexpected passive reply")
+	})
+	rw.Write([]byte("220 Hello"))
+	if got := buf.String(); got != "220 Hello" {
+		t.Errorf("after partial non-passive line, wrote %q; want it all", got)
+	}
+	rw.Write([]byte(" there\r\n22"))
+	if got := buf.String(); got != "220 Hello there\r\n" {
+		t.Errorf("after possible start of passive reply, wrote %q; want it held back", got)
+	}
+	rw.Write([]byte("7"))
+	rw.Flush()
+	if got := buf.String(); got != "220 Hello there\r\n227" {
+		t.Errorf("after Flush, wrote %q; want all", got)
+	}
+}
+
+func TestExpectations(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	e := &Expectations{now: func() time.Time { return now }}
+	client := netip.MustParseAddr("100.64.0.2")
+	dst := netip.MustParseAddrPort("100.64.0.1:50000")
+	backend := netip.MustParseAddrPort("127.0.0.1:50000")
+
+	if _, ok := e.Take(client, dst); ok {
+		t.Fatal("Take before Add succeeded")
+	}
+	e.Add(client, dst, backend)
+	if _, ok := e.Take(netip.MustParseAddr("100.64.0.3"), dst); ok {
+		t.Error("Take from another client succeeded")
+	}
+	if got, ok := e.Take(netip.MustParseAddr("::ffff:100.64.0.2"), dst); !ok || got != backend {
+		t.Errorf("Take = %v, %v; want %v, true", got, ok, backend)
+	}
+	if _, ok := e.Take(client, dst); ok {
+		t.Error("second Take succeeded")
+	}
+
+	e.Add(client, dst, backend)
+	now = now.Add(ExpectTimeout + time.Second)
+	if _, ok := e.Take(client, dst); ok {
+		t.Error("Take after expiry succeeded")
+	}
+}
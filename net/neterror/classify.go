@@ -0,0 +1,116 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package neterror
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+)
+
+// Code is a stable identifier for a class of low-level network failure.
+//
+// Codes are shown to users and included in health warnings so that
+// users, support, and GUIs can refer to a failure without relying on
+// platform-specific errno strings. Once added, a Code's value must not
+// change.
+type Code string
+
+const (
+	// CodeFirewallBlocked is an outbound packet rejected by a local
+	// firewall rule (EPERM on Linux).
+	CodeFirewallBlocked Code = "firewall-blocked"
+
+	// CodeNoBufferSpace is the kernel running out of socket or
+	// interface buffers (ENOBUFS).
+	CodeNoBufferSpace Code = "no-buffer-space"
+
+	// CodeTLSCertUntrusted is a TLS certificate signed by an authority
+	// not in the system's root store.
+	CodeTLSCertUntrusted Code = "tls-cert-untrusted"
+
+	// CodeTLSCertExpired is a TLS certificate that has expired or is
+	// not yet valid, usually due to a wrong system clock.
+	CodeTLSCertExpired Code = "tls-cert-expired"
+
+	// CodeTLSCertHostMismatch is a TLS certificate not valid for the
+	// host being dialed.
+	CodeTLSCertHostMismatch Code = "tls-cert-host-mismatch"
+
+	// CodeDNSLookupFailed is a failure to resolve a name needed to
+	// bootstrap a connection, such as the control server's.
+	CodeDNSLookupFailed Code = "dns-lookup-failed"
+)
+
+var remediation = map[Code]string{
+	CodeFirewallBlocked:     "A local firewall rule is blocking Tailscale's outbound traffic. Check your iptables/nftables rules or security software and allow UDP and TCP traffic from tailscaled.",
+	CodeNoBufferSpace:       "The operating system ran out of network buffer space. This is usually temporary; if it persists, check for an overloaded or misbehaving network interface.",
+	CodeTLSCertUntrusted:    "The server's TLS certificate is not trusted by this device. A firewall, proxy, or antivirus product may be intercepting HTTPS traffic.",
+	CodeTLSCertExpired:      "The server's TLS certificate is expired or not yet valid. Check that this device's date and time are correct.",
+	CodeTLSCertHostMismatch: "The server's TLS certificate does not match the server name. A captive portal, proxy, or firewall may be intercepting HTTPS traffic.",
+	CodeDNSLookupFailed:     "A DNS lookup failed. Check that this device has working DNS servers and Internet access.",
+}
+
+// Remediation returns human-readable text describing what the user can do
+// about a failure of class c. It returns the empty string for unknown codes.
+func (c Code) Remediation() string {
+	return remediation[c]
+}
+
+var isNoBufferSpace func(error) bool // nil on platforms without ENOBUFS
+
+// Classify returns the Code for err, or the empty string if err is nil or
+// does not match any known class of failure.
+func Classify(err error) Code {
+	if err == nil {
+		return ""
+	}
+	if isSendError(err) && TreatAsLostUDP(err) {
+		return CodeFirewallBlocked
+	}
+	if isNoBufferSpace != nil && isNoBufferSpace(err) {
+		return CodeNoBufferSpace
+	}
+
+	if _, ok := errors.AsType[x509.UnknownAuthorityError](err); ok {
+		return CodeTLSCertUntrusted
+	}
+	if e, ok := errors.AsType[x509.CertificateInvalidError](err); ok {
+		if e.Reason == x509.Expired {
+			return CodeTLSCertExpired
+		}
+		return CodeTLSCertUntrusted
+	}
+	if _, ok := errors.AsType[x509.HostnameError](err); ok {
+		return CodeTLSCertHostMismatch
+	}
+	if _, ok := errors.AsType[*tls.CertificateVerificationError](err); ok {
+		// A verification failure whose underlying error wasn't one of
+		// the x509 types above.
+		return CodeTLSCertUntrusted
+	}
+	if _, ok := errors.AsType[*net.DNSError](err); ok {
+		return CodeDNSLookupFailed
+	}
+	return ""
+}
+
+// isSendError reports whether err came from sending on a socket. Other
+// operations, such as opening files or binding sockets, can fail with the
+// same errno as a send blocked by a firewall for unrelated reasons.
+func isSendError(err error) bool {
+	if e, ok := errors.AsType[*os.SyscallError](err); ok {
+		switch e.Syscall {
+		case "sendto", "sendmsg", "sendmmsg", "write", "writev":
+			return true
+		}
+		return false
+	}
+	if e, ok := errors.AsType[*net.OpError](err); ok {
+		return e.Op == "write"
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package neterror
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	type test struct {
+		name string
+		err  error
+		want Code
+	}
+	tests := []test{
+		{"nil", nil, ""},
+		{"unknown", errors.New("foo"), ""},
+		{
+			name: "enobufs",
+			err: &net.OpError{
+				Op: "write",
+				Err: &os.SyscallError{
+					Syscall: "sendto",
+					Err:     syscall.ENOBUFS,
+				},
+			},
+			want: CodeNoBufferSpace,
+		},
+		{
+			name: "unknown_authority",
+			err:  &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}},
+			want: CodeTLSCertUntrusted,
+		},
+		{
+			name: "expired",
+			err:  fmt.Errorf("dial: %w", x509.CertificateInvalidError{Reason: x509.Expired}),
+			want: CodeTLSCertExpired,
+		},
+		{
+			name: "hostname",
+			err:  x509.HostnameError{Host: "example.com"},
+			want: CodeTLSCertHostMismatch,
+		},
+		{
+			name: "dns",
+			err:  &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "controlplane.tailscale.com"}},
+			want: CodeDNSLookupFailed,
+		},
+	}
+	if runtime.GOOS == "linux" {
+		tests = append(tests,
+			test{
+				name: "eperm_sendto",
+				err: &net.OpError{
+					Op:  "write",
+					Err: &os.SyscallError{Syscall: "sendto", Err: syscall.EPERM},
+				},
+				want: CodeFirewallBlocked,
+			},
+			test{
+				name: "eperm_sendmmsg",
+				err:  fmt.Errorf("writing batch: %w", os.NewSyscallError("sendmmsg", syscall.EPERM)),
+				want: CodeFirewallBlocked,
+			},
+			test{"eperm_write_op", &net.OpError{Op: "write", Err: syscall.EPERM}, CodeFirewallBlocked},
+			test{"eperm_bare", syscall.EPERM, ""},
+			test{"eperm_bind", &net.OpError{Op: "listen", Err: os.NewSyscallError("bind", syscall.EPERM)}, ""},
+			test{"eperm_open", &os.PathError{Op: "open", Path: "/dev/net/tun", Err: syscall.EPERM}, ""},
+		)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("got = %q; want %q", got, tt.want)
+			}
+			if tt.want != "" && tt.want.Remediation() == "" {
+				t.Errorf("no remediation for %q", tt.want)
+			}
+		})
+	}
+}
@@ -13,6 +13,16 @@
 	"syscall"
 )
 
+func init() {
+	isNoBufferSpace = func(err error) bool {
+		// 10055 is Windows error code WSAENOBUFS.
+		if runtime.GOOS == "windows" && errors.Is(err, syscall.Errno(10055)) {
+			return true
+		}
+		return errors.Is(err, syscall.ENOBUFS)
+	}
+}
+
 // Reports whether err resulted from reading or writing to a closed or broken pipe.
 func IsClosedPipeError(err error) bool {
 	// 232 is Windows error code ERROR_NO_DATA, "The pipe is being closed".
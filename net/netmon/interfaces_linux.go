@@ -127,6 +127,14 @@ func likelyHomeRouterIPLinux() (ret netip.Addr, myIP netip.Addr, ok bool) {
 }
 
 func defaultRoute() (d DefaultRouteDetails, err error) {
+	if name := GetVRFConfig().Physical; name != "" {
+		// /proc/net/route only shows the main table, not the VRF's.
+		vrf, err := LinuxVRFByName(name)
+		if err != nil {
+			return d, err
+		}
+		return defaultRouteFromNetlink(vrf.Table)
+	}
 	v, err := defaultRouteInterfaceProcNet()
 	if err == nil {
 		d.InterfaceName = v
@@ -149,10 +157,12 @@ func defaultRoute() (d DefaultRouteDetails, err error) {
 	// as a fallback for weird environments where netlink might be
 	// banned but /proc/net/route is emulated (e.g. stuff like
 	// Cloud Run?).
-	return defaultRouteFromNetlink()
+	return defaultRouteFromNetlink(0)
 }
 
-func defaultRouteFromNetlink() (d DefaultRouteDetails, err error) {
+// defaultRouteFromNetlink returns the default route in the routing table
+// table, or in any table if table is zero.
+func defaultRouteFromNetlink(table uint32) (d DefaultRouteDetails, err error) {
 	c, err := rtnetlink.Dial(&netlink.Config{Strict: true})
 	if err != nil {
 		return d, fmt.Errorf("defaultRouteFromNetlink: Dial: %w", err)
@@ -163,6 +173,9 @@ func defaultRouteFromNetlink() (d DefaultRouteDetails, err error) {
 		return d, fmt.Errorf("defaultRouteFromNetlink: List: %w", err)
 	}
 	for _, rm := range rms {
+		if table != 0 && routeMessageTable(rm) != table {
+			continue
+		}
 		if rm.Attributes.Gateway == nil {
 			// A default route has a gateway. If it doesn't, skip it.
 			continue
@@ -190,6 +203,15 @@ func defaultRouteFromNetlink() (d DefaultRouteDetails, err error) {
 	return d, errNoDefaultRoute
 }
 
+// routeMessageTable returns the routing table of rm. Tables above 255 are
+// only in its RTA_TABLE attribute.
+func routeMessageTable(rm rtnetlink.RouteMessage) uint32 {
+	if rm.Attributes.Table != 0 {
+		return rm.Attributes.Table
+	}
+	return uint32(rm.Table)
+}
+
 var zeroRouteBytes = []byte("00000000")
 var procNetRoutePath = "/proc/net/route"
 
@@ -105,7 +105,7 @@ func BenchmarkDefaultRouteInterface(b *testing.B) {
 }
 
 func TestRouteLinuxNetlink(t *testing.T) {
-	d, err := defaultRouteFromNetlink()
+	d, err := defaultRouteFromNetlink(0)
 	if errors.Is(err, fs.ErrPermission) {
 		t.Skip(err)
 	}
@@ -89,6 +89,8 @@ type Monitor struct {
 	wallTimer    *time.Timer // nil until Started; re-armed AfterFunc per tick
 	lastWall     time.Time
 	jumpDuration time.Duration // wall-clock time elapsed during detected time jump; 0 if no time jump observed since reset
+
+	ranker InterfaceRanker // or nil to use the OS's default route interface
 }
 
 // ChangeFunc is a callback function registered with Monitor that's called when the
@@ -119,6 +121,7 @@ type ChangeDelta struct {
 	// Computed Fields
 
 	DefaultInterfaceChanged     bool // whether default route interface changed
+	DefaultInterfaceRanked      bool // whether new state's default interface was chosen by an InterfaceRanker
 	IsLessExpensive             bool // whether new state's default interface is less expensive than old.
 	HasPACOrProxyConfigChanged  bool // whether PAC/HTTP proxy config changed
 	InterfaceIPsChanged         bool // whether any interface IPs changed in a meaningful way
@@ -175,6 +178,7 @@ func NewChangeDelta(old, new *State, jumpDuration time.Duration, forceViability
 	}
 
 	cd.DefaultRouteInterface = new.DefaultRouteInterface
+	cd.DefaultInterfaceRanked = new.DefaultRouteRanked
 	defIf := new.Interface[cd.DefaultRouteInterface]
 
 	tsIfName, err := TailscaleInterfaceName()
@@ -226,7 +230,11 @@ func (cd *ChangeDelta) StateDesc() string {
 			reasons = append(reasons, fmt.Sprintf("time-jumped(%v)", cd.JumpDuration.Round(time.Second)))
 		}
 		if cd.DefaultInterfaceChanged {
-			reasons = append(reasons, "default-if-changed")
+			if cd.DefaultInterfaceRanked {
+				reasons = append(reasons, "default-if-changed(ranked)")
+			} else {
+				reasons = append(reasons, "default-if-changed")
+			}
 		}
 		if cd.InterfaceIPsChanged {
 			reasons = append(reasons, "ips-changed")
@@ -419,7 +427,20 @@ func (m *Monitor) InterfaceState() *State {
 }
 
 func (m *Monitor) interfaceStateUncached() (*State, error) {
-	return getState(tsIfProps.tsIfName())
+	tsIfName := tsIfProps.tsIfName()
+	s, err := getState(tsIfName)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	ranker := m.ranker
+	m.mu.Unlock()
+	if ranker != nil {
+		if err := s.applyRanking(ranker(s), tsIfName); err != nil {
+			m.logf("[v1] ignoring interface ranking: %v", err)
+		}
+	}
+	return s, nil
 }
 
 // GatewayAndSelfIP returns the current network's default gateway, and
@@ -0,0 +1,67 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmon
+
+import "fmt"
+
+// InterfaceRanking is a platform's choice of the default route interface.
+type InterfaceRanking struct {
+	// Interface is the name of the interface to use as the default route
+	// interface, such as Wi-Fi in preference to cellular. If empty, the
+	// one the OS reports is kept.
+	Interface string
+
+	// Expensive is whether the resulting default route interface is
+	// metered or otherwise costly to use. It populates State.IsExpensive.
+	Expensive bool
+}
+
+// InterfaceRanker chooses the default route interface from the machine's
+// network state, in which DefaultRouteInterface is the one the OS reports.
+// It must not modify s.
+//
+// Platforms whose OS doesn't pick the interface Tailscale should use, such as
+// Android and ChromeOS where the OS default can be the VPN itself or a
+// cellular network while Wi-Fi is up, can set one with
+// [Monitor.SetInterfaceRanker] in place of heuristics in this package.
+type InterfaceRanker func(s *State) InterfaceRanking
+
+// SetInterfaceRanker sets the function the monitor uses to choose the default
+// route interface, replacing any previous one. If r is nil, the OS's choice
+// is used.
+//
+// The network state is re-checked, notifying ChangeFunc callbacks, so that a
+// changed choice takes effect (and magicsock rebinds if needed). Platforms
+// should likewise call [Monitor.InjectEvent] when their ranking's inputs
+// change, such as a policy on metered networks.
+func (m *Monitor) SetInterfaceRanker(r InterfaceRanker) {
+	if m.static {
+		return
+	}
+	m.mu.Lock()
+	m.ranker = r
+	m.mu.Unlock()
+	m.InjectEvent()
+}
+
+// applyRanking updates s per rk, a ranking of s. It returns an error, leaving
+// s unmodified, if rk chooses an interface that's not a viable default:
+// unknown, down, or the Tailscale interface (named tsIfName, if known).
+func (s *State) applyRanking(rk InterfaceRanking, tsIfName string) error {
+	if rk.Interface != "" && rk.Interface != s.DefaultRouteInterface {
+		ni, ok := s.Interface[rk.Interface]
+		switch {
+		case !ok:
+			return fmt.Errorf("unknown interface %q", rk.Interface)
+		case !ni.IsUp():
+			return fmt.Errorf("interface %q is down", rk.Interface)
+		case rk.Interface == tsIfName || isTailscaleInterface(rk.Interface, s.InterfaceIPs[rk.Interface]):
+			return fmt.Errorf("interface %q is Tailscale's", rk.Interface)
+		}
+		s.DefaultRouteInterface = rk.Interface
+		s.DefaultRouteRanked = true
+	}
+	s.IsExpensive = rk.Expensive
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmon
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestApplyRanking(t *testing.T) {
+	up := func(name string) Interface {
+		return Interface{Interface: &net.Interface{Name: name, Flags: net.FlagUp}}
+	}
+	newState := func() *State {
+		return &State{
+			DefaultRouteInterface: "rmnet0",
+			Interface: map[string]Interface{
+				"rmnet0":     up("rmnet0"),
+				"wlan0":      up("wlan0"),
+				"eth0":       {Interface: &net.Interface{Name: "eth0"}},
+				"tailscale0": up("tailscale0"),
+			},
+			InterfaceIPs: map[string][]netip.Prefix{
+				"rmnet0":     {netip.MustParsePrefix("10.1.2.3/8")},
+				"wlan0":      {netip.MustParsePrefix("192.168.1.2/24")},
+				"tailscale0": {netip.MustParsePrefix("100.64.1.2/32")},
+			},
+		}
+	}
+	tests := []struct {
+		name        string
+		rk          InterfaceRanking
+		wantErr     bool
+		wantDefault string
+		wantRanked  bool
+	}{
+		{
+			name:        "keep-os",
+			rk:          InterfaceRanking{Expensive: true},
+			wantDefault: "rmnet0",
+		},
+		{
+			name:        "same-as-os",
+			rk:          InterfaceRanking{Interface: "rmnet0", Expensive: true},
+			wantDefault: "rmnet0",
+		},
+		{
+			name:        "prefer-wifi",
+			rk:          InterfaceRanking{Interface: "wlan0"},
+			wantDefault: "wlan0",
+			wantRanked:  true,
+		},
+		{
+			name:        "unknown",
+			rk:          InterfaceRanking{Interface: "wlan1"},
+			wantErr:     true,
+			wantDefault: "rmnet0",
+		},
+		{
+			name:        "down",
+			rk:          InterfaceRanking{Interface: "eth0"},
+			wantErr:     true,
+			wantDefault: "rmnet0",
+		},
+		{
+			name:        "tailscale",
+			rk:          InterfaceRanking{Interface: "tailscale0"},
+			wantErr:     true,
+			wantDefault: "rmnet0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newState()
+			err := s.applyRanking(tt.rk, "tailscale0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v; want error: %v", err, tt.wantErr)
+			}
+			if s.DefaultRouteInterface != tt.wantDefault || s.DefaultRouteRanked != tt.wantRanked {
+				t.Errorf("default = %q, ranked %v; want %q, ranked %v", s.DefaultRouteInterface, s.DefaultRouteRanked, tt.wantDefault, tt.wantRanked)
+			}
+			if wantExpensive := tt.rk.Expensive && !tt.wantErr; s.IsExpensive != wantExpensive {
+				t.Errorf("IsExpensive = %v; want %v", s.IsExpensive, wantExpensive)
+			}
+		})
+	}
+}
+
+func TestRankingRebind(t *testing.T) {
+	wifi := Interface{Interface: &net.Interface{Name: "wlan0", Flags: net.FlagUp}}
+	cell := Interface{Interface: &net.Interface{Name: "rmnet0", Flags: net.FlagUp}}
+	old := &State{
+		DefaultRouteInterface: "rmnet0",
+		IsExpensive:           true,
+		Interface:             map[string]Interface{"rmnet0": cell, "wlan0": wifi},
+		InterfaceIPs: map[string][]netip.Prefix{
+			"rmnet0": {netip.MustParsePrefix("10.1.2.3/8")},
+			"wlan0":  {netip.MustParsePrefix("192.168.1.2/24")},
+		},
+	}
+	s := *old
+	if err := s.applyRanking(InterfaceRanking{Interface: "wlan0"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	cd, err := NewChangeDelta(old, &s, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cd.DefaultInterfaceChanged || !cd.DefaultInterfaceRanked || !cd.IsLessExpensive || !cd.RebindLikelyRequired {
+		t.Errorf("got changed=%v ranked=%v lessExpensive=%v rebind=%v; want all true",
+			cd.DefaultInterfaceChanged, cd.DefaultInterfaceRanked, cd.IsLessExpensive, cd.RebindLikelyRequired)
+	}
+}
@@ -287,6 +287,11 @@ type State struct {
 	// InterfaceIPs.
 	DefaultRouteInterface string
 
+	// DefaultRouteRanked is whether DefaultRouteInterface was chosen by
+	// the Monitor's InterfaceRanker over the one the OS reported. It's
+	// not considered by Equal.
+	DefaultRouteRanked bool
+
 	// HTTPProxy is the HTTP proxy to use, if any.
 	HTTPProxy string
 
@@ -301,6 +306,9 @@ func (s *State) String() string {
 		if iface, ok := s.Interface[s.DefaultRouteInterface]; ok && iface.Desc != "" {
 			fmt.Fprintf(&sb, "(%s) ", iface.Desc)
 		}
+		if s.DefaultRouteRanked {
+			sb.WriteString("(ranked) ")
+		}
 	}
 	sb.WriteString("ifs={")
 	var ifs []string
@@ -0,0 +1,38 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmon
+
+import "tailscale.com/syncs"
+
+// VRFConfig is how tailscaled places its traffic in Linux VRFs (virtual
+// routing and forwarding domains), as on routers whose management and data
+// planes are separated.
+//
+// The zero value means to use the default VRF for everything. It's only used
+// on Linux.
+type VRFConfig struct {
+	// Physical, if non-empty, is the name of the VRF device that tailscaled's
+	// own sockets, such as those to the control plane, DERP servers, and
+	// peers, are bound to. The default route is then looked up in the VRF's
+	// routing table.
+	Physical string
+
+	// TUN, if non-empty, is the name of the VRF device that the TUN
+	// interface is enslaved to, so that Tailscale's routes go in the VRF's
+	// routing table. It must differ from Physical.
+	TUN string
+}
+
+var vrfConfig syncs.AtomicValue[VRFConfig]
+
+// SetVRFConfig sets the VRF configuration of the process. It should be called
+// before any sockets are created and before the TUN interface is configured.
+func SetVRFConfig(c VRFConfig) {
+	vrfConfig.Store(c)
+}
+
+// GetVRFConfig returns the VRF configuration set by SetVRFConfig.
+func GetVRFConfig() VRFConfig {
+	return vrfConfig.Load()
+}
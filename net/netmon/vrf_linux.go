@@ -0,0 +1,87 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package netmon
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// VRF is a Linux VRF device.
+type VRF struct {
+	Name  string
+	Index int
+	Table uint32 // the VRF's routing table
+}
+
+// LinuxVRFs returns the VRF devices on the system.
+func LinuxVRFs() ([]VRF, error) {
+	c, err := rtnetlink.Dial(&netlink.Config{Strict: true})
+	if err != nil {
+		return nil, fmt.Errorf("LinuxVRFs: Dial: %w", err)
+	}
+	defer c.Close()
+	lms, err := c.Link.ListByKind("vrf")
+	if err != nil {
+		return nil, fmt.Errorf("LinuxVRFs: List: %w", err)
+	}
+	var ret []VRF
+	for _, lm := range lms {
+		if lm.Attributes == nil || lm.Attributes.Info == nil || lm.Attributes.Info.Kind != "vrf" {
+			continue
+		}
+		table, err := parseVRFTable(lm.Attributes.Info.Data)
+		if err != nil {
+			return nil, fmt.Errorf("LinuxVRFs: %s: %w", lm.Attributes.Name, err)
+		}
+		ret = append(ret, VRF{
+			Name:  lm.Attributes.Name,
+			Index: int(lm.Index),
+			Table: table,
+		})
+	}
+	return ret, nil
+}
+
+// LinuxVRFByName returns the VRF device with the given name.
+func LinuxVRFByName(name string) (VRF, error) {
+	vrfs, err := LinuxVRFs()
+	if err != nil {
+		return VRF{}, err
+	}
+	for _, v := range vrfs {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return VRF{}, fmt.Errorf("no VRF device named %q", name)
+}
+
+// parseVRFTable returns the routing table from the IFLA_INFO_DATA of a VRF
+// device.
+func parseVRFTable(data []byte) (uint32, error) {
+	ad, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return 0, err
+	}
+	var table uint32
+	for ad.Next() {
+		if ad.Type() == unix.IFLA_VRF_TABLE {
+			table = ad.Uint32()
+		}
+	}
+	if err := ad.Err(); err != nil {
+		return 0, err
+	}
+	if table == 0 {
+		return 0, errors.New("no routing table")
+	}
+	return table, nil
+}
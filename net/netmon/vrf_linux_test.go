@@ -0,0 +1,47 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmon
+
+import (
+	"testing"
+
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseVRFTable(t *testing.T) {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(unix.IFLA_VRF_TABLE, 1001)
+	data, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseVRFTable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1001 {
+		t.Errorf("got table %d; want 1001", got)
+	}
+
+	if _, err := parseVRFTable(nil); err == nil {
+		t.Error("got no error for a VRF without a table")
+	}
+}
+
+func TestRouteMessageTable(t *testing.T) {
+	tests := []struct {
+		rm   rtnetlink.RouteMessage
+		want uint32
+	}{
+		{rtnetlink.RouteMessage{Table: unix.RT_TABLE_MAIN}, unix.RT_TABLE_MAIN},
+		{rtnetlink.RouteMessage{Table: unix.RT_TABLE_COMPAT, Attributes: rtnetlink.RouteAttributes{Table: 1001}}, 1001},
+	}
+	for _, tt := range tests {
+		if got := routeMessageTable(tt.rm); got != tt.want {
+			t.Errorf("routeMessageTable(%+v) = %d; want %d", tt.rm, got, tt.want)
+		}
+	}
+}
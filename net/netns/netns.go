@@ -14,12 +14,19 @@
 package netns
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"log"
 	"net"
 	"net/netip"
 	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
 
+	"tailscale.com/envknob"
 	"tailscale.com/net/netknob"
 	"tailscale.com/net/netmon"
 	"tailscale.com/types/logger"
@@ -84,6 +91,120 @@ func SetDisableBindConnToInterfaceAppleExt(logf logger.Logf, v bool) {
 	}
 }
 
+// interfaceOverride is an interface to bind sockets to when their
+// destination is in pfx.
+type interfaceOverride struct {
+	pfx    netip.Prefix
+	ifName string
+}
+
+// bindInterfaceByPrefix, if non-nil, are the interface overrides set by
+// SetBindInterfaceByPrefix, sorted from most to least specific prefix.
+var bindInterfaceByPrefix atomic.Pointer[[]interfaceOverride]
+
+var bindInterfaceByPrefixEnv = envknob.RegisterString("TS_BIND_TO_INTERFACE_BY_PREFIX")
+
+// SetBindInterfaceByPrefix sets the network interfaces to bind sockets to,
+// by the prefix containing their destination address, overriding the
+// interface which would otherwise be chosen. This allows multi-homed
+// machines such as routers to send control and DERP traffic over a
+// particular uplink. If a destination is in several prefixes, the longest
+// one applies. A nil or empty m removes all overrides.
+//
+// It replaces any overrides from the TS_BIND_TO_INTERFACE_BY_PREFIX
+// environment variable, which has the format of
+// ParseBindInterfaceByPrefix.
+//
+// Currently, this only changes the behaviour on Linux, where it uses
+// SO_BINDTODEVICE.
+func SetBindInterfaceByPrefix(logf logger.Logf, m map[netip.Prefix]string) {
+	overrides := sortedInterfaceOverrides(m)
+	bindInterfaceByPrefix.Store(&overrides)
+	logf("netns: bindInterfaceByPrefix changed to %v", m)
+}
+
+func sortedInterfaceOverrides(m map[netip.Prefix]string) []interfaceOverride {
+	overrides := make([]interfaceOverride, 0, len(m))
+	for pfx, ifName := range m {
+		overrides = append(overrides, interfaceOverride{pfx.Masked(), ifName})
+	}
+	slices.SortFunc(overrides, func(a, b interfaceOverride) int {
+		return cmp.Or(
+			cmp.Compare(b.pfx.Bits(), a.pfx.Bits()),
+			a.pfx.Addr().Compare(b.pfx.Addr()),
+		)
+	})
+	return overrides
+}
+
+// ParseBindInterfaceByPrefix parses a comma-separated list of
+// "prefix=interface" pairs, such as "0.0.0.0/0=wan0,192.168.0.0/16=eth1",
+// into a map for SetBindInterfaceByPrefix.
+func ParseBindInterfaceByPrefix(s string) (map[netip.Prefix]string, error) {
+	m := map[netip.Prefix]string{}
+	for f := range strings.SplitSeq(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		pfxStr, ifName, ok := strings.Cut(f, "=")
+		if !ok || ifName == "" {
+			return nil, fmt.Errorf("invalid override %q; want prefix=interface", f)
+		}
+		pfx, err := netip.ParsePrefix(pfxStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid override %q: %w", f, err)
+		}
+		m[pfx.Masked()] = ifName
+	}
+	return m, nil
+}
+
+// loadEnvBindInterfaceByPrefix sets the interface overrides from the
+// environment, if there are any and they haven't been set already.
+var loadEnvBindInterfaceByPrefix = sync.OnceFunc(func() {
+	s := bindInterfaceByPrefixEnv()
+	if s == "" {
+		return
+	}
+	m, err := ParseBindInterfaceByPrefix(s)
+	if err != nil {
+		log.Printf("netns: ignoring TS_BIND_TO_INTERFACE_BY_PREFIX: %v", err)
+		return
+	}
+	overrides := sortedInterfaceOverrides(m)
+	if bindInterfaceByPrefix.CompareAndSwap(nil, &overrides) {
+		log.Printf("netns: bindInterfaceByPrefix set to %v from environment", m)
+	}
+})
+
+// interfaceOverrideFor returns the name of the interface to bind a socket
+// dialing address to, if it's overridden by SetBindInterfaceByPrefix.
+func interfaceOverrideFor(address string) (ifName string, ok bool) {
+	loadEnvBindInterfaceByPrefix()
+	overrides := bindInterfaceByPrefix.Load()
+	if overrides == nil || len(*overrides) == 0 {
+		return "", false
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || ip.IsUnspecified() {
+		// Names, and unspecified addresses of listeners, have no
+		// destination to match.
+		return "", false
+	}
+	ip = ip.Unmap().WithZone("")
+	for _, o := range *overrides {
+		if o.pfx.Contains(ip) {
+			return o.ifName, true
+		}
+	}
+	return "", false
+}
+
 // Listener returns a new net.Listener with its Control hook func
 // initialized as necessary to run in logical network namespace that
 // doesn't route back into Tailscale.
@@ -92,11 +92,30 @@ func controlC(network, address string, c syscall.RawConn) error {
 		return nil
 	}
 
+	ifName, override := interfaceOverrideFor(address)
+	if !override {
+		// Binding to a VRF device scopes the socket to the VRF, so
+		// that its routes are looked up in the VRF's routing table.
+		ifName = netmon.GetVRFConfig().Physical
+		override = ifName != ""
+	}
+
 	var sockErr error
 	err := c.Control(func(fd uintptr) {
-		if UseSocketMark() {
+		switch {
+		case override:
+			// Still mark the socket, if we can, so its packets skip
+			// Tailscale's routes, and additionally bind it to the
+			// interface or VRF to pick the uplink they leave by.
+			if UseSocketMark() {
+				sockErr = setBypassMark(fd)
+			}
+			if sockErr == nil {
+				sockErr = bindToDeviceName(fd, ifName)
+			}
+		case UseSocketMark():
 			sockErr = setBypassMark(fd)
-		} else {
+		default:
 			sockErr = bindToDevice(fd)
 		}
 	})
@@ -126,8 +145,12 @@ func bindToDevice(fd uintptr) error {
 		// a default route anyway, it doesn't matter.
 		ifc = "lo"
 	}
+	return bindToDeviceName(fd, ifc)
+}
+
+func bindToDeviceName(fd uintptr, ifc string) error {
 	if err := unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, ifc); err != nil {
-		return fmt.Errorf("setting SO_BINDTODEVICE: %w", err)
+		return fmt.Errorf("setting SO_BINDTODEVICE to %q: %w", ifc, err)
 	}
 	return nil
 }
@@ -76,3 +76,45 @@ func TestIsLocalhost(t *testing.T) {
 		}
 	}
 }
+
+func TestInterfaceOverrideFor(t *testing.T) {
+	m, err := ParseBindInterfaceByPrefix("0.0.0.0/0=wan0, 192.168.0.0/16=eth1,192.168.7.0/24=eth2,::/0=wan0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetBindInterfaceByPrefix(t.Logf, m)
+	defer SetBindInterfaceByPrefix(t.Logf, nil)
+
+	tests := []struct {
+		address string
+		want    string // or empty for no override
+	}{
+		{"1.2.3.4:443", "wan0"},
+		{"192.168.1.1:80", "eth1"},
+		{"192.168.7.1:80", "eth2"},
+		{"192.168.7.1", "eth2"},
+		{"[::ffff:192.168.7.1]:80", "eth2"},
+		{"[2001:db8::1]:443", "wan0"},
+		{"[fe80::1%eth0]:443", "wan0"},
+		{"0.0.0.0:0", ""},
+		{"[::]:41641", ""},
+		{"example.com:443", ""},
+	}
+	for _, tt := range tests {
+		got, ok := interfaceOverrideFor(tt.address)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("interfaceOverrideFor(%q) = %q, %v; want %q", tt.address, got, ok, tt.want)
+		}
+	}
+
+	SetBindInterfaceByPrefix(t.Logf, nil)
+	if got, ok := interfaceOverrideFor("1.2.3.4:443"); ok {
+		t.Errorf("after clearing, interfaceOverrideFor = %q; want none", got)
+	}
+
+	for _, bad := range []string{"10.0.0.0/8", "10.0.0.0/8=", "10.0.0.0/33=eth0", "eth0=10.0.0.0/8"} {
+		if _, err := ParseBindInterfaceByPrefix(bad); err == nil {
+			t.Errorf("ParseBindInterfaceByPrefix(%q) succeeded; want error", bad)
+		}
+	}
+}
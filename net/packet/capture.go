@@ -51,6 +51,11 @@ type CaptureMeta struct {
 	OriginalSrc netip.AddrPort // The source address before SNAT was performed.
 	DidDNAT     bool           // DNAT was performed & the address was updated.
 	OriginalDst netip.AddrPort // The destination address before DNAT was performed.
+
+	// DropReason, if non-empty, is why the packet filter dropped the
+	// packet. Dropped packets are captured a second time, after the
+	// filter, with this set.
+	DropReason string
 }
 
 // CapturePath describes where in the data path the packet was captured.
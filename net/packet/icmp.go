@@ -26,3 +26,57 @@ func ICMPEchoPayload(payload []byte) (idSeq uint32, buf []byte) {
 
 	return
 }
+
+const (
+	// maxICMP4ErrorLen is the largest ICMPv4 error we generate, the
+	// minimum datagram size that all IPv4 hosts must accept (RFC 1812,
+	// section 4.3.2.3).
+	maxICMP4ErrorLen = 576
+	// maxICMP6ErrorLen is the largest ICMPv6 error we generate, the IPv6
+	// minimum MTU (RFC 4443, section 2.4).
+	maxICMP6ErrorLen = 1280
+)
+
+// PacketTooBig returns an ICMPv4 "fragmentation needed" (RFC 1191) or ICMPv6
+// "packet too big" (RFC 8201) error in response to q, telling its sender
+// that the path MTU towards q's destination is mtu. The error appears to
+// come from q's destination.
+//
+// It returns nil if q doesn't warrant one: if it's neither an IPv4 packet
+// with the don't-fragment bit set nor an IPv6 packet, or if it's an ICMP
+// error itself.
+func PacketTooBig(q *Parsed, mtu uint32) []byte {
+	if q.length > len(q.b) || q.IsError() {
+		return nil
+	}
+	orig := q.b[:q.length]
+	switch q.IPVersion {
+	case 4:
+		const dontFragment = 0x40
+		if orig[6]&dontFragment == 0 {
+			return nil
+		}
+		h := ICMP4Header{
+			IP4Header: IP4Header{Src: q.Dst.Addr(), Dst: q.Src.Addr()},
+			Type:      ICMP4Unreachable,
+			Code:      ICMP4FragmentationNeeded,
+		}
+		orig = orig[:min(len(orig), maxICMP4ErrorLen-h.Len()-4)]
+		payload := make([]byte, 4+len(orig))
+		binary.BigEndian.PutUint16(payload[2:4], uint16(min(mtu, 0xffff))) // next-hop MTU
+		copy(payload[4:], orig)
+		return Generate(h, payload)
+	case 6:
+		h := ICMP6Header{
+			IP6Header: IP6Header{Src: q.Dst.Addr(), Dst: q.Src.Addr()},
+			Type:      ICMP6PacketTooBig,
+			Code:      ICMP6NoCode,
+		}
+		orig = orig[:min(len(orig), maxICMP6ErrorLen-h.Len()-4)]
+		payload := make([]byte, 4+len(orig))
+		binary.BigEndian.PutUint32(payload[:4], mtu)
+		copy(payload[4:], orig)
+		return Generate(h, payload)
+	}
+	return nil
+}
@@ -49,6 +49,11 @@ func (t ICMP4Type) String() string {
 
 const (
 	ICMP4NoCode ICMP4Code = 0
+
+	// ICMP4FragmentationNeeded is the ICMP4Unreachable code that tells the
+	// sender that a packet with the don't-fragment bit set was too big for
+	// the path (RFC 1191).
+	ICMP4FragmentationNeeded ICMP4Code = 4
 )
 
 // ICMP4Header is an IPv4+ICMPv4 header.
@@ -5,6 +5,7 @@
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"net/netip"
 	"reflect"
@@ -752,3 +753,73 @@ func BenchmarkString(b *testing.B) {
 		})
 	}
 }
+
+func TestPacketTooBig(t *testing.T) {
+	src4, dst4 := netip.MustParseAddr("100.64.0.1"), netip.MustParseAddr("100.64.0.2")
+	src6, dst6 := netip.MustParseAddr("fd7a:115c:a1e0::1"), netip.MustParseAddr("fd7a:115c:a1e0::2")
+	payload := bytes.Repeat([]byte{'x'}, 1400)
+
+	udp4 := Generate(UDP4Header{IP4Header: IP4Header{Src: src4, Dst: dst4}, SrcPort: 1234, DstPort: 5678}, payload)
+	udp4DF := bytes.Clone(udp4)
+	udp4DF[6] |= 0x40
+	udp6 := Generate(UDP6Header{IP6Header: IP6Header{Src: src6, Dst: dst6}, SrcPort: 1234, DstPort: 5678}, payload)
+
+	var q Parsed
+	q.Decode(udp4)
+	if got := PacketTooBig(&q, 1280); got != nil {
+		t.Errorf("PacketTooBig for IPv4 without DF = %x; want nil", got)
+	}
+
+	q.Decode(udp4DF)
+	b := PacketTooBig(&q, 1280)
+	var r Parsed
+	r.Decode(b)
+	if r.IPProto != ICMPv4 || r.Src.Addr() != dst4 || r.Dst.Addr() != src4 {
+		t.Fatalf("IPv4 error = %v; want ICMPv4 from %v to %v", r.String(), dst4, src4)
+	}
+	if h := r.ICMP4Header(); h.Type != ICMP4Unreachable || h.Code != ICMP4FragmentationNeeded {
+		t.Errorf("IPv4 error type/code = %v/%v", h.Type, h.Code)
+	}
+	if !r.IsError() {
+		t.Error("IPv4 error IsError = false")
+	}
+	if len(b) > maxICMP4ErrorLen {
+		t.Errorf("IPv4 error is %d bytes; want at most %d", len(b), maxICMP4ErrorLen)
+	}
+	icmp := b[ip4HeaderLength:]
+	if mtu := binary.BigEndian.Uint16(icmp[6:8]); mtu != 1280 {
+		t.Errorf("IPv4 next-hop MTU = %d; want 1280", mtu)
+	}
+	if !bytes.Equal(icmp[8:8+28], udp4DF[:28]) {
+		t.Errorf("IPv4 error doesn't quote the original headers")
+	}
+	if xsum := ip4Checksum(icmp); xsum != 0 {
+		t.Errorf("IPv4 error ICMP checksum invalid (residue %#x)", xsum)
+	}
+
+	// ICMP errors aren't answered with ICMP errors.
+	if got := PacketTooBig(&r, 1280); got != nil {
+		t.Errorf("PacketTooBig for ICMP error = %x; want nil", got)
+	}
+
+	q.Decode(udp6)
+	b = PacketTooBig(&q, 1400)
+	r.Decode(b)
+	if r.IPProto != ICMPv6 || r.Src.Addr() != dst6 || r.Dst.Addr() != src6 {
+		t.Fatalf("IPv6 error = %v; want ICMPv6 from %v to %v", r.String(), dst6, src6)
+	}
+	if h := r.ICMP6Header(); h.Type != ICMP6PacketTooBig {
+		t.Errorf("IPv6 error type = %v", h.Type)
+	}
+	if len(b) != maxICMP6ErrorLen {
+		t.Errorf("IPv6 error is %d bytes; want %d", len(b), maxICMP6ErrorLen)
+	}
+	icmp = b[ip6HeaderLength:]
+	if mtu := binary.BigEndian.Uint32(icmp[4:8]); mtu != 1400 {
+		t.Errorf("IPv6 MTU = %d; want 1400", mtu)
+	}
+	want := icmp6Checksum(icmp[:4], dst6.As16(), src6.As16(), icmp[4:])
+	if got := binary.BigEndian.Uint16(icmp[2:4]); got != want {
+		t.Errorf("IPv6 error ICMP checksum = %#x; want %#x", got, want)
+	}
+}
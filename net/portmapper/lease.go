@@ -0,0 +1,112 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package portmapper
+
+import (
+	"time"
+
+	"tailscale.com/net/netmon"
+	"tailscale.com/net/portmapper/portmappertype"
+	"tailscale.com/util/clientmetric"
+)
+
+// The lease manager keeps the Client's mapping renewed without waiting for
+// a caller to ask for it: it renews the mapping at its RenewAfter time, and
+// again whenever netmon reports that the machine woke from sleep.
+//
+// Renewing after a wake matters because mapping deadlines carry monotonic
+// clock readings, which on some platforms don't advance while the machine
+// is suspended. A mapping whose lease ran out during a long sleep would
+// otherwise look valid for however long the machine was asleep, and a
+// renewal timer armed before the sleep would fire that much too late.
+
+// onLinkChange is the netmon.ChangeDelta subscriber for the lease manager.
+func (c *Client) onLinkChange(delta netmon.ChangeDelta) {
+	if !delta.TimeJumped() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noteWakeLocked(time.Now())
+}
+
+// noteWakeLocked renews the current mapping, if any, after the machine
+// woke from sleep at time now. If the mapping's lease expired by the wall
+// clock, it's dropped first, so that it's no longer handed out.
+//
+// c.mu must be held.
+func (c *Client) noteWakeLocked(now time.Time) {
+	if c.closed || c.mapping == nil {
+		return
+	}
+	c.lastWake = now
+	metricLeaseWakeRenewals.Add(1)
+
+	m := c.mapping
+	if !now.Round(0).Before(m.GoodUntil().Round(0)) {
+		c.logf("mapping %v expired during sleep; creating a new one", m.External())
+		c.mapping = nil
+		c.stopRenewTimerLocked()
+	} else {
+		c.vlogf("renewing mapping %v after wake", m.External())
+		c.forceRenew = true
+	}
+	c.maybeStartMappingLocked()
+}
+
+// scheduleRenewalLocked arms the renewal timer to renew m, which must be
+// the current mapping, at its RenewAfter time.
+//
+// c.mu must be held.
+func (c *Client) scheduleRenewalLocked(m mapping) {
+	c.stopRenewTimerLocked()
+	if c.closed || c.mapping != m {
+		return
+	}
+	c.renewTimer = time.AfterFunc(time.Until(m.RenewAfter()), func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.closed || c.mapping != m {
+			return
+		}
+		c.renewTimer = nil
+		metricLeaseTimerRenewals.Add(1)
+		c.maybeStartMappingLocked()
+	})
+}
+
+// stopRenewTimerLocked stops the renewal timer, if it's armed.
+//
+// c.mu must be held.
+func (c *Client) stopRenewTimerLocked() {
+	if c.renewTimer != nil {
+		c.renewTimer.Stop()
+		c.renewTimer = nil
+	}
+}
+
+// Leases returns the port mapping leases c currently holds, for debugging.
+// It holds at most one.
+func (c *Client) Leases() []portmappertype.Lease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.mapping
+	if m == nil {
+		return nil
+	}
+	return []portmappertype.Lease{{
+		Mapping: portmappertype.Mapping{
+			External:  m.External(),
+			Type:      m.MappingType(),
+			GoodUntil: m.GoodUntil(),
+		},
+		RenewAfter: m.RenewAfter(),
+		LastWake:   c.lastWake,
+	}}
+}
+
+var (
+	metricLeaseTimerRenewals = clientmetric.NewCounter("portmap_lease_timer_renewals")
+	metricLeaseWakeRenewals  = clientmetric.NewCounter("portmap_lease_wake_renewals")
+)
@@ -151,6 +151,11 @@ type Client struct {
 	localPort uint16
 
 	mapping mapping // non-nil if we have a mapping
+
+	// The following fields are used by the lease manager; see lease.go.
+	renewTimer *time.Timer // fires at mapping.RenewAfter; nil if none
+	forceRenew bool        // renew mapping even before its RenewAfter
+	lastWake   time.Time   // when a wake from sleep last renewed mappings
 }
 
 var _ portmappertype.Client = (*Client)(nil)
@@ -272,6 +277,7 @@ func NewClient(c Config) *Client {
 	}
 	ret.pubClient = c.EventBus.Client("portmapper")
 	ret.updates = eventbus.Publish[portmappertype.Mapping](ret.pubClient)
+	eventbus.SubscribeFunc(ret.pubClient, ret.onLinkChange)
 	if ret.logf == nil {
 		ret.logf = logger.Discard
 	}
@@ -300,12 +306,16 @@ func (c *Client) NoteNetworkDown() {
 
 func (c *Client) Close() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	if c.closed {
+		c.mu.Unlock()
 		return nil
 	}
 	c.closed = true
 	c.invalidateMappingsLocked(true)
+	c.mu.Unlock()
+
+	// Close the eventbus client without holding c.mu, as its subscriber
+	// (onLinkChange) acquires c.mu.
 	c.updates.Close()
 	c.pubClient.Close()
 
@@ -398,6 +408,8 @@ func (c *Client) invalidateMappingsLocked(releaseOld bool) {
 		}
 		c.mapping = nil
 	}
+	c.stopRenewTimerLocked()
+	c.forceRenew = false
 
 	c.pmpPubIP = netip.Addr{}
 	c.pmpPubIPTime = time.Time{}
@@ -527,6 +539,10 @@ func (c *Client) createMapping() {
 		// the control flow to eliminate that possibility. Meanwhile, this
 		// mitigates a panic downstream, cf. #16662.
 	}
+	c.mu.Lock()
+	c.scheduleRenewalLocked(mapping)
+	c.mu.Unlock()
+
 	c.updates.Publish(portmappertype.Mapping{
 		External:  mapping.External(),
 		Type:      mapping.MappingType(),
@@ -621,7 +637,7 @@ func (c *Client) createOrGetMapping(ctx context.Context) (mapping mapping, exter
 
 	// Do we have an existing mapping that's valid?
 	if m := c.mapping; m != nil {
-		if now.Before(m.RenewAfter()) {
+		if now.Before(m.RenewAfter()) && !c.forceRenew {
 			defer c.mu.Unlock()
 			reusedExisting = true
 			return nil, m.External(), nil
@@ -629,6 +645,7 @@ func (c *Client) createOrGetMapping(ctx context.Context) (mapping mapping, exter
 		// The mapping might still be valid, so just try to renew it.
 		prevPort = m.External().Port()
 	}
+	c.forceRenew = false
 
 	if c.debug.DisablePCP() && c.debug.DisablePMP() {
 		c.mu.Unlock()
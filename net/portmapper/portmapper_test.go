@@ -5,12 +5,14 @@
 
 import (
 	"context"
+	"net/netip"
 	"os"
 	"reflect"
 	"strconv"
 	"testing"
 	"time"
 
+	"tailscale.com/net/netmon"
 	"tailscale.com/net/portmapper/portmappertype"
 	"tailscale.com/util/eventbus/eventbustest"
 )
@@ -154,3 +156,68 @@ func TestUpdateEvent(t *testing.T) {
 		t.Error(err.Error())
 	}
 }
+
+func TestLeaseRenewAfterWake(t *testing.T) {
+	igd, err := NewTestIGD(t, TestIGDOptions{PCP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer igd.Close()
+
+	c := newTestClient(t, igd, nil)
+	if _, err := c.Probe(t.Context()); err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	c.createMapping()
+	leases := c.Leases()
+	if len(leases) != 1 || leases[0].Type != "pcp" || !leases[0].LastWake.IsZero() {
+		t.Fatalf("Leases = %+v; want one pcp lease", leases)
+	}
+	c.mu.Lock()
+	first := c.mapping
+	haveTimer := c.renewTimer != nil
+	c.mu.Unlock()
+	if !haveTimer {
+		t.Error("no renewal timer armed for new mapping")
+	}
+
+	// A wake renews the mapping even though it's not due for renewal.
+	mapsBefore := igd.stats().numPCPMapRecv
+	c.onLinkChange(netmon.ChangeDelta{JumpDuration: time.Hour})
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for range 100 {
+			c.mu.Lock()
+			ok := !c.runningCreate && cond()
+			c.mu.Unlock()
+			if ok {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	waitFor("renewal", func() bool { return c.mapping != nil && c.mapping != first })
+	if got := igd.stats().numPCPMapRecv; got <= mapsBefore {
+		t.Errorf("PCP map requests = %d after wake; want more than %d", got, mapsBefore)
+	}
+	if leases := c.Leases(); len(leases) != 1 || leases[0].LastWake.IsZero() {
+		t.Errorf("Leases after wake = %+v; want LastWake set", leases)
+	}
+
+	// A mapping that expired during sleep is dropped right away.
+	c.mu.Lock()
+	expired := &pcpMapping{
+		c:          c,
+		external:   netip.MustParseAddrPort("203.0.113.1:4242"),
+		renewAfter: time.Now().Add(-2 * time.Minute),
+		goodUntil:  time.Now().Add(-time.Minute),
+	}
+	c.mapping = expired
+	c.noteWakeLocked(time.Now())
+	if c.mapping == expired {
+		t.Error("expired mapping still held after wake")
+	}
+	c.mu.Unlock()
+	waitFor("new mapping", func() bool { return c.mapping != nil })
+}
@@ -75,6 +75,10 @@ type Client interface {
 	// map UDP traffic
 	SetLocalPort(localPort uint16)
 
+	// Leases returns the port mapping leases the client currently holds,
+	// for debugging. A client holds at most one lease at a time.
+	Leases() []Lease
+
 	Close() error
 }
 
@@ -86,3 +90,15 @@ type Mapping struct {
 
 	// TODO(creachadair): Record whether we reused an existing mapping?
 }
+
+// Lease describes a port mapping lease held by a [Client].
+type Lease struct {
+	Mapping
+
+	// RenewAfter is when the client will renew the mapping.
+	RenewAfter time.Time
+
+	// LastWake is when the client last renewed its mappings after the
+	// machine woke from sleep, or the zero time if it hasn't.
+	LastWake time.Time
+}
@@ -7,6 +7,7 @@
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"io"
 	"log"
@@ -29,11 +30,34 @@
 
 	stunIPv4 = stunAddrFamily.Get("ipv4")
 	stunIPv6 = stunAddrFamily.Get("ipv6")
+
+	stunTransport = stats.NewLabelMap("counter_transport", "transport")
+	stunTCP       = stunTransport.Get("tcp")
+	stunTCPConns  = stats.NewLabelMap("counter_tcp_conns", "disposition")
+	stunTCPAccept = stunTCPConns.Get("accepted")
+	stunTCPReject = stunTCPConns.Get("rejected")
+)
+
+const (
+	// tcpIdleTimeout is how long a STUN-over-TCP connection may go
+	// without a request before the server closes it.
+	tcpIdleTimeout = 30 * time.Second
+
+	// maxTCPConns is the maximum number of concurrent STUN-over-TCP
+	// connections.
+	maxTCPConns = 1000
+
+	// maxTCPMessageLen is the largest STUN message body the server reads
+	// over TCP. Binding requests are much smaller than this.
+	maxTCPMessageLen = 512
 )
 
 type STUNServer struct {
 	ctx context.Context // ctx signals service shutdown
 	pc  *net.UDPConn    // pc is the UDP listener
+	ln  net.Listener    // ln is the TCP listener, if any
+
+	tcpConns chan struct{} // semaphore of active TCP connections
 }
 
 // New creates a new STUN server. The server is shutdown when ctx is done.
@@ -117,3 +141,115 @@ func (s *STUNServer) ListenAndServe(listenAddr string) error {
 func (s *STUNServer) LocalAddr() net.Addr {
 	return s.pc.LocalAddr()
 }
+
+// ListenTCP binds a TCP listener for the server at listenAddr, for clients on
+// networks that block UDP.
+func (s *STUNServer) ListenTCP(listenAddr string) error {
+	var err error
+	s.ln, err = net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+	s.tcpConns = make(chan struct{}, maxTCPConns)
+	log.Printf("STUN server listening on TCP %v", s.ln.Addr())
+	go func() {
+		<-s.ctx.Done()
+		s.ln.Close()
+	}()
+	return nil
+}
+
+// ServeTCP starts serving responses to STUN requests over TCP. ListenTCP must
+// be called before ServeTCP.
+//
+// STUN messages over TCP need no extra framing, as the STUN header carries
+// the message length (RFC 5389, section 7.2.2). Each connection may carry
+// any number of binding requests.
+func (s *STUNServer) ServeTCP() error {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("STUN Accept: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		select {
+		case s.tcpConns <- struct{}{}:
+			stunTCPAccept.Add(1)
+			go func() {
+				defer func() { <-s.tcpConns }()
+				s.serveTCPConn(c)
+			}()
+		default:
+			stunTCPReject.Add(1)
+			c.Close()
+		}
+	}
+}
+
+// ListenAndServeTCP starts the STUN server over TCP on listenAddr.
+func (s *STUNServer) ListenAndServeTCP(listenAddr string) error {
+	if err := s.ListenTCP(listenAddr); err != nil {
+		return err
+	}
+	return s.ServeTCP()
+}
+
+// TCPAddr returns the local address of the server's TCP listener. It must not
+// be called before ListenTCP.
+func (s *STUNServer) TCPAddr() net.Addr {
+	return s.ln.Addr()
+}
+
+func (s *STUNServer) serveTCPConn(c net.Conn) {
+	defer c.Close()
+	ta, ok := c.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	remote := ta.AddrPort()
+	remote = netip.AddrPortFrom(remote.Addr().Unmap(), remote.Port())
+
+	buf := make([]byte, 20+maxTCPMessageLen) // 20 is the STUN header length
+	for {
+		c.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+		hdr := buf[:20]
+		if _, err := io.ReadFull(c, hdr); err != nil {
+			return
+		}
+		if !stun.Is(hdr) {
+			stunNotSTUN.Add(1)
+			return
+		}
+		n := int(binary.BigEndian.Uint16(hdr[2:4]))
+		if n > maxTCPMessageLen {
+			stunNotSTUN.Add(1)
+			return
+		}
+		pkt := buf[:20+n]
+		if _, err := io.ReadFull(c, pkt[20:]); err != nil {
+			stunReadError.Add(1)
+			return
+		}
+		txid, err := stun.ParseBindingRequest(pkt)
+		if err != nil {
+			stunNotSTUN.Add(1)
+			return
+		}
+		stunTCP.Add(1)
+		if remote.Addr().Is4() {
+			stunIPv4.Add(1)
+		} else {
+			stunIPv6.Add(1)
+		}
+		c.SetWriteDeadline(time.Now().Add(tcpIdleTimeout))
+		if _, err := c.Write(stun.Response(txid, remote)); err != nil {
+			stunWriteError.Add(1)
+			return
+		}
+		stunSuccess.Add(1)
+	}
+}
@@ -5,6 +5,8 @@
 
 import (
 	"context"
+	"encoding/binary"
+	"io"
 	"net"
 	"sync"
 	"testing"
@@ -58,6 +60,65 @@ func TestSTUNServer(t *testing.T) {
 	}
 }
 
+func TestSTUNServerTCP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := New(ctx)
+	must.Do(s.ListenTCP("localhost:0"))
+	var w sync.WaitGroup
+	w.Add(1)
+	var serveErr error
+	go func() {
+		defer w.Done()
+		serveErr = s.ServeTCP()
+	}()
+
+	c := must.Get(net.Dial("tcp", s.TCPAddr().String()))
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	wantAddr := c.LocalAddr().(*net.TCPAddr).AddrPort()
+
+	// Several requests can be made over one connection.
+	for range 2 {
+		txid := stun.NewTxID()
+		if _, err := c.Write(stun.Request(txid)); err != nil {
+			t.Fatalf("failed to write STUN request: %v", err)
+		}
+		hdr := make([]byte, 20)
+		if _, err := io.ReadFull(c, hdr); err != nil {
+			t.Fatalf("failed to read STUN response header: %v", err)
+		}
+		res := make([]byte, 20+int(binary.BigEndian.Uint16(hdr[2:4])))
+		copy(res, hdr)
+		if _, err := io.ReadFull(c, res[20:]); err != nil {
+			t.Fatalf("failed to read STUN response: %v", err)
+		}
+		tid, addr, err := stun.ParseResponse(res)
+		if err != nil {
+			t.Fatalf("failed to parse STUN response: %v", err)
+		}
+		if tid != txid {
+			t.Fatalf("STUN response has wrong transaction ID; got %d, want %d", tid, txid)
+		}
+		if addr != wantAddr {
+			t.Fatalf("STUN response has mapped address %v; want %v", addr, wantAddr)
+		}
+	}
+
+	// Anything that's not STUN closes the connection. (It may be reset
+	// rather than closed cleanly, as the rest of the request isn't read.)
+	c.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	if n, err := c.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("read %d bytes after non-STUN request; want connection closed", n)
+	}
+
+	cancel()
+	w.Wait()
+	if serveErr != nil {
+		t.Fatalf("failed to listen and serve: %v", serveErr)
+	}
+}
+
 func BenchmarkServerSTUN(b *testing.B) {
 	b.ReportAllocs()
 	ctx := b.Context()
@@ -0,0 +1,208 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tshttpproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"tailscale.com/util/mak"
+)
+
+// AuthSession is a connection-oriented HTTP proxy authentication handshake,
+// such as NTLM or Negotiate (SPNEGO/Kerberos), in progress on a single
+// connection to a proxy.
+type AuthSession interface {
+	// Step returns the token to send to the proxy in response to its
+	// challenge token. The first call, before the proxy has sent a
+	// challenge, passes a nil challenge.
+	Step(challenge []byte) (token []byte, err error)
+
+	// Close releases any resources held by the session.
+	Close()
+}
+
+var (
+	authSchemesMu sync.Mutex
+	authSchemes   map[string]func(proxyURL *url.URL) (AuthSession, error) // keyed by lowercase scheme
+)
+
+// RegisterAuthScheme registers newSession as the implementation of the
+// named connection-oriented HTTP proxy authentication scheme (for example,
+// "Negotiate" or "NTLM"), for use by [Connect].
+//
+// On Windows, Negotiate and NTLM are registered by default, using the
+// credentials of the current user.
+func RegisterAuthScheme(scheme string, newSession func(proxyURL *url.URL) (AuthSession, error)) {
+	authSchemesMu.Lock()
+	defer authSchemesMu.Unlock()
+	mak.Set(&authSchemes, strings.ToLower(scheme), newSession)
+}
+
+// maxAuthLegs is the maximum number of CONNECT requests Connect sends on a
+// proxy connection before giving up on authenticating.
+const maxAuthLegs = 5
+
+// Connect dials a proxy using dialProxy and asks it to CONNECT to target,
+// a host:port. It returns the resulting tunnel to target.
+//
+// The first CONNECT request carries the Authorization value from
+// [GetAuthHeader], if any. If the proxy then demands authentication, Connect
+// runs the handshake of the first scheme offered by the proxy that has been
+// registered with [RegisterAuthScheme], redialing the proxy with dialProxy
+// if it closes the connection between legs.
+func Connect(ctx context.Context, dialProxy func(context.Context) (net.Conn, error), proxyURL *url.URL, target string) (net.Conn, error) {
+	conn, err := dialProxy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer func() { stop() }()
+	br := bufio.NewReader(conn)
+
+	var (
+		scheme string
+		sess   AuthSession
+	)
+	defer func() {
+		if sess != nil {
+			sess.Close()
+		}
+	}()
+
+	auth, err := GetAuthHeader(proxyURL)
+	if err != nil {
+		log.Printf("tshttpproxy: failed to get proxy auth header for %s; ignoring: %v", proxyURL.Redacted(), err)
+		auth = ""
+	}
+	for leg := 1; ; leg++ {
+		res, err := sendConnect(conn, br, target, auth)
+		if err != nil {
+			conn.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("CONNECT to %s via proxy %s: %w", target, proxyURL.Redacted(), err)
+		}
+		if res.StatusCode == http.StatusOK {
+			if !stop() {
+				return nil, ctx.Err()
+			}
+			if br.Buffered() > 0 {
+				return &bufferedConn{conn, br}, nil
+			}
+			return conn, nil
+		}
+		io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+		res.Body.Close()
+		if res.StatusCode != http.StatusProxyAuthRequired || leg == maxAuthLegs {
+			conn.Close()
+			return nil, fmt.Errorf("invalid response status from HTTP proxy %s on CONNECT to %s: %v", proxyURL.Redacted(), target, res.Status)
+		}
+
+		challenges := res.Header.Values("Proxy-Authenticate")
+		var token []byte
+		if sess == nil {
+			scheme, sess, err = newAuthSession(proxyURL, challenges)
+			if err == nil {
+				token, err = sess.Step(nil)
+			}
+		} else {
+			challenge, ok := challengeFor(challenges, scheme)
+			if !ok || len(challenge) == 0 {
+				err = errors.New("credentials rejected")
+			} else {
+				token, err = sess.Step(challenge)
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("authenticating to HTTP proxy %s: %w", proxyURL.Redacted(), err)
+		}
+		auth = scheme + " " + base64.StdEncoding.EncodeToString(token)
+
+		if res.Close {
+			conn.Close()
+			stop()
+			if conn, err = dialProxy(ctx); err != nil {
+				return nil, err
+			}
+			stop = context.AfterFunc(ctx, func() { conn.Close() })
+			br = bufio.NewReader(conn)
+		}
+	}
+}
+
+// sendConnect writes a CONNECT request for target to conn, with the
+// Proxy-Authorization value auth if non-empty, and reads the proxy's
+// response from br.
+func sendConnect(conn net.Conn, br *bufio.Reader, target, auth string) (*http.Response, error) {
+	var authHeader string
+	if auth != "" {
+		authHeader = proxyAuthHeader + ": " + auth + "\r\n"
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n%s\r\n", target, target, authHeader); err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(br, &http.Request{Method: "CONNECT"})
+}
+
+// newAuthSession starts a session for the first of the proxy's challenges
+// whose scheme is registered.
+func newAuthSession(proxyURL *url.URL, challenges []string) (scheme string, _ AuthSession, _ error) {
+	var offered []string
+	for _, c := range challenges {
+		scheme, _, _ := strings.Cut(strings.TrimSpace(c), " ")
+		authSchemesMu.Lock()
+		newSession, ok := authSchemes[strings.ToLower(scheme)]
+		authSchemesMu.Unlock()
+		if !ok {
+			offered = append(offered, scheme)
+			continue
+		}
+		sess, err := newSession(proxyURL)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", scheme, err)
+		}
+		return scheme, sess, nil
+	}
+	return "", nil, fmt.Errorf("no supported authentication scheme among %q", offered)
+}
+
+// challengeFor returns the decoded challenge token for scheme in the
+// proxy's challenges, which is empty if the proxy sent the scheme without
+// a token. It reports whether the proxy sent scheme at all.
+func challengeFor(challenges []string, scheme string) ([]byte, bool) {
+	for _, c := range challenges {
+		s, tok, _ := strings.Cut(strings.TrimSpace(c), " ")
+		if !strings.EqualFold(s, scheme) {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(tok))
+		if err != nil {
+			return nil, false
+		}
+		return b, true
+	}
+	return nil, false
+}
+
+// bufferedConn is a net.Conn whose reads are served from a bufio.Reader
+// that may hold data the proxy sent right after its CONNECT response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
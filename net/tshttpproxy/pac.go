@@ -0,0 +1,376 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tshttpproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/mak"
+)
+
+var (
+	// pacURLKnob is the URL of a proxy auto-config (PAC) file to use to
+	// choose the proxy for each URL. It may be an http, https or file URL.
+	pacURLKnob = envknob.RegisterString("TS_PROXY_PAC_URL")
+
+	// debugPAC logs every PAC decision, not just changes.
+	debugPAC = envknob.RegisterBool("TS_DEBUG_PROXY_PAC")
+)
+
+const (
+	pacScriptTTL      = 30 * time.Minute // how long a fetched PAC file is used
+	pacRetryInterval  = time.Minute      // how soon to retry a failed fetch
+	pacDecisionTTL    = 5 * time.Minute  // how long a FindProxyForURL result is cached
+	pacMaxDecisions   = 1000             // cached results before the cache is flushed
+	pacMaxScriptSize  = 1 << 20
+	pacFetchTimeout   = 10 * time.Second
+	pacProxyOKTTL     = 5 * time.Minute // how long a reachable proxy isn't rechecked
+	pacProxyBadTTL    = time.Minute     // how long an unreachable proxy is skipped
+	pacProxyProbeTime = 3 * time.Second
+)
+
+// pacErrorf is a rate-limited logger for PAC errors, which would otherwise be
+// logged for every request while the PAC file is broken.
+var pacErrorf = logger.RateLimitedFn(log.Printf, 10*time.Minute, 2 /* burst*/, 10 /* maxCache */)
+
+// pacDecision is a cached result of the PAC file's FindProxyForURL.
+type pacDecision struct {
+	result  string     // as returned by FindProxyForURL
+	proxies []*url.URL // parsed result; nil entries mean DIRECT
+	expires time.Time
+}
+
+var pac struct {
+	sync.Mutex
+	url       string     // of script, or of the failed fetch
+	script    *pacScript // or nil if none was fetched yet
+	fetched   time.Time  // when script was fetched
+	failed    time.Time  // if non-zero, when fetching url last failed
+	decisions map[string]pacDecision
+	reachable map[string]pacProxyState // keyed by proxy host:port
+	lastLog   map[string]string        // last logged decision by PAC URL argument
+}
+
+type pacProxyState struct {
+	ok      bool
+	checked time.Time
+}
+
+// These are overridden in tests.
+var (
+	pacFetch      = fetchPAC
+	pacProbeProxy = probeProxy
+	pacSystem     = &pacSys{
+		resolve: pacResolve,
+		myIP:    pacMyIP,
+		now:     time.Now,
+	}
+)
+
+// invalidatePACCache makes the next lookup refetch the PAC file and
+// forget which proxies were reachable, as the network has changed. The
+// current PAC file is used until the new one is fetched.
+func invalidatePACCache() {
+	pac.Lock()
+	defer pac.Unlock()
+	pac.fetched = time.Time{}
+	pac.failed = time.Time{}
+	pac.decisions = nil
+	pac.reachable = nil
+}
+
+// pacProxyFromEnv returns the proxy to use for req per the PAC file at
+// TS_PROXY_PAC_URL. It returns ok false if there's no PAC file configured or
+// it can't be used, in which case the caller should fall back to the system
+// proxy settings. A nil proxy with ok true means to connect directly.
+func pacProxyFromEnv(req *http.Request) (proxy *url.URL, ok bool) {
+	pacURL := pacURLKnob()
+	if pacURL == "" || req.URL == nil {
+		return nil, false
+	}
+	script := pacScriptFor(pacURL)
+	if script == nil {
+		return nil, false
+	}
+
+	// Like browsers, pass only the scheme and host to FindProxyForURL, so the
+	// paths and queries of requests aren't exposed to the PAC file and the
+	// results can be cached per host.
+	u := &url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: "/"}
+	urlStr := u.String()
+	host := req.URL.Hostname()
+
+	now := time.Now()
+	pac.Lock()
+	d, cached := pac.decisions[urlStr]
+	pac.Unlock()
+	if !cached || now.After(d.expires) {
+		res, err := script.findProxyForURL(pacSystem, urlStr, host)
+		if err == nil {
+			d.proxies, err = parsePACResult(res)
+		}
+		if err != nil {
+			pacErrorf("tshttpproxy: pac: FindProxyForURL(%q, %q): %v", urlStr, host, err)
+			return nil, false
+		}
+		d.result = res
+		d.expires = now.Add(pacDecisionTTL)
+		pac.Lock()
+		if len(pac.decisions) >= pacMaxDecisions {
+			clear(pac.decisions)
+		}
+		mak.Set(&pac.decisions, urlStr, d)
+		pac.Unlock()
+	}
+
+	proxy = choosePACProxy(d.proxies)
+	logPACDecision(urlStr, host, d.result, proxy, cached)
+	return proxy, true
+}
+
+// pacScriptFor returns the PAC file at pacURL, fetching it if needed. If
+// a refetch fails, the previously fetched file is returned. It returns
+// nil if no PAC file is available.
+func pacScriptFor(pacURL string) *pacScript {
+	pac.Lock()
+	defer pac.Unlock()
+
+	now := time.Now()
+	if pac.url != pacURL {
+		pac.url = pacURL
+		pac.script = nil
+		pac.fetched = time.Time{}
+		pac.failed = time.Time{}
+		pac.decisions = nil
+	}
+	if pac.script != nil && now.Sub(pac.fetched) < pacScriptTTL {
+		return pac.script
+	}
+	if !pac.failed.IsZero() && now.Sub(pac.failed) < pacRetryInterval {
+		return pac.script
+	}
+
+	// Fetching while holding pac's lock makes concurrent lookups wait for
+	// the one fetch, rather than each fetching the file.
+	src, err := pacFetch(pacURL)
+	var script *pacScript
+	if err == nil {
+		script, err = parsePAC(src)
+	}
+	if err != nil {
+		pacErrorf("tshttpproxy: pac: loading %q: %v", pacURL, err)
+		pac.failed = now
+		if pac.script != nil {
+			pacErrorf("tshttpproxy: pac: using PAC file fetched at %v", pac.fetched.Format(time.RFC3339))
+		}
+		return pac.script
+	}
+	if pac.script == nil {
+		log.Printf("tshttpproxy: pac: using PAC file %q", pacURL)
+	}
+	pac.script = script
+	pac.fetched = now
+	pac.failed = time.Time{}
+	pac.decisions = nil
+	return script
+}
+
+// fetchPAC returns the contents of the PAC file at pacURL.
+func fetchPAC(pacURL string) (string, error) {
+	u, err := url.Parse(pacURL)
+	if err != nil {
+		return "", err
+	}
+	var r io.Reader
+	switch u.Scheme {
+	case "file":
+		f, err := os.Open(u.Path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	case "http", "https":
+		ctx, cancel := context.WithTimeout(context.Background(), pacFetchTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "GET", pacURL, nil)
+		if err != nil {
+			return "", err
+		}
+		// The PAC file itself must be fetched directly.
+		tr := &http.Transport{Proxy: nil}
+		defer tr.CloseIdleConnections()
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("unexpected HTTP status %v", res.Status)
+		}
+		r = res.Body
+	default:
+		return "", fmt.Errorf("unsupported PAC URL scheme %q", u.Scheme)
+	}
+	b, err := io.ReadAll(io.LimitReader(r, pacMaxScriptSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > pacMaxScriptSize {
+		return "", errors.New("PAC file too large")
+	}
+	return string(b), nil
+}
+
+// parsePACResult parses the result of FindProxyForURL: semicolon-separated
+// directives such as "PROXY host:port", "HTTPS host:port", "SOCKS5
+// host:port" or "DIRECT". It returns the proxies to try, in order, with a
+// nil entry for DIRECT. Unsupported directives are skipped.
+func parsePACResult(res string) ([]*url.URL, error) {
+	var proxies []*url.URL
+	for dir := range strings.SplitSeq(res, ";") {
+		kind, hostPort, _ := strings.Cut(strings.TrimSpace(dir), " ")
+		hostPort = strings.TrimSpace(hostPort)
+		var scheme string
+		switch strings.ToUpper(kind) {
+		case "":
+			continue
+		case "DIRECT":
+			proxies = append(proxies, nil)
+			continue
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		default:
+			continue // e.g. SOCKS4 or QUIC, which we can't use
+		}
+		if _, _, err := net.SplitHostPort(hostPort); err != nil {
+			return nil, fmt.Errorf("bad proxy %q in %q", hostPort, res)
+		}
+		proxies = append(proxies, &url.URL{Scheme: scheme, Host: hostPort})
+	}
+	if len(proxies) == 0 {
+		if strings.TrimSpace(res) != "" {
+			return nil, fmt.Errorf("no usable proxies in %q", res)
+		}
+		// An empty result means DIRECT.
+		proxies = append(proxies, nil)
+	}
+	return proxies, nil
+}
+
+// choosePACProxy returns the first of the proxies from a PAC result that's
+// reachable, or nil for DIRECT. If none are, it returns the first, so the
+// connection error is reported against it.
+func choosePACProxy(proxies []*url.URL) *url.URL {
+	if len(proxies) == 1 {
+		return proxies[0] // nothing to fail over to
+	}
+	for _, p := range proxies {
+		if p == nil || pacProxyReachable(p) {
+			return p
+		}
+	}
+	return proxies[0]
+}
+
+// pacProxyReachable reports whether proxy p accepted a recent TCP
+// connection, probing it if it wasn't checked recently.
+func pacProxyReachable(p *url.URL) bool {
+	now := time.Now()
+	pac.Lock()
+	st, ok := pac.reachable[p.Host]
+	pac.Unlock()
+	if ok {
+		ttl := pacProxyBadTTL
+		if st.ok {
+			ttl = pacProxyOKTTL
+		}
+		if now.Sub(st.checked) < ttl {
+			return st.ok
+		}
+	}
+
+	err := pacProbeProxy(p.Host)
+	if err != nil {
+		pacErrorf("tshttpproxy: pac: proxy %v unreachable, failing over: %v", p, err)
+	}
+	pac.Lock()
+	defer pac.Unlock()
+	mak.Set(&pac.reachable, p.Host, pacProxyState{ok: err == nil, checked: now})
+	return err == nil
+}
+
+func probeProxy(hostPort string) error {
+	c, err := net.DialTimeout("tcp", hostPort, pacProxyProbeTime)
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// logPACDecision logs the proxy chosen for urlStr if it changed, or always
+// if TS_DEBUG_PROXY_PAC is set.
+func logPACDecision(urlStr, host, res string, proxy *url.URL, cached bool) {
+	chosen := "DIRECT"
+	if proxy != nil {
+		chosen = proxy.String()
+	}
+	if debugPAC() {
+		log.Printf("tshttpproxy: pac: FindProxyForURL(%q, %q) = %q (cached=%v); using %s", urlStr, host, res, cached, chosen)
+		return
+	}
+	pac.Lock()
+	defer pac.Unlock()
+	if pac.lastLog[urlStr] == chosen {
+		return
+	}
+	mak.Set(&pac.lastLog, urlStr, chosen)
+	log.Printf("tshttpproxy: pac: using %s for %q (FindProxyForURL = %q)", chosen, urlStr, res)
+}
+
+// pacResolve implements the PAC dnsResolve function, returning host's first
+// IPv4 address.
+func pacResolve(host string) (netip.Addr, bool) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return ip, true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		return netip.Addr{}, false
+	}
+	return ips[0].Unmap(), true
+}
+
+// pacMyIP implements the PAC myIpAddress function, returning the IPv4
+// address of the interface with the default route.
+func pacMyIP() netip.Addr {
+	// Connecting a UDP socket sends no packets; it just picks the
+	// source address.
+	c, err := net.Dial("udp4", "192.0.2.1:80") // TEST-NET-1
+	if err != nil {
+		return netip.AddrFrom4([4]byte{127, 0, 0, 1})
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap()
+}
@@ -0,0 +1,347 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tshttpproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/tstest"
+	"tailscale.com/util/must"
+)
+
+const testPAC = `
+// Example corporate PAC file.
+var corpProxy = "PROXY proxy1.corp.example:8080; PROXY proxy2.corp.example:8080";
+
+function isCorp(host) {
+	return dnsDomainIs(host, ".corp.example") || localHostOrDomainIs(host, "intranet.corp.example");
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host) && host != "controlplane") {
+		return "DIRECT";
+	}
+	if (isCorp(host) || isInNet(dnsResolve(host), "10.0.0.0", "255.0.0.0")) {
+		return "DIRECT";
+	} else if (shExpMatch(host, "*.tailscale.com") && url.substring(0, 6) === "https:") {
+		return corpProxy + "; DIRECT";
+	}
+	/* Weekend traffic goes through the backup proxy. */
+	if (weekdayRange("SAT", "SUN")) return "PROXY backup.corp.example:3128";
+	return dnsDomainLevels(host) > 1 ? "SOCKS5 socks.corp.example:1080" : corpProxy;
+}
+`
+
+func testPACSys() *pacSys {
+	return &pacSys{
+		resolve: func(host string) (netip.Addr, bool) {
+			if ip, err := netip.ParseAddr(host); err == nil {
+				return ip, true
+			}
+			if host == "build.example.com" {
+				return netip.MustParseAddr("10.1.2.3"), true
+			}
+			return netip.Addr{}, false
+		},
+		myIP: func() netip.Addr { return netip.MustParseAddr("192.168.1.2") },
+		now: func() time.Time {
+			return time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC) // a Wednesday
+		},
+	}
+}
+
+func TestPACScript(t *testing.T) {
+	s, err := parsePAC(testPAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url, host string
+		want      string
+	}{
+		{"https://printer/", "printer", "DIRECT"},
+		{"https://controlplane/", "controlplane", "PROXY proxy1.corp.example:8080; PROXY proxy2.corp.example:8080"},
+		{"https://wiki.corp.example/", "wiki.corp.example", "DIRECT"},
+		{"https://intranet/", "intranet", "DIRECT"},
+		{"https://build.example.com/", "build.example.com", "DIRECT"},
+		{"https://10.9.9.9/", "10.9.9.9", "DIRECT"},
+		{"https://controlplane.tailscale.com/", "controlplane.tailscale.com", "PROXY proxy1.corp.example:8080; PROXY proxy2.corp.example:8080; DIRECT"},
+		{"https://DERP1.Tailscale.com/", "DERP1.Tailscale.com", "PROXY proxy1.corp.example:8080; PROXY proxy2.corp.example:8080; DIRECT"},
+		{"http://derp1.tailscale.com/", "derp1.tailscale.com", "SOCKS5 socks.corp.example:1080"},
+		{"https://example.com/", "example.com", "PROXY proxy1.corp.example:8080; PROXY proxy2.corp.example:8080"},
+	}
+	for _, tt := range tests {
+		got, err := s.findProxyForURL(testPACSys(), tt.url, tt.host)
+		if err != nil {
+			t.Errorf("FindProxyForURL(%q, %q): %v", tt.url, tt.host, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FindProxyForURL(%q, %q) = %q; want %q", tt.url, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestPACScriptErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"no_func", `var x = 1;`},
+		{"syntax", `function FindProxyForURL(url, host) { return "DIRECT" + ; }`},
+		{"unterminated_string", `function FindProxyForURL(url, host) { return "DIRECT; }`},
+		{"loop", `function FindProxyForURL(url, host) { while (true) {} }`},
+		{"nested_func", `function FindProxyForURL(url, host) { function f() {} }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parsePAC(tt.src); err == nil {
+				t.Errorf("parsePAC succeeded; want error")
+			}
+		})
+	}
+
+	evalTests := []struct {
+		name string
+		src  string
+	}{
+		{"undefined_var", `function FindProxyForURL(url, host) { return nope; }`},
+		{"unknown_func", `function FindProxyForURL(url, host) { return nope(); }`},
+		{"not_string", `function FindProxyForURL(url, host) { return 42; }`},
+		{"recursion", `function f(x) { return f(x); } function FindProxyForURL(url, host) { return f(1); }`},
+		{"date_range", `function FindProxyForURL(url, host) { if (dateRange("JAN", "MAR")) return "DIRECT"; }`},
+	}
+	for _, tt := range evalTests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parsePAC(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := s.findProxyForURL(testPACSys(), "https://example.com/", "example.com"); err == nil {
+				t.Errorf("FindProxyForURL = %q; want error", got)
+			}
+		})
+	}
+}
+
+func TestPACNesting(t *testing.T) {
+	// script returns a PAC file whose FindProxyForURL body is body with
+	// "%s" replaced by n levels of open, inner, then n levels of close.
+	script := func(body, open, inner, close string, n int) string {
+		nested := strings.Repeat(open, n) + inner + strings.Repeat(close, n)
+		return `function FindProxyForURL(url, host) { ` + strings.ReplaceAll(body, "%s", nested) + ` }`
+	}
+	tests := []struct {
+		name                     string
+		body, open, inner, close string
+	}{
+		{"parens", `return "" + %s;`, "(", "1", ")"},
+		{"not", `return "" + %s;`, "!", "1", ""},
+		{"negate", `return "" + %s;`, "-", "1", ""},
+		{"calls", `return "" + %s;`, "String(", "1", ")"},
+		{"assign", `var x = %s; return "DIRECT";`, "x = ", "1", ""},
+		{"blocks", `%s return "DIRECT";`, "{", "", "}"},
+		{"if", `%s return "DIRECT";`, "if (true) ", ";", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A script this deeply nested used to overflow the stack,
+			// killing the process.
+			deep := pacMaxScriptSize / (len(tt.open) + len(tt.close))
+			if _, err := parsePAC(script(tt.body, tt.open, tt.inner, tt.close, deep)); err == nil {
+				t.Errorf("parsePAC with %d levels succeeded; want error", deep)
+			}
+			if _, err := parsePAC(script(tt.body, tt.open, tt.inner, tt.close, 10)); err != nil {
+				t.Errorf("parsePAC with 10 levels: %v", err)
+			}
+		})
+	}
+}
+
+func TestPACExpressions(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`"a" + 1 + 2`, "a12"},
+		{`1 + 2 + "a"`, "3a"},
+		{`"10" == 10`, "true"},
+		{`"10" === 10`, "false"},
+		{`null == undefined`, "true"},
+		{`"abc".length * 2`, "6"},
+		{`"https://x/".indexOf("://")`, "5"},
+		{`"abcdef".substr(2, 3)`, "cde"},
+		{`"abcdef".substring(4, 1)`, "bcd"},
+		{`"" || "fallback"`, "fallback"},
+		{`!"" && "yes"`, "yes"},
+		{`"b" > "a" ? "gt" : "le"`, "gt"},
+		{`convert_addr("10.0.0.1")`, "167772161"},
+		{`myIpAddress()`, "192.168.1.2"},
+		{`isResolvable("nope.example")`, "false"},
+		{`timeRange(9, 17)`, "true"},
+		{`timeRange(0, 1, "GMT")`, "false"},
+		{`weekdayRange("MON", "FRI")`, "true"},
+		{`weekdayRange("FRI", "TUE")`, "false"},
+	}
+	for _, tt := range tests {
+		s, err := parsePAC(fmt.Sprintf(`function FindProxyForURL(url, host) { return "" + (%s); }`, tt.expr))
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		got, err := s.findProxyForURL(testPACSys(), "https://example.com/", "example.com")
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q; want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestShExpMatch(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"http://home.netscape.com/people/ari/index.html", "*/ari/*", true},
+		{"http://home.netscape.com/people/montulli/index.html", "*/ari/*", false},
+		{"derp1.tailscale.com", "derp?.tailscale.com", true},
+		{"derp12.tailscale.com", "derp?.tailscale.com", false},
+		{"abc", "*", true},
+		{"", "*", true},
+		{"", "?", false},
+		{"aXbXc", "a*b*c", true},
+		{"aXbXd", "a*b*c", false},
+		{"abc", "abc", true},
+	}
+	for _, tt := range tests {
+		if got := shExpMatch(tt.s, tt.pattern); got != tt.want {
+			t.Errorf("shExpMatch(%q, %q) = %v; want %v", tt.s, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestParsePACResult(t *testing.T) {
+	tests := []struct {
+		res     string
+		want    []string // "" for DIRECT
+		wantErr bool
+	}{
+		{res: "DIRECT", want: []string{""}},
+		{res: "", want: []string{""}},
+		{res: "PROXY a:8080; HTTPS b:443;SOCKS c:1080 ; DIRECT", want: []string{"http://a:8080", "https://b:443", "socks5://c:1080", ""}},
+		{res: "SOCKS4 a:1080; PROXY b:3128", want: []string{"http://b:3128"}},
+		{res: "SOCKS4 a:1080", wantErr: true},
+		{res: "PROXY nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePACResult(tt.res)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePACResult(%q) error = %v; want error %v", tt.res, err, tt.wantErr)
+			continue
+		}
+		var gotStr []string
+		for _, u := range got {
+			if u == nil {
+				gotStr = append(gotStr, "")
+			} else {
+				gotStr = append(gotStr, u.String())
+			}
+		}
+		if fmt.Sprint(gotStr) != fmt.Sprint(tt.want) {
+			t.Errorf("parsePACResult(%q) = %q; want %q", tt.res, gotStr, tt.want)
+		}
+	}
+}
+
+func TestPACProxyFromEnvironment(t *testing.T) {
+	envknob.Setenv("TS_PROXY_PAC_URL", "http://wpad.corp.example/proxy.pac")
+	t.Cleanup(func() { envknob.Setenv("TS_PROXY_PAC_URL", "") })
+	t.Cleanup(invalidatePACCache)
+	t.Cleanup(func() {
+		// ProxyFromEnvironment caches the environment's proxy settings.
+		config = nil
+		proxyFunc = nil
+	})
+
+	fetches := 0
+	pacSrc := testPAC
+	tstest.Replace(t, &pacFetch, func(string) (string, error) {
+		fetches++
+		if pacSrc == "" {
+			return "", errors.New("fetch failed")
+		}
+		return pacSrc, nil
+	})
+	down := map[string]bool{}
+	tstest.Replace(t, &pacProbeProxy, func(hostPort string) error {
+		if down[hostPort] {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	tstest.Replace(t, &pacSystem, testPACSys())
+
+	proxyFor := func(rawURL string) string {
+		t.Helper()
+		u, err := ProxyFromEnvironment(&http.Request{URL: must.Get(url.Parse(rawURL))})
+		if err != nil {
+			t.Fatalf("ProxyFromEnvironment(%q): %v", rawURL, err)
+		}
+		if u == nil {
+			return "DIRECT"
+		}
+		return u.String()
+	}
+
+	if got := proxyFor("https://controlplane.tailscale.com/key?v=1"); got != "http://proxy1.corp.example:8080" {
+		t.Errorf("control proxy = %q; want proxy1", got)
+	}
+	if got := proxyFor("https://wiki.corp.example/"); got != "DIRECT" {
+		t.Errorf("corp proxy = %q; want DIRECT", got)
+	}
+	if fetches != 1 {
+		t.Errorf("fetched PAC file %d times; want 1", fetches)
+	}
+
+	// Fail over to the second proxy, then to DIRECT, once the proxies are
+	// found to be down.
+	down["proxy1.corp.example:8080"] = true
+	InvalidateCache()
+	if got := proxyFor("https://controlplane.tailscale.com/"); got != "http://proxy2.corp.example:8080" {
+		t.Errorf("with proxy1 down, control proxy = %q; want proxy2", got)
+	}
+	down["proxy2.corp.example:8080"] = true
+	InvalidateCache()
+	if got := proxyFor("https://controlplane.tailscale.com/"); got != "DIRECT" {
+		t.Errorf("with both proxies down, control proxy = %q; want DIRECT", got)
+	}
+
+	// If the PAC file can't be refetched, the last one is still used.
+	pacSrc = ""
+	InvalidateCache()
+	if got := proxyFor("https://wiki.corp.example/"); got != "DIRECT" {
+		t.Errorf("after failed refetch, corp proxy = %q; want DIRECT", got)
+	}
+	if fetches != 4 {
+		t.Errorf("fetched PAC file %d times; want 4", fetches)
+	}
+
+	// Without any PAC file, the caller falls back to the system settings.
+	envknob.Setenv("TS_PROXY_PAC_URL", "http://wpad.corp.example/other.pac")
+	if u, ok := pacProxyFromEnv(&http.Request{URL: must.Get(url.Parse("https://example.com/"))}); ok {
+		t.Errorf("with no PAC file, got proxy %v; want fallback", u)
+	}
+}
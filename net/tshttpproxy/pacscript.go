@@ -0,0 +1,1205 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tshttpproxy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pacScript is a parsed proxy auto-config (PAC) file.
+//
+// Rather than embedding a JavaScript engine, it supports the subset of
+// JavaScript that PAC files use in practice: function declarations, var
+// declarations and assignments, if/else, return, and expressions over strings,
+// numbers and booleans using the comparison, logical, conditional and
+// arithmetic operators, the standard PAC helper functions (isInNet,
+// shExpMatch, dnsDomainIs, etc.) and common string methods.
+type pacScript struct {
+	funcs   map[string]*pacFunc
+	globals []pacStmt // top-level statements, run before each call
+}
+
+// pacSys is what the PAC helper functions need from the system.
+type pacSys struct {
+	resolve func(host string) (netip.Addr, bool) // dnsResolve
+	myIP    func() netip.Addr                    // myIpAddress
+	now     func() time.Time                     // weekdayRange, timeRange
+}
+
+const (
+	pacMaxSteps = 1_000_000 // evaluation steps per FindProxyForURL call
+	pacMaxDepth = 100       // nested function calls
+	pacMaxNest  = 100       // nested statements and expressions when parsing
+)
+
+// parsePAC parses the PAC file src.
+func parsePAC(src string) (*pacScript, error) {
+	toks, err := lexPAC(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &pacParser{toks: toks}
+	s := &pacScript{funcs: map[string]*pacFunc{}}
+	for p.peek().kind != pacEOF {
+		if p.peek().isIdent("function") {
+			f, err := p.funcDecl()
+			if err != nil {
+				return nil, err
+			}
+			s.funcs[f.name] = f
+			continue
+		}
+		st, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		s.globals = append(s.globals, st)
+	}
+	if s.funcs["FindProxyForURL"] == nil {
+		return nil, errors.New("pac: no FindProxyForURL function")
+	}
+	return s, nil
+}
+
+// findProxyForURL calls the script's FindProxyForURL function.
+func (s *pacScript) findProxyForURL(sys *pacSys, urlStr, host string) (string, error) {
+	in := &pacInterp{script: s, sys: sys}
+	globals := &pacScope{vars: map[string]any{}}
+	for _, st := range s.globals {
+		if _, _, err := in.exec(globals, st); err != nil {
+			return "", err
+		}
+	}
+	v, err := in.call(globals, s.funcs["FindProxyForURL"], []any{urlStr, host})
+	if err != nil {
+		return "", err
+	}
+	ret, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("pac: FindProxyForURL returned %s, not a string", pacToString(v))
+	}
+	return ret, nil
+}
+
+// Lexer.
+
+type pacTokKind int
+
+const (
+	pacEOF pacTokKind = iota
+	pacIdentTok
+	pacStringTok
+	pacNumberTok
+	pacPunctTok
+)
+
+type pacToken struct {
+	kind pacTokKind
+	s    string // identifier, punctuation or unquoted string
+	num  float64
+	line int
+}
+
+func (t pacToken) isIdent(s string) bool { return t.kind == pacIdentTok && t.s == s }
+func (t pacToken) isPunct(s string) bool { return t.kind == pacPunctTok && t.s == s }
+
+func (t pacToken) String() string {
+	switch t.kind {
+	case pacEOF:
+		return "end of file"
+	case pacStringTok:
+		return strconv.Quote(t.s)
+	}
+	return fmt.Sprintf("%q", t.s)
+}
+
+// pacPuncts are the punctuation tokens, longest first.
+var pacPuncts = []string{
+	"===", "!==",
+	"==", "!=", "<=", ">=", "&&", "||",
+	"(", ")", "{", "}", ",", ";", ".", "!", "<", ">", "+", "-", "*", "/", "%", "=", "?", ":",
+}
+
+func lexPAC(src string) ([]pacToken, error) {
+	var toks []pacToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("pac: line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\n' {
+					return nil, fmt.Errorf("pac: line %d: newline in string", line)
+				}
+				if src[j] != '\\' {
+					sb.WriteByte(src[j])
+					continue
+				}
+				j++
+				if j == len(src) {
+					break
+				}
+				switch src[j] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				case 'r':
+					sb.WriteByte('\r')
+				default:
+					sb.WriteByte(src[j])
+				}
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("pac: line %d: unterminated string", line)
+			}
+			toks = append(toks, pacToken{kind: pacStringTok, s: sb.String(), line: line})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("pac: line %d: bad number %q", line, src[i:j])
+			}
+			toks = append(toks, pacToken{kind: pacNumberTok, num: n, line: line})
+			i = j
+		case isPACIdentByte(c):
+			j := i
+			for j < len(src) && (isPACIdentByte(src[j]) || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			toks = append(toks, pacToken{kind: pacIdentTok, s: src[i:j], line: line})
+			i = j
+		default:
+			found := false
+			for _, p := range pacPuncts {
+				if strings.HasPrefix(src[i:], p) {
+					toks = append(toks, pacToken{kind: pacPunctTok, s: p, line: line})
+					i += len(p)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("pac: line %d: unexpected character %q", line, c)
+			}
+		}
+	}
+	return append(toks, pacToken{kind: pacEOF, line: line}), nil
+}
+
+func isPACIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$'
+}
+
+// Parser.
+
+type pacFunc struct {
+	name   string
+	params []string
+	body   []pacStmt
+}
+
+type pacStmt interface{}
+
+type (
+	pacVarStmt struct {
+		names []string
+		vals  []pacExpr // nil entries for declarations without a value
+	}
+	pacIfStmt struct {
+		cond pacExpr
+		then pacStmt
+		els  pacStmt // or nil
+	}
+	pacReturnStmt struct {
+		x pacExpr // or nil
+	}
+	pacBlockStmt struct {
+		list []pacStmt
+	}
+	pacExprStmt struct {
+		x pacExpr
+	}
+)
+
+type pacExpr interface{}
+
+type (
+	pacLit struct {
+		v any
+	}
+	pacIdent struct {
+		name string
+	}
+	pacCall struct {
+		fn   pacExpr // pacIdent or pacMember
+		args []pacExpr
+	}
+	pacMember struct {
+		x    pacExpr
+		name string
+	}
+	pacUnary struct {
+		op string
+		x  pacExpr
+	}
+	pacBinary struct {
+		op   string
+		x, y pacExpr
+	}
+	pacCond struct {
+		cond, x, y pacExpr
+	}
+	pacAssign struct {
+		name string
+		x    pacExpr
+	}
+)
+
+type pacParser struct {
+	toks []pacToken
+	pos  int
+	nest int // current depth of nested statements and expressions
+}
+
+func (p *pacParser) peek() pacToken { return p.toks[p.pos] }
+
+func (p *pacParser) next() pacToken {
+	t := p.toks[p.pos]
+	if t.kind != pacEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it's the punctuation s.
+func (p *pacParser) accept(s string) bool {
+	if p.peek().isPunct(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *pacParser) expect(s string) error {
+	if t := p.next(); !t.isPunct(s) {
+		return p.errorf(t, "got %v, want %q", t, s)
+	}
+	return nil
+}
+
+func (p *pacParser) ident() (string, error) {
+	t := p.next()
+	if t.kind != pacIdentTok {
+		return "", p.errorf(t, "got %v, want identifier", t)
+	}
+	return t.s, nil
+}
+
+func (p *pacParser) errorf(t pacToken, format string, args ...any) error {
+	return fmt.Errorf("pac: line %d: %s", t.line, fmt.Sprintf(format, args...))
+}
+
+// enter records that the parser is descending into a nested statement or
+// expression, failing if it's nested more than pacMaxNest deep, which
+// would otherwise let a malicious script overflow the stack. Callers must
+// call leave when done if it succeeds.
+func (p *pacParser) enter() error {
+	if p.nest >= pacMaxNest {
+		return p.errorf(p.peek(), "nested too deeply")
+	}
+	p.nest++
+	return nil
+}
+
+func (p *pacParser) leave() { p.nest-- }
+
+func (p *pacParser) funcDecl() (*pacFunc, error) {
+	p.next() // "function"
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	f := &pacFunc{name: name}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.accept(")") {
+		if len(f.params) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		param, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		f.params = append(f.params, param)
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	f.body = body.list
+	return f, nil
+}
+
+func (p *pacParser) block() (*pacBlockStmt, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	b := &pacBlockStmt{}
+	for !p.accept("}") {
+		if p.peek().kind == pacEOF {
+			return nil, p.errorf(p.peek(), "missing }")
+		}
+		st, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		b.list = append(b.list, st)
+	}
+	return b, nil
+}
+
+func (p *pacParser) stmt() (pacStmt, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	t := p.peek()
+	switch {
+	case t.isPunct("{"):
+		return p.block()
+	case t.isPunct(";"):
+		p.next()
+		return &pacBlockStmt{}, nil
+	case t.isIdent("var"), t.isIdent("let"), t.isIdent("const"):
+		p.next()
+		st := &pacVarStmt{}
+		for {
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			var val pacExpr
+			if p.accept("=") {
+				if val, err = p.expr(); err != nil {
+					return nil, err
+				}
+			}
+			st.names = append(st.names, name)
+			st.vals = append(st.vals, val)
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.accept(";")
+		return st, nil
+	case t.isIdent("if"):
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		st := &pacIfStmt{cond: cond}
+		if st.then, err = p.stmt(); err != nil {
+			return nil, err
+		}
+		if p.peek().isIdent("else") {
+			p.next()
+			if st.els, err = p.stmt(); err != nil {
+				return nil, err
+			}
+		}
+		return st, nil
+	case t.isIdent("return"):
+		p.next()
+		st := &pacReturnStmt{}
+		if !p.accept(";") && !p.peek().isPunct("}") {
+			var err error
+			if st.x, err = p.expr(); err != nil {
+				return nil, err
+			}
+			p.accept(";")
+		}
+		return st, nil
+	case t.isIdent("function"):
+		return nil, p.errorf(t, "nested functions are not supported")
+	case t.isIdent("for"), t.isIdent("while"), t.isIdent("do"), t.isIdent("switch"):
+		return nil, p.errorf(t, "%q statements are not supported", t.s)
+	}
+	x, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	p.accept(";")
+	return &pacExprStmt{x}, nil
+}
+
+func (p *pacParser) expr() (pacExpr, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	if t := p.peek(); t.kind == pacIdentTok && p.toks[p.pos+1].isPunct("=") {
+		p.pos += 2
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &pacAssign{name: t.s, x: x}, nil
+	}
+	return p.condExpr()
+}
+
+func (p *pacParser) condExpr() (pacExpr, error) {
+	cond, err := p.binaryExpr(0)
+	if err != nil || !p.accept("?") {
+		return cond, err
+	}
+	x, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	y, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return &pacCond{cond, x, y}, nil
+}
+
+// pacBinaryOps are the binary operators by increasing precedence.
+var pacBinaryOps = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "===", "!=="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *pacParser) binaryExpr(prec int) (pacExpr, error) {
+	if prec == len(pacBinaryOps) {
+		return p.unaryExpr()
+	}
+	x, err := p.binaryExpr(prec + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != pacPunctTok || !slices.Contains(pacBinaryOps[prec], t.s) {
+			return x, nil
+		}
+		p.next()
+		y, err := p.binaryExpr(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &pacBinary{op: t.s, x: x, y: y}
+	}
+}
+
+func (p *pacParser) unaryExpr() (pacExpr, error) {
+	if t := p.peek(); t.isPunct("!") || t.isPunct("-") {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		p.next()
+		x, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &pacUnary{op: t.s, x: x}, nil
+	}
+	return p.postfixExpr()
+}
+
+func (p *pacParser) postfixExpr() (pacExpr, error) {
+	x, err := p.primaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			x = &pacMember{x: x, name: name}
+		case p.accept("("):
+			c := &pacCall{fn: x}
+			for !p.accept(")") {
+				if len(c.args) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				arg, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				c.args = append(c.args, arg)
+			}
+			x = c
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *pacParser) primaryExpr() (pacExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case pacStringTok:
+		return &pacLit{t.s}, nil
+	case pacNumberTok:
+		return &pacLit{t.num}, nil
+	case pacIdentTok:
+		switch t.s {
+		case "true":
+			return &pacLit{true}, nil
+		case "false":
+			return &pacLit{false}, nil
+		case "null", "undefined":
+			return &pacLit{nil}, nil
+		}
+		return &pacIdent{t.s}, nil
+	case pacPunctTok:
+		if t.s == "(" {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+	return nil, p.errorf(t, "unexpected %v", t)
+}
+
+// Interpreter.
+
+// pacScope is a set of variables: the globals, or the parameters and
+// variables of a function call.
+type pacScope struct {
+	vars   map[string]any
+	parent *pacScope
+}
+
+func (s *pacScope) lookup(name string) (*pacScope, bool) {
+	for ; s != nil; s = s.parent {
+		if _, ok := s.vars[name]; ok {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+type pacInterp struct {
+	script *pacScript
+	sys    *pacSys
+	steps  int
+	depth  int
+}
+
+func (in *pacInterp) step() error {
+	in.steps++
+	if in.steps > pacMaxSteps {
+		return errors.New("pac: script took too long")
+	}
+	return nil
+}
+
+func (in *pacInterp) call(globals *pacScope, f *pacFunc, args []any) (any, error) {
+	if in.depth >= pacMaxDepth {
+		return nil, errors.New("pac: too much recursion")
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+
+	sc := &pacScope{vars: map[string]any{}, parent: globals}
+	for i, param := range f.params {
+		var v any
+		if i < len(args) {
+			v = args[i]
+		}
+		sc.vars[param] = v
+	}
+	for _, st := range f.body {
+		v, returned, err := in.exec(sc, st)
+		if err != nil || returned {
+			return v, err
+		}
+	}
+	return nil, nil
+}
+
+// exec runs st, reporting whether it returned and with what value.
+func (in *pacInterp) exec(sc *pacScope, st pacStmt) (_ any, returned bool, _ error) {
+	if err := in.step(); err != nil {
+		return nil, false, err
+	}
+	switch st := st.(type) {
+	case *pacVarStmt:
+		for i, name := range st.names {
+			var v any
+			if st.vals[i] != nil {
+				var err error
+				if v, err = in.eval(sc, st.vals[i]); err != nil {
+					return nil, false, err
+				}
+			} else if _, ok := sc.vars[name]; ok {
+				continue // redeclaration without a value keeps it
+			}
+			sc.vars[name] = v
+		}
+	case *pacIfStmt:
+		cond, err := in.eval(sc, st.cond)
+		if err != nil {
+			return nil, false, err
+		}
+		if pacTruthy(cond) {
+			return in.exec(sc, st.then)
+		}
+		if st.els != nil {
+			return in.exec(sc, st.els)
+		}
+	case *pacReturnStmt:
+		if st.x == nil {
+			return nil, true, nil
+		}
+		v, err := in.eval(sc, st.x)
+		return v, err == nil, err
+	case *pacBlockStmt:
+		for _, st := range st.list {
+			if v, returned, err := in.exec(sc, st); err != nil || returned {
+				return v, returned, err
+			}
+		}
+	case *pacExprStmt:
+		_, err := in.eval(sc, st.x)
+		return nil, false, err
+	default:
+		return nil, false, fmt.Errorf("pac: unknown statement %T", st)
+	}
+	return nil, false, nil
+}
+
+func (in *pacInterp) eval(sc *pacScope, x pacExpr) (any, error) {
+	if err := in.step(); err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case *pacLit:
+		return x.v, nil
+	case *pacIdent:
+		if s, ok := sc.lookup(x.name); ok {
+			return s.vars[x.name], nil
+		}
+		return nil, fmt.Errorf("pac: %s is not defined", x.name)
+	case *pacAssign:
+		v, err := in.eval(sc, x.x)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := sc.lookup(x.name)
+		if !ok {
+			// Assigning to an undeclared variable creates a global.
+			for s = sc; s.parent != nil; s = s.parent {
+			}
+		}
+		s.vars[x.name] = v
+		return v, nil
+	case *pacUnary:
+		v, err := in.eval(sc, x.x)
+		if err != nil {
+			return nil, err
+		}
+		if x.op == "!" {
+			return !pacTruthy(v), nil
+		}
+		return -pacToNumber(v), nil
+	case *pacCond:
+		cond, err := in.eval(sc, x.cond)
+		if err != nil {
+			return nil, err
+		}
+		if pacTruthy(cond) {
+			return in.eval(sc, x.x)
+		}
+		return in.eval(sc, x.y)
+	case *pacBinary:
+		return in.evalBinary(sc, x)
+	case *pacMember:
+		v, err := in.eval(sc, x.x)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := v.(string); ok && x.name == "length" {
+			return float64(len(s)), nil
+		}
+		return nil, fmt.Errorf("pac: unsupported property %s of %s", x.name, pacToString(v))
+	case *pacCall:
+		return in.evalCall(sc, x)
+	}
+	return nil, fmt.Errorf("pac: unknown expression %T", x)
+}
+
+func (in *pacInterp) evalBinary(sc *pacScope, x *pacBinary) (any, error) {
+	a, err := in.eval(sc, x.x)
+	if err != nil {
+		return nil, err
+	}
+	// Logical operators short-circuit and yield one of their operands.
+	switch x.op {
+	case "||":
+		if pacTruthy(a) {
+			return a, nil
+		}
+		return in.eval(sc, x.y)
+	case "&&":
+		if !pacTruthy(a) {
+			return a, nil
+		}
+		return in.eval(sc, x.y)
+	}
+	b, err := in.eval(sc, x.y)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "==":
+		return pacLooseEqual(a, b), nil
+	case "!=":
+		return !pacLooseEqual(a, b), nil
+	case "===":
+		return a == b, nil
+	case "!==":
+		return a != b, nil
+	case "+":
+		as, aok := a.(string)
+		bs, bok := b.(string)
+		if aok || bok {
+			if !aok {
+				as = pacToString(a)
+			}
+			if !bok {
+				bs = pacToString(b)
+			}
+			return as + bs, nil
+		}
+		return pacToNumber(a) + pacToNumber(b), nil
+	case "-":
+		return pacToNumber(a) - pacToNumber(b), nil
+	case "*":
+		return pacToNumber(a) * pacToNumber(b), nil
+	case "/":
+		return pacToNumber(a) / pacToNumber(b), nil
+	case "%":
+		return math.Mod(pacToNumber(a), pacToNumber(b)), nil
+	}
+	// Relational operators compare strings lexically and anything
+	// else numerically.
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	var c int
+	if aok && bok {
+		c = strings.Compare(as, bs)
+	} else {
+		an, bn := pacToNumber(a), pacToNumber(b)
+		if math.IsNaN(an) || math.IsNaN(bn) {
+			return false, nil
+		}
+		switch {
+		case an < bn:
+			c = -1
+		case an > bn:
+			c = 1
+		}
+	}
+	switch x.op {
+	case "<":
+		return c < 0, nil
+	case ">":
+		return c > 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return nil, fmt.Errorf("pac: unknown operator %s", x.op)
+}
+
+func (in *pacInterp) evalCall(sc *pacScope, x *pacCall) (any, error) {
+	args := make([]any, len(x.args))
+	for i, a := range x.args {
+		v, err := in.eval(sc, a)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	switch fn := x.fn.(type) {
+	case *pacIdent:
+		if f, ok := in.script.funcs[fn.name]; ok {
+			globals := sc
+			for globals.parent != nil {
+				globals = globals.parent
+			}
+			return in.call(globals, f, args)
+		}
+		if f, ok := pacBuiltins[fn.name]; ok {
+			return f(in.sys, args)
+		}
+		return nil, fmt.Errorf("pac: unknown function %s", fn.name)
+	case *pacMember:
+		recv, err := in.eval(sc, fn.x)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := recv.(string)
+		if !ok {
+			return nil, fmt.Errorf("pac: unsupported method %s of %s", fn.name, pacToString(recv))
+		}
+		return pacStringMethod(s, fn.name, args)
+	}
+	return nil, errors.New("pac: call of non-function")
+}
+
+func pacStringMethod(s, name string, args []any) (any, error) {
+	arg := func(i int) any {
+		if i < len(args) {
+			return args[i]
+		}
+		return nil
+	}
+	// index clamps the i'th argument to an index in s, defaulting to def.
+	index := func(i, def int) int {
+		if i >= len(args) || args[i] == nil {
+			return def
+		}
+		n := pacToNumber(args[i])
+		switch {
+		case math.IsNaN(n) || n < 0:
+			return 0
+		case n > float64(len(s)):
+			return len(s)
+		}
+		return int(n)
+	}
+	switch name {
+	case "toLowerCase":
+		return strings.ToLower(s), nil
+	case "toUpperCase":
+		return strings.ToUpper(s), nil
+	case "trim":
+		return strings.TrimSpace(s), nil
+	case "indexOf":
+		return float64(strings.Index(s, pacToString(arg(0)))), nil
+	case "lastIndexOf":
+		return float64(strings.LastIndex(s, pacToString(arg(0)))), nil
+	case "startsWith":
+		return strings.HasPrefix(s, pacToString(arg(0))), nil
+	case "endsWith":
+		return strings.HasSuffix(s, pacToString(arg(0))), nil
+	case "includes":
+		return strings.Contains(s, pacToString(arg(0))), nil
+	case "substring":
+		start, end := index(0, 0), index(1, len(s))
+		if start > end {
+			start, end = end, start
+		}
+		return s[start:end], nil
+	case "substr":
+		start := index(0, 0)
+		n := len(s) - start
+		if len(args) > 1 {
+			n = int(max(0, min(pacToNumber(args[1]), float64(n))))
+		}
+		return s[start : start+n], nil
+	case "charAt":
+		i := index(0, 0)
+		if i >= len(s) {
+			return "", nil
+		}
+		return s[i : i+1], nil
+	}
+	return nil, fmt.Errorf("pac: unsupported string method %s", name)
+}
+
+func pacTruthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	}
+	return false
+}
+
+func pacToNumber(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return 0
+		}
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return math.NaN()
+}
+
+func pacToString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return "undefined"
+}
+
+// pacLooseEqual implements JavaScript's == for the values a PAC script
+// can have.
+func pacLooseEqual(a, b any) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return as == bs
+	}
+	return pacToNumber(a) == pacToNumber(b)
+}
+
+// Builtins.
+
+// pacBuiltins are the functions that PAC files may call, per
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Proxy_servers_and_tunneling/Proxy_Auto-Configuration_PAC_file.
+var pacBuiltins map[string]func(sys *pacSys, args []any) (any, error)
+
+func init() {
+	pacBuiltins = map[string]func(*pacSys, []any) (any, error){
+		"isPlainHostName": func(_ *pacSys, args []any) (any, error) {
+			return !strings.Contains(pacArg(args, 0), "."), nil
+		},
+		"dnsDomainIs": func(_ *pacSys, args []any) (any, error) {
+			return strings.HasSuffix(strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))), nil
+		},
+		"localHostOrDomainIs": func(_ *pacSys, args []any) (any, error) {
+			host, hostdom := strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))
+			if host == hostdom {
+				return true, nil
+			}
+			return !strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+"."), nil
+		},
+		"isResolvable": func(sys *pacSys, args []any) (any, error) {
+			_, ok := sys.resolve(pacArg(args, 0))
+			return ok, nil
+		},
+		"dnsResolve": func(sys *pacSys, args []any) (any, error) {
+			if ip, ok := sys.resolve(pacArg(args, 0)); ok {
+				return ip.String(), nil
+			}
+			return nil, nil
+		},
+		"isInNet": func(sys *pacSys, args []any) (any, error) {
+			ip, ok := sys.resolve(pacArg(args, 0))
+			if !ok || !ip.Is4() {
+				return false, nil
+			}
+			pattern, err1 := netip.ParseAddr(pacArg(args, 1))
+			mask, err2 := netip.ParseAddr(pacArg(args, 2))
+			if err1 != nil || err2 != nil || !pattern.Is4() || !mask.Is4() {
+				return false, nil
+			}
+			ipv, pv, mv := ip.As4(), pattern.As4(), mask.As4()
+			for i := range ipv {
+				if ipv[i]&mv[i] != pv[i]&mv[i] {
+					return false, nil
+				}
+			}
+			return true, nil
+		},
+		"myIpAddress": func(sys *pacSys, _ []any) (any, error) {
+			return sys.myIP().String(), nil
+		},
+		"dnsDomainLevels": func(_ *pacSys, args []any) (any, error) {
+			return float64(strings.Count(pacArg(args, 0), ".")), nil
+		},
+		"convert_addr": func(_ *pacSys, args []any) (any, error) {
+			ip, err := netip.ParseAddr(pacArg(args, 0))
+			if err != nil || !ip.Is4() {
+				return 0.0, nil
+			}
+			b := ip.As4()
+			return float64(uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])), nil
+		},
+		"shExpMatch": func(_ *pacSys, args []any) (any, error) {
+			return shExpMatch(pacArg(args, 0), pacArg(args, 1)), nil
+		},
+		"weekdayRange": pacWeekdayRange,
+		"timeRange":    pacTimeRange,
+		"dateRange": func(*pacSys, []any) (any, error) {
+			return nil, errors.New("pac: dateRange is not supported")
+		},
+		"alert": func(*pacSys, []any) (any, error) {
+			return nil, nil
+		},
+	}
+}
+
+// pacArg returns the i'th argument as a string, or the empty string if
+// there's no such argument.
+func pacArg(args []any, i int) string {
+	if i >= len(args) || args[i] == nil {
+		return ""
+	}
+	return pacToString(args[i])
+}
+
+// shExpMatch reports whether s matches the shell expression pattern, in
+// which * matches any sequence of characters (including /) and ? matches
+// any one character.
+func shExpMatch(s, pattern string) bool {
+	// Iterative glob matching, backtracking to the most recent *.
+	var si, pi int
+	star, starS := -1, 0
+	for si < len(s) {
+		switch {
+		case pi < len(pattern) && (pattern[pi] == '?' || pattern[pi] == s[si]):
+			si++
+			pi++
+		case pi < len(pattern) && pattern[pi] == '*':
+			star, starS = pi, si
+			pi++
+		case star != -1:
+			pi = star + 1
+			starS++
+			si = starS
+		default:
+			return false
+		}
+	}
+	for pi < len(pattern) && pattern[pi] == '*' {
+		pi++
+	}
+	return pi == len(pattern)
+}
+
+var pacWeekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// pacNow returns the current time and the arguments other than a trailing
+// "GMT", which asks for the time in UTC.
+func pacNow(sys *pacSys, args []any) (time.Time, []any) {
+	now := sys.now()
+	if n := len(args); n > 0 && args[n-1] == "GMT" {
+		return now.UTC(), args[:n-1]
+	}
+	return now, args
+}
+
+func pacWeekdayRange(sys *pacSys, args []any) (any, error) {
+	now, args := pacNow(sys, args)
+	if len(args) < 1 || len(args) > 2 {
+		return nil, errors.New("pac: bad weekdayRange arguments")
+	}
+	var days []int
+	for i := range args {
+		d := slices.Index(pacWeekdays, pacArg(args, i))
+		if d == -1 {
+			return nil, fmt.Errorf("pac: bad weekday %q", pacArg(args, i))
+		}
+		days = append(days, d)
+	}
+	wd := int(now.Weekday())
+	if len(days) == 1 {
+		return wd == days[0], nil
+	}
+	if days[0] <= days[1] {
+		return wd >= days[0] && wd <= days[1], nil
+	}
+	return wd >= days[0] || wd <= days[1], nil // wraps around the weekend
+}
+
+func pacTimeRange(sys *pacSys, args []any) (any, error) {
+	now, args := pacNow(sys, args)
+	var hours []int
+	for _, a := range args {
+		n, ok := a.(float64)
+		if !ok || n < 0 || n > 24 {
+			return nil, errors.New("pac: bad timeRange arguments")
+		}
+		hours = append(hours, int(n))
+	}
+	h := now.Hour()
+	switch len(hours) {
+	case 1:
+		return h == hours[0], nil
+	case 2:
+		if hours[0] <= hours[1] {
+			return h >= hours[0] && h < hours[1], nil
+		}
+		return h >= hours[0] || h < hours[1], nil
+	}
+	return nil, errors.New("pac: only the hour forms of timeRange are supported")
+}
@@ -30,6 +30,7 @@ func InvalidateCache() {
 	mu.Lock()
 	defer mu.Unlock()
 	noProxyUntil = time.Time{}
+	invalidatePACCache()
 }
 
 var (
@@ -145,7 +146,8 @@ func SetSelfProxy(addrs ...string) {
 
 // ProxyFromEnvironment is like the standard library's http.ProxyFromEnvironment
 // but additionally does OS-specific proxy lookups if the environment variables
-// alone don't specify a proxy.
+// alone don't specify a proxy. If TS_PROXY_PAC_URL is set, the PAC file it
+// names is used in preference to the OS settings.
 func ProxyFromEnvironment(req *http.Request) (ret *url.URL, _ error) {
 	defer func() {
 		if ret == nil {
@@ -169,6 +171,10 @@ func ProxyFromEnvironment(req *http.Request) (ret *url.URL, _ error) {
 		return u, nil
 	}
 
+	if u, ok := pacProxyFromEnv(req); ok {
+		return u, nil
+	}
+
 	mu.Lock()
 	noProxyTime := noProxyUntil
 	mu.Unlock()
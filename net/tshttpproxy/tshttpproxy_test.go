@@ -4,6 +4,11 @@
 package tshttpproxy
 
 import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -205,3 +210,92 @@ func TestSetSelfProxy(t *testing.T) {
 		})
 	}
 }
+
+// testAuthSession is an AuthSession for the fake "X-Test" scheme, which
+// answers the proxy's challenge by prefixing it with "response:".
+type testAuthSession struct{ closed bool }
+
+func (s *testAuthSession) Step(challenge []byte) ([]byte, error) {
+	if challenge == nil {
+		return []byte("hello"), nil
+	}
+	return append([]byte("response:"), challenge...), nil
+}
+
+func (s *testAuthSession) Close() { s.closed = true }
+
+func TestConnectMultiLegAuth(t *testing.T) {
+	sess := new(testAuthSession)
+	RegisterAuthScheme("X-Test", func(*url.URL) (AuthSession, error) { return sess, nil })
+	t.Cleanup(func() {
+		authSchemesMu.Lock()
+		defer authSchemesMu.Unlock()
+		delete(authSchemes, "x-test")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	b64 := base64.StdEncoding.EncodeToString
+	authsc := make(chan []string, 1)
+	go func() {
+		var gotAuths []string
+		defer func() { authsc <- gotAuths }()
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		br := bufio.NewReader(c)
+		for {
+			req, err := http.ReadRequest(br)
+			if err != nil {
+				return
+			}
+			auth := req.Header.Get("Proxy-Authorization")
+			gotAuths = append(gotAuths, auth)
+			switch auth {
+			case "":
+				io.WriteString(c, "HTTP/1.1 407 Proxy Auth Required\r\nProxy-Authenticate: Basic realm=x\r\nProxy-Authenticate: X-Test\r\nContent-Length: 0\r\n\r\n")
+			case "X-Test " + b64([]byte("hello")):
+				io.WriteString(c, "HTTP/1.1 407 Proxy Auth Required\r\nProxy-Authenticate: X-Test "+b64([]byte("challenge"))+"\r\nContent-Length: 3\r\n\r\nno!")
+			case "X-Test " + b64([]byte("response:challenge")):
+				io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\ntunneled")
+				return
+			default:
+				io.WriteString(c, "HTTP/1.1 403 Forbidden\r\n\r\n")
+				return
+			}
+		}
+	}()
+
+	proxyURL := must.Get(url.Parse("http://" + ln.Addr().String()))
+	dialProxy := func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", ln.Addr().String())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := Connect(ctx, dialProxy, proxyURL, "example.com:443")
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer conn.Close()
+
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "tunneled" {
+		t.Errorf("read %q from tunnel; want %q", got, "tunneled")
+	}
+	if gotAuths := <-authsc; len(gotAuths) != 3 {
+		t.Errorf("proxy got %d CONNECT requests (auth %q); want 3", len(gotAuths), gotAuths)
+	}
+	if !sess.closed {
+		t.Errorf("auth session not closed")
+	}
+}
@@ -17,7 +17,9 @@
 	"time"
 	"unsafe"
 
+	"github.com/alexbrainman/sspi"
 	"github.com/alexbrainman/sspi/negotiate"
+	"github.com/alexbrainman/sspi/ntlm"
 	"github.com/dblohm7/wingoes"
 	"golang.org/x/sys/windows"
 	"tailscale.com/hostinfo"
@@ -30,6 +32,8 @@
 func init() {
 	sysProxyFromEnv = proxyFromWinHTTPOrCache
 	sysAuthHeader = sysAuthHeaderWindows
+	RegisterAuthScheme("Negotiate", newNegotiateSession)
+	RegisterAuthScheme("NTLM", newNTLMSession)
 }
 
 var cachedProxy struct {
@@ -286,3 +290,81 @@ func sysAuthHeaderWindows(u *url.URL) (string, error) {
 
 	return "Negotiate " + base64.StdEncoding.EncodeToString(token), nil
 }
+
+// negotiateSession is an [AuthSession] for the Negotiate (SPNEGO) scheme,
+// using SSPI with the current user's credentials. Depending on what the
+// proxy and domain support, SSPI picks Kerberos or NTLM.
+type negotiateSession struct {
+	spn    string
+	creds  *sspi.Credentials
+	secCtx *negotiate.ClientContext // nil until the first Step
+}
+
+func newNegotiateSession(u *url.URL) (AuthSession, error) {
+	creds, err := negotiate.AcquireCurrentUserCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("negotiate.AcquireCurrentUserCredentials: %w", err)
+	}
+	return &negotiateSession{spn: "HTTP/" + u.Hostname(), creds: creds}, nil
+}
+
+func (s *negotiateSession) Step(challenge []byte) ([]byte, error) {
+	if s.secCtx == nil {
+		secCtx, token, err := negotiate.NewClientContext(s.creds, s.spn)
+		if err != nil {
+			return nil, fmt.Errorf("negotiate.NewClientContext: %w", err)
+		}
+		s.secCtx = secCtx
+		return token, nil
+	}
+	_, token, err := s.secCtx.Update(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("negotiate.ClientContext.Update: %w", err)
+	}
+	return token, nil
+}
+
+func (s *negotiateSession) Close() {
+	if s.secCtx != nil {
+		s.secCtx.Release()
+	}
+	s.creds.Release()
+}
+
+// ntlmSession is an [AuthSession] for the NTLM scheme, for proxies that
+// don't offer Negotiate, using SSPI with the current user's credentials.
+type ntlmSession struct {
+	creds  *sspi.Credentials
+	secCtx *ntlm.ClientContext // nil until the first Step
+}
+
+func newNTLMSession(*url.URL) (AuthSession, error) {
+	creds, err := ntlm.AcquireCurrentUserCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("ntlm.AcquireCurrentUserCredentials: %w", err)
+	}
+	return &ntlmSession{creds: creds}, nil
+}
+
+func (s *ntlmSession) Step(challenge []byte) ([]byte, error) {
+	if s.secCtx == nil {
+		secCtx, negotiateMsg, err := ntlm.NewClientContext(s.creds)
+		if err != nil {
+			return nil, fmt.Errorf("ntlm.NewClientContext: %w", err)
+		}
+		s.secCtx = secCtx
+		return negotiateMsg, nil
+	}
+	authenticateMsg, err := s.secCtx.Update(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("ntlm.ClientContext.Update: %w", err)
+	}
+	return authenticateMsg, nil
+}
+
+func (s *ntlmSession) Close() {
+	if s.secCtx != nil {
+		s.secCtx.Release()
+	}
+	s.creds.Release()
+}
@@ -4,6 +4,8 @@
 package tstun
 
 import (
+	"slices"
+
 	"tailscale.com/envknob"
 )
 
@@ -91,6 +93,9 @@
 	9000,                     // Most jumbo frames are this size or larger
 }
 
+// maxProbedWireMTU is the largest of WireMTUsToProbe.
+var maxProbedWireMTU = slices.Max(WireMTUsToProbe)
+
 // wgHeaderLen is the length of all the headers Wireguard adds to a packet
 // in the worst case (IPv6). This constant is for use when we can't or
 // shouldn't use information about the IP version of a specific packet
@@ -137,12 +142,11 @@ func DefaultTUNMTU() TUNMTU {
 
 	debugPMTUD, _ := envknob.LookupBool("TS_DEBUG_ENABLE_PMTUD")
 	if debugPMTUD {
-		// TODO: While we are just probing MTU but not generating PTB,
-		// this has to continue to return the safe MTU. When we add the
-		// code to generate PTB, this will be:
-		//
-		// return WireToTUNMTU(maxProbedWireMTU)
-		return safeTUNMTU
+		// Packets that don't fit the probed path MTU to their peer are
+		// answered with ICMP packet-too-big errors by the Wrapper (see
+		// Wrapper.PeerPathMTU), so the TUN can offer the largest MTU
+		// that any path might support.
+		return min(WireToTUNMTU(maxProbedWireMTU), maxTUNMTU)
 	}
 
 	return safeTUNMTU
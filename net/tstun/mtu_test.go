@@ -40,15 +40,12 @@ func TestDefaultTunMTU(t *testing.T) {
 		t.Errorf("default TUN MTU = %d, want %d, clamping failed", DefaultTUNMTU(), maxTUNMTU)
 	}
 
-	// If PMTUD is enabled, the MTU should default to the safe MTU, but only
-	// if the user hasn't requested a specific MTU.
-	//
-	// TODO: When PMTUD is generating PTB responses, this will become the
-	// largest MTU we probe.
+	// If PMTUD is enabled, the MTU should default to the largest MTU we
+	// probe, but only if the user hasn't requested a specific MTU.
 	os.Setenv("TS_DEBUG_MTU", "")
 	os.Setenv("TS_DEBUG_ENABLE_PMTUD", "true")
-	if DefaultTUNMTU() != safeTUNMTU {
-		t.Errorf("default TUN MTU = %d, want %d", DefaultTUNMTU(), safeTUNMTU)
+	if want := min(WireToTUNMTU(maxProbedWireMTU), maxTUNMTU); DefaultTUNMTU() != want {
+		t.Errorf("default TUN MTU = %d, want %d", DefaultTUNMTU(), want)
 	}
 	// TS_DEBUG_MTU should take precedence over TS_DEBUG_ENABLE_PMTUD.
 	mtu = WireToTUNMTU(MaxPacketSize - 1)
@@ -207,6 +207,14 @@ type Wrapper struct {
 	// running for the given IP address.
 	PeerAPIPort func(netip.Addr) (port uint16, ok bool)
 
+	// PeerPathMTU, if non-nil, returns the largest packet that fits on
+	// the path to the peer handling packets to dst, if that's known.
+	// Outbound packets larger than that are dropped and answered with an
+	// ICMP packet-too-big error, so that the sending host lowers its path
+	// MTU for dst rather than blackholing on a path with a smaller MTU
+	// than the TUN's.
+	PeerPathMTU func(dst netip.Addr) (mtu TUNMTU, ok bool)
+
 	// disableFilter disables all filtering when set. This should only be used in tests.
 	disableFilter bool
 
@@ -921,9 +929,14 @@ func (t *Wrapper) filterPacketOutboundToWireGuard(p *packet.Parsed, pc *peerConf
 				Reason: reason,
 			}, 1)
 		}
+		t.captureDropped(packet.FromLocal, p)
 		return filter.Drop, gro
 	}
 
+	if res := t.clampToPeerPathMTU(p); res.IsDrop() {
+		return res, gro
+	}
+
 	if t.PostFilterPacketOutboundToWireGuard != nil {
 		if res := t.PostFilterPacketOutboundToWireGuard(p, t); res.IsDrop() {
 			return res, gro
@@ -932,6 +945,28 @@ func (t *Wrapper) filterPacketOutboundToWireGuard(p *packet.Parsed, pc *peerConf
 	return filter.Accept, gro
 }
 
+// clampToPeerPathMTU drops outbound packet p if it's larger than the path
+// MTU to its destination peer, and injects an ICMP packet-too-big error for
+// it back to the host.
+func (t *Wrapper) clampToPeerPathMTU(p *packet.Parsed) filter.Response {
+	size := len(p.Buffer())
+	if t.PeerPathMTU == nil || size <= int(safeTUNMTU) {
+		// Every path can carry packets of the safe MTU.
+		return filter.Accept
+	}
+	mtu, ok := t.PeerPathMTU(p.Dst.Addr())
+	if !ok || size <= int(mtu) {
+		return filter.Accept
+	}
+	metricPacketOutDropPathMTU.Add(1)
+	if ptb := packet.PacketTooBig(p, uint32(mtu)); ptb != nil {
+		if err := t.InjectInboundCopy(ptb); err != nil {
+			t.limitedLogf("tstun: injecting packet-too-big for %v: %v", p.Dst.Addr(), err)
+		}
+	}
+	return filter.DropSilently
+}
+
 // noteActivity records that there was a read or write at the current time.
 func (t *Wrapper) noteActivity() {
 	t.lastActivityAtomic.StoreAtomic(mono.Now())
@@ -1217,6 +1252,7 @@ func (t *Wrapper) filterPacketInboundFromWireGuard(p *packet.Parsed, captHook pa
 		t.metrics.inboundDroppedPacketsTotal.Add(usermetric.DropLabels{
 			Reason: usermetric.ReasonACL,
 		}, 1)
+		t.captureDropped(packet.FromPeer, p)
 
 		// Tell them, via TSMP, we're dropping them due to the ACL.
 		// Their host networking stack can translate this into ICMP
@@ -1553,6 +1589,7 @@ func (t *Wrapper) SetConnectionCounter(fn netlogfunc.ConnectionCounter) {
 	metricPacketOutDrop          = clientmetric.NewCounter("tstun_out_to_wg_drop")
 	metricPacketOutDropFilter    = clientmetric.NewCounter("tstun_out_to_wg_drop_filter")
 	metricPacketOutDropSelfDisco = clientmetric.NewCounter("tstun_out_to_wg_drop_self_disco")
+	metricPacketOutDropPathMTU   = clientmetric.NewCounter("tstun_out_to_wg_drop_path_mtu")
 )
 
 func (t *Wrapper) InstallCaptureHook(cb packet.CaptureCallback) {
@@ -1562,6 +1599,18 @@ func (t *Wrapper) InstallCaptureHook(cb packet.CaptureCallback) {
 	t.captureHook.Store(cb)
 }
 
+// captureDropped passes p, which the packet filter dropped, to the capture
+// hook, if any. Packets dropped silently, without a reason recorded in
+// p.CaptureMeta.DropReason, aren't captured.
+func (t *Wrapper) captureDropped(path packet.CapturePath, p *packet.Parsed) {
+	if !buildfeatures.HasCapture || p.CaptureMeta.DropReason == "" {
+		return
+	}
+	if captHook := t.captureHook.Load(); captHook != nil {
+		captHook(path, t.now(), p.Buffer(), p.CaptureMeta)
+	}
+}
+
 func updateConnCounter(update netlogfunc.ConnectionCounter, b []byte, receive bool) {
 	var p packet.Parsed
 	p.Decode(b)
@@ -937,16 +937,27 @@ type captureRecord struct {
 	// TODO: test Read
 	// TODO: determine if we want InjectOutbound to log
 
-	// Assert that the right packets are captured.
+	// Assert that the right packets are captured. The written packets
+	// aren't valid IP packets, so they're also captured as dropped.
 	want := []captureRecord{
 		{
 			path: packet.FromPeer,
 			pkt:  []byte("Write1"),
 		},
+		{
+			path: packet.FromPeer,
+			pkt:  []byte("Write1"),
+			meta: packet.CaptureMeta{DropReason: "too short"},
+		},
 		{
 			path: packet.FromPeer,
 			pkt:  []byte("Write2"),
 		},
+		{
+			path: packet.FromPeer,
+			pkt:  []byte("Write2"),
+			meta: packet.CaptureMeta{DropReason: "too short"},
+		},
 		{
 			path: packet.SynthesizedToLocal,
 			pkt:  []byte("InjectInboundPacketBuffer"),
@@ -1055,3 +1066,64 @@ func TestInterceptOrdering(t *testing.T) {
 		t.Errorf("got number of intercepts run in Read(): %d; want: %d", seq, numOutboundIntercepts)
 	}
 }
+
+func TestClampToPeerPathMTU(t *testing.T) {
+	bus := eventbustest.NewBus(t)
+	chtun, tun := newChannelTUN(t.Logf, bus, false)
+	defer tun.Close()
+
+	tun.SetFilter(filter.NewAllowAllForTest(t.Logf))
+	const pathMTU = 1400
+	tun.PeerPathMTU = func(dst netip.Addr) (TUNMTU, bool) {
+		return pathMTU, dst == netip.MustParseAddr("fd7a:115c:a1e0::2")
+	}
+	udp6 := func(dst string, size int) *packet.Parsed {
+		h := packet.UDP6Header{
+			IP6Header: packet.IP6Header{
+				Src: netip.MustParseAddr("fd7a:115c:a1e0::1"),
+				Dst: netip.MustParseAddr(dst),
+			},
+			SrcPort: 1234,
+			DstPort: 5678,
+		}
+		p := new(packet.Parsed)
+		p.Decode(packet.Generate(h, make([]byte, size-h.Len())))
+		return p
+	}
+
+	tests := []struct {
+		name string
+		dst  string
+		size int
+		want filter.Response
+	}{
+		{"fits", "fd7a:115c:a1e0::2", pathMTU, filter.Accept},
+		{"too_big", "fd7a:115c:a1e0::2", pathMTU + 1, filter.DropSilently},
+		{"unknown_path", "fd7a:115c:a1e0::3", pathMTU + 1, filter.Accept},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The packet-too-big reply is injected synchronously, so
+			// receive it concurrently.
+			injected := make(chan []byte, 1)
+			if tt.want == filter.DropSilently {
+				go func() { injected <- <-chtun.Inbound }()
+			}
+			got, _ := tun.filterPacketOutboundToWireGuard(udp6(tt.dst, tt.size), nil, nil)
+			if got != tt.want {
+				t.Fatalf("got %v; want %v", got, tt.want)
+			}
+			if got != filter.DropSilently {
+				return
+			}
+			ptb := new(packet.Parsed)
+			ptb.Decode(<-injected)
+			if ptb.IPProto != ipproto.ICMPv6 || ptb.Src.Addr() != netip.MustParseAddr(tt.dst) {
+				t.Fatalf("injected %v; want ICMPv6 packet-too-big from %v", ptb, tt.dst)
+			}
+			if typ := ptb.ICMP6Header().Type; typ != packet.ICMP6PacketTooBig {
+				t.Fatalf("injected ICMPv6 type %v; want packet-too-big", typ)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+)
+
+// IDs of the endpoint security agents that GetSecurityAgents looks for.
+const (
+	SecurityAgentCrowdStrike = "crowdstrike"
+	SecurityAgentDefender    = "defender"
+	SecurityAgentSentinelOne = "sentinelone"
+)
+
+// GetSecurityAgents returns the endpoint security agents (EDR and
+// antivirus) found on the machine, in ID order. It only looks for the
+// agents whose IDs are listed above.
+//
+// It's implemented on Windows, using Windows Security Center and the
+// agents' services, and on macOS, by inspecting the agents' bundles and
+// running processes.
+func GetSecurityAgents(logf logger.Logf) ([]tailcfg.C2NPostureSecurityAgent, error) {
+	return getSecurityAgents(logf)
+}
@@ -0,0 +1,166 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build darwin && !ios
+
+package posture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+)
+
+// macSecurityAgent describes how to find a security agent on macOS.
+type macSecurityAgent struct {
+	id   string
+	name string
+	// bundles are the paths the agent's app or bundle may be installed
+	// at. The first one found is used.
+	bundles []string
+	// processes are the names of the agent's daemons, any of which
+	// running means the agent is running.
+	processes []string
+}
+
+var macSecurityAgents = []macSecurityAgent{
+	{
+		id:        SecurityAgentCrowdStrike,
+		name:      "CrowdStrike Falcon",
+		bundles:   []string{"/Applications/Falcon.app"},
+		processes: []string{"falcond", "com.crowdstrike.falcon.Agent"},
+	},
+	{
+		id:        SecurityAgentDefender,
+		name:      "Microsoft Defender",
+		bundles:   []string{"/Applications/Microsoft Defender.app"},
+		processes: []string{"wdavdaemon"},
+	},
+	{
+		id:   SecurityAgentSentinelOne,
+		name: "SentinelOne",
+		bundles: []string{
+			"/Applications/SentinelOne/SentinelOne Extensions.app",
+			"/Library/Sentinel/sentinel-agent.bundle",
+		},
+		processes: []string{"sentineld"},
+	},
+}
+
+func getSecurityAgents(logf logger.Logf) ([]tailcfg.C2NPostureSecurityAgent, error) {
+	procs, err := runningProcesses()
+	if err != nil {
+		logf("GetSecurityAgents: listing processes: %v", err)
+	}
+
+	var ret []tailcfg.C2NPostureSecurityAgent
+	for _, a := range macSecurityAgents {
+		agent := tailcfg.C2NPostureSecurityAgent{
+			ID:      a.id,
+			Running: slices.ContainsFunc(a.processes, func(p string) bool { return procs[p] }),
+		}
+		found := agent.Running
+		for _, b := range a.bundles {
+			if _, err := os.Stat(b); err != nil {
+				continue
+			}
+			found = true
+			agent.Version, err = bundleVersion(b)
+			if err != nil {
+				logf("GetSecurityAgents: reading version of %s: %v", b, err)
+			}
+			break
+		}
+		if !found {
+			continue
+		}
+		agent.Name = a.name
+		ret = append(ret, agent)
+	}
+	return ret, nil
+}
+
+// runningProcesses returns the set of the names of running processes.
+func runningProcesses() (map[string]bool, error) {
+	out, err := exec.Command("/bin/ps", "-axco", "comm=").Output()
+	if err != nil {
+		return nil, err
+	}
+	procs := make(map[string]bool)
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if p := strings.TrimSpace(s.Text()); p != "" {
+			procs[p] = true
+		}
+	}
+	return procs, s.Err()
+}
+
+// bundleVersion returns the CFBundleShortVersionString of the bundle at
+// path.
+func bundleVersion(path string) (string, error) {
+	f, err := os.Open(filepath.Join(path, "Contents", "Info.plist"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return plistStringValue(f, "CFBundleShortVersionString")
+}
+
+// plistStringValue returns the string value of key in the top-level
+// dictionary of the XML property list read from r. Binary property lists
+// aren't supported, but bundles' Info.plist files are XML.
+func plistStringValue(r io.Reader, key string) (string, error) {
+	d := xml.NewDecoder(r)
+	depth := 0
+	lastKey := ""
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return "", errors.New("key not found")
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			// The top-level dictionary's entries are at depth 3:
+			// <plist><dict><key>.
+			if depth != 3 {
+				continue
+			}
+			switch t.Name.Local {
+			case "key":
+				var k string
+				if err := d.DecodeElement(&k, &t); err != nil {
+					return "", err
+				}
+				depth--
+				lastKey = k
+				continue
+			case "string":
+				if lastKey == key {
+					var v string
+					if err := d.DecodeElement(&v, &t); err != nil {
+						return "", err
+					}
+					return strings.TrimSpace(v), nil
+				}
+			}
+			lastKey = ""
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build darwin && !ios
+
+package posture
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlistStringValue(t *testing.T) {
+	const plist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.agent</string>
+	<key>LSEnvironment</key>
+	<dict>
+		<key>CFBundleShortVersionString</key>
+		<string>0.0.0</string>
+	</dict>
+	<key>CFBundleShortVersionString</key>
+	<string>7.15.18513</string>
+</dict>
+</plist>`
+
+	got, err := plistStringValue(strings.NewReader(plist), "CFBundleShortVersionString")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "7.15.18513"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	if _, err := plistStringValue(strings.NewReader(plist), "CFBundleVersion"); err == nil {
+		t.Error("missing key: got no error")
+	}
+}
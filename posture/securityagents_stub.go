@@ -0,0 +1,18 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !windows && !(darwin && !ios)
+
+package posture
+
+import (
+	"errors"
+	"fmt"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+)
+
+func getSecurityAgents(logger.Logf) ([]tailcfg.C2NPostureSecurityAgent, error) {
+	return nil, fmt.Errorf("not implemented: %w", errors.ErrUnsupported)
+}
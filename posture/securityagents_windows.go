@@ -0,0 +1,159 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/osdiag"
+	"tailscale.com/util/winutil"
+)
+
+// windowsSecurityAgent describes how to find a security agent on Windows.
+type windowsSecurityAgent struct {
+	id string
+	// wscNames are prefixes of the agent's product name in Windows
+	// Security Center, for agents that register there.
+	wscNames []string
+	// service is the name of the agent's Windows service.
+	service string
+	// version returns the agent's installed version, or "" if unknown.
+	version func() string
+}
+
+var windowsSecurityAgents = []windowsSecurityAgent{
+	{
+		id:       SecurityAgentCrowdStrike,
+		wscNames: []string{"CrowdStrike Falcon"},
+		service:  "CSFalconService",
+		version:  func() string { return uninstallVersion("CrowdStrike Windows Sensor") },
+	},
+	{
+		id:       SecurityAgentDefender,
+		wscNames: []string{"Microsoft Defender", "Windows Defender"},
+		service:  "WinDefend",
+		version:  defenderVersion,
+	},
+	{
+		id:       SecurityAgentSentinelOne,
+		wscNames: []string{"Sentinel Agent", "SentinelOne"},
+		service:  "SentinelAgent",
+		version:  func() string { return uninstallVersion("Sentinel Agent") },
+	},
+}
+
+func getSecurityAgents(logf logger.Logf) ([]tailcfg.C2NPostureSecurityAgent, error) {
+	// Windows Server has no Security Center, so carry on without it and
+	// rely on the agents' services.
+	products, err := osdiag.AntivirusProducts()
+	if err != nil {
+		logf("GetSecurityAgents: querying Windows Security Center: %v", err)
+	}
+
+	scm, err := winutil.ConnectToLocalSCMForRead()
+	if err != nil {
+		return nil, fmt.Errorf("connecting to Service Control Manager: %w", err)
+	}
+	defer scm.Disconnect()
+
+	var ret []tailcfg.C2NPostureSecurityAgent
+	for _, a := range windowsSecurityAgents {
+		agent := tailcfg.C2NPostureSecurityAgent{ID: a.id}
+		i := slices.IndexFunc(products, func(p osdiag.AntivirusProduct) bool {
+			return slices.ContainsFunc(a.wscNames, func(name string) bool {
+				return hasPrefixFold(p.Name, name)
+			})
+		})
+		running, haveService := serviceRunning(scm, a.service)
+		switch {
+		case i >= 0:
+			// Prefer Security Center's view: Defender's service keeps
+			// running in passive mode when another antivirus is active.
+			agent.Name = products[i].Name
+			agent.Running = products[i].Enabled
+		case haveService:
+			agent.Running = running
+		default:
+			continue
+		}
+		agent.Version = a.version()
+		ret = append(ret, agent)
+	}
+	return ret, nil
+}
+
+// serviceRunning reports whether the named service is running, and
+// whether it exists at all.
+func serviceRunning(scm *mgr.Mgr, name string) (running, ok bool) {
+	s, err := winutil.OpenServiceForRead(scm, name)
+	if err != nil {
+		return false, false
+	}
+	defer s.Close()
+	st, err := s.Query()
+	if err != nil {
+		return false, true
+	}
+	return st.State == svc.Running, true
+}
+
+// uninstallVersion returns the DisplayVersion of the installed program
+// whose DisplayName begins with displayName, or "" if there's none.
+func uninstallVersion(displayName string) string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+	names, err := k.ReadSubKeyNames(0)
+	if err != nil {
+		return ""
+	}
+	for _, name := range names {
+		sk, err := registry.OpenKey(k, name, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		dn, _, _ := sk.GetStringValue("DisplayName")
+		v, _, _ := sk.GetStringValue("DisplayVersion")
+		sk.Close()
+		if v != "" && hasPrefixFold(dn, displayName) {
+			return v
+		}
+	}
+	return ""
+}
+
+// defenderVersion returns the Microsoft Defender platform version, which
+// names the directory that Defender runs from, or "" if it's unknown.
+func defenderVersion() string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows Defender`, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+	// Like `C:\ProgramData\Microsoft\Windows Defender\Platform\4.18.24090.11-0\`.
+	loc, _, err := k.GetStringValue("InstallLocation")
+	if err != nil {
+		return ""
+	}
+	v, _, _ := strings.Cut(filepath.Base(strings.TrimRight(loc, `\`)), "-")
+	if v == "" || v[0] < '0' || v[0] > '9' {
+		return ""
+	}
+	return v
+}
+
+// hasPrefixFold reports whether s begins with prefix, ignoring case.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
@@ -0,0 +1,181 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux && !android
+
+package posture
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"tailscale.com/types/logger"
+	"tailscale.com/util/syspolicy/pkey"
+	"tailscale.com/util/syspolicy/policyclient"
+)
+
+// Sources of serial numbers on Linux, as named in the SerialNumberSources
+// policy setting.
+const (
+	sourceSMBIOS     = "smbios"
+	sourceDeviceTree = "devicetree"
+	sourceMachineID  = "machine-id"
+)
+
+// defaultSerialNumberSources are the sources used if the SerialNumberSources
+// policy setting isn't set. The machine ID isn't a hardware serial, so it's
+// only used if allowed explicitly.
+var defaultSerialNumberSources = []string{sourceSMBIOS, sourceDeviceTree}
+
+// machineIDPrefix labels the machine ID among serial numbers, so that it's
+// never mistaken for a hardware serial.
+const machineIDPrefix = "machine-id:"
+
+// readSMBIOS reads the serial numbers from the SMBIOS tables. It's replaced
+// in tests.
+var readSMBIOS = smbiosSerialNumbers
+
+// GetSerialNumbers returns the serial numbers of the device from the sources
+// allowed by the SerialNumberSources policy setting: SMBIOS/DMI, the device
+// tree of ARM single-board computers, and the systemd machine ID.
+func GetSerialNumbers(polc policyclient.Client, logf logger.Logf) ([]string, error) {
+	sources, err := polc.GetStringArray(pkey.SerialNumberSources, defaultSerialNumberSources)
+	if err != nil {
+		logf("posture: reading %s policy setting: %v", pkey.SerialNumberSources, err)
+		sources = defaultSerialNumberSources
+	}
+	return linuxSerialNumbers("/", sources, logf)
+}
+
+// linuxSerialNumbers returns the serial numbers from sources, reading files
+// relative to root. It returns an error only if it found none and a source
+// failed.
+func linuxSerialNumbers(root string, sources []string, logf logger.Logf) ([]string, error) {
+	var serials []string
+	var errs []error
+	add := func(s string) {
+		if !slices.Contains(serials, s) {
+			serials = append(serials, s)
+		}
+	}
+	for _, src := range sources {
+		var got []string
+		var err error
+		switch src {
+		case sourceSMBIOS:
+			got, err = dmiSerialNumbers(root)
+		case sourceDeviceTree:
+			got, err = deviceTreeSerialNumbers(root)
+		case sourceMachineID:
+			var id string
+			id, err = machineID(root)
+			if id != "" {
+				got = []string{machineIDPrefix + id}
+			}
+		default:
+			logf("posture: ignoring unknown serial number source %q", src)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src, err))
+		}
+		for _, s := range got {
+			add(s)
+		}
+	}
+	if len(serials) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return serials, nil
+}
+
+// dmiSerialNumbers returns the serial numbers in the SMBIOS tables, or, if
+// those can't be read, in the sysfs DMI attributes derived from them.
+func dmiSerialNumbers(root string) ([]string, error) {
+	serials, err := readSMBIOS()
+	if err == nil {
+		return slices.DeleteFunc(serials, isPlaceholderSerial), nil
+	}
+	for _, name := range []string{"product_serial", "board_serial", "chassis_serial"} {
+		b, ferr := os.ReadFile(filepath.Join(root, "sys/class/dmi/id", name))
+		if ferr != nil {
+			continue
+		}
+		if s := strings.TrimSpace(string(b)); !isPlaceholderSerial(s) {
+			serials = append(serials, s)
+		}
+	}
+	if len(serials) == 0 {
+		return nil, err
+	}
+	return serials, nil
+}
+
+// deviceTreeSerialNumbers returns the serial number of the device tree, as
+// ARM single-board computers have, or else the Serial line of /proc/cpuinfo,
+// where older kernels on Raspberry Pis report it.
+func deviceTreeSerialNumbers(root string) ([]string, error) {
+	for _, p := range []string{"sys/firmware/devicetree/base/serial-number", "proc/device-tree/serial-number"} {
+		b, err := os.ReadFile(filepath.Join(root, p))
+		if err != nil {
+			continue
+		}
+		// Device tree strings are NUL-terminated.
+		b, _, _ = bytes.Cut(b, []byte{0})
+		if s := strings.TrimSpace(string(b)); !isPlaceholderSerial(s) {
+			return []string{s}, nil
+		}
+	}
+
+	f, err := os.Open(filepath.Join(root, "proc/cpuinfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok || strings.TrimSpace(k) != "Serial" {
+			continue
+		}
+		if s := strings.TrimSpace(v); !isPlaceholderSerial(s) {
+			return []string{s}, nil
+		}
+	}
+	return nil, sc.Err()
+}
+
+// machineID returns the systemd machine ID.
+func machineID(root string) (string, error) {
+	for _, p := range []string{"etc/machine-id", "var/lib/dbus/machine-id"} {
+		b, err := os.ReadFile(filepath.Join(root, p))
+		if err != nil {
+			continue
+		}
+		if id := strings.TrimSpace(string(b)); id != "" && id != "uninitialized" {
+			return id, nil
+		}
+	}
+	return "", errors.New("no machine ID found")
+}
+
+// isPlaceholderSerial reports whether s is empty or a value that firmware
+// reports in place of a serial number, which identifies nothing.
+func isPlaceholderSerial(s string) bool {
+	if strings.Trim(s, "0") == "" {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "none", "not specified", "not applicable", "default string",
+		"to be filled by o.e.m.", "system serial number", "chassis serial number",
+		"0123456789", "123456789":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux && !android
+
+package posture
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"tailscale.com/types/logger"
+)
+
+func TestLinuxSerialNumbers(t *testing.T) {
+	writeFiles := func(t *testing.T, files map[string]string) string {
+		root := t.TempDir()
+		for name, content := range files {
+			p := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return root
+	}
+	noSMBIOS := func() ([]string, error) { return nil, errors.New("permission denied") }
+
+	tests := []struct {
+		name    string
+		smbios  func() ([]string, error)
+		files   map[string]string
+		sources []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "smbios",
+			smbios:  func() ([]string, error) { return []string{"PF1ABC", "Default string", "PF1ABC-BOARD"}, nil },
+			sources: defaultSerialNumberSources,
+			want:    []string{"PF1ABC", "PF1ABC-BOARD"},
+		},
+		{
+			name:   "sysfs-dmi",
+			smbios: noSMBIOS,
+			files: map[string]string{
+				"sys/class/dmi/id/product_serial": "PF1ABC\n",
+				"sys/class/dmi/id/board_serial":   "To be filled by O.E.M.\n",
+				"sys/class/dmi/id/chassis_serial": "PF1ABC\n",
+			},
+			sources: defaultSerialNumberSources,
+			want:    []string{"PF1ABC"},
+		},
+		{
+			name:   "devicetree",
+			smbios: noSMBIOS,
+			files: map[string]string{
+				"sys/firmware/devicetree/base/serial-number": "10000000abcdef01\x00",
+			},
+			sources: defaultSerialNumberSources,
+			want:    []string{"10000000abcdef01"},
+		},
+		{
+			name:   "raspberry-pi-cpuinfo",
+			smbios: noSMBIOS,
+			files: map[string]string{
+				"proc/cpuinfo": "processor\t: 0\nHardware\t: BCM2835\nRevision\t: a02082\nSerial\t\t: 00000000abcdef01\nModel\t\t: Raspberry Pi 3 Model B Rev 1.2\n",
+			},
+			sources: defaultSerialNumberSources,
+			want:    []string{"00000000abcdef01"},
+		},
+		{
+			name:   "zero-serial",
+			smbios: noSMBIOS,
+			files: map[string]string{
+				"proc/cpuinfo": "Serial\t\t: 0000000000000000\n",
+			},
+			sources: defaultSerialNumberSources,
+			wantErr: true,
+		},
+		{
+			name:   "machine-id-not-by-default",
+			smbios: noSMBIOS,
+			files: map[string]string{
+				"etc/machine-id": "0123456789abcdef0123456789abcdef\n",
+			},
+			sources: defaultSerialNumberSources,
+			wantErr: true,
+		},
+		{
+			name:   "machine-id-allowed",
+			smbios: noSMBIOS,
+			files: map[string]string{
+				"etc/machine-id": "0123456789abcdef0123456789abcdef\n",
+			},
+			sources: []string{sourceSMBIOS, sourceMachineID},
+			want:    []string{"machine-id:0123456789abcdef0123456789abcdef"},
+		},
+		{
+			name:    "smbios-not-allowed",
+			smbios:  func() ([]string, error) { return []string{"PF1ABC"}, nil },
+			files:   map[string]string{"etc/machine-id": "0123456789abcdef0123456789abcdef\n"},
+			sources: []string{sourceMachineID},
+			want:    []string{"machine-id:0123456789abcdef0123456789abcdef"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := readSMBIOS
+			readSMBIOS = tt.smbios
+			defer func() { readSMBIOS = old }()
+
+			got, err := linuxSerialNumbers(writeFiles(t, tt.files), tt.sources, logger.Discard)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q; want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -12,8 +12,6 @@
 	"strings"
 
 	"github.com/digitalocean/go-smbios/smbios"
-	"tailscale.com/types/logger"
-	"tailscale.com/util/syspolicy/policyclient"
 )
 
 // getByteFromSmbiosStructure retrieves a 8-bit unsigned integer at the given specOffset.
@@ -72,7 +70,9 @@ func init() {
 	numOfTables = len(validTables)
 }
 
-func GetSerialNumbers(polc policyclient.Client, logf logger.Logf) ([]string, error) {
+// smbiosSerialNumbers returns the serial numbers of the product, baseboard
+// and chassis in the SMBIOS tables.
+func smbiosSerialNumbers() ([]string, error) {
 	// Find SMBIOS data in operating system-specific location.
 	rc, _, err := smbios.Stream()
 	if err != nil {
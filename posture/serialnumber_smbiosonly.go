@@ -0,0 +1,17 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build windows || freebsd || openbsd || dragonfly || netbsd
+
+package posture
+
+import (
+	"tailscale.com/types/logger"
+	"tailscale.com/util/syspolicy/policyclient"
+)
+
+// GetSerialNumbers returns the serial numbers of the product, baseboard and
+// chassis, as reported by SMBIOS.
+func GetSerialNumbers(policyclient.Client, logger.Logf) ([]string, error) {
+	return smbiosSerialNumbers()
+}
@@ -0,0 +1,449 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dist
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Attestations are written next to each target's first output, as:
+//
+//   - <output>.intoto.jsonl: DSSE envelopes of in-toto statements, one per
+//     line: SLSA provenance of the target's outputs, then their SBOM.
+//   - <output>.spdx.json: the SBOM alone, as an SPDX document.
+//
+// The envelopes are signed with Build.AttestationSigner, if set. Use
+// [VerifyAttestations] to check them.
+const (
+	attestationSuffix = ".intoto.jsonl"
+	sbomSuffix        = ".spdx.json"
+
+	inTotoPayloadType     = "application/vnd.in-toto+json"
+	inTotoStatementType   = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType    = "https://slsa.dev/provenance/v1"
+	spdxPredicateType     = "https://spdx.dev/Document"
+	distBuilderID         = "https://tailscale.com/release/dist"
+	distBuildType         = "https://tailscale.com/release/dist/build/v1"
+	tailscaleRepoURI      = "git+https://github.com/tailscale/tailscale"
+	spdxDocumentNamespace = "https://tailscale.com/spdx/"
+)
+
+// A GoTarget is a Target whose outputs package Go programs. The SBOMs of its
+// outputs list the programs' Go modules.
+type GoTarget interface {
+	Target
+	// GoPrograms returns the Go programs that the target packages.
+	GoPrograms() []GoProgram
+}
+
+// A GoProgram is a Go program packaged by a GoTarget.
+type GoProgram struct {
+	// Path is the program's package path.
+	Path string
+	// Env is the environment it's built with, as passed to
+	// [Build.BuildGoBinary].
+	Env map[string]string
+}
+
+// A GoModule is a module that a Go program is built from.
+type GoModule struct {
+	Path    string
+	Version string // empty for the main module
+}
+
+// inTotoStatement is an in-toto v1 attestation statement.
+type inTotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []inTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     any             `json:"predicate"`
+}
+
+// inTotoSubject is an artifact that an in-toto statement is about.
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// slsaProvenance is a SLSA v1 provenance predicate.
+type slsaProvenance struct {
+	BuildDefinition struct {
+		BuildType            string               `json:"buildType"`
+		ExternalParameters   map[string]any       `json:"externalParameters"`
+		InternalParameters   map[string]any       `json:"internalParameters,omitempty"`
+		ResolvedDependencies []slsaResourceDigest `json:"resolvedDependencies,omitempty"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata struct {
+			StartedOn  time.Time `json:"startedOn"`
+			FinishedOn time.Time `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// slsaResourceDigest is a SLSA ResourceDescriptor identified by digest.
+type slsaResourceDigest struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// spdxDocument is an SPDX 2.3 document, with only what dist writes.
+type spdxDocument struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	DataLicense       string `json:"dataLicense"`
+	SPDXID            string `json:"SPDXID"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+	CreationInfo      struct {
+		Created  time.Time `json:"created"`
+		Creators []string  `json:"creators"`
+	} `json:"creationInfo"`
+	Packages      []spdxPackage      `json:"packages"`
+	Relationships []spdxRelationship `json:"relationships"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// dsseEnvelope is a DSSE envelope of a signed payload.
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     []byte          `json:"payload"` // base64 in JSON
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"` // base64 in JSON
+}
+
+// dssePAE returns the DSSE pre-authentication encoding of payload, which is
+// what envelopes' signatures sign.
+func dssePAE(payloadType string, payload []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "DSSEv1 %d %s %d ", len(payloadType), payloadType, len(payload))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// attest writes the attestations of t's outputs, files, built between start
+// and finish, and returns files with the attestations' files added.
+func (b *Build) attest(t Target, files []string, start, finish time.Time) ([]string, error) {
+	if len(files) == 0 {
+		return files, nil
+	}
+	var subjects []inTotoSubject
+	for _, f := range files {
+		sum, err := hashFile(b.outPath(f))
+		if err != nil {
+			return nil, fmt.Errorf("hashing output: %w", err)
+		}
+		subjects = append(subjects, inTotoSubject{
+			Name:   filepath.Base(f),
+			Digest: map[string]string{"sha256": sum},
+		})
+	}
+
+	prov, err := b.provenance(t, start, finish)
+	if err != nil {
+		return nil, err
+	}
+	sbom, err := b.sbom(t, subjects)
+	if err != nil {
+		return nil, fmt.Errorf("generating SBOM: %w", err)
+	}
+
+	var jsonl bytes.Buffer
+	for _, st := range []inTotoStatement{
+		{Type: inTotoStatementType, Subject: subjects, PredicateType: slsaProvenanceType, Predicate: prov},
+		{Type: inTotoStatementType, Subject: subjects, PredicateType: spdxPredicateType, Predicate: sbom},
+	} {
+		env, err := b.envelope(st)
+		if err != nil {
+			return nil, err
+		}
+		jsonl.Write(env)
+		jsonl.WriteByte('\n')
+	}
+	sbomJSON, err := json.MarshalIndent(sbom, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	attestationFile, sbomFile := files[0]+attestationSuffix, files[0]+sbomSuffix
+	if err := os.WriteFile(b.outPath(attestationFile), jsonl.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(b.outPath(sbomFile), sbomJSON, 0644); err != nil {
+		return nil, err
+	}
+	return append(files, attestationFile, sbomFile), nil
+}
+
+// outPath returns the path of a Target's output f, which is relative to b.Out
+// unless absolute.
+func (b *Build) outPath(f string) string {
+	if filepath.IsAbs(f) {
+		return f
+	}
+	return filepath.Join(b.Out, f)
+}
+
+// envelope returns the JSON DSSE envelope of st, signed with
+// b.AttestationSigner if it's set.
+func (b *Build) envelope(st inTotoStatement) ([]byte, error) {
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	env := dsseEnvelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     payload,
+		Signatures:  []dsseSignature{},
+	}
+	if b.AttestationSigner != nil {
+		sig, err := b.AttestationSigner(bytes.NewReader(dssePAE(env.PayloadType, payload)))
+		if err != nil {
+			return nil, fmt.Errorf("signing attestation: %w", err)
+		}
+		env.Signatures = append(env.Signatures, dsseSignature{Sig: sig})
+	}
+	return json.Marshal(env)
+}
+
+// provenance returns the SLSA provenance of t's outputs.
+func (b *Build) provenance(t Target, start, finish time.Time) (*slsaProvenance, error) {
+	goVersion, err := b.goVersion()
+	if err != nil {
+		return nil, err
+	}
+	p := new(slsaProvenance)
+	p.BuildDefinition.BuildType = distBuildType
+	p.BuildDefinition.ExternalParameters = map[string]any{
+		"target":  t.String(),
+		"version": b.Version.Long,
+	}
+	if ct, ok := t.(CacheableTarget); ok {
+		if key, ok := ct.CacheKey(); ok {
+			p.BuildDefinition.ExternalParameters["options"] = key
+		}
+	}
+	p.BuildDefinition.InternalParameters = map[string]any{
+		"goVersion": goVersion,
+	}
+	if b.Version.GitHash != "" {
+		p.BuildDefinition.ResolvedDependencies = append(p.BuildDefinition.ResolvedDependencies, slsaResourceDigest{
+			URI:    tailscaleRepoURI,
+			Digest: map[string]string{"gitCommit": b.Version.GitHash},
+		})
+	}
+	p.RunDetails.Builder.ID = distBuilderID
+	p.RunDetails.Metadata.StartedOn = start.UTC()
+	p.RunDetails.Metadata.FinishedOn = finish.UTC()
+	return p, nil
+}
+
+// sbom returns the SPDX SBOM of t's outputs, subjects. It lists the Go
+// modules of the programs they package if t is a GoTarget.
+func (b *Build) sbom(t Target, subjects []inTotoSubject) (*spdxDocument, error) {
+	doc := &spdxDocument{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        subjects[0].Name,
+		// The namespace must be unique to this document.
+		DocumentNamespace: spdxDocumentNamespace + subjects[0].Name + "-" + subjects[0].Digest["sha256"],
+	}
+	doc.CreationInfo.Created = b.Time
+	doc.CreationInfo.Creators = []string{"Tool: tailscale-dist-" + b.Version.Short}
+
+	add := func(p spdxPackage, relationship string) {
+		p.SPDXID = fmt.Sprintf("SPDXRef-Package-%d", len(doc.Packages))
+		p.DownloadLocation = "NOASSERTION"
+		doc.Packages = append(doc.Packages, p)
+		r := spdxRelationship{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: p.SPDXID}
+		if relationship != "" {
+			r = spdxRelationship{SPDXElementID: doc.Packages[0].SPDXID, RelationshipType: relationship, RelatedSPDXElement: p.SPDXID}
+		}
+		doc.Relationships = append(doc.Relationships, r)
+	}
+	root := spdxPackage{Name: t.String(), VersionInfo: b.Version.Short}
+	for _, s := range subjects {
+		root.Checksums = append(root.Checksums, spdxChecksum{Algorithm: "SHA256", ChecksumValue: s.Digest["sha256"]})
+	}
+	add(root, "")
+
+	gt, ok := t.(GoTarget)
+	if !ok {
+		return doc, nil
+	}
+	goVersion, err := b.goVersion()
+	if err != nil {
+		return nil, err
+	}
+	add(goModulePackage(GoModule{Path: "stdlib", Version: goVersion}), "CONTAINS")
+	var mods []GoModule
+	for _, prog := range gt.GoPrograms() {
+		pmods, err := b.GoModules(prog)
+		if err != nil {
+			return nil, err
+		}
+		mods = append(mods, pmods...)
+	}
+	slices.SortFunc(mods, func(a, b GoModule) int {
+		return strings.Compare(a.Path+" "+a.Version, b.Path+" "+b.Version)
+	})
+	for _, m := range slices.Compact(mods) {
+		if m.Version == "" {
+			m.Version = b.Version.Short // the main module
+		}
+		add(goModulePackage(m), "CONTAINS")
+	}
+	return doc, nil
+}
+
+// goModulePackage returns the SPDX package of m.
+func goModulePackage(m GoModule) spdxPackage {
+	return spdxPackage{
+		Name:        m.Path,
+		VersionInfo: m.Version,
+		ExternalRefs: []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  "pkg:golang/" + m.Path + "@" + m.Version,
+		}},
+	}
+}
+
+// goVersion returns the version of b's Go toolchain, such as "go1.25.1".
+func (b *Build) goVersion() (string, error) {
+	return b.goVersionMemo.Do("go-version", func() (string, error) {
+		out, err := b.Command(b.Repo, b.Go, "env", "GOVERSION").CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("getting Go version: %v: %s", err, out)
+		}
+		return strings.TrimSpace(out), nil
+	})
+}
+
+// GoModules returns the modules that prog is built from, in the order that
+// the go command lists them. They're computed once per program per build.
+func (b *Build) GoModules(prog GoProgram) ([]GoModule, error) {
+	return b.goModules.Do([]any{"go-modules", prog.Path, prog.Env}, func() ([]GoModule, error) {
+		cmd := b.Command(b.Repo, b.Go, "list", "-deps", "-f", "{{with .Module}}{{.Path}} {{(or .Replace .).Version}}{{end}}", prog.Path)
+		for k, v := range prog.Env {
+			cmd.Cmd.Env = append(cmd.Cmd.Env, k+"="+v)
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("listing modules of %s: %v: %s", prog.Path, err, out)
+		}
+		var mods []GoModule
+		seen := map[GoModule]bool{}
+		for line := range strings.Lines(out) {
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				continue // standard library package
+			}
+			path, version, _ := strings.Cut(line, " ")
+			m := GoModule{Path: path, Version: version}
+			if !seen[m] {
+				seen[m] = true
+				mods = append(mods, m)
+			}
+		}
+		return mods, nil
+	})
+}
+
+// VerifyAttestations checks the attestations in r, as written by a Build, of
+// the artifact named name with contents artifact. verify reports whether sig
+// is a valid signature of msg by a trusted key; each attestation must have at
+// least one such signature.
+func VerifyAttestations(r io.Reader, name string, artifact io.Reader, verify func(msg, sig []byte) bool) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, artifact); err != nil {
+		return fmt.Errorf("hashing artifact: %w", err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	n := 0
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16<<20)
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		n++
+		var env dsseEnvelope
+		if err := json.Unmarshal(s.Bytes(), &env); err != nil {
+			return fmt.Errorf("attestation %d: %w", n, err)
+		}
+		if env.PayloadType != inTotoPayloadType {
+			return fmt.Errorf("attestation %d: unexpected payload type %q", n, env.PayloadType)
+		}
+		pae := dssePAE(env.PayloadType, env.Payload)
+		if !slices.ContainsFunc(env.Signatures, func(s dsseSignature) bool { return verify(pae, s.Sig) }) {
+			return fmt.Errorf("attestation %d: no valid signature", n)
+		}
+		var st inTotoStatement
+		if err := json.Unmarshal(env.Payload, &st); err != nil {
+			return fmt.Errorf("attestation %d: %w", n, err)
+		}
+		if st.Type != inTotoStatementType {
+			return fmt.Errorf("attestation %d: unexpected statement type %q", n, st.Type)
+		}
+		if !slices.ContainsFunc(st.Subject, func(s inTotoSubject) bool {
+			return s.Name == name && s.Digest["sha256"] == sum
+		}) {
+			return fmt.Errorf("attestation %d (%s) is not of %s with SHA-256 %s", n, st.PredicateType, name, sum)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("no attestations")
+	}
+	return nil
+}
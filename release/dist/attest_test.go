@@ -0,0 +1,199 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dist
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/version/mkversion"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// fakeGoToolScript is a fake Go toolchain for attestation tests. It reports
+// its version and lists the same modules for every program, including
+// duplicates and standard library packages.
+const fakeGoToolScript = `#!/bin/sh
+case "$1" in
+env) echo go1.99.1 ;;
+list) printf '\ntailscale.com \ngithub.com/example/dep v1.2.3\n\ntailscale.com \ngolang.org/x/sys v0.1.0\n' ;;
+*) exit 1 ;;
+esac
+`
+
+// fakeGoTarget is a GoTarget that packages tailscale and tailscaled.
+type fakeGoTarget struct {
+	fakeTarget
+}
+
+func (t *fakeGoTarget) GoPrograms() []GoProgram {
+	env := map[string]string{"GOOS": "linux", "GOARCH": "amd64"}
+	return []GoProgram{
+		{Path: "tailscale.com/cmd/tailscale", Env: env},
+		{Path: "tailscale.com/cmd/tailscaled", Env: env},
+	}
+}
+
+func newAttestTestBuild(t *testing.T) *Build {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the Go toolchain")
+	}
+	dir := t.TempDir()
+	goTool := filepath.Join(dir, "go")
+	writeFile(t, goTool, fakeGoToolScript)
+	if err := os.Chmod(goTool, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &Build{
+		Repo: dir,
+		Out:  filepath.Join(dir, "out"),
+		Go:   goTool,
+		Version: mkversion.VersionInfo{
+			Short:   "1.2.3",
+			Long:    "1.2.3-t0123456789a",
+			GitHash: "0123456789abcdef0123456789abcdef01234567",
+		},
+		Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestAttestGolden(t *testing.T) {
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	signer := Signer(func(r io.Reader) ([]byte, error) {
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.Sign(priv, msg), nil
+	})
+
+	tests := []struct {
+		name   string
+		target Target
+		signer Signer
+	}{
+		{
+			name:   "go-target",
+			target: &fakeGoTarget{fakeTarget{name: "tgz/amd64", key: map[string]string{"GOOS": "linux", "GOARCH": "amd64"}, ok: true}},
+			signer: signer,
+		},
+		{
+			name:   "plain-target-unsigned",
+			target: &fakeTarget{name: "qnap/x86_64", key: "x86_64", ok: true},
+		},
+		{
+			name:   "uncacheable-target",
+			target: &fakeTarget{name: "rpm/amd64", ok: false},
+			signer: signer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newAttestTestBuild(t)
+			b.AttestationSigner = tt.signer
+			files, err := tt.target.Build(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			files, err = b.attest(tt.target, files, start, start.Add(90*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := tt.target.String() + ".out"
+			if want := []string{out, out + attestationSuffix, out + sbomSuffix}; !slices.Equal(files, want) {
+				t.Fatalf("files = %q; want %q", files, want)
+			}
+
+			jsonl, err := os.ReadFile(filepath.Join(b.Out, out+attestationSuffix))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name+".intoto.json", decodeStatements(t, jsonl))
+			sbom, err := os.ReadFile(filepath.Join(b.Out, out+sbomSuffix))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name+sbomSuffix, sbom)
+
+			if tt.signer == nil {
+				return
+			}
+			verify := func(msg, sig []byte) bool {
+				return ed25519.Verify(priv.Public().(ed25519.PublicKey), msg, sig)
+			}
+			artifact, err := os.ReadFile(filepath.Join(b.Out, out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyAttestations(bytes.NewReader(jsonl), filepath.Base(out), bytes.NewReader(artifact), verify); err != nil {
+				t.Errorf("VerifyAttestations: %v", err)
+			}
+			if err := VerifyAttestations(bytes.NewReader(jsonl), filepath.Base(out), strings.NewReader("tampered"), verify); err == nil {
+				t.Error("VerifyAttestations of a different artifact succeeded")
+			}
+		})
+	}
+}
+
+// decodeStatements returns the in-toto statements in the DSSE envelopes of
+// jsonl as indented JSON, so that golden files are readable. It fails t if
+// the envelopes are malformed.
+func decodeStatements(t *testing.T, jsonl []byte) []byte {
+	t.Helper()
+	var statements []json.RawMessage
+	s := bufio.NewScanner(bytes.NewReader(jsonl))
+	for s.Scan() {
+		var env dsseEnvelope
+		if err := json.Unmarshal(s.Bytes(), &env); err != nil {
+			t.Fatalf("parsing envelope: %v", err)
+		}
+		if env.PayloadType != inTotoPayloadType {
+			t.Errorf("payload type = %q; want %q", env.PayloadType, inTotoPayloadType)
+		}
+		statements = append(statements, env.Payload)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	j, err := json.MarshalIndent(statements, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// checkGolden compares got to the contents of testdata/name, or updates the
+// file if the -update flag is set.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	got = append(bytes.TrimSpace(got), '\n')
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s mismatch (run with -update to update it)\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
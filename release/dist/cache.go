@@ -0,0 +1,262 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A CacheableTarget is a Target whose outputs are determined entirely by the
+// repo's source tree, the Go toolchain, the build's version and its own
+// CacheKey. When the Build has a CacheDir, the outputs of such targets are
+// kept there and reused by later builds with the same inputs.
+type CacheableTarget interface {
+	Target
+	// CacheKey returns the target's packaging inputs that aren't files in
+	// the repo, such as its Go environment and packaging options. It must
+	// be JSON-marshalable. If ok is false, the target's outputs depend on
+	// something else (a signing key, say) and the target isn't cached.
+	CacheKey() (key any, ok bool)
+}
+
+// cacheManifestName is the name of the file in each cache entry that lists
+// the entry's files and their hashes.
+const cacheManifestName = "manifest.json"
+
+// cacheManifest describes a cache entry.
+type cacheManifest struct {
+	Files []cacheFile
+}
+
+// cacheFile is a file in a cache entry.
+type cacheFile struct {
+	Name   string // path relative to Build.Out
+	Abs    bool   // whether the Target returned it as an absolute path
+	SHA256 string // hex hash of the file's contents
+}
+
+// cacheInputs returns a hash of the inputs shared by all targets of b: the
+// source tree, the Go toolchain and the version being built. It's computed
+// once per build.
+func (b *Build) cacheInputs() (string, error) {
+	return b.cacheInputsMemo.Do("cache-inputs", func() (string, error) {
+		h := sha256.New()
+		goVersion, err := b.Command(b.Repo, b.Go, "version").CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("getting Go version: %w", err)
+		}
+		fmt.Fprintf(h, "go: %s\n", strings.TrimSpace(goVersion))
+		fmt.Fprintf(h, "web-client: %v\n", b.WebClientSource != "")
+		if err := json.NewEncoder(h).Encode(b.Version); err != nil {
+			return "", err
+		}
+		if err := b.hashSourceTree(h); err != nil {
+			return "", fmt.Errorf("hashing source tree: %w", err)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	})
+}
+
+// hashSourceTree writes the names and contents of all files in b.Repo that
+// aren't ignored by git to h.
+func (b *Build) hashSourceTree(h io.Writer) error {
+	out, err := b.Command(b.Repo, "git", "ls-files", "-z", "--cached", "--others", "--exclude-standard").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("listing files: %v: %s", err, out)
+	}
+	for name := range strings.SplitSeq(out, "\x00") {
+		if name == "" {
+			continue
+		}
+		sum, err := hashFile(filepath.Join(b.Repo, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // deleted but not yet staged
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %s\n", sum, name)
+	}
+	return nil
+}
+
+// cacheKey returns the cache key of t, or ok false if t isn't cacheable.
+func (b *Build) cacheKey(t Target) (key string, ok bool, err error) {
+	ct, isCacheable := t.(CacheableTarget)
+	if !isCacheable {
+		return "", false, nil
+	}
+	tkey, ok := ct.CacheKey()
+	if !ok {
+		return "", false, nil
+	}
+	inputs, err := b.cacheInputs()
+	if err != nil {
+		return "", false, err
+	}
+	tj, err := json.Marshal(tkey)
+	if err != nil {
+		return "", false, fmt.Errorf("marshaling cache key: %w", err)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", inputs, t, tj)
+	return hex.EncodeToString(h.Sum(nil)), true, nil
+}
+
+// buildTarget builds t, reusing its outputs from b.CacheDir if possible.
+func (b *Build) buildTarget(t Target) ([]string, error) {
+	if b.CacheDir == "" {
+		return t.Build(b)
+	}
+	key, ok, err := b.cacheKey(t)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return t.Build(b)
+	}
+	dir := filepath.Join(b.CacheDir, key)
+	if files, err := b.restoreFromCache(dir); err == nil {
+		log.Printf("%s: using cached build %s", t, key[:12])
+		return files, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s: discarding cached build %s: %v", t, key[:12], err)
+		os.RemoveAll(dir)
+	}
+
+	files, err := t.Build(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.storeInCache(dir, files); err != nil {
+		log.Printf("%s: not caching build: %v", t, err)
+	}
+	return files, nil
+}
+
+// restoreFromCache verifies the cache entry in dir and copies its files to
+// b.Out, returning their paths as the Target returned them. It returns an
+// error wrapping os.ErrNotExist if there's no entry.
+func (b *Build) restoreFromCache(dir string) ([]string, error) {
+	mj, err := os.ReadFile(filepath.Join(dir, cacheManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var m cacheManifest
+	if err := json.Unmarshal(mj, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	for _, f := range m.Files {
+		sum, err := hashFile(filepath.Join(dir, f.Name))
+		if err != nil {
+			return nil, fmt.Errorf("verifying: %w", err)
+		}
+		if sum != f.SHA256 {
+			return nil, fmt.Errorf("verifying %s: hash mismatch", f.Name)
+		}
+	}
+	var files []string
+	for _, f := range m.Files {
+		dst := filepath.Join(b.Out, f.Name)
+		if err := copyFile(filepath.Join(dir, f.Name), dst); err != nil {
+			return nil, fmt.Errorf("restoring: %w", err)
+		}
+		if f.Abs {
+			files = append(files, dst)
+		} else {
+			files = append(files, f.Name)
+		}
+	}
+	return files, nil
+}
+
+// storeInCache copies files, as returned by a Target, into a new cache entry
+// in dir.
+func (b *Build) storeInCache(dir string, files []string) error {
+	var m cacheManifest
+	for _, name := range files {
+		f := cacheFile{Name: name, Abs: filepath.IsAbs(name)}
+		if f.Abs {
+			rel, err := filepath.Rel(b.Out, name)
+			if err != nil || !filepath.IsLocal(rel) {
+				return fmt.Errorf("%s is outside the output directory", name)
+			}
+			f.Name = rel
+		}
+		m.Files = append(m.Files, f)
+	}
+
+	// Build the entry in a temporary directory and rename it into place, so
+	// that concurrent or interrupted builds never leave a partial entry.
+	if err := os.MkdirAll(b.CacheDir, 0750); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(b.CacheDir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	for i, f := range m.Files {
+		dst := filepath.Join(tmp, f.Name)
+		if err := copyFile(filepath.Join(b.Out, f.Name), dst); err != nil {
+			return err
+		}
+		if m.Files[i].SHA256, err = hashFile(dst); err != nil {
+			return err
+		}
+	}
+	mj, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, cacheManifestName), mj, 0644); err != nil {
+		return err
+	}
+	os.RemoveAll(dir)
+	return os.Rename(tmp, dir)
+}
+
+// hashFile returns the hex SHA-256 hash of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFile copies the file at src to dst, creating dst's directory if needed.
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
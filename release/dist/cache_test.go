@@ -0,0 +1,242 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dist
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"tailscale.com/version/mkversion"
+)
+
+// fakeTarget is a CacheableTarget that writes a single file.
+type fakeTarget struct {
+	name   string
+	key    any
+	ok     bool
+	builds int
+}
+
+func (t *fakeTarget) String() string        { return t.name }
+func (t *fakeTarget) CacheKey() (any, bool) { return t.key, t.ok }
+func (t *fakeTarget) Build(b *Build) ([]string, error) {
+	t.builds++
+	name := t.name + ".out"
+	path := filepath.Join(b.Out, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return []string{name}, os.WriteFile(path, []byte(t.name), 0644)
+}
+
+// newCacheTestBuild returns a Build of a new git repo containing a committed
+// main.go and a .gitignore ignoring *.log, using a fake Go toolchain that
+// reports goVersion.
+func newCacheTestBuild(t *testing.T, goVersion string) *Build {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the Go toolchain")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	writeFile(t, filepath.Join(repo, "main.go"), "package main\n")
+	writeFile(t, filepath.Join(repo, ".gitignore"), "*.log\n")
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	goTool := filepath.Join(dir, "go")
+	writeFile(t, goTool, "#!/bin/sh\necho go version "+goVersion+" linux/amd64\n")
+	if err := os.Chmod(goTool, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &Build{
+		Repo:    repo,
+		Out:     filepath.Join(dir, "out"),
+		Go:      goTool,
+		Version: mkversion.VersionInfo{Short: "1.2.3"},
+	}
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustCacheKey(t *testing.T, b *Build, tgt Target) string {
+	t.Helper()
+	key, ok, err := b.cacheKey(tgt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("%v not cacheable", tgt)
+	}
+	return key
+}
+
+func TestCacheKey(t *testing.T) {
+	base := mustCacheKey(t, newCacheTestBuild(t, "go1.99"), &fakeTarget{name: "tgz/amd64", key: "amd64", ok: true})
+
+	tests := []struct {
+		name        string
+		goVersion   string                       // if empty, go1.99
+		modify      func(t *testing.T, b *Build) // changes b's inputs
+		target      *fakeTarget                  // if nil, the base target
+		wantChanged bool
+	}{
+		{
+			name:        "same-inputs",
+			wantChanged: false,
+		},
+		{
+			name: "edit-tracked-file",
+			modify: func(t *testing.T, b *Build) {
+				writeFile(t, filepath.Join(b.Repo, "main.go"), "package main\n\nfunc main() {}\n")
+			},
+			wantChanged: true,
+		},
+		{
+			name: "add-untracked-file",
+			modify: func(t *testing.T, b *Build) {
+				writeFile(t, filepath.Join(b.Repo, "new.go"), "package main\n")
+			},
+			wantChanged: true,
+		},
+		{
+			name: "add-ignored-file",
+			modify: func(t *testing.T, b *Build) {
+				writeFile(t, filepath.Join(b.Repo, "build.log"), "noise\n")
+			},
+			wantChanged: false,
+		},
+		{
+			name: "delete-tracked-file",
+			modify: func(t *testing.T, b *Build) {
+				if err := os.Remove(filepath.Join(b.Repo, "main.go")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantChanged: true,
+		},
+		{
+			name:        "go-version",
+			goVersion:   "go1.100",
+			wantChanged: true,
+		},
+		{
+			name: "version",
+			modify: func(t *testing.T, b *Build) {
+				b.Version.Short = "1.2.4"
+			},
+			wantChanged: true,
+		},
+		{
+			name: "web-client",
+			modify: func(t *testing.T, b *Build) {
+				b.WebClientSource = "/src/web"
+			},
+			wantChanged: true,
+		},
+		{
+			name:        "target-name",
+			target:      &fakeTarget{name: "tgz/arm64", key: "amd64", ok: true},
+			wantChanged: true,
+		},
+		{
+			name:        "target-key",
+			target:      &fakeTarget{name: "tgz/amd64", key: "arm64", ok: true},
+			wantChanged: true,
+		},
+		{
+			name: "unrelated-build-fields",
+			modify: func(t *testing.T, b *Build) {
+				b.Out = t.TempDir()
+				b.Verbose = true
+				b.Attest = true
+			},
+			wantChanged: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goVersion := tt.goVersion
+			if goVersion == "" {
+				goVersion = "go1.99"
+			}
+			b := newCacheTestBuild(t, goVersion)
+			if tt.modify != nil {
+				tt.modify(t, b)
+			}
+			tgt := tt.target
+			if tgt == nil {
+				tgt = &fakeTarget{name: "tgz/amd64", key: "amd64", ok: true}
+			}
+			got := mustCacheKey(t, b, tgt)
+			if changed := got != base; changed != tt.wantChanged {
+				t.Errorf("key changed = %v; want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestCacheKeyNotCacheable(t *testing.T) {
+	b := newCacheTestBuild(t, "go1.99")
+	for _, tgt := range []Target{
+		&fakeTarget{name: "signed", key: "amd64", ok: false},
+		notCacheableTarget{},
+	} {
+		if _, ok, err := b.cacheKey(tgt); err != nil || ok {
+			t.Errorf("cacheKey(%v) = ok %v, err %v; want not cacheable", tgt, ok, err)
+		}
+	}
+}
+
+type notCacheableTarget struct{}
+
+func (notCacheableTarget) String() string                 { return "plain" }
+func (notCacheableTarget) Build(*Build) ([]string, error) { return nil, nil }
+
+func TestBuildTargetReusesCache(t *testing.T) {
+	b := newCacheTestBuild(t, "go1.99")
+	b.CacheDir = t.TempDir()
+	tgt := &fakeTarget{name: "tgz/amd64", key: "amd64", ok: true}
+	for range 2 {
+		files, err := b.buildTarget(tgt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 || files[0] != "tgz/amd64.out" {
+			t.Fatalf("files = %q; want [tgz/amd64.out]", files)
+		}
+		path := filepath.Join(b.Out, files[0])
+		if got, err := os.ReadFile(path); err != nil || string(got) != "tgz/amd64" {
+			t.Fatalf("output = %q, %v; want %q", got, err, "tgz/amd64")
+		}
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tgt.builds != 1 {
+		t.Errorf("target built %d times; want 1", tgt.builds)
+	}
+}
@@ -5,6 +5,8 @@
 package cli
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/binary"
 	"errors"
@@ -66,6 +68,10 @@ func CLI(getTargets func() ([]dist.Target, error)) *ffcli.Command {
 					fs.BoolVar(&buildArgs.verbose, "verbose", false, "verbose logging")
 					fs.StringVar(&buildArgs.webClientRoot, "web-client-root", "", "path to root of web client source to build")
 					fs.StringVar(&buildArgs.outPath, "out", "", "path to write output artifacts (defaults to '$PWD/dist' if not set)")
+					fs.StringVar(&buildArgs.cacheDir, "cache-dir", "", "path to cache unsigned build artifacts in, keyed by their inputs (defaults to a tailscale-dist directory in the user cache directory)")
+					fs.BoolVar(&buildArgs.noCache, "no-cache", false, "build all targets, without reading or writing the build cache")
+					fs.BoolVar(&buildArgs.attest, "attest", false, "write SLSA provenance attestations and SPDX SBOMs of each target's outputs alongside them")
+					fs.StringVar(&buildArgs.attestKey, "attest-signing-key", "", "path to a signing private key to sign attestations with (implies --attest)")
 					return fs
 				})(),
 				LongHelp: strings.TrimSpace(`
@@ -134,6 +140,21 @@ func CLI(getTargets func() ([]dist.Target, error)) *ffcli.Command {
 					return fs
 				})(),
 			},
+			{
+				Name: "verify-attestation",
+				Exec: func(ctx context.Context, args []string) error {
+					return runVerifyAttestation(ctx)
+				},
+				ShortUsage: "dist verify-attestation",
+				ShortHelp:  "Verify a package's attestations using a signing key",
+				FlagSet: (func() *flag.FlagSet {
+					fs := flag.NewFlagSet("verify-attestation", flag.ExitOnError)
+					fs.StringVar(&verifyAttestationArgs.signPubPath, "sign-pub-path", "signing-public-key.pem", "path to the signing public key; this can be a bundle of multiple keys")
+					fs.StringVar(&verifyAttestationArgs.packagePath, "package-path", "", "path to the package that was attested")
+					fs.StringVar(&verifyAttestationArgs.attestationPath, "attestation-path", "", "path to the attestations file (defaults to the package path plus \".intoto.jsonl\")")
+					return fs
+				})(),
+			},
 		},
 		Exec: func(context.Context, []string) error { return flag.ErrHelp },
 	}
@@ -158,6 +179,10 @@ func runList(ctx context.Context, filters []string, targets []dist.Target) error
 	verbose       bool
 	webClientRoot string
 	outPath       string
+	cacheDir      string
+	noCache       bool
+	attest        bool
+	attestKey     string
 }
 
 func runBuild(ctx context.Context, filters []string, targets []dist.Target) error {
@@ -185,6 +210,32 @@ func runBuild(ctx context.Context, filters []string, targets []dist.Target) erro
 	defer b.Close()
 	b.Verbose = buildArgs.verbose
 	b.WebClientSource = buildArgs.webClientRoot
+	b.Attest = buildArgs.attest || buildArgs.attestKey != ""
+	if buildArgs.attestKey != "" {
+		skRaw, err := os.ReadFile(buildArgs.attestKey)
+		if err != nil {
+			return err
+		}
+		sk, err := distsign.ParseSigningKey(skRaw)
+		if err != nil {
+			return fmt.Errorf("parsing %q: %w", buildArgs.attestKey, err)
+		}
+		b.AttestationSigner = func(r io.Reader) ([]byte, error) {
+			h := distsign.NewPackageHash()
+			if _, err := io.Copy(h, r); err != nil {
+				return nil, err
+			}
+			return sk.SignPackageHash(h.Sum(nil), h.Len())
+		}
+	}
+	if !buildArgs.noCache {
+		b.CacheDir = buildArgs.cacheDir
+		if b.CacheDir == "" {
+			if dir, err := os.UserCacheDir(); err == nil {
+				b.CacheDir = filepath.Join(dir, "tailscale-dist")
+			}
+		}
+	}
 
 	out, err := b.Build(tgts)
 	if err != nil {
@@ -334,11 +385,10 @@ func runVerifyPackageSignature(ctx context.Context) error {
 		return err
 	}
 	defer pkg.Close()
-	pkgHash := distsign.NewPackageHash()
-	if _, err := io.Copy(pkgHash, pkg); err != nil {
+	hash, err := packageHash(pkg)
+	if err != nil {
 		return fmt.Errorf("reading %q: %w", args.packagePath, err)
 	}
-	hash := binary.LittleEndian.AppendUint64(pkgHash.Sum(nil), uint64(pkgHash.Len()))
 	sig, err := os.ReadFile(args.sigPath)
 	if err != nil {
 		return err
@@ -349,3 +399,53 @@ func runVerifyPackageSignature(ctx context.Context) error {
 	fmt.Println("signature ok")
 	return nil
 }
+
+var verifyAttestationArgs struct {
+	signPubPath     string
+	packagePath     string
+	attestationPath string
+}
+
+func runVerifyAttestation(ctx context.Context) error {
+	args := verifyAttestationArgs
+	if args.packagePath == "" {
+		return errors.New("--package-path must be set")
+	}
+	attestationPath := cmp.Or(args.attestationPath, args.packagePath+".intoto.jsonl")
+	signPubBundle, err := os.ReadFile(args.signPubPath)
+	if err != nil {
+		return err
+	}
+	signPubs, err := distsign.ParseSigningKeyBundle(signPubBundle)
+	if err != nil {
+		return fmt.Errorf("parsing %q: %w", args.signPubPath, err)
+	}
+	pkg, err := os.Open(args.packagePath)
+	if err != nil {
+		return err
+	}
+	defer pkg.Close()
+	attestations, err := os.Open(attestationPath)
+	if err != nil {
+		return err
+	}
+	defer attestations.Close()
+	verify := func(msg, sig []byte) bool {
+		hash, err := packageHash(bytes.NewReader(msg))
+		return err == nil && distsign.VerifyAny(signPubs, hash, sig)
+	}
+	if err := dist.VerifyAttestations(attestations, filepath.Base(args.packagePath), pkg, verify); err != nil {
+		return err
+	}
+	fmt.Println("attestations ok")
+	return nil
+}
+
+// packageHash returns the hash of r's contents that signing keys sign.
+func packageHash(r io.Reader) ([]byte, error) {
+	h := distsign.NewPackageHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return binary.LittleEndian.AppendUint64(h.Sum(nil), uint64(h.Len())), nil
+}
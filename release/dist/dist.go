@@ -59,6 +59,14 @@ type Build struct {
 	// WebClientSource is a path to the source for the web client.
 	// If non-empty, web client assets will be built.
 	WebClientSource string
+	// CacheDir is where the outputs of CacheableTargets are cached across
+	// builds. If empty, all targets are always built.
+	CacheDir string
+	// Attest is whether to write provenance attestations and SBOMs of
+	// targets' outputs alongside them.
+	Attest bool
+	// AttestationSigner, if non-nil, signs the attestations.
+	AttestationSigner Signer
 
 	// Tmp is a temporary directory that gets deleted when the Builder is closed.
 	Tmp string
@@ -78,7 +86,10 @@ type Build struct {
 	extraMu sync.Mutex
 	extra   map[any]any
 
-	goBuilds Memoize[string]
+	goBuilds        Memoize[string]
+	cacheInputsMemo Memoize[string]
+	goVersionMemo   Memoize[string]
+	goModules       Memoize[[]GoModule]
 	// When running `dist build all` on a cold Go build cache, the fanout of
 	// gooses and goarches results in a very large number of compile processes,
 	// which bogs down the build machine.
@@ -164,7 +175,11 @@ func (b *Build) Build(targets []Target) (files []string, err error) {
 				errs[i] = err
 				wg.Done()
 			}()
-			fs, err := t.Build(b)
+			start := time.Now()
+			fs, err := b.buildTarget(t)
+			if err == nil && b.Attest {
+				fs, err = b.attest(t, fs, start, time.Now())
+			}
 			buildFiles[i] = fs
 		}(i, t)
 	}
@@ -23,7 +23,11 @@ case "$1" in
           exit 0
         fi
     fi
-    ${QPKG_ROOT}/tailscaled --port ${QPKG_PORT} --statedir=${QPKG_ROOT}/state --socket=/tmp/tailscale/tailscaled.sock 2> /dev/null &
+    TUN_FLAG=""
+    if [ -e ${QPKG_ROOT}/outbound-only ]; then
+        TUN_FLAG="--tun=userspace-networking"
+    fi
+    ${QPKG_ROOT}/tailscaled --port ${QPKG_PORT} --statedir=${QPKG_ROOT}/state --socket=/tmp/tailscale/tailscaled.sock ${TUN_FLAG} 2> /dev/null &
     echo $! > /tmp/tailscale/tailscaled.pid
     ;;
 
@@ -13,7 +13,11 @@ trap cleanup EXIT
 mkdir -p /Tailscale/$ARCH
 cp /tailscaled /Tailscale/$ARCH/tailscaled
 cp /tailscale /Tailscale/$ARCH/tailscale
+if [ "${OUTBOUND_ONLY:-0}" = "1" ]; then
+	touch /Tailscale/$ARCH/outbound-only
+fi
 
-sed "s/\$QPKG_VER/$TSTAG-$QNAPTAG/g" /Tailscale/qpkg.cfg.in >/Tailscale/qpkg.cfg
+# qpkg.cfg is generated by the Go target builder.
+cp /qpkg.cfg /Tailscale/qpkg.cfg
 
 qbuild --root /Tailscale --build-arch $ARCH --build-dir /out
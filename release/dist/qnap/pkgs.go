@@ -21,9 +21,12 @@
 )
 
 type target struct {
-	goenv  map[string]string
-	arch   string
-	signer *signer
+	goenv map[string]string
+	arch  string
+	// outboundOnly is whether the package runs tailscaled in
+	// userspace-networking mode, without a TUN device.
+	outboundOnly bool
+	signer       *signer
 }
 
 type signer struct {
@@ -36,9 +39,29 @@ type signer struct {
 }
 
 func (t *target) String() string {
+	if t.outboundOnly {
+		return fmt.Sprintf("qnap/%s/outbound-only", t.arch)
+	}
 	return fmt.Sprintf("qnap/%s", t.arch)
 }
 
+// CacheKey implements [dist.CacheableTarget]. Signed packages aren't cached.
+func (t *target) CacheKey() (any, bool) {
+	return struct {
+		GoEnv        map[string]string
+		Arch         string
+		OutboundOnly bool
+	}{t.goenv, t.arch, t.outboundOnly}, t.signer == nil
+}
+
+// GoPrograms implements [dist.GoTarget].
+func (t *target) GoPrograms() []dist.GoProgram {
+	return []dist.GoProgram{
+		{Path: "tailscale.com/cmd/tailscale", Env: t.goenv},
+		{Path: "tailscale.com/cmd/tailscaled", Env: t.goenv},
+	}
+}
+
 func (t *target) Build(b *dist.Build) ([]string, error) {
 	// Stop early if we don't have docker running.
 	if _, err := exec.LookPath("docker"); err != nil {
@@ -67,20 +90,40 @@ func (t *target) buildQPKG(b *dist.Build, qnapBuilds *qnapBuilds, inner *innerPk
 		return nil, fmt.Errorf("makeDockerImage: %w", err)
 	}
 
+	// qbuild names its output after the package name, version and arch,
+	// so outbound-only packages go in their own directory.
+	outDir := b.Out
+	if t.outboundOnly {
+		outDir = filepath.Join(b.Out, "outbound-only")
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return nil, err
+		}
+	}
 	filename := fmt.Sprintf("Tailscale_%s-%s_%s.qpkg", b.Version.Short, qnapTag, t.arch)
-	filePath := filepath.Join(b.Out, filename)
+	filePath := filepath.Join(outDir, filename)
+
+	cfgPath, err := t.writeQPKGConfig(b, filepath.Join(qnapBuilds.tmpDir, "qpkg-cfg"))
+	if err != nil {
+		return nil, fmt.Errorf("writeQPKGConfig: %w", err)
+	}
+	outboundOnly := "0"
+	if t.outboundOnly {
+		outboundOnly = "1"
+	}
 
 	args := []string{"run", "--rm",
 		"--network=host",
 		"-e", fmt.Sprintf("ARCH=%s", t.arch),
 		"-e", fmt.Sprintf("TSTAG=%s", b.Version.Short),
 		"-e", fmt.Sprintf("QNAPTAG=%s", qnapTag),
+		"-e", fmt.Sprintf("OUTBOUND_ONLY=%s", outboundOnly),
 		"-v", fmt.Sprintf("%s:/tailscale", inner.tailscalePath),
 		"-v", fmt.Sprintf("%s:/tailscaled", inner.tailscaledPath),
 		// Tailscale folder has QNAP package setup files needed for building.
 		"-v", fmt.Sprintf("%s:/Tailscale", filepath.Join(qnapBuilds.tmpDir, "files/Tailscale")),
 		"-v", fmt.Sprintf("%s:/build-qpkg.sh", filepath.Join(qnapBuilds.tmpDir, "files/scripts/build-qpkg.sh")),
-		"-v", fmt.Sprintf("%s:/out", b.Out),
+		"-v", fmt.Sprintf("%s:/qpkg.cfg", cfgPath),
+		"-v", fmt.Sprintf("%s:/out", outDir),
 	}
 
 	if t.signer != nil {
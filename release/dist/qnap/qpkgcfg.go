@@ -0,0 +1,52 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package qnap
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"tailscale.com/release/dist"
+)
+
+// mkQPKGConfig returns the contents of the qpkg.cfg file that qbuild
+// reads when building t, derived from files/Tailscale/qpkg.cfg.in.
+//
+// Outbound-only builds run tailscaled in userspace-networking mode and
+// say so in the package summary shown by the QTS App Center.
+func (t *target) mkQPKGConfig(b *dist.Build) ([]byte, error) {
+	tmpl, err := fs.ReadFile(buildFiles, "files/Tailscale/qpkg.cfg.in")
+	if err != nil {
+		return nil, err
+	}
+	ver := fmt.Sprintf("%s-%s", b.Version.Short, qnapTag)
+	cfg := bytes.ReplaceAll(tmpl, []byte("$QPKG_VER"), []byte(ver))
+	if t.outboundOnly {
+		cfg = append(cfg, "\n# Outbound-only build: tailscaled runs in userspace-networking mode.\nQPKG_SUMMARY=\"Tailscale (outbound-only, no TUN device)\"\n"...)
+	}
+	return cfg, nil
+}
+
+// writeQPKGConfig writes the qpkg.cfg for t into dir and returns its path.
+func (t *target) writeQPKGConfig(b *dist.Build, dir string) (string, error) {
+	cfg, err := t.mkQPKGConfig(b)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := t.arch + ".cfg"
+	if t.outboundOnly {
+		name = t.arch + "-outbound-only.cfg"
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, cfg, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
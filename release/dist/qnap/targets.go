@@ -18,7 +18,10 @@
 // gcloudKeyring is the full path to the Google Cloud keyring containing the signing key.
 // keyName is the name of the key.
 // certificateBase64 is the PEM certificate to use in the signature, base64 encoded.
-func Targets(gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, certificateBase64, certificateIntermediariesBase64 string) []dist.Target {
+//
+// If outboundOnly is set, the packages run tailscaled in
+// userspace-networking mode and never touch the TUN device.
+func Targets(outboundOnly bool, gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, certificateBase64, certificateIntermediariesBase64 string) []dist.Target {
 	var signerInfo *signer
 	if !slices.Contains([]string{gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, certificateBase64, certificateIntermediariesBase64}, "") {
 		signerInfo = &signer{
@@ -37,7 +40,8 @@ func Targets(gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, cer
 				"GOOS":   "linux",
 				"GOARCH": "386",
 			},
-			signer: signerInfo,
+			outboundOnly: outboundOnly,
+			signer:       signerInfo,
 		},
 		&target{
 			arch: "x86_ce53xx",
@@ -45,7 +49,8 @@ func Targets(gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, cer
 				"GOOS":   "linux",
 				"GOARCH": "386",
 			},
-			signer: signerInfo,
+			outboundOnly: outboundOnly,
+			signer:       signerInfo,
 		},
 		&target{
 			arch: "x86_64",
@@ -53,7 +58,8 @@ func Targets(gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, cer
 				"GOOS":   "linux",
 				"GOARCH": "amd64",
 			},
-			signer: signerInfo,
+			outboundOnly: outboundOnly,
+			signer:       signerInfo,
 		},
 		&target{
 			arch: "arm-x31",
@@ -61,7 +67,8 @@ func Targets(gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, cer
 				"GOOS":   "linux",
 				"GOARCH": "arm",
 			},
-			signer: signerInfo,
+			outboundOnly: outboundOnly,
+			signer:       signerInfo,
 		},
 		&target{
 			arch: "arm-x41",
@@ -69,7 +76,8 @@ func Targets(gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, cer
 				"GOOS":   "linux",
 				"GOARCH": "arm",
 			},
-			signer: signerInfo,
+			outboundOnly: outboundOnly,
+			signer:       signerInfo,
 		},
 		&target{
 			arch: "arm-x19",
@@ -77,7 +85,8 @@ func Targets(gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, cer
 				"GOOS":   "linux",
 				"GOARCH": "arm",
 			},
-			signer: signerInfo,
+			outboundOnly: outboundOnly,
+			signer:       signerInfo,
 		},
 		&target{
 			arch: "arm_64",
@@ -85,7 +94,8 @@ func Targets(gcloudCredentialsBase64, gcloudProject, gcloudKeyring, keyName, cer
 				"GOOS":   "linux",
 				"GOARCH": "arm64",
 			},
-			signer: signerInfo,
+			outboundOnly: outboundOnly,
+			signer:       signerInfo,
 		},
 	}
 }
@@ -27,15 +27,41 @@ type target struct {
 	dsmMinorVersion int
 	goenv           map[string]string
 	packageCenter   bool
-	signer          dist.Signer
+	// outboundOnly is whether the package is built to only run
+	// tailscaled in userspace-networking mode, without a TUN device.
+	outboundOnly bool
+	signer       dist.Signer
 }
 
 func (t *target) String() string {
+	if t.outboundOnly {
+		return fmt.Sprintf("synology/dsm%s/%s/outbound-only", t.dsmVersionString(), t.filenameArch)
+	}
 	return fmt.Sprintf("synology/dsm%s/%s", t.dsmVersionString(), t.filenameArch)
 }
 
+// CacheKey implements [dist.CacheableTarget]. Signed packages aren't cached.
+func (t *target) CacheKey() (any, bool) {
+	return struct {
+		FilenameArch    string
+		DSMMajorVersion int
+		DSMMinorVersion int
+		GoEnv           map[string]string
+		PackageCenter   bool
+		OutboundOnly    bool
+	}{t.filenameArch, t.dsmMajorVersion, t.dsmMinorVersion, t.goenv, t.packageCenter, t.outboundOnly}, t.signer == nil
+}
+
+// GoPrograms implements [dist.GoTarget].
+func (t *target) GoPrograms() []dist.GoProgram {
+	return []dist.GoProgram{
+		{Path: "tailscale.com/cmd/tailscale", Env: t.goenv},
+		{Path: "tailscale.com/cmd/tailscaled", Env: t.goenv},
+	}
+}
+
 func (t *target) Build(b *dist.Build) ([]string, error) {
-	inner, err := getSynologyBuilds(b).buildInnerPackage(b, t.dsmMajorVersion, t.goenv)
+	inner, err := getSynologyBuilds(b).buildInnerPackage(b, t.dsmMajorVersion, t.outboundOnly, t.goenv)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +93,11 @@ func (t *target) dsmVersionString() string {
 
 func (t *target) buildSPK(b *dist.Build, inner *innerPkg) ([]string, error) {
 	synoVersion := b.Version.Synology[t.dsmVersionInt()]
-	filename := fmt.Sprintf("tailscale-%s-%s-%d-dsm%s.spk", t.filenameArch, b.Version.Short, synoVersion, t.dsmVersionString())
+	var variant string
+	if t.outboundOnly {
+		variant = "-outbound-only"
+	}
+	filename := fmt.Sprintf("tailscale-%s-%s-%d-dsm%s%s.spk", t.filenameArch, b.Version.Short, synoVersion, t.dsmVersionString(), variant)
 	out := filepath.Join(b.Out, filename)
 	if t.packageCenter {
 		log.Printf("Building %s (for package center)", filename)
@@ -83,9 +113,9 @@ func (t *target) buildSPK(b *dist.Build, inner *innerPkg) ([]string, error) {
 		return nil, errors.New("syno version exceeds int32 range")
 	}
 
-	privFile := fmt.Sprintf("privilege-dsm%d", t.dsmMajorVersion)
-	if t.packageCenter && t.dsmMajorVersion == 7 {
-		privFile += ".for-package-center"
+	priv, err := t.mkPrivilege()
+	if err != nil {
+		return nil, err
 	}
 
 	f, err := os.Create(out)
@@ -103,7 +133,7 @@ func (t *target) buildSPK(b *dist.Build, inner *innerPkg) ([]string, error) {
 		static("Tailscale.sc", "Tailscale.sc", 0644),
 		dir("conf"),
 		static("resource", "conf/resource", 0644),
-		static(privFile, "conf/privilege", 0644),
+		memFile("conf/privilege", priv, 0644),
 		file(inner.path, "package.tgz", 0644),
 		dir("scripts"),
 		static("scripts/start-stop-status", "scripts/start-stop-status", 0644),
@@ -198,8 +228,12 @@ func getSynologyBuilds(b *dist.Build) *synologyBuilds {
 // buildInnerPackage builds the inner tarball for synology packages,
 // which contains the files to unpack to disk on installation (as
 // opposed to the outer tarball, which contains package metadata)
-func (m *synologyBuilds) buildInnerPackage(b *dist.Build, dsmVersion int, goenv map[string]string) (*innerPkg, error) {
-	key := []any{dsmVersion, goenv}
+//
+// If outboundOnly is set, the package includes a conf/outbound-only
+// marker that makes the start script run tailscaled in
+// userspace-networking mode.
+func (m *synologyBuilds) buildInnerPackage(b *dist.Build, dsmVersion int, outboundOnly bool, goenv map[string]string) (*innerPkg, error) {
+	key := []any{dsmVersion, outboundOnly, goenv}
 	return m.innerPkgs.Do(key, func() (*innerPkg, error) {
 		if err := b.BuildWebClientAssets(); err != nil {
 			return nil, err
@@ -227,18 +261,23 @@ func (m *synologyBuilds) buildInnerPackage(b *dist.Build, dsmVersion int, goenv
 		tw := tar.NewWriter(cw)
 		defer tw.Close()
 
-		err = writeTar(tw, b.Time,
+		ents := []tarEntry{
 			dir("bin"),
 			file(tsd, "bin/tailscaled", 0755),
 			file(ts, "bin/tailscale", 0755),
 			dir("conf"),
 			static("Tailscale.sc", "conf/Tailscale.sc", 0644),
 			static(fmt.Sprintf("logrotate-dsm%d", dsmVersion), "conf/logrotate.conf", 0644),
+		}
+		if outboundOnly {
+			ents = append(ents, memFile("conf/outbound-only", nil, 0644))
+		}
+		ents = append(ents,
 			dir("ui"),
 			static("PACKAGE_ICON_256.PNG", "ui/PACKAGE_ICON_256.PNG", 0644),
 			static("config", "ui/config", 0644),
 			static("index.cgi", "ui/index.cgi", 0755))
-		if err != nil {
+		if err := writeTar(tw, b.Time, ents...); err != nil {
 			return nil, err
 		}
 
@@ -0,0 +1,73 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package synology
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// privilege is the DSM package privilege file, written to conf/privilege
+// in the SPK.
+//
+// See https://help.synology.com/developer-guide/synology_package/privilege.html.
+type privilege struct {
+	Defaults  privilegeDefaults `json:"defaults"`
+	Username  string            `json:"username"`
+	Groupname string            `json:"groupname"`
+	Tool      []privilegeTool   `json:"tool,omitempty"`
+}
+
+type privilegeDefaults struct {
+	RunAs string `json:"run-as"`
+}
+
+// privilegeTool grants extra Linux capabilities to a single binary in
+// the package. It is only honored by DSM 7 for packages distributed
+// through the package center.
+type privilegeTool struct {
+	RelPath      string `json:"relpath"`
+	User         string `json:"user"`
+	Group        string `json:"group"`
+	Capabilities string `json:"capabilities"`
+}
+
+// tunCapabilities are the capabilities tailscaled needs to create and
+// configure a TUN device on DSM 7.
+var tunCapabilities = []string{"cap_net_admin", "cap_chown", "cap_net_raw"}
+
+// mkPrivilege returns the contents of the privilege file for t.
+//
+// DSM 6 packages run as root. DSM 7 packages run as the package user
+// and, when built for the package center, request the capabilities
+// tailscaled needs for TUN mode. Outbound-only builds never use a TUN
+// device, so they request no extra capabilities.
+func (t *target) mkPrivilege() ([]byte, error) {
+	p := privilege{
+		Username:  "tailscale",
+		Groupname: "tailscale",
+	}
+	switch t.dsmMajorVersion {
+	case 6:
+		p.Defaults.RunAs = "root"
+	case 7:
+		p.Defaults.RunAs = "package"
+		if t.packageCenter && !t.outboundOnly {
+			p.Tool = append(p.Tool, privilegeTool{
+				RelPath:      "bin/tailscaled",
+				User:         "package",
+				Group:        "package",
+				Capabilities: strings.Join(tunCapabilities, ","),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported DSM major version %d", t.dsmMajorVersion)
+	}
+	bs, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(bs, '\n'), nil
+}
@@ -26,7 +26,12 @@
 	"monaco",
 }
 
-func Targets(forPackageCenter bool, signer dist.Signer) []dist.Target {
+// Targets defines the dist.Targets for Synology devices.
+//
+// If outboundOnly is set, the packages run tailscaled in
+// userspace-networking mode and their privilege file requests no TUN
+// capabilities.
+func Targets(forPackageCenter, outboundOnly bool, signer dist.Signer) []dist.Target {
 	var ret []dist.Target
 	for _, dsmVersion := range []struct {
 		major int
@@ -49,6 +54,7 @@ func Targets(forPackageCenter bool, signer dist.Signer) []dist.Target {
 					"GOARCH": "amd64",
 				},
 				packageCenter: forPackageCenter,
+				outboundOnly:  outboundOnly,
 				signer:        signer,
 			},
 			&target{
@@ -60,6 +66,7 @@ func Targets(forPackageCenter bool, signer dist.Signer) []dist.Target {
 					"GOARCH": "386",
 				},
 				packageCenter: forPackageCenter,
+				outboundOnly:  outboundOnly,
 				signer:        signer,
 			},
 			&target{
@@ -71,6 +78,7 @@ func Targets(forPackageCenter bool, signer dist.Signer) []dist.Target {
 					"GOARCH": "arm64",
 				},
 				packageCenter: forPackageCenter,
+				outboundOnly:  outboundOnly,
 				signer:        signer,
 			})
 
@@ -88,6 +96,7 @@ func Targets(forPackageCenter bool, signer dist.Signer) []dist.Target {
 					"GOARM":  "5",
 				},
 				packageCenter: forPackageCenter,
+				outboundOnly:  outboundOnly,
 				signer:        signer,
 			})
 		}
@@ -102,6 +111,7 @@ func Targets(forPackageCenter bool, signer dist.Signer) []dist.Target {
 					"GOARM":  "7",
 				},
 				packageCenter: forPackageCenter,
+				outboundOnly:  outboundOnly,
 				signer:        signer,
 			})
 		}
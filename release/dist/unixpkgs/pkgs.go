@@ -41,6 +41,19 @@ func (t *tgzTarget) String() string {
 	return fmt.Sprintf("%s/%s/tgz", t.os(), t.arch())
 }
 
+// CacheKey implements [dist.CacheableTarget]. Signed tarballs aren't cached.
+func (t *tgzTarget) CacheKey() (any, bool) {
+	return struct {
+		FilenameArch string
+		GoEnv        map[string]string
+	}{t.filenameArch, t.goEnv}, t.signer == nil
+}
+
+// GoPrograms implements [dist.GoTarget].
+func (t *tgzTarget) GoPrograms() []dist.GoProgram {
+	return goPrograms(t.goEnv)
+}
+
 func (t *tgzTarget) Build(b *dist.Build) ([]string, error) {
 	var filename string
 	if t.goEnv["GOOS"] == "linux" {
@@ -186,6 +199,16 @@ func (t *debTarget) String() string {
 	return fmt.Sprintf("linux/%s/deb", t.goEnv["GOARCH"])
 }
 
+// CacheKey implements [dist.CacheableTarget].
+func (t *debTarget) CacheKey() (any, bool) {
+	return t.goEnv, true
+}
+
+// GoPrograms implements [dist.GoTarget].
+func (t *debTarget) GoPrograms() []dist.GoProgram {
+	return goPrograms(t.goEnv)
+}
+
 func (t *debTarget) Build(b *dist.Build) ([]string, error) {
 	if t.os() != "linux" {
 		return nil, errors.New("deb only supported on linux")
@@ -333,6 +356,16 @@ func (t *rpmTarget) String() string {
 	return fmt.Sprintf("linux/%s/rpm", t.arch())
 }
 
+// CacheKey implements [dist.CacheableTarget]. Signed RPMs aren't cached.
+func (t *rpmTarget) CacheKey() (any, bool) {
+	return t.goEnv, t.signer == nil
+}
+
+// GoPrograms implements [dist.GoTarget].
+func (t *rpmTarget) GoPrograms() []dist.GoProgram {
+	return goPrograms(t.goEnv)
+}
+
 func (t *rpmTarget) Build(b *dist.Build) ([]string, error) {
 	if t.os() != "linux" {
 		return nil, errors.New("rpm only supported on linux")
@@ -475,6 +508,14 @@ func debArch(arch string) string {
 	}
 }
 
+// goPrograms returns the Go programs in all packages built with goEnv.
+func goPrograms(goEnv map[string]string) []dist.GoProgram {
+	return []dist.GoProgram{
+		{Path: "tailscale.com/cmd/tailscale", Env: goEnv},
+		{Path: "tailscale.com/cmd/tailscaled", Env: goEnv},
+	}
+}
+
 // rpmArch returns the RPM arch name for the given Go arch name.
 // nfpm also does this translation internally, but we need to do it outside nfpm
 // because we also need the filename to be correct.
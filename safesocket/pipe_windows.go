@@ -7,11 +7,14 @@
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/tailscale/go-winio"
 	"golang.org/x/sys/windows"
@@ -30,11 +33,101 @@ func connect(ctx context.Context, path string) (net.Conn, error) {
 // It is a var for testing, do not change this value.
 var windowsSDDL = "O:BAG:BAD:PAI(A;OICI;GWGR;;;BU)(A;OICI;GWGR;;;SY)"
 
+var (
+	pipeGroupsMu sync.Mutex
+	pipeGroups   []*windows.SID // see SetWindowsPipeGroups
+)
+
+// SetWindowsPipeGroups sets the Windows groups whose members may connect to
+// the named pipes created by later calls to [Listen], in addition to the users
+// allowed by default. Each group is given either by name, such as
+// `DOMAIN\Monitoring`, or by SID string.
+//
+// It's up to the server to decide what members of the groups may do once
+// connected; see [WindowsPipeGroups]. Groups that can't be resolved are
+// skipped, and reported in the returned error.
+func SetWindowsPipeGroups(groups []string) error {
+	var sids []*windows.SID
+	var errs []error
+	for _, g := range groups {
+		sid, err := windows.StringToSid(g)
+		if err != nil {
+			sid, _, _, err = windows.LookupSID("", g)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("group %q: %w", g, err))
+			continue
+		}
+		sids = append(sids, sid)
+	}
+	pipeGroupsMu.Lock()
+	defer pipeGroupsMu.Unlock()
+	pipeGroups = sids
+	return errors.Join(errs...)
+}
+
+// WindowsPipeGroups returns the SIDs of the groups set by
+// [SetWindowsPipeGroups]. The caller must not modify them.
+func WindowsPipeGroups() []*windows.SID {
+	pipeGroupsMu.Lock()
+	defer pipeGroupsMu.Unlock()
+	return pipeGroups
+}
+
+// WindowsPipeDefaultSIDs returns the SIDs of the users and groups that may
+// connect to the named pipes created by [Listen] regardless of the groups set
+// by [SetWindowsPipeGroups].
+func WindowsPipeDefaultSIDs() ([]*windows.SID, error) {
+	if windowsSDDL == "" {
+		return nil, nil
+	}
+	sd, err := windows.SecurityDescriptorFromString(windowsSDDL)
+	if err != nil {
+		return nil, err
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return nil, err
+	}
+	var sids []*windows.SID
+	for i := range uint32(dacl.AceCount) {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err := windows.GetAce(dacl, i, &ace); err != nil {
+			return nil, err
+		}
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE {
+			continue
+		}
+		sid, err := (*windows.SID)(unsafe.Pointer(&ace.SidStart)).Copy()
+		if err != nil {
+			return nil, err
+		}
+		sids = append(sids, sid)
+	}
+	return sids, nil
+}
+
+// pipeSDDL returns the Security Descriptor to set on a new named pipe:
+// windowsSDDL, plus read/write access for the groups set by
+// [SetWindowsPipeGroups].
+func pipeSDDL() string {
+	sids := WindowsPipeGroups()
+	if windowsSDDL == "" || len(sids) == 0 {
+		return windowsSDDL
+	}
+	var sb strings.Builder
+	sb.WriteString(windowsSDDL)
+	for _, sid := range sids {
+		fmt.Fprintf(&sb, "(A;OICI;GWGR;;;%s)", sid)
+	}
+	return sb.String()
+}
+
 func listen(path string) (net.Listener, error) {
 	lc, err := winio.ListenPipe(
 		path,
 		&winio.PipeConfig{
-			SecurityDescriptor: windowsSDDL,
+			SecurityDescriptor: pipeSDDL(),
 			InputBufferSize:    256 * 1024,
 			OutputBufferSize:   256 * 1024,
 		},
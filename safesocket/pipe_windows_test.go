@@ -5,6 +5,7 @@
 
 import (
 	"fmt"
+	"slices"
 	"testing"
 
 	"tailscale.com/util/winutil"
@@ -110,3 +111,40 @@ func TestExpectedWindowsTypes(t *testing.T) {
 		}
 	}
 }
+
+func TestPipeSDDL(t *testing.T) {
+	t.Cleanup(func() { SetWindowsPipeGroups(nil) })
+	orig := windowsSDDL
+	t.Cleanup(func() { windowsSDDL = orig })
+	windowsSDDL = "O:BAG:BAD:PAI(A;OICI;GWGR;;;BU)(A;OICI;GWGR;;;SY)"
+
+	if got := pipeSDDL(); got != windowsSDDL {
+		t.Errorf("pipeSDDL() with no groups = %q; want %q", got, windowsSDDL)
+	}
+
+	// Network Service, by SID, and a group that doesn't exist.
+	err := SetWindowsPipeGroups([]string{"S-1-5-20", `NoSuchDomain\NoSuchGroup`})
+	if err == nil {
+		t.Error("no error for unknown group")
+	}
+	want := windowsSDDL + "(A;OICI;GWGR;;;S-1-5-20)"
+	if got := pipeSDDL(); got != want {
+		t.Errorf("pipeSDDL() = %q; want %q", got, want)
+	}
+}
+
+func TestWindowsPipeDefaultSIDs(t *testing.T) {
+	sids, err := WindowsPipeDefaultSIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, sid := range sids {
+		got = append(got, sid.String())
+	}
+	// BUILTIN\Users and LocalSystem, per windowsSDDL.
+	want := []string{"S-1-5-32-545", "S-1-5-18"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
@@ -49,6 +49,19 @@ func filterEnv(acceptEnv []string, environ []string) ([]string, error) {
 	return acceptedPairs, nil
 }
 
+// removeDeniedEnv returns environ, a slice of "key=value" strings, without
+// the variables whose names match the patterns of denyEnv, which may contain
+// the same wildcards as acceptEnv values.
+func removeDeniedEnv(denyEnv []string, environ []string) []string {
+	if len(denyEnv) == 0 {
+		return environ
+	}
+	return slices.DeleteFunc(slices.Clone(environ), func(envPair string) bool {
+		variableName, _, _ := strings.Cut(envPair, "=")
+		return matchAcceptEnv(denyEnv, variableName)
+	})
+}
+
 // matchAcceptEnv is a convenience function that wraps calling matchAcceptEnvPattern
 // with every value in acceptEnv for a given env that is being matched against.
 func matchAcceptEnv(acceptEnv []string, env string) bool {
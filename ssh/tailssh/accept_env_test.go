@@ -5,6 +5,7 @@
 
 import (
 	"fmt"
+	"slices"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -154,3 +155,44 @@ func TestFilterEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoveDeniedEnv(t *testing.T) {
+	testCases := []struct {
+		name    string
+		denyEnv []string
+		environ []string
+		want    []string
+	}{
+		{
+			name:    "no-deny",
+			denyEnv: nil,
+			environ: []string{"FOO=BAR", "LANG=C"},
+			want:    []string{"FOO=BAR", "LANG=C"},
+		},
+		{
+			name:    "direct-and-wildcard",
+			denyEnv: []string{"LANG", "LC_*"},
+			environ: []string{"FOO=BAR", "LANG=C", "LC_ALL=C", "LC_TIME=C", "TERM=xterm"},
+			want:    []string{"FOO=BAR", "TERM=xterm"},
+		},
+		{
+			name:    "deny-all",
+			denyEnv: []string{"*"},
+			environ: []string{"FOO=BAR", "TERM=xterm"},
+			want:    []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			environ := slices.Clone(tc.environ)
+			got := removeDeniedEnv(tc.denyEnv, environ)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected result (-want,+got): \n%s", diff)
+			}
+			if !slices.Equal(environ, tc.environ) {
+				t.Errorf("environ modified: %q", environ)
+			}
+		})
+	}
+}
@@ -221,6 +221,9 @@ func (ss *sshSession) newIncubatorCommand(logf logger.Logf) (cmd *exec.Cmd, err
 		// integration. Otherwise, we'll serve SFTP in the incubator process
 		// with no PAM integration.
 		incubatorArgs = append(incubatorArgs, "--sftp", fmt.Sprintf("--cmd=%s be-child sftp", ss.conn.srv.tailscaledPath))
+		if root := ss.conn.finalAction.SFTPRoot; root != "" {
+			incubatorArgs = append(incubatorArgs, "--sftp-root="+root)
+		}
 	case isShell:
 		incubatorArgs = append(incubatorArgs, "--shell")
 	default:
@@ -229,10 +232,12 @@ func (ss *sshSession) newIncubatorCommand(logf logger.Logf) (cmd *exec.Cmd, err
 
 	allowSendEnv := nm.HasCap(tailcfg.NodeAttrSSHEnvironmentVariables)
 	if allowSendEnv {
-		env, err := filterEnv(ss.conn.acceptEnv, ss.Session.Environ())
+		acceptEnv := slices.Concat(ss.conn.acceptEnv, ss.conn.finalAction.AcceptEnv)
+		env, err := filterEnv(acceptEnv, ss.Session.Environ())
 		if err != nil {
 			return nil, err
 		}
+		env = removeDeniedEnv(ss.conn.finalAction.DenyEnv, env)
 
 		if len(env) > 0 {
 			encoded, err := json.Marshal(env)
@@ -280,6 +285,7 @@ type incubatorArgs struct {
 	hasTTY             bool
 	cmd                string
 	isSFTP             bool
+	sftpRoot           string
 	isShell            bool
 	forceV1Behavior    bool
 	debugTest          bool
@@ -305,6 +311,7 @@ func parseIncubatorArgs(args []string) (incubatorArgs, error) {
 	flags.StringVar(&ia.cmd, "cmd", "", "the cmd to launch, including all arguments (ignored in sftp mode)")
 	flags.BoolVar(&ia.isShell, "shell", false, "is launching a shell (with no cmds)")
 	flags.BoolVar(&ia.isSFTP, "sftp", false, "run sftp server (cmd is ignored)")
+	flags.StringVar(&ia.sftpRoot, "sftp-root", "", "directory to confine the sftp server to, relative to home-dir if not absolute")
 	flags.BoolVar(&ia.forceV1Behavior, "force-v1-behavior", false, "allow falling back to the su command if login is unavailable")
 	flags.BoolVar(&ia.debugTest, "debug-test", false, "should debug in test mode")
 	flags.BoolVar(&ia.isSELinuxEnforcing, "is-selinux-enforcing", false, "whether SELinux is in enforcing mode")
@@ -386,6 +393,9 @@ func beIncubator(args []string) error {
 	if ia.isSFTP && ia.isShell {
 		return fmt.Errorf("--sftp and --shell are mutually exclusive")
 	}
+	if ia.sftpRoot != "" && !ia.isSFTP {
+		return fmt.Errorf("--sftp-root requires --sftp")
+	}
 
 	dlogf := logger.Discard
 	if debugIncubator {
@@ -441,6 +451,12 @@ func handleSFTPInProcess(dlogf logger.Logf, ia incubatorArgs) error {
 		defer sessionCloser()
 	}
 
+	if ia.sftpRoot != "" {
+		if err := chrootSFTP(dlogf, &ia); err != nil {
+			return err
+		}
+	}
+
 	if err := dropPrivileges(dlogf, ia); err != nil {
 		return err
 	}
@@ -448,6 +464,26 @@ func handleSFTPInProcess(dlogf logger.Logf, ia incubatorArgs) error {
 	return serveSFTP()
 }
 
+// chrootSFTP confines the process to ia.sftpRoot, before it drops privileges
+// to serve SFTP in-process. It fails, rather than serving the whole
+// filesystem, if it can't, such as when not running as root.
+func chrootSFTP(dlogf logger.Logf, ia *incubatorArgs) error {
+	root := ia.sftpRoot
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(ia.homeDir, root)
+	}
+	dlogf("confining sftp to %q", root)
+	if err := unix.Chroot(root); err != nil {
+		return fmt.Errorf("confining sftp to %q: %w", root, err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return fmt.Errorf("confining sftp to %q: %w", root, err)
+	}
+	// The home directory is outside of the new root, or not where it was.
+	ia.homeDir = "/"
+	return nil
+}
+
 // beSFTP serves SFTP in-process.
 func beSFTP(args []string) error {
 	return serveSFTP()
@@ -472,13 +508,20 @@ func serveSFTP() error {
 //
 // - We are running as root
 // - This is not an SELinuxEnforcing host
+// - This is not SFTP confined to a root directory
 //
-// The last condition exists because if we're running on a SELinux-enabled
+// The second condition exists because if we're running on a SELinux-enabled
 // system, neiher login nor su will be able to set the correct context for the
 // shell. So, we don't bother trying to run them and instead fall back to using
 // the incubator to launch the shell.
 // See http://github.com/tailscale/tailscale/issues/4908.
 func shouldAttemptLoginShell(dlogf logger.Logf, ia incubatorArgs) bool {
+	if ia.sftpRoot != "" {
+		// The SFTP server must be confined before dropping privileges,
+		// which login and su do.
+		dlogf("won't use login shell for SFTP confined to %q", ia.sftpRoot)
+		return false
+	}
 	if ia.forceV1Behavior && ia.isSFTP {
 		// v1 behavior did not run SFTP within a login shell.
 		dlogf("Forcing v1 behavior, won't use login shell for SFTP")
@@ -846,7 +889,7 @@ func (ss *sshSession) launchProcess() error {
 
 	cmd := ss.cmd
 	cmd.Env = envForUser(ss.conn.localUser)
-	for _, kv := range ss.Environ() {
+	for _, kv := range removeDeniedEnv(ss.conn.finalAction.DenyEnv, ss.Environ()) {
 		if acceptEnvPair(kv) {
 			cmd.Env = append(cmd.Env, kv)
 		}
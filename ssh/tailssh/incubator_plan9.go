@@ -19,6 +19,7 @@
 	"os"
 	"os/exec"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -102,6 +103,10 @@ func (ss *sshSession) newIncubatorCommand(logf logger.Logf) (cmd *exec.Cmd, err
 		incubatorArgs = append(incubatorArgs, "--debug-test")
 	}
 
+	if isSFTP && ss.conn.finalAction.SFTPRoot != "" {
+		return nil, errors.New("SFTP root directories are not supported on plan9")
+	}
+
 	switch {
 	case isSFTP:
 		// Note that we include both the `--sftp` flag and a command to launch
@@ -119,10 +124,12 @@ func (ss *sshSession) newIncubatorCommand(logf logger.Logf) (cmd *exec.Cmd, err
 
 	allowSendEnv := nm.HasCap(tailcfg.NodeAttrSSHEnvironmentVariables)
 	if allowSendEnv {
-		env, err := filterEnv(ss.conn.acceptEnv, ss.Session.Environ())
+		acceptEnv := slices.Concat(ss.conn.acceptEnv, ss.conn.finalAction.AcceptEnv)
+		env, err := filterEnv(acceptEnv, ss.Session.Environ())
 		if err != nil {
 			return nil, err
 		}
+		env = removeDeniedEnv(ss.conn.finalAction.DenyEnv, env)
 
 		if len(env) > 0 {
 			encoded, err := json.Marshal(env)
@@ -354,7 +361,7 @@ func (ss *sshSession) launchProcess() error {
 	cmd := ss.cmd
 	cmd.Dir = "/"
 	cmd.Env = append(os.Environ(), envForUser(ss.conn.localUser)...)
-	for _, kv := range ss.Environ() {
+	for _, kv := range removeDeniedEnv(ss.conn.finalAction.DenyEnv, ss.Environ()) {
 		if acceptEnvPair(kv) {
 			cmd.Env = append(cmd.Env, kv)
 		}
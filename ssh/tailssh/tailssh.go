@@ -700,6 +700,11 @@ func (c *conn) handleSessionPostSSHAuth(s gliderssh.Session) {
 		metricSFTP.Add(1)
 	case "":
 		// Regular SSH session.
+		if c.finalAction.SFTPRoot != "" {
+			fmt.Fprintf(s.Stderr(), "Only SFTP is allowed\r\n")
+			s.Exit(1)
+			return
+		}
 	default:
 		fmt.Fprintf(s.Stderr(), "Unsupported subsystem %q\r\n", s.Subsystem())
 		s.Exit(1)
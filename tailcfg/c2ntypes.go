@@ -69,11 +69,35 @@ type C2NPostureIdentityResponse struct {
 	// of the client machine's network interfaces.
 	IfaceHardwareAddrs []string `json:",omitempty"`
 
+	// SecurityAgents lists the endpoint security agents (EDR and
+	// antivirus) found on the client machine. It's only populated when
+	// the request asks for it, and only on Windows and macOS.
+	SecurityAgents []C2NPostureSecurityAgent `json:",omitempty"`
+
 	// PostureDisabled indicates if the machine has opted out of
 	// device posture collection.
 	PostureDisabled bool `json:",omitempty"`
 }
 
+// C2NPostureSecurityAgent describes an endpoint security agent found on
+// the client machine, for use in posture checks.
+type C2NPostureSecurityAgent struct {
+	// ID identifies the agent, like "crowdstrike", "defender" or
+	// "sentinelone".
+	ID string
+
+	// Name is the agent's product name, as reported by the OS.
+	Name string `json:",omitempty"`
+
+	// Version is the agent's version, if known.
+	Version string `json:",omitempty"`
+
+	// Running is whether the agent is running. On Windows, an agent
+	// registered with Windows Security Center is running if it's
+	// enabled there.
+	Running bool
+}
+
 // C2NAppConnectorDomainRoutesResponse contains a map of domains to
 // slice of addresses, indicating what IP addresses have been resolved
 // for each domain.
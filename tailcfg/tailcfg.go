@@ -185,7 +185,15 @@
 //   - 136: 2026-04-09: Client understands [NodeAttrDisableLinuxCGNATDropRule]
 //   - 137: 2026-04-15: Client handles 429 responses to /machine/register.
 //   - 138: 2026-03-31: can handle C2N /debug/tka.
-const CurrentCapabilityVersion CapabilityVersion = 138
+//   - 139: 2026-10-16: Client enforces [PeerCapabilityValidity] windows on FilterRules.
+//   - 140: 2026-10-16: Client reports SecurityAgents in C2N /posture/identity when asked.
+//   - 141: 2026-10-16: Client understands [NodeAttrMDNSGateway]
+//   - 142: 2026-10-16: Client enforces [NodeAttrEndpointPolicy]
+//   - 143: 2026-10-16: Client sends Hostinfo.Attributes, if configured to collect them
+//   - 144: 2026-10-16: Client understands [NodeAttrLocalOperator]
+//   - 145: 2026-10-16: Client enforces [PeerCapabilityAppProtocols]
+//   - 146: 2026-10-16: Client enforces SSHAction.SFTPRoot, SSHAction.AcceptEnv and SSHAction.DenyEnv
+const CurrentCapabilityVersion CapabilityVersion = 146
 
 // ID is an integer ID for a user, node, or login allocated by the
 // control plane.
@@ -918,6 +926,12 @@ type Hostinfo struct {
 	//   * Android apps use EncryptedSharedPreferences
 	StateEncrypted opt.Bool `json:",omitzero"`
 
+	// Attributes are custom attributes of the device, such as an asset tag
+	// or cost center, as reported by a local command configured by the
+	// device's administrator. Keys are at most 64 ASCII letters, digits,
+	// '_', '-', '.' or ':', and values are at most 256 bytes of UTF-8.
+	Attributes map[string]string `json:",omitempty"`
+
 	// NOTE: any new fields containing pointers in this type
 	//       require changes to Hostinfo.Equal.
 }
@@ -1583,8 +1597,51 @@ type CapGrant struct {
 	// capabilities, such as the ability to add user groups to the OIDC
 	// claim
 	PeerCapabilityTsIDP PeerCapability = "tailscale.com/cap/tsidp"
+
+	// PeerCapabilityValidity, in a FilterRule's CapGrant, limits when the
+	// rest of the FilterRule applies. Its values are [ValidityCapValue]s;
+	// if there are several, the rule applies only when all of them are
+	// satisfied. It isn't itself granted to the source.
+	//
+	// Unlike other capabilities, it may be sent in a FilterRule that also
+	// has DstPorts, to make a network grant temporary. Clients before
+	// CapabilityVersion 139 don't enforce it.
+	PeerCapabilityValidity PeerCapability = "tailscale.com/cap/validity"
+
+	// PeerCapabilityAppProtocols, in a FilterRule's CapGrant, limits the
+	// TCP connections that the FilterRule's DstPorts allow to those whose
+	// client speaks one of the application protocols in its values, which
+	// are [AppProtocolsCapValue]s. The protocol is recognized from the
+	// first data the client sends, and connections speaking any other
+	// protocol are dropped. It doesn't allow other IP protocols, and like
+	// [PeerCapabilityValidity], it isn't itself granted to the source.
+	//
+	// It's meant as defense in depth for ports that multiplex protocols,
+	// not as a substitute for authenticating clients. Clients before
+	// CapabilityVersion 145 don't enforce it.
+	PeerCapabilityAppProtocols PeerCapability = "tailscale.com/cap/app-protocols"
 )
 
+// ValidityCapValue is the value of a [PeerCapabilityValidity] capability.
+type ValidityCapValue struct {
+	// NotBefore, if non-zero, is the time at which the FilterRule starts
+	// to apply.
+	NotBefore time.Time `json:",omitzero"`
+
+	// NotAfter, if non-zero, is the time at which the FilterRule stops
+	// applying.
+	NotAfter time.Time `json:",omitzero"`
+}
+
+// AppProtocolsCapValue is the value of a [PeerCapabilityAppProtocols]
+// capability.
+type AppProtocolsCapValue struct {
+	// Protocols are the allowed application protocols: "tls", "ssh",
+	// "http", or "rdp". With several values, the protocols of all of them
+	// are allowed.
+	Protocols []string
+}
+
 // NodeCapMap is a map of capabilities to their optional values. It is valid for
 // a capability to have no values (nil slice); such capabilities can be tested
 // for by using the [NodeCapMap.Contains] method.
@@ -1709,7 +1766,8 @@ type FilterRule struct {
 	// DstPorts are the port ranges to allow once a source IP
 	// matches (is in the CIDR described by SrcIPs).
 	//
-	// CapGrant and DstPorts are mutually exclusive: at most one can be non-nil.
+	// CapGrant and DstPorts are mutually exclusive: at most one can be
+	// non-nil, unless CapGrant only contains [PeerCapabilityValidity].
 	DstPorts []NetPortRange `json:",omitempty"`
 
 	// IPProto are the IP protocol numbers to match.
@@ -1732,7 +1790,8 @@ type FilterRule struct {
 	// doing WhoIs lookups, looking up the remote IP address's
 	// application-level capabilities.
 	//
-	// CapGrant and DstPorts are mutually exclusive: at most one can be non-nil.
+	// CapGrant and DstPorts are mutually exclusive: at most one can be
+	// non-nil, unless CapGrant only contains [PeerCapabilityValidity].
 	CapGrant []CapGrant `json:",omitempty"`
 }
 
@@ -2788,6 +2847,26 @@ func (p NodeCapabilityPrefix) ToAttribute(value string) NodeCapability {
 	// that does not originate from the Tailscale network interface.
 	// This enables access to off-tailnet endpoints within that IP range.
 	NodeAttrDisableLinuxCGNATDropRule NodeCapability = "disable-linux-cgnat-drop-rule"
+
+	// NodeAttrMDNSGateway configures a DNS-SD zone that bridges mDNS service
+	// discovery between a gateway node's LAN and the tailnet. Nodes tagged as
+	// the zone's gateways browse their LAN for the configured service types
+	// and serve them in the zone; other nodes send their queries for the zone
+	// to a gateway. Each value is of type [tailscale.com/net/dns/mdnsgw.Attr].
+	NodeAttrMDNSGateway NodeCapability = "mdns-gateway"
+
+	// NodeAttrEndpointPolicy restricts the paths the node may use to reach
+	// its peers, such as to keep traffic to some peers on DERP. Each value
+	// is of type [EndpointPolicyRule]; a path is usable only if no rule
+	// that applies to the peer forbids it.
+	NodeAttrEndpointPolicy NodeCapability = "endpoint-policy"
+
+	// NodeAttrLocalOperator delegates some local administration of the node
+	// to OS users who otherwise may only read its state: a finer-grained
+	// form of "tailscale set --operator". Each value is of type
+	// [LocalOperatorGrant]. It only applies on Unix-like platforms, where
+	// there's a distinction between such users and the operator.
+	NodeAttrLocalOperator NodeCapability = "local-operator"
 )
 
 const (
@@ -3028,6 +3107,26 @@ type SSHAction struct {
 	// OnRecorderFailure is the action to take if recording fails.
 	// If nil, the default action is to fail open.
 	OnRecordingFailure *SSHRecorderFailureAction `json:"onRecordingFailure,omitempty"`
+
+	// SFTPRoot, if non-empty, restricts accepted connections to SFTP, and
+	// confines SFTP to the directory at this path, as if it were the root
+	// of the filesystem. A relative path is relative to the local user's
+	// home directory. Shells and commands are refused, as they'd have
+	// access to the whole filesystem.
+	SFTPRoot string `json:"sftpRoot,omitempty"`
+
+	// AcceptEnv is a slice of environment variable names that are
+	// allowlisted for sessions of accepted connections, in addition to
+	// those of SSHRule.AcceptEnv. It's subject to
+	// NodeAttrSSHEnvironmentVariables like SSHRule.AcceptEnv, and may
+	// contain the same wildcards.
+	AcceptEnv []string `json:"acceptEnv,omitempty"`
+
+	// DenyEnv is a slice of environment variable names that sessions of
+	// accepted connections may not set, even if they're accepted by
+	// AcceptEnv, SSHRule.AcceptEnv, or by default (such as TERM and LANG).
+	// It may contain the same wildcards as AcceptEnv.
+	DenyEnv []string `json:"denyEnv,omitempty"`
 }
 
 // SSHRecorderFailureAction is the action to take if recording fails.
@@ -3320,6 +3419,57 @@ type EarlyNoise struct {
 // vs NodeKey)
 const LBHeader = "Ts-Lb"
 
+// EndpointPolicyRule is a rule restricting which paths a node may use to
+// reach some of its peers. It's the value type of [NodeAttrEndpointPolicy]
+// and of the EndpointPolicy field in the tailscaled config file.
+//
+// DERP is always permitted, as it's the path of last resort.
+type EndpointPolicyRule struct {
+	// Peers selects the peers the rule applies to. Each entry is "*" for
+	// all peers, a tag such as "tag:restricted", or a StableNodeID.
+	Peers []string `json:",omitempty"`
+
+	// Deny lists the types of path that must not be used to reach the
+	// selected peers: "direct" for direct UDP and "relay" for peer relays.
+	Deny []string `json:",omitempty"`
+
+	// DenyPrefixes are IP prefixes of peer endpoints that must not be used
+	// for direct UDP, such as a corporate LAN's.
+	DenyPrefixes []netip.Prefix `json:",omitempty"`
+
+	// AllowPrefixes, if non-empty, are the only IP prefixes of peer
+	// endpoints that may be used for direct UDP.
+	AllowPrefixes []netip.Prefix `json:",omitempty"`
+}
+
+// Endpoint policy path types, for [EndpointPolicyRule.Deny].
+const (
+	EndpointPolicyDirect = "direct"
+	EndpointPolicyRelay  = "relay"
+)
+
+// LocalOperatorGrant grants local OS users permission to make some changes
+// to a node. It's the value type of [NodeAttrLocalOperator].
+type LocalOperatorGrant struct {
+	// Users are the local users granted the permissions, by user name or
+	// numeric user ID.
+	Users []string `json:",omitempty"`
+
+	// Permissions are what the users may do: one or more of the
+	// LocalOperator* constants. Unknown permissions are ignored.
+	Permissions []string `json:",omitempty"`
+}
+
+// Local operator permissions, for [LocalOperatorGrant.Permissions].
+const (
+	LocalOperatorExitNode     = "exit-node"     // select or clear an exit node, and allow LAN access with it
+	LocalOperatorAcceptRoutes = "accept-routes" // accept or reject subnet routes
+	LocalOperatorAcceptDNS    = "accept-dns"    // accept or reject DNS configuration
+	LocalOperatorShieldsUp    = "shields-up"    // block or allow incoming connections
+	LocalOperatorUpDown       = "up-down"       // connect and disconnect ("tailscale up" and "down" of a logged in node)
+	LocalOperatorTaildrop     = "taildrop"      // send files, and receive those sent to the node
+)
+
 // ServiceIPMappings maps ServiceName to lists of IP addresses. This is used
 // as the value of the [NodeAttrServiceHost] capability, to inform service hosts
 // what IP addresses they need to listen on for each service that they are
@@ -143,6 +143,7 @@ func (src *Hostinfo) Clone() *Hostinfo {
 	if dst.TPM != nil {
 		dst.TPM = new(*src.TPM)
 	}
+	dst.Attributes = maps.Clone(src.Attributes)
 	return dst
 }
 
@@ -190,6 +191,7 @@ func (src *Hostinfo) Clone() *Hostinfo {
 	Location        *Location
 	TPM             *TPMInfo
 	StateEncrypted  opt.Bool
+	Attributes      map[string]string
 }{})
 
 // Clone makes a deep copy of NetInfo.
@@ -545,6 +547,8 @@ func (src *SSHAction) Clone() *SSHAction {
 	if dst.OnRecordingFailure != nil {
 		dst.OnRecordingFailure = new(*src.OnRecordingFailure)
 	}
+	dst.AcceptEnv = append(src.AcceptEnv[:0:0], src.AcceptEnv...)
+	dst.DenyEnv = append(src.DenyEnv[:0:0], src.DenyEnv...)
 	return dst
 }
 
@@ -560,6 +564,9 @@ func (src *SSHAction) Clone() *SSHAction {
 	AllowRemotePortForwarding bool
 	Recorders                 []netip.AddrPort
 	OnRecordingFailure        *SSHRecorderFailureAction
+	SFTPRoot                  string
+	AcceptEnv                 []string
+	DenyEnv                   []string
 }{})
 
 // Clone makes a deep copy of SSHPrincipal.
@@ -71,6 +71,7 @@ func TestHostinfoEqual(t *testing.T) {
 		"Location",
 		"TPM",
 		"StateEncrypted",
+		"Attributes",
 	}
 	if have := fieldsOf(reflect.TypeFor[Hostinfo]()); !reflect.DeepEqual(have, hiHandles) {
 		t.Errorf("Hostinfo.Equal check might be out of sync\nfields: %q\nhandled: %q\n",
@@ -299,6 +300,16 @@ func TestHostinfoEqual(t *testing.T) {
 			&Hostinfo{ExitNodeID: "stable-exit"},
 			false,
 		},
+		{
+			&Hostinfo{Attributes: map[string]string{"rack": "r1"}},
+			&Hostinfo{Attributes: map[string]string{"rack": "r1"}},
+			true,
+		},
+		{
+			&Hostinfo{Attributes: map[string]string{"rack": "r1"}},
+			&Hostinfo{Attributes: map[string]string{"rack": "r2"}},
+			false,
+		},
 	}
 	for i, tt := range tests {
 		got := tt.a.Equal(tt.b)
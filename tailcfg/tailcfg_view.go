@@ -625,8 +625,14 @@ func (v HostinfoView) TPM() views.ValuePointer[TPMInfo] { return views.ValuePoin
 //   - Apple nodes use the Keychain
 //   - Linux and Windows nodes use the TPM
 //   - Android apps use EncryptedSharedPreferences
-func (v HostinfoView) StateEncrypted() opt.Bool   { return v.ж.StateEncrypted }
-func (v HostinfoView) Equal(v2 HostinfoView) bool { return v.ж.Equal(v2.ж) }
+func (v HostinfoView) StateEncrypted() opt.Bool { return v.ж.StateEncrypted }
+
+// Attributes are custom attributes of the device, such as an asset tag
+// or cost center, as reported by a local command configured by the
+// device's administrator. Keys are at most 64 ASCII letters, digits,
+// '_', '-', '.' or ':', and values are at most 256 bytes of UTF-8.
+func (v HostinfoView) Attributes() views.Map[string, string] { return views.MapOf(v.ж.Attributes) }
+func (v HostinfoView) Equal(v2 HostinfoView) bool            { return v.ж.Equal(v2.ж) }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _HostinfoViewNeedsRegeneration = Hostinfo(struct {
@@ -672,6 +678,7 @@ func (v HostinfoView) Equal(v2 HostinfoView) bool { return v.ж.Equal(v2.ж) }
 	Location        *Location
 	TPM             *TPMInfo
 	StateEncrypted  opt.Bool
+	Attributes      map[string]string
 }{})
 
 // View returns a read-only view of NetInfo.
@@ -2138,6 +2145,26 @@ func (v SSHActionView) OnRecordingFailure() views.ValuePointer[SSHRecorderFailur
 	return views.ValuePointerOf(v.ж.OnRecordingFailure)
 }
 
+// SFTPRoot, if non-empty, restricts accepted connections to SFTP, and
+// confines SFTP to the directory at this path, as if it were the root
+// of the filesystem. A relative path is relative to the local user's
+// home directory. Shells and commands are refused, as they'd have
+// access to the whole filesystem.
+func (v SSHActionView) SFTPRoot() string { return v.ж.SFTPRoot }
+
+// AcceptEnv is a slice of environment variable names that are
+// allowlisted for sessions of accepted connections, in addition to
+// those of SSHRule.AcceptEnv. It's subject to
+// NodeAttrSSHEnvironmentVariables like SSHRule.AcceptEnv, and may
+// contain the same wildcards.
+func (v SSHActionView) AcceptEnv() views.Slice[string] { return views.SliceOf(v.ж.AcceptEnv) }
+
+// DenyEnv is a slice of environment variable names that sessions of
+// accepted connections may not set, even if they're accepted by
+// AcceptEnv, SSHRule.AcceptEnv, or by default (such as TERM and LANG).
+// It may contain the same wildcards as AcceptEnv.
+func (v SSHActionView) DenyEnv() views.Slice[string] { return views.SliceOf(v.ж.DenyEnv) }
+
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _SSHActionViewNeedsRegeneration = SSHAction(struct {
 	Message                   string
@@ -2150,6 +2177,9 @@ func (v SSHActionView) OnRecordingFailure() views.ValuePointer[SSHRecorderFailur
 	AllowRemotePortForwarding bool
 	Recorders                 []netip.AddrPort
 	OnRecordingFailure        *SSHRecorderFailureAction
+	SFTPRoot                  string
+	AcceptEnv                 []string
+	DenyEnv                   []string
 }{})
 
 // View returns a read-only view of SSHPrincipal.
@@ -0,0 +1,104 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_omit_tailnetlock
+
+package tka
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"tailscale.com/types/tkatype"
+)
+
+// DetachedSignature is a signature over an AUM which is carried separately
+// from the AUM itself.
+//
+// Detached signatures allow an AUM to be signed by a tailnet lock key on a
+// machine which is not connected to the tailnet (such as an air-gapped
+// machine used for key ceremonies): the unsigned AUM is carried to the
+// signer, and only the resulting signature is carried back. Because the
+// signature names the AUM it covers by its SigHash, it cannot be mistakenly
+// attached to a different AUM.
+type DetachedSignature struct {
+	// SigHash is the AUM.SigHash of the AUM which was signed.
+	SigHash tkatype.AUMSigHash `cbor:"1,keyasint"`
+	// Signature is the signature over SigHash.
+	Signature tkatype.Signature `cbor:"2,keyasint"`
+}
+
+// SignDetached signs aum using signer, returning the signatures
+// as detached signatures. aum is not modified.
+func SignDetached(aum AUM, signer Signer) ([]DetachedSignature, error) {
+	sigHash := aum.SigHash()
+	sigs, err := signer.SignAUM(sigHash)
+	if err != nil {
+		return nil, fmt.Errorf("signing failed: %w", err)
+	}
+	out := make([]DetachedSignature, len(sigs))
+	for i, sig := range sigs {
+		out[i] = DetachedSignature{SigHash: sigHash, Signature: sig}
+	}
+	return out, nil
+}
+
+// AttachSignatures adds the provided detached signatures to the AUM.
+//
+// An error is returned if any signature is over a different AUM, or if the
+// AUM already carries a signature by the same key. Signatures are not
+// verified: the AUM must be checked against the authority before use.
+func (a *AUM) AttachSignatures(sigs ...DetachedSignature) error {
+	sigHash := a.SigHash()
+	for i, s := range sigs {
+		if s.SigHash != sigHash {
+			return fmt.Errorf("signature %d is for a different AUM", i)
+		}
+		if len(s.Signature.KeyID) == 0 {
+			return fmt.Errorf("signature %d has no keyID", i)
+		}
+		for _, existing := range a.Signatures {
+			if bytes.Equal(existing.KeyID, s.Signature.KeyID) {
+				return fmt.Errorf("signature %d: AUM is already signed by key %x", i, s.Signature.KeyID)
+			}
+		}
+		a.Signatures = append(a.Signatures, s.Signature)
+	}
+	return nil
+}
+
+// Serialize returns the given detached signature in a serialized format.
+func (s *DetachedSignature) Serialize() []byte {
+	out := bytes.NewBuffer(make([]byte, 0, 128))
+	encoder, err := cbor.CTAP2EncOptions().EncMode()
+	if err != nil {
+		// Deterministic validation of encoding options, should
+		// never fail.
+		panic(err)
+	}
+	if err := encoder.NewEncoder(out).Encode(s); err != nil {
+		// Writing to a bytes.Buffer should never fail.
+		panic(err)
+	}
+	return out.Bytes()
+}
+
+// Unserialize decodes bytes representing a marshaled detached signature.
+func (s *DetachedSignature) Unserialize(data []byte) error {
+	dec, _ := cborDecOpts.DecMode()
+	return dec.Unmarshal(data, s)
+}
+
+// CheckPending returns nil if aum is correctly signed by keys trusted by the
+// authority, and would be applied on top of the current head.
+func (a *Authority) CheckPending(aum AUM) error {
+	if aum.MessageKind == AUMCheckpoint {
+		return errors.New("checkpoint AUMs cannot be submitted as pending updates")
+	}
+	if parent, _ := aum.Parent(); parent != a.Head() {
+		return fmt.Errorf("AUM does not apply to the current head: based on %x but head is %x", parent, a.Head())
+	}
+	return aumVerify(aum, a.state, false)
+}
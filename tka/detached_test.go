@@ -0,0 +1,89 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tka
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDetachedSignature(t *testing.T) {
+	pub, priv := testingKey25519(t, 1)
+	key := Key{Kind: Key25519, Public: pub, Votes: 2}
+
+	storage := ChonkMem()
+	a, _, err := Create(storage, State{
+		Keys:              []Key{key},
+		DisablementValues: [][]byte{DisablementKDF([]byte{1, 2, 3})},
+	}, signer25519(priv))
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	// Build the update without a signer, as the node producing the
+	// pending AUM doesn't hold the signing key.
+	pub2, _ := testingKey25519(t, 2)
+	key2 := Key{Kind: Key25519, Public: pub2, Votes: 1}
+	b := a.NewUpdater(nil)
+	if err := b.AddKey(key2); err != nil {
+		t.Fatalf("AddKey(%v) failed: %v", key2, err)
+	}
+	updates, err := b.Finalize(storage)
+	if err != nil {
+		t.Fatalf("Finalize() failed: %v", err)
+	}
+	if len(updates) != 1 {
+		t.Fatalf("got %d updates, want 1", len(updates))
+	}
+	pending := updates[0]
+	if err := a.CheckPending(pending); err == nil {
+		t.Error("CheckPending() succeeded on unsigned AUM")
+	}
+
+	// Sign it, passing the signature through its serialized form as it
+	// would be when carried from an air-gapped machine.
+	sigs, err := SignDetached(pending, signer25519(priv))
+	if err != nil {
+		t.Fatalf("SignDetached() failed: %v", err)
+	}
+	if len(sigs) != 1 {
+		t.Fatalf("got %d signatures, want 1", len(sigs))
+	}
+	var sig DetachedSignature
+	if err := sig.Unserialize(sigs[0].Serialize()); err != nil {
+		t.Fatalf("Unserialize() failed: %v", err)
+	}
+	if diff := cmp.Diff(sigs[0], sig); diff != "" {
+		t.Errorf("serialization roundtrip differs (-want, +got):\n%s", diff)
+	}
+
+	var other AUM
+	if err := other.Unserialize(pending.Serialize()); err != nil {
+		t.Fatal(err)
+	}
+	other.PrevAUMHash = []byte{1, 2, 3}
+	if err := other.AttachSignatures(sig); err == nil {
+		t.Error("AttachSignatures() succeeded for signature over a different AUM")
+	}
+
+	if err := pending.AttachSignatures(sig); err != nil {
+		t.Fatalf("AttachSignatures() failed: %v", err)
+	}
+	if err := pending.AttachSignatures(sig); err == nil {
+		t.Error("AttachSignatures() succeeded attaching a duplicate signature")
+	}
+	if err := a.CheckPending(pending); err != nil {
+		t.Fatalf("CheckPending() failed: %v", err)
+	}
+	if err := a.Inform(storage, []AUM{pending}); err != nil {
+		t.Fatalf("could not apply signed update: %v", err)
+	}
+	if !a.KeyTrusted(key2.MustID()) {
+		t.Error("new key is not trusted")
+	}
+	if err := a.CheckPending(pending); err == nil {
+		t.Error("CheckPending() succeeded for AUM which no longer applies to head")
+	}
+}
@@ -76,6 +76,11 @@ type System struct {
 	// LocalBackend tracks the current config after any reloads.
 	InitialConfig *conffile.Config
 
+	// StartupProfile, if non-empty, is the name or ID of the login profile
+	// to switch to at startup instead of the last used one. It comes from
+	// tailscaled's --profile flag.
+	StartupProfile string
+
 	// SocketPath is the path to the tailscaled Unix socket.
 	// It is used to prevent serve from proxying to our own socket.
 	SocketPath string
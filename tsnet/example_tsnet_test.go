@@ -9,11 +9,13 @@
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
 
 	"tailscale.com/tsnet"
+	"tailscale.com/tstest/natlab"
 )
 
 // ExampleServer shows you how to construct a ready-to-use tsnet instance.
@@ -251,3 +253,34 @@ func ExampleServer_ListenService_reverseProxy() {
 	log.Printf("Listening on https://%v\n", ln.FQDN)
 	log.Fatal(http.Serve(ln, reverseProxy))
 }
+
+// ExampleServer_PacketListener shows you how to test a tsnet program on a
+// simulated network, in which it's behind two layers of NAT on a lossy
+// network, rather than on the real network of the machine running the test.
+func ExampleServer_PacketListener() {
+	internet := natlab.NewInternet()
+	isp := &natlab.Network{
+		Name:    "isp",
+		Prefix4: netip.MustParsePrefix("100.64.0.0/24"),
+	}
+	home := &natlab.Network{
+		Name:     "home",
+		Prefix4:  netip.MustParsePrefix("192.168.0.0/24"),
+		LossRate: 0.05,
+	}
+	natlab.NewNAT("cgnat", internet, isp, natlab.AddressAndPortDependentNAT)
+	natlab.NewNAT("router", isp, home, natlab.EndpointIndependentNAT)
+
+	m := &natlab.Machine{Name: "laptop"}
+	m.Attach("eth0", home)
+
+	srv := &tsnet.Server{
+		Hostname:       "laptop",
+		Dir:            filepath.Join(os.TempDir(), "tsnet-laptop"),
+		PacketListener: m,
+	}
+	if err := srv.Start(); err != nil {
+		log.Fatalf("can't start tsnet server: %v", err)
+	}
+	defer srv.Close()
+}
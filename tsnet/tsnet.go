@@ -169,6 +169,7 @@
 	"tailscale.com/logtail"
 	"tailscale.com/logtail/filch"
 	"tailscale.com/net/memnet"
+	"tailscale.com/net/netcheck"
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/proxymux"
 	"tailscale.com/net/socks5"
@@ -185,9 +186,59 @@
 	"tailscale.com/util/set"
 	"tailscale.com/util/testenv"
 	"tailscale.com/wgengine"
+	"tailscale.com/wgengine/magicsock"
 	"tailscale.com/wgengine/netstack"
 )
 
+// StateCrypter encrypts and decrypts state values for [Server.StateCrypter].
+// Implementations must be safe for concurrent use.
+type StateCrypter interface {
+	// Encrypt returns the encrypted form of the value plaintext of the
+	// state key id, to be written to the Server's state store.
+	Encrypt(id ipn.StateKey, plaintext []byte) ([]byte, error)
+
+	// Decrypt returns the plaintext of ciphertext, a value of the state
+	// key id previously returned by Encrypt.
+	Decrypt(id ipn.StateKey, ciphertext []byte) ([]byte, error)
+}
+
+// cryptStore is an ipn.StateStore that encrypts the values stored in the
+// StateStore it wraps with a StateCrypter.
+type cryptStore struct {
+	ipn.StateStore
+	ipn.EncryptedStateStore // marker only; always nil
+
+	c StateCrypter
+}
+
+func (s *cryptStore) ReadState(id ipn.StateKey) ([]byte, error) {
+	bs, err := s.StateStore.ReadState(id)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := s.c.Decrypt(id, bs)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting state %q: %w", id, err)
+	}
+	return pt, nil
+}
+
+func (s *cryptStore) WriteState(id ipn.StateKey, bs []byte) error {
+	ct, err := s.c.Encrypt(id, bs)
+	if err != nil {
+		return fmt.Errorf("encrypting state %q: %w", id, err)
+	}
+	return s.StateStore.WriteState(id, ct)
+}
+
+// SetDialer implements ipn.StateStoreDialerSetter if the wrapped store
+// does.
+func (s *cryptStore) SetDialer(d func(ctx context.Context, network, address string) (net.Conn, error)) {
+	if sds, ok := s.StateStore.(ipn.StateStoreDialerSetter); ok {
+		sds.SetDialer(d)
+	}
+}
+
 // Server is an embedded Tailscale server.
 //
 // Its exported fields may be changed until the first method call.
@@ -214,6 +265,16 @@ type Server struct {
 	// `Dir/tailscaled.log.conf`.
 	Store ipn.StateStore
 
+	// StateCrypter, if non-nil, encrypts each state value (including
+	// the node's private keys) before it's written to Store and
+	// decrypts it when read back, so applications can protect state at
+	// rest with their own KMS or keychain without implementing an
+	// ipn.StateStore.
+	//
+	// State written without a StateCrypter can't be read with one, so
+	// it should be set from the node's first start.
+	StateCrypter StateCrypter
+
 	// Hostname is the hostname to present to the control server.
 	// If empty, the binary name is used.
 	Hostname string
@@ -296,6 +357,24 @@ type Server struct {
 	// This field must be set before calling Start.
 	Tun tun.Device
 
+	// PacketListener, if non-nil, specifies how to create the UDP sockets
+	// for WireGuard and peer-to-peer traffic, instead of using the real
+	// network. It's meant for tests that simulate network topologies with
+	// [tailscale.com/tstest/natlab].
+	//
+	// This field must be set before calling Start.
+	PacketListener nettype.PacketListener
+
+	// SharedUDP, if non-nil, specifies UDP sockets for WireGuard and
+	// peer-to-peer traffic to share with the other Servers in the process
+	// using it, rather than each binding its own. This saves ports, and NAT
+	// mappings on the gateways in front of the host. Create it with
+	// [magicsock.NewSharedUDP]; the Servers' Port fields should match or be
+	// zero.
+	//
+	// This field must be set before calling Start.
+	SharedUDP *magicsock.SharedUDP
+
 	initOnce            sync.Once
 	initErr             error
 	lb                  *ipnlocal.LocalBackend
@@ -845,6 +924,9 @@ func (s *Server) start() (reterr error) {
 		HealthTracker: sys.HealthTracker.Get(),
 		ExtraRootCAs:  sys.ExtraRootCAs,
 		Metrics:       sys.UserMetricsRegistry(),
+		SharedUDP:     s.SharedUDP,
+
+		TestOnlyPacketListener: s.PacketListener,
 	})
 	if err != nil {
 		return err
@@ -910,7 +992,11 @@ func (s *Server) start() (reterr error) {
 			return err
 		}
 	}
-	sys.Set(s.Store)
+	var stateStore ipn.StateStore = s.Store
+	if s.StateCrypter != nil {
+		stateStore = &cryptStore{StateStore: s.Store, c: s.StateCrypter}
+	}
+	sys.Set(stateStore)
 
 	loginFlags := controlclient.LoginDefault
 	if s.Ephemeral {
@@ -1305,6 +1391,23 @@ func (s *Server) ListenPacket(network, addr string) (net.PacketConn, error) {
 	}, nil
 }
 
+// ListenTCPPortRange announces on the TCP ports first through last
+// (inclusive) on the Tailscale network, for protocols such as passive FTP that
+// negotiate additional ports at runtime. The accepted connections' LocalAddr
+// reports the port connected to.
+//
+// Like Listen with no IP, it matches traffic to the Tailscale IPs of this
+// node only. Connections to ports in the range go to the returned listener
+// even if another was created for them with Listen.
+//
+// It will start the server if it has not been started yet.
+func (s *Server) ListenTCPPortRange(first, last uint16) (net.Listener, error) {
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	return s.netstack.ListenTCPPortRange(netip.Addr{}, first, last)
+}
+
 // udpPacketConn wraps a net.PacketConn to unregister from s.listeners on Close.
 type udpPacketConn struct {
 	net.PacketConn
@@ -2192,6 +2295,112 @@ func (s *Server) CapturePcap(ctx context.Context, pcapFile string) error {
 	return nil
 }
 
+// NetcheckReport returns the most recent report of this node's network
+// conditions: its UDP connectivity, NAT behavior, and latency to each DERP
+// region, as shown by "tailscale netcheck". If no netcheck has completed
+// yet, it starts one and waits for it until ctx is done.
+func (s *Server) NetcheckReport(ctx context.Context) (*netcheck.Report, error) {
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	ms := s.sys.MagicSock.Get()
+	if r := ms.GetLastNetcheckReport(ctx); r != nil {
+		return r, nil
+	}
+	ms.ReSTUN("tsnet-netcheck")
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+			if r := ms.GetLastNetcheckReport(ctx); r != nil {
+				return r, nil
+			}
+		}
+	}
+}
+
+// PathKind is how traffic to a peer is carried, as shown by
+// "tailscale status".
+type PathKind string
+
+const (
+	PathNone      PathKind = ""           // the peer isn't active
+	PathDirect    PathKind = "direct"     // directly over UDP
+	PathDERP      PathKind = "derp"       // relayed by a DERP server
+	PathPeerRelay PathKind = "peer-relay" // relayed by a peer relay node
+)
+
+// PeerPath is the connectivity status of one of the Server's peers.
+type PeerPath struct {
+	ID           tailcfg.StableNodeID
+	DNSName      string
+	TailscaleIPs []netip.Addr
+	Online       bool // whether the peer is connected to the control server
+	Active       bool // whether there's been recent traffic with the peer
+
+	// Path is how traffic to the peer is currently carried. It's
+	// PathNone if the peer isn't Active.
+	Path PathKind
+
+	// Addr is where traffic to the peer is sent: the peer's UDP address
+	// for PathDirect, the DERP region code for PathDERP, or the peer
+	// relay's address for PathPeerRelay.
+	Addr string
+
+	LastHandshake time.Time // last WireGuard handshake; zero if none
+	TxBytes       int64
+	RxBytes       int64
+}
+
+// Relayed reports whether traffic to the peer is relayed rather than sent
+// directly, which is slower and may indicate a connectivity problem.
+func (p PeerPath) Relayed() bool {
+	return p.Path == PathDERP || p.Path == PathPeerRelay
+}
+
+// PeerPaths returns the connectivity status of each of the Server's peers,
+// sorted by DNS name.
+func (s *Server) PeerPaths(ctx context.Context) ([]PeerPath, error) {
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	st, err := s.localClient.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]PeerPath, 0, len(st.Peer))
+	for _, ps := range st.Peer {
+		p := PeerPath{
+			ID:            ps.ID,
+			DNSName:       ps.DNSName,
+			TailscaleIPs:  ps.TailscaleIPs,
+			Online:        ps.Online,
+			Active:        ps.Active,
+			LastHandshake: ps.LastHandshake,
+			TxBytes:       ps.TxBytes,
+			RxBytes:       ps.RxBytes,
+		}
+		// This matches the precedence in "tailscale status".
+		switch {
+		case !ps.Active:
+		case ps.CurAddr != "":
+			p.Path, p.Addr = PathDirect, ps.CurAddr
+		case ps.PeerRelay != "":
+			p.Path, p.Addr = PathPeerRelay, ps.PeerRelay
+		case ps.Relay != "":
+			p.Path, p.Addr = PathDERP, ps.Relay
+		}
+		ret = append(ret, p)
+	}
+	slices.SortFunc(ret, func(a, b PeerPath) int {
+		return strings.Compare(a.DNSName, b.DNSName)
+	})
+	return ret, nil
+}
+
 // Sys returns a handle to the Tailscale subsystems of this node.
 //
 // This is not a stable API, nor are the APIs of the returned subsystems.
@@ -379,6 +379,57 @@ func TestDialBlocks(t *testing.T) {
 	defer c.Close()
 }
 
+func TestNetcheckAndPeerPaths(t *testing.T) {
+	tstest.Shard(t)
+	tstest.ResourceCheck(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	controlURL, _ := startControl(t)
+	s1, _, _ := startServer(t, ctx, controlURL, "s1")
+	s2, s2ip, _ := startServer(t, ctx, controlURL, "s2")
+
+	report, err := s1.NetcheckReport(ctx)
+	if err != nil {
+		t.Fatalf("NetcheckReport: %v", err)
+	}
+	if len(report.RegionLatency) == 0 {
+		t.Errorf("netcheck report has no DERP region latencies: %+v", report)
+	}
+
+	ln := must.Get(s2.Listen("tcp", ":8081"))
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Close()
+		}
+	}()
+	c, err := s1.Dial(ctx, "tcp", netip.AddrPortFrom(s2ip, 8081).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	paths, err := s1.PeerPaths(ctx)
+	if err != nil {
+		t.Fatalf("PeerPaths: %v", err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("got %d peer paths; want 1: %+v", len(paths), paths)
+	}
+	p := paths[0]
+	if !slices.Contains(p.TailscaleIPs, s2ip) {
+		t.Errorf("peer IPs = %v; want %v", p.TailscaleIPs, s2ip)
+	}
+	if p.Active && p.Path == PathNone {
+		t.Errorf("active peer has no path: %+v", p)
+	}
+	if !p.Active && p.Path != PathNone {
+		t.Errorf("idle peer has path %q", p.Path)
+	}
+}
+
 // TestConn tests basic TCP connections between two tsnet Servers, s1 and s2:
 //
 //   - s1, a subnet router, first listens on its TCP :8081.
@@ -782,6 +833,56 @@ func TestStartStopStartGetsSameIP(t *testing.T) {
 	}
 }
 
+// xorCrypter is a StateCrypter for tests that XORs state with a fixed byte.
+type xorCrypter struct{}
+
+func (xorCrypter) Encrypt(_ ipn.StateKey, bs []byte) ([]byte, error) {
+	out := make([]byte, len(bs))
+	for i, b := range bs {
+		out[i] = b ^ 0x5a
+	}
+	return out, nil
+}
+
+func (c xorCrypter) Decrypt(id ipn.StateKey, bs []byte) ([]byte, error) {
+	return c.Encrypt(id, bs)
+}
+
+func TestStateCrypter(t *testing.T) {
+	tstest.Shard(t)
+	tstest.ResourceCheck(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	controlURL, _ := startControl(t)
+	store := new(mem.Store)
+	var crypter xorCrypter
+	s := &Server{
+		Dir:          t.TempDir(),
+		ControlURL:   controlURL,
+		Hostname:     "s1",
+		Store:        store,
+		StateCrypter: crypter,
+		Ephemeral:    true,
+	}
+	defer s.Close()
+	if _, err := s.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := store.ReadState(ipn.MachineKeyStateKey)
+	if err != nil {
+		t.Fatalf("reading machine key from store: %v", err)
+	}
+	if bytes.HasPrefix(raw, []byte("privkey:")) {
+		t.Errorf("machine key stored in plaintext")
+	}
+	plain := must.Get(crypter.Encrypt(ipn.MachineKeyStateKey, raw))
+	if !bytes.HasPrefix(plain, []byte("privkey:")) {
+		t.Errorf("decrypted machine key = %q; want privkey: prefix", plain)
+	}
+}
+
 func TestFunnel(t *testing.T) {
 	tstest.Shard(t)
 	ctx, dialCancel := context.WithTimeout(context.Background(), 30*time.Second)
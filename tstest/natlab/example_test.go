@@ -0,0 +1,53 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package natlab_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+
+	"tailscale.com/tstest/natlab"
+)
+
+// Example shows a client behind a NAT sending a packet to a server on the
+// internet, which sees it coming from the NAT's public address.
+func Example() {
+	internet := natlab.NewInternet()
+	lan := &natlab.Network{
+		Name:    "lan",
+		Prefix4: netip.MustParsePrefix("192.168.0.0/24"),
+	}
+	natlab.NewNAT("router", internet, lan, natlab.EndpointIndependentNAT)
+
+	server := &natlab.Machine{Name: "server"}
+	serverAddr := netip.AddrPortFrom(server.Attach("eth0", internet).V4(), 3478)
+	client := &natlab.Machine{Name: "client"}
+	client.Attach("eth0", lan)
+
+	ctx := context.Background()
+	spc, err := server.ListenPacket(ctx, "udp4", serverAddr.String())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer spc.Close()
+	cpc, err := client.ListenPacket(ctx, "udp4", ":0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cpc.Close()
+
+	if _, err := cpc.WriteTo([]byte("hello"), net.UDPAddrFromAddrPort(serverAddr)); err != nil {
+		log.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	n, from, err := spc.ReadFrom(buf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("server got %q from %v\n", buf[:n], from.(*net.UDPAddr).IP)
+	// Output: server got "hello" from 1.0.0.1
+}
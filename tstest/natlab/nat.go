@@ -69,6 +69,27 @@ func (t NATType) key(src, dst netip.AddrPort) natKey {
 	return k
 }
 
+// NewNAT returns a new Machine named name that routes between the networks
+// wan and lan through a NAT of type typ, with a firewall that only lets
+// traffic from wan in response to traffic from lan. The Machine becomes
+// lan's default gateway. wan may itself be the lan of another NAT, to
+// simulate nested NATs.
+func NewNAT(name string, wan, lan *Network, typ NATType) *Machine {
+	m := &Machine{Name: name}
+	wanIf := m.Attach("wan", wan)
+	lanIf := m.Attach("lan", lan)
+	lan.SetDefaultGateway(lanIf)
+	m.PacketHandler = &SNAT44{
+		Machine:           m,
+		ExternalInterface: wanIf,
+		Type:              typ,
+		Firewall: &Firewall{
+			TrustedInterface: lanIf,
+		},
+	}
+	return m
+}
+
 // DefaultMappingTimeout is the default timeout for a NAT mapping.
 const DefaultMappingTimeout = 30 * time.Second
 
@@ -5,6 +5,19 @@
 // in-memory without running VMs or requiring root, etc. Despite the
 // name, it does more than just NATs. But NATs are the most
 // interesting.
+//
+// A topology is built from Networks, such as the one returned by
+// NewInternet, and Machines attached to them. Machines can sit behind
+// NATs (see NewNAT and SNAT44), firewalls (see Firewall), or lossy
+// networks (see Network.LossRate). Each Machine's ListenPacket method
+// can be used as the PacketListener of a program under test, such as
+// [tailscale.com/tsnet.Server.PacketListener], so that its UDP traffic
+// crosses the simulated network instead of the real one. Only UDP is
+// simulated; other traffic, such as that to DERP servers, uses the
+// real network.
+//
+// The package is intended for tests outside of this repository too,
+// such as those of programs embedding tsnet. See the package examples.
 package natlab
 
 import (
@@ -98,11 +111,19 @@ func NewInternet() *Network {
 	}
 }
 
+// A Network is a network segment, such as a LAN or the internet, to which
+// Machines are attached.
 type Network struct {
 	Name    string
 	Prefix4 netip.Prefix
 	Prefix6 netip.Prefix
 
+	// LossRate is the fraction of packets, from 0 to 1, that are lost
+	// while crossing the network. A LossRate of 1 lets no UDP through,
+	// so that Tailscale nodes attached to the network can only reach
+	// their peers through DERP.
+	LossRate float64
+
 	mu        sync.Mutex
 	machine   map[netip.Addr]*Interface
 	defaultGW *Interface // optional
@@ -179,6 +200,11 @@ func addOne(a *[16]byte, index int) {
 func (n *Network) write(p *Packet) (num int, err error) {
 	p.setLocator("net=%s", n.Name)
 
+	if n.LossRate > 0 && rand.Float64() < n.LossRate {
+		p.Trace("lost")
+		return len(p.Payload), nil
+	}
+
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	iface, ok := n.machine[p.Dst.Addr()]
@@ -715,6 +741,10 @@ type conn struct {
 	closedCh  chan struct{} // closed by Close
 
 	in chan *Packet
+
+	mu              sync.Mutex
+	readDeadline    time.Time     // or zero for none
+	deadlineChanged chan struct{} // closed when readDeadline changes
 }
 
 func (c *conn) Close() error {
@@ -762,13 +792,38 @@ func (c *conn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
 }
 
 func (c *conn) ReadFromUDPAddrPort(p []byte) (n int, addr netip.AddrPort, err error) {
-	select {
-	case <-c.closedCh:
-		return 0, netip.AddrPort{}, net.ErrClosed
-	case pkt := <-c.in:
-		n = copy(p, pkt.Payload)
-		pkt.Trace("PacketConn.ReadFrom")
-		return n, pkt.Src, nil
+	for {
+		c.mu.Lock()
+		deadline := c.readDeadline
+		if c.deadlineChanged == nil {
+			c.deadlineChanged = make(chan struct{})
+		}
+		changed := c.deadlineChanged
+		c.mu.Unlock()
+
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, netip.AddrPort{}, os.ErrDeadlineExceeded
+			}
+			t := time.NewTimer(d)
+			timeout = t.C
+			defer t.Stop()
+		}
+
+		select {
+		case <-c.closedCh:
+			return 0, netip.AddrPort{}, net.ErrClosed
+		case pkt := <-c.in:
+			n = copy(p, pkt.Payload)
+			pkt.Trace("PacketConn.ReadFrom")
+			return n, pkt.Src, nil
+		case <-timeout:
+			return 0, netip.AddrPort{}, os.ErrDeadlineExceeded
+		case <-changed:
+			// Wait again with the new deadline.
+		}
 	}
 }
 
@@ -792,11 +847,21 @@ func (c *conn) WriteToUDPAddrPort(p []byte, ipp netip.AddrPort) (n int, err erro
 }
 
 func (c *conn) SetDeadline(t time.Time) error {
-	panic("SetWriteDeadline unsupported; TODO when needed")
+	return c.SetReadDeadline(t)
 }
+
+// SetWriteDeadline does nothing, as writes never block.
 func (c *conn) SetWriteDeadline(t time.Time) error {
-	panic("SetWriteDeadline unsupported; TODO when needed")
+	return nil
 }
+
 func (c *conn) SetReadDeadline(t time.Time) error {
-	panic("SetReadDeadline unsupported; TODO when needed")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	if c.deadlineChanged != nil {
+		close(c.deadlineChanged)
+		c.deadlineChanged = nil
+	}
+	return nil
 }
@@ -5,9 +5,11 @@
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/netip"
+	"os"
 	"testing"
 	"time"
 
@@ -81,6 +83,48 @@ func TestSendPacket(t *testing.T) {
 	}
 }
 
+func TestLossRate(t *testing.T) {
+	internet := NewInternet()
+	internet.LossRate = 1
+
+	foo := &Machine{Name: "foo"}
+	bar := &Machine{Name: "bar"}
+	foo.Attach("eth0", internet)
+	barAddr := netip.AddrPortFrom(bar.Attach("eth0", internet).V4(), 456)
+
+	ctx := context.Background()
+	fooPC, err := foo.ListenPacket(ctx, "udp4", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	barPC, err := bar.ListenPacket(ctx, "udp4", barAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fooPC.WriteTo([]byte("lost"), net.UDPAddrFromAddrPort(barAddr)); err != nil {
+		t.Fatal(err)
+	}
+	barPC.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	buf := make([]byte, 1500)
+	if n, _, err := barPC.ReadFrom(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("ReadFrom = %q, %v; want deadline exceeded", buf[:n], err)
+	}
+
+	internet.LossRate = 0
+	barPC.SetReadDeadline(time.Time{})
+	if _, err := fooPC.WriteTo([]byte("found"), net.UDPAddrFromAddrPort(barAddr)); err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := barPC.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "found" {
+		t.Errorf("read %q; want %q", got, "found")
+	}
+}
+
 func TestMultiNetwork(t *testing.T) {
 	lan := &Network{
 		Name:    "lan",
@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dnstype
+
+import "time"
+
+// Routes of a DNS query through the Tailscale resolver, as reported in
+// [QueryTrace.Route].
+const (
+	RouteMagicDNS = "magicdns" // answered from the tailnet's own records
+	RouteZone     = "zone"     // answered by a zone handler, such as for VIP services
+	RouteSplit    = "split"    // forwarded per the split DNS route for a suffix
+	RouteDefault  = "default"  // forwarded to the default resolvers
+	RouteFallback = "fallback" // forwarded to the host's resolvers, none being configured
+	RouteNone     = "none"     // no resolvers to forward to
+)
+
+// QueryTrace describes how the Tailscale resolver (100.100.100.100)
+// resolved a DNS query, for debugging.
+type QueryTrace struct {
+	// Route is how the query was routed; one of the Route constants.
+	Route string
+
+	// RouteSuffix is the domain suffix of the split DNS route, if Route is
+	// RouteSplit.
+	RouteSuffix string `json:",omitempty"`
+
+	// Upstreams are the upstream resolvers the query was forwarded to, if
+	// any, in the order they were to be queried.
+	Upstreams []UpstreamTrace `json:",omitempty"`
+
+	// Duration is how long resolving the query took.
+	Duration time.Duration
+}
+
+// UpstreamTrace describes the forwarding of a query to an upstream resolver.
+type UpstreamTrace struct {
+	// Addr is the address of the resolver, as in [Resolver.Addr].
+	Addr string
+
+	// StartDelay is how long the query was to wait before being sent to
+	// the resolver, racing the resolvers before it.
+	StartDelay time.Duration `json:",omitempty"`
+
+	// Sent is whether the query was sent, rather than answered by another
+	// resolver first.
+	Sent bool
+
+	// Transport is how the response arrived: "udp", "tcp", "doh", or
+	// "peerapi-doh" for the DNS proxy of an exit node or app connector.
+	Transport string `json:",omitempty"`
+
+	// Duration is how long the resolver took to respond or fail.
+	Duration time.Duration `json:",omitempty"`
+
+	// Answered is whether the response of the resolver was the one used.
+	Answered bool `json:",omitempty"`
+
+	// Err is the error querying the resolver, if any.
+	Err string `json:",omitempty"`
+}
@@ -0,0 +1,28 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package netstacktype defines types for configuring the userspace
+// (gVisor-based) network stack.
+package netstacktype
+
+// TCPConfig is the tunable TCP configuration of the userspace network stack.
+//
+// The zero value of each field means to use netstack's platform default.
+// Changes only apply to TCP connections created after they're made.
+type TCPConfig struct {
+	// ReceiveBufferMax is the maximum TCP receive buffer size in bytes,
+	// which caps the advertised receive window.
+	ReceiveBufferMax int `json:",omitempty"`
+
+	// SendBufferMax is the maximum TCP send buffer size in bytes, which
+	// caps the send window.
+	SendBufferMax int `json:",omitempty"`
+
+	// RACK is whether to enable RACK-TLP loss detection. It's disabled
+	// by default; see https://github.com/tailscale/tailscale/issues/9707.
+	RACK bool `json:",omitempty"`
+
+	// CongestionControl is the name of the TCP congestion control
+	// algorithm to use: "reno" or "cubic". Empty means "reno".
+	CongestionControl string `json:",omitempty"`
+}
@@ -30,5 +30,6 @@ func NewCounter(string) *Metric                   { return &zeroMetric }
 func NewGauge(string) *Metric                     { return &zeroMetric }
 func NewAggregateCounter(string) *Metric          { return &zeroMetric }
 func NewCounterFunc(string, func() int64) *Metric { return &zeroMetric }
+func NewGaugeFunc(string, func() int64) *Metric   { return &zeroMetric }
 
 func ResetForTest(any) {}
@@ -73,6 +73,7 @@ func (f *FakeNetfilterRunner) AddSNATRule() error                        { retur
 func (f *FakeNetfilterRunner) DelSNATRule() error                        { return nil }
 func (f *FakeNetfilterRunner) AddConnmarkSaveRule() error                { return nil }
 func (f *FakeNetfilterRunner) DelConnmarkSaveRule() error                { return nil }
+func (f *FakeNetfilterRunner) DelAppRules() error                        { return nil }
 func (f *FakeNetfilterRunner) AddStatefulRule(tunname string) error      { return nil }
 func (f *FakeNetfilterRunner) DelStatefulRule(tunname string) error      { return nil }
 func (f *FakeNetfilterRunner) AddLoopbackRule(addr netip.Addr) error     { return nil }
@@ -81,8 +82,12 @@ func (f *FakeNetfilterRunner) AddDNATRule(origDst, dst netip.Addr) error { retur
 func (f *FakeNetfilterRunner) DNATWithLoadBalancer(origDst netip.Addr, dsts []netip.Addr) error {
 	return nil
 }
+func (f *FakeNetfilterRunner) SetAppRules(tunname string, excludeApps, requireTunnelApps []string) error {
+	return nil
+}
 func (f *FakeNetfilterRunner) EnsureSNATForDst(src, dst netip.Addr) error               { return nil }
 func (f *FakeNetfilterRunner) DNATNonTailscaleTraffic(tun string, dst netip.Addr) error { return nil }
+func (f *FakeNetfilterRunner) EnsureOutputDNATRule(origDst, dst netip.Addr) error       { return nil }
 func (f *FakeNetfilterRunner) ClampMSSToPMTU(tun string, addr netip.Addr) error         { return nil }
 func (f *FakeNetfilterRunner) AddMagicsockPortRule(port uint16, network string) error   { return nil }
 func (f *FakeNetfilterRunner) DelMagicsockPortRule(port uint16, network string) error   { return nil }
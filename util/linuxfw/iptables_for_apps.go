@@ -0,0 +1,88 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"errors"
+	"fmt"
+)
+
+// appRuleArgs returns the arguments for the rules in the ts-apps chain that
+// route traffic from the cgroups in excludeApps and requireTunnelApps, and
+// an error for each cgroup that doesn't exist. Rules for missing cgroups
+// are left out, as iptables can't add them.
+func appRuleArgs(tunname string, excludeApps, requireTunnelApps []string) (rules [][]string, errs []error) {
+	for _, p := range excludeApps {
+		if _, _, err := cgroupV2ID(p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules, []string{"-m", "cgroup", "--path", p, "-j", "MARK", "--set-mark", bypassMark + "/" + fwmarkMask})
+	}
+	for _, p := range requireTunnelApps {
+		if _, _, err := cgroupV2ID(p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules,
+			[]string{"-m", "cgroup", "--path", p, "-o", "lo", "-j", "RETURN"},
+			[]string{"-m", "cgroup", "--path", p, "!", "-o", tunname, "-j", "DROP"},
+		)
+	}
+	return rules, errs
+}
+
+// SetAppRules replaces the rules in mangle/ts-apps with ones that route
+// traffic from the processes in the given cgroup v2 paths, and hooks the
+// chain into mangle/OUTPUT if needed.
+//
+// The jump is inserted at the top of mangle/OUTPUT, ahead of the connmark
+// save rule, so that the bypass mark is saved to conntrack and restored on
+// replies.
+func (i *iptablesRunner) SetAppRules(tunname string, excludeApps, requireTunnelApps []string) error {
+	rules, errs := appRuleArgs(tunname, excludeApps, requireTunnelApps)
+	for _, ipt := range i.getTables() {
+		if err := ipt.ClearChain("mangle", appsChain); err != nil {
+			if !isNotExistError(err) {
+				return fmt.Errorf("flushing mangle/%s: %w", appsChain, err)
+			}
+			if err := ipt.NewChain("mangle", appsChain); err != nil {
+				return fmt.Errorf("creating mangle/%s: %w", appsChain, err)
+			}
+		}
+		for _, args := range rules {
+			if err := ipt.Append("mangle", appsChain, args...); err != nil {
+				return fmt.Errorf("adding %v in mangle/%s: %w", args, appsChain, err)
+			}
+		}
+
+		args := []string{"-j", appsChain}
+		exists, err := ipt.Exists("mangle", "OUTPUT", args...)
+		if err != nil {
+			return fmt.Errorf("checking for %v in mangle/OUTPUT: %w", args, err)
+		}
+		if !exists {
+			if err := ipt.Insert("mangle", "OUTPUT", 1, args...); err != nil {
+				return fmt.Errorf("adding %v in mangle/OUTPUT: %w", args, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DelAppRules removes the rules and chain added by SetAppRules.
+func (i *iptablesRunner) DelAppRules() error {
+	for _, ipt := range i.getTables() {
+		args := []string{"-j", appsChain}
+		if err := ipt.Delete("mangle", "OUTPUT", args...); err != nil && !isNotExistError(err) {
+			return fmt.Errorf("deleting %v in mangle/OUTPUT: %w", args, err)
+		}
+		if err := delChain(ipt, "mangle", appsChain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -256,6 +256,21 @@ func (i *iptablesRunner) AddDNATRule(origDst, dst netip.Addr) error {
 	return table.Insert("nat", "PREROUTING", 1, "--destination", origDst.String(), "-j", "DNAT", "--to-destination", dst.String())
 }
 
+// EnsureOutputDNATRule ensures a rule in the nat/OUTPUT chain that DNATs
+// locally generated traffic destined for origDst to dst.
+func (i *iptablesRunner) EnsureOutputDNATRule(origDst, dst netip.Addr) error {
+	table := i.getIPTByAddr(dst)
+	args := []string{"--destination", origDst.String(), "-j", "DNAT", "--to-destination", dst.String()}
+	exists, err := table.Exists("nat", "OUTPUT", args...)
+	if err != nil {
+		return fmt.Errorf("error checking for output DNAT rule: %w", err)
+	}
+	if exists {
+		return nil
+	}
+	return table.Insert("nat", "OUTPUT", 1, args...)
+}
+
 // EnsureSNATForDst sets up firewall to ensure that all traffic aimed for dst, has its source ip set to src:
 // - creates a SNAT rule if not already present
 // - ensures that any no longer valid SNAT rules for the same dst are removed
@@ -671,6 +686,9 @@ func (i *iptablesRunner) DelMagicsockPortRule(port uint16, network string) error
 // for handling non-Tailscale CGNAT traffic, since these rules need to be
 // identical across [AddExternalCGNATRules] and [DelExternalCGNATRules].
 func buildExternalCGNATRules(mode CGNATMode, tunname string) ([][]string, error) {
+	if prefix, ok := tunFamilyPrefix(tunname); ok {
+		tunname = prefix + "+"
+	}
 	switch mode {
 	case CGNATModeDrop:
 		// Only allow CGNAT range traffic to come from the Tailscale interface.
@@ -693,7 +711,9 @@ func buildExternalCGNATRules(mode CGNATMode, tunname string) ([][]string, error)
 
 // AddExternalCGNATRules adds rules to the ts-input chain to deal with
 // traffic from the CGNAT range that arrives on non-Tailscale network
-// interfaces.
+// interfaces. If tunname is a default name like "tailscale0", the TUN
+// interfaces of other tailscaleds on the machine, such as "tailscale1", are
+// not affected.
 func (i *iptablesRunner) AddExternalCGNATRules(mode CGNATMode, tunname string) error {
 	rules, err := buildExternalCGNATRules(mode, tunname)
 	if err != nil {
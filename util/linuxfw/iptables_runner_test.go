@@ -7,6 +7,7 @@
 
 import (
 	"net/netip"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -555,3 +556,35 @@ func TestAddAndDelCGNATRules(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildExternalCGNATRulesTUNFamily(t *testing.T) {
+	rules, err := buildExternalCGNATRules(CGNATModeReturn, "tailscale1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"!", "-i", "tailscale+", "-s", tsaddr.CGNATRange().String(), "-j", "RETURN"}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("rules = %q; want %q", rules, want)
+	}
+}
+
+func TestTUNFamilyPrefix(t *testing.T) {
+	tests := []struct {
+		tunname    string
+		wantPrefix string
+		wantOK     bool
+	}{
+		{"tailscale0", "tailscale", true},
+		{"tailscale12", "tailscale", true},
+		{"tailscale", "", false},
+		{"tailscale0a", "", false},
+		{"tun0", "", false},
+		{"wg0", "", false},
+	}
+	for _, tt := range tests {
+		prefix, ok := tunFamilyPrefix(tt.tunname)
+		if prefix != tt.wantPrefix || ok != tt.wantOK {
+			t.Errorf("tunFamilyPrefix(%q) = %q, %v; want %q, %v", tt.tunname, prefix, ok, tt.wantPrefix, tt.wantOK)
+		}
+	}
+}
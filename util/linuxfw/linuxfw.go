@@ -12,6 +12,7 @@
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/tailscale/netlink"
 	"tailscale.com/feature"
@@ -101,6 +102,51 @@ func getTailscaleSubnetRouteMark() []byte {
 	return []byte{0x00, 0x04, 0x00, 0x00}
 }
 
+// getTailscaleBypassMark returns the TailscaleBypassMark in bytes.
+func getTailscaleBypassMark() []byte {
+	return []byte{0x00, 0x08, 0x00, 0x00}
+}
+
+// tunFamilyPrefix returns the name of the TUN interface tunname without its
+// trailing number, if it's one of the default-named "tailscale0",
+// "tailscale1", etc.
+//
+// Rules about traffic that doesn't come from the Tailscale interface use it
+// rather than tunname, so that they don't apply to the TUN interfaces of
+// other tailscaleds on the machine, such as to tailscale1's traffic by the
+// rules of tailscale0's tailscaled. Other names, which might share a prefix
+// with unrelated interfaces such as other VPNs' "tun1", are left alone.
+func tunFamilyPrefix(tunname string) (prefix string, ok bool) {
+	const family = "tailscale"
+	num, ok := strings.CutPrefix(tunname, family)
+	if !ok || num == "" || strings.TrimLeft(num, "0123456789") != "" {
+		return "", false
+	}
+	return family, true
+}
+
+// appsChain is the chain in the mangle table, hooked into OUTPUT, that
+// holds the per-app routing rules added by SetAppRules.
+const appsChain = "ts-apps"
+
+// cgroupV2Root is where the unified cgroup hierarchy is mounted.
+const cgroupV2Root = "/sys/fs/cgroup"
+
+// cgroupV2ID returns the ID of the cgroup at path, relative to the cgroup2
+// mount, and its depth in the hierarchy. The ID is the inode number of the
+// cgroup's directory, which is what the kernel matches sockets against.
+func cgroupV2ID(path string) (id uint64, level uint32, err error) {
+	fi, err := os.Stat(cgroupV2Root + path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cgroup %q: %w", path, err)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || !fi.IsDir() {
+		return 0, 0, fmt.Errorf("cgroup %q: not a cgroup directory", path)
+	}
+	return st.Ino, uint32(strings.Count(strings.Trim(path, "/"), "/") + 1), nil
+}
+
 // checkIPv6ForTest can be set in tests.
 var checkIPv6ForTest func(logger.Logf) error
 
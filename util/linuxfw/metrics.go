@@ -0,0 +1,267 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"errors"
+	"expvar"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/usermetric"
+)
+
+type ruleOpLabel struct {
+	mode   string `prom:"mode"`   // "iptables" or "nftables"
+	op     string `prom:"op"`     // "add" or "delete"
+	rule   string `prom:"rule"`   // kind of rule, such as "loopback" or "snat"
+	result string `prom:"result"` // "ok" or "error"
+}
+
+type ruleErrorLabel struct {
+	mode string `prom:"mode"`
+	code string `prom:"code"` // see errorCode
+}
+
+type modeLabel struct {
+	mode string `prom:"mode"`
+}
+
+// Metrics holds the user metrics for firewall rule operations. Use
+// [Instrument] to record the operations of a [NetfilterRunner] in it.
+type Metrics struct {
+	ruleOps    *usermetric.MultiLabelMap[ruleOpLabel]
+	ruleErrors *usermetric.MultiLabelMap[ruleErrorLabel]
+
+	// lastSync is the Unix time of the last successful rule operation, by
+	// firewall mode. It's set up in NewMetrics and safe for concurrent
+	// reads.
+	lastSync map[FirewallMode]*expvar.Int
+}
+
+// NewMetrics returns a new Metrics registered with reg.
+//
+// It will panic if called twice with the same registry.
+func NewMetrics(reg *usermetric.Registry) *Metrics {
+	m := &Metrics{
+		ruleOps: usermetric.NewMultiLabelMapWithRegistry[ruleOpLabel](
+			reg,
+			"tailscaled_firewall_rule_operations_total",
+			"counter",
+			"Number of firewall rule add and delete operations by firewall mode, operation, rule kind and result",
+		),
+		ruleErrors: usermetric.NewMultiLabelMapWithRegistry[ruleErrorLabel](
+			reg,
+			"tailscaled_firewall_rule_errors_total",
+			"counter",
+			"Number of failed firewall rule operations by firewall mode and kernel error code",
+		),
+		lastSync: map[FirewallMode]*expvar.Int{
+			FirewallModeIPTables: {},
+			FirewallModeNfTables: {},
+		},
+	}
+	lastSync := usermetric.NewMultiLabelMapWithRegistry[modeLabel](
+		reg,
+		"tailscaled_firewall_last_sync_timestamp_seconds",
+		"gauge",
+		"Unix time of the last successful firewall rule operation by firewall mode",
+	)
+	for mode, v := range m.lastSync {
+		lastSync.Set(modeLabel{string(mode)}, v)
+	}
+	return m
+}
+
+// record records the result of an operation on a rule of the given kind.
+// It returns err, for convenience.
+func (m *Metrics) record(mode FirewallMode, op, rule string, err error) error {
+	l := ruleOpLabel{mode: string(mode), op: op, rule: rule, result: "ok"}
+	if err != nil {
+		l.result = "error"
+		m.ruleErrors.Add(ruleErrorLabel{mode: string(mode), code: errorCode(err)}, 1)
+	} else if v, ok := m.lastSync[mode]; ok {
+		v.Set(time.Now().Unix())
+	}
+	m.ruleOps.Add(l, 1)
+	return err
+}
+
+// errorCode returns a short, stable description of the failure behind err
+// for use as a metric label: the errno name (such as "EPERM") for errors
+// from the kernel, the exit status (such as "exit_4") for failed iptables
+// commands, or "other".
+func errorCode(err error) string {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		if name := unix.ErrnoName(errno); name != "" {
+			return name
+		}
+		return "errno_" + strconv.Itoa(int(errno))
+	}
+	var exitErr interface{ ExitStatus() int }
+	if errors.As(err, &exitErr) {
+		return "exit_" + strconv.Itoa(exitErr.ExitStatus())
+	}
+	return "other"
+}
+
+// Instrument returns a NetfilterRunner that runs rule operations with nfr
+// and records them in m. If m is nil, it returns nfr.
+func Instrument(nfr NetfilterRunner, m *Metrics) NetfilterRunner {
+	if m == nil || nfr == nil {
+		return nfr
+	}
+	var mode FirewallMode
+	switch nfr.(type) {
+	case *iptablesRunner:
+		mode = FirewallModeIPTables
+	case *nftablesRunner:
+		mode = FirewallModeNfTables
+	}
+	return &instrumentedRunner{NetfilterRunner: nfr, mode: mode, m: m}
+}
+
+// instrumentedRunner is a NetfilterRunner that records the rule operations
+// of the NetfilterRunner it wraps.
+type instrumentedRunner struct {
+	NetfilterRunner
+	mode FirewallMode
+	m    *Metrics
+}
+
+const (
+	opAdd    = "add"
+	opDelete = "delete"
+)
+
+func (r *instrumentedRunner) AddLoopbackRule(addr netip.Addr) error {
+	return r.m.record(r.mode, opAdd, "loopback", r.NetfilterRunner.AddLoopbackRule(addr))
+}
+
+func (r *instrumentedRunner) DelLoopbackRule(addr netip.Addr) error {
+	return r.m.record(r.mode, opDelete, "loopback", r.NetfilterRunner.DelLoopbackRule(addr))
+}
+
+func (r *instrumentedRunner) AddHooks() error {
+	return r.m.record(r.mode, opAdd, "hooks", r.NetfilterRunner.AddHooks())
+}
+
+func (r *instrumentedRunner) DelHooks(logf logger.Logf) error {
+	return r.m.record(r.mode, opDelete, "hooks", r.NetfilterRunner.DelHooks(logf))
+}
+
+func (r *instrumentedRunner) AddChains() error {
+	return r.m.record(r.mode, opAdd, "chains", r.NetfilterRunner.AddChains())
+}
+
+func (r *instrumentedRunner) DelChains() error {
+	return r.m.record(r.mode, opDelete, "chains", r.NetfilterRunner.DelChains())
+}
+
+func (r *instrumentedRunner) AddBase(tunname string) error {
+	return r.m.record(r.mode, opAdd, "base", r.NetfilterRunner.AddBase(tunname))
+}
+
+func (r *instrumentedRunner) DelBase() error {
+	return r.m.record(r.mode, opDelete, "base", r.NetfilterRunner.DelBase())
+}
+
+func (r *instrumentedRunner) AddSNATRule() error {
+	return r.m.record(r.mode, opAdd, "snat", r.NetfilterRunner.AddSNATRule())
+}
+
+func (r *instrumentedRunner) DelSNATRule() error {
+	return r.m.record(r.mode, opDelete, "snat", r.NetfilterRunner.DelSNATRule())
+}
+
+func (r *instrumentedRunner) AddStatefulRule(tunname string) error {
+	return r.m.record(r.mode, opAdd, "stateful", r.NetfilterRunner.AddStatefulRule(tunname))
+}
+
+func (r *instrumentedRunner) DelStatefulRule(tunname string) error {
+	return r.m.record(r.mode, opDelete, "stateful", r.NetfilterRunner.DelStatefulRule(tunname))
+}
+
+func (r *instrumentedRunner) AddConnmarkSaveRule() error {
+	return r.m.record(r.mode, opAdd, "connmark_save", r.NetfilterRunner.AddConnmarkSaveRule())
+}
+
+func (r *instrumentedRunner) DelConnmarkSaveRule() error {
+	return r.m.record(r.mode, opDelete, "connmark_save", r.NetfilterRunner.DelConnmarkSaveRule())
+}
+
+func (r *instrumentedRunner) SetAppRules(tunname string, excludeApps, requireTunnelApps []string) error {
+	return r.m.record(r.mode, opAdd, "apps", r.NetfilterRunner.SetAppRules(tunname, excludeApps, requireTunnelApps))
+}
+
+func (r *instrumentedRunner) DelAppRules() error {
+	return r.m.record(r.mode, opDelete, "apps", r.NetfilterRunner.DelAppRules())
+}
+
+func (r *instrumentedRunner) AddDNATRule(origDst, dst netip.Addr) error {
+	return r.m.record(r.mode, opAdd, "dnat", r.NetfilterRunner.AddDNATRule(origDst, dst))
+}
+
+func (r *instrumentedRunner) DNATWithLoadBalancer(origDst netip.Addr, dsts []netip.Addr) error {
+	return r.m.record(r.mode, opAdd, "dnat_load_balancer", r.NetfilterRunner.DNATWithLoadBalancer(origDst, dsts))
+}
+
+func (r *instrumentedRunner) EnsureSNATForDst(src, dst netip.Addr) error {
+	return r.m.record(r.mode, opAdd, "snat_for_dst", r.NetfilterRunner.EnsureSNATForDst(src, dst))
+}
+
+func (r *instrumentedRunner) DNATNonTailscaleTraffic(exemptInterface string, dst netip.Addr) error {
+	return r.m.record(r.mode, opAdd, "dnat_non_tailscale", r.NetfilterRunner.DNATNonTailscaleTraffic(exemptInterface, dst))
+}
+
+func (r *instrumentedRunner) EnsureOutputDNATRule(origDst, dst netip.Addr) error {
+	return r.m.record(r.mode, opAdd, "output_dnat", r.NetfilterRunner.EnsureOutputDNATRule(origDst, dst))
+}
+
+func (r *instrumentedRunner) EnsurePortMapRuleForSvc(svc, tun string, targetIP netip.Addr, pm PortMap) error {
+	return r.m.record(r.mode, opAdd, "svc_port_map", r.NetfilterRunner.EnsurePortMapRuleForSvc(svc, tun, targetIP, pm))
+}
+
+func (r *instrumentedRunner) DeletePortMapRuleForSvc(svc, tun string, targetIP netip.Addr, pm PortMap) error {
+	return r.m.record(r.mode, opDelete, "svc_port_map", r.NetfilterRunner.DeletePortMapRuleForSvc(svc, tun, targetIP, pm))
+}
+
+func (r *instrumentedRunner) EnsureDNATRuleForSvc(svcName string, origDst, dst netip.Addr) error {
+	return r.m.record(r.mode, opAdd, "svc_dnat", r.NetfilterRunner.EnsureDNATRuleForSvc(svcName, origDst, dst))
+}
+
+func (r *instrumentedRunner) DeleteDNATRuleForSvc(svcName string, origDst, dst netip.Addr) error {
+	return r.m.record(r.mode, opDelete, "svc_dnat", r.NetfilterRunner.DeleteDNATRuleForSvc(svcName, origDst, dst))
+}
+
+func (r *instrumentedRunner) DeleteSvc(svc, tun string, targetIPs []netip.Addr, pm []PortMap) error {
+	return r.m.record(r.mode, opDelete, "svc", r.NetfilterRunner.DeleteSvc(svc, tun, targetIPs, pm))
+}
+
+func (r *instrumentedRunner) ClampMSSToPMTU(tun string, addr netip.Addr) error {
+	return r.m.record(r.mode, opAdd, "clamp_mss", r.NetfilterRunner.ClampMSSToPMTU(tun, addr))
+}
+
+func (r *instrumentedRunner) AddMagicsockPortRule(port uint16, network string) error {
+	return r.m.record(r.mode, opAdd, "magicsock_port", r.NetfilterRunner.AddMagicsockPortRule(port, network))
+}
+
+func (r *instrumentedRunner) DelMagicsockPortRule(port uint16, network string) error {
+	return r.m.record(r.mode, opDelete, "magicsock_port", r.NetfilterRunner.DelMagicsockPortRule(port, network))
+}
+
+func (r *instrumentedRunner) AddExternalCGNATRules(mode CGNATMode, tunname string) error {
+	return r.m.record(r.mode, opAdd, "external_cgnat", r.NetfilterRunner.AddExternalCGNATRules(mode, tunname))
+}
+
+func (r *instrumentedRunner) DelExternalCGNATRules(mode CGNATMode, tunname string) error {
+	return r.m.record(r.mode, opDelete, "external_cgnat", r.NetfilterRunner.DelExternalCGNATRules(mode, tunname))
+}
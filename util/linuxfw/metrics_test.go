@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net/netip"
+	"syscall"
+	"testing"
+
+	"tailscale.com/util/usermetric"
+)
+
+type fakeExitError int
+
+func (e fakeExitError) Error() string   { return fmt.Sprintf("exit status %d", int(e)) }
+func (e fakeExitError) ExitStatus() int { return int(e) }
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{syscall.EPERM, "EPERM"},
+		{fmt.Errorf("conn.Receive: %w", syscall.ENOENT), "ENOENT"},
+		{fmt.Errorf("running iptables: %w", fakeExitError(4)), "exit_4"},
+		{errors.New("boom"), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorCode(tt.err); got != tt.want {
+			t.Errorf("errorCode(%v) = %q; want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	m := NewMetrics(new(usermetric.Registry))
+	nfr := Instrument(NewFakeIPTablesRunner(), m)
+
+	if err := nfr.AddChains(); err != nil {
+		t.Fatal(err)
+	}
+	if err := nfr.DelLoopbackRule(netip.MustParseAddr("100.64.0.1")); err == nil {
+		t.Fatal("deleting a missing loopback rule succeeded")
+	}
+
+	count := func(v expvar.Var) string {
+		if v == nil {
+			return "0"
+		}
+		return v.String()
+	}
+	ops := []struct {
+		l    ruleOpLabel
+		want string
+	}{
+		{ruleOpLabel{mode: "iptables", op: opAdd, rule: "chains", result: "ok"}, "1"},
+		{ruleOpLabel{mode: "iptables", op: opDelete, rule: "loopback", result: "error"}, "1"},
+		{ruleOpLabel{mode: "iptables", op: opDelete, rule: "loopback", result: "ok"}, "0"},
+	}
+	for _, tt := range ops {
+		if got := count(m.ruleOps.Get(tt.l)); got != tt.want {
+			t.Errorf("ruleOps[%+v] = %s; want %s", tt.l, got, tt.want)
+		}
+	}
+	if got := count(m.ruleErrors.Get(ruleErrorLabel{mode: "iptables", code: "other"})); got != "1" {
+		t.Errorf("ruleErrors = %s; want 1", got)
+	}
+	if m.lastSync[FirewallModeIPTables].Value() == 0 {
+		t.Error("iptables last sync time not set")
+	}
+	if m.lastSync[FirewallModeNfTables].Value() != 0 {
+		t.Error("nftables last sync time set")
+	}
+}
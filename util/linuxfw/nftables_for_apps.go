@@ -0,0 +1,159 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+)
+
+// appsChainPriority is the priority of the ts-apps chain. It runs just
+// before the mangle OUTPUT chain that holds the connmark save rule, so that
+// the bypass mark is saved to conntrack and restored on replies.
+var appsChainPriority = nftables.ChainPriorityRef(*nftables.ChainPriorityMangle - 1)
+
+// makeCgroupMatchExprs returns expressions that match packets from sockets
+// in the cgroup with the given ID at the given level of the hierarchy.
+func makeCgroupMatchExprs(id uint64, level uint32) []expr.Any {
+	return []expr.Any{
+		&expr.Socket{
+			Key:      expr.SocketKeyCgroupv2,
+			Level:    level,
+			Register: 1,
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     binaryutil.NativeEndian.PutUint64(id),
+		},
+	}
+}
+
+// makeAppExcludeExprs returns expressions that set the bypass mark on
+// packets from the given cgroup.
+// Implements: socket cgroupv2 level L ID meta mark set meta mark & 0xff00ffff | 0x80000
+func makeAppExcludeExprs(id uint64, level uint32) []expr.Any {
+	return append(makeCgroupMatchExprs(id, level),
+		&expr.Meta{Key: expr.MetaKeyMARK, Register: 1},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           getTailscaleFwmarkMaskNeg(),
+			Xor:            getTailscaleBypassMark(),
+		},
+		&expr.Meta{
+			Key:            expr.MetaKeyMARK,
+			SourceRegister: true,
+			Register:       1,
+		},
+	)
+}
+
+// makeAppRequireTunnelExprs returns expressions that drop packets from the
+// given cgroup that would leave via an interface other than tunname or
+// loopback.
+// Implements: socket cgroupv2 level L ID oifname != tunname oifname != "lo" drop
+func makeAppRequireTunnelExprs(tunname string, id uint64, level uint32) []expr.Any {
+	return append(makeCgroupMatchExprs(id, level),
+		&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+		&expr.Cmp{
+			Op:       expr.CmpOpNeq,
+			Register: 1,
+			Data:     []byte(tunname),
+		},
+		// Include the NUL terminator so that only "lo" itself matches,
+		// not every interface whose name starts with "lo".
+		&expr.Cmp{
+			Op:       expr.CmpOpNeq,
+			Register: 1,
+			Data:     []byte("lo\x00"),
+		},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	)
+}
+
+// SetAppRules replaces the rules in the ts-apps chain of the mangle table
+// with ones that route traffic from the processes in the given cgroup v2
+// paths, creating the chain if needed.
+func (n *nftablesRunner) SetAppRules(tunname string, excludeApps, requireTunnelApps []string) error {
+	var rules [][]expr.Any
+	var errs []error
+	for _, p := range excludeApps {
+		id, level, err := cgroupV2ID(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules, makeAppExcludeExprs(id, level))
+	}
+	for _, p := range requireTunnelApps {
+		id, level, err := cgroupV2ID(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules, makeAppRequireTunnelExprs(tunname, id, level))
+	}
+
+	conn := n.conn
+	for _, table := range n.getTables() {
+		mangleTable := conn.AddTable(&nftables.Table{
+			Family: table.Proto,
+			Name:   "mangle",
+		})
+		// The chain is of type route so that the kernel redoes the
+		// routing lookup for packets whose mark we change.
+		chain, err := getOrCreateChain(conn, chainInfo{
+			table:         mangleTable,
+			name:          appsChain,
+			chainType:     nftables.ChainTypeRoute,
+			chainHook:     nftables.ChainHookOutput,
+			chainPriority: appsChainPriority,
+		})
+		if err != nil {
+			return fmt.Errorf("get %s chain: %w", appsChain, err)
+		}
+		conn.FlushChain(chain)
+		for _, exprs := range rules {
+			conn.AddRule(&nftables.Rule{
+				Table: mangleTable,
+				Chain: chain,
+				Exprs: exprs,
+			})
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("flush add app rules: %w", err)
+	}
+	return errors.Join(errs...)
+}
+
+// DelAppRules removes the ts-apps chain added by SetAppRules.
+func (n *nftablesRunner) DelAppRules() error {
+	conn := n.conn
+	for _, table := range n.getTables() {
+		mangleTable := &nftables.Table{
+			Family: table.Proto,
+			Name:   "mangle",
+		}
+		chain, err := getChainFromTable(conn, mangleTable, appsChain)
+		if err != nil {
+			// Chain doesn't exist; nothing to do.
+			continue
+		}
+		conn.FlushChain(chain)
+		conn.DelChain(chain)
+	}
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("flush del app rules: %w", err)
+	}
+	return nil
+}
@@ -111,6 +111,37 @@ func (n *nftablesRunner) AddDNATRule(origDst netip.Addr, dst netip.Addr) error {
 	return n.conn.Flush()
 }
 
+func (n *nftablesRunner) EnsureOutputDNATRule(origDst, dst netip.Addr) error {
+	polAccept := nftables.ChainPolicyAccept
+	table, err := n.getNFTByAddr(dst)
+	if err != nil {
+		return fmt.Errorf("error setting up nftables for IP family of %v: %w", dst, err)
+	}
+	nat, err := createTableIfNotExist(n.conn, table.Proto, "nat")
+	if err != nil {
+		return fmt.Errorf("error ensuring nat table: %w", err)
+	}
+	outputCh, err := getOrCreateChain(n.conn, chainInfo{
+		table:         nat,
+		name:          "OUTPUT",
+		chainType:     nftables.ChainTypeNAT,
+		chainHook:     nftables.ChainHookOutput,
+		chainPriority: nftables.ChainPriorityNATDest,
+		chainPolicy:   &polAccept,
+	})
+	if err != nil {
+		return fmt.Errorf("error ensuring output chain: %w", err)
+	}
+	rule := dnatRuleForChain(nat, outputCh, origDst, dst, nil)
+	if existing, err := findRule(n.conn, rule); err != nil {
+		return err
+	} else if existing != nil {
+		return nil
+	}
+	n.conn.InsertRule(rule)
+	return n.conn.Flush()
+}
+
 func dnatRuleForChain(t *nftables.Table, ch *nftables.Chain, origDst, dst netip.Addr, meta []byte) *nftables.Rule {
 	var daddrOffset, fam, dadderLen uint32
 	if origDst.Is4() {
@@ -534,6 +565,19 @@ type NetfilterRunner interface {
 	// DelConnmarkSaveRule removes conntrack marking rules added by AddConnmarkSaveRule.
 	DelConnmarkSaveRule() error
 
+	// SetAppRules replaces the per-app routing rules, which match traffic
+	// by the cgroup v2 path of the sending process. Traffic from
+	// excludeApps gets the bypass mark, so it's routed as if Tailscale
+	// weren't running; traffic from requireTunnelApps that would leave
+	// via an interface other than tunname or loopback is dropped.
+	//
+	// Rules are added for all cgroups that exist; the returned error
+	// lists the ones that don't.
+	SetAppRules(tunname string, excludeApps, requireTunnelApps []string) error
+
+	// DelAppRules removes the rules added by SetAppRules.
+	DelAppRules() error
+
 	// HasIPV6 reports true if the system supports IPv6.
 	HasIPV6() bool
 
@@ -573,6 +617,12 @@ type NetfilterRunner interface {
 	// the Tailscale interface, as used in the Kubernetes egress proxies.
 	DNATNonTailscaleTraffic(exemptInterface string, dst netip.Addr) error
 
+	// EnsureOutputDNATRule ensures a rule in the nat/OUTPUT chain that DNATs
+	// locally generated traffic destined for origDst to dst. This is used to
+	// route a Kubernetes Pod's traffic for a tailnet target to an egress
+	// proxy, without a proxy sidecar in the Pod.
+	EnsureOutputDNATRule(origDst, dst netip.Addr) error
+
 	EnsurePortMapRuleForSvc(svc, tun string, targetIP netip.Addr, pm PortMap) error
 
 	DeletePortMapRuleForSvc(svc, tun string, targetIP netip.Addr, pm PortMap) error
@@ -596,7 +646,9 @@ type NetfilterRunner interface {
 
 	// AddExternalCGNATRules adds rules to the ts-input chain to deal with
 	// traffic from the CGNAT range that arrives on non-Tailscale network
-	// interfaces.
+	// interfaces. If tunname is a default name like "tailscale0", the TUN
+	// interfaces of other tailscaleds on the machine, such as "tailscale1",
+	// are not affected.
 	AddExternalCGNATRules(mode CGNATMode, tunname string) error
 
 	// DelExternalCGNATRules removes the rules created by AddExternalCGNATRules,
@@ -1169,7 +1221,8 @@ func maskof(pfx netip.Prefix) []byte {
 
 // createRangeRule creates a rule that matches packets with source IP from the give
 // range (like CGNAT range or ChromeOSVM range) and the interface is not the tunname,
-// and makes the given decision. Only IPv4 is supported.
+// or another of its family (see tunFamilyPrefix), and makes the given decision.
+// Only IPv4 is supported.
 func createRangeRule(
 	table *nftables.Table, chain *nftables.Chain,
 	tunname string, rng netip.Prefix, decision expr.VerdictKind,
@@ -1177,6 +1230,11 @@ func createRangeRule(
 	if rng.Addr().Is6() {
 		return nil, errors.New("IPv6 is not supported")
 	}
+	if prefix, ok := tunFamilyPrefix(tunname); ok {
+		// Comparing fewer bytes than the name register holds
+		// matches by prefix, like iifname "tailscale*".
+		tunname = prefix
+	}
 	saddrExpr, err := newLoadSaddrExpr(nftables.TableFamilyIPv4, 1)
 	if err != nil {
 		return nil, fmt.Errorf("newLoadSaddrExpr: %w", err)
@@ -1590,7 +1648,9 @@ func (n *nftablesRunner) DelMagicsockPortRule(port uint16, network string) error
 
 // AddExternalCGNATRules adds rules to the ts-input chain to deal with
 // traffic from the CGNAT range that arrives on non-Tailscale network
-// interfaces.
+// interfaces. If tunname is a default name like "tailscale0", the TUN
+// interfaces of other tailscaleds on the machine, such as "tailscale1", are
+// not affected.
 func (n *nftablesRunner) AddExternalCGNATRules(mode CGNATMode, tunname string) error {
 	conn := n.conn
 
@@ -585,6 +585,51 @@ func getSecurityInfo() map[string]any {
 	return result
 }
 
+// AntivirusProduct describes an antivirus product registered with Windows
+// Security Center.
+type AntivirusProduct struct {
+	Name    string
+	Enabled bool // whether its state is on
+}
+
+// AntivirusProducts returns the antivirus products registered with Windows
+// Security Center. The COM runtime must already be started.
+func AntivirusProducts() ([]AntivirusProduct, error) {
+	productList, err := com.CreateInstance[wsc.WSCProductList](wsc.CLSID_WSCProductList)
+	if err != nil {
+		return nil, err
+	}
+	if err := productList.Initialize(wsc.WSC_SECURITY_PROVIDER_ANTIVIRUS); err != nil {
+		return nil, err
+	}
+	n, err := productList.GetCount()
+	if err != nil {
+		return nil, err
+	}
+	n = min(n, maxProvCount)
+
+	var ret []AntivirusProduct
+	for i := int32(0); i < n; i++ {
+		product, err := productList.GetItem(uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		name, err := product.GetProductName()
+		if err != nil {
+			return nil, err
+		}
+		state, err := product.GetProductState()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, AntivirusProduct{
+			Name:    name,
+			Enabled: state == wsc.WSC_SECURITY_PRODUCT_STATE_ON,
+		})
+	}
+	return ret, nil
+}
+
 type _MEMORYSTATUSEX struct {
 	Length               uint32
 	MemoryLoad           uint32
@@ -93,6 +93,15 @@
 	// installed. Its value is "InstallUpdates" because of an awkwardly-named
 	// visibility option "ApplyUpdates" on MacOS.
 	ApplyUpdates Key = "InstallUpdates"
+	// UpdateTrack is a string value that pins client updates to a release
+	// track ("stable", "release-candidate" or "unstable") or to an explicit
+	// version such as "1.84.2". Updates to other tracks or versions are
+	// refused. If blank, updates aren't pinned.
+	UpdateTrack Key = "UpdateTrack"
+	// AllowUpdateRollback is a boolean key that controls whether the
+	// "tailscale update --rollback" command may reinstall the version that
+	// was running before the most recent update. The default is true.
+	AllowUpdateRollback Key = "AllowUpdateRollback"
 	// EnableRunExitNode controls if the device acts as an exit node. Even when
 	// running as an exit node, the device must be approved by a tailnet
 	// administrator. Its name is slightly awkward because RunExitNodeVisibility
@@ -127,6 +136,11 @@
 	OnboardingFlowVisibility Key = "OnboardingFlow"
 
 	// Keys with a string value formatted for use with time.ParseDuration().
+
+	// KeyExpirationNoticeTime is how long before the node key expires that
+	// users are notified, and that the actions configured by
+	// KeyExpirationNoticeCommand, KeyExpirationNoticeWebhook and
+	// KeyExpirationNoticeMessage are taken.
 	KeyExpirationNoticeTime Key = "KeyExpirationNotice" // default 24 hours
 
 	// Boolean Keys that are only applicable on Windows. Booleans are stored in the registry as
@@ -183,8 +197,97 @@
 	// would otherwise obtain from the OS, e.g. by calling os.Hostname().
 	Hostname Key = "Hostname"
 
+	// DefaultProfile is the name or ID of the login profile that tailscaled
+	// switches to when it starts, instead of the last used one. It's meant
+	// for shared machines and kiosks. The tailscaled --profile flag and the
+	// config file take precedence over it.
+	DefaultProfile Key = "DefaultProfile"
+
+	// DERPHomeRegion is the decimal ID of the DERP region that the device
+	// must use as its home, instead of the one with the lowest latency.
+	// If blank, the home region isn't forced.
+	DERPHomeRegion Key = "DERPHomeRegion"
+
+	// TaildropFileScanner is the virus scanner or content policy service
+	// that checks files received with Taildrop before they're made available
+	// to users. It's either the path of a command to run with the path of the
+	// received file as its argument, or "unix:" followed by the path of a
+	// Unix socket serving the same protocol. If blank, files aren't checked.
+	TaildropFileScanner Key = "TaildropFileScanner"
+
+	// KeyExpirationNoticeCommand is the path of a command that tailscaled
+	// runs once the node key is due to expire within KeyExpirationNoticeTime,
+	// such as to automate reauthentication. The key expiry is passed in the
+	// TS_KEY_EXPIRY environment variable, in RFC 3339 format. If blank, no
+	// command is run.
+	KeyExpirationNoticeCommand Key = "KeyExpirationNoticeCommand"
+
+	// KeyExpirationNoticeWebhook is a URL to which tailscaled POSTs a JSON
+	// object with the node's ID, name and key expiry once the node key is due
+	// to expire within KeyExpirationNoticeTime. If blank, no request is made.
+	KeyExpirationNoticeWebhook Key = "KeyExpirationNoticeWebhook"
+
+	// KeyExpirationNoticeMessage is the text of the health warning shown once
+	// the node key is due to expire within KeyExpirationNoticeTime. If blank,
+	// the warning has a default text.
+	KeyExpirationNoticeMessage Key = "KeyExpirationNoticeMessage"
+
 	// Keys with a string array value.
 
 	// AllowedSuggestedExitNodes's string array value is a list of exit node IDs that restricts which exit nodes are considered when generating suggestions for exit nodes.
 	AllowedSuggestedExitNodes Key = "AllowedSuggestedExitNodes"
+
+	// BootstrapDNSServers's string array value is a list of servers, each of
+	// the form "hostname=ip", that tailscaled queries for bootstrap DNS before
+	// the DERP servers, for networks where those can't be reached. Like DERP
+	// servers, they must serve /bootstrap-dns over HTTPS. It's read when
+	// tailscaled starts.
+	BootstrapDNSServers Key = "BootstrapDNSServers"
+
+	// DNSNdots, DNSTimeout, DNSAttempts, and DNSSearchOrder set
+	// resolv.conf(5)-style options for the DNS configuration that Tailscale
+	// manages, overriding those of the config file. DNSNdots's integer value
+	// is the number of dots a name must have to be tried as an absolute name
+	// before the search domains. DNSTimeout's duration value is how long to
+	// wait for a nameserver to respond before retrying, and DNSAttempts's
+	// integer value is how many times to query each. DNSSearchOrder's string
+	// value is "tailscale-first" or "os-first", the order of Tailscale's
+	// search domains relative to the OS's others.
+	DNSNdots       Key = "DNSNdots"
+	DNSTimeout     Key = "DNSTimeout"
+	DNSAttempts    Key = "DNSAttempts"
+	DNSSearchOrder Key = "DNSSearchOrder"
+
+	// SerialNumberSources's string array value is the list of sources that
+	// Linux devices may read serial numbers for posture checks from: "smbios"
+	// for the SMBIOS/DMI product, baseboard and chassis serials, "devicetree"
+	// for the serial of ARM single-board computers such as Raspberry Pis, and
+	// "machine-id" for the systemd machine ID, which isn't a hardware serial
+	// and is reported with a "machine-id:" prefix. If not set, "smbios" and
+	// "devicetree" are allowed.
+	SerialNumberSources Key = "SerialNumberSources"
+
+	// DERPDenyRegions's string array value is a list of decimal DERP region IDs
+	// that the device must never use, such as for data sovereignty requirements.
+	DERPDenyRegions Key = "DERPDenyRegions"
+
+	// LocalAPIReadOnlyGroups's string array value is a list of Windows
+	// groups, by name or SID, whose members may connect to tailscaled's
+	// LocalAPI with read-only access, such as service accounts used for
+	// monitoring. Members that are elevated administrators or LocalSystem
+	// keep full access. It's read when tailscaled starts.
+	LocalAPIReadOnlyGroups Key = "LocalAPIReadOnlyGroups"
+
+	// LocalAPIRedactOtherUsers is a boolean key that, if true, redacts other
+	// local users' data from the LocalAPI responses to users connecting over
+	// its Unix socket who are neither root nor the operator, such as others'
+	// Taildrop transfers and Taildrive shares, for multi-user machines. Such
+	// users may still read the node's status.
+	LocalAPIRedactOtherUsers Key = "LocalAPIRedactOtherUsers"
+
+	// WebClientReadOnly is a boolean key that, if true, makes the web client
+	// that tailscaled serves on port 5252 read-only: viewers can see the
+	// device's status but can't change its settings, whatever capabilities
+	// they're granted, such as for kiosk devices.
+	WebClientReadOnly Key = "WebClientReadOnly"
 )
@@ -18,12 +18,21 @@
 	setting.NewDefinition(pkey.AllowedSuggestedExitNodes, setting.DeviceSetting, setting.StringListValue),
 	setting.NewDefinition(pkey.AllowExitNodeOverride, setting.DeviceSetting, setting.BooleanValue),
 	setting.NewDefinition(pkey.AllowTailscaledRestart, setting.DeviceSetting, setting.BooleanValue),
+	setting.NewDefinition(pkey.AllowUpdateRollback, setting.DeviceSetting, setting.BooleanValue),
 	setting.NewDefinition(pkey.AlwaysOn, setting.DeviceSetting, setting.BooleanValue),
 	setting.NewDefinition(pkey.AlwaysOnOverrideWithReason, setting.DeviceSetting, setting.BooleanValue),
 	setting.NewDefinition(pkey.ApplyUpdates, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(pkey.AuthKey, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.BootstrapDNSServers, setting.DeviceSetting, setting.StringListValue),
 	setting.NewDefinition(pkey.CheckUpdates, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(pkey.ControlURL, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.DefaultProfile, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.DERPDenyRegions, setting.DeviceSetting, setting.StringListValue),
+	setting.NewDefinition(pkey.DNSAttempts, setting.DeviceSetting, setting.IntegerValue),
+	setting.NewDefinition(pkey.DNSNdots, setting.DeviceSetting, setting.IntegerValue),
+	setting.NewDefinition(pkey.DNSSearchOrder, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.DNSTimeout, setting.DeviceSetting, setting.DurationValue),
+	setting.NewDefinition(pkey.DERPHomeRegion, setting.DeviceSetting, setting.StringValue),
 	setting.NewDefinition(pkey.DeviceSerialNumber, setting.DeviceSetting, setting.StringValue),
 	setting.NewDefinition(pkey.EnableDNSRegistration, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(pkey.EnableIncomingConnections, setting.DeviceSetting, setting.PreferenceOptionValue),
@@ -37,12 +46,21 @@
 	setting.NewDefinition(pkey.FlushDNSOnSessionUnlock, setting.DeviceSetting, setting.BooleanValue),
 	setting.NewDefinition(pkey.EncryptState, setting.DeviceSetting, setting.BooleanValue),
 	setting.NewDefinition(pkey.Hostname, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.KeyExpirationNoticeCommand, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.KeyExpirationNoticeMessage, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.KeyExpirationNoticeWebhook, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.LocalAPIReadOnlyGroups, setting.DeviceSetting, setting.StringListValue),
+	setting.NewDefinition(pkey.LocalAPIRedactOtherUsers, setting.DeviceSetting, setting.BooleanValue),
 	setting.NewDefinition(pkey.LogSCMInteractions, setting.DeviceSetting, setting.BooleanValue),
 	setting.NewDefinition(pkey.LogTarget, setting.DeviceSetting, setting.StringValue),
 	setting.NewDefinition(pkey.MachineCertificateSubject, setting.DeviceSetting, setting.StringValue),
 	setting.NewDefinition(pkey.PostureChecking, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(pkey.ReconnectAfter, setting.DeviceSetting, setting.DurationValue),
+	setting.NewDefinition(pkey.SerialNumberSources, setting.DeviceSetting, setting.StringListValue),
 	setting.NewDefinition(pkey.Tailnet, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.TaildropFileScanner, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.UpdateTrack, setting.DeviceSetting, setting.StringValue),
+	setting.NewDefinition(pkey.WebClientReadOnly, setting.DeviceSetting, setting.BooleanValue),
 	setting.NewDefinition(pkey.HardwareAttestation, setting.DeviceSetting, setting.BooleanValue),
 
 	// User policy settings (can be configured on a user- or device-basis):
@@ -0,0 +1,258 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package source
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tailscale.com/util/set"
+	"tailscale.com/util/syspolicy/internal/loggerx"
+	"tailscale.com/util/syspolicy/pkey"
+	"tailscale.com/util/syspolicy/setting"
+)
+
+var (
+	_ Store      = (*FilePolicyStore)(nil)
+	_ Changeable = (*FilePolicyStore)(nil)
+)
+
+// FilePolicyStore is a [Store] that reads policy settings from the JSON files
+// in a directory, such as /etc/tailscale/policy.d on Linux.
+//
+// Each file with a .json extension must contain a JSON object whose names are
+// policy setting keys (e.g. "ExitNodeID") and whose values are strings,
+// non-negative integers, booleans or arrays of strings, depending on the
+// setting's type. Files are applied in lexical order of their names, with
+// settings in later files overriding the same settings in earlier ones.
+// Files that can't be parsed are logged and ignored.
+//
+// Where supported, the store watches the directory and reloads the policy
+// settings when files are added, removed or modified.
+type FilePolicyStore struct {
+	dir  string
+	done chan struct{} // closed by Close
+
+	mu     sync.RWMutex
+	values map[pkey.Key]any
+	cbs    set.HandleSet[func()]
+	closed bool
+}
+
+// NewFilePolicyStore returns a new [FilePolicyStore] that reads policy
+// settings from the JSON files in dir. It is not an error if dir does not exist.
+func NewFilePolicyStore(dir string) (*FilePolicyStore, error) {
+	s, err := newFilePolicyStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := watchPolicyDir(dir, s.reloadAndLog, s.done); err != nil {
+		loggerx.Errorf("failed to watch %s; policy changes require a restart: %v", dir, err)
+	}
+	return s, nil
+}
+
+// newFilePolicyStore is like [NewFilePolicyStore], but doesn't watch dir.
+func newFilePolicyStore(dir string) (*FilePolicyStore, error) {
+	s := &FilePolicyStore{dir: dir, done: make(chan struct{})}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReadString implements [Store].
+func (s *FilePolicyStore) ReadString(key pkey.Key) (string, error) {
+	v, err := s.lookup(key)
+	if err != nil {
+		return "", err
+	}
+	str, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: %w: %v is not a string", key, setting.ErrTypeMismatch, v)
+	}
+	return str, nil
+}
+
+// ReadUInt64 implements [Store].
+func (s *FilePolicyStore) ReadUInt64(key pkey.Key) (uint64, error) {
+	v, err := s.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	num, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%s: %w: %v is not a number", key, setting.ErrTypeMismatch, v)
+	}
+	value, err := strconv.ParseUint(num.String(), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w: %v is not a valid uint64", key, setting.ErrTypeMismatch, num)
+	}
+	return value, nil
+}
+
+// ReadBoolean implements [Store].
+func (s *FilePolicyStore) ReadBoolean(key pkey.Key) (bool, error) {
+	v, err := s.lookup(key)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s: %w: %v is not a bool", key, setting.ErrTypeMismatch, v)
+	}
+	return b, nil
+}
+
+// ReadStringArray implements [Store].
+func (s *FilePolicyStore) ReadStringArray(key pkey.Key) ([]string, error) {
+	v, err := s.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: %v is not an array", key, setting.ErrTypeMismatch, v)
+	}
+	res := make([]string, len(arr))
+	for i, e := range arr {
+		str, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w: element %v is not a string", key, setting.ErrTypeMismatch, e)
+		}
+		res[i] = str
+	}
+	return res, nil
+}
+
+func (s *FilePolicyStore) lookup(key pkey.Key) (any, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	v, ok := s.values[key]
+	if !ok {
+		return nil, setting.ErrNotConfigured
+	}
+	return v, nil
+}
+
+// RegisterChangeCallback implements [Changeable].
+func (s *FilePolicyStore) RegisterChangeCallback(callback func()) (unregister func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	handle := s.cbs.Add(callback)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.cbs, handle)
+	}, nil
+}
+
+// Reload re-reads the policy files and, if the policy settings changed,
+// invokes the registered change callbacks.
+func (s *FilePolicyStore) Reload() error {
+	values, err := readPolicyDir(s.dir)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrStoreClosed
+	}
+	if s.values != nil && reflect.DeepEqual(values, s.values) {
+		s.mu.Unlock()
+		return nil
+	}
+	first := s.values == nil
+	s.values = values
+	cbs := make([]func(), 0, len(s.cbs))
+	for _, cb := range s.cbs {
+		cbs = append(cbs, cb)
+	}
+	s.mu.Unlock()
+
+	if !first {
+		for _, cb := range cbs {
+			cb()
+		}
+	}
+	return nil
+}
+
+func (s *FilePolicyStore) reloadAndLog() {
+	if err := s.Reload(); err != nil && err != ErrStoreClosed {
+		loggerx.Errorf("failed to reload policy files in %s: %v", s.dir, err)
+	}
+}
+
+// Close implements [io.Closer] and stops watching the policy directory.
+func (s *FilePolicyStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	return nil
+}
+
+// readPolicyDir reads and merges the policy settings in the .json files
+// in dir. It returns an empty, non-nil map if dir does not exist.
+func readPolicyDir(dir string) (map[pkey.Key]any, error) {
+	values := make(map[pkey.Key]any)
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return values, nil
+		}
+		return nil, err
+	}
+	// os.ReadDir returns entries sorted by name.
+	for _, ent := range ents {
+		if ent.IsDir() || !strings.HasSuffix(ent.Name(), ".json") {
+			continue
+		}
+		name := filepath.Join(dir, ent.Name())
+		file, err := readPolicyFile(name)
+		if err != nil {
+			loggerx.Errorf("ignoring policy file %s: %v", name, err)
+			continue
+		}
+		for k, v := range file {
+			values[pkey.Key(k)] = v
+		}
+	}
+	return values, nil
+}
+
+func readPolicyFile(name string) (map[string]any, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+	return m, nil
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package source
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchPolicyDir calls onChange whenever a file in dir is created, removed,
+// renamed or written, until done is closed.
+func watchPolicyDir(dir string, onChange func(), done <-chan struct{}) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	const mask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+	if _, err := unix.InotifyAddWatch(fd, dir, mask); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	// The fd is non-blocking, so os.NewFile registers it with the runtime
+	// poller and Close unblocks a pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-done
+		f.Close()
+	}()
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			// We don't care which files changed; any event means the
+			// directory needs to be re-read.
+			if _, err := f.Read(buf); err != nil {
+				return
+			}
+			onChange()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,12 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !linux
+
+package source
+
+import "errors"
+
+func watchPolicyDir(dir string, onChange func(), done <-chan struct{}) error {
+	return errors.New("not supported on this platform")
+}
@@ -0,0 +1,92 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package source
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"tailscale.com/util/syspolicy/setting"
+)
+
+func TestFilePolicyStore(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("10-base.json", `{"ExitNodeID": "base", "AllowIncomingConnections": true, "KeyExpirationNotice": 24, "AllowedSuggestedExitNodes": ["a", "b"]}`)
+	write("20-override.json", `{"ExitNodeID": "override"}`)
+	write("30-broken.json", `{"ExitNodeID": `)
+	write("README", `{"ExitNodeID": "ignored"}`)
+
+	s, err := newFilePolicyStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if got, err := s.ReadString("ExitNodeID"); err != nil || got != "override" {
+		t.Errorf("ExitNodeID = %q, %v; want override", got, err)
+	}
+	if got, err := s.ReadBoolean("AllowIncomingConnections"); err != nil || !got {
+		t.Errorf("AllowIncomingConnections = %v, %v; want true", got, err)
+	}
+	if got, err := s.ReadUInt64("KeyExpirationNotice"); err != nil || got != 24 {
+		t.Errorf("KeyExpirationNotice = %v, %v; want 24", got, err)
+	}
+	if got, err := s.ReadStringArray("AllowedSuggestedExitNodes"); err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("AllowedSuggestedExitNodes = %q, %v; want [a b]", got, err)
+	}
+	if _, err := s.ReadString("Tailnet"); !errors.Is(err, setting.ErrNotConfigured) {
+		t.Errorf("Tailnet err = %v; want ErrNotConfigured", err)
+	}
+	if _, err := s.ReadBoolean("ExitNodeID"); !errors.Is(err, setting.ErrTypeMismatch) {
+		t.Errorf("ReadBoolean(ExitNodeID) err = %v; want ErrTypeMismatch", err)
+	}
+
+	var changed int
+	unregister, err := s.RegisterChangeCallback(func() { changed++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unregister()
+
+	// Reloading unchanged files doesn't report a change.
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if changed != 0 {
+		t.Errorf("changed = %d after no-op reload; want 0", changed)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "20-override.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if changed == 0 {
+		t.Error("change callback not called")
+	}
+	if got, err := s.ReadString("ExitNodeID"); err != nil || got != "base" {
+		t.Errorf("ExitNodeID = %q, %v; want base", got, err)
+	}
+}
+
+func TestFilePolicyStoreMissingDir(t *testing.T) {
+	s, err := NewFilePolicyStore(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.ReadString("ExitNodeID"); !errors.Is(err, setting.ErrNotConfigured) {
+		t.Errorf("err = %v; want ErrNotConfigured", err)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package syspolicy
+
+import (
+	"os"
+
+	"tailscale.com/util/syspolicy/internal"
+	"tailscale.com/util/syspolicy/internal/loggerx"
+	"tailscale.com/util/syspolicy/rsop"
+	"tailscale.com/util/syspolicy/setting"
+	"tailscale.com/util/syspolicy/source"
+	"tailscale.com/util/testenv"
+)
+
+// linuxPolicyDir is the directory from which policy settings are read on
+// Linux, for fleets managed with configuration management tools rather than
+// an MDM solution. See [source.FilePolicyStore] for the file format.
+const linuxPolicyDir = "/etc/tailscale/policy.d"
+
+func init() {
+	internal.Init.MustDefer(func() error {
+		// Do not register or use default policy stores during tests.
+		// Each test should set up its own necessary configurations.
+		if testenv.InTest() {
+			return nil
+		}
+		// Only watch the policy directory if it exists at startup; creating
+		// it later requires a restart.
+		if fi, err := os.Stat(linuxPolicyDir); err != nil || !fi.IsDir() {
+			return nil
+		}
+		store, err := source.NewFilePolicyStore(linuxPolicyDir)
+		if err != nil {
+			loggerx.Errorf("failed to read policy files in %s: %v", linuxPolicyDir, err)
+			return nil
+		}
+		if _, err := rsop.RegisterStore("PolicyFiles", setting.DeviceScope, store); err != nil {
+			store.Close()
+			return err
+		}
+		return nil
+	})
+}
@@ -53,6 +53,33 @@ type DropLabels struct {
 	Reason DropReason
 }
 
+// PeerRole classifies a peer by the routes it offers.
+type PeerRole string
+
+const (
+	// PeerRoleExitNode means that the peer offers itself as an exit node.
+	PeerRoleExitNode PeerRole = "exit_node"
+
+	// PeerRoleSubnetRouter means that the peer routes subnets other than
+	// exit routes, and is not an exit node.
+	PeerRoleSubnetRouter PeerRole = "subnet_router"
+
+	// PeerRoleNode means that the peer routes only its own addresses.
+	PeerRoleNode PeerRole = "node"
+)
+
+// PeerTrafficLabels contains common label(s) for per-peer traffic counters.
+// Traffic is attributed by the peer's tags and role rather than the peer
+// itself, to bound the number of series in large tailnets.
+type PeerTrafficLabels struct {
+	// Tags is the peer's ACL tags, sorted and comma-separated, or empty if
+	// the peer is not tagged.
+	Tags string
+
+	// Role is the peer's role.
+	Role PeerRole
+}
+
 // initOnce initializes the common metrics.
 func (r *Registry) initOnce() {
 	if !buildfeatures.HasUserMetrics {
@@ -23,6 +23,15 @@ func NewMultiLabelMapWithRegistry[T comparable](m *Registry, name string, promTy
 	return nil
 }
 
+type DeltaCounter[K, L comparable] struct{}
+
+func NewDeltaCounterWithRegistry[K, L comparable](m *Registry, name, helpText string) *DeltaCounter[K, L] {
+	return nil
+}
+
+func (*DeltaCounter[K, L]) Observe(K, L, int64) {}
+func (*DeltaCounter[K, L]) Retain(func(K) bool) {}
+
 func (*noopMap[T]) Add(T, int64) {}
 func (*noopMap[T]) Set(T, any)   {}
 
@@ -13,6 +13,7 @@
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 
 	"tailscale.com/metrics"
 	"tailscale.com/tsweb/varz"
@@ -49,6 +50,67 @@ func NewMultiLabelMapWithRegistry[T comparable](m *Registry, name string, promTy
 	return ml
 }
 
+// DeltaCounter is a counter fed with samples of cumulative totals from many
+// sources, such as the byte counters of individual WireGuard peers. Each
+// sample adds the increase since the source's previous sample to the
+// underlying MultiLabelMap, under the labels the source currently has.
+//
+// This allows sources to be aggregated by attributes (like a peer's tags)
+// which can change over time, without the counter ever going backwards.
+type DeltaCounter[K, L comparable] struct {
+	m *MultiLabelMap[L]
+
+	mu   sync.Mutex
+	last map[K]int64 // source => total at its last sample
+}
+
+// NewDeltaCounterWithRegistry creates and registers a new counter with the
+// given name whose values are keyed by labels of type L, fed with samples of
+// sources of type K. See NewMultiLabelMapWithRegistry regarding names.
+func NewDeltaCounterWithRegistry[K, L comparable](m *Registry, name, helpText string) *DeltaCounter[K, L] {
+	return &DeltaCounter[K, L]{
+		m:    NewMultiLabelMapWithRegistry[L](m, name, "counter", helpText),
+		last: make(map[K]int64),
+	}
+}
+
+// Observe records that the cumulative total of src is now total, adding the
+// increase since src's previous sample to the counter for labels.
+//
+// If total is less than the previous sample, src is assumed to have been
+// reset and all of total is counted.
+func (d *DeltaCounter[K, L]) Observe(src K, labels L, total int64) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delta := total
+	if last, ok := d.last[src]; ok && total >= last {
+		delta = total - last
+	}
+	d.last[src] = total
+	if delta > 0 {
+		d.m.Add(labels, delta)
+	}
+}
+
+// Retain forgets the previous samples of all sources for which keep returns
+// false, so that the next sample from such a source is counted in full.
+// It should be called with sources that no longer exist, to bound memory.
+func (d *DeltaCounter[K, L]) Retain(keep func(K) bool) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k := range d.last {
+		if !keep(k) {
+			delete(d.last, k)
+		}
+	}
+}
+
 // Gauge is a gauge metric with no labels.
 type Gauge struct {
 	m    *expvar.Float
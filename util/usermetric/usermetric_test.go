@@ -24,3 +24,30 @@ func TestGauge(t *testing.T) {
 	}
 
 }
+
+func TestDeltaCounter(t *testing.T) {
+	var reg Registry
+	type labels struct{ Kind string }
+	d := NewDeltaCounterWithRegistry[string, labels](&reg, "test_delta_total", "This is a test counter")
+
+	a, b := labels{"a"}, labels{"b"}
+	d.Observe("src1", a, 10)
+	d.Observe("src2", a, 5)
+	d.Observe("src1", a, 15) // +5
+	d.Observe("src1", b, 20) // +5, now attributed to b
+	d.Observe("src2", a, 2)  // reset; +2
+
+	d.Retain(func(src string) bool { return src != "src1" })
+	d.Observe("src1", b, 3) // forgotten, so counted in full
+
+	var buf bytes.Buffer
+	d.m.WritePrometheus(&buf, "test_delta_total")
+	const want = `# TYPE test_delta_total counter
+# HELP test_delta_total This is a test counter
+test_delta_total{kind="a"} 22
+test_delta_total{kind="b"} 8
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
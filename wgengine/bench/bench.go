@@ -1,12 +1,22 @@
 // Copyright (c) Tailscale Inc & contributors
 // SPDX-License-Identifier: BSD-3-Clause
 
-// Create two wgengine instances and pass data through them, measuring
-// throughput, latency, and packet loss.
+// The bench command passes generated packets through various data paths,
+// from plain channels to a pair of wgengine instances talking over DERP,
+// measuring throughput, latency, and packet loss.
+//
+// Results can be written as JSON and saved as a baseline, against which later
+// runs are compared to catch data path performance regressions:
+//
+//	go run ./wgengine/bench -write-baseline=base.json
+//	go run ./wgengine/bench -baseline=base.json
 package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"io"
 	"log"
 	"net"
@@ -15,6 +25,7 @@
 	"net/netip"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,17 +39,118 @@
 var Addr2 = netip.MustParsePrefix("100.64.1.2/32")
 
 func main() {
+	var (
+		list          = flag.Bool("list", false, "list the scenarios and exit")
+		continuous    = flag.Bool("continuous", false, "run a single scenario until interrupted, logging its progress every second")
+		sizes         = flag.String("sizes", strconv.Itoa(ICMPMinSize+PayloadSize), "comma-separated packet sizes in bytes, including IP and ICMP headers")
+		warmup        = flag.Duration("warmup", 2*time.Second, "how long to run each scenario before measuring")
+		duration      = flag.Duration("duration", 5*time.Second, "how long to measure each scenario")
+		jsonOut       = flag.Bool("json", false, "write results to stdout as JSON")
+		baselineFile  = flag.String("baseline", "", "if non-empty, a baseline file to compare results against; exits non-zero on regression")
+		tolerance     = flag.Float64("tolerance", 0.1, "fraction by which results may be worse than the baseline without being a regression")
+		writeBaseline = flag.String("write-baseline", "", "if non-empty, a file to write the results to, for use as a later -baseline")
+		debugAddr     = flag.String("debug-addr", "", "if non-empty, address to serve /debug/pprof on")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [scenario...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Scenarios may be given by name or number. With none, all are run.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	var logf logger.Logf = log.Printf
 	log.SetFlags(0)
 
-	debugMux := newDebugMux()
-	go runDebugServer(debugMux, "0.0.0.0:8999")
+	if *list {
+		for _, sc := range scenarios {
+			fmt.Printf("%-20s %4d  %-8s %s\n", sc.Name, sc.Mode, sc.Path, sc.Doc)
+		}
+		return
+	}
 
-	mode, err := strconv.Atoi(os.Args[1])
-	if err != nil {
-		log.Fatalf("%q: %v", os.Args[1], err)
+	if *debugAddr != "" {
+		go runDebugServer(newDebugMux(), *debugAddr)
+	}
+
+	var run []Scenario
+	for _, name := range flag.Args() {
+		sc, ok := scenarioByName(name)
+		if !ok {
+			log.Fatalf("unknown scenario %q; see -list", name)
+		}
+		run = append(run, sc)
+	}
+	if len(run) == 0 {
+		run = scenarios
+	}
+
+	var packetSizes []int
+	for f := range strings.SplitSeq(*sizes, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < ICMPMinSize+8 {
+			log.Fatalf("invalid packet size %q; must be at least %d", f, ICMPMinSize+8)
+		}
+		packetSizes = append(packetSizes, n)
+	}
+
+	if *continuous {
+		if len(run) != 1 || len(packetSizes) != 1 {
+			log.Fatalf("-continuous requires exactly one scenario and packet size")
+		}
+		runContinuous(logf, run[0], packetSizes[0])
+		return
+	}
+
+	var results []Result
+	for _, sc := range run {
+		for _, size := range packetSizes {
+			r := runScenario(logger.WithPrefix(logf, sc.Name+": "), sc, RunConfig{
+				PacketSize: size,
+				Warmup:     *warmup,
+				Duration:   *duration,
+			})
+			if !*jsonOut {
+				fmt.Println(r)
+			}
+			results = append(results, r)
+		}
+	}
+
+	b := newBaseline(results)
+	if *jsonOut {
+		j, err := json.MarshalIndent(b, "", "\t")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s\n", j)
+	}
+	if *writeBaseline != "" {
+		if err := b.write(*writeBaseline); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *baselineFile != "" {
+		base, err := readBaseline(*baselineFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if base.GOOS != b.GOOS || base.GOARCH != b.GOARCH || base.NumCPU != b.NumCPU {
+			logf("warning: baseline is from %s/%s with %d CPUs; results may not be comparable",
+				base.GOOS, base.GOARCH, base.NumCPU)
+		}
+		if regressions := base.compare(results, *tolerance); len(regressions) > 0 {
+			for _, r := range regressions {
+				logf("REGRESSION: %s", r)
+			}
+			os.Exit(1)
+		}
+		logf("no regressions relative to %s", *baselineFile)
 	}
+}
 
+// runContinuous runs sc forever with the given packet size, logging its
+// progress every second.
+func runContinuous(logf logger.Logf, sc Scenario, packetSize int) {
 	traf := NewTrafficGen(nil)
 
 	// Sample test results below are using GOMAXPROCS=2 (for some
@@ -46,48 +158,21 @@ func main() {
 	// on apenwarr's old Linux box:
 	//   Intel(R) Core(TM) i7-4785T CPU @ 2.20GHz
 	// My 2019 Mac Mini is about 20% faster on most tests.
-
-	switch mode {
-	// tx=8786325 rx=8786326 (0 = 0.00% loss) (70768.7 Mbits/sec)
-	case 1:
-		setupTrivialNoAllocTest(logf, traf)
-
-	// tx=6476293 rx=6476293 (0 = 0.00% loss) (52249.7 Mbits/sec)
-	case 2:
-		setupTrivialTest(logf, traf)
-
-	// tx=1957974 rx=1958379 (0 = 0.00% loss) (15939.8 Mbits/sec)
-	case 11:
-		setupBlockingChannelTest(logf, traf)
-
-	// tx=728621 rx=701825 (26620 = 3.65% loss) (5525.2 Mbits/sec)
-	// (much faster on macOS??)
-	case 12:
-		setupNonblockingChannelTest(logf, traf)
-
-	// tx=1024260 rx=941098 (83334 = 8.14% loss) (7516.6 Mbits/sec)
-	// (much faster on macOS??)
-	case 13:
-		setupDoubleChannelTest(logf, traf)
-
-	// tx=265468 rx=263189 (2279 = 0.86% loss) (2162.0 Mbits/sec)
-	case 21:
-		setupUDPTest(logf, traf)
-
-	// tx=1493580 rx=1493580 (0 = 0.00% loss) (12210.4 Mbits/sec)
-	case 31:
-		setupBatchTCPTest(logf, traf)
-
-	// tx=134236 rx=133166 (1070 = 0.80% loss) (1088.9 Mbits/sec)
-	case 101:
-		setupWGTest(nil, logf, traf, Addr1, Addr2)
-
-	default:
-		log.Fatalf("provide a valid test number (0..n)")
-	}
+	//
+	//   trivial-noalloc      tx=8786325 rx=8786326 (0 = 0.00% loss) (70768.7 Mbits/sec)
+	//   trivial              tx=6476293 rx=6476293 (0 = 0.00% loss) (52249.7 Mbits/sec)
+	//   blocking-channel     tx=1957974 rx=1958379 (0 = 0.00% loss) (15939.8 Mbits/sec)
+	//   nonblocking-channel  tx=728621 rx=701825 (26620 = 3.65% loss) (5525.2 Mbits/sec)
+	//                        (much faster on macOS??)
+	//   double-channel       tx=1024260 rx=941098 (83334 = 8.14% loss) (7516.6 Mbits/sec)
+	//                        (much faster on macOS??)
+	//   udp                  tx=265468 rx=263189 (2279 = 0.86% loss) (2162.0 Mbits/sec)
+	//   tcp-batch            tx=1493580 rx=1493580 (0 = 0.00% loss) (12210.4 Mbits/sec)
+	//   wg-direct            tx=134236 rx=133166 (1070 = 0.80% loss) (1088.9 Mbits/sec)
+	sc.Setup(logf, traf)
 
 	logf("initialized ok.")
-	traf.Start(Addr1.Addr(), Addr2.Addr(), PayloadSize+ICMPMinSize, 0)
+	traf.Start(Addr1.Addr(), Addr2.Addr(), packetSize, 0)
 
 	var cur, prev Snapshot
 	var pps int64
@@ -7,6 +7,7 @@
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -47,6 +48,13 @@ func BenchmarkWireGuardTest(b *testing.B) {
 	})
 }
 
+func BenchmarkWireGuardDERPTest(b *testing.B) {
+	b.Skip("https://github.com/tailscale/tailscale/issues/2716")
+	run(b, func(logf logger.Logf, traf *TrafficGen) {
+		setupWGDERPTest(b, logf, traf, Addr1, Addr2)
+	})
+}
+
 type SetupFunc func(logger.Logf, *TrafficGen)
 
 func run(b *testing.B, setup SetupFunc) {
@@ -106,3 +114,70 @@ func runOnce(b *testing.B, setup SetupFunc, payload int) {
 
 	b.ReportMetric(loss*100, "%lost")
 }
+
+func TestLatencyHist(t *testing.T) {
+	var h LatencyHist
+	for range 97 {
+		h.add(3 * time.Microsecond)
+	}
+	for range 3 {
+		h.add(time.Millisecond)
+	}
+
+	if got, want := h.Quantile(0.5), 4096*time.Nanosecond; got != want {
+		t.Errorf("p50 = %v; want %v", got, want)
+	}
+	if got, want := h.Quantile(0.99), 1048576*time.Nanosecond; got != want {
+		t.Errorf("p99 = %v; want %v", got, want)
+	}
+	if got, want := h.Mean(), (97*3*time.Microsecond+3*time.Millisecond)/100; got != want {
+		t.Errorf("mean = %v; want %v", got, want)
+	}
+
+	before := h
+	h.add(time.Second)
+	if d := h.Sub(before); d.Count != 1 || d.Mean() != time.Second {
+		t.Errorf("Sub = %+v; want the single later sample", d)
+	}
+}
+
+func TestBaselineCompare(t *testing.T) {
+	base := newBaseline([]Result{
+		{Scenario: "a", PacketSize: 100, Mbps: 1000, LatencyMean: 10 * time.Microsecond},
+		{Scenario: "b", PacketSize: 100, Mbps: 1000, LatencyMean: 10 * time.Microsecond},
+	})
+	results := []Result{
+		{Scenario: "a", PacketSize: 100, Mbps: 950, LatencyMean: 10500 * time.Nanosecond}, // within 10%
+		{Scenario: "b", PacketSize: 100, Mbps: 800, LatencyMean: 20 * time.Microsecond},   // slower both ways
+		{Scenario: "c", PacketSize: 100, Mbps: 1},                                         // not in baseline
+		{Scenario: "a", PacketSize: 1000, Mbps: 1},                                        // not in baseline
+	}
+	got := base.compare(results, 0.1)
+	if len(got) != 2 {
+		t.Fatalf("got %d regressions, want 2: %q", len(got), got)
+	}
+	if !strings.Contains(got[0], "throughput") || !strings.Contains(got[1], "latency") {
+		t.Errorf("unexpected regressions: %q", got)
+	}
+}
+
+func TestRunScenario(t *testing.T) {
+	for _, sc := range scenarios {
+		if sc.Heavy {
+			continue
+		}
+		t.Run(sc.Name, func(t *testing.T) {
+			r := runScenario(t.Logf, sc, RunConfig{
+				PacketSize: ICMPMinSize + 100,
+				Warmup:     50 * time.Millisecond,
+				Duration:   100 * time.Millisecond,
+			})
+			if r.RxPackets == 0 || r.Mbps == 0 {
+				t.Errorf("no packets received: %v", r)
+			}
+			if r.LatencyMean == 0 {
+				t.Errorf("no latency measured: %v", r)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Result is the machine-readable result of a run of a scenario.
+type Result struct {
+	Scenario   string
+	Path       string
+	PacketSize int
+	Duration   time.Duration
+
+	TxPackets   int64
+	RxPackets   int64
+	LossPercent float64
+	Mbps        float64
+	PPS         float64
+
+	// The latency fields are zero if packets were too small to carry
+	// timestamps. The quantiles are upper bounds, accurate to within a
+	// factor of two.
+	LatencyMean time.Duration
+	LatencyP50  time.Duration
+	LatencyP99  time.Duration
+}
+
+func newResult(sc Scenario, cfg RunConfig, d Delta) Result {
+	r := Result{
+		Scenario:    sc.Name,
+		Path:        sc.Path,
+		PacketSize:  cfg.PacketSize,
+		Duration:    time.Duration(d.DurationNsec),
+		TxPackets:   d.TxPackets,
+		RxPackets:   d.RxPackets,
+		Mbps:        d.Mbps(),
+		PPS:         d.PPS(),
+		LatencyMean: d.Latency.Mean(),
+		LatencyP50:  d.Latency.Quantile(0.5),
+		LatencyP99:  d.Latency.Quantile(0.99),
+	}
+	if d.TxPackets > 0 {
+		r.LossPercent = float64(d.LostPackets) * 100 / float64(d.TxPackets)
+	}
+	return r
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%-20s %-8s %5dB %10.1f Mbit/s %10.0f pkt/s %5.1f%% loss  p50<%-8v p99<%v",
+		r.Scenario, r.Path, r.PacketSize, r.Mbps, r.PPS, r.LossPercent, r.LatencyP50, r.LatencyP99)
+}
+
+// Baseline is a set of results to compare later runs against, as written
+// by the -write-baseline flag.
+type Baseline struct {
+	GOOS      string
+	GOARCH    string
+	GoVersion string
+	NumCPU    int
+	Results   []Result
+}
+
+func newBaseline(results []Result) *Baseline {
+	return &Baseline{
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		NumCPU:    runtime.NumCPU(),
+		Results:   results,
+	}
+}
+
+func readBaseline(path string) (*Baseline, error) {
+	j, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := new(Baseline)
+	if err := json.Unmarshal(j, b); err != nil {
+		return nil, fmt.Errorf("parsing baseline %s: %w", path, err)
+	}
+	return b, nil
+}
+
+func (b *Baseline) write(path string) error {
+	j, err := json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(j, '\n'), 0644)
+}
+
+// find returns the baseline's result for the same scenario and packet
+// size as r.
+func (b *Baseline) find(r Result) (Result, bool) {
+	for _, br := range b.Results {
+		if br.Scenario == r.Scenario && br.PacketSize == r.PacketSize {
+			return br, true
+		}
+	}
+	return Result{}, false
+}
+
+// compare returns a description of each way in which the results regressed
+// relative to b by more than tolerance, a fraction such as 0.1 for 10%.
+// Results with no counterpart in b are ignored.
+//
+// Throughput regresses when it drops, and latency when its mean rises. The
+// quantiles are too coarse to compare, and latencies of less than a
+// microsecond too noisy.
+func (b *Baseline) compare(results []Result, tolerance float64) (regressions []string) {
+	for _, r := range results {
+		br, ok := b.find(r)
+		if !ok {
+			continue
+		}
+		if br.Mbps > 0 && r.Mbps < br.Mbps*(1-tolerance) {
+			regressions = append(regressions, fmt.Sprintf("%s/%dB: throughput %.1f Mbit/s, down %.1f%% from %.1f Mbit/s",
+				r.Scenario, r.PacketSize, r.Mbps, (1-r.Mbps/br.Mbps)*100, br.Mbps))
+		}
+		if br.LatencyMean >= time.Microsecond && r.LatencyMean >= time.Microsecond &&
+			float64(r.LatencyMean) > float64(br.LatencyMean)*(1+tolerance) {
+			regressions = append(regressions, fmt.Sprintf("%s/%dB: mean latency %v, up from %v",
+				r.Scenario, r.PacketSize, r.LatencyMean, br.LatencyMean))
+		}
+	}
+	return regressions
+}
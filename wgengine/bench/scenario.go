@@ -0,0 +1,167 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"tailscale.com/types/logger"
+)
+
+// A Scenario is a named way of passing the traffic generator's packets from
+// its sender to its receiver, exercising some data path.
+type Scenario struct {
+	Name string
+	Mode int    // the scenario's number in the original numbered modes
+	Path string // the data path exercised, such as "tun" or "derp"
+	Doc  string
+
+	// Setup connects the traffic generator's sender to its receiver. It
+	// returns a func to release any resources, which may be nil.
+	Setup func(logf logger.Logf, traf *TrafficGen) (cleanup func())
+
+	// Heavy is whether the scenario involves real engines, sockets or
+	// servers, and so is only run when explicitly requested by tests.
+	Heavy bool
+}
+
+// noCleanup adapts a setup func which leaks its goroutines until the
+// traffic generator stops to Scenario.Setup.
+func noCleanup(setup func(logger.Logf, *TrafficGen)) func(logger.Logf, *TrafficGen) func() {
+	return func(logf logger.Logf, traf *TrafficGen) func() {
+		setup(logf, traf)
+		return nil
+	}
+}
+
+// scenarios are the known scenarios, in the order they're run by default.
+var scenarios = []Scenario{
+	{
+		Name:  "trivial-noalloc",
+		Mode:  1,
+		Path:  "loopback",
+		Doc:   "fill and absorb a single packet buffer; the traffic generator's upper bound",
+		Setup: noCleanup(setupTrivialNoAllocTest),
+	},
+	{
+		Name:  "trivial",
+		Mode:  2,
+		Path:  "loopback",
+		Doc:   "like trivial-noalloc, allocating a buffer per packet",
+		Setup: noCleanup(setupTrivialTest),
+	},
+	{
+		Name:  "blocking-channel",
+		Mode:  11,
+		Path:  "channel",
+		Doc:   "pass packets through a blocking channel",
+		Setup: noCleanup(setupBlockingChannelTest),
+	},
+	{
+		Name:  "nonblocking-channel",
+		Mode:  12,
+		Path:  "channel",
+		Doc:   "pass packets through a channel, dropping them when it's full",
+		Setup: noCleanup(setupNonblockingChannelTest),
+	},
+	{
+		Name:  "double-channel",
+		Mode:  13,
+		Path:  "channel",
+		Doc:   "pass packets through two channels and an intermediate goroutine",
+		Setup: noCleanup(setupDoubleChannelTest),
+	},
+	{
+		Name:  "udp",
+		Mode:  21,
+		Path:  "udp",
+		Doc:   "pass packets through a localhost UDP socket",
+		Setup: noCleanup(setupUDPTest),
+		Heavy: true,
+	},
+	{
+		Name:  "tcp-batch",
+		Mode:  31,
+		Path:  "tcp",
+		Doc:   "pass packets through a localhost TCP socket, 10 per syscall",
+		Setup: noCleanup(setupBatchTCPTest),
+		Heavy: true,
+	},
+	{
+		Name: "wg-direct",
+		Mode: 101,
+		Path: "tun",
+		Doc:  "pass packets between the TUN devices of two wgengines talking directly over localhost UDP",
+		Setup: func(logf logger.Logf, traf *TrafficGen) func() {
+			return setupWGPair(logf, traf, Addr1, Addr2, nil)
+		},
+		Heavy: true,
+	},
+	{
+		Name: "wg-derp",
+		Mode: 102,
+		Path: "derp",
+		Doc:  "like wg-direct, relaying all traffic through a localhost DERP server",
+		Setup: func(logf logger.Logf, traf *TrafficGen) func() {
+			return setupWGDERPPair(logf, traf, Addr1, Addr2)
+		},
+		Heavy: true,
+	},
+	// TODO: add a netstack scenario, once the receiving engine can be
+	// given a netstack without the rest of LocalBackend.
+}
+
+// scenarioByName returns the scenario with the given name or number.
+func scenarioByName(name string) (Scenario, bool) {
+	for _, sc := range scenarios {
+		if sc.Name == name || (sc.Mode != 0 && name == strconv.Itoa(sc.Mode)) {
+			return sc, true
+		}
+	}
+	return Scenario{}, false
+}
+
+// RunConfig configures a single run of a scenario.
+type RunConfig struct {
+	// PacketSize is the size of each generated packet in bytes, including
+	// the IP and ICMP headers. It must be at least ICMPMinSize+16 for
+	// latency to be measured.
+	PacketSize int
+
+	// Warmup is how long to run before measuring, to skip handshakes and
+	// let the transmit rate converge.
+	Warmup time.Duration
+
+	// Duration is how long to measure for, after Warmup.
+	Duration time.Duration
+}
+
+// runScenario runs sc as configured by cfg and returns its results.
+func runScenario(logf logger.Logf, sc Scenario, cfg RunConfig) Result {
+	traf := NewTrafficGen(nil)
+	cleanup := sc.Setup(logf, traf)
+	traf.Start(Addr1.Addr(), Addr2.Addr(), cfg.PacketSize, 0)
+
+	const adjustEvery = 10 * time.Millisecond
+	tick := time.NewTicker(adjustEvery)
+	defer tick.Stop()
+	adjustUntil := func(deadline time.Time) {
+		for time.Now().Before(deadline) {
+			<-tick.C
+			traf.Adjust()
+		}
+	}
+
+	adjustUntil(time.Now().Add(cfg.Warmup))
+	start := traf.Snap()
+	adjustUntil(time.Now().Add(cfg.Duration))
+	d := traf.Snap().Sub(start)
+
+	traf.Stop()
+	if cleanup != nil {
+		cleanup()
+	}
+	return newResult(sc, cfg, d)
+}
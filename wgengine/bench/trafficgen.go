@@ -7,6 +7,8 @@
 	"encoding/binary"
 	"fmt"
 	"log"
+	"math"
+	"math/bits"
 	"net/netip"
 	"sync"
 	"time"
@@ -24,6 +26,70 @@ type Snapshot struct {
 	TotalLost    int64 // packets out-of-order or lost so far
 	TotalOOO     int64 // packets out-of-order so far
 	TotalBytesRx int64 // total bytes received so far
+
+	// Latency is the distribution of the one-way latency of received
+	// packets so far, for packets large enough to carry a timestamp.
+	Latency LatencyHist
+}
+
+// latencyBuckets is the number of buckets in a LatencyHist. Bucket i counts
+// latencies of less than 2**i nanoseconds (and at least 2**(i-1)), so the
+// last bucket holds anything from about 1.1 seconds up.
+const latencyBuckets = 32
+
+// LatencyHist is a histogram of packet latencies, with buckets which grow
+// exponentially in size.
+type LatencyHist struct {
+	Count   int64
+	SumNsec int64
+	Buckets [latencyBuckets]int64
+}
+
+func (h *LatencyHist) add(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := min(bits.Len64(uint64(d)), latencyBuckets-1)
+	h.Buckets[i]++
+	h.Count++
+	h.SumNsec += int64(d)
+}
+
+// Sub returns the histogram of the latencies recorded in h but not a,
+// where a is an earlier copy of h.
+func (h LatencyHist) Sub(a LatencyHist) LatencyHist {
+	h.Count -= a.Count
+	h.SumNsec -= a.SumNsec
+	for i := range h.Buckets {
+		h.Buckets[i] -= a.Buckets[i]
+	}
+	return h
+}
+
+// Mean returns the mean latency, or zero if there are no samples.
+func (h LatencyHist) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return time.Duration(h.SumNsec / h.Count)
+}
+
+// Quantile returns an upper bound of the q-quantile (0 < q <= 1) of the
+// latency, accurate to within a factor of two, or zero if there are no
+// samples.
+func (h LatencyHist) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	want := int64(math.Ceil(q * float64(h.Count)))
+	var n int64
+	for i, c := range h.Buckets {
+		n += c
+		if n >= want && c > 0 {
+			return time.Duration(1) << i
+		}
+	}
+	return time.Duration(1) << (latencyBuckets - 1)
 }
 
 type Delta struct {
@@ -33,6 +99,7 @@ type Delta struct {
 	LostPackets  int64
 	OOOPackets   int64
 	Bytes        int64
+	Latency      LatencyHist
 }
 
 func (b Snapshot) Sub(a Snapshot) Delta {
@@ -45,22 +112,41 @@ func (b Snapshot) Sub(a Snapshot) Delta {
 		LostPackets: b.TotalLost - a.TotalLost,
 		OOOPackets:  b.TotalOOO - a.TotalOOO,
 		Bytes:       b.TotalBytesRx - a.TotalBytesRx,
+		Latency:     b.Latency.Sub(a.Latency),
 	}
 }
 
 func (d Delta) String() string {
-	return fmt.Sprintf("tx=%-6d rx=%-4d (%6d = %.1f%% loss) (%d OOO) (%4.1f Mbit/s)",
+	return fmt.Sprintf("tx=%-6d rx=%-4d (%6d = %.1f%% loss) (%d OOO) (%4.1f Mbit/s) (latency p50<%v p99<%v)",
 		d.TxPackets, d.RxPackets, d.LostPackets,
 		float64(d.LostPackets)*100/float64(d.TxPackets),
 		d.OOOPackets,
-		float64(d.Bytes)*8*1e9/float64(d.DurationNsec)/1e6)
+		d.Mbps(),
+		d.Latency.Quantile(0.5), d.Latency.Quantile(0.99))
+}
+
+// Mbps returns the receive throughput in megabits per second.
+func (d Delta) Mbps() float64 {
+	if d.DurationNsec == 0 {
+		return 0
+	}
+	return float64(d.Bytes) * 8 * 1e9 / float64(d.DurationNsec) / 1e6
+}
+
+// PPS returns the receive rate in packets per second.
+func (d Delta) PPS() float64 {
+	if d.DurationNsec == 0 {
+		return 0
+	}
+	return float64(d.RxPackets) * 1e9 / float64(d.DurationNsec)
 }
 
 type TrafficGen struct {
 	mu        sync.Mutex
-	cur, prev Snapshot // snapshots used for rate control
-	buf       []byte   // pre-generated packet buffer
-	done      bool     // true if the test has completed
+	cur, prev Snapshot  // snapshots used for rate control
+	buf       []byte    // pre-generated packet buffer
+	done      bool      // true if the test has completed
+	epoch     time.Time // base of the timestamps carried in packets
 
 	onFirstPacket func() // function to call on first received packet
 
@@ -83,6 +169,7 @@ type TrafficGen struct {
 func NewTrafficGen(onFirstPacket func()) *TrafficGen {
 	t := TrafficGen{
 		onFirstPacket: onFirstPacket,
+		epoch:         time.Now(),
 	}
 
 	// initially locked, until first Start()
@@ -118,6 +205,14 @@ func (t *TrafficGen) Start(src, dst netip.Addr, bytesPerPacket int, maxPackets i
 	t.mu.Unlock()
 }
 
+// Stop ends the test: Generate returns 0 from then on, and Running
+// returns false.
+func (t *TrafficGen) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done = true
+}
+
 func (t *TrafficGen) Snap() Snapshot {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -172,16 +267,33 @@ func (t *TrafficGen) Generate(b []byte, ofs int) int {
 	binary.BigEndian.PutUint64(
 		b[ofs+ICMPMinSize:ofs+ICMPMinSize+8],
 		uint64(seq))
+	if len(t.buf) >= ICMPMinSize+16 {
+		// Room for a timestamp, to measure latency.
+		binary.BigEndian.PutUint64(
+			b[ofs+ICMPMinSize+8:ofs+ICMPMinSize+16],
+			uint64(time.Since(t.epoch)))
+	}
 
 	return len(t.buf)
 }
 
 // GotPacket processes a packet that came back on the receive side.
 func (t *TrafficGen) GotPacket(b []byte, ofs int) {
+	var latency time.Duration
+	hasTimestamp := len(b)-ofs >= ICMPMinSize+16
+	if hasTimestamp {
+		sent := time.Duration(binary.BigEndian.Uint64(
+			b[ofs+ICMPMinSize+8 : ofs+ICMPMinSize+16]))
+		latency = time.Since(t.epoch) - sent
+	}
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	s := &t.cur
+	if hasTimestamp {
+		s.Latency.add(latency)
+	}
 	seq := int64(binary.BigEndian.Uint64(
 		b[ofs+ICMPMinSize : ofs+ICMPMinSize+8]))
 	if seq > s.LastSeqRx {
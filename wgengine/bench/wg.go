@@ -4,9 +4,13 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
 	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/netip"
 	"os"
 	"sync"
@@ -14,6 +18,8 @@
 
 	"github.com/tailscale/wireguard-go/tun"
 
+	"tailscale.com/derp/derpserver"
+	"tailscale.com/envknob"
 	"tailscale.com/net/dns"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tsd"
@@ -34,6 +40,22 @@ func epFromTyped(eps []tailcfg.Endpoint) (ret []netip.AddrPort) {
 }
 
 func setupWGTest(b *testing.B, logf logger.Logf, traf *TrafficGen, a1, a2 netip.Prefix) {
+	cleanup := setupWGPair(logf, traf, a1, a2, nil)
+	if b != nil {
+		b.Cleanup(cleanup)
+	}
+}
+
+// setupWGPair creates two wgengine instances, the first reading packets
+// from traf and the second delivering them back to it, and connects them
+// as peers.
+//
+// If derpMap is nil, the engines talk directly over UDP on localhost and
+// don't use DERP. Otherwise, they don't advertise any endpoints and so
+// send all traffic through the first region in derpMap.
+//
+// It returns a func which closes the engines.
+func setupWGPair(logf logger.Logf, traf *TrafficGen, a1, a2 netip.Prefix, derpMap *tailcfg.DERPMap) (cleanup func()) {
 	l1 := logger.WithPrefix(logf, "e1: ")
 	k1 := key.NewNode()
 
@@ -57,9 +79,6 @@ func setupWGTest(b *testing.B, logf logger.Logf, traf *TrafficGen, a1, a2 netip.
 	if err != nil {
 		log.Fatalf("e1 init: %v", err)
 	}
-	if b != nil {
-		b.Cleanup(e1.Close)
-	}
 
 	l2 := logger.WithPrefix(logf, "e2: ")
 	k2 := key.NewNode()
@@ -83,13 +102,22 @@ func setupWGTest(b *testing.B, logf logger.Logf, traf *TrafficGen, a1, a2 netip.
 	if err != nil {
 		log.Fatalf("e2 init: %v", err)
 	}
-	if b != nil {
-		b.Cleanup(e2.Close)
-	}
 
 	e1.SetFilter(filter.NewAllowAllForTest(l1))
 	e2.SetFilter(filter.NewAllowAllForTest(l2))
 
+	// With DERP, peers are reached only through their home region.
+	var homeDERP int
+	if derpMap != nil {
+		homeDERP = derpMap.RegionIDs()[0]
+	}
+	endpoints := func(st *wgengine.Status) []netip.AddrPort {
+		if derpMap != nil {
+			return nil
+		}
+		return epFromTyped(st.LocalAddrs)
+	}
+
 	var wait sync.WaitGroup
 	wait.Add(2)
 
@@ -104,11 +132,14 @@ func setupWGTest(b *testing.B, logf logger.Logf, traf *TrafficGen, a1, a2 netip.
 		logf("e1 status: %v", *st)
 
 		n := &tailcfg.Node{
-			ID:         tailcfg.NodeID(0),
+			ID:         tailcfg.NodeID(1),
 			Name:       "n1",
+			Key:        k1.Public(),
+			DiscoKey:   s1.MagicSock.Get().DiscoPublicKey(),
 			Addresses:  []netip.Prefix{a1},
 			AllowedIPs: []netip.Prefix{a1},
-			Endpoints:  epFromTyped(st.LocalAddrs),
+			Endpoints:  endpoints(st),
+			HomeDERP:   homeDERP,
 		}
 		e2.SetNetworkMap(&netmap.NetworkMap{
 			NodeKey: k2.Public(),
@@ -135,11 +166,14 @@ func setupWGTest(b *testing.B, logf logger.Logf, traf *TrafficGen, a1, a2 netip.
 		logf("e2 status: %v", *st)
 
 		n := &tailcfg.Node{
-			ID:         tailcfg.NodeID(0),
+			ID:         tailcfg.NodeID(2),
 			Name:       "n2",
+			Key:        k2.Public(),
+			DiscoKey:   s2.MagicSock.Get().DiscoPublicKey(),
 			Addresses:  []netip.Prefix{a2},
 			AllowedIPs: []netip.Prefix{a2},
-			Endpoints:  epFromTyped(st.LocalAddrs),
+			Endpoints:  endpoints(st),
+			HomeDERP:   homeDERP,
 		}
 		e1.SetNetworkMap(&netmap.NetworkMap{
 			NodeKey: k1.Public(),
@@ -155,11 +189,76 @@ func setupWGTest(b *testing.B, logf logger.Logf, traf *TrafficGen, a1, a2 netip.
 		e2waitDoneOnce.Do(wait.Done)
 	})
 
-	// Not using DERP in this test (for now?).
-	s1.MagicSock.Get().SetDERPMap(&tailcfg.DERPMap{})
-	s2.MagicSock.Get().SetDERPMap(&tailcfg.DERPMap{})
+	if derpMap == nil {
+		derpMap = &tailcfg.DERPMap{}
+	}
+	s1.MagicSock.Get().SetDERPMap(derpMap)
+	s2.MagicSock.Get().SetDERPMap(derpMap)
 
 	wait.Wait()
+
+	return func() {
+		e1.Close()
+		e2.Close()
+	}
+}
+
+// startDERP starts a DERP server on localhost, returning a DERPMap with a
+// single region served by it and a func to stop it.
+func startDERP(logf logger.Logf) (derpMap *tailcfg.DERPMap, cleanup func()) {
+	d := derpserver.New(key.NewNode(), logf)
+
+	httpsrv := httptest.NewUnstartedServer(derpserver.Handler(d))
+	httpsrv.Config.ErrorLog = logger.StdLogger(logf)
+	httpsrv.Config.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	httpsrv.StartTLS()
+
+	derpMap = &tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			1: {
+				RegionID:   1,
+				RegionCode: "bench",
+				Nodes: []*tailcfg.DERPNode{
+					{
+						Name:             "b1",
+						RegionID:         1,
+						HostName:         "bench-node.unused",
+						IPv4:             "127.0.0.1",
+						IPv6:             "none",
+						STUNPort:         -1,
+						DERPPort:         httpsrv.Listener.Addr().(*net.TCPAddr).Port,
+						InsecureForTests: true,
+					},
+				},
+			},
+		},
+	}
+	return derpMap, func() {
+		httpsrv.CloseClientConnections()
+		httpsrv.Close()
+		d.Close()
+	}
+}
+
+// setupWGDERPTest is like setupWGTest, but relays all traffic between the
+// engines through a DERP server on localhost.
+func setupWGDERPTest(b *testing.B, logf logger.Logf, traf *TrafficGen, a1, a2 netip.Prefix) {
+	cleanup := setupWGDERPPair(logf, traf, a1, a2)
+	if b != nil {
+		b.Cleanup(cleanup)
+	}
+}
+
+func setupWGDERPPair(logf logger.Logf, traf *TrafficGen, a1, a2 netip.Prefix) (cleanup func()) {
+	// Don't let the engines discover a direct path to each other.
+	envknob.Setenv("TS_DEBUG_ALWAYS_USE_DERP", "true")
+	derpMap, derpCleanup := startDERP(logger.WithPrefix(logf, "derp: "))
+	wgCleanup := setupWGPair(logf, traf, a1, a2, derpMap)
+	return func() {
+		wgCleanup()
+		derpCleanup()
+		envknob.Setenv("TS_DEBUG_ALWAYS_USE_DERP", "")
+	}
 }
 
 type sourceTun struct {
@@ -0,0 +1,145 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package filter
+
+import (
+	"bytes"
+
+	"tailscale.com/net/flowtrack"
+	"tailscale.com/net/packet"
+	"tailscale.com/util/clientmetric"
+	"tailscale.com/wgengine/filter/filtertype"
+)
+
+var metricAppProtoDrops = clientmetric.NewCounter("filter_drop_app_protocol")
+
+// appFlow is the state of an inbound TCP connection that's limited to
+// application protocols.
+type appFlow struct {
+	allowed filtertype.AppProtoSet
+	blocked bool // the client spoke a protocol that isn't allowed
+}
+
+// runInTCPAppProtos is the TCP part of runIn4 and runIn6 for filters with
+// Matches limited to application protocols (see [Match.AppProtos]).
+//
+// A connection that's only allowed by such Matches is tracked from its SYN
+// until the first data from the client, which must be one of the allowed
+// protocols. Otherwise, that data and the rest of the connection, other than
+// resets, are dropped. Recognizing protocols fails closed: data that's too
+// short to recognize, or arrives out of order, counts as a mismatch.
+func (f *Filter) runInTCPAppProtos(q *packet.Parsed, ms matches) (r Response, why string) {
+	t := flowtrack.MakeTuple(q.IPProto, q.Src, q.Dst)
+	if !q.IsTCPSyn() {
+		return f.checkAppFlow(q, t)
+	}
+	ok, protos := ms.matchAppProtos(q, f.srcIPHasCap)
+	if !ok {
+		return noVerdict, "no rules matched"
+	}
+	if protos == 0 {
+		return Accept, "tcp ok"
+	}
+	f.state.mu.Lock()
+	if fl, ok := f.state.appFlows.Get(t); !ok || !fl.blocked {
+		// A retransmitted SYN doesn't unblock a connection.
+		f.state.appFlows.Add(t, appFlow{allowed: protos})
+	}
+	f.state.mu.Unlock()
+	if len(q.Payload()) > 0 {
+		// TCP Fast Open data.
+		return f.checkAppFlow(q, t)
+	}
+	return Accept, "tcp ok"
+}
+
+// checkAppFlow checks a non-SYN packet of the inbound TCP connection t, or
+// SYN with data, against the state of t in appFlows, if any.
+func (f *Filter) checkAppFlow(q *packet.Parsed, t flowtrack.Tuple) (r Response, why string) {
+	f.state.mu.Lock()
+	defer f.state.mu.Unlock()
+	fl, ok := f.state.appFlows.Get(t)
+	if !ok {
+		return Accept, "tcp non-syn"
+	}
+	if fl.blocked {
+		if q.TCPFlags&packet.TCPRst != 0 {
+			// Let the local end of the connection clean up.
+			f.state.appFlows.Remove(t)
+			return Accept, "tcp rst"
+		}
+		return Drop, "app protocol mismatch"
+	}
+	payload := q.Payload()
+	if len(payload) == 0 {
+		return Accept, "tcp non-syn"
+	}
+	if fl.allowed.Contains(detectAppProto(payload)) {
+		// The rest of the connection takes the fast path.
+		f.state.appFlows.Remove(t)
+		return Accept, "app protocol ok"
+	}
+	fl.blocked = true
+	metricAppProtoDrops.Add(1)
+	return Drop, "app protocol mismatch"
+}
+
+// matchAppProtos is like match, for a TCP SYN. If q is allowed only by
+// Matches limited to application protocols, it also returns the union of
+// their protocols. If any other Match allows q, protos is zero.
+func (ms matches) matchAppProtos(q *packet.Parsed, hasCap CapTestFunc) (ok bool, protos filtertype.AppProtoSet) {
+	for i := range ms {
+		m := &ms[i]
+		if m.AppProtos != 0 && protos.Contains(m.AppProtos) {
+			continue // nothing new to learn
+		}
+		if !ms[i:i+1].match(q, hasCap) {
+			continue
+		}
+		if m.AppProtos == 0 {
+			return true, 0
+		}
+		ok = true
+		protos |= m.AppProtos
+	}
+	return ok, protos
+}
+
+// httpMethods are the prefixes of the first line of HTTP/1.x requests, and
+// of the HTTP/2 connection preface.
+var httpMethods = [][]byte{
+	[]byte("GET "),
+	[]byte("HEAD "),
+	[]byte("POST "),
+	[]byte("PUT "),
+	[]byte("DELETE "),
+	[]byte("CONNECT "),
+	[]byte("OPTIONS "),
+	[]byte("TRACE "),
+	[]byte("PATCH "),
+	[]byte("PRI * HTTP/2.0"),
+}
+
+// detectAppProto returns the application protocol that a client whose first
+// data on a TCP connection is b speaks, or zero if it's not recognized.
+func detectAppProto(b []byte) filtertype.AppProtoSet {
+	switch {
+	case len(b) >= 3 && b[0] == 0x16 && b[1] == 0x03 && b[2] <= 0x04:
+		// TLS handshake record, for TLS 1.0 to 1.3 (and SSL 3.0).
+		return filtertype.AppProtoTLS
+	case bytes.HasPrefix(b, []byte("SSH-")):
+		// The SSH protocol version exchange (RFC 4253, section 4.2).
+		return filtertype.AppProtoSSH
+	case len(b) >= 6 && b[0] == 0x03 && b[1] == 0x00 && b[5]&0xf0 == 0xe0:
+		// A TPKT header (RFC 1006) with an X.224 Connection Request,
+		// with which RDP connections start.
+		return filtertype.AppProtoRDP
+	}
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, m) {
+			return filtertype.AppProtoHTTP
+		}
+	}
+	return 0
+}
@@ -0,0 +1,185 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package filter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/netip"
+	"testing"
+
+	"go4.org/netipx"
+	"tailscale.com/net/packet"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/ipproto"
+	"tailscale.com/util/must"
+	"tailscale.com/wgengine/filter/filtertype"
+)
+
+// tcp4 returns a parsed IPv4 TCP packet with the given flags and payload.
+func tcp4(src, dst string, sport, dport uint16, flags packet.TCPFlag, payload string) *packet.Parsed {
+	b := make([]byte, 40+len(payload))
+	h := packet.IP4Header{IPProto: ipproto.TCP, Src: mustIP(src), Dst: mustIP(dst)}
+	if err := h.Marshal(b); err != nil {
+		panic(err)
+	}
+	binary.BigEndian.PutUint16(b[20:], sport)
+	binary.BigEndian.PutUint16(b[22:], dport)
+	b[32] = 5 << 4 // data offset
+	b[33] = byte(flags)
+	copy(b[40:], payload)
+	q := new(packet.Parsed)
+	q.Decode(b)
+	return q
+}
+
+func TestAppProtos(t *testing.T) {
+	appProtos := func(protos ...string) tailcfg.PeerCapMap {
+		return tailcfg.PeerCapMap{
+			tailcfg.PeerCapabilityAppProtocols: {
+				tailcfg.RawMessage(must.Get(json.Marshal(tailcfg.AppProtocolsCapValue{Protocols: protos}))),
+			},
+		}
+	}
+	dst := netip.MustParsePrefix("100.64.0.2/32")
+	mm, err := MatchesFromFilterRules([]tailcfg.FilterRule{
+		{
+			SrcIPs:   []string{"100.64.0.1"},
+			DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.2", Ports: tailcfg.PortRange{First: 8443, Last: 8443}}},
+			CapGrant: []tailcfg.CapGrant{{Dsts: []netip.Prefix{dst}, CapMap: appProtos("tls")}},
+		},
+		{
+			SrcIPs:   []string{"100.64.0.1"},
+			DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.2", Ports: tailcfg.PortRange{First: 8443, Last: 8443}}},
+			CapGrant: []tailcfg.CapGrant{{Dsts: []netip.Prefix{dst}, CapMap: appProtos("http")}},
+		},
+		{
+			// Unrestricted for another source.
+			SrcIPs:   []string{"100.64.0.3"},
+			DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.2", Ports: tailcfg.PortRange{First: 8443, Last: 8443}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mm[0].AppProtos, filtertype.AppProtoTLS; got != want {
+		t.Fatalf("AppProtos = %v; want %v", got, want)
+	}
+	if got := mm[0].IPProto.AsSlice(); len(got) != 1 || got[0] != ipproto.TCP {
+		t.Fatalf("IPProto = %v; want just TCP", got)
+	}
+	var b netipx.IPSetBuilder
+	b.AddPrefix(dst)
+	filt := New(mm, nil, must.Get(b.IPSet()), nil, nil, t.Logf)
+
+	const (
+		syn = packet.TCPSyn
+		ack = packet.TCPAck
+		psh = packet.TCPPsh | packet.TCPAck
+		rst = packet.TCPRst
+	)
+	tlsHello := "\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03"
+	type step struct {
+		q    *packet.Parsed
+		want Response
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "tls",
+			steps: []step{
+				{tcp4("100.64.0.1", "100.64.0.2", 1000, 8443, syn, ""), Accept},
+				{tcp4("100.64.0.1", "100.64.0.2", 1000, 8443, ack, ""), Accept},
+				{tcp4("100.64.0.1", "100.64.0.2", 1000, 8443, psh, tlsHello), Accept},
+				{tcp4("100.64.0.1", "100.64.0.2", 1000, 8443, psh, "anything after"), Accept},
+			},
+		},
+		{
+			name: "http",
+			steps: []step{
+				{tcp4("100.64.0.1", "100.64.0.2", 1001, 8443, syn, ""), Accept},
+				{tcp4("100.64.0.1", "100.64.0.2", 1001, 8443, psh, "GET / HTTP/1.1\r\n"), Accept},
+			},
+		},
+		{
+			name: "ssh-mismatch",
+			steps: []step{
+				{tcp4("100.64.0.1", "100.64.0.2", 1002, 8443, syn, ""), Accept},
+				{tcp4("100.64.0.1", "100.64.0.2", 1002, 8443, psh, "SSH-2.0-OpenSSH_9.6\r\n"), Drop},
+				{tcp4("100.64.0.1", "100.64.0.2", 1002, 8443, psh, tlsHello), Drop},
+				{tcp4("100.64.0.1", "100.64.0.2", 1002, 8443, syn, ""), Accept},
+				{tcp4("100.64.0.1", "100.64.0.2", 1002, 8443, psh, tlsHello), Drop},
+				{tcp4("100.64.0.1", "100.64.0.2", 1002, 8443, rst, ""), Accept},
+			},
+		},
+		{
+			name: "fast-open-mismatch",
+			steps: []step{
+				{tcp4("100.64.0.1", "100.64.0.2", 1003, 8443, syn, "\x03\x00\x00\x13\x0e\xe0"), Drop},
+			},
+		},
+		{
+			name: "unrestricted-source",
+			steps: []step{
+				{tcp4("100.64.0.3", "100.64.0.2", 1004, 8443, syn, ""), Accept},
+				{tcp4("100.64.0.3", "100.64.0.2", 1004, 8443, psh, "SSH-2.0-OpenSSH_9.6\r\n"), Accept},
+			},
+		},
+		{
+			name: "other-port",
+			steps: []step{
+				{tcp4("100.64.0.1", "100.64.0.2", 1005, 22, syn, ""), Drop},
+			},
+		},
+		{
+			name: "outbound-connection",
+			steps: []step{
+				{tcp4("100.64.0.1", "100.64.0.2", 8443, 1006, ack, "SSH-2.0-OpenSSH_9.6\r\n"), Accept},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, s := range tt.steps {
+				if got := filt.RunIn(s.q, 0); got != s.want {
+					t.Fatalf("step %d: RunIn(%v) = %v; want %v", i, s.q, got, s.want)
+				}
+			}
+		})
+	}
+
+	if _, err := MatchesFromFilterRules([]tailcfg.FilterRule{{
+		SrcIPs:   []string{"100.64.0.1"},
+		DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.2", Ports: tailcfg.PortRange{First: 8443, Last: 8443}}},
+		CapGrant: []tailcfg.CapGrant{{Dsts: []netip.Prefix{dst}, CapMap: appProtos("gopher")}},
+	}}); err == nil {
+		t.Errorf("got no error for unknown application protocol")
+	}
+}
+
+func TestDetectAppProto(t *testing.T) {
+	tests := []struct {
+		in   string
+		want filtertype.AppProtoSet
+	}{
+		{"\x16\x03\x01\x02\x00\x01", filtertype.AppProtoTLS},
+		{"\x16\x03\x05", 0},
+		{"SSH-2.0-OpenSSH_9.6\r\n", filtertype.AppProtoSSH},
+		{"GET / HTTP/1.1\r\n", filtertype.AppProtoHTTP},
+		{"OPTIONS * HTTP/1.1\r\n", filtertype.AppProtoHTTP},
+		{"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", filtertype.AppProtoHTTP},
+		{"GETX / HTTP/1.1\r\n", 0},
+		{"\x03\x00\x00\x13\x0e\xe0\x00\x00", filtertype.AppProtoRDP},
+		{"\x03\x00\x00\x13", 0},
+		{"S", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := detectAppProto([]byte(tt.in)); got != tt.want {
+			t.Errorf("detectAppProto(%q) = %v; want %v", tt.in, got, tt.want)
+		}
+	}
+}
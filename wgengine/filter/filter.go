@@ -60,6 +60,11 @@ type Filter struct {
 	// capability grants, partitioned by source IP address family.
 	cap4, cap6 matches
 
+	// hasAppProtos is whether any of the matches are limited to
+	// application protocols, which requires tracking inbound TCP
+	// connections until their protocol is known.
+	hasAppProtos bool
+
 	// state is the connection tracking state attached to this
 	// filter. It is used to allow incoming traffic that is a response
 	// to an outbound connection that this node made, even if those
@@ -103,11 +108,18 @@ type Filter struct {
 type filterState struct {
 	mu  sync.Mutex
 	lru *flowtrack.Cache[struct{}] // from flowtrack.Tuple -> struct{}
+
+	// appFlows are the inbound TCP connections limited to application
+	// protocols whose protocol isn't known yet, or didn't match.
+	appFlows *flowtrack.Cache[appFlow]
 }
 
 // lruMax is the size of the LRU cache in filterState.
 const lruMax = 512
 
+// appFlowsMax is the size of the appFlows cache in filterState.
+const appFlowsMax = 4096
+
 // Response is a verdict from the packet filter.
 type Response int
 
@@ -229,7 +241,8 @@ func New(matches []Match, capTest CapTestFunc, localNets, logIPs *netipx.IPSet,
 		state = shareStateWith.state
 	} else {
 		state = &filterState{
-			lru: &flowtrack.Cache[struct{}]{MaxEntries: lruMax},
+			lru:      &flowtrack.Cache[struct{}]{MaxEntries: lruMax},
+			appFlows: &flowtrack.Cache[appFlow]{MaxEntries: appFlowsMax},
 		}
 	}
 
@@ -246,6 +259,7 @@ func New(matches []Match, capTest CapTestFunc, localNets, logIPs *netipx.IPSet,
 		state:       state,
 		srcIPHasCap: capTest,
 	}
+	f.hasAppProtos = slices.ContainsFunc(matches, func(m Match) bool { return m.AppProtos != 0 })
 	if localNets != nil {
 		p := localNets.Prefixes()
 		p4, p6 := slicesx.Partition(p, func(p netip.Prefix) bool { return p.Addr().Is4() })
@@ -270,6 +284,9 @@ func matchesFamily(ms matches, keep func(netip.Addr) bool) matches {
 		var retm Match
 		retm.IPProto = m.IPProto
 		retm.SrcCaps = m.SrcCaps
+		retm.NotBefore = m.NotBefore
+		retm.NotAfter = m.NotAfter
+		retm.AppProtos = m.AppProtos
 		for _, src := range m.Srcs {
 			if keep(src.Addr()) {
 				retm.Srcs = append(retm.Srcs, src)
@@ -283,6 +300,7 @@ func matchesFamily(ms matches, keep func(netip.Addr) bool) matches {
 		}
 		if (len(retm.Srcs) > 0 || len(retm.SrcCaps) > 0) && len(retm.Dsts) > 0 {
 			retm.SrcsContains = ipset.NewContainsIPFunc(views.SliceOf(retm.Srcs))
+			retm.DstPorts = newDstPortsFunc(retm.Dsts)
 			ret = append(ret, retm)
 		}
 	}
@@ -297,7 +315,7 @@ func capMatchesFunc(ms matches, keep func(netip.Addr) bool) matches {
 		if len(m.Caps) == 0 {
 			continue
 		}
-		retm := Match{Caps: m.Caps}
+		retm := Match{Caps: m.Caps, NotBefore: m.NotBefore, NotAfter: m.NotAfter}
 		for _, src := range m.Srcs {
 			if keep(src.Addr()) {
 				retm.Srcs = append(retm.Srcs, src)
@@ -340,6 +358,11 @@ func init() {
 }
 
 func (f *Filter) logRateLimit(runflags RunFlags, q *packet.Parsed, dir direction, r Response, why string) {
+	if r == Drop {
+		// Record why for packet capture, which may capture dropped
+		// packets regardless of logging.
+		q.CaptureMeta.DropReason = why
+	}
 	if runflags == 0 || !f.loggingAllowed(q) {
 		return
 	}
@@ -416,8 +439,9 @@ func (f *Filter) CapsWithValues(srcIP, dstIP netip.Addr) tailcfg.PeerCapMap {
 		mm = f.cap6
 	}
 	var out tailcfg.PeerCapMap
-	for _, m := range mm {
-		if !m.SrcsContains(srcIP) {
+	for i := range mm {
+		m := &mm[i]
+		if !m.SrcsContains(srcIP) || !isActive(m) {
 			continue
 		}
 		for _, cm := range m.Caps {
@@ -521,6 +545,9 @@ func (f *Filter) runIn4(q *packet.Parsed) (r Response, why string) {
 			return Accept, "icmp ok"
 		}
 	case ipproto.TCP:
+		if f.hasAppProtos {
+			return f.runInTCPAppProtos(q, f.matches4)
+		}
 		// For TCP, we want to allow *outgoing* connections,
 		// which means we want to allow return packets on those
 		// connections. To make this restriction work, we need to
@@ -583,6 +610,9 @@ func (f *Filter) runIn6(q *packet.Parsed) (r Response, why string) {
 			return Accept, "icmp ok"
 		}
 	case ipproto.TCP:
+		if f.hasAppProtos {
+			return f.runInTCPAppProtos(q, f.matches6)
+		}
 		// For TCP, we want to allow *outgoing* connections,
 		// which means we want to allow return packets on those
 		// connections. To make this restriction work, we need to
@@ -8,12 +8,15 @@
 	"encoding/json"
 	"flag"
 	"fmt"
+	"maps"
+	"math/rand/v2"
 	"net/netip"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -233,6 +236,29 @@ func TestUDPState(t *testing.T) {
 	}
 }
 
+func TestCaptureDropReason(t *testing.T) {
+	acl := newFilter(t.Logf)
+
+	// Dropped whether or not drops are being logged.
+	for _, flags := range []RunFlags{0, LogDrops} {
+		p := parsed(ipproto.UDP, "119.119.119.119", "102.102.102.102", 4242, 4343)
+		if got := acl.RunIn(&p, flags); got != Drop {
+			t.Fatalf("got %v; want Drop", got)
+		}
+		if p.CaptureMeta.DropReason == "" {
+			t.Errorf("flags=%v: DropReason not set on dropped packet", flags)
+		}
+	}
+
+	p := parsed(ipproto.TCP, "8.1.1.1", "1.2.3.4", 999, 22)
+	if got := acl.RunIn(&p, 0); got != Accept {
+		t.Fatalf("got %v; want Accept", got)
+	}
+	if p.CaptureMeta.DropReason != "" {
+		t.Errorf("DropReason = %q on accepted packet", p.CaptureMeta.DropReason)
+	}
+}
+
 func TestNoAllocs(t *testing.T) {
 	acl := newFilter(t.Logf)
 
@@ -1324,3 +1350,200 @@ func benchmarkFile(b *testing.B, file string, opt benchOpt) {
 		}
 	}
 }
+
+func TestValidityWindow(t *testing.T) {
+	start := time.Date(2026, 10, 12, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)
+	validity := tailcfg.PeerCapMap{
+		tailcfg.PeerCapabilityValidity: {
+			tailcfg.RawMessage(must.Get(json.Marshal(tailcfg.ValidityCapValue{NotBefore: start, NotAfter: end}))),
+		},
+	}
+	dst := netip.MustParsePrefix("100.64.0.2/32")
+	mm, err := MatchesFromFilterRules([]tailcfg.FilterRule{
+		{
+			SrcIPs:   []string{"100.64.0.1"},
+			DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.2", Ports: tailcfg.PortRange{First: 22, Last: 22}}},
+			CapGrant: []tailcfg.CapGrant{{Dsts: []netip.Prefix{dst}, CapMap: validity}},
+		},
+		{
+			SrcIPs: []string{"100.64.0.1"},
+			CapGrant: []tailcfg.CapGrant{{
+				Dsts:   []netip.Prefix{dst},
+				Caps:   []tailcfg.PeerCapability{"temp-admin"},
+				CapMap: validity,
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mm {
+		if !m.NotBefore.Equal(start) || !m.NotAfter.Equal(end) {
+			t.Fatalf("match window = [%v, %v); want [%v, %v)", m.NotBefore, m.NotAfter, start, end)
+		}
+	}
+	var b netipx.IPSetBuilder
+	b.AddPrefix(dst)
+	localNets := must.Get(b.IPSet())
+	filt := New(mm, nil, localNets, nil, nil, t.Logf)
+
+	src, dstIP := mustIP("100.64.0.1"), dst.Addr()
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"before", start.Add(-time.Hour), false},
+		{"just-before-within-skew", start.Add(-validitySkew / 2), true},
+		{"during", start.Add(time.Hour), true},
+		{"just-after-within-skew", end.Add(validitySkew / 2), true},
+		{"after", end.Add(validitySkew), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tstest.Replace(t, &timeNow, func() time.Time { return tt.now })
+			if got := filt.CheckTCP(src, dstIP, 22) == Accept; got != tt.want {
+				t.Errorf("CheckTCP accepted = %v; want %v", got, tt.want)
+			}
+			caps := filt.CapsWithValues(src, dstIP)
+			if got := caps.HasCapability("temp-admin"); got != tt.want {
+				t.Errorf("has temp-admin = %v; want %v", got, tt.want)
+			}
+			if caps.HasCapability(tailcfg.PeerCapabilityValidity) {
+				t.Errorf("validity capability unexpectedly granted")
+			}
+		})
+	}
+}
+
+// randomDsts returns n random NetPortRanges of family fam ("4" or "6"),
+// drawn from a small address space so that they overlap and nest, with a
+// few distinct port ranges.
+func randomDsts(rng *rand.Rand, fam string, n int) []NetPortRange {
+	portRanges := []PortRange{filtertype.AllPorts, {First: 22, Last: 22}, {First: 80, Last: 80}, {First: 443, Last: 443}, {First: 1000, Last: 2000}}
+	dsts := make([]NetPortRange, n)
+	for i := range dsts {
+		dsts[i] = NetPortRange{
+			Net:   randomPrefix(rng, fam),
+			Ports: portRanges[rng.IntN(len(portRanges))],
+		}
+	}
+	return dsts
+}
+
+func randomAddr(rng *rand.Rand, fam string) netip.Addr {
+	if fam == "4" {
+		return netip.AddrFrom4([4]byte{100, 64, byte(rng.IntN(4)), byte(rng.IntN(256))})
+	}
+	a := tsaddr.TailscaleULARange().Addr().As16()
+	a[13], a[14], a[15] = byte(rng.IntN(4)), byte(rng.IntN(4)), byte(rng.IntN(256))
+	return netip.AddrFrom16(a)
+}
+
+func randomPrefix(rng *rand.Rand, fam string) netip.Prefix {
+	a := randomAddr(rng, fam)
+	bits := a.BitLen()
+	if rng.IntN(2) == 0 {
+		bits -= rng.IntN(20)
+	}
+	if rng.IntN(50) == 0 {
+		bits = 0
+	}
+	return netip.PrefixFrom(a, bits).Masked()
+}
+
+// TestDstPortsFunc checks that the table built by newDstPortsFunc agrees with
+// scanning Dsts.
+func TestDstPortsFunc(t *testing.T) {
+	if f := newDstPortsFunc(randomDsts(rand.New(rand.NewPCG(1, 1)), "4", dstPortsTableMin-1)); f != nil {
+		t.Errorf("got table for %d Dsts; want scanning", dstPortsTableMin-1)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, fam := range []string{"4", "6"} {
+		for range 200 {
+			dsts := randomDsts(rng, fam, dstPortsTableMin+rng.IntN(100))
+			dstPorts := newDstPortsFunc(dsts)
+			if dstPorts == nil {
+				t.Fatalf("got no table for %d Dsts", len(dsts))
+			}
+			for range 100 {
+				ip := randomAddr(rng, fam)
+				want := map[PortRange]bool{}
+				for _, d := range dsts {
+					if d.Net.Contains(ip) {
+						want[d.Ports] = true
+					}
+				}
+				got := map[PortRange]bool{}
+				for _, pr := range dstPorts(ip) {
+					if got[pr] {
+						t.Errorf("DstPorts(%v) returned %v twice", ip, pr)
+					}
+					got[pr] = true
+				}
+				if !maps.Equal(got, want) {
+					t.Fatalf("DstPorts(%v) = %v; want %v\ndsts: %v", ip, got, want, dsts)
+				}
+			}
+		}
+	}
+}
+
+// TestMatchDstsTable checks that packet matching gives the same results
+// whether Dsts are scanned or looked up in a table.
+func TestMatchDstsTable(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	for _, fam := range []string{"4", "6"} {
+		src := randomAddr(rng, fam)
+		for range 100 {
+			scan := m(nets("0.0.0.0/0", "::/0"), randomDsts(rng, fam, dstPortsTableMin+rng.IntN(50)))
+			table := scan
+			table.DstPorts = newDstPortsFunc(table.Dsts)
+			for range 100 {
+				dst := randomAddr(rng, fam)
+				port := []uint16{22, 80, 443, 1500, 8080}[rng.IntN(5)]
+				q := parsed(ipproto.TCP, src.String(), dst.String(), 1234, port)
+				for _, fn := range []struct {
+					name string
+					f    func(matches, *packet.Parsed) bool
+				}{
+					{"match", func(ms matches, q *packet.Parsed) bool { return ms.match(q, nil) }},
+					{"matchIPsOnly", func(ms matches, q *packet.Parsed) bool { return ms.matchIPsOnly(q, nil) }},
+					{"matchProtoAndIPsOnlyIfAllPorts", matches.matchProtoAndIPsOnlyIfAllPorts},
+				} {
+					want := fn.f(matches{scan}, &q)
+					if got := fn.f(matches{table}, &q); got != want {
+						t.Fatalf("%s(%v:%d) with table = %v; scanning = %v", fn.name, dst, port, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkMatchDsts(b *testing.B) {
+	src := netip.MustParseAddr("100.99.99.99")
+	for _, n := range []int{4, 8, 16, 64, 256, 1024, 4096} {
+		rng := rand.New(rand.NewPCG(5, 6))
+		scan := m(nets("0.0.0.0/0"), randomDsts(rng, "4", n))
+		table := scan
+		table.DstPorts = newDstPortsTable(table.Dsts)
+		var pkts []packet.Parsed
+		for range 256 {
+			pkts = append(pkts, parsed(ipproto.TCP, src.String(), randomAddr(rng, "4").String(), 1234, 443))
+		}
+		for _, bm := range []struct {
+			name string
+			ms   matches
+		}{{"scan", matches{scan}}, {"table", matches{table}}} {
+			b.Run(fmt.Sprintf("%s/%d", bm.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := range b.N {
+					bm.ms.match(&pkts[i%len(pkts)], nil)
+				}
+			})
+		}
+	}
+}
@@ -8,6 +8,7 @@
 	"fmt"
 	"net/netip"
 	"strings"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/ipproto"
@@ -63,6 +64,56 @@ type CapMatch struct {
 	Values []tailcfg.RawMessage
 }
 
+// AppProtoSet is a set of application-layer protocols that can be
+// recognized from the first data a client sends on a TCP connection.
+type AppProtoSet uint8
+
+const (
+	AppProtoTLS AppProtoSet = 1 << iota
+	AppProtoSSH
+	AppProtoHTTP
+	AppProtoRDP
+)
+
+var appProtoNames = []struct {
+	p    AppProtoSet
+	name string
+}{
+	{AppProtoTLS, "tls"},
+	{AppProtoSSH, "ssh"},
+	{AppProtoHTTP, "http"},
+	{AppProtoRDP, "rdp"},
+}
+
+// ParseAppProto returns the AppProtoSet containing just the protocol with
+// the given name, as used in [tailcfg.AppProtocolsCapValue].
+func ParseAppProto(name string) (AppProtoSet, error) {
+	for _, pn := range appProtoNames {
+		if pn.name == name {
+			return pn.p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown application protocol %q", name)
+}
+
+// Contains reports whether s contains all of the protocols in p.
+func (s AppProtoSet) Contains(p AppProtoSet) bool {
+	return p != 0 && s&p == p
+}
+
+func (s AppProtoSet) String() string {
+	if s == 0 {
+		return "none"
+	}
+	var names []string
+	for _, pn := range appProtoNames {
+		if s&pn.p != 0 {
+			names = append(names, pn.name)
+		}
+	}
+	return strings.Join(names, "+")
+}
+
 // Match matches packets from any IP address in Srcs to any ip:port in
 // Dsts.
 type Match struct {
@@ -87,7 +138,39 @@ type Match struct {
 	SrcCaps []tailcfg.NodeCapability
 
 	Dsts []NetPortRange // optional, if source matches
-	Caps []CapMatch     // optional, if source match
+	// DstPorts, if non-nil, is an optimized function that returns the Ports
+	// of every element of Dsts whose Net contains Addr, or nil if none do.
+	// It's only set when Dsts is long enough for it to be faster than
+	// scanning Dsts.
+	DstPorts func(netip.Addr) []PortRange `json:"-"`
+	Caps     []CapMatch                   // optional, if source match
+
+	// NotBefore and NotAfter, if non-zero, bound the times at which the
+	// Match applies, from a [tailcfg.PeerCapabilityValidity] grant.
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// AppProtos, if non-zero, limits the TCP connections that the Match
+	// allows to those speaking one of these application protocols, from a
+	// [tailcfg.PeerCapabilityAppProtocols] grant.
+	AppProtos AppProtoSet
+}
+
+// ActiveAt reports whether m applies at time now, allowing for clocks
+// that are off by up to skew.
+func (m *Match) ActiveAt(now time.Time, skew time.Duration) bool {
+	if !m.NotBefore.IsZero() && now.Before(m.NotBefore.Add(-skew)) {
+		return false
+	}
+	if !m.NotAfter.IsZero() && !now.Before(m.NotAfter.Add(skew)) {
+		return false
+	}
+	return true
+}
+
+// HasWindow reports whether m only applies at some times.
+func (m *Match) HasWindow() bool {
+	return !m.NotBefore.IsZero() || !m.NotAfter.IsZero()
 }
 
 func (m Match) String() string {
@@ -7,6 +7,7 @@
 
 import (
 	"net/netip"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/ipproto"
@@ -41,7 +42,11 @@ func (src *Match) Clone() *Match {
 	SrcsContains func(netip.Addr) bool
 	SrcCaps      []tailcfg.NodeCapability
 	Dsts         []NetPortRange
+	DstPorts     func(netip.Addr) []PortRange
 	Caps         []CapMatch
+	NotBefore    time.Time
+	NotAfter     time.Time
+	AppProtos    AppProtoSet
 }{})
 
 // Clone makes a deep copy of CapMatch.
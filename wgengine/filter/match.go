@@ -4,8 +4,13 @@
 package filter
 
 import (
+	"cmp"
+	"maps"
 	"net/netip"
+	"slices"
+	"time"
 
+	"github.com/gaissmai/bart"
 	"tailscale.com/net/packet"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/views"
@@ -20,9 +25,20 @@ func (ms matches) match(q *packet.Parsed, hasCap CapTestFunc) bool {
 		if !views.SliceContains(m.IPProto, q.IPProto) {
 			continue
 		}
+		if !isActive(m) {
+			continue
+		}
 		if !srcMatches(m, q.Src.Addr(), hasCap) {
 			continue
 		}
+		if m.DstPorts != nil {
+			for _, pr := range m.DstPorts(q.Dst.Addr()) {
+				if pr.Contains(q.Dst.Port()) {
+					return true
+				}
+			}
+			continue
+		}
 		for _, dst := range m.Dsts {
 			if !dst.Net.Contains(q.Dst.Addr()) {
 				continue
@@ -36,6 +52,18 @@ func (ms matches) match(q *packet.Parsed, hasCap CapTestFunc) bool {
 	return false
 }
 
+// validitySkew is how far off this node's clock is assumed to be able to be
+// when enforcing Match validity windows.
+const validitySkew = time.Minute
+
+// timeNow is time.Now, but can be replaced by tests.
+var timeNow = time.Now
+
+// isActive reports whether m applies now, per its validity window.
+func isActive(m *filtertype.Match) bool {
+	return !m.HasWindow() || m.ActiveAt(timeNow(), validitySkew)
+}
+
 // srcMatches reports whether srcAddr matche the src requirements in m, either
 // by Srcs (using SrcsContains), or by the node having a capability listed
 // in SrcCaps using the provided hasCap function.
@@ -61,8 +89,15 @@ func srcMatches(m *filtertype.Match, srcAddr netip.Addr, hasCap CapTestFunc) boo
 
 func (ms matches) matchIPsOnly(q *packet.Parsed, hasCap CapTestFunc) bool {
 	srcAddr := q.Src.Addr()
-	for _, m := range ms {
-		if !m.SrcsContains(srcAddr) {
+	for i := range ms {
+		m := &ms[i]
+		if !m.SrcsContains(srcAddr) || !isActive(m) {
+			continue
+		}
+		if m.DstPorts != nil {
+			if len(m.DstPorts(q.Dst.Addr())) > 0 {
+				return true
+			}
 			continue
 		}
 		for _, dst := range m.Dsts {
@@ -72,7 +107,11 @@ func (ms matches) matchIPsOnly(q *packet.Parsed, hasCap CapTestFunc) bool {
 		}
 	}
 	if hasCap != nil {
-		for _, m := range ms {
+		for i := range ms {
+			m := &ms[i]
+			if !isActive(m) {
+				continue
+			}
 			for _, c := range m.SrcCaps {
 				if hasCap(srcAddr, c) {
 					return true
@@ -87,11 +126,18 @@ func (ms matches) matchIPsOnly(q *packet.Parsed, hasCap CapTestFunc) bool {
 // Match if for the right IP Protocol and IP address, but ports are
 // ignored, as long as the match is for the entire uint16 port range.
 func (ms matches) matchProtoAndIPsOnlyIfAllPorts(q *packet.Parsed) bool {
-	for _, m := range ms {
+	for i := range ms {
+		m := &ms[i]
 		if !views.SliceContains(m.IPProto, q.IPProto) {
 			continue
 		}
-		if !m.SrcsContains(q.Src.Addr()) {
+		if !m.SrcsContains(q.Src.Addr()) || !isActive(m) {
+			continue
+		}
+		if m.DstPorts != nil {
+			if slices.Contains(m.DstPorts(q.Dst.Addr()), filtertype.AllPorts) {
+				return true
+			}
 			continue
 		}
 		for _, dst := range m.Dsts {
@@ -105,3 +151,55 @@ func (ms matches) matchProtoAndIPsOnlyIfAllPorts(q *packet.Parsed) bool {
 	}
 	return false
 }
+
+// dstPortsTableMin is the number of Dsts at which a Match's Dsts are
+// indexed in a routing table for lookups, rather than scanned. Below it,
+// scanning is as fast; see BenchmarkMatchDsts.
+const dstPortsTableMin = 8
+
+// newDstPortsFunc returns a func for [filtertype.Match.DstPorts] for dsts,
+// or nil if dsts is short enough to be scanned.
+func newDstPortsFunc(dsts []filtertype.NetPortRange) func(netip.Addr) []filtertype.PortRange {
+	if len(dsts) < dstPortsTableMin {
+		return nil
+	}
+	return newDstPortsTable(dsts)
+}
+
+// newDstPortsTable returns a func for [filtertype.Match.DstPorts] for dsts
+// which looks up addresses in a routing table.
+func newDstPortsTable(dsts []filtertype.NetPortRange) func(netip.Addr) []filtertype.PortRange {
+	ports := map[netip.Prefix][]filtertype.PortRange{}
+	for _, dst := range dsts {
+		p := dst.Net.Masked()
+		if !slices.Contains(ports[p], dst.Ports) {
+			ports[p] = append(ports[p], dst.Ports)
+		}
+	}
+
+	// A table lookup only finds the longest prefix containing an address,
+	// so each prefix's value must also include the ports of all the shorter
+	// prefixes containing it. Inserting prefixes from shortest to longest
+	// means that the lookup of a prefix's own address finds the complete
+	// value of its longest proper parent, if any. (Distinct prefixes of the
+	// same length don't overlap.)
+	pfxs := slices.SortedFunc(maps.Keys(ports), func(a, b netip.Prefix) int {
+		return cmp.Compare(a.Bits(), b.Bits())
+	})
+	t := new(bart.Table[[]filtertype.PortRange])
+	for _, p := range pfxs {
+		v := ports[p]
+		if parent, ok := t.Lookup(p.Addr()); ok {
+			for _, pr := range parent {
+				if !slices.Contains(v, pr) {
+					v = append(v, pr)
+				}
+			}
+		}
+		t.Insert(p, v)
+	}
+	return func(ip netip.Addr) []filtertype.PortRange {
+		v, _ := t.Lookup(ip)
+		return v
+	}
+}
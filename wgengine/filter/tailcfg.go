@@ -4,6 +4,7 @@
 package filter
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/netip"
 	"strings"
@@ -14,6 +15,7 @@
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/ipproto"
 	"tailscale.com/types/views"
+	"tailscale.com/wgengine/filter/filtertype"
 )
 
 var defaultProtos = []ipproto.Proto{
@@ -93,6 +95,20 @@ func MatchesFromFilterRules(pf []tailcfg.FilterRule) ([]Match, error) {
 				})
 			}
 		}
+		if err := setValidity(&m, r.CapGrant); err != nil {
+			// Fail closed: a rule whose validity we can't tell
+			// doesn't apply at all.
+			if erracc == nil {
+				erracc = err
+			}
+			continue
+		}
+		if err := setAppProtos(&m, r.CapGrant); err != nil {
+			if erracc == nil {
+				erracc = err
+			}
+			continue
+		}
 		for _, cm := range r.CapGrant {
 			for _, dstNet := range cm.Dsts {
 				for _, cap := range cm.Caps {
@@ -102,6 +118,10 @@ func MatchesFromFilterRules(pf []tailcfg.FilterRule) ([]Match, error) {
 					})
 				}
 				for cap, val := range cm.CapMap {
+					switch cap {
+					case tailcfg.PeerCapabilityValidity, tailcfg.PeerCapabilityAppProtocols:
+						continue // handled by setValidity and setAppProtos
+					}
 					m.Caps = append(m.Caps, CapMatch{
 						Dst:    dstNet,
 						Cap:    tailcfg.PeerCapability(cap),
@@ -116,6 +136,27 @@ func MatchesFromFilterRules(pf []tailcfg.FilterRule) ([]Match, error) {
 	return mm, erracc
 }
 
+// setValidity sets m's NotBefore and NotAfter from the
+// [tailcfg.PeerCapabilityValidity] values in grants, if any. With several
+// values, m applies only within all of them.
+func setValidity(m *Match, grants []tailcfg.CapGrant) error {
+	for _, cg := range grants {
+		for _, raw := range cg.CapMap[tailcfg.PeerCapabilityValidity] {
+			var v tailcfg.ValidityCapValue
+			if err := json.Unmarshal([]byte(raw), &v); err != nil {
+				return fmt.Errorf("invalid %s value: %w", tailcfg.PeerCapabilityValidity, err)
+			}
+			if !v.NotBefore.IsZero() && v.NotBefore.After(m.NotBefore) {
+				m.NotBefore = v.NotBefore
+			}
+			if !v.NotAfter.IsZero() && (m.NotAfter.IsZero() || v.NotAfter.Before(m.NotAfter)) {
+				m.NotAfter = v.NotAfter
+			}
+		}
+	}
+	return nil
+}
+
 var (
 	zeroIP4 = netaddr.IPv4(0, 0, 0, 0)
 	zeroIP6 = netip.AddrFrom16([16]byte{})
@@ -176,3 +217,35 @@ func parseIPSet(arg string) (prefixes []netip.Prefix, peerCap tailcfg.NodeCapabi
 	}
 	return []netip.Prefix{netip.PrefixFrom(ip, ip.BitLen())}, "", nil
 }
+
+// setAppProtos sets m's AppProtos from the
+// [tailcfg.PeerCapabilityAppProtocols] values in grants, if any, and limits m
+// to TCP, the only IP protocol they can be enforced for.
+func setAppProtos(m *Match, grants []tailcfg.CapGrant) error {
+	for _, cg := range grants {
+		for _, raw := range cg.CapMap[tailcfg.PeerCapabilityAppProtocols] {
+			var v tailcfg.AppProtocolsCapValue
+			if err := json.Unmarshal([]byte(raw), &v); err != nil {
+				return fmt.Errorf("invalid %s value: %w", tailcfg.PeerCapabilityAppProtocols, err)
+			}
+			if len(v.Protocols) == 0 {
+				return fmt.Errorf("%s value with no protocols", tailcfg.PeerCapabilityAppProtocols)
+			}
+			for _, name := range v.Protocols {
+				p, err := filtertype.ParseAppProto(name)
+				if err != nil {
+					return err
+				}
+				m.AppProtos |= p
+			}
+		}
+	}
+	if m.AppProtos != 0 {
+		if views.SliceContains(m.IPProto, ipproto.TCP) {
+			m.IPProto = views.SliceOf([]ipproto.Proto{ipproto.TCP})
+		} else {
+			m.IPProto = views.Slice[ipproto.Proto]{}
+		}
+	}
+	return nil
+}
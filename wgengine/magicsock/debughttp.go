@@ -13,6 +13,8 @@
 	"strings"
 	"time"
 
+	"tailscale.com/derp"
+	"tailscale.com/derp/derphttp"
 	"tailscale.com/feature"
 	"tailscale.com/feature/buildfeatures"
 	"tailscale.com/tailcfg"
@@ -20,6 +22,23 @@
 	"tailscale.com/types/key"
 )
 
+// derpPacerStats returns the write pacing stats of each active DERP
+// connection, keyed by region ID.
+func (c *Conn) derpPacerStats() map[int]derp.PacerStats {
+	c.mu.Lock()
+	clients := make(map[int]*derphttp.Client, len(c.activeDerp))
+	for rid, ad := range c.activeDerp {
+		clients[rid] = ad.c
+	}
+	c.mu.Unlock()
+
+	stats := make(map[int]derp.PacerStats, len(clients))
+	for rid, dc := range clients {
+		stats[rid] = dc.PacerStats()
+	}
+	return stats
+}
+
 // ServeHTTPDebug serves an HTML representation of the innards of c for debugging.
 //
 // It's accessible either from tailscaled's debug port (at
@@ -31,6 +50,10 @@ func (c *Conn) ServeHTTPDebug(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Get DERP write pacing stats before taking c.mu, as getting them
+	// waits for any in-progress write to each DERP server.
+	pacerStats := c.derpPacerStats()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -45,6 +68,7 @@ type D struct {
 			regionID   int
 			lastWrite  time.Time
 			createTime time.Time
+			pacer      derp.PacerStats
 		}
 		ent := make([]D, 0, len(c.activeDerp))
 		for rid, ad := range c.activeDerp {
@@ -52,6 +76,7 @@ type D struct {
 				regionID:   rid,
 				lastWrite:  *ad.lastWrite,
 				createTime: ad.createTime,
+				pacer:      pacerStats[rid],
 			})
 		}
 		sort.Slice(ent, func(i, j int) bool {
@@ -66,11 +91,19 @@ type D struct {
 			if e.regionID == c.myDerp {
 				home = "🏠"
 			}
-			fmt.Fprintf(w, "<li>%s %d - %v: created %v ago, write %v ago</li>\n",
+			fmt.Fprintf(w, "<li>%s %d - %v: created %v ago, write %v ago",
 				home, e.regionID, html.EscapeString(r.RegionCode),
 				now.Sub(e.createTime).Round(time.Second),
 				now.Sub(e.lastWrite).Round(time.Second),
 			)
+			if p := e.pacer; p.Enabled {
+				fmt.Fprintf(w, "; pacing: active=%v rate=%.0f B/s minRTT=%v srtt=%v delay=%v",
+					p.Active, p.RateBytesPerSec,
+					p.MinRTT.Round(time.Millisecond), p.SmoothedRTT.Round(time.Millisecond),
+					p.TotalDelay.Round(time.Millisecond),
+				)
+			}
+			fmt.Fprintf(w, "</li>\n")
 		}
 
 	}
@@ -66,6 +66,18 @@
 	// suppressing/dropping inbound/outbound [disco.Ping] messages, forcing
 	// all peer communication over DERP or peer relay.
 	debugNeverDirectUDP = envknob.RegisterBool("TS_DEBUG_NEVER_DIRECT_UDP")
+	// debugDERPPacing enables adaptive pacing of writes to DERP servers,
+	// to avoid TCP loss cascades from bursts on lossy links.
+	debugDERPPacing = envknob.RegisterBool("TS_DEBUG_DERP_PACING")
+	// derpBrokerSocket is the path of the Unix socket of a DERP broker, as
+	// tailscaled --derp-broker-socket serves, to connect to DERP regions
+	// through, sharing its connections with other processes on the host.
+	derpBrokerSocket = envknob.RegisterString("TS_DERP_BROKER_SOCKET")
+	// debugPeriodicReSTUNInterval, if non-zero, replaces the default 20-26s
+	// interval between periodic STUN probes while active, so magicsock wakes
+	// up less often. Intervals over 30s may let NAT mappings expire between
+	// probes, leaving stale endpoints until the next netcheck.
+	debugPeriodicReSTUNInterval = envknob.RegisterDuration("TS_DEBUG_PERIODIC_RESTUN_INTERVAL")
 	// Hey you! Adding a new debugknob? Make sure to stub it out in the
 	// debugknobs_stubs.go file too.
 )
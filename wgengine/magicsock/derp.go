@@ -195,6 +195,9 @@ func (c *Conn) maybeSetNearestDERP(report *netcheck.Report, force bool) (preferr
 	}
 
 	preferredDERP = report.PreferredDERP
+	if pin := c.pinnedDERPHome(report); pin != 0 {
+		preferredDERP = pin
+	}
 	if preferredDERP == 0 {
 		// Perhaps UDP is blocked. Pick a deterministic but arbitrary
 		// one.
@@ -328,6 +331,10 @@ func (c *Conn) goDerpConnect(regionID int) {
 // operations on those.
 const derpWriteQueueDepth = 32
 
+// derpPacerPingInterval is how often a DERP connection with write pacing
+// enabled pings its server to sample the RTT.
+const derpPacerPingInterval = 5 * time.Second
+
 // derpWriteChanForRegion returns a channel to which to send DERP packet write
 // requests. It creates a new DERP connection to regionID if necessary.
 //
@@ -418,6 +425,8 @@ func (c *Conn) derpWriteChanForRegion(regionID int, peer key.NodePublic) chan de
 		dc.TLSConfig = &tls.Config{RootCAs: c.extraRootCAs}
 	}
 
+	dc.PaceWrites = debugDERPPacing()
+	dc.BrokerSocket = derpBrokerSocket()
 	dc.SetCanAckPings(true)
 	dc.NotePreferred(c.myDerp == regionID)
 	dc.SetAddressFamilySelector(derpAddrFamSelector{c})
@@ -687,10 +696,25 @@ func (c *Conn) runDerpWriter(ctx context.Context, dc *derphttp.Client, ch <-chan
 		return
 	}
 
+	// When pacing writes, periodically ping the server so the pacer has
+	// RTT samples to detect queueing on the path.
+	var pingTick <-chan time.Time
+	if dc.PaceWrites {
+		t := time.NewTicker(derpPacerPingInterval)
+		defer t.Stop()
+		pingTick = t.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-pingTick:
+			go func() {
+				ctx, cancel := context.WithTimeout(ctx, derpPacerPingInterval)
+				defer cancel()
+				dc.Ping(ctx) // RTT sample is recorded by dc
+			}()
 		case wr := <-ch:
 			err := dc.Send(wr.pubKey, wr.b)
 			if err != nil {
@@ -836,6 +860,8 @@ func (c *Conn) setDERPMap(dm *tailcfg.DERPMap, doReStun bool) {
 		}
 	}
 
+	c.derpMapUnfiltered = dm
+	dm = filterDERPMap(dm, c.deniedDERPRegionsLocked())
 	if reflect.DeepEqual(dm, c.derpMap) {
 		return
 	}
@@ -0,0 +1,198 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"tailscale.com/health"
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/set"
+)
+
+// derpHomePinWarnable is a Warnable that warns the user that the DERP region
+// their node is configured to use as its home can't be used.
+var derpHomePinWarnable = health.Register(&health.Warnable{
+	Code:     "derp-home-pin-unavailable",
+	Title:    "Pinned DERP region unavailable",
+	Severity: health.SeverityMedium,
+	Text: func(args health.Args) string {
+		return fmt.Sprintf("Tailscale is configured to use DERP region %s as its home, but %s.", args[health.ArgDERPRegionID], args[health.ArgError])
+	},
+})
+
+// SetDERPRegionPolicy sets the DERP regions that may be used, as configured
+// by the user or system policy.
+//
+// If home is non-zero, it's the region to use as the home DERP instead of the
+// one with the lowest latency. If it can't be used, a health warning is
+// raised and the home is chosen as usual.
+//
+// The deny regions are never used: they're removed from the DERP map, so no
+// connections are made to them, neither to use as home nor to reach peers
+// whose home they are. Such peers are only reachable directly or by relay.
+func (c *Conn) SetDERPRegionPolicy(home int, deny []int) {
+	c.mu.Lock()
+	var denied set.Set[int]
+	if len(deny) > 0 {
+		denied = set.SetOf(deny)
+	}
+	if home == c.derpHomePin && denied.Equal(c.derpDenied) {
+		c.mu.Unlock()
+		return
+	}
+	c.derpHomePin = home
+	c.derpDenied = denied
+	dm := c.derpMapUnfiltered
+	denyList := denied.Slice()
+	slices.Sort(denyList)
+	c.logf("magicsock: DERP region policy changed: home=%d deny=%v", home, denyList)
+	c.mu.Unlock()
+
+	if home == 0 {
+		c.health.SetHealthy(derpHomePinWarnable)
+	}
+	if dm == nil {
+		return
+	}
+	c.setDERPMap(dm, false)
+	// Even if the filtered DERP map didn't change, the home region may
+	// need to.
+	go c.ReSTUN("derp-region-policy")
+}
+
+// deniedDERPRegionsLocked returns the DERP regions to remove from the DERP
+// map: those denied by SetDERPRegionPolicy, plus any made unavailable by a
+// running DERP failover drill.
+//
+// c.mu must be held.
+func (c *Conn) deniedDERPRegionsLocked() set.Set[int] {
+	if c.derpDrillRegion == 0 || c.derpDenied.Contains(c.derpDrillRegion) {
+		return c.derpDenied
+	}
+	deny := set.Set[int]{}
+	deny.AddSet(c.derpDenied)
+	deny.Add(c.derpDrillRegion)
+	return deny
+}
+
+// StartDERPFailoverDrill makes the DERP region unavailable, as if it were
+// denied by SetDERPRegionPolicy, until the returned stop func is called. It's
+// used to test how connectivity recovers if the region, typically the home
+// one, goes down. Only one drill may run at a time.
+func (c *Conn) StartDERPFailoverDrill(region int) (stop func(), err error) {
+	c.mu.Lock()
+	if c.derpDrillRegion != 0 {
+		c.mu.Unlock()
+		return nil, errors.New("a DERP failover drill is already running")
+	}
+	dm := c.derpMapUnfiltered
+	if dm == nil {
+		c.mu.Unlock()
+		return nil, errors.New("DERP is disabled")
+	}
+	c.derpDrillRegion = region
+	c.logf("magicsock: [debug] DERP failover drill: making region %d unavailable", region)
+	c.mu.Unlock()
+
+	c.setDERPMap(dm, false)
+	go c.ReSTUN("derp-failover-drill")
+
+	return sync.OnceFunc(func() {
+		c.mu.Lock()
+		c.derpDrillRegion = 0
+		dm := c.derpMapUnfiltered
+		c.logf("magicsock: [debug] DERP failover drill: region %d available again", region)
+		c.mu.Unlock()
+
+		c.setDERPMap(dm, false)
+		go c.ReSTUN("derp-failover-drill-done")
+	}), nil
+}
+
+// HomeDERPRegion returns the current home DERP region, or zero if there's
+// none.
+func (c *Conn) HomeDERPRegion() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.myDerp
+}
+
+// filterDERPMap returns dm without the regions in deny. It returns dm itself
+// if there are none to remove.
+func filterDERPMap(dm *tailcfg.DERPMap, deny set.Set[int]) *tailcfg.DERPMap {
+	if dm == nil {
+		return nil
+	}
+	var dm2 *tailcfg.DERPMap
+	for id := range deny {
+		if _, ok := dm.Regions[id]; !ok {
+			continue
+		}
+		if dm2 == nil {
+			dm2 = new(*dm)
+			dm2.Regions = maps.Clone(dm.Regions)
+		}
+		delete(dm2.Regions, id)
+	}
+	if dm2 == nil {
+		return dm
+	}
+	return dm2
+}
+
+// pinnedDERPHome returns the DERP region set by SetDERPRegionPolicy to use
+// as home, or zero if there's none or it can't be used, updating the health
+// warning about it per report.
+//
+// c.mu must NOT be held.
+func (c *Conn) pinnedDERPHome(report *netcheck.Report) int {
+	c.mu.Lock()
+	pin := c.derpHomePin
+	dm := c.derpMap
+	denied := c.derpDenied.Contains(pin)
+	drill := pin != 0 && pin == c.derpDrillRegion
+	c.mu.Unlock()
+
+	if drill {
+		// Unavailable on purpose for now; leave any health warning as is.
+		return 0
+	}
+
+	if pin == 0 || (dm == nil && !denied) {
+		// No pin, or DERP is disabled entirely.
+		c.health.SetHealthy(derpHomePinWarnable)
+		return 0
+	}
+	var problem string
+	switch {
+	case denied:
+		problem = "it's also configured as a denied region"
+	case dm.Regions[pin] == nil:
+		problem = "it's not in the DERP map"
+	default:
+		if _, ok := report.RegionLatency[pin]; !ok && len(report.RegionLatency) > 0 {
+			// Other regions answered latency probes, but not the
+			// pinned one. Stay on it regardless, as the pin asks,
+			// but let the user know why connectivity may suffer.
+			c.health.SetUnhealthy(derpHomePinWarnable, health.Args{
+				health.ArgDERPRegionID: fmt.Sprint(pin),
+				health.ArgError:        "it's unreachable",
+			})
+			return pin
+		}
+		c.health.SetHealthy(derpHomePinWarnable)
+		return pin
+	}
+	c.health.SetUnhealthy(derpHomePinWarnable, health.Args{
+		health.ArgDERPRegionID: fmt.Sprint(pin),
+		health.ArgError:        problem,
+	})
+	return 0
+}
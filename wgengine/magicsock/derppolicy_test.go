@@ -0,0 +1,175 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/health"
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/eventbus"
+	"tailscale.com/util/eventbus/eventbustest"
+)
+
+func TestDERPRegionPolicy(t *testing.T) {
+	region := func(id int) *tailcfg.DERPRegion {
+		return &tailcfg.DERPRegion{
+			RegionID: id,
+			Nodes: []*tailcfg.DERPNode{
+				{Name: "a", RegionID: id, HostName: "derp.test.unused", IPv4: "127.0.0.1", IPv6: "none"},
+			},
+		}
+	}
+	derpMap := &tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			1: region(1),
+			2: region(2),
+			3: region(3),
+		},
+	}
+	bus := eventbustest.NewBus(t)
+	ht := health.NewTracker(bus)
+	c := newConn(t.Logf)
+	ec := bus.Client("magicsock.Conn.Test")
+	c.eventClient = ec
+	c.homeDERPChangedPub = eventbus.Publish[HomeDERPChanged](ec)
+	c.eventBus = bus
+	c.health = ht
+	// With a zero private key and everHadKey=true, ReSTUN returns early without
+	// spawning updateEndpoints.
+	c.everHadKey = true
+	c.SetDERPMapWithoutReSTUN(derpMap)
+
+	report := &netcheck.Report{
+		PreferredDERP: 2,
+		RegionLatency: map[int]time.Duration{1: 20 * time.Millisecond, 2: 10 * time.Millisecond},
+	}
+	setPolicyAndPick := func(home int, deny []int) int {
+		t.Helper()
+		c.SetDERPRegionPolicy(home, deny)
+		return c.maybeSetNearestDERP(report, false)
+	}
+
+	if got := setPolicyAndPick(0, nil); got != 2 {
+		t.Errorf("without policy, home = %d; want 2", got)
+	}
+
+	if got := setPolicyAndPick(1, nil); got != 1 {
+		t.Errorf("pinned to 1, home = %d; want 1", got)
+	}
+	if ht.IsUnhealthy(derpHomePinWarnable) {
+		t.Errorf("unexpected warning with reachable pinned region")
+	}
+
+	if got := setPolicyAndPick(3, nil); got != 3 {
+		t.Errorf("pinned to unreachable 3, home = %d; want 3", got)
+	}
+	if !ht.IsUnhealthy(derpHomePinWarnable) {
+		t.Errorf("missing warning with unreachable pinned region")
+	}
+
+	c.SetDERPRegionPolicy(0, []int{1, 2})
+	c.mu.Lock()
+	_, has1 := c.derpMap.Regions[1]
+	_, has3 := c.derpMap.Regions[3]
+	_, hasUnfiltered1 := c.derpMapUnfiltered.Regions[1]
+	c.mu.Unlock()
+	if has1 || !has3 || !hasUnfiltered1 {
+		t.Errorf("with regions 1 and 2 denied, derpMap has 1 = %v, 3 = %v; unfiltered has 1 = %v", has1, has3, hasUnfiltered1)
+	}
+	if ht.IsUnhealthy(derpHomePinWarnable) {
+		t.Errorf("unexpected warning after removing pin")
+	}
+
+	// Denying the pinned region overrides the pin.
+	report.PreferredDERP = 3
+	if got := setPolicyAndPick(1, []int{1}); got != 3 {
+		t.Errorf("pinned to denied 1, home = %d; want 3", got)
+	}
+	if !ht.IsUnhealthy(derpHomePinWarnable) {
+		t.Errorf("missing warning with denied pinned region")
+	}
+
+	// Updates to the DERP map are filtered too.
+	c.SetDERPMapWithoutReSTUN(&tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			1: region(1),
+			4: region(4),
+		},
+	})
+	c.mu.Lock()
+	_, has1 = c.derpMap.Regions[1]
+	_, has4 := c.derpMap.Regions[4]
+	c.mu.Unlock()
+	if has1 || !has4 {
+		t.Errorf("after DERP map update, has 1 = %v, 4 = %v; want false, true", has1, has4)
+	}
+}
+
+func TestDERPFailoverDrill(t *testing.T) {
+	region := func(id int) *tailcfg.DERPRegion {
+		return &tailcfg.DERPRegion{
+			RegionID: id,
+			Nodes: []*tailcfg.DERPNode{
+				{Name: "a", RegionID: id, HostName: "derp.test.unused", IPv4: "127.0.0.1", IPv6: "none"},
+			},
+		}
+	}
+	bus := eventbustest.NewBus(t)
+	c := newConn(t.Logf)
+	ec := bus.Client("magicsock.Conn.Test")
+	c.eventClient = ec
+	c.homeDERPChangedPub = eventbus.Publish[HomeDERPChanged](ec)
+	c.eventBus = bus
+	c.health = health.NewTracker(bus)
+	c.everHadKey = true // see TestDERPRegionPolicy
+	c.SetDERPMapWithoutReSTUN(&tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			1: region(1),
+			2: region(2),
+			3: region(3),
+		},
+	})
+	c.SetDERPRegionPolicy(0, []int{3})
+
+	hasRegions := func() (has1, has3 bool) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		_, has1 = c.derpMap.Regions[1]
+		_, has3 = c.derpMap.Regions[3]
+		return has1, has3
+	}
+
+	stop, err := c.StartDERPFailoverDrill(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.StartDERPFailoverDrill(2); err == nil {
+		t.Errorf("second concurrent drill started; want error")
+	}
+	if has1, has3 := hasRegions(); has1 || has3 {
+		t.Errorf("during drill, has 1 = %v, 3 = %v; want false, false", has1, has3)
+	}
+
+	// A drill can't be used as a home, even if pinned.
+	c.SetDERPRegionPolicy(1, []int{3})
+	report := &netcheck.Report{
+		PreferredDERP: 2,
+		RegionLatency: map[int]time.Duration{2: 10 * time.Millisecond},
+	}
+	if got := c.maybeSetNearestDERP(report, false); got != 2 {
+		t.Errorf("during drill of pinned region 1, home = %d; want 2", got)
+	}
+
+	stop()
+	stop() // idempotent
+	if has1, has3 := hasRegions(); !has1 || has3 {
+		t.Errorf("after drill, has 1 = %v, 3 = %v; want true, false", has1, has3)
+	}
+	if c.derpDenied.Contains(1) {
+		t.Errorf("drill region left in derpDenied")
+	}
+}
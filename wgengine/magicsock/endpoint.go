@@ -91,6 +91,8 @@ type endpoint struct {
 	bestAddr           addrQuality // best non-DERP path; zero if none; mutate via setBestAddrLocked()
 	bestAddrAt         mono.Time   // time best address re-confirmed
 	trustBestAddrUntil mono.Time   // time when bestAddr expires
+	bestPathChanges    int64       // times bestAddr changed from a valid path; see [PeerPathStats]
+	derpFallbacks      int64       // times bestAddr was cleared from a valid path; see [PeerPathStats]
 	sentPing           map[stun.TxID]sentPing
 	endpointState      map[netip.AddrPort]*endpointState // netip.AddrPort type for key (instead of [epAddr]) as [endpointState] is irrelevant for Geneve-encapsulated paths
 	isCallMeMaybeEP    map[netip.AddrPort]bool
@@ -101,9 +103,13 @@ type endpoint struct {
 	heartbeatDisabled bool
 	probeUDPLifetime  *probeUDPLifetime // UDP path lifetime probing; nil if disabled
 
+	keepWarm bool // whether to keep paths warm while idle; see [Conn.SetWarmPeers]
+
 	expired         bool // whether the node has expired
 	isWireguardOnly bool // whether the endpoint is WireGuard only
 	relayCapable    bool // whether the node is capable of speaking via a [tailscale.com/net/udprelay.Server]
+
+	pathPolicy pathPolicy // which paths the endpoint policy permits to the node
 }
 
 // udpRelayEndpointReady determines whether the given relay [addrQuality] should
@@ -112,6 +118,9 @@ type endpoint struct {
 func (de *endpoint) udpRelayEndpointReady(maybeBest addrQuality) {
 	de.mu.Lock()
 	defer de.mu.Unlock()
+	if de.pathPolicy.suppresses(maybeBest.epAddr) {
+		return
+	}
 	now := mono.Now()
 	curBestAddrTrusted := now.Before(de.trustBestAddrUntil)
 	sameRelayServer := de.bestAddr.vni.IsSet() && maybeBest.relayServerDisco.Compare(de.bestAddr.relayServerDisco) == 0
@@ -136,9 +145,17 @@ func (de *endpoint) udpRelayEndpointReady(maybeBest addrQuality) {
 }
 
 func (de *endpoint) setBestAddrLocked(v addrQuality) {
+	de.noteBestPathChangeLocked(v.epAddr)
 	if v.epAddr != de.bestAddr.epAddr {
 		de.probeUDPLifetime.resetCycleEndpointLocked()
 	}
+	if v.epAddr != de.bestAddr.epAddr || v.wireMTU != de.bestAddr.wireMTU {
+		if v.ap.IsValid() && v.wireMTU != 0 {
+			de.c.peerPathMTUs.Store(de.publicKey, v.wireMTU)
+		} else {
+			de.c.peerPathMTUs.Delete(de.publicKey)
+		}
+	}
 	de.bestAddr = v
 }
 
@@ -404,17 +421,29 @@ type endpointState struct {
 	// was advertised last via a call-me-maybe disco message.
 	callMeMaybeTime time.Time
 
+	// hintTime, if non-zero, is the time this endpoint was added as a
+	// path hint. See [Conn.AddPathHints].
+	hintTime time.Time
+
+	// pingsSent and pingsLost count the disco pings sent to this endpoint
+	// and those that timed out. See [PathStats].
+	pingsSent, pingsLost int64
+
 	recentPongs []pongReply // ring buffer up to pongHistoryCount entries
 	recentPong  uint16      // index into recentPongs of most recent; older before, wrapped
 
 	index int16 // index in nodecfg.Node.Endpoints; meaningless if lastGotPing non-zero
 }
 
-// clear removes all derived / probed state from an endpointState.
+// clear removes all derived / probed state from an endpointState, except for
+// the ping counters, which cover the path's whole lifetime.
 func (s *endpointState) clear() {
 	*s = endpointState{
 		index:       s.index,
 		lastGotPing: s.lastGotPing,
+		hintTime:    s.hintTime,
+		pingsSent:   s.pingsSent,
+		pingsLost:   s.pingsLost,
 	}
 }
 
@@ -444,8 +473,12 @@ func (st *endpointState) shouldDeleteLocked() bool {
 	case !st.callMeMaybeTime.IsZero():
 		return false
 	case st.lastGotPing.IsZero():
-		// This was an endpoint from the network map. Is it still in the network map?
-		return st.index == indexSentinelDeleted
+		// This was an endpoint from the network map or a path hint. Is it
+		// still in the network map, or a recent hint?
+		if st.index != indexSentinelDeleted {
+			return false
+		}
+		return st.hintTime.IsZero() || time.Since(st.hintTime) > sessionActiveTimeout
 	default:
 		// This was an endpoint discovered at runtime.
 		return time.Since(st.lastGotPing) > sessionActiveTimeout
@@ -818,12 +851,16 @@ func (de *endpoint) heartbeat() {
 		return
 	}
 
-	if de.lastSendExt.IsZero() {
+	if de.lastSendExt.IsZero() && !de.keepWarm {
 		// Shouldn't happen.
 		return
 	}
 
 	now := mono.Now()
+	if de.keepWarm && now.Sub(de.lastSendExt) > sessionActiveTimeout {
+		de.heartbeatWarmLocked(now)
+		return
+	}
 	if now.Sub(de.lastSendExt) > sessionActiveTimeout {
 		// Session's idle. Stop heartbeating.
 		de.c.dlogf("[v1] magicsock: disco: ending heartbeats for idle session to %v (%v)", de.publicKey.ShortString(), de.discoShort())
@@ -876,6 +913,9 @@ func (de *endpoint) setHeartbeatDisabled(v bool) {
 	de.mu.Lock()
 	defer de.mu.Unlock()
 	de.heartbeatDisabled = v
+	if !v && de.keepWarm {
+		de.warmLocked(mono.Now())
+	}
 }
 
 // discoverUDPRelayPathsLocked starts UDP relay path discovery.
@@ -900,7 +940,7 @@ func (de *endpoint) wantUDPRelayPathDiscoveryLocked(now mono.Time) bool {
 		// call into [relayManager] and do some wasted work.
 		return false
 	}
-	if !de.relayCapable {
+	if !de.relayCapable || de.pathPolicy.denyRelay {
 		return false
 	}
 	if de.bestAddr.isDirect() && now.Before(de.trustBestAddrUntil) {
@@ -949,8 +989,16 @@ func (de *endpoint) wantFullPingLocked(now mono.Time) bool {
 }
 
 func (de *endpoint) noteTxActivityExtTriggerLocked(now mono.Time) {
+	wasIdle := now.Sub(de.lastSendExt) > sessionActiveTimeout
 	de.lastSendExt = now
-	if de.heartBeatTimer == nil && !de.heartbeatDisabled {
+	if de.heartbeatDisabled {
+		return
+	}
+	if de.heartBeatTimer == nil {
+		de.heartBeatTimer = time.AfterFunc(heartbeatInterval, de.heartbeat)
+	} else if wasIdle && de.keepWarm && de.heartBeatTimer.Stop() {
+		// Switch from the slower heartbeat of an idle warm endpoint to
+		// that of an active session.
 		de.heartBeatTimer = time.AfterFunc(heartbeatInterval, de.heartbeat)
 	}
 }
@@ -1184,6 +1232,7 @@ func (de *endpoint) discoPingTimeout(txid stun.TxID) {
 	if debugDisco() || !de.bestAddr.ap.IsValid() || bestUntrusted {
 		de.c.dlogf("[v1] magicsock: disco: timeout waiting for pong %x from %v (%v, %v)", txid[:6], sp.to, de.publicKey.ShortString(), de.discoShort())
 	}
+	de.noteDiscoPingLocked(sp, true)
 	de.removeSentDiscoPingLocked(txid, sp, discoPingTimedOut)
 }
 
@@ -1289,6 +1338,9 @@ func (de *endpoint) startDiscoPingLocked(ep epAddr, now mono.Time, purpose disco
 	if debugNeverDirectUDP() && !ep.vni.IsSet() && ep.ap.Addr() != tailcfg.DerpMagicIPAddr {
 		return
 	}
+	if de.pathPolicy.suppresses(ep) {
+		return
+	}
 	epDisco := de.disco.Load()
 	if epDisco == nil {
 		return
@@ -1332,7 +1384,7 @@ func (de *endpoint) startDiscoPingLocked(ep epAddr, now mono.Time, purpose disco
 	de.lastSendAny = now
 	for _, s := range sizes {
 		txid := stun.NewTxID()
-		de.sentPing[txid] = sentPing{
+		sp := sentPing{
 			to:      ep,
 			at:      now,
 			timer:   time.AfterFunc(pingTimeoutDuration, func() { de.discoPingTimeout(txid) }),
@@ -1340,6 +1392,8 @@ func (de *endpoint) startDiscoPingLocked(ep epAddr, now mono.Time, purpose disco
 			resCB:   resCB,
 			size:    s,
 		}
+		de.sentPing[txid] = sp
+		de.noteDiscoPingLocked(sp, false)
 		if purpose == pingHeartbeatForUDPLifetime && de.probeUDPLifetime != nil {
 			de.probeUDPLifetime.lastTxID = txid
 		}
@@ -1659,6 +1713,10 @@ func (de *endpoint) noteConnectivityChange() {
 	for k := range de.endpointState {
 		de.endpointState[k].clear()
 	}
+	if de.keepWarm {
+		// Rediscover the path now rather than on the next packet.
+		de.warmLocked(mono.Now())
+	}
 }
 
 // pingSizeToPktLen calculates the minimum path MTU that would permit
@@ -1766,7 +1824,7 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src epAdd
 
 	// Promote this pong response to our current best address if it's lower latency.
 	// TODO(bradfitz): decide how latency vs. preference order affects decision
-	if !isDerp {
+	if !isDerp && de.pathPolicy.allows(sp.to) {
 		thisPong := addrQuality{
 			epAddr:  sp.to,
 			latency: latency,
@@ -0,0 +1,173 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"reflect"
+	"slices"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/clientmetric"
+)
+
+var (
+	metricEndpointPolicySuppressedDirect = clientmetric.NewCounter("magicsock_endpoint_policy_suppressed_direct")
+	metricEndpointPolicySuppressedRelay  = clientmetric.NewCounter("magicsock_endpoint_policy_suppressed_relay")
+)
+
+// pathPolicy is the compiled form of the [tailcfg.EndpointPolicyRule]s that
+// apply to one peer. The zero value permits all paths.
+type pathPolicy struct {
+	denyDirect   bool
+	denyRelay    bool
+	denyPrefixes []netip.Prefix
+	allowLists   [][]netip.Prefix // direct UDP endpoints must be in one prefix of each
+}
+
+// pathPolicyForPeer returns the policy for reaching n under rules.
+func pathPolicyForPeer(rules []tailcfg.EndpointPolicyRule, n tailcfg.NodeView) pathPolicy {
+	var p pathPolicy
+	for _, r := range rules {
+		if !endpointPolicyRuleMatches(r, n) {
+			continue
+		}
+		for _, d := range r.Deny {
+			switch d {
+			case tailcfg.EndpointPolicyDirect:
+				p.denyDirect = true
+			case tailcfg.EndpointPolicyRelay:
+				p.denyRelay = true
+			}
+		}
+		p.denyPrefixes = append(p.denyPrefixes, r.DenyPrefixes...)
+		if len(r.AllowPrefixes) > 0 {
+			p.allowLists = append(p.allowLists, r.AllowPrefixes)
+		}
+	}
+	return p
+}
+
+// endpointPolicyRuleMatches reports whether r applies to n.
+func endpointPolicyRuleMatches(r tailcfg.EndpointPolicyRule, n tailcfg.NodeView) bool {
+	for _, sel := range r.Peers {
+		switch {
+		case sel == "*":
+			return true
+		case sel == string(n.StableID()):
+			return true
+		case n.Tags().ContainsFunc(func(t string) bool { return t == sel }):
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether p permits the path ep.
+func (p pathPolicy) allows(ep epAddr) bool {
+	if ep.ap.Addr() == tailcfg.DerpMagicIPAddr {
+		return true
+	}
+	if ep.vni.IsSet() {
+		return !p.denyRelay
+	}
+	if p.denyDirect {
+		return false
+	}
+	ip := ep.ap.Addr().Unmap()
+	inPrefixes := func(pfxs []netip.Prefix) bool {
+		return slices.ContainsFunc(pfxs, func(pfx netip.Prefix) bool { return pfx.Contains(ip) })
+	}
+	if inPrefixes(p.denyPrefixes) {
+		return false
+	}
+	for _, allow := range p.allowLists {
+		if !inPrefixes(allow) {
+			return false
+		}
+	}
+	return true
+}
+
+// suppresses reports whether p forbids the candidate path ep, counting it in
+// the audit metrics if so.
+func (p pathPolicy) suppresses(ep epAddr) bool {
+	if p.allows(ep) {
+		return false
+	}
+	if ep.vni.IsSet() {
+		metricEndpointPolicySuppressedRelay.Add(1)
+	} else {
+		metricEndpointPolicySuppressedDirect.Add(1)
+	}
+	return true
+}
+
+// endpointPolicyRulesLocked returns the endpoint policy rules in effect: those
+// from the self node's [tailcfg.NodeAttrEndpointPolicy] followed by those set
+// with [Conn.SetLocalEndpointPolicy].
+//
+// c.mu must be held.
+func (c *Conn) endpointPolicyRulesLocked() []tailcfg.EndpointPolicyRule {
+	var rules []tailcfg.EndpointPolicyRule
+	if c.self.Valid() {
+		var err error
+		rules, err = tailcfg.UnmarshalNodeCapViewJSON[tailcfg.EndpointPolicyRule](c.self.CapMap(), tailcfg.NodeAttrEndpointPolicy)
+		if err != nil {
+			c.logf("magicsock: invalid %s: %v", tailcfg.NodeAttrEndpointPolicy, err)
+			rules = nil
+		}
+	}
+	return append(rules, c.localEndpointPolicy...)
+}
+
+// SetLocalEndpointPolicy sets endpoint policy rules from local configuration,
+// which are enforced along with any from the control plane.
+func (c *Conn) SetLocalEndpointPolicy(rules []tailcfg.EndpointPolicyRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.localEndpointPolicy = slices.Clone(rules)
+	if !c.updateEndpointPolicyLocked() {
+		return
+	}
+	c.peerMap.forEachEndpoint(func(ep *endpoint) {
+		if n, ok := c.peersByID[ep.nodeID]; ok {
+			ep.setPathPolicy(pathPolicyForPeer(c.endpointPolicy, n))
+		}
+	})
+}
+
+// updateEndpointPolicyLocked recomputes c.endpointPolicy and reports whether
+// it changed. It's the caller's responsibility to apply a changed policy to
+// peers.
+//
+// c.mu must be held.
+func (c *Conn) updateEndpointPolicyLocked() (changed bool) {
+	rules := c.endpointPolicyRulesLocked()
+	if reflect.DeepEqual(rules, c.endpointPolicy) {
+		return false
+	}
+	c.endpointPolicy = rules
+	return true
+}
+
+// setPathPolicy sets the path policy for de, dropping its best address if
+// the policy no longer permits it.
+func (de *endpoint) setPathPolicy(p pathPolicy) {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	de.pathPolicy = p
+	if de.bestAddr.ap.IsValid() && !p.allows(de.bestAddr.epAddr) {
+		de.c.logf("magicsock: disco: node %v %v endpoint policy forbids %v", de.publicKey.ShortString(), de.discoShort(), de.bestAddr.epAddr)
+		de.clearBestAddrLocked()
+	}
+}
+
+// suppressesPath reports whether de's path policy forbids the candidate path
+// ep, counting it in the audit metrics if so.
+func (de *endpoint) suppressesPath(ep epAddr) bool {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	return de.pathPolicy.suppresses(ep)
+}
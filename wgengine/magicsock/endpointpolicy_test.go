@@ -0,0 +1,71 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+
+	"tailscale.com/net/packet"
+	"tailscale.com/tailcfg"
+)
+
+func TestPathPolicy(t *testing.T) {
+	restricted := (&tailcfg.Node{StableID: "n1", Tags: []string{"tag:restricted"}}).View()
+	other := (&tailcfg.Node{StableID: "n2", Tags: []string{"tag:server"}}).View()
+
+	rules := []tailcfg.EndpointPolicyRule{
+		{
+			Peers:        []string{"*"},
+			DenyPrefixes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		},
+		{
+			Peers: []string{"tag:restricted"},
+			Deny:  []string{tailcfg.EndpointPolicyDirect, tailcfg.EndpointPolicyRelay},
+		},
+		{
+			Peers:         []string{"n2"},
+			AllowPrefixes: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("10.1.0.0/16")},
+		},
+		{
+			Peers:         []string{"n2"},
+			AllowPrefixes: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("10.0.0.0/8")},
+		},
+	}
+
+	var vni packet.VirtualNetworkID
+	vni.Set(7)
+	derp := epAddr{ap: netip.AddrPortFrom(tailcfg.DerpMagicIPAddr, 1)}
+	relay := epAddr{ap: netip.MustParseAddrPort("198.51.100.1:7"), vni: vni}
+	direct := func(s string) epAddr { return epAddr{ap: netip.MustParseAddrPort(s)} }
+
+	tests := []struct {
+		name string
+		n    tailcfg.NodeView
+		ep   epAddr
+		want bool
+	}{
+		{"restricted-derp", restricted, derp, true},
+		{"restricted-relay", restricted, relay, false},
+		{"restricted-direct", restricted, direct("192.0.2.1:41641"), false},
+		{"other-derp", other, derp, true},
+		{"other-relay", other, relay, true},
+		{"other-allowed", other, direct("192.0.2.1:41641"), true},
+		{"other-not-in-second-allow-list", other, direct("198.51.100.2:41641"), false},
+		{"other-denied-lan", other, direct("10.1.2.3:41641"), false},
+		{"other-denied-lan-v4mapped", other, direct("[::ffff:10.1.2.3]:41641"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := pathPolicyForPeer(rules, tt.n)
+			if got := p.allows(tt.ep); got != tt.want {
+				t.Errorf("allows(%v) = %v; want %v", tt.ep, got, tt.want)
+			}
+		})
+	}
+
+	if p := pathPolicyForPeer(nil, restricted); !p.allows(direct("10.0.0.1:1")) || !p.allows(relay) {
+		t.Error("empty policy forbids a path")
+	}
+}
@@ -150,6 +150,16 @@ type metrics struct {
 	// outboundPacketsDroppedErrors is the total number of outbound packets
 	// dropped due to errors.
 	outboundPacketsDroppedErrors expvar.Int
+
+	// discoPingsSent and discoPingsLost are the total number of disco pings
+	// sent to peers and of those that timed out, labeled by path.
+	discoPingsSent pathCounters
+	discoPingsLost pathCounters
+
+	// bestPathChanges is the total number of times the best path to a peer
+	// changed away from a direct or peer relay path, labeled by the new
+	// path (derp if none).
+	bestPathChanges pathCounters
 }
 
 // A Conn routes UDP packets and actively manages a list of its endpoints.
@@ -164,6 +174,7 @@ type Conn struct {
 	derpActiveFunc         func()
 	idleFunc               func() time.Duration // nil means unknown
 	testOnlyPacketListener nettype.PacketListener
+	sharedUDP              *SharedUDP                             // or nil to bind own sockets
 	onDERPRecv             func(int, key.NodePublic, []byte) bool // or nil, see Options.OnDERPRecv
 	netMon                 *netmon.Monitor                        // must be non-nil
 	health                 *health.Tracker                        // or nil
@@ -263,6 +274,10 @@ type Conn struct {
 	//lint:ignore U1000 used on Linux/Darwin only
 	peerMTUEnabled atomic.Bool
 
+	// peerPathMTUs is the probed wire MTU of each peer's current best
+	// UDP path. Peers without one are absent.
+	peerPathMTUs syncs.Map[key.NodePublic, tstun.WireMTU]
+
 	// connCounter maintains per-connection counters.
 	connCounter syncs.AtomicValue[netlogfunc.ConnectionCounter]
 
@@ -356,6 +371,10 @@ type Conn struct {
 	netInfoLast *tailcfg.NetInfo
 
 	derpMap            *tailcfg.DERPMap                    // nil (or zero regions/nodes) means DERP is disabled
+	derpMapUnfiltered  *tailcfg.DERPMap                    // from last SetDERPMap, before removing derpDenied regions to make derpMap
+	derpHomePin        int                                 // if non-zero, the DERP region to use as home; from SetDERPRegionPolicy
+	derpDenied         set.Set[int]                        // DERP regions never to use; from SetDERPRegionPolicy
+	derpDrillRegion    int                                 // if non-zero, a DERP region made unavailable by StartDERPFailoverDrill
 	self               tailcfg.NodeView                    // from last SetNetworkMap
 	peersByID          map[tailcfg.NodeID]tailcfg.NodeView // current peer set, keyed by NodeID. Maintained by SetNetworkMap/UpsertPeer/RemovePeer. Note: per-field NodeMutation patches received in UpdateNetmapDelta are never applied to these snapshots.
 	filt               *filter.Filter                      // from last SetFilter
@@ -399,6 +418,23 @@ type Conn struct {
 	// to the node.
 	staticEndpoints views.Slice[netip.AddrPort]
 
+	// localEndpointPolicy are the endpoint policy rules from local
+	// configuration, set by [Conn.SetLocalEndpointPolicy].
+	localEndpointPolicy []tailcfg.EndpointPolicyRule
+
+	// endpointPolicy are the endpoint policy rules in effect, from both
+	// the self node and localEndpointPolicy. See
+	// [Conn.updateEndpointPolicyLocked].
+	endpointPolicy []tailcfg.EndpointPolicyRule
+
+	// warmPeers are the peers whose paths are kept warm, set by
+	// [Conn.SetWarmPeers].
+	warmPeers set.Set[key.NodePublic]
+
+	// pathHints are the path hints from [Conn.AddPathHints] for peers
+	// that don't have an endpoint yet.
+	pathHints map[key.NodePublic]netip.AddrPort
+
 	// metrics contains the metrics for the magicsock instance.
 	metrics *metrics
 
@@ -453,9 +489,13 @@ type Options struct {
 	IdleFunc func() time.Duration
 
 	// TestOnlyPacketListener optionally specifies how to create PacketConns.
-	// Only used by tests.
+	// Only used by tests, including those of programs embedding tsnet.
 	TestOnlyPacketListener nettype.PacketListener
 
+	// SharedUDP optionally specifies UDP sockets to share with the Conns
+	// of other backends in the process, rather than binding its own.
+	SharedUDP *SharedUDP
+
 	// NetMon is the network monitor to use.
 	// It must be non-nil.
 	NetMon *netmon.Monitor
@@ -634,6 +674,7 @@ func NewConn(opts Options) (*Conn, error) {
 	c.derpActiveFunc = opts.derpActiveFunc()
 	c.idleFunc = opts.IdleFunc
 	c.testOnlyPacketListener = opts.TestOnlyPacketListener
+	c.sharedUDP = opts.SharedUDP
 	c.onDERPRecv = opts.OnDERPRecv
 
 	// Set up publishers and subscribers. Subscribe calls must return before
@@ -801,6 +842,19 @@ func registerMetrics(reg *usermetric.Registry) *metrics {
 
 	outboundPacketsDroppedErrors.Set(usermetric.DropLabels{Reason: usermetric.ReasonError}, &m.outboundPacketsDroppedErrors)
 
+	m.discoPingsSent.register(reg,
+		"tailscaled_disco_pings_sent_total",
+		"Counts the number of disco pings sent to other peers to measure path quality",
+	)
+	m.discoPingsLost.register(reg,
+		"tailscaled_disco_pings_lost_total",
+		"Counts the number of disco pings to other peers that got no reply",
+	)
+	m.bestPathChanges.register(reg,
+		"tailscaled_peer_path_changes_total",
+		"Counts the number of times the path to a peer changed away from a direct or peer relay path, labeled by the new path",
+	)
+
 	return m
 }
 
@@ -832,6 +886,24 @@ func deregisterMetrics() {
 	metricSendPeerRelay.UnregisterAll()
 }
 
+// DataBytes returns the total number of bytes of WireGuard packets c has
+// sent and received to peers directly or via peer relays, and via DERP.
+// They're always zero in builds without [expvar.IsAvailable].
+func (c *Conn) DataBytes() (direct, derp ipnstate.UsageBytes) {
+	m := c.metrics
+	direct = ipnstate.UsageBytes{
+		TxBytes: uint64(m.outboundBytesIPv4Total.Value() + m.outboundBytesIPv6Total.Value() +
+			m.outboundBytesPeerRelayIPv4Total.Value() + m.outboundBytesPeerRelayIPv6Total.Value()),
+		RxBytes: uint64(m.inboundBytesIPv4Total.Value() + m.inboundBytesIPv6Total.Value() +
+			m.inboundBytesPeerRelayIPv4Total.Value() + m.inboundBytesPeerRelayIPv6Total.Value()),
+	}
+	derp = ipnstate.UsageBytes{
+		TxBytes: uint64(m.outboundBytesDERPTotal.Value()),
+		RxBytes: uint64(m.inboundBytesDERPTotal.Value()),
+	}
+	return direct, derp
+}
+
 // InstallCaptureHook installs a callback which is called to
 // log debug information into the pcap stream. This function
 // can be called with a nil argument to uninstall the capture
@@ -873,6 +945,9 @@ func (c *Conn) updateEndpoints(why string) {
 				// common UDP NAT timeout on Linux,
 				// etc)
 				d := tstime.RandomDurationBetween(20*time.Second, 26*time.Second)
+				if iv := debugPeriodicReSTUNInterval(); iv > 0 {
+					d = tstime.RandomDurationBetween(iv, iv*13/10)
+				}
 				if t := c.periodicReSTUNTimer; t != nil {
 					if debugReSTUNStopOnIdle() {
 						c.logf("resetting existing periodicSTUN to run in %v", d)
@@ -2522,13 +2597,19 @@ func (c *Conn) handlePingLocked(dm *disco.Ping, src epAddr, di *discoInfo, derpN
 	dstKey := derpNodeSrc
 
 	// Remember this route if not present.
-	var dup bool
+	var dup, suppressed bool
 	if isDerp {
 		if _, ok := c.peerMap.endpointForNodeKey(derpNodeSrc); ok {
 			numNodes = 1
 		}
 	} else {
 		c.peerMap.forEachEndpointWithDiscoKey(di.discoKey, func(ep *endpoint) (keepGoing bool) {
+			if ep.suppressesPath(src) {
+				// Don't reply, so the peer doesn't use a path our
+				// endpoint policy forbids either.
+				suppressed = true
+				return true
+			}
 			if ep.addCandidateEndpoint(src.ap, dm.TxID) {
 				dup = true
 				return false
@@ -2550,6 +2631,9 @@ func (c *Conn) handlePingLocked(dm *disco.Ping, src epAddr, di *discoInfo, derpN
 	}
 
 	if numNodes == 0 {
+		if suppressed {
+			return
+		}
 		c.logf("[unexpected] got disco ping from %v/%v for node not in peers", src, derpNodeSrc)
 		return
 	}
@@ -3019,10 +3103,11 @@ func (c *Conn) updateNodes(self tailcfg.NodeView, peers []tailcfg.NodeView) (pee
 	// up-to-date.
 	// TODO: mutate [debugFlags] here instead of in various [Conn] setters.
 	flags := c.debugFlagsLocked()
+	policyChanged := c.updateEndpointPolicyLocked()
 
 	// Fast path: if the peer set and every peer's NodeView are unchanged,
-	// and flags are unchanged, skip all further work.
-	if c.lastFlags == flags && len(peers) == len(c.peersByID) {
+	// and flags and the endpoint policy are unchanged, skip all further work.
+	if c.lastFlags == flags && !policyChanged && len(peers) == len(c.peersByID) {
 		allSame := true
 		for _, n := range peers {
 			if prev, ok := c.peersByID[n.ID()]; !ok || !prev.Equal(n) {
@@ -3118,6 +3203,7 @@ func (c *Conn) upsertPeerLocked(n tailcfg.NodeView, flags debugFlags, entriesPer
 			oldDiscoKey = epDisco.key
 		}
 		ep.updateFromNode(n, flags.heartbeatDisabled, flags.probeUDPLifetimeOn)
+		ep.setPathPolicy(pathPolicyForPeer(c.endpointPolicy, n))
 		c.peerMap.upsertEndpoint(ep, oldDiscoKey) // maybe update discokey mappings in peerMap
 		return
 	}
@@ -3181,7 +3267,12 @@ func (c *Conn) upsertPeerLocked(n tailcfg.NodeView, flags debugFlags, entriesPer
 	}
 
 	ep.updateFromNode(n, flags.heartbeatDisabled, flags.probeUDPLifetimeOn)
+	ep.setPathPolicy(pathPolicyForPeer(c.endpointPolicy, n))
 	c.peerMap.upsertEndpoint(ep, key.DiscoPublic{})
+	c.applyPathHintLocked(ep)
+	if c.warmPeers.Contains(ep.publicKey) {
+		ep.setKeepWarm(true)
+	}
 }
 
 // UpsertPeer adds or updates a single peer in c. It is the efficient
@@ -3534,6 +3625,15 @@ func (c *Conn) shouldDoPeriodicReSTUNLocked() bool {
 
 func (c *Conn) onPortMapChanged(portmappertype.Mapping) { c.ReSTUN("portmap-changed") }
 
+// PortMapLeases returns the port mapping leases the portmapper currently
+// holds, for debugging. It returns nil if the portmapper is disabled.
+func (c *Conn) PortMapLeases() []portmappertype.Lease {
+	if c.portMapper == nil {
+		return nil
+	}
+	return c.portMapper.Leases()
+}
+
 // ReSTUN triggers an address discovery.
 // The provided why string is for debug logging only.
 // If Conn.staticEndpoints have been updated, calling ReSTUN will also result in
@@ -3573,9 +3673,18 @@ func (c *Conn) ReSTUN(why string) {
 	}
 }
 
-// listenPacket opens a packet listener.
+// listenPacket opens a packet listener, on c's SharedUDP if it has one.
 // The network must be "udp4" or "udp6".
 func (c *Conn) listenPacket(network string, port uint16) (nettype.PacketConn, error) {
+	if c.sharedUDP != nil {
+		return c.sharedUDP.listenPacket(c, network, port)
+	}
+	return c.listenUDP(network, port)
+}
+
+// listenUDP opens a UDP socket.
+// The network must be "udp4" or "udp6".
+func (c *Conn) listenUDP(network string, port uint16) (nettype.PacketConn, error) {
 	ctx := context.Background() // unused without DNS name to resolve
 	if network == "udp4" {
 		ctx = sockstats.WithSockStats(ctx, sockstats.LabelMagicsockConnUDP4, c.logf)
@@ -3726,7 +3835,10 @@ func (c *Conn) Rebind() {
 		st := c.netMon.InterfaceState()
 		defIf := st.DefaultRouteInterface
 		ifIPs = st.InterfaceIPs[defIf]
-		c.logf("Rebind; defIf=%q, ips=%v", defIf, ifIPs)
+		// If a platform's InterfaceRanker chose defIf over the OS's
+		// default, DERP connections made over another interface are
+		// closed below like on any other default route change.
+		c.logf("Rebind; defIf=%q, ranked=%v, expensive=%v, ips=%v", defIf, st.DefaultRouteRanked, st.IsExpensive, ifIPs)
 	}
 
 	if len(ifIPs) > 0 {
@@ -4165,6 +4277,11 @@ type discoInfo struct {
 	// metricDERPStaleCleaned is how many times we closed a stale DERP connection.
 	metricDERPStaleCleaned = clientmetric.NewCounter("derp_stale_cleaned")
 
+	// Packets received on a SharedUDP socket that matched no Conn, or that
+	// the Conn they matched was too far behind to take.
+	metricSharedUDPUnrouted = clientmetric.NewCounter("magicsock_shared_udp_unrouted")
+	metricSharedUDPDropped  = clientmetric.NewCounter("magicsock_shared_udp_dropped")
+
 	// Disco packets received bpf read path
 	//lint:ignore U1000 used on Linux only
 	metricRecvDiscoPacketIPv4 = clientmetric.NewCounter("magicsock_disco_recv_bpf_ipv4")
@@ -0,0 +1,233 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"slices"
+	"time"
+
+	"tailscale.com/feature/condlite/expvar"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/util/usermetric"
+)
+
+// PeerPathStats describes the quality of the paths to a peer, as measured by
+// disco pings. It is for debug use only and could change at any time.
+type PeerPathStats struct {
+	NodeKey key.NodePublic
+
+	// BestPath is the path packets to the peer currently take, or empty if
+	// they go via DERP.
+	BestPath string `json:",omitempty"`
+
+	// BestPathChanges is the number of times the best path changed away from
+	// a direct or peer relay path.
+	BestPathChanges int64
+
+	// DERPFallbacks is the number of those changes that left no path other
+	// than DERP.
+	DERPFallbacks int64
+
+	// Paths are the peer's candidate direct paths, ordered by address.
+	Paths []PathStats `json:",omitempty"`
+}
+
+// PathStats describes the quality of a direct path to a peer.
+type PathStats struct {
+	Addr netip.AddrPort
+
+	// PingsSent and PingsLost are the number of disco pings sent on the
+	// path and the number of those that timed out. MTU probes aren't
+	// counted, as large ones are expected to be lost.
+	PingsSent int64
+	PingsLost int64
+
+	// Pongs is the number of recent pongs the latency stats below are
+	// computed from.
+	Pongs int `json:",omitempty"`
+
+	Latency       time.Duration `json:",omitempty"` // of the most recent pong
+	LatencyMean   time.Duration `json:",omitempty"`
+	LatencyStdDev time.Duration `json:",omitempty"`
+}
+
+// GetPeerPathStats returns the path quality stats of peer.
+func (c *Conn) GetPeerPathStats(peer tailcfg.NodeView) (PeerPathStats, error) {
+	c.mu.Lock()
+	if c.privateKey.IsZero() {
+		c.mu.Unlock()
+		return PeerPathStats{}, fmt.Errorf("tailscaled stopped")
+	}
+	ep, ok := c.peerMap.endpointForNodeKey(peer.Key())
+	c.mu.Unlock()
+
+	if !ok {
+		return PeerPathStats{}, fmt.Errorf("unknown peer")
+	}
+	return ep.pathStats(), nil
+}
+
+// AllPeerPathStats returns the path quality stats of all peers, ordered by
+// node key.
+func (c *Conn) AllPeerPathStats() []PeerPathStats {
+	c.mu.Lock()
+	var eps []*endpoint
+	c.peerMap.forEachEndpoint(func(ep *endpoint) {
+		eps = append(eps, ep)
+	})
+	c.mu.Unlock()
+
+	ret := make([]PeerPathStats, 0, len(eps))
+	for _, ep := range eps {
+		ret = append(ret, ep.pathStats())
+	}
+	slices.SortFunc(ret, func(a, b PeerPathStats) int {
+		return a.NodeKey.Compare(b.NodeKey)
+	})
+	return ret
+}
+
+func (de *endpoint) pathStats() PeerPathStats {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	ret := PeerPathStats{
+		NodeKey:         de.publicKey,
+		BestPathChanges: de.bestPathChanges,
+		DERPFallbacks:   de.derpFallbacks,
+	}
+	if de.bestAddr.ap.IsValid() {
+		ret.BestPath = de.bestAddr.epAddr.String()
+	}
+	for ap, st := range de.endpointState {
+		ps := PathStats{
+			Addr:      ap,
+			PingsSent: st.pingsSent,
+			PingsLost: st.pingsLost,
+			Pongs:     len(st.recentPongs),
+		}
+		ps.Latency, _ = st.latencyLocked()
+		ps.LatencyMean, ps.LatencyStdDev = st.latencyStatsLocked()
+		ret.Paths = append(ret.Paths, ps)
+	}
+	slices.SortFunc(ret.Paths, func(a, b PathStats) int {
+		return a.Addr.Compare(b.Addr)
+	})
+	return ret
+}
+
+// latencyStatsLocked returns the mean and standard deviation of the
+// latencies in st's pong history, or zero if it's empty.
+//
+// endpoint.mu must be held.
+func (st *endpointState) latencyStatsLocked() (mean, stdDev time.Duration) {
+	n := len(st.recentPongs)
+	if n == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, r := range st.recentPongs {
+		sum += float64(r.latency)
+	}
+	m := sum / float64(n)
+	var sq float64
+	for _, r := range st.recentPongs {
+		d := float64(r.latency) - m
+		sq += d * d
+	}
+	return time.Duration(m), time.Duration(math.Sqrt(sq / float64(n)))
+}
+
+// noteBestPathChangeLocked records in de's stats and c's metrics that de's
+// best path is changing from de.bestAddr to to.
+//
+// de.mu must be held.
+func (de *endpoint) noteBestPathChangeLocked(to epAddr) {
+	if !de.bestAddr.ap.IsValid() || to == de.bestAddr.epAddr {
+		return
+	}
+	de.bestPathChanges++
+	if !to.ap.IsValid() {
+		de.derpFallbacks++
+	}
+	if m := de.c.metrics; m != nil {
+		m.bestPathChanges.forPath(pathForEpAddr(to)).Add(1)
+	}
+}
+
+// noteDiscoPingLocked records in the stats of sp's path and in c's metrics
+// that sp was sent, or if lost, that it timed out.
+//
+// de.mu must be held.
+func (de *endpoint) noteDiscoPingLocked(sp sentPing, lost bool) {
+	if sp.size != 0 {
+		return // MTU probe
+	}
+	if st, ok := de.endpointState[sp.to.ap]; ok && !sp.to.vni.IsSet() {
+		if lost {
+			st.pingsLost++
+		} else {
+			st.pingsSent++
+		}
+	}
+	if m := de.c.metrics; m != nil {
+		c := &m.discoPingsSent
+		if lost {
+			c = &m.discoPingsLost
+		}
+		c.forPath(pathForEpAddr(sp.to)).Add(1)
+	}
+}
+
+// pathForEpAddr returns the Path that packets sent to ep take. The zero
+// epAddr (no path) is reported as DERP.
+func pathForEpAddr(ep epAddr) Path {
+	switch {
+	case !ep.ap.IsValid() || ep.ap.Addr() == tailcfg.DerpMagicIPAddr:
+		return PathDERP
+	case ep.vni.IsSet() && ep.ap.Addr().Is6():
+		return PathPeerRelayIPv6
+	case ep.vni.IsSet():
+		return PathPeerRelayIPv4
+	case ep.ap.Addr().Is6():
+		return PathDirectIPv6
+	}
+	return PathDirectIPv4
+}
+
+// pathCounters is a set of counters, one per Path, registered as a
+// usermetric labeled by path. See [metrics] for why they aren't looked up
+// by label.
+type pathCounters struct {
+	directIPv4    expvar.Int
+	directIPv6    expvar.Int
+	derp          expvar.Int
+	peerRelayIPv4 expvar.Int
+	peerRelayIPv6 expvar.Int
+}
+
+// register registers pc with reg as a counter with the given name and help.
+func (pc *pathCounters) register(reg *usermetric.Registry, name, help string) {
+	m := usermetric.NewMultiLabelMapWithRegistry[pathLabel](reg, name, "counter", help)
+	for _, p := range []Path{PathDirectIPv4, PathDirectIPv6, PathDERP, PathPeerRelayIPv4, PathPeerRelayIPv6} {
+		m.Set(pathLabel{Path: p}, pc.forPath(p))
+	}
+}
+
+func (pc *pathCounters) forPath(p Path) *expvar.Int {
+	switch p {
+	case PathDirectIPv4:
+		return &pc.directIPv4
+	case PathDirectIPv6:
+		return &pc.directIPv6
+	case PathPeerRelayIPv4:
+		return &pc.peerRelayIPv4
+	case PathPeerRelayIPv6:
+		return &pc.peerRelayIPv6
+	}
+	return &pc.derp
+}
@@ -0,0 +1,98 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/net/packet"
+	"tailscale.com/net/stun"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/util/usermetric"
+)
+
+func TestPathForEpAddr(t *testing.T) {
+	var vni packet.VirtualNetworkID
+	vni.Set(7)
+	tests := []struct {
+		ep   epAddr
+		want Path
+	}{
+		{epAddr{}, PathDERP},
+		{epAddr{ap: netip.AddrPortFrom(tailcfg.DerpMagicIPAddr, 1)}, PathDERP},
+		{epAddr{ap: netip.MustParseAddrPort("192.0.2.1:41641")}, PathDirectIPv4},
+		{epAddr{ap: netip.MustParseAddrPort("[2001:db8::1]:41641")}, PathDirectIPv6},
+		{epAddr{ap: netip.MustParseAddrPort("192.0.2.1:41641"), vni: vni}, PathPeerRelayIPv4},
+		{epAddr{ap: netip.MustParseAddrPort("[2001:db8::1]:41641"), vni: vni}, PathPeerRelayIPv6},
+	}
+	for _, tt := range tests {
+		if got := pathForEpAddr(tt.ep); got != tt.want {
+			t.Errorf("pathForEpAddr(%v) = %v; want %v", tt.ep, got, tt.want)
+		}
+	}
+}
+
+func TestPeerPathStats(t *testing.T) {
+	c := &Conn{metrics: registerMetrics(new(usermetric.Registry))}
+	t.Cleanup(deregisterMetrics)
+	ap1 := netip.MustParseAddrPort("192.0.2.1:41641")
+	ap2 := netip.MustParseAddrPort("192.0.2.2:41641")
+	de := &endpoint{
+		c:         c,
+		publicKey: key.NewNode().Public(),
+		sentPing:  map[stun.TxID]sentPing{},
+		endpointState: map[netip.AddrPort]*endpointState{
+			ap1: {},
+			ap2: {},
+		},
+	}
+
+	de.mu.Lock()
+	for range 4 {
+		de.noteDiscoPingLocked(sentPing{to: epAddr{ap: ap1}}, false)
+	}
+	de.noteDiscoPingLocked(sentPing{to: epAddr{ap: ap1}}, true)
+	de.noteDiscoPingLocked(sentPing{to: epAddr{ap: ap1}, size: 1200}, true) // MTU probe; not counted
+	for _, lat := range []time.Duration{10, 20, 30} {
+		de.endpointState[ap1].addPongReplyLocked(pongReply{latency: lat * time.Millisecond})
+	}
+	de.endpointState[ap1].clear() // keeps the ping counters
+
+	de.setBestAddrLocked(addrQuality{epAddr: epAddr{ap: ap1}})
+	de.setBestAddrLocked(addrQuality{epAddr: epAddr{ap: ap2}})
+	de.setBestAddrLocked(addrQuality{epAddr: epAddr{ap: ap2}})
+	de.setBestAddrLocked(addrQuality{})
+	de.endpointState[ap2].addPongReplyLocked(pongReply{latency: 10 * time.Millisecond})
+	de.endpointState[ap2].addPongReplyLocked(pongReply{latency: 30 * time.Millisecond})
+	de.mu.Unlock()
+
+	got := de.pathStats()
+	if got.BestPath != "" || got.BestPathChanges != 2 || got.DERPFallbacks != 1 {
+		t.Errorf("BestPath=%q BestPathChanges=%v DERPFallbacks=%v; want \"\", 2, 1", got.BestPath, got.BestPathChanges, got.DERPFallbacks)
+	}
+	if len(got.Paths) != 2 {
+		t.Fatalf("got %d paths; want 2", len(got.Paths))
+	}
+	if p := got.Paths[0]; p.Addr != ap1 || p.PingsSent != 4 || p.PingsLost != 1 || p.Pongs != 0 {
+		t.Errorf("path 1 = %+v; want 4 pings sent, 1 lost, no pongs", p)
+	}
+	if p := got.Paths[1]; p.Addr != ap2 || p.Pongs != 2 || p.Latency != 30*time.Millisecond ||
+		p.LatencyMean != 20*time.Millisecond || p.LatencyStdDev != 10*time.Millisecond {
+		t.Errorf("path 2 = %+v; want 2 pongs, latency 30ms, mean 20ms, stddev 10ms", p)
+	}
+
+	m := c.metrics
+	if got := m.discoPingsSent.directIPv4.Value(); got != 4 {
+		t.Errorf("disco pings sent = %v; want 4", got)
+	}
+	if got := m.discoPingsLost.directIPv4.Value(); got != 1 {
+		t.Errorf("disco pings lost = %v; want 1", got)
+	}
+	if got, got2 := m.bestPathChanges.directIPv4.Value(), m.bestPathChanges.derp.Value(); got != 1 || got2 != 1 {
+		t.Errorf("path changes to direct_ipv4, derp = %v, %v; want 1, 1", got, got2)
+	}
+}
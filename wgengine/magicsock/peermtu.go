@@ -11,6 +11,7 @@
 	"golang.org/x/sys/unix"
 	"tailscale.com/disco"
 	"tailscale.com/net/tstun"
+	"tailscale.com/types/key"
 )
 
 // Peer path MTU routines shared by platforms that implement it.
@@ -61,6 +62,21 @@ func (c *Conn) PeerMTUEnabled() bool {
 	return c.peerMTUEnabled.Load()
 }
 
+// PeerPathMTU returns the largest TUN packet that fits on the current best
+// UDP path to the peer with node key nk, as found by path MTU probing. It
+// reports false if peer path MTU discovery is disabled or the peer has no
+// UDP path, in which case packets to it go via DERP.
+func (c *Conn) PeerPathMTU(nk key.NodePublic) (tstun.TUNMTU, bool) {
+	if !c.peerMTUEnabled.Load() {
+		return 0, false
+	}
+	mtu, ok := c.peerPathMTUs.Load(nk)
+	if !ok {
+		return 0, false
+	}
+	return tstun.WireToTUNMTU(mtu), true
+}
+
 // UpdatePMTUD configures the underlying sockets of this Conn to enable or disable
 // peer path MTU discovery according to the current configuration.
 //
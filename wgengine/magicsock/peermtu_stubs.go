@@ -5,7 +5,11 @@
 
 package magicsock
 
-import "tailscale.com/disco"
+import (
+	"tailscale.com/disco"
+	"tailscale.com/net/tstun"
+	"tailscale.com/types/key"
+)
 
 func (c *Conn) DontFragSetting() (bool, error) {
 	return false, nil
@@ -19,6 +23,10 @@ func (c *Conn) PeerMTUEnabled() bool {
 	return false
 }
 
+func (c *Conn) PeerPathMTU(nk key.NodePublic) (tstun.TUNMTU, bool) {
+	return 0, false
+}
+
 func (c *Conn) UpdatePMTUD() {
 }
 
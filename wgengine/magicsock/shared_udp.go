@@ -0,0 +1,376 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tailscale/wireguard-go/device"
+	"go4.org/mem"
+	"tailscale.com/disco"
+	"tailscale.com/net/packet"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/nettype"
+)
+
+// SharedUDP is a pair of UDP sockets, one IPv4 and one IPv6, shared by the
+// Conns of several backends in one process, such as tsnet Servers, rather
+// than each binding its own, so that they use fewer ports, and fewer NAT
+// mappings on the gateways in front of them. Set it in [Options.SharedUDP].
+//
+// Received packets are demultiplexed by the key they're for: WireGuard
+// handshake initiations by their MAC1, which is keyed by the node key of the
+// recipient; other WireGuard messages by their receiver index, as learned
+// from the handshakes each Conn sends; and disco messages by whose disco key
+// opens them. STUN responses go to every Conn, and packets for none of them
+// are dropped.
+//
+// The sockets are opened by the first Conn to bind, on the port it asks for,
+// and closed once the last Conn closes them or rebinds. A Conn asking for
+// another port falls back to port 0, which joins the open sockets.
+type SharedUDP struct {
+	logf logger.Logf
+
+	mu    sync.Mutex
+	socks map[string]*sharedSocket // by network, "udp4" or "udp6"
+}
+
+// NewSharedUDP returns a new SharedUDP. Its sockets are opened as Conns
+// using it bind.
+func NewSharedUDP(logf logger.Logf) *SharedUDP {
+	return &SharedUDP{
+		logf:  logger.WithPrefix(logf, "magicsock: shared UDP: "),
+		socks: make(map[string]*sharedSocket),
+	}
+}
+
+const (
+	// sharedUDPQueueDepth is how many received packets a member of a shared
+	// socket buffers before newer ones are dropped.
+	sharedUDPQueueDepth = 256
+
+	// sharedIndexLifetime is how long a WireGuard receiver index learned
+	// from a sent handshake routes received packets. It's longer than
+	// WireGuard's RejectAfterTime, after which a session's keys are
+	// discarded.
+	sharedIndexLifetime = 5 * time.Minute
+
+	// maxSharedDiscoKeys is how many disco shared keys a member of a shared
+	// socket caches for opening disco messages.
+	maxSharedDiscoKeys = 1024
+)
+
+// sharedSocket is one of the sockets of a SharedUDP.
+type sharedSocket struct {
+	s       *SharedUDP
+	network string
+	pconn   nettype.PacketConn
+
+	members atomic.Pointer[[]*sharedUDPConn] // copied on write under s.mu
+
+	indexMu   sync.RWMutex
+	index     map[uint32]sharedIndex // by WireGuard receiver index
+	lastPrune time.Time
+}
+
+// sharedIndex is the member of a sharedSocket that a WireGuard receiver
+// index belongs to.
+type sharedIndex struct {
+	m    *sharedUDPConn
+	sent time.Time // of the last handshake with the index
+}
+
+// sharedUDPConn is the nettype.PacketConn of a Conn on a sharedSocket.
+type sharedUDPConn struct {
+	sock *sharedSocket
+	c    *Conn
+
+	in        chan sharedPacket
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu          sync.Mutex
+	mac1Key     key.NodePublic // cookie is initialized for
+	cookie      device.CookieChecker
+	discoKey    key.DiscoPrivate // discoShared is derived from
+	discoShared map[key.DiscoPublic]key.DiscoShared
+}
+
+type sharedPacket struct {
+	b   []byte
+	src netip.AddrPort
+}
+
+// listenPacket returns c's conn on the shared socket for network, opening
+// the socket on port if it isn't open.
+func (s *SharedUDP) listenPacket(c *Conn, network string, port uint16) (nettype.PacketConn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sock := s.socks[network]
+	if sock == nil {
+		pconn, err := c.listenUDP(network, port)
+		if err != nil {
+			return nil, err
+		}
+		trySetUDPSocketOptions(pconn, s.logf)
+		sock = &sharedSocket{
+			s:       s,
+			network: network,
+			pconn:   pconn,
+			index:   make(map[uint32]sharedIndex),
+		}
+		sock.members.Store(new([]*sharedUDPConn))
+		s.socks[network] = sock
+		s.logf("opened %v socket on %v", network, pconn.LocalAddr())
+		go sock.readLoop()
+	} else if cur := sock.localPort(); port != 0 && port != cur {
+		return nil, fmt.Errorf("shared %v socket is on port %d", network, cur)
+	}
+	m := &sharedUDPConn{
+		sock:   sock,
+		c:      c,
+		in:     make(chan sharedPacket, sharedUDPQueueDepth),
+		closed: make(chan struct{}),
+	}
+	members := append(slices.Clone(*sock.members.Load()), m)
+	sock.members.Store(&members)
+	return m, nil
+}
+
+// leave removes m from its socket, closing the socket if m was its last
+// member.
+func (s *SharedUDP) leave(m *sharedUDPConn) {
+	sock := m.sock
+	s.mu.Lock()
+	members := slices.DeleteFunc(slices.Clone(*sock.members.Load()), func(o *sharedUDPConn) bool { return o == m })
+	sock.members.Store(&members)
+	last := len(members) == 0
+	if last && s.socks[sock.network] == sock {
+		delete(s.socks, sock.network)
+	}
+	s.mu.Unlock()
+
+	sock.indexMu.Lock()
+	for idx, e := range sock.index {
+		if e.m == m {
+			delete(sock.index, idx)
+		}
+	}
+	sock.indexMu.Unlock()
+
+	if last {
+		s.logf("closing %v socket", sock.network)
+		sock.pconn.Close()
+	}
+}
+
+func (sock *sharedSocket) localPort() uint16 {
+	if ua, ok := sock.pconn.LocalAddr().(*net.UDPAddr); ok {
+		return uint16(ua.Port)
+	}
+	return 0
+}
+
+func (sock *sharedSocket) readLoop() {
+	buf := make([]byte, 64<<10)
+	for {
+		n, src, err := sock.pconn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Other errors, such as those from ICMP errors on some
+			// platforms, concern single packets.
+			continue
+		}
+		sock.route(buf[:n], src)
+	}
+}
+
+// route delivers the packet b from src to the members it's for.
+func (sock *sharedSocket) route(b []byte, src netip.AddrPort) {
+	members := *sock.members.Load()
+	switch len(members) {
+	case 0:
+		return
+	case 1:
+		members[0].deliver(b, src)
+		return
+	}
+
+	pt, isGeneveEncap := packetLooksLike(b)
+	payload := b
+	if isGeneveEncap {
+		payload = b[packet.GeneveFixedHeaderLength:]
+	}
+	switch pt {
+	case packetLooksLikeSTUNBinding:
+		// Each Conn's netchecker ignores transactions it didn't start.
+		for _, m := range members {
+			m.deliver(b, src)
+		}
+		return
+	case packetLooksLikeDisco:
+		for _, m := range members {
+			if m.opensDisco(payload) {
+				m.deliver(b, src)
+				return
+			}
+		}
+	default:
+		if m := sock.wireGuardRecipient(members, payload); m != nil {
+			m.deliver(b, src)
+			return
+		}
+	}
+	metricSharedUDPUnrouted.Add(1)
+}
+
+// wireGuardRecipient returns the member of members that the WireGuard
+// message b is for, or nil if there's none.
+func (sock *sharedSocket) wireGuardRecipient(members []*sharedUDPConn, b []byte) *sharedUDPConn {
+	if len(b) < 8 {
+		return nil
+	}
+	switch binary.LittleEndian.Uint32(b) {
+	case device.MessageInitiationType:
+		if len(b) != device.MessageInitiationSize {
+			return nil
+		}
+		for _, m := range members {
+			if m.checkMAC1(b) {
+				return m
+			}
+		}
+	case device.MessageResponseType, device.MessageCookieReplyType, device.MessageTransportType:
+		sock.indexMu.RLock()
+		defer sock.indexMu.RUnlock()
+		return sock.index[binary.LittleEndian.Uint32(b[4:8])].m
+	}
+	return nil
+}
+
+// noteSent notes that m sent b, learning the receiver index of the session
+// if b is a WireGuard handshake.
+func (sock *sharedSocket) noteSent(m *sharedUDPConn, b []byte) {
+	pt, isGeneveEncap := packetLooksLike(b)
+	if pt != packetLooksLikeWireGuard {
+		return
+	}
+	if isGeneveEncap {
+		b = b[packet.GeneveFixedHeaderLength:]
+	}
+	if len(b) < 8 {
+		return
+	}
+	switch binary.LittleEndian.Uint32(b) {
+	case device.MessageInitiationType, device.MessageResponseType:
+	default:
+		return
+	}
+	// The sender index of a handshake is the receiver index of the
+	// messages of the session it establishes.
+	idx := binary.LittleEndian.Uint32(b[4:8])
+	now := time.Now()
+	sock.indexMu.Lock()
+	defer sock.indexMu.Unlock()
+	sock.index[idx] = sharedIndex{m: m, sent: now}
+	if now.Sub(sock.lastPrune) > time.Minute {
+		sock.lastPrune = now
+		for idx, e := range sock.index {
+			if now.Sub(e.sent) > sharedIndexLifetime {
+				delete(sock.index, idx)
+			}
+		}
+	}
+}
+
+// deliver queues a copy of the packet b from src for m to read, dropping it
+// if m is falling behind.
+func (m *sharedUDPConn) deliver(b []byte, src netip.AddrPort) {
+	select {
+	case m.in <- sharedPacket{b: append([]byte(nil), b...), src: src}:
+	default:
+		metricSharedUDPDropped.Add(1)
+	}
+}
+
+// checkMAC1 reports whether the WireGuard handshake initiation b is for m's
+// node key.
+func (m *sharedUDPConn) checkMAC1(b []byte) bool {
+	pub := m.c.publicKeyAtomic.Load()
+	if pub.IsZero() {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if pub != m.mac1Key {
+		m.cookie.Init(device.NoisePublicKey(pub.Raw32()))
+		m.mac1Key = pub
+	}
+	return m.cookie.CheckMAC1(b)
+}
+
+// opensDisco reports whether m's disco key opens the disco message b.
+func (m *sharedUDPConn) opensDisco(b []byte) bool {
+	sender := key.DiscoPublicFromRaw32(mem.B(b[len(disco.Magic):discoHeaderLen]))
+	priv := m.c.discoAtomic.Private()
+	m.mu.Lock()
+	if !priv.Equal(m.discoKey) || len(m.discoShared) >= maxSharedDiscoKeys {
+		m.discoKey = priv
+		m.discoShared = make(map[key.DiscoPublic]key.DiscoShared)
+	}
+	shared, ok := m.discoShared[sender]
+	if !ok {
+		shared = priv.Shared(sender)
+		m.discoShared[sender] = shared
+	}
+	m.mu.Unlock()
+	_, ok = shared.Open(b[discoHeaderLen:])
+	return ok
+}
+
+func (m *sharedUDPConn) ReadFromUDPAddrPort(b []byte) (int, netip.AddrPort, error) {
+	select {
+	case p := <-m.in:
+		return copy(b, p.b), p.src, nil
+	case <-m.closed:
+		return 0, netip.AddrPort{}, net.ErrClosed
+	}
+}
+
+func (m *sharedUDPConn) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	select {
+	case <-m.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	m.sock.noteSent(m, b)
+	return m.sock.pconn.WriteToUDPAddrPort(b, addr)
+}
+
+func (m *sharedUDPConn) LocalAddr() net.Addr { return m.sock.pconn.LocalAddr() }
+
+func (m *sharedUDPConn) Close() error {
+	err := net.ErrClosed
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		m.sock.s.leave(m)
+		err = nil
+	})
+	return err
+}
+
+func (m *sharedUDPConn) SetDeadline(t time.Time) error      { return errors.New("unimplemented") }
+func (m *sharedUDPConn) SetReadDeadline(t time.Time) error  { return errors.New("unimplemented") }
+func (m *sharedUDPConn) SetWriteDeadline(t time.Time) error { return errors.New("unimplemented") }
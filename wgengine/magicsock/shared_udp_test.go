@@ -0,0 +1,132 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/tailscale/wireguard-go/device"
+	"tailscale.com/disco"
+	"tailscale.com/net/stun"
+	"tailscale.com/types/key"
+)
+
+func TestSharedUDP(t *testing.T) {
+	s := NewSharedUDP(t.Logf)
+	newConn := func() *Conn {
+		c := &Conn{logf: t.Logf, testOnlyPacketListener: localhostListener{}}
+		c.publicKeyAtomic.Store(key.NewNode().Public())
+		c.discoAtomic.Set(key.NewDisco())
+		return c
+	}
+	c1, c2 := newConn(), newConn()
+	p1, err := s.listenPacket(c1, "udp4", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := s.listenPacket(c2, "udp4", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, m2 := p1.(*sharedUDPConn), p2.(*sharedUDPConn)
+	if m1.sock != m2.sock {
+		t.Fatal("conns don't share a socket")
+	}
+	sharedAddr := p1.LocalAddr().(*net.UDPAddr).AddrPort()
+	if _, err := s.listenPacket(newConn(), "udp4", sharedAddr.Port()+1); err == nil {
+		t.Error("listening on another port succeeded")
+	}
+
+	peer, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	peerAddr := peer.LocalAddr().(*net.UDPAddr).AddrPort()
+
+	// expect checks that the packet b sent by peer is received by the
+	// members want, and no others.
+	expect := func(name string, b []byte, want ...*sharedUDPConn) {
+		t.Helper()
+		if _, err := peer.WriteToUDPAddrPort(b, sharedAddr); err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range want {
+			select {
+			case p := <-m.in:
+				if string(p.b) != string(b) || p.src != peerAddr {
+					t.Errorf("%s: got %d bytes from %v", name, len(p.b), p.src)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: not received", name)
+			}
+		}
+		// Packets are routed in order, so had the last been misrouted,
+		// it'd be queued by now.
+		for _, m := range []*sharedUDPConn{m1, m2} {
+			select {
+			case <-m.in:
+				t.Errorf("%s: received by the wrong conn", name)
+			default:
+			}
+		}
+	}
+
+	// Disco messages go to whose disco key opens them.
+	peerDisco := key.NewDisco()
+	discoMsg := func(to *Conn) []byte {
+		b := []byte(disco.Magic)
+		b = peerDisco.Public().AppendTo(b)
+		return append(b, peerDisco.Shared(to.discoAtomic.Public()).Seal([]byte("hello"))...)
+	}
+	expect("disco to c2", discoMsg(c2), m2)
+	expect("disco to c1", discoMsg(c1), m1)
+	expect("disco to nobody", discoMsg(newConn()))
+
+	// Handshake initiations go to whose node key they're MACed for.
+	initiation := func(to *Conn) []byte {
+		b := make([]byte, device.MessageInitiationSize)
+		binary.LittleEndian.PutUint32(b, device.MessageInitiationType)
+		var gen device.CookieGenerator
+		gen.Init(device.NoisePublicKey(to.publicKeyAtomic.Load().Raw32()))
+		gen.AddMacs(b)
+		return b
+	}
+	expect("initiation to c1", initiation(c1), m1)
+	expect("initiation to c2", initiation(c2), m2)
+
+	// Other WireGuard messages go to whose handshake set their receiver
+	// index.
+	const idx = 0x12345678
+	resp := make([]byte, device.MessageResponseSize)
+	binary.LittleEndian.PutUint32(resp, device.MessageResponseType)
+	binary.LittleEndian.PutUint32(resp[4:], idx)
+	if _, err := p2.WriteToUDPAddrPort(resp, peerAddr); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data, device.MessageTransportType)
+	binary.LittleEndian.PutUint32(data[4:], idx)
+	expect("data for c2", data, m2)
+	binary.LittleEndian.PutUint32(data[4:], idx+1)
+	expect("data for nobody", data)
+
+	// STUN responses go to everyone.
+	expect("stun", stun.Response(stun.NewTxID(), netip.MustParseAddrPort("1.2.3.4:5")), m1, m2)
+
+	// The socket closes with its last member.
+	p1.Close()
+	if _, ok := s.socks["udp4"]; !ok {
+		t.Fatal("socket closed with a member left")
+	}
+	expect("initiation to c2 alone", initiation(newConn()), m2)
+	p2.Close()
+	if _, ok := s.socks["udp4"]; ok {
+		t.Fatal("socket open without members")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"time"
+
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+	"tailscale.com/util/mak"
+	"tailscale.com/util/set"
+)
+
+// warmHeartbeatInterval is how often the path to a warm peer (see
+// [Conn.SetWarmPeers]) is pinged while there's no traffic to it. It's under
+// the 30 seconds after which many NATs drop idle UDP mappings.
+const warmHeartbeatInterval = 25 * time.Second
+
+// SetWarmPeers sets the peers whose paths are kept warm, replacing any
+// previous ones, so that the first packet to them after a period of idleness
+// or a network change doesn't wait for path discovery.
+//
+// The path to a warm peer is pinged every warmHeartbeatInterval even while
+// idle, and rediscovered as soon as connectivity changes rather than on the
+// next packet to it. It has no effect while silent disco is enabled.
+func (c *Conn) SetWarmPeers(peers []key.NodePublic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var warm set.Set[key.NodePublic]
+	if len(peers) > 0 {
+		warm = set.SetOf(peers)
+	}
+	if warm.Equal(c.warmPeers) {
+		return
+	}
+	c.warmPeers = warm
+	c.peerMap.forEachEndpoint(func(ep *endpoint) {
+		ep.setKeepWarm(warm.Contains(ep.publicKey))
+	})
+}
+
+// AddPathHints adds the direct UDP paths in hints, such as those saved from
+// [Conn.WarmPeerPaths] before a restart, as candidate endpoints of their
+// peers, to ping along with those from the network map. A hint that the
+// peer doesn't confirm is forgotten after a while. Hints for peers that
+// aren't known yet are kept until they are.
+func (c *Conn) AddPathHints(hints map[key.NodePublic]netip.AddrPort) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, ap := range hints {
+		if !ap.IsValid() {
+			continue
+		}
+		if ep, ok := c.peerMap.endpointForNodeKey(k); ok {
+			ep.addPathHint(ap)
+		} else {
+			mak.Set(&c.pathHints, k, ap)
+		}
+	}
+}
+
+// applyPathHintLocked adds the pending path hint for ep's peer, if any, to
+// ep.
+//
+// c.mu must be held.
+func (c *Conn) applyPathHintLocked(ep *endpoint) {
+	if ap, ok := c.pathHints[ep.publicKey]; ok {
+		delete(c.pathHints, ep.publicKey)
+		ep.addPathHint(ap)
+	}
+}
+
+// WarmPeerPaths returns the direct UDP paths in use to the warm peers that
+// have one, for the caller to save and pass to [Conn.AddPathHints] after a
+// restart.
+func (c *Conn) WarmPeerPaths() map[key.NodePublic]netip.AddrPort {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ret map[key.NodePublic]netip.AddrPort
+	for k := range c.warmPeers {
+		ep, ok := c.peerMap.endpointForNodeKey(k)
+		if !ok {
+			continue
+		}
+		ep.mu.Lock()
+		if ep.bestAddr.isDirect() {
+			mak.Set(&ret, k, ep.bestAddr.ap)
+		}
+		ep.mu.Unlock()
+	}
+	return ret
+}
+
+// setKeepWarm sets whether de's path is kept warm. See [Conn.SetWarmPeers].
+func (de *endpoint) setKeepWarm(v bool) {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	if de.keepWarm == v {
+		return
+	}
+	de.keepWarm = v
+	if v {
+		de.warmLocked(mono.Now())
+	}
+}
+
+// warmLocked starts discovery of de's paths if it doesn't have a trusted one,
+// and heartbeats to keep them warm if they're not already running.
+//
+// de.mu must be held.
+func (de *endpoint) warmLocked(now mono.Time) {
+	if de.heartbeatDisabled || de.isWireguardOnly || de.expired {
+		return
+	}
+	if de.wantFullPingLocked(now) {
+		de.sendDiscoPingsLocked(now, true)
+	}
+	if de.heartBeatTimer == nil {
+		de.heartBeatTimer = time.AfterFunc(warmHeartbeatInterval, de.heartbeat)
+	}
+}
+
+// heartbeatWarmLocked is the heartbeat of a warm endpoint whose session is
+// idle. It pings the best path, even once it's no longer trusted for sending,
+// to keep it (and any NAT mappings along it) alive, or starts discovery if
+// there's none.
+//
+// de.mu must be held.
+func (de *endpoint) heartbeatWarmLocked(now mono.Time) {
+	if de.isWireguardOnly || de.expired {
+		return
+	}
+	if de.bestAddr.ap.IsValid() {
+		de.startDiscoPingLocked(de.bestAddr.epAddr, now, pingHeartbeat, 0, nil)
+	} else {
+		de.sendDiscoPingsLocked(now, true)
+	}
+	de.heartBeatTimer = time.AfterFunc(warmHeartbeatInterval, de.heartbeat)
+}
+
+// addPathHint adds ap as a candidate endpoint of de, and pings it right away
+// if de is warm. See [Conn.AddPathHints].
+func (de *endpoint) addPathHint(ap netip.AddrPort) {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	if de.isWireguardOnly {
+		return
+	}
+	if _, ok := de.endpointState[ap]; ok {
+		return
+	}
+	de.endpointState[ap] = &endpointState{
+		index:    indexSentinelDeleted,
+		hintTime: time.Now(),
+	}
+	de.debugUpdates.Add(EndpointChange{
+		When: time.Now(),
+		What: "addPathHint",
+		To:   ap,
+	})
+	if de.keepWarm && !de.heartbeatDisabled {
+		de.startDiscoPingLocked(epAddr{ap: ap}, mono.Now(), pingDiscovery, 0, nil)
+	}
+}
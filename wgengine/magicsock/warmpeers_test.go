@@ -0,0 +1,101 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"maps"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/net/stun"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+func TestWarmPeers(t *testing.T) {
+	c := newConn(t.Logf)
+	newEndpoint := func(id int) *endpoint {
+		ep := &endpoint{
+			c:             c,
+			nodeID:        tailcfg.NodeID(id),
+			publicKey:     key.NewNode().Public(),
+			sentPing:      map[stun.TxID]sentPing{},
+			endpointState: map[netip.AddrPort]*endpointState{},
+			// Suppress the pings to the path hints, as c has no sockets.
+			pathPolicy: pathPolicy{denyDirect: true},
+		}
+		ep.disco.Store(&endpointDisco{key: key.NewDisco().Public()})
+		c.peerMap.upsertEndpoint(ep, key.DiscoPublic{})
+		return ep
+	}
+	ep1, ep2 := newEndpoint(1), newEndpoint(2)
+	t.Cleanup(func() {
+		for _, ep := range []*endpoint{ep1, ep2} {
+			if ep.heartBeatTimer != nil {
+				ep.heartBeatTimer.Stop()
+			}
+		}
+	})
+	ap1 := netip.MustParseAddrPort("192.0.2.1:41641")
+	ap3 := netip.MustParseAddrPort("192.0.2.3:41641")
+	k3 := key.NewNode().Public()
+
+	c.AddPathHints(map[key.NodePublic]netip.AddrPort{ep1.publicKey: ap1, k3: ap3})
+	if st, ok := ep1.endpointState[ap1]; !ok || st.hintTime.IsZero() || st.shouldDeleteLocked() {
+		t.Errorf("path hint for known peer not added as a live candidate: %+v", st)
+	}
+	if got := c.pathHints[k3]; got != ap3 {
+		t.Errorf("pending path hint for unknown peer = %v; want %v", got, ap3)
+	}
+
+	c.SetWarmPeers([]key.NodePublic{ep1.publicKey})
+	if !ep1.keepWarm || ep1.heartBeatTimer == nil {
+		t.Errorf("warm peer: keepWarm=%v, heartbeat running=%v; want true, true", ep1.keepWarm, ep1.heartBeatTimer != nil)
+	}
+	if ep2.keepWarm || ep2.heartBeatTimer != nil {
+		t.Errorf("other peer: keepWarm=%v, heartbeat running=%v; want false, false", ep2.keepWarm, ep2.heartBeatTimer != nil)
+	}
+
+	// An idle warm peer keeps heartbeating; an idle other peer doesn't.
+	ep1.heartBeatTimer.Stop()
+	ep1.heartbeat()
+	if ep1.heartBeatTimer == nil {
+		t.Error("idle warm peer stopped heartbeating")
+	}
+
+	ep1.bestAddr = addrQuality{epAddr: epAddr{ap: ap1}}
+	want := map[key.NodePublic]netip.AddrPort{ep1.publicKey: ap1}
+	if got := c.WarmPeerPaths(); !maps.Equal(got, want) {
+		t.Errorf("WarmPeerPaths = %v; want %v", got, want)
+	}
+
+	c.SetWarmPeers(nil)
+	ep1.heartBeatTimer.Stop()
+	ep1.heartbeat()
+	if ep1.keepWarm || ep1.heartBeatTimer != nil {
+		t.Errorf("formerly warm peer: keepWarm=%v, heartbeat running=%v; want false, false", ep1.keepWarm, ep1.heartBeatTimer != nil)
+	}
+	if got := c.WarmPeerPaths(); len(got) != 0 {
+		t.Errorf("WarmPeerPaths with no warm peers = %v; want none", got)
+	}
+}
+
+func TestPathHintExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		st   endpointState
+		want bool
+	}{
+		{"recent-hint", endpointState{index: indexSentinelDeleted, hintTime: time.Now()}, false},
+		{"old-hint", endpointState{index: indexSentinelDeleted, hintTime: time.Now().Add(-2 * sessionActiveTimeout)}, true},
+		{"old-hint-in-netmap", endpointState{index: 0, hintTime: time.Now().Add(-2 * sessionActiveTimeout)}, false},
+		{"removed-from-netmap", endpointState{index: indexSentinelDeleted}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.st.shouldDeleteLocked(); got != tt.want {
+			t.Errorf("%s: shouldDeleteLocked = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
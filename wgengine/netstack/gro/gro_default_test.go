@@ -0,0 +1,100 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ios && !ts_omit_gro
+
+package gro
+
+import (
+	"net/netip"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"tailscale.com/net/packet"
+)
+
+// countingDispatcher is a stack.NetworkDispatcher that counts the packets
+// delivered to it.
+type countingDispatcher struct {
+	packets int
+}
+
+func (d *countingDispatcher) DeliverNetworkPacket(tcpip.NetworkProtocolNumber, *stack.PacketBuffer) {
+	d.packets++
+}
+
+func (d *countingDispatcher) DeliverLinkPacket(tcpip.NetworkProtocolNumber, *stack.PacketBuffer) {}
+
+// tcp4Segments returns n consecutive, MSS-sized IPv4 TCP segments of a
+// single flow, as a subnet router would read them from its TUN device in one
+// batch.
+func tcp4Segments(n, mss int) [][]byte {
+	segs := make([][]byte, n)
+	for i := range segs {
+		seg := make([]byte, header.IPv4MinimumSize+header.TCPMinimumSize+mss)
+		ipH := header.IPv4(seg)
+		ipH.Encode(&header.IPv4Fields{
+			SrcAddr:     tcpip.AddrFromSlice(netip.MustParseAddr("192.0.2.1").AsSlice()),
+			DstAddr:     tcpip.AddrFromSlice(netip.MustParseAddr("192.0.2.2").AsSlice()),
+			Protocol:    uint8(header.TCPProtocolNumber),
+			TTL:         64,
+			TotalLength: uint16(len(seg)),
+			ID:          uint16(i),
+		})
+		ipH.SetChecksum(^ipH.CalculateChecksum())
+		tcpH := header.TCP(seg[header.IPv4MinimumSize:])
+		tcpH.Encode(&header.TCPFields{
+			SrcPort:    40000,
+			DstPort:    443,
+			SeqNum:     uint32(1 + i*mss),
+			AckNum:     1,
+			DataOffset: header.TCPMinimumSize,
+			Flags:      header.TCPFlagAck,
+			WindowSize: 65535,
+		})
+		pseudoCsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, ipH.SourceAddress(), ipH.DestinationAddress(), uint16(header.TCPMinimumSize+mss))
+		tcpH.SetChecksum(^tcpH.CalculateChecksum(pseudoCsum))
+		segs[i] = seg
+	}
+	return segs
+}
+
+// BenchmarkGRO measures the cost of delivering a batch of TCP segments into
+// netstack with and without coalescing. The "delivered/op" metric is the
+// number of packets gVisor has to process per batch.
+func BenchmarkGRO(b *testing.B) {
+	const batch = 64 // roughly a full TUN read vector
+	segs := tcp4Segments(batch, 1360)
+
+	b.Run("gro", func(b *testing.B) {
+		var d countingDispatcher
+		var p packet.Parsed
+		b.ReportAllocs()
+		for b.Loop() {
+			g := NewGRO()
+			g.SetDispatcher(&d)
+			for _, seg := range segs {
+				p.Decode(seg)
+				g.Enqueue(&p)
+			}
+			g.Flush()
+		}
+		b.ReportMetric(float64(d.packets)/float64(b.N), "delivered/op")
+	})
+	b.Run("no-gro", func(b *testing.B) {
+		var d countingDispatcher
+		var p packet.Parsed
+		b.ReportAllocs()
+		for b.Loop() {
+			for _, seg := range segs {
+				p.Decode(seg)
+				pkt := RXChecksumOffload(&p)
+				d.DeliverNetworkPacket(pkt.NetworkProtocolNumber, pkt)
+				pkt.DecRef()
+			}
+		}
+		b.ReportMetric(float64(d.packets)/float64(b.N), "delivered/op")
+	})
+}
@@ -6,6 +6,7 @@
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"expvar"
@@ -37,6 +38,7 @@
 	"tailscale.com/ipn/ipnlocal"
 	"tailscale.com/metrics"
 	"tailscale.com/net/dns"
+	"tailscale.com/net/ftpalg"
 	"tailscale.com/net/ipset"
 	"tailscale.com/net/netaddr"
 	"tailscale.com/net/netx"
@@ -50,6 +52,7 @@
 	"tailscale.com/types/ipproto"
 	"tailscale.com/types/logger"
 	"tailscale.com/types/netmap"
+	"tailscale.com/types/netstacktype"
 	"tailscale.com/types/nettype"
 	"tailscale.com/types/views"
 	"tailscale.com/util/clientmetric"
@@ -137,6 +140,28 @@ func maxInFlightConnectionAttemptsPerClient() int {
 // at the netstack default. Value is a Go duration, e.g. "15s".
 var netstackKeepaliveInterval = envknob.RegisterDuration("TS_NETSTACK_KEEPALIVE_INTERVAL")
 
+// netstackDisableGRO disables coalescing of TCP segments read from the TUN
+// device (or received from WireGuard) before they're handed to netstack, and
+// the corresponding GSO on the way back out. Coalescing reduces per-packet
+// overhead for large forwarded TCP streams; this is an escape hatch for
+// middleboxes that mishandle the resulting segment sizes.
+var netstackDisableGRO = envknob.RegisterBool("TS_NETSTACK_DISABLE_GRO")
+
+// netstackTCPReceiveBufferMax and netstackTCPSendBufferMax, if non-zero,
+// replace the platform's maximum TCP receive and send buffer sizes in bytes
+// when the TCP config doesn't set them, trading throughput on high
+// bandwidth-delay product paths for less memory per connection.
+var (
+	netstackTCPReceiveBufferMax = envknob.RegisterInt("TS_NETSTACK_TCP_RECEIVE_BUFFER_MAX")
+	netstackTCPSendBufferMax    = envknob.RegisterInt("TS_NETSTACK_TCP_SEND_BUFFER_MAX")
+)
+
+// netstackDisableFTPHelper disables following passive mode replies on
+// forwarded FTP control connections (to port 21), which otherwise rewrites
+// the server address in them to the one the client connected to and
+// forwards the data connections they announce to the same server.
+var netstackDisableFTPHelper = envknob.RegisterBool("TS_NETSTACK_DISABLE_FTP_HELPER")
+
 var (
 	serviceIP   = tsaddr.TailscaleServiceIP()
 	serviceIPv6 = tsaddr.TailscaleServiceIPv6()
@@ -243,6 +268,14 @@ type Impl struct {
 	// make this a set of strings for faster lookup
 	atomicActiveVIPServices syncs.AtomicValue[set.Set[tailcfg.ServiceName]]
 
+	// atomicTCPPortRanges are the listeners from ListenTCPPortRange. It's
+	// replaced, not mutated, with mu held.
+	atomicTCPPortRanges syncs.AtomicValue[[]*tcpPortRangeListener]
+
+	// ftpData are the FTP data connections expected by the FTP control
+	// connections being forwarded. See ftpalg.
+	ftpData ftpalg.Expectations
+
 	// forwardDialFunc, if non-nil, is the net.Dialer.DialContext-style
 	// function that is used to make outgoing connections when forwarding a
 	// TCP connection to another host (e.g. in subnet router mode).
@@ -280,6 +313,8 @@ type Impl struct {
 	// unfortunate that we have to track this all twice, but thankfully the
 	// map only holds pending (in-flight) packets, and it's reasonably cheap.
 	packetsInFlight map[stack.TransportEndpointID]struct{}
+	// tcpConfig is the TCP configuration last set by SetTCPConfig.
+	tcpConfig netstacktype.TCPConfig
 }
 
 const nicID = 1
@@ -290,7 +325,15 @@ type Impl struct {
 // have a UDP packet as big as the MTU.
 const maxUDPPacketSize = tstun.MaxPacketSize
 
-func setTCPBufSizes(ipstack *stack.Stack) error {
+// setTCPConfig applies c to ipstack. Zero fields of c use platform defaults,
+// or the TS_NETSTACK_TCP_*_BUFFER_MAX envknobs if set.
+func setTCPConfig(ipstack *stack.Stack, c netstacktype.TCPConfig) error {
+	rxMax := cmp.Or(c.ReceiveBufferMax, netstackTCPReceiveBufferMax(), tcpRXBufMaxSize)
+	txMax := cmp.Or(c.SendBufferMax, netstackTCPSendBufferMax(), tcpTXBufMaxSize)
+	if rxMax < tcpRXBufMinSize || txMax < tcpTXBufMinSize {
+		return fmt.Errorf("TCP buffer sizes must be at least %d bytes", tcp.MinBufferSize)
+	}
+
 	// tcpip.TCP{Receive,Send}BufferSizeRangeOption is gVisor's version of
 	// Linux's tcp_{r,w}mem. Application within gVisor differs as some Linux
 	// features are not (yet) implemented, and socket buffer memory is not
@@ -304,10 +347,10 @@ func setTCPBufSizes(ipstack *stack.Stack) error {
 		// for application by the TCP_WINDOW_CLAMP socket option.
 		Min: tcpRXBufMinSize,
 		// Default is used by gVisor at socket creation.
-		Default: tcpRXBufDefSize,
+		Default: min(tcpRXBufDefSize, rxMax),
 		// Max is used by gVisor to cap the advertised receive window post-read.
 		// (tcp_moderate_rcvbuf=true, the default).
-		Max: tcpRXBufMaxSize,
+		Max: rxMax,
 	}
 	tcpipErr := ipstack.SetTransportProtocolOption(tcp.ProtocolNumber, &tcpRXBufOpt)
 	if tcpipErr != nil {
@@ -317,14 +360,67 @@ func setTCPBufSizes(ipstack *stack.Stack) error {
 		// Min in unused by gVisor at the time of writing.
 		Min: tcpTXBufMinSize,
 		// Default is used by gVisor at socket creation.
-		Default: tcpTXBufDefSize,
+		Default: min(tcpTXBufDefSize, txMax),
 		// Max is used by gVisor to cap the send window.
-		Max: tcpTXBufMaxSize,
+		Max: txMax,
 	}
 	tcpipErr = ipstack.SetTransportProtocolOption(tcp.ProtocolNumber, &tcpTXBufOpt)
 	if tcpipErr != nil {
 		return fmt.Errorf("could not set TCP TX buf size: %v", tcpipErr)
 	}
+
+	// See https://github.com/tailscale/tailscale/issues/9707
+	// gVisor's RACK performs poorly. ACKs do not appear to be handled in a
+	// timely manner, leading to spurious retransmissions and a reduced
+	// congestion window. It's off unless explicitly requested.
+	tcpRecoveryOpt := tcpip.TCPRecovery(0)
+	if c.RACK {
+		tcpRecoveryOpt = tcpip.TCPRACKLossDetection
+	}
+	tcpipErr = ipstack.SetTransportProtocolOption(tcp.ProtocolNumber, &tcpRecoveryOpt)
+	if tcpipErr != nil {
+		return fmt.Errorf("could not set TCP RACK: %v", tcpipErr)
+	}
+
+	// gVisor defaults to reno at the time of writing. We explicitly set reno
+	// congestion control in order to prevent unexpected changes. Netstack
+	// has an int overflow in sender congestion window arithmetic that is more
+	// prone to trigger with cubic congestion control, so cubic is opt-in.
+	// See https://github.com/google/gvisor/issues/11632
+	cc := cmp.Or(c.CongestionControl, "reno")
+	if cc != "reno" && cc != "cubic" {
+		return fmt.Errorf("unsupported TCP congestion control %q", cc)
+	}
+	ccOpt := tcpip.CongestionControlOption(cc)
+	tcpipErr = ipstack.SetTransportProtocolOption(tcp.ProtocolNumber, &ccOpt)
+	if tcpipErr != nil {
+		return fmt.Errorf("could not set %s congestion control: %v", cc, tcpipErr)
+	}
+	return nil
+}
+
+// TCPConfig returns the current TCP configuration of the stack.
+func (ns *Impl) TCPConfig() netstacktype.TCPConfig {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.tcpConfig
+}
+
+// SetTCPConfig changes the TCP configuration of the stack. It only affects
+// TCP connections created afterwards.
+func (ns *Impl) SetTCPConfig(c netstacktype.TCPConfig) error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if err := setTCPConfig(ns.ipstack, c); err != nil {
+		// Put back the previous config so a partially applied bad
+		// config doesn't linger.
+		if err2 := setTCPConfig(ns.ipstack, ns.tcpConfig); err2 != nil {
+			ns.logf("netstack: restoring TCP config: %v", err2)
+		}
+		return err
+	}
+	ns.tcpConfig = c
+	ns.logf("netstack: TCP config set to %+v", c)
 	return nil
 }
 
@@ -357,32 +453,13 @@ func Create(logf logger.Logf, tundev *tstun.Wrapper, e wgengine.Engine, mc *magi
 	if tcpipErr != nil {
 		return nil, fmt.Errorf("could not enable TCP SACK: %v", tcpipErr)
 	}
-	// See https://github.com/tailscale/tailscale/issues/9707
-	// gVisor's RACK performs poorly. ACKs do not appear to be handled in a
-	// timely manner, leading to spurious retransmissions and a reduced
-	// congestion window.
-	tcpRecoveryOpt := tcpip.TCPRecovery(0)
-	tcpipErr = ipstack.SetTransportProtocolOption(tcp.ProtocolNumber, &tcpRecoveryOpt)
-	if tcpipErr != nil {
-		return nil, fmt.Errorf("could not disable TCP RACK: %v", tcpipErr)
-	}
-	// gVisor defaults to reno at the time of writing. We explicitly set reno
-	// congestion control in order to prevent unexpected changes. Netstack
-	// has an int overflow in sender congestion window arithmetic that is more
-	// prone to trigger with cubic congestion control.
-	// See https://github.com/google/gvisor/issues/11632
-	renoOpt := tcpip.CongestionControlOption("reno")
-	tcpipErr = ipstack.SetTransportProtocolOption(tcp.ProtocolNumber, &renoOpt)
-	if tcpipErr != nil {
-		return nil, fmt.Errorf("could not set reno congestion control: %v", tcpipErr)
-	}
-	err := setTCPBufSizes(ipstack)
+	err := setTCPConfig(ipstack, netstacktype.TCPConfig{})
 	if err != nil {
 		return nil, err
 	}
 	supportedGSOKind := stack.GSONotSupported
 	supportedGROKind := groNotSupported
-	if runtime.GOOS == "linux" && buildfeatures.HasGRO {
+	if runtime.GOOS == "linux" && buildfeatures.HasGRO && !netstackDisableGRO() {
 		// TODO(jwhited): add Windows support https://github.com/tailscale/corp/issues/21874
 		supportedGROKind = tcpGROSupported
 		supportedGSOKind = stack.HostGSOSupported
@@ -1229,6 +1306,9 @@ func (ns *Impl) shouldProcessInbound(p *packet.Parsed, t *tstun.Wrapper) bool {
 			return true
 		}
 	}
+	if isLocal && p.IPProto == ipproto.TCP && ns.tcpPortRangeListenerFor(p.Dst) != nil {
+		return true
+	}
 	if buildfeatures.HasServe && isService {
 		if p.IsEchoRequest() {
 			return true
@@ -1627,6 +1707,14 @@ func (ns *Impl) acceptTCP(r *tcp.ForwarderRequest) {
 		return
 	}
 
+	// FTP data connections follow their control connection's backend.
+	if backend, ok := ns.ftpData.Take(clientRemoteIP, dstAddrPort); ok {
+		if !ns.forwardTCP(getConnOrReset, clientRemoteIP, &wq, dstAddrPort, backend, isLocal) {
+			r.Complete(true) // sends a RST
+		}
+		return
+	}
+
 	if ns.lb != nil {
 		handler, opts := ns.lb.TCPHandlerForDst(clientRemoteAddrPort, dstAddrPort)
 		if handler != nil {
@@ -1639,6 +1727,15 @@ func (ns *Impl) acceptTCP(r *tcp.ForwarderRequest) {
 		}
 	}
 
+	if ln := ns.tcpPortRangeListenerFor(dstAddrPort); ln != nil {
+		c := getConnOrReset() // will send a RST if it fails
+		if c == nil {
+			return
+		}
+		ln.handle(c)
+		return
+	}
+
 	if ns.GetTCPHandlerForFlow != nil {
 		handler, ok := ns.GetTCPHandlerForFlow(clientRemoteAddrPort, dstAddrPort)
 		if ok {
@@ -1684,7 +1781,7 @@ func (ns *Impl) acceptTCP(r *tcp.ForwarderRequest) {
 	}
 	dialAddr := netip.AddrPortFrom(dialIP, uint16(reqDetails.LocalPort))
 
-	if !ns.forwardTCP(getConnOrReset, clientRemoteIP, &wq, dialAddr, isLocal) {
+	if !ns.forwardTCP(getConnOrReset, clientRemoteIP, &wq, dstAddrPort, dialAddr, isLocal) {
 		r.Complete(true) // sends a RST
 	}
 }
@@ -1696,7 +1793,9 @@ type tcpCloser interface {
 	CloseWrite() error
 }
 
-func (ns *Impl) forwardTCP(getClient func(...tcpip.SettableSocketOption) *gonet.TCPConn, clientRemoteIP netip.Addr, wq *waiter.Queue, dialAddr netip.AddrPort, isLocal bool) (handled bool) {
+// forwardTCP forwards the TCP connection from clientRemoteIP to dstAddr to a
+// new connection to dialAddr.
+func (ns *Impl) forwardTCP(getClient func(...tcpip.SettableSocketOption) *gonet.TCPConn, clientRemoteIP netip.Addr, wq *waiter.Queue, dstAddr, dialAddr netip.AddrPort, isLocal bool) (handled bool) {
 	dialAddrStr := dialAddr.String()
 	if debugNetstack() {
 		ns.logf("[v2] netstack: forwarding incoming connection to %s", dialAddrStr)
@@ -1786,7 +1885,18 @@ func (ns *Impl) forwardTCP(getClient func(...tcpip.SettableSocketOption) *gonet.
 		}
 	}()
 	go func() {
-		_, err := io.Copy(client, backend)
+		var clientW io.Writer = client
+		var ftpReplies *ftpalg.ReplyWriter
+		if dstAddr.Port() == ftpalg.ControlPort && !netstackDisableFTPHelper() {
+			ftpReplies = ftpalg.NewReplyWriter(client, dstAddr.Addr(), func(port uint16) {
+				ns.ftpData.Add(clientRemoteIP, netip.AddrPortFrom(dstAddr.Addr(), port), netip.AddrPortFrom(dialAddr.Addr(), port))
+			})
+			clientW = ftpReplies
+		}
+		_, err := io.Copy(clientW, backend)
+		if ftpReplies != nil {
+			err = errors.Join(err, ftpReplies.Flush())
+		}
 		if err != nil {
 			err = fmt.Errorf("backend -> client: %w", err)
 		}
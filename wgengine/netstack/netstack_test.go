@@ -1743,3 +1743,99 @@ func TestInjectLoopback(t *testing.T) {
 		t.Errorf("got %q, want %q", got, "loopback test")
 	}
 }
+
+func TestTCPPortRangeListener(t *testing.T) {
+	impl := makeNetstack(t, func(impl *Impl) {
+		impl.ProcessSubnets = false
+		impl.ProcessLocalIPs = false
+		impl.atomicIsLocalIPFunc.Store(looksLikeATailscaleSelfAddress)
+	})
+	self := netip.MustParseAddr("100.101.102.104")
+	other := netip.MustParseAddr("192.0.2.1")
+
+	ln, err := impl.ListenTCPPortRange(netip.Addr{}, 50000, 50099)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ln.Addr().String(), ":50000-50099"; got != want {
+		t.Errorf("Addr = %q; want %q", got, want)
+	}
+	if _, err := impl.ListenTCPPortRange(self, 50099, 50200); err == nil {
+		t.Error("overlapping range: got no error")
+	}
+	if _, err := impl.ListenTCPPortRange(netip.Addr{}, 60001, 60000); err == nil {
+		t.Error("empty range: got no error")
+	}
+	ln2, err := impl.ListenTCPPortRange(other, 50000, 50099)
+	if err == nil {
+		t.Error("range at non-local address overlapping all-local range: got no error")
+		ln2.Close()
+	}
+
+	tests := []struct {
+		dst  netip.AddrPort
+		want bool
+	}{
+		{netip.AddrPortFrom(self, 50000), true},
+		{netip.AddrPortFrom(self, 50099), true},
+		{netip.AddrPortFrom(self, 50100), false},
+		{netip.AddrPortFrom(other, 50000), false},
+	}
+	client := netip.MustParseAddr("100.101.102.103")
+	for _, tt := range tests {
+		if got := impl.tcpPortRangeListenerFor(tt.dst) != nil; got != tt.want {
+			t.Errorf("listener for %v = %v; want %v", tt.dst, got, tt.want)
+		}
+		var p packet.Parsed
+		p.Decode(tcp4syn(t, client, tt.dst.Addr(), 1234, tt.dst.Port()))
+		if got := impl.shouldProcessInbound(&p, nil); got != tt.want {
+			t.Errorf("shouldProcessInbound to %v = %v; want %v", tt.dst, got, tt.want)
+		}
+	}
+
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if impl.tcpPortRangeListenerFor(netip.AddrPortFrom(self, 50000)) != nil {
+		t.Error("closed listener still matches")
+	}
+	if _, err := ln.Accept(); err == nil {
+		t.Error("Accept on closed listener: got no error")
+	}
+}
+
+func TestTCPForwardFTPDataExpectation(t *testing.T) {
+	impl := makeNetstack(t, func(impl *Impl) {
+		impl.ProcessSubnets = true
+	})
+	dialed := make(chan string, 1)
+	impl.forwardDialFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed <- address
+		return nil, fmt.Errorf("refusing dial in test")
+	}
+	prefs := ipn.NewPrefs()
+	prefs.AdvertiseRoutes = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	impl.lb.Start(ipn.Options{
+		UpdatePrefs: prefs,
+	})
+	impl.atomicIsLocalIPFunc.Store(looksLikeATailscaleSelfAddress)
+
+	// As if an FTP control connection to 192.0.2.1:21 was forwarded to
+	// 192.0.2.9:21 and the server announced data port 50000.
+	client := netip.MustParseAddr("100.101.102.103")
+	impl.ftpData.Add(client, netip.MustParseAddrPort("192.0.2.1:50000"), netip.MustParseAddrPort("192.0.2.9:50000"))
+
+	var parsed packet.Parsed
+	parsed.Decode(tcp4syn(t, client, netip.MustParseAddr("192.0.2.1"), 1234, 50000))
+	if resp, _ := impl.injectInbound(&parsed, impl.tundev, nil); resp != filter.DropSilently {
+		t.Fatalf("got filter outcome %v, want filter.DropSilently", resp)
+	}
+	select {
+	case got := <-dialed:
+		if want := "192.0.2.9:50000"; got != want {
+			t.Errorf("dialed %q; want %q", got, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for dial")
+	}
+}
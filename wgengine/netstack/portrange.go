@@ -0,0 +1,128 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netstack
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+)
+
+// tcpPortRangeListener is a listener from [Impl.ListenTCPPortRange].
+type tcpPortRangeListener struct {
+	ns          *Impl
+	addr        netip.Addr // or the zero value for all local IPs
+	first, last uint16
+
+	conns     chan net.Conn // unbuffered, never closed
+	closed    chan struct{} // closed on Close
+	closeOnce sync.Once
+}
+
+// ListenTCPPortRange returns a listener for incoming TCP connections to the
+// ports first through last (inclusive) at addr, or at any of the local
+// Tailscale IPs if addr is the zero value. It's for protocols like passive
+// FTP and SIP that negotiate additional ports from a range at runtime.
+//
+// The accepted connections' LocalAddr reports the port connected to. The
+// ranges of different listeners at the same addresses must not overlap.
+// Connections to ports that are handled by the LocalBackend, such as its
+// peerapi and serve ports, are not delivered to the listener.
+func (ns *Impl) ListenTCPPortRange(addr netip.Addr, first, last uint16) (net.Listener, error) {
+	if first == 0 || last < first {
+		return nil, fmt.Errorf("netstack: invalid port range %d-%d", first, last)
+	}
+	addr = addr.Unmap()
+	ln := &tcpPortRangeListener{
+		ns:     ns,
+		addr:   addr,
+		first:  first,
+		last:   last,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	lns := ns.atomicTCPPortRanges.Load()
+	for _, o := range lns {
+		if (o.addr == addr || !o.addr.IsValid() || !addr.IsValid()) && first <= o.last && o.first <= last {
+			return nil, fmt.Errorf("netstack: port range %d-%d overlaps listened range %d-%d", first, last, o.first, o.last)
+		}
+	}
+	ns.atomicTCPPortRanges.Store(append(slices.Clip(lns), ln))
+	return ln, nil
+}
+
+// tcpPortRangeListenerFor returns the listener from ListenTCPPortRange for
+// dst, or nil if there's none.
+func (ns *Impl) tcpPortRangeListenerFor(dst netip.AddrPort) *tcpPortRangeListener {
+	ip := dst.Addr().Unmap()
+	for _, ln := range ns.atomicTCPPortRanges.Load() {
+		if dst.Port() < ln.first || dst.Port() > ln.last {
+			continue
+		}
+		if ln.addr == ip || (!ln.addr.IsValid() && ns.isLocalIP(ip)) {
+			return ln
+		}
+	}
+	return nil
+}
+
+func (ln *tcpPortRangeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-ln.conns:
+		return c, nil
+	case <-ln.closed:
+		return nil, fmt.Errorf("netstack: %w", net.ErrClosed)
+	}
+}
+
+func (ln *tcpPortRangeListener) Addr() net.Addr {
+	return tcpPortRangeAddr{ln.addr, ln.first, ln.last}
+}
+
+func (ln *tcpPortRangeListener) Close() error {
+	err := fmt.Errorf("netstack: %w", net.ErrClosed)
+	ln.closeOnce.Do(func() {
+		err = nil
+		close(ln.closed)
+		ns := ln.ns
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		ns.atomicTCPPortRanges.Store(slices.DeleteFunc(slices.Clone(ns.atomicTCPPortRanges.Load()), func(o *tcpPortRangeListener) bool {
+			return o == ln
+		}))
+	})
+	return err
+}
+
+// handle passes c to a pending Accept, or closes it if ln is closed first.
+func (ln *tcpPortRangeListener) handle(c net.Conn) {
+	select {
+	case ln.conns <- c:
+	case <-ln.closed:
+		c.Close()
+	case <-ln.ns.ctx.Done():
+		c.Close()
+	}
+}
+
+// tcpPortRangeAddr is the net.Addr of a tcpPortRangeListener.
+type tcpPortRangeAddr struct {
+	ip          netip.Addr
+	first, last uint16
+}
+
+func (a tcpPortRangeAddr) Network() string { return "tcp" }
+
+func (a tcpPortRangeAddr) String() string {
+	ports := fmt.Sprintf("%d-%d", a.first, a.last)
+	if !a.ip.IsValid() {
+		return ":" + ports
+	}
+	return net.JoinHostPort(a.ip.String(), ports)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgengine
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+	"tailscale.com/util/clientmetric"
+	"tailscale.com/util/set"
+	"tailscale.com/wgengine/wgcfg"
+	"tailscale.com/wgengine/wgint"
+)
+
+// peerIdleSweepInterval is how often the sessions of peers are checked
+// against the engine's [wgcfg.PeerIdleConfig].
+const peerIdleSweepInterval = 30 * time.Second
+
+var metricPeerIdleTornDown = clientmetric.NewCounter("wgengine_peer_idle_torn_down")
+
+// peerActivity is what the engine last saw of a peer's traffic.
+type peerActivity struct {
+	rx, tx uint64    // bytes received from and sent to the peer
+	at     mono.Time // when rx or tx was first seen at their current values
+}
+
+// updatePeerIdleLocked starts or stops the periodic sweep of the sessions of
+// idle peers, according to e.lastCfgFull.PeerIdle.
+//
+// e.wgLock must be held.
+func (e *userspaceEngine) updatePeerIdleLocked() {
+	pi := e.lastCfgFull.PeerIdle
+	if pi.Timeout == 0 && pi.MaxActive == 0 {
+		if e.peerIdleTimer != nil {
+			e.peerIdleTimer.Stop()
+			e.peerIdleTimer = nil
+		}
+		e.peerActivity = nil
+		return
+	}
+	if e.peerIdleTimer == nil {
+		e.peerIdleTimer = time.AfterFunc(peerIdleSweepInterval, e.sweepIdlePeers)
+	}
+}
+
+// sweepIdlePeers is the callback of e.peerIdleTimer.
+func (e *userspaceEngine) sweepIdlePeers() {
+	e.wgLock.Lock()
+	defer e.wgLock.Unlock()
+	if e.peerIdleTimer == nil {
+		// Stopped while we waited for the lock.
+		return
+	}
+	e.sweepIdlePeersLocked(e.timeNow())
+	e.peerIdleTimer.Reset(peerIdleSweepInterval)
+}
+
+// sweepIdlePeersLocked updates e.peerActivity from the traffic counters of
+// the peers with sessions in wireguard-go, and tears down the sessions that
+// e.lastCfgFull.PeerIdle says to. They're re-created on demand by the
+// PeerLookupFunc installed by [wgcfg.ReconfigDevice].
+//
+// e.wgLock must be held.
+func (e *userspaceEngine) sweepIdlePeersLocked(now mono.Time) {
+	active := make(map[key.NodePublic]peerActivity)
+	for _, p := range e.lastCfgFull.Peers {
+		peer, ok := e.wgdev.LookupActivePeer(p.PublicKey.Raw32())
+		if !ok {
+			continue
+		}
+		wp := wgint.PeerOf(peer)
+		rx, tx := wp.RxBytes(), wp.TxBytes()
+		a, ok := e.peerActivity[p.PublicKey]
+		if !ok || a.rx != rx || a.tx != tx {
+			a = peerActivity{rx: rx, tx: tx, at: now}
+		}
+		active[p.PublicKey] = a
+	}
+	e.peerActivity = active
+
+	down := peersToTearDown(e.lastCfgFull.PeerIdle, active, now)
+	if len(down) == 0 {
+		return
+	}
+	for _, k := range down {
+		e.wgdev.RemovePeer(k.Raw32())
+		delete(e.peerActivity, k)
+	}
+	metricPeerIdleTornDown.Add(int64(len(down)))
+	e.logf("wgengine: tore down sessions of %d idle peers; %d remain", len(down), len(e.peerActivity))
+}
+
+// peersToTearDown returns the peers in active whose sessions pi says to tear
+// down at now: those idle for at least pi.Timeout, and then the least recently
+// active ones beyond pi.MaxActive. Peers in pi.AlwaysOn are never returned.
+func peersToTearDown(pi wgcfg.PeerIdleConfig, active map[key.NodePublic]peerActivity, now mono.Time) []key.NodePublic {
+	alwaysOn := set.SetOf(pi.AlwaysOn)
+	var down, rest []key.NodePublic
+	for k, a := range active {
+		switch {
+		case alwaysOn.Contains(k):
+		case pi.Timeout > 0 && now.Sub(a.at) >= pi.Timeout:
+			down = append(down, k)
+		default:
+			rest = append(rest, k)
+		}
+	}
+	if pi.MaxActive > 0 {
+		if over := len(active) - len(down) - pi.MaxActive; over > 0 {
+			slices.SortFunc(rest, func(a, b key.NodePublic) int {
+				if c := cmp.Compare(active[a].at, active[b].at); c != 0 {
+					return c
+				}
+				if a.Less(b) {
+					return -1
+				}
+				return 1
+			})
+			down = append(down, rest[:min(over, len(rest))]...)
+		}
+	}
+	return down
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Tailscale Inc & contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgengine
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+	"tailscale.com/wgengine/wgcfg"
+)
+
+func TestPeersToTearDown(t *testing.T) {
+	now := mono.Time(int64(time.Hour))
+	k := make([]key.NodePublic, 4)
+	for i := range k {
+		k[i] = key.NewNode().Public()
+	}
+	// k[0] is the most recently active, k[3] the least.
+	active := map[key.NodePublic]peerActivity{
+		k[0]: {at: now},
+		k[1]: {at: now.Add(-2 * time.Minute)},
+		k[2]: {at: now.Add(-5 * time.Minute)},
+		k[3]: {at: now.Add(-10 * time.Minute)},
+	}
+
+	tests := []struct {
+		name string
+		pi   wgcfg.PeerIdleConfig
+		want []key.NodePublic
+	}{
+		{
+			name: "zero",
+		},
+		{
+			name: "timeout",
+			pi:   wgcfg.PeerIdleConfig{Timeout: 5 * time.Minute},
+			want: []key.NodePublic{k[2], k[3]},
+		},
+		{
+			name: "timeout-always-on",
+			pi:   wgcfg.PeerIdleConfig{Timeout: 5 * time.Minute, AlwaysOn: []key.NodePublic{k[3]}},
+			want: []key.NodePublic{k[2]},
+		},
+		{
+			name: "max-active",
+			pi:   wgcfg.PeerIdleConfig{MaxActive: 2},
+			want: []key.NodePublic{k[3], k[2]},
+		},
+		{
+			name: "max-active-not-exceeded",
+			pi:   wgcfg.PeerIdleConfig{MaxActive: 4},
+		},
+		{
+			name: "max-active-always-on",
+			pi:   wgcfg.PeerIdleConfig{MaxActive: 2, AlwaysOn: []key.NodePublic{k[3]}},
+			want: []key.NodePublic{k[2], k[1]},
+		},
+		{
+			name: "max-active-all-always-on",
+			pi:   wgcfg.PeerIdleConfig{MaxActive: 1, AlwaysOn: k},
+		},
+		{
+			name: "timeout-and-max-active",
+			pi:   wgcfg.PeerIdleConfig{Timeout: 10 * time.Minute, MaxActive: 1},
+			want: []key.NodePublic{k[3], k[2], k[1]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := peersToTearDown(tt.pi, active, now)
+			// Order only matters among the peers torn down for MaxActive,
+			// which come last; the ones torn down for Timeout come in map
+			// order.
+			if tt.pi.MaxActive == 0 {
+				slices.SortFunc(got, func(a, b key.NodePublic) int {
+					return slices.Index(k, a) - slices.Index(k, b)
+				})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
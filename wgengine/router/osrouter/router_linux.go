@@ -12,6 +12,7 @@
 	"net/netip"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -33,13 +34,14 @@
 	"tailscale.com/types/preftype"
 	"tailscale.com/util/eventbus"
 	"tailscale.com/util/linuxfw"
+	"tailscale.com/util/usermetric"
 	"tailscale.com/version/distro"
 	"tailscale.com/wgengine/router"
 )
 
 func init() {
 	router.HookNewUserspaceRouter.Set(func(opts router.NewOpts) (router.Router, error) {
-		return newUserspaceRouter(opts.Logf, opts.Tun, opts.NetMon, opts.Health, opts.Bus)
+		return newUserspaceRouter(opts.Logf, opts.Tun, opts.NetMon, opts.Health, opts.Bus, opts.Metrics)
 	})
 	router.HookCleanUp.Set(func(logf logger.Logf, netMon *netmon.Monitor, ifName string) {
 		cleanUp(logf, ifName)
@@ -76,9 +78,22 @@ type linuxRouter struct {
 
 	// ipPolicyPrefBase is the base priority at which ip rules are installed.
 	ipPolicyPrefBase int
+	// defaultIPPolicyPrefBase is ipPolicyPrefBase for the default policy
+	// routing.
+	defaultIPPolicyPrefBase int
 
-	cmd commandRunner
-	nfr linuxfw.NetfilterRunner
+	// table is the routing table for Tailscale routes. It's
+	// tailscaleRouteTable unless policyRouting says otherwise or the TUN
+	// interface is in a VRF.
+	table RouteTable
+
+	// tunVRF is the VRF that the TUN interface is enslaved to, from
+	// netmon.VRFConfig.TUN, or the zero value for the default VRF.
+	tunVRF netmon.VRF
+
+	cmd       commandRunner
+	nfr       linuxfw.NetfilterRunner
+	fwMetrics *linuxfw.Metrics // or nil if the router has no metrics registry
 
 	mu                sync.Mutex
 	addrs             map[netip.Prefix]bool
@@ -87,14 +102,30 @@ type linuxRouter struct {
 	snatSubnetRoutes  bool
 	statefulFiltering bool
 	connmarkEnabled   bool // whether connmark rules are currently enabled
+	excludeApps       []string
+	requireTunnelApps []string
+	appRulesSet       bool // whether per-app rules are installed and up to date
 	netfilterMode     preftype.NetfilterMode
 	netfilterKind     string
 	cgnatMode         linuxfw.CGNATMode
 	magicsockPortV4   uint16
 	magicsockPortV6   uint16
-}
 
-func newUserspaceRouter(logf logger.Logf, tunDev tun.Device, netMon *netmon.Monitor, health *health.Tracker, bus *eventbus.Bus) (router.Router, error) {
+	// defaultPolicyRouting is the policy routing used when the Config
+	// leaves it zero, from TS_POLICY_ROUTING_INSTANCE.
+	defaultPolicyRouting router.PolicyRouting
+	// policyRouting is the policy routing of the last Set, from which
+	// table and ipPolicyPrefBase derive.
+	policyRouting router.PolicyRouting
+	// ipRulesAdded is whether the ip rules of policyRouting have been
+	// added, which the first Set does.
+	ipRulesAdded bool
+	// loggedNetfilterOff is whether we've logged that the requested
+	// netfilter mode is ignored for non-default policy routing.
+	loggedNetfilterOff bool
+}
+
+func newUserspaceRouter(logf logger.Logf, tunDev tun.Device, netMon *netmon.Monitor, health *health.Tracker, bus *eventbus.Bus, reg *usermetric.Registry) (router.Router, error) {
 	tunname, err := tunDev.Name()
 	if err != nil {
 		return nil, err
@@ -104,21 +135,27 @@ func newUserspaceRouter(logf logger.Logf, tunDev tun.Device, netMon *netmon.Moni
 		ambientCapNetAdmin: useAmbientCaps(),
 	}
 
-	return newUserspaceRouterAdvanced(logf, tunname, netMon, cmd, health, bus)
+	var fwMetrics *linuxfw.Metrics
+	if reg != nil {
+		fwMetrics = linuxfw.NewMetrics(reg)
+	}
+	return newUserspaceRouterAdvanced(logf, tunname, netMon, cmd, health, bus, fwMetrics)
 }
 
-func newUserspaceRouterAdvanced(logf logger.Logf, tunname string, netMon *netmon.Monitor, cmd commandRunner, health *health.Tracker, bus *eventbus.Bus) (router.Router, error) {
+func newUserspaceRouterAdvanced(logf logger.Logf, tunname string, netMon *netmon.Monitor, cmd commandRunner, health *health.Tracker, bus *eventbus.Bus, fwMetrics *linuxfw.Metrics) (router.Router, error) {
 	r := &linuxRouter{
 		logf:          logf,
 		tunname:       tunname,
 		netfilterMode: netfilterOff,
 		netMon:        netMon,
 		health:        health,
+		fwMetrics:     fwMetrics,
 
 		cmd: cmd,
 
 		ipRuleFixLimiter: rate.NewLimiter(rate.Every(5*time.Second), 10),
 		ipPolicyPrefBase: 5200,
+		table:            tailscaleRouteTable,
 	}
 	ec := bus.Client("router-linux")
 	r.rulesAddedPub = eventbus.Publish[AddIPRules](ec)
@@ -168,6 +205,33 @@ func newUserspaceRouterAdvanced(logf logger.Logf, tunname string, netMon *netmon
 		r.logf("mwan3 on openWRT detected, switching policy base priority to 1300")
 	}
 
+	r.defaultIPPolicyPrefBase = r.ipPolicyPrefBase
+
+	if n := policyRoutingInstance(); n != 0 {
+		pr, err := router.PolicyRoutingInstance(n)
+		if err != nil {
+			return nil, fmt.Errorf("TS_POLICY_ROUTING_INSTANCE: %w", err)
+		}
+		r.defaultPolicyRouting = pr
+		r.policyRouting = pr
+	}
+
+	if vc := netmon.GetVRFConfig(); vc.TUN != "" {
+		if vc.TUN == vc.Physical {
+			return nil, fmt.Errorf("TUN VRF %q is also the physical VRF", vc.TUN)
+		}
+		vrf, err := netmon.LinuxVRFByName(vc.TUN)
+		if err != nil {
+			return nil, fmt.Errorf("TUN VRF: %w", err)
+		}
+		// The VRF's own policy routing rule sends the traffic of its
+		// interfaces to its routing table, so Tailscale's routes go
+		// straight in there, and Tailscale's ip rules aren't needed.
+		r.tunVRF = vrf
+		r.table = RouteTable{Name: strconv.FormatUint(uint64(vrf.Table), 10), Num: int(vrf.Table)}
+		r.logf("TUN VRF %s: using its routing table %d", vrf.Name, vrf.Table)
+	}
+
 	r.v6Available = linuxfw.CheckIPv6(r.logf) == nil
 
 	r.fixupWSLMTU()
@@ -264,6 +328,14 @@ func useAmbientCaps() bool {
 
 var forceIPCommand = envknob.RegisterBool("TS_DEBUG_USE_IP_COMMAND")
 
+// policyRoutingInstance is the policy routing instance number of this
+// tailscaled, which lets more than one tailscaled (each with its own TUN
+// device, state and tailnet) run concurrently on the same machine.
+//
+// It selects the policy routing that [router.PolicyRoutingInstance] returns
+// for it, which is used unless the [router.Config] sets its own.
+var policyRoutingInstance = envknob.RegisterInt("TS_POLICY_ROUTING_INSTANCE")
+
 // useIPCommand reports whether r should use the "ip" command (or its
 // fake commandRunner for tests) instead of netlink.
 func (r *linuxRouter) useIPCommand() bool {
@@ -324,7 +396,10 @@ type AddIPRules struct{
 // about the priority number. We could just do this in response to any netlink
 // change. Filtering by known priority ranges cuts back on some logspam.
 func (r *linuxRouter) onIPRuleDeleted(table uint8, priority uint32) {
-	if int(priority) < r.ipPolicyPrefBase || int(priority) >= (r.ipPolicyPrefBase+100) {
+	r.mu.Lock()
+	base, added := r.ipPolicyPrefBase, r.ipRulesAdded
+	r.mu.Unlock()
+	if !added || int(priority) < base || int(priority) >= (base+100) {
 		// Not our rule.
 		return
 	}
@@ -342,6 +417,11 @@ func (r *linuxRouter) onIPRuleDeleted(table uint8, priority uint32) {
 
 	time.AfterFunc(rr.Delay()+250*time.Millisecond, func() {
 		if r.ruleRestorePending.Swap(false) && !r.closed.Load() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if !r.ipRulesAdded {
+				return
+			}
 			r.logf("somebody (likely systemd-networkd) deleted ip rules; restoring Tailscale's")
 			r.justAddIPRules()
 		}
@@ -354,8 +434,10 @@ func (r *linuxRouter) Up() error {
 	if err := r.setNetfilterModeLocked(netfilterOff); err != nil {
 		return fmt.Errorf("setting netfilter mode: %w", err)
 	}
-	if err := r.addIPRules(); err != nil {
-		return fmt.Errorf("adding IP rules: %w", err)
+	// The ip rules are added by the first Set, once the policy routing
+	// to use is known.
+	if err := r.setTUNVRF(); err != nil {
+		return fmt.Errorf("enslaving interface to VRF: %w", err)
 	}
 	if err := r.upInterface(); err != nil {
 		return fmt.Errorf("bringing interface up: %w", err)
@@ -377,12 +459,16 @@ func (r *linuxRouter) Close() error {
 	if err := r.nfr.DelConnmarkSaveRule(); err != nil {
 		r.logf("warning: failed to delete connmark rules: %v", err)
 	}
+	r.delAppRulesLocked()
 
 	if err := r.downInterface(); err != nil {
 		return err
 	}
-	if err := r.delIPRules(); err != nil {
-		return err
+	if r.ipRulesAdded {
+		if err := r.delIPRules(); err != nil {
+			return err
+		}
+		r.ipRulesAdded = false
 	}
 	if err := r.setNetfilterModeLocked(netfilterOff); err != nil {
 		return err
@@ -404,11 +490,11 @@ func (r *linuxRouter) Close() error {
 func (r *linuxRouter) setupNetfilterLocked(kind string) error {
 	r.netfilterKind = kind
 
-	var err error
-	r.nfr, err = linuxfw.New(r.logf, r.netfilterKind)
+	nfr, err := linuxfw.New(r.logf, r.netfilterKind)
 	if err != nil {
 		return fmt.Errorf("could not create new netfilter: %w", err)
 	}
+	r.nfr = linuxfw.Instrument(nfr, r.fwMetrics)
 
 	return nil
 }
@@ -418,8 +504,28 @@ func (r *linuxRouter) Set(cfg *router.Config) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	var errs []error
+	pr := r.policyRouting
 	if cfg == nil {
 		cfg = &shutdownConfig
+	} else {
+		pr = cfg.PolicyRouting
+		if pr.IsZero() {
+			pr = r.defaultPolicyRouting
+		}
+	}
+	if err := r.setPolicyRoutingLocked(pr); err != nil {
+		errs = append(errs, err)
+	}
+	if !r.policyRouting.IsZero() && cfg.NetfilterMode != netfilterOff {
+		// Netfilter chains are shared by all tailscaleds on the
+		// machine; leave them to the one with the default policy
+		// routing.
+		if !r.loggedNetfilterOff {
+			r.logf("ignoring netfilter mode %v with non-default policy routing; the tailscaled with the default manages netfilter", cfg.NetfilterMode)
+			r.loggedNetfilterOff = true
+		}
+		cfg = cfg.Clone()
+		cfg.NetfilterMode = netfilterOff
 	}
 
 	if cfg.NetfilterKind != r.netfilterKind {
@@ -524,6 +630,8 @@ func (r *linuxRouter) Set(cfg *router.Config) error {
 		r.connmarkEnabled = false
 	}
 
+	r.setAppRulesLocked(cfg, netfilterOn)
+
 	// Issue 11405: enable IP forwarding on gokrazy.
 	advertisingRoutes := len(cfg.SubnetRoutes) > 0
 	if getDistroFunc() == distro.Gokrazy && advertisingRoutes {
@@ -547,6 +655,51 @@ func (r *linuxRouter) Set(cfg *router.Config) error {
 	return errors.Join(errs...)
 }
 
+// setAppRulesLocked installs, updates or removes the per-app routing rules
+// for cfg.ExcludeApps and cfg.RequireTunnelApps. The rules need netfilter,
+// so they're only installed when netfilterOn is true.
+//
+// The rules can only match cgroups that exist, so if some were missing,
+// they're retried on each Set until they've all been added.
+// [linuxRouter.mu] must be held.
+func (r *linuxRouter) setAppRulesLocked(cfg *router.Config, netfilterOn bool) {
+	want := netfilterOn && (len(cfg.ExcludeApps) > 0 || len(cfg.RequireTunnelApps) > 0)
+	if !want {
+		r.delAppRulesLocked()
+		return
+	}
+	if r.appRulesSet &&
+		slices.Equal(cfg.ExcludeApps, r.excludeApps) &&
+		slices.Equal(cfg.RequireTunnelApps, r.requireTunnelApps) {
+		return
+	}
+	r.excludeApps = slices.Clone(cfg.ExcludeApps)
+	r.requireTunnelApps = slices.Clone(cfg.RequireTunnelApps)
+	if err := r.nfr.SetAppRules(r.tunname, r.excludeApps, r.requireTunnelApps); err != nil {
+		// Errors are only logged: a cgroup that doesn't exist yet
+		// (say, an app that isn't running) shouldn't fail the whole
+		// router config.
+		r.logf("warning: setting per-app routing rules: %v", err)
+		r.appRulesSet = false
+		return
+	}
+	r.appRulesSet = true
+}
+
+// delAppRulesLocked removes the per-app routing rules, if any.
+// [linuxRouter.mu] must be held.
+func (r *linuxRouter) delAppRulesLocked() {
+	if r.excludeApps == nil && r.requireTunnelApps == nil {
+		return
+	}
+	if err := r.nfr.DelAppRules(); err != nil {
+		r.logf("warning: failed to delete per-app routing rules: %v", err)
+	}
+	r.excludeApps = nil
+	r.requireTunnelApps = nil
+	r.appRulesSet = false
+}
+
 // setCGNATDropModeLocked clears old rules and add new rules for the desired
 // behavior for incoming non-Tailscale CGNAT packets.
 // [linuxRouter.mu] must be held.
@@ -971,7 +1124,7 @@ func (r *linuxRouter) addThrowRoute(cidr netip.Prefix) error {
 	}
 	err := netlink.RouteReplace(&netlink.Route{
 		Dst:   netipx.PrefixIPNet(cidr.Masked()),
-		Table: tailscaleRouteTable.Num,
+		Table: r.table.Num,
 		Type:  unix.RTN_THROW,
 	})
 	if err != nil {
@@ -986,7 +1139,7 @@ func (r *linuxRouter) addRouteDef(routeDef []string, cidr netip.Prefix) error {
 	}
 	args := append([]string{"ip", "route", "add"}, routeDef...)
 	if r.ipRuleAvailable {
-		args = append(args, "table", tailscaleRouteTable.ipCmdArg())
+		args = append(args, "table", r.table.ipCmdArg())
 	}
 	err := r.cmd.run(args...)
 	if err == nil {
@@ -1067,7 +1220,7 @@ func (r *linuxRouter) delRouteDef(routeDef []string, cidr netip.Prefix) error {
 	}
 	args := append([]string{"ip", "route", "del"}, routeDef...)
 	if r.ipRuleAvailable {
-		args = append(args, "table", tailscaleRouteTable.ipCmdArg())
+		args = append(args, "table", r.table.ipCmdArg())
 	}
 	err := r.cmd.run(args...)
 	if err != nil {
@@ -1094,7 +1247,7 @@ func dashFam(ip netip.Addr) string {
 func (r *linuxRouter) hasRoute(routeDef []string, cidr netip.Prefix) (bool, error) {
 	args := append([]string{"ip", dashFam(cidr.Addr()), "route", "show"}, routeDef...)
 	if r.ipRuleAvailable {
-		args = append(args, "table", tailscaleRouteTable.ipCmdArg())
+		args = append(args, "table", r.table.ipCmdArg())
 	}
 	out, err := r.cmd.output(args...)
 	if err != nil {
@@ -1124,11 +1277,28 @@ func (r *linuxRouter) linkIndex() (int, error) {
 // routeTable returns the route table to use.
 func (r *linuxRouter) routeTable() int {
 	if r.ipRuleAvailable {
-		return tailscaleRouteTable.Num
+		return r.table.Num
 	}
 	return 0
 }
 
+// setTUNVRF enslaves the tunnel interface to r.tunVRF, if set. It must be
+// done before addresses are added to the interface, as enslaving it cycles
+// it down and up, which drops its IPv6 addresses.
+func (r *linuxRouter) setTUNVRF() error {
+	if r.tunVRF.Name == "" {
+		return nil
+	}
+	if r.useIPCommand() {
+		return r.cmd.run("ip", "link", "set", "dev", r.tunname, "master", r.tunVRF.Name)
+	}
+	link, err := r.link()
+	if err != nil {
+		return fmt.Errorf("enslaving interface to VRF, %w", err)
+	}
+	return netlink.LinkSetMasterByIndex(link, r.tunVRF.Index)
+}
+
 // upInterface brings up the tunnel interface.
 func (r *linuxRouter) upInterface() error {
 	if r.useIPCommand() {
@@ -1253,7 +1423,7 @@ func (r *linuxRouter) addrFamilies() []addrFamily {
 // routing loops. If the rule exists and appears to be a
 // tailscale-managed rule, it is gracefully replaced.
 func (r *linuxRouter) addIPRules() error {
-	if !r.ipRuleAvailable {
+	if !r.ipRuleAvailable || r.tunVRF.Name != "" {
 		return nil
 	}
 
@@ -1405,9 +1575,93 @@ func ipRules() []netlink.Rule {
 	return baseIPRules
 }
 
+// ipRules returns the ip rules from the package-level ipRules, adjusted
+// to point at r's routing table.
+func (r *linuxRouter) ipRules() []netlink.Rule {
+	rules := ipRules()
+	if r.table == tailscaleRouteTable {
+		return rules
+	}
+	rules = slices.Clone(rules)
+	for i := range rules {
+		if rules[i].Table == tailscaleRouteTable.Num {
+			rules[i].Table = r.table.Num
+		}
+	}
+	return rules
+}
+
+// setPolicyRoutingLocked makes pr r's policy routing, adding its ip rules
+// if none have been added yet, or else moving the ip rules, and routes, of
+// the previous policy routing to it. The caller then adds the routes back.
+func (r *linuxRouter) setPolicyRoutingLocked(pr router.PolicyRouting) error {
+	if r.ipRulesAdded && pr == r.policyRouting {
+		return nil
+	}
+	if err := r.checkPolicyRouting(pr); err != nil {
+		return err
+	}
+	if r.ipRulesAdded {
+		r.logf("policy routing changed from %+v to %+v", r.policyRouting, pr)
+		for cidr := range r.routes {
+			if err := r.delRoute(cidr); err != nil {
+				r.logf("deleting route %v: %v", cidr, err)
+			}
+		}
+		for cidr := range r.localRoutes {
+			if err := r.delThrowRoute(cidr); err != nil {
+				r.logf("deleting throw route %v: %v", cidr, err)
+			}
+		}
+		r.routes, r.localRoutes = nil, nil
+		if err := r.delIPRules(); err != nil {
+			return fmt.Errorf("deleting IP rules: %w", err)
+		}
+		r.ipRulesAdded = false
+	}
+
+	r.policyRouting = pr
+	if r.tunVRF.Name == "" {
+		r.table = tailscaleRouteTable
+		if pr.Table != 0 {
+			r.table = RouteTable{Name: strconv.Itoa(pr.Table), Num: pr.Table}
+		}
+	}
+	r.ipPolicyPrefBase = r.defaultIPPolicyPrefBase + pr.RulePriorityOffset
+	if !pr.IsZero() {
+		r.logf("policy routing: using routing table %d and ip rule priority base %d", r.table.Num, r.ipPolicyPrefBase)
+	}
+
+	if err := r.addIPRules(); err != nil {
+		return fmt.Errorf("adding IP rules: %w", err)
+	}
+	r.ipRulesAdded = true
+	return nil
+}
+
+// checkPolicyRouting returns an error if r can't use pr.
+func (r *linuxRouter) checkPolicyRouting(pr router.PolicyRouting) error {
+	if pr.Table < 0 || pr.Table >= defaultRouteTable.Num {
+		return fmt.Errorf("policy routing table %d out of range [1, %d]", pr.Table, defaultRouteTable.Num-1)
+	}
+	if base := r.defaultIPPolicyPrefBase + pr.RulePriorityOffset; base < 0 || base+100 > 32766 {
+		return fmt.Errorf("policy routing ip rule priorities from %d out of range", base)
+	}
+	return nil
+}
+
+// tableArg returns the "ip" command argument for the routing table num,
+// which must be r's table or a well-known one.
+func (r *linuxRouter) tableArg(num int) string {
+	if num == r.table.Num {
+		return r.table.ipCmdArg()
+	}
+	return mustRouteTable(num).ipCmdArg()
+}
+
 // justAddIPRules adds policy routing rule without deleting any first.
 func (r *linuxRouter) justAddIPRules() error {
-	if !r.ipRuleAvailable {
+	if !r.ipRuleAvailable || r.tunVRF.Name != "" {
 		return nil
 	}
 	if r.useIPCommand() {
@@ -1415,7 +1669,7 @@ func (r *linuxRouter) justAddIPRules() error {
 	}
 	var errAcc error
 	for _, family := range r.addrFamilies() {
-		for _, ru := range ipRules() {
+		for _, ru := range r.ipRules() {
 			// Note: r is a value type here; safe to mutate it.
 			ru.Family = family.netlinkInt()
 			if ru.Mark != 0 {
@@ -1444,7 +1698,7 @@ func (r *linuxRouter) addIPRulesWithIPCommand() error {
 	rg := newRunGroup(nil, r.cmd)
 
 	for _, family := range r.addrFamilies() {
-		for _, rule := range ipRules() {
+		for _, rule := range r.ipRules() {
 			args := []string{
 				"ip", family.dashArg(),
 				"rule", "add",
@@ -1458,7 +1712,7 @@ func (r *linuxRouter) addIPRulesWithIPCommand() error {
 				}
 			}
 			if rule.Table != 0 {
-				args = append(args, "table", mustRouteTable(rule.Table).ipCmdArg())
+				args = append(args, "table", r.tableArg(rule.Table))
 			}
 			if rule.Type == unix.RTN_UNREACHABLE {
 				args = append(args, "type", "unreachable")
@@ -1484,7 +1738,7 @@ func (r *linuxRouter) delRoutes() error {
 // delIPRules removes the policy routing rules that avoid
 // tailscaled routing loops, if it exists.
 func (r *linuxRouter) delIPRules() error {
-	if !r.ipRuleAvailable {
+	if !r.ipRuleAvailable || r.tunVRF.Name != "" {
 		return nil
 	}
 	if r.useIPCommand() {
@@ -1492,7 +1746,7 @@ func (r *linuxRouter) delIPRules() error {
 	}
 	var errAcc error
 	for _, family := range r.addrFamilies() {
-		for _, ru := range ipRules() {
+		for _, ru := range r.ipRules() {
 			// Note: r is a value type here; safe to mutate it.
 			// When deleting rules, we want to be a bit specific (mention which
 			// table we were routing to) but not *too* specific (fwmarks, etc).
@@ -1535,14 +1789,14 @@ func (r *linuxRouter) delIPRulesWithIPCommand() error {
 		// That leaves us some flexibility to change these values in later
 		// versions without having ongoing hacks for every possible
 		// combination.
-		for _, rule := range ipRules() {
+		for _, rule := range r.ipRules() {
 			args := []string{
 				"ip", family.dashArg(),
 				"rule", "del",
 				"pref", strconv.Itoa(rule.Priority + r.ipPolicyPrefBase),
 			}
 			if rule.Table != 0 {
-				args = append(args, "table", mustRouteTable(rule.Table).ipCmdArg())
+				args = append(args, "table", r.tableArg(rule.Table))
 			} else {
 				args = append(args, "type", "unreachable")
 			}
@@ -1688,7 +1942,7 @@ func platformCanNetfilter() bool {
 // The function calls cleanUp for both iptables and nftables since which ever
 // netfilter runner is used, the cleanUp function for the other one doesn't do anything.
 func cleanUp(logf logger.Logf, interfaceName string) {
-	if interfaceName != "userspace-networking" && platformCanNetfilter() {
+	if interfaceName != "userspace-networking" && platformCanNetfilter() && policyRoutingInstance() == 0 {
 		linuxfw.IPTablesCleanUp(logf)
 		linuxfw.NfTablesCleanUp(logf)
 	}
@@ -507,6 +507,49 @@ func TestRouterStates(t *testing.T) {
 v6/mangle/PREROUTING -m conntrack --ctstate ESTABLISHED,RELATED -j CONNMARK --restore-mark --nfmask 0xff0000 --ctmask 0xff0000
 v6/nat/POSTROUTING -j ts-postrouting
 v6/nat/ts-postrouting -m mark --mark 0x40000/0xff0000 -j MASQUERADE
+`,
+		},
+		{
+			name: "per-app-routing",
+			in: &Config{
+				LocalAddrs:        mustCIDRs("100.101.102.104/10"),
+				Routes:            mustCIDRs("100.100.100.100/32"),
+				NetfilterMode:     netfilterOn,
+				ExcludeApps:       []string{"/user.slice/app-a.scope"},
+				RequireTunnelApps: []string{"/user.slice/app-b.scope"},
+			},
+			want: `
+up
+ip addr add 100.101.102.104/10 dev tailscale0
+ip route add 100.100.100.100/32 dev tailscale0 table 52` + basic +
+				`v4/filter/FORWARD -j ts-forward
+v4/filter/INPUT -j ts-input
+v4/filter/ts-forward -i tailscale0 -j MARK --set-mark 0x40000/0xff0000
+v4/filter/ts-forward -m mark --mark 0x40000/0xff0000 -j ACCEPT
+v4/filter/ts-forward -o tailscale0 -s 100.64.0.0/10 -j DROP
+v4/filter/ts-forward -o tailscale0 -j ACCEPT
+v4/filter/ts-input -i lo -s 100.101.102.104 -j ACCEPT
+v4/filter/ts-input ! -i tailscale0 -s 100.115.92.0/23 -j RETURN
+v4/filter/ts-input ! -i tailscale0 -s 100.64.0.0/10 -j DROP
+v4/mangle/OUTPUT -j ts-apps
+v4/mangle/OUTPUT -m conntrack --ctstate NEW -m mark ! --mark 0x0/0xff0000 -j CONNMARK --save-mark --nfmask 0xff0000 --ctmask 0xff0000
+v4/mangle/PREROUTING -m conntrack --ctstate ESTABLISHED,RELATED -j CONNMARK --restore-mark --nfmask 0xff0000 --ctmask 0xff0000
+v4/mangle/ts-apps -m cgroup --path /user.slice/app-a.scope -j MARK --set-mark 0x80000/0xff0000
+v4/mangle/ts-apps -m cgroup --path /user.slice/app-b.scope -o lo -j RETURN
+v4/mangle/ts-apps -m cgroup --path /user.slice/app-b.scope ! -o tailscale0 -j DROP
+v4/nat/POSTROUTING -j ts-postrouting
+v6/filter/FORWARD -j ts-forward
+v6/filter/INPUT -j ts-input
+v6/filter/ts-forward -i tailscale0 -j MARK --set-mark 0x40000/0xff0000
+v6/filter/ts-forward -m mark --mark 0x40000/0xff0000 -j ACCEPT
+v6/filter/ts-forward -o tailscale0 -j ACCEPT
+v6/mangle/OUTPUT -j ts-apps
+v6/mangle/OUTPUT -m conntrack --ctstate NEW -m mark ! --mark 0x0/0xff0000 -j CONNMARK --save-mark --nfmask 0xff0000 --ctmask 0xff0000
+v6/mangle/PREROUTING -m conntrack --ctstate ESTABLISHED,RELATED -j CONNMARK --restore-mark --nfmask 0xff0000 --ctmask 0xff0000
+v6/mangle/ts-apps -m cgroup --path /user.slice/app-a.scope -j MARK --set-mark 0x80000/0xff0000
+v6/mangle/ts-apps -m cgroup --path /user.slice/app-b.scope -o lo -j RETURN
+v6/mangle/ts-apps -m cgroup --path /user.slice/app-b.scope ! -o tailscale0 -j DROP
+v6/nat/POSTROUTING -j ts-postrouting
 `,
 		},
 	}
@@ -522,7 +565,7 @@ func TestRouterStates(t *testing.T) {
 
 	fake := NewFakeOS(t)
 	ht := health.NewTracker(bus)
-	router, err := newUserspaceRouterAdvanced(t.Logf, "tailscale0", mon, fake, ht, bus)
+	router, err := newUserspaceRouterAdvanced(t.Logf, "tailscale0", mon, fake, ht, bus, nil)
 	router.(*linuxRouter).nfr = fake.nfr
 	if err != nil {
 		t.Fatalf("failed to create router: %v", err)
@@ -693,6 +736,10 @@ func (n *fakeIPTablesRunner) DNATNonTailscaleTraffic(exemptInterface string, dst
 	return errors.New("not implemented")
 }
 
+func (n *fakeIPTablesRunner) EnsureOutputDNATRule(origDst, dst netip.Addr) error {
+	return errors.New("not implemented")
+}
+
 func (n *fakeIPTablesRunner) EnsurePortMapRuleForSvc(svc, tun string, targetIP netip.Addr, pm linuxfw.PortMap) error {
 	return errors.New("not implemented")
 }
@@ -953,6 +1000,35 @@ func (n *fakeIPTablesRunner) DelConnmarkSaveRule() error {
 	return nil
 }
 
+func (n *fakeIPTablesRunner) SetAppRules(tunname string, excludeApps, requireTunnelApps []string) error {
+	for _, ipt := range []map[string][]string{n.ipt4, n.ipt6} {
+		var rules []string
+		for _, p := range excludeApps {
+			rules = append(rules, fmt.Sprintf("-m cgroup --path %s -j MARK --set-mark 0x80000/0xff0000", p))
+		}
+		for _, p := range requireTunnelApps {
+			rules = append(rules,
+				fmt.Sprintf("-m cgroup --path %s -o lo -j RETURN", p),
+				fmt.Sprintf("-m cgroup --path %s ! -o %s -j DROP", p, tunname))
+		}
+		if _, ok := ipt["mangle/ts-apps"]; !ok {
+			if err := insertRule(n, ipt, "mangle/OUTPUT", "-j ts-apps"); err != nil {
+				return err
+			}
+		}
+		ipt["mangle/ts-apps"] = rules
+	}
+	return nil
+}
+
+func (n *fakeIPTablesRunner) DelAppRules() error {
+	for _, ipt := range []map[string][]string{n.ipt4, n.ipt6} {
+		deleteRule(n, ipt, "mangle/OUTPUT", "-j ts-apps") // ignore errors
+		delete(ipt, "mangle/ts-apps")
+	}
+	return nil
+}
+
 func buildExternalCGNATRules(mode linuxfw.CGNATMode, tunname string) ([]iptRule, error) {
 	switch mode {
 	case linuxfw.CGNATModeDrop:
@@ -1066,6 +1142,16 @@ func (o *fakeOS) String() string {
 	return b.String()[:len(b.String())-1]
 }
 
+// withoutFwmark returns the ip rule r without its fwmark, which, like the
+// real "ip rule del", the fake's deletions needn't mention.
+func withoutFwmark(r string) string {
+	f := strings.Fields(r)
+	if i := slices.Index(f, "fwmark"); i >= 0 && i+1 < len(f) {
+		f = slices.Delete(f, i, i+2)
+	}
+	return strings.Join(f, " ")
+}
+
 func (o *fakeOS) run(args ...string) error {
 	unexpected := func() error {
 		o.t.Errorf("unexpected invocation %q", strings.Join(args, " "))
@@ -1124,7 +1210,7 @@ func (o *fakeOS) run(args ...string) error {
 	case "del":
 		found := false
 		for i, el := range *ls {
-			if el == rest {
+			if el == rest || ls == &o.rules && withoutFwmark(el) == rest {
 				found = true
 				*ls = append((*ls)[:i], (*ls)[i+1:]...)
 				break
@@ -1216,7 +1302,7 @@ func newLinuxRootTest(t *testing.T) (*linuxTest, *eventbus.Bus) {
 	mon.Start()
 	lt.mon = mon
 
-	r, err := newUserspaceRouter(logf, lt.tun, mon, nil, bus)
+	r, err := newUserspaceRouter(logf, lt.tun, mon, nil, bus, nil)
 	if err != nil {
 		lt.Close()
 		t.Fatal(err)
@@ -1511,6 +1597,217 @@ func TestIPRulesForUBNT(t *testing.T) {
 	}
 }
 
+func TestIPRulesForInstance(t *testing.T) {
+	r := &linuxRouter{table: RouteTable{Name: "tailscale2", Num: tailscaleRouteTable.Num + 2}}
+	rules := r.ipRules()
+	if len(rules) != len(ipRules()) {
+		t.Fatalf("got %d rules; want %d", len(rules), len(ipRules()))
+	}
+	var sawTable bool
+	for _, rule := range rules {
+		if rule.Table == tailscaleRouteTable.Num {
+			t.Errorf("rule %+v uses default table", rule)
+		}
+		if rule.Table == r.table.Num {
+			sawTable = true
+		}
+	}
+	if !sawTable {
+		t.Errorf("no rule uses table %d", r.table.Num)
+	}
+	if baseIPRules[len(baseIPRules)-1].Table != tailscaleRouteTable.Num {
+		t.Errorf("baseIPRules modified")
+	}
+	if got, want := r.tableArg(r.table.Num), "54"; got != want {
+		t.Errorf("tableArg = %q; want %q", got, want)
+	}
+	if got, want := r.tableArg(mainRouteTable.Num), "main"; got != want {
+		t.Errorf("tableArg(main) = %q; want %q", got, want)
+	}
+}
+
+func TestPolicyRouting(t *testing.T) {
+	bus := eventbustest.NewBus(t)
+	mon, err := netmon.New(bus, logger.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mon.Start()
+	defer mon.Close()
+
+	fake := NewFakeOS(t)
+	ht := health.NewTracker(bus)
+	r, err := newUserspaceRouterAdvanced(t.Logf, "tailscale0", mon, fake, ht, bus, nil)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+	r.(*linuxRouter).nfr = fake.nfr
+	if err := r.Up(); err != nil {
+		t.Fatalf("failed to up router: %v", err)
+	}
+	// Up leaves the ip rules to Set, for them to use its policy routing.
+	if got, want := fake.String(), "up"; got != want {
+		t.Fatalf("after Up, OS state = %q; want %q", got, want)
+	}
+
+	pr, err := router.PolicyRoutingInstance(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		LocalAddrs:    mustCIDRs("100.101.102.104/10"),
+		Routes:        mustCIDRs("100.100.100.100/32"),
+		NetfilterMode: netfilterOn,
+		PolicyRouting: pr,
+	}
+	if err := r.Set(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Netfilter is left to the tailscaled with the default policy routing.
+	want := `
+up
+ip addr add 100.101.102.104/10 dev tailscale0
+ip route add 100.100.100.100/32 dev tailscale0 table 53
+ip rule add -4 pref 5310 fwmark 0x80000/0xff0000 table main
+ip rule add -4 pref 5330 fwmark 0x80000/0xff0000 table default
+ip rule add -4 pref 5350 fwmark 0x80000/0xff0000 type unreachable
+ip rule add -4 pref 5370 table 53
+ip rule add -6 pref 5310 fwmark 0x80000/0xff0000 table main
+ip rule add -6 pref 5330 fwmark 0x80000/0xff0000 table default
+ip rule add -6 pref 5350 fwmark 0x80000/0xff0000 type unreachable
+ip rule add -6 pref 5370 table 53`
+	if diff := cmp.Diff(fake.String(), adjustFwmask(t, strings.TrimSpace(want))); diff != "" {
+		t.Fatalf("unexpected OS state (-got+want):\n%s", diff)
+	}
+
+	// Changing the policy routing moves the rules and routes.
+	cfg.PolicyRouting = router.PolicyRouting{Table: 60, RulePriorityOffset: 300}
+	cfg.NetfilterMode = netfilterOff
+	if err := r.Set(cfg); err != nil {
+		t.Fatal(err)
+	}
+	want = `
+up
+ip addr add 100.101.102.104/10 dev tailscale0
+ip route add 100.100.100.100/32 dev tailscale0 table 60
+ip rule add -4 pref 5510 fwmark 0x80000/0xff0000 table main
+ip rule add -4 pref 5530 fwmark 0x80000/0xff0000 table default
+ip rule add -4 pref 5550 fwmark 0x80000/0xff0000 type unreachable
+ip rule add -4 pref 5570 table 60
+ip rule add -6 pref 5510 fwmark 0x80000/0xff0000 table main
+ip rule add -6 pref 5530 fwmark 0x80000/0xff0000 table default
+ip rule add -6 pref 5550 fwmark 0x80000/0xff0000 type unreachable
+ip rule add -6 pref 5570 table 60`
+	if diff := cmp.Diff(fake.String(), adjustFwmask(t, strings.TrimSpace(want))); diff != "" {
+		t.Fatalf("unexpected OS state (-got+want):\n%s", diff)
+	}
+
+	// Set(nil) keeps the policy routing.
+	if err := r.Set(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.String(); !strings.Contains(got, "pref 5570 table 60") || strings.Contains(got, "ip route") {
+		t.Errorf("after Set(nil), unexpected OS state:\n%s", got)
+	}
+
+	for _, bad := range []router.PolicyRouting{
+		{Table: 254},
+		{RulePriorityOffset: 30000},
+	} {
+		if err := r.(*linuxRouter).checkPolicyRouting(bad); err == nil {
+			t.Errorf("checkPolicyRouting(%+v) = nil; want error", bad)
+		}
+	}
+}
+
+// TestDefaultPolicyRoutingRulesOnSet tests that with the default policy
+// routing, the ip rules that Up used to add are added by the Set(nil) that
+// wgengine makes right after Up, and removed by Close.
+func TestDefaultPolicyRoutingRulesOnSet(t *testing.T) {
+	bus := eventbustest.NewBus(t)
+	mon, err := netmon.New(bus, logger.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mon.Start()
+	defer mon.Close()
+
+	fake := NewFakeOS(t)
+	ht := health.NewTracker(bus)
+	r, err := newUserspaceRouterAdvanced(t.Logf, "tailscale0", mon, fake, ht, bus, nil)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+	r.(*linuxRouter).nfr = fake.nfr
+	if err := r.Up(); err != nil {
+		t.Fatalf("failed to up router: %v", err)
+	}
+	if err := r.Set(nil); err != nil {
+		t.Fatal(err)
+	}
+	want := `
+up
+ip rule add -4 pref 5210 fwmark 0x80000/0xff0000 table main
+ip rule add -4 pref 5230 fwmark 0x80000/0xff0000 table default
+ip rule add -4 pref 5250 fwmark 0x80000/0xff0000 type unreachable
+ip rule add -4 pref 5270 table 52
+ip rule add -6 pref 5210 fwmark 0x80000/0xff0000 table main
+ip rule add -6 pref 5230 fwmark 0x80000/0xff0000 table default
+ip rule add -6 pref 5250 fwmark 0x80000/0xff0000 type unreachable
+ip rule add -6 pref 5270 table 52`
+	if diff := cmp.Diff(fake.String(), adjustFwmask(t, strings.TrimSpace(want))); diff != "" {
+		t.Fatalf("unexpected OS state after Set(nil) (-got+want):\n%s", diff)
+	}
+
+	// A later empty Config, as when logged out, leaves the rules be.
+	if err := r.Set(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(fake.String(), adjustFwmask(t, strings.TrimSpace(want))); diff != "" {
+		t.Fatalf("unexpected OS state after empty Set (-got+want):\n%s", diff)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.String(), "down"; got != want {
+		t.Errorf("after Close, OS state = %q; want %q", got, want)
+	}
+}
+
+func TestPolicyRoutingInstanceEnv(t *testing.T) {
+	old := policyRoutingInstance
+	policyRoutingInstance = func() int { return 2 }
+	t.Cleanup(func() { policyRoutingInstance = old })
+
+	bus := eventbustest.NewBus(t)
+	mon, err := netmon.New(bus, logger.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mon.Start()
+	defer mon.Close()
+
+	fake := NewFakeOS(t)
+	ht := health.NewTracker(bus)
+	r, err := newUserspaceRouterAdvanced(t.Logf, "tailscale0", mon, fake, ht, bus, nil)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+	r.(*linuxRouter).nfr = fake.nfr
+	if err := r.Up(); err != nil {
+		t.Fatalf("failed to up router: %v", err)
+	}
+	// An empty Config, as sent when logged out, keeps the instance's
+	// policy routing.
+	if err := r.Set(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.String(); !strings.Contains(got, "ip rule add -4 pref 5470 table 54") {
+		t.Errorf("unexpected OS state:\n%s", got)
+	}
+}
+
 func TestUpdateMagicsockPortChange(t *testing.T) {
 	nfr := &fakeIPTablesRunner{
 		t:    t,
@@ -27,7 +27,9 @@
 	"tailscale.com/net/netmon"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/backoff"
+	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/eventbus"
+	"tailscale.com/util/winutil/gp"
 	"tailscale.com/wgengine/router"
 )
 
@@ -44,6 +46,13 @@ type winRouter struct {
 	nativeTun           *tun.NativeTun
 	routeChangeCallback *winipcfg.RouteChangeCallback
 	firewall            *firewallTweaker
+	gpWatcher           *gp.ChangeWatcher // or nil
+
+	// mu serializes Set with reapplying the last config after a group
+	// policy refresh.
+	mu      sync.Mutex
+	lastCfg *router.Config // +checklocks:mu
+	closed  bool           // +checklocks:mu
 }
 
 func newUserspaceRouter(logf logger.Logf, tundev tun.Device, netMon *netmon.Monitor, health *health.Tracker, bus *eventbus.Bus) (router.Router, error) {
@@ -77,6 +86,14 @@ func (r *winRouter) Up() error {
 		return fmt.Errorf("monitorDefaultRoutes, after %v: %v", d, err)
 	}
 	r.logf("monitorDefaultRoutes done after %v", d)
+
+	// A group policy refresh can reset our interface's addresses, routes
+	// and metrics, so reapply our config after each one. Failing to watch
+	// for refreshes isn't fatal.
+	r.gpWatcher, err = gp.NewChangeWatcher(gp.MachinePolicy, r.reapplyAfterGPRefresh)
+	if err != nil {
+		r.logf("watching for group policy refreshes: %v", err)
+	}
 	return nil
 }
 
@@ -91,6 +108,9 @@ func (r *winRouter) Set(cfg *router.Config) error {
 	}
 	r.firewall.set(localAddrs, cfg.Routes, cfg.LocalRoutes)
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastCfg = cfg.Clone()
 	err := configureInterface(cfg, r.nativeTun, r.health)
 	if err != nil {
 		r.logf("ConfigureInterface: %v", err)
@@ -105,6 +125,27 @@ func (r *winRouter) Set(cfg *router.Config) error {
 	return nil
 }
 
+// reapplyAfterGPRefresh reconfigures the interface with the last config
+// passed to Set. It's called after each machine group policy refresh.
+func (r *winRouter) reapplyAfterGPRefresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.lastCfg == nil {
+		return
+	}
+	metricGPRefreshReapply.Add(1)
+	r.logf("reapplying interface config after group policy refresh")
+	if err := configureInterface(r.lastCfg, r.nativeTun, r.health); err != nil {
+		metricGPRefreshReapplyError.Add(1)
+		r.logf("reapplying interface config after group policy refresh: %v", err)
+	}
+}
+
+var (
+	metricGPRefreshReapply      = clientmetric.NewCounter("router_windows_gp_refresh_reapply")
+	metricGPRefreshReapplyError = clientmetric.NewCounter("router_windows_gp_refresh_reapply_error")
+)
+
 func hasDefaultRoute(routes []netip.Prefix) bool {
 	for _, route := range routes {
 		if route.Bits() == 0 {
@@ -115,6 +156,13 @@ func hasDefaultRoute(routes []netip.Prefix) bool {
 }
 
 func (r *winRouter) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	if r.gpWatcher != nil {
+		r.gpWatcher.Close()
+	}
+
 	r.firewall.clear()
 
 	if r.routeChangeCallback != nil {
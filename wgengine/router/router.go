@@ -21,6 +21,7 @@
 	"tailscale.com/types/logger"
 	"tailscale.com/types/preftype"
 	"tailscale.com/util/eventbus"
+	"tailscale.com/util/usermetric"
 )
 
 // Router is responsible for managing the system network stack.
@@ -41,11 +42,12 @@ type Router interface {
 
 // NewOpts are the options passed to the NewUserspaceRouter hook.
 type NewOpts struct {
-	Logf   logger.Logf     // required
-	Tun    tun.Device      // required
-	NetMon *netmon.Monitor // optional
-	Health *health.Tracker // required (but TODO: support optional later)
-	Bus    *eventbus.Bus   // required
+	Logf    logger.Logf          // required
+	Tun     tun.Device           // required
+	NetMon  *netmon.Monitor      // optional
+	Health  *health.Tracker      // required (but TODO: support optional later)
+	Bus     *eventbus.Bus        // required
+	Metrics *usermetric.Registry // optional
 }
 
 // PortUpdate is an eventbus value, reporting the port and address family
@@ -67,18 +69,20 @@ type PortUpdate struct {
 // provided tun device.
 //
 // If netMon is nil, it's not used. It's currently (2021-07-20) only
-// used on Linux in some situations.
+// used on Linux in some situations. If metrics is non-nil, the router may
+// register user metrics with it.
 func New(logf logger.Logf, tundev tun.Device, netMon *netmon.Monitor,
-	health *health.Tracker, bus *eventbus.Bus,
+	health *health.Tracker, bus *eventbus.Bus, metrics *usermetric.Registry,
 ) (Router, error) {
 	logf = logger.WithPrefix(logf, "router: ")
 	if f, ok := HookNewUserspaceRouter.GetOk(); ok {
 		return f(NewOpts{
-			Logf:   logf,
-			Tun:    tundev,
-			NetMon: netMon,
-			Health: health,
-			Bus:    bus,
+			Logf:    logf,
+			Tun:     tundev,
+			NetMon:  netMon,
+			Health:  health,
+			Bus:     bus,
+			Metrics: metrics,
 		})
 	}
 	if !buildfeatures.HasOSRouter {
@@ -137,6 +141,59 @@ type Config struct {
 	NetfilterMode       preftype.NetfilterMode // how much to manage netfilter rules
 	NetfilterKind       string                 // what kind of netfilter to use ("nftables", "iptables", or "" to auto-detect)
 	RemoveCGNATDropRule bool                   // whether to remove the firewall rule to drop non-Tailscale inbound traffic from CGNAT IPs
+	ExcludeApps         []string               // cgroup v2 paths whose traffic bypasses Tailscale routes
+	RequireTunnelApps   []string               // cgroup v2 paths whose traffic may only use the Tailscale interface
+	PolicyRouting       PolicyRouting          // routing table and ip rule priorities to use; the zero value means the default
+}
+
+// PolicyRouting is the Linux policy routing of a tailscaled: the routing
+// table that it installs routes into and the priorities of the ip rules that
+// send traffic to it. Several tailscaleds, each with its own TUN interface,
+// can run on a machine at once if each has its own table and rule
+// priorities.
+//
+// All tailscaleds on a machine mark their own packets with the same bypass
+// fwmark, so each one's packets skip every table.
+//
+// The zero value is the default, which on Linux is the policy routing of
+// instance TS_POLICY_ROUTING_INSTANCE (see [PolicyRoutingInstance]).
+type PolicyRouting struct {
+	// Table is the number of the routing table. Zero means 52.
+	Table int
+
+	// RulePriorityOffset is added to the priorities of the ip rules,
+	// which take up 100 priorities from 5200 by default.
+	RulePriorityOffset int
+}
+
+// IsZero reports whether pr is the default policy routing.
+func (pr PolicyRouting) IsZero() bool {
+	return pr == PolicyRouting{}
+}
+
+// MaxPolicyRoutingInstance is the largest instance number that
+// [PolicyRoutingInstance] accepts.
+//
+// It keeps instances' routing tables below the reserved range from 253,
+// and their ip rules below the main table's at priority 32766.
+const MaxPolicyRoutingInstance = 15
+
+// PolicyRoutingInstance returns the policy routing of instance n of several
+// tailscaleds running on a machine at once, numbered from 0, whose policy
+// routing is the default.
+//
+// Instance n uses routing table 52+n and ip rule priorities offset by 100*n.
+func PolicyRoutingInstance(n int) (PolicyRouting, error) {
+	if n < 0 || n > MaxPolicyRoutingInstance {
+		return PolicyRouting{}, fmt.Errorf("policy routing instance %d out of range [0, %d]", n, MaxPolicyRoutingInstance)
+	}
+	if n == 0 {
+		return PolicyRouting{}, nil
+	}
+	return PolicyRouting{
+		Table:              52 + n,
+		RulePriorityOffset: 100 * n,
+	}, nil
 }
 
 func (a *Config) Equal(b *Config) bool {
@@ -158,5 +215,7 @@ func (c *Config) Clone() *Config {
 	c2.Routes = slices.Clone(c.Routes)
 	c2.LocalRoutes = slices.Clone(c.LocalRoutes)
 	c2.SubnetRoutes = slices.Clone(c.SubnetRoutes)
+	c2.ExcludeApps = slices.Clone(c.ExcludeApps)
+	c2.RequireTunnelApps = slices.Clone(c.RequireTunnelApps)
 	return &c2
 }
@@ -16,6 +16,7 @@ func TestConfigEqual(t *testing.T) {
 		"LocalAddrs", "Routes", "LocalRoutes", "NewMTU",
 		"SubnetRoutes", "SNATSubnetRoutes", "StatefulFiltering",
 		"NetfilterMode", "NetfilterKind", "RemoveCGNATDropRule",
+		"ExcludeApps", "RequireTunnelApps", "PolicyRouting",
 	}
 	configType := reflect.TypeFor[Config]()
 	configFields := []string{}
@@ -147,6 +148,26 @@ func TestConfigEqual(t *testing.T) {
 			&Config{NewMTU: 0},
 			false,
 		},
+		{
+			&Config{ExcludeApps: []string{"/a.scope"}},
+			&Config{ExcludeApps: []string{"/a.scope"}},
+			true,
+		},
+		{
+			&Config{ExcludeApps: []string{"/a.scope"}},
+			&Config{RequireTunnelApps: []string{"/a.scope"}},
+			false,
+		},
+		{
+			&Config{PolicyRouting: PolicyRouting{Table: 53}},
+			&Config{PolicyRouting: PolicyRouting{Table: 53}},
+			true,
+		},
+		{
+			&Config{PolicyRouting: PolicyRouting{Table: 53}},
+			&Config{},
+			false,
+		},
 	}
 	for i, tt := range tests {
 		got := tt.a.Equal(tt.b)
@@ -155,3 +176,27 @@ func TestConfigEqual(t *testing.T) {
 		}
 	}
 }
+
+func TestPolicyRoutingInstance(t *testing.T) {
+	tests := []struct {
+		n       int
+		want    PolicyRouting
+		wantErr bool
+	}{
+		{n: 0, want: PolicyRouting{}},
+		{n: 1, want: PolicyRouting{Table: 53, RulePriorityOffset: 100}},
+		{n: 15, want: PolicyRouting{Table: 67, RulePriorityOffset: 1500}},
+		{n: 16, wantErr: true},
+		{n: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := PolicyRoutingInstance(tt.n)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("PolicyRoutingInstance(%d) error = %v; want error %v", tt.n, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("PolicyRoutingInstance(%d) = %+v; want %+v", tt.n, got, tt.want)
+		}
+	}
+}
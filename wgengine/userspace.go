@@ -46,6 +46,7 @@
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
 	"tailscale.com/types/netmap"
+	"tailscale.com/types/nettype"
 	"tailscale.com/types/views"
 	"tailscale.com/util/backoff"
 	"tailscale.com/util/checkchange"
@@ -154,6 +155,13 @@ type userspaceEngine struct {
 	// wgLock must be held when using this map.
 	tsmpLearnedDisco map[key.NodePublic]key.DiscoPublic
 
+	// peerIdleTimer, if non-nil, runs the periodic sweep of the sessions
+	// of idle peers; see peeridle.go. peerActivity is what the sweep last
+	// saw of the traffic of each peer with a session.
+	// wgLock must be held when using these.
+	peerIdleTimer *time.Timer
+	peerActivity  map[key.NodePublic]peerActivity
+
 	// Lock ordering: magicsock.Conn.mu, wgLock, then mu.
 }
 
@@ -271,6 +279,15 @@ type Config struct {
 	// WireGuard. The pkt slice is borrowed and must be copied if
 	// the callee needs to retain it.
 	OnDERPRecv func(regionID int, src key.NodePublic, pkt []byte) (handled bool)
+
+	// SharedUDP, if non-nil, is the UDP sockets magicsock shares with the
+	// engines of other backends in the process, rather than binding its own.
+	SharedUDP *magicsock.SharedUDP
+
+	// TestOnlyPacketListener, if non-nil, is how magicsock creates its
+	// UDP sockets, such as on a [tailscale.com/tstest/natlab.Machine].
+	// Only used in tests.
+	TestOnlyPacketListener nettype.PacketListener
 }
 
 // NewFakeUserspaceEngine returns a new userspace engine for testing.
@@ -442,6 +459,9 @@ func NewUserspaceEngine(logf logger.Logf, conf Config) (_ Engine, reterr error)
 		PeerByKeyFunc:  e.PeerByKey,
 		ForceDiscoKey:  conf.ForceDiscoKey,
 		OnDERPRecv:     conf.OnDERPRecv,
+		SharedUDP:      conf.SharedUDP,
+
+		TestOnlyPacketListener: conf.TestOnlyPacketListener,
 	}
 	var err error
 	e.magicConn, err = magicsock.NewConn(magicsockOpts)
@@ -457,6 +477,7 @@ func NewUserspaceEngine(logf logger.Logf, conf Config) (_ Engine, reterr error)
 		e.tundev.PostFilterPacketInboundFromWireGuard = echoRespondToAll
 	}
 	e.tundev.PreFilterPacketOutboundToWireGuardEngineIntercept = e.handleLocalPackets
+	e.tundev.PeerPathMTU = e.peerPathMTU
 
 	if e.conn25PacketHooks != nil {
 		e.tundev.PreFilterPacketOutboundToWireGuardAppConnectorIntercept = func(p *packet.Parsed, _ *tstun.Wrapper) filter.Response {
@@ -737,6 +758,20 @@ func (e *userspaceEngine) SetPeerByIPPacketFunc(fn func(netip.Addr) (_ key.NodeP
 	})
 }
 
+// peerPathMTU returns the probed path MTU to the peer that routes dst, if
+// any. It's used by the tun wrapper to clamp outbound packets.
+func (e *userspaceEngine) peerPathMTU(dst netip.Addr) (tstun.TUNMTU, bool) {
+	rt := e.peerByIPRoute.Load()
+	if rt == nil {
+		return 0, false
+	}
+	pk, ok := rt.Lookup(dst)
+	if !ok {
+		return 0, false
+	}
+	return e.magicConn.PeerPathMTU(pk)
+}
+
 // hasOverlap checks if there is a IPPrefix which is common amongst the two
 // provided slices.
 func hasOverlap(aips, rips views.Slice[netip.Prefix]) bool {
@@ -926,6 +961,7 @@ func (e *userspaceEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config,
 	}
 
 	e.lastCfgFull = *cfg.Clone()
+	e.updatePeerIdleLocked()
 
 	e.magicConn.UpdatePeers(peerSet)
 	e.magicConn.SetPreferredPort(listenPort)
@@ -1188,6 +1224,13 @@ func (e *userspaceEngine) Close() {
 	e.closing = true
 	e.mu.Unlock()
 
+	e.wgLock.Lock()
+	if e.peerIdleTimer != nil {
+		e.peerIdleTimer.Stop()
+		e.peerIdleTimer = nil
+	}
+	e.wgLock.Unlock()
+
 	e.magicConn.Close()
 	if e.netMonOwned {
 		e.netMon.Close()
@@ -7,12 +7,13 @@
 import (
 	"net/netip"
 	"slices"
+	"time"
 
 	"tailscale.com/types/key"
 	"tailscale.com/types/logid"
 )
 
-//go:generate go run tailscale.com/cmd/cloner -type=Config,Peer
+//go:generate go run tailscale.com/cmd/cloner -type=Config,Peer,PeerIdleConfig
 
 // Config is a WireGuard configuration.
 // It only supports the set of things Tailscale uses.
@@ -31,6 +32,29 @@ type Config struct {
 		DomainID           logid.PrivateID
 		LogExitFlowEnabled bool
 	}
+
+	// PeerIdle is when to tear down the sessions of idle peers.
+	PeerIdle PeerIdleConfig
+}
+
+// PeerIdleConfig is when to tear down the WireGuard sessions of idle peers,
+// beyond wireguard-go's own removal of peers that haven't had a handshake in
+// several minutes. The zero value adds nothing to wireguard-go's behavior.
+type PeerIdleConfig struct {
+	Timeout   time.Duration    // if non-zero, tear down sessions idle this long
+	MaxActive int              // if non-zero, tear down the least recently active sessions beyond this many
+	AlwaysOn  []key.NodePublic // peers never torn down for Timeout or MaxActive
+}
+
+func (c PeerIdleConfig) Equal(o PeerIdleConfig) bool {
+	return c.Timeout == o.Timeout &&
+		c.MaxActive == o.MaxActive &&
+		slices.Equal(c.AlwaysOn, o.AlwaysOn)
+}
+
+// IsZero reports whether c is the zero value.
+func (c PeerIdleConfig) IsZero() bool {
+	return c.Timeout == 0 && c.MaxActive == 0 && len(c.AlwaysOn) == 0
 }
 
 func (c *Config) Equal(o *Config) bool {
@@ -40,6 +64,7 @@ func (c *Config) Equal(o *Config) bool {
 	return c.PrivateKey.Equal(o.PrivateKey) &&
 		c.MTU == o.MTU &&
 		c.NetworkLogging == o.NetworkLogging &&
+		c.PeerIdle.Equal(o.PeerIdle) &&
 		slices.Equal(c.Addresses, o.Addresses) &&
 		slices.Equal(c.DNS, o.DNS) &&
 		slices.EqualFunc(c.Peers, o.Peers, Peer.Equal)
@@ -15,7 +15,7 @@ func TestConfigEqual(t *testing.T) {
 	for sf := range rt.Fields() {
 		switch sf.Name {
 		case "Name", "NodeID", "PrivateKey", "MTU", "Addresses", "DNS", "Peers",
-			"NetworkLogging":
+			"NetworkLogging", "PeerIdle":
 			// These are compared in [Config.Equal].
 		default:
 			t.Errorf("Have you added field %q to Config.Equal? Do so if not, and then update TestConfigEqual", sf.Name)
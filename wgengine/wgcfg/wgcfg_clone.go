@@ -7,6 +7,7 @@
 
 import (
 	"net/netip"
+	"time"
 
 	"tailscale.com/types/key"
 	"tailscale.com/types/logid"
@@ -28,6 +29,7 @@ func (src *Config) Clone() *Config {
 			dst.Peers[i] = *src.Peers[i].Clone()
 		}
 	}
+	dst.PeerIdle = *src.PeerIdle.Clone()
 	return dst
 }
 
@@ -43,6 +45,7 @@ func (src *Config) Clone() *Config {
 		DomainID           logid.PrivateID
 		LogExitFlowEnabled bool
 	}
+	PeerIdle PeerIdleConfig
 }{})
 
 // Clone makes a deep copy of Peer.
@@ -73,3 +76,22 @@ func (src *Peer) Clone() *Peer {
 	IsJailed            bool
 	PersistentKeepalive uint16
 }{})
+
+// Clone makes a deep copy of PeerIdleConfig.
+// The result aliases no memory with the original.
+func (src *PeerIdleConfig) Clone() *PeerIdleConfig {
+	if src == nil {
+		return nil
+	}
+	dst := new(PeerIdleConfig)
+	*dst = *src
+	dst.AlwaysOn = append(src.AlwaysOn[:0:0], src.AlwaysOn...)
+	return dst
+}
+
+// A compilation failure here means this code must be regenerated, with the command at the top of this file.
+var _PeerIdleConfigCloneNeedsRegeneration = PeerIdleConfig(struct {
+	Timeout   time.Duration
+	MaxActive int
+	AlwaysOn  []key.NodePublic
+}{})